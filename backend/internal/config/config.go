@@ -3,9 +3,11 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds the application configuration
@@ -15,6 +17,39 @@ type Config struct {
 	JWTSecret           string
 	AccessTokenTTLMin   int
 	RefreshTokenTTLHour int
+	RateLimits          RateLimitConfig
+	Tracing             TracingConfig
+	ShutdownTimeout     time.Duration // how long in-flight requests and background work get to finish on SIGTERM
+}
+
+// RateLimit is a token bucket refilled with PerMinute requests a minute and holding at most
+// Burst; a zero PerMinute means no limit
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// RateLimitConfig sets the request limits for each client IP, each signed-in user and each
+// client IP within a route group, identified by path prefix
+type RateLimitConfig struct {
+	Enabled bool
+	PerIP   RateLimit
+	PerUser RateLimit
+	Routes  map[string]RateLimit
+}
+
+// TracingConfig sets where OpenTelemetry spans are exported. Tracing is off when no
+// endpoint is set.
+type TracingConfig struct {
+	Endpoint    string // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	Headers     map[string]string
+	ServiceName string
+	SampleRatio float64 // share of new traces recorded; requests that arrive traced follow their caller
+}
+
+// Enabled reports whether spans are exported
+func (t TracingConfig) Enabled() bool {
+	return t.Endpoint != ""
 }
 
 // LoadConfig loads configuration from environment variables
@@ -46,6 +81,9 @@ func LoadConfig() *Config {
 		JWTSecret:           getEnv("JWT_SECRET", "dev-secret-change-me"),
 		AccessTokenTTLMin:   accessTTL,
 		RefreshTokenTTLHour: refreshTTL,
+		RateLimits:          loadRateLimits(),
+		Tracing:             loadTracing(),
+		ShutdownTimeout:     loadShutdownTimeout(),
 	}
 
 	// Log configuration (excluding sensitive values)
@@ -54,10 +92,119 @@ func LoadConfig() *Config {
 	log.Printf("   Allowed Origins: %v", config.AllowedOrigins)
 	log.Printf("   JWT Access TTL (min): %d", config.AccessTokenTTLMin)
 	log.Printf("   JWT Refresh TTL (h): %d", config.RefreshTokenTTLHour)
+	log.Printf("   Rate limits enabled: %t", config.RateLimits.Enabled)
+	if config.Tracing.Enabled() {
+		log.Printf("   Tracing: exporting to %s (sample ratio %g)", config.Tracing.Endpoint, config.Tracing.SampleRatio)
+	} else {
+		log.Printf("   Tracing: disabled")
+	}
+	log.Printf("   Shutdown drain timeout: %s", config.ShutdownTimeout)
 
 	return config
 }
 
+// loadRateLimits reads ENABLE_RATE_LIMITING and the RATE_LIMIT_* settings. Route limits are given as a comma-separated
+// list of prefix=perMinute[:burst], e.g. "/auth/=30:10,/admin/=300". By default sign-in and the public webhook
+// signature check are limited.
+func loadRateLimits() RateLimitConfig {
+	limits := RateLimitConfig{
+		Enabled: getEnv("ENABLE_RATE_LIMITING", "true") == "true",
+		PerIP:   envRateLimit("RATE_LIMIT_REQUESTS_PER_MINUTE", 600, "RATE_LIMIT_BURST", 100),
+		PerUser: envRateLimit("RATE_LIMIT_USER_REQUESTS_PER_MINUTE", 1200, "RATE_LIMIT_USER_BURST", 200),
+		Routes:  make(map[string]RateLimit),
+	}
+	for _, entry := range strings.Split(getEnv("RATE_LIMIT_ROUTES", "/auth/=30:10,/webhooks/consumers/=30:10"), ",") {
+		prefix, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || prefix == "" {
+			continue
+		}
+		rate, burst, _ := strings.Cut(value, ":")
+		limit, err := parseRateLimit(rate, burst)
+		if err != nil {
+			log.Printf("⚠️ Ignoring RATE_LIMIT_ROUTES entry %q: %v", entry, err)
+			continue
+		}
+		limits.Routes[prefix] = limit
+	}
+	return limits
+}
+
+// envRateLimit reads a per-minute rate and burst, falling back to the defaults when unset or invalid
+func envRateLimit(rateKey string, defaultRate int, burstKey string, defaultBurst int) RateLimit {
+	limit, err := parseRateLimit(getEnv(rateKey, strconv.Itoa(defaultRate)), getEnv(burstKey, strconv.Itoa(defaultBurst)))
+	if err != nil {
+		log.Printf("⚠️ Invalid %s or %s, using defaults: %v", rateKey, burstKey, err)
+		return RateLimit{PerMinute: defaultRate, Burst: defaultBurst}
+	}
+	return limit
+}
+
+// parseRateLimit parses a per-minute rate and an optional burst, which defaults to the rate
+func parseRateLimit(rate, burst string) (RateLimit, error) {
+	perMinute, err := strconv.Atoi(strings.TrimSpace(rate))
+	if err != nil || perMinute < 0 {
+		return RateLimit{}, fmt.Errorf("rate %q must be a number of requests per minute", rate)
+	}
+	limit := RateLimit{PerMinute: perMinute, Burst: perMinute}
+	if burst = strings.TrimSpace(burst); burst != "" {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 1 {
+			return RateLimit{}, fmt.Errorf("burst %q must be a positive number", burst)
+		}
+	}
+	return limit, nil
+}
+
+// loadShutdownTimeout reads SHUTDOWN_TIMEOUT as a duration, e.g. "8s". The default leaves
+// room within the 10 seconds Cloud Run allows between SIGTERM and SIGKILL.
+func loadShutdownTimeout() time.Duration {
+	timeout := 8 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			log.Printf("⚠️ Ignoring SHUTDOWN_TIMEOUT %q: must be a positive duration", v)
+		} else {
+			timeout = parsed
+		}
+	}
+	return timeout
+}
+
+// loadTracing reads the standard OTEL_* exporter settings. An endpoint without a path gets the
+// OTLP traces path; headers are given as a comma-separated list of key=value.
+func loadTracing() TracingConfig {
+	tracing := TracingConfig{
+		Headers:     make(map[string]string),
+		ServiceName: getEnv("OTEL_SERVICE_NAME", "cloudgate-backend"),
+		SampleRatio: 1,
+	}
+	if endpoint := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")); endpoint != "" {
+		parsed, err := url.Parse(endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			log.Printf("⚠️ Ignoring OTEL_EXPORTER_OTLP_ENDPOINT %q: must be an http or https URL", endpoint)
+		} else {
+			if parsed.Path == "" || parsed.Path == "/" {
+				parsed.Path = "/v1/traces"
+			}
+			tracing.Endpoint = parsed.String()
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && key != "" {
+			tracing.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			log.Printf("⚠️ Invalid OTEL_TRACES_SAMPLER_ARG %q, sampling every trace: must be between 0 and 1", v)
+		} else {
+			tracing.SampleRatio = ratio
+		}
+	}
+	return tracing
+}
+
 // validateRequiredEnvVars checks if required environment variables are set for production
 func validateRequiredEnvVars() {
 	// Only validate in Cloud Run environment (when PORT is set by platform)
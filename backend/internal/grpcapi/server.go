@@ -0,0 +1,345 @@
+// Package grpcapi serves the internal gRPC API next to the REST routes, on the same service
+// layer, for internal callers sending events at high volume
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/grpcapi/eventsv1"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// accountCacheTTL is how long a certificate's service account is trusted without
+	// looking it up again, so disabling an account takes effect within this time
+	accountCacheTTL = time.Minute
+	// maxStreamErrors bounds the rejections reported back from one stream
+	maxStreamErrors = 100
+)
+
+// Server implements the EventIngestion service. Callers are authenticated by the client
+// certificate verified in the TLS handshake and mapped to a service account, whose scopes
+// decide which kinds of events it may send and whose event rate limit caps how fast.
+type Server struct {
+	eventsv1.UnimplementedEventIngestionServer
+	security *services.SecurityMonitoringService
+	accounts *services.ServiceAccountService
+	quota    *services.EventQuota
+
+	mu       sync.Mutex
+	resolved map[string]cachedAccount // by certificate fingerprint
+}
+
+type cachedAccount struct {
+	account *models.ServiceAccount
+	expires time.Time
+}
+
+// NewServer creates the event ingestion service
+func NewServer(security *services.SecurityMonitoringService, accounts *services.ServiceAccountService, quota *services.EventQuota) *Server {
+	return &Server{
+		security: security,
+		accounts: accounts,
+		quota:    quota,
+		resolved: make(map[string]cachedAccount),
+	}
+}
+
+// ServeFromEnv serves the gRPC API on GRPC_LISTEN_ADDR over mutual TLS, with the server
+// certificate in MTLS_CERT_FILE and MTLS_KEY_FILE, until ctx is done or the listener fails.
+// Calls in flight when ctx is done are allowed to finish. It returns at once when
+// GRPC_LISTEN_ADDR is not set.
+func ServeFromEnv(ctx context.Context, security *services.SecurityMonitoringService, accounts *services.ServiceAccountService) {
+	address := os.Getenv("GRPC_LISTEN_ADDR")
+	if address == "" {
+		return
+	}
+	tlsConfig, err := accounts.ServerTLSConfig(os.Getenv("MTLS_CERT_FILE"), os.Getenv("MTLS_KEY_FILE"))
+	if err != nil {
+		log.Printf("❌ gRPC listener disabled: %v", err)
+		return
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Printf("❌ gRPC listener disabled: %v", err)
+		return
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		// Reconnecting now and then re-verifies client certificates against the CA
+		grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionAge: time.Hour, MaxConnectionAgeGrace: time.Minute}),
+	)
+	eventsv1.RegisterEventIngestionServer(server, NewServer(security, accounts, services.NewEventQuota()))
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.GracefulStop()
+		case <-stopped:
+		}
+	}()
+	defer close(stopped)
+
+	log.Printf("🛰️ gRPC listener on %s", address)
+	if err := server.Serve(listener); err != nil {
+		log.Printf("❌ gRPC listener stopped: %v", err)
+	}
+}
+
+// ProcessLoginEvent processes a login event for security monitoring
+func (s *Server) ProcessLoginEvent(ctx context.Context, event *eventsv1.LoginEvent) (*eventsv1.IngestResponse, error) {
+	if _, err := s.authorizeEvent(ctx, services.ServiceScopeLoginEvents); err != nil {
+		return nil, err
+	}
+	if err := s.processLogin(ctx, event); err != nil {
+		return nil, err
+	}
+	return &eventsv1.IngestResponse{}, nil
+}
+
+// ProcessAPIEvent processes an API event for security monitoring
+func (s *Server) ProcessAPIEvent(ctx context.Context, event *eventsv1.APIEvent) (*eventsv1.IngestResponse, error) {
+	if _, err := s.authorizeEvent(ctx, services.ServiceScopeAPIEvents); err != nil {
+		return nil, err
+	}
+	if err := s.processAPI(event); err != nil {
+		return nil, err
+	}
+	return &eventsv1.IngestResponse{}, nil
+}
+
+// ProcessSecurityEvent raises a detection reported by another system as an alert
+func (s *Server) ProcessSecurityEvent(ctx context.Context, event *eventsv1.SecurityEvent) (*eventsv1.IngestResponse, error) {
+	account, err := s.authorizeEvent(ctx, services.ServiceScopeSecurityEvents)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.processSecurity(account, event); err != nil {
+		return nil, err
+	}
+	return &eventsv1.IngestResponse{}, nil
+}
+
+// StreamEvents processes a stream of mixed events, counting the ones it rejects
+func (s *Server) StreamEvents(stream eventsv1.EventIngestion_StreamEventsServer) error {
+	account, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	response := &eventsv1.StreamEventsResponse{}
+	for index := int64(0); ; index++ {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+		if !s.quota.Allow(account, time.Now()) {
+			return status.Errorf(codes.ResourceExhausted, "event rate limit exceeded after %d accepted events", response.Accepted)
+		}
+
+		if err := s.processEvent(stream.Context(), account, event); err != nil {
+			response.Rejected++
+			if len(response.Errors) < maxStreamErrors {
+				response.Errors = append(response.Errors, &eventsv1.EventError{Index: index, Message: status.Convert(err).Message()})
+			}
+			continue
+		}
+		response.Accepted++
+	}
+}
+
+func (s *Server) processEvent(ctx context.Context, account *models.ServiceAccount, event *eventsv1.Event) error {
+	switch e := event.GetEvent().(type) {
+	case *eventsv1.Event_Login:
+		if err := s.permit(account, services.ServiceScopeLoginEvents); err != nil {
+			return err
+		}
+		return s.processLogin(ctx, e.Login)
+	case *eventsv1.Event_Api:
+		if err := s.permit(account, services.ServiceScopeAPIEvents); err != nil {
+			return err
+		}
+		return s.processAPI(e.Api)
+	case *eventsv1.Event_Security:
+		if err := s.permit(account, services.ServiceScopeSecurityEvents); err != nil {
+			return err
+		}
+		return s.processSecurity(account, e.Security)
+	default:
+		return status.Error(codes.InvalidArgument, "event is empty")
+	}
+}
+
+// processLogin applies the same checks as the REST login event endpoint
+func (s *Server) processLogin(ctx context.Context, event *eventsv1.LoginEvent) error {
+	userID, err := uuid.Parse(event.GetUserId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "user_id must be a valid UUID")
+	}
+	if err := required(map[string]string{"email": event.GetEmail(), "ip_address": event.GetIpAddress(), "user_agent": event.GetUserAgent()}); err != nil {
+		return err
+	}
+
+	if err := s.security.ProcessLoginEvent(ctx, userID, event.GetEmail(), event.GetIpAddress(), event.GetUserAgent(), event.GetSuccess(), event.GetRiskScore()); err != nil {
+		return status.Errorf(codes.Internal, "failed to process login event: %v", err)
+	}
+	return nil
+}
+
+// processAPI applies the same checks as the REST API event endpoint
+func (s *Server) processAPI(event *eventsv1.APIEvent) error {
+	if err := required(map[string]string{"endpoint": event.GetEndpoint(), "method": event.GetMethod(), "ip_address": event.GetIpAddress(), "user_agent": event.GetUserAgent()}); err != nil {
+		return err
+	}
+	if event.GetStatusCode() == 0 {
+		return status.Error(codes.InvalidArgument, "status_code is required")
+	}
+
+	responseTime := time.Duration(event.GetResponseTimeMs()) * time.Millisecond
+	if err := s.security.ProcessAPIEvent(event.GetEndpoint(), event.GetMethod(), event.GetIpAddress(), event.GetUserAgent(), int(event.GetStatusCode()), responseTime); err != nil {
+		return status.Errorf(codes.Internal, "failed to process API event: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) processSecurity(account *models.ServiceAccount, event *eventsv1.SecurityEvent) error {
+	var userID *uuid.UUID
+	if event.GetUserId() != "" {
+		parsed, err := uuid.Parse(event.GetUserId())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "user_id must be a valid UUID")
+		}
+		userID = &parsed
+	}
+	severity, ok := severities[event.GetSeverity()]
+	if !ok {
+		return status.Error(codes.InvalidArgument, "severity is required")
+	}
+
+	securityEvent := services.ExternalSecurityEvent{
+		EventType:   event.GetEventType(),
+		Severity:    severity,
+		Title:       event.GetTitle(),
+		Description: event.GetDescription(),
+		UserID:      userID,
+		IPAddress:   event.GetIpAddress(),
+		Attributes:  event.GetAttributes(),
+		Source:      account.Name,
+	}
+	if event.GetOccurredAt() != nil {
+		securityEvent.OccurredAt = event.GetOccurredAt().AsTime()
+	}
+	_, err := s.security.ProcessSecurityEvent(securityEvent)
+	switch {
+	case errors.Is(err, services.ErrInvalidSecurityEvent):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return status.Errorf(codes.Internal, "failed to process security event: %v", err)
+	}
+	return nil
+}
+
+var severities = map[eventsv1.Severity]services.AlertSeverity{
+	eventsv1.Severity_SEVERITY_LOW:      services.SeverityLow,
+	eventsv1.Severity_SEVERITY_MEDIUM:   services.SeverityMedium,
+	eventsv1.Severity_SEVERITY_HIGH:     services.SeverityHigh,
+	eventsv1.Severity_SEVERITY_CRITICAL: services.SeverityCritical,
+}
+
+func required(fields map[string]string) error {
+	var missing []string
+	for name, value := range fields {
+		if strings.TrimSpace(value) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return status.Errorf(codes.InvalidArgument, "%s required", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// authorizeEvent authenticates the caller of a unary call and spends one event of its quota
+func (s *Server) authorizeEvent(ctx context.Context, scope string) (*models.ServiceAccount, error) {
+	account, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.permit(account, scope); err != nil {
+		return nil, err
+	}
+	if !s.quota.Allow(account, time.Now()) {
+		return nil, status.Error(codes.ResourceExhausted, "event rate limit exceeded")
+	}
+	return account, nil
+}
+
+func (s *Server) permit(account *models.ServiceAccount, scope string) error {
+	if !services.HasScope(account, scope) {
+		return status.Errorf(codes.PermissionDenied, "service account %s lacks the %s scope", account.Name, scope)
+	}
+	return nil
+}
+
+// authenticate maps the client certificate of the call's connection to its service account
+func (s *Server) authenticate(ctx context.Context) (*models.ServiceAccount, error) {
+	client, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+	tlsInfo, ok := client.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+	certificate := tlsInfo.State.PeerCertificates[0]
+	fingerprint := services.CertificateFingerprint(certificate)
+
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.resolved[fingerprint]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.account, nil
+	}
+
+	account, err := s.accounts.AuthenticateCertificate(certificate, now)
+	if err != nil {
+		services.LogAuditEvent(ctx, "", "service_authentication_failed", "service_account", "", client.Addr.String(), "grpc", err.Error(), "failure")
+		switch {
+		case errors.Is(err, services.ErrServiceAccountDisabled):
+			return nil, status.Error(codes.PermissionDenied, "service account disabled")
+		case errors.Is(err, services.ErrServiceAccountUnknown):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		default:
+			log.Printf("Error authenticating gRPC service account: %v", err)
+			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to authenticate service: %v", err))
+		}
+	}
+
+	s.mu.Lock()
+	s.resolved[fingerprint] = cachedAccount{account: account, expires: now.Add(accountCacheTTL)}
+	s.mu.Unlock()
+	return account, nil
+}
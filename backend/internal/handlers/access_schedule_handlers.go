@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AccessScheduleHandlers contains per-app access schedule HTTP handlers
+type AccessScheduleHandlers struct {
+	scheduleService *services.AccessScheduleService
+}
+
+// NewAccessScheduleHandlers creates new access schedule handlers
+func NewAccessScheduleHandlers(scheduleService *services.AccessScheduleService) *AccessScheduleHandlers {
+	return &AccessScheduleHandlers{
+		scheduleService: scheduleService,
+	}
+}
+
+// SetAccessScheduleRequest represents an admin's schedule for an app
+type SetAccessScheduleRequest struct {
+	Timezone         string   `json:"timezone"`
+	StartTime        string   `json:"start_time"`
+	EndTime          string   `json:"end_time"`
+	Days             []string `json:"days"`
+	AllowedCountries []string `json:"allowed_countries"`
+	Enabled          *bool    `json:"enabled"`
+}
+
+// RequestAccessOverrideRequest represents a user's request to bypass a schedule
+type RequestAccessOverrideRequest struct {
+	Reason          string `json:"reason" binding:"required"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+// ReviewAccessOverrideRequest represents an admin's decision on an override
+type ReviewAccessOverrideRequest struct {
+	Note string `json:"note"`
+}
+
+// ListSchedules returns all app access schedules
+func (h *AccessScheduleHandlers) ListSchedules(c *gin.Context) {
+	schedules, err := h.scheduleService.ListSchedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list schedules", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "count": len(schedules)})
+}
+
+// GetSchedule returns the access schedule for an app
+func (h *AccessScheduleHandlers) GetSchedule(c *gin.Context) {
+	schedule, err := h.scheduleService.GetSchedule(c.Param("appId"))
+	if errors.Is(err, services.ErrScheduleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No access schedule for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get schedule", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+// SetSchedule creates or replaces the access schedule for an app
+func (h *AccessScheduleHandlers) SetSchedule(c *gin.Context) {
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req SetAccessScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	schedule, err := h.scheduleService.SetSchedule(appID, services.AccessScheduleInput{
+		Timezone:         req.Timezone,
+		StartTime:        req.StartTime,
+		EndTime:          req.EndTime,
+		Days:             req.Days,
+		AllowedCountries: req.AllowedCountries,
+		Enabled:          enabled,
+	}, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidSchedule) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schedule", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+// DeleteSchedule removes the access schedule for an app
+func (h *AccessScheduleHandlers) DeleteSchedule(c *gin.Context) {
+	err := h.scheduleService.DeleteSchedule(c.Param("appId"), getAnalystID(c))
+	if errors.Is(err, services.ErrScheduleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No access schedule for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access schedule removed"})
+}
+
+// RequestOverride lets a user ask for access to an app outside its schedule
+func (h *AccessScheduleHandlers) RequestOverride(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req RequestAccessOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	request, err := h.scheduleService.RequestOverride(*userID, appID, req.Reason, time.Duration(req.DurationMinutes)*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request override", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"override": request})
+}
+
+// ListOverrides returns override requests, filtered by ?status=
+func (h *AccessScheduleHandlers) ListOverrides(c *gin.Context) {
+	requests, err := h.scheduleService.ListOverrides(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list overrides", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"overrides": requests, "count": len(requests)})
+}
+
+// ApproveOverride grants a pending override request
+func (h *AccessScheduleHandlers) ApproveOverride(c *gin.Context) {
+	h.reviewOverride(c, true)
+}
+
+// DenyOverride rejects a pending override request
+func (h *AccessScheduleHandlers) DenyOverride(c *gin.Context) {
+	h.reviewOverride(c, false)
+}
+
+func (h *AccessScheduleHandlers) reviewOverride(c *gin.Context, approve bool) {
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid override ID"})
+		return
+	}
+
+	var req ReviewAccessOverrideRequest
+	// The note is optional, so an empty body is fine
+	_ = c.ShouldBindJSON(&req)
+
+	request, err := h.scheduleService.ReviewOverride(requestID, approve, getAnalystID(c), req.Note)
+	switch {
+	case errors.Is(err, services.ErrOverrideNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Override request not found"})
+		return
+	case errors.Is(err, services.ErrOverrideAlreadyReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Override request already reviewed"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review override", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"override": request})
+}
+
+// RequireAccessSchedule blocks token issuance for an app outside its access schedule
+func (h *AccessScheduleHandlers) RequireAccessSchedule(appID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !checkAccessSchedule(c, h.scheduleService, userID.(uuid.UUID), appID) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkAccessSchedule writes an outside_access_schedule response and returns false when the app is off-limits
+func checkAccessSchedule(c *gin.Context, scheduleService *services.AccessScheduleService, userID uuid.UUID, appID string) bool {
+	result, err := scheduleService.CheckAccess(userID, appID, requestCountry(c), time.Now())
+	if err != nil {
+		log.Printf("Error checking access schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify access schedule"})
+		return false
+	}
+	if !result.Allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":        "outside_access_schedule",
+			"message":      result.Reason,
+			"app_id":       appID,
+			"override_url": "/apps/" + appID + "/access-override",
+		})
+		return false
+	}
+	return true
+}
+
+// requestCountry returns the caller's ISO country code. A trusted edge proxy may supply it
+// in the header named by GEO_COUNTRY_HEADER (e.g. CF-IPCountry); otherwise we geolocate the IP.
+func requestCountry(c *gin.Context) string {
+	if header := getEnv("GEO_COUNTRY_HEADER", ""); header != "" {
+		if country := c.GetHeader(header); len(country) == 2 {
+			return country
+		}
+	}
+	if country := performGeolocation(c.Request.Context(), c.ClientIP()).Country; len(country) == 2 {
+		return country
+	}
+	return ""
+}
@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 )
 
@@ -52,7 +53,7 @@ type LocationRequest struct {
 type EvaluateAuthenticationResponse struct {
 	Decision        string                    `json:"decision"`
 	RiskScore       float64                   `json:"risk_score"`
-	RiskLevel       string                    `json:"risk_level"`
+	RiskLevel       models.RiskLevel          `json:"risk_level"`
 	RequiredActions []AuthActionResponse      `json:"required_actions"`
 	Reasoning       []string                  `json:"reasoning"`
 	SessionDuration int64                     `json:"session_duration_seconds"`
@@ -113,21 +114,10 @@ func (h *AdaptiveAuthHandlers) EvaluateAuthentication(c *gin.Context) {
 	}
 
 	// Convert location if provided
-	if req.Location != nil {
-		authContext.Location = &services.GeoLocation{
-			Country:     req.Location.Country,
-			Region:      req.Location.Region,
-			City:        req.Location.City,
-			Latitude:    req.Location.Latitude,
-			Longitude:   req.Location.Longitude,
-			ISP:         req.Location.ISP,
-			Timezone:    req.Location.Timezone,
-			VPNDetected: req.Location.VPNDetected,
-		}
-	}
+	authContext.Location = req.Location.geoLocation()
 
 	// Evaluate authentication
-	decision, err := h.adaptiveAuthService.EvaluateAuthentication(authContext)
+	decision, err := h.adaptiveAuthService.EvaluateAuthentication(c.Request.Context(), authContext)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Authentication evaluation failed",
@@ -136,7 +126,103 @@ func (h *AdaptiveAuthHandlers) EvaluateAuthentication(c *gin.Context) {
 		return
 	}
 
-	// Convert decision to response format
+	c.JSON(http.StatusOK, newEvaluateAuthenticationResponse(decision))
+}
+
+// SimulateAuthenticationRequest is a hypothetical login; only the user is required
+type SimulateAuthenticationRequest struct {
+	UserID            string                 `json:"user_id" binding:"required"`
+	Email             string                 `json:"email"`
+	IPAddress         string                 `json:"ip_address"`
+	UserAgent         string                 `json:"user_agent"`
+	DeviceFingerprint string                 `json:"device_fingerprint"`
+	Location          *LocationRequest       `json:"location,omitempty"`
+	LoginTime         *time.Time             `json:"login_time,omitempty"` // defaults to now
+	SessionInfo       map[string]interface{} `json:"session_info,omitempty"`
+	RequestHeaders    map[string]string      `json:"request_headers,omitempty"`
+	ApplicationID     string                 `json:"application_id,omitempty"`
+}
+
+// SimulateAuthenticationResponse is the decision a hypothetical login would get and why
+type SimulateAuthenticationResponse struct {
+	Decision       *EvaluateAuthenticationResponse `json:"decision"`
+	RiskFactors    *services.RiskFactors           `json:"risk_factors"`
+	TriggeredRules []services.TriggeredRiskRule    `json:"triggered_rules"`
+	Context        *services.AuthContext           `json:"context"`
+}
+
+// SimulateAuthentication returns the decision a hypothetical login would get, with the risk
+// factors and rules behind it, without recording the assessment or raising security events
+func (h *AdaptiveAuthHandlers) SimulateAuthentication(c *gin.Context) {
+	var req SimulateAuthenticationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"message": "User ID must be a valid UUID",
+		})
+		return
+	}
+
+	authContext := &services.AuthContext{
+		UserID:            userID,
+		Email:             req.Email,
+		IPAddress:         req.IPAddress,
+		UserAgent:         req.UserAgent,
+		DeviceFingerprint: req.DeviceFingerprint,
+		Location:          req.Location.geoLocation(),
+		SessionInfo:       req.SessionInfo,
+		RequestHeaders:    req.RequestHeaders,
+		ApplicationID:     req.ApplicationID,
+	}
+	if req.LoginTime != nil {
+		authContext.LoginTime = *req.LoginTime
+	}
+
+	simulation, err := h.adaptiveAuthService.SimulateAuthentication(c.Request.Context(), authContext)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Authentication simulation failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SimulateAuthenticationResponse{
+		Decision:       newEvaluateAuthenticationResponse(simulation.Decision),
+		RiskFactors:    simulation.RiskFactors,
+		TriggeredRules: simulation.TriggeredRules,
+		Context:        simulation.Context,
+	})
+}
+
+// geoLocation converts a location from a request, which may be absent
+func (l *LocationRequest) geoLocation() *services.GeoLocation {
+	if l == nil {
+		return nil
+	}
+	return &services.GeoLocation{
+		Country:     l.Country,
+		Region:      l.Region,
+		City:        l.City,
+		Latitude:    l.Latitude,
+		Longitude:   l.Longitude,
+		ISP:         l.ISP,
+		Timezone:    l.Timezone,
+		VPNDetected: l.VPNDetected,
+	}
+}
+
+// newEvaluateAuthenticationResponse converts a decision to response format
+func newEvaluateAuthenticationResponse(decision *services.AuthDecision) *EvaluateAuthenticationResponse {
 	response := &EvaluateAuthenticationResponse{
 		Decision:        string(decision.Decision),
 		RiskScore:       decision.RiskScore,
@@ -170,12 +256,12 @@ func (h *AdaptiveAuthHandlers) EvaluateAuthentication(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	return response
 }
 
 // GetRiskAssessmentHistory retrieves risk assessment history for a user
 func (h *AdaptiveAuthHandlers) GetRiskAssessmentHistory(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID := c.Param("userId")
 	if userID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Missing user ID",
@@ -185,7 +271,8 @@ func (h *AdaptiveAuthHandlers) GetRiskAssessmentHistory(c *gin.Context) {
 	}
 
 	// Validate user ID format
-	if _, err := uuid.Parse(userID); err != nil {
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid user ID",
 			"message": "User ID must be a valid UUID",
@@ -193,15 +280,14 @@ func (h *AdaptiveAuthHandlers) GetRiskAssessmentHistory(c *gin.Context) {
 		return
 	}
 
-	// Get limit parameter
-	limitStr := c.DefaultQuery("limit", "10")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 100 {
-		limit = 10
+	// Filter expression, sort and pagination
+	page, ok := parseListPage(c, services.RiskAssessmentFilterSchema, 10, 100)
+	if !ok {
+		return
 	}
 
 	// Get risk assessment history
-	history, err := services.GetRiskAssessmentHistory(userID, limit)
+	history, total, err := services.ListRiskAssessments(c.Request.Context(), userUUID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to retrieve risk assessment history",
@@ -212,7 +298,9 @@ func (h *AdaptiveAuthHandlers) GetRiskAssessmentHistory(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"user_id": userID,
-		"limit":   limit,
+		"limit":   page.Limit,
+		"offset":  page.Offset,
+		"total":   total,
 		"history": history,
 	})
 }
@@ -238,7 +326,7 @@ func (h *AdaptiveAuthHandlers) GetLatestRiskAssessment(c *gin.Context) {
 	}
 
 	// Get latest risk assessment
-	assessment, err := services.GetLatestRiskAssessment(userID)
+	assessment, err := services.GetLatestRiskAssessment(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to retrieve latest risk assessment",
@@ -404,3 +492,60 @@ func (h *AdaptiveAuthHandlers) CheckDeviceStatus(c *gin.Context) {
 		},
 	})
 }
+
+// RequireRouteRisk applies risk-based conditional access to a route group. Each request
+// is scored against the group's sensitivity; risky sessions must step up or are denied.
+// Must run after AuthenticationMiddleware.
+func (h *AdaptiveAuthHandlers) RequireRouteRisk(sensitivity services.RouteSensitivity) gin.HandlerFunc {
+	policy := services.RoutePolicyFor(sensitivity)
+
+	return func(c *gin.Context) {
+		if policy.Sensitivity == services.RouteSensitivityLow {
+			c.Next()
+			return
+		}
+
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.Next()
+			return
+		}
+
+		riskCtx := &services.RequestRiskContext{
+			UserID:    userID.(uuid.UUID),
+			IPAddress: c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			AAL:       c.GetInt("aal"),
+		}
+		if sessionID, ok := c.Get("sessionID"); ok {
+			sid := sessionID.(uuid.UUID)
+			riskCtx.SessionID = &sid
+		}
+
+		decision := h.adaptiveAuthService.EvaluateRequestAccess(c.Request.Context(), riskCtx, policy)
+		c.Set("requestRisk", decision.RiskScore)
+
+		switch decision.Decision {
+		case services.AuthDecisionDeny:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "access_denied",
+				"message":    "Request blocked by risk-based access policy",
+				"risk_score": decision.RiskScore,
+				"reasons":    decision.Reasons,
+			})
+			c.Abort()
+			return
+		case services.AuthDecisionChallenge:
+			middleware.ChallengeStepUp(c, gin.H{
+				"message":      "Session risk exceeds this endpoint's tolerance; re-authenticate with a stronger method",
+				"current_aal":  riskCtx.AAL,
+				"required_aal": decision.RequiredAAL,
+				"risk_score":   decision.RiskScore,
+				"reasons":      decision.Reasons,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AlertEmailHandlers contains the endpoint behind the acknowledge and escalate links in
+// alert emails
+type AlertEmailHandlers struct {
+	links *services.AlertEmailLinks
+}
+
+// NewAlertEmailHandlers creates new alert email handlers
+func NewAlertEmailHandlers(links *services.AlertEmailLinks) *AlertEmailHandlers {
+	return &AlertEmailHandlers{links: links}
+}
+
+// ConfirmAction shows a page confirming a link's action. Mail scanners fetch links in
+// emails, so the GET only checks the link and the action is taken by the page's POST.
+func (h *AlertEmailHandlers) ConfirmAction(c *gin.Context) {
+	link, ok := alertEmailLink(c, c.Query)
+	if !ok {
+		return
+	}
+	if err := h.links.Verify(link, time.Now()); err != nil {
+		alertEmailPage(c, http.StatusBadRequest, "Link expired", "This link has expired or is invalid. Open the alert in the CloudGate console instead.")
+		return
+	}
+
+	form := fmt.Sprintf(`<form method="post">
+    <input type="hidden" name="action" value="%s" />
+    <input type="hidden" name="recipient" value="%s" />
+    <input type="hidden" name="expires" value="%s" />
+    <input type="hidden" name="signature" value="%s" />
+    <input type="submit" value="%s alert" />
+</form>`, html.EscapeString(link.Action), html.EscapeString(link.Recipient), html.EscapeString(link.Expires),
+		html.EscapeString(link.Signature), alertEmailVerb(link.Action, false))
+	alertEmailPage(c, http.StatusOK, alertEmailVerb(link.Action, false)+" alert "+link.AlertID.String()+"?", form)
+}
+
+// ApplyAction acknowledges or escalates the alert and records who clicked from where
+func (h *AlertEmailHandlers) ApplyAction(c *gin.Context) {
+	link, ok := alertEmailLink(c, c.PostForm)
+	if !ok {
+		return
+	}
+
+	alert, err := h.links.Apply(c.Request.Context(), link, c.ClientIP(), c.GetHeader("User-Agent"), time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAlertLink):
+			alertEmailPage(c, http.StatusBadRequest, "Link expired", "This link has expired or is invalid. Open the alert in the CloudGate console instead.")
+		case errors.Is(err, services.ErrAlertLinkUsed):
+			alertEmailPage(c, http.StatusConflict, "Link already used", "This link has already been used.")
+		case errors.Is(err, services.ErrAlertNotFound):
+			alertEmailPage(c, http.StatusNotFound, "Alert not found", "This alert no longer exists.")
+		case errors.Is(err, services.ErrAlertClosed):
+			alertEmailPage(c, http.StatusConflict, "Alert closed", "This alert has already been resolved.")
+		default:
+			log.Printf("Error applying alert email link: %v", err)
+			alertEmailPage(c, http.StatusInternalServerError, "Something went wrong", "The alert was not updated. Please try again or use the CloudGate console.")
+		}
+		return
+	}
+
+	alertEmailPage(c, http.StatusOK, "Alert "+alertEmailVerb(link.Action, true),
+		fmt.Sprintf("%s is now %s with %s severity.", html.EscapeString(alert.Title), alert.Status, alert.Severity))
+}
+
+// alertEmailLink reads a link's parameters with get, answering 400 for a malformed alert ID
+func alertEmailLink(c *gin.Context, get func(string) string) (services.AlertEmailLink, bool) {
+	alertID, err := uuid.Parse(c.Param("alert_id"))
+	if err != nil {
+		alertEmailPage(c, http.StatusBadRequest, "Invalid link", "This link is not a CloudGate alert link.")
+		return services.AlertEmailLink{}, false
+	}
+	return services.AlertEmailLink{
+		AlertID:   alertID,
+		Action:    get("action"),
+		Recipient: get("recipient"),
+		Expires:   get("expires"),
+		Signature: get("signature"),
+	}, true
+}
+
+func alertEmailVerb(action string, past bool) string {
+	switch {
+	case action == services.AlertEmailEscalate && past:
+		return "escalated"
+	case action == services.AlertEmailEscalate:
+		return "Escalate"
+	case past:
+		return "acknowledged"
+	default:
+		return "Acknowledge"
+	}
+}
+
+// alertEmailPage renders a minimal page; body must already be escaped
+func alertEmailPage(c *gin.Context, status int, title, body string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(status, `<!DOCTYPE html>
+<html>
+<head>
+    <title>CloudGate - %s</title>
+</head>
+<body>
+    <h1>%s</h1>
+    %s
+</body>
+</html>`, html.EscapeString(title), html.EscapeString(title), body)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// alertStreamWriteWait bounds each write to a dashboard
+	alertStreamWriteWait = 10 * time.Second
+	// alertStreamPongWait is how long a dashboard may stay silent before it is dropped
+	alertStreamPongWait = 60 * time.Second
+	// alertStreamPingPeriod keeps idle connections and the proxies in front of them alive
+	alertStreamPingPeriod = alertStreamPongWait * 9 / 10
+)
+
+// AlertStreamHandlers streams security alerts to dashboards over WebSocket
+type AlertStreamHandlers struct {
+	security *services.SecurityMonitoringService
+	upgrader websocket.Upgrader
+}
+
+// NewAlertStreamHandlers creates new alert stream handlers. Browsers send the session cookie
+// with the handshake, so only allowlisted origins may upgrade.
+func NewAlertStreamHandlers(security *services.SecurityMonitoringService, allowedOrigins []string) *AlertStreamHandlers {
+	origins := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origins[origin] = true
+	}
+	return &AlertStreamHandlers{
+		security: security,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 4096,
+			CheckOrigin: func(r *http.Request) bool {
+				// Clients other than browsers send no Origin and authenticate with a bearer token
+				origin := r.Header.Get("Origin")
+				return origin == "" || origins[origin]
+			},
+		},
+	}
+}
+
+// StreamAlerts upgrades an authenticated request to a WebSocket and pushes each security
+// alert to it as JSON until either side closes the connection
+func (h *AlertStreamHandlers) StreamAlerts(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		log.Printf("⚠️ Alert stream upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	subscriberID := "ws:" + uuid.New().String()
+	alerts := h.security.Subscribe(subscriberID)
+	defer h.security.Unsubscribe(subscriberID)
+
+	userID, _ := c.Get("userID")
+	log.Printf("📡 Alert stream opened for user %v", userID)
+	defer log.Printf("📡 Alert stream closed for user %v", userID)
+
+	// Dashboards only listen; reading handles pongs and notices when the client goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(alertStreamPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(alertStreamPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(alertStreamPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case alert, ok := <-alerts:
+			conn.SetWriteDeadline(time.Now().Add(alertStreamWriteWait))
+			if !ok {
+				// The monitoring service is shutting down
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+				return
+			}
+			if err := conn.WriteJSON(gin.H{"type": "alert", "alert": alert}); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(alertStreamWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
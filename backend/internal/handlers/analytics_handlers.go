@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnalyticsHandlers contains usage analytics HTTP handlers
+type AnalyticsHandlers struct {
+	analyticsService *services.AnalyticsService
+}
+
+// NewAnalyticsHandlers creates new analytics handlers
+func NewAnalyticsHandlers(analyticsService *services.AnalyticsService) *AnalyticsHandlers {
+	return &AnalyticsHandlers{
+		analyticsService: analyticsService,
+	}
+}
+
+// parseAnalyticsRange reads the "days" query parameter (default 30, max 365)
+func parseAnalyticsRange(c *gin.Context) (time.Time, time.Time, int) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		days = 30
+	}
+	end := time.Now().UTC()
+	start := end.Add(-time.Duration(days) * 24 * time.Hour)
+	return start, end, days
+}
+
+// GetAppUsage returns launch totals per app, most used first
+func (h *AnalyticsHandlers) GetAppUsage(c *gin.Context) {
+	start, end, days := parseAnalyticsRange(c)
+
+	usage, err := h.analyticsService.GetAppUsage(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get app usage", "message": err.Error()})
+		return
+	}
+
+	var unused []string
+	for _, app := range usage {
+		if app.Launches == 0 {
+			unused = append(unused, app.AppID)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apps":        usage,
+		"unused_apps": unused,
+		"days":        days,
+	})
+}
+
+// GetDailyAppUsage returns daily launches and active users per app
+func (h *AnalyticsHandlers) GetDailyAppUsage(c *gin.Context) {
+	start, end, days := parseAnalyticsRange(c)
+
+	daily, err := h.analyticsService.GetDailyAppUsage(c.Query("app_id"), start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get daily usage", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"daily": daily,
+		"days":  days,
+	})
+}
+
+// GetSSOActivity returns the daily sign-in trend
+func (h *AnalyticsHandlers) GetSSOActivity(c *gin.Context) {
+	start, end, days := parseAnalyticsRange(c)
+
+	activity, err := h.analyticsService.GetSSOActivity(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get SSO activity", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity": activity,
+		"days":     days,
+	})
+}
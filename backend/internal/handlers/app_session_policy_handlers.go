@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AppSessionPolicyHandlers contains per-app session policy HTTP handlers
+type AppSessionPolicyHandlers struct {
+	policyService *services.AppSessionPolicyService
+}
+
+// NewAppSessionPolicyHandlers creates new app session policy handlers
+func NewAppSessionPolicyHandlers(policyService *services.AppSessionPolicyService) *AppSessionPolicyHandlers {
+	return &AppSessionPolicyHandlers{
+		policyService: policyService,
+	}
+}
+
+// SetAppSessionPolicyRequest represents an admin's session rules for an app
+type SetAppSessionPolicyRequest struct {
+	MaxSessionMinutes      int   `json:"max_session_minutes"`
+	IdleTimeoutMinutes     int   `json:"idle_timeout_minutes"`
+	ReauthAfterMinutes     int   `json:"reauth_after_minutes"`
+	AllowedAALs            []int `json:"allowed_aals"`
+	RequireCompliantDevice bool  `json:"require_compliant_device"`
+}
+
+// ListPolicies returns all app session policies
+func (h *AppSessionPolicyHandlers) ListPolicies(c *gin.Context) {
+	policies, err := h.policyService.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list session policies", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "count": len(policies)})
+}
+
+// GetPolicy returns the session policy for an app
+func (h *AppSessionPolicyHandlers) GetPolicy(c *gin.Context) {
+	policy, err := h.policyService.GetPolicy(c.Param("appId"))
+	if errors.Is(err, services.ErrSessionPolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No session policy for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session policy", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// SetPolicy creates or replaces the session policy for an app
+func (h *AppSessionPolicyHandlers) SetPolicy(c *gin.Context) {
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req SetAppSessionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	policy, err := h.policyService.SetPolicy(appID, services.AppSessionPolicyInput{
+		MaxSessionMinutes:      req.MaxSessionMinutes,
+		IdleTimeoutMinutes:     req.IdleTimeoutMinutes,
+		ReauthAfterMinutes:     req.ReauthAfterMinutes,
+		AllowedAALs:            req.AllowedAALs,
+		RequireCompliantDevice: req.RequireCompliantDevice,
+	}, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidSessionPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session policy", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session policy", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// DeletePolicy removes the session policy for an app
+func (h *AppSessionPolicyHandlers) DeletePolicy(c *gin.Context) {
+	err := h.policyService.DeletePolicy(c.Param("appId"), getAnalystID(c))
+	if errors.Is(err, services.ErrSessionPolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No session policy for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session policy", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session policy removed"})
+}
+
+// checkAppSessionPolicy writes a step_up_required, reauthentication_required,
+// auth_level_not_allowed or device_not_compliant response and returns false when the caller's session does not
+// satisfy the app's session policy. Otherwise it returns when the app session must end,
+// zero when the policy sets no limit.
+func checkAppSessionPolicy(c *gin.Context, policyService *services.AppSessionPolicyService, app *types.SaaSApplication) (time.Time, bool) {
+	var sessionID *uuid.UUID
+	if value, ok := c.Get("sessionID"); ok {
+		if id, ok := value.(uuid.UUID); ok {
+			sessionID = &id
+		}
+	}
+
+	now := time.Now()
+	result, err := policyService.CheckSession(app, sessionID, c.GetInt("aal"), now)
+	if err == nil && result.Allowed {
+		var userID uuid.UUID
+		if value, ok := c.Get("userID"); ok {
+			userID, _ = value.(uuid.UUID)
+		}
+		var device *services.AppSessionCheckResult
+		device, err = policyService.CheckDevice(app, userID, c.GetHeader("X-Device-ID"), now)
+		if err == nil && !device.Allowed {
+			result = device
+		}
+	}
+	if err != nil {
+		log.Printf("Error checking app session policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session policy"})
+		return time.Time{}, false
+	}
+	if !result.Allowed {
+		response := gin.H{
+			"error":       result.Error,
+			"message":     result.Reason,
+			"app_id":      app.ID,
+			"current_aal": c.GetInt("aal"),
+		}
+		if result.RequiredAAL > 0 {
+			response["required_aal"] = result.RequiredAAL
+		}
+		if result.Error == services.AppSessionStepUpRequired {
+			middleware.ChallengeStepUp(c, response)
+			return time.Time{}, false
+		}
+		c.JSON(http.StatusForbidden, response)
+		return time.Time{}, false
+	}
+	return result.NotOnOrAfter, true
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// auditStreamFlushEvery is how many NDJSON records are buffered before flushing to the client
+const auditStreamFlushEvery = 500
+
+// AuditExportHandlers contains signed audit export HTTP handlers
+type AuditExportHandlers struct {
+	exportService *services.AuditExportService
+}
+
+// NewAuditExportHandlers creates new audit export handlers
+func NewAuditExportHandlers(exportService *services.AuditExportService) *AuditExportHandlers {
+	return &AuditExportHandlers{
+		exportService: exportService,
+	}
+}
+
+// CreateAuditExportRequest represents the time range and filters of an export
+type CreateAuditExportRequest struct {
+	StartTime time.Time `json:"start_time" binding:"required"`
+	EndTime   time.Time `json:"end_time" binding:"required"`
+	UserID    string    `json:"user_id"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Status    string    `json:"status"`
+	Async     bool      `json:"async"` // run as a background job and answer 202 with the job
+}
+
+// VerifyAuditExportRequest represents a manifest a recipient wants checked. The manifest
+// must be the exact bytes that were signed; content_sha256 is the hash of the export file
+// the recipient holds, if they want it checked against the manifest.
+type VerifyAuditExportRequest struct {
+	Manifest      json.RawMessage `json:"manifest" binding:"required"`
+	Signature     string          `json:"signature" binding:"required"`
+	ContentSHA256 string          `json:"content_sha256"`
+}
+
+// CreateExport exports matching audit logs and signs a manifest for them, or with "async"
+// queues the export as a background job
+func (h *AuditExportHandlers) CreateExport(c *gin.Context) {
+	var req CreateAuditExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	filters := services.AuditExportFilters{
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Action:    req.Action,
+		Resource:  req.Resource,
+		Status:    req.Status,
+	}
+	userID, ok := parseOptionalUUID(c, &req.UserID, "user_id")
+	if !ok {
+		return
+	}
+	filters.UserID = userID
+	exporter := services.AuditExportExporter{
+		UserID: getAnalystID(c),
+		Email:  c.GetString("email"),
+	}
+
+	if req.Async {
+		job, err := h.exportService.StartExport(filters, exporter)
+		switch {
+		case errors.Is(err, services.ErrInvalidAuditExport):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export", "message": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export", "message": err.Error()})
+		default:
+			c.JSON(http.StatusAccepted, gin.H{"job": job})
+		}
+		return
+	}
+
+	export, err := h.exportService.CreateExport(filters, exporter)
+	switch {
+	case errors.Is(err, services.ErrInvalidAuditExport), errors.Is(err, services.ErrAuditExportTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export", "message": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"export":    export,
+		"manifest":  json.RawMessage(export.Manifest),
+		"signature": export.Signature,
+	})
+}
+
+// ListAuditLogs returns a page of audit logs for the audit console, narrowed by a filter
+// expression over services.AuditLogFilterSchema in ?filter= and ordered by ?sort=
+func (h *AuditExportHandlers) ListAuditLogs(c *gin.Context) {
+	page, ok := parseListPage(c, services.AuditLogFilterSchema, 50, 500)
+	if !ok {
+		return
+	}
+	logs, total, err := h.exportService.ListLogs(c.Request.Context(), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit logs", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"audit_logs": logs,
+		"count":      len(logs),
+		"total":      total,
+		"limit":      page.Limit,
+		"offset":     page.Offset,
+	})
+}
+
+// StreamAuditLogs streams matching audit logs as NDJSON, one record per line, straight from
+// a database cursor. Unlike CreateExport there is no record cap and nothing is signed; it is
+// meant for bulk pulls into a SIEM or data warehouse. Filters are query parameters:
+// ?start_time=&end_time= (RFC3339, required) and optional user_id, action, resource, status.
+func (h *AuditExportHandlers) StreamAuditLogs(c *gin.Context) {
+	startTime, err := time.Parse(time.RFC3339, c.Query("start_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time", "message": "start_time must be RFC3339"})
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time", "message": "end_time must be RFC3339"})
+		return
+	}
+	filters := services.AuditExportFilters{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Action:    c.Query("action"),
+		Resource:  c.Query("resource"),
+		Status:    c.Query("status"),
+	}
+	rawUserID := c.Query("user_id")
+	userID, ok := parseOptionalUUID(c, &rawUserID, "user_id")
+	if !ok {
+		return
+	}
+	filters.UserID = userID
+
+	// Headers are written with the first record so that errors raised before any output,
+	// such as an inverted time range, still get a proper status code
+	encoder := json.NewEncoder(c.Writer)
+	written := 0
+	err = h.exportService.StreamLogs(c.Request.Context(), filters, func(auditLog *models.AuditLog) error {
+		if written == 0 {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-logs-%s.ndjson", startTime.UTC().Format("20060102T150405Z")))
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(auditLog); err != nil {
+			return err
+		}
+		written++
+		if written%auditStreamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil && written == 0:
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+	case err == nil:
+		c.Writer.Flush()
+	case written > 0:
+		// The status is already sent, so the failure is reported in-band as a final line
+		log.Printf("Audit log stream aborted after %d records: %v", written, err)
+		encoder.Encode(gin.H{"error": "stream aborted", "message": err.Error(), "records": written})
+		c.Writer.Flush()
+	case errors.Is(err, services.ErrInvalidAuditExport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time range", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stream audit logs", "message": err.Error()})
+	}
+}
+
+// ListExports returns export jobs, newest first
+func (h *AuditExportHandlers) ListExports(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	exports, total, err := h.exportService.ListExports(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exports", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": exports, "total": total, "limit": limit, "offset": offset})
+}
+
+// GetManifest returns the signed manifest of an export
+func (h *AuditExportHandlers) GetManifest(c *gin.Context) {
+	export, ok := h.loadExport(c)
+	if !ok {
+		return
+	}
+
+	publicKey, keyID := h.exportService.PublicKey()
+	c.JSON(http.StatusOK, gin.H{
+		"manifest":   json.RawMessage(export.Manifest),
+		"signature":  export.Signature,
+		"key_id":     export.KeyID,
+		"public_key": publicKey,
+		"current":    export.KeyID == keyID,
+	})
+}
+
+// DownloadExport returns the export file exactly as it was hashed
+func (h *AuditExportHandlers) DownloadExport(c *gin.Context) {
+	export, ok := h.loadExport(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-export-%s.json", export.ID))
+	c.Header("X-Content-SHA256", export.ContentSHA256)
+	c.Data(http.StatusOK, "application/json", []byte(export.Content))
+}
+
+// GetPublicKey returns the key recipients use to verify manifests offline
+func (h *AuditExportHandlers) GetPublicKey(c *gin.Context) {
+	publicKey, keyID := h.exportService.PublicKey()
+	c.JSON(http.StatusOK, gin.H{"algorithm": "ed25519", "key_id": keyID, "public_key": publicKey})
+}
+
+// VerifyExport checks a manifest signature and, if given, the export content against it
+func (h *AuditExportHandlers) VerifyExport(c *gin.Context) {
+	var req VerifyAuditExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	result, err := h.exportService.VerifyManifest(req.Manifest, req.Signature, req.ContentSHA256)
+	if errors.Is(err, services.ErrInvalidAuditExport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid manifest", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify manifest", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verification": result})
+}
+
+func (h *AuditExportHandlers) loadExport(c *gin.Context) (*models.AuditExport, bool) {
+	exportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return nil, false
+	}
+
+	export, err := h.exportService.GetExport(exportID)
+	if errors.Is(err, services.ErrAuditExportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audit export not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get export", "message": err.Error()})
+		return nil, false
+	}
+	return export, true
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateAuditFileExportRequest represents the time range, filters and format of a file export
+type CreateAuditFileExportRequest struct {
+	CreateAuditExportRequest
+	Format string `json:"format" binding:"required"` // csv, jsonl
+}
+
+// CreateFileExport writes matching audit logs to the object store as CSV or JSON Lines
+// and answers with a signed download URL, or with "async" queues the export as a job
+func (h *AuditExportHandlers) CreateFileExport(c *gin.Context) {
+	var req CreateAuditFileExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+	userID, ok := parseOptionalUUID(c, &req.UserID, "user_id")
+	if !ok {
+		return
+	}
+	filters := services.AuditExportFilters{
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		UserID:    userID,
+		Action:    req.Action,
+		Resource:  req.Resource,
+		Status:    req.Status,
+	}
+
+	if req.Async {
+		export, job, err := h.exportService.StartFileExport(filters, req.Format, getAnalystID(c))
+		if err != nil {
+			handleAuditFileExportError(c, "Failed to start export", err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"export": export, "job": job})
+		return
+	}
+
+	export, err := h.exportService.ExportFile(c.Request.Context(), filters, req.Format, getAnalystID(c))
+	if err != nil {
+		if export != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed", "message": err.Error(), "export": export})
+			return
+		}
+		handleAuditFileExportError(c, "Failed to create export", err)
+		return
+	}
+	downloadURL, _, err := h.exportService.FileExportURL(export.ID, time.Now())
+	if err != nil {
+		handleAuditFileExportError(c, "Failed to sign download URL", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"export": export, "download_url": downloadURL})
+}
+
+// ListFileExports returns file exports newest first, narrowed to one schedule by ?schedule_id=
+func (h *AuditExportHandlers) ListFileExports(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	rawScheduleID := c.Query("schedule_id")
+	scheduleID, ok := parseOptionalUUID(c, &rawScheduleID, "schedule_id")
+	if !ok {
+		return
+	}
+
+	exports, total, err := h.exportService.ListFileExports(scheduleID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exports", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": exports, "total": total, "limit": limit, "offset": offset})
+}
+
+// GetFileExport returns a file export's status, size and hash
+func (h *AuditExportHandlers) GetFileExport(c *gin.Context) {
+	exportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+	export, err := h.exportService.GetFileExport(exportID)
+	if err != nil {
+		handleAuditFileExportError(c, "Failed to get export", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": export})
+}
+
+// GetFileExportDownloadURL returns a short-lived signed URL for a completed file export
+func (h *AuditExportHandlers) GetFileExportDownloadURL(c *gin.Context) {
+	exportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+	downloadURL, export, err := h.exportService.FileExportURL(exportID, time.Now())
+	if err != nil {
+		handleAuditFileExportError(c, "Failed to sign download URL", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"download_url": downloadURL, "content_sha256": export.ContentSHA256})
+}
+
+// ListExportSchedules returns all scheduled exports
+func (h *AuditExportHandlers) ListExportSchedules(c *gin.Context) {
+	schedules, err := h.exportService.ListSchedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get export schedules", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "count": len(schedules)})
+}
+
+// GetExportSchedule returns a scheduled export with its filters
+func (h *AuditExportHandlers) GetExportSchedule(c *gin.Context) {
+	scheduleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export schedule ID"})
+		return
+	}
+	schedule, err := h.exportService.GetSchedule(scheduleID)
+	if err != nil {
+		handleAuditFileExportError(c, "Failed to get export schedule", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+// CreateExportSchedule saves a new recurring export
+func (h *AuditExportHandlers) CreateExportSchedule(c *gin.Context) {
+	var definition services.AuditExportScheduleDefinition
+	if err := c.ShouldBindJSON(&definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+	schedule, err := h.exportService.CreateSchedule(definition, getAnalystID(c))
+	if err != nil {
+		handleAuditFileExportError(c, "Failed to create export schedule", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"schedule": schedule})
+}
+
+// UpdateExportSchedule replaces a recurring export's definition
+func (h *AuditExportHandlers) UpdateExportSchedule(c *gin.Context) {
+	scheduleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export schedule ID"})
+		return
+	}
+	var definition services.AuditExportScheduleDefinition
+	if err := c.ShouldBindJSON(&definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+	schedule, err := h.exportService.UpdateSchedule(scheduleID, definition, getAnalystID(c))
+	if err != nil {
+		handleAuditFileExportError(c, "Failed to update export schedule", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+// DeleteExportSchedule stops a recurring export; files it already wrote are kept
+func (h *AuditExportHandlers) DeleteExportSchedule(c *gin.Context) {
+	scheduleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export schedule ID"})
+		return
+	}
+	if err := h.exportService.DeleteSchedule(scheduleID, getAnalystID(c)); err != nil {
+		handleAuditFileExportError(c, "Failed to delete export schedule", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Export schedule deleted successfully"})
+}
+
+func handleAuditFileExportError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAuditExport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export", "message": err.Error()})
+	case errors.Is(err, services.ErrAuditExportNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": "Export not ready", "message": err.Error()})
+	case errors.Is(err, services.ErrAuditExportScheduleExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Export schedule already exists", "message": err.Error()})
+	case errors.Is(err, services.ErrAuditExportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audit export not found"})
+	case errors.Is(err, services.ErrAuditExportScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export schedule not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AuditReportHandlers contains audit statistics and compliance report HTTP handlers
+type AuditReportHandlers struct {
+	auditService *services.AuditService
+	volume       *services.AuditVolumeMonitor
+}
+
+// NewAuditReportHandlers creates new audit report handlers
+func NewAuditReportHandlers(auditService *services.AuditService, volume *services.AuditVolumeMonitor) *AuditReportHandlers {
+	return &AuditReportHandlers{
+		auditService: auditService,
+		volume:       volume,
+	}
+}
+
+// ComplianceReportRequest represents a compliance report request
+type ComplianceReportRequest struct {
+	ReportType string    `json:"report_type" binding:"required"`
+	StartTime  time.Time `json:"start_time" binding:"required"`
+	EndTime    time.Time `json:"end_time" binding:"required"`
+}
+
+// GetStatistics returns audit statistics for ?start_time=&end_time= (RFC3339). Large
+// ranges are accepted as a background job and answered with 202 and the job to poll.
+func (h *AuditReportHandlers) GetStatistics(c *gin.Context) {
+	startTime, err := time.Parse(time.RFC3339, c.Query("start_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time", "message": "start_time must be RFC3339"})
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time", "message": "end_time must be RFC3339"})
+		return
+	}
+
+	stats, job, err := h.auditService.RequestStatistics(startTime, endTime, getAnalystID(c))
+	if !handleReportQueryError(c, err, "Failed to get audit statistics") {
+		return
+	}
+	if job != nil {
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"statistics": stats})
+}
+
+// GenerateComplianceReport builds a compliance report, as a background job for large ranges
+func (h *AuditReportHandlers) GenerateComplianceReport(c *gin.Context) {
+	var req ComplianceReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	generatedBy := uuid.Nil
+	if analystID := getAnalystID(c); analystID != nil {
+		generatedBy = *analystID
+	}
+
+	report, job, err := h.auditService.RequestComplianceReport(services.ComplianceReportType(req.ReportType), req.StartTime, req.EndTime, generatedBy)
+	if !handleReportQueryError(c, err, "Failed to generate compliance report") {
+		return
+	}
+	if job != nil {
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// GetReportJob returns a background report job, with its result once completed
+func (h *AuditReportHandlers) GetReportJob(c *gin.Context) {
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.auditService.GetReportJob(jobID)
+	if errors.Is(err, services.ErrReportJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get report job", "message": err.Error()})
+		return
+	}
+
+	response := gin.H{"job": job}
+	if job.Status == models.ReportJobCompleted {
+		response["result"] = json.RawMessage(job.Result)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetQueryMetrics returns per-endpoint query cost for the reporting endpoints
+func (h *AuditReportHandlers) GetQueryMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"metrics": h.auditService.QueryMetrics()})
+}
+
+// GetVolumeBaselines returns the learned events-per-minute of each audit category and
+// whether its last evaluated minute was normal, a drop or a spike
+func (h *AuditReportHandlers) GetVolumeBaselines(c *gin.Context) {
+	baselines, err := h.volume.GetBaselines()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit volume baselines", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"baselines": baselines,
+		"count":     len(baselines),
+	})
+}
+
+// handleReportQueryError writes the response for a query guard or query error and
+// reports whether the handler should carry on
+func handleReportQueryError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrInvalidQueryRange), errors.Is(err, services.ErrQueryRangeTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time range", "message": err.Error()})
+	case errors.Is(err, services.ErrQueryTimeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Query timed out", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+	return false
+}
@@ -1,15 +1,19 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"time"
 
 	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -34,7 +38,7 @@ type tokenResponse struct {
 }
 
 // RegisterHandler registers a new local user
-func RegisterHandler(userService *services.UserService) gin.HandlerFunc {
+func RegisterHandler(userService *services.UserService, radiusService *services.RadiusService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req registerRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -55,12 +59,14 @@ func RegisterHandler(userService *services.UserService) gin.HandlerFunc {
 			return
 		}
 
+		rememberRadiusPassword(radiusService, user.ID, req.Password)
+
 		c.JSON(http.StatusCreated, gin.H{"user_id": user.ID})
 	}
 }
 
 // LoginHandler authenticates a user and returns tokens
-func LoginHandler(userService *services.UserService, sessionService *services.SessionService, cfg *config.Config) gin.HandlerFunc {
+func LoginHandler(userService *services.UserService, sessionService *services.SessionService, radiusService *services.RadiusService, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req loginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -70,24 +76,57 @@ func LoginHandler(userService *services.UserService, sessionService *services.Se
 
 		user, err := userService.GetUserByEmail(req.Email)
 		if err != nil {
+			recordLogin(c, services.LoginAttempt{Email: req.Email, Method: models.AuthMethodPassword, FailureReason: models.LoginFailureUnknownUser})
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
 
+		// A locked account gets the same answer as a wrong password, so the lock cannot be
+		// used to tell when a guess was right
+		if user.IsLocked(time.Now()) {
+			recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Method: models.AuthMethodPassword, FailureReason: models.LoginFailureAccountLocked})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
 		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+			recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Method: models.AuthMethodPassword, FailureReason: models.LoginFailureInvalidPassword})
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
+		// The database is a read-only replica during disaster recovery: sign in without a
+		// session, so the user signs in again when the access token expires
+		if inDisasterRecovery() {
+			accessToken, expiresIn, err := generateAccessToken(cfg, user.ID.String(), user.Email, user.Username, "", models.AAL1)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+				return
+			}
+			services.LogAuditEvent(c.Request.Context(), user.ID.String(), "login", "session", "", c.ClientIP(), c.GetHeader("User-Agent"), "Signed in during disaster recovery without a session", "success")
+
+			cookieDomain := os.Getenv("COOKIE_DOMAIN")
+			cookieSecure := os.Getenv("COOKIE_SECURE") == "true"
+			if cookieSecure {
+				c.SetSameSite(http.SameSiteNoneMode)
+			} else {
+				c.SetSameSite(http.SameSiteLaxMode)
+			}
+			c.SetCookie("access_token", accessToken, expiresIn, "/", cookieDomain, cookieSecure, true)
+			c.JSON(http.StatusOK, tokenResponse{AccessToken: accessToken, ExpiresIn: expiresIn, TokenType: "Bearer"})
+			return
+		}
+		rememberRadiusPassword(radiusService, user.ID, req.Password)
 
 		// Create a session (used as refresh token)
 		session, err := sessionService.CreateSession(user.ID, c.ClientIP(), c.GetHeader("User-Agent"))
 		if err != nil {
+			recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Method: models.AuthMethodPassword, FailureReason: models.LoginFailureSessionError})
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 			return
 		}
+		recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Success: true, Method: models.AuthMethodPassword, SessionID: &session.ID})
 
 		// Issue access token
-		accessToken, expiresIn, err := generateAccessToken(cfg, user.ID.String(), user.Email, user.Username)
+		accessToken, expiresIn, err := generateAccessToken(cfg, user.ID.String(), user.Email, user.Username, session.ID.String(), session.AuthLevel)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
 			return
@@ -115,8 +154,9 @@ func LoginHandler(userService *services.UserService, sessionService *services.Se
 	}
 }
 
-// RefreshHandler exchanges a refresh token (session token) for a new access token
-func RefreshHandler(sessionService *services.SessionService, cfg *config.Config) gin.HandlerFunc {
+// RefreshHandler exchanges a refresh token (session token) for a new access token.
+// Refresh is refused while an emergency lockdown has paused it for the user.
+func RefreshHandler(sessionService *services.SessionService, emergencyService *services.EmergencyService, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			RefreshToken string `json:"refresh_token" binding:"required"`
@@ -132,26 +172,64 @@ func RefreshHandler(sessionService *services.SessionService, cfg *config.Config)
 			return
 		}
 
-		// Rotate/refresh session expiry
-		if _, err := sessionService.RefreshSession(req.RefreshToken); err != nil {
+		if session.User.IsLocked(time.Now()) {
+			c.JSON(http.StatusForbidden, accountLockedResponse(&session.User))
+			return
+		}
+
+		// Refreshing is not activity, so an idle session cannot be kept alive by the client
+		if sessionActivity != nil && !inDisasterRecovery() {
+			if ended, reason := sessionActivity.RecordActivity(session.ID, false, time.Now()); ended {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "session_idle_timeout", "message": reason})
+				return
+			}
+		}
+
+		if until := emergencyService.RefreshPausedUntil(session.User.Email); until != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "refresh_paused",
+				"message":      "Token refresh is paused by an emergency lockdown; please sign in again",
+				"paused_until": until,
+			})
+			return
+		}
+
+		// Rotate/refresh session expiry; during disaster recovery the replicated session is
+		// used as is, unless it was logged out since
+		if inDisasterRecovery() {
+			if disasterRecovery.LoggedOut(req.RefreshToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+				return
+			}
+		} else if _, err := sessionService.RefreshSession(req.RefreshToken); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
 			return
 		}
 
-		accessToken, expiresIn, err := generateAccessToken(cfg, session.User.ID.String(), session.User.Email, session.User.Username)
+		// Impersonation sessions keep their actor and their fixed end
+		var accessToken string
+		var expiresIn int
+		if session.ImpersonatorID != nil {
+			accessToken, expiresIn, err = generateImpersonationAccessToken(cfg, &session.User, session)
+		} else {
+			accessToken, expiresIn, err = generateAccessToken(cfg, session.User.ID.String(), session.User.Email, session.User.Username, session.ID.String(), session.AuthLevel)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
 			return
 		}
-		// Update access token cookie
-		cookieDomain := os.Getenv("COOKIE_DOMAIN")
-		cookieSecure := os.Getenv("COOKIE_SECURE") == "true"
-		if cookieSecure {
-			c.SetSameSite(http.SameSiteNoneMode)
-		} else {
-			c.SetSameSite(http.SameSiteLaxMode)
+		// Update access token cookie; impersonation tokens are never cookies, so they do
+		// not replace the administrator's own session in the browser
+		if session.ImpersonatorID == nil {
+			cookieDomain := os.Getenv("COOKIE_DOMAIN")
+			cookieSecure := os.Getenv("COOKIE_SECURE") == "true"
+			if cookieSecure {
+				c.SetSameSite(http.SameSiteNoneMode)
+			} else {
+				c.SetSameSite(http.SameSiteLaxMode)
+			}
+			c.SetCookie("access_token", accessToken, expiresIn, "/", cookieDomain, cookieSecure, true)
 		}
-		c.SetCookie("access_token", accessToken, expiresIn, "/", cookieDomain, cookieSecure, true)
 
 		c.JSON(http.StatusOK, tokenResponse{
 			AccessToken:  accessToken,
@@ -162,6 +240,19 @@ func RefreshHandler(sessionService *services.SessionService, cfg *config.Config)
 	}
 }
 
+// accountLockedResponse tells a locked user when they can sign in again
+func accountLockedResponse(user *models.User) gin.H {
+	response := gin.H{"error": "account_locked", "message": "This account is locked; contact your administrator"}
+	if services.IsDormantLock(user) {
+		response["message"] = "This account was disabled after a long time without sign-in; request reactivation"
+		response["reactivation_url"] = "/auth/reactivation-requests"
+	}
+	if user.LockedUntil != nil {
+		response["locked_until"] = user.LockedUntil
+	}
+	return response
+}
+
 // LogoutHandler invalidates a refresh token
 func LogoutHandler(sessionService *services.SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -172,7 +263,12 @@ func LogoutHandler(sessionService *services.SessionService) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := sessionService.InvalidateSession(req.RefreshToken); err != nil {
+		if inDisasterRecovery() {
+			if err := disasterRecovery.QueueLogout(req.RefreshToken); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+				return
+			}
+		} else if err := sessionService.InvalidateSession(req.RefreshToken); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
 			return
 		}
@@ -190,7 +286,50 @@ func LogoutHandler(sessionService *services.SessionService) gin.HandlerFunc {
 	}
 }
 
-func generateAccessToken(cfg *config.Config, sub, email, username string) (string, int, error) {
+// stepUpSession raises the caller's session to the given assurance level and
+// reissues the access token so the new level is visible to RequireAAL
+func stepUpSession(c *gin.Context, level int) (string, int, error) {
+	sessionIDVal, exists := c.Get("sessionID")
+	if !exists {
+		return "", 0, fmt.Errorf("access token is not bound to a session")
+	}
+
+	sessionService := services.NewSessionService(services.GetDB())
+	session, err := sessionService.ElevateSessionAAL(sessionIDVal.(uuid.UUID), level)
+	if err != nil {
+		return "", 0, err
+	}
+
+	cfg := config.LoadConfig()
+	accessToken, expiresIn, err := generateAccessToken(cfg, session.User.ID.String(), session.User.Email, session.User.Username, session.ID.String(), session.AuthLevel)
+	if err != nil {
+		return "", 0, err
+	}
+
+	cookieDomain := os.Getenv("COOKIE_DOMAIN")
+	cookieSecure := os.Getenv("COOKIE_SECURE") == "true"
+	if cookieSecure {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie("access_token", accessToken, expiresIn, "/", cookieDomain, cookieSecure, true)
+
+	return accessToken, expiresIn, nil
+}
+
+// rememberRadiusPassword captures the credential MS-CHAPv2 network logins need while the
+// plaintext password is at hand; failures only affect RADIUS, not the web sign-in
+func rememberRadiusPassword(radiusService *services.RadiusService, userID uuid.UUID, password string) {
+	if radiusService == nil {
+		return
+	}
+	if err := radiusService.RememberPassword(userID, password); err != nil {
+		log.Printf("⚠️ Failed to store RADIUS credential for %s: %v", userID, err)
+	}
+}
+
+func generateAccessToken(cfg *config.Config, sub, email, username, sessionID string, aal int) (string, int, error) {
 	ttl := time.Duration(cfg.AccessTokenTTLMin) * time.Minute
 	expiresAt := time.Now().Add(ttl)
 
@@ -198,6 +337,8 @@ func generateAccessToken(cfg *config.Config, sub, email, username string) (strin
 		"sub":      sub,
 		"email":    email,
 		"username": username,
+		"sid":      sessionID,
+		"aal":      aal,
 		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
 		"typ":      "access",
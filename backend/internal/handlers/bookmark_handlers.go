@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BookmarkHandlers contains the bookmark app and saved credential handlers
+type BookmarkHandlers struct {
+	bookmarkService *services.BookmarkService
+	consentService  *services.ConsentService
+	scheduleService *services.AccessScheduleService
+	policyService   *services.AppSessionPolicyService
+}
+
+// NewBookmarkHandlers creates new bookmark handlers
+func NewBookmarkHandlers(bookmarkService *services.BookmarkService, consentService *services.ConsentService, scheduleService *services.AccessScheduleService, policyService *services.AppSessionPolicyService) *BookmarkHandlers {
+	return &BookmarkHandlers{
+		bookmarkService: bookmarkService,
+		consentService:  consentService,
+		scheduleService: scheduleService,
+		policyService:   policyService,
+	}
+}
+
+// BookmarkAppRequest represents an admin's definition of a bookmark app
+type BookmarkAppRequest struct {
+	AppID            string `json:"app_id"`
+	Name             string `json:"name" binding:"required"`
+	Description      string `json:"description"`
+	Icon             string `json:"icon"`
+	Category         string `json:"category"`
+	URL              string `json:"url" binding:"required"`
+	LoginURL         string `json:"login_url"`
+	UsernameSelector string `json:"username_selector"`
+	PasswordSelector string `json:"password_selector"`
+	SubmitSelector   string `json:"submit_selector"`
+	AllowCredentials bool   `json:"allow_credentials"`
+	RequiredAAL      int    `json:"required_aal"`
+}
+
+// SaveBookmarkCredentialRequest represents the credentials a user stores for a bookmark app
+type SaveBookmarkCredentialRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (req BookmarkAppRequest) input() services.BookmarkAppInput {
+	return services.BookmarkAppInput{
+		AppID:            req.AppID,
+		Name:             req.Name,
+		Description:      req.Description,
+		Icon:             req.Icon,
+		Category:         req.Category,
+		URL:              req.URL,
+		LoginURL:         req.LoginURL,
+		UsernameSelector: req.UsernameSelector,
+		PasswordSelector: req.PasswordSelector,
+		SubmitSelector:   req.SubmitSelector,
+		AllowCredentials: req.AllowCredentials,
+		RequiredAAL:      req.RequiredAAL,
+	}
+}
+
+// ListApps returns every bookmark app
+func (h *BookmarkHandlers) ListApps(c *gin.Context) {
+	apps, err := h.bookmarkService.ListApps()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list bookmark apps", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apps": apps, "count": len(apps)})
+}
+
+// CreateApp defines a new bookmark app
+func (h *BookmarkHandlers) CreateApp(c *gin.Context) {
+	var req BookmarkAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	app, err := h.bookmarkService.CreateApp(req.input(), getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidBookmark) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bookmark app", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bookmark app", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"app": app})
+}
+
+// UpdateApp replaces a bookmark app's settings
+func (h *BookmarkHandlers) UpdateApp(c *gin.Context) {
+	var req BookmarkAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	app, err := h.bookmarkService.UpdateApp(c.Param("appId"), req.input(), getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrBookmarkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark app not found"})
+	case errors.Is(err, services.ErrInvalidBookmark):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bookmark app", "message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bookmark app", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"app": app})
+	}
+}
+
+// DeleteApp removes a bookmark app and the credentials saved for it
+func (h *BookmarkHandlers) DeleteApp(c *gin.Context) {
+	err := h.bookmarkService.DeleteApp(c.Param("appId"), getAnalystID(c))
+	if errors.Is(err, services.ErrBookmarkNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark app not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bookmark app", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark app removed"})
+}
+
+// GetCredentials tells the user whether they have credentials saved for a bookmark app
+func (h *BookmarkHandlers) GetCredentials(c *gin.Context) {
+	userID, err := uuid.Parse(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	info, err := h.bookmarkService.GetCredentialInfo(userID, c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get credentials", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": info})
+}
+
+// SaveCredentials stores the user's credentials for a bookmark app
+func (h *BookmarkHandlers) SaveCredentials(c *gin.Context) {
+	userID, err := uuid.Parse(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	var req SaveBookmarkCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	info, err := h.bookmarkService.SaveCredential(userID, c.Param("appId"), req.Username, req.Password)
+	if err != nil {
+		respondBookmarkError(c, err, "Failed to save credentials")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": info})
+}
+
+// DeleteCredentials removes the user's credentials for a bookmark app
+func (h *BookmarkHandlers) DeleteCredentials(c *gin.Context) {
+	userID, err := uuid.Parse(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.bookmarkService.DeleteCredential(userID, c.Param("appId")); err != nil {
+		respondBookmarkError(c, err, "Failed to delete credentials")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Credentials deleted"})
+}
+
+// Autofill returns the user's credentials and login form metadata for a bookmark app, after
+// the same assurance level, consent, access schedule and session policy checks as an SSO launch
+func (h *BookmarkHandlers) Autofill(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	app, exists := services.GetSaaSApp(c.Param("appId"))
+	if !exists || app.Protocol != constants.ProtocolBookmark {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark app not found"})
+		return
+	}
+
+	// Apps may demand a stronger session than a password login provides
+	if app.RequiredAAL > c.GetInt("aal") {
+		middleware.ChallengeStepUp(c, gin.H{
+			"message":      fmt.Sprintf("%s requires a stronger authentication method", app.Name),
+			"current_aal":  c.GetInt("aal"),
+			"required_aal": app.RequiredAAL,
+		})
+		return
+	}
+	if !checkConsent(c, h.consentService, userUUID, app.ID) || !checkAccessSchedule(c, h.scheduleService, userUUID, app.ID) {
+		return
+	}
+	if _, ok := checkAppSessionPolicy(c, h.policyService, app); !ok {
+		return
+	}
+
+	autofill, err := h.bookmarkService.Autofill(userUUID, app.ID, time.Now())
+	if err != nil {
+		respondBookmarkError(c, err, "Failed to load credentials")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"autofill": autofill})
+}
+
+func respondBookmarkError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrBookmarkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark app not found"})
+	case errors.Is(err, services.ErrBookmarkCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No credentials saved for this app"})
+	case errors.Is(err, services.ErrBookmarkCredentialsNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Credential storage is not enabled for this app", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidBookmark):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credentials", "message": err.Error()})
+	default:
+		log.Printf("Bookmark credential error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
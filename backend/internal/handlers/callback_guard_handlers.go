@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CallbackGuardHandlers contains OAuth callback throttling middleware and HTTP handlers
+type CallbackGuardHandlers struct {
+	callbackGuard *services.CallbackGuard
+}
+
+// NewCallbackGuardHandlers creates new callback guard handlers
+func NewCallbackGuardHandlers(callbackGuard *services.CallbackGuard) *CallbackGuardHandlers {
+	return &CallbackGuardHandlers{
+		callbackGuard: callbackGuard,
+	}
+}
+
+// Protect refuses callback and token requests from blocked IP addresses or carrying a
+// blocked state prefix, and counts failed requests towards a block. Policy refusals
+// (403) are not failures: they come from real users, not forged codes or states.
+func (h *CallbackGuardHandlers) Protect(endpoint string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ipAddress := c.ClientIP()
+		state := c.Query("state")
+
+		block, err := h.callbackGuard.Check(ipAddress, state, time.Now())
+		if err != nil {
+			// Throttling is best-effort; never lock users out on errors
+			log.Printf("Failed to check callback blocks: %v", err)
+		}
+		if block != nil {
+			retryAfter := int(math.Ceil(time.Until(block.ExpiresAt).Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":         "callback_blocked",
+				"message":       "Too many failed sign-in callbacks; try again later",
+				"blocked_until": block.ExpiresAt,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest || status == http.StatusForbidden {
+			return
+		}
+		if err := h.callbackGuard.RecordFailure(endpoint, ipAddress, state, c.GetHeader("User-Agent"), status, time.Now()); err != nil {
+			log.Printf("Failed to record callback failure: %v", err)
+		}
+	}
+}
+
+// ListBlocks returns the callback blocks in force
+func (h *CallbackGuardHandlers) ListBlocks(c *gin.Context) {
+	blocks, err := h.callbackGuard.ListBlocks(time.Now())
+	if err != nil {
+		log.Printf("Error listing callback blocks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list callback blocks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocks": blocks, "count": len(blocks)})
+}
+
+// Unblock lifts a callback block early
+func (h *CallbackGuardHandlers) Unblock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid callback block ID"})
+		return
+	}
+
+	if err := h.callbackGuard.Unblock(uint(id), getAnalystID(c), time.Now()); err != nil {
+		if errors.Is(err, services.ErrCallbackBlockNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Callback block not found"})
+			return
+		}
+		log.Printf("Error lifting callback block: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift callback block"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Callback block lifted successfully"})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// canaryRedactedHeaders carry credentials and are never stored with a canary hit
+var canaryRedactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+}
+
+// CanaryKeyHandlers contains canary key middleware and HTTP handlers
+type CanaryKeyHandlers struct {
+	canaryKeyService *services.CanaryKeyService
+}
+
+// NewCanaryKeyHandlers creates new canary key handlers
+func NewCanaryKeyHandlers(canaryKeyService *services.CanaryKeyService) *CanaryKeyHandlers {
+	return &CanaryKeyHandlers{
+		canaryKeyService: canaryKeyService,
+	}
+}
+
+// CreateCanaryKeyRequest describes where a canary key will be planted
+type CreateCanaryKeyRequest struct {
+	Label     string `json:"label" binding:"required"`
+	Placement string `json:"placement"`
+}
+
+// DetectCanaryKeys refuses any request presenting a canary key, as a bearer token, an
+// X-API-Key header or an api_key query parameter, exactly as an invalid key would be
+// refused, so whoever holds the leaked key learns nothing
+func (h *CanaryKeyHandlers) DetectCanaryKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, presentedIn := presentedAPIKey(c)
+		if !strings.HasPrefix(key, services.CanaryKeyPrefix) {
+			c.Next()
+			return
+		}
+
+		canary, err := h.canaryKeyService.Detect(services.CanaryRequest{
+			Key:         key,
+			PresentedIn: presentedIn,
+			IPAddress:   c.ClientIP(),
+			UserAgent:   c.GetHeader("User-Agent"),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Query:       redactedQuery(c),
+			Headers:     redactedHeaders(c),
+		}, time.Now())
+		if err != nil {
+			log.Printf("Failed to check canary keys: %v", err)
+		}
+		if canary != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func presentedAPIKey(c *gin.Context) (string, string) {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token), "authorization"
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return strings.TrimSpace(key), "x-api-key"
+	}
+	if key := c.Query("api_key"); key != "" {
+		return key, "query"
+	}
+	return "", ""
+}
+
+func redactedHeaders(c *gin.Context) map[string]string {
+	headers := make(map[string]string, len(c.Request.Header))
+	for name, values := range c.Request.Header {
+		if canaryRedactedHeaders[name] {
+			headers[name] = "[redacted]"
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+func redactedQuery(c *gin.Context) string {
+	query := c.Request.URL.Query()
+	if query.Has("api_key") {
+		query.Set("api_key", "[redacted]")
+	}
+	return query.Encode()
+}
+
+// CreateCanaryKey issues a canary key; the key is only shown in this response
+func (h *CanaryKeyHandlers) CreateCanaryKey(c *gin.Context) {
+	var req CreateCanaryKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	canary, key, err := h.canaryKeyService.Create(req.Label, req.Placement, getAnalystID(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCanaryKey) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid canary key", "message": err.Error()})
+			return
+		}
+		log.Printf("Error creating canary key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create canary key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"canary_key": canary, "key": key})
+}
+
+// ListCanaryKeys returns every canary key with how often it has been used
+func (h *CanaryKeyHandlers) ListCanaryKeys(c *gin.Context) {
+	canaries, err := h.canaryKeyService.List()
+	if err != nil {
+		log.Printf("Error listing canary keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list canary keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"canary_keys": canaries, "count": len(canaries)})
+}
+
+// GetCanaryKeyHits returns a page of a canary key's uses with their request context
+func (h *CanaryKeyHandlers) GetCanaryKeyHits(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid canary key ID"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	hits, total, err := h.canaryKeyService.Hits(id, limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrCanaryKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Canary key not found"})
+			return
+		}
+		log.Printf("Error listing canary key hits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list canary key hits"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hits":   hits,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// DeleteCanaryKey retires a canary key
+func (h *CanaryKeyHandlers) DeleteCanaryKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid canary key ID"})
+		return
+	}
+
+	if err := h.canaryKeyService.Delete(id, getAnalystID(c)); err != nil {
+		if errors.Is(err, services.ErrCanaryKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Canary key not found"})
+			return
+		}
+		log.Printf("Error deleting canary key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete canary key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Canary key deleted successfully"})
+}
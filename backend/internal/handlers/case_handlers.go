@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CaseHandlers contains investigation case HTTP handlers
+type CaseHandlers struct {
+	caseService *services.CaseService
+}
+
+// NewCaseHandlers creates new case handlers
+func NewCaseHandlers(caseService *services.CaseService) *CaseHandlers {
+	return &CaseHandlers{
+		caseService: caseService,
+	}
+}
+
+// CreateCaseRequest represents a request to open a case
+type CreateCaseRequest struct {
+	Title       string  `json:"title" binding:"required"`
+	Description string  `json:"description"`
+	Severity    string  `json:"severity" binding:"required"`
+	OwnerID     *string `json:"owner_id"`
+}
+
+// UpdateCaseRequest represents a partial update to a case
+type UpdateCaseRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Severity    *string `json:"severity"`
+	Status      *string `json:"status"`
+	OwnerID     *string `json:"owner_id"`
+}
+
+// LinkCaseRequest represents a request to attach an incident, alert or user
+type LinkCaseRequest struct {
+	LinkType string `json:"link_type" binding:"required"`
+	TargetID string `json:"target_id" binding:"required"`
+}
+
+// AddCaseNoteRequest represents a note added to a case
+type AddCaseNoteRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// AddCaseEvidenceRequest represents an evidence attachment
+type AddCaseEvidenceRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	URI         string `json:"uri" binding:"required"`
+	SHA256      string `json:"sha256"`
+}
+
+// AddCaseTaskRequest represents a follow-up task
+type AddCaseTaskRequest struct {
+	Title      string     `json:"title" binding:"required"`
+	AssigneeID *string    `json:"assignee_id"`
+	DueAt      *time.Time `json:"due_at"`
+}
+
+// UpdateCaseTaskRequest represents a task status change
+type UpdateCaseTaskRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// ListCases returns cases filtered by ?status= and ?owner_id=
+func (h *CaseHandlers) ListCases(c *gin.Context) {
+	filters := services.CaseFilters{Status: c.Query("status")}
+
+	if owner := c.Query("owner_id"); owner != "" {
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner ID"})
+			return
+		}
+		filters.OwnerID = &ownerID
+	}
+
+	var err error
+	filters.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || filters.Limit < 1 || filters.Limit > 200 {
+		filters.Limit = 50
+	}
+	filters.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || filters.Offset < 0 {
+		filters.Offset = 0
+	}
+
+	cases, total, err := h.caseService.ListCases(filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list cases", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cases":  cases,
+		"total":  total,
+		"limit":  filters.Limit,
+		"offset": filters.Offset,
+	})
+}
+
+// CreateCase opens a new investigation case
+func (h *CaseHandlers) CreateCase(c *gin.Context) {
+	var req CreateCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	ownerID, ok := parseOptionalUUID(c, req.OwnerID, "owner ID")
+	if !ok {
+		return
+	}
+
+	investigation, err := h.caseService.CreateCase(req.Title, req.Description, req.Severity, ownerID, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to create case")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"case": investigation})
+}
+
+// GetCase returns a case with everything linked to it
+func (h *CaseHandlers) GetCase(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+
+	investigation, err := h.caseService.GetCase(caseID)
+	if err != nil {
+		respondCaseError(c, err, "Failed to get case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"case": investigation})
+}
+
+// UpdateCase changes a case's details, owner or status
+func (h *CaseHandlers) UpdateCase(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	ownerID, ok := parseOptionalUUID(c, req.OwnerID, "owner ID")
+	if !ok {
+		return
+	}
+
+	investigation, err := h.caseService.UpdateCase(caseID, services.CaseUpdate{
+		Title:       req.Title,
+		Description: req.Description,
+		Severity:    req.Severity,
+		Status:      req.Status,
+		OwnerID:     ownerID,
+	}, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to update case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"case": investigation})
+}
+
+// LinkToCase attaches an incident, alert or user to a case
+func (h *CaseHandlers) LinkToCase(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req LinkCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	link, err := h.caseService.LinkTarget(caseID, req.LinkType, req.TargetID, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to link to case")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"link": link})
+}
+
+// UnlinkFromCase removes a link from a case
+func (h *CaseHandlers) UnlinkFromCase(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+	linkID, err := uuid.Parse(c.Param("linkId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	if err := h.caseService.UnlinkTarget(caseID, linkID, getAnalystID(c)); err != nil {
+		respondCaseError(c, err, "Failed to unlink from case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Link removed"})
+}
+
+// AddNote appends an analyst note to a case
+func (h *CaseHandlers) AddNote(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req AddCaseNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	note, err := h.caseService.AddNote(caseID, req.Body, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to add note")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"note": note})
+}
+
+// AddEvidence records an evidence attachment on a case
+func (h *CaseHandlers) AddEvidence(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req AddCaseEvidenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	evidence, err := h.caseService.AddEvidence(caseID, req.Name, req.Description, req.URI, req.SHA256, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to add evidence")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"evidence": evidence})
+}
+
+// AddTask creates a follow-up task on a case
+func (h *CaseHandlers) AddTask(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+
+	var req AddCaseTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	assigneeID, ok := parseOptionalUUID(c, req.AssigneeID, "assignee ID")
+	if !ok {
+		return
+	}
+
+	task, err := h.caseService.AddTask(caseID, req.Title, assigneeID, req.DueAt, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to add task")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"task": task})
+}
+
+// UpdateTask marks a case task done or reopens it
+func (h *CaseHandlers) UpdateTask(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+	taskID, err := uuid.Parse(c.Param("taskId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var req UpdateCaseTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	task, err := h.caseService.UpdateTaskStatus(caseID, taskID, req.Status, getAnalystID(c))
+	if err != nil {
+		respondCaseError(c, err, "Failed to update task")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
+
+// GetMyTasks returns the caller's open case tasks
+func (h *CaseHandlers) GetMyTasks(c *gin.Context) {
+	analystID := getAnalystID(c)
+	if analystID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tasks, err := h.caseService.GetAssignedTasks(*analystID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tasks", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks, "count": len(tasks)})
+}
+
+func parseCaseID(c *gin.Context) (uuid.UUID, bool) {
+	caseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid case ID"})
+		return uuid.Nil, false
+	}
+	return caseID, true
+}
+
+// parseOptionalUUID parses an optional ID from a request body, writing a 400 on failure
+func parseOptionalUUID(c *gin.Context, value *string, field string) (*uuid.UUID, bool) {
+	if value == nil || *value == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(*value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + field})
+		return nil, false
+	}
+	return &id, true
+}
+
+func respondCaseError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrCaseNotFound), errors.Is(err, services.ErrCaseTaskNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrCaseClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidCaseLink), errors.Is(err, services.ErrInvalidCaseInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+}
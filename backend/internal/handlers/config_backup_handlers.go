@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigBackupHandlers contains the configuration backup and restore handlers
+type ConfigBackupHandlers struct {
+	configBackupService *services.ConfigBackupService
+}
+
+// NewConfigBackupHandlers creates new configuration backup handlers
+func NewConfigBackupHandlers(configBackupService *services.ConfigBackupService) *ConfigBackupHandlers {
+	return &ConfigBackupHandlers{configBackupService: configBackupService}
+}
+
+// ExportConfig returns a versioned snapshot of the configuration
+func (h *ConfigBackupHandlers) ExportConfig(c *gin.Context) {
+	snapshot, err := h.configBackupService.ExportSnapshot(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export configuration", "message": err.Error()})
+		return
+	}
+
+	services.LogAuditEvent(c.Request.Context(), getUserIDFromContext(c), "config_exported", "configuration", "", c.ClientIP(), c.GetHeader("User-Agent"), "", "success")
+	c.Header("Content-Disposition", "attachment; filename=cloudgate-config-"+snapshot.ExportedAt.Format("20060102-150405")+".json")
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// RestoreConfig applies a snapshot. With ?dry_run=true it only reports the changes a
+// restore would make.
+func (h *ConfigBackupHandlers) RestoreConfig(c *gin.Context) {
+	var snapshot services.ConfigSnapshot
+	if err := c.ShouldBindJSON(&snapshot); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	result, err := h.configBackupService.Restore(&snapshot, dryRun, getAnalystID(c), time.Now())
+	switch {
+	case errors.Is(err, services.ErrSnapshotVersionUnsupported), errors.Is(err, services.ErrInvalidSnapshot):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot", "message": err.Error()})
+	case err != nil:
+		// Restores run in one transaction, so a failure leaves the configuration unchanged
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Snapshot could not be applied; no changes were made", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
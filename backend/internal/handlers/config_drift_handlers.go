@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ConfigDriftHandlers contains the configuration change history handlers
+type ConfigDriftHandlers struct {
+	configDriftService *services.ConfigDriftService
+}
+
+// NewConfigDriftHandlers creates new configuration drift handlers
+func NewConfigDriftHandlers(configDriftService *services.ConfigDriftService) *ConfigDriftHandlers {
+	return &ConfigDriftHandlers{configDriftService: configDriftService}
+}
+
+// ListVersions returns recorded configuration changes with their diffs, newest first,
+// filtered by ?kind= and ?key=
+func (h *ConfigDriftHandlers) ListVersions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	versions, err := h.configDriftService.ListVersions(c.Query("kind"), c.Query("key"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list configuration versions", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "count": len(versions)})
+}
+
+// GetVersion returns one configuration version with the configuration it recorded
+func (h *ConfigDriftHandlers) GetVersion(c *gin.Context) {
+	versionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+
+	version, err := h.configDriftService.GetVersion(versionID)
+	if err != nil {
+		if errors.Is(err, services.ErrConfigVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configuration version", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// RollbackVersion puts configuration back the way a version recorded it, recording the
+// rollback as a new version
+func (h *ConfigDriftHandlers) RollbackVersion(c *gin.Context) {
+	versionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+
+	version, err := h.configDriftService.Rollback(versionID, getAnalystID(c), time.Now())
+	switch {
+	case errors.Is(err, services.ErrConfigVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration version not found"})
+	case errors.Is(err, services.ErrConfigRollbackUnsupported):
+		c.JSON(http.StatusConflict, gin.H{"error": "Configuration version cannot be rolled back", "message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Rollback failed", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Configuration rolled back", "version": version})
+	}
+}
+
+// GetDriftStatus returns recent configuration change activity against the drift alert limits
+func (h *ConfigDriftHandlers) GetDriftStatus(c *gin.Context) {
+	status, err := h.configDriftService.Status(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configuration drift status", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
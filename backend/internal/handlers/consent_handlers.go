@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ConsentHandlers contains consent-related HTTP handlers
+type ConsentHandlers struct {
+	consentService *services.ConsentService
+}
+
+// NewConsentHandlers creates new consent handlers
+func NewConsentHandlers(consentService *services.ConsentService) *ConsentHandlers {
+	return &ConsentHandlers{
+		consentService: consentService,
+	}
+}
+
+// GetConsentScreen returns what CloudGate will access for an app and the user's current consent
+func (h *ConsentHandlers) GetConsentScreen(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	app, ok := services.GetSaaSApp(c.Param("appId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	response := gin.H{
+		"app_id":      app.ID,
+		"app_name":    app.Name,
+		"description": app.Description,
+		"data_access": app.DataAccess,
+		"consented":   false,
+	}
+
+	consent, err := h.consentService.GetActiveConsent(userID.(uuid.UUID), app.ID)
+	if err == nil {
+		response["consented"] = true
+		response["consent"] = consent
+	} else if !errors.Is(err, services.ErrConsentNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get consent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GrantConsent records the user's consent to an app's data access
+func (h *ConsentHandlers) GrantConsent(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	app, ok := services.GetSaaSApp(c.Param("appId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	consent, err := h.consentService.GrantConsent(userID.(uuid.UUID), app.ID, app.DataAccess, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		log.Printf("Error granting consent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant consent"})
+		return
+	}
+
+	uid := userID.(uuid.UUID).String()
+	services.LogAuditEvent(c.Request.Context(), uid, "consent_granted", "app", app.ID, c.ClientIP(), c.GetHeader("User-Agent"), "Consent granted for "+app.Name, "success")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Consent granted",
+		"consent": consent,
+	})
+}
+
+// ListConsents returns the user's consent records
+func (h *ConsentHandlers) ListConsents(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	includeInactive := c.Query("include_inactive") == "true"
+	consents, err := h.consentService.GetUserConsents(userID.(uuid.UUID), includeInactive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get consents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"consents": consents,
+		"count":    len(consents),
+	})
+}
+
+// RevokeConsent withdraws consent for an app and marks its connection as revoked
+func (h *ConsentHandlers) RevokeConsent(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	appID := c.Param("appId")
+	err := h.consentService.RevokeConsent(userID.(uuid.UUID), appID)
+	if errors.Is(err, services.ErrConsentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active consent for this application"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke consent"})
+		return
+	}
+
+	uid := userID.(uuid.UUID).String()
+	if _, connected := services.GetUserAppConnection(uid, appID); connected {
+		if err := services.UpdateUserAppConnection(uid, appID, map[string]interface{}{"status": models.ConnectionRevoked}); err != nil {
+			log.Printf("Error revoking connection after consent withdrawal: %v", err)
+		}
+	}
+
+	services.LogAuditEvent(c.Request.Context(), uid, "consent_revoked", "app", appID, c.ClientIP(), c.GetHeader("User-Agent"), "Consent revoked", "warning")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Consent revoked"})
+}
+
+// RequireConsent blocks connection attempts for an app until the user has granted consent
+func (h *ConsentHandlers) RequireConsent(appID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !checkConsent(c, h.consentService, userID.(uuid.UUID), appID) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkConsent writes a consent_required response and returns false when the user has not consented
+func checkConsent(c *gin.Context, consentService *services.ConsentService, userID uuid.UUID, appID string) bool {
+	consented, err := consentService.HasValidConsent(userID, appID)
+	if err != nil {
+		log.Printf("Error checking consent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify consent"})
+		return false
+	}
+	if !consented {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":       "consent_required",
+			"message":     "Review and accept the data access for this application before connecting",
+			"app_id":      appID,
+			"consent_url": "/apps/" + appID + "/consent",
+		})
+		return false
+	}
+	return true
+}
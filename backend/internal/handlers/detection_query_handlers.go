@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DetectionQueryHandlers contains saved detection query HTTP handlers
+type DetectionQueryHandlers struct {
+	detectionQueryService *services.DetectionQueryService
+}
+
+// NewDetectionQueryHandlers creates new detection query handlers
+func NewDetectionQueryHandlers(detectionQueryService *services.DetectionQueryService) *DetectionQueryHandlers {
+	return &DetectionQueryHandlers{
+		detectionQueryService: detectionQueryService,
+	}
+}
+
+// RunDetectionQueryRequest overrides a detection query's parameter defaults for one run
+type RunDetectionQueryRequest struct {
+	Parameters map[string]string `json:"parameters"`
+}
+
+// ListQueries returns all saved detection queries
+func (h *DetectionQueryHandlers) ListQueries(c *gin.Context) {
+	queries, err := h.detectionQueryService.ListQueries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get detection queries", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"queries": queries,
+		"count":   len(queries),
+	})
+}
+
+// GetQuery returns a detection query with its definition
+func (h *DetectionQueryHandlers) GetQuery(c *gin.Context) {
+	queryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid detection query ID"})
+		return
+	}
+
+	query, err := h.detectionQueryService.GetQuery(queryID)
+	if err != nil {
+		handleDetectionQueryError(c, "Failed to get detection query", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": query})
+}
+
+// CreateQuery saves a new detection query
+func (h *DetectionQueryHandlers) CreateQuery(c *gin.Context) {
+	var definition services.DetectionQueryDefinition
+	if err := c.ShouldBindJSON(&definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	query, err := h.detectionQueryService.CreateQuery(definition, getAnalystID(c), time.Now())
+	if err != nil {
+		handleDetectionQueryError(c, "Failed to create detection query", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"query": query})
+}
+
+// UpdateQuery replaces a detection query's definition
+func (h *DetectionQueryHandlers) UpdateQuery(c *gin.Context) {
+	queryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid detection query ID"})
+		return
+	}
+	var definition services.DetectionQueryDefinition
+	if err := c.ShouldBindJSON(&definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	query, err := h.detectionQueryService.UpdateQuery(queryID, definition, getAnalystID(c), time.Now())
+	if err != nil {
+		handleDetectionQueryError(c, "Failed to update detection query", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": query})
+}
+
+// DeleteQuery removes a detection query
+func (h *DetectionQueryHandlers) DeleteQuery(c *gin.Context) {
+	queryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid detection query ID"})
+		return
+	}
+
+	if err := h.detectionQueryService.DeleteQuery(queryID, getAnalystID(c)); err != nil {
+		handleDetectionQueryError(c, "Failed to delete detection query", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Detection query deleted"})
+}
+
+// RunQuery runs a detection query now without raising alerts, to try it out
+func (h *DetectionQueryHandlers) RunQuery(c *gin.Context) {
+	queryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid detection query ID"})
+		return
+	}
+	var req RunDetectionQueryRequest
+	// Parameters are optional, so an empty body is fine
+	_ = c.ShouldBindJSON(&req)
+
+	run, err := h.detectionQueryService.RunQuery(queryID, req.Parameters, time.Now())
+	if err != nil {
+		handleDetectionQueryError(c, "Failed to run detection query", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run": run})
+}
+
+// ListRuns returns a detection query's run history, newest first
+func (h *DetectionQueryHandlers) ListRuns(c *gin.Context) {
+	queryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid detection query ID"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	runs, total, err := h.detectionQueryService.ListRuns(queryID, limit, offset)
+	if err != nil {
+		handleDetectionQueryError(c, "Failed to get detection query runs", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":   runs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func handleDetectionQueryError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidDetectionQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid detection query", "message": err.Error()})
+	case errors.Is(err, services.ErrDetectionQueryExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Detection query already exists", "message": err.Error()})
+	case errors.Is(err, services.ErrDetectionQueryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Detection query not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+}
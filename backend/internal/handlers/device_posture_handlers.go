@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// devicePostureMaxBody bounds agent attestations and MDM inventory webhooks
+const devicePostureMaxBody = 1 << 20
+
+// DevicePostureHandlers contains the device posture receivers for the agent and MDMs and
+// the endpoints to review reported posture
+type DevicePostureHandlers struct {
+	posture *services.DevicePostureService
+}
+
+// NewDevicePostureHandlers creates new device posture handlers
+func NewDevicePostureHandlers(posture *services.DevicePostureService) *DevicePostureHandlers {
+	return &DevicePostureHandlers{posture: posture}
+}
+
+// ReportPosture records an attestation from the CloudGate agent, sent through a service
+// account with the devices:posture scope
+func (h *DevicePostureHandlers) ReportPosture(c *gin.Context) {
+	var req services.PostureAttestation
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, devicePostureMaxBody)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	req.Source = models.PostureSourceAgent
+
+	posture, err := h.posture.RecordAttestation(req, time.Now())
+	if errors.Is(err, services.ErrInvalidPosture) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attestation", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record device posture: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record device posture"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posture": posture})
+}
+
+// IntuneWebhook records the posture of Intune managed devices pushed as Microsoft Graph
+// managedDevice objects
+func (h *DevicePostureHandlers) IntuneWebhook(c *gin.Context) {
+	h.receiveWebhook(c, models.PostureSourceIntune, services.ParseIntuneDevices)
+}
+
+// JamfWebhook records the posture of a computer from its Jamf Pro inventory record
+func (h *DevicePostureHandlers) JamfWebhook(c *gin.Context) {
+	h.receiveWebhook(c, models.PostureSourceJamf, services.ParseJamfComputer)
+}
+
+// receiveWebhook authenticates an MDM webhook by its bearer secret and records each device
+// it reports. Devices of unknown users are skipped so one bad record does not fail a batch.
+func (h *DevicePostureHandlers) receiveWebhook(c *gin.Context, source string, parse func([]byte) ([]services.PostureAttestation, error)) {
+	if err := h.posture.VerifyWebhook(source, c.GetHeader("Authorization")); err != nil {
+		if errors.Is(err, services.ErrPostureWebhookNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Posture webhook not configured"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook secret"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, devicePostureMaxBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	attestations, err := parse(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	recorded, skipped := 0, 0
+	for _, attestation := range attestations {
+		if _, err := h.posture.RecordAttestation(attestation, now); err != nil {
+			if !errors.Is(err, services.ErrInvalidPosture) {
+				log.Printf("Failed to record %s device posture: %v", source, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record device posture"})
+				return
+			}
+			skipped++
+			continue
+		}
+		recorded++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recorded": recorded, "skipped": skipped})
+}
+
+// GetMyDevices returns the posture reported for the signed-in user's devices
+func (h *DevicePostureHandlers) GetMyDevices(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	id := userID.(uuid.UUID)
+
+	postures, err := h.posture.ListPostures(&id, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list devices", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": postures, "count": len(postures)})
+}
+
+// ListPostures returns reported device posture, optionally filtered by user or compliance
+func (h *DevicePostureHandlers) ListPostures(c *gin.Context) {
+	var userID *uuid.UUID
+	if value := c.Query("user_id"); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id", "message": "user_id must be a valid UUID"})
+			return
+		}
+		userID = &parsed
+	}
+	var compliant *bool
+	if value := c.Query("compliant"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid compliant filter"})
+			return
+		}
+		compliant = &parsed
+	}
+
+	postures, err := h.posture.ListPostures(userID, compliant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list devices", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": postures, "count": len(postures)})
+}
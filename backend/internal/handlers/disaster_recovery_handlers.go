@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// disasterRecovery switches sign-in to work without database writes. It is set by
+// SetupRoutes; when nil DR mode is never active.
+var disasterRecovery *services.DisasterRecoveryService
+
+// drWritablePaths keep accepting writes in DR mode: sign-in, app launches and the DR
+// switch itself, none of which need to write to the database while it is a replica
+var drWritablePaths = []string{"/auth/login", "/auth/refresh", "/auth/logout", "/apps/launch", "/admin/dr-mode"}
+
+// DisasterRecoveryHandlers contains the DR mode middleware and switch
+type DisasterRecoveryHandlers struct {
+	disasterRecoveryService *services.DisasterRecoveryService
+}
+
+// NewDisasterRecoveryHandlers creates new disaster recovery handlers
+func NewDisasterRecoveryHandlers(disasterRecoveryService *services.DisasterRecoveryService) *DisasterRecoveryHandlers {
+	return &DisasterRecoveryHandlers{disasterRecoveryService: disasterRecoveryService}
+}
+
+func inDisasterRecovery() bool {
+	return disasterRecovery != nil && disasterRecovery.Enabled()
+}
+
+// SetDisasterRecoveryModeRequest represents an admin's request to switch DR mode
+type SetDisasterRecoveryModeRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// BlockWritesDuringRecovery refuses configuration changes while in DR mode. Reads pass,
+// as do the sign-in and launch endpoints that work from replicated data.
+func (h *DisasterRecoveryHandlers) BlockWritesDuringRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.disasterRecoveryService.Enabled() {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		for _, allowed := range drWritablePaths {
+			if path == allowed || strings.HasPrefix(path, allowed+"/") {
+				c.Next()
+				return
+			}
+		}
+
+		c.Header("Retry-After", "300")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "read_only_mode",
+			"message": "CloudGate is running in disaster recovery mode; changes are unavailable until the primary database is restored",
+		})
+		c.Abort()
+	}
+}
+
+// GetStatus returns the DR mode state of this instance
+func (h *DisasterRecoveryHandlers) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.disasterRecoveryService.Status())
+}
+
+// SetMode switches DR mode on or off. Switching it off replays the queued writes.
+func (h *DisasterRecoveryHandlers) SetMode(c *gin.Context) {
+	var req SetDisasterRecoveryModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	if req.Enabled {
+		reason := strings.TrimSpace(req.Reason)
+		if reason == "" {
+			reason = "enabled by " + c.GetString("email")
+		}
+		h.disasterRecoveryService.Enable(reason, time.Now())
+		services.LogAuditEvent(c.Request.Context(), getUserIDFromContext(c), "dr_mode_enabled", "disaster_recovery", "", c.ClientIP(), c.GetHeader("User-Agent"), reason, "success")
+		c.JSON(http.StatusOK, h.disasterRecoveryService.Status())
+		return
+	}
+
+	replayed, err := h.disasterRecoveryService.Disable()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay queued writes", "message": err.Error(), "replayed": replayed, "status": h.disasterRecoveryService.Status()})
+		return
+	}
+	services.LogAuditEvent(c.Request.Context(), getUserIDFromContext(c), "dr_mode_disabled", "disaster_recovery", "", c.ClientIP(), c.GetHeader("User-Agent"), "", "success")
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed, "status": h.disasterRecoveryService.Status()})
+}
+
+// ReplayQueue retries writing queued entries after DR mode has been switched off
+func (h *DisasterRecoveryHandlers) ReplayQueue(c *gin.Context) {
+	if h.disasterRecoveryService.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "DR mode is active", "message": "Queued writes are replayed once DR mode is switched off"})
+		return
+	}
+	replayed, err := h.disasterRecoveryService.Replay()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay queued writes", "message": err.Error(), "replayed": replayed})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed, "status": h.disasterRecoveryService.Status()})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// EmergencyHandlers contains emergency sign-out HTTP handlers
+type EmergencyHandlers struct {
+	emergencyService *services.EmergencyService
+}
+
+// NewEmergencyHandlers creates new emergency handlers
+func NewEmergencyHandlers(emergencyService *services.EmergencyService) *EmergencyHandlers {
+	return &EmergencyHandlers{
+		emergencyService: emergencyService,
+	}
+}
+
+// EmergencySignoutRequest represents an admin's emergency sign-out
+type EmergencySignoutRequest struct {
+	Scope               string `json:"scope" binding:"required"` // global or domain
+	Domain              string `json:"domain"`
+	Reason              string `json:"reason" binding:"required"`
+	RequireMFA          *bool  `json:"require_mfa"`
+	RefreshPauseMinutes int    `json:"refresh_pause_minutes"`
+}
+
+// TriggerSignout revokes all sessions in scope and locks down re-authentication
+func (h *EmergencyHandlers) TriggerSignout(c *gin.Context) {
+	var req EmergencySignoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	requireMFA := true
+	if req.RequireMFA != nil {
+		requireMFA = *req.RequireMFA
+	}
+
+	lockdown, err := h.emergencyService.TriggerSignout(services.EmergencySignoutInput{
+		Scope:        req.Scope,
+		Domain:       req.Domain,
+		Reason:       req.Reason,
+		RequireMFA:   requireMFA,
+		RefreshPause: time.Duration(req.RefreshPauseMinutes) * time.Minute,
+	}, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidLockdownScope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to trigger emergency sign-out", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"lockdown": lockdown})
+}
+
+// ListLockdowns returns emergency lockdowns, only active ones with ?active=true
+func (h *EmergencyHandlers) ListLockdowns(c *gin.Context) {
+	lockdowns, err := h.emergencyService.ListLockdowns(c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lockdowns", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockdowns": lockdowns, "count": len(lockdowns)})
+}
+
+// LiftLockdown ends an active emergency lockdown
+func (h *EmergencyHandlers) LiftLockdown(c *gin.Context) {
+	lockdownID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lockdown ID"})
+		return
+	}
+
+	err = h.emergencyService.LiftLockdown(lockdownID, getAnalystID(c))
+	if errors.Is(err, services.ErrLockdownNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active lockdown not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift lockdown", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockdown lifted"})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// EntityGraphHandlers contains entity risk graph HTTP handlers
+type EntityGraphHandlers struct {
+	entityGraphService *services.EntityGraphService
+	adminLinks         *services.AdminLinkService
+}
+
+// NewEntityGraphHandlers creates new entity graph handlers
+func NewEntityGraphHandlers(entityGraphService *services.EntityGraphService, adminLinks *services.AdminLinkService) *EntityGraphHandlers {
+	return &EntityGraphHandlers{
+		entityGraphService: entityGraphService,
+		adminLinks:         adminLinks,
+	}
+}
+
+// GetEntityGraph returns the entities linked to a user, device, IP address or app.
+// Supports ?depth= (1-3, default 1), ?types=user,device,ip,app and ?since= (RFC3339), so
+// "what else did this IP touch?" is /ip/:value and "which users share this device?" is
+// /device/:fingerprint?types=user. A user graph links the user in connected providers'
+// admin consoles.
+func (h *EntityGraphHandlers) GetEntityGraph(c *gin.Context) {
+	query := services.EntityGraphQuery{}
+
+	var err error
+	query.Depth, err = strconv.Atoi(c.DefaultQuery("depth", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid depth"})
+		return
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since timestamp", "message": err.Error()})
+			return
+		}
+		query.Since = &t
+	}
+	if types := c.Query("types"); types != "" {
+		query.Types = strings.Split(types, ",")
+	}
+
+	graph, err := h.entityGraphService.Traverse(c.Param("type"), c.Param("value"), query, time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownEntityType) || errors.Is(err, services.ErrInvalidGraphQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid graph query", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build entity graph", "message": err.Error()})
+		return
+	}
+
+	if c.Param("type") == services.EntityUser {
+		if userID, err := uuid.Parse(c.Param("value")); err == nil {
+			graph.AdminLinks, err = h.adminLinks.ForUser(userID)
+			if err != nil && !errors.Is(err, services.ErrUserNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build admin console links", "message": err.Error()})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExtensionHandlers contains the endpoints used by the CloudGate browser extension
+type ExtensionHandlers struct {
+	extensionService *services.ExtensionService
+}
+
+// NewExtensionHandlers creates new browser extension handlers
+func NewExtensionHandlers(extensionService *services.ExtensionService) *ExtensionHandlers {
+	return &ExtensionHandlers{extensionService: extensionService}
+}
+
+// ReportDomainsRequest represents the sites the extension saw the user visit
+type ReportDomainsRequest struct {
+	Domains []struct {
+		Domain    string `json:"domain" binding:"required"`
+		Visits    int    `json:"visits"`
+		LoginForm bool   `json:"login_form"`
+	} `json:"domains" binding:"required"`
+}
+
+// ReportEventsRequest represents security observations from the extension
+type ReportEventsRequest struct {
+	Events []struct {
+		Type        string    `json:"type" binding:"required"`
+		URL         string    `json:"url"`
+		Description string    `json:"description"`
+		OccurredAt  time.Time `json:"occurred_at"`
+	} `json:"events" binding:"required"`
+}
+
+// Session is a cheap check the extension polls to know whether the user is signed in. It
+// answers from the access token alone, without touching the database.
+func (h *ExtensionHandlers) Session(c *gin.Context) {
+	session := gin.H{
+		"authenticated": true,
+		"user": gin.H{
+			"id":       getUserIDFromContext(c),
+			"email":    c.GetString("email"),
+			"username": c.GetString("username"),
+		},
+		"aal":           c.GetInt("aal"),
+		"impersonating": false,
+		"server_time":   time.Now().UTC(),
+	}
+	if sessionID, ok := c.Get("sessionID"); ok {
+		session["session_id"] = sessionID
+	}
+	if _, ok := c.Get("impersonatorID"); ok {
+		session["impersonating"] = true
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, session)
+}
+
+// Apps returns the app catalog with launch URLs for the extension's menu
+func (h *ExtensionHandlers) Apps(c *gin.Context) {
+	apps := h.extensionService.Apps(c.GetInt("aal"), getEnv("BACKEND_URL", "http://localhost:8081"))
+	c.JSON(http.StatusOK, gin.H{"apps": apps, "count": len(apps)})
+}
+
+// ReportDomains records sites visited by the user that may be unsanctioned SaaS apps
+func (h *ExtensionHandlers) ReportDomains(c *gin.Context) {
+	userID, err := uuid.Parse(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	var req ReportDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	inputs := make([]services.ExtensionDomainInput, 0, len(req.Domains))
+	for _, domain := range req.Domains {
+		inputs = append(inputs, services.ExtensionDomainInput{Domain: domain.Domain, Visits: domain.Visits, LoginForm: domain.LoginForm})
+	}
+	result, err := h.extensionService.ReportDomains(userID, inputs, time.Now())
+	if errors.Is(err, services.ErrInvalidExtensionReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record domains", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"result": result})
+}
+
+// ReportEvents feeds the extension's security observations into security monitoring
+func (h *ExtensionHandlers) ReportEvents(c *gin.Context) {
+	userID, err := uuid.Parse(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	var req ReportEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	inputs := make([]services.ExtensionEventInput, 0, len(req.Events))
+	for _, event := range req.Events {
+		inputs = append(inputs, services.ExtensionEventInput{Type: event.Type, URL: event.URL, Description: event.Description, OccurredAt: event.OccurredAt})
+	}
+	recorded, err := h.extensionService.ReportEvents(userID, inputs, tokenSource(c, "browser_extension"), time.Now())
+	if errors.Is(err, services.ErrInvalidExtensionReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record events", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"recorded": recorded})
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// FileUploadHandlers contains file upload HTTP handlers
+type FileUploadHandlers struct {
+	uploadService *services.FileUploadService
+	caseService   *services.CaseService
+}
+
+// NewFileUploadHandlers creates new file upload handlers
+func NewFileUploadHandlers(uploadService *services.FileUploadService, caseService *services.CaseService) *FileUploadHandlers {
+	return &FileUploadHandlers{
+		uploadService: uploadService,
+		caseService:   caseService,
+	}
+}
+
+// UploadFile accepts a multipart "file" for a "purpose": case_evidence,
+// compliance_report or bulk_import
+func (h *FileUploadHandlers) UploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	upload, ok := h.upload(c, purpose)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"upload": upload})
+}
+
+// UploadCaseEvidence uploads a file and attaches it to an open case as evidence
+func (h *FileUploadHandlers) UploadCaseEvidence(c *gin.Context) {
+	caseID, ok := parseCaseID(c)
+	if !ok {
+		return
+	}
+	upload, ok := h.upload(c, models.UploadPurposeCaseEvidence)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		name = upload.Filename
+	}
+	evidence, err := h.caseService.AddEvidence(caseID, name, c.PostForm("description"), "upload:"+upload.ID.String(), upload.SHA256, getAnalystID(c))
+	if err != nil {
+		// Evidence for a missing or closed case is not kept
+		if delErr := h.uploadService.Delete(c.Request.Context(), upload.ID, getAnalystID(c), time.Now()); delErr != nil {
+			log.Printf("Failed to remove unattached evidence upload %s: %v", upload.ID, delErr)
+		}
+		respondCaseError(c, err, "Failed to add evidence")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"evidence": evidence, "upload": upload})
+}
+
+// upload reads the request's file and stores it, writing the error response on failure
+func (h *FileUploadHandlers) upload(c *gin.Context, purpose string) (*models.FileUpload, bool) {
+	maxBytes, known := services.UploadMaxBytes(purpose)
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload", "message": fmt.Sprintf("unknown purpose %q", purpose)})
+		return nil, false
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload", "message": err.Error()})
+		return nil, false
+	}
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload too large", "message": fmt.Sprintf("%s uploads are limited to %d bytes", purpose, maxBytes)})
+		return nil, false
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload", "message": err.Error()})
+		return nil, false
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload", "message": err.Error()})
+		return nil, false
+	}
+
+	upload, err := h.uploadService.Upload(c.Request.Context(), services.UploadInput{
+		Purpose:    purpose,
+		Filename:   header.Filename,
+		Content:    content,
+		UploadedBy: getAnalystID(c),
+		IPAddress:  c.ClientIP(),
+	}, time.Now())
+	if err != nil {
+		handleUploadError(c, "Failed to upload file", err)
+		return nil, false
+	}
+	return upload, true
+}
+
+// GetUpload returns an upload's details
+func (h *FileUploadHandlers) GetUpload(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return
+	}
+
+	upload, err := h.uploadService.Get(id, time.Now())
+	if err != nil {
+		handleUploadError(c, "Failed to get upload", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+// GetDownloadURL returns a short-lived signed URL for downloading an upload
+func (h *FileUploadHandlers) GetDownloadURL(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return
+	}
+
+	url, expiresAt, err := h.uploadService.DownloadURL(id, getAnalystID(c), time.Now())
+	if err != nil {
+		handleUploadError(c, "Failed to create download URL", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": expiresAt})
+}
+
+// DeleteUpload removes an upload from storage
+func (h *FileUploadHandlers) DeleteUpload(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return
+	}
+
+	if err := h.uploadService.Delete(c.Request.Context(), id, getAnalystID(c), time.Now()); err != nil {
+		handleUploadError(c, "Failed to delete upload", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload deleted successfully"})
+}
+
+// ServeLocalFile serves a signed download URL when uploads are kept on local disk. The
+// signature is the only authorization, as with a GCS signed URL.
+func (h *FileUploadHandlers) ServeLocalFile(c *gin.Context) {
+	store := h.uploadService.LocalStore()
+	if store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	filename := c.Query("filename")
+	file, err := store.Open(strings.TrimPrefix(c.Param("key"), "/"), filename, c.Query("expires"), c.Query("signature"), time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSignedURL) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired download URL"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.ReplaceAll(filename, `"`, "")))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, -1, "application/octet-stream", file, nil)
+}
+
+func handleUploadError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidUpload):
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrUploadTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrUploadTypeNotAllowed):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrUploadInfected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrUploadScanFailed):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": message, "message": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"cloudgate-backend/internal/middleware"
 	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
 	"cloudgate-backend/pkg/types"
 )
 
@@ -88,13 +90,30 @@ func ConnectAppHandler(c *gin.Context) {
 		return
 	}
 
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !checkConsent(c, services.NewConsentService(services.GetDB()), userUUID, app.ID) {
+		return
+	}
+	if !checkAccessSchedule(c, services.NewAccessScheduleService(services.GetDB()), userUUID, app.ID) {
+		return
+	}
+
+	state, ok := issueOAuthState(c, "apps")
+	if !ok {
+		return
+	}
+
 	// Simulate OAuth connection initiation
-	connectionURL := fmt.Sprintf("https://auth.%s.com/oauth2/authorize?client_id=%s&redirect_uri=%s&response_type=code&scope=%s",
-		app.ID, "your_client_id", "https://yourapp.com/oauth/callback", "read write")
+	connectionURL := fmt.Sprintf("https://auth.%s.com/oauth2/authorize?client_id=%s&redirect_uri=%s&response_type=code&scope=%s&state=%s",
+		app.ID, "your_client_id", "https://yourapp.com/oauth/callback", "read write", state)
 
 	response := types.AppConnectionResponse{
 		AuthURL: connectionURL,
-		State:   "mock_state_value",
+		State:   state,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -109,11 +128,13 @@ func OAuthCallbackHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code or state"})
 		return
 	}
+	if _, ok := checkOAuthState(c, "apps", state); !ok {
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "OAuth callback received",
 		"code":    code,
-		"state":   state,
 	})
 }
 
@@ -131,14 +152,73 @@ func LaunchAppHandler(c *gin.Context) {
 		return
 	}
 
+	// Apps may demand a stronger session than a password login provides
+	if app, ok := services.GetSaaSApp(request.AppID); ok && app.RequiredAAL > c.GetInt("aal") {
+		middleware.ChallengeStepUp(c, gin.H{
+			"message":      fmt.Sprintf("%s requires a stronger authentication method", app.Name),
+			"current_aal":  c.GetInt("aal"),
+			"required_aal": app.RequiredAAL,
+		})
+		return
+	}
+
+	if userUUID, err := uuid.Parse(userID); err == nil {
+		if !checkAccessSchedule(c, services.NewAccessScheduleService(services.GetDB()), userUUID, request.AppID) {
+			return
+		}
+
+		// Launch analytics are not recorded while the database is a read-only replica
+		if !inDisasterRecovery() {
+			analyticsService := services.NewAnalyticsService(services.GetDB())
+			if err := analyticsService.RecordAppLaunch(userUUID, request.AppID, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+				log.Printf("Error recording app launch: %v", err)
+			}
+		}
+	}
+
+	// Apps may also limit how old, idle or strong the session they are opened from may be
+	var sessionEnds time.Time
+	if app, ok := services.GetSaaSApp(request.AppID); ok {
+		ends, allowed := checkAppSessionPolicy(c, services.NewAppSessionPolicyService(services.GetDB()), app)
+		if !allowed {
+			return
+		}
+		sessionEnds = ends
+	}
+
+	// Header-auth apps are opened through CloudGate's proxy, which signs the user in
+	if app, ok := services.GetSaaSApp(request.AppID); ok && app.Protocol == constants.ProtocolHeaderProxy {
+		c.JSON(http.StatusOK, types.AppLaunchResponse{
+			LaunchURL: getEnv("BACKEND_URL", "http://localhost:8081") + "/proxy/" + app.ID + "/",
+			Method:    "redirect",
+		})
+		return
+	}
+
+	// Bookmark apps have no SSO; the browser opens them and may auto-fill saved credentials
+	if app, ok := services.GetSaaSApp(request.AppID); ok && app.Protocol == constants.ProtocolBookmark {
+		response := types.AppLaunchResponse{LaunchURL: app.LaunchURL, Method: "redirect"}
+		if app.Config["credentials"] == "optional" {
+			response.AutofillURL = "/apps/" + app.ID + "/autofill"
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
 	// Simulate generating a temporary access token for app launch
 	launchToken := uuid.New().String()
 
+	// The launch token never outlives the app session its policy allows
+	expiresIn := int64(300)
+	if !sessionEnds.IsZero() {
+		expiresIn = min(expiresIn, int64(time.Until(sessionEnds).Seconds()))
+	}
+
 	response := types.AppLaunchResponse{
 		LaunchURL: fmt.Sprintf("https://app.%s.com/dashboard?token=%s", request.AppID, launchToken),
 		Method:    "redirect",
 		Token:     launchToken,
-		ExpiresIn: 300,
+		ExpiresIn: expiresIn,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -146,11 +226,15 @@ func LaunchAppHandler(c *gin.Context) {
 
 // Helper function to extract user ID from request context
 func getUserIDFromContext(c *gin.Context) string {
-	userID, exists := c.Get("userID")
+	value, exists := c.Get("userID")
 	if !exists {
 		return ""
 	}
-	return userID.(uuid.UUID).String()
+	userID, ok := value.(uuid.UUID)
+	if !ok || userID == uuid.Nil {
+		return ""
+	}
+	return userID.String()
 }
 
 // DatabaseHealthCheckHandler checks database connectivity
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// HeaderProxyHandlers contains the header-injection proxy and its admin handlers
+type HeaderProxyHandlers struct {
+	proxyService    *services.HeaderProxyService
+	consentService  *services.ConsentService
+	scheduleService *services.AccessScheduleService
+	policyService   *services.AppSessionPolicyService
+}
+
+// NewHeaderProxyHandlers creates new header proxy handlers
+func NewHeaderProxyHandlers(proxyService *services.HeaderProxyService, consentService *services.ConsentService, scheduleService *services.AccessScheduleService, policyService *services.AppSessionPolicyService) *HeaderProxyHandlers {
+	return &HeaderProxyHandlers{
+		proxyService:    proxyService,
+		consentService:  consentService,
+		scheduleService: scheduleService,
+		policyService:   policyService,
+	}
+}
+
+// SetHeaderProxyRequest represents an admin's upstream configuration for an app
+type SetHeaderProxyRequest struct {
+	UpstreamURL       string   `json:"upstream_url" binding:"required"`
+	UserHeader        string   `json:"user_header"`
+	EmailHeader       string   `json:"email_header"`
+	GroupsHeader      string   `json:"groups_header"`
+	DefaultGroups     []string `json:"default_groups"`
+	SharedSecret      string   `json:"shared_secret"`
+	RequireAssignment bool     `json:"require_assignment"`
+	Enabled           *bool    `json:"enabled"`
+}
+
+// SetHeaderProxyAssignmentRequest represents the groups an admin gives a user in an app
+type SetHeaderProxyAssignmentRequest struct {
+	Groups []string `json:"groups"`
+}
+
+// Proxy forwards a request to a header-auth app's upstream as the signed-in user, after
+// the same assurance level, consent and access schedule checks as any other launch
+func (h *HeaderProxyHandlers) Proxy(c *gin.Context) {
+	appID := c.Param("appId")
+	userID := getUserIDFromContext(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	app, exists := services.GetSaaSApp(appID)
+	if !exists || app.Protocol != constants.ProtocolHeaderProxy {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	// Apps may demand a stronger session than a password login provides
+	if app.RequiredAAL > c.GetInt("aal") {
+		middleware.ChallengeStepUp(c, gin.H{
+			"message":      fmt.Sprintf("%s requires a stronger authentication method", app.Name),
+			"current_aal":  c.GetInt("aal"),
+			"required_aal": app.RequiredAAL,
+		})
+		return
+	}
+	if !checkConsent(c, h.consentService, userUUID, app.ID) || !checkAccessSchedule(c, h.scheduleService, userUUID, app.ID) {
+		return
+	}
+	if _, ok := checkAppSessionPolicy(c, h.policyService, app); !ok {
+		return
+	}
+
+	config, identity, err := h.proxyService.Authorize(app.ID, userUUID, c.GetString("username"), c.GetString("email"))
+	if err != nil {
+		services.LogAuditEvent(c.Request.Context(), userID, "header_proxy_denied", "app", app.ID, c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+		switch {
+		case errors.Is(err, services.ErrHeaderProxyNotFound), errors.Is(err, services.ErrHeaderProxyDisabled):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Application unavailable", "message": err.Error()})
+		case errors.Is(err, services.ErrHeaderProxyNotAssigned):
+			c.JSON(http.StatusForbidden, gin.H{"error": "not_assigned", "message": fmt.Sprintf("You have not been given access to %s", app.Name)})
+		default:
+			log.Printf("Error authorizing header proxy request for %s: %v", app.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize request"})
+		}
+		return
+	}
+	proxy, err := h.proxyService.NewProxy(config, identity, c.Param("path"))
+	if err != nil {
+		log.Printf("Error building header proxy for %s: %v", app.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Upstream misconfigured"})
+		return
+	}
+
+	started := time.Now()
+	proxy.ServeHTTP(c.Writer, c.Request)
+
+	entry := &models.HeaderProxyRequestLog{
+		AppID:      app.ID,
+		UserID:     userUUID,
+		Method:     c.Request.Method,
+		Path:       c.Param("path"),
+		StatusCode: c.Writer.Status(),
+		DurationMs: time.Since(started).Milliseconds(),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.GetHeader("User-Agent"),
+	}
+	if sessionID, ok := c.Get("sessionID"); ok {
+		if id, ok := sessionID.(uuid.UUID); ok {
+			entry.SessionID = &id
+		}
+	}
+	h.proxyService.LogRequest(entry)
+}
+
+// ListApps returns every configured header proxy app
+func (h *HeaderProxyHandlers) ListApps(c *gin.Context) {
+	configs, err := h.proxyService.ListApps()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list header proxy apps", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apps": configs, "count": len(configs)})
+}
+
+// GetApp returns the header proxy configuration for an app
+func (h *HeaderProxyHandlers) GetApp(c *gin.Context) {
+	config, err := h.proxyService.GetApp(c.Param("appId"))
+	if errors.Is(err, services.ErrHeaderProxyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No header proxy for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get header proxy app", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"app": config})
+}
+
+// SetApp creates or replaces the header proxy configuration for an app
+func (h *HeaderProxyHandlers) SetApp(c *gin.Context) {
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req SetHeaderProxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	config, err := h.proxyService.SetApp(appID, services.HeaderProxyInput{
+		UpstreamURL:       req.UpstreamURL,
+		UserHeader:        req.UserHeader,
+		EmailHeader:       req.EmailHeader,
+		GroupsHeader:      req.GroupsHeader,
+		DefaultGroups:     req.DefaultGroups,
+		SharedSecret:      req.SharedSecret,
+		RequireAssignment: req.RequireAssignment,
+		Enabled:           enabled,
+	}, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidHeaderProxy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid header proxy configuration", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save header proxy app", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"app": config})
+}
+
+// DeleteApp removes the header proxy configuration for an app
+func (h *HeaderProxyHandlers) DeleteApp(c *gin.Context) {
+	err := h.proxyService.DeleteApp(c.Param("appId"), getAnalystID(c))
+	if errors.Is(err, services.ErrHeaderProxyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No header proxy for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete header proxy app", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Header proxy removed"})
+}
+
+// ListAssignments returns the users assigned to a header proxy app
+func (h *HeaderProxyHandlers) ListAssignments(c *gin.Context) {
+	assignments, err := h.proxyService.ListAssignments(c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list assignments", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments, "count": len(assignments)})
+}
+
+// SetAssignment assigns a user to a header proxy app with the groups sent for them
+func (h *HeaderProxyHandlers) SetAssignment(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": err.Error()})
+		return
+	}
+	var req SetHeaderProxyAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	assignment, err := h.proxyService.SetAssignment(c.Param("appId"), userID, req.Groups, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrHeaderProxyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No header proxy for this app"})
+	case errors.Is(err, services.ErrInvalidHeaderProxy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment", "message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save assignment", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"assignment": assignment})
+	}
+}
+
+// DeleteAssignment removes a user's assignment to a header proxy app
+func (h *HeaderProxyHandlers) DeleteAssignment(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": err.Error()})
+		return
+	}
+
+	err = h.proxyService.DeleteAssignment(c.Param("appId"), userID, getAnalystID(c))
+	if errors.Is(err, services.ErrHeaderProxyAssignmentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not assigned to this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete assignment", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Assignment removed"})
+}
+
+// ListRequestLogs returns recent proxied requests for an app, optionally ?user_id= and ?limit=
+func (h *HeaderProxyHandlers) ListRequestLogs(c *gin.Context) {
+	var userID *uuid.UUID
+	if value := c.Query("user_id"); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": err.Error()})
+			return
+		}
+		userID = &parsed
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	logs, err := h.proxyService.ListRequestLogs(c.Param("appId"), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list requests", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": logs, "count": len(logs)})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandlers contains the liveness and readiness probes for Cloud Run and load balancers
+type HealthHandlers struct {
+	health  *services.HealthService
+	started time.Time
+}
+
+// NewHealthHandlers creates new probe handlers
+func NewHealthHandlers(health *services.HealthService) *HealthHandlers {
+	return &HealthHandlers{health: health, started: time.Now()}
+}
+
+// Liveness answers while the process can serve HTTP at all. It checks no dependencies, so
+// an outage elsewhere does not get every instance restarted.
+func (h *HealthHandlers) Liveness(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "alive",
+		"uptime_seconds": int64(time.Since(h.started).Seconds()),
+	})
+}
+
+// Readiness reports each dependency's status, answering 503 when a critical one is down
+// so the instance is taken out of rotation until it recovers
+func (h *HealthHandlers) Readiness(c *gin.Context) {
+	report := h.health.Check(c.Request.Context())
+	c.Header("Cache-Control", "no-store")
+	if !report.Ready() {
+		log.Printf("⚠️ Readiness check failed: %+v", report.Checks)
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
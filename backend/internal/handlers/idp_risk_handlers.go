@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// idpRiskMaxBody bounds security event tokens and Graph notification batches
+const idpRiskMaxBody = 1 << 20
+
+// IdPRiskHandlers contains the identity provider risk signal receivers and the admin
+// endpoints to review signals
+type IdPRiskHandlers struct {
+	risk *services.IdPRiskSignalService
+}
+
+// NewIdPRiskHandlers creates new identity provider risk signal handlers
+func NewIdPRiskHandlers(risk *services.IdPRiskSignalService) *IdPRiskHandlers {
+	return &IdPRiskHandlers{risk: risk}
+}
+
+// GoogleEvent receives a RISC security event token pushed by Google, answering as
+// security event token push delivery expects
+func (h *IdPRiskHandlers) GoogleEvent(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, idpRiskMaxBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"err": "invalid_request", "description": "Failed to read request body"})
+		return
+	}
+
+	signals, err := h.risk.ReceiveGoogleEvent(c.Request.Context(), string(body), time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRiskConnectorNotConfigured):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"err": "not_configured", "description": err.Error()})
+		case errors.Is(err, services.ErrInvalidRiskSignal):
+			c.JSON(http.StatusBadRequest, gin.H{"err": "authentication_failed", "description": err.Error()})
+		default:
+			log.Printf("Failed to record Google risk signal: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"err": "internal_error"})
+		}
+		return
+	}
+	if len(signals) > 0 {
+		log.Printf("🔐 Recorded %d Google risk signal(s)", len(signals))
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// MicrosoftNotification answers Microsoft Graph's subscription validation and, for change
+// notifications carrying the subscription's client state, syncs Entra risky users early
+func (h *IdPRiskHandlers) MicrosoftNotification(c *gin.Context) {
+	if token := c.Query("validationToken"); token != "" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(token))
+		return
+	}
+
+	var req struct {
+		Value []services.GraphNotification `json:"value"`
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, idpRiskMaxBody)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	if err := h.risk.VerifyMicrosoftNotifications(req.Value); err != nil {
+		if errors.Is(err, services.ErrRiskConnectorNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Microsoft risk signals not configured"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid notification", "message": err.Error()})
+		return
+	}
+
+	// Graph expects an answer within seconds, so the sync runs after responding
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		recorded, err := h.risk.SyncMicrosoft(ctx, time.Now())
+		if err != nil {
+			log.Printf("⚠️ Microsoft risk signal sync failed: %v", err)
+			return
+		}
+		if recorded > 0 {
+			log.Printf("🔐 Recorded %d Microsoft risk signal(s)", recorded)
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// ListSignals returns recent identity provider risk signals, optionally filtered by
+// provider or user
+func (h *IdPRiskHandlers) ListSignals(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	var userID *uuid.UUID
+	if value := c.Query("user_id"); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id", "message": "user_id must be a valid UUID"})
+			return
+		}
+		userID = &parsed
+	}
+
+	signals, err := h.risk.List(c.Query("provider"), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list risk signals", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"signals":   signals,
+		"count":     len(signals),
+		"google":    h.risk.GoogleEnabled(),
+		"microsoft": h.risk.MicrosoftEnabled(),
+	})
+}
+
+// SyncMicrosoft polls Microsoft Entra risky users now
+func (h *IdPRiskHandlers) SyncMicrosoft(c *gin.Context) {
+	recorded, err := h.risk.SyncMicrosoft(c.Request.Context(), time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrRiskConnectorNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Microsoft risk signals not configured"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sync Microsoft risk signals", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Microsoft risk signals synced", "recorded": recorded})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ImpersonationHandlers contains the support impersonation ("login as user") handlers
+type ImpersonationHandlers struct {
+	impersonationService *services.ImpersonationService
+	userService          *services.UserService
+	cfg                  *config.Config
+}
+
+// NewImpersonationHandlers creates new impersonation handlers
+func NewImpersonationHandlers(impersonationService *services.ImpersonationService, userService *services.UserService, cfg *config.Config) *ImpersonationHandlers {
+	return &ImpersonationHandlers{
+		impersonationService: impersonationService,
+		userService:          userService,
+		cfg:                  cfg,
+	}
+}
+
+// ImpersonationRequest represents an administrator's request to act as a user
+type ImpersonationRequest struct {
+	UserID          string `json:"user_id" binding:"required"`
+	Reason          string `json:"reason" binding:"required"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+// RequestImpersonation asks to impersonate a user; it starts out pending the user's
+// consent unless consent is not required
+func (h *ImpersonationHandlers) RequestImpersonation(c *gin.Context) {
+	adminID, ok := h.callerID(c)
+	if !ok {
+		return
+	}
+	var req ImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+	targetID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": err.Error()})
+		return
+	}
+
+	impersonation, err := h.impersonationService.Request(adminID, services.ImpersonationInput{
+		TargetUserID: targetID,
+		Reason:       req.Reason,
+		Duration:     time.Duration(req.DurationMinutes) * time.Minute,
+	}, tokenSource(c, "impersonation"), time.Now())
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to request impersonation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"impersonation": impersonation})
+}
+
+// ListImpersonations returns impersonations for administrators, optionally ?status=
+func (h *ImpersonationHandlers) ListImpersonations(c *gin.Context) {
+	impersonations, err := h.impersonationService.List(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list impersonations", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonations": impersonations, "count": len(impersonations)})
+}
+
+// StartImpersonation begins an approved impersonation and returns tokens for the
+// impersonation session. They are not set as cookies, so the administrator's own
+// session in the browser is left untouched.
+func (h *ImpersonationHandlers) StartImpersonation(c *gin.Context) {
+	adminID, ok := h.callerID(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation ID", "message": err.Error()})
+		return
+	}
+
+	impersonation, session, err := h.impersonationService.Start(adminID, id, tokenSource(c, "impersonation"), time.Now())
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to start impersonation")
+		return
+	}
+	user, err := h.userService.GetUserByID(impersonation.TargetUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user", "message": err.Error()})
+		return
+	}
+	accessToken, expiresIn, err := generateImpersonationAccessToken(h.cfg, user, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+	banner, err := h.impersonationService.Banner(session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build banner", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"impersonation": impersonation,
+		"banner":        banner,
+		"access_token":  accessToken,
+		"refresh_token": session.SessionToken,
+		"expires_in":    expiresIn,
+		"token_type":    "Bearer",
+	})
+}
+
+// EndImpersonation ends an impersonation by ID; the administrator who requested it and
+// the impersonated user can both end it
+func (h *ImpersonationHandlers) EndImpersonation(c *gin.Context) {
+	actorID, ok := h.callerID(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation ID", "message": err.Error()})
+		return
+	}
+
+	impersonation, err := h.impersonationService.End(actorID, id, tokenSource(c, "impersonation"), time.Now())
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to end impersonation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonation": impersonation})
+}
+
+// ListMyImpersonations returns the caller's pending, active and past impersonations
+func (h *ImpersonationHandlers) ListMyImpersonations(c *gin.Context) {
+	userID, ok := h.callerID(c)
+	if !ok {
+		return
+	}
+	impersonations, err := h.impersonationService.ListForUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list impersonations", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonations": impersonations, "count": len(impersonations)})
+}
+
+// ApproveImpersonation records the caller's consent to a pending impersonation
+func (h *ImpersonationHandlers) ApproveImpersonation(c *gin.Context) {
+	h.decide(c, true)
+}
+
+// DenyImpersonation refuses a pending impersonation of the caller
+func (h *ImpersonationHandlers) DenyImpersonation(c *gin.Context) {
+	h.decide(c, false)
+}
+
+func (h *ImpersonationHandlers) decide(c *gin.Context, approve bool) {
+	userID, ok := h.callerID(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation ID", "message": err.Error()})
+		return
+	}
+
+	impersonation, err := h.impersonationService.Decide(userID, id, approve, tokenSource(c, "impersonation"), time.Now())
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to record decision")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonation": impersonation})
+}
+
+// GetCurrentImpersonation tells the frontend whether the caller's session is an
+// impersonation, with the banner to show if it is
+func (h *ImpersonationHandlers) GetCurrentImpersonation(c *gin.Context) {
+	if _, impersonating := c.Get("impersonatorID"); !impersonating {
+		c.JSON(http.StatusOK, gin.H{"impersonating": false})
+		return
+	}
+	banner, err := h.impersonationService.Banner(c.MustGet("sessionID").(uuid.UUID))
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to load impersonation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonating": true, "banner": banner})
+}
+
+// EndCurrentImpersonation ends the impersonation the caller's session belongs to, for
+// the banner's exit button
+func (h *ImpersonationHandlers) EndCurrentImpersonation(c *gin.Context) {
+	impersonatorID, impersonating := c.Get("impersonatorID")
+	if !impersonating {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating", "message": "This session is not an impersonation session"})
+		return
+	}
+	current, err := h.impersonationService.ActiveForSession(c.MustGet("sessionID").(uuid.UUID))
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to load impersonation")
+		return
+	}
+
+	impersonation, err := h.impersonationService.End(impersonatorID.(uuid.UUID), current.ID, tokenSource(c, "impersonation"), time.Now())
+	if err != nil {
+		respondImpersonationError(c, err, "Failed to end impersonation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonation": impersonation})
+}
+
+// AuditImpersonatedRequests records every request made through an impersonation session
+func (h *ImpersonationHandlers) AuditImpersonatedRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		impersonatorID, impersonating := c.Get("impersonatorID")
+		if !impersonating {
+			return
+		}
+		h.impersonationService.RecordRequest(c.MustGet("sessionID").(uuid.UUID), impersonatorID.(uuid.UUID),
+			c.Request.Method, c.Request.URL.Path, c.Writer.Status(), tokenSource(c, "impersonation"))
+	}
+}
+
+func (h *ImpersonationHandlers) callerID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func respondImpersonationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrImpersonationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found", "message": err.Error()})
+	case errors.Is(err, services.ErrInvalidImpersonation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation request", "message": err.Error()})
+	case errors.Is(err, services.ErrImpersonationState):
+		c.JSON(http.StatusConflict, gin.H{"error": "Invalid impersonation state", "message": err.Error()})
+	case errors.Is(err, services.ErrImpersonationEnded):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "impersonation_ended", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+}
+
+// generateImpersonationAccessToken issues an access token for an impersonation session.
+// It names the administrator in an RFC 8693 "act" claim and never outlives the session.
+func generateImpersonationAccessToken(cfg *config.Config, user *models.User, session *models.Session) (string, int, error) {
+	ttl := time.Duration(cfg.AccessTokenTTLMin) * time.Minute
+	if remaining := time.Until(session.ExpiresAt); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 || session.ImpersonatorID == nil {
+		return "", 0, services.ErrImpersonationEnded
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	claims := jwt.MapClaims{
+		"sub":      user.ID.String(),
+		"email":    user.Email,
+		"username": user.Username,
+		"sid":      session.ID.String(),
+		"aal":      session.AuthLevel,
+		"act":      map[string]interface{}{"sub": session.ImpersonatorID.String()},
+		"exp":      expiresAt.Unix(),
+		"iat":      time.Now().Unix(),
+		"typ":      "access",
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(cfg.JWTSecret))
+	if err != nil {
+		return "", 0, err
+	}
+	return signed, int(ttl.Seconds()), nil
+}
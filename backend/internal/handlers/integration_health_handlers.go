@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IntegrationHealthHandlers contains integration health HTTP handlers
+type IntegrationHealthHandlers struct {
+	integrationHealthService *services.IntegrationHealthService
+}
+
+// NewIntegrationHealthHandlers creates new integration health handlers
+func NewIntegrationHealthHandlers(integrationHealthService *services.IntegrationHealthService) *IntegrationHealthHandlers {
+	return &IntegrationHealthHandlers{
+		integrationHealthService: integrationHealthService,
+	}
+}
+
+// GetIntegrationHealth returns the rolling health score of each provider integration, least healthy first
+func (h *IntegrationHealthHandlers) GetIntegrationHealth(c *gin.Context) {
+	integrations, err := h.integrationHealthService.GetIntegrationHealth(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get integration health", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"integrations": integrations,
+		"count":        len(integrations),
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPReputationHandlers contains IP reputation HTTP handlers
+type IPReputationHandlers struct {
+	ipReputationService *services.IPReputationService
+}
+
+// NewIPReputationHandlers creates new IP reputation handlers
+func NewIPReputationHandlers(ipReputationService *services.IPReputationService) *IPReputationHandlers {
+	return &IPReputationHandlers{
+		ipReputationService: ipReputationService,
+	}
+}
+
+// SetIPOverrideRequest allows or denies an IP address regardless of its score
+type SetIPOverrideRequest struct {
+	Override  string     `json:"override" binding:"required"` // allow, deny
+	Reason    string     `json:"reason" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// BlockDeniedIPs refuses every request from an IP address with an active deny override,
+// whether set by an analyst or by an automated block_ip response
+func (h *IPReputationHandlers) BlockDeniedIPs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.ipReputationService.IsBlocked(c.ClientIP(), time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "ip_blocked",
+				"message": "Requests from this IP address are blocked",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListReputations returns a page of known IP addresses with their current score
+func (h *IPReputationHandlers) ListReputations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	reputations, total, err := h.ipReputationService.List(limit, offset, time.Now())
+	if err != nil {
+		log.Printf("Error listing IP reputations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list IP reputations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reputations": reputations,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// GetReputation returns an IP address's reputation and what it is made of
+func (h *IPReputationHandlers) GetReputation(c *gin.Context) {
+	reputation, err := h.ipReputationService.Lookup(c.Request.Context(), c.Param("ip"), time.Now())
+	if err != nil {
+		handleIPReputationError(c, "Failed to get IP reputation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reputation)
+}
+
+// SetOverride allows or denies an IP address, optionally until expires_at
+func (h *IPReputationHandlers) SetOverride(c *gin.Context) {
+	var req SetIPOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	reputation, err := h.ipReputationService.SetOverride(c.Param("ip"), req.Override, req.Reason, req.ExpiresAt, getAnalystID(c), time.Now())
+	if err != nil {
+		handleIPReputationError(c, "Failed to set IP reputation override", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reputation)
+}
+
+// ClearOverride removes an IP address's override so it is scored again
+func (h *IPReputationHandlers) ClearOverride(c *gin.Context) {
+	if err := h.ipReputationService.ClearOverride(c.Param("ip"), getAnalystID(c)); err != nil {
+		handleIPReputationError(c, "Failed to clear IP reputation override", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Override cleared successfully"})
+}
+
+func handleIPReputationError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidIPAddress), errors.Is(err, services.ErrInvalidIPOverride):
+		c.JSON(http.StatusBadRequest, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrIPOverrideNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": message, "message": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
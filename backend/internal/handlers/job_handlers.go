@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// JobHandlers contains background job HTTP handlers. Under /api/v1/jobs users see only
+// the jobs they requested; the admin routes see every job.
+type JobHandlers struct {
+	jobQueue          *services.JobQueue
+	dataExportService *services.UserDataExportService
+}
+
+// NewJobHandlers creates new job handlers
+func NewJobHandlers(jobQueue *services.JobQueue, dataExportService *services.UserDataExportService) *JobHandlers {
+	return &JobHandlers{
+		jobQueue:          jobQueue,
+		dataExportService: dataExportService,
+	}
+}
+
+// ListMyJobs returns the caller's jobs, newest first
+func (h *JobHandlers) ListMyJobs(c *gin.Context) {
+	analystID := getAnalystID(c)
+	if analystID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	h.listJobs(c, analystID)
+}
+
+// ListJobs returns all jobs, filtered by ?kind=, ?status= and ?requested_by=
+func (h *JobHandlers) ListJobs(c *gin.Context) {
+	requestedBy := c.Query("requested_by")
+	requester, ok := parseOptionalUUID(c, &requestedBy, "requested_by")
+	if !ok {
+		return
+	}
+	h.listJobs(c, requester)
+}
+
+func (h *JobHandlers) listJobs(c *gin.Context, requestedBy *uuid.UUID) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	jobs, total, err := h.jobQueue.List(services.JobFilter{
+		Kind:        c.Query("kind"),
+		Status:      c.Query("status"),
+		RequestedBy: requestedBy,
+	}, limit, offset)
+	if err != nil {
+		handleJobError(c, "Failed to list jobs", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "total": total, "limit": limit, "offset": offset})
+}
+
+// GetMyJob returns one of the caller's jobs
+func (h *JobHandlers) GetMyJob(c *gin.Context) {
+	if job, ok := h.loadJob(c, true); ok {
+		c.JSON(http.StatusOK, gin.H{"job": job})
+	}
+}
+
+// GetJob returns any job
+func (h *JobHandlers) GetJob(c *gin.Context) {
+	if job, ok := h.loadJob(c, false); ok {
+		c.JSON(http.StatusOK, gin.H{"job": job})
+	}
+}
+
+// GetMyJobLogs returns the log of one of the caller's jobs
+func (h *JobHandlers) GetMyJobLogs(c *gin.Context) {
+	h.getJobLogs(c, true)
+}
+
+// GetJobLogs returns the log of any job
+func (h *JobHandlers) GetJobLogs(c *gin.Context) {
+	h.getJobLogs(c, false)
+}
+
+func (h *JobHandlers) getJobLogs(c *gin.Context, own bool) {
+	job, ok := h.loadJob(c, own)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	logs, total, err := h.jobQueue.Logs(job.ID, limit, offset)
+	if err != nil {
+		handleJobError(c, "Failed to get job logs", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"logs": logs, "total": total, "limit": limit, "offset": offset})
+}
+
+// GetMyJobResult returns the result of one of the caller's completed jobs
+func (h *JobHandlers) GetMyJobResult(c *gin.Context) {
+	h.getJobResult(c, true)
+}
+
+// GetJobResult returns the result of any completed job
+func (h *JobHandlers) GetJobResult(c *gin.Context) {
+	h.getJobResult(c, false)
+}
+
+func (h *JobHandlers) getJobResult(c *gin.Context, own bool) {
+	job, ok := h.loadJob(c, own)
+	if !ok {
+		return
+	}
+	if job.Status != models.ReportJobCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job has no result", "message": "job is " + job.Status, "job": job})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job, "result": json.RawMessage(job.Result)})
+}
+
+// CancelMyJob cancels one of the caller's jobs
+func (h *JobHandlers) CancelMyJob(c *gin.Context) {
+	h.cancelJob(c, true)
+}
+
+// CancelJob cancels any job
+func (h *JobHandlers) CancelJob(c *gin.Context) {
+	h.cancelJob(c, false)
+}
+
+func (h *JobHandlers) cancelJob(c *gin.Context, own bool) {
+	job, ok := h.loadJob(c, own)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobQueue.Cancel(job.ID, getAnalystID(c))
+	if err != nil {
+		handleJobError(c, "Failed to cancel job", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// RequestMyDataExport starts a GDPR export of the caller's own data
+func (h *JobHandlers) RequestMyDataExport(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	job, err := h.dataExportService.StartExport(*userID, userID)
+	if err != nil {
+		handleJobError(c, "Failed to start data export", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// RequestUserDataExport starts a GDPR export of a user's data on their behalf
+func (h *JobHandlers) RequestUserDataExport(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	job, err := h.dataExportService.StartExport(userID, getAnalystID(c))
+	if err != nil {
+		handleJobError(c, "Failed to start data export", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// loadJob reads the :id job, hiding other users' jobs when own is set
+func (h *JobHandlers) loadJob(c *gin.Context, own bool) (*models.ReportJob, bool) {
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return nil, false
+	}
+
+	job, err := h.jobQueue.Get(jobID)
+	if err != nil {
+		handleJobError(c, "Failed to get job", err)
+		return nil, false
+	}
+	if own {
+		analystID := getAnalystID(c)
+		if analystID == nil || job.RequestedBy == nil || *job.RequestedBy != *analystID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return nil, false
+		}
+	}
+	return job, true
+}
+
+func handleJobError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrReportJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, services.ErrDataSubjectNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": message, "message": err.Error()})
+	case errors.Is(err, services.ErrReportJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": message, "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kerberosPrincipalKey is the context key the Negotiate middleware stores the
+// authenticated principal under
+const kerberosPrincipalKey = "kerberosPrincipal"
+
+// KerberosHandlers contains the SPNEGO desktop sign-in handlers
+type KerberosHandlers struct {
+	kerberosService *services.KerberosService
+	sessionService  *services.SessionService
+	cfg             *config.Config
+}
+
+// NewKerberosHandlers creates new Kerberos handlers
+func NewKerberosHandlers(kerberosService *services.KerberosService, sessionService *services.SessionService, cfg *config.Config) *KerberosHandlers {
+	return &KerberosHandlers{
+		kerberosService: kerberosService,
+		sessionService:  sessionService,
+		cfg:             cfg,
+	}
+}
+
+// Negotiate runs HTTP Negotiate for clients on the internal network. A request without a
+// token is answered with a "WWW-Authenticate: Negotiate" challenge, which a domain-joined
+// browser retries with a Kerberos ticket; a valid ticket leaves the principal in the
+// context. Clients off the network, or whose token fails, pass through unauthenticated
+// so the handler can send them to the normal sign-in.
+func (h *KerberosHandlers) Negotiate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.kerberosService.Enabled() || !h.kerberosService.OnInternalNetwork(c.ClientIP()) {
+			c.Next()
+			return
+		}
+
+		scheme, encoded, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Negotiate") {
+			c.Header("WWW-Authenticate", "Negotiate")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "negotiate_required",
+				"message": "Sign in with your Windows or Kerberos credentials, or use the normal sign-in",
+			})
+			return
+		}
+
+		token, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err == nil {
+			var principal *services.KerberosPrincipal
+			principal, err = h.kerberosService.Authenticate(token, tokenSource(c, "kerberos"), time.Now())
+			if err == nil {
+				c.Set(kerberosPrincipalKey, principal)
+				c.Next()
+				return
+			}
+		}
+		log.Printf("Kerberos negotiation from %s failed: %v", c.ClientIP(), err)
+		services.LogAuditEvent(c.Request.Context(), "", "kerberos_sign_in", "auth", "", c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+		c.Next()
+	}
+}
+
+// Login signs in the user behind the principal the Negotiate middleware authenticated,
+// issuing tokens exactly like a password login but recording Kerberos on the session.
+// Without a principal it answers 401 spnego_unavailable so the client falls back to the
+// normal sign-in flow.
+func (h *KerberosHandlers) Login(c *gin.Context) {
+	value, exists := c.Get(kerberosPrincipalKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "spnego_unavailable",
+			"message": "Desktop sign-in is not available from this device or network; use the normal sign-in",
+		})
+		return
+	}
+	principal := value.(*services.KerberosPrincipal)
+
+	user, err := h.kerberosService.ResolveUser(principal)
+	if err != nil {
+		services.LogAuditEvent(c.Request.Context(), "", "kerberos_sign_in", "auth", principal.String(), c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+		if errors.Is(err, services.ErrKerberosPrincipalUnknown) {
+			recordLogin(c, services.LoginAttempt{Email: principal.String(), Method: models.AuthMethodKerberos, FailureReason: models.LoginFailureUnknownUser})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "spnego_unavailable", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve user", "message": err.Error()})
+		return
+	}
+
+	if user.IsLocked(time.Now()) {
+		recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Method: models.AuthMethodKerberos, FailureReason: models.LoginFailureAccountLocked})
+		c.JSON(http.StatusForbidden, accountLockedResponse(user))
+		return
+	}
+
+	session, err := h.sessionService.CreateSessionWithMethod(user.ID, c.ClientIP(), c.GetHeader("User-Agent"), models.AuthMethodKerberos)
+	if err != nil {
+		recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Method: models.AuthMethodKerberos, FailureReason: models.LoginFailureSessionError})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	recordLogin(c, services.LoginAttempt{UserID: &user.ID, Email: user.Email, Success: true, Method: models.AuthMethodKerberos, SessionID: &session.ID})
+
+	accessToken, expiresIn, err := generateAccessToken(h.cfg, user.ID.String(), user.Email, user.Username, session.ID.String(), session.AuthLevel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	cookieDomain := os.Getenv("COOKIE_DOMAIN")
+	cookieSecure := os.Getenv("COOKIE_SECURE") == "true"
+	if cookieSecure {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie("access_token", accessToken, expiresIn, "/", cookieDomain, cookieSecure, true)
+	c.SetCookie("refresh_token", session.SessionToken, h.cfg.RefreshTokenTTLHour*3600, "/", cookieDomain, cookieSecure, true)
+
+	services.LogAuditEvent(c.Request.Context(), user.ID.String(), "kerberos_sign_in", "auth", principal.String(), c.ClientIP(), c.GetHeader("User-Agent"), "Signed in with Kerberos", "success")
+
+	c.JSON(http.StatusOK, tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: session.SessionToken,
+		ExpiresIn:    expiresIn,
+		TokenType:    "Bearer",
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keycloakEventMaxBody bounds a batch of Keycloak events pushed by an event listener
+const keycloakEventMaxBody = 1 << 20
+
+// KeycloakEventHandlers contains the Keycloak event receiver and the admin endpoint to
+// poll events now
+type KeycloakEventHandlers struct {
+	events *services.KeycloakEventService
+}
+
+// NewKeycloakEventHandlers creates new Keycloak event handlers
+func NewKeycloakEventHandlers(events *services.KeycloakEventService) *KeycloakEventHandlers {
+	return &KeycloakEventHandlers{events: events}
+}
+
+// Webhook receives one Keycloak event or an array of them from an event listener,
+// authenticated by its bearer secret. Redelivered events are acknowledged and ignored.
+func (h *KeycloakEventHandlers) Webhook(c *gin.Context) {
+	if err := h.events.VerifyWebhook(c.GetHeader("Authorization")); err != nil {
+		if errors.Is(err, services.ErrKeycloakEventsNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Keycloak event webhook not configured"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook secret"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, keycloakEventMaxBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	events, err := services.ParseKeycloakEvents(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+
+	result, err := h.events.Ingest(c.Request.Context(), events, time.Now())
+	if err != nil {
+		log.Printf("Failed to ingest Keycloak events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ingest Keycloak events"})
+		return
+	}
+	c.JSON(http.StatusAccepted, result)
+}
+
+// Sync polls the realm's admin API for events now
+func (h *KeycloakEventHandlers) Sync(c *gin.Context) {
+	result, err := h.events.SyncEvents(c.Request.Context(), time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrKeycloakEventsNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Keycloak event polling not configured"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sync Keycloak events", "message": err.Error(), "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Keycloak events synced", "result": result})
+}
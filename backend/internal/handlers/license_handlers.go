@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LicenseHandlers contains license utilization HTTP handlers
+type LicenseHandlers struct {
+	licenseService *services.LicenseService
+}
+
+// NewLicenseHandlers creates new license handlers
+func NewLicenseHandlers(licenseService *services.LicenseService) *LicenseHandlers {
+	return &LicenseHandlers{
+		licenseService: licenseService,
+	}
+}
+
+// SetLicenseAllocationRequest represents a manual seat allocation update
+type SetLicenseAllocationRequest struct {
+	ProvisionedSeats int     `json:"provisioned_seats" binding:"min=0"`
+	CostPerSeat      float64 `json:"cost_per_seat" binding:"min=0"`
+}
+
+// GetUtilizationReport returns seats vs. active users per app, as JSON or CSV (?format=csv)
+func (h *LicenseHandlers) GetUtilizationReport(c *gin.Context) {
+	_, _, days := parseAnalyticsRange(c)
+
+	report, err := h.licenseService.GetUtilizationReport(time.Duration(days) * 24 * time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build license report", "message": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		if err := services.WriteUtilizationCSV(&buf, report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export license report", "message": err.Error()})
+			return
+		}
+		filename := fmt.Sprintf("license-utilization-%s.csv", time.Now().UTC().Format("2006-01-02"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "text/csv", buf.Bytes())
+		return
+	}
+
+	totalUnused := 0
+	totalUnusedCost := 0.0
+	for _, entry := range report {
+		totalUnused += entry.UnusedSeats
+		totalUnusedCost += entry.UnusedCost
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report":            report,
+		"active_window":     days,
+		"total_unused":      totalUnused,
+		"total_unused_cost": totalUnusedCost,
+	})
+}
+
+// SetAllocation records provisioned seats and per-seat cost for an app
+func (h *LicenseHandlers) SetAllocation(c *gin.Context) {
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req SetLicenseAllocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	allocation, err := h.licenseService.SetAllocation(appID, req.ProvisionedSeats, req.CostPerSeat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save allocation", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"allocation": allocation})
+}
+
+// SyncLicenses pulls seat counts from provider admin APIs
+func (h *LicenseHandlers) SyncLicenses(c *gin.Context) {
+	results := h.licenseService.SyncProviders(c.Request.Context())
+
+	synced := []string{}
+	failed := gin.H{}
+	for appID, err := range results {
+		if err != nil {
+			failed[appID] = err.Error()
+		} else {
+			synced = append(synced, appID)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"synced": synced,
+		"failed": failed,
+	})
+}
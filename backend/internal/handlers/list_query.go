@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"cloudgate-backend/internal/services"
+)
+
+// parseListPage reads the filter, sort, limit and offset query parameters the filterable
+// lists share. A limit outside 1..maxLimit falls back to defaultLimit; a filter or sort the
+// list does not support is answered with 400.
+func parseListPage(c *gin.Context, schema *services.FilterSchema, defaultLimit, maxLimit int) (services.ListPage, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	page, err := schema.NewListPage(c.Query("filter"), c.Query("sort"), limit, offset, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "message": err.Error()})
+		return services.ListPage{}, false
+	}
+	return page, true
+}
+
+// GetFilterSchemas describes the fields, operators and sorts each filterable list accepts,
+// for building queries
+func GetFilterSchemas(c *gin.Context) {
+	schemas := make(gin.H, len(services.FilterSchemas))
+	for name, schema := range services.FilterSchemas {
+		fields := make(gin.H, len(schema.Fields))
+		for field, spec := range schema.Fields {
+			fields[field] = gin.H{
+				"kind":      spec.Kind,
+				"values":    spec.Values,
+				"operators": spec.Operators(),
+				"sortable":  spec.Sortable,
+			}
+		}
+		schemas[name] = gin.H{"fields": fields, "default_sort": schema.DefaultSort}
+	}
+	c.JSON(http.StatusOK, gin.H{"schemas": schemas})
+}
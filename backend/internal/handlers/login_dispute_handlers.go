@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// LoginDisputeHandlers contains HTTP handlers for disputing a login and working the
+// dispute through to resolution
+type LoginDisputeHandlers struct {
+	disputeService *services.LoginDisputeService
+	radiusService  *services.RadiusService
+}
+
+// NewLoginDisputeHandlers creates new login dispute handlers
+func NewLoginDisputeHandlers(disputeService *services.LoginDisputeService, radiusService *services.RadiusService) *LoginDisputeHandlers {
+	return &LoginDisputeHandlers{
+		disputeService: disputeService,
+		radiusService:  radiusService,
+	}
+}
+
+// disputeResponse is a dispute with the remediation steps it is still waiting on
+func disputeResponse(dispute *models.LoginDispute) gin.H {
+	return gin.H{
+		"dispute":       dispute,
+		"pending_steps": services.PendingDisputeSteps(dispute),
+	}
+}
+
+func respondWithDisputeError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrDisputeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login dispute not found"})
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sign-in not found"})
+	case errors.Is(err, services.ErrInvalidDisputeStep):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+	case errors.Is(err, services.ErrDisputeState):
+		c.JSON(http.StatusConflict, gin.H{"error": "Invalid dispute state", "message": err.Error()})
+	default:
+		log.Printf("Error trying to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// ReportLogin disputes a sign-in the user does not recognize, ending its session
+func (h *LoginDisputeHandlers) ReportLogin(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	// The comment is optional, so an empty body is fine
+	_ = c.ShouldBindJSON(&req)
+
+	dispute, err := h.disputeService.OpenDispute(*userID, sessionID, req.Comment, c.ClientIP(), time.Now())
+	if err != nil {
+		respondWithDisputeError(c, err, "report sign-in")
+		return
+	}
+
+	c.JSON(http.StatusCreated, disputeResponse(dispute))
+}
+
+// ListMyDisputes returns the user's login disputes
+func (h *LoginDisputeHandlers) ListMyDisputes(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	disputes, err := h.disputeService.ListDisputes(userID, c.Query("status"))
+	if err != nil {
+		respondWithDisputeError(c, err, "list login disputes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"disputes": disputes, "count": len(disputes)})
+}
+
+// GetMyDispute returns one of the user's login disputes
+func (h *LoginDisputeHandlers) GetMyDispute(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+
+	dispute, err := h.disputeService.GetUserDispute(*userID, disputeID)
+	if err != nil {
+		respondWithDisputeError(c, err, "get login dispute")
+		return
+	}
+
+	c.JSON(http.StatusOK, disputeResponse(dispute))
+}
+
+// ResetPassword completes a dispute's password reset step
+func (h *LoginDisputeHandlers) ResetPassword(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+	var req struct {
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	var currentSession *uuid.UUID
+	if sessionID, ok := c.Get("sessionID"); ok {
+		if id, ok := sessionID.(uuid.UUID); ok {
+			currentSession = &id
+		}
+	}
+
+	dispute, err := h.disputeService.ResetPassword(*userID, disputeID, req.NewPassword, currentSession, time.Now())
+	if err != nil {
+		respondWithDisputeError(c, err, "reset password")
+		return
+	}
+	rememberRadiusPassword(h.radiusService, *userID, req.NewPassword)
+
+	c.JSON(http.StatusOK, disputeResponse(dispute))
+}
+
+// VerifyMFA completes a dispute's MFA re-enrollment step with a code from the newly
+// enrolled authenticator
+func (h *LoginDisputeHandlers) VerifyMFA(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	dispute, err := h.disputeService.VerifyMFA(*userID, disputeID, req.Code, time.Now())
+	if err != nil {
+		respondWithDisputeError(c, err, "verify MFA")
+		return
+	}
+
+	c.JSON(http.StatusOK, disputeResponse(dispute))
+}
+
+// ListDisputes returns login disputes for review. Supports ?status= and ?user_id=.
+func (h *LoginDisputeHandlers) ListDisputes(c *gin.Context) {
+	var userID *uuid.UUID
+	if value := c.Query("user_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID = &id
+	}
+
+	disputes, err := h.disputeService.ListDisputes(userID, c.Query("status"))
+	if err != nil {
+		respondWithDisputeError(c, err, "list login disputes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"disputes": disputes, "count": len(disputes)})
+}
+
+// GetDispute returns any login dispute
+func (h *LoginDisputeHandlers) GetDispute(c *gin.Context) {
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+
+	dispute, err := h.disputeService.GetDispute(disputeID)
+	if err != nil {
+		respondWithDisputeError(c, err, "get login dispute")
+		return
+	}
+
+	c.JSON(http.StatusOK, disputeResponse(dispute))
+}
+
+// ResolveDispute closes a login dispute with the administrator's finding
+func (h *LoginDisputeHandlers) ResolveDispute(c *gin.Context) {
+	disputeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dispute ID"})
+		return
+	}
+	var req struct {
+		Resolution string `json:"resolution" binding:"required"`
+		Note       string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	dispute, err := h.disputeService.Resolve(disputeID, getAnalystID(c), req.Resolution, req.Note, time.Now())
+	if err != nil {
+		respondWithDisputeError(c, err, "resolve login dispute")
+		return
+	}
+
+	c.JSON(http.StatusOK, disputeResponse(dispute))
+}
+
+// RequireDisputeRemediation holds back a user who disputed a login until they have reset
+// their password and re-enrolled MFA
+func (h *LoginDisputeHandlers) RequireDisputeRemediation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getAnalystID(c)
+		if userID == nil {
+			c.Next()
+			return
+		}
+		dispute, err := h.disputeService.PendingRemediation(*userID)
+		if err != nil {
+			// Remediation is enforced on a best-effort basis; never lock users out on errors
+			log.Printf("Failed to check login dispute remediation: %v", err)
+			c.Next()
+			return
+		}
+		if dispute != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":         "remediation_required",
+				"message":       "Reset your password and set up MFA again to finish securing your account",
+				"dispute_id":    dispute.ID,
+				"pending_steps": services.PendingDisputeSteps(dispute),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// loginHistory records login attempts. It is set by SetupRoutes; when nil attempts are
+// not recorded.
+var loginHistory *services.LoginHistoryService
+
+// recordLogin records a login attempt from the request. Recording never fails the login,
+// and is skipped in disaster recovery, when the database is a read-only replica.
+func recordLogin(c *gin.Context, attempt services.LoginAttempt) {
+	if loginHistory == nil || inDisasterRecovery() {
+		return
+	}
+	attempt.IPAddress = c.ClientIP()
+	attempt.UserAgent = c.GetHeader("User-Agent")
+	if _, err := loginHistory.Record(attempt, time.Now()); err != nil {
+		log.Printf("Failed to record login for %s: %v", attempt.Email, err)
+	}
+}
+
+// geoLocate resolves an IP address for login history, or nil when it cannot be located
+func geoLocate(ipAddress string) *services.GeoLocation {
+	location := performGeolocation(context.Background(), ipAddress)
+	if location.Country == "Unknown" {
+		return nil
+	}
+	return &services.GeoLocation{
+		Country:     location.Country,
+		Region:      location.Region,
+		City:        location.City,
+		Latitude:    location.Latitude,
+		Longitude:   location.Longitude,
+		ISP:         location.ISP,
+		Timezone:    location.Timezone,
+		VPNDetected: location.IsVPN,
+
+		ASN:            location.ASN,
+		ASOrganization: location.ASOrganization,
+	}
+}
+
+// LoginHistoryHandlers contains login history HTTP handlers
+type LoginHistoryHandlers struct {
+	loginHistoryService *services.LoginHistoryService
+}
+
+// NewLoginHistoryHandlers creates new login history handlers
+func NewLoginHistoryHandlers(loginHistoryService *services.LoginHistoryService) *LoginHistoryHandlers {
+	return &LoginHistoryHandlers{
+		loginHistoryService: loginHistoryService,
+	}
+}
+
+// GetMyLoginHistory returns the signed-in user's login history
+func (h *LoginHistoryHandlers) GetMyLoginHistory(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	h.respondWithHistory(c, *userID)
+}
+
+// GetUserLoginHistory returns any user's login history for an investigation
+func (h *LoginHistoryHandlers) GetUserLoginHistory(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	h.respondWithHistory(c, userID)
+}
+
+func (h *LoginHistoryHandlers) respondWithHistory(c *gin.Context, userID uuid.UUID) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	history, err := h.loginHistoryService.History(userID, limit, offset, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve login history",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
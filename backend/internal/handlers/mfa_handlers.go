@@ -13,6 +13,7 @@ import (
 	"github.com/pquerna/otp/totp"
 	"github.com/skip2/go-qrcode"
 
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 )
 
@@ -154,7 +155,7 @@ func VerifyMFASetupHandler(c *gin.Context) {
 	}
 
 	// Log MFA enablement
-	services.LogAuditEvent(userID, "mfa_enabled", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA successfully enabled", "success")
+	services.LogAuditEvent(c.Request.Context(), userID, "mfa_enabled", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA successfully enabled", "success")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "MFA enabled successfully",
@@ -189,6 +190,17 @@ func VerifyMFAHandler(c *gin.Context) {
 		return
 	}
 
+	// No step-up completes while the user is being bombed with prompts
+	if checkStepUpPaused(c, userID, false) {
+		return
+	}
+
+	// Designated groups may have to step up with WebAuthn instead
+	requirement, allowed := checkOTPStepUp(c, userID)
+	if !allowed {
+		return
+	}
+
 	// Verify TOTP code
 	valid := totp.Validate(request.Code, mfaSetup.Secret)
 	if !valid {
@@ -200,19 +212,34 @@ func VerifyMFAHandler(c *gin.Context) {
 
 		if !valid {
 			// Log failed MFA attempt
-			services.LogAuditEvent(userID, "mfa_verification_failed", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA verification failed", "failure")
+			services.LogAuditEvent(c.Request.Context(), userID, "mfa_verification_failed", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA verification failed", "failure")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
 			return
 		}
 	}
 
 	// Log successful MFA verification
-	services.LogAuditEvent(userID, "mfa_verification_success", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA verification successful", "success")
+	services.LogAuditEvent(c.Request.Context(), userID, "mfa_verification_success", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA verification successful", "success")
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message":  "MFA verification successful",
 		"verified": true,
-	})
+	}
+
+	// Raise the session to AAL2 so step-up protected endpoints accept it
+	accessToken, expiresIn, err := stepUpSession(c, models.AAL2)
+	if err != nil {
+		log.Printf("Error stepping up session after MFA: %v", err)
+	} else {
+		response["access_token"] = accessToken
+		response["expires_in"] = expiresIn
+		response["auth_level"] = models.AAL2
+	}
+	if requirement != nil {
+		response["phishing_resistant_required_from"] = requirement.EnforcedFrom
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // GetMFAStatusHandler returns MFA status for a user
@@ -306,7 +333,7 @@ func DisableMFAHandler(c *gin.Context) {
 	}
 
 	// Log MFA disablement
-	services.LogAuditEvent(userID, "mfa_disabled", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA disabled", "warning")
+	services.LogAuditEvent(c.Request.Context(), userID, "mfa_disabled", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "MFA disabled", "warning")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "MFA disabled successfully",
@@ -364,7 +391,7 @@ func RegenerateBackupCodesHandler(c *gin.Context) {
 	}
 
 	// Log backup codes regeneration
-	services.LogAuditEvent(userID, "backup_codes_regenerated", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "Backup codes regenerated", "success")
+	services.LogAuditEvent(c.Request.Context(), userID, "backup_codes_regenerated", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "Backup codes regenerated", "success")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Backup codes regenerated successfully",
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// NotificationInboxHandlers contains the HTTP handlers for the admin notification inbox
+type NotificationInboxHandlers struct {
+	inbox *services.NotificationInboxService
+}
+
+// NewNotificationInboxHandlers creates new notification inbox handlers
+func NewNotificationInboxHandlers(inbox *services.NotificationInboxService) *NotificationInboxHandlers {
+	return &NotificationInboxHandlers{inbox: inbox}
+}
+
+// ListNotifications returns the caller's notifications, newest first, filtered by
+// ?severity=high,critical and ?unread=true
+func (h *NotificationInboxHandlers) ListNotifications(c *gin.Context) {
+	recipientID := getAnalystID(c)
+	if recipientID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	severities, ok := parseNotificationSeverities(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	notifications, total, err := h.inbox.List(*recipientID, services.NotificationFilter{
+		Severities: severities,
+		UnreadOnly: c.Query("unread") == "true",
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+		"limit":         limit,
+		"offset":        offset,
+	})
+}
+
+// GetUnreadCount returns how many of the caller's notifications are unread, by severity
+func (h *NotificationInboxHandlers) GetUnreadCount(c *gin.Context) {
+	recipientID := getAnalystID(c)
+	if recipientID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	counts, err := h.inbox.UnreadCounts(*recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, counts)
+}
+
+// MarkRead marks one of the caller's notifications read
+func (h *NotificationInboxHandlers) MarkRead(c *gin.Context) {
+	recipientID := getAnalystID(c)
+	if recipientID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+	err = h.inbox.MarkRead(*recipientID, notificationID, time.Now())
+	if errors.Is(err, services.ErrNotificationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked read"})
+}
+
+// MarkAllRead marks the caller's unread notifications read, only those of ?severity= when given
+func (h *NotificationInboxHandlers) MarkAllRead(c *gin.Context) {
+	recipientID := getAnalystID(c)
+	if recipientID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	severities, ok := parseNotificationSeverities(c)
+	if !ok {
+		return
+	}
+	marked, err := h.inbox.MarkAllRead(*recipientID, severities, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
+
+func parseNotificationSeverities(c *gin.Context) ([]services.AlertSeverity, bool) {
+	var severities []services.AlertSeverity
+	for _, value := range strings.Split(c.Query("severity"), ",") {
+		severity := services.AlertSeverity(strings.ToLower(strings.TrimSpace(value)))
+		switch severity {
+		case "":
+			continue
+		case services.SeverityLow, services.SeverityMedium, services.SeverityHigh, services.SeverityCritical:
+			severities = append(severities, severity)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid severity", "message": "severity must be low, medium, high or critical"})
+			return nil, false
+		}
+	}
+	return severities, true
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -293,3 +294,41 @@ func RecordUsageHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Usage recorded successfully"})
 }
+
+// RecordCallOutcomeRequest reports how an API call or token refresh through a connection went
+type RecordCallOutcomeRequest struct {
+	ConnectionID string `json:"connection_id" binding:"required"`
+	Kind         string `json:"kind,omitempty"` // api_call (default) or token_refresh
+	Success      *bool  `json:"success" binding:"required"`
+	LatencyMs    int    `json:"latency_ms,omitempty"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RecordCallOutcomeHandler records a call outcome for integration health scoring
+func RecordCallOutcomeHandler(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var request RecordCallOutcomeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	monitoringService := services.NewOAuthMonitoringService(services.GetDB())
+	err := monitoringService.RecordCallOutcome(userID, request.ConnectionID, request.Kind, *request.Success, request.LatencyMs, request.StatusCode, request.Error)
+	if errors.Is(err, services.ErrInvalidSampleKind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kind", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record call outcome"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Call outcome recorded successfully"})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redirectAllowlist guards the frontend redirects and provider callback URIs used by the
+// OAuth and SAML handlers. It is set by SetupRoutes; when nil it is loaded from the environment.
+var redirectAllowlist *services.RedirectAllowlist
+
+func activeRedirectAllowlist() *services.RedirectAllowlist {
+	if redirectAllowlist == nil {
+		redirectAllowlist = services.NewRedirectAllowlist()
+	}
+	return redirectAllowlist
+}
+
+// oauthCallbackURI is the redirect URI registered with a provider for this backend
+func oauthCallbackURI(provider string) string {
+	return getEnv("BACKEND_URL", "http://localhost:8081") + "/oauth/" + provider + "/callback"
+}
+
+// allowCallbackURI rejects a sign-in flow whose provider redirect URI is not on the
+// callback allowlist, so authorization codes are never sent to another host
+func allowCallbackURI(c *gin.Context, provider, redirectURI string) bool {
+	if err := activeRedirectAllowlist().CheckCallback(provider, redirectURI); err != nil {
+		rejectRedirect(c, provider, "oauth_callback_rejected", redirectURI, err)
+		return false
+	}
+	return true
+}
+
+// redirectToFrontend finishes a sign-in flow by sending the browser to the frontend
+// callback page, provided FRONTEND_URL is on the redirect allowlist
+func redirectToFrontend(c *gin.Context, provider, email string) {
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+	redirectURL := fmt.Sprintf("%s/oauth/callback?provider=%s&email=%s&code=success", frontendURL, url.QueryEscape(provider), url.QueryEscape(email))
+	if err := activeRedirectAllowlist().CheckRedirect(redirectURL); err != nil {
+		rejectRedirect(c, provider, "oauth_redirect_rejected", frontendURL, err)
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+func rejectRedirect(c *gin.Context, provider, action, target string, err error) {
+	log.Printf("🚫 %s for %s: %v", action, provider, err)
+	services.LogAuditEvent(c.Request.Context(), getUserIDFromContext(c), action, "oauth_provider", provider, c.ClientIP(), c.GetHeader("User-Agent"),
+		fmt.Sprintf("Rejected %s: %v", target, err), "failure")
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Redirect target not allowed",
+		"message": "The redirect URL for this provider is not on the allowlist",
+	})
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OIDCHandlers contains the OpenID Connect provider handlers and the admin handlers for
+// its clients
+type OIDCHandlers struct {
+	provider *services.OIDCProviderService
+}
+
+// NewOIDCHandlers creates new OpenID Connect provider handlers
+func NewOIDCHandlers(provider *services.OIDCProviderService) *OIDCHandlers {
+	return &OIDCHandlers{provider: provider}
+}
+
+// Discovery serves the provider metadata clients configure themselves from
+func (h *OIDCHandlers) Discovery(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, h.provider.Discovery())
+}
+
+// Authorize answers a client's authorization request for the signed-in user by sending the
+// browser back to the client with a code, received over GET or as a POSTed form. API scopes
+// the user has not yet given the client are answered with consent_required, listing them.
+func (h *OIDCHandlers) Authorize(c *gin.Context) {
+	param := c.Query
+	if c.Request.Method == http.MethodPost {
+		param = c.PostForm
+	}
+	client, err := h.provider.AuthorizeClient(param("client_id"), param("redirect_uri"))
+	switch {
+	case errors.Is(err, services.ErrOIDCClientNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_client", "message": "Unknown client_id"})
+		return
+	case errors.Is(err, services.ErrInvalidOIDCRedirect):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error reading OIDC authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read authorization request"})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	// Clients may demand a stronger session than a password login provides
+	if client.RequiredAAL > c.GetInt("aal") {
+		middleware.ChallengeStepUp(c, gin.H{
+			"message":      fmt.Sprintf("%s requires a stronger authentication method", client.Name),
+			"current_aal":  c.GetInt("aal"),
+			"required_aal": client.RequiredAAL,
+		})
+		return
+	}
+
+	subject := services.OIDCSubject{UserID: userUUID, AAL: c.GetInt("aal")}
+	if value, ok := c.Get("sessionID"); ok {
+		if sessionID, ok := value.(uuid.UUID); ok {
+			subject.SessionID = &sessionID
+		}
+	}
+	request := services.OIDCAuthorizeRequest{
+		ResponseType:        param("response_type"),
+		RedirectURI:         param("redirect_uri"),
+		Scope:               param("scope"),
+		State:               param("state"),
+		Nonce:               param("nonce"),
+		CodeChallenge:       param("code_challenge"),
+		CodeChallengeMethod: param("code_challenge_method"),
+	}
+	redirect, err := h.provider.Authorize(client, request, subject, time.Now())
+	// The consent screen posts the request back with consent=approve once the user agrees
+	var consentErr *services.OIDCConsentRequiredError
+	if errors.As(err, &consentErr) && c.Request.Method == http.MethodPost && param("consent") == "approve" {
+		if err := h.provider.ConsentToScopes(userUUID, client.ClientID, consentErr.Scopes, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+			log.Printf("Error recording consent for OIDC client %s: %v", client.ClientID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record consent"})
+			return
+		}
+		redirect, err = h.provider.Authorize(client, request, subject, time.Now())
+	}
+	if errors.As(err, &consentErr) {
+		scopes := make([]gin.H, 0, len(consentErr.Scopes))
+		for _, scope := range consentErr.Scopes {
+			scopes = append(scopes, gin.H{"scope": scope, "description": services.APIScopeDescriptions[scope]})
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":       "consent_required",
+			"message":     fmt.Sprintf("%s is asking for access to your CloudGate account", client.Name),
+			"client_id":   client.ClientID,
+			"client_name": client.Name,
+			"scopes":      scopes,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error authorizing OIDC client %s: %v", client.ClientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize client"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Token exchanges an authorization code for tokens. Confidential clients authenticate with
+// HTTP Basic or client_secret in the form; public clients send only their client_id.
+func (h *OIDCHandlers) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	request := services.OIDCTokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+		CodeVerifier: c.PostForm("code_verifier"),
+	}
+	basicID, basicSecret, basic := c.Request.BasicAuth()
+	if basic {
+		if request.ClientSecret != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "use one client authentication method"})
+			return
+		}
+		// Basic credentials are form-encoded first (RFC 6749 section 2.3.1)
+		id, idErr := url.QueryUnescape(basicID)
+		secret, secretErr := url.QueryUnescape(basicSecret)
+		if idErr != nil || secretErr != nil || (request.ClientID != "" && request.ClientID != id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "malformed client credentials"})
+			return
+		}
+		request.ClientID, request.ClientSecret = id, secret
+	}
+
+	response, err := h.provider.Exchange(request, time.Now())
+	var protocolErr *services.OIDCError
+	if errors.As(err, &protocolErr) {
+		status := http.StatusBadRequest
+		if protocolErr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+			if basic {
+				c.Header("WWW-Authenticate", `Basic realm="cloudgate"`)
+			}
+		}
+		c.JSON(status, gin.H{"error": protocolErr.Code, "error_description": protocolErr.Description})
+		return
+	}
+	if err != nil {
+		log.Printf("Error issuing OIDC tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UserInfo returns the claims about the user that the bearer access token's scopes allow
+func (h *OIDCHandlers) UserInfo(c *gin.Context) {
+	accessToken, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="cloudgate"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_request", "error_description": "a bearer access token is required"})
+		return
+	}
+
+	info, err := h.provider.UserInfo(accessToken, time.Now())
+	var protocolErr *services.OIDCError
+	if errors.As(err, &protocolErr) {
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer realm="cloudgate", error=%q, error_description=%q`, protocolErr.Code, protocolErr.Description))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": protocolErr.Code, "error_description": protocolErr.Description})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading OIDC user info: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, info)
+}
+
+// ListClients returns every registered OIDC client
+func (h *OIDCHandlers) ListClients(c *gin.Context) {
+	clients, err := h.provider.ListClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list OIDC clients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients, "count": len(clients)})
+}
+
+// GetClient returns one registered OIDC client
+func (h *OIDCHandlers) GetClient(c *gin.Context) {
+	client, err := h.provider.GetClient(c.Param("clientId"))
+	if errors.Is(err, services.ErrOIDCClientNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC client not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get OIDC client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"client": client})
+}
+
+// CreateClient registers an OIDC client. A confidential client's secret is only shown here.
+func (h *OIDCHandlers) CreateClient(c *gin.Context) {
+	var input services.OIDCClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	client, secret, err := h.provider.CreateClient(input, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidOIDCClient) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create OIDC client"})
+		return
+	}
+
+	response := gin.H{"client": client}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateClient replaces an OIDC client's registration
+func (h *OIDCHandlers) UpdateClient(c *gin.Context) {
+	var input services.OIDCClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	client, err := h.provider.UpdateClient(c.Param("clientId"), input, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrOIDCClientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC client not found"})
+		return
+	case errors.Is(err, services.ErrInvalidOIDCClient):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update OIDC client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"client": client})
+}
+
+// RotateSecret issues a new secret for a confidential OIDC client
+func (h *OIDCHandlers) RotateSecret(c *gin.Context) {
+	secret, err := h.provider.RotateSecret(c.Param("clientId"), getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrOIDCClientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC client not found"})
+		return
+	case errors.Is(err, services.ErrInvalidOIDCClient):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate client secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"client_secret": secret})
+}
+
+// DeleteClient removes an OIDC client
+func (h *OIDCHandlers) DeleteClient(c *gin.Context) {
+	err := h.provider.DeleteClient(c.Param("clientId"), getAnalystID(c))
+	if errors.Is(err, services.ErrOIDCClientNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC client not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete OIDC client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OIDC client deleted"})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIHandlers serves the OpenAPI document of the routes third-party clients may call
+type OpenAPIHandlers struct {
+	provider *services.OIDCProviderService
+}
+
+// NewOpenAPIHandlers creates new OpenAPI handlers; clients obtain their access tokens from provider
+func NewOpenAPIHandlers(provider *services.OIDCProviderService) *OpenAPIHandlers {
+	return &OpenAPIHandlers{provider: provider}
+}
+
+// Spec serves an OpenAPI 3 document listing every route open to third-party clients with
+// the API scope it requires, built from the routes declared with middleware.RequireScope
+func (h *OpenAPIHandlers) Spec(c *gin.Context) {
+	issuer := h.provider.Issuer()
+	paths := make(map[string]gin.H)
+	for _, route := range middleware.ScopedRoutes() {
+		path, parameters := openAPIPath(route.Path)
+		operation := gin.H{
+			"description": "Requires the " + route.Scope + " scope: " + services.APIScopeDescriptions[route.Scope],
+			"security":    []gin.H{{"oauth2": []string{route.Scope}}, {"bearerAuth": []string{}}},
+			"responses": gin.H{
+				"2XX": gin.H{"description": "Success"},
+				"401": gin.H{"description": "Missing, invalid or expired access token"},
+				"403": gin.H{"description": "The user lacks the required role, or the access token lacks the scope (insufficient_scope)"},
+			},
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if paths[path] == nil {
+			paths[path] = gin.H{}
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "CloudGate API",
+			"version": "1.0.0",
+			"description": "Routes third-party tools may call on a user's behalf. Register an OIDC client with the " +
+				"API scopes it needs; users consent to each scope when they authorize the client. The user's " +
+				"roles still apply to every route.",
+		},
+		"servers": []gin.H{{"url": issuer}},
+		"components": gin.H{
+			"securitySchemes": gin.H{
+				"oauth2": gin.H{
+					"type": "oauth2",
+					"flows": gin.H{
+						"authorizationCode": gin.H{
+							"authorizationUrl": issuer + "/oauth2/authorize",
+							"tokenUrl":         issuer + "/oauth2/token",
+							"scopes":           services.APIScopeDescriptions,
+						},
+					},
+				},
+				"bearerAuth": gin.H{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "CloudGate's own session tokens, which are not limited by scope",
+				},
+			},
+		},
+		"paths": paths,
+	})
+}
+
+// openAPIPath turns a gin route path into an OpenAPI path template and its parameters
+func openAPIPath(path string) (string, []gin.H) {
+	var parameters []gin.H
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, gin.H{"name": name, "in": "path", "required": true, "schema": gin.H{"type": "string"}})
+		}
+	}
+	return strings.Join(segments, "/"), parameters
+}
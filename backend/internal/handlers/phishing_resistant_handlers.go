@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// phishingResistant enforces WebAuthn-only step-ups for designated groups. It is set by
+// SetupRoutes; when nil OTP step-ups are not restricted.
+var phishingResistant *services.PhishingResistantService
+
+// checkOTPStepUp decides whether the user may step up with an OTP. It writes the refusal
+// and returns false when a phishing-resistant authenticator is required. During a grace
+// period the requirement is returned so the response can warn about it.
+func checkOTPStepUp(c *gin.Context, userID string) (*services.PhishingResistantRequirement, bool) {
+	if phishingResistant == nil {
+		return nil, true
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, true
+	}
+
+	requirement, err := phishingResistant.CheckOTPStepUp(userUUID, c.GetString("email"), time.Now())
+	if errors.Is(err, services.ErrPhishingResistantRequired) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "phishing_resistant_required",
+			"message":       "Your account must step up with a security key or passkey",
+			"group":         requirement.Group,
+			"enforced_from": requirement.EnforcedFrom,
+		})
+		return nil, false
+	}
+	if err != nil {
+		// Enforcement is best effort here; the OTP itself is still verified
+		log.Printf("Failed to check phishing-resistant policy: %v", err)
+		return nil, true
+	}
+	return requirement, true
+}
+
+// PhishingResistantHandlers contains the admin HTTP handlers for phishing-resistant
+// enforcement policies
+type PhishingResistantHandlers struct {
+	phishingResistantService *services.PhishingResistantService
+}
+
+// NewPhishingResistantHandlers creates new phishing-resistant policy handlers
+func NewPhishingResistantHandlers(phishingResistantService *services.PhishingResistantService) *PhishingResistantHandlers {
+	return &PhishingResistantHandlers{
+		phishingResistantService: phishingResistantService,
+	}
+}
+
+// ListPolicies returns every phishing-resistant policy
+func (h *PhishingResistantHandlers) ListPolicies(c *gin.Context) {
+	policies, err := h.phishingResistantService.ListPolicies()
+	if err != nil {
+		log.Printf("Error listing phishing-resistant policies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "count": len(policies)})
+}
+
+// SetPolicy creates or updates a tenant group's phishing-resistant policy
+func (h *PhishingResistantHandlers) SetPolicy(c *gin.Context) {
+	var req services.PhishingResistantPolicyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	policy, err := h.phishingResistantService.SetPolicy(c.Param("tenant"), c.Param("group"), req, getAnalystID(c), time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPhishingResistantPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy", "message": err.Error()})
+			return
+		}
+		log.Printf("Error setting phishing-resistant policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeletePolicy removes a tenant group's phishing-resistant policy
+func (h *PhishingResistantHandlers) DeletePolicy(c *gin.Context) {
+	if err := h.phishingResistantService.DeletePolicy(c.Param("tenant"), c.Param("group"), getAnalystID(c)); err != nil {
+		if errors.Is(err, services.ErrPhishingResistantPolicyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+			return
+		}
+		log.Printf("Error deleting phishing-resistant policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Policy deleted successfully"})
+}
+
+// GetReport returns the enrollment state of every enabled policy's members
+func (h *PhishingResistantHandlers) GetReport(c *gin.Context) {
+	reports, err := h.phishingResistantService.Report(time.Now())
+	if err != nil {
+		log.Printf("Error building phishing-resistant report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": reports, "count": len(reports)})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PlaybookHandlers contains response playbook HTTP handlers
+type PlaybookHandlers struct {
+	engine *services.PlaybookEngine
+}
+
+// NewPlaybookHandlers creates new playbook handlers
+func NewPlaybookHandlers(engine *services.PlaybookEngine) *PlaybookHandlers {
+	return &PlaybookHandlers{
+		engine: engine,
+	}
+}
+
+// PlaybookDecisionRequest approves or rejects a playbook paused at an approval gate
+type PlaybookDecisionRequest struct {
+	Approved *bool  `json:"approved" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+// ListPlaybooks returns all response playbooks
+func (h *PlaybookHandlers) ListPlaybooks(c *gin.Context) {
+	playbooks, err := h.engine.ListPlaybooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get playbooks", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"playbooks": playbooks,
+		"count":     len(playbooks),
+	})
+}
+
+// CreatePlaybook stores a playbook written as JSON, or as YAML when sent with a YAML content type
+func (h *PlaybookHandlers) CreatePlaybook(c *gin.Context) {
+	definition, ok := readPlaybookDefinition(c)
+	if !ok {
+		return
+	}
+
+	playbook, err := h.engine.CreatePlaybook(*definition, getAnalystID(c))
+	if err != nil {
+		handlePlaybookError(c, "Failed to create playbook", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"playbook": playbook})
+}
+
+// UpdatePlaybook replaces a playbook's definition
+func (h *PlaybookHandlers) UpdatePlaybook(c *gin.Context) {
+	playbookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playbook ID"})
+		return
+	}
+
+	definition, ok := readPlaybookDefinition(c)
+	if !ok {
+		return
+	}
+
+	playbook, err := h.engine.UpdatePlaybook(playbookID, *definition)
+	if err != nil {
+		handlePlaybookError(c, "Failed to update playbook", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"playbook": playbook})
+}
+
+// DeletePlaybook removes a playbook
+func (h *PlaybookHandlers) DeletePlaybook(c *gin.Context) {
+	playbookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playbook ID"})
+		return
+	}
+
+	if err := h.engine.DeletePlaybook(playbookID); err != nil {
+		handlePlaybookError(c, "Failed to delete playbook", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Playbook deleted"})
+}
+
+// GetAlertPlaybookExecutions returns the playbook runs for an alert with their step results
+func (h *PlaybookHandlers) GetAlertPlaybookExecutions(c *gin.Context) {
+	alertID, err := uuid.Parse(c.Param("alert_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	executions, err := h.engine.ListExecutions(alertID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get playbook executions", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"executions": executions,
+		"count":      len(executions),
+	})
+}
+
+// DecidePlaybookExecution approves or rejects a playbook paused at an approval gate
+func (h *PlaybookHandlers) DecidePlaybookExecution(c *gin.Context) {
+	executionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+		return
+	}
+
+	var req PlaybookDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	execution, err := h.engine.Decide(executionID, getAnalystID(c), *req.Approved, req.Comment)
+	if err != nil {
+		handlePlaybookError(c, "Failed to record decision", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"execution": execution})
+}
+
+func readPlaybookDefinition(c *gin.Context) (*services.PlaybookDefinition, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return nil, false
+	}
+
+	isYAML := strings.Contains(c.ContentType(), "yaml")
+	definition, err := services.ParsePlaybookDefinition(body, isYAML)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playbook", "message": err.Error()})
+		return nil, false
+	}
+	return definition, true
+}
+
+func handlePlaybookError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPlaybook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playbook", "message": err.Error()})
+	case errors.Is(err, services.ErrPlaybookExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Playbook already exists", "message": err.Error()})
+	case errors.Is(err, services.ErrPlaybookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playbook not found"})
+	case errors.Is(err, services.ErrPlaybookExecutionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playbook execution not found"})
+	case errors.Is(err, services.ErrExecutionNotAwaitingApproval):
+		c.JSON(http.StatusConflict, gin.H{"error": "Playbook execution is not awaiting approval"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message, "message": err.Error()})
+	}
+}
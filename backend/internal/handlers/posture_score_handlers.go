@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PostureScoreHandlers contains the HTTP handlers for tenant security posture scores
+type PostureScoreHandlers struct {
+	posture *services.PostureScoreService
+}
+
+// NewPostureScoreHandlers creates new posture score handlers
+func NewPostureScoreHandlers(posture *services.PostureScoreService) *PostureScoreHandlers {
+	return &PostureScoreHandlers{posture: posture}
+}
+
+// ListScores returns every tenant's posture score now
+func (h *PostureScoreHandlers) ListScores(c *gin.Context) {
+	scores, err := h.posture.ComputeAll(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute posture scores", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenants": scores, "count": len(scores)})
+}
+
+// GetScore returns a tenant's posture score now with the breakdown of its components
+func (h *PostureScoreHandlers) GetScore(c *gin.Context) {
+	score, err := h.posture.Compute(c.Param("tenant"), time.Now())
+	if errors.Is(err, services.ErrTenantNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute posture score", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, score)
+}
+
+// GetHistory returns a tenant's recorded posture scores over the last ?days=90
+func (h *PostureScoreHandlers) GetHistory(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+	if err != nil || days < 1 || days > 730 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 730"})
+		return
+	}
+	points, err := h.posture.History(c.Param("tenant"), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get posture history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tenant": c.Param("tenant"), "days": days, "points": points})
+}
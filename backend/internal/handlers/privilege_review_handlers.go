@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivilegeReviewHandlers contains the HTTP handlers for reviewing privileged roles
+type PrivilegeReviewHandlers struct {
+	review *services.PrivilegeReviewService
+}
+
+// NewPrivilegeReviewHandlers creates new privilege review handlers
+func NewPrivilegeReviewHandlers(review *services.PrivilegeReviewService) *PrivilegeReviewHandlers {
+	return &PrivilegeReviewHandlers{review: review}
+}
+
+// AuditPrivilegedRequests records each request to the group's privileged endpoints in the
+// audit trail that privilege reviews read
+func (h *PrivilegeReviewHandlers) AuditPrivilegedRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		userID := getAnalystID(c)
+		if userID == nil || c.FullPath() == "" {
+			return
+		}
+		h.review.RecordUse(*userID, c.Request.Method, c.FullPath(), c.ClientIP(), c.GetHeader("User-Agent"), c.Writer.Status(), time.Now())
+	}
+}
+
+// GetReport reviews privileged role holders now, as JSON or CSV (?format=csv)
+func (h *PrivilegeReviewHandlers) GetReport(c *gin.Context) {
+	report, err := h.review.Report(c.Request.Context(), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build privilege review", "message": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		if err := services.WritePrivilegeReviewCSV(&buf, report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export privilege review", "message": err.Error()})
+			return
+		}
+		filename := fmt.Sprintf("privilege-review-%s.csv", report.GeneratedAt.UTC().Format("2006-01-02"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "text/csv", buf.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// StartReport queues a privilege review on the job queue
+func (h *PrivilegeReviewHandlers) StartReport(c *gin.Context) {
+	job, err := h.review.StartReport(getAnalystID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue privilege review", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
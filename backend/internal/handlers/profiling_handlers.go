@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServeProfile serves the Go runtime profiles of net/http/pprof, for profiling hot paths
+// such as login risk scoring on a live instance. It is routed at /debug/pprof/*profile
+// within a group that requires the admin role.
+func ServeProfile(c *gin.Context) {
+	name := strings.Trim(c.Param("profile"), "/")
+	switch name {
+	case "":
+		// The index only finds profile names under /debug/pprof/, so it is served at that path
+		c.Request.URL.Path = "/debug/pprof/"
+		pprof.Index(c.Writer, c.Request)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
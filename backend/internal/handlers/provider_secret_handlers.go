@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// providerSecrets resolves OAuth client secrets for the provider callbacks, which are
+// plain handler funcs. It is set by SetupRoutes; when nil the environment is used.
+var providerSecrets *services.ProviderSecretService
+
+// ProviderSecretHandlers contains provider client secret rotation HTTP handlers
+type ProviderSecretHandlers struct {
+	secretService *services.ProviderSecretService
+}
+
+// NewProviderSecretHandlers creates new provider secret handlers
+func NewProviderSecretHandlers(secretService *services.ProviderSecretService) *ProviderSecretHandlers {
+	return &ProviderSecretHandlers{
+		secretService: secretService,
+	}
+}
+
+// RotateProviderSecretRequest represents a new client secret issued by the provider
+type RotateProviderSecretRequest struct {
+	ClientSecret string `json:"client_secret" binding:"required"`
+	GraceMinutes int    `json:"grace_minutes"`
+}
+
+// RotateSecret validates and activates a new client secret for a provider
+func (h *ProviderSecretHandlers) RotateSecret(c *gin.Context) {
+	var req RotateProviderSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	secret, err := h.secretService.RotateSecret(c.Request.Context(), c.Param("provider"), req.ClientSecret,
+		time.Duration(req.GraceMinutes)*time.Minute, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider", "message": err.Error()})
+		return
+	case errors.Is(err, services.ErrSecretRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Client secret rejected by provider", "message": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to rotate client secret", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret})
+}
+
+// ListSecrets returns secret metadata (never the secrets) for a provider
+func (h *ProviderSecretHandlers) ListSecrets(c *gin.Context) {
+	secrets, err := h.secretService.ListSecrets(c.Param("provider"))
+	if errors.Is(err, services.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list secrets", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secrets": secrets, "count": len(secrets)})
+}
+
+// activeClientSecret returns the current client secret for a provider
+func activeClientSecret(provider, envKey string) string {
+	if secrets := clientSecrets(provider, envKey); len(secrets) > 0 {
+		return secrets[0]
+	}
+	return ""
+}
+
+func clientSecrets(provider, envKey string) []string {
+	if providerSecrets == nil {
+		return []string{getEnv(envKey, "")}
+	}
+	return providerSecrets.ClientSecrets(provider)
+}
+
+// withClientSecrets runs a token exchange with the active client secret, retrying with
+// secrets still inside their rotation grace window for callbacks started before a rotation
+func withClientSecrets(provider, envKey string, exchange func(secret string) error) error {
+	secrets := clientSecrets(provider, envKey)
+	if len(secrets) == 0 {
+		// Not configured: let the provider report it as before
+		return exchange("")
+	}
+
+	var errs []error
+	for _, secret := range secrets {
+		err := exchange(secret)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("token exchange failed with all %d client secrets: %w", len(errs), errors.Join(errs...))
+}
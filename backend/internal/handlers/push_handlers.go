@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PushHandlers contains HTTP handlers for registering devices for push alerts
+type PushHandlers struct {
+	push *services.PushService
+}
+
+// NewPushHandlers creates new push handlers
+func NewPushHandlers(push *services.PushService) *PushHandlers {
+	return &PushHandlers{push: push}
+}
+
+// RegisterPushDeviceRequest carries a device's FCM registration token
+type RegisterPushDeviceRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Platform string `json:"platform" binding:"required"`
+	Name     string `json:"name"`
+}
+
+// RegisterDevice registers the caller's phone or browser for critical alert push notifications
+func (h *PushHandlers) RegisterDevice(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	var req RegisterPushDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+
+	device, err := h.push.RegisterDevice(*userID, req.Token, req.Platform, req.Name)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPushDevice) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid push device", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register push device", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"device": device, "push_enabled": h.push.Enabled()})
+}
+
+// ListDevices returns the caller's registered push devices
+func (h *PushHandlers) ListDevices(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	devices, err := h.push.ListDevices(*userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list push devices", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": devices, "count": len(devices), "push_enabled": h.push.Enabled()})
+}
+
+// RemoveDevice unregisters one of the caller's push devices
+func (h *PushHandlers) RemoveDevice(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	deviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	removed, err := h.push.RemoveDevice(*userID, deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove push device", "message": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Push device not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Push device removed"})
+}
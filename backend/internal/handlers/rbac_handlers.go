@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RBACHandlers contains the HTTP handlers for assigning privileged roles
+type RBACHandlers struct {
+	rbac *services.RBACService
+}
+
+// NewRBACHandlers creates new role management handlers
+func NewRBACHandlers(rbac *services.RBACService) *RBACHandlers {
+	return &RBACHandlers{rbac: rbac}
+}
+
+// ListAssignments returns every privileged role assignment and the roles that can be assigned
+func (h *RBACHandlers) ListAssignments(c *gin.Context) {
+	assignments, err := h.rbac.ListAssignments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list role assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments, "count": len(assignments), "roles": h.rbac.Roles()})
+}
+
+// AssignRole grants a user a privileged role
+func (h *RBACHandlers) AssignRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	assignment, err := h.rbac.AssignRole(userID, c.Param("role"), getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignment": assignment})
+}
+
+// RevokeRole removes a privileged role from a user
+func (h *RBACHandlers) RevokeRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	err = h.rbac.RevokeRole(userID, c.Param("role"), getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrRoleAssignmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "The user does not hold this role"})
+		return
+	case errors.Is(err, services.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked"})
+}
+
+// GetMyRoles returns the current user's roles and the permissions they grant
+func (h *RBACHandlers) GetMyRoles(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roles, err := h.rbac.UserRoles(*userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		return
+	}
+	permissions, err := h.rbac.UserPermissions(*userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "permissions": permissions})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenReplayGuard validates inbound SAML assertions and OIDC ID tokens. It is set by
+// SetupRoutes; when nil a guard that does not raise alerts is used.
+var tokenReplayGuard *services.ReplayGuard
+
+func activeReplayGuard() *services.ReplayGuard {
+	if tokenReplayGuard == nil {
+		tokenReplayGuard = services.NewReplayGuard(services.GetDB(), nil)
+	}
+	return tokenReplayGuard
+}
+
+func tokenSource(c *gin.Context, provider string) services.TokenSource {
+	return services.TokenSource{
+		Provider:  provider,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+	}
+}
+
+// issueAuthNonce creates the nonce for an OIDC authorization request, responding with
+// an error if it cannot be stored
+func issueAuthNonce(c *gin.Context, provider string) (string, bool) {
+	nonce, err := activeReplayGuard().IssueNonce(provider, time.Now())
+	if err != nil {
+		log.Printf("Error issuing %s nonce: %v", provider, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate nonce"})
+		return "", false
+	}
+	return nonce, true
+}
+
+// checkIDToken rejects a sign-in whose ID token is invalid, expired or replayed
+func checkIDToken(c *gin.Context, provider, idToken, clientID string) bool {
+	if err := activeReplayGuard().CheckIDToken(idToken, clientID, tokenSource(c, provider), time.Now()); err != nil {
+		rejectAssertion(c, provider, err)
+		return false
+	}
+	return true
+}
+
+// rejectAssertion records and responds to a SAML assertion or ID token that failed validation
+func rejectAssertion(c *gin.Context, provider string, err error) {
+	log.Printf("🚫 Rejected %s sign-in: %v", provider, err)
+	services.LogAuditEvent(c.Request.Context(), getUserIDFromContext(c), "assertion_rejected", "oauth_provider", provider, c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+
+	switch {
+	case errors.Is(err, services.ErrTokenReplayed),
+		errors.Is(err, services.ErrTokenExpired),
+		errors.Is(err, services.ErrTokenNotYetValid),
+		errors.Is(err, services.ErrInvalidAssertion),
+		errors.Is(err, services.ErrInvalidNonce):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in assertion rejected", "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate sign-in assertion"})
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResidencyHandlers contains the data residency handlers
+type ResidencyHandlers struct {
+	residencyService *services.ResidencyService
+}
+
+// NewResidencyHandlers creates new data residency handlers
+func NewResidencyHandlers(residencyService *services.ResidencyService) *ResidencyHandlers {
+	return &ResidencyHandlers{residencyService: residencyService}
+}
+
+// ListRegions returns the data residency regions with their tenants and connection state
+func (h *ResidencyHandlers) ListRegions(c *gin.Context) {
+	regions := h.residencyService.Regions()
+	c.JSON(http.StatusOK, gin.H{"regions": regions, "count": len(regions)})
+}
+
+// GetTenantRegion returns the region a tenant's data is stored in
+func (h *ResidencyHandlers) GetTenantRegion(c *gin.Context) {
+	tenant := c.Param("tenant")
+	c.JSON(http.StatusOK, gin.H{"tenant": tenant, "region": h.residencyService.RegionFor(tenant)})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math"
@@ -11,80 +12,26 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 )
 
 // Risk scoring structures
 type RiskAssessment struct {
-	UserID            string          `json:"user_id"`
-	SessionID         string          `json:"session_id"`
-	IPAddress         string          `json:"ip_address"`
-	UserAgent         string          `json:"user_agent"`
-	Location          LocationInfo    `json:"location"`
-	DeviceFingerprint string          `json:"device_fingerprint"`
-	BehaviorSignals   BehaviorSignals `json:"behavior_signals"`
-	RiskScore         float64         `json:"risk_score"`
-	RiskLevel         string          `json:"risk_level"`
-	Factors           []RiskFactor    `json:"risk_factors"`
-	Recommendations   []string        `json:"recommendations"`
-	Timestamp         time.Time       `json:"timestamp"`
-}
-
-type LocationInfo struct {
-	Country   string  `json:"country"`
-	Region    string  `json:"region"`
-	City      string  `json:"city"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-	Timezone  string  `json:"timezone"`
-	ISP       string  `json:"isp"`
-	IsVPN     bool    `json:"is_vpn"`
-	IsTor     bool    `json:"is_tor"`
-	IsProxy   bool    `json:"is_proxy"`
-}
-
-type BehaviorSignals struct {
-	TypingPattern     TypingPattern     `json:"typing_pattern"`
-	MouseMovement     MouseMovement     `json:"mouse_movement"`
-	NavigationPattern NavigationPattern `json:"navigation_pattern"`
-	TimePatterns      TimePatterns      `json:"time_patterns"`
-}
-
-type TypingPattern struct {
-	AvgKeydownTime float64   `json:"avg_keydown_time"`
-	AvgKeyupTime   float64   `json:"avg_keyup_time"`
-	TypingRhythm   float64   `json:"typing_rhythm"`
-	PausePatterns  []float64 `json:"pause_patterns"`
-}
-
-type MouseMovement struct {
-	AvgSpeed        float64 `json:"avg_speed"`
-	ClickFrequency  float64 `json:"click_frequency"`
-	MovementPattern string  `json:"movement_pattern"`
-	ScrollBehavior  float64 `json:"scroll_behavior"`
-}
-
-type NavigationPattern struct {
-	PageSequence    []string `json:"page_sequence"`
-	SessionDuration float64  `json:"session_duration"`
-	ClickDepth      int      `json:"click_depth"`
-	BackButtonUsage int      `json:"back_button_usage"`
-}
-
-type TimePatterns struct {
-	LoginTime        string  `json:"login_time"`
-	TypicalHours     []int   `json:"typical_hours"`
-	WeekdayPattern   []int   `json:"weekday_pattern"`
-	SessionFrequency float64 `json:"session_frequency"`
-}
-
-type RiskFactor struct {
-	Type        string  `json:"type"`
-	Description string  `json:"description"`
-	Weight      float64 `json:"weight"`
-	Score       float64 `json:"score"`
-	Severity    string  `json:"severity"`
+	UserID            string                   `json:"user_id"`
+	SessionID         string                   `json:"session_id"`
+	IPAddress         string                   `json:"ip_address"`
+	UserAgent         string                   `json:"user_agent"`
+	Location          services.LocationInfo    `json:"location"`
+	DeviceFingerprint string                   `json:"device_fingerprint"`
+	BehaviorSignals   services.BehaviorSignals `json:"behavior_signals"`
+	RiskScore         float64                  `json:"risk_score"`
+	RiskLevel         models.RiskLevel         `json:"risk_level"`
+	Factors           []services.RiskFactor    `json:"risk_factors"`
+	Recommendations   []string                 `json:"recommendations"`
+	Timestamp         time.Time                `json:"timestamp"`
 }
 
 type PolicyDecision struct {
@@ -138,7 +85,7 @@ func AssessRiskHandler(c *gin.Context) {
 	}
 
 	// Perform geolocation lookup
-	location := performGeolocation(ipAddress)
+	location := performGeolocation(c.Request.Context(), ipAddress)
 
 	// Get behavior signals
 	behaviorSignals := extractBehaviorSignals(contextData)
@@ -147,7 +94,7 @@ func AssessRiskHandler(c *gin.Context) {
 	assessment := calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint, location, behaviorSignals)
 
 	// Store assessment for future reference
-	err := services.StoreRiskAssessment(assessment)
+	err := services.StoreRiskAssessment(c.Request.Context(), assessment.record())
 	if err != nil {
 		log.Printf("Error storing risk assessment: %v", err)
 		// Don't fail the request for this
@@ -165,35 +112,32 @@ func GetPolicyDecisionHandler(c *gin.Context) {
 	}
 
 	// Get latest risk assessment
-	assessment, err := services.GetLatestRiskAssessment(userID)
+	assessment, err := services.GetLatestRiskAssessment(c.Request.Context(), userID)
 	if err != nil {
 		log.Printf("Error getting risk assessment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get risk assessment"})
 		return
 	}
 
-	// Convert assessment to our internal type for policy decision
-	assessmentMap, ok := assessment.(map[string]interface{})
-	if !ok {
-		log.Printf("Error converting assessment to map")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process risk assessment"})
-		return
-	}
-
-	// Create a proper RiskAssessment struct for policy decision
-	riskScore, _ := assessmentMap["risk_score"].(float64)
-	riskLevel, _ := assessmentMap["risk_level"].(string)
-
+	// Make the policy decision on the stored score and level
+	riskScore := assessment.RiskScore
 	internalAssessment := RiskAssessment{
 		RiskScore: riskScore,
-		RiskLevel: riskLevel,
+		RiskLevel: assessment.RiskLevel,
 	}
 
 	// Make policy decision
 	decision := makePolicyDecision(internalAssessment)
 
+	// The decision's idle timeout applies to the session the request was made with
+	if sessionID := currentSessionID(c); sessionID != nil && sessionActivity != nil && decision.SessionLimits.IdleTimeout > 0 {
+		if err := sessionActivity.LimitIdleTimeout(*sessionID, decision.SessionLimits.IdleTimeout); err != nil {
+			log.Printf("Error applying session limits: %v", err)
+		}
+	}
+
 	// Log policy decision
-	services.LogAuditEvent(userID, "policy_decision", "security", userID, c.ClientIP(), c.GetHeader("User-Agent"),
+	services.LogAuditEvent(c.Request.Context(), userID, "policy_decision", "security", userID, c.ClientIP(), c.GetHeader("User-Agent"),
 		fmt.Sprintf("Policy decision: %s (risk: %.2f)", decision.Action, riskScore), "info")
 
 	c.JSON(http.StatusOK, decision)
@@ -213,7 +157,7 @@ func GetRiskHistoryHandler(c *gin.Context) {
 		limit = 50
 	}
 
-	assessments, err := services.GetRiskAssessmentHistory(userID, limit)
+	assessments, err := services.GetRiskAssessmentHistory(c.Request.Context(), userID, limit)
 	if err != nil {
 		log.Printf("Error getting risk history: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get risk history"})
@@ -249,7 +193,7 @@ func UpdateRiskThresholdsHandler(c *gin.Context) {
 	}
 
 	// Log threshold update
-	services.LogAuditEvent(userID, "risk_thresholds_updated", "security", "global", c.ClientIP(), c.GetHeader("User-Agent"),
+	services.LogAuditEvent(c.Request.Context(), userID, "risk_thresholds_updated", "security", "global", c.ClientIP(), c.GetHeader("User-Agent"),
 		"Risk scoring thresholds updated", "info")
 
 	c.JSON(http.StatusOK, gin.H{
@@ -260,9 +204,10 @@ func UpdateRiskThresholdsHandler(c *gin.Context) {
 
 // Helper functions
 
-func performGeolocation(ipAddress string) LocationInfo {
-	// Simplified geolocation - in production, use MaxMind GeoIP2 or similar service
-	location := LocationInfo{
+// performGeolocation locates an IP address with GeoIP, reporting private addresses as local
+// and addresses GeoIP cannot locate as unknown
+func performGeolocation(ctx context.Context, ipAddress string) services.LocationInfo {
+	location := services.LocationInfo{
 		Country:  "Unknown",
 		Region:   "Unknown",
 		City:     "Unknown",
@@ -286,44 +231,43 @@ func performGeolocation(ipAddress string) LocationInfo {
 		return location
 	}
 
-	// Mock geolocation data based on IP patterns
-	if strings.HasPrefix(ipAddress, "192.168.") || strings.HasPrefix(ipAddress, "10.") {
-		location.Country = "US"
-		location.Region = "California"
-		location.City = "San Francisco"
-		location.Latitude = 37.7749
-		location.Longitude = -122.4194
-		location.Timezone = "America/Los_Angeles"
-		location.ISP = "Local Network"
+	if located := services.LocateIP(ctx, ipAddress); located != nil {
+		location.Country = located.Country
+		location.Region = located.Region
+		location.City = located.City
+		location.Latitude = located.Latitude
+		location.Longitude = located.Longitude
+		location.ASN = located.ASN
+		location.ASOrganization = located.ASOrganization
+		location.IsVPN = located.VPNDetected
+		if located.Timezone != "" {
+			location.Timezone = located.Timezone
+		}
+		if located.ISP != "" {
+			location.ISP = located.ISP
+		}
 	}
 
-	// In production, integrate with MaxMind GeoIP2:
-	// db, err := geoip2.Open("GeoLite2-City.mmdb")
-	// record, err := db.City(ip)
-	// location.Country = record.Country.IsoCode
-	// location.City = record.City.Names["en"]
-	// etc.
-
 	return location
 }
 
-func extractBehaviorSignals(contextData map[string]interface{}) BehaviorSignals {
-	signals := BehaviorSignals{
-		TypingPattern: TypingPattern{
+func extractBehaviorSignals(contextData map[string]interface{}) services.BehaviorSignals {
+	signals := services.BehaviorSignals{
+		TypingPattern: services.TypingPattern{
 			AvgKeydownTime: 100.0,
 			AvgKeyupTime:   50.0,
 			TypingRhythm:   1.0,
 		},
-		MouseMovement: MouseMovement{
+		MouseMovement: services.MouseMovement{
 			AvgSpeed:        150.0,
 			ClickFrequency:  2.0,
 			MovementPattern: "normal",
 		},
-		NavigationPattern: NavigationPattern{
+		NavigationPattern: services.NavigationPattern{
 			SessionDuration: 300.0,
 			ClickDepth:      5,
 		},
-		TimePatterns: TimePatterns{
+		TimePatterns: services.TimePatterns{
 			LoginTime:        time.Now().Format("15:04"),
 			TypicalHours:     []int{9, 10, 11, 14, 15, 16},
 			SessionFrequency: 1.5,
@@ -344,7 +288,26 @@ func extractBehaviorSignals(contextData map[string]interface{}) BehaviorSignals
 	return signals
 }
 
-func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string, location LocationInfo, behavior BehaviorSignals) RiskAssessment {
+// record is the assessment as StoreRiskAssessment stores it
+func (a RiskAssessment) record() *services.RiskAssessment {
+	userID, _ := uuid.Parse(a.UserID)
+	location, behavior := a.Location, a.BehaviorSignals
+	return &services.RiskAssessment{
+		UserID:            userID,
+		SessionID:         a.SessionID,
+		IPAddress:         a.IPAddress,
+		UserAgent:         a.UserAgent,
+		Location:          &location,
+		DeviceFingerprint: a.DeviceFingerprint,
+		BehaviorSignals:   &behavior,
+		RiskScore:         a.RiskScore,
+		RiskLevel:         a.RiskLevel,
+		Factors:           a.Factors,
+		Recommendations:   a.Recommendations,
+	}
+}
+
+func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string, location services.LocationInfo, behavior services.BehaviorSignals) RiskAssessment {
 	assessment := RiskAssessment{
 		UserID:            userID,
 		IPAddress:         ipAddress,
@@ -353,14 +316,14 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 		Location:          location,
 		BehaviorSignals:   behavior,
 		Timestamp:         time.Now(),
-		Factors:           []RiskFactor{},
+		Factors:           []services.RiskFactor{},
 	}
 
 	totalScore := 0.0
 
 	// Location-based risk factors
 	if location.IsVPN {
-		factor := RiskFactor{
+		factor := services.RiskFactor{
 			Type:        "location",
 			Description: "VPN usage detected",
 			Weight:      0.3,
@@ -372,7 +335,7 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 	}
 
 	if location.IsTor {
-		factor := RiskFactor{
+		factor := services.RiskFactor{
 			Type:        "location",
 			Description: "Tor network usage detected",
 			Weight:      0.5,
@@ -387,7 +350,7 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 	currentHour := time.Now().Hour()
 	isOffHours := currentHour < 6 || currentHour > 22
 	if isOffHours {
-		factor := RiskFactor{
+		factor := services.RiskFactor{
 			Type:        "temporal",
 			Description: "Login outside typical hours",
 			Weight:      0.2,
@@ -400,7 +363,7 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 
 	// Device fingerprint risk
 	if deviceFingerprint == "" {
-		factor := RiskFactor{
+		factor := services.RiskFactor{
 			Type:        "device",
 			Description: "No device fingerprint available",
 			Weight:      0.2,
@@ -414,7 +377,7 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 	// Check for new device
 	isNewDevice, err := services.IsNewDevice(userID, deviceFingerprint)
 	if err == nil && isNewDevice {
-		factor := RiskFactor{
+		factor := services.RiskFactor{
 			Type:        "device",
 			Description: "New device detected",
 			Weight:      0.4,
@@ -427,7 +390,7 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 
 	// Behavior analysis
 	if behavior.TypingPattern.AvgKeydownTime > 200 || behavior.TypingPattern.AvgKeydownTime < 50 {
-		factor := RiskFactor{
+		factor := services.RiskFactor{
 			Type:        "behavior",
 			Description: "Unusual typing pattern detected",
 			Weight:      0.15,
@@ -443,13 +406,13 @@ func calculateRiskScore(userID, ipAddress, userAgent, deviceFingerprint string,
 
 	// Determine risk level
 	if assessment.RiskScore < 0.3 {
-		assessment.RiskLevel = "low"
+		assessment.RiskLevel = models.RiskLow
 	} else if assessment.RiskScore < 0.6 {
-		assessment.RiskLevel = "medium"
+		assessment.RiskLevel = models.RiskMedium
 	} else if assessment.RiskScore < 0.8 {
-		assessment.RiskLevel = "high"
+		assessment.RiskLevel = models.RiskHigh
 	} else {
-		assessment.RiskLevel = "critical"
+		assessment.RiskLevel = models.RiskCritical
 	}
 
 	// Generate recommendations
@@ -470,7 +433,7 @@ func makePolicyDecision(assessment RiskAssessment) PolicyDecision {
 	}
 
 	switch assessment.RiskLevel {
-	case "low":
+	case models.RiskLow:
 		decision.Action = "allow"
 		decision.Explanation = "Low risk - standard access granted"
 		decision.SessionLimits = SessionLimits{
@@ -478,7 +441,7 @@ func makePolicyDecision(assessment RiskAssessment) PolicyDecision {
 			IdleTimeout: 60,  // 1 hour
 		}
 
-	case "medium":
+	case models.RiskMedium:
 		decision.Action = "step_up"
 		decision.RequiredMFA = []string{"totp", "sms"}
 		decision.Explanation = "Medium risk - additional authentication required"
@@ -490,7 +453,7 @@ func makePolicyDecision(assessment RiskAssessment) PolicyDecision {
 		decision.Monitoring.Level = "enhanced"
 		decision.Monitoring.LogAllActions = true
 
-	case "high":
+	case models.RiskHigh:
 		decision.Action = "step_up"
 		decision.RequiredMFA = []string{"webauthn", "totp"}
 		decision.Explanation = "High risk - strong authentication and monitoring required"
@@ -505,7 +468,7 @@ func makePolicyDecision(assessment RiskAssessment) PolicyDecision {
 		decision.Monitoring.RealTimeAlerts = true
 		decision.Monitoring.BehaviorTracking = true
 
-	case "critical":
+	case models.RiskCritical:
 		decision.Action = "deny"
 		decision.Explanation = "Critical risk - access denied"
 		decision.Monitoring.Level = "full"
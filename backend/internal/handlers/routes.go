@@ -1,35 +1,504 @@
 package handlers
 
 import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
 	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/grpcapi"
 	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes configures all the API routes for the application
-func SetupRoutes(router *gin.Engine, cfg *config.Config) {
+// SetupRoutes configures all the API routes for the application. Background loops the
+// services need run under workers, and their services shut down when workers stop.
+func SetupRoutes(router *gin.Engine, cfg *config.Config, workers *services.Workers) {
 	// Initialize services
 	db := services.GetDB()
 	userService := services.NewUserService(db)
 	sessionService := services.NewSessionService(db)
+	sessionActivity = services.NewSessionActivityService(db)
+	middleware.SetSessionActivityTracker(sessionActivity)
 	settingsService := services.NewUserSettingsService(db)
 	adaptiveAuthService := services.NewAdaptiveAuthService(db)
 	securityMonitoringService := services.NewSecurityMonitoringService(db)
+	workers.OnStop(securityMonitoringService.Shutdown)
+	// Changes to rules, thresholds, policies and channels are versioned and watched for drift
+	configDriftService := services.NewConfigDriftService(db, securityMonitoringService)
+	services.SetConfigDriftService(configDriftService)
+	// OAuth request-token secrets, WebAuthn challenges and threat intel answers are kept in
+	// Redis when REDIS_URL is set, so a request can land on any instance
+	if cache, err := services.NewCacheFromEnv(); err != nil {
+		log.Printf("⚠️ Redis cache disabled, keeping short-lived state in memory: %v", err)
+	} else {
+		services.SetCache(cache)
+	}
+	// Alerts and IP reputation draw on Tor exit node, Spamhaus DROP and AbuseIPDB data when
+	// configured; every instance refreshes its own copy of the downloaded lists
+	threatIntelligence := securityMonitoringService.ThreatIntelligence()
+	threatIntelligence.UseCache(services.SharedCache())
+	for _, provider := range services.NewThreatIntelProvidersFromEnv() {
+		threatIntelligence.AddProvider(provider)
+	}
+	workers.Go(threatIntelligence.RunFeedRefresh)
+	// Sign-in risk and alerts consult the local IP reputation, which failed logins and alerts feed
+	ipReputationService := services.NewIPReputationService(db, securityMonitoringService.ThreatIntelligence())
+	services.SetIPReputationService(ipReputationService)
+	// Risk scoring, adaptive auth and suspicious-location alerts locate sign-ins with GeoIP
+	if geoIPService, err := services.NewGeoIPServiceFromEnv(); err != nil {
+		log.Printf("⚠️ GeoIP disabled: %v", err)
+	} else if geoIPService != nil {
+		services.SetGeoIPService(geoIPService)
+	}
+	webhookService := services.NewWebhookService(db)
+	webhookSigningService := services.NewWebhookSigningService(db)
+	webhookService.UseSigner(webhookSigningService)
+	consentService := services.NewConsentService(db)
+	analyticsService := services.NewAnalyticsService(db)
+	licenseService := services.NewLicenseService(db)
+	// Risk scoring and alerting read the same watchlist the handlers write, so a change
+	// takes effect without waiting for a cache to expire
+	watchlistService := services.NewWatchlistService(db)
+	adaptiveAuthService.SetWatchlist(watchlistService)
+	securityMonitoringService.SetWatchlist(watchlistService)
+	timelineService := services.NewTimelineService(db)
+	caseService := services.NewCaseService(db)
+	accessScheduleService := services.NewAccessScheduleService(db)
+	emergencyService := services.NewEmergencyService(db, securityMonitoringService)
+	providerSecretService := services.NewProviderSecretService(db)
+	// Long reports and exports share one job queue, which notifies JOB_NOTIFY_WEBHOOK_URL
+	jobQueue := services.NewJobQueue(db, webhookService)
+	workers.OnStop(jobQueue.Shutdown)
+	auditExportService := services.NewAuditExportService(db)
+	auditExportService.SetJobQueue(jobQueue)
+	auditService := services.NewAuditService(db)
+	auditService.SetJobQueue(jobQueue)
+	integrationHealthService := services.NewIntegrationHealthService(db, securityMonitoringService)
+	auditVolumeMonitor := services.NewAuditVolumeMonitor(db, securityMonitoringService)
+	wsfedService := services.NewWSFederationService()
+	signingKeyService := services.NewSigningKeyService(db, securityMonitoringService)
+	radiusService := services.NewRadiusService(db, adaptiveAuthService)
+	oauthProviders := services.NewOAuthProviderRegistry()
+	// Alerts and investigations deep-link into connected providers' admin consoles
+	adminLinkService := services.NewAdminLinkService(db, oauthProviders)
+	securityMonitoringService.SetAdminLinks(adminLinkService)
 
 	// Initialize handlers
 	userHandlers := NewUserHandlers(userService, sessionService)
 	settingsHandlers := NewSettingsHandlers(settingsService)
 	dashboardHandlers := NewDashboardHandlers(userService, settingsService)
 	adaptiveAuthHandlers := NewAdaptiveAuthHandlers(adaptiveAuthService)
-	securityMonitoringHandlers := NewSecurityMonitoringHandlers(securityMonitoringService)
+	// Alert emails carry signed links to acknowledge or escalate without signing in
+	alertEmailLinks := services.NewAlertEmailLinks(db, securityMonitoringService)
+	securityMonitoringHandlers := NewSecurityMonitoringHandlers(securityMonitoringService, webhookService, alertEmailLinks)
+	alertEmailHandlers := NewAlertEmailHandlers(alertEmailLinks)
+	alertStreamHandlers := NewAlertStreamHandlers(securityMonitoringService, cfg.AllowedOrigins)
+	consentHandlers := NewConsentHandlers(consentService)
+	securityCenterService := services.NewSecurityCenterService(db, describeLocation)
+	securityCenterHandlers := NewSecurityCenterHandlers(securityCenterService)
+	sessionHandlers := NewSessionHandlers(securityCenterService, securityMonitoringService)
+	loginDisputeHandlers := NewLoginDisputeHandlers(services.NewLoginDisputeService(db, securityMonitoringService), radiusService)
+	loginHistory = services.NewLoginHistoryService(db, geoLocate)
+	loginHistoryHandlers := NewLoginHistoryHandlers(loginHistory)
+	phishingResistant = services.NewPhishingResistantService(db)
+	phishingResistantHandlers := NewPhishingResistantHandlers(phishingResistant)
+	analyticsHandlers := NewAnalyticsHandlers(analyticsService)
+	licenseHandlers := NewLicenseHandlers(licenseService)
+	watchlistHandlers := NewWatchlistHandlers(watchlistService)
+	timelineHandlers := NewTimelineHandlers(timelineService, adminLinkService)
+	entityGraphHandlers := NewEntityGraphHandlers(services.NewEntityGraphService(db), adminLinkService)
+	ipReputationHandlers := NewIPReputationHandlers(ipReputationService)
+	caseHandlers := NewCaseHandlers(caseService)
+	objectStore := services.NewObjectStoreFromEnv()
+	fileUploadService := services.NewFileUploadService(db, objectStore, services.NewMalwareScannerFromEnv(), securityMonitoringService)
+	auditExportService.UseObjectStore(services.NewAuditExportStoreFromEnv(objectStore))
+	fileUploadHandlers := NewFileUploadHandlers(fileUploadService, caseService)
+	accessScheduleHandlers := NewAccessScheduleHandlers(accessScheduleService)
+	emergencyHandlers := NewEmergencyHandlers(emergencyService)
+	providerSecretHandlers := NewProviderSecretHandlers(providerSecretService)
+	auditExportHandlers := NewAuditExportHandlers(auditExportService)
+	auditReportHandlers := NewAuditReportHandlers(auditService, auditVolumeMonitor)
+	jobHandlers := NewJobHandlers(jobQueue, services.NewUserDataExportService(db, jobQueue))
+	webhookHandlers := NewWebhookHandlers(webhookService)
+	webhookConsumerHandlers := NewWebhookConsumerHandlers(webhookSigningService)
+	playbookHandlers := NewPlaybookHandlers(securityMonitoringService.Playbooks())
+	ruleImportHandlers := NewRuleImportHandlers(services.NewRuleImportService(db, securityMonitoringService), securityMonitoringService)
+	detectionQueryService := services.NewDetectionQueryService(db, securityMonitoringService)
+	detectionQueryHandlers := NewDetectionQueryHandlers(detectionQueryService)
+	integrationHealthHandlers := NewIntegrationHealthHandlers(integrationHealthService)
+	appSessionPolicyService := services.NewAppSessionPolicyService(db)
+	appSessionPolicyHandlers := NewAppSessionPolicyHandlers(appSessionPolicyService)
+	wsfedHandlers := NewWSFederationHandlers(wsfedService, consentService, accessScheduleService, appSessionPolicyService)
+	samlIssuer = services.NewSAMLIssuerService(db)
+	samlSSOHandlers := NewSAMLSSOHandlers(samlIssuer, consentService, accessScheduleService, appSessionPolicyService)
+	oidcProvider := services.NewOIDCProviderService(db)
+	oidcProvider.UseConsents(consentService)
+	oidcHandlers := NewOIDCHandlers(oidcProvider)
+	openAPIHandlers := NewOpenAPIHandlers(oidcProvider)
+	headerProxyHandlers := NewHeaderProxyHandlers(services.NewHeaderProxyService(db), consentService, accessScheduleService, appSessionPolicyService)
+
+	// Bookmark apps defined by admins join the app catalog
+	bookmarkService := services.NewBookmarkService(db)
+	if err := bookmarkService.LoadApps(); err != nil {
+		log.Printf("⚠️ Failed to load bookmark apps: %v", err)
+	}
+	bookmarkHandlers := NewBookmarkHandlers(bookmarkService, consentService, accessScheduleService, appSessionPolicyService)
+	// Session policies are attached once every app, bookmarks included, is in the catalog
+	if err := appSessionPolicyService.LoadPolicies(); err != nil {
+		log.Printf("⚠️ Failed to load app session policies: %v", err)
+	}
+	extensionHandlers := NewExtensionHandlers(services.NewExtensionService(db, securityMonitoringService))
+	shadowITService := services.NewShadowITService(db)
+	shadowITHandlers := NewShadowITHandlers(shadowITService)
+	slackHandlers := NewSlackHandlers(services.NewSlackTriageService(db, securityMonitoringService))
+	// Critical alerts are pushed to admins' registered phones and browsers through FCM
+	pushService := services.NewPushService(db)
+	if pushService.Enabled() {
+		securityMonitoringService.AddAlertChannel("push", &services.PushAlertChannel{
+			Push:        pushService,
+			MinSeverity: services.AlertSeverity(getEnv("PUSH_ALERT_MIN_SEVERITY", string(services.SeverityCritical))),
+			Enabled:     true,
+		})
+	}
+	pushHandlers := NewPushHandlers(pushService)
+	// Bursts of step-up prompts pause further ones, alert and tell the user on their phones
+	stepUpFatigue = services.NewStepUpFatigueService(db, securityMonitoringService, pushService)
+	middleware.SetStepUpGuard(stepUpFatigue)
+	stepUpFatigueHandlers := NewStepUpFatigueHandlers(stepUpFatigue)
+	// Accounts unused for STALE_ACCOUNT_DAYS are flagged or disabled, and counted in compliance reports
+	staleAccountService := services.NewStaleAccountService(db, securityMonitoringService, pushService)
+	auditService.SetStaleAccounts(staleAccountService)
+	staleAccountHandlers := NewStaleAccountHandlers(staleAccountService)
+	// Admin and security analyst roles are reviewed against their audited privileged requests
+	privilegeReviewService := services.NewPrivilegeReviewService(db, jobQueue)
+	auditService.SetPrivilegeReview(privilegeReviewService)
+	privilegeReviewHandlers := NewPrivilegeReviewHandlers(privilegeReviewService)
+	// Security, audit and admin endpoints require the admin or security analyst role
+	rbacService := services.NewRBACService(db, auditService)
+	middleware.SetRoleChecker(rbacService)
+	rbacHandlers := NewRBACHandlers(rbacService)
+	// Access tokens from the Keycloak realm are verified against its published keys
+	if keycloakVerifier := services.NewKeycloakTokenVerifier(db); keycloakVerifier.Enabled() {
+		middleware.SetExternalTokenVerifier(keycloakVerifier)
+		log.Printf("Accepting Keycloak access tokens from %s", keycloakVerifier.Issuer())
+	}
+	// Alerts also land in an in-app inbox for each admin and security analyst
+	notificationInbox := services.NewNotificationInboxService(db)
+	securityMonitoringService.AddAlertChannel("inbox", &services.InboxAlertChannel{
+		Inbox:       notificationInbox,
+		MinSeverity: services.AlertSeverity(getEnv("NOTIFICATION_INBOX_MIN_SEVERITY", string(services.SeverityLow))),
+		Enabled:     getEnv("NOTIFICATION_INBOX_ENABLED", "true") == "true",
+	})
+	notificationInboxHandlers := NewNotificationInboxHandlers(notificationInbox)
+	// One posture score per tenant, snapshotted for its trend
+	postureScoreService := services.NewPostureScoreService(db)
+	postureScoreHandlers := NewPostureScoreHandlers(postureScoreService)
+	// Risky-user signals from Google and Microsoft raise alerts and adjust user risk
+	idpRiskService := services.NewIdPRiskSignalService(db, securityMonitoringService)
+	idpRiskHandlers := NewIdPRiskHandlers(idpRiskService)
+	// Keycloak login, logout and admin events are audited and feed login monitoring
+	keycloakEventService := services.NewKeycloakEventService(db, securityMonitoringService)
+	keycloakEventHandlers := NewKeycloakEventHandlers(keycloakEventService)
+	// Device posture from the agent, Intune and Jamf counts towards device risk and app policies
+	devicePostureService := services.NewDevicePostureService(db)
+	services.SetDevicePostureService(devicePostureService)
+	devicePostureHandlers := NewDevicePostureHandlers(devicePostureService)
+
+	// OAuth callbacks pick up rotated client secrets
+	providerSecrets = providerSecretService
+
+	// Sign-in flows only redirect to allowlisted frontend and callback origins
+	redirectAllowlist = services.NewRedirectAllowlist()
+
+	// While the database is a replica after a failover, sign-in keeps working, changes are
+	// refused and audit writes are queued; writes queued before a restart are replayed now
+	disasterRecoveryService := services.NewDisasterRecoveryService(db)
+	services.SetDisasterRecoveryService(disasterRecoveryService)
+	disasterRecovery = disasterRecoveryService
+	disasterRecoveryHandlers := NewDisasterRecoveryHandlers(disasterRecoveryService)
+	if !disasterRecoveryService.Enabled() {
+		workers.Go(func(context.Context) {
+			if _, err := disasterRecoveryService.Replay(); err != nil {
+				log.Printf("⚠️ Failed to replay disaster recovery queue: %v", err)
+			}
+		})
+	}
+
+	// Tenant audit data is kept in the tenant's data residency region
+	residencyService := services.NewResidencyService(db)
+	services.SetResidencyService(residencyService)
+	residencyHandlers := NewResidencyHandlers(residencyService)
+
+	// Audit logs, audit events and security alerts are forwarded to the SIEMs configured in
+	// the environment, draining what is queued when the workers stop
+	siemForwarder := services.NewEventForwarderFromEnv()
+	if siemForwarder != nil {
+		auditService.SetEventForwarder(siemForwarder)
+		securityMonitoringService.SetEventForwarder(siemForwarder)
+		workers.Go(siemForwarder.Run)
+	}
+	configDriftHandlers := NewConfigDriftHandlers(configDriftService)
+	configBackupHandlers := NewConfigBackupHandlers(services.NewConfigBackupService(db, securityMonitoringService, residencyService))
+
+	// SAML assertions and OIDC ID tokens are checked for expiry and replay
+	tokenReplayGuard = services.NewReplayGuard(db, securityMonitoringService)
+	samlServiceProvider = services.NewSAMLServiceProvider(db)
+	samlIdPHandlers := NewSAMLIdPHandlers(samlServiceProvider)
+
+	// OAuth callbacks and token refresh are throttled against forged codes, states and tokens
+	callbackGuard := services.NewCallbackGuard(db, securityMonitoringService)
+	callbackGuardHandlers := NewCallbackGuardHandlers(callbackGuard)
+	canaryKeyHandlers := NewCanaryKeyHandlers(services.NewCanaryKeyService(db, securityMonitoringService))
+
+	// SaaS integrations connect through one OAuth flow driven by the provider registry, and
+	// callbacks are only accepted with a state issued to the same user
+	oauthProviderHandlers := NewOAuthProviderHandlers(oauthProviders)
+	oauthStates = services.NewStateStore(db)
+
+	// SAML and WS-Federation assertions and OIDC tokens are signed with managed, rotating keys
+	if err := signingKeyService.EnsureActiveKey(time.Now()); err != nil {
+		log.Printf("⚠️ Failed to prepare signing key: %v", err)
+	} else {
+		wsfedService.UseSigningKeys(signingKeyService)
+		samlIssuer.UseSigningKeys(signingKeyService)
+		oidcProvider.UseSigningKeys(signingKeyService)
+		// Clients call the API with the access tokens the provider issues them
+		middleware.SetExternalTokenVerifier(oidcProvider)
+		signingKeys = signingKeyService
+	}
+	signingKeyHandlers := NewSigningKeyHandlers(signingKeyService)
+
+	// Internal services report events with a client certificate mapped to a service account
+	serviceAccountService := services.NewServiceAccountService(db)
+	serviceAccountHandlers := NewServiceAccountHandlers(serviceAccountService)
+
+	// High-volume senders can use the gRPC API instead, with the same accounts over mTLS
+	workers.Go(func(ctx context.Context) {
+		grpcapi.ServeFromEnv(ctx, securityMonitoringService, serviceAccountService)
+	})
+
+	// Domain-joined devices on the internal network can sign in with Kerberos
+	kerberosHandlers := NewKerberosHandlers(services.NewKerberosService(db, tokenReplayGuard), sessionService, cfg)
+
+	// Support impersonation sessions stop working as soon as the impersonation ends
+	impersonationService := services.NewImpersonationService(db, sessionService, auditService)
+	impersonationHandlers := NewImpersonationHandlers(impersonationService, userService, cfg)
+	middleware.SetImpersonationChecker(impersonationService)
+
+	// Emergency lockdowns revoke and restrict tokens in every authenticated route
+	middleware.SetTokenRevocationChecker(emergencyService)
+
+	// Leased periodic jobs stop with the other background workers
+	runPeriodic := func(name string, interval time.Duration, job func() error) {
+		workers.Go(func(ctx context.Context) {
+			services.NewLockService(db).RunPeriodic(ctx, name, interval, job)
+		})
+	}
+
+	// Score provider integrations and raise degradation alerts through the monitoring
+	// service that serves the alert routes, leased so only one instance evaluates
+	runPeriodic("integration_health", integrationHealthService.Interval(), func() error {
+		alerts, err := integrationHealthService.Evaluate(time.Now())
+		if alerts > 0 {
+			log.Printf("🔌 Raised %d integration degradation alert(s)", alerts)
+		}
+		return err
+	})
+
+	// Alert when audit volume drops or spikes against its per-category baseline
+	runPeriodic("audit_volume", auditVolumeMonitor.Interval(), func() error {
+		alerts, err := auditVolumeMonitor.Evaluate(time.Now())
+		if alerts > 0 {
+			log.Printf("📉 Raised %d audit volume anomaly alert(s)", alerts)
+		}
+		return err
+	})
+
+	// Uploads are deleted from storage once their purpose's retention has passed
+	runPeriodic("upload_lifecycle", fileUploadService.Interval(), func() error {
+		purged, err := fileUploadService.PurgeExpired(workers.Context(), time.Now())
+		if purged > 0 {
+			log.Printf("🗑️ Purged %d expired upload(s)", purged)
+		}
+		return err
+	})
+
+	// Finished jobs and their logs are kept for JOB_RETENTION
+	runPeriodic("job_queue_purge", jobQueue.Interval(), func() error {
+		purged, err := jobQueue.PurgeFinished(time.Now())
+		if purged > 0 {
+			log.Printf("🗑️ Purged %d finished job(s)", purged)
+		}
+		return err
+	})
+
+	// Forget callback failures outside the throttling window and expired blocks
+	runPeriodic("callback_guard_purge", callbackGuard.Interval(), func() error {
+		return callbackGuard.Purge(time.Now())
+	})
+
+	// Switch to scheduled signing keys, retire old ones and warn before certificates expire
+	runPeriodic("signing_key_maintenance", signingKeyService.Interval(), func() error {
+		return signingKeyService.Maintain(time.Now())
+	})
+
+	// Retire webhook signing keys whose rotation overlap has ended
+	runPeriodic("webhook_key_retirement", webhookSigningService.Interval(), func() error {
+		retired, err := webhookSigningService.RetireExpiredKeys(time.Now())
+		if retired > 0 {
+			log.Printf("🔑 Retired %d webhook signing key(s)", retired)
+		}
+		return err
+	})
+
+	// Warn owners of unused accounts, then flag or disable them past the limit
+	runPeriodic("stale_accounts", staleAccountService.Interval(), func() error {
+		scan, err := staleAccountService.Scan(time.Now())
+		if scan.Warned+scan.Dormant+scan.Disabled > 0 {
+			log.Printf("💤 Dormant accounts: %d warned, %d flagged, %d disabled", scan.Warned, scan.Dormant, scan.Disabled)
+		}
+		return err
+	})
+
+	// Queue a review of privileged role holders; results are kept as privilege_review jobs
+	runPeriodic("privilege_review", privilegeReviewService.Interval(), func() error {
+		_, err := privilegeReviewService.StartReport(nil)
+		return err
+	})
+
+	// Drop inbox notifications past their retention
+	runPeriodic("notification_inbox_purge", notificationInbox.Interval(), func() error {
+		_, err := notificationInbox.Purge(time.Now())
+		return err
+	})
+
+	// Record each tenant's posture score for the trend
+	runPeriodic("posture_score", postureScoreService.Interval(), func() error {
+		_, err := postureScoreService.Snapshot(time.Now())
+		return err
+	})
+
+	// Discover unsanctioned SaaS apps from extension reports and tenant OAuth grants
+	runPeriodic("shadow_it_scan", shadowITService.Interval(), func() error {
+		for source, err := range shadowITService.Scan(workers.Context(), time.Now()) {
+			if err != nil {
+				log.Printf("⚠️ Shadow IT scan of %s failed: %v", source, err)
+			}
+		}
+		return nil
+	})
+
+	// Poll Microsoft Entra for users whose risk changed, in case change notifications are missed
+	if idpRiskService.MicrosoftEnabled() {
+		runPeriodic("idp_risk_sync", idpRiskService.Interval(), func() error {
+			recorded, err := idpRiskService.SyncMicrosoft(workers.Context(), time.Now())
+			if recorded > 0 {
+				log.Printf("🔐 Recorded %d Microsoft risk signal(s)", recorded)
+			}
+			return err
+		})
+	}
+
+	// Poll Keycloak for login, logout and admin events, and forget old ones already ingested
+	if keycloakEventService.PollEnabled() || keycloakEventService.WebhookEnabled() {
+		runPeriodic("keycloak_events", keycloakEventService.Interval(), func() error {
+			if keycloakEventService.PollEnabled() {
+				result, err := keycloakEventService.SyncEvents(workers.Context(), time.Now())
+				if result.Ingested > 0 {
+					log.Printf("🔑 Ingested %d Keycloak event(s)", result.Ingested)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			_, err := keycloakEventService.Purge(time.Now())
+			return err
+		})
+	}
+
+	// End sessions that went idle without another request and audit why they ended
+	runPeriodic("session_idle_timeout", sessionActivity.Interval(), func() error {
+		ended, err := sessionActivity.ExpireIdle(time.Now())
+		if ended > 0 {
+			log.Printf("⏲️ Ended %d idle session(s)", ended)
+		}
+		return err
+	})
+
+	// Run saved detection queries whose schedule is due, leased so alerts are raised once
+	runPeriodic("detection_queries", detectionQueryService.Interval(), func() error {
+		alerts, err := detectionQueryService.EvaluateDue(time.Now())
+		if alerts > 0 {
+			log.Printf("🔎 Raised %d detection query alert(s)", alerts)
+		}
+		return err
+	})
+
+	// Write scheduled audit exports to the bucket, leased so each window is exported once
+	runPeriodic("audit_file_exports", auditExportService.Interval(), func() error {
+		exported, err := auditExportService.RunDueExports(workers.Context(), time.Now())
+		if exported > 0 {
+			log.Printf("📤 Wrote %d scheduled audit export(s)", exported)
+		}
+		return err
+	})
+
+	// Optional RADIUS server for network device and VPN logins. It shares the adaptive
+	// auth service above, so RADIUS logins are scored against the same watchlist.
+	runPeriodic("radius_purge", time.Hour, func() error {
+		return radiusService.PurgeExpired(time.Now())
+	})
+	if radiusService.Enabled() {
+		radiusAddress := os.Getenv("RADIUS_LISTEN_ADDR")
+		if radiusAddress == "" {
+			radiusAddress = "0.0.0.0:1812"
+		}
+		workers.Go(func(ctx context.Context) {
+			log.Printf("📡 RADIUS server listening on %s/udp", radiusAddress)
+			if err := radiusService.ListenAndServe(ctx, radiusAddress); err != nil {
+				log.Printf("❌ RADIUS server stopped: %v", err)
+			}
+		})
+	}
+
+	// Blocked IP addresses are refused before anything else runs
+	router.Use(ipReputationHandlers.BlockDeniedIPs())
+
+	// Clients over their per-IP, per-route or per-user request limits are refused, and
+	// audited once each time they start being refused
+	rateLimiter := middleware.NewRateLimiter(cfg.RateLimits)
+	rateLimiter.OnLimit(func(c *gin.Context, scope, key string) {
+		details := map[string]interface{}{"scope": scope, "key": key}
+		if err := auditService.LogAPIEvent(c.Request.Context(), getAnalystID(c), c.ClientIP(), c.GetHeader("User-Agent"), c.Request.URL.Path, c.Request.Method, http.StatusTooManyRequests, 0, details); err != nil {
+			log.Printf("Failed to audit rate limit: %v", err)
+		}
+	})
+	router.Use(rateLimiter.LimitRequests())
+	middleware.SetRateLimiter(rateLimiter)
+
+	// Any use of a canary API key is refused and raised as a leak, before the rest of the chain
+	router.Use(canaryKeyHandlers.DetectCanaryKeys())
+
+	// Configuration changes are refused in disaster recovery mode
+	router.Use(disasterRecoveryHandlers.BlockWritesDuringRecovery())
+
+	// Full request logging for watchlisted users
+	router.Use(watchlistHandlers.WatchlistSessionLogger())
+
+	// Every request made while impersonating a user is audited
+	router.Use(impersonationHandlers.AuditImpersonatedRequests())
 
 	// Add global OPTIONS handler for CORS preflight
 	router.OPTIONS("/*cors", func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS,PATCH")
-		c.Header("Access-Control-Allow-Headers", "Origin,Content-Type,Accept,Authorization,X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Origin,Content-Type,Accept,Authorization,X-Requested-With,X-Device-ID,X-Session-Activity")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Status(204)
 	})
@@ -37,15 +506,34 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	// Health check endpoint
 	router.GET("/health", HealthCheckHandler)
 	router.GET("/health/db", DatabaseHealthCheckHandler)
+	// Liveness and readiness probes; readiness checks the database, Redis, Keycloak, the
+	// background workers and SIEM forwarding
+	healthService := services.NewHealthService(db, workers)
+	healthService.SetEventForwarder(siemForwarder)
+	healthHandlers := NewHealthHandlers(healthService)
+	router.GET("/healthz", healthHandlers.Liveness)
+	router.GET("/readyz", healthHandlers.Readiness)
 
 	// Auth endpoints (JWT-based)
-	router.POST("/auth/register", RegisterHandler(userService))
-	router.POST("/auth/login", LoginHandler(userService, sessionService, cfg))
-	router.POST("/auth/refresh", RefreshHandler(sessionService, cfg))
+	router.POST("/auth/register", RegisterHandler(userService, radiusService))
+	router.POST("/auth/login", LoginHandler(userService, sessionService, radiusService, cfg))
+	router.POST("/auth/refresh", callbackGuardHandlers.Protect("token_refresh"), RefreshHandler(sessionService, emergencyService, cfg))
 	router.POST("/auth/logout", LogoutHandler(sessionService))
+	router.POST("/auth/reactivation-requests", staleAccountHandlers.RequestReactivation)
+	router.GET("/auth/negotiate", kerberosHandlers.Negotiate(), kerberosHandlers.Login)
+	router.GET("/auth/impersonation", middleware.AuthenticationMiddleware(), impersonationHandlers.GetCurrentImpersonation)
+	router.POST("/auth/impersonation/end", middleware.AuthenticationMiddleware(), impersonationHandlers.EndCurrentImpersonation)
 
-	// API info endpoint
+	// API info endpoint, and the OpenAPI document of the routes open to third-party clients
 	router.GET("/api/info", APIInfoHandler)
+	router.GET("/openapi.json", openAPIHandlers.Spec)
+
+	// Routes third-party clients may call with an access token granted the API scope; their
+	// tokens are refused everywhere else
+	scoped := func(group *gin.RouterGroup, method, path, scope string, handlers ...gin.HandlerFunc) {
+		middleware.RequireScope(method, group.BasePath()+path, scope)
+		group.Handle(method, path, handlers...)
+	}
 
 	// Dashboard endpoints (protected)
 	dashboardGroup := router.Group("/dashboard")
@@ -64,15 +552,41 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		userGroup.POST("/email/verify", userHandlers.SendEmailVerification)
 		userGroup.GET("/email/verify", userHandlers.VerifyEmail)
 		userGroup.GET("/audit-logs", userHandlers.GetAuditLogs)
-		userGroup.GET("/sessions", userHandlers.GetSessions)
-		userGroup.DELETE("/sessions/:token", userHandlers.InvalidateSession)
-		userGroup.DELETE("/sessions", userHandlers.InvalidateAllSessions)
-		userGroup.DELETE("/account", userHandlers.DeactivateAccount)
+		userGroup.GET("/roles", rbacHandlers.GetMyRoles)
+		userGroup.GET("/devices/posture", devicePostureHandlers.GetMyDevices)
+		// Users review their active sessions and sign out of any but the current one
+		userGroup.GET("/sessions", sessionHandlers.ListMySessions)
+		userGroup.POST("/sessions/heartbeat", sessionHandlers.Heartbeat)
+		userGroup.DELETE("/sessions/:id", middleware.BlockDuringImpersonation(), sessionHandlers.RevokeMySession)
+		userGroup.DELETE("/sessions", middleware.BlockDuringImpersonation(), sessionHandlers.RevokeMyOtherSessions)
+		userGroup.DELETE("/account", middleware.BlockDuringImpersonation(), userHandlers.DeactivateAccount)
+		userGroup.GET("/consents", consentHandlers.ListConsents)
+		userGroup.POST("/data-export", middleware.BlockDuringImpersonation(), jobHandlers.RequestMyDataExport)
+		userGroup.DELETE("/consents/:appId", middleware.BlockDuringImpersonation(), consentHandlers.RevokeConsent)
+
+		// Users consent to, refuse or end impersonation of themselves, never an impersonator
+		userGroup.GET("/impersonations", impersonationHandlers.ListMyImpersonations)
+		userGroup.POST("/impersonations/:id/approve", middleware.BlockDuringImpersonation(), impersonationHandlers.ApproveImpersonation)
+		userGroup.POST("/impersonations/:id/deny", middleware.BlockDuringImpersonation(), impersonationHandlers.DenyImpersonation)
+		userGroup.POST("/impersonations/:id/end", middleware.BlockDuringImpersonation(), impersonationHandlers.EndImpersonation)
+
+		// Security center: users review and act on their own sign-ins, sessions and connected apps
+		userGroup.GET("/security-center", securityCenterHandlers.GetOverview)
+		userGroup.DELETE("/security-center/sessions/:id", middleware.BlockDuringImpersonation(), securityCenterHandlers.RevokeSession)
+		userGroup.DELETE("/security-center/apps/:appId", middleware.BlockDuringImpersonation(), securityCenterHandlers.DisconnectApp)
+		userGroup.GET("/security-center/login-history", loginHistoryHandlers.GetMyLoginHistory)
+
+		// "This wasn't me": disputing a login revokes it and walks the user through securing the account
+		userGroup.POST("/security-center/logins/:id/report", middleware.BlockDuringImpersonation(), loginDisputeHandlers.ReportLogin)
+		userGroup.GET("/security-center/disputes", loginDisputeHandlers.ListMyDisputes)
+		userGroup.GET("/security-center/disputes/:id", loginDisputeHandlers.GetMyDispute)
+		userGroup.POST("/security-center/disputes/:id/password", middleware.BlockDuringImpersonation(), loginDisputeHandlers.ResetPassword)
+		userGroup.POST("/security-center/disputes/:id/mfa", middleware.BlockDuringImpersonation(), loginDisputeHandlers.VerifyMFA)
 	}
 
 	// User settings endpoints
 	userSettingsGroup := router.Group("/user/settings")
-	userSettingsGroup.Use(middleware.AuthenticationMiddleware())
+	userSettingsGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityMedium))
 	{
 		userSettingsGroup.GET("", settingsHandlers.GetUserSettings)
 		userSettingsGroup.PUT("", settingsHandlers.UpdateUserSettings)
@@ -82,14 +596,15 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 
 	// MFA endpoints
 	mfaGroup := router.Group("/user/mfa")
-	mfaGroup.Use(middleware.AuthenticationMiddleware())
+	mfaGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation())
 	{
 		mfaGroup.GET("/status", GetMFAStatusHandler)
 		mfaGroup.POST("/setup", SetupMFAHandler)
 		mfaGroup.POST("/verify-setup", VerifyMFASetupHandler)
 		mfaGroup.POST("/verify", VerifyMFAHandler)
-		mfaGroup.POST("/disable", DisableMFAHandler)
-		mfaGroup.POST("/backup-codes/regenerate", RegenerateBackupCodesHandler)
+		// Step-up endpoints stay reachable for risky sessions; disabling MFA does not
+		mfaGroup.POST("/disable", adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityHigh), DisableMFAHandler)
+		mfaGroup.POST("/backup-codes/regenerate", middleware.RequireAAL(models.AAL2), RegenerateBackupCodesHandler)
 	}
 
 	// OAuth Monitoring endpoints
@@ -97,10 +612,11 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	monitoringGroup.Use(middleware.AuthenticationMiddleware())
 	{
 		// Connection monitoring
-		monitoringGroup.GET("/connections", GetConnectionsHandler)
-		monitoringGroup.GET("/connections/stats", GetConnectionStatsHandler)
-		monitoringGroup.POST("/connections/:connectionId/test", TestConnectionHandler)
-		monitoringGroup.POST("/connections/usage", RecordUsageHandler)
+		scoped(monitoringGroup, http.MethodGet, "/connections", services.APIScopeConnectionsManage, GetConnectionsHandler)
+		scoped(monitoringGroup, http.MethodGet, "/connections/stats", services.APIScopeConnectionsManage, GetConnectionStatsHandler)
+		scoped(monitoringGroup, http.MethodPost, "/connections/:connectionId/test", services.APIScopeConnectionsManage, TestConnectionHandler)
+		scoped(monitoringGroup, http.MethodPost, "/connections/usage", services.APIScopeConnectionsManage, RecordUsageHandler)
+		scoped(monitoringGroup, http.MethodPost, "/connections/outcomes", services.APIScopeConnectionsManage, RecordCallOutcomeHandler)
 
 		// Security events
 		monitoringGroup.GET("/security/events", GetSecurityEventsHandler)
@@ -108,77 +624,516 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 
 		// Device management
 		monitoringGroup.GET("/devices", GetTrustedDevicesHandler)
-		monitoringGroup.POST("/devices", RegisterDeviceHandler)
-		monitoringGroup.PUT("/devices/:deviceId/trust", TrustDeviceHandler)
-		monitoringGroup.DELETE("/devices/:deviceId", RevokeDeviceHandler)
+		monitoringGroup.POST("/devices", middleware.BlockDuringImpersonation(), RegisterDeviceHandler)
+		monitoringGroup.PUT("/devices/:deviceId/trust", middleware.BlockDuringImpersonation(), TrustDeviceHandler)
+		monitoringGroup.DELETE("/devices/:deviceId", middleware.BlockDuringImpersonation(), RevokeDeviceHandler)
 	}
 
 	// SaaS Applications endpoints (protected)
 	appsGroup := router.Group("/apps")
-	appsGroup.Use(middleware.AuthenticationMiddleware())
+	appsGroup.Use(middleware.AuthenticationMiddleware(), loginDisputeHandlers.RequireDisputeRemediation())
 	{
 		appsGroup.GET("", GetAppsHandler)
 		appsGroup.POST("/connect", ConnectAppHandler)
 		appsGroup.POST("/launch", LaunchAppHandler)
-		appsGroup.GET("/callback", OAuthCallbackHandler)
+		appsGroup.GET("/:appId/consent", consentHandlers.GetConsentScreen)
+		appsGroup.POST("/:appId/consent", consentHandlers.GrantConsent)
+		appsGroup.POST("/:appId/access-override", accessScheduleHandlers.RequestOverride)
+
+		// Saved credentials for bookmark apps are never shown to an impersonator
+		appsGroup.GET("/:appId/credentials", bookmarkHandlers.GetCredentials)
+		appsGroup.PUT("/:appId/credentials", middleware.BlockDuringImpersonation(), bookmarkHandlers.SaveCredentials)
+		appsGroup.DELETE("/:appId/credentials", middleware.BlockDuringImpersonation(), bookmarkHandlers.DeleteCredentials)
+		appsGroup.GET("/:appId/autofill", middleware.BlockDuringImpersonation(), bookmarkHandlers.Autofill)
+	}
+
+	// Browser extension companion endpoints; an impersonator's browser reports nothing
+	extensionGroup := router.Group("/extension")
+	extensionGroup.Use(middleware.AuthenticationMiddleware())
+	{
+		extensionGroup.GET("/session", extensionHandlers.Session)
+		extensionGroup.GET("/apps", extensionHandlers.Apps)
+		extensionGroup.POST("/domains", middleware.BlockDuringImpersonation(), extensionHandlers.ReportDomains)
+		extensionGroup.POST("/events", middleware.BlockDuringImpersonation(), extensionHandlers.ReportEvents)
 	}
 
 	// OAuth endpoints for real SaaS integrations (protected for user context)
 	oauthGroup := router.Group("/oauth")
 	oauthGroup.Use(middleware.AuthenticationMiddleware())
 	{
-		// Google OAuth (OAuth 2.0)
-		oauthGroup.GET("/google/connect", GoogleOAuthInitHandler)
-		oauthGroup.GET("/google/callback", GoogleOAuthCallbackHandler)
+		// OAuth 2.0 providers from the registry, built in or configured
+		for _, provider := range oauthProviders.Providers() {
+			name, appID := provider.Config().Name, provider.Config().AppID
+			oauthGroup.GET("/"+name+"/connect", consentHandlers.RequireConsent(appID), accessScheduleHandlers.RequireAccessSchedule(appID), oauthProviderHandlers.Connect(name))
+		}
 
-		// Microsoft OAuth (OAuth 2.0)
-		oauthGroup.GET("/microsoft/connect", MicrosoftOAuthInitHandler)
-		oauthGroup.GET("/microsoft/callback", MicrosoftOAuthCallbackHandler)
+		// Trello OAuth (OAuth 1.0a)
+		oauthGroup.GET("/trello/connect", consentHandlers.RequireConsent("trello"), accessScheduleHandlers.RequireAccessSchedule("trello"), TrelloOAuthInitHandler)
+	}
 
-		// Slack OAuth (OAuth 2.0)
-		oauthGroup.GET("/slack/connect", SlackOAuthInitHandler)
-		oauthGroup.GET("/slack/callback", SlackOAuthCallbackHandler)
+	// Provider callbacks are redirects that may not carry the sign-in token, so they are
+	// not behind authentication; the state issued at connect identifies the user
+	router.GET("/apps/callback", callbackGuardHandlers.Protect("apps_callback"), OAuthCallbackHandler)
+	callbackGroup := router.Group("/oauth")
+	{
+		for _, provider := range oauthProviders.Providers() {
+			name := provider.Config().Name
+			callbackGroup.GET("/"+name+"/callback", callbackGuardHandlers.Protect(name+"_callback"), oauthProviderHandlers.Callback(name))
+		}
+		callbackGroup.GET("/trello/callback", callbackGuardHandlers.Protect("trello_callback"), TrelloOAuthCallbackHandler)
+	}
 
-		// GitHub OAuth (OAuth 2.0)
-		oauthGroup.GET("/github/connect", GitHubOAuthInitHandler)
-		oauthGroup.GET("/github/callback", GitHubOAuthCallbackHandler)
+	// Slack app slash commands and alert buttons, authenticated by Slack's request signature
+	slackGroup := router.Group("/integrations/slack")
+	slackGroup.Use(slackHandlers.VerifySignature())
+	{
+		slackGroup.POST("/commands", slackHandlers.Command)
+		slackGroup.POST("/interactions", slackHandlers.Interaction)
+	}
 
-		// Trello OAuth (OAuth 1.0a)
-		oauthGroup.GET("/trello/connect", TrelloOAuthInitHandler)
-		oauthGroup.GET("/trello/callback", TrelloOAuthCallbackHandler)
+	// One-click acknowledge and escalate links from alert emails, authorized by their signature
+	router.GET("/alerts/:alert_id/email-action", callbackGuardHandlers.Protect("alert_email_link"), alertEmailHandlers.ConfirmAction)
+	router.POST("/alerts/:alert_id/email-action", callbackGuardHandlers.Protect("alert_email_link"), alertEmailHandlers.ApplyAction)
+
+	// Webhook consumers test their signature implementation against their current keys;
+	// the route is unauthenticated, so RATE_LIMIT_ROUTES limits it per client IP by default
+	router.POST("/webhooks/consumers/:consumerId/verify", webhookConsumerHandlers.VerifySignature)
+
+	// Identity provider risk signals, authenticated by Google's token signature and the
+	// Graph subscription's client state
+	idpRiskGroup := router.Group("/integrations/idp-risk")
+	{
+		idpRiskGroup.POST("/google", idpRiskHandlers.GoogleEvent)
+		idpRiskGroup.POST("/microsoft", idpRiskHandlers.MicrosoftNotification)
+	}
+
+	// Keycloak events pushed by an event listener, authenticated by a shared bearer secret
+	router.POST("/integrations/keycloak/events", keycloakEventHandlers.Webhook)
+
+	// Device posture pushed by MDMs, authenticated by a shared bearer secret
+	mdmGroup := router.Group("/integrations/mdm")
+	{
+		mdmGroup.POST("/intune", devicePostureHandlers.IntuneWebhook)
+		mdmGroup.POST("/jamf", devicePostureHandlers.JamfWebhook)
+	}
+
+	// Signed download URLs when uploads are kept on local disk instead of GCS
+	router.GET("/files/*key", fileUploadHandlers.ServeLocalFile)
+
+	// Signing keys for SAML and WS-Federation assertions and OIDC tokens, published for
+	// relying parties
+	router.GET("/.well-known/jwks.json", signingKeyHandlers.JWKS)
+	router.GET("/.well-known/openid-configuration", oidcHandlers.Discovery)
+	router.GET("/saml/metadata", SAMLMetadataHandler)
+
+	// SAML identity provider endpoint, taking AuthnRequests over the HTTP-Redirect and
+	// HTTP-POST bindings from registered service providers
+	samlSSOGroup := router.Group("/saml/sso")
+	samlSSOGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation())
+	{
+		samlSSOGroup.GET("", samlSSOHandlers.SingleSignOn)
+		samlSSOGroup.POST("", samlSSOHandlers.SingleSignOn)
+	}
+
+	// OpenID Connect provider for registered clients. Only the authorization endpoint needs
+	// a signed-in user; the token endpoint authenticates clients and userinfo takes the
+	// access token it issued.
+	oauth2Group := router.Group("/oauth2")
+	{
+		oauth2Group.GET("/authorize", middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), oidcHandlers.Authorize)
+		oauth2Group.POST("/authorize", middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), oidcHandlers.Authorize)
+		oauth2Group.POST("/token", oidcHandlers.Token)
+		oauth2Group.GET("/userinfo", oidcHandlers.UserInfo)
+		oauth2Group.POST("/userinfo", oidcHandlers.UserInfo)
+	}
+
+	// WS-Federation passive requestor endpoint for legacy relying parties, which find the
+	// signing certificate in the public federation metadata
+	router.GET("/wsfed/FederationMetadata/2007-06/FederationMetadata.xml", wsfedHandlers.FederationMetadata)
+	wsfedGroup := router.Group("/wsfed")
+	wsfedGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation())
+	{
+		wsfedGroup.GET("", wsfedHandlers.PassiveSignIn)
+	}
 
-		// Salesforce OAuth (OAuth 2.0)
-		oauthGroup.GET("/salesforce/connect", SalesforceOAuthInitHandler)
-		oauthGroup.GET("/salesforce/callback", SalesforceOAuthCallbackHandler)
+	// Event ingestion for internal services, authenticated by client certificate
+	internalGroup := router.Group("/internal")
+	{
+		internalGroup.POST("/events/login", serviceAccountHandlers.RequireServiceAccount(services.ServiceScopeLoginEvents), securityMonitoringHandlers.ProcessLoginEvent)
+		internalGroup.POST("/events/api", serviceAccountHandlers.RequireServiceAccount(services.ServiceScopeAPIEvents), securityMonitoringHandlers.ProcessAPIEvent)
+		internalGroup.POST("/events/security", serviceAccountHandlers.RequireServiceAccount(services.ServiceScopeSecurityEvents), securityMonitoringHandlers.ProcessSecurityEvent)
+		internalGroup.POST("/devices/posture", serviceAccountHandlers.RequireServiceAccount(services.ServiceScopeDevicePosture), devicePostureHandlers.ReportPosture)
+	}
+
+	// Header-injection proxy for internal apps that trust identity headers. OPTIONS is left
+	// to the global CORS handler.
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"} {
+		router.Handle(method, "/proxy/:appId/*path", middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), headerProxyHandlers.Proxy)
 	}
 
 	// Adaptive Authentication endpoints
 	adaptiveAuthGroup := router.Group("/api/v1/adaptive-auth")
-	adaptiveAuthGroup.Use(middleware.AuthenticationMiddleware())
+	adaptiveAuthGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityHigh))
 	{
 		adaptiveAuthGroup.POST("/evaluate", adaptiveAuthHandlers.EvaluateAuthentication)
-		adaptiveAuthGroup.GET("/history/:userId", adaptiveAuthHandlers.GetRiskAssessmentHistory)
-		adaptiveAuthGroup.GET("/latest/:userId", adaptiveAuthHandlers.GetLatestRiskAssessment)
-		adaptiveAuthGroup.PUT("/thresholds", adaptiveAuthHandlers.UpdateRiskThresholds)
+		adaptiveAuthGroup.GET("/history/:userId", middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst), adaptiveAuthHandlers.GetRiskAssessmentHistory)
+		adaptiveAuthGroup.GET("/latest/:userId", middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst), adaptiveAuthHandlers.GetLatestRiskAssessment)
+		adaptiveAuthGroup.PUT("/thresholds", middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst), adaptiveAuthHandlers.UpdateRiskThresholds)
 		adaptiveAuthGroup.POST("/register-device", adaptiveAuthHandlers.RegisterDeviceFingerprint)
 		adaptiveAuthGroup.GET("/device-status", adaptiveAuthHandlers.CheckDeviceStatus)
 	}
 
 	// WebAuthn endpoints (protected)
 	webauthnGroup := router.Group("/webauthn")
-	webauthnGroup.Use(middleware.AuthenticationMiddleware())
+	webauthnGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation())
 	{
 		webauthnGroup.GET("/credentials", GetWebAuthnCredentialsHandler)
-		webauthnGroup.DELETE("/credentials/:credential_id", DeleteWebAuthnCredentialHandler)
+		webauthnGroup.DELETE("/credentials/:credential_id", middleware.RequireAAL(models.AAL2), DeleteWebAuthnCredentialHandler)
+
+		// Step-up authentication (raises the session to AAL3)
+		webauthnGroup.POST("/authenticate/begin", WebAuthnAuthenticationBeginHandler)
+		webauthnGroup.POST("/authenticate/finish", WebAuthnAuthenticationFinishHandler)
 	}
 
+	// Dashboards stream alerts in real time, guarded like the security API
+	router.GET("/ws/security/alerts", middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(),
+		middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityHigh),
+		alertStreamHandlers.StreamAlerts)
+
 	// Security monitoring endpoints (protected)
 	securityGroup := router.Group("/api/v1/security")
-	securityGroup.Use(middleware.AuthenticationMiddleware())
+	securityGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityHigh), privilegeReviewHandlers.AuditPrivilegedRequests(), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
 	{
 		// Map to implemented handlers
-		securityGroup.POST("/alerts/generate", securityMonitoringHandlers.GenerateAlert)
-		securityGroup.GET("/alerts", securityMonitoringHandlers.GetAlerts)
+		scoped(securityGroup, http.MethodPost, "/alerts/generate", services.APIScopeAlertsWrite, securityMonitoringHandlers.GenerateAlert)
+		scoped(securityGroup, http.MethodGet, "/alerts", services.APIScopeAlertsRead, securityMonitoringHandlers.GetAlerts)
+		scoped(securityGroup, http.MethodGet, "/alerts/queue", services.APIScopeAlertsRead, securityMonitoringHandlers.GetAlertQueue)
+		scoped(securityGroup, http.MethodGet, "/alerts/:alert_id", services.APIScopeAlertsRead, securityMonitoringHandlers.GetAlert)
+		securityGroup.GET("/actions", securityMonitoringHandlers.GetSecurityActions)
+		scoped(securityGroup, http.MethodPut, "/alerts/:alert_id/status", services.APIScopeAlertsWrite, securityMonitoringHandlers.UpdateAlertStatus)
 		securityGroup.GET("/metrics", securityMonitoringHandlers.GetSecurityMetrics)
+		scoped(securityGroup, http.MethodGet, "/incidents", services.APIScopeIncidentsRead, securityMonitoringHandlers.GetIncidents)
+		// Fields, operators and sorts of the lists that take ?filter= expressions
+		securityGroup.GET("/filters", GetFilterSchemas)
+		securityGroup.GET("/correlation/rules", securityMonitoringHandlers.GetCorrelationRules)
+		securityGroup.PUT("/correlation/rules", securityMonitoringHandlers.UpdateCorrelationRules)
+		securityGroup.GET("/event-schemas", securityMonitoringHandlers.GetEventSchemas)
+
+		// The caller's phones and browsers that receive critical alerts as push notifications
+		securityGroup.GET("/push-devices", pushHandlers.ListDevices)
+		securityGroup.POST("/push-devices", pushHandlers.RegisterDevice)
+		securityGroup.DELETE("/push-devices/:id", pushHandlers.RemoveDevice)
+
+		securityGroup.GET("/integrations/health", integrationHealthHandlers.GetIntegrationHealth)
+
+		// Detection rules and bulk import of rules with response policies, kept in git
+		securityGroup.GET("/rules", ruleImportHandlers.ListRules)
+		securityGroup.POST("/rules/import", middleware.RequireAAL(models.AAL2), ruleImportHandlers.ImportRules)
+
+		// Response playbooks
+		securityGroup.GET("/playbooks", playbookHandlers.ListPlaybooks)
+		securityGroup.POST("/playbooks", playbookHandlers.CreatePlaybook)
+		securityGroup.PUT("/playbooks/:id", playbookHandlers.UpdatePlaybook)
+		securityGroup.DELETE("/playbooks/:id", playbookHandlers.DeletePlaybook)
+		scoped(securityGroup, http.MethodGet, "/alerts/:alert_id/playbook-executions", services.APIScopeAlertsRead, playbookHandlers.GetAlertPlaybookExecutions)
+
+		// Saved detection queries over the audit log, run on a schedule
+		// Evidence, compliance report and bulk import files, downloaded through signed URLs
+		securityGroup.POST("/uploads", fileUploadHandlers.UploadFile)
+		securityGroup.GET("/uploads/:id", fileUploadHandlers.GetUpload)
+		securityGroup.GET("/uploads/:id/download", fileUploadHandlers.GetDownloadURL)
+		securityGroup.DELETE("/uploads/:id", fileUploadHandlers.DeleteUpload)
+
+		securityGroup.GET("/detection-queries", detectionQueryHandlers.ListQueries)
+		securityGroup.POST("/detection-queries", detectionQueryHandlers.CreateQuery)
+		securityGroup.GET("/detection-queries/:id", detectionQueryHandlers.GetQuery)
+		securityGroup.PUT("/detection-queries/:id", detectionQueryHandlers.UpdateQuery)
+		securityGroup.DELETE("/detection-queries/:id", detectionQueryHandlers.DeleteQuery)
+		securityGroup.POST("/detection-queries/:id/run", detectionQueryHandlers.RunQuery)
+		securityGroup.GET("/detection-queries/:id/runs", detectionQueryHandlers.ListRuns)
+		securityGroup.POST("/playbook-executions/:id/decision", middleware.RequireAAL(models.AAL2), playbookHandlers.DecidePlaybookExecution)
+
+		// Tenant security posture scores and their trend
+		securityGroup.GET("/posture", postureScoreHandlers.ListScores)
+		securityGroup.GET("/posture/:tenant", postureScoreHandlers.GetScore)
+		securityGroup.GET("/posture/:tenant/history", postureScoreHandlers.GetHistory)
+	}
+
+	// Usage analytics cover the whole organization, so only admins and security analysts
+	// read them (protected)
+	analyticsGroup := router.Group("/api/v1/analytics")
+	analyticsGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
+	{
+		analyticsGroup.GET("/apps", analyticsHandlers.GetAppUsage)
+		analyticsGroup.GET("/apps/daily", analyticsHandlers.GetDailyAppUsage)
+		analyticsGroup.GET("/sso", analyticsHandlers.GetSSOActivity)
+	}
+
+	// License utilization endpoints (protected); only admins change seat allocations or
+	// start provider syncs
+	licenseGroup := router.Group("/api/v1/licenses")
+	licenseGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(),
+		adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityMedium), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
+	{
+		licenseGroup.GET("/report", licenseHandlers.GetUtilizationReport)
+		licenseGroup.PUT("/:appId", middleware.RequireRole(models.RoleAdmin), licenseHandlers.SetAllocation)
+		licenseGroup.POST("/sync", middleware.RequireRole(models.RoleAdmin), licenseHandlers.SyncLicenses)
+	}
+
+	// Watchlist endpoints (protected)
+	watchlistGroup := router.Group("/api/v1/watchlist")
+	watchlistGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityCritical), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
+	{
+		watchlistGroup.GET("", watchlistHandlers.ListWatchlist)
+		watchlistGroup.POST("", watchlistHandlers.AddToWatchlist)
+		watchlistGroup.DELETE("/:userId", watchlistHandlers.RemoveFromWatchlist)
+		watchlistGroup.GET("/:userId/timeline", watchlistHandlers.GetWatchlistTimeline)
+	}
+
+	// Background report and export jobs requested by the caller (protected)
+	jobsGroup := router.Group("/api/v1/jobs")
+	jobsGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation())
+	{
+		jobsGroup.GET("", jobHandlers.ListMyJobs)
+		jobsGroup.GET("/:id", jobHandlers.GetMyJob)
+		jobsGroup.GET("/:id/logs", jobHandlers.GetMyJobLogs)
+		jobsGroup.GET("/:id/result", jobHandlers.GetMyJobResult)
+		jobsGroup.POST("/:id/cancel", jobHandlers.CancelMyJob)
+	}
+
+	// Admin investigation endpoints (protected)
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityCritical), privilegeReviewHandlers.AuditPrivilegedRequests(), middleware.RequireRole(models.RoleAdmin))
+	{
+		adminGroup.GET("/users/:id/timeline", timelineHandlers.GetUserTimeline)
+		adminGroup.GET("/users/:id/login-history", loginHistoryHandlers.GetUserLoginHistory)
+		adminGroup.GET("/users/:id/sessions", sessionHandlers.ListUserSessions)
+		adminGroup.DELETE("/users/:id/sessions", middleware.RequireAAL(models.AAL2), sessionHandlers.RevokeUserSessions)
+		adminGroup.DELETE("/users/:id/sessions/:sessionId", middleware.RequireAAL(models.AAL2), sessionHandlers.RevokeUserSession)
+		adminGroup.DELETE("/users/:id/lock", middleware.RequireAAL(models.AAL2), securityMonitoringHandlers.UnlockAccount)
+		adminGroup.POST("/users/:id/data-export", middleware.RequireAAL(models.AAL2), jobHandlers.RequestUserDataExport)
+		adminGroup.GET("/entity-graph/:type/:value", entityGraphHandlers.GetEntityGraph)
+		adminGroup.GET("/canary-keys", canaryKeyHandlers.ListCanaryKeys)
+		adminGroup.POST("/canary-keys", middleware.RequireAAL(models.AAL2), canaryKeyHandlers.CreateCanaryKey)
+		adminGroup.GET("/canary-keys/:id/hits", canaryKeyHandlers.GetCanaryKeyHits)
+		adminGroup.DELETE("/canary-keys/:id", middleware.RequireAAL(models.AAL2), canaryKeyHandlers.DeleteCanaryKey)
+		adminGroup.GET("/idp-risk-signals", idpRiskHandlers.ListSignals)
+		adminGroup.POST("/idp-risk-signals/microsoft/sync", idpRiskHandlers.SyncMicrosoft)
+		adminGroup.POST("/keycloak-events/sync", keycloakEventHandlers.Sync)
+		adminGroup.GET("/devices/posture", devicePostureHandlers.ListPostures)
+		adminGroup.GET("/step-up-blocks", stepUpFatigueHandlers.ListBlocks)
+		adminGroup.DELETE("/step-up-blocks/:userId", middleware.RequireAAL(models.AAL2), stepUpFatigueHandlers.Unblock)
+		adminGroup.GET("/dormant-accounts", staleAccountHandlers.ListDormantAccounts)
+		adminGroup.POST("/dormant-accounts/scan", staleAccountHandlers.ScanDormantAccounts)
+		adminGroup.POST("/dormant-accounts/:userId/reactivate", middleware.RequireAAL(models.AAL2), staleAccountHandlers.Reactivate)
+		adminGroup.GET("/roles", rbacHandlers.ListAssignments)
+		adminGroup.PUT("/users/:id/roles/:role", middleware.RequireAAL(models.AAL2), rbacHandlers.AssignRole)
+		adminGroup.DELETE("/users/:id/roles/:role", middleware.RequireAAL(models.AAL2), rbacHandlers.RevokeRole)
+		adminGroup.GET("/privilege-review", privilegeReviewHandlers.GetReport)
+		adminGroup.POST("/privilege-reviews", privilegeReviewHandlers.StartReport)
+		adminGroup.GET("/slack/analysts", slackHandlers.ListAnalysts)
+		adminGroup.PUT("/slack/analysts", middleware.RequireAAL(models.AAL2), slackHandlers.LinkAnalyst)
+		adminGroup.DELETE("/slack/analysts/:team_id/:slack_user_id", middleware.RequireAAL(models.AAL2), slackHandlers.UnlinkAnalyst)
+		adminGroup.GET("/callback-blocks", callbackGuardHandlers.ListBlocks)
+		adminGroup.DELETE("/callback-blocks/:id", middleware.RequireAAL(models.AAL2), callbackGuardHandlers.Unblock)
+		adminGroup.GET("/ip-reputation", ipReputationHandlers.ListReputations)
+		adminGroup.GET("/ip-reputation/:ip", ipReputationHandlers.GetReputation)
+		adminGroup.PUT("/ip-reputation/:ip/override", middleware.RequireAAL(models.AAL2), ipReputationHandlers.SetOverride)
+		adminGroup.DELETE("/ip-reputation/:ip/override", middleware.RequireAAL(models.AAL2), ipReputationHandlers.ClearOverride)
+		adminGroup.GET("/login-disputes", loginDisputeHandlers.ListDisputes)
+		adminGroup.GET("/login-disputes/:id", loginDisputeHandlers.GetDispute)
+		adminGroup.POST("/login-disputes/:id/resolve", loginDisputeHandlers.ResolveDispute)
+
+		// Phishing-resistant (WebAuthn-only) step-up enforcement for designated groups
+		adminGroup.GET("/phishing-resistant/policies", phishingResistantHandlers.ListPolicies)
+		adminGroup.PUT("/phishing-resistant/policies/:tenant/:group", middleware.RequireAAL(models.AAL2), phishingResistantHandlers.SetPolicy)
+		adminGroup.DELETE("/phishing-resistant/policies/:tenant/:group", middleware.RequireAAL(models.AAL2), phishingResistantHandlers.DeletePolicy)
+		adminGroup.GET("/phishing-resistant/report", phishingResistantHandlers.GetReport)
+
+		// Per-app access schedules and override review
+		adminGroup.GET("/apps/schedules", accessScheduleHandlers.ListSchedules)
+		adminGroup.GET("/apps/:appId/schedule", accessScheduleHandlers.GetSchedule)
+		adminGroup.PUT("/apps/:appId/schedule", middleware.RequireAAL(models.AAL2), accessScheduleHandlers.SetSchedule)
+		adminGroup.DELETE("/apps/:appId/schedule", middleware.RequireAAL(models.AAL2), accessScheduleHandlers.DeleteSchedule)
+		adminGroup.GET("/access-overrides", accessScheduleHandlers.ListOverrides)
+		adminGroup.POST("/access-overrides/:id/approve", middleware.RequireAAL(models.AAL2), accessScheduleHandlers.ApproveOverride)
+		adminGroup.POST("/access-overrides/:id/deny", middleware.RequireAAL(models.AAL2), accessScheduleHandlers.DenyOverride)
+
+		// Per-app session policies: maximum age, idle timeout, re-authentication and assurance levels
+		adminGroup.GET("/apps/session-policies", appSessionPolicyHandlers.ListPolicies)
+		adminGroup.GET("/apps/:appId/session-policy", appSessionPolicyHandlers.GetPolicy)
+		adminGroup.PUT("/apps/:appId/session-policy", middleware.RequireAAL(models.AAL2), appSessionPolicyHandlers.SetPolicy)
+		adminGroup.DELETE("/apps/:appId/session-policy", middleware.RequireAAL(models.AAL2), appSessionPolicyHandlers.DeletePolicy)
+		adminGroup.GET("/apps/saml-idps", samlIdPHandlers.ListConfigs)
+		adminGroup.GET("/apps/:appId/saml-idp", samlIdPHandlers.GetConfig)
+		adminGroup.PUT("/apps/:appId/saml-idp", middleware.RequireAAL(models.AAL2), samlIdPHandlers.SetConfig)
+		adminGroup.DELETE("/apps/:appId/saml-idp", middleware.RequireAAL(models.AAL2), samlIdPHandlers.DeleteConfig)
+		adminGroup.GET("/apps/saml-relying-parties", samlSSOHandlers.ListRelyingParties)
+		adminGroup.GET("/apps/:appId/saml-relying-party", samlSSOHandlers.GetRelyingParty)
+		adminGroup.PUT("/apps/:appId/saml-relying-party", middleware.RequireAAL(models.AAL2), samlSSOHandlers.SetRelyingParty)
+		adminGroup.DELETE("/apps/:appId/saml-relying-party", middleware.RequireAAL(models.AAL2), samlSSOHandlers.DeleteRelyingParty)
+		adminGroup.GET("/oidc-clients", oidcHandlers.ListClients)
+		adminGroup.POST("/oidc-clients", middleware.RequireAAL(models.AAL2), oidcHandlers.CreateClient)
+		adminGroup.GET("/oidc-clients/:clientId", oidcHandlers.GetClient)
+		adminGroup.PUT("/oidc-clients/:clientId", middleware.RequireAAL(models.AAL2), oidcHandlers.UpdateClient)
+		adminGroup.DELETE("/oidc-clients/:clientId", middleware.RequireAAL(models.AAL2), oidcHandlers.DeleteClient)
+		adminGroup.POST("/oidc-clients/:clientId/secret", middleware.RequireAAL(models.AAL2), oidcHandlers.RotateSecret)
+
+		// Header proxy upstreams, user assignments and request logs
+		adminGroup.GET("/apps/proxies", headerProxyHandlers.ListApps)
+		adminGroup.GET("/apps/:appId/proxy", headerProxyHandlers.GetApp)
+		adminGroup.PUT("/apps/:appId/proxy", middleware.RequireAAL(models.AAL2), headerProxyHandlers.SetApp)
+		adminGroup.DELETE("/apps/:appId/proxy", middleware.RequireAAL(models.AAL2), headerProxyHandlers.DeleteApp)
+		adminGroup.GET("/apps/:appId/proxy/assignments", headerProxyHandlers.ListAssignments)
+		adminGroup.PUT("/apps/:appId/proxy/assignments/:userId", middleware.RequireAAL(models.AAL2), headerProxyHandlers.SetAssignment)
+		adminGroup.DELETE("/apps/:appId/proxy/assignments/:userId", middleware.RequireAAL(models.AAL2), headerProxyHandlers.DeleteAssignment)
+		adminGroup.GET("/apps/:appId/proxy/requests", headerProxyHandlers.ListRequestLogs)
+
+		// Bookmark apps for applications without SSO
+		adminGroup.GET("/apps/bookmarks", bookmarkHandlers.ListApps)
+		adminGroup.POST("/apps/bookmarks", middleware.RequireAAL(models.AAL2), bookmarkHandlers.CreateApp)
+		adminGroup.PUT("/apps/bookmarks/:appId", middleware.RequireAAL(models.AAL2), bookmarkHandlers.UpdateApp)
+		adminGroup.DELETE("/apps/bookmarks/:appId", middleware.RequireAAL(models.AAL2), bookmarkHandlers.DeleteApp)
+
+		// Disaster recovery mode; not behind step-up, which needs a writable database
+		adminGroup.GET("/dr-mode", disasterRecoveryHandlers.GetStatus)
+		adminGroup.POST("/dr-mode", disasterRecoveryHandlers.SetMode)
+		adminGroup.POST("/dr-mode/replay", disasterRecoveryHandlers.ReplayQueue)
+
+		// Data residency regions
+		adminGroup.GET("/residency/regions", residencyHandlers.ListRegions)
+		adminGroup.GET("/residency/tenants/:tenant", residencyHandlers.GetTenantRegion)
+
+		// Hypothetical sign-ins show the adaptive auth decision without recording anything
+		adminGroup.POST("/auth/simulate", adaptiveAuthHandlers.SimulateAuthentication)
+
+		// Configuration snapshots for backup and promotion between environments
+		adminGroup.GET("/config/export", configBackupHandlers.ExportConfig)
+		adminGroup.POST("/config/restore", middleware.RequireAAL(models.AAL2), configBackupHandlers.RestoreConfig)
+		adminGroup.GET("/config/versions", configDriftHandlers.ListVersions)
+		adminGroup.GET("/config/versions/:id", configDriftHandlers.GetVersion)
+		adminGroup.POST("/config/versions/:id/rollback", middleware.RequireAAL(models.AAL2), configDriftHandlers.RollbackVersion)
+		adminGroup.GET("/config/drift", configDriftHandlers.GetDriftStatus)
+
+		// Signing key rotation
+		adminGroup.GET("/signing-keys", signingKeyHandlers.ListKeys)
+		adminGroup.POST("/signing-keys/rotate", middleware.RequireAAL(models.AAL2), signingKeyHandlers.RotateKey)
+		adminGroup.POST("/signing-keys/:kid/revoke", middleware.RequireAAL(models.AAL2), signingKeyHandlers.RevokeKey)
+
+		// Service accounts for client-certificate callers
+		adminGroup.GET("/service-accounts", serviceAccountHandlers.ListAccounts)
+		adminGroup.POST("/service-accounts", middleware.RequireAAL(models.AAL2), serviceAccountHandlers.CreateAccount)
+		adminGroup.PUT("/service-accounts/:id", middleware.RequireAAL(models.AAL2), serviceAccountHandlers.UpdateAccount)
+		adminGroup.DELETE("/service-accounts/:id", middleware.RequireAAL(models.AAL2), serviceAccountHandlers.DeleteAccount)
+
+		// Shadow IT discovery report and review
+		adminGroup.GET("/shadow-it", shadowITHandlers.GetReport)
+		adminGroup.POST("/shadow-it/scan", shadowITHandlers.Scan)
+		adminGroup.GET("/shadow-it/:id/grants", shadowITHandlers.GetGrants)
+		adminGroup.PUT("/shadow-it/:id/status", shadowITHandlers.ReviewApp)
+
+		// Emergency global sign-out
+		adminGroup.POST("/emergency/signout", middleware.RequireAAL(models.AAL2), emergencyHandlers.TriggerSignout)
+		adminGroup.GET("/emergency/lockdowns", emergencyHandlers.ListLockdowns)
+		adminGroup.POST("/emergency/lockdowns/:id/lift", emergencyHandlers.LiftLockdown)
+
+		// Provider client secret rotation
+		adminGroup.GET("/providers/:provider/secrets", providerSecretHandlers.ListSecrets)
+		adminGroup.POST("/providers/:provider/secrets/rotate", middleware.RequireAAL(models.AAL2), providerSecretHandlers.RotateSecret)
+
+		// Background jobs of every user
+		adminGroup.GET("/jobs", jobHandlers.ListJobs)
+		adminGroup.GET("/jobs/:id", jobHandlers.GetJob)
+		adminGroup.GET("/jobs/:id/logs", jobHandlers.GetJobLogs)
+		adminGroup.GET("/jobs/:id/result", jobHandlers.GetJobResult)
+		adminGroup.POST("/jobs/:id/cancel", jobHandlers.CancelJob)
+
+		// Outbound webhook dead letters
+		adminGroup.GET("/webhooks/dead-letters", webhookHandlers.ListDeadLetters)
+		adminGroup.POST("/webhooks/dead-letters/replay", webhookHandlers.ReplayDeadLetters)
+		adminGroup.GET("/webhooks/dead-letters/:id", webhookHandlers.GetDeadLetter)
+		adminGroup.POST("/webhooks/dead-letters/:id/replay", webhookHandlers.ReplayDeadLetter)
+		adminGroup.DELETE("/webhooks/dead-letters/:id", webhookHandlers.DiscardDeadLetter)
+
+		// Outbound webhook consumers and their signing keys
+		adminGroup.GET("/webhooks/consumers", webhookConsumerHandlers.ListConsumers)
+		adminGroup.POST("/webhooks/consumers", middleware.RequireAAL(models.AAL2), webhookConsumerHandlers.CreateConsumer)
+		adminGroup.GET("/webhooks/consumers/:consumerId", webhookConsumerHandlers.GetConsumer)
+		adminGroup.PUT("/webhooks/consumers/:consumerId", middleware.RequireAAL(models.AAL2), webhookConsumerHandlers.UpdateConsumer)
+		adminGroup.DELETE("/webhooks/consumers/:consumerId", middleware.RequireAAL(models.AAL2), webhookConsumerHandlers.DeleteConsumer)
+		adminGroup.POST("/webhooks/consumers/:consumerId/keys", middleware.RequireAAL(models.AAL2), webhookConsumerHandlers.RotateKey)
+		adminGroup.DELETE("/webhooks/consumers/:consumerId/keys/:keyId", middleware.RequireAAL(models.AAL2), webhookConsumerHandlers.RevokeKey)
+
+		// Support impersonation ("login as user")
+		adminGroup.GET("/impersonations", impersonationHandlers.ListImpersonations)
+		adminGroup.POST("/impersonations", middleware.RequireAAL(models.AAL2), impersonationHandlers.RequestImpersonation)
+		adminGroup.POST("/impersonations/:id/start", middleware.RequireAAL(models.AAL2), impersonationHandlers.StartImpersonation)
+		adminGroup.POST("/impersonations/:id/end", impersonationHandlers.EndImpersonation)
+
+		// Runtime profiles, for the login risk scoring hot path among others
+		adminGroup.GET("/debug/pprof/*profile", ServeProfile)
+	}
+
+	// Audit logs, exports and compliance reports, also open to security analysts (protected)
+	auditGroup := router.Group("/admin/audit")
+	auditGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityCritical), privilegeReviewHandlers.AuditPrivilegedRequests(), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
+	{
+		// Audit exports with signed chain-of-custody manifests
+		auditGroup.POST("/exports", auditExportHandlers.CreateExport)
+		scoped(auditGroup, http.MethodGet, "/exports", services.APIScopeAuditRead, auditExportHandlers.ListExports)
+		scoped(auditGroup, http.MethodGet, "/exports/public-key", services.APIScopeAuditRead, auditExportHandlers.GetPublicKey)
+		auditGroup.POST("/exports/verify", auditExportHandlers.VerifyExport)
+		scoped(auditGroup, http.MethodGet, "/exports/:id/manifest", services.APIScopeAuditRead, auditExportHandlers.GetManifest)
+		scoped(auditGroup, http.MethodGet, "/exports/:id/download", services.APIScopeAuditRead, auditExportHandlers.DownloadExport)
+
+		// Bulk CSV and JSON Lines exports to the object store, on demand and on a schedule
+		auditGroup.POST("/file-exports", auditExportHandlers.CreateFileExport)
+		scoped(auditGroup, http.MethodGet, "/file-exports", services.APIScopeAuditRead, auditExportHandlers.ListFileExports)
+		scoped(auditGroup, http.MethodGet, "/file-exports/:id", services.APIScopeAuditRead, auditExportHandlers.GetFileExport)
+		scoped(auditGroup, http.MethodGet, "/file-exports/:id/download", services.APIScopeAuditRead, auditExportHandlers.GetFileExportDownloadURL)
+		auditGroup.GET("/export-schedules", auditExportHandlers.ListExportSchedules)
+		auditGroup.POST("/export-schedules", auditExportHandlers.CreateExportSchedule)
+		auditGroup.GET("/export-schedules/:id", auditExportHandlers.GetExportSchedule)
+		auditGroup.PUT("/export-schedules/:id", auditExportHandlers.UpdateExportSchedule)
+		auditGroup.DELETE("/export-schedules/:id", auditExportHandlers.DeleteExportSchedule)
+
+		// Audit log browsing and NDJSON streaming
+		scoped(auditGroup, http.MethodGet, "/logs", services.APIScopeAuditRead, auditExportHandlers.ListAuditLogs)
+		scoped(auditGroup, http.MethodGet, "/logs/stream", services.APIScopeAuditRead, auditExportHandlers.StreamAuditLogs)
+
+		// Audit statistics and compliance reports, with query cost guardrails
+		scoped(auditGroup, http.MethodGet, "/statistics", services.APIScopeAuditRead, auditReportHandlers.GetStatistics)
+		auditGroup.POST("/reports", auditReportHandlers.GenerateComplianceReport)
+		auditGroup.GET("/report-jobs/:id", auditReportHandlers.GetReportJob)
+		auditGroup.GET("/query-metrics", auditReportHandlers.GetQueryMetrics)
+		auditGroup.GET("/volume", auditReportHandlers.GetVolumeBaselines)
+	}
+
+	// Admin notification inbox (protected)
+	notificationGroup := router.Group("/api/v1/notifications")
+	notificationGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
+	{
+		notificationGroup.GET("", notificationInboxHandlers.ListNotifications)
+		notificationGroup.GET("/unread-count", notificationInboxHandlers.GetUnreadCount)
+		notificationGroup.POST("/:id/read", notificationInboxHandlers.MarkRead)
+		notificationGroup.POST("/read-all", notificationInboxHandlers.MarkAllRead)
+	}
+
+	// Investigation case endpoints (protected)
+	caseGroup := router.Group("/api/v1/cases")
+	caseGroup.Use(middleware.AuthenticationMiddleware(), middleware.BlockDuringImpersonation(), adaptiveAuthHandlers.RequireRouteRisk(services.RouteSensitivityHigh), privilegeReviewHandlers.AuditPrivilegedRequests(), middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst))
+	{
+		scoped(caseGroup, http.MethodGet, "", services.APIScopeIncidentsRead, caseHandlers.ListCases)
+		scoped(caseGroup, http.MethodPost, "", services.APIScopeIncidentsWrite, caseHandlers.CreateCase)
+		caseGroup.GET("/tasks/mine", caseHandlers.GetMyTasks)
+		scoped(caseGroup, http.MethodGet, "/:id", services.APIScopeIncidentsRead, caseHandlers.GetCase)
+		scoped(caseGroup, http.MethodPatch, "/:id", services.APIScopeIncidentsWrite, caseHandlers.UpdateCase)
+		scoped(caseGroup, http.MethodPost, "/:id/links", services.APIScopeIncidentsWrite, caseHandlers.LinkToCase)
+		scoped(caseGroup, http.MethodDelete, "/:id/links/:linkId", services.APIScopeIncidentsWrite, caseHandlers.UnlinkFromCase)
+		scoped(caseGroup, http.MethodPost, "/:id/notes", services.APIScopeIncidentsWrite, caseHandlers.AddNote)
+		scoped(caseGroup, http.MethodPost, "/:id/evidence", services.APIScopeIncidentsWrite, caseHandlers.AddEvidence)
+		caseGroup.POST("/:id/evidence/upload", fileUploadHandlers.UploadCaseEvidence)
+		caseGroup.POST("/:id/tasks", caseHandlers.AddTask)
+		caseGroup.PATCH("/:id/tasks/:taskId", caseHandlers.UpdateTask)
 	}
 }
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ruleImportMaxBody bounds rule bundles
+const ruleImportMaxBody = 5 << 20
+
+// RuleImportHandlers contains detection rule listing and bulk rule and policy import handlers
+type RuleImportHandlers struct {
+	importer *services.RuleImportService
+	security *services.SecurityMonitoringService
+}
+
+// NewRuleImportHandlers creates new rule import handlers
+func NewRuleImportHandlers(importer *services.RuleImportService, security *services.SecurityMonitoringService) *RuleImportHandlers {
+	return &RuleImportHandlers{importer: importer, security: security}
+}
+
+// ListRules returns the detection rules
+func (h *RuleImportHandlers) ListRules(c *gin.Context) {
+	rules := h.security.GetSecurityRules()
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "count": len(rules)})
+}
+
+// ImportRules validates a bundle of detection rules and response policies, sent as JSON,
+// or as YAML or CSV by content type, and applies it when every item is valid. With
+// ?dry_run=true it only returns the validation report.
+func (h *RuleImportHandlers) ImportRules(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, ruleImportMaxBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+	format := services.RuleBundleJSON
+	switch contentType := c.ContentType(); {
+	case strings.Contains(contentType, "csv"):
+		format = services.RuleBundleCSV
+	case strings.Contains(contentType, "yaml"):
+		format = services.RuleBundleYAML
+	}
+
+	bundle, err := services.ParseRuleBundle(body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule bundle", "message": err.Error()})
+		return
+	}
+
+	report, err := h.importer.Import(bundle, c.Query("dry_run") == "true", getAnalystID(c), time.Now())
+	switch {
+	case err != nil:
+		// Policies are applied in one transaction, so a failure leaves them unchanged
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Rule bundle could not be applied; no changes were made", "message": err.Error()})
+	case !report.Valid:
+		c.JSON(http.StatusUnprocessableEntity, report)
+	default:
+		c.JSON(http.StatusOK, report)
+	}
+}
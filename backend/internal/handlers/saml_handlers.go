@@ -1,16 +1,20 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
-	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 	"cloudgate-backend/pkg/constants"
 )
@@ -32,115 +36,15 @@ type SAMLIssuer struct {
 	Value   string   `xml:",chardata"`
 }
 
-// SAML Response structure
-type SAMLResponse struct {
-	XMLName      xml.Name      `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
-	ID           string        `xml:"ID,attr"`
-	Version      string        `xml:"Version,attr"`
-	IssueInstant string        `xml:"IssueInstant,attr"`
-	Destination  string        `xml:"Destination,attr"`
-	InResponseTo string        `xml:"InResponseTo,attr"`
-	Issuer       SAMLIssuer    `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
-	Status       SAMLStatus    `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
-	Assertion    SAMLAssertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
-}
-
-type SAMLStatus struct {
-	XMLName    xml.Name       `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
-	StatusCode SAMLStatusCode `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
-}
-
-type SAMLStatusCode struct {
-	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
-	Value   string   `xml:"Value,attr"`
-}
-
-type SAMLAssertion struct {
-	XMLName            xml.Name               `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
-	ID                 string                 `xml:"ID,attr"`
-	Version            string                 `xml:"Version,attr"`
-	IssueInstant       string                 `xml:"IssueInstant,attr"`
-	Issuer             SAMLIssuer             `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
-	Subject            SAMLSubject            `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
-	Conditions         SAMLConditions         `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
-	AttributeStatement SAMLAttributeStatement `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
-	AuthnStatement     SAMLAuthnStatement     `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
-}
-
-type SAMLSubject struct {
-	XMLName             xml.Name                `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
-	NameID              SAMLNameID              `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
-	SubjectConfirmation SAMLSubjectConfirmation `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
-}
+// samlServiceProvider validates responses from apps' identity providers. It is set by
+// SetupRoutes.
+var samlServiceProvider *services.SAMLServiceProvider
 
-type SAMLNameID struct {
-	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
-	Format  string   `xml:"Format,attr"`
-	Value   string   `xml:",chardata"`
-}
-
-type SAMLSubjectConfirmation struct {
-	XMLName                 xml.Name                    `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
-	Method                  string                      `xml:"Method,attr"`
-	SubjectConfirmationData SAMLSubjectConfirmationData `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
-}
-
-type SAMLSubjectConfirmationData struct {
-	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
-	NotOnOrAfter string   `xml:"NotOnOrAfter,attr"`
-	Recipient    string   `xml:"Recipient,attr"`
-	InResponseTo string   `xml:"InResponseTo,attr"`
-}
-
-type SAMLConditions struct {
-	XMLName             xml.Name                `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
-	NotBefore           string                  `xml:"NotBefore,attr"`
-	NotOnOrAfter        string                  `xml:"NotOnOrAfter,attr"`
-	AudienceRestriction SAMLAudienceRestriction `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
-}
-
-type SAMLAudienceRestriction struct {
-	XMLName  xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
-	Audience SAMLAudience `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
-}
-
-type SAMLAudience struct {
-	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
-	Value   string   `xml:",chardata"`
-}
-
-type SAMLAttributeStatement struct {
-	XMLName    xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
-	Attributes []SAMLAttribute `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
-}
-
-type SAMLAttribute struct {
-	XMLName        xml.Name           `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
-	Name           string             `xml:"Name,attr"`
-	AttributeValue SAMLAttributeValue `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
-}
-
-type SAMLAttributeValue struct {
-	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
-	Type    string   `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
-	Value   string   `xml:",chardata"`
-}
-
-type SAMLAuthnStatement struct {
-	XMLName      xml.Name         `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
-	AuthnInstant string           `xml:"AuthnInstant,attr"`
-	SessionIndex string           `xml:"SessionIndex,attr"`
-	AuthnContext SAMLAuthnContext `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContext"`
-}
-
-type SAMLAuthnContext struct {
-	XMLName              xml.Name                 `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContext"`
-	AuthnContextClassRef SAMLAuthnContextClassRef `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContextClassRef"`
-}
-
-type SAMLAuthnContextClassRef struct {
-	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContextClassRef"`
-	Value   string   `xml:",chardata"`
+func activeSAMLServiceProvider() *services.SAMLServiceProvider {
+	if samlServiceProvider == nil {
+		samlServiceProvider = services.NewSAMLServiceProvider(services.GetDB())
+	}
+	return samlServiceProvider
 }
 
 // SAMLInitHandler initiates SAML SSO for legacy applications
@@ -168,6 +72,18 @@ func SAMLInitHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Application does not support SAML"})
 		return
 	}
+	if _, ok := checkAppSessionPolicy(c, services.NewAppSessionPolicyService(services.GetDB()), app); !ok {
+		return
+	}
+
+	// Apps with an imported IdP sign in at its SSO URL; others keep the catalog's
+	sp := activeSAMLServiceProvider()
+	ssoURL := app.Config["sso_url"]
+	if idp, err := sp.GetConfig(appID); err == nil && idp.SSOURL != "" {
+		ssoURL = idp.SSOURL
+	} else if err != nil && !errors.Is(err, services.ErrSAMLIdPNotConfigured) {
+		log.Printf("Error loading SAML identity provider: %v", err)
+	}
 
 	// Generate SAML request
 	requestID := generateSAMLID()
@@ -177,11 +93,11 @@ func SAMLInitHandler(c *gin.Context) {
 		ID:                          requestID,
 		Version:                     "2.0",
 		IssueInstant:                issueInstant,
-		Destination:                 app.Config["sso_url"],
+		Destination:                 ssoURL,
 		ProtocolBinding:             "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST",
-		AssertionConsumerServiceURL: fmt.Sprintf("%s/saml/%s/acs", getEnv("NEXT_PUBLIC_API_URL", "http://localhost:8081"), appID),
+		AssertionConsumerServiceURL: sp.ACSURL(appID),
 		Issuer: SAMLIssuer{
-			Value: "CloudGate-SSO",
+			Value: sp.EntityID(),
 		},
 	}
 
@@ -193,12 +109,15 @@ func SAMLInitHandler(c *gin.Context) {
 		return
 	}
 
-	// Store request for validation (in production, use Redis)
-	// For demo, we'll skip this step
+	// The RelayState comes back with the response and identifies the user it is for; it is
+	// bound to the request ID so it only redeems the response to this request
+	relayState, ok := issueOAuthState(c, samlStatePurpose(appID, requestID))
+	if !ok {
+		return
+	}
 
 	// Create HTML form for auto-submission
-	samlRequestB64 := encodeBase64(xmlData)
-	relayState := generateSAMLID()
+	samlRequestB64 := base64.StdEncoding.EncodeToString(xmlData)
 
 	htmlForm := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -217,7 +136,7 @@ func SAMLInitHandler(c *gin.Context) {
     </form>
     <p>Redirecting to %s...</p>
 </body>
-</html>`, app.Config["sso_url"], samlRequestB64, relayState, app.Name)
+</html>`, html.EscapeString(ssoURL), samlRequestB64, html.EscapeString(relayState), html.EscapeString(app.Name))
 
 	c.Header("Content-Type", "text/html")
 	c.String(http.StatusOK, htmlForm)
@@ -233,7 +152,7 @@ func SAMLACSHandler(c *gin.Context) {
 
 	// Get SAML response from form data
 	samlResponse := c.PostForm("SAMLResponse")
-	_ = c.PostForm("RelayState") // RelayState for future use
+	relayState := c.PostForm("RelayState")
 
 	if samlResponse == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "SAML response is required"})
@@ -241,36 +160,58 @@ func SAMLACSHandler(c *gin.Context) {
 	}
 
 	// Decode base64 SAML response
-	xmlData, err := decodeBase64(samlResponse)
+	xmlData, err := decodeSAMLMessage(samlResponse)
 	if err != nil {
 		log.Printf("Error decoding SAML response: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SAML response"})
 		return
 	}
 
-	// Parse SAML response
-	var response SAMLResponse
-	if err := xml.Unmarshal(xmlData, &response); err != nil {
-		log.Printf("Error parsing SAML response: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SAML response format"})
+	// Only responses signed by the app's identity provider and addressed to this ACS are accepted
+	assertion, err := activeSAMLServiceProvider().ValidateResponse(appID, xmlData)
+	switch {
+	case errors.Is(err, services.ErrSAMLIdPNotConfigured):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SAML sign-in is not set up for this application"})
+		return
+	case errors.Is(err, services.ErrSAMLAuthnFailed):
+		log.Printf("SAML authentication failed for %s: %v", appID, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SAML authentication failed"})
+		return
+	case err != nil:
+		log.Printf("Rejected SAML response for %s: %v", appID, err)
+		services.LogAuditEvent(c.Request.Context(), "", "saml_response_rejected", "app", appID, c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid SAML response"})
 		return
 	}
 
-	// Validate SAML response
-	if response.Status.StatusCode.Value != "urn:oasis:names:tc:SAML:2.0:status:Success" {
-		log.Printf("SAML authentication failed: %s", response.Status.StatusCode.Value)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "SAML authentication failed"})
+	// SP-initiated responses carry the RelayState issued to the user for the request they
+	// answer; IdP-initiated ones only fall back to the demo user in development
+	var userID string
+	switch {
+	case relayState != "":
+		boundTo, ok := checkOAuthState(c, samlStatePurpose(appID, assertion.InResponseTo), relayState)
+		if !ok {
+			return
+		}
+		userID = boundTo.String()
+	case services.DemoUserFallback():
+		userID = constants.DemoUserID
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SAML response must be for a sign-in started from CloudGate"})
 		return
 	}
 
-	// Extract user information from assertion
-	userEmail := response.Assertion.Subject.NameID.Value
-	userID := constants.DemoUserID // In production, map from SAML attributes
+	// Reject assertions outside their validity window or seen before
+	if err := activeReplayGuard().CheckSAMLAssertion(assertion.Issuer, assertion.ID, assertion.NotBefore, assertion.NotOnOrAfter, tokenSource(c, appID), time.Now()); err != nil {
+		rejectAssertion(c, appID, err)
+		return
+	}
+	userEmail := assertion.NameID
 
 	// Create or update app connection
 	services.CreateUserAppConnection(userID, appID)
 	err = services.UpdateUserAppConnection(userID, appID, map[string]interface{}{
-		"status":       constants.StatusConnected,
+		"status":       models.ConnectionConnected,
 		"user_email":   userEmail,
 		"connected_at": time.Now().UTC().Format(time.RFC3339),
 	})
@@ -282,12 +223,10 @@ func SAMLACSHandler(c *gin.Context) {
 	}
 
 	// Log SAML authentication
-	services.LogAuditEvent(userID, "saml_authentication", "app", appID, c.ClientIP(), c.GetHeader("User-Agent"), fmt.Sprintf("SAML authentication successful for %s", appID), "success")
+	services.LogAuditEvent(c.Request.Context(), userID, "saml_authentication", "app", appID, c.ClientIP(), c.GetHeader("User-Agent"), fmt.Sprintf("SAML authentication successful for %s", appID), "success")
 
 	// Redirect to frontend with success
-	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
-	redirectURL := fmt.Sprintf("%s/oauth/callback?provider=%s&email=%s&code=success", frontendURL, appID, url.QueryEscape(userEmail))
-	c.Redirect(http.StatusFound, redirectURL)
+	redirectToFrontend(c, appID, userEmail)
 }
 
 // SAMLMetadataHandler provides SAML metadata for CloudGate as IdP
@@ -297,37 +236,59 @@ func SAMLMetadataHandler(c *gin.Context) {
 
 	metadata := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"
-                     entityID="CloudGate-SSO">
+                     entityID="%s">
     <md:IDPSSODescriptor WantAuthnRequestsSigned="false"
                          protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
-        <md:KeyDescriptor use="signing">
-            <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
-                <ds:X509Data>
-                    <ds:X509Certificate><!-- Certificate would go here --></ds:X509Certificate>
-                </ds:X509Data>
-            </ds:KeyInfo>
-        </md:KeyDescriptor>
-        <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
+%s        <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
         <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
                                Location="%s/saml/sso"/>
         <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
                                Location="%s/saml/sso"/>
     </md:IDPSSODescriptor>
-</md:EntityDescriptor>`, baseURL, baseURL)
+</md:EntityDescriptor>`, html.EscapeString(activeSAMLIssuer().EntityID()), samlKeyDescriptors(), baseURL, baseURL)
 
 	c.Header("Content-Type", "application/xml; charset=utf-8")
 	c.String(http.StatusOK, metadata)
 }
 
+// samlKeyDescriptors lists every published signing certificate, so service providers
+// already trust the next key when a rotation switches to it
+func samlKeyDescriptors() string {
+	if signingKeys == nil {
+		return ""
+	}
+	certificates, err := signingKeys.Certificates()
+	if err != nil {
+		log.Printf("Error loading signing certificates: %v", err)
+		return ""
+	}
+
+	var descriptors strings.Builder
+	for _, certificate := range certificates {
+		fmt.Fprintf(&descriptors, `        <md:KeyDescriptor use="signing">
+            <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+                <ds:X509Data>
+                    <ds:X509Certificate>%s</ds:X509Certificate>
+                </ds:X509Data>
+            </ds:KeyInfo>
+        </md:KeyDescriptor>
+`, certificate)
+	}
+	return descriptors.String()
+}
+
 // Helper functions
 func generateSAMLID() string {
 	return "_" + uuid.New().String()
 }
 
-func encodeBase64(data []byte) string {
-	return fmt.Sprintf("%s", data) // Simplified for demo - should use proper base64 encoding
+// samlStatePurpose binds a RelayState to the app and the AuthnRequest it was issued with
+func samlStatePurpose(appID, requestID string) string {
+	return "saml:" + appID + ":" + requestID
 }
 
-func decodeBase64(data string) ([]byte, error) {
-	return []byte(data), nil // Simplified for demo - should use proper base64 decoding
+// decodeSAMLMessage decodes an HTTP-POST binding message, which identity providers often
+// wrap across lines
+func decodeSAMLMessage(data string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
 }
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SAMLIdPHandlers contains the admin HTTP handlers for apps' SAML identity providers
+type SAMLIdPHandlers struct {
+	sp *services.SAMLServiceProvider
+}
+
+// NewSAMLIdPHandlers creates new SAML identity provider handlers
+func NewSAMLIdPHandlers(sp *services.SAMLServiceProvider) *SAMLIdPHandlers {
+	return &SAMLIdPHandlers{sp: sp}
+}
+
+// ListConfigs returns the identity providers of all SAML apps
+func (h *SAMLIdPHandlers) ListConfigs(c *gin.Context) {
+	configs, err := h.sp.ListConfigs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list SAML identity providers", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identity_providers": configs, "count": len(configs), "sp_entity_id": h.sp.EntityID()})
+}
+
+// GetConfig returns an app's identity provider and the values to register CloudGate with it
+func (h *SAMLIdPHandlers) GetConfig(c *gin.Context) {
+	appID := c.Param("appId")
+	config, err := h.sp.GetConfig(appID)
+	if errors.Is(err, services.ErrSAMLIdPNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No SAML identity provider for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get SAML identity provider", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identity_provider": config, "sp_entity_id": h.sp.EntityID(), "acs_url": h.sp.ACSURL(appID)})
+}
+
+// SetConfig imports an app's identity provider from metadata or explicit settings
+func (h *SAMLIdPHandlers) SetConfig(c *gin.Context) {
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req services.SAMLIdPInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	config, err := h.sp.SetConfig(appID, req, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidSAMLIdP) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SAML identity provider", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save SAML identity provider", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identity_provider": config, "sp_entity_id": h.sp.EntityID(), "acs_url": h.sp.ACSURL(appID)})
+}
+
+// DeleteConfig removes an app's identity provider, refusing its SAML responses from then on
+func (h *SAMLIdPHandlers) DeleteConfig(c *gin.Context) {
+	err := h.sp.DeleteConfig(c.Param("appId"), getAnalystID(c))
+	if errors.Is(err, services.ErrSAMLIdPNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No SAML identity provider for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete SAML identity provider", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SAML identity provider removed"})
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// samlIssuer answers service providers that sign in with CloudGate as their SAML identity
+// provider. It is set by SetupRoutes.
+var samlIssuer *services.SAMLIssuerService
+
+func activeSAMLIssuer() *services.SAMLIssuerService {
+	if samlIssuer == nil {
+		samlIssuer = services.NewSAMLIssuerService(services.GetDB())
+	}
+	return samlIssuer
+}
+
+// SAMLSSOHandlers contains the SAML identity provider handlers
+type SAMLSSOHandlers struct {
+	issuer          *services.SAMLIssuerService
+	consentService  *services.ConsentService
+	scheduleService *services.AccessScheduleService
+	policyService   *services.AppSessionPolicyService
+}
+
+// NewSAMLSSOHandlers creates new SAML identity provider handlers
+func NewSAMLSSOHandlers(issuer *services.SAMLIssuerService, consentService *services.ConsentService, scheduleService *services.AccessScheduleService, policyService *services.AppSessionPolicyService) *SAMLSSOHandlers {
+	return &SAMLSSOHandlers{
+		issuer:          issuer,
+		consentService:  consentService,
+		scheduleService: scheduleService,
+		policyService:   policyService,
+	}
+}
+
+// SingleSignOn answers a service provider's AuthnRequest, received over the HTTP-Redirect
+// (GET) or HTTP-POST binding, with a signed response for the signed-in user, posted to the
+// provider's registered ACS URL by the browser
+func (h *SAMLSSOHandlers) SingleSignOn(c *gin.Context) {
+	encoded, relayState := c.Query("SAMLRequest"), c.Query("RelayState")
+	deflated := true
+	if c.Request.Method == http.MethodPost {
+		encoded, relayState = c.PostForm("SAMLRequest"), c.PostForm("RelayState")
+		deflated = false
+	}
+	if encoded == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SAMLRequest is required"})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	request, err := h.issuer.ParseAuthnRequest(encoded, deflated)
+	switch {
+	case errors.Is(err, services.ErrSAMLRelyingPartyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service provider not found", "message": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidAuthnRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SAML request", "message": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error reading SAML request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read SAML request"})
+		return
+	}
+	app, exists := services.GetSaaSApp(request.RelyingParty.AppID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	// Apps may demand a stronger session than a password login provides
+	if app.RequiredAAL > c.GetInt("aal") {
+		middleware.ChallengeStepUp(c, gin.H{
+			"message":      fmt.Sprintf("%s requires a stronger authentication method", app.Name),
+			"current_aal":  c.GetInt("aal"),
+			"required_aal": app.RequiredAAL,
+		})
+		return
+	}
+	if !checkConsent(c, h.consentService, userUUID, app.ID) || !checkAccessSchedule(c, h.scheduleService, userUUID, app.ID) {
+		return
+	}
+	sessionEnds, ok := checkAppSessionPolicy(c, h.policyService, app)
+	if !ok {
+		return
+	}
+
+	subject := services.SAMLSubject{UserID: userUUID, AAL: c.GetInt("aal"), NotOnOrAfter: sessionEnds}
+	if value, ok := c.Get("sessionID"); ok {
+		if sessionID, ok := value.(uuid.UUID); ok {
+			subject.SessionIndex = "_" + sessionID.String()
+		}
+	}
+	response, err := h.issuer.IssueResponse(request, subject, time.Now())
+	if err != nil {
+		services.LogAuditEvent(c.Request.Context(), userID, "saml_sign_in", "app", app.ID, c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+		if errors.Is(err, services.ErrInvalidAuthnRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SAML request", "message": err.Error()})
+			return
+		}
+		log.Printf("Error issuing SAML response for %s: %v", app.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue SAML response"})
+		return
+	}
+
+	analyticsService := services.NewAnalyticsService(services.GetDB())
+	if err := analyticsService.RecordAppLaunch(userUUID, app.ID, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+		log.Printf("Error recording app launch: %v", err)
+	}
+	services.LogAuditEvent(c.Request.Context(), userID, "saml_sign_in", "app", app.ID, c.ClientIP(), c.GetHeader("User-Agent"),
+		fmt.Sprintf("SAML assertion %s issued for %s", response.AssertionID, app.ID), "success")
+
+	htmlForm := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>CloudGate SAML SSO</title>
+</head>
+<body onload="document.forms[0].submit()">
+    <form method="post" action="%s">
+        <input type="hidden" name="SAMLResponse" value="%s" />
+        <input type="hidden" name="RelayState" value="%s" />
+        <noscript>
+            <p>Your browser does not support JavaScript. Please click the button below to continue.</p>
+            <input type="submit" value="Continue" />
+        </noscript>
+    </form>
+    <p>Redirecting to %s...</p>
+</body>
+</html>`, html.EscapeString(response.ACSURL), response.SAMLResponse, html.EscapeString(relayState), html.EscapeString(app.Name))
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, htmlForm)
+}
+
+// ListRelyingParties returns every service provider registered with CloudGate's IdP
+func (h *SAMLSSOHandlers) ListRelyingParties(c *gin.Context) {
+	parties, err := h.issuer.ListRelyingParties()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list SAML relying parties", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"relying_parties": parties, "count": len(parties), "idp_entity_id": h.issuer.EntityID()})
+}
+
+// GetRelyingParty returns the service provider registered for an app
+func (h *SAMLSSOHandlers) GetRelyingParty(c *gin.Context) {
+	party, err := h.issuer.GetRelyingParty(c.Param("appId"))
+	if errors.Is(err, services.ErrSAMLRelyingPartyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No SAML relying party for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get SAML relying party", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"relying_party": party})
+}
+
+// SetRelyingParty registers an app's service provider and the attributes sent to it
+func (h *SAMLSSOHandlers) SetRelyingParty(c *gin.Context) {
+	appID := c.Param("appId")
+	if _, ok := services.GetSaaSApp(appID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found"})
+		return
+	}
+
+	var req services.SAMLRelyingPartyInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	party, err := h.issuer.SetRelyingParty(appID, req, getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidSAMLRelyingParty) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SAML relying party", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save SAML relying party", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"relying_party": party})
+}
+
+// DeleteRelyingParty stops answering an app's service provider
+func (h *SAMLSSOHandlers) DeleteRelyingParty(c *gin.Context) {
+	err := h.issuer.DeleteRelyingParty(c.Param("appId"), getAnalystID(c))
+	if errors.Is(err, services.ErrSAMLRelyingPartyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No SAML relying party for this app"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete SAML relying party", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SAML relying party removed"})
+}
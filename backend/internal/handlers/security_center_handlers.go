@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SecurityCenterHandlers contains the user-facing security center HTTP handlers
+type SecurityCenterHandlers struct {
+	securityCenterService *services.SecurityCenterService
+}
+
+// NewSecurityCenterHandlers creates new security center handlers
+func NewSecurityCenterHandlers(securityCenterService *services.SecurityCenterService) *SecurityCenterHandlers {
+	return &SecurityCenterHandlers{
+		securityCenterService: securityCenterService,
+	}
+}
+
+// describeLocation formats where an IP address is for display
+func describeLocation(ipAddress string) string {
+	location := performGeolocation(context.Background(), ipAddress)
+	if location.Country == "Unknown" {
+		return "Unknown location"
+	}
+	if location.City == location.Country {
+		return location.City
+	}
+	return location.City + ", " + location.Country
+}
+
+// GetOverview returns the user's sign-ins, sessions, connected apps, devices and MFA status
+func (h *SecurityCenterHandlers) GetOverview(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	overview, err := h.securityCenterService.Overview(*userID, currentSessionID(c), time.Now())
+	if err != nil {
+		log.Printf("Error getting security center overview: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get security overview"})
+		return
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
+
+// RevokeSession signs the user out of one of their sessions
+func (h *SecurityCenterHandlers) RevokeSession(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.securityCenterService.RevokeSession(*userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		log.Printf("Error revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// DisconnectApp revokes the user's connection to an app
+func (h *SecurityCenterHandlers) DisconnectApp(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.securityCenterService.DisconnectApp(*userID, c.Param("appId")); err != nil {
+		if errors.Is(err, services.ErrAppNotConnected) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "App not connected"})
+			return
+		}
+		log.Printf("Error disconnecting app: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect app"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "App disconnected successfully"})
+}
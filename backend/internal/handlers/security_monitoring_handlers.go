@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,12 +17,18 @@ import (
 // SecurityMonitoringHandlers contains handlers for security monitoring
 type SecurityMonitoringHandlers struct {
 	securityService *services.SecurityMonitoringService
+	webhookService  *services.WebhookService
+	alertLinks      *services.AlertEmailLinks
+	eventSchemas    *services.EventSchemaRegistry
 }
 
 // NewSecurityMonitoringHandlers creates new security monitoring handlers
-func NewSecurityMonitoringHandlers(service *services.SecurityMonitoringService) *SecurityMonitoringHandlers {
+func NewSecurityMonitoringHandlers(service *services.SecurityMonitoringService, webhookService *services.WebhookService, alertLinks *services.AlertEmailLinks) *SecurityMonitoringHandlers {
 	return &SecurityMonitoringHandlers{
 		securityService: service,
+		webhookService:  webhookService,
+		alertLinks:      alertLinks,
+		eventSchemas:    services.NewEventSchemaRegistry(),
 	}
 }
 
@@ -50,6 +59,7 @@ type AlertResponse struct {
 	ResolvedAt  *time.Time             `json:"resolved_at,omitempty"`
 	Actions     []ActionResponse       `json:"actions"`
 	Tags        []string               `json:"tags"`
+	Priority    services.AlertPriority `json:"priority"`
 }
 
 // ActionResponse represents a security action in API responses
@@ -112,24 +122,38 @@ type UpdateAlertStatusRequest struct {
 	AssignedTo *string `json:"assigned_to,omitempty"`
 }
 
-// LoginEventRequest represents a login event for monitoring
+// LoginEventRequest represents a login event for monitoring, in the current schema version.
+// Event requests are validated by the event schema registry rather than binding tags.
 type LoginEventRequest struct {
-	UserID    string  `json:"user_id" binding:"required"`
-	Email     string  `json:"email" binding:"required"`
-	IPAddress string  `json:"ip_address" binding:"required"`
-	UserAgent string  `json:"user_agent" binding:"required"`
-	Success   bool    `json:"success"`
+	UserID    string  `json:"user_id"`
+	Email     string  `json:"email"`
+	IPAddress string  `json:"ip_address"`
+	UserAgent string  `json:"user_agent"`
+	Outcome   string  `json:"outcome"`
 	RiskScore float64 `json:"risk_score"`
 }
 
-// APIEventRequest represents an API event for monitoring
+// APIEventRequest represents an API event for monitoring, in the current schema version
 type APIEventRequest struct {
-	Endpoint     string `json:"endpoint" binding:"required"`
-	Method       string `json:"method" binding:"required"`
-	IPAddress    string `json:"ip_address" binding:"required"`
-	UserAgent    string `json:"user_agent" binding:"required"`
-	StatusCode   int    `json:"status_code" binding:"required"`
-	ResponseTime int64  `json:"response_time_ms" binding:"required"`
+	Endpoint     string `json:"endpoint"`
+	Method       string `json:"method"`
+	IPAddress    string `json:"ip_address"`
+	UserAgent    string `json:"user_agent"`
+	StatusCode   int    `json:"status_code"`
+	ResponseTime int64  `json:"response_time_ms"`
+}
+
+// SecurityEventRequest represents a detection reported by another system, in the current
+// schema version
+type SecurityEventRequest struct {
+	EventType   string            `json:"event_type"`
+	Severity    string            `json:"severity"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	UserID      string            `json:"user_id"`
+	IPAddress   string            `json:"ip_address"`
+	Attributes  map[string]string `json:"attributes"`
+	OccurredAt  time.Time         `json:"occurred_at"`
 }
 
 // AlertChannelRequest represents a request to configure an alert channel
@@ -216,23 +240,15 @@ func (h *SecurityMonitoringHandlers) GetAlerts(c *gin.Context) {
 		}
 	}
 
-	// Parse pagination
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 1000 {
-		limit = 50
-	}
-	filters.Limit = limit
-
-	offsetStr := c.DefaultQuery("offset", "0")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0
+	// Filter expression, sort and pagination
+	page, ok := parseListPage(c, services.AlertFilterSchema, 50, 1000)
+	if !ok {
+		return
 	}
-	filters.Offset = offset
+	filters.Filter, filters.Sort, filters.Limit, filters.Offset = page.Filter, page.Sort, page.Limit, page.Offset
 
 	// Get alerts
-	alerts, err := h.securityService.GetAlerts(filters)
+	alerts, total, err := h.securityService.ListAlerts(filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to retrieve alerts",
@@ -250,11 +266,140 @@ func (h *SecurityMonitoringHandlers) GetAlerts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"alerts": response,
 		"count":  len(response),
+		"total":  total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	})
+}
+
+// GetAlertQueue returns the triage backlog, most important alert first
+func (h *SecurityMonitoringHandlers) GetAlertQueue(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	alerts, total, err := h.securityService.GetAlertQueue(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve alert queue",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := make([]AlertResponse, len(alerts))
+	for i, alert := range alerts {
+		response[i] = convertAlertToResponse(alert)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": response,
+		"total":  total,
 		"limit":  limit,
 		"offset": offset,
 	})
 }
 
+// GetAlert returns one security alert
+func (h *SecurityMonitoringHandlers) GetAlert(c *gin.Context) {
+	alertID, err := uuid.Parse(c.Param("alert_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid alert ID",
+			"message": "Alert ID must be a valid UUID",
+		})
+		return
+	}
+
+	alert, err := h.securityService.GetAlert(alertID)
+	if errors.Is(err, services.ErrAlertNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Alert not found",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve alert",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alert": convertAlertToResponse(*alert)})
+}
+
+// GetSecurityActions returns the audit trail of response actions, newest first, filtered
+// by ?type=, ?alert_id= and ?user_id=
+func (h *SecurityMonitoringHandlers) GetSecurityActions(c *gin.Context) {
+	filters := services.ActionFilters{}
+	if actionType := c.Query("type"); actionType != "" {
+		t := services.ActionType(actionType)
+		filters.Type = &t
+	}
+	alertID, userID := c.Query("alert_id"), c.Query("user_id")
+	var ok bool
+	if filters.AlertID, ok = parseOptionalUUID(c, &alertID, "alert_id"); !ok {
+		return
+	}
+	if filters.UserID, ok = parseOptionalUUID(c, &userID, "user_id"); !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	filters.Limit, filters.Offset = limit, offset
+
+	actions, total, err := h.securityService.GetActionExecutions(filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve security actions",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions": actions,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// UnlockAccount lets a user locked by a lock_account response sign in again
+func (h *SecurityMonitoringHandlers) UnlockAccount(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": "User ID must be a valid UUID"})
+		return
+	}
+
+	err = h.securityService.UnlockAccount(userID, getAnalystID(c))
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked", "user_id": userID})
+}
+
 // UpdateAlertStatus updates the status of a security alert
 func (h *SecurityMonitoringHandlers) UpdateAlertStatus(c *gin.Context) {
 	alertIDStr := c.Param("alert_id")
@@ -303,6 +448,20 @@ func (h *SecurityMonitoringHandlers) UpdateAlertStatus(c *gin.Context) {
 
 	// Update alert status
 	err = h.securityService.UpdateAlertStatus(alertID, status, assignedTo)
+	if errors.Is(err, services.ErrInvalidAlertStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid status",
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrAlertNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Alert not found",
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to update alert status",
@@ -398,23 +557,15 @@ func (h *SecurityMonitoringHandlers) GetIncidents(c *gin.Context) {
 		}
 	}
 
-	// Parse pagination
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 100 {
-		limit = 20
-	}
-	filters.Limit = limit
-
-	offsetStr := c.DefaultQuery("offset", "0")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0
+	// Filter expression, sort and pagination
+	page, ok := parseListPage(c, services.IncidentFilterSchema, 20, 100)
+	if !ok {
+		return
 	}
-	filters.Offset = offset
+	filters.Filter, filters.Sort, filters.Limit, filters.Offset = page.Filter, page.Sort, page.Limit, page.Offset
 
 	// Get incidents
-	incidents, err := h.securityService.GetIncidents(filters)
+	incidents, total, err := h.securityService.ListIncidents(filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to retrieve incidents",
@@ -432,8 +583,9 @@ func (h *SecurityMonitoringHandlers) GetIncidents(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"incidents": response,
 		"count":     len(response),
-		"limit":     limit,
-		"offset":    offset,
+		"total":     total,
+		"limit":     page.Limit,
+		"offset":    page.Offset,
 	})
 }
 
@@ -455,9 +607,38 @@ func (h *SecurityMonitoringHandlers) GetSecurityMetrics(c *gin.Context) {
 	})
 }
 
-// ProcessLoginEvent processes a login event for security monitoring
-func (h *SecurityMonitoringHandlers) ProcessLoginEvent(c *gin.Context) {
-	var req LoginEventRequest
+// CorrelationRuleRequest represents an alert correlation rule in API requests
+type CorrelationRuleRequest struct {
+	Name             string   `json:"name" binding:"required"`
+	Keys             []string `json:"keys" binding:"required"`
+	Window           string   `json:"window" binding:"required"` // Go duration, e.g. "15m"
+	MinAlerts        int      `json:"min_alerts"`
+	MinDistinctUsers int      `json:"min_distinct_users"`
+}
+
+// GetCorrelationRules returns the active alert correlation rules
+func (h *SecurityMonitoringHandlers) GetCorrelationRules(c *gin.Context) {
+	rules := h.securityService.GetCorrelationRules()
+
+	response := make([]gin.H, len(rules))
+	for i, rule := range rules {
+		response[i] = gin.H{
+			"name":               rule.Name,
+			"keys":               rule.Keys,
+			"window":             rule.Window.String(),
+			"min_alerts":         rule.MinAlerts,
+			"min_distinct_users": rule.MinDistinctUsers,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": response})
+}
+
+// UpdateCorrelationRules replaces the alert correlation rules
+func (h *SecurityMonitoringHandlers) UpdateCorrelationRules(c *gin.Context) {
+	var req struct {
+		Rules []CorrelationRuleRequest `json:"rules" binding:"required,dive"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request format",
@@ -466,6 +647,68 @@ func (h *SecurityMonitoringHandlers) ProcessLoginEvent(c *gin.Context) {
 		return
 	}
 
+	rules := make([]services.CorrelationRule, 0, len(req.Rules))
+	for _, r := range req.Rules {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid window",
+				"message": "Window must be a positive duration such as 15m",
+			})
+			return
+		}
+
+		keys := make([]services.CorrelationKey, 0, len(r.Keys))
+		for _, k := range r.Keys {
+			key := services.CorrelationKey(k)
+			switch key {
+			case services.CorrelationKeyUser, services.CorrelationKeyIP, services.CorrelationKeyAlertType:
+				keys = append(keys, key)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid correlation key",
+					"message": "Keys must be user_id, ip_address or alert_type",
+				})
+				return
+			}
+		}
+		if len(keys) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid correlation key",
+				"message": "Each rule needs at least one key",
+			})
+			return
+		}
+
+		minAlerts := r.MinAlerts
+		if minAlerts < 1 {
+			minAlerts = 2
+		}
+		rules = append(rules, services.CorrelationRule{
+			Name:             r.Name,
+			Keys:             keys,
+			Window:           window,
+			MinAlerts:        minAlerts,
+			MinDistinctUsers: r.MinDistinctUsers,
+		})
+	}
+
+	h.securityService.SetCorrelationRules(rules)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Correlation rules updated",
+		"count":   len(rules),
+	})
+}
+
+// ProcessLoginEvent processes a login event for security monitoring
+func (h *SecurityMonitoringHandlers) ProcessLoginEvent(c *gin.Context) {
+	var req LoginEventRequest
+	event, ok := h.bindEvent(c, services.EventKindLogin, &req)
+	if !ok {
+		return
+	}
+
 	// Parse user ID
 	userID, err := uuid.Parse(req.UserID)
 	if err != nil {
@@ -477,7 +720,7 @@ func (h *SecurityMonitoringHandlers) ProcessLoginEvent(c *gin.Context) {
 	}
 
 	// Process login event
-	err = h.securityService.ProcessLoginEvent(userID, req.Email, req.IPAddress, req.UserAgent, req.Success, req.RiskScore)
+	err = h.securityService.ProcessLoginEvent(c.Request.Context(), userID, req.Email, req.IPAddress, req.UserAgent, req.Outcome == "success", req.RiskScore)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to process login event",
@@ -486,19 +729,14 @@ func (h *SecurityMonitoringHandlers) ProcessLoginEvent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login event processed successfully",
-	})
+	c.JSON(http.StatusOK, eventResponse("Login event processed successfully", event))
 }
 
 // ProcessAPIEvent processes an API event for security monitoring
 func (h *SecurityMonitoringHandlers) ProcessAPIEvent(c *gin.Context) {
 	var req APIEventRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"message": err.Error(),
-		})
+	event, ok := h.bindEvent(c, services.EventKindAPI, &req)
+	if !ok {
 		return
 	}
 
@@ -515,11 +753,125 @@ func (h *SecurityMonitoringHandlers) ProcessAPIEvent(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, eventResponse("API event processed successfully", event))
+}
+
+// ProcessSecurityEvent raises a detection reported by another system as an alert
+func (h *SecurityMonitoringHandlers) ProcessSecurityEvent(c *gin.Context) {
+	var req SecurityEventRequest
+	event, ok := h.bindEvent(c, services.EventKindSecurity, &req)
+	if !ok {
+		return
+	}
+	userID, ok := parseOptionalUUID(c, &req.UserID, "user_id")
+	if !ok {
+		return
+	}
+
+	alert, err := h.securityService.ProcessSecurityEvent(services.ExternalSecurityEvent{
+		EventType:   req.EventType,
+		Severity:    services.AlertSeverity(req.Severity),
+		Title:       req.Title,
+		Description: req.Description,
+		UserID:      userID,
+		IPAddress:   req.IPAddress,
+		Attributes:  req.Attributes,
+		OccurredAt:  req.OccurredAt,
+		Source:      c.GetString("serviceAccount"),
+	})
+	if errors.Is(err, services.ErrInvalidSecurityEvent) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid security event",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to process security event",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := eventResponse("Security event processed successfully", event)
+	response["alert_id"] = alert.ID
+	c.JSON(http.StatusOK, response)
+}
+
+// GetEventSchemas returns every version of the ingested event schemas
+func (h *SecurityMonitoringHandlers) GetEventSchemas(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"message": "API event processed successfully",
+		"schemas": h.eventSchemas.Schemas(),
 	})
 }
 
+// bindEvent reads an ingested event in the schema version named by the X-Event-Schema-Version
+// header or the schema_version field, and decodes it upgraded to the current version into req
+func (h *SecurityMonitoringHandlers) bindEvent(c *gin.Context, kind string, req interface{}) (*services.NormalizedEvent, bool) {
+	var payload map[string]interface{}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	declared := c.GetHeader("X-Event-Schema-Version")
+	if value, ok := payload["schema_version"]; ok {
+		if declared == "" {
+			declared = fmt.Sprint(value)
+		}
+		delete(payload, "schema_version")
+	}
+	version, err := services.ParseEventSchemaVersion(declared)
+	var event *services.NormalizedEvent
+	if err == nil {
+		event, err = h.eventSchemas.Normalize(kind, version, payload)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":           "Invalid event",
+			"message":         err.Error(),
+			"current_version": h.eventSchemas.CurrentVersion(kind),
+		})
+		return nil, false
+	}
+
+	// Round-trip through JSON to decode the upgraded payload like a request body
+	body, err := json.Marshal(event.Payload)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	if event.Deprecated {
+		c.Header("Deprecation", "true")
+	}
+	for _, warning := range event.Warnings {
+		c.Writer.Header().Add("Warning", "299 - "+strconv.Quote(warning))
+	}
+	return event, true
+}
+
+func eventResponse(message string, event *services.NormalizedEvent) gin.H {
+	response := gin.H{
+		"message":        message,
+		"schema_version": event.Version,
+	}
+	if len(event.Warnings) > 0 {
+		response["warnings"] = event.Warnings
+	}
+	return response
+}
+
 // ConfigureAlertChannel configures an alert delivery channel
 func (h *SecurityMonitoringHandlers) ConfigureAlertChannel(c *gin.Context) {
 	var req AlertChannelRequest
@@ -535,20 +887,56 @@ func (h *SecurityMonitoringHandlers) ConfigureAlertChannel(c *gin.Context) {
 	var channel services.AlertChannel
 	switch req.Type {
 	case "email":
+		host, _ := req.Config["smtp_host"].(string)
+		port, _ := req.Config["smtp_port"].(float64)
+		username, _ := req.Config["smtp_username"].(string)
+		password, _ := req.Config["smtp_password"].(string)
+		from, _ := req.Config["from_address"].(string)
+		var to []string
+		if configured, ok := req.Config["to_addresses"].([]interface{}); ok {
+			for _, value := range configured {
+				if str, ok := value.(string); ok && str != "" {
+					to = append(to, str)
+				}
+			}
+		}
 		channel = &services.EmailAlertChannel{
-			Enabled: req.Enabled,
+			SMTPHost:     host,
+			SMTPPort:     int(port),
+			SMTPUsername: username,
+			SMTPPassword: password,
+			FromAddress:  from,
+			ToAddresses:  to,
+			Enabled:      req.Enabled,
+			Links:        h.alertLinks,
 		}
-		// Configure email-specific settings from req.Config
 	case "slack":
+		webhookURL, _ := req.Config["webhook_url"].(string)
+		slackChannel, _ := req.Config["channel"].(string)
+		username, _ := req.Config["username"].(string)
 		channel = &services.SlackAlertChannel{
-			Enabled: req.Enabled,
+			WebhookURL: webhookURL,
+			Channel:    slackChannel,
+			Username:   username,
+			Enabled:    req.Enabled,
+			Deliverer:  h.webhookService,
 		}
-		// Configure Slack-specific settings from req.Config
 	case "webhook":
+		url, _ := req.Config["url"].(string)
+		headers := make(map[string]string)
+		if configured, ok := req.Config["headers"].(map[string]interface{}); ok {
+			for key, value := range configured {
+				if str, ok := value.(string); ok {
+					headers[key] = str
+				}
+			}
+		}
 		channel = &services.WebhookAlertChannel{
-			Enabled: req.Enabled,
+			URL:       url,
+			Headers:   headers,
+			Enabled:   req.Enabled,
+			Deliverer: h.webhookService,
 		}
-		// Configure webhook-specific settings from req.Config
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid channel type",
@@ -586,6 +974,19 @@ func (h *SecurityMonitoringHandlers) GetAlertTypes(c *gin.Context) {
 		string(services.AlertTypeAPIAbuse),
 		string(services.AlertTypeConfigurationChange),
 		string(services.AlertTypeSystemIntegrityBreach),
+		string(services.AlertTypeIntegrationDegraded),
+		string(services.AlertTypeTokenReplay),
+		string(services.AlertTypePasswordReuse),
+		string(services.AlertTypePhishingSuspected),
+		string(services.AlertTypeSigningKeyExpiring),
+		string(services.AlertTypeDetectionQuery),
+		string(services.AlertTypeCallbackAbuse),
+		string(services.AlertTypeCanaryKeyUsed),
+		string(services.AlertTypeMalwareUpload),
+		string(services.AlertTypeExternalEvent),
+		string(services.AlertTypeAuditVolumeAnomaly),
+		string(services.AlertTypeIdPRiskSignal),
+		string(services.AlertTypeDormantAccounts),
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -625,6 +1026,7 @@ func convertAlertToResponse(alert services.SecurityAlert) AlertResponse {
 		ResolvedAt:  alert.ResolvedAt,
 		Actions:     make([]ActionResponse, len(alert.Actions)),
 		Tags:        alert.Tags,
+		Priority:    alert.Priority,
 	}
 
 	if alert.UserID != nil {
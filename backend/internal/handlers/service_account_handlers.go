@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ServiceAccountHandlers contains the client-certificate service authentication middleware
+// and the service account admin handlers
+type ServiceAccountHandlers struct {
+	serviceAccountService *services.ServiceAccountService
+}
+
+// NewServiceAccountHandlers creates new service account handlers
+func NewServiceAccountHandlers(serviceAccountService *services.ServiceAccountService) *ServiceAccountHandlers {
+	return &ServiceAccountHandlers{serviceAccountService: serviceAccountService}
+}
+
+// ServiceAccountRequest represents an admin's definition of a service account
+type ServiceAccountRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Description     string   `json:"description"`
+	CertFingerprint string   `json:"cert_fingerprint"`
+	CertURI         string   `json:"cert_uri"`
+	CertSubject     string   `json:"cert_subject"`
+	Scopes          []string `json:"scopes" binding:"required"`
+	Enabled         *bool    `json:"enabled"`
+	EventRateLimit  int      `json:"event_rate_limit"`
+}
+
+func (req ServiceAccountRequest) input() services.ServiceAccountInput {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return services.ServiceAccountInput{
+		Name:            req.Name,
+		Description:     req.Description,
+		CertFingerprint: req.CertFingerprint,
+		CertURI:         req.CertURI,
+		CertSubject:     req.CertSubject,
+		Scopes:          req.Scopes,
+		Enabled:         enabled,
+		EventRateLimit:  req.EventRateLimit,
+	}
+}
+
+// RequireServiceAccount authenticates the caller by client certificate and requires the
+// service account it maps to to hold the scope
+func (h *ServiceAccountHandlers) RequireServiceAccount(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, err := h.serviceAccountService.Authenticate(c.Request, net.ParseIP(c.RemoteIP()), time.Now())
+		if err != nil {
+			services.LogAuditEvent(c.Request.Context(), "", "service_authentication_failed", "service_account", "", c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+			switch {
+			case errors.Is(err, services.ErrMTLSNotConfigured):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service authentication is not configured"})
+			case errors.Is(err, services.ErrServiceAccountDisabled):
+				c.JSON(http.StatusForbidden, gin.H{"error": "Service account disabled"})
+			case errors.Is(err, services.ErrClientCertificateRequired), errors.Is(err, services.ErrClientCertificateInvalid), errors.Is(err, services.ErrServiceAccountUnknown):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Client certificate not accepted", "message": err.Error()})
+			default:
+				log.Printf("Error authenticating service account: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate service"})
+			}
+			c.Abort()
+			return
+		}
+		if !services.HasScope(account, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "message": "Service account " + account.Name + " lacks the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+
+		c.Set("serviceAccount", account.Name)
+		c.Next()
+	}
+}
+
+// ListAccounts returns every service account
+func (h *ServiceAccountHandlers) ListAccounts(c *gin.Context) {
+	accounts, err := h.serviceAccountService.ListAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_accounts": accounts, "count": len(accounts), "mtls_enabled": h.serviceAccountService.Enabled()})
+}
+
+// CreateAccount defines a new service account
+func (h *ServiceAccountHandlers) CreateAccount(c *gin.Context) {
+	var req ServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	account, err := h.serviceAccountService.CreateAccount(req.input(), getAnalystID(c))
+	if errors.Is(err, services.ErrInvalidServiceAccount) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"service_account": account})
+}
+
+// UpdateAccount replaces a service account's certificate mapping, scopes and state
+func (h *ServiceAccountHandlers) UpdateAccount(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID", "message": err.Error()})
+		return
+	}
+	var req ServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	account, err := h.serviceAccountService.UpdateAccount(id, req.input(), getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrServiceAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+	case errors.Is(err, services.ErrInvalidServiceAccount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account", "message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service account", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"service_account": account})
+	}
+}
+
+// DeleteAccount removes a service account
+func (h *ServiceAccountHandlers) DeleteAccount(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID", "message": err.Error()})
+		return
+	}
+
+	err = h.serviceAccountService.DeleteAccount(id, getAnalystID(c))
+	if errors.Is(err, services.ErrServiceAccountNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted"})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// sessionActivity ends idle sessions. It is set by SetupRoutes; when nil sessions have no
+// idle timeout.
+var sessionActivity *services.SessionActivityService
+
+// SessionHandlers let users review and revoke their own sessions, and administrators
+// sign any user out
+type SessionHandlers struct {
+	securityCenter *services.SecurityCenterService
+	security       *services.SecurityMonitoringService
+}
+
+// NewSessionHandlers creates new session handlers
+func NewSessionHandlers(securityCenter *services.SecurityCenterService, security *services.SecurityMonitoringService) *SessionHandlers {
+	return &SessionHandlers{securityCenter: securityCenter, security: security}
+}
+
+// ForceLogoutRequest optionally says why an administrator signed a user out
+type ForceLogoutRequest struct {
+	Reason string `json:"reason"`
+}
+
+// currentSessionID is the session the request's access token was issued for, if any
+func currentSessionID(c *gin.Context) *uuid.UUID {
+	if sessionID, ok := c.Get("sessionID"); ok {
+		if id, ok := sessionID.(uuid.UUID); ok {
+			return &id
+		}
+	}
+	return nil
+}
+
+// ListMySessions returns the user's active sessions with their device, IP address and location
+func (h *SessionHandlers) ListMySessions(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	sessions, err := h.securityCenter.ActiveSessions(*userID, currentSessionID(c), time.Now())
+	if err != nil {
+		log.Printf("Error listing sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions, "count": len(sessions)})
+}
+
+// Heartbeat keeps the current session from timing out while the user is active in the
+// frontend without making requests, and says when it will time out otherwise
+func (h *SessionHandlers) Heartbeat(c *gin.Context) {
+	sessionID := currentSessionID(c)
+	if sessionID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No session", "message": "This access token was not issued for a CloudGate session"})
+		return
+	}
+	if sessionActivity == nil {
+		c.JSON(http.StatusOK, gin.H{"session_id": sessionID})
+		return
+	}
+
+	activity, err := sessionActivity.Heartbeat(*sessionID, time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session_idle_timeout", "message": "Your session has ended; please sign in again"})
+			return
+		}
+		log.Printf("Error recording session heartbeat: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record session activity"})
+		return
+	}
+	c.JSON(http.StatusOK, activity)
+}
+
+// RevokeMySession signs the user out of one of their sessions
+func (h *SessionHandlers) RevokeMySession(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.securityCenter.RevokeSession(*userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		log.Printf("Error revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	services.LogAuditEvent(c.Request.Context(), userID.String(), "session_revoked", "session", sessionID.String(), c.ClientIP(), c.GetHeader("User-Agent"), "", "success")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeMyOtherSessions signs the user out of every session but the one making the request
+func (h *SessionHandlers) RevokeMyOtherSessions(c *gin.Context) {
+	userID := getAnalystID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	revoked, err := h.securityCenter.RevokeOtherSessions(*userID, currentSessionID(c))
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	services.LogAuditEvent(c.Request.Context(), userID.String(), "other_sessions_revoked", "session", "", c.ClientIP(), c.GetHeader("User-Agent"), "", "success")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked successfully", "revoked": revoked})
+}
+
+// ListUserSessions returns a user's active sessions for an administrator
+func (h *SessionHandlers) ListUserSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": "User ID must be a valid UUID"})
+		return
+	}
+
+	sessions, err := h.securityCenter.ActiveSessions(userID, nil, time.Now())
+	if err != nil {
+		log.Printf("Error listing sessions for user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "sessions": sessions, "count": len(sessions)})
+}
+
+// RevokeUserSessions signs a user out of every session
+func (h *SessionHandlers) RevokeUserSessions(c *gin.Context) {
+	h.forceLogout(c, nil)
+}
+
+// RevokeUserSession signs a user out of one session
+func (h *SessionHandlers) RevokeUserSession(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+	h.forceLogout(c, &sessionID)
+}
+
+func (h *SessionHandlers) forceLogout(c *gin.Context, sessionID *uuid.UUID) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "message": "User ID must be a valid UUID"})
+		return
+	}
+	var req ForceLogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "message": err.Error()})
+			return
+		}
+	}
+
+	err = h.security.ForceLogout(userID, sessionID, getAnalystID(c), req.Reason)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "message": err.Error()})
+		return
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User signed out", "user_id": userID})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ShadowITHandlers contains the shadow IT discovery report handlers
+type ShadowITHandlers struct {
+	shadowITService *services.ShadowITService
+}
+
+// NewShadowITHandlers creates new shadow IT handlers
+func NewShadowITHandlers(shadowITService *services.ShadowITService) *ShadowITHandlers {
+	return &ShadowITHandlers{shadowITService: shadowITService}
+}
+
+// ReviewDiscoveredAppRequest represents an admin's review of a discovered app
+type ReviewDiscoveredAppRequest struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// GetReport returns discovered apps, riskiest first, optionally ?status= and ?risk_level=
+func (h *ShadowITHandlers) GetReport(c *gin.Context) {
+	apps, err := h.shadowITService.Report(c.Query("status"), c.Query("risk_level"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build shadow IT report", "message": err.Error()})
+		return
+	}
+
+	byRisk := gin.H{"high": 0, "medium": 0, "low": 0}
+	unreviewed := 0
+	for _, app := range apps {
+		byRisk[app.RiskLevel] = byRisk[app.RiskLevel].(int) + 1
+		if app.Status == services.DiscoveryStatusUnreviewed {
+			unreviewed++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apps":       apps,
+		"count":      len(apps),
+		"by_risk":    byRisk,
+		"unreviewed": unreviewed,
+	})
+}
+
+// GetGrants returns the users who granted a discovered app OAuth access
+func (h *ShadowITHandlers) GetGrants(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid app ID", "message": err.Error()})
+		return
+	}
+
+	grants, err := h.shadowITService.GetGrants(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list grants", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"grants": grants, "count": len(grants)})
+}
+
+// ReviewApp marks a discovered app sanctioned, blocked or back to unreviewed
+func (h *ShadowITHandlers) ReviewApp(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid app ID", "message": err.Error()})
+		return
+	}
+	var req ReviewDiscoveredAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	app, err := h.shadowITService.SetStatus(id, req.Status, req.Note, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrDiscoveredAppNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Discovered app not found"})
+	case errors.Is(err, services.ErrInvalidDiscoveryStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status", "message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review app", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"app": app})
+	}
+}
+
+// Scan runs discovery now instead of waiting for the periodic scan
+func (h *ShadowITHandlers) Scan(c *gin.Context) {
+	results := h.shadowITService.Scan(c.Request.Context(), time.Now())
+
+	scanned := []string{}
+	failed := gin.H{}
+	for source, err := range results {
+		if err != nil {
+			failed[source] = err.Error()
+		} else {
+			scanned = append(scanned, source)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scanned": scanned,
+		"failed":  failed,
+	})
+}
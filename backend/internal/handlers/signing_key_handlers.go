@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signingKeys publishes CloudGate's signing certificates in the SAML metadata. It is set
+// by SetupRoutes; when nil the metadata carries no certificate.
+var signingKeys *services.SigningKeyService
+
+// SigningKeyHandlers contains the signing key publication and rotation handlers
+type SigningKeyHandlers struct {
+	signingKeyService *services.SigningKeyService
+}
+
+// NewSigningKeyHandlers creates new signing key handlers
+func NewSigningKeyHandlers(signingKeyService *services.SigningKeyService) *SigningKeyHandlers {
+	return &SigningKeyHandlers{signingKeyService: signingKeyService}
+}
+
+// RotateSigningKeyRequest represents an admin's request to rotate the signing key
+type RotateSigningKeyRequest struct {
+	Immediate bool `json:"immediate"` // switch now instead of after the overlap period
+}
+
+// JWKS publishes the signing keys as a JSON Web Key Set
+func (h *SigningKeyHandlers) JWKS(c *gin.Context) {
+	set, err := h.signingKeyService.JWKS()
+	if err != nil {
+		log.Printf("Error building JWKS: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, set)
+}
+
+// ListKeys returns every signing key with its lifecycle dates
+func (h *SigningKeyHandlers) ListKeys(c *gin.Context) {
+	keys, err := h.signingKeyService.ListKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list signing keys", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys, "count": len(keys)})
+}
+
+// RotateKey generates a new signing key, scheduled after the overlap period unless immediate
+func (h *SigningKeyHandlers) RotateKey(c *gin.Context) {
+	var req RotateSigningKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+			return
+		}
+	}
+
+	key, err := h.signingKeyService.Rotate(req.Immediate, getAnalystID(c), time.Now())
+	if errors.Is(err, services.ErrSigningKeyRotationPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Rotation already scheduled", "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"key": key})
+}
+
+// RevokeKey withdraws a scheduled or retiring signing key from publication
+func (h *SigningKeyHandlers) RevokeKey(c *gin.Context) {
+	err := h.signingKeyService.Revoke(c.Param("kid"), getAnalystID(c), time.Now())
+	switch {
+	case errors.Is(err, services.ErrSigningKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Signing key not found"})
+	case errors.Is(err, services.ErrSigningKeyInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Signing key in use", "message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke signing key", "message": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Signing key revoked"})
+	}
+}
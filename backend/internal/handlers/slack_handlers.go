@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// slackMaxBody bounds Slack request bodies, which are read whole to check their signature
+const slackMaxBody = 1 << 20
+
+// SlackHandlers contains the Slack app's slash command and interactivity endpoints and
+// the admin endpoints that map Slack users to analysts
+type SlackHandlers struct {
+	slack *services.SlackTriageService
+}
+
+// NewSlackHandlers creates new Slack handlers
+func NewSlackHandlers(slack *services.SlackTriageService) *SlackHandlers {
+	return &SlackHandlers{slack: slack}
+}
+
+// VerifySignature rejects requests not signed by Slack with SLACK_SIGNING_SECRET
+func (h *SlackHandlers) VerifySignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.slack.Enabled() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Slack integration not configured"})
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, slackMaxBody))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		err = h.slack.VerifyRequest(c.GetHeader("X-Slack-Request-Timestamp"), c.GetHeader("X-Slack-Signature"), body, time.Now())
+		if err != nil {
+			log.Printf("🚫 Rejected Slack request from %s: %v", c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Slack signature"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// Command answers the /cloudgate slash command
+func (h *SlackHandlers) Command(c *gin.Context) {
+	message, err := h.slack.HandleCommand(services.SlackCommand{
+		TeamID:  c.PostForm("team_id"),
+		UserID:  c.PostForm("user_id"),
+		Command: c.PostForm("command"),
+		Text:    c.PostForm("text"),
+	}, time.Now())
+	if err != nil {
+		// Slack shows the response to the user, so failures are answered with a 200
+		c.JSON(http.StatusOK, slackError(err))
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+// Interaction handles alert button clicks. Slack only waits three seconds, so the click is
+// acknowledged at once and the updated alert is posted to the response URL.
+func (h *SlackHandlers) Interaction(c *gin.Context) {
+	var interaction services.SlackInteraction
+	if err := json.Unmarshal([]byte(c.PostForm("payload")), &interaction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interaction payload", "message": err.Error()})
+		return
+	}
+
+	message, err := h.slack.HandleInteraction(c.Request.Context(), interaction, time.Now())
+	if err != nil {
+		message = slackError(err)
+	}
+	go func() {
+		if err := h.slack.Respond(interaction.ResponseURL, message); err != nil {
+			log.Printf("Failed to respond to Slack interaction: %v", err)
+		}
+	}()
+	c.Status(http.StatusOK)
+}
+
+// slackError explains a failed command or action to the analyst, hiding internal errors
+func slackError(err error) *services.SlackMessage {
+	text := "Something went wrong; please try again or use the CloudGate console"
+	switch {
+	case errors.Is(err, services.ErrSlackUserUnauthorized):
+		text = "Your Slack account is not linked to an active CloudGate analyst. Connect Slack in CloudGate or ask an admin to link you."
+	case errors.Is(err, services.ErrAlertNotFound):
+		text = "That alert no longer exists"
+	case errors.Is(err, services.ErrInvalidSlackAction):
+		text = "That action is not supported"
+	default:
+		log.Printf("Error handling Slack request: %v", err)
+	}
+	return &services.SlackMessage{ResponseType: "ephemeral", Text: text}
+}
+
+// LinkSlackAnalystRequest maps a Slack user to an analyst
+type LinkSlackAnalystRequest struct {
+	TeamID      string `json:"team_id" binding:"required"`
+	SlackUserID string `json:"slack_user_id" binding:"required"`
+	UserID      string `json:"user_id" binding:"required"`
+}
+
+// ListAnalysts returns the Slack users mapped to analysts by admins
+func (h *SlackHandlers) ListAnalysts(c *gin.Context) {
+	links, err := h.slack.ListAnalysts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list Slack analysts", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"analysts": links, "count": len(links)})
+}
+
+// LinkAnalyst maps a Slack user to an analyst, replacing any earlier mapping
+func (h *SlackHandlers) LinkAnalyst(c *gin.Context) {
+	var req LinkSlackAnalystRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id", "message": "user_id must be a valid UUID"})
+		return
+	}
+
+	link, err := h.slack.LinkAnalyst(req.TeamID, req.SlackUserID, userID, getAnalystID(c))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link Slack analyst", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// UnlinkAnalyst removes a Slack user's mapping
+func (h *SlackHandlers) UnlinkAnalyst(c *gin.Context) {
+	removed, err := h.slack.UnlinkAnalyst(c.Param("team_id"), c.Param("slack_user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink Slack analyst", "message": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slack analyst not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Slack analyst unlinked"})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// StaleAccountHandlers contains the HTTP handlers for dormant accounts and their reactivation
+type StaleAccountHandlers struct {
+	staleAccounts *services.StaleAccountService
+}
+
+// NewStaleAccountHandlers creates new dormant account handlers
+func NewStaleAccountHandlers(staleAccounts *services.StaleAccountService) *StaleAccountHandlers {
+	return &StaleAccountHandlers{staleAccounts: staleAccounts}
+}
+
+// ListDormantAccounts returns dormant accounts, optionally filtered by status
+func (h *StaleAccountHandlers) ListDormantAccounts(c *gin.Context) {
+	accounts, err := h.staleAccounts.List(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list dormant accounts"})
+		return
+	}
+	summary, err := h.staleAccounts.Summary()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count dormant accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts, "count": len(accounts), "summary": summary})
+}
+
+// ScanDormantAccounts runs the dormant account scan now instead of waiting for the next one
+func (h *StaleAccountHandlers) ScanDormantAccounts(c *gin.Context) {
+	scan, err := h.staleAccounts.Scan(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan for dormant accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, scan)
+}
+
+// Reactivate unlocks a disabled dormant account
+func (h *StaleAccountHandlers) Reactivate(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	err = h.staleAccounts.Reactivate(userID, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrDormantAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNotDormantLock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account reactivated"})
+}
+
+// RequestReactivation lets the owner of a disabled dormant account ask for it back. It
+// answers the same whether or not the account exists.
+func (h *StaleAccountHandlers) RequestReactivation(c *gin.Context) {
+	var req struct {
+		Email  string `json:"email" binding:"required,email"`
+		Reason string `json:"reason" binding:"max=1000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.staleAccounts.RequestReactivation(req.Email, req.Reason, c.ClientIP(), time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request reactivation"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account was disabled for inactivity, an administrator will review the request"})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// stepUpFatigue pauses step-up prompts for users being bombed with them. It is set by
+// SetupRoutes; when nil step-ups are never paused.
+var stepUpFatigue *services.StepUpFatigueService
+
+// checkStepUpPaused writes a step_up_blocked response and returns true while the user's
+// step-ups are paused. When prompt is set the check counts as a new challenge.
+func checkStepUpPaused(c *gin.Context, userID string, prompt bool) bool {
+	if stepUpFatigue == nil {
+		return false
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return false
+	}
+
+	var until time.Time
+	var blocked bool
+	if prompt {
+		until, blocked = stepUpFatigue.RecordChallenge(userUUID, c.ClientIP(), c.GetHeader("User-Agent"), time.Now())
+	} else {
+		until, blocked = stepUpFatigue.Blocked(userUUID, time.Now())
+	}
+	if blocked {
+		middleware.StepUpBlocked(c, until)
+	}
+	return blocked
+}
+
+// StepUpFatigueHandlers contains the admin HTTP handlers for users whose step-ups are paused
+type StepUpFatigueHandlers struct {
+	fatigue *services.StepUpFatigueService
+}
+
+// NewStepUpFatigueHandlers creates new step-up fatigue handlers
+func NewStepUpFatigueHandlers(fatigue *services.StepUpFatigueService) *StepUpFatigueHandlers {
+	return &StepUpFatigueHandlers{fatigue: fatigue}
+}
+
+// ListBlocks returns the users whose step-up prompts are paused
+func (h *StepUpFatigueHandlers) ListBlocks(c *gin.Context) {
+	blocks := h.fatigue.ListBlocks(time.Now())
+	c.JSON(http.StatusOK, gin.H{"blocks": blocks, "count": len(blocks)})
+}
+
+// Unblock resumes a user's step-up prompts before the pause ends
+func (h *StepUpFatigueHandlers) Unblock(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !h.fatigue.Unblock(userID, getAnalystID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Step-ups are not paused for this user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Step-up prompts resumed"})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TimelineHandlers contains user activity timeline HTTP handlers
+type TimelineHandlers struct {
+	timelineService *services.TimelineService
+	adminLinks      *services.AdminLinkService
+}
+
+// NewTimelineHandlers creates new timeline handlers
+func NewTimelineHandlers(timelineService *services.TimelineService, adminLinks *services.AdminLinkService) *TimelineHandlers {
+	return &TimelineHandlers{
+		timelineService: timelineService,
+		adminLinks:      adminLinks,
+	}
+}
+
+// GetUserTimeline returns a user's merged activity feed, newest first, with links to the
+// user in connected providers' admin consoles.
+// Supports ?since=&until= (RFC3339), ?sources=audit,risk,... and limit/offset paging.
+func (h *TimelineHandlers) GetUserTimeline(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	query := services.TimelineQuery{}
+
+	query.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || query.Limit < 1 || query.Limit > 200 {
+		query.Limit = 50
+	}
+	query.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since timestamp", "message": err.Error()})
+			return
+		}
+		query.Since = &t
+	}
+	if until := c.Query("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until timestamp", "message": err.Error()})
+			return
+		}
+		query.Until = &t
+	}
+	if sources := c.Query("sources"); sources != "" {
+		query.Sources = strings.Split(sources, ",")
+	}
+
+	entries, total, err := h.timelineService.GetUserTimeline(userID, query)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownTimelineSource) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sources", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build timeline", "message": err.Error()})
+		return
+	}
+
+	links, err := h.adminLinks.ForUser(userID)
+	if err != nil && !errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build admin console links", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     userID,
+		"timeline":    entries,
+		"total":       total,
+		"limit":       query.Limit,
+		"offset":      query.Offset,
+		"admin_links": links,
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha1"
@@ -14,20 +15,20 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
-	"cloudgate-backend/pkg/constants"
 )
 
-// In-memory store for OAuth 1.0a request token secrets (for demo purposes)
-var (
-	requestTokenSecrets = make(map[string]string)
-	requestTokenMutex   = sync.RWMutex{}
-)
+// trelloRequestTokenKey is where the secret of an OAuth 1.0a request token waits in the
+// shared cache for the callback, which may reach another instance
+func trelloRequestTokenKey(requestToken string) string {
+	return "trello_request_token:" + requestToken
+}
 
 // TrelloOAuthConfig holds Trello OAuth 1.0a configuration
 type TrelloOAuthConfig struct {
@@ -132,6 +133,9 @@ func buildOAuthHeader(params map[string]string) string {
 // TrelloOAuthInitHandler initiates Trello OAuth 1.0a flow
 func TrelloOAuthInitHandler(c *gin.Context) {
 	config := getTrelloOAuthConfig()
+	if !allowCallbackURI(c, "trello", config.CallbackURL) {
+		return
+	}
 
 	if config.APIKey == "" || config.APISecret == "" {
 		log.Printf("Trello OAuth not configured - missing APIKey or APISecret")
@@ -150,7 +154,7 @@ func TrelloOAuthInitHandler(c *gin.Context) {
 	}
 
 	// Step 1: Get request token
-	requestToken, requestTokenSecret, err := getTrelloRequestToken(config)
+	requestToken, requestTokenSecret, err := getTrelloRequestToken(c.Request.Context(), config)
 	if err != nil {
 		log.Printf("Error getting Trello request token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -159,10 +163,25 @@ func TrelloOAuthInitHandler(c *gin.Context) {
 		return
 	}
 
-	// Store request token secret for callback (in production, use Redis/database)
-	requestTokenMutex.Lock()
-	requestTokenSecrets[requestToken] = requestTokenSecret
-	requestTokenMutex.Unlock()
+	// The request token stands in for a state: the callback must come back with it for
+	// the same user
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if err := activeStateStore().Bind("trello", requestToken, userUUID, time.Now()); err != nil {
+		log.Printf("Error storing Trello request token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate Trello OAuth"})
+		return
+	}
+
+	// Store request token secret for callback
+	if err := services.SharedCache().Set(c.Request.Context(), trelloRequestTokenKey(requestToken), []byte(requestTokenSecret), activeStateStore().TTL()); err != nil {
+		log.Printf("Error storing Trello request token secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate Trello OAuth"})
+		return
+	}
 
 	// Build authorization URL
 	authURL := fmt.Sprintf("%s?oauth_token=%s&scope=read,write&expiration=30days&name=CloudGate",
@@ -177,7 +196,7 @@ func TrelloOAuthInitHandler(c *gin.Context) {
 }
 
 // getTrelloRequestToken gets request token from Trello (Step 1 of OAuth 1.0a)
-func getTrelloRequestToken(config *TrelloOAuthConfig) (string, string, error) {
+func getTrelloRequestToken(ctx context.Context, config *TrelloOAuthConfig) (string, string, error) {
 	// OAuth 1.0a parameters
 	params := map[string]string{
 		"oauth_callback":         config.CallbackURL,
@@ -196,7 +215,7 @@ func getTrelloRequestToken(config *TrelloOAuthConfig) (string, string, error) {
 	authHeader := buildOAuthHeader(params)
 
 	// Make request
-	req, err := http.NewRequest("POST", config.RequestTokenURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", config.RequestTokenURL, nil)
 	if err != nil {
 		return "", "", err
 	}
@@ -204,7 +223,7 @@ func getTrelloRequestToken(config *TrelloOAuthConfig) (string, string, error) {
 	req.Header.Set("Authorization", authHeader)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := services.TracedHTTPClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", "", err
@@ -241,6 +260,9 @@ func getTrelloRequestToken(config *TrelloOAuthConfig) (string, string, error) {
 // TrelloOAuthCallbackHandler handles Trello OAuth 1.0a callback
 func TrelloOAuthCallbackHandler(c *gin.Context) {
 	config := getTrelloOAuthConfig()
+	if !allowCallbackURI(c, "trello", config.CallbackURL) {
+		return
+	}
 
 	oauthToken := c.Query("oauth_token")
 	oauthVerifier := c.Query("oauth_verifier")
@@ -252,26 +274,23 @@ func TrelloOAuthCallbackHandler(c *gin.Context) {
 		return
 	}
 
-	// Step 3: Exchange for access token
-	// Retrieve the stored request token secret
-	requestTokenMutex.RLock()
-	requestTokenSecret, exists := requestTokenSecrets[oauthToken]
-	requestTokenMutex.RUnlock()
+	userUUID, ok := checkOAuthState(c, "trello", oauthToken)
+	if !ok {
+		return
+	}
 
-	if !exists {
-		log.Printf("Request token secret not found for token: %s", oauthToken)
+	// Step 3: Exchange for access token
+	// Retrieve the stored request token secret, which is only used once
+	requestTokenSecret, err := services.SharedCache().Take(c.Request.Context(), trelloRequestTokenKey(oauthToken))
+	if err != nil {
+		log.Printf("Request token secret not found for token %s: %v", oauthToken, err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid OAuth state - request token not found",
 		})
 		return
 	}
 
-	// Clean up the stored secret
-	requestTokenMutex.Lock()
-	delete(requestTokenSecrets, oauthToken)
-	requestTokenMutex.Unlock()
-
-	accessToken, accessTokenSecret, err := getTrelloAccessToken(config, oauthToken, oauthVerifier, requestTokenSecret)
+	accessToken, accessTokenSecret, err := getTrelloAccessToken(c.Request.Context(), config, oauthToken, oauthVerifier, string(requestTokenSecret))
 	if err != nil {
 		log.Printf("Error getting Trello access token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -281,7 +300,7 @@ func TrelloOAuthCallbackHandler(c *gin.Context) {
 	}
 
 	// Get user information from Trello
-	userInfo, err := getTrelloUserInfo(config, accessToken, accessTokenSecret)
+	userInfo, err := getTrelloUserInfo(c.Request.Context(), config, accessToken, accessTokenSecret)
 	if err != nil {
 		log.Printf("Error getting Trello user info: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -290,9 +309,8 @@ func TrelloOAuthCallbackHandler(c *gin.Context) {
 		return
 	}
 
-	// Store tokens in database
-	userID := constants.DemoUserID // In production, get from JWT
-	err = storeTrelloTokens(userID, accessToken, accessTokenSecret, userInfo)
+	// Store tokens for the user the request token was issued to
+	err = storeTrelloTokens(userUUID.String(), accessToken, accessTokenSecret, userInfo)
 	if err != nil {
 		log.Printf("Error storing Trello tokens: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -302,13 +320,11 @@ func TrelloOAuthCallbackHandler(c *gin.Context) {
 	}
 
 	// Redirect to frontend with success
-	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
-	redirectURL := fmt.Sprintf("%s/oauth/callback?provider=trello&email=%s&code=success", frontendURL, url.QueryEscape(userInfo.Username))
-	c.Redirect(http.StatusFound, redirectURL)
+	redirectToFrontend(c, "trello", userInfo.Username)
 }
 
 // getTrelloAccessToken exchanges request token for access token (Step 3 of OAuth 1.0a)
-func getTrelloAccessToken(config *TrelloOAuthConfig, oauthToken, oauthVerifier, requestTokenSecret string) (string, string, error) {
+func getTrelloAccessToken(ctx context.Context, config *TrelloOAuthConfig, oauthToken, oauthVerifier, requestTokenSecret string) (string, string, error) {
 	// OAuth 1.0a parameters
 	params := map[string]string{
 		"oauth_consumer_key":     config.APIKey,
@@ -328,7 +344,7 @@ func getTrelloAccessToken(config *TrelloOAuthConfig, oauthToken, oauthVerifier,
 	authHeader := buildOAuthHeader(params)
 
 	// Make request
-	req, err := http.NewRequest("POST", config.AccessTokenURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", config.AccessTokenURL, nil)
 	if err != nil {
 		return "", "", err
 	}
@@ -336,7 +352,7 @@ func getTrelloAccessToken(config *TrelloOAuthConfig, oauthToken, oauthVerifier,
 	req.Header.Set("Authorization", authHeader)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := services.TracedHTTPClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", "", err
@@ -371,7 +387,7 @@ func getTrelloAccessToken(config *TrelloOAuthConfig, oauthToken, oauthVerifier,
 }
 
 // getTrelloUserInfo retrieves user information from Trello API
-func getTrelloUserInfo(config *TrelloOAuthConfig, accessToken, accessTokenSecret string) (*TrelloUserInfo, error) {
+func getTrelloUserInfo(ctx context.Context, config *TrelloOAuthConfig, accessToken, accessTokenSecret string) (*TrelloUserInfo, error) {
 	userInfoURL := "https://api.trello.com/1/members/me"
 
 	// OAuth 1.0a parameters for API call
@@ -392,14 +408,14 @@ func getTrelloUserInfo(config *TrelloOAuthConfig, accessToken, accessTokenSecret
 	authHeader := buildOAuthHeader(params)
 
 	// Make request
-	req, err := http.NewRequest("GET", userInfoURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", userInfoURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Authorization", authHeader)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := services.TracedHTTPClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -423,7 +439,7 @@ func getTrelloUserInfo(config *TrelloOAuthConfig, accessToken, accessTokenSecret
 func storeTrelloTokens(userID string, accessToken, accessTokenSecret string, userInfo *TrelloUserInfo) error {
 	// Create app connection record
 	connection := map[string]interface{}{
-		"status":              constants.StatusConnected,
+		"status":              models.ConnectionConnected,
 		"access_token":        accessToken,
 		"access_token_secret": accessTokenSecret, // OAuth 1.0a specific
 		"token_type":          "OAuth1.0a",
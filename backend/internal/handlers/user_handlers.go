@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 
 	"cloudgate-backend/internal/services"
 
@@ -140,13 +139,12 @@ func (h *UserHandlers) GetAuditLogs(c *gin.Context) {
 		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 50
+	page, ok := parseListPage(c, services.AuditLogFilterSchema, 50, 500)
+	if !ok {
+		return
 	}
 
-	logs, err := h.userService.GetUserAuditLogs(userID.(uuid.UUID), limit)
+	logs, total, err := h.userService.ListUserAuditLogs(userID.(uuid.UUID), page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit logs"})
 		return
@@ -154,63 +152,9 @@ func (h *UserHandlers) GetAuditLogs(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"audit_logs": logs,
-	})
-}
-
-// GetSessions retrieves active sessions for the current user
-func (h *UserHandlers) GetSessions(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	sessions, err := h.sessionService.GetUserSessions(userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"sessions": sessions,
-	})
-}
-
-// InvalidateSession invalidates a specific session
-func (h *UserHandlers) InvalidateSession(c *gin.Context) {
-	sessionToken := c.Param("token")
-	if sessionToken == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Session token is required"})
-		return
-	}
-
-	err := h.sessionService.InvalidateSession(sessionToken)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate session"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Session invalidated successfully",
-	})
-}
-
-// InvalidateAllSessions invalidates all sessions for the current user
-func (h *UserHandlers) InvalidateAllSessions(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	err := h.sessionService.InvalidateAllUserSessions(userID.(uuid.UUID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate sessions"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "All sessions invalidated successfully",
+		"total":      total,
+		"limit":      page.Limit,
+		"offset":     page.Offset,
 	})
 }
 
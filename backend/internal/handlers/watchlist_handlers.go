@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WatchlistHandlers contains watchlist HTTP handlers
+type WatchlistHandlers struct {
+	watchlistService *services.WatchlistService
+}
+
+// NewWatchlistHandlers creates new watchlist handlers
+func NewWatchlistHandlers(watchlistService *services.WatchlistService) *WatchlistHandlers {
+	return &WatchlistHandlers{
+		watchlistService: watchlistService,
+	}
+}
+
+// AddToWatchlistRequest represents a request to flag a user
+type AddToWatchlistRequest struct {
+	UserID             string  `json:"user_id" binding:"required"`
+	Reason             string  `json:"reason" binding:"required"`
+	DurationDays       int     `json:"duration_days"`
+	ThresholdFactor    float64 `json:"threshold_factor"`
+	FullSessionLogging *bool   `json:"full_session_logging"`
+}
+
+// ListWatchlist returns all active watchlist entries
+func (h *WatchlistHandlers) ListWatchlist(c *gin.Context) {
+	entries, err := h.watchlistService.ListActive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get watchlist", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// AddToWatchlist flags a user for enhanced monitoring
+func (h *WatchlistHandlers) AddToWatchlist(c *gin.Context) {
+	var req AddToWatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	fullSessionLogging := true
+	if req.FullSessionLogging != nil {
+		fullSessionLogging = *req.FullSessionLogging
+	}
+
+	entry, err := h.watchlistService.AddToWatchlist(
+		userID,
+		getAnalystID(c),
+		req.Reason,
+		time.Duration(req.DurationDays)*24*time.Hour,
+		req.ThresholdFactor,
+		fullSessionLogging,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to watchlist", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"entry": entry})
+}
+
+// RemoveFromWatchlist ends enhanced monitoring for a user
+func (h *WatchlistHandlers) RemoveFromWatchlist(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = h.watchlistService.RemoveFromWatchlist(userID, getAnalystID(c))
+	if errors.Is(err, services.ErrNotOnWatchlist) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not on the watchlist"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from watchlist", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User removed from watchlist"})
+}
+
+// GetWatchlistTimeline returns the activity recorded for a watched user
+func (h *WatchlistHandlers) GetWatchlistTimeline(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	entry, watched := h.watchlistService.GetActiveEntry(userID)
+	if !watched {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not on the watchlist"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	activity, total, err := h.watchlistService.GetActivity(userID, entry.CreatedAt, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get activity", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entry":    entry,
+		"activity": activity,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// WatchlistSessionLogger records every authenticated request made by watched users
+// who have full session logging enabled. It runs after the handler so the user is known.
+func (h *WatchlistHandlers) WatchlistSessionLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		userIDVal, exists := c.Get("userID")
+		if !exists {
+			return
+		}
+		userID, ok := userIDVal.(uuid.UUID)
+		if !ok {
+			return
+		}
+
+		entry, watched := h.watchlistService.GetActiveEntry(userID)
+		if !watched || !entry.FullSessionLogging {
+			return
+		}
+
+		status := "success"
+		if c.Writer.Status() >= 400 {
+			status = "failure"
+		}
+		details := fmt.Sprintf("%s %s -> %d (%s)", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), time.Since(start))
+		services.LogAuditEvent(c.Request.Context(), userID.String(), "watchlist_request", "http", c.FullPath(), c.ClientIP(), c.GetHeader("User-Agent"), details, status)
+	}
+}
+
+// getAnalystID returns the authenticated caller's ID for attribution, if any
+func getAnalystID(c *gin.Context) *uuid.UUID {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		return nil
+	}
+	if userID, ok := userIDVal.(uuid.UUID); ok {
+		return &userID
+	}
+	return nil
+}
@@ -1,16 +1,20 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
+	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 )
 
@@ -156,13 +160,18 @@ func WebAuthnRegistrationBeginHandler(c *gin.Context) {
 	}
 
 	// Generate challenge
-	challenge := generateChallenge()
+	challenge, err := issueWebAuthnChallenge(c, "webauthn.create", userID)
+	if err != nil {
+		log.Printf("Error issuing WebAuthn challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin registration"})
+		return
+	}
 
 	// Create registration options for JSON response
 	options := WebAuthnPublicKeyCredentialCreationOptionsJSON{
 		Challenge: base64.URLEncoding.EncodeToString(challenge),
 		RP: WebAuthnRelyingParty{
-			ID:   "localhost",
+			ID:   services.WebAuthnRPID(),
 			Name: "CloudGate SSO",
 			Icon: "https://cloudgate.example.com/icon.png",
 		},
@@ -230,15 +239,24 @@ func WebAuthnRegistrationFinishHandler(c *gin.Context) {
 		return
 	}
 
-	// Verify challenge (in production, verify against stored challenge)
+	// Verify challenge and ceremony type
 	if clientData["type"] != "webauthn.create" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ceremony type"})
 		return
 	}
+	if !verifyWebAuthnChallenge(c, "webauthn.create", userID, clientData) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
 
-	// Store credential
+	// Verify the origin and authenticator data, then store the credential's public key
 	credentialID := request.Credential.ID
-	err := services.StoreWebAuthnCredential(userID, credentialID, request.Credential.Response.AttestationObject)
+	err := services.RegisterWebAuthnCredential(userID, credentialID, request.Credential.Response.ClientDataJSON, request.Credential.Response.AttestationObject)
+	if errors.Is(err, services.ErrInvalidWebAuthnResponse) {
+		log.Printf("Rejected WebAuthn registration: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential"})
+		return
+	}
 	if err != nil {
 		log.Printf("Error storing WebAuthn credential: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store credential"})
@@ -246,7 +264,7 @@ func WebAuthnRegistrationFinishHandler(c *gin.Context) {
 	}
 
 	// Log WebAuthn registration
-	services.LogAuditEvent(userID, "webauthn_registered", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "WebAuthn credential registered", "success")
+	services.LogAuditEvent(c.Request.Context(), userID, "webauthn_registered", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "WebAuthn credential registered", "success")
 
 	response := WebAuthnRegistrationResponse{
 		Success: true,
@@ -264,8 +282,10 @@ func WebAuthnAuthenticationBeginHandler(c *gin.Context) {
 		return
 	}
 
-	// Generate challenge
-	challenge := generateChallenge()
+	// Each authentication prompts the user's authenticator, so it counts towards fatigue
+	if checkStepUpPaused(c, userID, true) {
+		return
+	}
 
 	// Get user's credentials
 	credentials, err := services.GetUserWebAuthnCredentials(userID)
@@ -280,6 +300,14 @@ func WebAuthnAuthenticationBeginHandler(c *gin.Context) {
 		return
 	}
 
+	// Generate challenge
+	challenge, err := issueWebAuthnChallenge(c, "webauthn.get", userID)
+	if err != nil {
+		log.Printf("Error issuing WebAuthn challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin authentication"})
+		return
+	}
+
 	// Create authentication options
 	allowCredentials := make([]WebAuthnPublicKeyCredentialDescriptorJSON, len(credentials))
 	for i, cred := range credentials {
@@ -293,7 +321,7 @@ func WebAuthnAuthenticationBeginHandler(c *gin.Context) {
 	options := WebAuthnPublicKeyCredentialRequestOptionsJSON{
 		Challenge:        base64.URLEncoding.EncodeToString(challenge),
 		Timeout:          60000, // 60 seconds
-		RPID:             "localhost",
+		RPID:             services.WebAuthnRPID(),
 		AllowCredentials: allowCredentials,
 		UserVerification: "preferred",
 	}
@@ -308,6 +336,9 @@ func WebAuthnAuthenticationFinishHandler(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
+	if checkStepUpPaused(c, userID, false) {
+		return
+	}
 
 	var request WebAuthnAuthenticationRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -334,33 +365,45 @@ func WebAuthnAuthenticationFinishHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ceremony type"})
 		return
 	}
-
-	// Verify credential exists
-	credentialID := request.Credential.ID
-	exists, err := services.VerifyWebAuthnCredential(userID, credentialID)
-	if err != nil {
-		log.Printf("Error verifying WebAuthn credential: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify credential"})
+	if !verifyWebAuthnChallenge(c, "webauthn.get", userID, clientData) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired challenge"})
 		return
 	}
 
-	if !exists {
+	// Verify the assertion's signature against the stored public key
+	credentialID := request.Credential.ID
+	_, err := services.VerifyWebAuthnAssertion(userID, services.WebAuthnAssertion{
+		CredentialID:      credentialID,
+		ClientDataJSON:    request.Credential.Response.ClientDataJSON,
+		AuthenticatorData: request.Credential.Response.AuthenticatorData,
+		Signature:         request.Credential.Response.Signature,
+	})
+	if errors.Is(err, services.ErrWebAuthnCredentialNotFound) || errors.Is(err, services.ErrInvalidWebAuthnResponse) || errors.Is(err, services.ErrWebAuthnSignCountRegressed) {
+		log.Printf("Rejected WebAuthn assertion for user %s: %v", userID, err)
+		status := "failure"
+		if errors.Is(err, services.ErrWebAuthnSignCountRegressed) {
+			status = "warning"
+		}
+		services.LogAuditEvent(c.Request.Context(), userID, "webauthn_authentication", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), fmt.Sprintf("WebAuthn authentication rejected: %v", err), status)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credential"})
 		return
 	}
-
-	// Update credential usage
-	err = services.UpdateWebAuthnCredentialUsage(userID, credentialID)
 	if err != nil {
-		log.Printf("Error updating credential usage: %v", err)
-		// Don't fail authentication for this
+		log.Printf("Error verifying WebAuthn assertion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify credential"})
+		return
 	}
 
 	// Log WebAuthn authentication
-	services.LogAuditEvent(userID, "webauthn_authentication", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "WebAuthn authentication successful", "success")
+	services.LogAuditEvent(c.Request.Context(), userID, "webauthn_authentication", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), "WebAuthn authentication successful", "success")
 
-	// Generate session token (simplified)
-	token := generateSessionToken()
+	// Raise the session to AAL3; access tokens not bound to a session cannot be stepped up
+	token, _, err := stepUpSession(c, models.AAL3)
+	if err != nil {
+		log.Printf("Error stepping up session after WebAuthn: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session could not be stepped up; sign in again"})
+		return
+	}
 
 	response := WebAuthnAuthenticationResponse{
 		Success: true,
@@ -414,7 +457,7 @@ func DeleteWebAuthnCredentialHandler(c *gin.Context) {
 	}
 
 	// Log credential deletion
-	services.LogAuditEvent(userID, "webauthn_credential_deleted", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), fmt.Sprintf("WebAuthn credential deleted: %s", credentialID), "warning")
+	services.LogAuditEvent(c.Request.Context(), userID, "webauthn_credential_deleted", "user", userID, c.ClientIP(), c.GetHeader("User-Agent"), fmt.Sprintf("WebAuthn credential deleted: %s", credentialID), "warning")
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "WebAuthn credential deleted successfully",
@@ -422,18 +465,42 @@ func DeleteWebAuthnCredentialHandler(c *gin.Context) {
 }
 
 // Helper functions
-func generateChallenge() []byte {
-	// Generate cryptographically secure random challenge
+
+// webAuthnChallengeTTL outlasts the 60 second timeout the options give the browser
+const webAuthnChallengeTTL = 2 * time.Minute
+
+func webAuthnChallengeKey(ceremony, userID string) string {
+	return "webauthn_challenge:" + ceremony + ":" + userID
+}
+
+// issueWebAuthnChallenge creates a random challenge for the user's ceremony and keeps it in
+// the shared cache, so the ceremony can finish on any instance. Beginning a ceremony again
+// replaces the challenge.
+func issueWebAuthnChallenge(c *gin.Context, ceremony, userID string) ([]byte, error) {
 	challenge := make([]byte, 32)
-	// In production, use crypto/rand
-	for i := range challenge {
-		challenge[i] = byte(time.Now().UnixNano() % 256)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
 	}
-	return challenge
+	if err := services.SharedCache().Set(c.Request.Context(), webAuthnChallengeKey(ceremony, userID), challenge, webAuthnChallengeTTL); err != nil {
+		return nil, err
+	}
+	return challenge, nil
 }
 
-func generateSessionToken() string {
-	return uuid.New().String()
+// verifyWebAuthnChallenge reports whether the client data carries the challenge issued for
+// the user's ceremony. The challenge is taken from the cache, so it is only accepted once.
+func verifyWebAuthnChallenge(c *gin.Context, ceremony, userID string, clientData map[string]interface{}) bool {
+	issued, err := services.SharedCache().Take(c.Request.Context(), webAuthnChallengeKey(ceremony, userID))
+	if err != nil {
+		if !errors.Is(err, services.ErrCacheMiss) {
+			log.Printf("Error reading WebAuthn challenge: %v", err)
+		}
+		return false
+	}
+	// Browsers return the challenge base64url-encoded without padding
+	encoded, _ := clientData["challenge"].(string)
+	signed, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	return err == nil && subtle.ConstantTimeCompare(signed, issued) == 1
 }
 
 // Helper function removed - using inline struct instead
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxWebhookSample bounds the sample payload a consumer can post for verification
+const maxWebhookSample = 1 << 20
+
+// WebhookConsumerHandlers contains the HTTP handlers for webhook consumers and their
+// signing keys
+type WebhookConsumerHandlers struct {
+	signing *services.WebhookSigningService
+}
+
+// NewWebhookConsumerHandlers creates new webhook consumer handlers
+func NewWebhookConsumerHandlers(signing *services.WebhookSigningService) *WebhookConsumerHandlers {
+	return &WebhookConsumerHandlers{signing: signing}
+}
+
+// ListConsumers returns every webhook consumer with its signing keys
+func (h *WebhookConsumerHandlers) ListConsumers(c *gin.Context) {
+	consumers, err := h.signing.ListConsumers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhook consumers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consumers": consumers, "count": len(consumers)})
+}
+
+// GetConsumer returns a webhook consumer with its signing keys
+func (h *WebhookConsumerHandlers) GetConsumer(c *gin.Context) {
+	id, ok := parseWebhookConsumerID(c)
+	if !ok {
+		return
+	}
+	consumer, err := h.signing.GetConsumer(id)
+	if errors.Is(err, services.ErrWebhookConsumerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook consumer not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook consumer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consumer": consumer})
+}
+
+// CreateConsumer registers a webhook consumer. The first key's secret is only shown here.
+func (h *WebhookConsumerHandlers) CreateConsumer(c *gin.Context) {
+	var input services.WebhookConsumerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	consumer, key, secret, err := h.signing.CreateConsumer(input, getAnalystID(c), time.Now())
+	if errors.Is(err, services.ErrInvalidWebhookConsumer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook consumer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"consumer": consumer, "key": key, "secret": secret})
+}
+
+// UpdateConsumer replaces a webhook consumer's registration
+func (h *WebhookConsumerHandlers) UpdateConsumer(c *gin.Context) {
+	id, ok := parseWebhookConsumerID(c)
+	if !ok {
+		return
+	}
+	var input services.WebhookConsumerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "message": err.Error()})
+		return
+	}
+	consumer, err := h.signing.UpdateConsumer(id, input, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrWebhookConsumerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook consumer not found"})
+		return
+	case errors.Is(err, services.ErrInvalidWebhookConsumer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook consumer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consumer": consumer})
+}
+
+// DeleteConsumer removes a webhook consumer and its signing keys
+func (h *WebhookConsumerHandlers) DeleteConsumer(c *gin.Context) {
+	id, ok := parseWebhookConsumerID(c)
+	if !ok {
+		return
+	}
+	err := h.signing.DeleteConsumer(id, getAnalystID(c))
+	if errors.Is(err, services.ErrWebhookConsumerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook consumer not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook consumer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook consumer deleted"})
+}
+
+// RotateKey issues a new signing key for a consumer; its secret is only shown here
+func (h *WebhookConsumerHandlers) RotateKey(c *gin.Context) {
+	id, ok := parseWebhookConsumerID(c)
+	if !ok {
+		return
+	}
+	key, secret, err := h.signing.RotateKey(id, getAnalystID(c), time.Now())
+	if errors.Is(err, services.ErrWebhookConsumerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook consumer not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"key": key, "secret": secret})
+}
+
+// RevokeKey stops a signing key from signing at once
+func (h *WebhookConsumerHandlers) RevokeKey(c *gin.Context) {
+	id, ok := parseWebhookConsumerID(c)
+	if !ok {
+		return
+	}
+	err := h.signing.RevokeKey(id, c.Param("keyId"), getAnalystID(c), time.Now())
+	switch {
+	case errors.Is(err, services.ErrWebhookConsumerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook consumer not found"})
+		return
+	case errors.Is(err, services.ErrWebhookKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Signing key not found or already retired"})
+		return
+	case errors.Is(err, services.ErrLastWebhookKey):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke signing key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signing key revoked"})
+}
+
+// VerifySignature lets a consumer check their signing implementation: they post a
+// sample payload as the raw body with the X-CloudGate-Signature they computed for it.
+// Only validity is revealed, never a signature.
+func (h *WebhookConsumerHandlers) VerifySignature(c *gin.Context) {
+	id, ok := parseWebhookConsumerID(c)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSample+1))
+	if err != nil || len(body) > maxWebhookSample {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The sample payload must be at most 1 MiB"})
+		return
+	}
+	verification, err := h.signing.Verify(id, body, c.GetHeader(services.WebhookSignatureHeader), time.Now())
+	if errors.Is(err, services.ErrWebhookConsumerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook consumer not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify signature"})
+		return
+	}
+
+	c.JSON(http.StatusOK, verification)
+}
+
+func parseWebhookConsumerID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("consumerId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook consumer ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WebhookHandlers contains webhook dead-letter HTTP handlers
+type WebhookHandlers struct {
+	webhookService *services.WebhookService
+}
+
+// NewWebhookHandlers creates new webhook handlers
+func NewWebhookHandlers(webhookService *services.WebhookService) *WebhookHandlers {
+	return &WebhookHandlers{
+		webhookService: webhookService,
+	}
+}
+
+// BulkReplayRequest selects dead letters to replay, either by ID or by filter
+type BulkReplayRequest struct {
+	IDs       []string `json:"ids"`
+	Source    string   `json:"source"`
+	EventType string   `json:"event_type"`
+}
+
+// ListDeadLetters returns failed deliveries, filtered by ?source=&status=&event_type=
+func (h *WebhookHandlers) ListDeadLetters(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	deadLetters, total, err := h.webhookService.ListDeadLetters(services.DeadLetterFilter{
+		Source:    c.Query("source"),
+		Status:    c.Query("status"),
+		EventType: c.Query("event_type"),
+	}, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list dead letters", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letters": deadLetters, "total": total, "limit": limit, "offset": offset})
+}
+
+// GetDeadLetter returns a failed delivery with its payload and the receiver's last response
+func (h *WebhookHandlers) GetDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	deadLetter, err := h.webhookService.GetDeadLetter(id)
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dead letter", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letter": deadLetter})
+}
+
+// ReplayDeadLetter redelivers a single failed delivery
+func (h *WebhookHandlers) ReplayDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	deadLetter, err := h.webhookService.Replay(c.Request.Context(), id, getAnalystID(c))
+	switch {
+	case errors.Is(err, services.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	case errors.Is(err, services.ErrDeadLetterReplayed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Dead letter already replayed"})
+		return
+	case errors.Is(err, services.ErrWebhookDeliveryFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Replay failed", "message": err.Error(), "dead_letter": deadLetter})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay dead letter", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letter": deadLetter})
+}
+
+// ReplayDeadLetters redelivers several failed deliveries, by ID or by source/event type
+func (h *WebhookHandlers) ReplayDeadLetters(c *gin.Context) {
+	var req BulkReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "message": err.Error()})
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.IDs))
+	for _, raw := range req.IDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dead letter ID", "message": raw})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	results, err := h.webhookService.ReplayBulk(c.Request.Context(), ids, services.DeadLetterFilter{Source: req.Source, EventType: req.EventType}, getAnalystID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay dead letters", "message": err.Error()})
+		return
+	}
+
+	delivered := 0
+	for _, result := range results {
+		if result.Delivered {
+			delivered++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "replayed": len(results), "delivered": delivered})
+}
+
+// DiscardDeadLetter deletes a failed delivery without replaying it
+func (h *WebhookHandlers) DiscardDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	err := h.webhookService.DiscardDeadLetter(id, getAnalystID(c))
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard dead letter", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter discarded"})
+}
+
+func parseDeadLetterID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dead letter ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
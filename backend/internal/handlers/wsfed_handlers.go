@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WSFederationHandlers contains the WS-Federation passive requestor handlers
+type WSFederationHandlers struct {
+	wsfedService    *services.WSFederationService
+	consentService  *services.ConsentService
+	scheduleService *services.AccessScheduleService
+	policyService   *services.AppSessionPolicyService
+}
+
+// NewWSFederationHandlers creates new WS-Federation handlers
+func NewWSFederationHandlers(wsfedService *services.WSFederationService, consentService *services.ConsentService, scheduleService *services.AccessScheduleService, policyService *services.AppSessionPolicyService) *WSFederationHandlers {
+	return &WSFederationHandlers{
+		wsfedService:    wsfedService,
+		consentService:  consentService,
+		scheduleService: scheduleService,
+		policyService:   policyService,
+	}
+}
+
+// PassiveSignIn answers a relying party's wsignin1.0 request for the signed-in user with a
+// signed token, posted back to the app's registered reply address by the browser
+func (h *WSFederationHandlers) PassiveSignIn(c *gin.Context) {
+	req := services.WSFedSignInRequest{
+		Action:  c.Query("wa"),
+		Realm:   c.Query("wtrealm"),
+		ReplyTo: c.Query("wreply"),
+		Context: c.Query("wctx"),
+	}
+
+	userID := getUserIDFromContext(c)
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	app, exists := services.GetWSFedAppByRealm(req.Realm)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Application not found", "message": fmt.Sprintf("No WS-Federation application is registered for realm %q", req.Realm)})
+		return
+	}
+
+	// Apps may demand a stronger session than a password login provides
+	if app.RequiredAAL > c.GetInt("aal") {
+		middleware.ChallengeStepUp(c, gin.H{
+			"message":      fmt.Sprintf("%s requires a stronger authentication method", app.Name),
+			"current_aal":  c.GetInt("aal"),
+			"required_aal": app.RequiredAAL,
+		})
+		return
+	}
+	if !checkConsent(c, h.consentService, userUUID, app.ID) || !checkAccessSchedule(c, h.scheduleService, userUUID, app.ID) {
+		return
+	}
+	sessionEnds, ok := checkAppSessionPolicy(c, h.policyService, app)
+	if !ok {
+		return
+	}
+
+	subject := services.WSFedSubject{
+		UserID:       userID,
+		Email:        c.GetString("email"),
+		Name:         c.GetString("username"),
+		AAL:          c.GetInt("aal"),
+		NotOnOrAfter: sessionEnds,
+	}
+	response, err := h.wsfedService.IssueSignInResponse(app, req, subject, time.Now())
+	if err != nil {
+		services.LogAuditEvent(c.Request.Context(), userID, "wsfed_sign_in", "app", app.ID, c.ClientIP(), c.GetHeader("User-Agent"), err.Error(), "failure")
+		switch {
+		case errors.Is(err, services.ErrInvalidWSFedRequest), errors.Is(err, services.ErrWSFedNotConfigured):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid WS-Federation request", "message": err.Error()})
+		default:
+			log.Printf("Error issuing WS-Federation token for %s: %v", app.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		}
+		return
+	}
+
+	analyticsService := services.NewAnalyticsService(services.GetDB())
+	if err := analyticsService.RecordAppLaunch(userUUID, app.ID, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+		log.Printf("Error recording app launch: %v", err)
+	}
+	services.LogAuditEvent(c.Request.Context(), userID, "wsfed_sign_in", "app", app.ID, c.ClientIP(), c.GetHeader("User-Agent"),
+		fmt.Sprintf("WS-Federation token %s issued for %s", response.AssertionID, app.ID), "success")
+
+	htmlForm := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>CloudGate WS-Federation SSO</title>
+</head>
+<body onload="document.forms[0].submit()">
+    <form method="post" action="%s">
+        <input type="hidden" name="wa" value="%s" />
+        <input type="hidden" name="wresult" value="%s" />
+        <input type="hidden" name="wctx" value="%s" />
+        <noscript>
+            <p>Your browser does not support JavaScript. Please click the button below to continue.</p>
+            <input type="submit" value="Continue" />
+        </noscript>
+    </form>
+    <p>Redirecting to %s...</p>
+</body>
+</html>`, html.EscapeString(response.ReplyTo), services.WSFedActionSignIn, html.EscapeString(response.Result), html.EscapeString(response.Context), html.EscapeString(app.Name))
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, htmlForm)
+}
+
+// FederationMetadata publishes the issuer's signing certificate and passive endpoint for
+// relying parties to import
+func (h *WSFederationHandlers) FederationMetadata(c *gin.Context) {
+	passiveEndpoint := getEnv("BACKEND_URL", "http://localhost:8081") + "/wsfed"
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.String(http.StatusOK, h.wsfedService.FederationMetadata(passiveEndpoint))
+}
@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"cmp"
+	"context"
 	"log"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/models"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -25,6 +31,8 @@ func SetupCORS(cfg *config.Config) gin.HandlerFunc {
 		"Accept",
 		"Authorization",
 		"X-Requested-With",
+		"X-Device-ID",
+		"X-Session-Activity",
 		"Access-Control-Allow-Origin",
 		"Access-Control-Allow-Headers",
 		"Access-Control-Allow-Methods",
@@ -56,6 +64,156 @@ func SecurityHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
+// TokenRevocationChecker decides whether an otherwise valid access token may still be used,
+// e.g. after an emergency sign-out. requiredAAL is the minimum assurance level it must carry.
+type TokenRevocationChecker interface {
+	CheckToken(email string, issuedAt time.Time) (revoked bool, requiredAAL int, reason string)
+}
+
+var revocationChecker TokenRevocationChecker
+
+// SetTokenRevocationChecker installs the checker consulted by AuthenticationMiddleware
+func SetTokenRevocationChecker(checker TokenRevocationChecker) {
+	revocationChecker = checker
+}
+
+// ImpersonationChecker confirms that an impersonation session is still active, so its
+// access tokens stop working as soon as the impersonation ends
+type ImpersonationChecker interface {
+	CheckImpersonation(sessionID, impersonatorID uuid.UUID, now time.Time) error
+}
+
+var impersonationChecker ImpersonationChecker
+
+// SetImpersonationChecker installs the checker consulted by AuthenticationMiddleware
+// for tokens that carry an impersonating actor
+func SetImpersonationChecker(checker ImpersonationChecker) {
+	impersonationChecker = checker
+}
+
+// SessionActivityTracker ends sessions left idle past their timeout and records each
+// request made with a session as activity, unless it is passive
+type SessionActivityTracker interface {
+	RecordActivity(sessionID uuid.UUID, active bool, now time.Time) (ended bool, reason string)
+}
+
+var sessionActivityTracker SessionActivityTracker
+
+// SetSessionActivityTracker installs the tracker consulted by AuthenticationMiddleware for
+// tokens issued for a CloudGate session
+func SetSessionActivityTracker(tracker SessionActivityTracker) {
+	sessionActivityTracker = tracker
+}
+
+// StepUpGuard counts the step-up challenges issued to each user and pauses them when they
+// come too fast, as they do when someone holding the user's credentials bombs them with prompts
+type StepUpGuard interface {
+	RecordChallenge(userID uuid.UUID, ipAddress, userAgent string, now time.Time) (blockedUntil time.Time, blocked bool)
+}
+
+var stepUpGuard StepUpGuard
+
+// SetStepUpGuard installs the guard consulted whenever a step-up is required
+func SetStepUpGuard(guard StepUpGuard) {
+	stepUpGuard = guard
+}
+
+// RoleChecker reports whether a user holds any of the given roles
+type RoleChecker interface {
+	HasRole(userID uuid.UUID, roles ...string) (bool, error)
+}
+
+var roleChecker RoleChecker
+
+// SetRoleChecker installs the checker consulted by RequireRole
+func SetRoleChecker(checker RoleChecker) {
+	roleChecker = checker
+}
+
+// ExternalTokenVerifier verifies access tokens issued by an external identity provider,
+// such as a Keycloak realm, and maps them to CloudGate users
+type ExternalTokenVerifier interface {
+	Issuer() string
+	VerifyToken(ctx context.Context, token string, now time.Time) (*models.TokenIdentity, error)
+}
+
+var externalTokenVerifiers []ExternalTokenVerifier
+
+// SetExternalTokenVerifier installs the verifier AuthenticationMiddleware hands tokens
+// from its issuer to, replacing any earlier one for that issuer, or removes them all when
+// nil; CloudGate's own tokens are still verified with the JWT secret
+func SetExternalTokenVerifier(verifier ExternalTokenVerifier) {
+	if verifier == nil {
+		externalTokenVerifiers = nil
+		return
+	}
+	externalTokenVerifiers = slices.DeleteFunc(externalTokenVerifiers, func(existing ExternalTokenVerifier) bool {
+		return existing.Issuer() == verifier.Issuer()
+	})
+	externalTokenVerifiers = append(externalTokenVerifiers, verifier)
+}
+
+// routeScopes maps a route's method and full path to the API scope a scope-limited token needs
+var routeScopes = make(map[string]string)
+
+// RequireScope declares the API scope an access token issued to a third-party client must
+// hold to call a route, given by its method and full path as registered with gin. Such
+// tokens are refused on every route not declared; CloudGate's own tokens are not limited.
+func RequireScope(method, path, scope string) {
+	routeScopes[method+" "+path] = scope
+}
+
+// ScopedRoute is a route third-party clients may call with the API scope
+type ScopedRoute struct {
+	Method string
+	Path   string
+	Scope  string
+}
+
+// ScopedRoutes lists the routes declared with RequireScope, ordered by path and method
+func ScopedRoutes() []ScopedRoute {
+	routes := make([]ScopedRoute, 0, len(routeScopes))
+	for route, scope := range routeScopes {
+		method, path, _ := strings.Cut(route, " ")
+		routes = append(routes, ScopedRoute{Method: method, Path: path, Scope: scope})
+	}
+	slices.SortFunc(routes, func(a, b ScopedRoute) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+	return routes
+}
+
+// ChallengeStepUp answers a request whose session must step up: step_up_required with
+// response's fields, or step_up_blocked while the user's prompts are paused. It aborts the request.
+func ChallengeStepUp(c *gin.Context, response gin.H) {
+	if value, ok := c.Get("userID"); ok && stepUpGuard != nil {
+		if userID, ok := value.(uuid.UUID); ok {
+			if until, blocked := stepUpGuard.RecordChallenge(userID, c.ClientIP(), c.GetHeader("User-Agent"), time.Now()); blocked {
+				StepUpBlocked(c, until)
+				return
+			}
+		}
+	}
+	response["error"] = "step_up_required"
+	c.JSON(http.StatusForbidden, response)
+	c.Abort()
+}
+
+// StepUpBlocked refuses to prompt a user whose step-ups are paused until the given time
+func StepUpBlocked(c *gin.Context, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":         "step_up_blocked",
+		"message":       "Too many verification prompts were requested for your account, so they are paused. If you did not request them, change your password.",
+		"blocked_until": until,
+	})
+	c.Abort()
+}
+
+// stepUpPaths stay reachable while a stronger assurance level is enforced, so users can satisfy it
+var stepUpPaths = []string{"/user/mfa/", "/webauthn/authenticate/"}
+
 // AuthenticationMiddleware validates the JWT token and sets user context
 func AuthenticationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -84,6 +242,28 @@ func AuthenticationMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if verifier := externalVerifierFor(tokenString); verifier != nil {
+			identity, err := verifier.VerifyToken(c.Request.Context(), tokenString, time.Now())
+			if err != nil {
+				log.Printf("Rejected identity provider token: %v", err)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+			if identity.Scopes != nil {
+				if !allowScopes(c, identity.Scopes) {
+					return
+				}
+				c.Set("scopes", identity.Scopes)
+			}
+			c.Set("roles", identity.Roles)
+			if len(identity.GrantedRoles) > 0 {
+				c.Set("grantedRoles", identity.GrantedRoles)
+			}
+			admitRequest(c, identity.UserID, identity.Username, identity.Email, identity.AAL, identity.IssuedAt)
+			return
+		}
+
 		cfg := config.LoadConfig()
 		parsedToken, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -119,15 +299,216 @@ func AuthenticationMiddleware() gin.HandlerFunc {
 			}
 		}
 		if userID == uuid.Nil {
-			userID, _ = uuid.Parse("12345678-1234-1234-1234-123456789012")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Abort()
+			return
 		}
 
 		username, _ := claims["username"].(string)
 		email, _ := claims["email"].(string)
 
-		c.Set("userID", userID)
-		c.Set("username", username)
-		c.Set("email", email)
+		// Tokens issued before session tracking carry no sid/aal and count as password-only
+		aal := models.AAL1
+		if aalVal, ok := claims["aal"].(float64); ok && int(aalVal) > aal {
+			aal = int(aalVal)
+		}
+		var sessionID uuid.UUID
+		if sid, ok := claims["sid"].(string); ok {
+			if id, err := uuid.Parse(sid); err == nil {
+				sessionID = id
+				c.Set("sessionID", sessionID)
+			}
+		}
+
+		// Impersonation tokens name the acting administrator in an RFC 8693 "act" claim
+		if act, ok := claims["act"].(map[string]interface{}); ok {
+			actorSub, _ := act["sub"].(string)
+			impersonatorID, err := uuid.Parse(actorSub)
+			if err != nil || sessionID == uuid.Nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				c.Abort()
+				return
+			}
+			if impersonationChecker != nil {
+				if err := impersonationChecker.CheckImpersonation(sessionID, impersonatorID, time.Now()); err != nil {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "impersonation_ended", "message": err.Error()})
+					c.Abort()
+					return
+				}
+			}
+			c.Set("impersonatorID", impersonatorID)
+		}
+
+		// Background polling marks itself passive so that it does not keep an idle session alive
+		if sessionID != uuid.Nil && sessionActivityTracker != nil {
+			active := !strings.EqualFold(c.GetHeader("X-Session-Activity"), "passive")
+			if ended, reason := sessionActivityTracker.RecordActivity(sessionID, active, time.Now()); ended {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "session_idle_timeout", "message": reason})
+				c.Abort()
+				return
+			}
+		}
+
+		var issuedAt time.Time
+		if iatVal, ok := claims["iat"].(float64); ok {
+			issuedAt = time.Unix(int64(iatVal), 0)
+		}
+		admitRequest(c, userID, username, email, aal, issuedAt)
+	}
+}
+
+// externalVerifierFor returns the verifier for the identity provider that issued a token,
+// or nil for CloudGate's own tokens. The issuer is read before verification only to
+// choose the verifier.
+func externalVerifierFor(tokenString string) ExternalTokenVerifier {
+	if len(externalTokenVerifiers) == 0 {
+		return nil
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil
+	}
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil || issuer == "" {
+		return nil
+	}
+	for _, verifier := range externalTokenVerifiers {
+		if verifier.Issuer() == issuer {
+			return verifier
+		}
+	}
+	return nil
+}
+
+// allowScopes refuses a scope-limited token on a route that needs a scope it does not hold,
+// or that was not opened to third-party clients, with an RFC 6750 insufficient_scope error
+func allowScopes(c *gin.Context, scopes []string) bool {
+	required, declared := routeScopes[c.Request.Method+" "+c.FullPath()]
+	if declared && slices.Contains(scopes, required) {
+		return true
+	}
+	challenge := `Bearer error="insufficient_scope"`
+	response := gin.H{"error": "insufficient_scope", "message": "This access token does not allow this request"}
+	if declared {
+		challenge += `, scope="` + required + `"`
+		response["required_scope"] = required
+	}
+	c.Header("WWW-Authenticate", challenge)
+	c.JSON(http.StatusForbidden, response)
+	c.Abort()
+	return false
+}
+
+// admitRequest applies revocations and step-up requirements to a verified token, then
+// sets the user context and continues the request
+func admitRequest(c *gin.Context, userID uuid.UUID, username, email string, aal int, issuedAt time.Time) {
+	if revocationChecker != nil {
+		revoked, requiredAAL, reason := revocationChecker.CheckToken(email, issuedAt)
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session_revoked", "message": reason})
+			c.Abort()
+			return
+		}
+		if aal < requiredAAL && !isStepUpPath(c.Request.URL.Path) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":        "step_up_required",
+				"message":      reason,
+				"current_aal":  aal,
+				"required_aal": requiredAAL,
+			})
+			c.Abort()
+			return
+		}
+	}
+
+	c.Set("userID", userID)
+	c.Set("username", username)
+	c.Set("email", email)
+	c.Set("aal", aal)
+	if userRateLimiter != nil && !userRateLimiter.limitUser(c, userID) {
+		return
+	}
+	c.Next()
+}
+
+// RequireAAL rejects requests whose session has not reached the given
+// authentication assurance level, telling the client to step up first
+func RequireAAL(level int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := c.GetInt("aal")
+		if current < level {
+			ChallengeStepUp(c, gin.H{
+				"message":      "This action requires a stronger authentication method",
+				"current_aal":  current,
+				"required_aal": level,
+			})
+			return
+		}
 		c.Next()
 	}
 }
+
+// RequireRole rejects requests from users holding none of the given roles. It runs after
+// AuthenticationMiddleware and fails closed when no checker is installed.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID uuid.UUID
+		if value, ok := c.Get("userID"); ok {
+			userID, _ = value.(uuid.UUID)
+		}
+		// Roles granted by a trusted identity provider's token need no lookup
+		if granted, ok := c.Get("grantedRoles"); ok && userID != uuid.Nil {
+			if held, ok := granted.([]string); ok && slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(held, role) }) {
+				c.Next()
+				return
+			}
+		}
+		if userID == uuid.Nil || roleChecker == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_role", "message": "You do not have access to this resource"})
+			c.Abort()
+			return
+		}
+		allowed, err := roleChecker.HasRole(userID, roles...)
+		if err != nil {
+			log.Printf("Error checking roles for user %s: %v", userID, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify access, please retry"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "insufficient_role",
+				"message":        "You do not have access to this resource",
+				"required_roles": roles,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// BlockDuringImpersonation rejects requests made through an impersonation session, for
+// security settings and other areas an administrator must not change on a user's behalf
+func BlockDuringImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonatorID"); impersonating {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "impersonation_restricted",
+				"message": "This action is not available while impersonating a user",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func isStepUpPath(path string) bool {
+	for _, prefix := range stepUpPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
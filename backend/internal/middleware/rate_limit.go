@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// rateLimitSweepInterval is how often full, idle buckets are dropped
+const rateLimitSweepInterval = 5 * time.Minute
+
+// Rate limit scopes reported when a request is refused
+const (
+	RateLimitScopeIP    = "ip"
+	RateLimitScopeUser  = "user"
+	RateLimitScopeRoute = "route"
+)
+
+// RateLimitHandler is told when a client starts being refused, once per run of refused
+// requests rather than for every one
+type RateLimitHandler func(c *gin.Context, scope, key string)
+
+// RateLimiter refuses requests beyond token-bucket limits per client IP, per signed-in user
+// and per client IP within route groups. Buckets live in memory, so the limits apply on
+// each instance separately.
+type RateLimiter struct {
+	limits   config.RateLimitConfig
+	prefixes []string // route group prefixes, longest first
+	onLimit  RateLimitHandler
+
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	limit   config.RateLimit
+	tokens  float64
+	updated time.Time
+	limited bool
+}
+
+// NewRateLimiter creates a rate limiter with the given limits
+func NewRateLimiter(limits config.RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*rateBucket),
+	}
+	for prefix := range limits.Routes {
+		l.prefixes = append(l.prefixes, prefix)
+	}
+	// Longer prefixes are more specific and win
+	sort.Slice(l.prefixes, func(i, j int) bool { return len(l.prefixes[i]) > len(l.prefixes[j]) })
+	return l
+}
+
+// OnLimit installs the handler told when a client starts being refused
+func (l *RateLimiter) OnLimit(handler RateLimitHandler) {
+	l.onLimit = handler
+}
+
+// LimitRequests applies the per-IP and route group limits to every request except CORS
+// preflights and health checks
+func (l *RateLimiter) LimitRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !l.limits.Enabled || c.Request.Method == http.MethodOptions || strings.HasPrefix(path, "/health") {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		if !l.allow(c, RateLimitScopeIP, ip, l.limits.PerIP) {
+			return
+		}
+		for _, prefix := range l.prefixes {
+			if strings.HasPrefix(path, prefix) {
+				if !l.allow(c, RateLimitScopeRoute, prefix+" "+ip, l.limits.Routes[prefix]) {
+					return
+				}
+				break
+			}
+		}
+		c.Next()
+	}
+}
+
+// limitUser applies the per-user limit once AuthenticationMiddleware knows who is calling
+func (l *RateLimiter) limitUser(c *gin.Context, userID uuid.UUID) bool {
+	if !l.limits.Enabled {
+		return true
+	}
+	return l.allow(c, RateLimitScopeUser, userID.String(), l.limits.PerUser)
+}
+
+// allow takes a token from the bucket for scope and key, writing a 429 response with
+// Retry-After and aborting the request when it is empty
+func (l *RateLimiter) allow(c *gin.Context, scope, key string, limit config.RateLimit) bool {
+	if limit.PerMinute <= 0 {
+		return true
+	}
+	allowed, retryAfter, started := l.take(scope+":"+key, limit)
+	if allowed {
+		return true
+	}
+
+	if started && l.onLimit != nil {
+		l.onLimit(c, scope, key)
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "rate_limit_exceeded",
+		"message":     fmt.Sprintf("Too many requests; try again in %d seconds", seconds),
+		"retry_after": seconds,
+	})
+	c.Abort()
+	return false
+}
+
+// take removes one token from a bucket. When it is empty it returns how long until a token
+// is available, and whether this is the first refusal since the bucket last allowed a request.
+func (l *RateLimiter) take(key string, limit config.RateLimit) (bool, time.Duration, bool) {
+	now := time.Now()
+	rate := float64(limit.PerMinute) / 60
+	burst := float64(max(limit.Burst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{limit: limit, tokens: burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = min(burst, bucket.tokens+elapsed*rate)
+		bucket.updated = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.limited = false
+		return true, 0, false
+	}
+
+	started := !bucket.limited
+	bucket.limited = true
+	wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	return false, wait, started
+}
+
+// sweep drops buckets that have refilled completely, which are no different from new ones
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		rate := float64(bucket.limit.PerMinute) / 60
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*rate >= float64(max(bucket.limit.Burst, 1)) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var userRateLimiter *RateLimiter
+
+// SetRateLimiter installs the limiter whose per-user limit AuthenticationMiddleware applies
+func SetRateLimiter(limiter *RateLimiter) {
+	userRateLimiter = limiter
+}
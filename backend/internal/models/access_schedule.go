@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Access override request statuses
+const (
+	OverrideStatusPending  = "pending"
+	OverrideStatusApproved = "approved"
+	OverrideStatusDenied   = "denied"
+)
+
+// AppAccessSchedule restricts when and from where an app may be launched or connected
+type AppAccessSchedule struct {
+	ID               uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID            string     `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	Timezone         string     `gorm:"type:text;not null" json:"timezone"` // IANA name, e.g. Europe/Berlin
+	StartTime        string     `gorm:"type:text" json:"start_time"`        // HH:MM local time, empty means no time window
+	EndTime          string     `gorm:"type:text" json:"end_time"`          // HH:MM; earlier than StartTime means overnight
+	Days             string     `gorm:"type:text" json:"days"`              // comma-separated weekdays (mon,tue,...), empty means every day
+	AllowedCountries string     `gorm:"type:text" json:"allowed_countries"` // comma-separated ISO codes, empty means anywhere
+	Enabled          bool       `json:"enabled"`
+	UpdatedBy        *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// AccessOverrideRequest asks an admin to let a user into an app outside its schedule
+type AccessOverrideRequest struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	AppID       string     `gorm:"type:text;not null;index" json:"app_id"`
+	Reason      string     `gorm:"type:text;not null" json:"reason"`
+	DurationMin int        `gorm:"not null" json:"duration_minutes"`
+	Status      string     `gorm:"type:text;not null;index" json:"status"`
+	ReviewedBy  *uuid.UUID `gorm:"type:text" json:"reviewed_by,omitempty"`
+	ReviewNote  string     `gorm:"type:text" json:"review_note,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// BeforeCreate hook to generate UUID
+func (s *AppAccessSchedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (o *AccessOverrideRequest) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether an approved override is still in force
+func (o *AccessOverrideRequest) IsActive() bool {
+	return o.Status == OverrideStatusApproved && o.ExpiresAt != nil && time.Now().Before(*o.ExpiresAt)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminNotification is an alert delivered to one admin or security analyst's in-app inbox
+type AdminNotification struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	RecipientID uuid.UUID  `gorm:"type:text;not null;index:idx_admin_notifications_recipient" json:"recipient_id"`
+	AlertID     *uuid.UUID `gorm:"type:text;index" json:"alert_id,omitempty"`
+	AlertType   string     `gorm:"type:text" json:"alert_type"`
+	Severity    string     `gorm:"type:text;not null;index" json:"severity"`
+	Title       string     `gorm:"type:text;not null" json:"title"`
+	Message     string     `gorm:"type:text" json:"message"`
+	ReadAt      *time.Time `gorm:"index" json:"read_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"index:idx_admin_notifications_recipient" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (n *AdminNotification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
@@ -9,12 +9,12 @@ import (
 
 // AppConnection represents a user's connection to a SaaS application
 type AppConnection struct {
-	ID       uuid.UUID `gorm:"type:text;primary_key" json:"id"`
-	UserID   uuid.UUID `gorm:"type:text;not null;index" json:"user_id"`
-	AppID    string    `gorm:"type:text;not null" json:"app_id"`
-	AppName  string    `gorm:"type:text;not null" json:"app_name"`
-	Provider string    `gorm:"type:text;not null" json:"provider"`
-	Status   string    `gorm:"type:text;not null;default:'pending'" json:"status"` // pending, connected, error, revoked
+	ID       uuid.UUID        `gorm:"type:text;primary_key" json:"id"`
+	UserID   uuid.UUID        `gorm:"type:text;not null;index" json:"user_id"`
+	AppID    string           `gorm:"type:text;not null" json:"app_id"`
+	AppName  string           `gorm:"type:text;not null" json:"app_name"`
+	Provider string           `gorm:"type:text;not null" json:"provider"`
+	Status   ConnectionStatus `gorm:"type:text;not null;default:'pending';check:chk_app_connections_status,status IN ('pending','connected','error','revoked')" json:"status"`
 
 	// OAuth specific fields
 	AccessToken    string     `gorm:"type:text" json:"-"`
@@ -25,15 +25,16 @@ type AppConnection struct {
 	// Connection details
 	UserEmail   string     `gorm:"type:text" json:"user_email,omitempty"`
 	UserName    string     `gorm:"type:text" json:"user_name,omitempty"`
+	Extras      string     `gorm:"type:text" json:"-"` // JSON provider account details, like username or instance_url
 	ConnectedAt time.Time  `json:"connected_at"`
 	LastUsed    *time.Time `json:"last_used,omitempty"`
 
 	// Health monitoring
-	LastHealthCheck *time.Time `json:"last_health_check,omitempty"`
-	HealthStatus    string     `gorm:"type:text;default:'unknown'" json:"health_status"` // healthy, warning, error, unknown
-	ResponseTime    int        `gorm:"default:0" json:"response_time_ms"`
-	ErrorCount      int        `gorm:"default:0" json:"error_count"`
-	UptimePercent   float64    `gorm:"default:100.0" json:"uptime_percent"`
+	LastHealthCheck *time.Time   `json:"last_health_check,omitempty"`
+	HealthStatus    HealthStatus `gorm:"type:text;default:'unknown';check:chk_app_connections_health_status,health_status IN ('healthy','unknown','warning','error')" json:"health_status"`
+	ResponseTime    int          `gorm:"default:0" json:"response_time_ms"`
+	ErrorCount      int          `gorm:"default:0" json:"error_count"`
+	UptimePercent   float64      `gorm:"default:100.0" json:"uptime_percent"`
 
 	// Usage statistics
 	UsageCount      int64      `gorm:"default:0" json:"usage_count"`
@@ -60,6 +61,17 @@ func (a *AppConnection) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// BeforeSave rejects statuses outside their enums; empty ones take the column defaults
+func (a *AppConnection) BeforeSave(tx *gorm.DB) error {
+	if a.Status != "" && !a.Status.Valid() {
+		return invalidValue("connection status", string(a.Status))
+	}
+	if a.HealthStatus != "" && !a.HealthStatus.Valid() {
+		return invalidValue("health status", string(a.HealthStatus))
+	}
+	return nil
+}
+
 // ConnectionHealthMetrics represents health metrics for a connection
 type ConnectionHealthMetrics struct {
 	ConnectionID   uuid.UUID `gorm:"type:text;primary_key" json:"connection_id"`
@@ -87,7 +99,7 @@ type SecurityEvent struct {
 	ConnectionID *uuid.UUID `gorm:"type:text;index" json:"connection_id,omitempty"`
 	EventType    string     `gorm:"type:text;not null" json:"event_type"` // login, suspicious_location, new_device, failed_mfa, token_refresh
 	Description  string     `gorm:"type:text;not null" json:"description"`
-	Severity     string     `gorm:"type:text;not null" json:"severity"` // low, medium, high, critical
+	Severity     Severity   `gorm:"type:text;not null;check:chk_security_events_severity,severity IN ('low','medium','high','critical')" json:"severity"`
 	IPAddress    string     `gorm:"type:text" json:"ip_address"`
 	UserAgent    string     `gorm:"type:text" json:"user_agent"`
 	Location     string     `gorm:"type:text" json:"location,omitempty"`
@@ -112,6 +124,14 @@ func (s *SecurityEvent) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// BeforeSave rejects severities outside the enum
+func (s *SecurityEvent) BeforeSave(tx *gorm.DB) error {
+	if s.Severity != "" && !s.Severity.Valid() {
+		return invalidValue("severity", string(s.Severity))
+	}
+	return nil
+}
+
 // TrustedDevice represents a user's trusted device
 type TrustedDevice struct {
 	ID          uuid.UUID `gorm:"type:text;primary_key" json:"id"`
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AppLaunchEvent records a single launch of a SaaS application from the portal
+type AppLaunchEvent struct {
+	ID         uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	UserID     uuid.UUID `gorm:"type:text;not null;index" json:"user_id"`
+	AppID      string    `gorm:"type:text;not null;index" json:"app_id"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	LaunchedAt time.Time `gorm:"not null;index" json:"launched_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *AppLaunchEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AppSessionPolicy holds an app's session rules, checked whenever the app is launched, a
+// token is issued for it or a request is proxied to it. Zero durations mean no limit.
+type AppSessionPolicy struct {
+	ID                 uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	AppID              string    `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	MaxSessionMinutes  int       `json:"max_session_minutes"`
+	IdleTimeoutMinutes int       `json:"idle_timeout_minutes"`
+	ReauthAfterMinutes int       `json:"reauth_after_minutes"`
+	AllowedAALs        string    `gorm:"type:text" json:"allowed_aals"` // comma-separated levels, empty means any
+	// RequireCompliantDevice admits only devices whose reported posture passes the checks
+	RequireCompliantDevice bool       `gorm:"default:false" json:"require_compliant_device"`
+	UpdatedBy              *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *AppSessionPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditExport is an export of audit logs handed to auditors or legal, kept together
+// with the signed manifest recipients use to verify it has not been altered
+type AuditExport struct {
+	ID            uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	ExportedBy    *uuid.UUID `gorm:"type:text;index" json:"exported_by,omitempty"`
+	ExporterEmail string     `gorm:"type:text" json:"exporter_email,omitempty"`
+	StartTime     time.Time  `gorm:"not null" json:"start_time"`
+	EndTime       time.Time  `gorm:"not null" json:"end_time"`
+	Filters       string     `gorm:"type:text" json:"filters"` // JSON
+	RecordCount   int        `json:"record_count"`
+	ContentSHA256 string     `gorm:"type:text;not null" json:"content_sha256"`
+	Content       string     `gorm:"type:text" json:"-"`
+	Manifest      string     `gorm:"type:text;not null" json:"-"` // signed bytes, kept verbatim
+	Signature     string     `gorm:"type:text;not null" json:"signature"`
+	KeyID         string     `gorm:"type:text;not null" json:"key_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *AuditExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// Audit file export formats
+const (
+	AuditFileExportCSV   = "csv"
+	AuditFileExportJSONL = "jsonl"
+)
+
+// Audit file export statuses
+const (
+	AuditFileExportRunning   = "running"
+	AuditFileExportCompleted = "completed"
+	AuditFileExportFailed    = "failed"
+)
+
+// AuditFileExport is a bulk export of audit logs written as CSV or JSON Lines to the
+// object store, for compliance teams to load into their own tools. Unlike AuditExport it
+// has no record cap and no signed manifest, only the file's hash.
+type AuditFileExport struct {
+	ID            uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	ScheduleID    *uuid.UUID `gorm:"type:text;index" json:"schedule_id,omitempty"`
+	Format        string     `gorm:"type:text;not null" json:"format"`
+	StartTime     time.Time  `gorm:"not null" json:"start_time"`
+	EndTime       time.Time  `gorm:"not null" json:"end_time"`
+	Filters       string     `gorm:"type:text" json:"filters"` // JSON
+	Status        string     `gorm:"type:text;not null;index" json:"status"`
+	ObjectKey     string     `gorm:"type:text" json:"object_key,omitempty"`
+	RecordCount   int64      `json:"record_count"`
+	SizeBytes     int64      `json:"size_bytes"`
+	ContentSHA256 string     `gorm:"type:text" json:"content_sha256,omitempty"`
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	RequestedBy   *uuid.UUID `gorm:"type:text;index" json:"requested_by,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *AuditFileExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// AuditExportSchedule exports the audit logs matching its filters every interval. Each run
+// covers the time since the previous one ended, so consecutive files neither overlap nor
+// leave gaps.
+type AuditExportSchedule struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Name            string     `gorm:"type:text;not null;uniqueIndex" json:"name"`
+	Format          string     `gorm:"type:text;not null" json:"format"`
+	Filters         string     `gorm:"type:text" json:"-"` // JSON, without a time range
+	IntervalMinutes int        `gorm:"not null" json:"interval_minutes"`
+	Enabled         bool       `gorm:"not null" json:"enabled"`
+	ExportedUntil   *time.Time `json:"exported_until,omitempty"` // end of the last window exported
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt       *time.Time `gorm:"index" json:"next_run_at,omitempty"`
+	LastError       string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedBy       *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (s *AuditExportSchedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
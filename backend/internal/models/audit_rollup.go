@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Audit rollup dimensions. The total row of a day holds the event count and risk score
+// sums, and its presence marks the day as rolled up.
+const (
+	RollupDimensionTotal      = "total"
+	RollupDimensionEventType  = "event_type"
+	RollupDimensionCategory   = "category"
+	RollupDimensionSeverity   = "severity"
+	RollupDimensionOutcome    = "outcome"
+	RollupDimensionCompliance = "compliance_violations"
+)
+
+// AuditDailyRollup is one pre-aggregated audit event count for a UTC day, so statistics
+// over past days are read from a few rows instead of scanning every event
+type AuditDailyRollup struct {
+	Day       string    `gorm:"type:text;primary_key" json:"day"` // YYYY-MM-DD, UTC
+	Dimension string    `gorm:"type:text;primary_key" json:"dimension"`
+	Value     string    `gorm:"type:text;primary_key" json:"value"`
+	Count     int64     `gorm:"not null" json:"count"`
+	RiskSum   float64   `json:"risk_sum"`
+	RiskCount int64     `json:"risk_count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Audit volume states, from the last evaluated minute of a category
+const (
+	AuditVolumeLearning = "learning"
+	AuditVolumeNormal   = "normal"
+	AuditVolumeDrop     = "drop"
+	AuditVolumeSpike    = "spike"
+)
+
+// AuditVolumeBaseline is the learned events-per-minute of an audit category, an
+// exponentially weighted mean and variance updated once per evaluated minute
+type AuditVolumeBaseline struct {
+	Category    string     `gorm:"type:text;primary_key" json:"category"`
+	Mean        float64    `json:"mean"`
+	Variance    float64    `json:"variance"`
+	Samples     int64      `json:"samples"`
+	LastCount   int64      `json:"last_count"`
+	LastMinute  time.Time  `json:"last_minute"`
+	Status      string     `gorm:"type:text;not null" json:"status"`
+	LastAlertAt *time.Time `json:"last_alert_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BookmarkApp is an admin-defined app without SSO. It is launched by opening its URL and
+// may let users store credentials that the browser extension fills into its login form.
+type BookmarkApp struct {
+	ID               uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID            string     `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	Name             string     `gorm:"type:text;not null" json:"name"`
+	Description      string     `gorm:"type:text" json:"description"`
+	Icon             string     `gorm:"type:text" json:"icon"`
+	Category         string     `gorm:"type:text" json:"category"`
+	URL              string     `gorm:"type:text;not null" json:"url"`
+	LoginURL         string     `gorm:"type:text" json:"login_url"`         // where credentials are filled, defaults to URL
+	UsernameSelector string     `gorm:"type:text" json:"username_selector"` // CSS selectors for the login form
+	PasswordSelector string     `gorm:"type:text" json:"password_selector"`
+	SubmitSelector   string     `gorm:"type:text" json:"submit_selector"`
+	AllowCredentials bool       `json:"allow_credentials"`
+	RequiredAAL      int        `json:"required_aal"`
+	CreatedBy        *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	UpdatedBy        *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// BookmarkCredential is a user's sealed username and password for a bookmark app
+type BookmarkCredential struct {
+	ID         uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:text;not null;uniqueIndex:idx_bookmark_credential" json:"user_id"`
+	AppID      string     `gorm:"type:text;not null;uniqueIndex:idx_bookmark_credential" json:"app_id"`
+	Username   string     `gorm:"type:text;not null" json:"-"` // sealed
+	Password   string     `gorm:"type:text;not null" json:"-"` // sealed
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *BookmarkApp) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (c *BookmarkCredential) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BootstrapRecord marks a bootstrap seed step as applied at a version. A recorded step is
+// not seeded again until its version is raised, so data an admin deletes stays deleted.
+type BootstrapRecord struct {
+	ID        uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	Step      string    `gorm:"type:text;not null;uniqueIndex" json:"step"`
+	Version   int       `gorm:"not null" json:"version"`
+	Demo      bool      `gorm:"not null" json:"demo"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *BootstrapRecord) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
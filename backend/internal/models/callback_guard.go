@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// What a callback block applies to
+const (
+	CallbackBlockIP          = "ip"
+	CallbackBlockStatePrefix = "state_prefix"
+)
+
+// CallbackFailure is a rejected request to an OAuth callback or token endpoint, kept for
+// the throttling window
+type CallbackFailure struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Endpoint    string    `gorm:"type:text;not null" json:"endpoint"` // google_callback, token_refresh, ...
+	IPAddress   string    `gorm:"type:text;index" json:"ip_address"`
+	StatePrefix string    `gorm:"type:text;index" json:"state_prefix,omitempty"`
+	Status      int       `json:"status"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+// CallbackBlock temporarily refuses callback and token requests from an IP address, or
+// carrying a state with a given prefix, after repeated failures
+type CallbackBlock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Scope     string    `gorm:"type:text;not null;uniqueIndex:idx_callback_block" json:"scope"` // ip, state_prefix
+	Value     string    `gorm:"type:text;not null;uniqueIndex:idx_callback_block" json:"value"`
+	Endpoint  string    `gorm:"type:text" json:"endpoint"` // where the threshold was crossed
+	Failures  int64     `json:"failures"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CanaryKey is a decoy API key planted in documentation, sample configs or repositories.
+// It never authenticates; any use of it means the place it was planted has leaked. Only
+// a hash of the key is stored.
+type CanaryKey struct {
+	ID        uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Label     string     `gorm:"type:text;not null" json:"label"`
+	Placement string     `gorm:"type:text" json:"placement"` // where it was planted, e.g. "ops wiki: deploy guide"
+	KeyHash   string     `gorm:"type:text;not null;uniqueIndex" json:"-"`
+	KeyHint   string     `gorm:"type:text" json:"key_hint"` // last four characters
+	HitCount  int64      `json:"hit_count"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
+	LastHitIP string     `gorm:"type:text" json:"last_hit_ip,omitempty"`
+	CreatedBy *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (k *CanaryKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// CanaryKeyHit is one use of a canary key, with the request that carried it
+type CanaryKeyHit struct {
+	ID          uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	CanaryKeyID uuid.UUID `gorm:"type:text;not null;index" json:"canary_key_id"`
+	IPAddress   string    `gorm:"type:text" json:"ip_address"`
+	UserAgent   string    `gorm:"type:text" json:"user_agent"`
+	Method      string    `gorm:"type:text" json:"method"`
+	Path        string    `gorm:"type:text" json:"path"`
+	Query       string    `gorm:"type:text" json:"query,omitempty"`
+	Headers     string    `gorm:"type:text" json:"headers"`      // JSON, credentials redacted
+	PresentedIn string    `gorm:"type:text" json:"presented_in"` // authorization, x-api-key, query
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (h *CanaryKeyHit) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Case statuses
+const (
+	CaseStatusOpen       = "open"
+	CaseStatusInProgress = "in_progress"
+	CaseStatusClosed     = "closed"
+)
+
+// Case link types
+const (
+	CaseLinkIncident = "incident"
+	CaseLinkAlert    = "alert"
+	CaseLinkUser     = "user"
+)
+
+// Case task statuses
+const (
+	CaseTaskOpen = "open"
+	CaseTaskDone = "done"
+)
+
+// InvestigationCase groups incidents, alerts, users and evidence under one investigation
+type InvestigationCase struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Title       string     `gorm:"type:text;not null" json:"title"`
+	Description string     `gorm:"type:text" json:"description"`
+	Severity    string     `gorm:"type:text;not null" json:"severity"`
+	Status      string     `gorm:"type:text;not null;index" json:"status"`
+	OwnerID     *uuid.UUID `gorm:"type:text;index" json:"owner_id,omitempty"`
+	CreatedBy   *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	Links    []CaseLink     `gorm:"foreignKey:CaseID" json:"links,omitempty"`
+	Notes    []CaseNote     `gorm:"foreignKey:CaseID" json:"notes,omitempty"`
+	Evidence []CaseEvidence `gorm:"foreignKey:CaseID" json:"evidence,omitempty"`
+	Tasks    []CaseTask     `gorm:"foreignKey:CaseID" json:"tasks,omitempty"`
+}
+
+// CaseLink attaches an incident, alert or user to a case
+type CaseLink struct {
+	ID        uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	CaseID    uuid.UUID  `gorm:"type:text;not null;uniqueIndex:idx_case_link" json:"case_id"`
+	LinkType  string     `gorm:"type:text;not null;uniqueIndex:idx_case_link" json:"link_type"`
+	TargetID  string     `gorm:"type:text;not null;uniqueIndex:idx_case_link;index" json:"target_id"`
+	AddedBy   *uuid.UUID `gorm:"type:text" json:"added_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CaseNote is an analyst's free-text entry on a case
+type CaseNote struct {
+	ID        uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	CaseID    uuid.UUID  `gorm:"type:text;not null;index" json:"case_id"`
+	AuthorID  *uuid.UUID `gorm:"type:text" json:"author_id,omitempty"`
+	Body      string     `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CaseEvidence references an artifact collected for a case. Content lives in
+// external storage; the hash lets reviewers verify it has not changed.
+type CaseEvidence struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	CaseID      uuid.UUID  `gorm:"type:text;not null;index" json:"case_id"`
+	Name        string     `gorm:"type:text;not null" json:"name"`
+	Description string     `gorm:"type:text" json:"description"`
+	URI         string     `gorm:"type:text;not null" json:"uri"`
+	SHA256      string     `gorm:"type:text" json:"sha256,omitempty"`
+	AddedBy     *uuid.UUID `gorm:"type:text" json:"added_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CaseTask is a unit of follow-up work on a case
+type CaseTask struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	CaseID      uuid.UUID  `gorm:"type:text;not null;index" json:"case_id"`
+	Title       string     `gorm:"type:text;not null" json:"title"`
+	AssigneeID  *uuid.UUID `gorm:"type:text;index" json:"assignee_id,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Status      string     `gorm:"type:text;not null" json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (c *InvestigationCase) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (l *CaseLink) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (n *CaseNote) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (e *CaseEvidence) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (t *CaseTask) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsOverdue reports whether an open task has passed its due date
+func (t *CaseTask) IsOverdue() bool {
+	return t.Status != CaseTaskDone && t.DueAt != nil && time.Now().After(*t.DueAt)
+}
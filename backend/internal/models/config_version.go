@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConfigVersion is one recorded change to a piece of configuration: a rule, a threshold,
+// a policy or an alert channel. Versions count up per kind and key and are never changed
+// once recorded; a rollback records a new version.
+type ConfigVersion struct {
+	ID        uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Kind      string     `gorm:"type:text;not null;index:idx_config_versions_kind_key" json:"kind"`
+	Key       string     `gorm:"type:text;not null;index:idx_config_versions_kind_key" json:"key"`
+	Version   int        `gorm:"not null" json:"version"`
+	Summary   string     `gorm:"type:text" json:"summary"`
+	ChangedBy *uuid.UUID `gorm:"type:text" json:"changed_by,omitempty"`
+	OffHours  bool       `gorm:"not null" json:"off_hours"`
+	ChangedAt time.Time  `gorm:"not null;index" json:"changed_at"`
+	// The configuration as JSON after the change, empty when the change removed it or the
+	// configuration holds secrets, and the field changes from the previous version
+	SnapshotJSON string `gorm:"column:snapshot;type:text" json:"-"`
+	DiffJSON     string `gorm:"column:diff;type:text" json:"-"`
+	RollbackOf   *int   `json:"rollback_of,omitempty"` // the version a rollback restored
+}
+
+// BeforeCreate hook to generate UUID
+func (v *ConfigVersion) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+// ErrConfigVersionImmutable is returned when changing or deleting a recorded configuration version
+var ErrConfigVersionImmutable = errors.New("configuration versions cannot be changed")
+
+// BeforeUpdate keeps recorded versions immutable
+func (v *ConfigVersion) BeforeUpdate(tx *gorm.DB) error {
+	return ErrConfigVersionImmutable
+}
+
+// BeforeDelete keeps recorded versions immutable
+func (v *ConfigVersion) BeforeDelete(tx *gorm.DB) error {
+	return ErrConfigVersionImmutable
+}
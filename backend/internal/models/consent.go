@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConsentRecord documents a user's consent for CloudGate to access data in a connected app
+type ConsentRecord struct {
+	ID             uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	AppID          string     `gorm:"type:text;not null;index" json:"app_id"`
+	DataCategories string     `gorm:"type:text" json:"data_categories"` // JSON array, as shown on the consent screen
+	LawfulBasis    string     `gorm:"type:text;not null;default:'consent'" json:"lawful_basis"`
+	IPAddress      string     `json:"ip_address"`
+	UserAgent      string     `json:"user_agent"`
+	GrantedAt      time.Time  `gorm:"not null" json:"granted_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// BeforeCreate hook to generate UUID
+func (c *ConsentRecord) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsValid reports whether the consent is neither revoked nor expired
+func (c *ConsentRecord) IsValid() bool {
+	if c.RevokedAt != nil {
+		return false
+	}
+	return c.ExpiresAt == nil || time.Now().Before(*c.ExpiresAt)
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Detection query run triggers
+const (
+	DetectionRunScheduled = "scheduled"
+	DetectionRunManual    = "manual"
+)
+
+// DetectionQuery is an analyst's saved detection over the audit log: filters counted over
+// a sliding window on a schedule, raising an alert when the count crosses a threshold.
+// The query itself is stored as a JSON definition.
+type DetectionQuery struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Name        string     `gorm:"type:text;not null;uniqueIndex" json:"name"`
+	Description string     `gorm:"type:text" json:"description"`
+	Enabled     bool       `gorm:"not null" json:"enabled"`
+	Definition  string     `gorm:"type:text;not null" json:"-"` // JSON
+	LastRunAt   *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt   *time.Time `gorm:"index" json:"next_run_at,omitempty"`
+	LastAlertAt *time.Time `json:"last_alert_at,omitempty"`
+	CreatedBy   *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (q *DetectionQuery) BeforeCreate(tx *gorm.DB) error {
+	if q.ID == uuid.Nil {
+		q.ID = uuid.New()
+	}
+	return nil
+}
+
+// DetectionQueryRun is one evaluation of a detection query and what it found
+type DetectionQueryRun struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	QueryID     uuid.UUID  `gorm:"type:text;not null;index" json:"query_id"`
+	QueryName   string     `gorm:"type:text;not null" json:"query_name"`
+	Trigger     string     `gorm:"type:text;not null" json:"trigger"` // scheduled, manual
+	Parameters  string     `gorm:"type:text" json:"-"`                // JSON
+	WindowStart time.Time  `json:"window_start"`
+	WindowEnd   time.Time  `json:"window_end"`
+	MatchCount  int64      `json:"match_count"`
+	Groups      string     `gorm:"type:text" json:"-"` // JSON, the groups over the threshold
+	Triggered   bool       `json:"triggered"`
+	AlertID     *uuid.UUID `gorm:"type:text" json:"alert_id,omitempty"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	DurationMs  int64      `json:"duration_ms"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *DetectionQueryRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
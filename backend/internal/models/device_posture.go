@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Where a device posture attestation came from
+const (
+	PostureSourceAgent  = "agent"
+	PostureSourceIntune = "intune"
+	PostureSourceJamf   = "jamf"
+)
+
+// DevicePosture is the latest security posture reported for one of a user's devices, by
+// the CloudGate agent or an MDM. Checks a report did not cover stay nil, and later reports
+// from other sources fill them in.
+type DevicePosture struct {
+	ID            uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	UserID        uuid.UUID `gorm:"type:text;not null;uniqueIndex:idx_device_posture_device" json:"user_id"`
+	DeviceID      string    `gorm:"type:text;not null;uniqueIndex:idx_device_posture_device" json:"device_id"` // as sent in X-Device-ID
+	DeviceName    string    `gorm:"type:text" json:"device_name"`
+	Platform      string    `gorm:"type:text" json:"platform"` // windows, macos, linux, ios, android
+	OSVersion     string    `gorm:"type:text" json:"os_version"`
+	DiskEncrypted *bool     `json:"disk_encrypted"`
+	EDRRunning    *bool     `json:"edr_running"`
+	MDMCompliant  *bool     `json:"mdm_compliant"` // the MDM's own compliance verdict
+	Source        string    `gorm:"type:text;not null" json:"source"`
+	Compliant     bool      `gorm:"index" json:"compliant"`
+	Issues        string    `gorm:"type:text" json:"issues,omitempty"` // semicolon-separated reasons it is not compliant
+	AttestedAt    time.Time `gorm:"index" json:"attested_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *DevicePosture) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
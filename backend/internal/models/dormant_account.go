@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Where a dormant account stands
+const (
+	DormantStatusWarned                = "warned"                 // the owner was told the account will be disabled
+	DormantStatusDormant               = "dormant"                // past the limit, but auto-disable is off
+	DormantStatusDisabled              = "disabled"               // locked until reactivated
+	DormantStatusReactivationRequested = "reactivation_requested" // the owner asked for the account back
+	DormantStatusReactivated           = "reactivated"            // an admin unlocked it
+)
+
+// DormantAccount tracks an account that has gone unused, from the first warning to its
+// reactivation. The record is removed when the owner signs in again before being disabled.
+type DormantAccount struct {
+	ID                      uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID                  uuid.UUID  `gorm:"type:text;not null;uniqueIndex" json:"user_id"`
+	Email                   string     `gorm:"type:text" json:"email"`
+	Status                  string     `gorm:"type:text;not null;index" json:"status"`
+	LastActivityAt          time.Time  `json:"last_activity_at"`
+	WarnedAt                *time.Time `json:"warned_at,omitempty"`
+	DisabledAt              *time.Time `json:"disabled_at,omitempty"`
+	ReactivationRequestedAt *time.Time `json:"reactivation_requested_at,omitempty"`
+	ReactivationReason      string     `gorm:"type:text" json:"reactivation_reason,omitempty"`
+	ReactivatedAt           *time.Time `json:"reactivated_at,omitempty"`
+	ReactivatedBy           *uuid.UUID `gorm:"type:text" json:"reactivated_by,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *DormantAccount) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Emergency lockdown scopes
+const (
+	LockdownScopeGlobal = "global"
+	LockdownScopeDomain = "domain" // users whose email is in one domain, i.e. one customer tenant
+)
+
+// EmergencyLockdown records an emergency global sign-out and the restrictions it put in place
+type EmergencyLockdown struct {
+	ID                 uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Scope              string     `gorm:"type:text;not null" json:"scope"`
+	Domain             string     `gorm:"type:text" json:"domain,omitempty"`
+	Reason             string     `gorm:"type:text;not null" json:"reason"`
+	RequireMFA         bool       `json:"require_mfa"`
+	RefreshPausedUntil *time.Time `json:"refresh_paused_until,omitempty"`
+	SessionsRevoked    int64      `json:"sessions_revoked"`
+	IncidentID         *uuid.UUID `gorm:"type:text" json:"incident_id,omitempty"`
+	TriggeredBy        *uuid.UUID `gorm:"type:text" json:"triggered_by,omitempty"`
+	TriggeredAt        time.Time  `gorm:"not null;index" json:"triggered_at"`
+	LiftedAt           *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy           *uuid.UUID `gorm:"type:text" json:"lifted_by,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (l *EmergencyLockdown) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+// AppliesTo reports whether the lockdown covers a user with the given email
+func (l *EmergencyLockdown) AppliesTo(email string) bool {
+	if l.Scope == LockdownScopeGlobal {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	return at >= 0 && strings.EqualFold(email[at+1:], l.Domain)
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExtensionDomainReport aggregates the visits a user's browser extension reported to a
+// site that is not in the app catalog
+type ExtensionDomainReport struct {
+	ID         uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	UserID     uuid.UUID `gorm:"type:text;not null;uniqueIndex:idx_extension_domain" json:"user_id"`
+	Domain     string    `gorm:"type:text;not null;uniqueIndex:idx_extension_domain;index" json:"domain"`
+	Visits     int64     `gorm:"not null;default:0" json:"visits"`
+	LoginForms int64     `gorm:"not null;default:0" json:"login_forms"` // visits where a sign-in form was seen
+	FirstSeen  time.Time `gorm:"not null" json:"first_seen"`
+	LastSeen   time.Time `gorm:"not null;index" json:"last_seen"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *ExtensionDomainReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// What an upload is for, which decides its allowed types, size limit and retention
+const (
+	UploadPurposeCaseEvidence     = "case_evidence"
+	UploadPurposeComplianceReport = "compliance_report"
+	UploadPurposeBulkImport       = "bulk_import"
+)
+
+// Malware scan outcomes of an upload
+const (
+	UploadScanClean      = "clean"
+	UploadScanNotScanned = "not_scanned" // no scanner configured
+)
+
+// FileUpload is an uploaded file kept in object storage until ExpiresAt
+type FileUpload struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Purpose     string     `gorm:"type:text;not null;index" json:"purpose"`
+	Filename    string     `gorm:"type:text;not null" json:"filename"`
+	ContentType string     `gorm:"type:text;not null" json:"content_type"` // as sniffed, not as declared
+	Size        int64      `json:"size"`
+	SHA256      string     `gorm:"type:text;not null" json:"sha256"`
+	StorageKey  string     `gorm:"type:text;not null" json:"-"`
+	ScanStatus  string     `gorm:"type:text;not null" json:"scan_status"`
+	UploadedBy  *uuid.UUID `gorm:"type:text;index" json:"uploaded_by,omitempty"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (u *FileUpload) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
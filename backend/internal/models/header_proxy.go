@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// HeaderProxyApp configures the upstream of an app that trusts identity headers. CloudGate
+// proxies the user's requests to it and injects who they are after its policy checks.
+type HeaderProxyApp struct {
+	ID                uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID             string     `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	UpstreamURL       string     `gorm:"type:text;not null" json:"upstream_url"`
+	UserHeader        string     `gorm:"type:text;not null" json:"user_header"` // e.g. X-Remote-User
+	EmailHeader       string     `gorm:"type:text" json:"email_header"`         // empty means not sent
+	GroupsHeader      string     `gorm:"type:text" json:"groups_header"`        // e.g. X-Remote-Groups
+	DefaultGroups     string     `gorm:"type:text" json:"default_groups"`       // comma-separated, sent for every user
+	SharedSecret      string     `gorm:"type:text" json:"-"`                    // lets the upstream reject requests that bypass CloudGate
+	RequireAssignment bool       `json:"require_assignment"`                    // only users with an assignment may use the app
+	Enabled           bool       `json:"enabled"`
+	UpdatedBy         *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// HeaderProxyAssignment gives a user access to a header proxy app and the groups sent for them
+type HeaderProxyAssignment struct {
+	ID        uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID     string     `gorm:"type:text;not null;uniqueIndex:idx_header_proxy_assignment" json:"app_id"`
+	UserID    uuid.UUID  `gorm:"type:text;not null;uniqueIndex:idx_header_proxy_assignment" json:"user_id"`
+	Groups    string     `gorm:"type:text" json:"groups"` // comma-separated
+	UpdatedBy *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// HeaderProxyRequestLog records one request proxied to a header proxy app
+type HeaderProxyRequestLog struct {
+	ID         uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID      string     `gorm:"type:text;not null;index" json:"app_id"`
+	UserID     uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	SessionID  *uuid.UUID `gorm:"type:text" json:"session_id,omitempty"`
+	Method     string     `gorm:"type:text;not null" json:"method"`
+	Path       string     `gorm:"type:text;not null" json:"path"`
+	StatusCode int        `json:"status_code"`
+	DurationMs int64      `json:"duration_ms"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *HeaderProxyApp) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (a *HeaderProxyAssignment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook to generate UUID
+func (l *HeaderProxyRequestLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
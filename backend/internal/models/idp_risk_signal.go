@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdPRiskSignal is a risky-user or risky-account event received from an upstream
+// identity provider, such as a Google RISC security event or a Microsoft Entra risky user
+type IdPRiskSignal struct {
+	ID         uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Provider   string     `gorm:"type:text;not null;uniqueIndex:idx_idp_risk_event" json:"provider"` // google, microsoft
+	EventID    string     `gorm:"type:text;not null;uniqueIndex:idx_idp_risk_event" json:"event_id"`
+	EventType  string     `gorm:"type:text;not null" json:"event_type"`
+	RiskLevel  string     `gorm:"type:text;not null" json:"risk_level"` // none, low, medium, high
+	RiskState  string     `gorm:"type:text" json:"risk_state,omitempty"`
+	Detail     string     `gorm:"type:text" json:"detail,omitempty"`
+	Subject    string     `gorm:"type:text;not null;index" json:"subject"` // email or provider account ID
+	UserID     *uuid.UUID `gorm:"type:text;index" json:"user_id,omitempty"`
+	AlertID    *uuid.UUID `gorm:"type:text" json:"alert_id,omitempty"`
+	ObservedAt time.Time  `gorm:"not null;index" json:"observed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (s *IdPRiskSignal) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Impersonation statuses
+const (
+	ImpersonationPendingConsent = "pending_consent"
+	ImpersonationApproved       = "approved"
+	ImpersonationActive         = "active"
+	ImpersonationDenied         = "denied"
+	ImpersonationEnded          = "ended"
+	ImpersonationExpired        = "expired"
+)
+
+// Impersonation is a support administrator's time-boxed "login as user" grant. It may
+// need the user's consent before it starts; once started it is bound to one session,
+// which carries the administrator as its impersonator.
+type Impersonation struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AdminID         uuid.UUID  `gorm:"type:text;not null;index" json:"admin_id"`
+	TargetUserID    uuid.UUID  `gorm:"type:text;not null;index" json:"target_user_id"`
+	Reason          string     `gorm:"type:text;not null" json:"reason"`
+	Status          string     `gorm:"type:text;not null;index" json:"status"`
+	ConsentRequired bool       `json:"consent_required"`
+	DurationSeconds int64      `gorm:"not null" json:"duration_seconds"`
+	RequestExpires  time.Time  `gorm:"not null" json:"request_expires_at"` // consent and start must happen before this
+	DecidedAt       *time.Time `json:"decided_at,omitempty"`
+	SessionID       *uuid.UUID `gorm:"type:text;index" json:"session_id,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	EndedBy         *uuid.UUID `gorm:"type:text" json:"ended_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (i *Impersonation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// Duration is how long the impersonation session lasts once started
+func (i *Impersonation) Duration() time.Duration {
+	return time.Duration(i.DurationSeconds) * time.Second
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Integration health sample kinds
+const (
+	IntegrationSampleHealthCheck  = "health_check"
+	IntegrationSampleAPICall      = "api_call"
+	IntegrationSampleTokenRefresh = "token_refresh"
+)
+
+// Integration health statuses
+const (
+	IntegrationHealthy   = "healthy"
+	IntegrationDegraded  = "degraded"
+	IntegrationUnhealthy = "unhealthy"
+	IntegrationUnknown   = "unknown"
+)
+
+// IntegrationHealthSample is one observed call to a provider integration: a health
+// check, an API call made on the user's behalf, or a token refresh
+type IntegrationHealthSample struct {
+	ID           uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Provider     string     `gorm:"type:text;not null;index:idx_integration_sample_provider_time" json:"provider"`
+	ConnectionID *uuid.UUID `gorm:"type:text;index" json:"connection_id,omitempty"`
+	Kind         string     `gorm:"type:text;not null" json:"kind"`
+	Success      bool       `json:"success"`
+	LatencyMs    int        `json:"latency_ms"`
+	StatusCode   int        `json:"status_code,omitempty"`
+	Error        string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt    time.Time  `gorm:"index:idx_integration_sample_provider_time" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (s *IntegrationHealthSample) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// IntegrationHealthState is the last evaluated health of a provider, kept so that
+// degradation alerts fire on a change rather than on every evaluation
+type IntegrationHealthState struct {
+	Provider    string     `gorm:"type:text;primary_key" json:"provider"`
+	Score       float64    `json:"score"`
+	Status      string     `gorm:"type:text;not null" json:"status"`
+	LastAlertAt *time.Time `json:"last_alert_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
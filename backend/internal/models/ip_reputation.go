@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Analyst overrides of an IP address's reputation
+const (
+	IPOverrideAllow = "allow"
+	IPOverrideDeny  = "deny"
+)
+
+// IPReputation is CloudGate's local view of an IP address: the cached threat-intel
+// verdict, what CloudGate itself has observed from it, and any analyst override. The
+// observation score is as of ObservedAt and decays with age when read.
+type IPReputation struct {
+	IPAddress         string     `gorm:"type:text;primary_key" json:"ip_address"`
+	IntelScore        float64    `json:"intel_score"` // threat-intel confidence, 0-1
+	IntelSource       string     `gorm:"type:text" json:"intel_source,omitempty"`
+	IntelCheckedAt    *time.Time `json:"intel_checked_at,omitempty"`
+	ObservationScore  float64    `json:"observation_score"`
+	FailedLogins      int64      `json:"failed_logins"`
+	Alerts            int64      `json:"alerts"`
+	ObservedAt        *time.Time `json:"observed_at,omitempty"`
+	Override          string     `gorm:"type:text" json:"override,omitempty"` // allow, deny
+	OverrideReason    string     `gorm:"type:text" json:"override_reason,omitempty"`
+	OverrideBy        *uuid.UUID `gorm:"type:text" json:"override_by,omitempty"`
+	OverrideExpiresAt *time.Time `json:"override_expires_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"index" json:"updated_at"`
+}
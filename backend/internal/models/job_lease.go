@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// JobLease is a lease on a named background job, held by one instance until it expires
+type JobLease struct {
+	Name       string    `gorm:"type:text;primary_key" json:"name"`
+	Holder     string    `gorm:"type:text;not null" json:"holder"`
+	AcquiredAt time.Time `gorm:"not null" json:"acquired_at"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+}
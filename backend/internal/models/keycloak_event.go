@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of Keycloak event
+const (
+	KeycloakEventUser  = "user"
+	KeycloakEventAdmin = "admin"
+)
+
+// KeycloakEvent records a Keycloak login, logout or admin event once it has been ingested,
+// so webhook redeliveries and overlapping polls are not audited twice
+type KeycloakEvent struct {
+	ID         string     `gorm:"type:text;primary_key" json:"id"` // Keycloak's event ID, or a hash of the event when it has none
+	Kind       string     `gorm:"type:text;not null;index:idx_keycloak_event_time" json:"kind"`
+	Type       string     `gorm:"type:text;not null" json:"type"` // LOGIN, LOGOUT, or the admin operation such as CREATE
+	RealmID    string     `gorm:"type:text" json:"realm_id,omitempty"`
+	UserID     *uuid.UUID `gorm:"type:text;index" json:"user_id,omitempty"`
+	OccurredAt time.Time  `gorm:"not null;index:idx_keycloak_event_time" json:"occurred_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LicenseAllocation tracks the seats an organization holds for a SaaS application
+type LicenseAllocation struct {
+	ID               uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID            string     `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	ProvisionedSeats int        `gorm:"default:0" json:"provisioned_seats"`
+	AssignedSeats    int        `gorm:"default:0" json:"assigned_seats"`
+	CostPerSeat      float64    `gorm:"default:0" json:"cost_per_seat"`
+	Source           string     `gorm:"type:text;default:'manual'" json:"source"` // manual, google_admin_sdk, microsoft_graph
+	LastSyncedAt     *time.Time `json:"last_synced_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (l *LicenseAllocation) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Login dispute statuses
+const (
+	DisputeOpen       = "open"       // the user still has remediation steps to complete
+	DisputeRemediated = "remediated" // password reset and MFA re-enrolled, awaiting review
+	DisputeResolved   = "resolved"   // closed by an administrator
+)
+
+// Login dispute resolutions
+const (
+	DisputeResolutionCompromised    = "compromised"     // the login was not the user's
+	DisputeResolutionNotCompromised = "not_compromised" // the login turned out to be the user's
+)
+
+// LoginDispute tracks a login the user said was not them, from the report through the
+// user's remediation to an administrator's resolution
+type LoginDispute struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	SessionID       uuid.UUID  `gorm:"type:text;not null;index" json:"session_id"`
+	AlertID         *uuid.UUID `gorm:"type:text" json:"alert_id,omitempty"`
+	Status          string     `gorm:"type:text;not null;index" json:"status"`
+	Comment         string     `gorm:"type:text" json:"comment,omitempty"`
+	LoginIPAddress  string     `gorm:"type:text" json:"login_ip_address"`
+	LoginUserAgent  string     `gorm:"type:text" json:"login_user_agent"`
+	LoginAt         time.Time  `json:"login_at"`
+	ReporterIP      string     `gorm:"type:text" json:"reporter_ip"`
+	PasswordResetAt *time.Time `json:"password_reset_at,omitempty"`
+	MFAVerifiedAt   *time.Time `json:"mfa_verified_at,omitempty"`
+	Resolution      string     `gorm:"type:text" json:"resolution,omitempty"`
+	ResolutionNote  string     `gorm:"type:text" json:"resolution_note,omitempty"`
+	ResolvedBy      *uuid.UUID `gorm:"type:text" json:"resolved_by,omitempty"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *LoginDispute) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
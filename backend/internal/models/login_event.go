@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reasons a login attempt failed
+const (
+	LoginFailureUnknownUser     = "unknown_user"
+	LoginFailureInvalidPassword = "invalid_password"
+	LoginFailureSessionError    = "session_error"
+	LoginFailureAccountLocked   = "account_locked"
+)
+
+// LoginEvent is one login attempt, successful or not, with where it came from. UserID is
+// empty when the attempt named an account that does not exist. Coordinates are empty when
+// the address could not be located, so the event is never plotted at 0,0.
+type LoginEvent struct {
+	ID            uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID        *uuid.UUID `gorm:"type:text;index:idx_login_events_user_time" json:"user_id,omitempty"`
+	Email         string     `gorm:"type:text;index" json:"email"`
+	Success       bool       `gorm:"not null" json:"success"`
+	FailureReason string     `gorm:"type:text" json:"failure_reason,omitempty"`
+	Method        string     `gorm:"type:text;not null" json:"method"`
+	SessionID     *uuid.UUID `gorm:"type:text" json:"session_id,omitempty"`
+	IPAddress     string     `gorm:"type:text" json:"ip_address"`
+	UserAgent     string     `gorm:"type:text" json:"user_agent"`
+	Country       string     `gorm:"type:text" json:"country,omitempty"`
+	Region        string     `gorm:"type:text" json:"region,omitempty"`
+	City          string     `gorm:"type:text" json:"city,omitempty"`
+	Latitude      *float64   `json:"latitude,omitempty"`
+	Longitude     *float64   `json:"longitude,omitempty"`
+	CreatedAt     time.Time  `gorm:"index:idx_login_events_user_time" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *LoginEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
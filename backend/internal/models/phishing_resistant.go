@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PhishingResistantPolicy restricts a designated group of a tenant's users, such as its
+// admins, to WebAuthn/passkey step-ups. OTP step-ups keep working until the grace period
+// that starts when the policy is enabled runs out.
+type PhishingResistantPolicy struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Tenant          string     `gorm:"type:text;not null;uniqueIndex:idx_phishing_resistant_tenant_group" json:"tenant"` // email domain
+	Group           string     `gorm:"column:group_name;type:text;not null;uniqueIndex:idx_phishing_resistant_tenant_group" json:"group"`
+	Members         string     `gorm:"type:text" json:"members"` // comma-separated member emails
+	Enabled         bool       `json:"enabled"`
+	GracePeriodDays int        `gorm:"not null" json:"grace_period_days"`
+	EnabledAt       *time.Time `json:"enabled_at,omitempty"`
+	EnforcedFrom    *time.Time `json:"enforced_from,omitempty"` // end of the grace period
+	UpdatedBy       *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *PhishingResistantPolicy) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Playbook execution statuses
+const (
+	PlaybookRunning          = "running"
+	PlaybookAwaitingApproval = "awaiting_approval"
+	PlaybookCompleted        = "completed"
+	PlaybookFailed           = "failed"
+	PlaybookCancelled        = "cancelled"
+)
+
+// Playbook is an automated response to security alerts: the alert types and severities
+// that trigger it and the ordered steps it runs, stored as a JSON definition
+type Playbook struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Name        string     `gorm:"type:text;not null;uniqueIndex" json:"name"`
+	Description string     `gorm:"type:text" json:"description"`
+	Enabled     bool       `gorm:"not null;default:true" json:"enabled"`
+	Definition  string     `gorm:"type:text;not null" json:"-"` // JSON
+	CreatedBy   *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *Playbook) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// PlaybookExecution is one run of a playbook against an alert. The alert and playbook
+// definition are snapshotted so a run paused at an approval gate resumes unchanged.
+type PlaybookExecution struct {
+	ID                  uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	PlaybookID          uuid.UUID  `gorm:"type:text;not null;index" json:"playbook_id"`
+	PlaybookName        string     `gorm:"type:text;not null" json:"playbook_name"`
+	AlertID             uuid.UUID  `gorm:"type:text;not null;index" json:"alert_id"`
+	Status              string     `gorm:"type:text;not null;index" json:"status"`
+	CurrentStep         int        `json:"current_step"`
+	Results             string     `gorm:"type:text" json:"-"` // JSON
+	Definition          string     `gorm:"type:text;not null" json:"-"`
+	Alert               string     `gorm:"type:text;not null" json:"-"`
+	ApprovalRequestedAt *time.Time `json:"approval_requested_at,omitempty"`
+	CompletedAt         *time.Time `json:"completed_at,omitempty"`
+	CreatedAt           time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *PlaybookExecution) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
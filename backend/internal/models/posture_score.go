@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PostureScoreSnapshot records a tenant's security posture score at a point in time, so
+// its trend can be charted
+type PostureScoreSnapshot struct {
+	ID              uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	Tenant          string    `gorm:"type:text;not null;index:idx_posture_snapshot_tenant_time" json:"tenant"` // email domain
+	Score           float64   `json:"score"`
+	Grade           string    `gorm:"type:text" json:"grade"`
+	Users           int64     `json:"users"`
+	ComponentScores string    `gorm:"type:text" json:"-"` // JSON, component name to score
+	CreatedAt       time.Time `gorm:"index:idx_posture_snapshot_tenant_time" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *PostureScoreSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Provider client secret statuses
+const (
+	ProviderSecretActive  = "active"
+	ProviderSecretGrace   = "grace" // replaced, but still accepted until GraceUntil
+	ProviderSecretRetired = "retired"
+)
+
+// ProviderSecret is an OAuth client secret for a SaaS provider, managed through rotation
+type ProviderSecret struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Provider    string     `gorm:"type:text;not null;index" json:"provider"`
+	Secret      string     `gorm:"type:text;not null" json:"-"` // encrypted in production
+	SecretHint  string     `gorm:"type:text" json:"secret_hint"`
+	Status      string     `gorm:"type:text;not null;index" json:"status"`
+	ValidatedAt *time.Time `json:"validated_at,omitempty"`
+	GraceUntil  *time.Time `json:"grace_until,omitempty"`
+	RotatedBy   *uuid.UUID `gorm:"type:text" json:"rotated_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *ProviderSecret) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsUsable reports whether the secret may still be sent to the provider
+func (p *ProviderSecret) IsUsable() bool {
+	switch p.Status {
+	case ProviderSecretActive:
+		return true
+	case ProviderSecretGrace:
+		return p.GraceUntil != nil && time.Now().Before(*p.GraceUntil)
+	default:
+		return false
+	}
+}
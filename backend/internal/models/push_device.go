@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PushDevice is an admin's phone or browser registered for critical alert push
+// notifications through Firebase Cloud Messaging
+type PushDevice struct {
+	ID         uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	Token      string     `gorm:"type:text;not null;uniqueIndex" json:"-"` // FCM registration token
+	Platform   string     `gorm:"type:text;not null" json:"platform"`      // android, ios, web
+	Name       string     `gorm:"type:text" json:"name"`
+	LastPushAt *time.Time `json:"last_push_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *PushDevice) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RadiusCredential holds the sealed NT password hash MS-CHAPv2 needs, which cannot be
+// derived from the bcrypt password hash. It is captured when the user registers or signs
+// in with their password, and only kept while MS-CHAPv2 is enabled.
+type RadiusCredential struct {
+	UserID    uuid.UUID `gorm:"type:text;primary_key" json:"user_id"`
+	NTHash    string    `gorm:"type:text;not null" json:"-"` // AES-GCM sealed, base64
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RadiusChallenge is a pending one-time passcode challenge, matched by the RADIUS State
+// attribute the network device echoes back with the passcode
+type RadiusChallenge struct {
+	State     string    `gorm:"type:text;primary_key" json:"-"`
+	UserID    uuid.UUID `gorm:"type:text;not null;index" json:"user_id"`
+	UserName  string    `gorm:"type:text;not null" json:"user_name"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
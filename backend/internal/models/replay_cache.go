@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReplayCacheEntry records a SAML assertion ID or OIDC ID token that has been accepted,
+// until it expires, so the same assertion or token cannot be presented twice
+type ReplayCacheEntry struct {
+	Key       string    `gorm:"type:text;primary_key" json:"key"` // kind:issuer:id
+	Kind      string    `gorm:"type:text;not null" json:"kind"`   // saml_assertion, oidc_id_token
+	Issuer    string    `gorm:"type:text" json:"issuer"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthNonce is a nonce sent with an OIDC authorization request. The ID token returned
+// by the provider must carry an issued nonce, which is then deleted.
+type AuthNonce struct {
+	Value     string    `gorm:"type:text;primary_key" json:"-"`
+	Provider  string    `gorm:"type:text;not null" json:"provider"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OAuthState is the state parameter of an OAuth authorization request, bound to the user
+// who started it. The callback must return an issued state for the same provider and
+// user, which is then deleted. CodeVerifier is the PKCE verifier sent with the token
+// exchange that follows.
+type OAuthState struct {
+	Value        string    `gorm:"type:text;primary_key" json:"-"`
+	Provider     string    `gorm:"type:text;not null" json:"provider"`
+	UserID       uuid.UUID `gorm:"type:text;not null" json:"user_id"`
+	CodeVerifier string    `gorm:"type:text" json:"-"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Report job kinds
+const (
+	ReportJobAuditStatistics  = "audit_statistics"
+	ReportJobComplianceReport = "compliance_report"
+	ReportJobAuditExport      = "audit_export"
+	ReportJobAuditFileExport  = "audit_file_export"
+	ReportJobUserDataExport   = "user_data_export" // GDPR subject access export
+	ReportJobPrivilegeReview  = "privilege_review"
+)
+
+// Report job statuses
+const (
+	ReportJobPending   = "pending"
+	ReportJobRunning   = "running"
+	ReportJobCompleted = "completed"
+	ReportJobFailed    = "failed"
+	ReportJobCancelled = "cancelled"
+)
+
+// Report job log levels
+const (
+	ReportJobLogInfo  = "info"
+	ReportJobLogWarn  = "warn"
+	ReportJobLogError = "error"
+)
+
+// ReportJob is a report or export too large to produce within a request, run in the
+// background on the shared job queue and polled for its progress and result
+type ReportJob struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Kind            string     `gorm:"type:text;not null;index" json:"kind"`
+	ReportType      string     `gorm:"type:text" json:"report_type,omitempty"`
+	StartTime       time.Time  `gorm:"not null" json:"start_time"`
+	EndTime         time.Time  `gorm:"not null" json:"end_time"`
+	SubjectID       *uuid.UUID `gorm:"type:text;index" json:"subject_id,omitempty"` // user whose data is exported
+	Status          string     `gorm:"type:text;not null;index" json:"status"`
+	Progress        int        `json:"progress"` // percent
+	ProgressMessage string     `gorm:"type:text" json:"progress_message,omitempty"`
+	CancelRequested bool       `json:"cancel_requested"`
+	Result          string     `gorm:"type:text" json:"-"` // JSON
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	RequestedBy     *uuid.UUID `gorm:"type:text;index" json:"requested_by,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (j *ReportJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsFinished reports whether the job has reached a final status
+func (j *ReportJob) IsFinished() bool {
+	return j.Status == ReportJobCompleted || j.Status == ReportJobFailed || j.Status == ReportJobCancelled
+}
+
+// ReportJobLog is a line of a background job's log
+type ReportJobLog struct {
+	ID        uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	JobID     uuid.UUID `gorm:"type:text;not null;index" json:"job_id"`
+	Level     string    `gorm:"type:text;not null" json:"level"`
+	Message   string    `gorm:"type:text;not null" json:"message"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (l *ReportJobLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
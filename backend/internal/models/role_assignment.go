@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Privileged roles
+const (
+	RoleAdmin           = "admin"
+	RoleSecurityAnalyst = "security_analyst"
+)
+
+// Permissions granted by the privileged roles
+const (
+	PermissionSecurityMonitor = "security:monitor" // alerts, detections, playbooks and watchlists
+	PermissionIncidentManage  = "incidents:manage" // investigation cases
+	PermissionRiskPolicy      = "risk:policy"      // adaptive authentication thresholds
+	PermissionAuditRead       = "audit:read"       // audit logs, exports and compliance reports
+	PermissionAdminManage     = "admin:manage"     // the /admin API
+	PermissionRoleManage      = "roles:manage"     // assigning and revoking roles
+)
+
+// RolePermissions lists what each role may do
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionSecurityMonitor, PermissionIncidentManage, PermissionRiskPolicy,
+		PermissionAuditRead, PermissionAdminManage, PermissionRoleManage,
+	},
+	RoleSecurityAnalyst: {
+		PermissionSecurityMonitor, PermissionIncidentManage, PermissionRiskPolicy, PermissionAuditRead,
+	},
+}
+
+// RoleAssignment grants a user a privileged role, reviewed periodically for unused privilege
+type RoleAssignment struct {
+	ID         uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:text;not null;uniqueIndex:idx_role_assignments_user_role" json:"user_id"`
+	Role       string     `gorm:"type:text;not null;uniqueIndex:idx_role_assignments_user_role" json:"role"`
+	AssignedBy *uuid.UUID `gorm:"type:text" json:"assigned_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *RoleAssignment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SAMLIdentityProvider is the identity provider trusted for an app's SAML sign-ins.
+// Responses are only accepted from EntityID and signed by one of its certificates.
+type SAMLIdentityProvider struct {
+	ID           uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AppID        string     `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	EntityID     string     `gorm:"type:text;not null" json:"entity_id"`
+	SSOURL       string     `gorm:"type:text" json:"sso_url"`
+	Certificates string     `gorm:"type:text;not null" json:"certificates"` // base64 DER signing certificates, one per line
+	MetadataURL  string     `gorm:"type:text" json:"metadata_url,omitempty"`
+	UpdatedBy    *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *SAMLIdentityProvider) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SAMLRelyingParty is a service provider that signs users in with CloudGate as its SAML
+// identity provider. Responses only go to its registered ACS URL.
+type SAMLRelyingParty struct {
+	ID           uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	AppID        string    `gorm:"type:text;not null;uniqueIndex" json:"app_id"`
+	EntityID     string    `gorm:"type:text;not null;uniqueIndex" json:"entity_id"`
+	ACSURL       string    `gorm:"type:text;not null" json:"acs_url"`
+	NameIDFormat string    `gorm:"type:text;not null" json:"name_id_format"` // email, persistent or unspecified
+	// AttributeMappings is a JSON object of SAML attribute names to the user field sent in each
+	AttributeMappings string     `gorm:"type:text" json:"attribute_mappings"`
+	UpdatedBy         *uuid.UUID `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *SAMLRelyingParty) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
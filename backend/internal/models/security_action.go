@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SecurityActionExecution records one response action carried out by the security
+// monitor, such as blocking an IP address or locking an account, and whether it worked
+type SecurityActionExecution struct {
+	ID          uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	ActionID    uuid.UUID  `gorm:"type:text;not null" json:"action_id"`
+	Type        string     `gorm:"type:text;not null;index" json:"type"`
+	Description string     `gorm:"type:text" json:"description"`
+	AlertID     *uuid.UUID `gorm:"type:text;index" json:"alert_id,omitempty"`
+	UserID      *uuid.UUID `gorm:"type:text;index" json:"user_id,omitempty"`
+	IPAddress   string     `gorm:"type:text;index" json:"ip_address,omitempty"`
+	Status      string     `gorm:"type:text;not null" json:"status"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	Metadata    string     `gorm:"type:text" json:"metadata"` // JSON
+	PerformedBy *uuid.UUID `gorm:"type:text" json:"performed_by,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (e *SecurityActionExecution) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SecurityAlertRecord is a security monitoring alert as stored for triage, with the
+// priority score analysts' queue is ordered by
+type SecurityAlertRecord struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Type            string     `gorm:"type:text;not null;index" json:"type"`
+	Severity        Severity   `gorm:"type:text;not null;index;check:chk_security_alert_records_severity,severity IN ('low','medium','high','critical')" json:"severity"`
+	Title           string     `gorm:"type:text;not null" json:"title"`
+	Description     string     `gorm:"type:text" json:"description"`
+	Source          string     `gorm:"type:text" json:"source"`
+	UserID          *uuid.UUID `gorm:"type:text;index" json:"user_id,omitempty"`
+	IPAddress       string     `gorm:"type:text;index" json:"ip_address"`
+	UserAgent       string     `gorm:"type:text" json:"user_agent"`
+	Metadata        string     `gorm:"type:text" json:"metadata"` // JSON
+	Tags            string     `gorm:"type:text" json:"tags"`     // JSON
+	Status          string     `gorm:"type:text;not null;index" json:"status"`
+	AssignedTo      *uuid.UUID `gorm:"type:text;index" json:"assigned_to,omitempty"`
+	PriorityScore   float64    `gorm:"index" json:"priority_score"`
+	PriorityFactors string     `gorm:"type:text" json:"priority_factors"` // JSON
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *SecurityAlertRecord) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeSave rejects severities outside the enum
+func (a *SecurityAlertRecord) BeforeSave(tx *gorm.DB) error {
+	if a.Severity != "" && !a.Severity.Valid() {
+		return invalidValue("severity", string(a.Severity))
+	}
+	return nil
+}
+
+// AlertLinkClick records a click on a signed acknowledge or escalate link from an alert
+// email: who it was sent to, which analyst that matched, and where the click came from.
+// Each link's signature is stored so the link only works once.
+type AlertLinkClick struct {
+	ID            uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	AlertID       uuid.UUID  `gorm:"type:text;not null;index" json:"alert_id"`
+	Action        string     `gorm:"type:text;not null" json:"action"` // acknowledge, escalate
+	Recipient     string     `gorm:"type:text;not null" json:"recipient"`
+	UserID        *uuid.UUID `gorm:"type:text;index" json:"user_id,omitempty"`
+	IPAddress     string     `gorm:"type:text" json:"ip_address"`
+	UserAgent     string     `gorm:"type:text" json:"user_agent"`
+	SignatureHash string     `gorm:"type:text;not null;uniqueIndex" json:"-"`
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (c *AlertLinkClick) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ServiceAccount is an internal service that calls CloudGate with a client certificate.
+// The certificate is matched by its SHA-256 fingerprint, a URI SAN (such as a SPIFFE ID)
+// or its subject common name, in that order.
+type ServiceAccount struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Name            string     `gorm:"type:text;not null;uniqueIndex" json:"name"`
+	Description     string     `gorm:"type:text" json:"description"`
+	CertFingerprint string     `gorm:"type:text;index" json:"cert_fingerprint,omitempty"` // lowercase hex SHA-256 of the DER certificate
+	CertURI         string     `gorm:"type:text;index" json:"cert_uri,omitempty"`
+	CertSubject     string     `gorm:"type:text;index" json:"cert_subject,omitempty"` // subject common name
+	Scopes          string     `gorm:"type:text;not null" json:"scopes"`              // space separated, e.g. events:login events:api
+	Enabled         bool       `gorm:"not null" json:"enabled"`
+	EventRateLimit  int        `gorm:"not null;default:0" json:"event_rate_limit"` // events per second per instance; 0 uses SERVICE_EVENT_RATE_LIMIT
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+	LastSeenSerial  string     `gorm:"type:text" json:"last_seen_serial,omitempty"`
+	CreatedBy       *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *ServiceAccount) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
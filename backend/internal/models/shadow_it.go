@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DiscoveredApp is a SaaS app employees use that is not in the app catalog, found in
+// browser extension domain reports or in OAuth grants on a connected tenant
+type DiscoveredApp struct {
+	ID           uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	DiscoveryKey string     `gorm:"type:text;not null;uniqueIndex" json:"discovery_key"` // domain:<host> or <source>:<client id>
+	Name         string     `gorm:"type:text;not null" json:"name"`
+	Domain       string     `gorm:"type:text;index" json:"domain,omitempty"`
+	ClientID     string     `gorm:"type:text" json:"client_id,omitempty"`
+	Source       string     `gorm:"type:text;not null;index" json:"source"` // browser_extension, google_oauth, microsoft_oauth
+	Users        int64      `gorm:"default:0" json:"users"`
+	Visits       int64      `gorm:"default:0" json:"visits"`
+	LoginForms   int64      `gorm:"default:0" json:"login_forms"`
+	Scopes       string     `gorm:"type:text" json:"scopes,omitempty"` // space separated, as granted
+	TenantWide   bool       `gorm:"default:false" json:"tenant_wide"`  // an administrator consented for every user
+	RiskScore    int        `gorm:"default:0" json:"risk_score"`
+	RiskLevel    string     `gorm:"type:text;not null;index" json:"risk_level"`                  // low, medium, high
+	Status       string     `gorm:"type:text;not null;default:'unreviewed';index" json:"status"` // unreviewed, sanctioned, blocked
+	ReviewNote   string     `gorm:"type:text" json:"review_note,omitempty"`
+	ReviewedBy   *uuid.UUID `gorm:"type:text" json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	FirstSeen    time.Time  `gorm:"not null" json:"first_seen"`
+	LastSeen     time.Time  `gorm:"not null;index" json:"last_seen"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *DiscoveredApp) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// DiscoveredAppGrant is one user's OAuth grant to a discovered app, as of the latest scan
+type DiscoveredAppGrant struct {
+	ID              uuid.UUID `gorm:"type:text;primary_key" json:"id"`
+	DiscoveredAppID uuid.UUID `gorm:"type:text;not null;uniqueIndex:idx_discovered_grant" json:"discovered_app_id"`
+	UserEmail       string    `gorm:"type:text;not null;uniqueIndex:idx_discovered_grant" json:"user_email"` // "*" for tenant-wide consent
+	Scopes          string    `gorm:"type:text" json:"scopes"`
+	LastSeen        time.Time `gorm:"not null;index" json:"last_seen"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (g *DiscoveredAppGrant) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return nil
+}
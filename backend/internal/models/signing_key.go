@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Signing key lifecycle. A next key is published before it signs so relying parties can
+// pick it up; a retiring key no longer signs but stays published until tokens it signed expire.
+const (
+	SigningKeyNext     = "next"
+	SigningKeyActive   = "active"
+	SigningKeyRetiring = "retiring"
+	SigningKeyRetired  = "retired"
+)
+
+// SigningKey is an RSA key pair and self-signed certificate used to sign SAML and
+// WS-Federation assertions and published in JWKS and federation metadata
+type SigningKey struct {
+	ID              uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	KID             string     `gorm:"column:kid;type:text;not null;uniqueIndex" json:"kid"` // RFC 7638 JWK thumbprint
+	Algorithm       string     `gorm:"type:text;not null" json:"algorithm"`
+	Status          string     `gorm:"type:text;not null;index" json:"status"`
+	Source          string     `gorm:"type:text;not null" json:"source"`      // generated, imported
+	Certificate     string     `gorm:"type:text;not null" json:"certificate"` // base64 DER
+	PrivateKey      string     `gorm:"type:text;not null" json:"-"`           // PKCS #8, sealed
+	NotBefore       time.Time  `json:"not_before"`
+	NotAfter        time.Time  `gorm:"index" json:"not_after"`
+	ActivatesAt     *time.Time `json:"activates_at,omitempty"`
+	ActivatedAt     *time.Time `json:"activated_at,omitempty"`
+	RetiresAt       *time.Time `json:"retires_at,omitempty"`
+	RetiredAt       *time.Time `json:"retired_at,omitempty"`
+	ExpiryAlertedAt *time.Time `json:"expiry_alerted_at,omitempty"`
+	CreatedBy       *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (k *SigningKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
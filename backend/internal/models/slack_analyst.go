@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SlackAnalyst maps a Slack user to the CloudGate analyst their slash commands and alert
+// buttons act as. Analysts who connected Slack through OAuth are mapped without one.
+type SlackAnalyst struct {
+	TeamID      string     `gorm:"type:text;primary_key" json:"team_id"`
+	SlackUserID string     `gorm:"type:text;primary_key" json:"slack_user_id"`
+	UserID      uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	LinkedBy    *uuid.UUID `gorm:"type:text" json:"linked_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,182 @@
+package models
+
+import "fmt"
+
+// Severity is how serious an alert or security event is
+type Severity string
+
+// Severities, from least to most serious
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// Rank orders severities from 1 for low to 4 for critical; unknown severities rank 0
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	}
+	return 0
+}
+
+// Valid reports whether s is one of the severities
+func (s Severity) Valid() bool {
+	return s.Rank() > 0
+}
+
+// Compare returns -1, 0 or 1 as s is less, as or more serious than other
+func (s Severity) Compare(other Severity) int {
+	return compareRanks(s.Rank(), other.Rank())
+}
+
+// Escalate returns the next severity, capped at critical
+func (s Severity) Escalate() Severity {
+	switch s {
+	case SeverityLow:
+		return SeverityMedium
+	case SeverityMedium:
+		return SeverityHigh
+	default:
+		return SeverityCritical
+	}
+}
+
+// ParseSeverity validates a severity given as a string
+func ParseSeverity(value string) (Severity, error) {
+	severity := Severity(value)
+	if !severity.Valid() {
+		return "", invalidValue("severity", value)
+	}
+	return severity, nil
+}
+
+// RiskLevel is how risky an assessed sign-in or user is
+type RiskLevel string
+
+// Risk levels, from least to most risky
+const (
+	RiskLow      RiskLevel = "low"
+	RiskMedium   RiskLevel = "medium"
+	RiskHigh     RiskLevel = "high"
+	RiskCritical RiskLevel = "critical"
+)
+
+// Rank orders risk levels from 1 for low to 4 for critical; unknown levels rank 0
+func (l RiskLevel) Rank() int {
+	switch l {
+	case RiskLow:
+		return 1
+	case RiskMedium:
+		return 2
+	case RiskHigh:
+		return 3
+	case RiskCritical:
+		return 4
+	}
+	return 0
+}
+
+// Valid reports whether l is one of the risk levels
+func (l RiskLevel) Valid() bool {
+	return l.Rank() > 0
+}
+
+// Compare returns -1, 0 or 1 as l is less, as or more risky than other
+func (l RiskLevel) Compare(other RiskLevel) int {
+	return compareRanks(l.Rank(), other.Rank())
+}
+
+// ConnectionStatus is where a user's connection to an app stands
+type ConnectionStatus string
+
+// Connection statuses
+const (
+	ConnectionPending   ConnectionStatus = "pending"
+	ConnectionConnected ConnectionStatus = "connected"
+	ConnectionError     ConnectionStatus = "error"
+	ConnectionRevoked   ConnectionStatus = "revoked"
+)
+
+// Valid reports whether s is one of the connection statuses
+func (s ConnectionStatus) Valid() bool {
+	switch s {
+	case ConnectionPending, ConnectionConnected, ConnectionError, ConnectionRevoked:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether the connection is over; a revoked connection has dropped its
+// tokens and has to be authorized from scratch
+func (s ConnectionStatus) IsTerminal() bool {
+	return s == ConnectionRevoked
+}
+
+// ParseConnectionStatus validates a connection status given as a string
+func ParseConnectionStatus(value string) (ConnectionStatus, error) {
+	status := ConnectionStatus(value)
+	if !status.Valid() {
+		return "", invalidValue("connection status", value)
+	}
+	return status, nil
+}
+
+// HealthStatus is how a connection answered its last health check
+type HealthStatus string
+
+// Health statuses
+const (
+	HealthHealthy HealthStatus = "healthy"
+	HealthUnknown HealthStatus = "unknown"
+	HealthWarning HealthStatus = "warning"
+	HealthError   HealthStatus = "error"
+)
+
+// Rank orders health statuses from 1 for healthy to 4 for error, with connections never
+// checked between healthy and warning; unknown values rank 0
+func (s HealthStatus) Rank() int {
+	switch s {
+	case HealthHealthy:
+		return 1
+	case HealthUnknown:
+		return 2
+	case HealthWarning:
+		return 3
+	case HealthError:
+		return 4
+	}
+	return 0
+}
+
+// Valid reports whether s is one of the health statuses
+func (s HealthStatus) Valid() bool {
+	return s.Rank() > 0
+}
+
+// Compare returns -1, 0 or 1 as s is healthier than, as healthy as or less healthy than other
+func (s HealthStatus) Compare(other HealthStatus) int {
+	return compareRanks(s.Rank(), other.Rank())
+}
+
+func compareRanks(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func invalidValue(kind, value string) error {
+	return fmt.Errorf("invalid %s %q", kind, value)
+}
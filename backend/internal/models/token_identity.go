@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenIdentity is the caller an external identity provider's access token was verified for
+type TokenIdentity struct {
+	UserID   uuid.UUID
+	Email    string
+	Username string
+	// Roles are every realm and client role the provider put in the token
+	Roles []string
+	// GrantedRoles are the CloudGate roles those provider roles grant, if the provider is trusted to grant any
+	GrantedRoles []string
+	// Scopes limit a token issued to a third-party client to those API scopes; nil when the
+	// token was issued to CloudGate itself and carries the user's full access
+	Scopes   []string
+	AAL      int
+	IssuedAt time.Time
+}
@@ -21,6 +21,9 @@ type User struct {
 	ProfilePictureURL string         `json:"profile_picture_url,omitempty"`
 	LastLoginAt       *time.Time     `json:"last_login_at,omitempty"`
 	IsActive          bool           `gorm:"default:true" json:"is_active"`
+	LockedAt          *time.Time     `json:"locked_at,omitempty"`
+	LockedUntil       *time.Time     `json:"locked_until,omitempty"` // nil locks until unlocked
+	LockReason        string         `gorm:"type:text" json:"lock_reason,omitempty"`
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
 	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
@@ -39,22 +42,46 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsLocked reports whether sign-in is refused because the account was locked
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedAt != nil && (u.LockedUntil == nil || now.Before(*u.LockedUntil))
+}
+
 // Session represents a user session
 type Session struct {
-	ID           uuid.UUID `gorm:"type:text;primary_key" json:"id"`
-	UserID       uuid.UUID `gorm:"type:text;not null;index" json:"user_id"`
-	SessionToken string    `gorm:"uniqueIndex;not null" json:"session_token"`
-	IPAddress    string    `json:"ip_address"`
-	UserAgent    string    `json:"user_agent"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	IsActive     bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                 uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID             uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	SessionToken       string     `gorm:"uniqueIndex;not null" json:"session_token"`
+	IPAddress          string     `json:"ip_address"`
+	UserAgent          string     `json:"user_agent"`
+	ExpiresAt          time.Time  `json:"expires_at"`
+	IsActive           bool       `gorm:"default:true" json:"is_active"`
+	AuthLevel          int        `gorm:"default:1" json:"auth_level"`
+	AuthMethod         string     `gorm:"type:text;default:'password'" json:"auth_method"`
+	ImpersonatorID     *uuid.UUID `gorm:"type:text;index" json:"impersonator_id,omitempty"` // set on impersonation sessions
+	AuthenticatedAt    *time.Time `json:"authenticated_at,omitempty"`                       // last sign-in or step-up; nil means at creation
+	IdleTimeoutMinutes int        `gorm:"default:0" json:"idle_timeout_minutes,omitempty"`  // set by risk policy; 0 means SESSION_IDLE_TIMEOUT
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 
 	// Relationships
 	User User `gorm:"foreignKey:UserID" json:"-"`
 }
 
+// Authentication assurance levels a session can reach
+const (
+	AAL1 = 1 // password only
+	AAL2 = 2 // password plus a second factor (TOTP or backup code)
+	AAL3 = 3 // phishing-resistant authenticator (WebAuthn)
+)
+
+// How the user proved their identity when a session was created
+const (
+	AuthMethodPassword      = "password"
+	AuthMethodKerberos      = "kerberos"      // SPNEGO from a domain-joined device
+	AuthMethodImpersonation = "impersonation" // an administrator acting as the user
+)
+
 // BeforeCreate hook to generate UUID
 func (s *Session) BeforeCreate(tx *gorm.DB) error {
 	if s.ID == uuid.Nil {
@@ -109,7 +136,8 @@ type AuditLog struct {
 	IPAddress  string     `json:"ip_address"`
 	UserAgent  string     `json:"user_agent"`
 	Details    string     `gorm:"type:text" json:"details,omitempty"`
-	Status     string     `gorm:"default:'success'" json:"status"` // success, failure, warning
+	Status     string     `gorm:"default:'success'" json:"status"`         // success, failure, warning
+	Region     string     `gorm:"type:text;index" json:"region,omitempty"` // data residency region the entry is stored in
 	CreatedAt  time.Time  `json:"created_at"`
 
 	// Relationships
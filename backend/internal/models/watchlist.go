@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WatchlistEntry flags a user for enhanced security monitoring
+type WatchlistEntry struct {
+	ID                 uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	UserID             uuid.UUID  `gorm:"type:text;not null;index" json:"user_id"`
+	Reason             string     `gorm:"type:text;not null" json:"reason"`
+	AddedBy            *uuid.UUID `gorm:"type:text" json:"added_by,omitempty"`
+	ThresholdFactor    float64    `gorm:"not null" json:"threshold_factor"` // multiplies alert/risk thresholds, e.g. 0.5 halves them
+	FullSessionLogging bool       `json:"full_session_logging"`
+	ExpiresAt          time.Time  `gorm:"not null;index" json:"expires_at"`
+	RemovedAt          *time.Time `json:"removed_at,omitempty"`
+	RemovedBy          *uuid.UUID `gorm:"type:text" json:"removed_by,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// BeforeCreate hook to generate UUID
+func (w *WatchlistEntry) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive reports whether the entry is still in force
+func (w *WatchlistEntry) IsActive() bool {
+	return w.RemovedAt == nil && time.Now().Before(w.ExpiresAt)
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Outbound webhook sources
+const (
+	WebhookSourceAlert    = "alert"
+	WebhookSourceAudit    = "audit"
+	WebhookSourceProvider = "provider"
+	WebhookSourceJob      = "job"
+)
+
+// Dead-letter statuses
+const (
+	DeadLetterFailed   = "failed"
+	DeadLetterReplayed = "replayed"
+)
+
+// WebhookDeadLetter is an outbound webhook delivery that exhausted its retries,
+// kept so an admin can inspect it and replay it once the receiver is fixed
+type WebhookDeadLetter struct {
+	ID             uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	Source         string     `gorm:"type:text;not null;index" json:"source"`
+	EventType      string     `gorm:"type:text;index" json:"event_type"`
+	URL            string     `gorm:"type:text;not null" json:"url"`
+	Headers        string     `gorm:"type:text" json:"-"` // JSON; may carry receiver credentials
+	Payload        string     `gorm:"type:text;not null" json:"payload"`
+	Status         string     `gorm:"type:text;not null;index" json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastResponse   string     `gorm:"type:text" json:"last_response,omitempty"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	LastAttemptAt  time.Time  `json:"last_attempt_at"`
+	ReplayedAt     *time.Time `json:"replayed_at,omitempty"`
+	ReplayedBy     *uuid.UUID `gorm:"type:text" json:"replayed_by,omitempty"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (d *WebhookDeadLetter) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// Webhook signing key statuses. A rotated-out key keeps signing alongside its
+// replacement until RetiresAt, so the consumer can switch secrets without dropping
+// deliveries.
+const (
+	WebhookKeyActive   = "active"
+	WebhookKeyRetiring = "retiring"
+	WebhookKeyRetired  = "retired"
+)
+
+// WebhookConsumer is a receiver of outbound webhooks. Deliveries to its URL are signed
+// with its own keys, so one consumer's secret cannot forge deliveries to another.
+type WebhookConsumer struct {
+	ID          uuid.UUID           `gorm:"type:text;primary_key" json:"id"`
+	Name        string              `gorm:"type:text;not null" json:"name"`
+	URL         string              `gorm:"type:text;not null;uniqueIndex" json:"url"`
+	Description string              `gorm:"type:text" json:"description,omitempty"`
+	Keys        []WebhookSigningKey `gorm:"foreignKey:ConsumerID" json:"keys,omitempty"`
+	CreatedBy   *uuid.UUID          `gorm:"type:text" json:"created_by,omitempty"`
+	UpdatedBy   *uuid.UUID          `gorm:"type:text" json:"updated_by,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (w *WebhookConsumer) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookSigningKey is an HMAC-SHA256 secret a consumer verifies deliveries with
+type WebhookSigningKey struct {
+	ID         uuid.UUID  `gorm:"type:text;primary_key" json:"id"`
+	ConsumerID uuid.UUID  `gorm:"type:text;not null;index" json:"consumer_id"`
+	KeyID      string     `gorm:"type:text;not null;uniqueIndex" json:"key_id"`
+	Secret     string     `gorm:"type:text;not null" json:"-"` // sealed
+	Status     string     `gorm:"type:text;not null;index" json:"status"`
+	RetiresAt  *time.Time `json:"retires_at,omitempty"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+	CreatedBy  *uuid.UUID `gorm:"type:text" json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (k *WebhookSigningKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxOverrideDuration caps how long a single override may bypass a schedule
+const maxOverrideDuration = 24 * time.Hour
+
+var (
+	// ErrScheduleNotFound is returned when an app has no access schedule
+	ErrScheduleNotFound = errors.New("access schedule not found")
+	// ErrInvalidSchedule is returned for malformed times, days, countries or timezones
+	ErrInvalidSchedule = errors.New("invalid access schedule")
+	// ErrOverrideNotFound is returned when an override request does not exist
+	ErrOverrideNotFound = errors.New("access override request not found")
+	// ErrOverrideAlreadyReviewed is returned when approving or denying a decided request
+	ErrOverrideAlreadyReviewed = errors.New("access override request already reviewed")
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// AccessScheduleInput describes a schedule as entered by an admin
+type AccessScheduleInput struct {
+	Timezone         string
+	StartTime        string
+	EndTime          string
+	Days             []string
+	AllowedCountries []string
+	Enabled          bool
+}
+
+// AccessCheckResult explains whether a user may use an app right now
+type AccessCheckResult struct {
+	Allowed    bool       `json:"allowed"`
+	Reason     string     `json:"reason,omitempty"`
+	OverrideID *uuid.UUID `json:"override_id,omitempty"`
+}
+
+// AccessScheduleService enforces per-app time-of-day and location restrictions
+type AccessScheduleService struct {
+	db *gorm.DB
+}
+
+// NewAccessScheduleService creates a new access schedule service
+func NewAccessScheduleService(db *gorm.DB) *AccessScheduleService {
+	return &AccessScheduleService{db: db}
+}
+
+// SetSchedule creates or replaces the access schedule for an app
+func (s *AccessScheduleService) SetSchedule(appID string, input AccessScheduleInput, actor *uuid.UUID) (*models.AppAccessSchedule, error) {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, input.Timezone)
+	}
+	if (input.StartTime == "") != (input.EndTime == "") {
+		return nil, fmt.Errorf("%w: start_time and end_time must be set together", ErrInvalidSchedule)
+	}
+	for _, t := range []string{input.StartTime, input.EndTime} {
+		if t == "" {
+			continue
+		}
+		if _, err := parseClock(t); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+
+	days := make([]string, 0, len(input.Days))
+	for _, d := range input.Days {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if _, ok := weekdayNames[d]; !ok {
+			return nil, fmt.Errorf("%w: unknown day %q", ErrInvalidSchedule, d)
+		}
+		days = append(days, d)
+	}
+	countries := make([]string, 0, len(input.AllowedCountries))
+	for _, c := range input.AllowedCountries {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if len(c) != 2 {
+			return nil, fmt.Errorf("%w: country %q must be a two-letter ISO code", ErrInvalidSchedule, c)
+		}
+		countries = append(countries, c)
+	}
+
+	var schedule models.AppAccessSchedule
+	err := s.db.Where("app_id = ?", appID).First(&schedule).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get access schedule: %w", err)
+	}
+
+	schedule.AppID = appID
+	schedule.Timezone = input.Timezone
+	schedule.StartTime = input.StartTime
+	schedule.EndTime = input.EndTime
+	schedule.Days = strings.Join(days, ",")
+	schedule.AllowedCountries = strings.Join(countries, ",")
+	schedule.Enabled = input.Enabled
+	schedule.UpdatedBy = actor
+
+	if err := s.db.Save(&schedule).Error; err != nil {
+		return nil, fmt.Errorf("failed to save access schedule: %w", err)
+	}
+
+	s.audit(actor, "access_schedule_updated", appID, fmt.Sprintf("window=%s-%s %s days=%s countries=%s enabled=%t",
+		schedule.StartTime, schedule.EndTime, schedule.Timezone, schedule.Days, schedule.AllowedCountries, schedule.Enabled))
+	recordConfigChange(ConfigKindPolicies, "access_schedule:"+appID, actor, "Access schedule updated", input)
+	return &schedule, nil
+}
+
+// GetSchedule returns the access schedule for an app
+func (s *AccessScheduleService) GetSchedule(appID string) (*models.AppAccessSchedule, error) {
+	var schedule models.AppAccessSchedule
+	err := s.db.Where("app_id = ?", appID).First(&schedule).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// ListSchedules returns every configured access schedule
+func (s *AccessScheduleService) ListSchedules() ([]models.AppAccessSchedule, error) {
+	var schedules []models.AppAccessSchedule
+	if err := s.db.Order("app_id ASC").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list access schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule removes an app's access schedule
+func (s *AccessScheduleService) DeleteSchedule(appID string, actor *uuid.UUID) error {
+	result := s.db.Where("app_id = ?", appID).Delete(&models.AppAccessSchedule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete access schedule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrScheduleNotFound
+	}
+
+	s.audit(actor, "access_schedule_deleted", appID, "Access schedule removed")
+	recordConfigChange(ConfigKindPolicies, "access_schedule:"+appID, actor, "Access schedule removed", nil)
+	return nil
+}
+
+// restoreSchedule puts an app's access schedule back to a recorded version
+func (s *AccessScheduleService) restoreSchedule(appID string, snapshot []byte, actor *uuid.UUID) error {
+	var input AccessScheduleInput
+	if err := json.Unmarshal(snapshot, &input); err != nil {
+		return fmt.Errorf("invalid access schedule snapshot: %w", err)
+	}
+	_, err := s.SetSchedule(appID, input, actor)
+	return err
+}
+
+// CheckAccess evaluates the app's schedule for a user at the given time and country.
+// An approved, unexpired override lets the user through and is audited each time it is used.
+func (s *AccessScheduleService) CheckAccess(userID uuid.UUID, appID, country string, at time.Time) (*AccessCheckResult, error) {
+	schedule, err := s.GetSchedule(appID)
+	if err == ErrScheduleNotFound {
+		return &AccessCheckResult{Allowed: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !schedule.Enabled {
+		return &AccessCheckResult{Allowed: true}, nil
+	}
+
+	reason := evaluateSchedule(schedule, country, at)
+	if reason == "" {
+		return &AccessCheckResult{Allowed: true}, nil
+	}
+
+	var override models.AccessOverrideRequest
+	err = s.db.Where("user_id = ? AND app_id = ? AND status = ? AND expires_at > ?", userID, appID, models.OverrideStatusApproved, at).
+		Order("expires_at DESC").First(&override).Error
+	if err == nil {
+		s.audit(&userID, "access_override_used", appID, fmt.Sprintf("Override %s bypassed schedule: %s", override.ID, reason))
+		return &AccessCheckResult{Allowed: true, Reason: reason, OverrideID: &override.ID}, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to check access overrides: %w", err)
+	}
+
+	s.audit(&userID, "access_schedule_blocked", appID, reason)
+	return &AccessCheckResult{Allowed: false, Reason: reason}, nil
+}
+
+// RequestOverride files a user's request to use an app outside its schedule
+func (s *AccessScheduleService) RequestOverride(userID uuid.UUID, appID, reason string, duration time.Duration) (*models.AccessOverrideRequest, error) {
+	if duration <= 0 || duration > maxOverrideDuration {
+		duration = time.Hour
+	}
+
+	request := models.AccessOverrideRequest{
+		UserID:      userID,
+		AppID:       appID,
+		Reason:      reason,
+		DurationMin: int(duration / time.Minute),
+		Status:      models.OverrideStatusPending,
+	}
+	if err := s.db.Create(&request).Error; err != nil {
+		return nil, fmt.Errorf("failed to request access override: %w", err)
+	}
+
+	s.audit(&userID, "access_override_requested", appID, reason)
+	return &request, nil
+}
+
+// ReviewOverride approves or denies a pending override. Approval starts the override clock.
+func (s *AccessScheduleService) ReviewOverride(requestID uuid.UUID, approve bool, reviewer *uuid.UUID, note string) (*models.AccessOverrideRequest, error) {
+	var request models.AccessOverrideRequest
+	err := s.db.First(&request, "id = ?", requestID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrOverrideNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access override: %w", err)
+	}
+	if request.Status != models.OverrideStatusPending {
+		return nil, ErrOverrideAlreadyReviewed
+	}
+
+	now := time.Now()
+	request.ReviewedBy = reviewer
+	request.ReviewNote = note
+	request.ReviewedAt = &now
+	action := "access_override_denied"
+	if approve {
+		expiresAt := now.Add(time.Duration(request.DurationMin) * time.Minute)
+		request.Status = models.OverrideStatusApproved
+		request.ExpiresAt = &expiresAt
+		action = "access_override_approved"
+	} else {
+		request.Status = models.OverrideStatusDenied
+	}
+
+	if err := s.db.Save(&request).Error; err != nil {
+		return nil, fmt.Errorf("failed to review access override: %w", err)
+	}
+
+	s.audit(reviewer, action, request.AppID, fmt.Sprintf("Override %s for user %s: %s", request.ID, request.UserID, note))
+	return &request, nil
+}
+
+// ListOverrides returns override requests, optionally filtered by status, newest first
+func (s *AccessScheduleService) ListOverrides(status string) ([]models.AccessOverrideRequest, error) {
+	query := s.db.Model(&models.AccessOverrideRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var requests []models.AccessOverrideRequest
+	if err := query.Order("created_at DESC").Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to list access overrides: %w", err)
+	}
+	return requests, nil
+}
+
+// evaluateSchedule returns why access is outside the schedule, or "" if it is inside
+func evaluateSchedule(schedule *models.AppAccessSchedule, country string, at time.Time) string {
+	if schedule.AllowedCountries != "" {
+		allowed := false
+		for _, c := range strings.Split(schedule.AllowedCountries, ",") {
+			if strings.EqualFold(c, country) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			if country == "" {
+				return "Location could not be determined and this app is restricted to specific countries"
+			}
+			return fmt.Sprintf("Access from %s is not allowed for this app", country)
+		}
+	}
+
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+
+	if schedule.Days != "" {
+		allowed := false
+		for _, d := range strings.Split(schedule.Days, ",") {
+			if weekdayNames[d] == local.Weekday() {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("This app is not available on %s", local.Weekday())
+		}
+	}
+
+	if schedule.StartTime != "" && schedule.EndTime != "" {
+		start, _ := parseClock(schedule.StartTime)
+		end, _ := parseClock(schedule.EndTime)
+		now := local.Hour()*60 + local.Minute()
+
+		var inside bool
+		if start <= end {
+			inside = now >= start && now < end
+		} else {
+			// Overnight window, e.g. 22:00-06:00
+			inside = now >= start || now < end
+		}
+		if !inside {
+			return fmt.Sprintf("This app is only available %s-%s %s", schedule.StartTime, schedule.EndTime, schedule.Timezone)
+		}
+	}
+
+	return ""
+}
+
+// parseClock converts HH:MM into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time %q must be HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *AccessScheduleService) audit(actor *uuid.UUID, action, appID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "app_access_schedule",
+		ResourceID: appID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit access schedule event: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cloudgate-backend/internal/models"
+)
+
+// RouteSensitivity classifies how much damage misuse of an endpoint could do
+type RouteSensitivity string
+
+const (
+	RouteSensitivityLow      RouteSensitivity = "low"
+	RouteSensitivityMedium   RouteSensitivity = "medium"
+	RouteSensitivityHigh     RouteSensitivity = "high"
+	RouteSensitivityCritical RouteSensitivity = "critical"
+)
+
+// requestRiskCacheTTL keeps the per-request check cheap for chatty clients
+const requestRiskCacheTTL = time.Minute
+
+// RoutePolicy is the risk tolerance of a route group. Requests above Tolerance must
+// have stepped up to StepUpAAL; requests above DenyAbove are refused outright.
+type RoutePolicy struct {
+	Sensitivity RouteSensitivity `json:"sensitivity"`
+	Tolerance   float64          `json:"tolerance"`
+	StepUpAAL   int              `json:"step_up_aal"`
+	DenyAbove   float64          `json:"deny_above"`
+}
+
+// RoutePolicyFor returns the policy for a sensitivity level
+func RoutePolicyFor(sensitivity RouteSensitivity) RoutePolicy {
+	switch sensitivity {
+	case RouteSensitivityMedium:
+		return RoutePolicy{Sensitivity: sensitivity, Tolerance: 0.7, StepUpAAL: models.AAL2, DenyAbove: 0.95}
+	case RouteSensitivityHigh:
+		return RoutePolicy{Sensitivity: sensitivity, Tolerance: 0.5, StepUpAAL: models.AAL2, DenyAbove: 0.85}
+	case RouteSensitivityCritical:
+		return RoutePolicy{Sensitivity: sensitivity, Tolerance: 0.3, StepUpAAL: models.AAL3, DenyAbove: 0.7}
+	default:
+		return RoutePolicy{Sensitivity: RouteSensitivityLow, Tolerance: 1.0, StepUpAAL: models.AAL1, DenyAbove: 1.0}
+	}
+}
+
+// RequestRiskContext is what the per-request check knows about a call
+type RequestRiskContext struct {
+	UserID    uuid.UUID
+	SessionID *uuid.UUID
+	IPAddress string
+	UserAgent string
+	AAL       int
+}
+
+// RequestAccessDecision is the outcome of a per-request conditional access check
+type RequestAccessDecision struct {
+	Decision    AuthDecisionType `json:"decision"`
+	RiskScore   float64          `json:"risk_score"`
+	RequiredAAL int              `json:"required_aal,omitempty"`
+	Reasons     []string         `json:"reasons"`
+}
+
+type cachedRequestRisk struct {
+	score     float64
+	reasons   []string
+	expiresAt time.Time
+}
+
+// EvaluateRequestAccess scores a single API call and applies the route's policy.
+// The score is a lightweight blend of the latest login assessment and signals
+// that the session has drifted since then; it avoids the full login evaluation. Its lookups
+// are cancelled with ctx.
+func (s *AdaptiveAuthService) EvaluateRequestAccess(ctx context.Context, riskCtx *RequestRiskContext, policy RoutePolicy) *RequestAccessDecision {
+	score, reasons := s.requestRisk(ctx, riskCtx)
+
+	decision := &RequestAccessDecision{
+		Decision:  AuthDecisionAllow,
+		RiskScore: score,
+		Reasons:   reasons,
+	}
+
+	switch {
+	case score <= policy.Tolerance:
+	case score > policy.DenyAbove:
+		decision.Decision = AuthDecisionDeny
+		go s.logRequestDenied(riskCtx, policy, score)
+	case riskCtx.AAL < policy.StepUpAAL:
+		decision.Decision = AuthDecisionChallenge
+		decision.RequiredAAL = policy.StepUpAAL
+	}
+
+	return decision
+}
+
+// requestRisk computes (or reuses) the risk score for a session/IP/user agent combination
+func (s *AdaptiveAuthService) requestRisk(ctx context.Context, riskCtx *RequestRiskContext) (float64, []string) {
+	sessionKey := ""
+	if riskCtx.SessionID != nil {
+		sessionKey = riskCtx.SessionID.String()
+	}
+	cacheKey := fmt.Sprintf("%s|%s|%s|%s", riskCtx.UserID, sessionKey, riskCtx.IPAddress, riskCtx.UserAgent)
+
+	s.requestRiskMutex.Lock()
+	if cached, ok := s.requestRiskCache[cacheKey]; ok && time.Now().Before(cached.expiresAt) {
+		s.requestRiskMutex.Unlock()
+		return cached.score, cached.reasons
+	}
+	s.requestRiskMutex.Unlock()
+
+	score := 0.0
+	reasons := []string{}
+
+	db, cancel := withDB(ctx, s.db)
+	defer cancel()
+
+	// Start from the most recent login assessment, if it is still relevant
+	latest, found, err := latestRiskAssessment(db, riskCtx.UserID, time.Now().Add(-24*time.Hour))
+	if err == nil && found {
+		score = latest.RiskScore
+		reasons = append(reasons, fmt.Sprintf("Latest login risk %.2f", latest.RiskScore))
+	}
+
+	// Compare the request against what the session was established with
+	if riskCtx.SessionID != nil {
+		var session models.Session
+		if err := db.First(&session, "id = ?", *riskCtx.SessionID).Error; err == nil {
+			if session.IPAddress != "" && session.IPAddress != riskCtx.IPAddress {
+				score += 0.3
+				reasons = append(reasons, "Request IP differs from session IP")
+			}
+			if session.UserAgent != "" && session.UserAgent != riskCtx.UserAgent {
+				score += 0.2
+				reasons = append(reasons, "User agent changed during session")
+			}
+		}
+	}
+
+	if s.isSuspiciousUserAgent(riskCtx.UserAgent) {
+		score += 0.3
+		reasons = append(reasons, "Automated client user agent")
+	}
+	if s.isHighRiskIP(ctx, riskCtx.IPAddress) || s.isTorExitNode(ctx, riskCtx.IPAddress) {
+		score += 0.3
+		reasons = append(reasons, "High-risk network")
+	}
+
+	if entry, watched := s.watchlistService.GetActiveEntry(riskCtx.UserID); watched {
+		score = score / entry.ThresholdFactor
+		reasons = append(reasons, "User is on the security watchlist")
+	}
+	score = math.Min(score, 1.0)
+
+	// Lookups cut short by a cancelled request may have missed risk, so are not reused
+	if ctx.Err() != nil {
+		return score, reasons
+	}
+
+	s.requestRiskMutex.Lock()
+	if s.requestRiskCache == nil {
+		s.requestRiskCache = make(map[string]cachedRequestRisk)
+	}
+	// Drop expired entries opportunistically so the cache stays bounded by active sessions
+	if len(s.requestRiskCache) > 10000 {
+		now := time.Now()
+		for k, v := range s.requestRiskCache {
+			if now.After(v.expiresAt) {
+				delete(s.requestRiskCache, k)
+			}
+		}
+	}
+	s.requestRiskCache[cacheKey] = cachedRequestRisk{score: score, reasons: reasons, expiresAt: time.Now().Add(requestRiskCacheTTL)}
+	s.requestRiskMutex.Unlock()
+
+	return score, reasons
+}
+
+func (s *AdaptiveAuthService) logRequestDenied(ctx *RequestRiskContext, policy RoutePolicy, score float64) {
+	log.Printf("🚫 API request denied for user %s (risk %.2f > %.2f on %s route)", ctx.UserID, score, policy.DenyAbove, policy.Sensitivity)
+	s.oauthMonitorService.CreateSecurityEvent(
+		ctx.UserID.String(),
+		"api_access_denied",
+		fmt.Sprintf("Request risk %.2f exceeded %s route tolerance", score, policy.Sensitivity),
+		"high",
+		ctx.IPAddress,
+		ctx.UserAgent,
+		"",
+		score,
+		nil,
+	)
+}
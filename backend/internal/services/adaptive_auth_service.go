@@ -1,11 +1,12 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"math"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +21,9 @@ type AdaptiveAuthService struct {
 	mfaService          *MFAService
 	oauthMonitorService *OAuthMonitoringService
 	userService         *UserService
+	watchlistService    *WatchlistService
+	requestRiskCache    map[string]cachedRequestRisk
+	requestRiskMutex    sync.Mutex
 }
 
 // AuthContext contains all context information for authentication decision
@@ -34,6 +38,34 @@ type AuthContext struct {
 	SessionInfo       map[string]interface{} `json:"session_info"`
 	RequestHeaders    map[string]string      `json:"request_headers"`
 	ApplicationID     string                 `json:"application_id,omitempty"`
+
+	// simulated assessments take the location as given and cache nothing
+	simulated bool
+	triggered []TriggeredRiskRule
+	// request is the context of the request being assessed, which lookups run under
+	request context.Context
+}
+
+// TriggeredRiskRule is a risk check that fired while assessing a login
+type TriggeredRiskRule struct {
+	Factor      string  `json:"factor"`
+	Rule        string  `json:"rule"`
+	Risk        float64 `json:"risk"` // added to the factor, which is capped at 1
+	Description string  `json:"description"`
+}
+
+// trigger records a risk check that fired and returns the risk it adds
+func (ctx *AuthContext) trigger(factor, rule string, risk float64, description string) float64 {
+	ctx.triggered = append(ctx.triggered, TriggeredRiskRule{Factor: factor, Rule: rule, Risk: risk, Description: description})
+	return risk
+}
+
+// requestContext returns the context lookups for the assessment run under
+func (ctx *AuthContext) requestContext() context.Context {
+	if ctx.request == nil {
+		return context.Background()
+	}
+	return ctx.request
 }
 
 // GeoLocation represents geographical location data
@@ -46,13 +78,16 @@ type GeoLocation struct {
 	ISP         string  `json:"isp"`
 	Timezone    string  `json:"timezone"`
 	VPNDetected bool    `json:"vpn_detected"`
+	// Autonomous system announcing the address, when GeoIP knows it
+	ASN            uint   `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
 }
 
 // AuthDecision represents the authentication decision
 type AuthDecision struct {
 	Decision        AuthDecisionType       `json:"decision"`
 	RiskScore       float64                `json:"risk_score"`
-	RiskLevel       string                 `json:"risk_level"`
+	RiskLevel       models.RiskLevel       `json:"risk_level"`
 	RequiredActions []AuthAction           `json:"required_actions"`
 	Reasoning       []string               `json:"reasoning"`
 	SessionDuration time.Duration          `json:"session_duration"`
@@ -114,6 +149,15 @@ const (
 	RestrictionSessionDuration RestrictionType = "session_duration"
 )
 
+// AuthSimulation is the decision EvaluateAuthentication would make for a login, with the
+// risk checks behind it
+type AuthSimulation struct {
+	Decision       *AuthDecision       `json:"decision"`
+	RiskFactors    *RiskFactors        `json:"risk_factors"`
+	TriggeredRules []TriggeredRiskRule `json:"triggered_rules"`
+	Context        *AuthContext        `json:"context"`
+}
+
 // RiskFactors contains individual risk assessment factors
 type RiskFactors struct {
 	LocationRisk    float64 `json:"location_risk"`
@@ -126,6 +170,29 @@ type RiskFactors struct {
 	VelocityRisk    float64 `json:"velocity_risk"`
 }
 
+// list returns the categories that carried risk as the factors of a stored assessment
+func (f RiskFactors) list() RiskFactorList {
+	factors := RiskFactorList{}
+	for _, category := range []struct {
+		name string
+		risk float64
+	}{
+		{"location", f.LocationRisk},
+		{"device", f.DeviceRisk},
+		{"behavioral", f.BehavioralRisk},
+		{"temporal", f.TemporalRisk},
+		{"network", f.NetworkRisk},
+		{"application", f.ApplicationRisk},
+		{"historical", f.HistoricalRisk},
+		{"velocity", f.VelocityRisk},
+	} {
+		if category.risk > 0 {
+			factors = append(factors, RiskFactor{Type: category.name, Score: category.risk})
+		}
+	}
+	return factors
+}
+
 // NewAdaptiveAuthService creates a new adaptive authentication service
 func NewAdaptiveAuthService(db *gorm.DB) *AdaptiveAuthService {
 	return &AdaptiveAuthService{
@@ -133,37 +200,97 @@ func NewAdaptiveAuthService(db *gorm.DB) *AdaptiveAuthService {
 		mfaService:          NewMFAService(db),
 		oauthMonitorService: NewOAuthMonitoringService(db),
 		userService:         NewUserService(db),
+		watchlistService:    NewWatchlistService(db),
+	}
+}
+
+// SetWatchlist shares the watchlist analysts edit, so a user added to it is judged against
+// lowered thresholds from their next sign-in rather than when this service's cache expires
+func (s *AdaptiveAuthService) SetWatchlist(watchlist *WatchlistService) {
+	s.watchlistService = watchlist
+}
+
+// EvaluateAuthentication performs comprehensive authentication evaluation. Lookups made on
+// the way are cancelled with ctx.
+func (s *AdaptiveAuthService) EvaluateAuthentication(ctx context.Context, authCtx *AuthContext) (*AuthDecision, error) {
+	authCtx.request = ctx
+
+	// 1-4. Assess the risk factors and decide
+	decision, riskFactors, err := s.decide(authCtx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("authentication evaluation cancelled: %w", err)
+	}
+	if decision.RiskLevel == models.RiskCritical {
+		go s.logSecurityEvent(authCtx, "critical_risk_access_denied", decision.RiskScore)
+	}
+
+	// 5. Store the assessment for learning
+	err = s.storeAuthAssessment(authCtx, decision, riskFactors)
+	if err != nil {
+		// Log error but don't fail the authentication
+		fmt.Printf("Failed to store auth assessment: %v\n", err)
+	}
+
+	// 6. Update user behavior patterns
+	go s.updateUserBehaviorPatterns(authCtx, decision)
+
+	return decision, nil
+}
+
+// SimulateAuthentication decides a hypothetical login the way EvaluateAuthentication
+// would, without storing the assessment, raising security events or caching threat intel.
+// A location in the context is used as given rather than replaced by GeoIP, and a zero
+// login time means now.
+func (s *AdaptiveAuthService) SimulateAuthentication(ctx context.Context, authCtx *AuthContext) (*AuthSimulation, error) {
+	authCtx.simulated = true
+	authCtx.triggered = nil
+	authCtx.request = ctx
+	if authCtx.LoginTime.IsZero() {
+		authCtx.LoginTime = time.Now()
+	}
+	decision, riskFactors, err := s.decide(authCtx)
+	if err != nil {
+		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("authentication simulation cancelled: %w", err)
+	}
+	triggered := authCtx.triggered
+	if triggered == nil {
+		triggered = []TriggeredRiskRule{}
+	}
+	return &AuthSimulation{Decision: decision, RiskFactors: riskFactors, TriggeredRules: triggered, Context: authCtx}, nil
 }
 
-// EvaluateAuthentication performs comprehensive authentication evaluation
-func (s *AdaptiveAuthService) EvaluateAuthentication(ctx *AuthContext) (*AuthDecision, error) {
+// decide assesses the risk factors and makes the decision, recording nothing
+func (s *AdaptiveAuthService) decide(ctx *AuthContext) (*AuthDecision, *RiskFactors, error) {
 	// 1. Perform comprehensive risk assessment
 	riskFactors, err := s.assessRiskFactors(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to assess risk factors: %w", err)
+		return nil, nil, fmt.Errorf("failed to assess risk factors: %w", err)
 	}
 
 	// 2. Calculate overall risk score
 	overallRisk := s.calculateOverallRisk(riskFactors)
 
-	// 3. Determine risk level
+	// 3. Determine risk level (watchlisted users are judged against lowered thresholds)
 	riskLevel := s.determineRiskLevel(overallRisk)
+	watchEntry, watched := s.watchlistService.GetActiveEntry(ctx.UserID)
+	if watched {
+		riskLevel = s.determineRiskLevel(math.Min(overallRisk/watchEntry.ThresholdFactor, 1.0))
+		ctx.trigger("watchlist", "watchlisted_user", 0, fmt.Sprintf("Risk thresholds lowered by a factor of %.2f", watchEntry.ThresholdFactor))
+	}
 
 	// 4. Make authentication decision based on risk
 	decision := s.makeAuthDecision(ctx, overallRisk, riskLevel, riskFactors)
-
-	// 5. Store the assessment for learning
-	err = s.storeAuthAssessment(ctx, decision, riskFactors)
-	if err != nil {
-		// Log error but don't fail the authentication
-		fmt.Printf("Failed to store auth assessment: %v\n", err)
+	if watched {
+		decision.Metadata["watchlisted"] = true
+		decision.Reasoning = append(decision.Reasoning, "User is on the security watchlist - stricter risk thresholds applied")
 	}
-
-	// 6. Update user behavior patterns
-	go s.updateUserBehaviorPatterns(ctx, decision)
-
-	return decision, nil
+	return decision, riskFactors, nil
 }
 
 // assessRiskFactors evaluates all risk factors
@@ -201,14 +328,22 @@ func (s *AdaptiveAuthService) assessRiskFactors(ctx *AuthContext) (*RiskFactors,
 func (s *AdaptiveAuthService) assessLocationRisk(ctx *AuthContext) float64 {
 	risk := 0.0
 
+	// Where GeoIP can locate the address it replaces the location the client reported, and
+	// is what the assessment stores. Simulations keep the location they are given.
+	if ctx.Location == nil || !ctx.simulated {
+		if located := LocateIP(ctx.requestContext(), ctx.IPAddress); located != nil {
+			ctx.Location = located
+		}
+	}
+
 	// Check if location is provided
 	if ctx.Location == nil {
-		return 0.3 // Moderate risk for unknown location
+		return ctx.trigger("location", "unknown_location", 0.3, "Location could not be determined") // Moderate risk for unknown location
 	}
 
 	// VPN/Proxy detection
 	if ctx.Location.VPNDetected {
-		risk += 0.4
+		risk += ctx.trigger("location", "vpn_or_proxy", 0.4, "VPN or proxy detected")
 	}
 
 	// Get user's historical locations
@@ -224,7 +359,7 @@ func (s *AdaptiveAuthService) assessLocationRisk(ctx *AuthContext) float64 {
 	}
 
 	if isNewCountry {
-		risk += 0.3
+		risk += ctx.trigger("location", "new_country", 0.3, fmt.Sprintf("First sign-in from %s", ctx.Location.Country))
 	}
 
 	// Calculate distance from usual locations
@@ -242,17 +377,14 @@ func (s *AdaptiveAuthService) assessLocationRisk(ctx *AuthContext) float64 {
 
 		// Add risk based on distance (normalized)
 		if minDistance > 1000 { // More than 1000km
-			risk += math.Min(0.3, minDistance/10000)
+			risk += ctx.trigger("location", "far_from_usual_locations", math.Min(0.3, minDistance/10000),
+				fmt.Sprintf("%.0f km from the nearest usual location", minDistance))
 		}
 	}
 
-	// Check for high-risk countries (simplified check)
-	highRiskCountries := []string{"CN", "RU", "KP", "IR"}
-	for _, country := range highRiskCountries {
-		if ctx.Location.Country == country {
-			risk += 0.2
-			break
-		}
+	// Check for high-risk countries
+	if isHighRiskCountry(ctx.Location.Country) {
+		risk += ctx.trigger("location", "high_risk_country", 0.2, fmt.Sprintf("Sign-in from high-risk country %s", ctx.Location.Country))
 	}
 
 	return math.Min(risk, 1.0)
@@ -265,19 +397,24 @@ func (s *AdaptiveAuthService) assessDeviceRisk(ctx *AuthContext) float64 {
 	// Check if device is known
 	isKnownDevice, err := IsNewDevice(ctx.UserID.String(), ctx.DeviceFingerprint)
 	if err != nil {
-		risk += 0.2 // Add risk for unknown device status
+		risk += ctx.trigger("device", "device_status_unknown", 0.2, "Device could not be checked") // Add risk for unknown device status
 	} else if isKnownDevice {
-		risk += 0.4 // New device adds significant risk
+		risk += ctx.trigger("device", "new_device", 0.4, "Unrecognized device") // New device adds significant risk
 	}
 
 	// Analyze user agent for suspicious patterns
 	if s.isSuspiciousUserAgent(ctx.UserAgent) {
-		risk += 0.3
+		risk += ctx.trigger("device", "suspicious_user_agent", 0.3, "Suspicious user agent")
 	}
 
 	// Check device consistency
 	if s.isInconsistentDevice(ctx) {
-		risk += 0.2
+		risk += ctx.trigger("device", "inconsistent_device", 0.2, "Inconsistent device fingerprint")
+	}
+
+	// Check the posture the device's agent or MDM last reported
+	if compliance := deviceCompliance(ctx.UserID, ctx.DeviceFingerprint); compliance != nil && !compliance.Compliant {
+		risk += ctx.trigger("device", "noncompliant_device", 0.3, "Device fails posture checks: "+strings.Join(compliance.Issues, "; "))
 	}
 
 	return math.Min(risk, 1.0)
@@ -292,17 +429,17 @@ func (s *AdaptiveAuthService) assessBehavioralRisk(ctx *AuthContext) float64 {
 
 	// Check login time patterns
 	if !s.isTypicalLoginTime(ctx.LoginTime, patterns) {
-		risk += 0.2
+		risk += ctx.trigger("behavioral", "atypical_login_time", 0.2, "Unusual sign-in time for the user")
 	}
 
 	// Check session patterns
 	if !s.isTypicalSessionPattern(ctx, patterns) {
-		risk += 0.2
+		risk += ctx.trigger("behavioral", "atypical_session", 0.2, "Unusual session pattern for the user")
 	}
 
 	// Check application access patterns
 	if ctx.ApplicationID != "" && !s.isTypicalApplicationAccess(ctx.UserID, ctx.ApplicationID) {
-		risk += 0.1
+		risk += ctx.trigger("behavioral", "atypical_application", 0.1, "Unusual application for the user")
 	}
 
 	return math.Min(risk, 1.0)
@@ -315,17 +452,17 @@ func (s *AdaptiveAuthService) assessTemporalRisk(ctx *AuthContext) float64 {
 	// Check for unusual hours
 	hour := ctx.LoginTime.Hour()
 	if hour < 6 || hour > 22 {
-		risk += 0.2
+		risk += ctx.trigger("temporal", "unusual_hours", 0.2, fmt.Sprintf("Sign-in at %02d:%02d", hour, ctx.LoginTime.Minute()))
 	}
 
 	// Check for weekend access (if unusual for user)
 	if s.isWeekendAccessUnusual(ctx.UserID, ctx.LoginTime) {
-		risk += 0.1
+		risk += ctx.trigger("temporal", "unusual_weekend_access", 0.1, "Weekend sign-in is unusual for the user")
 	}
 
 	// Check for rapid successive logins
 	if s.hasRecentLogins(ctx.UserID, ctx.LoginTime) {
-		risk += 0.3
+		risk += ctx.trigger("temporal", "rapid_successive_logins", 0.3, "Rapid successive sign-ins")
 	}
 
 	return math.Min(risk, 1.0)
@@ -338,22 +475,28 @@ func (s *AdaptiveAuthService) assessNetworkRisk(ctx *AuthContext) float64 {
 	// Parse IP address
 	ip := net.ParseIP(ctx.IPAddress)
 	if ip == nil {
-		return 0.5 // Invalid IP is high risk
+		return ctx.trigger("network", "invalid_ip", 0.5, "Invalid IP address") // Invalid IP is high risk
 	}
 
 	// Check for private/local IPs in production
 	if ip.IsPrivate() || ip.IsLoopback() {
-		risk += 0.1
+		risk += ctx.trigger("network", "private_ip", 0.1, "Private or loopback IP address")
 	}
 
-	// Check IP reputation (simplified)
-	if s.isHighRiskIP(ctx.IPAddress) {
-		risk += 0.5
+	// Check IP reputation
+	var highRiskIP bool
+	if ctx.simulated {
+		highRiskIP = ipPreviewHighRisk(ctx.requestContext(), ctx.IPAddress)
+	} else {
+		highRiskIP = s.isHighRiskIP(ctx.requestContext(), ctx.IPAddress)
+	}
+	if highRiskIP {
+		risk += ctx.trigger("network", "high_risk_ip", 0.5, "IP address has a bad reputation")
 	}
 
-	// Check for TOR exit nodes (simplified)
-	if s.isTorExitNode(ctx.IPAddress) {
-		risk += 0.6
+	// Check for Tor exit nodes
+	if s.isTorExitNode(ctx.requestContext(), ctx.IPAddress) {
+		risk += ctx.trigger("network", "tor_exit_node", 0.6, "Tor exit node")
 	}
 
 	return math.Min(risk, 1.0)
@@ -369,11 +512,13 @@ func (s *AdaptiveAuthService) assessApplicationRisk(ctx *AuthContext) float64 {
 
 	// Check application sensitivity level
 	sensitivityLevel := s.getApplicationSensitivityLevel(ctx.ApplicationID)
-	risk += sensitivityLevel * 0.3
+	if sensitivityLevel > 0 {
+		risk += ctx.trigger("application", "sensitive_application", sensitivityLevel*0.3, fmt.Sprintf("Application sensitivity %.1f", sensitivityLevel))
+	}
 
 	// Check for unusual application access
 	if !s.hasUserAccessedApplication(ctx.UserID, ctx.ApplicationID) {
-		risk += 0.2
+		risk += ctx.trigger("application", "first_application_access", 0.2, "First access to the application")
 	}
 
 	return math.Min(risk, 1.0)
@@ -386,18 +531,20 @@ func (s *AdaptiveAuthService) assessHistoricalRisk(ctx *AuthContext) float64 {
 	// Check for recent security events
 	recentEvents := s.getRecentSecurityEvents(ctx.UserID)
 	if len(recentEvents) > 0 {
-		risk += math.Min(float64(len(recentEvents))*0.1, 0.4)
+		risk += ctx.trigger("historical", "recent_security_events", math.Min(float64(len(recentEvents))*0.1, 0.4),
+			fmt.Sprintf("%d recent security events", len(recentEvents)))
 	}
 
 	// Check for failed login attempts
 	failedAttempts := s.getRecentFailedAttempts(ctx.UserID, ctx.IPAddress)
 	if failedAttempts > 0 {
-		risk += math.Min(float64(failedAttempts)*0.1, 0.3)
+		risk += ctx.trigger("historical", "recent_failed_logins", math.Min(float64(failedAttempts)*0.1, 0.3),
+			fmt.Sprintf("%d recent failed sign-ins", failedAttempts))
 	}
 
 	// Check for account compromise indicators
-	if s.hasCompromiseIndicators(ctx.UserID) {
-		risk += 0.5
+	if s.hasCompromiseIndicators(ctx) {
+		risk += ctx.trigger("historical", "compromise_indicators", 0.5, "Account shows signs of compromise")
 	}
 
 	return math.Min(risk, 1.0)
@@ -410,14 +557,14 @@ func (s *AdaptiveAuthService) assessVelocityRisk(ctx *AuthContext) float64 {
 	// Check login frequency in last hour
 	recentLogins := s.getRecentLoginCount(ctx.UserID, time.Hour)
 	if recentLogins > 10 {
-		risk += 0.4
+		risk += ctx.trigger("velocity", "high_login_velocity", 0.4, fmt.Sprintf("%d sign-ins in the last hour", recentLogins))
 	} else if recentLogins > 5 {
-		risk += 0.2
+		risk += ctx.trigger("velocity", "high_login_velocity", 0.2, fmt.Sprintf("%d sign-ins in the last hour", recentLogins))
 	}
 
 	// Check for impossible travel
 	if s.hasImpossibleTravel(ctx) {
-		risk += 0.8
+		risk += ctx.trigger("velocity", "impossible_travel", 0.8, "Impossible travel since the last sign-in")
 	}
 
 	return math.Min(risk, 1.0)
@@ -450,21 +597,21 @@ func (s *AdaptiveAuthService) calculateOverallRisk(factors *RiskFactors) float64
 }
 
 // determineRiskLevel categorizes risk score
-func (s *AdaptiveAuthService) determineRiskLevel(riskScore float64) string {
+func (s *AdaptiveAuthService) determineRiskLevel(riskScore float64) models.RiskLevel {
 	switch {
 	case riskScore < 0.2:
-		return "low"
+		return models.RiskLow
 	case riskScore < 0.4:
-		return "medium"
+		return models.RiskMedium
 	case riskScore < 0.7:
-		return "high"
+		return models.RiskHigh
 	default:
-		return "critical"
+		return models.RiskCritical
 	}
 }
 
 // makeAuthDecision creates authentication decision based on risk
-func (s *AdaptiveAuthService) makeAuthDecision(ctx *AuthContext, riskScore float64, riskLevel string, factors *RiskFactors) *AuthDecision {
+func (s *AdaptiveAuthService) makeAuthDecision(ctx *AuthContext, riskScore float64, riskLevel models.RiskLevel, factors *RiskFactors) *AuthDecision {
 	decision := &AuthDecision{
 		RiskScore:       riskScore,
 		RiskLevel:       riskLevel,
@@ -526,9 +673,6 @@ func (s *AdaptiveAuthService) makeAuthDecision(ctx *AuthContext, riskScore float
 		decision.Decision = AuthDecisionDeny
 		decision.SessionDuration = 0
 		decision.Reasoning = append(decision.Reasoning, "Critical risk detected - access denied")
-
-		// Log security event
-		go s.logSecurityEvent(ctx, "critical_risk_access_denied", riskScore)
 	}
 
 	// Add specific reasoning based on risk factors
@@ -615,14 +759,12 @@ func (s *AdaptiveAuthService) hasRecentLogins(userID uuid.UUID, loginTime time.T
 	return false
 }
 
-func (s *AdaptiveAuthService) isHighRiskIP(ipAddress string) bool {
-	// Implementation would check IP against threat intelligence feeds
-	return false
+func (s *AdaptiveAuthService) isHighRiskIP(ctx context.Context, ipAddress string) bool {
+	return ipIsHighRisk(ctx, ipAddress)
 }
 
-func (s *AdaptiveAuthService) isTorExitNode(ipAddress string) bool {
-	// Implementation would check against TOR exit node lists
-	return false
+func (s *AdaptiveAuthService) isTorExitNode(ctx context.Context, ipAddress string) bool {
+	return ipIsTorExitNode(ctx, ipAddress)
 }
 
 func (s *AdaptiveAuthService) getApplicationSensitivityLevel(appID string) float64 {
@@ -645,9 +787,11 @@ func (s *AdaptiveAuthService) getRecentFailedAttempts(userID uuid.UUID, ipAddres
 	return 0
 }
 
-func (s *AdaptiveAuthService) hasCompromiseIndicators(userID uuid.UUID) bool {
-	// Implementation would check for account compromise indicators
-	return false
+func (s *AdaptiveAuthService) hasCompromiseIndicators(ctx *AuthContext) bool {
+	// An upstream identity provider currently rates the user high risk
+	db, cancel := withDB(ctx.requestContext(), s.db)
+	defer cancel()
+	return latestIdPRiskLevel(db, ctx.UserID, time.Now()) == IdPRiskHigh
 }
 
 func (s *AdaptiveAuthService) getRecentLoginCount(userID uuid.UUID, duration time.Duration) int {
@@ -674,32 +818,31 @@ func (s *AdaptiveAuthService) addSpecificReasoning(decision *AuthDecision, facto
 
 func (s *AdaptiveAuthService) storeAuthAssessment(ctx *AuthContext, decision *AuthDecision, factors *RiskFactors) error {
 	// Store assessment for machine learning and analysis
-	assessment := map[string]interface{}{
-		"user_id":    ctx.UserID.String(),
-		"risk_score": decision.RiskScore,
-		"risk_level": decision.RiskLevel,
-		"decision":   decision.Decision,
-		"factors":    factors,
-		"context":    ctx,
-		"timestamp":  time.Now(),
-	}
-
-	// Convert to JSON for storage
-	assessmentJSON, err := json.Marshal(assessment)
-	if err != nil {
-		return err
-	}
-
-	// Store in risk assessment table
-	return StoreRiskAssessment(map[string]interface{}{
-		"user_id":       ctx.UserID.String(),
-		"risk_score":    decision.RiskScore,
-		"risk_level":    decision.RiskLevel,
-		"factors":       string(assessmentJSON),
-		"ip_address":    ctx.IPAddress,
-		"user_agent":    ctx.UserAgent,
-		"location_data": ctx.Location,
-	})
+	assessment := &RiskAssessment{
+		UserID:            ctx.UserID,
+		IPAddress:         ctx.IPAddress,
+		UserAgent:         ctx.UserAgent,
+		DeviceFingerprint: ctx.DeviceFingerprint,
+		RiskScore:         decision.RiskScore,
+		RiskLevel:         decision.RiskLevel,
+		Factors:           factors.list(),
+		Recommendations:   decision.Reasoning,
+	}
+	if ctx.Location != nil {
+		assessment.Location = &LocationInfo{
+			Country:        ctx.Location.Country,
+			Region:         ctx.Location.Region,
+			City:           ctx.Location.City,
+			Latitude:       ctx.Location.Latitude,
+			Longitude:      ctx.Location.Longitude,
+			Timezone:       ctx.Location.Timezone,
+			ISP:            ctx.Location.ISP,
+			IsVPN:          ctx.Location.VPNDetected,
+			ASN:            ctx.Location.ASN,
+			ASOrganization: ctx.Location.ASOrganization,
+		}
+	}
+	return StoreRiskAssessment(ctx.requestContext(), assessment)
 }
 
 func (s *AdaptiveAuthService) updateUserBehaviorPatterns(ctx *AuthContext, decision *AuthDecision) {
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Admin console link kinds, the keys of OAuthProviderConfig.AdminLinks
+const (
+	AdminLinkUser       = "user"
+	AdminLinkRepository = "repository"
+	AdminLinkAuditLog   = "audit_log"
+)
+
+var adminLinkPlaceholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// AdminConsoleLink opens a subject in a connected provider's admin console
+type AdminConsoleLink struct {
+	Provider string `json:"provider"`
+	Kind     string `json:"kind"`
+	Label    string `json:"label"`
+	URL      string `json:"url"`
+}
+
+// AdminLinkSubject is what an alert or investigation is about
+type AdminLinkSubject struct {
+	UserID     *uuid.UUID
+	Email      string
+	Username   string
+	Repository string // owner/name
+	Org        string // defaults to the repository owner
+}
+
+func (s AdminLinkSubject) empty() bool {
+	return s.UserID == nil && s.Email == "" && s.Username == "" && s.Repository == ""
+}
+
+// AdminLinkService builds deep links into the admin consoles of the providers the
+// organization has connected, so analysts land on the user or repository directly
+type AdminLinkService struct {
+	db        *gorm.DB
+	providers *OAuthProviderRegistry
+}
+
+// NewAdminLinkService creates a new admin link service
+func NewAdminLinkService(db *gorm.DB, providers *OAuthProviderRegistry) *AdminLinkService {
+	return &AdminLinkService{db: db, providers: providers}
+}
+
+// ForUser returns admin console links for a CloudGate user
+func (s *AdminLinkService) ForUser(userID uuid.UUID) ([]AdminConsoleLink, error) {
+	var user models.User
+	if err := s.db.Select("id", "email", "username").First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return s.Links(AdminLinkSubject{UserID: &userID, Email: user.Email, Username: user.Username})
+}
+
+// ForAlert returns admin console links for the user and repository an alert is about.
+// The metadata keys email, repository and org add to the alert's user.
+func (s *AdminLinkService) ForAlert(alert SecurityAlert) ([]AdminConsoleLink, error) {
+	subject := AdminLinkSubject{UserID: alert.UserID}
+	subject.Email, _ = alert.Metadata["email"].(string)
+	subject.Repository, _ = alert.Metadata["repository"].(string)
+	subject.Org, _ = alert.Metadata["org"].(string)
+	if alert.UserID != nil && subject.Email == "" {
+		var user models.User
+		if err := s.db.Select("id", "email", "username").First(&user, "id = ?", *alert.UserID).Error; err == nil {
+			subject.Email, subject.Username = user.Email, user.Username
+		}
+	}
+	return s.Links(subject)
+}
+
+// Links renders the admin console links of every connected provider that has them. A
+// provider's details, such as a Salesforce instance_url, come from the subject's own
+// connection when they have one and from the organization's latest connection otherwise,
+// and links with a placeholder nothing fills are left out.
+func (s *AdminLinkService) Links(subject AdminLinkSubject) ([]AdminConsoleLink, error) {
+	if subject.empty() {
+		return nil, nil
+	}
+	if subject.Org == "" {
+		subject.Org, _, _ = strings.Cut(subject.Repository, "/")
+	}
+
+	var configs []OAuthProviderConfig
+	var appIDs []string
+	for _, provider := range s.providers.Providers() {
+		if config := provider.Config(); len(config.AdminLinks) > 0 {
+			configs = append(configs, config)
+			appIDs = append(appIDs, config.AppID)
+		}
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	var connections []models.AppConnection
+	if err := s.db.Select("user_id", "app_id", "user_email", "extras", "updated_at").
+		Where("app_id IN ? AND status = ?", appIDs, models.ConnectionConnected).
+		Order("updated_at DESC").
+		Find(&connections).Error; err != nil {
+		return nil, fmt.Errorf("failed to get connected providers: %w", err)
+	}
+	latest := make(map[string]models.AppConnection)
+	own := make(map[string]models.AppConnection)
+	for _, connection := range connections {
+		if _, ok := latest[connection.AppID]; !ok {
+			latest[connection.AppID] = connection
+		}
+		if subject.UserID != nil && connection.UserID == *subject.UserID {
+			if _, ok := own[connection.AppID]; !ok {
+				own[connection.AppID] = connection
+			}
+		}
+	}
+
+	var links []AdminConsoleLink
+	for _, config := range configs {
+		values, ok := adminLinkValues(config, subject, latest[config.AppID], own[config.AppID])
+		if !ok {
+			continue
+		}
+		for _, kind := range []string{AdminLinkUser, AdminLinkRepository, AdminLinkAuditLog} {
+			template, ok := config.AdminLinks[kind]
+			if !ok {
+				continue
+			}
+			if kind == AdminLinkUser && subject.UserID == nil && subject.Email == "" && subject.Username == "" {
+				continue
+			}
+			if link, ok := renderAdminLink(template, values); ok {
+				links = append(links, AdminConsoleLink{
+					Provider: config.Name, Kind: kind, Label: adminLinkLabel(kind, config.Label()), URL: link,
+				})
+			}
+		}
+	}
+	return links, nil
+}
+
+// adminLinkValues fills placeholders for one provider, reporting false when the
+// organization has not connected it
+func adminLinkValues(config OAuthProviderConfig, subject AdminLinkSubject, latest, own models.AppConnection) (map[string]string, bool) {
+	if latest.AppID == "" {
+		return nil, false
+	}
+	values := map[string]string{
+		"email":      subject.Email,
+		"username":   subject.Username,
+		"repository": subject.Repository,
+		"org":        subject.Org,
+	}
+
+	// Token extras describe the organization's account, so anyone's connection will do
+	extras := connectionExtras(latest)
+	for key := range config.TokenExtras {
+		if extras[key] != "" {
+			values[key] = extras[key]
+		}
+	}
+	// The subject's own connection also knows who they are at the provider
+	if own.AppID != "" {
+		for key, value := range connectionExtras(own) {
+			if value != "" {
+				values[key] = value
+			}
+		}
+		if own.UserEmail != "" {
+			values["email"] = own.UserEmail
+		}
+	}
+	return values, true
+}
+
+func connectionExtras(connection models.AppConnection) map[string]string {
+	extras := make(map[string]string)
+	if connection.Extras == "" {
+		return extras
+	}
+	if err := json.Unmarshal([]byte(connection.Extras), &extras); err != nil {
+		log.Printf("Ignoring unreadable extras on %s connection: %v", connection.AppID, err)
+	}
+	return extras
+}
+
+// renderAdminLink fills a template, escaping values except a leading base URL, and only
+// returns https links
+func renderAdminLink(template string, values map[string]string) (string, bool) {
+	query := strings.Index(template, "?")
+	var rendered strings.Builder
+	last := 0
+	for _, match := range adminLinkPlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		value := values[template[match[2]:match[3]]]
+		if value == "" {
+			return "", false
+		}
+		rendered.WriteString(template[last:match[0]])
+		switch {
+		case match[0] == 0:
+			rendered.WriteString(strings.TrimSuffix(value, "/"))
+		case query >= 0 && match[0] > query:
+			rendered.WriteString(url.QueryEscape(value))
+		default:
+			rendered.WriteString(strings.ReplaceAll(url.PathEscape(value), "%2F", "/"))
+		}
+		last = match[1]
+	}
+	rendered.WriteString(template[last:])
+
+	parsed, err := url.Parse(rendered.String())
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "", false
+	}
+	return rendered.String(), true
+}
+
+func adminLinkLabel(kind, provider string) string {
+	switch kind {
+	case AdminLinkUser:
+		return fmt.Sprintf("Open user in %s admin", provider)
+	case AdminLinkRepository:
+		return fmt.Sprintf("Open repository settings in %s", provider)
+	default:
+		return fmt.Sprintf("Open %s audit log", provider)
+	}
+}
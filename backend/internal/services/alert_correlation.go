@@ -0,0 +1,253 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CorrelationKey is an alert attribute used to group related alerts
+type CorrelationKey string
+
+const (
+	CorrelationKeyUser      CorrelationKey = "user_id"
+	CorrelationKeyIP        CorrelationKey = "ip_address"
+	CorrelationKeyAlertType CorrelationKey = "alert_type"
+)
+
+// CorrelationRule groups alerts that share the same key values within a sliding window
+type CorrelationRule struct {
+	Name             string           `json:"name"`
+	Keys             []CorrelationKey `json:"keys"`
+	Window           time.Duration    `json:"window"`
+	MinAlerts        int              `json:"min_alerts"`         // alerts needed before an incident is opened
+	MinDistinctUsers int              `json:"min_distinct_users"` // 0 disables the check
+}
+
+// DefaultCorrelationRules returns the built-in rules, with windows taken from the environment
+func DefaultCorrelationRules() []CorrelationRule {
+	return []CorrelationRule{
+		{
+			Name:      "same_user_same_ip",
+			Keys:      []CorrelationKey{CorrelationKeyUser, CorrelationKeyIP},
+			Window:    envDuration("CORRELATION_USER_IP_WINDOW", 15*time.Minute),
+			MinAlerts: 2,
+		},
+		{
+			Name:             "attack_pattern_across_users",
+			Keys:             []CorrelationKey{CorrelationKeyAlertType},
+			Window:           envDuration("CORRELATION_PATTERN_WINDOW", 10*time.Minute),
+			MinAlerts:        3,
+			MinDistinctUsers: envInt("CORRELATION_PATTERN_MIN_USERS", 3),
+		},
+	}
+}
+
+// AlertCorrelator folds related alerts into incidents so analysts triage one item instead of many
+type AlertCorrelator struct {
+	rules     []CorrelationRule
+	incidents *IncidentManager
+	groups    map[string]*correlationGroup
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// correlationGroup tracks the recent alerts for one rule and one set of key values
+type correlationGroup struct {
+	rule       CorrelationRule
+	alerts     []SecurityAlert
+	incidentID *uuid.UUID
+	lastSeen   time.Time
+}
+
+// NewAlertCorrelator creates a correlator that opens incidents through the given manager
+func NewAlertCorrelator(incidents *IncidentManager, rules []CorrelationRule) *AlertCorrelator {
+	return &AlertCorrelator{
+		rules:     rules,
+		incidents: incidents,
+		groups:    make(map[string]*correlationGroup),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetRules replaces the correlation rules and drops any in-flight groups
+func (ac *AlertCorrelator) SetRules(rules []CorrelationRule) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	ac.rules = rules
+	ac.groups = make(map[string]*correlationGroup)
+}
+
+// Rules returns the active correlation rules
+func (ac *AlertCorrelator) Rules() []CorrelationRule {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	return append([]CorrelationRule(nil), ac.rules...)
+}
+
+// Correlate adds an alert to every matching group. A group that crosses its rule's thresholds
+// opens an incident; later alerts in the same window are attached to it. Returns newly opened incidents.
+func (ac *AlertCorrelator) Correlate(alert SecurityAlert) []*SecurityIncident {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	ac.sweep(alert.Timestamp)
+
+	var opened []*SecurityIncident
+	for _, rule := range ac.rules {
+		key, ok := correlationGroupKey(rule, alert)
+		if !ok {
+			continue
+		}
+
+		group, exists := ac.groups[key]
+		if !exists {
+			group = &correlationGroup{rule: rule}
+			ac.groups[key] = group
+		}
+
+		// A quiet gap longer than the window starts a new burst and a new incident
+		if group.incidentID != nil && alert.Timestamp.Sub(group.lastSeen) > rule.Window {
+			group.incidentID = nil
+		}
+		group.prune(alert.Timestamp)
+		group.alerts = append(group.alerts, alert)
+		group.lastSeen = alert.Timestamp
+
+		if group.incidentID != nil {
+			if ac.incidents.attachAlert(*group.incidentID, alert, rule.Name) {
+				continue
+			}
+			// The incident was resolved or closed; treat this as a fresh group
+			group.incidentID = nil
+			group.alerts = []SecurityAlert{alert}
+		}
+
+		if !group.meetsThresholds() {
+			continue
+		}
+
+		incident := ac.incidents.createCorrelatedIncident(
+			correlationTitle(rule, alert),
+			fmt.Sprintf("Opened by correlation rule %s from %d related alerts within %s", rule.Name, len(group.alerts), rule.Window),
+			rule.Name,
+			group.alerts,
+		)
+		group.incidentID = &incident.ID
+		opened = append(opened, incident)
+		log.Printf("🔗 Correlated %d alerts into incident %s (%s)", len(group.alerts), incident.ID, rule.Name)
+	}
+
+	return opened
+}
+
+// sweep drops groups that have been idle longer than their window, at most once a minute
+func (ac *AlertCorrelator) sweep(now time.Time) {
+	if now.Sub(ac.lastSweep) < time.Minute {
+		return
+	}
+	for key, group := range ac.groups {
+		if now.Sub(group.lastSeen) > group.rule.Window {
+			delete(ac.groups, key)
+		}
+	}
+	ac.lastSweep = now
+}
+
+// prune removes alerts that have fallen out of the rule's window
+func (g *correlationGroup) prune(now time.Time) {
+	cutoff := now.Add(-g.rule.Window)
+	kept := g.alerts[:0]
+	for _, a := range g.alerts {
+		if a.Timestamp.After(cutoff) {
+			kept = append(kept, a)
+		}
+	}
+	g.alerts = kept
+}
+
+func (g *correlationGroup) meetsThresholds() bool {
+	if len(g.alerts) < g.rule.MinAlerts {
+		return false
+	}
+	if g.rule.MinDistinctUsers > 0 {
+		users := make(map[uuid.UUID]bool)
+		for _, a := range g.alerts {
+			if a.UserID != nil {
+				users[*a.UserID] = true
+			}
+		}
+		if len(users) < g.rule.MinDistinctUsers {
+			return false
+		}
+	}
+	return true
+}
+
+// correlationGroupKey builds the group key for an alert, or false if the alert lacks a key value
+func correlationGroupKey(rule CorrelationRule, alert SecurityAlert) (string, bool) {
+	parts := []string{rule.Name}
+	for _, key := range rule.Keys {
+		value := correlationValue(key, alert)
+		if value == "" {
+			return "", false
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, "|"), true
+}
+
+func correlationValue(key CorrelationKey, alert SecurityAlert) string {
+	switch key {
+	case CorrelationKeyUser:
+		if alert.UserID != nil {
+			return alert.UserID.String()
+		}
+	case CorrelationKeyIP:
+		return alert.IPAddress
+	case CorrelationKeyAlertType:
+		return string(alert.Type)
+	}
+	return ""
+}
+
+func correlationTitle(rule CorrelationRule, alert SecurityAlert) string {
+	switch rule.Name {
+	case "same_user_same_ip":
+		return fmt.Sprintf("Repeated alerts for one user from %s", alert.IPAddress)
+	case "attack_pattern_across_users":
+		return fmt.Sprintf("%s pattern across multiple users", alert.Type)
+	}
+	return fmt.Sprintf("Correlated alerts (%s)", rule.Name)
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Invalid %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("⚠️ Invalid %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Actions an alert email's one-click links can take
+const (
+	AlertEmailAcknowledge = "acknowledge"
+	AlertEmailEscalate    = "escalate"
+)
+
+var (
+	// ErrInvalidAlertLink is returned for an alert email link that is expired or tampered with
+	ErrInvalidAlertLink = errors.New("invalid or expired alert link")
+	// ErrAlertLinkUsed is returned when an alert email link has already been clicked
+	ErrAlertLinkUsed = errors.New("alert link already used")
+)
+
+// AlertEmailLink is a signed acknowledge or escalate link from an alert email, as sent
+// to one recipient
+type AlertEmailLink struct {
+	AlertID   uuid.UUID
+	Action    string
+	Recipient string
+	Expires   string
+	Signature string
+}
+
+// AlertEmailLinks signs one-click links in alert emails, so on-call admins can acknowledge
+// or escalate an alert without signing in to the dashboard. Links are signed for the
+// alert, action and recipient, expire after ALERT_LINK_TTL and work once.
+type AlertEmailLinks struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+	key      []byte
+	baseURL  string
+	ttl      time.Duration
+}
+
+// NewAlertEmailLinks creates a signer whose links point at BACKEND_URL
+func NewAlertEmailLinks(db *gorm.DB, security *SecurityMonitoringService) *AlertEmailLinks {
+	return &AlertEmailLinks{
+		db:       db,
+		security: security,
+		key:      credentialKey("alert-link", "ALERT_LINK_SIGNING_KEY"),
+		baseURL:  strings.TrimRight(getEnv("BACKEND_URL", "http://localhost:8081"), "/"),
+		ttl:      envDuration("ALERT_LINK_TTL", 24*time.Hour),
+	}
+}
+
+// URLs returns the acknowledge and escalate links for an alert email sent to recipient
+func (l *AlertEmailLinks) URLs(alertID uuid.UUID, recipient string, now time.Time) map[string]string {
+	expires := strconv.FormatInt(now.Add(l.ttl).Unix(), 10)
+	links := make(map[string]string, 2)
+	for _, action := range []string{AlertEmailAcknowledge, AlertEmailEscalate} {
+		query := url.Values{}
+		query.Set("action", action)
+		query.Set("recipient", recipient)
+		query.Set("expires", expires)
+		query.Set("signature", l.signature(alertID, action, recipient, expires))
+		links[action] = l.baseURL + "/alerts/" + alertID.String() + "/email-action?" + query.Encode()
+	}
+	return links
+}
+
+// Verify checks a link's signature and expiry without using it up
+func (l *AlertEmailLinks) Verify(link AlertEmailLink, now time.Time) error {
+	if link.Action != AlertEmailAcknowledge && link.Action != AlertEmailEscalate {
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidAlertLink, link.Action)
+	}
+	expiresAt, err := strconv.ParseInt(link.Expires, 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return ErrInvalidAlertLink
+	}
+	expected := l.signature(link.AlertID, link.Action, link.Recipient, link.Expires)
+	if !hmac.Equal([]byte(link.Signature), []byte(expected)) {
+		return ErrInvalidAlertLink
+	}
+	return nil
+}
+
+// Apply acknowledges or escalates the alert for a verified link and records the click.
+// Acknowledging assigns the alert to the analyst whose email the link was sent to, if any.
+func (l *AlertEmailLinks) Apply(ctx context.Context, link AlertEmailLink, ipAddress, userAgent string, now time.Time) (*SecurityAlert, error) {
+	if err := l.Verify(link, now); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(link.Signature))
+	click := models.AlertLinkClick{
+		AlertID:       link.AlertID,
+		Action:        link.Action,
+		Recipient:     link.Recipient,
+		IPAddress:     ipAddress,
+		UserAgent:     userAgent,
+		SignatureHash: hex.EncodeToString(sum[:]),
+		CreatedAt:     now,
+	}
+	var analyst models.User
+	if err := l.db.Where("LOWER(email) = ? AND is_active = ?", strings.ToLower(link.Recipient), true).First(&analyst).Error; err == nil {
+		click.UserID = &analyst.ID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to look up recipient: %w", err)
+	}
+
+	// Recording the click first claims the link, so two clicks cannot both act on it
+	var used int64
+	if err := l.db.Model(&models.AlertLinkClick{}).Where("signature_hash = ?", click.SignatureHash).Count(&used).Error; err != nil {
+		return nil, fmt.Errorf("failed to check alert link: %w", err)
+	}
+	if used > 0 {
+		return nil, ErrAlertLinkUsed
+	}
+	if err := l.db.Create(&click).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAlertLinkUsed, err)
+	}
+
+	alert, err := l.apply(link, click.UserID)
+	if err != nil {
+		// A link that did nothing can be tried again
+		l.db.Delete(&click)
+		return nil, err
+	}
+
+	actor := ""
+	if click.UserID != nil {
+		actor = click.UserID.String()
+	}
+	verb := "acknowledged"
+	if link.Action == AlertEmailEscalate {
+		verb = "escalated"
+	}
+	LogAuditEvent(ctx, actor, "alert_"+verb, "security_alert", link.AlertID.String(), ipAddress, userAgent,
+		fmt.Sprintf("Alert %s from email link sent to %s", verb, link.Recipient), "success")
+	return alert, nil
+}
+
+func (l *AlertEmailLinks) apply(link AlertEmailLink, analystID *uuid.UUID) (*SecurityAlert, error) {
+	if link.Action == AlertEmailEscalate {
+		return l.security.EscalateAlert(link.AlertID)
+	}
+
+	alert, err := l.security.GetAlert(link.AlertID)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == StatusResolved || alert.Status == StatusFalsePositive {
+		return nil, ErrAlertClosed
+	}
+	if err := l.security.UpdateAlertStatus(link.AlertID, StatusInProgress, analystID); err != nil {
+		return nil, err
+	}
+	alert.Status = StatusInProgress
+	if analystID != nil {
+		alert.AssignedTo = analystID
+	}
+	return alert, nil
+}
+
+func (l *AlertEmailLinks) signature(alertID uuid.UUID, action, recipient, expires string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(alertID.String() + "\n" + action + "\n" + strings.ToLower(recipient) + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Weights of each factor in an alert's 0-100 priority score
+const (
+	priorityWeightSeverity    = 40.0
+	priorityWeightThreatIntel = 25.0
+	priorityWeightAsset       = 20.0
+	priorityWeightUserRisk    = 15.0
+)
+
+// AlertPriority is an alert's triage score and the factors it was built from. Each
+// factor is 0-1; Score is their weighted sum on a 0-100 scale.
+type AlertPriority struct {
+	Score            float64 `json:"score"`
+	Severity         float64 `json:"severity"`
+	ThreatIntel      float64 `json:"threat_intel"`
+	AssetSensitivity float64 `json:"asset_sensitivity"`
+	UserRisk         float64 `json:"user_risk"`
+}
+
+// endpointSensitivities mirrors the RequireRouteRisk levels of the route groups in
+// SetupRoutes, longest prefix first, so API alerts are weighted by what they hit
+var endpointSensitivities = []struct {
+	prefix      string
+	sensitivity RouteSensitivity
+}{
+	{"/api/v1/adaptive-auth", RouteSensitivityHigh},
+	{"/api/v1/watchlist", RouteSensitivityCritical},
+	{"/api/v1/security", RouteSensitivityHigh},
+	{"/api/v1/licenses", RouteSensitivityMedium},
+	{"/api/v1/cases", RouteSensitivityHigh},
+	{"/user/settings", RouteSensitivityMedium},
+	{"/user/mfa", RouteSensitivityHigh},
+	{"/admin", RouteSensitivityCritical},
+}
+
+// prioritizeAlert scores an alert from its severity, threat intelligence confidence,
+// the sensitivity of the asset involved and the risk profile of the user
+func (s *SecurityMonitoringService) prioritizeAlert(alert SecurityAlert) AlertPriority {
+	priority := AlertPriority{
+		Severity:         severityWeight(alert.Severity),
+		ThreatIntel:      threatIntelConfidence(alert.Metadata),
+		AssetSensitivity: assetSensitivity(alert.Metadata),
+		UserRisk:         s.userRiskProfile(alert.UserID, alert.Metadata),
+	}
+	score := priority.Severity*priorityWeightSeverity +
+		priority.ThreatIntel*priorityWeightThreatIntel +
+		priority.AssetSensitivity*priorityWeightAsset +
+		priority.UserRisk*priorityWeightUserRisk
+	priority.Score = math.Round(score*10) / 10
+	return priority
+}
+
+func severityWeight(severity AlertSeverity) float64 {
+	switch severity {
+	case SeverityCritical:
+		return 1.0
+	case SeverityHigh:
+		return 0.75
+	case SeverityMedium:
+		return 0.45
+	default:
+		return 0.2
+	}
+}
+
+func sensitivityWeight(sensitivity RouteSensitivity) float64 {
+	switch sensitivity {
+	case RouteSensitivityCritical:
+		return 1.0
+	case RouteSensitivityHigh:
+		return 0.7
+	case RouteSensitivityMedium:
+		return 0.4
+	default:
+		return 0.1
+	}
+}
+
+// threatIntelConfidence reads the enrichment added by GenerateAlert, which is the
+// provider's struct in process and a plain map once an alert has been stored. The
+// local IP reputation counts when it is worse than the provider's confidence.
+func threatIntelConfidence(metadata map[string]interface{}) float64 {
+	confidence := 0.0
+	switch data := metadata["threat_intelligence"].(type) {
+	case *ThreatIntelData:
+		confidence = data.Confidence
+	case map[string]interface{}:
+		confidence, _ = data["confidence"].(float64)
+	}
+	switch data := metadata["ip_reputation"].(type) {
+	case *IPReputationScore:
+		confidence = math.Max(confidence, data.Score)
+	case map[string]interface{}:
+		if score, ok := data["score"].(float64); ok {
+			confidence = math.Max(confidence, score)
+		}
+	}
+	return clamp01(confidence)
+}
+
+// assetSensitivity uses an explicit asset_sensitivity from the alert source, falling
+// back to the route sensitivity of the endpoint the alert concerns
+func assetSensitivity(metadata map[string]interface{}) float64 {
+	if sensitivity, ok := metadata["asset_sensitivity"].(string); ok && sensitivity != "" {
+		return sensitivityWeight(RouteSensitivity(sensitivity))
+	}
+	endpoint, _ := metadata["endpoint"].(string)
+	for _, entry := range endpointSensitivities {
+		if strings.HasPrefix(endpoint, entry.prefix) {
+			return sensitivityWeight(entry.sensitivity)
+		}
+	}
+	return sensitivityWeight(RouteSensitivityLow)
+}
+
+// userRiskProfile is the highest of the risk score carried by the alert, the user's
+// latest login risk assessment from the past week, and a floor for watchlisted users
+func (s *SecurityMonitoringService) userRiskProfile(userID *uuid.UUID, metadata map[string]interface{}) float64 {
+	risk := 0.0
+	if score, ok := metadata["risk_score"].(float64); ok {
+		risk = score
+	}
+	if userID == nil {
+		return clamp01(risk)
+	}
+
+	if latest, found, err := latestRiskAssessment(s.db, *userID, time.Now().Add(-7*24*time.Hour)); err == nil && found {
+		risk = math.Max(risk, latest.RiskScore)
+	}
+	if _, watched := s.watchlist.GetActiveEntry(*userID); watched {
+		risk = math.Max(risk, 0.8)
+	}
+	return clamp01(risk)
+}
+
+func clamp01(value float64) float64 {
+	return math.Min(math.Max(value, 0), 1)
+}
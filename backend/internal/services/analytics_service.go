@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AnalyticsService aggregates app launch and SSO activity for usage reporting
+type AnalyticsService struct {
+	db *gorm.DB
+}
+
+// NewAnalyticsService creates a new analytics service
+func NewAnalyticsService(db *gorm.DB) *AnalyticsService {
+	return &AnalyticsService{db: db}
+}
+
+// AppUsageSummary is the launch activity of one app over a period
+type AppUsageSummary struct {
+	AppID          string     `json:"app_id"`
+	AppName        string     `json:"app_name"`
+	Launches       int64      `json:"launches"`
+	UniqueUsers    int64      `json:"unique_users"`
+	LastLaunchedAt *time.Time `json:"last_launched_at,omitempty"`
+}
+
+// DailyUsage is the activity for a single calendar day (UTC)
+type DailyUsage struct {
+	Date        string `json:"date"`
+	AppID       string `json:"app_id,omitempty"`
+	Count       int64  `json:"count"`
+	ActiveUsers int    `json:"active_users"`
+}
+
+// RecordAppLaunch stores an app launch event
+func (s *AnalyticsService) RecordAppLaunch(userID uuid.UUID, appID, ipAddress, userAgent string) error {
+	event := models.AppLaunchEvent{
+		UserID:     userID,
+		AppID:      appID,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		LaunchedAt: time.Now().UTC(),
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		return fmt.Errorf("failed to record app launch: %w", err)
+	}
+	return nil
+}
+
+// GetAppUsage returns per-app launch totals for the period, most used first.
+// Catalog apps with no launches are included so unused licenses show up.
+func (s *AnalyticsService) GetAppUsage(start, end time.Time) ([]AppUsageSummary, error) {
+	var rows []struct {
+		AppID       string
+		Launches    int64
+		UniqueUsers int64
+	}
+	err := s.db.Model(&models.AppLaunchEvent{}).
+		Select("app_id, COUNT(*) AS launches, COUNT(DISTINCT user_id) AS unique_users").
+		Where("launched_at >= ? AND launched_at < ?", start, end).
+		Group("app_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate app usage: %w", err)
+	}
+
+	usage := make(map[string]*AppUsageSummary)
+	for _, row := range rows {
+		usage[row.AppID] = &AppUsageSummary{AppID: row.AppID, Launches: row.Launches, UniqueUsers: row.UniqueUsers}
+	}
+	for _, app := range GetAllSaaSApps() {
+		if _, ok := usage[app.ID]; !ok {
+			usage[app.ID] = &AppUsageSummary{AppID: app.ID}
+		}
+	}
+
+	summaries := make([]AppUsageSummary, 0, len(usage))
+	for appID, summary := range usage {
+		if app, ok := GetSaaSApp(appID); ok {
+			summary.AppName = app.Name
+		}
+		if summary.Launches > 0 {
+			var last models.AppLaunchEvent
+			if err := s.db.Where("app_id = ?", appID).Order("launched_at DESC").First(&last).Error; err == nil {
+				summary.LastLaunchedAt = &last.LaunchedAt
+			}
+		}
+		summaries = append(summaries, *summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Launches != summaries[j].Launches {
+			return summaries[i].Launches > summaries[j].Launches
+		}
+		return summaries[i].AppID < summaries[j].AppID
+	})
+
+	return summaries, nil
+}
+
+// GetDailyAppUsage returns launches and daily active users per app per day.
+// An empty appID includes every app.
+func (s *AnalyticsService) GetDailyAppUsage(appID string, start, end time.Time) ([]DailyUsage, error) {
+	var events []models.AppLaunchEvent
+	query := s.db.Select("app_id, user_id, launched_at").Where("launched_at >= ? AND launched_at < ?", start, end)
+	if appID != "" {
+		query = query.Where("app_id = ?", appID)
+	}
+	if err := query.Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to get launch events: %w", err)
+	}
+
+	type dayKey struct{ date, appID string }
+	counts := make(map[dayKey]int64)
+	users := make(map[dayKey]map[uuid.UUID]bool)
+	for _, e := range events {
+		key := dayKey{e.LaunchedAt.UTC().Format("2006-01-02"), e.AppID}
+		counts[key]++
+		if users[key] == nil {
+			users[key] = make(map[uuid.UUID]bool)
+		}
+		users[key][e.UserID] = true
+	}
+
+	daily := make([]DailyUsage, 0, len(counts))
+	for key, count := range counts {
+		daily = append(daily, DailyUsage{Date: key.date, AppID: key.appID, Count: count, ActiveUsers: len(users[key])})
+	}
+	sort.Slice(daily, func(i, j int) bool {
+		if daily[i].Date != daily[j].Date {
+			return daily[i].Date < daily[j].Date
+		}
+		return daily[i].AppID < daily[j].AppID
+	})
+
+	return daily, nil
+}
+
+// GetSSOActivity returns daily sign-in counts and distinct users, based on sessions created
+func (s *AnalyticsService) GetSSOActivity(start, end time.Time) ([]DailyUsage, error) {
+	var sessions []models.Session
+	err := s.db.Select("user_id, created_at").
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	counts := make(map[string]int64)
+	users := make(map[string]map[uuid.UUID]bool)
+	for _, session := range sessions {
+		day := session.CreatedAt.UTC().Format("2006-01-02")
+		counts[day]++
+		if users[day] == nil {
+			users[day] = make(map[uuid.UUID]bool)
+		}
+		users[day][session.UserID] = true
+	}
+
+	// Emit every day in the range so trends have no gaps
+	var daily []DailyUsage
+	for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+		key := day.Format("2006-01-02")
+		daily = append(daily, DailyUsage{Date: key, Count: counts[key], ActiveUsers: len(users[key])})
+	}
+
+	return daily, nil
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/pkg/types"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Why an app session policy turned a session away
+const (
+	AppSessionStepUpRequired     = "step_up_required"          // a stronger factor is needed
+	AppSessionReauthRequired     = "reauthentication_required" // the session is too old, idle or stale
+	AppSessionAALNotAllowed      = "auth_level_not_allowed"    // the session's level is above what the app accepts
+	AppSessionDeviceNotCompliant = "device_not_compliant"      // the device failed or never reported posture checks
+)
+
+// maxAppSessionMinutes caps the durations a policy may set, which never outlive a session anyway
+const maxAppSessionMinutes = 30 * 24 * 60
+
+var (
+	// ErrSessionPolicyNotFound is returned when an app has no session policy
+	ErrSessionPolicyNotFound = errors.New("app session policy not found")
+	// ErrInvalidSessionPolicy is returned for negative durations or unknown assurance levels
+	ErrInvalidSessionPolicy = errors.New("invalid app session policy")
+)
+
+// AppSessionPolicyInput describes an app's session rules as entered by an admin
+type AppSessionPolicyInput struct {
+	MaxSessionMinutes      int
+	IdleTimeoutMinutes     int
+	ReauthAfterMinutes     int
+	AllowedAALs            []int
+	RequireCompliantDevice bool
+}
+
+// AppSessionCheckResult explains whether the current session may be used for an app
+type AppSessionCheckResult struct {
+	Allowed     bool   `json:"allowed"`
+	Error       string `json:"error,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	RequiredAAL int    `json:"required_aal,omitempty"`
+	// NotOnOrAfter is when the policy ends the app session, which tokens issued for the
+	// app must not outlive; zero means the policy sets no limit
+	NotOnOrAfter time.Time `json:"-"`
+}
+
+// limit shortens the app session to end no later than t
+func (r *AppSessionCheckResult) limit(t time.Time) {
+	if r.NotOnOrAfter.IsZero() || t.Before(r.NotOnOrAfter) {
+		r.NotOnOrAfter = t
+	}
+}
+
+// AppSessionPolicyService stores per-app session policies in the app catalog and checks
+// sessions against them
+type AppSessionPolicyService struct {
+	db *gorm.DB
+}
+
+// NewAppSessionPolicyService creates a new app session policy service
+func NewAppSessionPolicyService(db *gorm.DB) *AppSessionPolicyService {
+	return &AppSessionPolicyService{db: db}
+}
+
+// LoadPolicies attaches the stored session policies to the apps in the catalog
+func (s *AppSessionPolicyService) LoadPolicies() error {
+	policies, err := s.ListPolicies()
+	if err != nil {
+		return err
+	}
+	for i := range policies {
+		if !SetSaaSAppSessionPolicy(policies[i].AppID, catalogSessionPolicy(&policies[i])) {
+			log.Printf("⚠️ Session policy for unknown app %s ignored", policies[i].AppID)
+		}
+	}
+	log.Printf("✅ Loaded %d app session policies", len(policies))
+	return nil
+}
+
+// SetPolicy creates or replaces the session policy for an app
+func (s *AppSessionPolicyService) SetPolicy(appID string, input AppSessionPolicyInput, actor *uuid.UUID) (*models.AppSessionPolicy, error) {
+	for name, minutes := range map[string]int{
+		"max_session_minutes":  input.MaxSessionMinutes,
+		"idle_timeout_minutes": input.IdleTimeoutMinutes,
+		"reauth_after_minutes": input.ReauthAfterMinutes,
+	} {
+		if minutes < 0 || minutes > maxAppSessionMinutes {
+			return nil, fmt.Errorf("%w: %s must be between 0 and %d", ErrInvalidSessionPolicy, name, maxAppSessionMinutes)
+		}
+	}
+	levels := make([]string, 0, len(input.AllowedAALs))
+	for _, level := range input.AllowedAALs {
+		if level < models.AAL1 || level > models.AAL3 {
+			return nil, fmt.Errorf("%w: unknown assurance level %d", ErrInvalidSessionPolicy, level)
+		}
+		if !slices.Contains(levels, strconv.Itoa(level)) {
+			levels = append(levels, strconv.Itoa(level))
+		}
+	}
+	slices.Sort(levels)
+
+	var policy models.AppSessionPolicy
+	err := s.db.Where("app_id = ?", appID).First(&policy).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get app session policy: %w", err)
+	}
+
+	policy.AppID = appID
+	policy.MaxSessionMinutes = input.MaxSessionMinutes
+	policy.IdleTimeoutMinutes = input.IdleTimeoutMinutes
+	policy.ReauthAfterMinutes = input.ReauthAfterMinutes
+	policy.AllowedAALs = strings.Join(levels, ",")
+	policy.RequireCompliantDevice = input.RequireCompliantDevice
+	policy.UpdatedBy = actor
+
+	if err := s.db.Save(&policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to save app session policy: %w", err)
+	}
+	SetSaaSAppSessionPolicy(appID, catalogSessionPolicy(&policy))
+
+	s.audit(actor, "app_session_policy_updated", appID, fmt.Sprintf("max=%dm idle=%dm reauth=%dm aal=%s compliant_device=%t",
+		policy.MaxSessionMinutes, policy.IdleTimeoutMinutes, policy.ReauthAfterMinutes, policy.AllowedAALs, policy.RequireCompliantDevice))
+	recordConfigChange(ConfigKindPolicies, "session_policy:"+appID, actor, "App session policy updated", input)
+	return &policy, nil
+}
+
+// GetPolicy returns the session policy for an app
+func (s *AppSessionPolicyService) GetPolicy(appID string) (*models.AppSessionPolicy, error) {
+	var policy models.AppSessionPolicy
+	err := s.db.Where("app_id = ?", appID).First(&policy).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrSessionPolicyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app session policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// ListPolicies returns every configured app session policy
+func (s *AppSessionPolicyService) ListPolicies() ([]models.AppSessionPolicy, error) {
+	var policies []models.AppSessionPolicy
+	if err := s.db.Order("app_id ASC").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list app session policies: %w", err)
+	}
+	return policies, nil
+}
+
+// DeletePolicy removes an app's session policy
+func (s *AppSessionPolicyService) DeletePolicy(appID string, actor *uuid.UUID) error {
+	result := s.db.Where("app_id = ?", appID).Delete(&models.AppSessionPolicy{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete app session policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionPolicyNotFound
+	}
+	SetSaaSAppSessionPolicy(appID, nil)
+
+	s.audit(actor, "app_session_policy_deleted", appID, "App session policy removed")
+	recordConfigChange(ConfigKindPolicies, "session_policy:"+appID, actor, "App session policy removed", nil)
+	return nil
+}
+
+// restorePolicy puts an app's session policy back to a recorded version
+func (s *AppSessionPolicyService) restorePolicy(appID string, snapshot []byte, actor *uuid.UUID) error {
+	var input AppSessionPolicyInput
+	if err := json.Unmarshal(snapshot, &input); err != nil {
+		return fmt.Errorf("invalid app session policy snapshot: %w", err)
+	}
+	_, err := s.SetPolicy(appID, input, actor)
+	return err
+}
+
+// CheckSession evaluates an app's session policy for the session a request was made with
+// (nil when the access token names none) at assurance level aal. The session's last
+// activity is its last refresh, step-up or app use; an allowed check counts as use.
+func (s *AppSessionPolicyService) CheckSession(app *types.SaaSApplication, sessionID *uuid.UUID, aal int, now time.Time) (*AppSessionCheckResult, error) {
+	policy := app.SessionPolicy
+	result := &AppSessionCheckResult{Allowed: true}
+	if policy == nil {
+		return result, nil
+	}
+
+	if len(policy.AllowedAALs) > 0 && !slices.Contains(policy.AllowedAALs, aal) {
+		required := 0
+		for _, level := range policy.AllowedAALs {
+			if level > aal && (required == 0 || level < required) {
+				required = level
+			}
+		}
+		if required == 0 {
+			return &AppSessionCheckResult{
+				Error:  AppSessionAALNotAllowed,
+				Reason: fmt.Sprintf("%s does not accept sessions at assurance level %d", app.Name, aal),
+			}, nil
+		}
+		return &AppSessionCheckResult{
+			Error:       AppSessionStepUpRequired,
+			Reason:      fmt.Sprintf("%s requires a stronger authentication method", app.Name),
+			RequiredAAL: required,
+		}, nil
+	}
+	if policy.MaxSessionMinutes == 0 && policy.IdleTimeoutMinutes == 0 && policy.ReauthAfterMinutes == 0 {
+		return result, nil
+	}
+
+	reauthenticate := func(reason string) *AppSessionCheckResult {
+		return &AppSessionCheckResult{Error: AppSessionReauthRequired, Reason: reason, RequiredAAL: max(aal, models.AAL1)}
+	}
+	if sessionID == nil {
+		return reauthenticate(fmt.Sprintf("Sign in again to open %s", app.Name)), nil
+	}
+	var session models.Session
+	err := s.db.Where("id = ? AND is_active = ?", *sessionID, true).First(&session).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && session.IsExpired()) {
+		return reauthenticate(fmt.Sprintf("Your session has ended; sign in again to open %s", app.Name)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if policy.MaxSessionMinutes > 0 {
+		ends := session.CreatedAt.Add(time.Duration(policy.MaxSessionMinutes) * time.Minute)
+		if !now.Before(ends) {
+			return reauthenticate(fmt.Sprintf("%s allows sessions of at most %d minutes; sign in again", app.Name, policy.MaxSessionMinutes)), nil
+		}
+		result.limit(ends)
+	}
+	if policy.IdleTimeoutMinutes > 0 {
+		idle := time.Duration(policy.IdleTimeoutMinutes) * time.Minute
+		if !now.Before(session.UpdatedAt.Add(idle)) {
+			return reauthenticate(fmt.Sprintf("%s signs you out after %d idle minutes", app.Name, policy.IdleTimeoutMinutes)), nil
+		}
+		result.limit(now.Add(idle))
+	}
+	if policy.ReauthAfterMinutes > 0 {
+		authenticatedAt := session.CreatedAt
+		if session.AuthenticatedAt != nil {
+			authenticatedAt = *session.AuthenticatedAt
+		}
+		ends := authenticatedAt.Add(time.Duration(policy.ReauthAfterMinutes) * time.Minute)
+		if !now.Before(ends) {
+			return reauthenticate(fmt.Sprintf("%s asks you to confirm it's you every %d minutes", app.Name, policy.ReauthAfterMinutes)), nil
+		}
+		result.limit(ends)
+	}
+
+	// Proxied apps are checked on every request, so activity is recorded at most once a minute
+	if now.Sub(session.UpdatedAt) > time.Minute {
+		if err := s.db.Model(&session).UpdateColumn("updated_at", now).Error; err != nil {
+			log.Printf("Failed to record session activity: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// CheckDevice evaluates an app's compliant device requirement for the device a request
+// came from, as identified by its X-Device-ID header
+func (s *AppSessionPolicyService) CheckDevice(app *types.SaaSApplication, userID uuid.UUID, deviceID string, now time.Time) (*AppSessionCheckResult, error) {
+	if app.SessionPolicy == nil || !app.SessionPolicy.RequireCompliantDevice {
+		return &AppSessionCheckResult{Allowed: true}, nil
+	}
+	if devicePostureService == nil {
+		return nil, errors.New("device posture is not tracked")
+	}
+	compliance, err := devicePostureService.CheckCompliance(userID, deviceID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !compliance.Compliant {
+		return &AppSessionCheckResult{
+			Error:  AppSessionDeviceNotCompliant,
+			Reason: fmt.Sprintf("%s requires a compliant device: %s", app.Name, strings.Join(compliance.Issues, "; ")),
+		}, nil
+	}
+	return &AppSessionCheckResult{Allowed: true}, nil
+}
+
+// catalogSessionPolicy converts a stored policy to the form kept in the app catalog
+func catalogSessionPolicy(policy *models.AppSessionPolicy) *types.AppSessionPolicy {
+	catalog := &types.AppSessionPolicy{
+		MaxSessionMinutes:      policy.MaxSessionMinutes,
+		IdleTimeoutMinutes:     policy.IdleTimeoutMinutes,
+		ReauthAfterMinutes:     policy.ReauthAfterMinutes,
+		RequireCompliantDevice: policy.RequireCompliantDevice,
+	}
+	for _, level := range strings.Split(policy.AllowedAALs, ",") {
+		if n, err := strconv.Atoi(level); err == nil {
+			catalog.AllowedAALs = append(catalog.AllowedAALs, n)
+		}
+	}
+	return catalog
+}
+
+func (s *AppSessionPolicyService) audit(actor *uuid.UUID, action, appID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "app_session_policy",
+		ResourceID: appID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit app session policy event: %v", err)
+	}
+}
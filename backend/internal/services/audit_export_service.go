@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// AuditExportManifestVersion is bumped whenever the manifest layout changes
+	AuditExportManifestVersion = 1
+	// maxAuditExportRecords keeps a single export small enough to build in one request
+	maxAuditExportRecords = 50000
+)
+
+var (
+	// ErrAuditExportNotFound is returned when an export job does not exist
+	ErrAuditExportNotFound = errors.New("audit export not found")
+	// ErrInvalidAuditExport is returned for a missing or inverted time range
+	ErrInvalidAuditExport = errors.New("invalid audit export request")
+	// ErrAuditExportTooLarge is returned when the filters match too many records
+	ErrAuditExportTooLarge = errors.New("audit export too large")
+)
+
+// AuditExportFilters selects the audit logs that go into an export
+type AuditExportFilters struct {
+	StartTime time.Time  `json:"start_time"`
+	EndTime   time.Time  `json:"end_time"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Action    string     `json:"action,omitempty"`
+	Resource  string     `json:"resource,omitempty"`
+	Status    string     `json:"status,omitempty"`
+}
+
+// AuditExportExporter identifies who produced an export
+type AuditExportExporter struct {
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+	Email  string     `json:"email,omitempty"`
+}
+
+// AuditExportManifest is the signed chain-of-custody record for an export
+type AuditExportManifest struct {
+	Version       int                 `json:"version"`
+	ExportID      uuid.UUID           `json:"export_id"`
+	GeneratedAt   time.Time           `json:"generated_at"`
+	StartTime     time.Time           `json:"start_time"`
+	EndTime       time.Time           `json:"end_time"`
+	Filters       AuditExportFilters  `json:"filters"`
+	Exporter      AuditExportExporter `json:"exporter"`
+	RecordCount   int                 `json:"record_count"`
+	ContentType   string              `json:"content_type"`
+	ContentSHA256 string              `json:"content_sha256"`
+	Algorithm     string              `json:"algorithm"`
+	KeyID         string              `json:"key_id"`
+}
+
+// AuditExportVerification is the result of checking a manifest and, optionally, its export
+type AuditExportVerification struct {
+	SignatureValid bool                 `json:"signature_valid"`
+	ContentChecked bool                 `json:"content_checked"`
+	ContentMatches bool                 `json:"content_matches"`
+	Manifest       *AuditExportManifest `json:"manifest,omitempty"`
+}
+
+// AuditExportService produces audit log exports with signed manifests, and bulk CSV or
+// JSON Lines exports written to the object store on demand or on a schedule
+type AuditExportService struct {
+	db               *gorm.DB
+	privateKey       ed25519.PrivateKey
+	keyID            string
+	jobs             *JobQueue
+	store            ObjectStore
+	urlTTL           time.Duration
+	scheduleInterval time.Duration
+}
+
+// NewAuditExportService creates a new audit export service. Manifests are signed with the
+// Ed25519 seed in AUDIT_EXPORT_SIGNING_KEY (base64); without it a key is derived from
+// JWT_SECRET so signatures survive restarts, which is only suitable for development.
+// File export download URLs last AUDIT_EXPORT_URL_TTL, and schedules are checked every
+// AUDIT_EXPORT_SCHEDULE_INTERVAL.
+func NewAuditExportService(db *gorm.DB) *AuditExportService {
+	var seed []byte
+	if encoded := getEnv("AUDIT_EXPORT_SIGNING_KEY", ""); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(decoded) != ed25519.SeedSize {
+			log.Printf("⚠️ AUDIT_EXPORT_SIGNING_KEY must be a base64 %d-byte Ed25519 seed, deriving a key instead", ed25519.SeedSize)
+		} else {
+			seed = decoded
+		}
+	}
+	if seed == nil {
+		derived := sha256.Sum256([]byte("cloudgate-audit-export:" + getEnv("JWT_SECRET", "dev-secret-change-me")))
+		seed = derived[:]
+	}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	keyHash := sha256.Sum256(publicKey)
+	return &AuditExportService{
+		db:               db,
+		privateKey:       privateKey,
+		keyID:            hex.EncodeToString(keyHash[:8]),
+		jobs:             NewJobQueue(db, nil),
+		urlTTL:           envDuration("AUDIT_EXPORT_URL_TTL", 15*time.Minute),
+		scheduleInterval: envDuration("AUDIT_EXPORT_SCHEDULE_INTERVAL", 5*time.Minute),
+	}
+}
+
+// SetJobQueue runs background exports on a queue shared with other features
+func (s *AuditExportService) SetJobQueue(jobs *JobQueue) {
+	s.jobs = jobs
+}
+
+// PublicKey returns the base64 verification key and its ID for handing to recipients
+func (s *AuditExportService) PublicKey() (string, string) {
+	return base64.StdEncoding.EncodeToString(s.privateKey.Public().(ed25519.PublicKey)), s.keyID
+}
+
+// CreateExport snapshots the matching audit logs, signs a manifest for them and stores both
+func (s *AuditExportService) CreateExport(filters AuditExportFilters, exporter AuditExportExporter) (*models.AuditExport, error) {
+	if filters.StartTime.IsZero() || filters.EndTime.IsZero() || !filters.EndTime.After(filters.StartTime) {
+		return nil, fmt.Errorf("%w: end_time must be after start_time", ErrInvalidAuditExport)
+	}
+	filters.StartTime = filters.StartTime.UTC()
+	filters.EndTime = filters.EndTime.UTC()
+
+	var logs []models.AuditLog
+	if err := s.logQuery(s.db, filters).Limit(maxAuditExportRecords + 1).Find(&logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to read audit logs: %w", err)
+	}
+	if len(logs) > maxAuditExportRecords {
+		return nil, fmt.Errorf("%w: more than %d records, narrow the time range or filters", ErrAuditExportTooLarge, maxAuditExportRecords)
+	}
+
+	content, err := json.Marshal(logs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit export: %w", err)
+	}
+	contentHash := sha256.Sum256(content)
+	filtersJSON, _ := json.Marshal(filters)
+
+	export := models.AuditExport{
+		ID:            uuid.New(),
+		ExportedBy:    exporter.UserID,
+		ExporterEmail: exporter.Email,
+		StartTime:     filters.StartTime,
+		EndTime:       filters.EndTime,
+		Filters:       string(filtersJSON),
+		RecordCount:   len(logs),
+		ContentSHA256: hex.EncodeToString(contentHash[:]),
+		Content:       string(content),
+		KeyID:         s.keyID,
+	}
+
+	manifest := AuditExportManifest{
+		Version:       AuditExportManifestVersion,
+		ExportID:      export.ID,
+		GeneratedAt:   time.Now().UTC(),
+		StartTime:     filters.StartTime,
+		EndTime:       filters.EndTime,
+		Filters:       filters,
+		Exporter:      exporter,
+		RecordCount:   export.RecordCount,
+		ContentType:   "application/json",
+		ContentSHA256: export.ContentSHA256,
+		Algorithm:     "ed25519",
+		KeyID:         s.keyID,
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode export manifest: %w", err)
+	}
+	export.Manifest = string(manifestJSON)
+	export.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, manifestJSON))
+
+	if err := s.db.Create(&export).Error; err != nil {
+		return nil, fmt.Errorf("failed to save audit export: %w", err)
+	}
+
+	auditLog := models.AuditLog{
+		UserID:     exporter.UserID,
+		Action:     "audit_export_created",
+		Resource:   "audit_export",
+		ResourceID: export.ID.String(),
+		Details:    fmt.Sprintf("%d records from %s to %s, sha256 %s", export.RecordCount, filters.StartTime.Format(time.RFC3339), filters.EndTime.Format(time.RFC3339), export.ContentSHA256),
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit audit export: %v", err)
+	}
+
+	return &export, nil
+}
+
+// StartExport queues CreateExport as a background job, for ranges that take too long to
+// export within a request. The job's result names the export to download.
+func (s *AuditExportService) StartExport(filters AuditExportFilters, exporter AuditExportExporter) (*models.ReportJob, error) {
+	if filters.StartTime.IsZero() || filters.EndTime.IsZero() || !filters.EndTime.After(filters.StartTime) {
+		return nil, fmt.Errorf("%w: end_time must be after start_time", ErrInvalidAuditExport)
+	}
+
+	job := &models.ReportJob{
+		Kind:        models.ReportJobAuditExport,
+		StartTime:   filters.StartTime.UTC(),
+		EndTime:     filters.EndTime.UTC(),
+		RequestedBy: exporter.UserID,
+	}
+	err := s.jobs.Enqueue(job, func(ctx context.Context, run *JobRun) (interface{}, error) {
+		if err := run.Progress(5, "Counting audit logs"); err != nil {
+			return nil, err
+		}
+		var count int64
+		if err := s.logQuery(s.db.WithContext(ctx), filters).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count audit logs: %w", err)
+		}
+		run.Logf("%d audit logs match", count)
+		if count > maxAuditExportRecords {
+			return nil, fmt.Errorf("%w: more than %d records, narrow the time range or filters", ErrAuditExportTooLarge, maxAuditExportRecords)
+		}
+
+		if err := run.Progress(20, "Exporting and signing"); err != nil {
+			return nil, err
+		}
+		export, err := s.CreateExport(filters, exporter)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"export_id":      export.ID,
+			"record_count":   export.RecordCount,
+			"content_sha256": export.ContentSHA256,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// StreamLogs calls fn for each audit log matching filters, oldest first, reading from a
+// database cursor so that unsigned bulk exports are not bounded by maxAuditExportRecords
+// or by memory. Returning an error from fn stops the stream and is returned.
+func (s *AuditExportService) StreamLogs(ctx context.Context, filters AuditExportFilters, fn func(*models.AuditLog) error) error {
+	if filters.StartTime.IsZero() || filters.EndTime.IsZero() || !filters.EndTime.After(filters.StartTime) {
+		return fmt.Errorf("%w: end_time must be after start_time", ErrInvalidAuditExport)
+	}
+	filters.StartTime = filters.StartTime.UTC()
+	filters.EndTime = filters.EndTime.UTC()
+
+	rows, err := s.logQuery(s.db.WithContext(ctx), filters).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var auditLog models.AuditLog
+		if err := s.db.ScanRows(rows, &auditLog); err != nil {
+			return fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		if err := fn(&auditLog); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read audit logs: %w", err)
+	}
+	return nil
+}
+
+// ListLogs returns a page of audit log entries and how many match the page's filter in all
+func (s *AuditExportService) ListLogs(ctx context.Context, page ListPage) ([]models.AuditLog, int64, error) {
+	db, cancel := withDB(ctx, s.db)
+	defer cancel()
+	var logs []models.AuditLog
+	total, err := page.find(db.Model(&models.AuditLog{}), "created_at DESC", &logs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit logs: %w", err)
+	}
+	return logs, total, nil
+}
+
+// logQuery builds the ordered audit log query for an export's time range and filters
+func (s *AuditExportService) logQuery(db *gorm.DB, filters AuditExportFilters) *gorm.DB {
+	query := db.Model(&models.AuditLog{}).Where("created_at >= ? AND created_at < ?", filters.StartTime, filters.EndTime)
+	if filters.UserID != nil {
+		query = query.Where("user_id = ?", *filters.UserID)
+	}
+	if filters.Action != "" {
+		query = query.Where("action = ?", filters.Action)
+	}
+	if filters.Resource != "" {
+		query = query.Where("resource = ?", filters.Resource)
+	}
+	if filters.Status != "" {
+		query = query.Where("status = ?", filters.Status)
+	}
+	return query.Order("created_at ASC, id ASC")
+}
+
+// GetExport returns an export job including its content and manifest
+func (s *AuditExportService) GetExport(exportID uuid.UUID) (*models.AuditExport, error) {
+	var export models.AuditExport
+	if err := s.db.First(&export, "id = ?", exportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuditExportNotFound
+		}
+		return nil, fmt.Errorf("failed to get audit export: %w", err)
+	}
+	return &export, nil
+}
+
+// ListExports returns export jobs newest first, without their content
+func (s *AuditExportService) ListExports(limit, offset int) ([]models.AuditExport, int64, error) {
+	query := s.db.Model(&models.AuditExport{})
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit exports: %w", err)
+	}
+
+	var exports []models.AuditExport
+	err := query.Omit("content").Order("created_at DESC").Limit(limit).Offset(offset).Find(&exports).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit exports: %w", err)
+	}
+	return exports, total, nil
+}
+
+// VerifyManifest checks a manifest's signature against this service's key and, when a
+// content hash is given, that it is the hash the manifest vouches for
+func (s *AuditExportService) VerifyManifest(manifestJSON []byte, signature, contentSHA256 string) (*AuditExportVerification, error) {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature is not base64", ErrInvalidAuditExport)
+	}
+
+	var manifest AuditExportManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: manifest is not valid JSON", ErrInvalidAuditExport)
+	}
+
+	result := &AuditExportVerification{
+		SignatureValid: ed25519.Verify(s.privateKey.Public().(ed25519.PublicKey), manifestJSON, sig),
+		Manifest:       &manifest,
+	}
+	if contentSHA256 != "" {
+		result.ContentChecked = true
+		result.ContentMatches = strings.EqualFold(contentSHA256, manifest.ContentSHA256)
+	}
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// rollupDayLayout is the UTC day key of audit daily rollups
+const rollupDayLayout = "2006-01-02"
+
+// statisticsSegment holds additive audit counts for part of a statistics range, so that
+// results read from rollups and counted live can be merged
+type statisticsSegment struct {
+	total                int64
+	riskSum              float64
+	riskCount            int64
+	complianceViolations int64
+	counts               map[string]map[string]int64 // dimension -> value -> events
+}
+
+func newStatisticsSegment() *statisticsSegment {
+	return &statisticsSegment{counts: make(map[string]map[string]int64)}
+}
+
+func (seg *statisticsSegment) add(dimension, value string, count int64) {
+	if seg.counts[dimension] == nil {
+		seg.counts[dimension] = make(map[string]int64)
+	}
+	seg.counts[dimension][value] += count
+}
+
+func (seg *statisticsSegment) merge(other *statisticsSegment) {
+	seg.total += other.total
+	seg.riskSum += other.riskSum
+	seg.riskCount += other.riskCount
+	seg.complianceViolations += other.complianceViolations
+	for dimension, values := range other.counts {
+		for value, count := range values {
+			seg.add(dimension, value, count)
+		}
+	}
+}
+
+func (seg *statisticsSegment) statistics(startTime, endTime time.Time) *AuditStatistics {
+	stats := &AuditStatistics{
+		TotalEvents:          seg.total,
+		EventsByType:         make(map[AuditEventType]int64),
+		EventsByCategory:     make(map[AuditCategory]int64),
+		EventsBySeverity:     make(map[AuditSeverity]int64),
+		EventsByOutcome:      make(map[AuditOutcome]int64),
+		ComplianceViolations: seg.complianceViolations,
+		TimeRange: AuditTimeRange{
+			StartTime: startTime,
+			EndTime:   endTime,
+		},
+	}
+	for value, count := range seg.counts[models.RollupDimensionEventType] {
+		stats.EventsByType[AuditEventType(value)] = count
+	}
+	for value, count := range seg.counts[models.RollupDimensionCategory] {
+		stats.EventsByCategory[AuditCategory(value)] = count
+	}
+	for value, count := range seg.counts[models.RollupDimensionSeverity] {
+		stats.EventsBySeverity[AuditSeverity(value)] = count
+	}
+	for value, count := range seg.counts[models.RollupDimensionOutcome] {
+		stats.EventsByOutcome[AuditOutcome(value)] = count
+	}
+	stats.SecurityEvents = stats.EventsByCategory[CategorySecurity]
+	stats.FailedAttempts = stats.EventsByOutcome[OutcomeFailure] + stats.EventsByOutcome[OutcomeDenied]
+	if seg.riskCount > 0 {
+		stats.AverageRiskScore = seg.riskSum / float64(seg.riskCount)
+	}
+	return stats
+}
+
+// rollups returns the rows that store seg as the rollup of day
+func (seg *statisticsSegment) rollups(day string) []models.AuditDailyRollup {
+	rows := []models.AuditDailyRollup{
+		{Day: day, Dimension: models.RollupDimensionTotal, Count: seg.total, RiskSum: seg.riskSum, RiskCount: seg.riskCount},
+		{Day: day, Dimension: models.RollupDimensionCompliance, Count: seg.complianceViolations},
+	}
+	for dimension, values := range seg.counts {
+		for value, count := range values {
+			rows = append(rows, models.AuditDailyRollup{Day: day, Dimension: dimension, Value: value, Count: count})
+		}
+	}
+	return rows
+}
+
+// liveSegment counts audit events in [from, to) straight from the events table. Sampled
+// events are weighted by their sample rate, so counts estimate every event that occurred.
+func (s *AuditService) liveSegment(tx *gorm.DB, from, to time.Time) (*statisticsSegment, error) {
+	seg := newStatisticsSegment()
+	inRange := "timestamp >= ? AND timestamp < ?"
+
+	var total sql.NullFloat64
+	if err := tx.Model(&AuditEvent{}).Select("SUM("+auditEventWeight+")").Where(inRange, from, to).Scan(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to get total events count: %w", err)
+	}
+	seg.total = weightedCount(total.Float64)
+
+	for dimension, column := range map[string]string{
+		models.RollupDimensionEventType: "event_type",
+		models.RollupDimensionCategory:  "category",
+		models.RollupDimensionSeverity:  "severity",
+		models.RollupDimensionOutcome:   "outcome",
+	} {
+		var results []struct {
+			Value string
+			Count float64
+		}
+		if err := tx.Model(&AuditEvent{}).
+			Select(column+" AS value, SUM("+auditEventWeight+") AS count").
+			Where(inRange, from, to).
+			Group(column).
+			Scan(&results).Error; err != nil {
+			return nil, fmt.Errorf("failed to get events by %s: %w", dimension, err)
+		}
+		for _, result := range results {
+			seg.add(dimension, result.Value, weightedCount(result.Count))
+		}
+	}
+
+	var risk struct {
+		Sum   sql.NullFloat64
+		Count sql.NullFloat64
+	}
+	if err := tx.Model(&AuditEvent{}).
+		Select("SUM(risk_score * "+auditEventWeight+") AS sum, SUM(CASE WHEN risk_score IS NOT NULL THEN "+auditEventWeight+" END) AS count").
+		Where(inRange, from, to).
+		Scan(&risk).Error; err != nil {
+		return nil, fmt.Errorf("failed to get risk scores: %w", err)
+	}
+	seg.riskSum, seg.riskCount = risk.Sum.Float64, weightedCount(risk.Count.Float64)
+
+	var violations sql.NullFloat64
+	if err := tx.Model(&AuditEvent{}).
+		Select("SUM("+auditEventWeight+")").
+		Where(inRange+" AND array_length(compliance_flags, 1) > 0", from, to).
+		Scan(&violations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get compliance violations count: %w", err)
+	}
+	seg.complianceViolations = weightedCount(violations.Float64)
+
+	return seg, nil
+}
+
+// weightedCount rounds a sum of event weights to the number of events it estimates
+func weightedCount(sum float64) int64 {
+	return int64(math.Round(sum))
+}
+
+// rollupSegment sums the stored rollups of days
+func (s *AuditService) rollupSegment(tx *gorm.DB, days []string) (*statisticsSegment, error) {
+	var results []struct {
+		Dimension string
+		Value     string
+		Count     int64
+		RiskSum   float64
+		RiskCount int64
+	}
+	if err := tx.Model(&models.AuditDailyRollup{}).
+		Select("dimension, value, SUM(count) AS count, SUM(risk_sum) AS risk_sum, SUM(risk_count) AS risk_count").
+		Where("day IN ?", days).
+		Group("dimension, value").
+		Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to read audit rollups: %w", err)
+	}
+
+	seg := newStatisticsSegment()
+	for _, result := range results {
+		switch result.Dimension {
+		case models.RollupDimensionTotal:
+			seg.total, seg.riskSum, seg.riskCount = result.Count, result.RiskSum, result.RiskCount
+		case models.RollupDimensionCompliance:
+			seg.complianceViolations = result.Count
+		default:
+			seg.add(result.Dimension, result.Value, result.Count)
+		}
+	}
+	return seg, nil
+}
+
+// rolledUpDays returns which UTC days in [from, to) have a rollup
+func (s *AuditService) rolledUpDays(tx *gorm.DB, from, to time.Time) (map[string]bool, error) {
+	rolledUp := make(map[string]bool)
+	if !from.Before(to) {
+		return rolledUp, nil
+	}
+
+	var days []string
+	if err := tx.Model(&models.AuditDailyRollup{}).
+		Where("dimension = ? AND day >= ? AND day < ?", models.RollupDimensionTotal, from.Format(rollupDayLayout), to.Format(rollupDayLayout)).
+		Pluck("day", &days).Error; err != nil {
+		return nil, fmt.Errorf("failed to read audit rollups: %w", err)
+	}
+	for _, day := range days {
+		rolledUp[day] = true
+	}
+	return rolledUp, nil
+}
+
+// RefreshDailyRollups rolls up every completed UTC day since the last rolled-up day, which
+// is recomputed to take in events that were still being written when it was last rolled.
+// The first run backfills up to AUDIT_ROLLUP_BACKFILL_DAYS. It returns the days rolled up.
+func (s *AuditService) RefreshDailyRollups(now time.Time) (int, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -envInt("AUDIT_ROLLUP_BACKFILL_DAYS", 400))
+
+	var lastDay sql.NullString
+	if err := s.db.Model(&models.AuditDailyRollup{}).
+		Select("MAX(day)").
+		Where("dimension = ?", models.RollupDimensionTotal).
+		Scan(&lastDay).Error; err != nil {
+		return 0, fmt.Errorf("failed to read audit rollups: %w", err)
+	}
+	if lastDay.Valid {
+		if day, err := time.Parse(rollupDayLayout, lastDay.String); err == nil && day.After(from) {
+			from = day
+		}
+	} else {
+		var earliest sql.NullTime
+		if err := s.db.Model(&AuditEvent{}).Select("MIN(timestamp)").Scan(&earliest).Error; err != nil {
+			return 0, fmt.Errorf("failed to find earliest audit event: %w", err)
+		}
+		if !earliest.Valid {
+			return 0, nil
+		}
+		if day := earliest.Time.UTC().Truncate(24 * time.Hour); day.After(from) {
+			from = day
+		}
+	}
+
+	rolled := 0
+	for day := from; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if err := s.rollUpDay(day); err != nil {
+			return rolled, err
+		}
+		rolled++
+	}
+	return rolled, nil
+}
+
+// rollUpDay replaces the rollup of one UTC day with a fresh count of its events
+func (s *AuditService) rollUpDay(day time.Time) error {
+	key := day.Format(rollupDayLayout)
+	return s.guard.Run(context.Background(), s.db, "audit_rollup", true, func(tx *gorm.DB) error {
+		seg, err := s.liveSegment(tx, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("day = ?", key).Delete(&models.AuditDailyRollup{}).Error; err != nil {
+			return fmt.Errorf("failed to clear audit rollup for %s: %w", key, err)
+		}
+		if err := tx.Create(seg.rollups(key)).Error; err != nil {
+			return fmt.Errorf("failed to save audit rollup for %s: %w", key, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// auditEventWeight is how many events a stored audit event stands for; statistics sum it
+// instead of counting rows so that sampled event types are extrapolated to their real volume
+const auditEventWeight = "1.0 / COALESCE(NULLIF(sample_rate, 0), 1)"
+
+// AuditSampler decides which low-value audit events are stored. Only successful,
+// informational events without compliance flags are sampled; errors, denials, security
+// events and anything a compliance report relies on are always kept.
+type AuditSampler struct {
+	rates  map[AuditEventType]float64
+	random func() float64
+}
+
+// NewAuditSampler creates a sampler keeping each event type at its rate, from 0 to 1.
+// Event types without a rate are always kept.
+func NewAuditSampler(rates map[AuditEventType]float64) *AuditSampler {
+	sampler := &AuditSampler{rates: make(map[AuditEventType]float64), random: rand.Float64}
+	for eventType, rate := range rates {
+		if rate > 0 && rate < 1 {
+			sampler.rates[eventType] = rate
+		}
+	}
+	return sampler
+}
+
+// NewAuditSamplerFromEnv reads AUDIT_SAMPLE_RATES, a comma-separated list of
+// event_type=rate pairs such as "api_call=0.01,data_access=0.25"
+func NewAuditSamplerFromEnv() *AuditSampler {
+	rates := make(map[AuditEventType]float64)
+	for _, entry := range strings.Split(os.Getenv("AUDIT_SAMPLE_RATES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eventType, value, ok := strings.Cut(entry, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || rate <= 0 || rate > 1 {
+			log.Printf("Ignoring invalid audit sample rate %q: rates must be in (0, 1]", entry)
+			continue
+		}
+		rates[AuditEventType(strings.TrimSpace(eventType))] = rate
+	}
+	return NewAuditSampler(rates)
+}
+
+// Rate returns the fraction of events like this one that are stored
+func (s *AuditSampler) Rate(eventType AuditEventType, category AuditCategory, severity AuditSeverity, outcome AuditOutcome, complianceFlags []string) float64 {
+	if s == nil || outcome != OutcomeSuccess || severity != AuditSeverityInfo || category == CategorySecurity || len(complianceFlags) > 0 {
+		return 1
+	}
+	if rate, ok := s.rates[eventType]; ok {
+		return rate
+	}
+	return 1
+}
+
+// Keep reports whether to store an event sampled at rate
+func (s *AuditSampler) Keep(rate float64) bool {
+	return rate >= 1 || s.random() < rate
+}
@@ -1,18 +1,26 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"log"
 	"time"
 
+	"cloudgate-backend/internal/models"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // AuditService handles comprehensive audit logging for compliance and security
 type AuditService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	guard     *QueryGuard
+	jobs      *JobQueue
+	sampler   *AuditSampler
+	dormant   *StaleAccountService
+	review    *PrivilegeReviewService
+	forwarder *EventForwarder
 }
 
 // AuditEvent represents a comprehensive audit log entry
@@ -36,6 +44,8 @@ type AuditEvent struct {
 	Tags            []string               `json:"tags" gorm:"type:text[]"`
 	CorrelationID   *uuid.UUID             `json:"correlation_id,omitempty" gorm:"type:uuid;index"`
 	ParentEventID   *uuid.UUID             `json:"parent_event_id,omitempty" gorm:"type:uuid;index"`
+	Region          string                 `json:"region,omitempty" gorm:"index"`
+	SampleRate      float64                `json:"sample_rate" gorm:"not null;default:1"`
 	CreatedAt       time.Time              `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt       time.Time              `json:"updated_at" gorm:"autoUpdateTime"`
 }
@@ -101,6 +111,7 @@ const (
 	EventTypeUserDeactivated AuditEventType = "user_deactivated"
 	EventTypeUserReactivated AuditEventType = "user_reactivated"
 	EventTypeAdminAction     AuditEventType = "admin_action"
+	EventTypeImpersonation   AuditEventType = "impersonation"
 
 	// API events
 	EventTypeAPICall           AuditEventType = "api_call"
@@ -215,6 +226,8 @@ type ComplianceReport struct {
 	ComplianceFlags map[string]int64           `json:"compliance_flags"`
 	Violations      []ComplianceViolation      `json:"violations"`
 	Recommendations []ComplianceRecommendation `json:"recommendations"`
+	DormantAccounts *DormantAccountSummary     `json:"dormant_accounts,omitempty"`
+	PrivilegeReview *PrivilegeReviewSummary    `json:"privilege_review,omitempty"`
 	Status          ComplianceReportStatus     `json:"status"`
 }
 
@@ -263,7 +276,10 @@ const (
 // NewAuditService creates a new audit service
 func NewAuditService(db *gorm.DB) *AuditService {
 	service := &AuditService{
-		db: db,
+		db:      db,
+		guard:   NewQueryGuard(),
+		jobs:    NewJobQueue(db, nil),
+		sampler: NewAuditSamplerFromEnv(),
 	}
 
 	// Auto-migrate the audit event table
@@ -274,8 +290,40 @@ func NewAuditService(db *gorm.DB) *AuditService {
 	return service
 }
 
+// SetJobQueue runs the service's background report jobs on a queue shared with other features
+func (s *AuditService) SetJobQueue(jobs *JobQueue) {
+	s.jobs = jobs
+}
+
+// SetStaleAccounts adds dormant account counts to compliance reports
+func (s *AuditService) SetStaleAccounts(dormant *StaleAccountService) {
+	s.dormant = dormant
+}
+
+// SetPrivilegeReview adds the review of privileged role holders to compliance reports
+func (s *AuditService) SetPrivilegeReview(review *PrivilegeReviewService) {
+	s.review = review
+}
+
+// SetEventForwarder sends the audit trail to SIEMs: every audit log written to the
+// service's database or a regional one, whoever writes it, and every audit event it logs
+func (s *AuditService) SetEventForwarder(forwarder *EventForwarder) {
+	s.forwarder = forwarder
+	if forwarder == nil {
+		return
+	}
+	forwarder.Attach(s.db)
+	if residency != nil {
+		for _, db := range residency.regionalDatabases() {
+			if db != s.db {
+				forwarder.Attach(db)
+			}
+		}
+	}
+}
+
 // LogEvent logs a new audit event
-func (s *AuditService) LogEvent(eventType AuditEventType, category AuditCategory, severity AuditSeverity, userID *uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent, resource, action string, outcome AuditOutcome, description string, details map[string]interface{}) error {
+func (s *AuditService) LogEvent(ctx context.Context, eventType AuditEventType, category AuditCategory, severity AuditSeverity, userID *uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent, resource, action string, outcome AuditOutcome, description string, details map[string]interface{}) error {
 	event := AuditEvent{
 		ID:          uuid.New(),
 		Timestamp:   time.Now(),
@@ -302,8 +350,27 @@ func (s *AuditService) LogEvent(eventType AuditEventType, category AuditCategory
 		event.RiskScore = &riskScore
 	}
 
-	// Store the event
-	if err := s.db.Create(&event).Error; err != nil {
+	// Low-value events are sampled; the rate is stored so statistics can extrapolate
+	event.SampleRate = s.sampler.Rate(eventType, category, severity, outcome, event.ComplianceFlags)
+	if !s.sampler.Keep(event.SampleRate) {
+		return nil
+	}
+
+	// The SIEM gets its copy even if the database write below fails
+	s.forwarder.Forward(auditEventSIEMEvent(event))
+
+	// The database is a read-only replica during disaster recovery
+	if DisasterRecoveryActive() {
+		if err := disasterRecovery.QueueAuditEvent(event); err != nil {
+			return fmt.Errorf("failed to queue audit event: %w", err)
+		}
+		return nil
+	}
+
+	// Store the event in the user's data residency region, even if the request is cancelled
+	ctx, cancel := context.WithTimeout(detached(ctx), dbTimeout)
+	defer cancel()
+	if err := auditDB(ctx, userID, s.db).WithContext(ctx).Create(&event).Error; err != nil {
 		log.Printf("Failed to log audit event: %v", err)
 		return fmt.Errorf("failed to log audit event: %w", err)
 	}
@@ -313,7 +380,7 @@ func (s *AuditService) LogEvent(eventType AuditEventType, category AuditCategory
 }
 
 // LogAuthenticationEvent logs authentication-related events
-func (s *AuditService) LogAuthenticationEvent(eventType AuditEventType, userID *uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent string, outcome AuditOutcome, details map[string]interface{}) error {
+func (s *AuditService) LogAuthenticationEvent(ctx context.Context, eventType AuditEventType, userID *uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent string, outcome AuditOutcome, details map[string]interface{}) error {
 	var severity AuditSeverity
 	switch outcome {
 	case OutcomeSuccess:
@@ -329,11 +396,11 @@ func (s *AuditService) LogAuthenticationEvent(eventType AuditEventType, userID *
 		description = fmt.Sprintf("Authentication event: %s for user %s", eventType, userID.String())
 	}
 
-	return s.LogEvent(eventType, CategoryAuthentication, severity, userID, sessionID, ipAddress, userAgent, "authentication", string(eventType), outcome, description, details)
+	return s.LogEvent(ctx, eventType, CategoryAuthentication, severity, userID, sessionID, ipAddress, userAgent, "authentication", string(eventType), outcome, description, details)
 }
 
 // LogDataAccessEvent logs data access events
-func (s *AuditService) LogDataAccessEvent(userID *uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent, resource, action string, outcome AuditOutcome, details map[string]interface{}) error {
+func (s *AuditService) LogDataAccessEvent(ctx context.Context, userID *uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent, resource, action string, outcome AuditOutcome, details map[string]interface{}) error {
 	var eventType AuditEventType
 	var severity AuditSeverity
 
@@ -364,31 +431,31 @@ func (s *AuditService) LogDataAccessEvent(userID *uuid.UUID, sessionID *uuid.UUI
 
 	description := fmt.Sprintf("Data access: %s on %s", action, resource)
 
-	return s.LogEvent(eventType, CategoryDataAccess, severity, userID, sessionID, ipAddress, userAgent, resource, action, outcome, description, details)
+	return s.LogEvent(ctx, eventType, CategoryDataAccess, severity, userID, sessionID, ipAddress, userAgent, resource, action, outcome, description, details)
 }
 
 // LogSecurityEvent logs security-related events
-func (s *AuditService) LogSecurityEvent(eventType AuditEventType, userID *uuid.UUID, ipAddress, userAgent, description string, details map[string]interface{}) error {
+func (s *AuditService) LogSecurityEvent(ctx context.Context, eventType AuditEventType, userID *uuid.UUID, ipAddress, userAgent, description string, details map[string]interface{}) error {
 	severity := AuditSeverityCritical
 	if eventType == EventTypeSuspiciousActivity {
 		severity = AuditSeverityWarning
 	}
 
-	return s.LogEvent(eventType, CategorySecurity, severity, userID, nil, ipAddress, userAgent, "security", string(eventType), OutcomeSuccess, description, details)
+	return s.LogEvent(ctx, eventType, CategorySecurity, severity, userID, nil, ipAddress, userAgent, "security", string(eventType), OutcomeSuccess, description, details)
 }
 
 // LogAdminEvent logs administrative events
-func (s *AuditService) LogAdminEvent(adminUserID uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent, resource, action string, outcome AuditOutcome, description string, details map[string]interface{}) error {
+func (s *AuditService) LogAdminEvent(ctx context.Context, adminUserID uuid.UUID, sessionID *uuid.UUID, ipAddress, userAgent, resource, action string, outcome AuditOutcome, description string, details map[string]interface{}) error {
 	severity := AuditSeverityInfo
 	if outcome != OutcomeSuccess {
 		severity = AuditSeverityError
 	}
 
-	return s.LogEvent(EventTypeAdminAction, CategoryAdministrative, severity, &adminUserID, sessionID, ipAddress, userAgent, resource, action, outcome, description, details)
+	return s.LogEvent(ctx, EventTypeAdminAction, CategoryAdministrative, severity, &adminUserID, sessionID, ipAddress, userAgent, resource, action, outcome, description, details)
 }
 
 // LogAPIEvent logs API-related events
-func (s *AuditService) LogAPIEvent(userID *uuid.UUID, ipAddress, userAgent, endpoint, method string, statusCode int, responseTime time.Duration, details map[string]interface{}) error {
+func (s *AuditService) LogAPIEvent(ctx context.Context, userID *uuid.UUID, ipAddress, userAgent, endpoint, method string, statusCode int, responseTime time.Duration, details map[string]interface{}) error {
 	var eventType AuditEventType
 	var outcome AuditOutcome
 	var severity AuditSeverity
@@ -420,12 +487,47 @@ func (s *AuditService) LogAPIEvent(userID *uuid.UUID, ipAddress, userAgent, endp
 
 	description := fmt.Sprintf("API call: %s %s (status: %d)", method, endpoint, statusCode)
 
-	return s.LogEvent(eventType, CategoryAPI, severity, userID, nil, ipAddress, userAgent, endpoint, method, outcome, description, details)
+	return s.LogEvent(ctx, eventType, CategoryAPI, severity, userID, nil, ipAddress, userAgent, endpoint, method, outcome, description, details)
 }
 
 // GetEvents retrieves audit events with filtering
 func (s *AuditService) GetEvents(filter AuditFilter) ([]AuditEvent, error) {
-	query := s.db.Model(&AuditEvent{})
+	var events []AuditEvent
+	if err := s.eventQuery(s.db, filter).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// StreamEvents calls fn for each matching audit event, reading them from a database cursor
+// one row at a time instead of loading the whole result set, so exports of millions of
+// events run in flat memory. Returning an error from fn stops the stream and is returned.
+func (s *AuditService) StreamEvents(ctx context.Context, filter AuditFilter, fn func(*AuditEvent) error) error {
+	rows, err := s.eventQuery(s.db.WithContext(ctx), filter).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event AuditEvent
+		if err := s.db.ScanRows(rows, &event); err != nil {
+			return fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read audit events: %w", err)
+	}
+	return nil
+}
+
+// eventQuery builds the filtered, ordered audit event query shared by GetEvents and StreamEvents
+func (s *AuditService) eventQuery(db *gorm.DB, filter AuditFilter) *gorm.DB {
+	query := db.Model(&AuditEvent{})
 
 	// Apply filters
 	if filter.StartTime != nil {
@@ -480,138 +582,172 @@ func (s *AuditService) GetEvents(filter AuditFilter) ([]AuditEvent, error) {
 	}
 
 	// Order by timestamp descending
-	query = query.Order("timestamp DESC")
-
-	var events []AuditEvent
-	if err := query.Find(&events).Error; err != nil {
-		return nil, fmt.Errorf("failed to retrieve audit events: %w", err)
-	}
-
-	return events, nil
+	return query.Order("timestamp DESC")
 }
 
-// GetStatistics generates audit statistics for a given time range
+// GetStatistics generates audit statistics for a given time range, inline and bounded by
+// the query guard's maximum range and statement timeout
 func (s *AuditService) GetStatistics(startTime, endTime time.Time) (*AuditStatistics, error) {
-	stats := &AuditStatistics{
-		EventsByType:     make(map[AuditEventType]int64),
-		EventsByCategory: make(map[AuditCategory]int64),
-		EventsBySeverity: make(map[AuditSeverity]int64),
-		EventsByOutcome:  make(map[AuditOutcome]int64),
-		TimeRange: AuditTimeRange{
-			StartTime: startTime,
-			EndTime:   endTime,
-		},
+	if _, err := s.guard.CheckRange(models.ReportJobAuditStatistics, startTime, endTime); err != nil {
+		return nil, err
 	}
 
-	// Get total events count
-	if err := s.db.Model(&AuditEvent{}).
-		Where("timestamp BETWEEN ? AND ?", startTime, endTime).
-		Count(&stats.TotalEvents).Error; err != nil {
-		return nil, fmt.Errorf("failed to get total events count: %w", err)
-	}
+	var stats *AuditStatistics
+	err := s.guard.Run(context.Background(), s.db, models.ReportJobAuditStatistics, false, func(tx *gorm.DB) error {
+		var err error
+		stats, err = s.statistics(tx, startTime, endTime)
+		return err
+	})
+	return stats, err
+}
 
-	// Get events by type
-	var typeResults []struct {
-		EventType AuditEventType `json:"event_type"`
-		Count     int64          `json:"count"`
-	}
-	if err := s.db.Model(&AuditEvent{}).
-		Select("event_type, COUNT(*) as count").
-		Where("timestamp BETWEEN ? AND ?", startTime, endTime).
-		Group("event_type").
-		Scan(&typeResults).Error; err != nil {
-		return nil, fmt.Errorf("failed to get events by type: %w", err)
+// RequestStatistics returns statistics for ranges small enough to compute inline; larger
+// ranges are queued as a background job whose result is fetched with GetReportJob
+func (s *AuditService) RequestStatistics(startTime, endTime time.Time, requestedBy *uuid.UUID) (*AuditStatistics, *models.ReportJob, error) {
+	async, err := s.guard.CheckRange(models.ReportJobAuditStatistics, startTime, endTime)
+	if err != nil {
+		return nil, nil, err
 	}
-	for _, result := range typeResults {
-		stats.EventsByType[result.EventType] = result.Count
+	if !async {
+		stats, err := s.GetStatistics(startTime, endTime)
+		return stats, nil, err
 	}
 
-	// Get events by category
-	var categoryResults []struct {
-		Category AuditCategory `json:"category"`
-		Count    int64         `json:"count"`
-	}
-	if err := s.db.Model(&AuditEvent{}).
-		Select("category, COUNT(*) as count").
-		Where("timestamp BETWEEN ? AND ?", startTime, endTime).
-		Group("category").
-		Scan(&categoryResults).Error; err != nil {
-		return nil, fmt.Errorf("failed to get events by category: %w", err)
-	}
-	for _, result := range categoryResults {
-		stats.EventsByCategory[result.Category] = result.Count
+	job := &models.ReportJob{
+		Kind:        models.ReportJobAuditStatistics,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		RequestedBy: requestedBy,
 	}
+	err = s.startReportJob(job, func(tx *gorm.DB) (interface{}, error) {
+		return s.statistics(tx, startTime, endTime)
+	})
+	return nil, job, err
+}
 
-	// Get events by severity
-	var severityResults []struct {
-		Severity AuditSeverity `json:"severity"`
-		Count    int64         `json:"count"`
+// statistics computes statistics for [startTime, endTime) on tx. Whole UTC days before
+// today that have been rolled up are read from the daily rollups; the partial days at
+// either end, today, and any day not rolled up yet are counted live from audit events.
+func (s *AuditService) statistics(tx *gorm.DB, startTime, endTime time.Time) (*AuditStatistics, error) {
+	startTime, endTime = startTime.UTC(), endTime.UTC()
+	firstDay := startTime.Truncate(24 * time.Hour)
+	if firstDay.Before(startTime) {
+		firstDay = firstDay.AddDate(0, 0, 1)
 	}
-	if err := s.db.Model(&AuditEvent{}).
-		Select("severity, COUNT(*) as count").
-		Where("timestamp BETWEEN ? AND ?", startTime, endTime).
-		Group("severity").
-		Scan(&severityResults).Error; err != nil {
-		return nil, fmt.Errorf("failed to get events by severity: %w", err)
+	lastDay := endTime.Truncate(24 * time.Hour)
+	if today := time.Now().UTC().Truncate(24 * time.Hour); today.Before(lastDay) {
+		lastDay = today
 	}
-	for _, result := range severityResults {
-		stats.EventsBySeverity[result.Severity] = result.Count
+
+	rolledUp, err := s.rolledUpDays(tx, firstDay, lastDay)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get events by outcome
-	var outcomeResults []struct {
-		Outcome AuditOutcome `json:"outcome"`
-		Count   int64        `json:"count"`
+	total := newStatisticsSegment()
+	var rollupDays []string
+	cursor := startTime
+	for day := firstDay; day.Before(lastDay); day = day.AddDate(0, 0, 1) {
+		key := day.Format(rollupDayLayout)
+		if !rolledUp[key] {
+			continue
+		}
+		if cursor.Before(day) {
+			live, err := s.liveSegment(tx, cursor, day)
+			if err != nil {
+				return nil, err
+			}
+			total.merge(live)
+		}
+		rollupDays = append(rollupDays, key)
+		cursor = day.AddDate(0, 0, 1)
 	}
-	if err := s.db.Model(&AuditEvent{}).
-		Select("outcome, COUNT(*) as count").
-		Where("timestamp BETWEEN ? AND ?", startTime, endTime).
-		Group("outcome").
-		Scan(&outcomeResults).Error; err != nil {
-		return nil, fmt.Errorf("failed to get events by outcome: %w", err)
+	if cursor.Before(endTime) {
+		live, err := s.liveSegment(tx, cursor, endTime)
+		if err != nil {
+			return nil, err
+		}
+		total.merge(live)
 	}
-	for _, result := range outcomeResults {
-		stats.EventsByOutcome[result.Outcome] = result.Count
+	if len(rollupDays) > 0 {
+		rolled, err := s.rollupSegment(tx, rollupDays)
+		if err != nil {
+			return nil, err
+		}
+		total.merge(rolled)
 	}
 
-	// Get security events count
-	if err := s.db.Model(&AuditEvent{}).
-		Where("timestamp BETWEEN ? AND ? AND category = ?", startTime, endTime, CategorySecurity).
-		Count(&stats.SecurityEvents).Error; err != nil {
-		return nil, fmt.Errorf("failed to get security events count: %w", err)
-	}
+	return total.statistics(startTime, endTime), nil
+}
 
-	// Get failed attempts count
-	if err := s.db.Model(&AuditEvent{}).
-		Where("timestamp BETWEEN ? AND ? AND outcome IN ?", startTime, endTime, []AuditOutcome{OutcomeFailure, OutcomeDenied}).
-		Count(&stats.FailedAttempts).Error; err != nil {
-		return nil, fmt.Errorf("failed to get failed attempts count: %w", err)
+// GenerateComplianceReport generates a comprehensive compliance report inline, bounded by
+// the query guard's maximum range and statement timeout
+func (s *AuditService) GenerateComplianceReport(reportType ComplianceReportType, startTime, endTime time.Time, generatedBy uuid.UUID) (*ComplianceReport, error) {
+	if _, err := s.guard.CheckRange(models.ReportJobComplianceReport, startTime, endTime); err != nil {
+		return nil, err
 	}
 
-	// Get average risk score
-	var avgRiskScore sql.NullFloat64
-	if err := s.db.Model(&AuditEvent{}).
-		Select("AVG(risk_score)").
-		Where("timestamp BETWEEN ? AND ? AND risk_score IS NOT NULL", startTime, endTime).
-		Scan(&avgRiskScore).Error; err != nil {
-		return nil, fmt.Errorf("failed to get average risk score: %w", err)
+	var report *ComplianceReport
+	err := s.guard.Run(context.Background(), s.db, models.ReportJobComplianceReport, false, func(tx *gorm.DB) error {
+		var err error
+		report, err = s.complianceReport(tx, reportType, startTime, endTime, generatedBy)
+		return err
+	})
+	return report, err
+}
+
+// RequestComplianceReport generates a compliance report inline for small ranges and queues
+// a background job for larger ones, like RequestStatistics
+func (s *AuditService) RequestComplianceReport(reportType ComplianceReportType, startTime, endTime time.Time, generatedBy uuid.UUID) (*ComplianceReport, *models.ReportJob, error) {
+	async, err := s.guard.CheckRange(models.ReportJobComplianceReport, startTime, endTime)
+	if err != nil {
+		return nil, nil, err
 	}
-	if avgRiskScore.Valid {
-		stats.AverageRiskScore = avgRiskScore.Float64
+	if !async {
+		report, err := s.GenerateComplianceReport(reportType, startTime, endTime, generatedBy)
+		return report, nil, err
 	}
 
-	// Get compliance violations count
-	if err := s.db.Model(&AuditEvent{}).
-		Where("timestamp BETWEEN ? AND ? AND array_length(compliance_flags, 1) > 0", startTime, endTime).
-		Count(&stats.ComplianceViolations).Error; err != nil {
-		return nil, fmt.Errorf("failed to get compliance violations count: %w", err)
+	job := &models.ReportJob{
+		Kind:        models.ReportJobComplianceReport,
+		ReportType:  string(reportType),
+		StartTime:   startTime,
+		EndTime:     endTime,
+		RequestedBy: &generatedBy,
 	}
+	err = s.startReportJob(job, func(tx *gorm.DB) (interface{}, error) {
+		return s.complianceReport(tx, reportType, startTime, endTime, generatedBy)
+	})
+	return nil, job, err
+}
 
-	return stats, nil
+// GetReportJob returns a background report job; its result is JSON once completed
+func (s *AuditService) GetReportJob(jobID uuid.UUID) (*models.ReportJob, error) {
+	return s.jobs.Get(jobID)
 }
 
-// GenerateComplianceReport generates a comprehensive compliance report
-func (s *AuditService) GenerateComplianceReport(reportType ComplianceReportType, startTime, endTime time.Time, generatedBy uuid.UUID) (*ComplianceReport, error) {
+// QueryMetrics returns the query cost recorded per reporting endpoint since startup
+func (s *AuditService) QueryMetrics() []QueryCostMetric {
+	return s.guard.Metrics()
+}
+
+// startReportJob runs job on the job queue, within the query guard's background timeout
+func (s *AuditService) startReportJob(job *models.ReportJob, run func(tx *gorm.DB) (interface{}, error)) error {
+	endpoint := job.Kind + "_job"
+	return s.jobs.Enqueue(job, func(ctx context.Context, progress *JobRun) (interface{}, error) {
+		progress.Logf("Querying audit events from %s to %s", job.StartTime.Format(time.RFC3339), job.EndTime.Format(time.RFC3339))
+		var result interface{}
+		err := s.guard.Run(ctx, s.db, endpoint, true, func(tx *gorm.DB) error {
+			var err error
+			result, err = run(tx)
+			return err
+		})
+		return result, err
+	})
+}
+
+// complianceReport runs the compliance report queries on tx
+func (s *AuditService) complianceReport(tx *gorm.DB, reportType ComplianceReportType, startTime, endTime time.Time, generatedBy uuid.UUID) (*ComplianceReport, error) {
 	report := &ComplianceReport{
 		ID:          uuid.New(),
 		ReportType:  reportType,
@@ -622,7 +758,7 @@ func (s *AuditService) GenerateComplianceReport(reportType ComplianceReportType,
 	}
 
 	// Generate statistics
-	stats, err := s.GetStatistics(startTime, endTime)
+	stats, err := s.statistics(tx, startTime, endTime)
 	if err != nil {
 		report.Status = ReportStatusFailed
 		return report, fmt.Errorf("failed to generate statistics: %w", err)
@@ -635,7 +771,7 @@ func (s *AuditService) GenerateComplianceReport(reportType ComplianceReportType,
 		Flag  string `json:"flag"`
 		Count int64  `json:"count"`
 	}
-	if err := s.db.Raw(`
+	if err := tx.Raw(`
 		SELECT unnest(compliance_flags) as flag, COUNT(*) as count
 		FROM audit_events
 		WHERE timestamp BETWEEN ? AND ?
@@ -651,6 +787,40 @@ func (s *AuditService) GenerateComplianceReport(reportType ComplianceReportType,
 	// Generate violations and recommendations based on report type
 	report.Violations = s.generateComplianceViolations(reportType, startTime, endTime)
 	report.Recommendations = s.generateComplianceRecommendations(reportType, report.Statistics)
+	if s.dormant != nil {
+		summary, err := s.dormant.Summary()
+		if err != nil {
+			report.Status = ReportStatusFailed
+			return report, err
+		}
+		report.DormantAccounts = &summary
+		if summary.Dormant > 0 {
+			report.Recommendations = append(report.Recommendations, ComplianceRecommendation{
+				ID:          uuid.New(),
+				Title:       "Dormant Accounts Still Enabled",
+				Description: fmt.Sprintf("%d account(s) have had no sign-in for %d days; review and disable them, or enable STALE_ACCOUNT_AUTO_DISABLE", summary.Dormant, summary.ThresholdDays),
+				Priority:    "medium",
+				Category:    "access_review",
+			})
+		}
+	}
+	if s.review != nil {
+		review, err := s.review.Report(tx.Statement.Context, time.Now())
+		if err != nil {
+			report.Status = ReportStatusFailed
+			return report, err
+		}
+		report.PrivilegeReview = &review.Summary
+		if review.Summary.Demote+review.Summary.Revoke > 0 {
+			report.Recommendations = append(report.Recommendations, ComplianceRecommendation{
+				ID:          uuid.New(),
+				Title:       "Unused Privileged Access",
+				Description: fmt.Sprintf("%d admin or security role holder(s) should be demoted and %d revoked; see the privilege review", review.Summary.Demote, review.Summary.Revoke),
+				Priority:    "high",
+				Category:    "access_review",
+			})
+		}
+	}
 
 	report.Status = ReportStatusCompleted
 	return report, nil
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditVolumeMaxCatchUp bounds how many missed minutes one evaluation works through
+const auditVolumeMaxCatchUp = time.Hour
+
+// AuditVolumeMonitor watches the audit log itself: it baselines events per minute by
+// category and alerts when volume drops sharply, which often means logging is broken or
+// being suppressed, or spikes, which often means something is flooding it
+type AuditVolumeMonitor struct {
+	db            *gorm.DB
+	security      *SecurityMonitoringService
+	smoothing     float64
+	warmup        int64
+	deviations    float64
+	minChange     float64
+	lag           time.Duration
+	alertCooldown time.Duration
+	evaluateEvery time.Duration
+}
+
+// NewAuditVolumeMonitor creates a new audit volume monitor. The security monitoring
+// service raises anomaly alerts and may be nil in tests.
+func NewAuditVolumeMonitor(db *gorm.DB, security *SecurityMonitoringService) *AuditVolumeMonitor {
+	minutes := math.Max(1, envDuration("AUDIT_VOLUME_BASELINE_WINDOW", 2*time.Hour).Minutes())
+	return &AuditVolumeMonitor{
+		db:            db,
+		security:      security,
+		smoothing:     2 / (minutes + 1),
+		warmup:        int64(minutes),
+		deviations:    float64(envInt("AUDIT_VOLUME_DEVIATIONS", 4)),
+		minChange:     float64(envInt("AUDIT_VOLUME_MIN_CHANGE_PERCENT", 50)) / 100,
+		lag:           envDuration("AUDIT_VOLUME_LAG", time.Minute),
+		alertCooldown: envDuration("AUDIT_VOLUME_ALERT_COOLDOWN", time.Hour),
+		evaluateEvery: envDuration("AUDIT_VOLUME_INTERVAL", time.Minute),
+	}
+}
+
+// Interval is how often audit volume should be evaluated
+func (m *AuditVolumeMonitor) Interval() time.Duration {
+	return m.evaluateEvery
+}
+
+// GetBaselines returns the learned volume of every audit category
+func (m *AuditVolumeMonitor) GetBaselines() ([]models.AuditVolumeBaseline, error) {
+	var baselines []models.AuditVolumeBaseline
+	if err := m.db.Order("category").Find(&baselines).Error; err != nil {
+		return nil, fmt.Errorf("failed to load audit volume baselines: %w", err)
+	}
+	return baselines, nil
+}
+
+// Evaluate counts every whole minute since the last evaluation, up to AUDIT_VOLUME_LAG
+// ago so late writes are included, against each category's baseline. It raises an alert
+// for each category whose volume turned anomalous, or stayed anomalous past the cooldown,
+// and returns the number of alerts raised.
+func (m *AuditVolumeMonitor) Evaluate(now time.Time) (int, error) {
+	end := now.Add(-m.lag).UTC().Truncate(time.Minute)
+	baselines, err := m.GetBaselines()
+	if err != nil {
+		return 0, err
+	}
+	byCategory := make(map[string]*models.AuditVolumeBaseline, len(baselines))
+	start := end.Add(-time.Minute)
+	for i := range baselines {
+		byCategory[baselines[i].Category] = &baselines[i]
+		if next := baselines[i].LastMinute.Add(time.Minute); next.Before(start) {
+			start = next
+		}
+	}
+	if earliest := end.Add(-auditVolumeMaxCatchUp); start.Before(earliest) {
+		start = earliest
+	}
+
+	raised := 0
+	changed := make(map[string]bool)
+	for minute := start; minute.Before(end); minute = minute.Add(time.Minute) {
+		counts, err := m.countByCategory(minute, minute.Add(time.Minute))
+		if err != nil {
+			return raised, err
+		}
+		categories := make([]string, 0, len(byCategory)+len(counts))
+		for category := range byCategory {
+			categories = append(categories, category)
+		}
+		for category := range counts {
+			if byCategory[category] == nil {
+				byCategory[category] = &models.AuditVolumeBaseline{Category: category}
+				categories = append(categories, category)
+			}
+		}
+		sort.Strings(categories)
+
+		for _, category := range categories {
+			baseline := byCategory[category]
+			if !baseline.LastMinute.IsZero() && !baseline.LastMinute.Before(minute) {
+				continue
+			}
+			previous := baseline.Status
+			m.observe(baseline, counts[category], minute)
+			changed[category] = true
+			if m.shouldAlert(baseline, previous, now) {
+				if err := m.raiseAlert(baseline); err != nil {
+					log.Printf("⚠️ Failed to raise audit volume alert for %s: %v", category, err)
+				} else {
+					alertedAt := now
+					baseline.LastAlertAt = &alertedAt
+					raised++
+				}
+			}
+		}
+	}
+
+	for category := range changed {
+		baseline := byCategory[category]
+		baseline.UpdatedAt = now
+		if err := m.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(baseline).Error; err != nil {
+			return raised, fmt.Errorf("failed to save audit volume baseline: %w", err)
+		}
+	}
+	return raised, nil
+}
+
+// countByCategory counts audit events in [from, to), scaling sampled events back up
+func (m *AuditVolumeMonitor) countByCategory(from, to time.Time) (map[string]int64, error) {
+	var results []struct {
+		Category string
+		Count    float64
+	}
+	if err := m.db.Model(&AuditEvent{}).
+		Select("category, SUM("+auditEventWeight+") AS count").
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Group("category").
+		Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to count audit events by category: %w", err)
+	}
+	counts := make(map[string]int64, len(results))
+	for _, result := range results {
+		counts[result.Category] = weightedCount(result.Count)
+	}
+	return counts, nil
+}
+
+// observe classifies a minute's count against the baseline and folds it in. Anomalous
+// minutes are learned at a quarter of the usual rate, so a sustained outage keeps
+// alerting while a lasting change in volume is still adopted eventually.
+func (m *AuditVolumeMonitor) observe(baseline *models.AuditVolumeBaseline, count int64, minute time.Time) {
+	observed := float64(count)
+	baseline.Status = models.AuditVolumeNormal
+	if baseline.Samples < m.warmup {
+		baseline.Status = models.AuditVolumeLearning
+	} else {
+		// Counts are roughly Poisson, so quiet categories are not judged on a tiny variance
+		spread := math.Max(math.Sqrt(baseline.Variance), math.Max(math.Sqrt(baseline.Mean), 1))
+		switch {
+		case observed < baseline.Mean-m.deviations*spread && observed < baseline.Mean*(1-m.minChange):
+			baseline.Status = models.AuditVolumeDrop
+		case observed > baseline.Mean+m.deviations*spread && observed > baseline.Mean*(1+m.minChange):
+			baseline.Status = models.AuditVolumeSpike
+		}
+	}
+
+	if baseline.Samples == 0 {
+		baseline.Mean = observed
+	} else {
+		rate := m.smoothing
+		if baseline.Status == models.AuditVolumeDrop || baseline.Status == models.AuditVolumeSpike {
+			rate /= 4
+		}
+		diff := observed - baseline.Mean
+		baseline.Mean += rate * diff
+		baseline.Variance = (1 - rate) * (baseline.Variance + rate*diff*diff)
+	}
+	baseline.Samples++
+	baseline.LastCount = count
+	baseline.LastMinute = minute
+}
+
+func (m *AuditVolumeMonitor) shouldAlert(baseline *models.AuditVolumeBaseline, previous string, now time.Time) bool {
+	if baseline.Status != models.AuditVolumeDrop && baseline.Status != models.AuditVolumeSpike {
+		return false
+	}
+	if baseline.Status != previous {
+		return true
+	}
+	return baseline.LastAlertAt == nil || now.Sub(*baseline.LastAlertAt) >= m.alertCooldown
+}
+
+func (m *AuditVolumeMonitor) raiseAlert(baseline *models.AuditVolumeBaseline) error {
+	if m.security == nil {
+		return nil
+	}
+	severity, title := SeverityMedium, fmt.Sprintf("Audit volume spike in %s events", baseline.Category)
+	advice := "check for a client or attacker flooding the audit log"
+	if baseline.Status == models.AuditVolumeDrop {
+		severity, title = SeverityHigh, fmt.Sprintf("Audit volume drop in %s events", baseline.Category)
+		advice = "check that logging is healthy and has not been suppressed"
+	}
+	_, err := m.security.GenerateAlert(
+		AlertTypeAuditVolumeAnomaly,
+		severity,
+		title,
+		fmt.Sprintf("%d %s audit events were logged in the minute from %s against a baseline of %.1f per minute; %s",
+			baseline.LastCount, baseline.Category, baseline.LastMinute.Format(time.RFC3339), baseline.Mean, advice),
+		map[string]interface{}{
+			"category":      baseline.Category,
+			"direction":     baseline.Status,
+			"observed":      baseline.LastCount,
+			"baseline_mean": math.Round(baseline.Mean*10) / 10,
+			"baseline_std":  math.Round(math.Sqrt(baseline.Variance)*10) / 10,
+			"minute":        baseline.LastMinute,
+		},
+	)
+	return err
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// workersKey finds the worker group in a worker's context, for heartbeats
+type workersKey struct{}
+
+// Workers runs the process's background loops under one context, so they can all be told
+// to stop on shutdown and waited for
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mutex  sync.Mutex
+	stops  []func(context.Context) error
+	beats  map[string]time.Time
+}
+
+// NewWorkers creates a worker group whose context is cancelled by Stop or with parent
+func NewWorkers(parent context.Context) *Workers {
+	w := &Workers{beats: make(map[string]time.Time)}
+	w.ctx, w.cancel = context.WithCancel(context.WithValue(parent, workersKey{}, w))
+	return w
+}
+
+// Context is cancelled when the workers are told to stop
+func (w *Workers) Context() context.Context {
+	return w.ctx
+}
+
+// Go runs fn in the background; fn should return soon after ctx is done
+func (w *Workers) Go(fn func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fn(w.ctx)
+	}()
+}
+
+// OnStop registers a service shutdown to run once the workers have stopped, in reverse
+// order of registration
+func (w *Workers) OnStop(fn func(ctx context.Context) error) {
+	w.mutex.Lock()
+	w.stops = append(w.stops, fn)
+	w.mutex.Unlock()
+}
+
+// Health reports whether the workers are running: not told to stop, and with no loop
+// that has gone stallAfter without a heartbeat, as a loop stuck in a job does
+func (w *Workers) Health(now time.Time, stallAfter time.Duration) error {
+	if w.ctx.Err() != nil {
+		return errors.New("background workers are stopping")
+	}
+	w.mutex.Lock()
+	var stalled []string
+	for name, beat := range w.beats {
+		if now.Sub(beat) > stallAfter {
+			stalled = append(stalled, name)
+		}
+	}
+	w.mutex.Unlock()
+	if len(stalled) > 0 {
+		slices.Sort(stalled)
+		return fmt.Errorf("no heartbeat for %s from %s", stallAfter, strings.Join(stalled, ", "))
+	}
+	return nil
+}
+
+// heartbeat records that the named loop running under ctx is still turning over. Loops
+// outside a worker group are not tracked.
+func heartbeat(ctx context.Context, name string, now time.Time) {
+	if w, ok := ctx.Value(workersKey{}).(*Workers); ok {
+		w.mutex.Lock()
+		w.beats[name] = now
+		w.mutex.Unlock()
+	}
+}
+
+// Stop cancels the workers' context, waits for them to return and then runs the OnStop
+// shutdowns, giving up once ctx is done
+func (w *Workers) Stop(ctx context.Context) error {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errors.New("background workers still running at shutdown deadline")
+	}
+
+	w.mutex.Lock()
+	stops := w.stops
+	w.stops = nil
+	w.mutex.Unlock()
+	for i := len(stops) - 1; i >= 0; i-- {
+		err = errors.Join(err, stops[i](ctx))
+	}
+	return err
+}
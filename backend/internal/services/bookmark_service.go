@@ -0,0 +1,432 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/pkg/constants"
+	"cloudgate-backend/pkg/types"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxBookmarkFieldLength bounds selectors and credentials accepted from clients
+const maxBookmarkFieldLength = 512
+
+var (
+	// ErrBookmarkNotFound is returned when a bookmark app does not exist
+	ErrBookmarkNotFound = errors.New("bookmark app not found")
+	// ErrInvalidBookmark is returned for malformed bookmark apps or credentials
+	ErrInvalidBookmark = errors.New("invalid bookmark app")
+	// ErrBookmarkCredentialsNotAllowed is returned when an app does not store credentials
+	ErrBookmarkCredentialsNotAllowed = errors.New("bookmark app does not store credentials")
+	// ErrBookmarkCredentialNotFound is returned when a user has no credentials for an app
+	ErrBookmarkCredentialNotFound = errors.New("bookmark credentials not found")
+)
+
+var bookmarkIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// BookmarkAppInput describes a bookmark app as entered by an admin
+type BookmarkAppInput struct {
+	AppID            string
+	Name             string
+	Description      string
+	Icon             string
+	Category         string
+	URL              string
+	LoginURL         string
+	UsernameSelector string
+	PasswordSelector string
+	SubmitSelector   string
+	AllowCredentials bool
+	RequiredAAL      int
+}
+
+// BookmarkCredentialInfo tells a user whether they have credentials saved for an app,
+// without revealing them
+type BookmarkCredentialInfo struct {
+	AppID          string     `json:"app_id"`
+	HasCredentials bool       `json:"has_credentials"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+// BookmarkAutofill is what the browser extension needs to sign a user in to a bookmark app.
+// It must only fill the form on a page whose origin matches Origin.
+type BookmarkAutofill struct {
+	AppID            string `json:"app_id"`
+	LoginURL         string `json:"login_url"`
+	Origin           string `json:"origin"`
+	UsernameSelector string `json:"username_selector,omitempty"`
+	PasswordSelector string `json:"password_selector,omitempty"`
+	SubmitSelector   string `json:"submit_selector,omitempty"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+}
+
+// BookmarkService manages apps that do not support SSO. They sit in the app catalog with
+// the "bookmark" protocol, so launches go through the same entitlement checks and
+// analytics as SSO apps. Credentials users choose to store are sealed with
+// BOOKMARK_CREDENTIAL_KEY and only unsealed for auto-fill.
+type BookmarkService struct {
+	db            *gorm.DB
+	credentialKey []byte
+}
+
+// NewBookmarkService creates a new bookmark service
+func NewBookmarkService(db *gorm.DB) *BookmarkService {
+	return &BookmarkService{
+		db:            db,
+		credentialKey: credentialKey("cloudgate-bookmark-credential", "BOOKMARK_CREDENTIAL_KEY"),
+	}
+}
+
+// LoadApps adds every bookmark app to the app catalog
+func (s *BookmarkService) LoadApps() error {
+	apps, err := s.ListApps()
+	if err != nil {
+		return err
+	}
+	for i := range apps {
+		RegisterSaaSApp(bookmarkCatalogEntry(&apps[i]))
+	}
+	return nil
+}
+
+// CreateApp defines a new bookmark app and adds it to the catalog
+func (s *BookmarkService) CreateApp(input BookmarkAppInput, actor *uuid.UUID) (*models.BookmarkApp, error) {
+	input.AppID = strings.ToLower(strings.TrimSpace(input.AppID))
+	if !bookmarkIDPattern.MatchString(input.AppID) {
+		return nil, fmt.Errorf("%w: app_id must be 2-63 lowercase letters, digits or dashes", ErrInvalidBookmark)
+	}
+	if _, exists := GetSaaSApp(input.AppID); exists {
+		return nil, fmt.Errorf("%w: app %s already exists", ErrInvalidBookmark, input.AppID)
+	}
+
+	app := models.BookmarkApp{AppID: input.AppID, CreatedBy: actor}
+	if err := applyBookmarkInput(&app, input); err != nil {
+		return nil, err
+	}
+	app.UpdatedBy = actor
+	if err := s.db.Create(&app).Error; err != nil {
+		return nil, fmt.Errorf("failed to create bookmark app: %w", err)
+	}
+
+	RegisterSaaSApp(bookmarkCatalogEntry(&app))
+	s.audit(actor, "bookmark_app_created", app.AppID, fmt.Sprintf("url=%s credentials=%t", app.URL, app.AllowCredentials), "success")
+	return &app, nil
+}
+
+// UpdateApp replaces a bookmark app's settings. Switching off credential storage deletes
+// the credentials users have saved for it.
+func (s *BookmarkService) UpdateApp(appID string, input BookmarkAppInput, actor *uuid.UUID) (*models.BookmarkApp, error) {
+	app, err := s.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyBookmarkInput(app, input); err != nil {
+		return nil, err
+	}
+	app.UpdatedBy = actor
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(app).Error; err != nil {
+			return err
+		}
+		if !app.AllowCredentials {
+			return tx.Where("app_id = ?", appID).Delete(&models.BookmarkCredential{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bookmark app: %w", err)
+	}
+
+	RegisterSaaSApp(bookmarkCatalogEntry(app))
+	s.audit(actor, "bookmark_app_updated", app.AppID, fmt.Sprintf("url=%s credentials=%t", app.URL, app.AllowCredentials), "success")
+	return app, nil
+}
+
+// GetApp returns a bookmark app
+func (s *BookmarkService) GetApp(appID string) (*models.BookmarkApp, error) {
+	var app models.BookmarkApp
+	err := s.db.Where("app_id = ?", appID).First(&app).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrBookmarkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmark app: %w", err)
+	}
+	return &app, nil
+}
+
+// ListApps returns every bookmark app
+func (s *BookmarkService) ListApps() ([]models.BookmarkApp, error) {
+	var apps []models.BookmarkApp
+	if err := s.db.Order("app_id ASC").Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to list bookmark apps: %w", err)
+	}
+	return apps, nil
+}
+
+// DeleteApp removes a bookmark app, the credentials saved for it and its catalog entry
+func (s *BookmarkService) DeleteApp(appID string, actor *uuid.UUID) error {
+	var deleted int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("app_id = ?", appID).Delete(&models.BookmarkApp{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Where("app_id = ?", appID).Delete(&models.BookmarkCredential{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete bookmark app: %w", err)
+	}
+	if deleted == 0 {
+		return ErrBookmarkNotFound
+	}
+
+	RemoveSaaSApp(appID)
+	s.audit(actor, "bookmark_app_deleted", appID, "Bookmark app and saved credentials removed", "success")
+	return nil
+}
+
+// SaveCredential seals and stores a user's credentials for a bookmark app
+func (s *BookmarkService) SaveCredential(userID uuid.UUID, appID, username, password string) (*BookmarkCredentialInfo, error) {
+	app, err := s.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	if !app.AllowCredentials {
+		return nil, ErrBookmarkCredentialsNotAllowed
+	}
+	if username == "" || password == "" || len(username) > maxBookmarkFieldLength || len(password) > maxBookmarkFieldLength {
+		return nil, fmt.Errorf("%w: username and password are required and limited to %d characters", ErrInvalidBookmark, maxBookmarkFieldLength)
+	}
+
+	sealedUsername, err := sealSecret(s.credentialKey, []byte(username))
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal bookmark credentials: %w", err)
+	}
+	sealedPassword, err := sealSecret(s.credentialKey, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal bookmark credentials: %w", err)
+	}
+
+	var credential models.BookmarkCredential
+	err = s.db.Where("user_id = ? AND app_id = ?", userID, appID).First(&credential).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get bookmark credentials: %w", err)
+	}
+	credential.UserID = userID
+	credential.AppID = appID
+	credential.Username = sealedUsername
+	credential.Password = sealedPassword
+	if err := s.db.Save(&credential).Error; err != nil {
+		return nil, fmt.Errorf("failed to save bookmark credentials: %w", err)
+	}
+
+	s.audit(&userID, "bookmark_credentials_saved", appID, "Credentials saved", "success")
+	return credentialInfo(appID, &credential), nil
+}
+
+// GetCredentialInfo reports whether a user has credentials saved for a bookmark app
+func (s *BookmarkService) GetCredentialInfo(userID uuid.UUID, appID string) (*BookmarkCredentialInfo, error) {
+	var credential models.BookmarkCredential
+	err := s.db.Where("user_id = ? AND app_id = ?", userID, appID).First(&credential).Error
+	if err == gorm.ErrRecordNotFound {
+		return credentialInfo(appID, nil), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmark credentials: %w", err)
+	}
+	return credentialInfo(appID, &credential), nil
+}
+
+// DeleteCredential removes a user's credentials for a bookmark app
+func (s *BookmarkService) DeleteCredential(userID uuid.UUID, appID string) error {
+	result := s.db.Where("user_id = ? AND app_id = ?", userID, appID).Delete(&models.BookmarkCredential{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete bookmark credentials: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrBookmarkCredentialNotFound
+	}
+
+	s.audit(&userID, "bookmark_credentials_deleted", appID, "Credentials deleted", "success")
+	return nil
+}
+
+// Autofill unseals a user's credentials for a bookmark app's login form. Every use is audited.
+func (s *BookmarkService) Autofill(userID uuid.UUID, appID string, now time.Time) (*BookmarkAutofill, error) {
+	app, err := s.GetApp(appID)
+	if err != nil {
+		return nil, err
+	}
+	if !app.AllowCredentials {
+		return nil, ErrBookmarkCredentialsNotAllowed
+	}
+	var credential models.BookmarkCredential
+	err = s.db.Where("user_id = ? AND app_id = ?", userID, appID).First(&credential).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrBookmarkCredentialNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmark credentials: %w", err)
+	}
+
+	username, err := openSecret(s.credentialKey, credential.Username)
+	if err != nil {
+		s.audit(&userID, "bookmark_credentials_used", appID, "Stored credentials could not be unsealed", "failure")
+		return nil, fmt.Errorf("failed to unseal bookmark credentials: %w", err)
+	}
+	password, err := openSecret(s.credentialKey, credential.Password)
+	if err != nil {
+		s.audit(&userID, "bookmark_credentials_used", appID, "Stored credentials could not be unsealed", "failure")
+		return nil, fmt.Errorf("failed to unseal bookmark credentials: %w", err)
+	}
+	if err := s.db.Model(&credential).Update("last_used_at", now).Error; err != nil {
+		log.Printf("Failed to record bookmark credential use: %v", err)
+	}
+
+	loginURL := bookmarkLoginURL(app)
+	parsed, _ := url.Parse(loginURL)
+	s.audit(&userID, "bookmark_credentials_used", appID, "Credentials released for auto-fill", "success")
+	return &BookmarkAutofill{
+		AppID:            appID,
+		LoginURL:         loginURL,
+		Origin:           parsed.Scheme + "://" + parsed.Host,
+		UsernameSelector: app.UsernameSelector,
+		PasswordSelector: app.PasswordSelector,
+		SubmitSelector:   app.SubmitSelector,
+		Username:         string(username),
+		Password:         string(password),
+	}, nil
+}
+
+func applyBookmarkInput(app *models.BookmarkApp, input BookmarkAppInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidBookmark)
+	}
+	links := []string{input.URL}
+	if input.LoginURL != "" {
+		links = append(links, input.LoginURL)
+	}
+	for _, link := range links {
+		parsed, err := url.Parse(link)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+			return fmt.Errorf("%w: %q is not an absolute http(s) URL", ErrInvalidBookmark, link)
+		}
+	}
+	for _, selector := range []string{input.UsernameSelector, input.PasswordSelector, input.SubmitSelector} {
+		if len(selector) > maxBookmarkFieldLength {
+			return fmt.Errorf("%w: selectors are limited to %d characters", ErrInvalidBookmark, maxBookmarkFieldLength)
+		}
+	}
+	if input.RequiredAAL < 0 || input.RequiredAAL > models.AAL3 {
+		return fmt.Errorf("%w: required_aal must be between 0 and %d", ErrInvalidBookmark, models.AAL3)
+	}
+	if input.Category == "" {
+		input.Category = constants.CategoryProductivity
+	}
+
+	app.Name = input.Name
+	app.Description = input.Description
+	app.Icon = input.Icon
+	app.Category = input.Category
+	app.URL = input.URL
+	app.LoginURL = input.LoginURL
+	app.UsernameSelector = input.UsernameSelector
+	app.PasswordSelector = input.PasswordSelector
+	app.SubmitSelector = input.SubmitSelector
+	app.AllowCredentials = input.AllowCredentials
+	app.RequiredAAL = input.RequiredAAL
+	return nil
+}
+
+// bookmarkCatalogEntry describes a bookmark app in the app catalog
+func bookmarkCatalogEntry(app *models.BookmarkApp) *types.SaaSApplication {
+	icon := app.Icon
+	if icon == "" {
+		icon = "🔖"
+	}
+	var domains []string
+	for _, link := range []string{app.URL, app.LoginURL} {
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Hostname() == "" {
+			continue
+		}
+		if host := strings.ToLower(parsed.Hostname()); !slices.Contains(domains, host) {
+			domains = append(domains, host)
+		}
+	}
+	credentials := "none"
+	var dataAccess []string
+	if app.AllowCredentials {
+		credentials = "optional"
+		dataAccess = []string{"The username and password you save for this app"}
+	}
+	return &types.SaaSApplication{
+		ID:          app.AppID,
+		Name:        app.Name,
+		Icon:        icon,
+		Description: app.Description,
+		Category:    app.Category,
+		Protocol:    constants.ProtocolBookmark,
+		Status:      "available",
+		LaunchURL:   app.URL,
+		Domains:     domains,
+		RequiredAAL: app.RequiredAAL,
+		DataAccess:  dataAccess,
+		Config: map[string]string{
+			"login_url":   bookmarkLoginURL(app),
+			"credentials": credentials,
+		},
+		CreatedAt: app.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: app.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func bookmarkLoginURL(app *models.BookmarkApp) string {
+	if app.LoginURL != "" {
+		return app.LoginURL
+	}
+	return app.URL
+}
+
+func credentialInfo(appID string, credential *models.BookmarkCredential) *BookmarkCredentialInfo {
+	if credential == nil {
+		return &BookmarkCredentialInfo{AppID: appID}
+	}
+	updatedAt := credential.UpdatedAt
+	return &BookmarkCredentialInfo{
+		AppID:          appID,
+		HasCredentials: true,
+		UpdatedAt:      &updatedAt,
+		LastUsedAt:     credential.LastUsedAt,
+	}
+}
+
+func (s *BookmarkService) audit(userID *uuid.UUID, action, appID, details, status string) {
+	auditLog := models.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		Resource:   "bookmark_app",
+		ResourceID: appID,
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit bookmark event: %v", err)
+	}
+}
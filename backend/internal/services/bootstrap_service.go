@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Bootstrap step outcomes
+const (
+	BootstrapApplied  = "applied"
+	BootstrapCurrent  = "current"  // already applied at this version
+	BootstrapDisabled = "disabled" // demo data, not enabled for this environment
+)
+
+// BootstrapStep is one piece of seed data. Apply must be safe to run again; raise Version
+// when the seed changes so databases that already have it pick up the change.
+type BootstrapStep struct {
+	Name    string
+	Version int
+	Demo    bool // demo data, never seeded unless demo data is enabled
+	Apply   func(db *gorm.DB) error
+}
+
+// bootstrapSteps is the seed data, in the order it is applied
+func bootstrapSteps() []BootstrapStep {
+	return []BootstrapStep{
+		{
+			Name:    "demo_user",
+			Version: 1,
+			Demo:    true,
+			Apply: func(db *gorm.DB) error {
+				_, err := NewUserService(db).GetOrCreateDemoUser()
+				return err
+			},
+		},
+	}
+}
+
+// BootstrapOptions selects what a bootstrap run seeds
+type BootstrapOptions struct {
+	Demo  bool // seed demo data
+	Force bool // apply steps again even when recorded at their version
+}
+
+// BootstrapResult is the outcome of one bootstrap step
+type BootstrapResult struct {
+	Step    string `json:"step"`
+	Version int    `json:"version"`
+	Demo    bool   `json:"demo"`
+	Status  string `json:"status"`
+}
+
+// BootstrapService seeds the data a fresh CloudGate database needs. Every step is recorded
+// with its version, so a step runs once per version: restarting an instance never
+// recreates seed data that has since been changed or deleted.
+type BootstrapService struct {
+	db    *gorm.DB
+	steps []BootstrapStep
+}
+
+// NewBootstrapService creates a new bootstrap service
+func NewBootstrapService(db *gorm.DB) *BootstrapService {
+	return &BootstrapService{db: db, steps: bootstrapSteps()}
+}
+
+// BootstrapOptionsFromEnv reads the boot-time options. Demo data is seeded when
+// BOOTSTRAP_DEMO_DATA is true; left unset it is seeded only outside production, where
+// GIN_MODE is release or the platform sets PORT. SKIP_DEMO_USER=true still turns it off.
+func BootstrapOptionsFromEnv() BootstrapOptions {
+	demo := getEnv("BOOTSTRAP_DEMO_DATA", fmt.Sprintf("%t", !isProduction())) == "true"
+	if getEnv("SKIP_DEMO_USER", "false") == "true" {
+		demo = false
+	}
+	return BootstrapOptions{Demo: demo}
+}
+
+// isProduction reports whether CloudGate runs in production, where GIN_MODE is release or
+// the platform sets PORT
+func isProduction() bool {
+	return getEnv("GIN_MODE", "") == "release" || getEnv("PORT", "") != ""
+}
+
+// Startup loads the built-in app catalog and, unless BOOTSTRAP_ON_START is false, seeds
+// the database with the options from the environment
+func (s *BootstrapService) Startup(now time.Time) ([]BootstrapResult, error) {
+	InitializeSaaSApps()
+	if getEnv("BOOTSTRAP_ON_START", "true") != "true" {
+		log.Println("ℹ️ Skipping bootstrap seed data (BOOTSTRAP_ON_START=false)")
+		return nil, nil
+	}
+	return s.Run(BootstrapOptionsFromEnv(), now)
+}
+
+// Run applies the steps not yet recorded at their current version
+func (s *BootstrapService) Run(opts BootstrapOptions, now time.Time) ([]BootstrapResult, error) {
+	// Bootstrap runs on boot, before RUN_MIGRATIONS may have created its table
+	if err := s.db.AutoMigrate(&models.BootstrapRecord{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate bootstrap records: %w", err)
+	}
+
+	results := make([]BootstrapResult, 0, len(s.steps))
+	for _, step := range s.steps {
+		result := BootstrapResult{Step: step.Name, Version: step.Version, Demo: step.Demo}
+		if step.Demo && !opts.Demo {
+			result.Status = BootstrapDisabled
+			results = append(results, result)
+			continue
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var record models.BootstrapRecord
+			err := tx.Where("step = ?", step.Name).First(&record).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return fmt.Errorf("failed to get bootstrap record: %w", err)
+			}
+			if err == nil && record.Version >= step.Version && !opts.Force {
+				result.Status = BootstrapCurrent
+				return nil
+			}
+
+			if err := step.Apply(tx); err != nil {
+				return err
+			}
+			record.Step = step.Name
+			record.Version = step.Version
+			record.Demo = step.Demo
+			record.AppliedAt = now
+			if err := tx.Save(&record).Error; err != nil {
+				return fmt.Errorf("failed to record bootstrap step: %w", err)
+			}
+			result.Status = BootstrapApplied
+			return nil
+		})
+		if err != nil {
+			return results, fmt.Errorf("bootstrap step %s: %w", step.Name, err)
+		}
+		if result.Status == BootstrapApplied {
+			log.Printf("🌱 Bootstrap step %s applied (version %d)", step.Name, step.Version)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ListRecords returns the applied bootstrap steps
+func (s *BootstrapService) ListRecords() ([]models.BootstrapRecord, error) {
+	var records []models.BootstrapRecord
+	if err := s.db.Order("step ASC").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to list bootstrap records: %w", err)
+	}
+	return records, nil
+}
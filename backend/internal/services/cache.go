@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned for keys that are not cached or have expired
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache keeps short-lived state, such as OAuth request-token secrets, WebAuthn challenges
+// and threat intel answers, where every instance can read it. Values expire after their TTL.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Take returns a value and deletes it at once, so single-use values are only used once
+	Take(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// sharedCache holds state that has to survive a request landing on another instance. It is
+// set by SetCache and defaults to a process-local cache, which is only enough for one instance.
+var sharedCache Cache = NewMemoryCache(defaultMemoryCacheEntries)
+
+// SetCache makes handlers and services keep their short-lived state in the cache
+func SetCache(cache Cache) {
+	sharedCache = cache
+}
+
+// SharedCache returns the cache installed by SetCache
+func SharedCache() Cache {
+	return sharedCache
+}
+
+// NewCacheFromEnv returns a Redis cache when REDIS_URL is set, so instances behind a load
+// balancer share state, and otherwise a process-local cache of up to CACHE_MAX_ENTRIES values
+func NewCacheFromEnv() (Cache, error) {
+	if redisURL := getEnv("REDIS_URL", ""); redisURL != "" {
+		return NewRedisCache(redisURL)
+	}
+	return NewMemoryCache(envInt("CACHE_MAX_ENTRIES", defaultMemoryCacheEntries)), nil
+}
+
+const defaultMemoryCacheEntries = 100000
+
+// MemoryCache is a Cache in process memory, for single instances and tests
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a cache of up to maxEntries values. When it is full, expired values
+// are dropped and, if none have expired, everything is.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{maxEntries: maxEntries, entries: make(map[string]memoryCacheEntry)}
+}
+
+// Get returns the value cached for key
+func (m *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lookup(key, time.Now())
+}
+
+// Set caches value for key for ttl
+func (m *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[key]; !exists && m.maxEntries > 0 && len(m.entries) >= m.maxEntries {
+		for cached, entry := range m.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(m.entries, cached)
+			}
+		}
+		if len(m.entries) >= m.maxEntries {
+			m.entries = make(map[string]memoryCacheEntry)
+		}
+	}
+	m.entries[key] = memoryCacheEntry{value: append([]byte(nil), value...), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Take returns the value cached for key and deletes it
+func (m *MemoryCache) Take(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, err := m.lookup(key, time.Now())
+	delete(m.entries, key)
+	return value, err
+}
+
+// Delete drops the value cached for key
+func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryCache) lookup(key string, now time.Time) ([]byte, error) {
+	entry, exists := m.entries[key]
+	if !exists || !now.Before(entry.expiresAt) {
+		return nil, ErrCacheMiss
+	}
+	return append([]byte(nil), entry.value...), nil
+}
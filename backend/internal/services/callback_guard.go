@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// callbackStatePrefixLength is how much of the state parameter identifies a forging
+// campaign; legitimate states are random, so their prefixes rarely repeat
+const callbackStatePrefixLength = 8
+
+// ErrCallbackBlockNotFound is returned when lifting a callback block that does not exist
+var ErrCallbackBlockNotFound = errors.New("callback block not found")
+
+// CallbackGuard throttles OAuth callback and token endpoints, which attackers probe with
+// forged codes and states. Failed requests are counted per IP address and per state
+// prefix over CALLBACK_GUARD_WINDOW; crossing a threshold blocks the IP address or state
+// prefix for CALLBACK_GUARD_BLOCK_DURATION and raises an alert. Failures and blocks are
+// kept in the database so every instance enforces them.
+type CallbackGuard struct {
+	db               *gorm.DB
+	security         *SecurityMonitoringService
+	window           time.Duration
+	blockDuration    time.Duration
+	maxIPFailures    int64
+	maxStateFailures int64
+}
+
+// NewCallbackGuard creates a callback guard. The security monitoring service raises
+// block alerts and may be nil in tests.
+func NewCallbackGuard(db *gorm.DB, security *SecurityMonitoringService) *CallbackGuard {
+	return &CallbackGuard{
+		db:               db,
+		security:         security,
+		window:           envDuration("CALLBACK_GUARD_WINDOW", 10*time.Minute),
+		blockDuration:    envDuration("CALLBACK_GUARD_BLOCK_DURATION", 30*time.Minute),
+		maxIPFailures:    int64(envInt("CALLBACK_GUARD_MAX_IP_FAILURES", 10)),
+		maxStateFailures: int64(envInt("CALLBACK_GUARD_MAX_STATE_FAILURES", 20)),
+	}
+}
+
+// Interval is how often expired failures and blocks should be purged
+func (g *CallbackGuard) Interval() time.Duration {
+	return g.window
+}
+
+// CallbackStatePrefix returns the part of a state parameter failures are grouped by
+func CallbackStatePrefix(state string) string {
+	if len(state) > callbackStatePrefixLength {
+		return state[:callbackStatePrefixLength]
+	}
+	return state
+}
+
+// Check returns the active block covering a request from ipAddress carrying state, or
+// nil when the request may proceed
+func (g *CallbackGuard) Check(ipAddress, state string, now time.Time) (*models.CallbackBlock, error) {
+	query := g.db.Where("expires_at > ?", now)
+	if prefix := CallbackStatePrefix(state); prefix != "" {
+		query = query.Where("(scope = ? AND value = ?) OR (scope = ? AND value = ?)",
+			models.CallbackBlockIP, ipAddress, models.CallbackBlockStatePrefix, prefix)
+	} else {
+		query = query.Where("scope = ? AND value = ?", models.CallbackBlockIP, ipAddress)
+	}
+
+	var block models.CallbackBlock
+	result := query.Order("expires_at DESC").Limit(1).Find(&block)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to check callback blocks: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &block, nil
+}
+
+// RecordFailure counts a rejected callback or token request and blocks the IP address or
+// state prefix once it has failed too often within the window
+func (g *CallbackGuard) RecordFailure(endpoint, ipAddress, state, userAgent string, status int, now time.Time) error {
+	failure := models.CallbackFailure{
+		Endpoint:    endpoint,
+		IPAddress:   ipAddress,
+		StatePrefix: CallbackStatePrefix(state),
+		Status:      status,
+		CreatedAt:   now,
+	}
+	if err := g.db.Create(&failure).Error; err != nil {
+		return fmt.Errorf("failed to record callback failure: %w", err)
+	}
+
+	since := now.Add(-g.window)
+	var ipFailures int64
+	if err := g.db.Model(&models.CallbackFailure{}).Where("ip_address = ? AND created_at > ?", ipAddress, since).Count(&ipFailures).Error; err != nil {
+		return fmt.Errorf("failed to count callback failures: %w", err)
+	}
+	if ipFailures >= g.maxIPFailures {
+		if err := g.block(models.CallbackBlockIP, ipAddress, endpoint, ipFailures, ipAddress, userAgent, now); err != nil {
+			return err
+		}
+	}
+
+	// Forged states spread across many addresses still share a prefix
+	if failure.StatePrefix == "" {
+		return nil
+	}
+	var stateFailures int64
+	if err := g.db.Model(&models.CallbackFailure{}).Where("state_prefix = ? AND created_at > ?", failure.StatePrefix, since).Count(&stateFailures).Error; err != nil {
+		return fmt.Errorf("failed to count callback failures: %w", err)
+	}
+	if stateFailures >= g.maxStateFailures {
+		return g.block(models.CallbackBlockStatePrefix, failure.StatePrefix, endpoint, stateFailures, ipAddress, userAgent, now)
+	}
+	return nil
+}
+
+// block creates or renews a block, alerting only when none was active
+func (g *CallbackGuard) block(scope, value, endpoint string, failures int64, ipAddress, userAgent string, now time.Time) error {
+	var block models.CallbackBlock
+	result := g.db.Where("scope = ? AND value = ?", scope, value).Limit(1).Find(&block)
+	if result.Error != nil {
+		return fmt.Errorf("failed to get callback block: %w", result.Error)
+	}
+	if result.RowsAffected > 0 && block.ExpiresAt.After(now) {
+		return nil
+	}
+
+	block.Scope = scope
+	block.Value = value
+	block.Endpoint = endpoint
+	block.Failures = failures
+	block.ExpiresAt = now.Add(g.blockDuration)
+	if err := g.db.Save(&block).Error; err != nil {
+		return fmt.Errorf("failed to save callback block: %w", err)
+	}
+
+	g.raiseBlockAlert(&block, ipAddress, userAgent)
+	return nil
+}
+
+func (g *CallbackGuard) raiseBlockAlert(block *models.CallbackBlock, ipAddress, userAgent string) {
+	log.Printf("🚨 Blocked OAuth callbacks for %s %s after %d failures", block.Scope, block.Value, block.Failures)
+	if g.security == nil {
+		return
+	}
+	description := fmt.Sprintf("%d failed requests to OAuth callback and token endpoints from %s within %s; blocked until %s",
+		block.Failures, block.Value, g.window, block.ExpiresAt.UTC().Format(time.RFC3339))
+	if block.Scope == models.CallbackBlockStatePrefix {
+		description = fmt.Sprintf("%d failed OAuth callbacks carrying states starting %q within %s; blocked until %s",
+			block.Failures, block.Value, g.window, block.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	_, err := g.security.GenerateAlert(
+		AlertTypeCallbackAbuse,
+		SeverityHigh,
+		"OAuth callback brute force blocked",
+		description,
+		map[string]interface{}{
+			"endpoint":   block.Endpoint,
+			"scope":      block.Scope,
+			"value":      block.Value,
+			"failures":   block.Failures,
+			"expires_at": block.ExpiresAt,
+			"ip_address": ipAddress,
+			"user_agent": userAgent,
+		},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to raise callback abuse alert: %v", err)
+	}
+}
+
+// ListBlocks returns the blocks in force, soonest to expire first
+func (g *CallbackGuard) ListBlocks(now time.Time) ([]models.CallbackBlock, error) {
+	var blocks []models.CallbackBlock
+	if err := g.db.Where("expires_at > ?", now).Order("expires_at ASC").Find(&blocks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list callback blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// Unblock lifts a block early, e.g. when a misbehaving integration has been fixed, and
+// forgets the failures that led to it
+func (g *CallbackGuard) Unblock(id uint, actor *uuid.UUID, now time.Time) error {
+	var block models.CallbackBlock
+	result := g.db.Where("id = ? AND expires_at > ?", id, now).Limit(1).Find(&block)
+	if result.Error != nil {
+		return fmt.Errorf("failed to get callback block: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrCallbackBlockNotFound
+	}
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		column := "ip_address"
+		if block.Scope == models.CallbackBlockStatePrefix {
+			column = "state_prefix"
+		}
+		if err := tx.Where(column+" = ?", block.Value).Delete(&models.CallbackFailure{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&block).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to lift callback block: %w", err)
+	}
+
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     "callback_block_lifted",
+		Resource:   "callback_block",
+		ResourceID: fmt.Sprintf("%d", block.ID),
+		Details:    fmt.Sprintf("Lifted %s block on %s", block.Scope, block.Value),
+		Status:     "success",
+	}
+	if err := g.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit callback block removal: %v", err)
+	}
+	return nil
+}
+
+// Purge deletes failures outside the window and expired blocks
+func (g *CallbackGuard) Purge(now time.Time) error {
+	if err := g.db.Where("created_at <= ?", now.Add(-g.window)).Delete(&models.CallbackFailure{}).Error; err != nil {
+		return fmt.Errorf("failed to purge callback failures: %w", err)
+	}
+	if err := g.db.Where("expires_at <= ?", now).Delete(&models.CallbackBlock{}).Error; err != nil {
+		return fmt.Errorf("failed to purge callback blocks: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CanaryKeyPrefix starts every canary key. CloudGate issues no other keys in this format,
+// so only values carrying it are looked up, and a bearer JWT or provider token never is.
+const CanaryKeyPrefix = "cgk_"
+
+var (
+	// ErrInvalidCanaryKey is returned when creating a canary key without a label
+	ErrInvalidCanaryKey = errors.New("invalid canary key")
+	// ErrCanaryKeyNotFound is returned when a canary key does not exist
+	ErrCanaryKeyNotFound = errors.New("canary key not found")
+)
+
+// CanaryRequest is the request a possible canary key was presented with
+type CanaryRequest struct {
+	Key         string
+	PresentedIn string // authorization, x-api-key, query
+	IPAddress   string
+	UserAgent   string
+	Method      string
+	Path        string
+	Query       string            // credentials redacted
+	Headers     map[string]string // credentials redacted
+}
+
+// CanaryKeyService issues decoy API keys to plant where real keys might leak from, and
+// raises a critical alert whenever one is used
+type CanaryKeyService struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+}
+
+// NewCanaryKeyService creates a new canary key service. The security monitoring service
+// raises canary alerts and may be nil in tests.
+func NewCanaryKeyService(db *gorm.DB, security *SecurityMonitoringService) *CanaryKeyService {
+	return &CanaryKeyService{db: db, security: security}
+}
+
+func hashCanaryKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a canary key. The key itself is only returned here; afterwards only its
+// last four characters are shown.
+func (s *CanaryKeyService) Create(label, placement string, actor *uuid.UUID) (*models.CanaryKey, string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return nil, "", fmt.Errorf("%w: label is required", ErrInvalidCanaryKey)
+	}
+
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate canary key: %w", err)
+	}
+	key := CanaryKeyPrefix + hex.EncodeToString(bytes)
+
+	canary := models.CanaryKey{
+		Label:     label,
+		Placement: strings.TrimSpace(placement),
+		KeyHash:   hashCanaryKey(key),
+		KeyHint:   key[len(key)-4:],
+		CreatedBy: actor,
+	}
+	if err := s.db.Create(&canary).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create canary key: %w", err)
+	}
+
+	s.audit(actor, "canary_key_created", canary.ID.String(), fmt.Sprintf("Created canary key %q for %s", canary.Label, canary.Placement))
+	return &canary, key, nil
+}
+
+// Detect checks whether a presented key is a canary. A canary's use is recorded with its
+// request and raises a critical alert; the caller must then refuse the request.
+func (s *CanaryKeyService) Detect(req CanaryRequest, now time.Time) (*models.CanaryKey, error) {
+	if !strings.HasPrefix(req.Key, CanaryKeyPrefix) {
+		return nil, nil
+	}
+	var canary models.CanaryKey
+	result := s.db.Where("key_hash = ?", hashCanaryKey(req.Key)).Limit(1).Find(&canary)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to check canary keys: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	headers, _ := json.Marshal(req.Headers)
+	hit := models.CanaryKeyHit{
+		CanaryKeyID: canary.ID,
+		IPAddress:   req.IPAddress,
+		UserAgent:   req.UserAgent,
+		Method:      req.Method,
+		Path:        req.Path,
+		Query:       req.Query,
+		Headers:     string(headers),
+		PresentedIn: req.PresentedIn,
+		CreatedAt:   now,
+	}
+	// The alert matters more than the record, so a failed write does not suppress it
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&hit).Error; err != nil {
+			return err
+		}
+		return tx.Model(&canary).Updates(map[string]interface{}{
+			"hit_count":   gorm.Expr("hit_count + 1"),
+			"last_hit_at": now,
+			"last_hit_ip": req.IPAddress,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to record canary key hit: %v", err)
+	}
+
+	s.raiseCanaryAlert(&canary, &hit, req.Headers)
+	return &canary, nil
+}
+
+func (s *CanaryKeyService) raiseCanaryAlert(canary *models.CanaryKey, hit *models.CanaryKeyHit, headers map[string]string) {
+	log.Printf("🚨 Canary key %q used from %s: %s %s", canary.Label, hit.IPAddress, hit.Method, hit.Path)
+	if s.security == nil {
+		return
+	}
+	_, err := s.security.GenerateAlert(
+		AlertTypeCanaryKeyUsed,
+		SeverityCritical,
+		"Canary API key used",
+		fmt.Sprintf("Canary key %q planted in %s was used from %s; wherever it was planted has leaked", canary.Label, canary.Placement, hit.IPAddress),
+		map[string]interface{}{
+			"canary_key_id": canary.ID.String(),
+			"label":         canary.Label,
+			"placement":     canary.Placement,
+			"hit_id":        hit.ID.String(),
+			"presented_in":  hit.PresentedIn,
+			"method":        hit.Method,
+			"endpoint":      hit.Path,
+			"query":         hit.Query,
+			"headers":       headers,
+			"ip_address":    hit.IPAddress,
+			"user_agent":    hit.UserAgent,
+		},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to raise canary key alert: %v", err)
+	}
+}
+
+// List returns every canary key, newest first
+func (s *CanaryKeyService) List() ([]models.CanaryKey, error) {
+	var canaries []models.CanaryKey
+	if err := s.db.Order("created_at DESC").Find(&canaries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list canary keys: %w", err)
+	}
+	return canaries, nil
+}
+
+// Hits returns a page of a canary key's uses, newest first, and the total
+func (s *CanaryKeyService) Hits(id uuid.UUID, limit, offset int) ([]models.CanaryKeyHit, int64, error) {
+	var count int64
+	if err := s.db.Model(&models.CanaryKey{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get canary key: %w", err)
+	}
+	if count == 0 {
+		return nil, 0, ErrCanaryKeyNotFound
+	}
+
+	var total int64
+	if err := s.db.Model(&models.CanaryKeyHit{}).Where("canary_key_id = ?", id).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count canary key hits: %w", err)
+	}
+	var hits []models.CanaryKeyHit
+	if err := s.db.Where("canary_key_id = ?", id).Order("created_at DESC").Limit(limit).Offset(offset).Find(&hits).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list canary key hits: %w", err)
+	}
+	return hits, total, nil
+}
+
+// Delete retires a canary key and its hits; the key then counts as an unknown key
+func (s *CanaryKeyService) Delete(id uuid.UUID, actor *uuid.UUID) error {
+	var deleted int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&models.CanaryKey{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Where("canary_key_id = ?", id).Delete(&models.CanaryKeyHit{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete canary key: %w", err)
+	}
+	if deleted == 0 {
+		return ErrCanaryKeyNotFound
+	}
+
+	s.audit(actor, "canary_key_deleted", id.String(), "Canary key retired")
+	return nil
+}
+
+func (s *CanaryKeyService) audit(actor *uuid.UUID, action, resourceID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "canary_key",
+		ResourceID: resourceID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit canary key change: %v", err)
+	}
+}
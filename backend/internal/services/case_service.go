@@ -0,0 +1,388 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCaseNotFound is returned when a case does not exist
+	ErrCaseNotFound = errors.New("case not found")
+	// ErrCaseClosed is returned when changing a case that has been closed
+	ErrCaseClosed = errors.New("case is closed")
+	// ErrInvalidCaseLink is returned for unknown link types or malformed targets
+	ErrInvalidCaseLink = errors.New("invalid case link")
+	// ErrInvalidCaseInput is returned for unknown severities or statuses
+	ErrInvalidCaseInput = errors.New("invalid case input")
+	// ErrCaseTaskNotFound is returned when a task does not belong to the case
+	ErrCaseTaskNotFound = errors.New("case task not found")
+)
+
+// CaseFilters narrows a case listing
+type CaseFilters struct {
+	Status  string
+	OwnerID *uuid.UUID
+	Limit   int
+	Offset  int
+}
+
+// CaseUpdate holds the case fields an analyst may change; nil fields are left as-is
+type CaseUpdate struct {
+	Title       *string
+	Description *string
+	Severity    *string
+	Status      *string
+	OwnerID     *uuid.UUID
+}
+
+// CaseService manages investigation cases for the SOC workflow
+type CaseService struct {
+	db *gorm.DB
+}
+
+// NewCaseService creates a new case service
+func NewCaseService(db *gorm.DB) *CaseService {
+	return &CaseService{db: db}
+}
+
+// CreateCase opens a new investigation case
+func (s *CaseService) CreateCase(title, description, severity string, ownerID, createdBy *uuid.UUID) (*models.InvestigationCase, error) {
+	if !AlertSeverity(severity).Valid() {
+		return nil, fmt.Errorf("%w: severity %q", ErrInvalidCaseInput, severity)
+	}
+
+	c := models.InvestigationCase{
+		Title:       title,
+		Description: description,
+		Severity:    severity,
+		Status:      models.CaseStatusOpen,
+		OwnerID:     ownerID,
+		CreatedBy:   createdBy,
+	}
+	if err := s.db.Create(&c).Error; err != nil {
+		return nil, fmt.Errorf("failed to create case: %w", err)
+	}
+
+	s.audit(createdBy, "case_created", c.ID, title)
+	return &c, nil
+}
+
+// GetCase returns a case with its links, notes, evidence and tasks
+func (s *CaseService) GetCase(caseID uuid.UUID) (*models.InvestigationCase, error) {
+	var c models.InvestigationCase
+	err := s.db.
+		Preload("Links", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Notes", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Evidence", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Tasks", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		First(&c, "id = ?", caseID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrCaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get case: %w", err)
+	}
+	return &c, nil
+}
+
+// ListCases returns cases matching the filters, most recently updated first
+func (s *CaseService) ListCases(filters CaseFilters) ([]models.InvestigationCase, int64, error) {
+	query := s.db.Model(&models.InvestigationCase{})
+	if filters.Status != "" {
+		query = query.Where("status = ?", filters.Status)
+	}
+	if filters.OwnerID != nil {
+		query = query.Where("owner_id = ?", *filters.OwnerID)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count cases: %w", err)
+	}
+
+	var cases []models.InvestigationCase
+	if err := query.Order("updated_at DESC").Limit(filters.Limit).Offset(filters.Offset).Find(&cases).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list cases: %w", err)
+	}
+	return cases, total, nil
+}
+
+// FindCasesForTarget returns the cases an incident, alert or user is linked to
+func (s *CaseService) FindCasesForTarget(linkType, targetID string) ([]models.InvestigationCase, error) {
+	var cases []models.InvestigationCase
+	err := s.db.
+		Joins("JOIN case_links ON case_links.case_id = investigation_cases.id").
+		Where("case_links.link_type = ? AND case_links.target_id = ?", linkType, targetID).
+		Order("investigation_cases.updated_at DESC").
+		Find(&cases).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cases: %w", err)
+	}
+	return cases, nil
+}
+
+// UpdateCase applies an analyst's changes. Closing stamps ClosedAt; reopening clears it.
+func (s *CaseService) UpdateCase(caseID uuid.UUID, update CaseUpdate, actor *uuid.UUID) (*models.InvestigationCase, error) {
+	c, err := s.loadCase(caseID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Title != nil {
+		updates["title"] = *update.Title
+	}
+	if update.Description != nil {
+		updates["description"] = *update.Description
+	}
+	if update.Severity != nil {
+		if !AlertSeverity(*update.Severity).Valid() {
+			return nil, fmt.Errorf("%w: severity %q", ErrInvalidCaseInput, *update.Severity)
+		}
+		updates["severity"] = *update.Severity
+	}
+	if update.OwnerID != nil {
+		updates["owner_id"] = *update.OwnerID
+	}
+	if update.Status != nil && *update.Status != c.Status {
+		switch *update.Status {
+		case models.CaseStatusOpen, models.CaseStatusInProgress:
+			updates["closed_at"] = nil
+		case models.CaseStatusClosed:
+			updates["closed_at"] = time.Now()
+		default:
+			return nil, fmt.Errorf("%w: status %q", ErrInvalidCaseInput, *update.Status)
+		}
+		updates["status"] = *update.Status
+	}
+	if len(updates) == 0 {
+		return c, nil
+	}
+
+	if err := s.db.Model(c).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update case: %w", err)
+	}
+
+	if update.Status != nil {
+		s.audit(actor, "case_status_changed", caseID, fmt.Sprintf("Status set to %s", *update.Status))
+	} else {
+		s.audit(actor, "case_updated", caseID, "Case details updated")
+	}
+	return s.GetCase(caseID)
+}
+
+// LinkTarget attaches an incident, alert or user to an open case. Linking the same target twice is a no-op.
+func (s *CaseService) LinkTarget(caseID uuid.UUID, linkType, targetID string, actor *uuid.UUID) (*models.CaseLink, error) {
+	switch linkType {
+	case models.CaseLinkIncident, models.CaseLinkAlert, models.CaseLinkUser:
+	default:
+		return nil, fmt.Errorf("%w: unknown link type %q", ErrInvalidCaseLink, linkType)
+	}
+	if _, err := uuid.Parse(targetID); err != nil {
+		return nil, fmt.Errorf("%w: target must be a UUID", ErrInvalidCaseLink)
+	}
+	if _, err := s.loadOpenCase(caseID); err != nil {
+		return nil, err
+	}
+
+	var existing models.CaseLink
+	err := s.db.Where("case_id = ? AND link_type = ? AND target_id = ?", caseID, linkType, targetID).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to check case link: %w", err)
+	}
+
+	link := models.CaseLink{
+		CaseID:   caseID,
+		LinkType: linkType,
+		TargetID: targetID,
+		AddedBy:  actor,
+	}
+	if err := s.db.Create(&link).Error; err != nil {
+		return nil, fmt.Errorf("failed to link %s to case: %w", linkType, err)
+	}
+
+	s.touch(caseID)
+	s.audit(actor, "case_linked", caseID, fmt.Sprintf("Linked %s %s", linkType, targetID))
+	return &link, nil
+}
+
+// UnlinkTarget removes a link from a case
+func (s *CaseService) UnlinkTarget(caseID, linkID uuid.UUID, actor *uuid.UUID) error {
+	if _, err := s.loadOpenCase(caseID); err != nil {
+		return err
+	}
+
+	result := s.db.Where("id = ? AND case_id = ?", linkID, caseID).Delete(&models.CaseLink{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unlink from case: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: link not found", ErrInvalidCaseLink)
+	}
+
+	s.touch(caseID)
+	s.audit(actor, "case_unlinked", caseID, fmt.Sprintf("Removed link %s", linkID))
+	return nil
+}
+
+// AddNote appends an analyst note to a case. Notes are allowed on closed cases for post-mortems.
+func (s *CaseService) AddNote(caseID uuid.UUID, body string, author *uuid.UUID) (*models.CaseNote, error) {
+	if _, err := s.loadCase(caseID); err != nil {
+		return nil, err
+	}
+
+	note := models.CaseNote{
+		CaseID:   caseID,
+		AuthorID: author,
+		Body:     body,
+	}
+	if err := s.db.Create(&note).Error; err != nil {
+		return nil, fmt.Errorf("failed to add note: %w", err)
+	}
+
+	s.touch(caseID)
+	return &note, nil
+}
+
+// AddEvidence records an evidence attachment on an open case
+func (s *CaseService) AddEvidence(caseID uuid.UUID, name, description, uri, sha256 string, actor *uuid.UUID) (*models.CaseEvidence, error) {
+	if _, err := s.loadOpenCase(caseID); err != nil {
+		return nil, err
+	}
+
+	evidence := models.CaseEvidence{
+		CaseID:      caseID,
+		Name:        name,
+		Description: description,
+		URI:         uri,
+		SHA256:      sha256,
+		AddedBy:     actor,
+	}
+	if err := s.db.Create(&evidence).Error; err != nil {
+		return nil, fmt.Errorf("failed to add evidence: %w", err)
+	}
+
+	s.touch(caseID)
+	s.audit(actor, "case_evidence_added", caseID, fmt.Sprintf("Added evidence %s (%s)", name, uri))
+	return &evidence, nil
+}
+
+// AddTask creates a follow-up task on an open case
+func (s *CaseService) AddTask(caseID uuid.UUID, title string, assigneeID *uuid.UUID, dueAt *time.Time, actor *uuid.UUID) (*models.CaseTask, error) {
+	if _, err := s.loadOpenCase(caseID); err != nil {
+		return nil, err
+	}
+
+	task := models.CaseTask{
+		CaseID:     caseID,
+		Title:      title,
+		AssigneeID: assigneeID,
+		DueAt:      dueAt,
+		Status:     models.CaseTaskOpen,
+	}
+	if err := s.db.Create(&task).Error; err != nil {
+		return nil, fmt.Errorf("failed to add task: %w", err)
+	}
+
+	s.touch(caseID)
+	s.audit(actor, "case_task_added", caseID, fmt.Sprintf("Added task: %s", title))
+	return &task, nil
+}
+
+// UpdateTaskStatus marks a task done or reopens it
+func (s *CaseService) UpdateTaskStatus(caseID, taskID uuid.UUID, status string, actor *uuid.UUID) (*models.CaseTask, error) {
+	var completedAt *time.Time
+	switch status {
+	case models.CaseTaskOpen:
+	case models.CaseTaskDone:
+		now := time.Now()
+		completedAt = &now
+	default:
+		return nil, fmt.Errorf("%w: task status %q", ErrInvalidCaseInput, status)
+	}
+
+	var task models.CaseTask
+	err := s.db.Where("id = ? AND case_id = ?", taskID, caseID).First(&task).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrCaseTaskNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+
+	if err := s.db.Model(&task).Updates(map[string]interface{}{"status": status, "completed_at": completedAt}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update task: %w", err)
+	}
+	task.Status = status
+	task.CompletedAt = completedAt
+
+	s.touch(caseID)
+	s.audit(actor, "case_task_updated", caseID, fmt.Sprintf("Task %s set to %s", task.Title, status))
+	return &task, nil
+}
+
+// GetAssignedTasks returns open tasks assigned to an analyst, earliest due first
+func (s *CaseService) GetAssignedTasks(assigneeID uuid.UUID) ([]models.CaseTask, error) {
+	var tasks []models.CaseTask
+	err := s.db.Where("assignee_id = ? AND status = ?", assigneeID, models.CaseTaskOpen).
+		Order("due_at IS NULL, due_at ASC").Find(&tasks).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assigned tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (s *CaseService) loadCase(caseID uuid.UUID) (*models.InvestigationCase, error) {
+	var c models.InvestigationCase
+	err := s.db.First(&c, "id = ?", caseID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrCaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get case: %w", err)
+	}
+	return &c, nil
+}
+
+func (s *CaseService) loadOpenCase(caseID uuid.UUID) (*models.InvestigationCase, error) {
+	c, err := s.loadCase(caseID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == models.CaseStatusClosed {
+		return nil, ErrCaseClosed
+	}
+	return c, nil
+}
+
+// touch bumps the case's updated_at so listings surface recent activity
+func (s *CaseService) touch(caseID uuid.UUID) {
+	if err := s.db.Model(&models.InvestigationCase{}).Where("id = ?", caseID).Update("updated_at", time.Now()).Error; err != nil {
+		log.Printf("Failed to touch case %s: %v", caseID, err)
+	}
+}
+
+func (s *CaseService) audit(actor *uuid.UUID, action string, caseID uuid.UUID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "case",
+		ResourceID: caseID.String(),
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit case change: %v", err)
+	}
+}
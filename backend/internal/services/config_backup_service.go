@@ -0,0 +1,512 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConfigSnapshotSchemaVersion is the snapshot layout written by ExportSnapshot. Restore
+// accepts this version and older ones.
+const ConfigSnapshotSchemaVersion = 1
+
+// Configuration change actions reported by a restore
+const (
+	ConfigChangeCreate = "create"
+	ConfigChangeUpdate = "update"
+	ConfigChangeManual = "manual" // environment-managed, must be changed by an operator
+)
+
+var (
+	// ErrSnapshotVersionUnsupported is returned for snapshots written by a newer CloudGate
+	ErrSnapshotVersionUnsupported = errors.New("unsupported snapshot schema version")
+	// ErrInvalidSnapshot is returned when a snapshot cannot be restored
+	ErrInvalidSnapshot = errors.New("invalid configuration snapshot")
+)
+
+// ConfigSnapshot is CloudGate's configuration state, portable between environments. It
+// carries no secrets, users or history: header proxy shared secrets and signing keys are
+// set up again in the target environment. Alert channels and tenant regions come from the
+// environment and are compared on restore but never applied.
+type ConfigSnapshot struct {
+	SchemaVersion    int                    `json:"schema_version"`
+	ExportedAt       time.Time              `json:"exported_at"`
+	BookmarkApps     []BookmarkAppConfig    `json:"bookmark_apps"`
+	HeaderProxyApps  []HeaderProxyAppConfig `json:"header_proxy_apps"`
+	AccessSchedules  []AccessScheduleConfig `json:"access_schedules"`
+	Playbooks        []PlaybookDefinition   `json:"playbooks"`
+	CorrelationRules []CorrelationRule      `json:"correlation_rules"`
+	RiskThresholds   map[string]float64     `json:"risk_thresholds,omitempty"`
+	ServiceAccounts  []ServiceAccountConfig `json:"service_accounts"`
+	AlertChannels    []string               `json:"alert_channels"`
+	TenantRegions    map[string]string      `json:"tenant_regions"`
+}
+
+// BookmarkAppConfig is a bookmark app in a configuration snapshot
+type BookmarkAppConfig struct {
+	AppID            string `json:"app_id"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Icon             string `json:"icon"`
+	Category         string `json:"category"`
+	URL              string `json:"url"`
+	LoginURL         string `json:"login_url"`
+	UsernameSelector string `json:"username_selector"`
+	PasswordSelector string `json:"password_selector"`
+	SubmitSelector   string `json:"submit_selector"`
+	AllowCredentials bool   `json:"allow_credentials"`
+	RequiredAAL      int    `json:"required_aal"`
+}
+
+// HeaderProxyAppConfig is a header proxy app in a configuration snapshot, without its shared secret
+type HeaderProxyAppConfig struct {
+	AppID             string   `json:"app_id"`
+	UpstreamURL       string   `json:"upstream_url"`
+	UserHeader        string   `json:"user_header"`
+	EmailHeader       string   `json:"email_header"`
+	GroupsHeader      string   `json:"groups_header"`
+	DefaultGroups     []string `json:"default_groups"`
+	RequireAssignment bool     `json:"require_assignment"`
+	Enabled           bool     `json:"enabled"`
+	HasSharedSecret   bool     `json:"has_shared_secret"`
+}
+
+// AccessScheduleConfig is an app access schedule in a configuration snapshot
+type AccessScheduleConfig struct {
+	AppID            string   `json:"app_id"`
+	Timezone         string   `json:"timezone"`
+	StartTime        string   `json:"start_time"`
+	EndTime          string   `json:"end_time"`
+	Days             []string `json:"days"`
+	AllowedCountries []string `json:"allowed_countries"`
+	Enabled          bool     `json:"enabled"`
+}
+
+// ServiceAccountConfig is a service account in a configuration snapshot
+type ServiceAccountConfig struct {
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	CertFingerprint string   `json:"cert_fingerprint"`
+	CertURI         string   `json:"cert_uri"`
+	CertSubject     string   `json:"cert_subject"`
+	Scopes          []string `json:"scopes"`
+	Enabled         bool     `json:"enabled"`
+}
+
+// ConfigChange is one difference between a snapshot and the current configuration
+type ConfigChange struct {
+	Section string   `json:"section"`
+	Key     string   `json:"key"`
+	Action  string   `json:"action"`
+	Fields  []string `json:"fields,omitempty"` // changed fields of an update
+	Note    string   `json:"note,omitempty"`
+}
+
+// ConfigRestoreResult lists the changes a restore made, or would make in a dry run
+type ConfigRestoreResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Changes []ConfigChange `json:"changes"`
+	Applied int            `json:"applied"`
+}
+
+// ConfigBackupService exports and restores configuration snapshots. Restores create and
+// update configuration through the owning services, so the usual validation and audit
+// apply, and never delete anything missing from the snapshot.
+type ConfigBackupService struct {
+	db         *gorm.DB
+	monitoring *SecurityMonitoringService
+	residency  *ResidencyService
+}
+
+// NewConfigBackupService creates a new configuration backup service. monitoring and
+// residency may be nil, leaving their sections empty.
+func NewConfigBackupService(db *gorm.DB, monitoring *SecurityMonitoringService, residency *ResidencyService) *ConfigBackupService {
+	return &ConfigBackupService{db: db, monitoring: monitoring, residency: residency}
+}
+
+// ExportSnapshot captures the current configuration
+func (s *ConfigBackupService) ExportSnapshot(now time.Time) (*ConfigSnapshot, error) {
+	snapshot := &ConfigSnapshot{
+		SchemaVersion:    ConfigSnapshotSchemaVersion,
+		ExportedAt:       now.UTC(),
+		BookmarkApps:     []BookmarkAppConfig{},
+		HeaderProxyApps:  []HeaderProxyAppConfig{},
+		AccessSchedules:  []AccessScheduleConfig{},
+		Playbooks:        []PlaybookDefinition{},
+		CorrelationRules: []CorrelationRule{},
+		ServiceAccounts:  []ServiceAccountConfig{},
+		AlertChannels:    []string{},
+		TenantRegions:    map[string]string{},
+	}
+
+	bookmarks, err := NewBookmarkService(s.db).ListApps()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range bookmarks {
+		snapshot.BookmarkApps = append(snapshot.BookmarkApps, BookmarkAppConfig{
+			AppID: app.AppID, Name: app.Name, Description: app.Description, Icon: app.Icon, Category: app.Category,
+			URL: app.URL, LoginURL: app.LoginURL, UsernameSelector: app.UsernameSelector, PasswordSelector: app.PasswordSelector,
+			SubmitSelector: app.SubmitSelector, AllowCredentials: app.AllowCredentials, RequiredAAL: app.RequiredAAL,
+		})
+	}
+
+	proxies, err := NewHeaderProxyService(s.db).ListApps()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range proxies {
+		snapshot.HeaderProxyApps = append(snapshot.HeaderProxyApps, HeaderProxyAppConfig{
+			AppID: app.AppID, UpstreamURL: app.UpstreamURL, UserHeader: app.UserHeader, EmailHeader: app.EmailHeader,
+			GroupsHeader: app.GroupsHeader, DefaultGroups: splitProxyGroups(app.DefaultGroups),
+			RequireAssignment: app.RequireAssignment, Enabled: app.Enabled, HasSharedSecret: app.SharedSecret != "",
+		})
+	}
+
+	schedules, err := NewAccessScheduleService(s.db).ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		snapshot.AccessSchedules = append(snapshot.AccessSchedules, AccessScheduleConfig{
+			AppID: schedule.AppID, Timezone: schedule.Timezone, StartTime: schedule.StartTime, EndTime: schedule.EndTime,
+			Days: splitProxyGroups(schedule.Days), AllowedCountries: splitProxyGroups(schedule.AllowedCountries), Enabled: schedule.Enabled,
+		})
+	}
+
+	playbooks, err := (&PlaybookEngine{db: s.db}).ListPlaybooks()
+	if err != nil {
+		return nil, err
+	}
+	for _, playbook := range playbooks {
+		definition := playbook.Definition
+		enabled := playbook.Enabled
+		definition.Enabled = &enabled
+		snapshot.Playbooks = append(snapshot.Playbooks, definition)
+	}
+
+	if snapshot.RiskThresholds, err = riskThresholdValues(s.db); err != nil {
+		return nil, err
+	}
+
+	accounts, err := NewServiceAccountService(s.db).ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		snapshot.ServiceAccounts = append(snapshot.ServiceAccounts, serviceAccountConfig(account))
+	}
+
+	if s.monitoring != nil {
+		snapshot.CorrelationRules = s.monitoring.GetCorrelationRules()
+		snapshot.AlertChannels = s.monitoring.AlertChannelNames()
+	}
+	if s.residency != nil {
+		snapshot.TenantRegions = s.residency.TenantRegions()
+	}
+	return snapshot, nil
+}
+
+// Restore applies a snapshot, or only reports the differences when dryRun is set
+func (s *ConfigBackupService) Restore(snapshot *ConfigSnapshot, dryRun bool, actor *uuid.UUID, now time.Time) (*ConfigRestoreResult, error) {
+	if snapshot.SchemaVersion < 1 {
+		return nil, fmt.Errorf("%w: schema_version is required", ErrInvalidSnapshot)
+	}
+	if snapshot.SchemaVersion > ConfigSnapshotSchemaVersion {
+		return nil, fmt.Errorf("%w: %d (this server writes %d)", ErrSnapshotVersionUnsupported, snapshot.SchemaVersion, ConfigSnapshotSchemaVersion)
+	}
+
+	current, err := s.ExportSnapshot(now)
+	if err != nil {
+		return nil, err
+	}
+	result := &ConfigRestoreResult{DryRun: dryRun, Changes: diffSnapshots(current, snapshot)}
+	if dryRun || len(result.Changes) == 0 {
+		return result, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range result.Changes {
+			if change.Action == ConfigChangeManual || change.Section == "correlation_rules" {
+				continue
+			}
+			if err := s.apply(tx, snapshot, change, actor); err != nil {
+				return fmt.Errorf("%s %s: %w", change.Section, change.Key, err)
+			}
+			result.Applied++
+		}
+		return nil
+	})
+	if err != nil {
+		// The catalog already lists bookmark apps from the rolled back restore
+		for _, change := range result.Changes {
+			if change.Section == "bookmark_apps" && change.Action == ConfigChangeCreate {
+				RemoveSaaSApp(change.Key)
+			}
+		}
+		if loadErr := NewBookmarkService(s.db).LoadApps(); loadErr != nil {
+			log.Printf("Failed to reload bookmark apps: %v", loadErr)
+		}
+		return nil, err
+	}
+
+	for _, change := range result.Changes {
+		if change.Section == "correlation_rules" && s.monitoring != nil {
+			s.monitoring.SetCorrelationRules(snapshot.CorrelationRules)
+			result.Applied++
+		}
+	}
+
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     "config_restored",
+		Resource:   "configuration",
+		ResourceID: snapshot.ExportedAt.Format(time.RFC3339),
+		Details:    fmt.Sprintf("Restored %d change(s) from a schema version %d snapshot", result.Applied, snapshot.SchemaVersion),
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit configuration restore: %v", err)
+	}
+	return result, nil
+}
+
+func (s *ConfigBackupService) apply(tx *gorm.DB, snapshot *ConfigSnapshot, change ConfigChange, actor *uuid.UUID) error {
+	switch change.Section {
+	case "bookmark_apps":
+		for _, app := range snapshot.BookmarkApps {
+			if app.AppID != change.Key {
+				continue
+			}
+			input := BookmarkAppInput{
+				AppID: app.AppID, Name: app.Name, Description: app.Description, Icon: app.Icon, Category: app.Category,
+				URL: app.URL, LoginURL: app.LoginURL, UsernameSelector: app.UsernameSelector, PasswordSelector: app.PasswordSelector,
+				SubmitSelector: app.SubmitSelector, AllowCredentials: app.AllowCredentials, RequiredAAL: app.RequiredAAL,
+			}
+			var err error
+			if change.Action == ConfigChangeCreate {
+				_, err = NewBookmarkService(tx).CreateApp(input, actor)
+			} else {
+				_, err = NewBookmarkService(tx).UpdateApp(app.AppID, input, actor)
+			}
+			return err
+		}
+	case "header_proxy_apps":
+		for _, app := range snapshot.HeaderProxyApps {
+			if app.AppID != change.Key {
+				continue
+			}
+			proxies := NewHeaderProxyService(tx)
+			input := HeaderProxyInput{
+				UpstreamURL: app.UpstreamURL, UserHeader: app.UserHeader, EmailHeader: app.EmailHeader, GroupsHeader: app.GroupsHeader,
+				DefaultGroups: app.DefaultGroups, RequireAssignment: app.RequireAssignment, Enabled: app.Enabled,
+			}
+			// Shared secrets are not in snapshots; an existing one is kept
+			if existing, err := proxies.GetApp(app.AppID); err == nil {
+				input.SharedSecret = existing.SharedSecret
+			}
+			_, err := proxies.SetApp(app.AppID, input, actor)
+			return err
+		}
+	case "access_schedules":
+		for _, schedule := range snapshot.AccessSchedules {
+			if schedule.AppID != change.Key {
+				continue
+			}
+			_, err := NewAccessScheduleService(tx).SetSchedule(schedule.AppID, AccessScheduleInput{
+				Timezone: schedule.Timezone, StartTime: schedule.StartTime, EndTime: schedule.EndTime,
+				Days: schedule.Days, AllowedCountries: schedule.AllowedCountries, Enabled: schedule.Enabled,
+			}, actor)
+			return err
+		}
+	case "playbooks":
+		for _, definition := range snapshot.Playbooks {
+			if definition.Name != change.Key {
+				continue
+			}
+			engine := &PlaybookEngine{db: tx}
+			if change.Action == ConfigChangeCreate {
+				_, err := engine.CreatePlaybook(definition, actor)
+				return err
+			}
+			var existing models.Playbook
+			if err := tx.Where("name = ?", definition.Name).First(&existing).Error; err != nil {
+				return fmt.Errorf("failed to get playbook: %w", err)
+			}
+			_, err := engine.UpdatePlaybook(existing.ID, definition)
+			return err
+		}
+	case "risk_thresholds":
+		return saveRiskThresholds(tx, snapshot.RiskThresholds)
+	case "service_accounts":
+		for _, account := range snapshot.ServiceAccounts {
+			if account.Name != change.Key {
+				continue
+			}
+			accounts := NewServiceAccountService(tx)
+			input := ServiceAccountInput{
+				Name: account.Name, Description: account.Description, CertFingerprint: account.CertFingerprint,
+				CertURI: account.CertURI, CertSubject: account.CertSubject, Scopes: account.Scopes, Enabled: account.Enabled,
+			}
+			if change.Action == ConfigChangeCreate {
+				_, err := accounts.CreateAccount(input, actor)
+				return err
+			}
+			var existing models.ServiceAccount
+			if err := tx.Where("name = ?", account.Name).First(&existing).Error; err != nil {
+				return fmt.Errorf("failed to get service account: %w", err)
+			}
+			_, err := accounts.UpdateAccount(existing.ID, input, actor)
+			return err
+		}
+	}
+	return fmt.Errorf("%w: nothing to apply", ErrInvalidSnapshot)
+}
+
+// diffSnapshots lists what restoring desired over current would change
+func diffSnapshots(current, desired *ConfigSnapshot) []ConfigChange {
+	var changes []ConfigChange
+	add := func(section string, currentItems, desiredItems map[string]interface{}) {
+		changes = append(changes, diffSection(section, currentItems, desiredItems)...)
+	}
+
+	add("bookmark_apps", keyedItems(current.BookmarkApps, func(a BookmarkAppConfig) string { return a.AppID }),
+		keyedItems(desired.BookmarkApps, func(a BookmarkAppConfig) string { return a.AppID }))
+
+	proxyChanges := diffSection("header_proxy_apps",
+		keyedItems(current.HeaderProxyApps, func(a HeaderProxyAppConfig) string { return a.AppID }),
+		keyedItems(desired.HeaderProxyApps, func(a HeaderProxyAppConfig) string { return a.AppID }))
+	for i, change := range proxyChanges {
+		fields := change.Fields[:0:0]
+		for _, field := range change.Fields {
+			if field != "has_shared_secret" {
+				fields = append(fields, field)
+			}
+		}
+		proxyChanges[i].Fields = fields
+		for _, app := range desired.HeaderProxyApps {
+			if app.AppID == change.Key && app.HasSharedSecret && (change.Action == ConfigChangeCreate || slices.Contains(change.Fields, "has_shared_secret")) {
+				proxyChanges[i].Note = "the shared secret is not in the snapshot and must be set again"
+			}
+		}
+	}
+	for _, change := range proxyChanges {
+		if change.Action == ConfigChangeCreate || len(change.Fields) > 0 {
+			changes = append(changes, change)
+		} else if change.Note != "" {
+			change.Action = ConfigChangeManual
+			changes = append(changes, change)
+		}
+	}
+
+	add("access_schedules", keyedItems(current.AccessSchedules, func(a AccessScheduleConfig) string { return a.AppID }),
+		keyedItems(desired.AccessSchedules, func(a AccessScheduleConfig) string { return a.AppID }))
+	add("playbooks", keyedItems(current.Playbooks, func(p PlaybookDefinition) string { return p.Name }),
+		keyedItems(desired.Playbooks, func(p PlaybookDefinition) string { return p.Name }))
+	add("service_accounts", keyedItems(current.ServiceAccounts, func(a ServiceAccountConfig) string { return a.Name }),
+		keyedItems(desired.ServiceAccounts, func(a ServiceAccountConfig) string { return a.Name }))
+
+	if desired.RiskThresholds != nil && !reflect.DeepEqual(current.RiskThresholds, desired.RiskThresholds) {
+		change := ConfigChange{Section: "risk_thresholds", Key: "risk_thresholds", Action: ConfigChangeUpdate}
+		if current.RiskThresholds == nil {
+			change.Action = ConfigChangeCreate
+		}
+		for key, value := range desired.RiskThresholds {
+			if existing, ok := current.RiskThresholds[key]; !ok || existing != value {
+				change.Fields = append(change.Fields, key)
+			}
+		}
+		sort.Strings(change.Fields)
+		changes = append(changes, change)
+	}
+	if len(desired.CorrelationRules) > 0 && !reflect.DeepEqual(current.CorrelationRules, desired.CorrelationRules) {
+		changes = append(changes, ConfigChange{Section: "correlation_rules", Key: "correlation_rules", Action: ConfigChangeUpdate,
+			Note: "correlation rules are held in memory; restore them again after a restart"})
+	}
+
+	for _, name := range desired.AlertChannels {
+		if !slices.Contains(current.AlertChannels, name) {
+			changes = append(changes, ConfigChange{Section: "alert_channels", Key: name, Action: ConfigChangeManual,
+				Note: "alert channels are configured through the environment"})
+		}
+	}
+	tenants := make([]string, 0, len(desired.TenantRegions))
+	for tenant := range desired.TenantRegions {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	for _, tenant := range tenants {
+		if current.TenantRegions[tenant] != desired.TenantRegions[tenant] {
+			changes = append(changes, ConfigChange{Section: "tenant_regions", Key: tenant, Action: ConfigChangeManual,
+				Note: fmt.Sprintf("map the tenant to region %s in DATA_RESIDENCY_TENANTS", desired.TenantRegions[tenant])})
+		}
+	}
+	if changes == nil {
+		changes = []ConfigChange{}
+	}
+	return changes
+}
+
+// diffSection compares items by key and field; keys only in current are left alone
+func diffSection(section string, current, desired map[string]interface{}) []ConfigChange {
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []ConfigChange
+	for _, key := range keys {
+		existing, ok := current[key]
+		if !ok {
+			changes = append(changes, ConfigChange{Section: section, Key: key, Action: ConfigChangeCreate})
+			continue
+		}
+		currentFields, desiredFields := fieldMap(existing), fieldMap(desired[key])
+		var fields []string
+		for field, value := range desiredFields {
+			if !reflect.DeepEqual(currentFields[field], value) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			sort.Strings(fields)
+			changes = append(changes, ConfigChange{Section: section, Key: key, Action: ConfigChangeUpdate, Fields: fields})
+		}
+	}
+	return changes
+}
+
+func keyedItems[T any](items []T, key func(T) string) map[string]interface{} {
+	keyed := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		keyed[key(item)] = item
+	}
+	return keyed
+}
+
+// fieldMap flattens an item to its JSON fields so items compare the way they are stored in snapshots
+func fieldMap(item interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	encoded, _ := json.Marshal(item)
+	json.Unmarshal(encoded, &fields)
+	return fields
+}
+
+func serviceAccountConfig(account models.ServiceAccount) ServiceAccountConfig {
+	return ServiceAccountConfig{
+		Name: account.Name, Description: account.Description, CertFingerprint: account.CertFingerprint,
+		CertURI: account.CertURI, CertSubject: account.CertSubject, Scopes: strings.Fields(account.Scopes), Enabled: account.Enabled,
+	}
+}
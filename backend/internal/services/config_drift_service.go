@@ -0,0 +1,553 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of configuration tracked for drift
+const (
+	ConfigKindRules      = "rules"      // playbooks and correlation rules
+	ConfigKindThresholds = "thresholds" // risk scoring thresholds
+	ConfigKindPolicies   = "policies"   // app access schedules and header proxy apps
+	ConfigKindChannels   = "channels"   // alert delivery channels
+)
+
+var (
+	// ErrConfigVersionNotFound is returned for an unknown configuration version
+	ErrConfigVersionNotFound = errors.New("configuration version not found")
+	// ErrConfigRollbackUnsupported is returned when rolling back to a version with no
+	// snapshot, or of configuration that cannot be restored
+	ErrConfigRollbackUnsupported = errors.New("configuration version cannot be rolled back")
+)
+
+// configDrift records configuration changes. It is set by SetConfigDriftService; when nil
+// changes are not tracked.
+var configDrift *ConfigDriftService
+
+// configRestorer puts configuration back to a recorded snapshot through the service that
+// owns it, which records the change as usual. name is the key without the restorer's prefix.
+type configRestorer func(name string, snapshot []byte, actor *uuid.UUID) error
+
+// ConfigFieldChange is one field that changed between two versions of a piece of
+// configuration; fields of nested objects and lists are addressed like steps[0].action
+type ConfigFieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// ConfigVersionDetail is a configuration version with the configuration it recorded and
+// what changed from the version before
+type ConfigVersionDetail struct {
+	models.ConfigVersion
+	Snapshot json.RawMessage     `json:"snapshot,omitempty"`
+	Diff     []ConfigFieldChange `json:"diff"`
+	// Restorable is whether the version can be rolled back to
+	Restorable bool `json:"restorable"`
+}
+
+// pendingRollback marks the change a restorer records as a rollback
+type pendingRollback struct {
+	kind     string
+	key      string
+	version  int
+	actor    *uuid.UUID
+	recorded *models.ConfigVersion
+}
+
+// ConfigDriftStatus describes recent configuration change activity against the alert limits
+type ConfigDriftStatus struct {
+	Window          string                `json:"window"`
+	MaxChanges      int                   `json:"max_changes"`
+	ChangesInWindow int64                 `json:"changes_in_window"`
+	BusinessHours   string                `json:"business_hours"`
+	InBusinessHours bool                  `json:"in_business_hours"`
+	LastChange      *models.ConfigVersion `json:"last_change,omitempty"`
+	ChangesByKind   map[string]int64      `json:"changes_by_kind"`
+}
+
+// ConfigDriftService versions configuration as it changes and raises soft alerts when
+// changes come in an unusual burst or outside business hours, both common signs of an
+// attacker tampering with configuration to keep access. Changes are never blocked.
+type ConfigDriftService struct {
+	db         *gorm.DB
+	security   *SecurityMonitoringService
+	window     time.Duration
+	maxChanges int
+
+	location    *time.Location
+	startMinute int
+	endMinute   int
+	days        []string
+
+	// Restorers by key prefix. Rollbacks run one at a time, and the one running marks the
+	// version its restorer records.
+	restorers  map[string]configRestorer
+	rollbackMu sync.Mutex
+	pendingMu  sync.Mutex
+	pending    *pendingRollback
+}
+
+// NewConfigDriftService creates a new configuration drift service. The burst limit is
+// CONFIG_DRIFT_MAX_CHANGES changes within CONFIG_DRIFT_WINDOW; business hours are
+// CONFIG_BUSINESS_HOURS on CONFIG_BUSINESS_DAYS in CONFIG_BUSINESS_TIMEZONE.
+func NewConfigDriftService(db *gorm.DB, security *SecurityMonitoringService) *ConfigDriftService {
+	s := &ConfigDriftService{
+		db:          db,
+		security:    security,
+		window:      envDuration("CONFIG_DRIFT_WINDOW", time.Hour),
+		maxChanges:  envInt("CONFIG_DRIFT_MAX_CHANGES", 10),
+		location:    time.UTC,
+		startMinute: 8 * 60,
+		endMinute:   18 * 60,
+		days:        []string{"mon", "tue", "wed", "thu", "fri"},
+	}
+
+	if name := getEnv("CONFIG_BUSINESS_TIMEZONE", ""); name != "" {
+		if location, err := time.LoadLocation(name); err == nil {
+			s.location = location
+		} else {
+			log.Printf("⚠️ Invalid CONFIG_BUSINESS_TIMEZONE=%q, using UTC", name)
+		}
+	}
+	if hours := getEnv("CONFIG_BUSINESS_HOURS", ""); hours != "" {
+		start, end, ok := strings.Cut(hours, "-")
+		startMinute, startErr := parseClock(strings.TrimSpace(start))
+		endMinute, endErr := parseClock(strings.TrimSpace(end))
+		if !ok || startErr != nil || endErr != nil {
+			log.Printf("⚠️ Invalid CONFIG_BUSINESS_HOURS=%q, using 08:00-18:00", hours)
+		} else {
+			s.startMinute, s.endMinute = startMinute, endMinute
+		}
+	}
+	if value := getEnv("CONFIG_BUSINESS_DAYS", ""); value != "" {
+		var days []string
+		for _, day := range strings.Split(value, ",") {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if _, ok := weekdayNames[day]; ok {
+				days = append(days, day)
+			} else {
+				log.Printf("⚠️ Ignoring CONFIG_BUSINESS_DAYS entry %q", day)
+			}
+		}
+		s.days = days
+	}
+
+	s.restorers = map[string]configRestorer{
+		"risk_thresholds":     func(_ string, snapshot []byte, _ *uuid.UUID) error { return restoreRiskThresholds(db, snapshot) },
+		"access_schedule:":    NewAccessScheduleService(db).restoreSchedule,
+		"phishing_resistant:": NewPhishingResistantService(db).restorePolicy,
+		"session_policy:":     NewAppSessionPolicyService(db).restorePolicy,
+		"saml_idp:":           NewSAMLServiceProvider(db).restoreConfig,
+		"saml_relying_party:": NewSAMLIssuerService(db).restoreRelyingParty,
+	}
+	if security != nil {
+		s.restorers["playbook:"] = security.playbooks.restorePlaybook
+		s.restorers["correlation_rules"] = security.restoreCorrelationRules
+		s.restorers["rule:"] = security.restoreSecurityRule
+		s.restorers["detection_query:"] = NewDetectionQueryService(db, security).restoreQuery
+	}
+	return s
+}
+
+// restorerFor returns the restorer with the longest prefix matching key, and the key without it
+func (s *ConfigDriftService) restorerFor(key string) (configRestorer, string, bool) {
+	var match string
+	for prefix := range s.restorers {
+		if strings.HasPrefix(key, prefix) && len(prefix) >= len(match) {
+			match = prefix
+		}
+	}
+	restore, ok := s.restorers[match]
+	return restore, strings.TrimPrefix(key, match), ok
+}
+
+// SetConfigDriftService makes configuration changes across CloudGate get versioned and checked for drift
+func SetConfigDriftService(s *ConfigDriftService) {
+	configDrift = s
+}
+
+// recordConfigChange versions a configuration change when drift tracking is on, with a
+// snapshot of the configuration after the change (nil when it was removed or holds
+// secrets). Tracking never fails the change itself.
+func recordConfigChange(kind, key string, actor *uuid.UUID, summary string, snapshot interface{}) {
+	if configDrift == nil {
+		return
+	}
+	if _, err := configDrift.RecordChange(kind, key, actor, summary, snapshot, time.Now()); err != nil {
+		log.Printf("Failed to record %s change to %s: %v", kind, key, err)
+	}
+}
+
+// InBusinessHours reports whether a time falls within business hours
+func (s *ConfigDriftService) InBusinessHours(t time.Time) bool {
+	local := t.In(s.location)
+	minute := local.Hour()*60 + local.Minute()
+	if s.startMinute <= s.endMinute {
+		return s.businessDay(local.Weekday()) && minute >= s.startMinute && minute < s.endMinute
+	}
+	// Hours crossing midnight belong to the day they start on
+	if minute >= s.startMinute {
+		return s.businessDay(local.Weekday())
+	}
+	return minute < s.endMinute && s.businessDay(local.AddDate(0, 0, -1).Weekday())
+}
+
+func (s *ConfigDriftService) businessDay(day time.Weekday) bool {
+	for _, name := range s.days {
+		if weekdayNames[name] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordChange stores the next version of a piece of configuration and alerts on drift.
+// snapshot is the configuration after the change, or nil when it was removed or holds secrets.
+func (s *ConfigDriftService) RecordChange(kind, key string, actor *uuid.UUID, summary string, snapshot interface{}, now time.Time) (*models.ConfigVersion, error) {
+	var encoded []byte
+	if snapshot != nil {
+		var err error
+		if encoded, err = json.Marshal(snapshot); err != nil {
+			return nil, fmt.Errorf("failed to encode configuration snapshot: %w", err)
+		}
+	}
+
+	s.pendingMu.Lock()
+	rollback := s.pending
+	if rollback != nil && (rollback.kind != kind || rollback.key != key || rollback.recorded != nil) {
+		rollback = nil
+	}
+	s.pendingMu.Unlock()
+	var rollbackOf *int
+	if rollback != nil {
+		rollbackOf = &rollback.version
+		summary = fmt.Sprintf("Rolled back to version %d", rollback.version)
+		if actor == nil {
+			actor = rollback.actor
+		}
+	}
+
+	version, err := s.record(kind, key, actor, summary, string(encoded), rollbackOf, now)
+	if err != nil {
+		return nil, err
+	}
+	if rollback != nil {
+		s.pendingMu.Lock()
+		rollback.recorded = version
+		s.pendingMu.Unlock()
+	}
+	return version, nil
+}
+
+func (s *ConfigDriftService) record(kind, key string, actor *uuid.UUID, summary, snapshot string, rollbackOf *int, now time.Time) (*models.ConfigVersion, error) {
+	var previous models.ConfigVersion
+	err := s.db.Where("kind = ? AND key = ?", kind, key).Order("version DESC").Limit(1).Find(&previous).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration version: %w", err)
+	}
+	diff, err := json.Marshal(diffConfigSnapshots(previous.SnapshotJSON, snapshot))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration diff: %w", err)
+	}
+
+	version := models.ConfigVersion{
+		Kind:         kind,
+		Key:          key,
+		Version:      previous.Version + 1,
+		Summary:      summary,
+		ChangedBy:    actor,
+		OffHours:     !s.InBusinessHours(now),
+		ChangedAt:    now,
+		SnapshotJSON: snapshot,
+		DiffJSON:     string(diff),
+		RollbackOf:   rollbackOf,
+	}
+	if err := s.db.Create(&version).Error; err != nil {
+		return nil, fmt.Errorf("failed to record configuration version: %w", err)
+	}
+
+	if err := s.checkDrift(&version, now); err != nil {
+		log.Printf("Failed to check configuration drift: %v", err)
+	}
+	return &version, nil
+}
+
+// checkDrift alerts once when changes in the window first exceed the limit, and on the
+// first off-hours change in a window
+func (s *ConfigDriftService) checkDrift(version *models.ConfigVersion, now time.Time) error {
+	if s.security == nil {
+		return nil
+	}
+	since := now.Add(-s.window)
+
+	var recent int64
+	if err := s.db.Model(&models.ConfigVersion{}).Where("changed_at > ? AND changed_at <= ?", since, now).Count(&recent).Error; err != nil {
+		return fmt.Errorf("failed to count configuration changes: %w", err)
+	}
+	if s.maxChanges > 0 && recent == int64(s.maxChanges)+1 {
+		severity := SeverityMedium
+		if version.OffHours {
+			severity = SeverityHigh
+		}
+		s.alert(severity, "Unusual rate of configuration changes",
+			fmt.Sprintf("%d configuration changes in the last %s, above the usual %d. Review recent changes to rules, thresholds, policies and alert channels for tampering.",
+				recent, s.window, s.maxChanges), version, map[string]interface{}{"changes": recent, "window": s.window.String()})
+	}
+
+	if version.OffHours {
+		var offHours int64
+		if err := s.db.Model(&models.ConfigVersion{}).Where("off_hours = ? AND changed_at > ? AND changed_at <= ?", true, since, now).Count(&offHours).Error; err != nil {
+			return fmt.Errorf("failed to count off-hours configuration changes: %w", err)
+		}
+		if offHours == 1 {
+			s.alert(SeverityLow, "Configuration changed outside business hours",
+				fmt.Sprintf("The %s configuration %s was changed at %s, outside business hours (%s).",
+					version.Kind, version.Key, now.In(s.location).Format(time.RFC3339), s.businessHours()), version, nil)
+		}
+	}
+	return nil
+}
+
+func (s *ConfigDriftService) alert(severity AlertSeverity, title, description string, version *models.ConfigVersion, extra map[string]interface{}) {
+	metadata := map[string]interface{}{
+		"kind":    version.Kind,
+		"key":     version.Key,
+		"version": version.Version,
+	}
+	if version.ChangedBy != nil {
+		metadata["user_id"] = version.ChangedBy.String()
+	}
+	for k, v := range extra {
+		metadata[k] = v
+	}
+	if _, err := s.security.GenerateAlert(AlertTypeConfigurationChange, severity, title, description, metadata); err != nil {
+		log.Printf("Failed to raise configuration drift alert: %v", err)
+	}
+}
+
+// ListVersions returns recorded configuration changes, newest first. kind and key are optional filters.
+func (s *ConfigDriftService) ListVersions(kind, key string, limit int) ([]ConfigVersionDetail, error) {
+	query := s.db.Order("changed_at DESC")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if key != "" {
+		query = query.Where("key = ?", key)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var versions []models.ConfigVersion
+	if err := query.Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list configuration versions: %w", err)
+	}
+	details := make([]ConfigVersionDetail, len(versions))
+	for i, version := range versions {
+		details[i] = s.versionDetail(version)
+	}
+	return details, nil
+}
+
+// GetVersion returns one configuration version with its snapshot and diff
+func (s *ConfigDriftService) GetVersion(versionID uuid.UUID) (*ConfigVersionDetail, error) {
+	var version models.ConfigVersion
+	if err := s.db.First(&version, "id = ?", versionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConfigVersionNotFound
+		}
+		return nil, fmt.Errorf("failed to get configuration version: %w", err)
+	}
+	detail := s.versionDetail(version)
+	return &detail, nil
+}
+
+// Rollback puts configuration back the way a version recorded it. The snapshot is applied
+// through the service owning the configuration, so its usual validation applies, and the
+// restore is recorded as a new version and audited.
+func (s *ConfigDriftService) Rollback(versionID uuid.UUID, actor *uuid.UUID, now time.Time) (*ConfigVersionDetail, error) {
+	var target models.ConfigVersion
+	if err := s.db.First(&target, "id = ?", versionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConfigVersionNotFound
+		}
+		return nil, fmt.Errorf("failed to get configuration version: %w", err)
+	}
+	restore, name, ok := s.restorerFor(target.Key)
+	if !ok || target.SnapshotJSON == "" {
+		return nil, fmt.Errorf("%w: %s version %d has no restorable snapshot", ErrConfigRollbackUnsupported, target.Key, target.Version)
+	}
+
+	s.rollbackMu.Lock()
+	defer s.rollbackMu.Unlock()
+	rollback := &pendingRollback{kind: target.Kind, key: target.Key, version: target.Version, actor: actor}
+	s.pendingMu.Lock()
+	s.pending = rollback
+	s.pendingMu.Unlock()
+	err := restore(name, []byte(target.SnapshotJSON), actor)
+	s.pendingMu.Lock()
+	s.pending = nil
+	recorded := rollback.recorded
+	s.pendingMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back %s to version %d: %w", target.Key, target.Version, err)
+	}
+
+	// The owning service records through the drift service set for CloudGate, which may not be this one
+	if recorded == nil {
+		summary := fmt.Sprintf("Rolled back to version %d", target.Version)
+		if recorded, err = s.record(target.Kind, target.Key, actor, summary, target.SnapshotJSON, &target.Version, now); err != nil {
+			return nil, err
+		}
+	}
+
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     "config_rolled_back",
+		Resource:   target.Kind,
+		ResourceID: target.Key,
+		Details:    fmt.Sprintf("Rolled back %s to version %d as version %d", target.Key, target.Version, recorded.Version),
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit configuration rollback: %v", err)
+	}
+	detail := s.versionDetail(*recorded)
+	return &detail, nil
+}
+
+func (s *ConfigDriftService) versionDetail(version models.ConfigVersion) ConfigVersionDetail {
+	detail := ConfigVersionDetail{ConfigVersion: version, Diff: []ConfigFieldChange{}}
+	if version.SnapshotJSON != "" {
+		detail.Snapshot = json.RawMessage(version.SnapshotJSON)
+		_, _, restorable := s.restorerFor(version.Key)
+		detail.Restorable = restorable
+	}
+	if version.DiffJSON != "" {
+		if err := json.Unmarshal([]byte(version.DiffJSON), &detail.Diff); err != nil {
+			log.Printf("Failed to decode diff of %s version %d: %v", version.Key, version.Version, err)
+		}
+	}
+	return detail
+}
+
+// diffConfigSnapshots lists the fields that differ between two JSON snapshots, by field.
+// An empty snapshot has no fields, so creating or removing configuration changes every field.
+func diffConfigSnapshots(before, after string) []ConfigFieldChange {
+	beforeFields, afterFields := map[string]interface{}{}, map[string]interface{}{}
+	flattenConfigSnapshot(before, beforeFields)
+	flattenConfigSnapshot(after, afterFields)
+
+	fields := make([]string, 0, len(afterFields))
+	for field := range beforeFields {
+		fields = append(fields, field)
+	}
+	for field := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []ConfigFieldChange{}
+	for _, field := range fields {
+		beforeValue, inBefore := beforeFields[field]
+		afterValue, inAfter := afterFields[field]
+		if inBefore && inAfter && reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		changes = append(changes, ConfigFieldChange{Field: field, Before: beforeValue, After: afterValue})
+	}
+	return changes
+}
+
+func flattenConfigSnapshot(snapshot string, fields map[string]interface{}) {
+	if snapshot == "" {
+		return
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(snapshot), &value); err != nil {
+		return
+	}
+	flattenConfigValue("", value, fields)
+}
+
+// flattenConfigValue records the leaves of a decoded JSON value; empty objects and lists are leaves
+func flattenConfigValue(path string, value interface{}, fields map[string]interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(typed) > 0 {
+			for key, child := range typed {
+				childPath := key
+				if path != "" {
+					childPath = path + "." + key
+				}
+				flattenConfigValue(childPath, child, fields)
+			}
+			return
+		}
+	case []interface{}:
+		if len(typed) > 0 {
+			for i, child := range typed {
+				flattenConfigValue(fmt.Sprintf("%s[%d]", path, i), child, fields)
+			}
+			return
+		}
+	}
+	fields[path] = value
+}
+
+// Status summarizes configuration changes in the current window
+func (s *ConfigDriftService) Status(now time.Time) (*ConfigDriftStatus, error) {
+	status := &ConfigDriftStatus{
+		Window:          s.window.String(),
+		MaxChanges:      s.maxChanges,
+		BusinessHours:   s.businessHours(),
+		InBusinessHours: s.InBusinessHours(now),
+		ChangesByKind:   map[string]int64{},
+	}
+
+	var counts []struct {
+		Kind  string
+		Count int64
+	}
+	err := s.db.Model(&models.ConfigVersion{}).Select("kind, COUNT(*) AS count").
+		Where("changed_at > ? AND changed_at <= ?", now.Add(-s.window), now).Group("kind").Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count configuration changes: %w", err)
+	}
+	for _, c := range counts {
+		status.ChangesByKind[c.Kind] = c.Count
+		status.ChangesInWindow += c.Count
+	}
+
+	var last models.ConfigVersion
+	err = s.db.Order("changed_at DESC").First(&last).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get last configuration change: %w", err)
+	}
+	if err == nil {
+		status.LastChange = &last
+	}
+	return status, nil
+}
+
+func (s *ConfigDriftService) businessHours() string {
+	days := append([]string(nil), s.days...)
+	sort.Slice(days, func(i, j int) bool { return weekdayNames[days[i]] < weekdayNames[days[j]] })
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s %s", s.startMinute/60, s.startMinute%60, s.endMinute/60, s.endMinute%60,
+		strings.Join(days, ","), s.location)
+}
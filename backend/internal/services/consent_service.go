@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// consentValidity is how long a consent grant stays valid before the user must re-confirm
+const consentValidity = 365 * 24 * time.Hour
+
+// ErrConsentNotFound is returned when a user has no active consent for an app
+var ErrConsentNotFound = errors.New("no active consent for application")
+
+// ConsentService manages consent records for app connections
+type ConsentService struct {
+	db *gorm.DB
+}
+
+// NewConsentService creates a new consent service
+func NewConsentService(db *gorm.DB) *ConsentService {
+	return &ConsentService{db: db}
+}
+
+// GrantConsent records that the user agreed to the listed data categories for an app.
+// Any earlier active grant for the same app is superseded.
+func (s *ConsentService) GrantConsent(userID uuid.UUID, appID string, dataCategories []string, ipAddress, userAgent string) (*models.ConsentRecord, error) {
+	categoriesJSON, err := json.Marshal(dataCategories)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode data categories: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(consentValidity)
+	record := models.ConsentRecord{
+		UserID:         userID,
+		AppID:          appID,
+		DataCategories: string(categoriesJSON),
+		LawfulBasis:    "consent",
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		GrantedAt:      now,
+		ExpiresAt:      &expiresAt,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ConsentRecord{}).
+			Where("user_id = ? AND app_id = ? AND revoked_at IS NULL", userID, appID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant consent: %w", err)
+	}
+
+	return &record, nil
+}
+
+// GetActiveConsent returns the user's current valid consent for an app
+func (s *ConsentService) GetActiveConsent(userID uuid.UUID, appID string) (*models.ConsentRecord, error) {
+	var record models.ConsentRecord
+	err := s.db.Where("user_id = ? AND app_id = ? AND revoked_at IS NULL", userID, appID).
+		Order("granted_at DESC").First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrConsentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consent: %w", err)
+	}
+
+	if !record.IsValid() {
+		return nil, ErrConsentNotFound
+	}
+
+	return &record, nil
+}
+
+// HasValidConsent reports whether the user currently consents to the app's data access
+func (s *ConsentService) HasValidConsent(userID uuid.UUID, appID string) (bool, error) {
+	_, err := s.GetActiveConsent(userID, appID)
+	if errors.Is(err, ErrConsentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetUserConsents lists a user's consent records, newest first.
+// Revoked and expired records are kept as evidence and only returned when includeInactive is set.
+func (s *ConsentService) GetUserConsents(userID uuid.UUID, includeInactive bool) ([]models.ConsentRecord, error) {
+	var records []models.ConsentRecord
+	query := s.db.Where("user_id = ?", userID)
+	if !includeInactive {
+		query = query.Where("revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	}
+
+	if err := query.Order("granted_at DESC").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user consents: %w", err)
+	}
+	return records, nil
+}
+
+// RevokeConsent withdraws the user's consent for an app
+func (s *ConsentService) RevokeConsent(userID uuid.UUID, appID string) error {
+	result := s.db.Model(&models.ConsentRecord{}).
+		Where("user_id = ? AND app_id = ? AND revoked_at IS NULL", userID, appID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke consent: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrConsentNotFound
+	}
+	return nil
+}
@@ -77,6 +77,10 @@ func InitializeDatabase() error {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	if err := TraceQueries(DB); err != nil {
+		log.Printf("⚠️ Warning: Queries will not be traced: %v", err)
+	}
+
 	// Configure connection pool
 	sqlDB, err := DB.DB()
 	if err != nil {
@@ -155,24 +159,7 @@ func getEnv(key, fallback string) string {
 func runMigrations() error {
 	log.Println("Running database migrations...")
 
-	err := DB.AutoMigrate(
-		&models.User{},
-		&models.Session{},
-		&models.AppToken{},
-		&models.AuditLog{},
-		&models.EmailVerification{},
-		&models.UserSettings{},
-		&models.MFASetup{},
-		&models.BackupCode{},
-		&models.AppConnection{},
-		&models.ConnectionHealthMetrics{},
-		&models.SecurityEvent{},
-		&models.TrustedDevice{},
-		&RiskAssessment{},
-		&RiskThresholds{},
-		&DeviceFingerprint{},
-		&WebAuthnCredential{},
-	)
+	err := migrateModels(DB)
 
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
@@ -199,6 +186,152 @@ func runMigrations() error {
 	return nil
 }
 
+// migrateModels creates or updates every table on a connection. Regional databases get the
+// same schema as the primary one.
+func migrateModels(db *gorm.DB) error {
+	prepareRiskAssessmentColumns(db)
+	prepareStatusColumns(db)
+	return db.AutoMigrate(
+		&models.User{},
+		&models.Session{},
+		&models.AppToken{},
+		&models.AuditLog{},
+		&models.EmailVerification{},
+		&models.UserSettings{},
+		&models.MFASetup{},
+		&models.BackupCode{},
+		&models.AppConnection{},
+		&models.ConnectionHealthMetrics{},
+		&models.SecurityEvent{},
+		&models.TrustedDevice{},
+		&models.ConsentRecord{},
+		&models.AppLaunchEvent{},
+		&models.LicenseAllocation{},
+		&models.WatchlistEntry{},
+		&models.InvestigationCase{},
+		&models.CaseLink{},
+		&models.CaseNote{},
+		&models.CaseEvidence{},
+		&models.CaseTask{},
+		&models.AppAccessSchedule{},
+		&models.AccessOverrideRequest{},
+		&models.AppSessionPolicy{},
+		&models.SAMLIdentityProvider{},
+		&models.SAMLRelyingParty{},
+		&models.DevicePosture{},
+		&models.DormantAccount{},
+		&models.RoleAssignment{},
+		&models.OIDCClient{},
+		&models.OIDCAuthorizationCode{},
+		&models.EmergencyLockdown{},
+		&models.ProviderSecret{},
+		&models.AuditExport{},
+		&models.AuditFileExport{},
+		&models.AuditExportSchedule{},
+		&models.WebhookDeadLetter{},
+		&models.WebhookConsumer{},
+		&models.WebhookSigningKey{},
+		&models.AdminNotification{},
+		&models.PostureScoreSnapshot{},
+		&models.JobLease{},
+		&models.ReportJob{},
+		&models.ReportJobLog{},
+		&models.AuditDailyRollup{},
+		&models.AuditVolumeBaseline{},
+		&models.SecurityAlertRecord{},
+		&models.SecurityActionExecution{},
+		&models.Playbook{},
+		&models.PlaybookExecution{},
+		&models.IntegrationHealthSample{},
+		&models.IntegrationHealthState{},
+		&models.ReplayCacheEntry{},
+		&models.AuthNonce{},
+		&models.OAuthState{},
+		&models.SlackAnalyst{},
+		&models.AlertLinkClick{},
+		&models.PushDevice{},
+		&models.IdPRiskSignal{},
+		&models.KeycloakEvent{},
+		&models.RadiusCredential{},
+		&models.RadiusChallenge{},
+		&models.Impersonation{},
+		&models.HeaderProxyApp{},
+		&models.HeaderProxyAssignment{},
+		&models.HeaderProxyRequestLog{},
+		&models.BookmarkApp{},
+		&models.BookmarkCredential{},
+		&models.ExtensionDomainReport{},
+		&models.DiscoveredApp{},
+		&models.DiscoveredAppGrant{},
+		&models.SigningKey{},
+		&models.ServiceAccount{},
+		&models.BootstrapRecord{},
+		&models.ConfigVersion{},
+		&models.LoginEvent{},
+		&models.LoginDispute{},
+		&models.PhishingResistantPolicy{},
+		&models.DetectionQuery{},
+		&models.DetectionQueryRun{},
+		&models.IPReputation{},
+		&models.CallbackFailure{},
+		&models.CallbackBlock{},
+		&models.CanaryKey{},
+		&models.CanaryKeyHit{},
+		&models.FileUpload{},
+		&RiskAssessment{},
+		&RiskThresholds{},
+		&DeviceFingerprint{},
+		&WebAuthnCredential{},
+	)
+}
+
+// prepareRiskAssessmentColumns clears the empty strings risk assessments used to store for
+// absent nested fields, which are not JSON, so Postgres can convert the columns to jsonb
+func prepareRiskAssessmentColumns(db *gorm.DB) {
+	if db.Dialector.Name() != "postgres" || !db.Migrator().HasTable(&RiskAssessment{}) {
+		return
+	}
+	for _, column := range []string{"location", "behavior_signals", "factors", "recommendations"} {
+		if err := db.Exec(fmt.Sprintf("UPDATE risk_assessments SET %s = NULL WHERE %s::text = ''", column, column)).Error; err != nil {
+			log.Printf("⚠️ Failed to clear empty risk assessment %s values: %v", column, err)
+		}
+	}
+}
+
+// statusColumns are the enum columns AutoMigrate adds check constraints to, with the value
+// rows holding anything else are moved to
+var statusColumns = []struct {
+	model    interface{}
+	table    string
+	column   string
+	values   []string
+	fallback string
+}{
+	{&models.AppConnection{}, "app_connections", "status", []string{"pending", "connected", "error", "revoked"}, "error"},
+	{&models.AppConnection{}, "app_connections", "health_status", []string{"healthy", "unknown", "warning", "error"}, "unknown"},
+	{&models.SecurityEvent{}, "security_events", "severity", []string{"low", "medium", "high", "critical"}, "medium"},
+	{&models.SecurityAlertRecord{}, "security_alert_records", "severity", []string{"low", "medium", "high", "critical"}, "medium"},
+	{&RiskAssessment{}, "risk_assessments", "risk_level", []string{"low", "medium", "high", "critical"}, "medium"},
+}
+
+// prepareStatusColumns lowercases the statuses rows were written with before they were typed
+// and moves any others to a fallback, so Postgres can add the check constraints
+func prepareStatusColumns(db *gorm.DB) {
+	if db.Dialector.Name() != "postgres" {
+		return
+	}
+	for _, c := range statusColumns {
+		if !db.Migrator().HasTable(c.model) {
+			continue
+		}
+		update := fmt.Sprintf("UPDATE %s SET %s = CASE WHEN lower(%s) IN ? THEN lower(%s) ELSE ? END WHERE %s NOT IN ?",
+			c.table, c.column, c.column, c.column, c.column)
+		if err := db.Exec(update, c.values, c.fallback, c.values).Error; err != nil {
+			log.Printf("⚠️ Failed to normalize %s.%s values: %v", c.table, c.column, err)
+		}
+	}
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
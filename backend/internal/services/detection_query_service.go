@@ -0,0 +1,549 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDetectionQueryNotFound is returned when a detection query does not exist
+	ErrDetectionQueryNotFound = errors.New("detection query not found")
+	// ErrDetectionQueryExists is returned when another detection query already has the name
+	ErrDetectionQueryExists = errors.New("detection query already exists")
+	// ErrInvalidDetectionQuery is returned for a definition that cannot be run
+	ErrInvalidDetectionQuery = errors.New("invalid detection query")
+)
+
+// Bounds on a detection query's window and schedule, which keep scheduled queries cheap
+const (
+	detectionMinInterval = time.Minute
+	detectionMaxWindow   = 31 * 24 * time.Hour
+	detectionMaxGroups   = 20
+)
+
+// detectionFields maps the audit log fields a detection query may filter and group on to
+// their columns. Only these columns ever reach the SQL.
+var detectionFields = map[string]string{
+	"action":      "action",
+	"resource":    "resource",
+	"resource_id": "resource_id",
+	"status":      "status",
+	"user_id":     "user_id",
+	"ip_address":  "ip_address",
+	"user_agent":  "user_agent",
+	"details":     "details",
+	"region":      "region",
+}
+
+var detectionOperators = map[string]bool{
+	"eq": true, "neq": true, "in": true, "not_in": true, "prefix": true, "contains": true,
+}
+
+// detectionParameter matches a ${name} placeholder in a filter value
+var detectionParameter = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// DetectionQueryDefinition is a detection query as written by an analyst. Filter values
+// may reference ${name} parameters, which take their defaults from Parameters and can be
+// overridden on a manual run.
+type DetectionQueryDefinition struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Enabled     *bool             `json:"enabled,omitempty"` // defaults to true
+	Filters     []DetectionFilter `json:"filters"`
+	GroupBy     string            `json:"group_by,omitempty"` // count per value of this field
+	Window      string            `json:"window"`             // e.g. "15m", counted back from each run
+	Interval    string            `json:"interval"`           // how often the query runs
+	Threshold   int64             `json:"threshold"`          // alert when a count reaches this
+	Severity    AlertSeverity     `json:"severity,omitempty"` // defaults to medium
+	Parameters  map[string]string `json:"parameters,omitempty"`
+}
+
+// DetectionFilter restricts one audit log field. "in" and "not_in" take Values, the
+// other operators Value.
+type DetectionFilter struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Value    string   `json:"value,omitempty"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// DetectionGroupCount is the number of matching events for one value of the group-by field
+type DetectionGroupCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// DetectionQueryDetail is a stored detection query together with its parsed definition
+type DetectionQueryDetail struct {
+	models.DetectionQuery
+	Definition DetectionQueryDefinition `json:"definition"`
+}
+
+// DetectionQueryRunDetail is a detection query run with its parameters and offending groups
+type DetectionQueryRunDetail struct {
+	models.DetectionQueryRun
+	Parameters map[string]string     `json:"parameters,omitempty"`
+	Groups     []DetectionGroupCount `json:"groups,omitempty"`
+}
+
+// Validate checks a definition can be run on a schedule
+func (d *DetectionQueryDefinition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDetectionQuery)
+	}
+	if d.Threshold < 1 {
+		return fmt.Errorf("%w: threshold must be at least 1", ErrInvalidDetectionQuery)
+	}
+	window, err := time.ParseDuration(d.Window)
+	if err != nil || window <= 0 || window > detectionMaxWindow {
+		return fmt.Errorf("%w: window must be a duration up to %s", ErrInvalidDetectionQuery, detectionMaxWindow)
+	}
+	interval, err := time.ParseDuration(d.Interval)
+	if err != nil || interval < detectionMinInterval {
+		return fmt.Errorf("%w: interval must be a duration of at least %s", ErrInvalidDetectionQuery, detectionMinInterval)
+	}
+	switch d.Severity {
+	case "", SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+	default:
+		return fmt.Errorf("%w: unknown severity %q", ErrInvalidDetectionQuery, d.Severity)
+	}
+	if d.GroupBy != "" {
+		if _, ok := detectionFields[d.GroupBy]; !ok {
+			return fmt.Errorf("%w: cannot group by %q", ErrInvalidDetectionQuery, d.GroupBy)
+		}
+	}
+
+	for i, filter := range d.Filters {
+		if _, ok := detectionFields[filter.Field]; !ok {
+			return fmt.Errorf("%w: filter %d: unknown field %q", ErrInvalidDetectionQuery, i+1, filter.Field)
+		}
+		if !detectionOperators[filter.Operator] {
+			return fmt.Errorf("%w: filter %d: unknown operator %q", ErrInvalidDetectionQuery, i+1, filter.Operator)
+		}
+		values := filter.Values
+		if filter.Operator == "in" || filter.Operator == "not_in" {
+			if len(values) == 0 {
+				return fmt.Errorf("%w: filter %d: %s needs values", ErrInvalidDetectionQuery, i+1, filter.Operator)
+			}
+		} else {
+			values = []string{filter.Value}
+		}
+		// Scheduled runs have no one to supply parameters, so each needs a default
+		for _, value := range values {
+			for _, match := range detectionParameter.FindAllStringSubmatch(value, -1) {
+				if _, ok := d.Parameters[match[1]]; !ok {
+					return fmt.Errorf("%w: filter %d: parameter %q has no default", ErrInvalidDetectionQuery, i+1, match[1])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DetectionQueryDefinition) window() time.Duration {
+	window, _ := time.ParseDuration(d.Window)
+	return window
+}
+
+func (d *DetectionQueryDefinition) interval() time.Duration {
+	interval, _ := time.ParseDuration(d.Interval)
+	return interval
+}
+
+// DetectionQueryService stores saved detection queries over the audit log, runs them on
+// their schedules and raises an alert when one crosses its threshold
+type DetectionQueryService struct {
+	db           *gorm.DB
+	security     *SecurityMonitoringService
+	guard        *QueryGuard
+	pollEvery    time.Duration
+	runRetention time.Duration
+}
+
+// NewDetectionQueryService creates a new detection query service. The security monitoring
+// service raises detection alerts and may be nil in tests.
+func NewDetectionQueryService(db *gorm.DB, security *SecurityMonitoringService) *DetectionQueryService {
+	return &DetectionQueryService{
+		db:           db,
+		security:     security,
+		guard:        NewQueryGuard(),
+		pollEvery:    envDuration("DETECTION_QUERY_POLL_INTERVAL", time.Minute),
+		runRetention: envDuration("DETECTION_QUERY_RUN_RETENTION", 30*24*time.Hour),
+	}
+}
+
+// Interval is how often due detection queries should be looked for
+func (s *DetectionQueryService) Interval() time.Duration {
+	return s.pollEvery
+}
+
+func detectionQueryFromDefinition(definition DetectionQueryDefinition) models.DetectionQuery {
+	encoded, _ := json.Marshal(definition)
+	return models.DetectionQuery{
+		Name:        definition.Name,
+		Description: definition.Description,
+		Enabled:     definition.Enabled == nil || *definition.Enabled,
+		Definition:  string(encoded),
+	}
+}
+
+func detectionQueryDetail(query models.DetectionQuery) DetectionQueryDetail {
+	detail := DetectionQueryDetail{DetectionQuery: query}
+	json.Unmarshal([]byte(query.Definition), &detail.Definition)
+	return detail
+}
+
+// ListQueries returns all detection queries by name
+func (s *DetectionQueryService) ListQueries() ([]DetectionQueryDetail, error) {
+	var queries []models.DetectionQuery
+	if err := s.db.Order("name ASC").Find(&queries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list detection queries: %w", err)
+	}
+	details := make([]DetectionQueryDetail, 0, len(queries))
+	for _, query := range queries {
+		details = append(details, detectionQueryDetail(query))
+	}
+	return details, nil
+}
+
+// GetQuery returns a detection query with its definition
+func (s *DetectionQueryService) GetQuery(queryID uuid.UUID) (*DetectionQueryDetail, error) {
+	var query models.DetectionQuery
+	if err := s.db.First(&query, "id = ?", queryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDetectionQueryNotFound
+		}
+		return nil, fmt.Errorf("failed to get detection query: %w", err)
+	}
+	detail := detectionQueryDetail(query)
+	return &detail, nil
+}
+
+// CreateQuery stores a new detection query; it first runs one interval from now
+func (s *DetectionQueryService) CreateQuery(definition DetectionQueryDefinition, createdBy *uuid.UUID, now time.Time) (*DetectionQueryDetail, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	var existing int64
+	if err := s.db.Model(&models.DetectionQuery{}).Where("name = ?", definition.Name).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check detection query name: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDetectionQueryExists, definition.Name)
+	}
+
+	query := detectionQueryFromDefinition(definition)
+	query.CreatedBy = createdBy
+	nextRunAt := now.Add(definition.interval())
+	query.NextRunAt = &nextRunAt
+	if err := s.db.Create(&query).Error; err != nil {
+		return nil, fmt.Errorf("failed to create detection query: %w", err)
+	}
+	recordConfigChange(ConfigKindRules, "detection_query:"+query.Name, createdBy, "Detection query created", definition)
+	detail := detectionQueryDetail(query)
+	return &detail, nil
+}
+
+// UpdateQuery replaces a detection query's definition and reschedules it
+func (s *DetectionQueryService) UpdateQuery(queryID uuid.UUID, definition DetectionQueryDefinition, actor *uuid.UUID, now time.Time) (*DetectionQueryDetail, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	var existing int64
+	if err := s.db.Model(&models.DetectionQuery{}).Where("name = ? AND id <> ?", definition.Name, queryID).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check detection query name: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDetectionQueryExists, definition.Name)
+	}
+
+	updated := detectionQueryFromDefinition(definition)
+	result := s.db.Model(&models.DetectionQuery{}).Where("id = ?", queryID).Updates(map[string]interface{}{
+		"name":        updated.Name,
+		"description": updated.Description,
+		"enabled":     updated.Enabled,
+		"definition":  updated.Definition,
+		"next_run_at": now.Add(definition.interval()),
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update detection query: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDetectionQueryNotFound
+	}
+	recordConfigChange(ConfigKindRules, "detection_query:"+updated.Name, actor, "Detection query updated", definition)
+	return s.GetQuery(queryID)
+}
+
+// DeleteQuery removes a detection query; its run history is kept
+func (s *DetectionQueryService) DeleteQuery(queryID uuid.UUID, actor *uuid.UUID) error {
+	var query models.DetectionQuery
+	if err := s.db.Select("name").First(&query, "id = ?", queryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDetectionQueryNotFound
+		}
+		return fmt.Errorf("failed to get detection query: %w", err)
+	}
+	result := s.db.Where("id = ?", queryID).Delete(&models.DetectionQuery{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete detection query: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDetectionQueryNotFound
+	}
+	recordConfigChange(ConfigKindRules, "detection_query:"+query.Name, actor, "Detection query deleted", nil)
+	return nil
+}
+
+// restoreQuery puts a detection query back to a recorded definition, recreating it when
+// it was deleted since
+func (s *DetectionQueryService) restoreQuery(name string, snapshot []byte, actor *uuid.UUID) error {
+	var definition DetectionQueryDefinition
+	if err := json.Unmarshal(snapshot, &definition); err != nil {
+		return fmt.Errorf("invalid detection query snapshot: %w", err)
+	}
+	var query models.DetectionQuery
+	err := s.db.Select("id").Where("name = ?", name).First(&query).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err = s.CreateQuery(definition, actor, time.Now())
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get detection query: %w", err)
+	}
+	_, err = s.UpdateQuery(query.ID, definition, actor, time.Now())
+	return err
+}
+
+// RunQuery runs a detection query now, with parameters overriding its defaults. Manual
+// runs are for trying a query out: they are kept in the run history but never raise an
+// alert or move the schedule.
+func (s *DetectionQueryService) RunQuery(queryID uuid.UUID, parameters map[string]string, now time.Time) (*DetectionQueryRunDetail, error) {
+	detail, err := s.GetQuery(queryID)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]string, len(detail.Definition.Parameters)+len(parameters))
+	for name, value := range detail.Definition.Parameters {
+		merged[name] = value
+	}
+	for name, value := range parameters {
+		merged[name] = value
+	}
+
+	run, groups := s.execute(detail, merged, models.DetectionRunManual, now)
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to record detection query run: %w", err)
+	}
+	return &DetectionQueryRunDetail{DetectionQueryRun: *run, Parameters: merged, Groups: groups}, nil
+}
+
+// EvaluateDue runs every enabled detection query whose next run is due and raises an
+// alert for each that crossed its threshold. A query that keeps matching alerts again
+// only once its window has moved past the events of the last alert. It returns the
+// number of alerts raised.
+func (s *DetectionQueryService) EvaluateDue(now time.Time) (int, error) {
+	var queries []models.DetectionQuery
+	if err := s.db.Where("enabled = ? AND (next_run_at IS NULL OR next_run_at <= ?)", true, now).
+		Order("next_run_at ASC").Find(&queries).Error; err != nil {
+		return 0, fmt.Errorf("failed to find due detection queries: %w", err)
+	}
+
+	raised := 0
+	for _, query := range queries {
+		detail := detectionQueryDetail(query)
+		run, groups := s.execute(&detail, detail.Definition.Parameters, models.DetectionRunScheduled, now)
+
+		updates := map[string]interface{}{
+			"last_run_at": now,
+			"next_run_at": now.Add(detail.Definition.interval()),
+		}
+		if run.Triggered && (query.LastAlertAt == nil || now.Sub(*query.LastAlertAt) >= detail.Definition.window()) {
+			alert, err := s.raiseAlert(&detail, run, groups)
+			if err != nil {
+				log.Printf("⚠️ Failed to raise detection alert for %s: %v", query.Name, err)
+			} else {
+				if alert != nil {
+					run.AlertID = &alert.ID
+				}
+				updates["last_alert_at"] = now
+				raised++
+			}
+		}
+
+		if err := s.db.Create(run).Error; err != nil {
+			log.Printf("⚠️ Failed to record run of detection query %s: %v", query.Name, err)
+		}
+		if err := s.db.Model(&models.DetectionQuery{}).Where("id = ?", query.ID).Updates(updates).Error; err != nil {
+			return raised, fmt.Errorf("failed to reschedule detection query %s: %w", query.Name, err)
+		}
+	}
+
+	if err := s.db.Where("created_at < ?", now.Add(-s.runRetention)).Delete(&models.DetectionQueryRun{}).Error; err != nil {
+		log.Printf("⚠️ Failed to prune detection query runs: %v", err)
+	}
+	return raised, nil
+}
+
+// ListRuns returns a detection query's runs, newest first, and the total number of runs
+func (s *DetectionQueryService) ListRuns(queryID uuid.UUID, limit, offset int) ([]DetectionQueryRunDetail, int64, error) {
+	var total int64
+	if err := s.db.Model(&models.DetectionQueryRun{}).Where("query_id = ?", queryID).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count detection query runs: %w", err)
+	}
+
+	var runs []models.DetectionQueryRun
+	if err := s.db.Where("query_id = ?", queryID).Order("created_at DESC").
+		Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list detection query runs: %w", err)
+	}
+
+	details := make([]DetectionQueryRunDetail, 0, len(runs))
+	for _, run := range runs {
+		detail := DetectionQueryRunDetail{DetectionQueryRun: run}
+		if run.Parameters != "" {
+			json.Unmarshal([]byte(run.Parameters), &detail.Parameters)
+		}
+		if run.Groups != "" {
+			json.Unmarshal([]byte(run.Groups), &detail.Groups)
+		}
+		details = append(details, detail)
+	}
+	return details, total, nil
+}
+
+// execute counts the query's matches over its window ending now. Failures are recorded
+// on the run rather than returned, so they show up in the run history.
+func (s *DetectionQueryService) execute(detail *DetectionQueryDetail, parameters map[string]string, trigger string, now time.Time) (*models.DetectionQueryRun, []DetectionGroupCount) {
+	definition := detail.Definition
+	run := &models.DetectionQueryRun{
+		QueryID:     detail.ID,
+		QueryName:   detail.Name,
+		Trigger:     trigger,
+		WindowStart: now.Add(-definition.window()),
+		WindowEnd:   now,
+	}
+	if len(parameters) > 0 {
+		encoded, _ := json.Marshal(parameters)
+		run.Parameters = string(encoded)
+	}
+
+	var groups []DetectionGroupCount
+	started := time.Now()
+	err := s.guard.Run(context.Background(), s.db, "detection_query", false, func(tx *gorm.DB) error {
+		scope := tx.Model(&models.AuditLog{}).Where("created_at >= ? AND created_at < ?", run.WindowStart, run.WindowEnd)
+		for _, filter := range definition.Filters {
+			scope = applyDetectionFilter(scope, filter, parameters)
+		}
+		scope = scope.Session(&gorm.Session{})
+
+		if err := scope.Count(&run.MatchCount).Error; err != nil {
+			return fmt.Errorf("failed to count matches: %w", err)
+		}
+		if definition.GroupBy == "" {
+			return nil
+		}
+		column := detectionFields[definition.GroupBy]
+		return scope.Select("COALESCE("+column+", '') AS value, COUNT(*) AS count").
+			Group(column).Having("COUNT(*) >= ?", definition.Threshold).
+			Order("count DESC").Limit(detectionMaxGroups).Scan(&groups).Error
+	})
+	run.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		run.Error = err.Error()
+		return run, nil
+	}
+
+	if definition.GroupBy == "" {
+		run.Triggered = run.MatchCount >= definition.Threshold
+	} else {
+		run.Triggered = len(groups) > 0
+		encoded, _ := json.Marshal(groups)
+		run.Groups = string(encoded)
+	}
+	return run, groups
+}
+
+// applyDetectionFilter adds one filter, with its parameters substituted, to a query.
+// Fields come from detectionFields, so only values are user supplied.
+func applyDetectionFilter(scope *gorm.DB, filter DetectionFilter, parameters map[string]string) *gorm.DB {
+	column := detectionFields[filter.Field]
+	value := substituteDetectionParameters(filter.Value, parameters)
+	values := make([]string, len(filter.Values))
+	for i, v := range filter.Values {
+		values[i] = substituteDetectionParameters(v, parameters)
+	}
+
+	switch filter.Operator {
+	case "eq":
+		return scope.Where(column+" = ?", value)
+	case "neq":
+		return scope.Where("COALESCE("+column+", '') <> ?", value)
+	case "in":
+		return scope.Where(column+" IN ?", values)
+	case "not_in":
+		return scope.Where("COALESCE("+column+", '') NOT IN ?", values)
+	case "prefix":
+		return scope.Where(column+` LIKE ? ESCAPE '\'`, likeEscaper.Replace(value)+"%")
+	case "contains":
+		return scope.Where(column+` LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(value)+"%")
+	}
+	return scope
+}
+
+// likeEscaper makes LIKE wildcards in a filter value match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func substituteDetectionParameters(value string, parameters map[string]string) string {
+	return detectionParameter.ReplaceAllStringFunc(value, func(placeholder string) string {
+		return parameters[detectionParameter.FindStringSubmatch(placeholder)[1]]
+	})
+}
+
+func (s *DetectionQueryService) raiseAlert(detail *DetectionQueryDetail, run *models.DetectionQueryRun, groups []DetectionGroupCount) (*SecurityAlert, error) {
+	if s.security == nil {
+		return nil, nil
+	}
+	definition := detail.Definition
+	severity := definition.Severity
+	if severity == "" {
+		severity = SeverityMedium
+	}
+
+	description := fmt.Sprintf("%d matching audit events in the last %s (threshold %d)", run.MatchCount, definition.Window, definition.Threshold)
+	if definition.GroupBy != "" {
+		offenders := make([]string, 0, len(groups))
+		for _, group := range groups {
+			offenders = append(offenders, fmt.Sprintf("%s (%d)", group.Value, group.Count))
+		}
+		description = fmt.Sprintf("%d %s value(s) reached %d matching audit events in the last %s: %s",
+			len(groups), definition.GroupBy, definition.Threshold, definition.Window, strings.Join(offenders, ", "))
+	}
+
+	return s.security.GenerateAlert(
+		AlertTypeDetectionQuery,
+		severity,
+		"Detection query matched: "+detail.Name,
+		description,
+		map[string]interface{}{
+			"detection_query_id": detail.ID.String(),
+			"query_name":         detail.Name,
+			"match_count":        run.MatchCount,
+			"threshold":          definition.Threshold,
+			"window":             definition.Window,
+			"group_by":           definition.GroupBy,
+			"groups":             groups,
+		},
+	)
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidPosture is returned for an attestation that is malformed or names an unknown user
+	ErrInvalidPosture = errors.New("invalid device posture attestation")
+	// ErrPostureWebhookNotConfigured is returned when an MDM's webhook secret is not set
+	ErrPostureWebhookNotConfigured = errors.New("MDM posture webhook not configured")
+	// ErrPostureWebhookUnauthorized is returned when an MDM webhook carries the wrong secret
+	ErrPostureWebhookUnauthorized = errors.New("MDM posture webhook secret mismatch")
+)
+
+// PostureAttestation is one device's posture as reported by the agent or an MDM. Checks
+// the reporter does not cover are left nil.
+type PostureAttestation struct {
+	DeviceID      string     `json:"device_id"`
+	UserID        *uuid.UUID `json:"user_id,omitempty"`
+	Email         string     `json:"email,omitempty"`
+	DeviceName    string     `json:"device_name,omitempty"`
+	Platform      string     `json:"platform,omitempty"`
+	OSVersion     string     `json:"os_version,omitempty"`
+	DiskEncrypted *bool      `json:"disk_encrypted,omitempty"`
+	EDRRunning    *bool      `json:"edr_running,omitempty"`
+	MDMCompliant  *bool      `json:"mdm_compliant,omitempty"`
+	Source        string     `json:"-"`
+}
+
+// DeviceCompliance is whether a device met the posture requirements when checked
+type DeviceCompliance struct {
+	Compliant bool                  `json:"compliant"`
+	Issues    []string              `json:"issues,omitempty"`
+	Posture   *models.DevicePosture `json:"posture,omitempty"` // nil when the device never reported
+}
+
+// DevicePostureService stores device posture attestations from the CloudGate agent and
+// from Intune and Jamf, and decides which devices are compliant: disk encrypted, EDR
+// running when DEVICE_REQUIRE_EDR is true, an OS at least the version DEVICE_MIN_OS_VERSIONS
+// sets for its platform, not flagged by its MDM, and reported within DEVICE_POSTURE_MAX_AGE.
+type DevicePostureService struct {
+	db            *gorm.DB
+	requireEDR    bool
+	minOSVersions map[string]string
+	maxAge        time.Duration
+	secrets       map[string]string
+}
+
+// NewDevicePostureService creates a device posture service configured from the environment
+func NewDevicePostureService(db *gorm.DB) *DevicePostureService {
+	s := &DevicePostureService{
+		db:            db,
+		requireEDR:    getEnv("DEVICE_REQUIRE_EDR", "true") == "true",
+		minOSVersions: make(map[string]string),
+		maxAge:        envDuration("DEVICE_POSTURE_MAX_AGE", 24*time.Hour),
+		secrets: map[string]string{
+			models.PostureSourceIntune: os.Getenv("INTUNE_POSTURE_WEBHOOK_SECRET"),
+			models.PostureSourceJamf:   os.Getenv("JAMF_POSTURE_WEBHOOK_SECRET"),
+		},
+	}
+	for _, entry := range strings.Split(os.Getenv("DEVICE_MIN_OS_VERSIONS"), ",") {
+		platform, version, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		s.minOSVersions[normalizePlatform(platform)] = strings.TrimSpace(version)
+	}
+	return s
+}
+
+// VerifyWebhook checks an MDM webhook's bearer token against the secret configured for it
+func (s *DevicePostureService) VerifyWebhook(source, authorization string) error {
+	secret := s.secrets[source]
+	if secret == "" {
+		return ErrPostureWebhookNotConfigured
+	}
+	token, _ := strings.CutPrefix(authorization, "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return ErrPostureWebhookUnauthorized
+	}
+	return nil
+}
+
+// RecordAttestation merges an attestation into the device's posture and re-evaluates it
+func (s *DevicePostureService) RecordAttestation(attestation PostureAttestation, now time.Time) (*models.DevicePosture, error) {
+	attestation.DeviceID = strings.TrimSpace(attestation.DeviceID)
+	if attestation.DeviceID == "" {
+		return nil, fmt.Errorf("%w: device_id is required", ErrInvalidPosture)
+	}
+	userID, err := s.resolveUser(attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	var posture models.DevicePosture
+	err = s.db.Where("user_id = ? AND device_id = ?", userID, attestation.DeviceID).First(&posture).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get device posture: %w", err)
+	}
+	wasCompliant := posture.ID != uuid.Nil && posture.Compliant
+
+	posture.UserID = userID
+	posture.DeviceID = attestation.DeviceID
+	posture.Source = attestation.Source
+	posture.AttestedAt = now
+	if attestation.DeviceName != "" {
+		posture.DeviceName = attestation.DeviceName
+	}
+	if attestation.Platform != "" {
+		posture.Platform = normalizePlatform(attestation.Platform)
+	}
+	if attestation.OSVersion != "" {
+		posture.OSVersion = attestation.OSVersion
+	}
+	if attestation.DiskEncrypted != nil {
+		posture.DiskEncrypted = attestation.DiskEncrypted
+	}
+	if attestation.EDRRunning != nil {
+		posture.EDRRunning = attestation.EDRRunning
+	}
+	if attestation.MDMCompliant != nil {
+		posture.MDMCompliant = attestation.MDMCompliant
+	}
+	issues := s.evaluate(&posture)
+	posture.Compliant = len(issues) == 0
+	posture.Issues = strings.Join(issues, "; ")
+
+	if err := s.db.Save(&posture).Error; err != nil {
+		return nil, fmt.Errorf("failed to save device posture: %w", err)
+	}
+	if wasCompliant && !posture.Compliant {
+		log.Printf("⚠️ Device %s of user %s is no longer compliant: %s", posture.DeviceID, posture.UserID, posture.Issues)
+	}
+	return &posture, nil
+}
+
+// ParseIntuneDevices reads Intune managed devices as returned by Microsoft Graph, either a
+// single managedDevice or a collection under "value"
+func ParseIntuneDevices(body []byte) ([]PostureAttestation, error) {
+	type managedDevice struct {
+		ID                         string `json:"id"`
+		AzureADDeviceID            string `json:"azureADDeviceId"`
+		DeviceName                 string `json:"deviceName"`
+		UserPrincipalName          string `json:"userPrincipalName"`
+		EmailAddress               string `json:"emailAddress"`
+		OperatingSystem            string `json:"operatingSystem"`
+		OSVersion                  string `json:"osVersion"`
+		IsEncrypted                *bool  `json:"isEncrypted"`
+		ComplianceState            string `json:"complianceState"`
+		PartnerReportedThreatState string `json:"partnerReportedThreatState"`
+	}
+	var collection struct {
+		Value []managedDevice `json:"value"`
+	}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPosture, err)
+	}
+	if collection.Value == nil {
+		var device managedDevice
+		if err := json.Unmarshal(body, &device); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPosture, err)
+		}
+		collection.Value = []managedDevice{device}
+	}
+
+	attestations := make([]PostureAttestation, 0, len(collection.Value))
+	for _, device := range collection.Value {
+		attestation := PostureAttestation{
+			DeviceID:      device.AzureADDeviceID,
+			Email:         device.EmailAddress,
+			DeviceName:    device.DeviceName,
+			Platform:      device.OperatingSystem,
+			OSVersion:     device.OSVersion,
+			DiskEncrypted: device.IsEncrypted,
+			Source:        models.PostureSourceIntune,
+		}
+		if attestation.DeviceID == "" || attestation.DeviceID == uuid.Nil.String() {
+			attestation.DeviceID = device.ID
+		}
+		if attestation.Email == "" {
+			attestation.Email = device.UserPrincipalName
+		}
+		switch device.ComplianceState {
+		case "compliant":
+			attestation.MDMCompliant = boolPtr(true)
+		case "noncompliant", "conflict", "error":
+			attestation.MDMCompliant = boolPtr(false)
+		}
+		// The Mobile Threat Defense partner reports whether its agent is active
+		switch device.PartnerReportedThreatState {
+		case "activated", "secured", "lowSeverity", "mediumSeverity", "highSeverity", "compromised":
+			attestation.EDRRunning = boolPtr(true)
+		case "deactivated", "unresponsive", "misconfigured":
+			attestation.EDRRunning = boolPtr(false)
+		}
+		attestations = append(attestations, attestation)
+	}
+	return attestations, nil
+}
+
+// ParseJamfComputer reads a Jamf Pro computer inventory record, as returned by its
+// computers-inventory-detail API. Jamf inventory has no EDR state, which the agent reports.
+func ParseJamfComputer(body []byte) ([]PostureAttestation, error) {
+	var computer struct {
+		UDID    string `json:"udid"`
+		General struct {
+			Name string `json:"name"`
+		} `json:"general"`
+		UserAndLocation struct {
+			Email string `json:"email"`
+		} `json:"userAndLocation"`
+		OperatingSystem struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"operatingSystem"`
+		DiskEncryption struct {
+			BootPartitionEncryptionDetails struct {
+				PartitionFileVault2State string `json:"partitionFileVault2State"`
+			} `json:"bootPartitionEncryptionDetails"`
+		} `json:"diskEncryption"`
+	}
+	if err := json.Unmarshal(body, &computer); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPosture, err)
+	}
+
+	attestation := PostureAttestation{
+		DeviceID:   computer.UDID,
+		Email:      computer.UserAndLocation.Email,
+		DeviceName: computer.General.Name,
+		Platform:   computer.OperatingSystem.Name,
+		OSVersion:  computer.OperatingSystem.Version,
+		Source:     models.PostureSourceJamf,
+	}
+	if attestation.Platform == "" {
+		attestation.Platform = "macos"
+	}
+	if state := computer.DiskEncryption.BootPartitionEncryptionDetails.PartitionFileVault2State; state != "" {
+		attestation.DiskEncrypted = boolPtr(state == "ENCRYPTED")
+	}
+	return []PostureAttestation{attestation}, nil
+}
+
+// CheckCompliance reports whether the user's device met the posture requirements at now
+func (s *DevicePostureService) CheckCompliance(userID uuid.UUID, deviceID string, now time.Time) (*DeviceCompliance, error) {
+	if deviceID == "" {
+		return &DeviceCompliance{Issues: []string{"device not identified"}}, nil
+	}
+	var posture models.DevicePosture
+	err := s.db.Where("user_id = ? AND device_id = ?", userID, deviceID).First(&posture).Error
+	if err == gorm.ErrRecordNotFound {
+		return &DeviceCompliance{Issues: []string{"no posture reported for this device"}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device posture: %w", err)
+	}
+
+	compliance := &DeviceCompliance{Compliant: posture.Compliant, Posture: &posture}
+	if posture.Issues != "" {
+		compliance.Issues = strings.Split(posture.Issues, "; ")
+	}
+	if now.Sub(posture.AttestedAt) > s.maxAge {
+		compliance.Compliant = false
+		compliance.Issues = append(compliance.Issues, fmt.Sprintf("posture last reported %s", posture.AttestedAt.UTC().Format(time.RFC3339)))
+	}
+	return compliance, nil
+}
+
+// ListPostures returns reported device postures, newest first, for one user or everyone
+func (s *DevicePostureService) ListPostures(userID *uuid.UUID, compliant *bool) ([]models.DevicePosture, error) {
+	query := s.db.Order("attested_at DESC")
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if compliant != nil {
+		query = query.Where("compliant = ?", *compliant)
+	}
+	var postures []models.DevicePosture
+	if err := query.Find(&postures).Error; err != nil {
+		return nil, fmt.Errorf("failed to list device postures: %w", err)
+	}
+	return postures, nil
+}
+
+// evaluate lists the reasons a device is not compliant
+func (s *DevicePostureService) evaluate(posture *models.DevicePosture) []string {
+	var issues []string
+	switch {
+	case posture.DiskEncrypted == nil:
+		issues = append(issues, "disk encryption not reported")
+	case !*posture.DiskEncrypted:
+		issues = append(issues, "disk not encrypted")
+	}
+	if s.requireEDR {
+		switch {
+		case posture.EDRRunning == nil:
+			issues = append(issues, "EDR not reported")
+		case !*posture.EDRRunning:
+			issues = append(issues, "EDR not running")
+		}
+	}
+	if minimum := s.minOSVersions[posture.Platform]; minimum != "" {
+		switch {
+		case posture.OSVersion == "":
+			issues = append(issues, "OS version not reported")
+		case compareVersions(posture.OSVersion, minimum) < 0:
+			issues = append(issues, fmt.Sprintf("OS version %s is older than %s", posture.OSVersion, minimum))
+		}
+	}
+	if posture.MDMCompliant != nil && !*posture.MDMCompliant {
+		issues = append(issues, "marked non-compliant by MDM")
+	}
+	return issues
+}
+
+func (s *DevicePostureService) resolveUser(attestation PostureAttestation) (uuid.UUID, error) {
+	var user models.User
+	query := s.db.Select("id")
+	switch {
+	case attestation.UserID != nil:
+		query = query.Where("id = ?", *attestation.UserID)
+	case attestation.Email != "":
+		query = query.Where("LOWER(email) = ?", strings.ToLower(attestation.Email))
+	default:
+		return uuid.Nil, fmt.Errorf("%w: user_id or email is required", ErrInvalidPosture)
+	}
+	err := query.First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		return uuid.Nil, fmt.Errorf("%w: unknown user for device %s", ErrInvalidPosture, attestation.DeviceID)
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	return user.ID, nil
+}
+
+// normalizePlatform maps the operating system names agents and MDMs use to one per platform
+func normalizePlatform(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case strings.HasPrefix(name, "windows"):
+		return "windows"
+	case strings.HasPrefix(name, "mac"), name == "osx", name == "os x":
+		return "macos"
+	case name == "ios", name == "ipados":
+		return "ios"
+	default:
+		return name
+	}
+}
+
+// compareVersions compares dotted version numbers numerically, treating missing parts as 0
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.TrimSpace(as[i]))
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.TrimSpace(bs[i]))
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+var devicePostureService *DevicePostureService
+
+// SetDevicePostureService makes device posture count towards sign-in device risk
+func SetDevicePostureService(s *DevicePostureService) {
+	devicePostureService = s
+}
+
+// deviceCompliance returns a reported device's compliance, or nil when posture is not
+// tracked or the device never reported
+func deviceCompliance(userID uuid.UUID, deviceID string) *DeviceCompliance {
+	if devicePostureService == nil || deviceID == "" {
+		return nil
+	}
+	compliance, err := devicePostureService.CheckCompliance(userID, deviceID, time.Now())
+	if err != nil {
+		log.Printf("Failed to check device posture: %v", err)
+		return nil
+	}
+	if compliance.Posture == nil {
+		return nil
+	}
+	return compliance
+}
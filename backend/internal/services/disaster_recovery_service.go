@@ -0,0 +1,312 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// disasterRecovery is the process-wide DR mode switch. It is set by SetDisasterRecoveryService;
+// when nil DR mode is never active.
+var disasterRecovery *DisasterRecoveryService
+
+const (
+	drQueueAuditLog            = "audit_log"
+	drQueueAuditEvent          = "audit_event"
+	drQueueSessionInvalidation = "session_invalidation"
+)
+
+// drQueueEntry is one write deferred while in DR mode, stored as a JSON line
+type drQueueEntry struct {
+	Kind         string           `json:"kind"`
+	QueuedAt     time.Time        `json:"queued_at"`
+	AuditLog     *models.AuditLog `json:"audit_log,omitempty"`
+	AuditEvent   *AuditEvent      `json:"audit_event,omitempty"`
+	SessionToken string           `json:"session_token,omitempty"`
+}
+
+// DisasterRecoveryStatus describes the DR mode state of this instance
+type DisasterRecoveryStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Since     *time.Time `json:"since,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	QueuedOps int        `json:"queued_ops"`
+	QueueFile string     `json:"queue_file"`
+}
+
+// DisasterRecoveryService runs CloudGate read-only while its database is a replica during
+// a failover. Sign-in and app launches keep working from the replicated data, configuration
+// changes are refused, and audit entries and logouts are queued in a local file
+// (DR_QUEUE_FILE) to be replayed once the primary database is writable again. The queue is
+// per instance.
+type DisasterRecoveryService struct {
+	db        *gorm.DB
+	queueFile string
+
+	mu        sync.Mutex
+	enabled   bool
+	since     *time.Time
+	reason    string
+	queued    int
+	loggedOut map[string]struct{}
+}
+
+// NewDisasterRecoveryService creates a new disaster recovery service, in DR mode when DR_MODE is true
+func NewDisasterRecoveryService(db *gorm.DB) *DisasterRecoveryService {
+	s := &DisasterRecoveryService{
+		db:        db,
+		queueFile: getEnv("DR_QUEUE_FILE", "cloudgate-dr-queue.jsonl"),
+		loggedOut: make(map[string]struct{}),
+	}
+	s.queued = s.countQueued()
+	if getEnv("DR_MODE", "false") == "true" {
+		now := time.Now()
+		s.enabled = true
+		s.since = &now
+		s.reason = "DR_MODE is set"
+		log.Printf("🛟 Disaster recovery mode: configuration changes are blocked and audit writes are queued")
+	}
+	return s
+}
+
+// SetDisasterRecoveryService installs the DR mode switch consulted by audit logging and sign-in
+func SetDisasterRecoveryService(s *DisasterRecoveryService) {
+	disasterRecovery = s
+}
+
+// DisasterRecoveryActive reports whether this instance is in DR mode
+func DisasterRecoveryActive() bool {
+	return disasterRecovery != nil && disasterRecovery.Enabled()
+}
+
+// Enabled reports whether DR mode is on
+func (s *DisasterRecoveryService) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabled
+}
+
+// Status returns the DR mode state and the number of queued writes
+func (s *DisasterRecoveryService) Status() DisasterRecoveryStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return DisasterRecoveryStatus{
+		Enabled:   s.enabled,
+		Since:     s.since,
+		Reason:    s.reason,
+		QueuedOps: s.queued,
+		QueueFile: s.queueFile,
+	}
+}
+
+// Enable switches DR mode on
+func (s *DisasterRecoveryService) Enable(reason string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enabled {
+		return
+	}
+	s.enabled = true
+	s.since = &now
+	s.reason = reason
+	log.Printf("🛟 Disaster recovery mode enabled: %s", reason)
+}
+
+// Disable switches DR mode off and replays the queued writes against the primary database
+func (s *DisasterRecoveryService) Disable() (int, error) {
+	s.mu.Lock()
+	s.enabled = false
+	s.since = nil
+	s.reason = ""
+	s.mu.Unlock()
+
+	log.Printf("🛟 Disaster recovery mode disabled")
+	return s.Replay()
+}
+
+// QueueAuditLog defers an audit log entry until the primary database is writable
+func (s *DisasterRecoveryService) QueueAuditLog(entry models.AuditLog) error {
+	return s.enqueue(drQueueEntry{Kind: drQueueAuditLog, AuditLog: &entry})
+}
+
+// QueueAuditEvent defers an audit event until the primary database is writable
+func (s *DisasterRecoveryService) QueueAuditEvent(event AuditEvent) error {
+	return s.enqueue(drQueueEntry{Kind: drQueueAuditEvent, AuditEvent: &event})
+}
+
+// QueueLogout ends a session on this instance now and invalidates it in the database on replay
+func (s *DisasterRecoveryService) QueueLogout(sessionToken string) error {
+	s.mu.Lock()
+	s.loggedOut[sessionToken] = struct{}{}
+	s.mu.Unlock()
+	return s.enqueue(drQueueEntry{Kind: drQueueSessionInvalidation, SessionToken: sessionToken})
+}
+
+// LoggedOut reports whether a session was logged out during DR mode and not yet replayed
+func (s *DisasterRecoveryService) LoggedOut(sessionToken string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.loggedOut[sessionToken]
+	return ok
+}
+
+// Replay writes the queued entries to the database. Entries that fail stay queued, so
+// replay can be retried.
+func (s *DisasterRecoveryService) Replay() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enabled {
+		return 0, nil
+	}
+
+	entries, err := s.readQueue()
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	var failed []drQueueEntry
+	replayed := 0
+	for _, entry := range entries {
+		if err := s.apply(entry); err != nil {
+			log.Printf("Failed to replay queued %s: %v", entry.Kind, err)
+			failed = append(failed, entry)
+			continue
+		}
+		if entry.Kind == drQueueSessionInvalidation {
+			delete(s.loggedOut, entry.SessionToken)
+		}
+		replayed++
+	}
+
+	if err := s.writeQueue(failed); err != nil {
+		return replayed, err
+	}
+	s.queued = len(failed)
+	if replayed > 0 {
+		log.Printf("🛟 Replayed %d queued write(s) from disaster recovery mode", replayed)
+	}
+	if len(failed) > 0 {
+		return replayed, fmt.Errorf("%d queued write(s) could not be replayed", len(failed))
+	}
+	return replayed, nil
+}
+
+func (s *DisasterRecoveryService) apply(entry drQueueEntry) error {
+	switch entry.Kind {
+	case drQueueAuditLog:
+		if entry.AuditLog == nil {
+			return nil
+		}
+		return auditDB(context.Background(), entry.AuditLog.UserID, s.db).Create(entry.AuditLog).Error
+	case drQueueAuditEvent:
+		if entry.AuditEvent == nil {
+			return nil
+		}
+		return auditDB(context.Background(), entry.AuditEvent.UserID, s.db).Create(entry.AuditEvent).Error
+	case drQueueSessionInvalidation:
+		return s.db.Model(&models.Session{}).Where("session_token = ?", entry.SessionToken).Update("is_active", false).Error
+	default:
+		return fmt.Errorf("unknown queued write %q", entry.Kind)
+	}
+}
+
+func (s *DisasterRecoveryService) enqueue(entry drQueueEntry) error {
+	entry.QueuedAt = time.Now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued write: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.queueFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open DR queue: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to queue write: %w", err)
+	}
+	s.queued++
+	return nil
+}
+
+func (s *DisasterRecoveryService) readQueue() ([]drQueueEntry, error) {
+	file, err := os.Open(s.queueFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DR queue: %w", err)
+	}
+	defer file.Close()
+
+	var entries []drQueueEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry drQueueEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Skipping unreadable DR queue entry: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read DR queue: %w", err)
+	}
+	return entries, nil
+}
+
+func (s *DisasterRecoveryService) writeQueue(entries []drQueueEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(s.queueFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear DR queue: %w", err)
+		}
+		return nil
+	}
+
+	tmp := s.queueFile + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite DR queue: %w", err)
+	}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to encode queued write: %w", err)
+		}
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to rewrite DR queue: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to rewrite DR queue: %w", err)
+	}
+	return os.Rename(tmp, s.queueFile)
+}
+
+func (s *DisasterRecoveryService) countQueued() int {
+	entries, err := s.readQueue()
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	return len(entries)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultRefreshPause is how long token refresh stays paused after an emergency sign-out
+	DefaultRefreshPause = time.Hour
+
+	lockdownCacheTTL = 15 * time.Second
+)
+
+var (
+	// ErrLockdownNotFound is returned when a lockdown does not exist or was already lifted
+	ErrLockdownNotFound = errors.New("active lockdown not found")
+	// ErrInvalidLockdownScope is returned for an unknown scope or a domain scope without a domain
+	ErrInvalidLockdownScope = errors.New("invalid lockdown scope")
+)
+
+// EmergencySignoutInput describes an emergency sign-out request
+type EmergencySignoutInput struct {
+	Scope        string
+	Domain       string
+	Reason       string
+	RequireMFA   bool
+	RefreshPause time.Duration
+}
+
+// EmergencyService runs the emergency sign-out ("panic button") for credential leaks or IdP compromise
+type EmergencyService struct {
+	db            *gorm.DB
+	security      *SecurityMonitoringService
+	cache         []models.EmergencyLockdown
+	cacheLoadedAt time.Time
+	mutex         sync.RWMutex
+}
+
+// NewEmergencyService creates a new emergency service. The security monitoring
+// service is used to open the critical incident and may be nil in tests.
+func NewEmergencyService(db *gorm.DB, security *SecurityMonitoringService) *EmergencyService {
+	return &EmergencyService{db: db, security: security}
+}
+
+// TriggerSignout revokes every session in scope, records the lockdown that forces
+// re-authentication and pauses refresh, and opens a critical incident.
+func (s *EmergencyService) TriggerSignout(input EmergencySignoutInput, actor *uuid.UUID) (*models.EmergencyLockdown, error) {
+	input.Domain = strings.ToLower(strings.TrimSpace(input.Domain))
+	switch input.Scope {
+	case models.LockdownScopeGlobal:
+		input.Domain = ""
+	case models.LockdownScopeDomain:
+		if input.Domain == "" {
+			return nil, fmt.Errorf("%w: domain scope needs a domain", ErrInvalidLockdownScope)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidLockdownScope, input.Scope)
+	}
+	if input.RefreshPause <= 0 {
+		input.RefreshPause = DefaultRefreshPause
+	}
+
+	now := time.Now()
+	refreshPausedUntil := now.Add(input.RefreshPause)
+	lockdown := models.EmergencyLockdown{
+		Scope:              input.Scope,
+		Domain:             input.Domain,
+		Reason:             input.Reason,
+		RequireMFA:         input.RequireMFA,
+		RefreshPausedUntil: &refreshPausedUntil,
+		TriggeredBy:        actor,
+		TriggeredAt:        now,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		revoke := tx.Model(&models.Session{}).Where("is_active = ?", true)
+		if input.Scope == models.LockdownScopeDomain {
+			revoke = revoke.Where("user_id IN (?)", tx.Model(&models.User{}).Select("id").Where("LOWER(email) LIKE ?", "%@"+input.Domain))
+		}
+		result := revoke.Update("is_active", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		lockdown.SessionsRevoked = result.RowsAffected
+		return tx.Create(&lockdown).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to trigger emergency sign-out: %w", err)
+	}
+	s.invalidateCache()
+
+	if s.security != nil {
+		incident, err := s.security.CreateIncident(
+			"Emergency sign-out triggered",
+			fmt.Sprintf("%s sign-out (%s): %d sessions revoked. Reason: %s", lockdown.Scope, lockdownTarget(&lockdown), lockdown.SessionsRevoked, input.Reason),
+			SeverityCritical,
+			nil,
+		)
+		if err != nil {
+			log.Printf("⚠️ Failed to open incident for emergency sign-out: %v", err)
+		} else {
+			lockdown.IncidentID = &incident.ID
+			s.db.Model(&lockdown).Update("incident_id", incident.ID)
+		}
+	}
+
+	log.Printf("🚨 Emergency sign-out (%s): %d sessions revoked", lockdownTarget(&lockdown), lockdown.SessionsRevoked)
+	s.audit(actor, "emergency_signout", lockdown.ID, fmt.Sprintf("%s: %d sessions revoked, MFA required=%t, refresh paused until %s. Reason: %s",
+		lockdownTarget(&lockdown), lockdown.SessionsRevoked, lockdown.RequireMFA, refreshPausedUntil.Format(time.RFC3339), input.Reason))
+
+	return &lockdown, nil
+}
+
+// LiftLockdown ends an active lockdown so normal authentication rules apply again
+func (s *EmergencyService) LiftLockdown(lockdownID uuid.UUID, actor *uuid.UUID) error {
+	result := s.db.Model(&models.EmergencyLockdown{}).
+		Where("id = ? AND lifted_at IS NULL", lockdownID).
+		Updates(map[string]interface{}{"lifted_at": time.Now(), "lifted_by": actor})
+	if result.Error != nil {
+		return fmt.Errorf("failed to lift lockdown: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrLockdownNotFound
+	}
+
+	s.invalidateCache()
+	s.audit(actor, "emergency_lockdown_lifted", lockdownID, "Lockdown lifted")
+	return nil
+}
+
+// ListLockdowns returns lockdowns newest first, optionally only those still in force
+func (s *EmergencyService) ListLockdowns(activeOnly bool) ([]models.EmergencyLockdown, error) {
+	query := s.db.Model(&models.EmergencyLockdown{})
+	if activeOnly {
+		query = query.Where("lifted_at IS NULL")
+	}
+
+	var lockdowns []models.EmergencyLockdown
+	if err := query.Order("triggered_at DESC").Find(&lockdowns).Error; err != nil {
+		return nil, fmt.Errorf("failed to list lockdowns: %w", err)
+	}
+	return lockdowns, nil
+}
+
+// CheckToken applies active lockdowns to an access token. Tokens issued before a
+// lockdown are revoked; newer ones must have reached requiredAAL if MFA is enforced.
+func (s *EmergencyService) CheckToken(email string, issuedAt time.Time) (revoked bool, requiredAAL int, reason string) {
+	requiredAAL = models.AAL1
+	for _, lockdown := range s.activeLockdowns() {
+		if !lockdown.AppliesTo(email) {
+			continue
+		}
+		// JWT iat has second precision, so compare at that granularity
+		if issuedAt.Before(lockdown.TriggeredAt.Truncate(time.Second)) {
+			return true, requiredAAL, "Signed out by an emergency lockdown; please sign in again"
+		}
+		if lockdown.RequireMFA {
+			requiredAAL = models.AAL2
+			reason = "Multi-factor authentication is required during an emergency lockdown"
+		}
+	}
+	return false, requiredAAL, reason
+}
+
+// RefreshPausedUntil returns when token refresh resumes for a user, or nil if it is not paused
+func (s *EmergencyService) RefreshPausedUntil(email string) *time.Time {
+	var until *time.Time
+	now := time.Now()
+	for _, lockdown := range s.activeLockdowns() {
+		if !lockdown.AppliesTo(email) || lockdown.RefreshPausedUntil == nil || !now.Before(*lockdown.RefreshPausedUntil) {
+			continue
+		}
+		if until == nil || lockdown.RefreshPausedUntil.After(*until) {
+			until = lockdown.RefreshPausedUntil
+		}
+	}
+	return until
+}
+
+// activeLockdowns serves unlifted lockdowns from a short-lived cache, since every request consults them
+func (s *EmergencyService) activeLockdowns() []models.EmergencyLockdown {
+	s.mutex.RLock()
+	if !s.cacheLoadedAt.IsZero() && time.Since(s.cacheLoadedAt) < lockdownCacheTTL {
+		defer s.mutex.RUnlock()
+		return s.cache
+	}
+	s.mutex.RUnlock()
+
+	lockdowns, err := s.ListLockdowns(true)
+	if err != nil {
+		log.Printf("⚠️ Failed to load emergency lockdowns: %v", err)
+		return nil
+	}
+
+	s.mutex.Lock()
+	s.cache = lockdowns
+	s.cacheLoadedAt = time.Now()
+	s.mutex.Unlock()
+	return lockdowns
+}
+
+func (s *EmergencyService) invalidateCache() {
+	s.mutex.Lock()
+	s.cache = nil
+	s.cacheLoadedAt = time.Time{}
+	s.mutex.Unlock()
+}
+
+func (s *EmergencyService) audit(actor *uuid.UUID, action string, lockdownID uuid.UUID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "emergency_lockdown",
+		ResourceID: lockdownID.String(),
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit emergency action: %v", err)
+	}
+}
+
+func lockdownTarget(lockdown *models.EmergencyLockdown) string {
+	if lockdown.Scope == models.LockdownScopeDomain {
+		return "domain " + lockdown.Domain
+	}
+	return "all users"
+}
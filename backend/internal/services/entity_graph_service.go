@@ -0,0 +1,322 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Entity types in the risk graph
+const (
+	EntityUser   = "user"
+	EntityDevice = "device" // keyed by fingerprint
+	EntityIP     = "ip"
+	EntityApp    = "app"
+)
+
+// Traversal bounds; each hop reads at most entityGraphRowsPerSource rows per source
+const (
+	entityGraphMaxDepth      = 3
+	entityGraphRowsPerSource = 500
+)
+
+var (
+	// ErrUnknownEntityType is returned when a graph query names an entity type that does not exist
+	ErrUnknownEntityType = errors.New("unknown entity type")
+	// ErrInvalidGraphQuery is returned for an out of range depth or an empty entity
+	ErrInvalidGraphQuery = errors.New("invalid graph query")
+)
+
+// entityEdgeSource derives edges between two entity types from the rows of one table
+type entityEdgeSource struct {
+	name       string
+	model      interface{}
+	fromType   string
+	fromColumn string
+	toType     string
+	toColumn   string
+	timeColumn string
+}
+
+// entityEdgeSources are the tables the graph is built from. Nothing is materialized:
+// edges are read from the existing records when an entity is traversed.
+var entityEdgeSources = []entityEdgeSource{
+	{"session", &models.Session{}, EntityUser, "user_id", EntityIP, "ip_address", "created_at"},
+	{"login", &models.LoginEvent{}, EntityUser, "user_id", EntityIP, "ip_address", "created_at"},
+	{"risk_assessment", &RiskAssessment{}, EntityUser, "user_id", EntityIP, "ip_address", "created_at"},
+	{"risk_assessment", &RiskAssessment{}, EntityUser, "user_id", EntityDevice, "device_fingerprint", "created_at"},
+	{"risk_assessment", &RiskAssessment{}, EntityDevice, "device_fingerprint", EntityIP, "ip_address", "created_at"},
+	{"trusted_device", &models.TrustedDevice{}, EntityUser, "user_id", EntityDevice, "fingerprint", "last_seen"},
+	{"trusted_device", &models.TrustedDevice{}, EntityDevice, "fingerprint", EntityIP, "ip_address", "last_seen"},
+	{"device_fingerprint", &DeviceFingerprint{}, EntityUser, "user_id", EntityDevice, "fingerprint", "last_seen"},
+	{"app_launch", &models.AppLaunchEvent{}, EntityUser, "user_id", EntityApp, "app_id", "launched_at"},
+	{"app_launch", &models.AppLaunchEvent{}, EntityIP, "ip_address", EntityApp, "app_id", "launched_at"},
+	{"app_connection", &models.AppConnection{}, EntityUser, "user_id", EntityApp, "app_id", "created_at"},
+}
+
+// EntityNode is a user, device, IP address or app in the graph
+type EntityNode struct {
+	ID           string   `json:"id"` // type:value
+	Type         string   `json:"type"`
+	Value        string   `json:"value"`
+	Label        string   `json:"label,omitempty"`
+	Depth        int      `json:"depth"` // hops from the queried entity
+	RiskScore    *float64 `json:"risk_score,omitempty"`
+	RiskLevel    string   `json:"risk_level,omitempty"`
+	FailedLogins int64    `json:"failed_logins,omitempty"`
+}
+
+// EntityEdge links two entities that were seen together, with the sources that saw them
+type EntityEdge struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Sources   []string  `json:"sources"`
+	Count     int64     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// EntityGraph is the neighbourhood of an entity
+type EntityGraph struct {
+	Root      string       `json:"root"`
+	Since     time.Time    `json:"since"`
+	Nodes     []EntityNode `json:"nodes"`
+	Edges     []EntityEdge `json:"edges"`
+	Truncated bool         `json:"truncated"` // the node limit was reached
+	// AdminLinks open a user root in connected providers' admin consoles
+	AdminLinks []AdminConsoleLink `json:"admin_links,omitempty"`
+}
+
+// EntityGraphQuery selects how far and into which entity types to traverse
+type EntityGraphQuery struct {
+	Depth int
+	Types []string // entity types to include besides the root; empty means all
+	Since *time.Time
+}
+
+// EntityGraphService links users, devices, IP addresses and apps from sessions, logins,
+// risk assessments, devices and app activity, so an investigation can see what else an
+// entity touched
+type EntityGraphService struct {
+	db       *gorm.DB
+	window   time.Duration
+	maxNodes int
+}
+
+// NewEntityGraphService creates a new entity graph service
+func NewEntityGraphService(db *gorm.DB) *EntityGraphService {
+	return &EntityGraphService{
+		db:       db,
+		window:   envDuration("ENTITY_GRAPH_WINDOW", 90*24*time.Hour),
+		maxNodes: envInt("ENTITY_GRAPH_MAX_NODES", 200),
+	}
+}
+
+func entityNodeID(entityType, value string) string {
+	return entityType + ":" + value
+}
+
+// Traverse returns the entities within query.Depth hops of an entity and the edges
+// between them, breadth first, until the node limit is reached
+func (s *EntityGraphService) Traverse(entityType, value string, query EntityGraphQuery, now time.Time) (*EntityGraph, error) {
+	if !isEntityType(entityType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEntityType, entityType)
+	}
+	for _, t := range query.Types {
+		if !isEntityType(t) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownEntityType, t)
+		}
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("%w: entity is required", ErrInvalidGraphQuery)
+	}
+	if query.Depth < 1 || query.Depth > entityGraphMaxDepth {
+		return nil, fmt.Errorf("%w: depth must be between 1 and %d", ErrInvalidGraphQuery, entityGraphMaxDepth)
+	}
+	since := now.Add(-s.window)
+	if query.Since != nil {
+		since = *query.Since
+	}
+
+	root := EntityNode{ID: entityNodeID(entityType, value), Type: entityType, Value: value}
+	graph := &EntityGraph{Root: root.ID, Since: since}
+	nodes := map[string]*EntityNode{root.ID: &root}
+	order := []string{root.ID}
+	edges := map[string]*EntityEdge{}
+
+	frontier := []*EntityNode{&root}
+	for depth := 1; depth <= query.Depth && len(frontier) > 0 && !graph.Truncated; depth++ {
+		var next []*EntityNode
+		for _, node := range frontier {
+			neighbors, err := s.neighbors(node, since)
+			if err != nil {
+				return nil, err
+			}
+			for _, neighbor := range neighbors {
+				otherID := entityNodeID(neighbor.otherType, neighbor.otherValue)
+				if _, seen := nodes[otherID]; !seen {
+					if len(query.Types) > 0 && !containsValue(query.Types, neighbor.otherType) {
+						continue
+					}
+					if len(nodes) >= s.maxNodes {
+						graph.Truncated = true
+						continue
+					}
+					other := &EntityNode{ID: otherID, Type: neighbor.otherType, Value: neighbor.otherValue, Depth: depth}
+					nodes[otherID] = other
+					order = append(order, otherID)
+					next = append(next, other)
+				}
+				mergeEntityEdge(edges, node.ID, otherID, neighbor)
+			}
+		}
+		frontier = next
+	}
+
+	graph.Nodes = make([]EntityNode, 0, len(order))
+	for _, id := range order {
+		graph.Nodes = append(graph.Nodes, *nodes[id])
+	}
+	if err := s.enrich(graph.Nodes, since); err != nil {
+		return nil, err
+	}
+
+	graph.Edges = make([]EntityEdge, 0, len(edges))
+	for _, edge := range edges {
+		sort.Strings(edge.Sources)
+		graph.Edges = append(graph.Edges, *edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if !graph.Edges[i].LastSeen.Equal(graph.Edges[j].LastSeen) {
+			return graph.Edges[i].LastSeen.After(graph.Edges[j].LastSeen)
+		}
+		return graph.Edges[i].From+graph.Edges[i].To < graph.Edges[j].From+graph.Edges[j].To
+	})
+	return graph, nil
+}
+
+func isEntityType(entityType string) bool {
+	switch entityType {
+	case EntityUser, EntityDevice, EntityIP, EntityApp:
+		return true
+	}
+	return false
+}
+
+// entityNeighbor is one sighting of another entity together with a node
+type entityNeighbor struct {
+	source     string
+	otherType  string
+	otherValue string
+	seenAt     time.Time
+}
+
+// neighbors reads every source that links the node's type to another, newest first
+func (s *EntityGraphService) neighbors(node *EntityNode, since time.Time) ([]entityNeighbor, error) {
+	var neighbors []entityNeighbor
+	for _, source := range entityEdgeSources {
+		var column, otherColumn, otherType string
+		switch node.Type {
+		case source.fromType:
+			column, otherColumn, otherType = source.fromColumn, source.toColumn, source.toType
+		case source.toType:
+			column, otherColumn, otherType = source.toColumn, source.fromColumn, source.fromType
+		default:
+			continue
+		}
+
+		var rows []struct {
+			Value  string
+			SeenAt time.Time
+		}
+		err := s.db.Model(source.model).
+			Select(otherColumn+" AS value, "+source.timeColumn+" AS seen_at").
+			Where(column+" = ? AND "+otherColumn+" IS NOT NULL AND "+otherColumn+" <> '' AND "+source.timeColumn+" >= ?", node.Value, since).
+			Order(source.timeColumn + " DESC").Limit(entityGraphRowsPerSource).
+			Scan(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s links: %w", source.name, err)
+		}
+		for _, row := range rows {
+			neighbors = append(neighbors, entityNeighbor{source: source.name, otherType: otherType, otherValue: row.Value, seenAt: row.SeenAt})
+		}
+	}
+	return neighbors, nil
+}
+
+// mergeEntityEdge folds a sighting into the edge between two nodes, whichever way round
+// it was found
+func mergeEntityEdge(edges map[string]*EntityEdge, from, to string, neighbor entityNeighbor) {
+	if to < from {
+		from, to = to, from
+	}
+	key := from + "|" + to
+	edge, ok := edges[key]
+	if !ok {
+		edge = &EntityEdge{From: from, To: to, FirstSeen: neighbor.seenAt, LastSeen: neighbor.seenAt}
+		edges[key] = edge
+	}
+	edge.Count++
+	if !containsValue(edge.Sources, neighbor.source) {
+		edge.Sources = append(edge.Sources, neighbor.source)
+	}
+	if neighbor.seenAt.Before(edge.FirstSeen) {
+		edge.FirstSeen = neighbor.seenAt
+	}
+	if neighbor.seenAt.After(edge.LastSeen) {
+		edge.LastSeen = neighbor.seenAt
+	}
+}
+
+// enrich labels users with their email and latest risk, devices with their name and IP
+// addresses with their failed logins since the start of the window
+func (s *EntityGraphService) enrich(nodes []EntityNode, since time.Time) error {
+	for i := range nodes {
+		node := &nodes[i]
+		switch node.Type {
+		case EntityUser:
+			var user models.User
+			if err := s.db.Select("email").Where("id = ?", node.Value).Limit(1).Find(&user).Error; err != nil {
+				return fmt.Errorf("failed to get user %s: %w", node.Value, err)
+			}
+			node.Label = user.Email
+			var assessment RiskAssessment
+			result := s.db.Where("user_id = ?", node.Value).Order("created_at DESC").Limit(1).Find(&assessment)
+			if result.Error != nil {
+				return fmt.Errorf("failed to get risk of user %s: %w", node.Value, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				node.RiskScore = &assessment.RiskScore
+				node.RiskLevel = string(assessment.RiskLevel)
+			}
+		case EntityDevice:
+			var device models.TrustedDevice
+			if err := s.db.Select("device_name").Where("fingerprint = ?", node.Value).Limit(1).Find(&device).Error; err != nil {
+				return fmt.Errorf("failed to get device %s: %w", node.Value, err)
+			}
+			if device.DeviceName == "" {
+				var fingerprint DeviceFingerprint
+				if err := s.db.Select("device_name").Where("fingerprint = ?", node.Value).Limit(1).Find(&fingerprint).Error; err != nil {
+					return fmt.Errorf("failed to get device %s: %w", node.Value, err)
+				}
+				device.DeviceName = fingerprint.DeviceName
+			}
+			node.Label = device.DeviceName
+		case EntityIP:
+			err := s.db.Model(&models.LoginEvent{}).
+				Where("ip_address = ? AND success = ? AND created_at >= ?", node.Value, false, since).
+				Count(&node.FailedLogins).Error
+			if err != nil {
+				return fmt.Errorf("failed to count failed logins from %s: %w", node.Value, err)
+			}
+		}
+	}
+	return nil
+}
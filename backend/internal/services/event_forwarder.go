@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of event forwarded to a SIEM
+const (
+	SIEMKindAuditLog      = "audit_log"
+	SIEMKindAuditEvent    = "audit_event"
+	SIEMKindSecurityAlert = "security_alert"
+)
+
+// ErrSIEMRejected marks events a SIEM refused outright, which sending again will not fix
+var ErrSIEMRejected = errors.New("SIEM rejected the events")
+
+// SIEMEvent is an audit log, audit event or security alert in the form sent to a SIEM
+type SIEMEvent struct {
+	ID         string          `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Kind       string          `json:"kind"`
+	Type       string          `json:"type"`
+	Severity   string          `json:"severity"`
+	Outcome    string          `json:"outcome,omitempty"`
+	UserID     *uuid.UUID      `json:"user_id,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Resource   string          `json:"resource,omitempty"`
+	ResourceID string          `json:"resource_id,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Region     string          `json:"region,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+// EventSink delivers batches of events to one SIEM
+type EventSink interface {
+	Name() string
+	Send(ctx context.Context, events []SIEMEvent) error
+}
+
+// SIEMPartialError reports a batch a SIEM accepted only part of: Retry are the events
+// worth sending again and Rejected how many it refused outright
+type SIEMPartialError struct {
+	Retry    []SIEMEvent
+	Rejected int
+	Reason   string
+}
+
+func (e *SIEMPartialError) Error() string {
+	return fmt.Sprintf("%d event(s) to retry, %d rejected: %s", len(e.Retry), e.Rejected, e.Reason)
+}
+
+// SIEMSinkStats counts what a sink has delivered since the process started
+type SIEMSinkStats struct {
+	Sink        string    `json:"sink"`
+	Queued      int       `json:"queued"`
+	Sent        int64     `json:"sent"`
+	Dropped     int64     `json:"dropped"` // pushed out of a full queue
+	Failed      int64     `json:"failed"`  // rejected, or still failing after every retry
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+	LastSentAt  time.Time `json:"last_sent_at,omitempty"`
+}
+
+// forwarderSink is a sink with its own queue, so a slow SIEM does not hold up the others
+type forwarderSink struct {
+	sink    EventSink
+	queue   chan SIEMEvent
+	sent    atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+
+	mutex       sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+	lastSentAt  time.Time
+}
+
+// EventForwarder sends audit and security events to SIEMs: Splunk's HTTP Event Collector,
+// Elasticsearch's bulk API and RFC 5424 syslog. Events are queued per sink without ever
+// blocking the request that raised them; when a sink falls SIEM_QUEUE_SIZE events behind,
+// its oldest queued events are dropped and counted. Each sink sends batches of up to
+// SIEM_BATCH_SIZE events at least every SIEM_FLUSH_INTERVAL, and a batch that fails is
+// retried SIEM_MAX_RETRIES times, backing off from SIEM_RETRY_BACKOFF. Delivery is at
+// least once: a SIEM may see an event twice after a retry, with the same id.
+type EventForwarder struct {
+	sinks      []*forwarderSink
+	batchSize  int
+	flushEvery time.Duration
+	maxRetries int
+	backoff    time.Duration
+	timeout    time.Duration
+}
+
+// NewEventForwarder creates a forwarder to sinks, tuned from the environment
+func NewEventForwarder(sinks ...EventSink) *EventForwarder {
+	f := &EventForwarder{
+		batchSize:  max(envInt("SIEM_BATCH_SIZE", 100), 1),
+		flushEvery: envDuration("SIEM_FLUSH_INTERVAL", 5*time.Second),
+		maxRetries: max(envInt("SIEM_MAX_RETRIES", 5), 0),
+		backoff:    envDuration("SIEM_RETRY_BACKOFF", time.Second),
+		timeout:    envDuration("SIEM_TIMEOUT", 10*time.Second),
+	}
+	queueSize := max(envInt("SIEM_QUEUE_SIZE", 10000), 1)
+	for _, sink := range sinks {
+		f.sinks = append(f.sinks, &forwarderSink{sink: sink, queue: make(chan SIEMEvent, queueSize)})
+	}
+	return f
+}
+
+// NewEventForwarderFromEnv creates a forwarder to each SIEM configured in the environment,
+// or returns nil when none is
+func NewEventForwarderFromEnv() *EventForwarder {
+	var sinks []EventSink
+	if hecURL := getEnv("SIEM_SPLUNK_HEC_URL", ""); hecURL != "" {
+		sink := NewSplunkHECSink(hecURL, getEnv("SIEM_SPLUNK_HEC_TOKEN", ""))
+		sink.Index = getEnv("SIEM_SPLUNK_INDEX", "")
+		sink.SourceType = getEnv("SIEM_SPLUNK_SOURCETYPE", sink.SourceType)
+		sinks = append(sinks, sink)
+	}
+	if elasticURL := getEnv("SIEM_ELASTIC_URL", ""); elasticURL != "" {
+		sink := NewElasticsearchSink(elasticURL, getEnv("SIEM_ELASTIC_INDEX", "cloudgate-events"))
+		sink.APIKey = getEnv("SIEM_ELASTIC_API_KEY", "")
+		sink.Username = getEnv("SIEM_ELASTIC_USERNAME", "")
+		sink.Password = getEnv("SIEM_ELASTIC_PASSWORD", "")
+		sinks = append(sinks, sink)
+	}
+	if syslogAddr := getEnv("SIEM_SYSLOG_ADDR", ""); syslogAddr != "" {
+		sink := NewSyslogSink(getEnv("SIEM_SYSLOG_NETWORK", "tcp"), syslogAddr)
+		sink.Facility = envInt("SIEM_SYSLOG_FACILITY", sink.Facility)
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	return NewEventForwarder(sinks...)
+}
+
+// Forward queues an event for every sink. It never blocks: a sink whose queue is full
+// drops its oldest event to make room.
+func (f *EventForwarder) Forward(event SIEMEvent) {
+	if f == nil {
+		return
+	}
+	for _, s := range f.sinks {
+		for queued := false; !queued; {
+			select {
+			case s.queue <- event:
+				queued = true
+			default:
+				select {
+				case <-s.queue:
+					if dropped := s.dropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+						log.Printf("⚠️ SIEM sink %s is falling behind, %d event(s) dropped", s.sink.Name(), dropped)
+					}
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Run delivers queued events until ctx is done, then makes one last attempt to deliver
+// what is still queued
+func (f *EventForwarder) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range f.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.run(ctx, s)
+		}()
+	}
+	wg.Wait()
+}
+
+func (f *EventForwarder) run(ctx context.Context, s *forwarderSink) {
+	ticker := time.NewTicker(f.flushEvery)
+	defer ticker.Stop()
+	batch := make([]SIEMEvent, 0, f.batchSize)
+	for {
+		select {
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= f.batchSize {
+				f.deliver(ctx, s, batch)
+				batch = make([]SIEMEvent, 0, f.batchSize)
+			}
+		case <-ticker.C:
+			heartbeat(ctx, "siem_"+s.sink.Name(), time.Now())
+			if len(batch) > 0 {
+				f.deliver(ctx, s, batch)
+				batch = make([]SIEMEvent, 0, f.batchSize)
+			}
+		case <-ctx.Done():
+			f.drain(ctx, s, batch)
+			return
+		}
+	}
+}
+
+// drain sends what is left at shutdown, giving up on the rest once a batch fails so a
+// SIEM that is down does not hold up the shutdown
+func (f *EventForwarder) drain(ctx context.Context, s *forwarderSink, batch []SIEMEvent) {
+	for {
+		full := false
+		for !full {
+			select {
+			case event := <-s.queue:
+				batch = append(batch, event)
+				full = len(batch) >= f.batchSize
+			default:
+				full = true
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if !f.deliver(ctx, s, batch) {
+			if left := len(s.queue); left > 0 {
+				s.failed.Add(int64(left))
+				log.Printf("⚠️ SIEM sink %s: %d event(s) not delivered at shutdown", s.sink.Name(), left)
+			}
+			return
+		}
+		batch = make([]SIEMEvent, 0, f.batchSize)
+	}
+}
+
+// deliver sends a batch, retrying what the sink did not take with exponential backoff.
+// Once ctx is done each batch gets a single attempt. It reports whether every event was
+// delivered.
+func (f *EventForwarder) deliver(ctx context.Context, s *forwarderSink, batch []SIEMEvent) bool {
+	pending := batch
+	for attempt := 0; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(detached(ctx), f.timeout)
+		err := s.sink.Send(sendCtx, pending)
+		cancel()
+		if err == nil {
+			s.sent.Add(int64(len(pending)))
+			s.mutex.Lock()
+			s.lastSentAt = time.Now()
+			s.mutex.Unlock()
+			return true
+		}
+
+		var partial *SIEMPartialError
+		if errors.As(err, &partial) {
+			s.sent.Add(int64(len(pending) - len(partial.Retry) - partial.Rejected))
+			s.failed.Add(int64(partial.Rejected))
+			pending = partial.Retry
+		}
+		s.mutex.Lock()
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now()
+		s.mutex.Unlock()
+		if len(pending) == 0 {
+			log.Printf("⚠️ SIEM sink %s rejected events: %v", s.sink.Name(), err)
+			return false
+		}
+		if errors.Is(err, ErrSIEMRejected) || attempt >= f.maxRetries || ctx.Err() != nil {
+			s.failed.Add(int64(len(pending)))
+			log.Printf("⚠️ SIEM sink %s failed to deliver %d event(s) after %d attempt(s): %v", s.sink.Name(), len(pending), attempt+1, err)
+			return false
+		}
+
+		wait := min(f.backoff<<attempt, time.Minute)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Stats returns each sink's delivery counts
+func (f *EventForwarder) Stats() []SIEMSinkStats {
+	if f == nil {
+		return nil
+	}
+	stats := make([]SIEMSinkStats, 0, len(f.sinks))
+	for _, s := range f.sinks {
+		s.mutex.Lock()
+		stats = append(stats, SIEMSinkStats{
+			Sink:        s.sink.Name(),
+			Queued:      len(s.queue),
+			Sent:        s.sent.Load(),
+			Dropped:     s.dropped.Load(),
+			Failed:      s.failed.Load(),
+			LastError:   s.lastError,
+			LastErrorAt: s.lastErrorAt,
+			LastSentAt:  s.lastSentAt,
+		})
+		s.mutex.Unlock()
+	}
+	return stats
+}
+
+// Health reports the sinks whose last delivery failed
+func (f *EventForwarder) Health() error {
+	var failing []string
+	for _, stats := range f.Stats() {
+		if stats.LastError != "" && stats.LastErrorAt.After(stats.LastSentAt) {
+			failing = append(failing, fmt.Sprintf("%s: %s", stats.Sink, stats.LastError))
+		}
+	}
+	if len(failing) > 0 {
+		return errors.New(strings.Join(failing, "; "))
+	}
+	return nil
+}
+
+// Attach forwards every audit log written through db, whoever writes it
+func (f *EventForwarder) Attach(db *gorm.DB) {
+	forward := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || tx.Statement.Schema.Table != "audit_logs" {
+			return
+		}
+		value := reflect.Indirect(tx.Statement.ReflectValue)
+		switch value.Kind() {
+		case reflect.Struct:
+			if entry, ok := value.Interface().(models.AuditLog); ok {
+				f.Forward(auditLogSIEMEvent(entry))
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < value.Len(); i++ {
+				if entry, ok := reflect.Indirect(value.Index(i)).Interface().(models.AuditLog); ok {
+					f.Forward(auditLogSIEMEvent(entry))
+				}
+			}
+		}
+	}
+
+	callbacks := db.Callback().Create()
+	var err error
+	if callbacks.Get("siem:forward") != nil {
+		err = callbacks.Replace("siem:forward", forward)
+	} else {
+		err = callbacks.After("gorm:create").Register("siem:forward", forward)
+	}
+	if err != nil {
+		log.Printf("Failed to register SIEM forwarding callback: %v", err)
+	}
+}
+
+func auditLogSIEMEvent(entry models.AuditLog) SIEMEvent {
+	severity := "info"
+	switch entry.Status {
+	case "failure":
+		severity = "medium"
+	case "warning":
+		severity = "low"
+	}
+	return SIEMEvent{
+		ID:         entry.ID.String(),
+		Timestamp:  entry.CreatedAt.UTC(),
+		Kind:       SIEMKindAuditLog,
+		Type:       entry.Action,
+		Severity:   severity,
+		Outcome:    entry.Status,
+		UserID:     entry.UserID,
+		IPAddress:  entry.IPAddress,
+		UserAgent:  entry.UserAgent,
+		Resource:   entry.Resource,
+		ResourceID: entry.ResourceID,
+		Message:    entry.Details,
+		Region:     entry.Region,
+	}
+}
+
+func auditEventSIEMEvent(event AuditEvent) SIEMEvent {
+	data, _ := json.Marshal(map[string]interface{}{
+		"category":         event.Category,
+		"action":           event.Action,
+		"session_id":       event.SessionID,
+		"details":          event.Details,
+		"risk_score":       event.RiskScore,
+		"compliance_flags": event.ComplianceFlags,
+		"sample_rate":      event.SampleRate,
+	})
+	return SIEMEvent{
+		ID:        event.ID.String(),
+		Timestamp: event.Timestamp.UTC(),
+		Kind:      SIEMKindAuditEvent,
+		Type:      string(event.EventType),
+		Severity:  string(event.Severity),
+		Outcome:   string(event.Outcome),
+		UserID:    event.UserID,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		Resource:  event.Resource,
+		Message:   event.Description,
+		Region:    event.Region,
+		Data:      data,
+	}
+}
+
+func securityAlertSIEMEvent(alert SecurityAlert) SIEMEvent {
+	data, _ := json.Marshal(map[string]interface{}{
+		"title":    alert.Title,
+		"source":   alert.Source,
+		"status":   alert.Status,
+		"tags":     alert.Tags,
+		"priority": alert.Priority,
+		"metadata": alert.Metadata,
+	})
+	return SIEMEvent{
+		ID:        alert.ID.String(),
+		Timestamp: alert.Timestamp.UTC(),
+		Kind:      SIEMKindSecurityAlert,
+		Type:      string(alert.Type),
+		Severity:  string(alert.Severity),
+		UserID:    alert.UserID,
+		IPAddress: alert.IPAddress,
+		UserAgent: alert.UserAgent,
+		Message:   alert.Description,
+		Data:      data,
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// EventQuota limits how many events each service account may submit, as a token bucket per
+// account refilled at its EventRateLimit per second and holding at most one second's worth.
+// Buckets live in memory, so the limit applies on each instance separately.
+type EventQuota struct {
+	defaultRate int
+
+	mu      sync.Mutex
+	buckets map[uuid.UUID]*quotaBucket
+}
+
+type quotaBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewEventQuota creates an event quota; accounts without their own limit get
+// SERVICE_EVENT_RATE_LIMIT events per second
+func NewEventQuota() *EventQuota {
+	return &EventQuota{
+		defaultRate: max(envInt("SERVICE_EVENT_RATE_LIMIT", 500), 1),
+		buckets:     make(map[uuid.UUID]*quotaBucket),
+	}
+}
+
+// Allow takes one event from the account's bucket, reporting false when it is empty
+func (q *EventQuota) Allow(account *models.ServiceAccount, now time.Time) bool {
+	rate := float64(q.defaultRate)
+	if account.EventRateLimit > 0 {
+		rate = float64(account.EventRateLimit)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	bucket, ok := q.buckets[account.ID]
+	if !ok {
+		bucket = &quotaBucket{tokens: rate, updated: now}
+		q.buckets[account.ID] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = min(rate, bucket.tokens+elapsed*rate)
+		bucket.updated = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
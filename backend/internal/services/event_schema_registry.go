@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of events internal services send to /internal/events/*
+const (
+	EventKindLogin    = "login"
+	EventKindAPI      = "api"
+	EventKindSecurity = "security"
+)
+
+// Types an event schema field can have
+const (
+	FieldString    = "string"
+	FieldNumber    = "number"
+	FieldInteger   = "integer"
+	FieldBoolean   = "boolean"
+	FieldUUID      = "uuid"
+	FieldTimestamp = "timestamp"
+	FieldStringMap = "string_map"
+)
+
+var (
+	ErrUnknownEventSchema  = errors.New("unknown event schema")
+	ErrEventSchemaMismatch = errors.New("event does not match its schema")
+)
+
+// EventSchemaField describes one field of an event schema
+type EventSchemaField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+// EventSchema is one version of the payload of an event kind. Older versions stay
+// accepted and are upgraded step by step to the current one before processing.
+type EventSchema struct {
+	Kind        string             `json:"kind"`
+	Version     int                `json:"version"`
+	Current     bool               `json:"current"`
+	Deprecated  bool               `json:"deprecated"`
+	Deprecation string             `json:"deprecation,omitempty"`
+	Fields      []EventSchemaField `json:"fields"`
+
+	// upgrade turns a valid payload of this version into one of the next version
+	upgrade func(payload map[string]interface{}) map[string]interface{}
+}
+
+// NormalizedEvent is an ingested event validated and upgraded to the current schema
+type NormalizedEvent struct {
+	Payload    map[string]interface{}
+	Version    int
+	Deprecated bool
+	Warnings   []string
+}
+
+// EventSchemaRegistry holds every schema version of the ingested event kinds
+type EventSchemaRegistry struct {
+	schemas map[string][]*EventSchema // by kind, oldest version first
+}
+
+// NewEventSchemaRegistry creates a registry of the built-in event schemas
+func NewEventSchemaRegistry() *EventSchemaRegistry {
+	registry := &EventSchemaRegistry{schemas: make(map[string][]*EventSchema)}
+
+	loginFields := []EventSchemaField{
+		{Name: "user_id", Type: FieldUUID, Required: true},
+		{Name: "email", Type: FieldString, Required: true},
+		{Name: "ip_address", Type: FieldString, Required: true},
+		{Name: "user_agent", Type: FieldString, Required: true},
+		{Name: "risk_score", Type: FieldNumber},
+	}
+	// v1 read a missing success flag as a failed login; v2 requires the outcome
+	registry.register(&EventSchema{
+		Kind: EventKindLogin, Version: 1, Deprecated: true,
+		Deprecation: "login events v1 are deprecated; send schema_version 2 with outcome instead of success",
+		Fields:      append(slices.Clone(loginFields), EventSchemaField{Name: "success", Type: FieldBoolean}),
+		upgrade: func(payload map[string]interface{}) map[string]interface{} {
+			outcome := "failure"
+			if success, _ := payload["success"].(bool); success {
+				outcome = "success"
+			}
+			delete(payload, "success")
+			payload["outcome"] = outcome
+			return payload
+		},
+	})
+	registry.register(&EventSchema{
+		Kind: EventKindLogin, Version: 2,
+		Fields: append(slices.Clone(loginFields), EventSchemaField{Name: "outcome", Type: FieldString, Required: true, Enum: []string{"success", "failure"}}),
+	})
+
+	registry.register(&EventSchema{
+		Kind: EventKindAPI, Version: 1,
+		Fields: []EventSchemaField{
+			{Name: "endpoint", Type: FieldString, Required: true},
+			{Name: "method", Type: FieldString, Required: true},
+			{Name: "ip_address", Type: FieldString, Required: true},
+			{Name: "user_agent", Type: FieldString, Required: true},
+			{Name: "status_code", Type: FieldInteger, Required: true},
+			{Name: "response_time_ms", Type: FieldInteger, Required: true},
+		},
+	})
+
+	registry.register(&EventSchema{
+		Kind: EventKindSecurity, Version: 1,
+		Fields: []EventSchemaField{
+			{Name: "event_type", Type: FieldString, Required: true},
+			{Name: "severity", Type: FieldString, Required: true, Enum: []string{string(SeverityLow), string(SeverityMedium), string(SeverityHigh), string(SeverityCritical)}},
+			{Name: "title", Type: FieldString, Required: true},
+			{Name: "description", Type: FieldString},
+			{Name: "user_id", Type: FieldUUID},
+			{Name: "ip_address", Type: FieldString},
+			{Name: "attributes", Type: FieldStringMap},
+			{Name: "occurred_at", Type: FieldTimestamp},
+		},
+	})
+	return registry
+}
+
+// register adds the next version of a kind, which becomes its current version
+func (r *EventSchemaRegistry) register(schema *EventSchema) {
+	versions := r.schemas[schema.Kind]
+	if len(versions) > 0 {
+		versions[len(versions)-1].Current = false
+	}
+	schema.Current = true
+	r.schemas[schema.Kind] = append(versions, schema)
+}
+
+// Schemas returns every schema version, by kind and then version
+func (r *EventSchemaRegistry) Schemas() []EventSchema {
+	kinds := make([]string, 0, len(r.schemas))
+	for kind := range r.schemas {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var schemas []EventSchema
+	for _, kind := range kinds {
+		for _, schema := range r.schemas[kind] {
+			schemas = append(schemas, *schema)
+		}
+	}
+	return schemas
+}
+
+// CurrentVersion returns the version events of a kind are processed as
+func (r *EventSchemaRegistry) CurrentVersion(kind string) int {
+	versions := r.schemas[kind]
+	if len(versions) == 0 {
+		return 0
+	}
+	return versions[len(versions)-1].Version
+}
+
+// ParseEventSchemaVersion reads a schema version such as "2" or "v2"; empty means version 1,
+// the shape producers sent before events were versioned
+func ParseEventSchemaVersion(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(value, "v"))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%w: invalid schema version %q", ErrUnknownEventSchema, value)
+	}
+	return version, nil
+}
+
+// Normalize validates a payload against its schema version and upgrades it to the current
+// version. Deprecated versions and unknown fields produce warnings, not errors.
+func (r *EventSchemaRegistry) Normalize(kind string, version int, payload map[string]interface{}) (*NormalizedEvent, error) {
+	versions := r.schemas[kind]
+	index := slices.IndexFunc(versions, func(schema *EventSchema) bool { return schema.Version == version })
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s events have no version %d (current is %d)", ErrUnknownEventSchema, kind, version, r.CurrentVersion(kind))
+	}
+	schema := versions[index]
+
+	warnings, err := schema.validate(payload)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Deprecated {
+		warnings = append([]string{schema.Deprecation}, warnings...)
+	}
+	for _, step := range versions[index : len(versions)-1] {
+		payload = step.upgrade(payload)
+	}
+
+	return &NormalizedEvent{Payload: payload, Version: version, Deprecated: schema.Deprecated, Warnings: warnings}, nil
+}
+
+// validate checks the payload's fields, dropping unknown ones with a warning each
+func (s *EventSchema) validate(payload map[string]interface{}) ([]string, error) {
+	var problems, warnings []string
+	for _, field := range s.Fields {
+		value, ok := payload[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				problems = append(problems, field.Name+" is required")
+			}
+			continue
+		}
+		if problem := field.check(value); problem != "" {
+			problems = append(problems, field.Name+" "+problem)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s v%d: %s", ErrEventSchemaMismatch, s.Kind, s.Version, strings.Join(problems, "; "))
+	}
+
+	var unknown []string
+	for name := range payload {
+		if !slices.ContainsFunc(s.Fields, func(field EventSchemaField) bool { return field.Name == name }) {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		delete(payload, name)
+		warnings = append(warnings, fmt.Sprintf("field %s is not part of %s v%d and was ignored", name, s.Kind, s.Version))
+	}
+	return warnings, nil
+}
+
+// check describes what is wrong with a JSON-decoded value, or returns ""
+func (f EventSchemaField) check(value interface{}) string {
+	switch f.Type {
+	case FieldString, FieldUUID, FieldTimestamp:
+		text, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if f.Required && strings.TrimSpace(text) == "" {
+			return "must not be empty"
+		}
+		if len(f.Enum) > 0 && !slices.Contains(f.Enum, text) {
+			return "must be one of " + strings.Join(f.Enum, ", ")
+		}
+		if f.Type == FieldUUID && text != "" {
+			if _, err := uuid.Parse(text); err != nil {
+				return "must be a UUID"
+			}
+		}
+		if f.Type == FieldTimestamp && text != "" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				return "must be an RFC 3339 timestamp"
+			}
+		}
+	case FieldNumber, FieldInteger:
+		number, ok := value.(float64)
+		if !ok {
+			return "must be a number"
+		}
+		if f.Type == FieldInteger && number != math.Trunc(number) {
+			return "must be an integer"
+		}
+	case FieldBoolean:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	case FieldStringMap:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return "must be an object"
+		}
+		for _, entry := range entries {
+			if _, ok := entry.(string); !ok {
+				return "must only have string values"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/pkg/constants"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxExtensionBatch caps the domains or events accepted in one report
+	maxExtensionBatch = 100
+	// maxExtensionVisits caps the visits one report may add to a domain
+	maxExtensionVisits = 10000
+)
+
+// ErrInvalidExtensionReport is returned for malformed or oversized extension reports
+var ErrInvalidExtensionReport = errors.New("invalid extension report")
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// extensionEventSpec describes an event type the browser extension may report
+type extensionEventSpec struct {
+	Severity AlertSeverity
+	Title    string
+	Alert    AlertType // empty means the event is recorded without raising an alert
+}
+
+// extensionEventTypes lists the events the browser extension may report
+var extensionEventTypes = map[string]extensionEventSpec{
+	"password_reuse":     {Severity: SeverityHigh, Title: "CloudGate password entered on another site", Alert: AlertTypePasswordReuse},
+	"phishing_suspected": {Severity: SeverityHigh, Title: "Possible phishing page imitating a sign-in", Alert: AlertTypePhishingSuspected},
+	"sso_bypass":         {Severity: SeverityMedium, Title: "Password sign-in to an app that uses SSO"},
+	"autofill_blocked":   {Severity: SeverityLow, Title: "Auto-fill refused on a page outside the app's origin"},
+}
+
+// ExtensionDomainInput is a site the extension saw the user visit
+type ExtensionDomainInput struct {
+	Domain    string
+	Visits    int
+	LoginForm bool
+}
+
+// ExtensionDomainResult summarizes a domain report
+type ExtensionDomainResult struct {
+	Accepted int `json:"accepted"`
+	Known    int `json:"known"`    // served by an app in the catalog
+	Rejected int `json:"rejected"` // not a valid public hostname
+}
+
+// ExtensionEventInput is a security observation from the extension
+type ExtensionEventInput struct {
+	Type        string
+	URL         string
+	Description string
+	OccurredAt  time.Time
+}
+
+// ExtensionApp is a catalog app as the extension shows it. Apps without a LaunchURL are
+// launched through POST /apps/launch.
+type ExtensionApp struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Icon           string   `json:"icon"`
+	Protocol       string   `json:"protocol"`
+	LaunchURL      string   `json:"launch_url,omitempty"`
+	AutofillURL    string   `json:"autofill_url,omitempty"`
+	Domains        []string `json:"domains,omitempty"`
+	StepUpRequired bool     `json:"step_up_required"`
+}
+
+// ExtensionService backs the CloudGate browser extension: the app list it shows, the
+// sites it sees users visit (input for shadow IT discovery) and the security events it
+// observes, which are recorded as security events and raise alerts when serious.
+type ExtensionService struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+}
+
+// NewExtensionService creates a new extension service
+func NewExtensionService(db *gorm.DB, security *SecurityMonitoringService) *ExtensionService {
+	return &ExtensionService{db: db, security: security}
+}
+
+// Apps lists the catalog for the extension, marking apps the session is too weak to open.
+// Relative launch URLs are resolved against baseURL.
+func (s *ExtensionService) Apps(aal int, baseURL string) []ExtensionApp {
+	catalog := GetAllSaaSApps()
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].Name < catalog[j].Name })
+
+	apps := make([]ExtensionApp, 0, len(catalog))
+	for _, app := range catalog {
+		entry := ExtensionApp{
+			ID:             app.ID,
+			Name:           app.Name,
+			Icon:           app.Icon,
+			Protocol:       app.Protocol,
+			LaunchURL:      app.LaunchURL,
+			Domains:        app.Domains,
+			StepUpRequired: app.RequiredAAL > aal,
+		}
+		if strings.HasPrefix(entry.LaunchURL, "/") {
+			entry.LaunchURL = strings.TrimSuffix(baseURL, "/") + entry.LaunchURL
+		}
+		if app.Protocol == constants.ProtocolBookmark && app.Config["credentials"] == "optional" {
+			entry.AutofillURL = "/apps/" + app.ID + "/autofill"
+		}
+		apps = append(apps, entry)
+	}
+	return apps
+}
+
+// ReportDomains records sites the extension saw a user visit. Sites served by catalog
+// apps are counted but not stored.
+func (s *ExtensionService) ReportDomains(userID uuid.UUID, inputs []ExtensionDomainInput, now time.Time) (*ExtensionDomainResult, error) {
+	if len(inputs) == 0 || len(inputs) > maxExtensionBatch {
+		return nil, fmt.Errorf("%w: between 1 and %d domains may be reported at once", ErrInvalidExtensionReport, maxExtensionBatch)
+	}
+
+	result := &ExtensionDomainResult{}
+	for _, input := range inputs {
+		domain, ok := normalizeReportedDomain(input.Domain)
+		if !ok {
+			result.Rejected++
+			continue
+		}
+		if _, known := GetSaaSAppByDomain(domain); known {
+			result.Known++
+			continue
+		}
+		visits := int64(input.Visits)
+		if visits < 1 {
+			visits = 1
+		}
+		if visits > maxExtensionVisits {
+			visits = maxExtensionVisits
+		}
+		var loginForms int64
+		if input.LoginForm {
+			loginForms = 1
+		}
+
+		var report models.ExtensionDomainReport
+		err := s.db.Where("user_id = ? AND domain = ?", userID, domain).First(&report).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			report = models.ExtensionDomainReport{UserID: userID, Domain: domain, Visits: visits, LoginForms: loginForms, FirstSeen: now, LastSeen: now}
+			err = s.db.Create(&report).Error
+		case err == nil:
+			err = s.db.Model(&report).Updates(map[string]interface{}{
+				"visits":      gorm.Expr("visits + ?", visits),
+				"login_forms": gorm.Expr("login_forms + ?", loginForms),
+				"last_seen":   now,
+			}).Error
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to record reported domain: %w", err)
+		}
+		result.Accepted++
+	}
+	return result, nil
+}
+
+// ReportEvents records security observations from the extension
+func (s *ExtensionService) ReportEvents(userID uuid.UUID, inputs []ExtensionEventInput, source TokenSource, now time.Time) (int, error) {
+	if len(inputs) == 0 || len(inputs) > maxExtensionBatch {
+		return 0, fmt.Errorf("%w: between 1 and %d events may be reported at once", ErrInvalidExtensionReport, maxExtensionBatch)
+	}
+	for _, input := range inputs {
+		if _, ok := extensionEventTypes[input.Type]; !ok {
+			return 0, fmt.Errorf("%w: unknown event type %q", ErrInvalidExtensionReport, input.Type)
+		}
+	}
+
+	for _, input := range inputs {
+		spec := extensionEventTypes[input.Type]
+		domain := ""
+		if parsed, err := url.Parse(input.URL); err == nil {
+			domain, _ = normalizeReportedDomain(parsed.Hostname())
+		}
+		occurredAt := input.OccurredAt
+		if occurredAt.IsZero() || occurredAt.After(now) {
+			occurredAt = now
+		}
+		description := spec.Title
+		if domain != "" {
+			description += " (" + domain + ")"
+		}
+		if input.Description != "" {
+			description += ": " + truncateString(input.Description, 500)
+		}
+
+		event := models.SecurityEvent{
+			UserID:      userID,
+			EventType:   "extension_" + input.Type,
+			Description: description,
+			Severity:    spec.Severity,
+			IPAddress:   source.IPAddress,
+			UserAgent:   source.UserAgent,
+		}
+		if err := s.db.Create(&event).Error; err != nil {
+			return 0, fmt.Errorf("failed to record extension event: %w", err)
+		}
+
+		if spec.Alert == "" || s.security == nil {
+			continue
+		}
+		_, err := s.security.GenerateAlert(spec.Alert, spec.Severity, spec.Title, description, map[string]interface{}{
+			"user_id":     userID.String(),
+			"domain":      domain,
+			"ip_address":  source.IPAddress,
+			"source":      "browser_extension",
+			"occurred_at": occurredAt.Format(time.RFC3339),
+			"event_id":    event.ID.String(),
+		})
+		if err != nil {
+			log.Printf("Failed to raise alert for extension event: %v", err)
+		}
+	}
+	return len(inputs), nil
+}
+
+// normalizeReportedDomain reduces a reported site to a lowercase public hostname without
+// its port or a leading "www.". IP addresses and single-label names are rejected.
+func normalizeReportedDomain(value string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.Contains(value, "://") {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return "", false
+		}
+		value = parsed.Hostname()
+	} else if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimPrefix(strings.TrimSuffix(value, "."), "www.")
+	if len(value) > 253 || net.ParseIP(value) != nil || !hostnamePattern.MatchString(value) {
+		return "", false
+	}
+	return value, true
+}
+
+func truncateString(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit]
+}
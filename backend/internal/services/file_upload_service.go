@@ -0,0 +1,407 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidUpload is returned for an empty file or an unknown purpose
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrUploadTooLarge is returned for a file over its purpose's size limit
+	ErrUploadTooLarge = errors.New("upload too large")
+	// ErrUploadTypeNotAllowed is returned when a file's sniffed content type is not allowed for its purpose
+	ErrUploadTypeNotAllowed = errors.New("upload content type not allowed")
+	// ErrUploadInfected is returned when the malware scanner flags a file
+	ErrUploadInfected = errors.New("upload failed malware scan")
+	// ErrUploadScanFailed is returned when a configured malware scanner cannot be reached
+	ErrUploadScanFailed = errors.New("upload could not be scanned")
+	// ErrUploadNotFound is returned when an upload does not exist or has expired
+	ErrUploadNotFound = errors.New("upload not found")
+)
+
+// uploadPolicy is what may be uploaded for a purpose and how long it is kept
+type uploadPolicy struct {
+	MaxBytes     int64
+	ContentTypes []string // sniffed media types; a trailing / allows a whole family
+	Retention    time.Duration
+	RetentionEnv string
+}
+
+var uploadPolicies = map[string]uploadPolicy{
+	models.UploadPurposeCaseEvidence: {
+		MaxBytes:     50 << 20,
+		ContentTypes: []string{"image/", "text/plain", "application/pdf", "application/zip", "application/x-gzip", "application/octet-stream"},
+		Retention:    365 * 24 * time.Hour,
+		RetentionEnv: "UPLOAD_EVIDENCE_RETENTION",
+	},
+	models.UploadPurposeComplianceReport: {
+		MaxBytes:     25 << 20,
+		ContentTypes: []string{"application/pdf", "text/plain", "application/zip"},
+		Retention:    7 * 365 * 24 * time.Hour,
+		RetentionEnv: "UPLOAD_REPORT_RETENTION",
+	},
+	models.UploadPurposeBulkImport: {
+		MaxBytes:     10 << 20,
+		ContentTypes: []string{"text/plain"}, // CSV and JSON sniff as text
+		Retention:    7 * 24 * time.Hour,
+		RetentionEnv: "UPLOAD_IMPORT_RETENTION",
+	},
+}
+
+// executableMagic identifies programs and scripts, which are refused for every purpose
+// even where arbitrary binary evidence is allowed. Windows PE files are checked by
+// isPortableExecutable, since "MZ" alone is also how some text starts.
+var executableMagic = [][]byte{
+	[]byte("\x7fELF"),        // Linux
+	{0xfe, 0xed, 0xfa, 0xce}, // Mach-O 32-bit
+	{0xfe, 0xed, 0xfa, 0xcf}, // Mach-O 64-bit
+	{0xcf, 0xfa, 0xed, 0xfe}, // Mach-O 64-bit, little endian
+	{0xca, 0xfe, 0xba, 0xbe}, // Mach-O universal, Java class
+	[]byte("#!"),             // scripts
+}
+
+// isPortableExecutable reports whether content has an MZ header pointing at a PE signature
+func isPortableExecutable(content []byte) bool {
+	if len(content) < 0x40 || !bytes.HasPrefix(content, []byte("MZ")) {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(content[0x3c:0x40]))
+	return offset+4 <= len(content) && bytes.Equal(content[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// UploadMaxBytes returns the size limit for a purpose, so oversized requests can be
+// refused before they are read
+func UploadMaxBytes(purpose string) (int64, bool) {
+	policy, ok := uploadPolicies[purpose]
+	return policy.MaxBytes, ok
+}
+
+// MalwareScanner checks an upload before it is stored
+type MalwareScanner interface {
+	Scan(ctx context.Context, filename string, content []byte) (infected bool, signature string, err error)
+}
+
+// HTTPMalwareScanner posts uploads to a scanning service, such as a ClamAV REST
+// wrapper, which answers {"infected": bool, "signature": "..."}
+type HTTPMalwareScanner struct {
+	URL    string
+	client *http.Client
+}
+
+// NewMalwareScannerFromEnv returns a scanner for UPLOAD_SCAN_URL, or nil when uploads are
+// not scanned
+func NewMalwareScannerFromEnv() MalwareScanner {
+	scanURL := getEnv("UPLOAD_SCAN_URL", "")
+	if scanURL == "" {
+		return nil
+	}
+	return &HTTPMalwareScanner{URL: scanURL, client: &http.Client{Timeout: 60 * time.Second}}
+}
+
+// Scan sends the content to the scanning service
+func (s *HTTPMalwareScanner) Scan(ctx context.Context, filename string, content []byte) (bool, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(content))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Filename", filename)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to reach malware scanner: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, "", fmt.Errorf("malware scanner returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, "", fmt.Errorf("failed to decode malware scan result: %w", err)
+	}
+	return result.Infected, result.Signature, nil
+}
+
+// UploadInput is a file being uploaded
+type UploadInput struct {
+	Purpose    string
+	Filename   string
+	Content    []byte
+	UploadedBy *uuid.UUID
+	IPAddress  string
+}
+
+// FileUploadService accepts evidence, report and import files. The content type is
+// sniffed rather than trusted, executables are always refused, files are scanned for
+// malware when a scanner is configured, and each purpose's retention decides when a file
+// is deleted from storage.
+type FileUploadService struct {
+	db       *gorm.DB
+	store    ObjectStore
+	scanner  MalwareScanner
+	security *SecurityMonitoringService
+	urlTTL   time.Duration
+}
+
+// NewFileUploadService creates a new file upload service. The scanner and the security
+// monitoring service, which raises malware alerts, may be nil.
+func NewFileUploadService(db *gorm.DB, store ObjectStore, scanner MalwareScanner, security *SecurityMonitoringService) *FileUploadService {
+	return &FileUploadService{
+		db:       db,
+		store:    store,
+		scanner:  scanner,
+		security: security,
+		urlTTL:   envDuration("UPLOAD_URL_TTL", 15*time.Minute),
+	}
+}
+
+// Interval is how often expired uploads should be purged
+func (s *FileUploadService) Interval() time.Duration {
+	return time.Hour
+}
+
+// LocalStore returns the store when uploads are kept on local disk, whose download URLs
+// CloudGate serves itself
+func (s *FileUploadService) LocalStore() *LocalObjectStore {
+	local, _ := s.store.(*LocalObjectStore)
+	return local
+}
+
+// Upload checks and stores a file
+func (s *FileUploadService) Upload(ctx context.Context, input UploadInput, now time.Time) (*models.FileUpload, error) {
+	policy, ok := uploadPolicies[input.Purpose]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown purpose %q", ErrInvalidUpload, input.Purpose)
+	}
+	if len(input.Content) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidUpload)
+	}
+	if int64(len(input.Content)) > policy.MaxBytes {
+		return nil, fmt.Errorf("%w: %s uploads are limited to %d bytes", ErrUploadTooLarge, input.Purpose, policy.MaxBytes)
+	}
+
+	contentType, err := sniffUploadType(input.Content, policy)
+	if err != nil {
+		return nil, err
+	}
+	filename := sanitizeFilename(input.Filename)
+
+	scanStatus := models.UploadScanNotScanned
+	if s.scanner != nil {
+		infected, signature, err := s.scanner.Scan(ctx, filename, input.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUploadScanFailed, err)
+		}
+		if infected {
+			s.raiseMalwareAlert(input, filename, signature)
+			s.audit(input.UploadedBy, "file_upload_rejected", "", "failure", fmt.Sprintf("Rejected %s (%s): %s", filename, input.Purpose, signature))
+			return nil, fmt.Errorf("%w: %s", ErrUploadInfected, signature)
+		}
+		scanStatus = models.UploadScanClean
+	}
+
+	sum := sha256.Sum256(input.Content)
+	upload := models.FileUpload{
+		ID:          uuid.New(),
+		Purpose:     input.Purpose,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(input.Content)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		ScanStatus:  scanStatus,
+		UploadedBy:  input.UploadedBy,
+		ExpiresAt:   now.Add(envDuration(policy.RetentionEnv, policy.Retention)),
+		CreatedAt:   now,
+	}
+	upload.StorageKey = fmt.Sprintf("%s/%s/%s", upload.Purpose, now.UTC().Format("2006/01"), upload.ID)
+
+	if err := s.store.Put(ctx, upload.StorageKey, contentType, input.Content); err != nil {
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := s.db.Create(&upload).Error; err != nil {
+		if delErr := s.store.Delete(ctx, upload.StorageKey); delErr != nil {
+			log.Printf("Failed to remove orphaned upload %s: %v", upload.StorageKey, delErr)
+		}
+		return nil, fmt.Errorf("failed to record upload: %w", err)
+	}
+
+	s.audit(input.UploadedBy, "file_uploaded", upload.ID.String(), "success", fmt.Sprintf("Uploaded %s (%s, %d bytes)", filename, input.Purpose, upload.Size))
+	return &upload, nil
+}
+
+// sniffUploadType detects the content type from the content and checks it against the
+// purpose's allowed types
+func sniffUploadType(content []byte, policy uploadPolicy) (string, error) {
+	executable := isPortableExecutable(content)
+	for _, magic := range executableMagic {
+		executable = executable || bytes.HasPrefix(content, magic)
+	}
+	if executable {
+		return "", fmt.Errorf("%w: executables are not accepted", ErrUploadTypeNotAllowed)
+	}
+	detected := http.DetectContentType(content)
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	for _, allowed := range policy.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return mediaType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUploadTypeNotAllowed, mediaType)
+}
+
+// sanitizeFilename keeps the base name without control characters, for display and
+// Content-Disposition only; storage keys never use it
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "upload"
+	}
+	return name
+}
+
+func (s *FileUploadService) raiseMalwareAlert(input UploadInput, filename, signature string) {
+	log.Printf("🚨 Malware upload rejected: %s (%s)", filename, signature)
+	if s.security == nil {
+		return
+	}
+	metadata := map[string]interface{}{
+		"purpose":    input.Purpose,
+		"filename":   filename,
+		"signature":  signature,
+		"ip_address": input.IPAddress,
+	}
+	if input.UploadedBy != nil {
+		metadata["user_id"] = input.UploadedBy.String()
+	}
+	_, err := s.security.GenerateAlert(
+		AlertTypeMalwareUpload,
+		SeverityHigh,
+		"Malware upload rejected",
+		fmt.Sprintf("Upload %s for %s was flagged as %s and rejected", filename, strings.ReplaceAll(input.Purpose, "_", " "), signature),
+		metadata,
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to raise malware upload alert: %v", err)
+	}
+}
+
+// Get returns an upload that has not expired
+func (s *FileUploadService) Get(id uuid.UUID, now time.Time) (*models.FileUpload, error) {
+	var upload models.FileUpload
+	result := s.db.Where("id = ? AND expires_at > ?", id, now).Limit(1).Find(&upload)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUploadNotFound
+	}
+	return &upload, nil
+}
+
+// DownloadURL returns a short-lived signed URL for an upload and when it stops working
+func (s *FileUploadService) DownloadURL(id uuid.UUID, actor *uuid.UUID, now time.Time) (string, time.Time, error) {
+	upload, err := s.Get(id, now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	signedURL, err := s.store.SignedURL(upload.StorageKey, upload.Filename, s.urlTTL, now)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign download URL: %w", err)
+	}
+
+	s.audit(actor, "file_download_url_issued", upload.ID.String(), "success", fmt.Sprintf("Issued download URL for %s", upload.Filename))
+	return signedURL, now.Add(s.urlTTL), nil
+}
+
+// Delete removes an upload from storage and its record
+func (s *FileUploadService) Delete(ctx context.Context, id uuid.UUID, actor *uuid.UUID, now time.Time) error {
+	upload, err := s.Get(id, now)
+	if err != nil {
+		return err
+	}
+	if err := s.remove(ctx, upload); err != nil {
+		return err
+	}
+
+	s.audit(actor, "file_upload_deleted", upload.ID.String(), "success", fmt.Sprintf("Deleted %s (%s)", upload.Filename, upload.Purpose))
+	return nil
+}
+
+// PurgeExpired deletes uploads past their purpose's retention, returning how many went
+func (s *FileUploadService) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	var expired []models.FileUpload
+	if err := s.db.Where("expires_at <= ?", now).Limit(500).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+	purged := 0
+	for i := range expired {
+		if err := s.remove(ctx, &expired[i]); err != nil {
+			log.Printf("Failed to purge upload %s: %v", expired[i].ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// remove deletes the object before the record, so a failed delete is retried by the
+// next purge rather than leaving an untracked object behind
+func (s *FileUploadService) remove(ctx context.Context, upload *models.FileUpload) error {
+	if err := s.store.Delete(ctx, upload.StorageKey); err != nil {
+		return fmt.Errorf("failed to delete stored upload: %w", err)
+	}
+	if err := s.db.Delete(upload).Error; err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+func (s *FileUploadService) audit(actor *uuid.UUID, action, resourceID, status, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "file_upload",
+		ResourceID: resourceID,
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit file upload: %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ErrGeoIPNotFound is returned when a GeoIP provider does not know where an IP address is
+var ErrGeoIPNotFound = errors.New("IP address location not found")
+
+// highRiskCountries are the countries sign-ins from which raise location risk and
+// suspicious-location alerts
+var highRiskCountries = []string{"CN", "RU", "KP", "IR"}
+
+// geoIP locates IP addresses for the risk engine, adaptive authentication and the security
+// monitor. It is set by SetGeoIPService; when nil no IP address can be located.
+var geoIP GeoIPService
+
+// GeoIPService resolves an IP address to where it is and the network that announces it
+type GeoIPService interface {
+	Lookup(ctx context.Context, ipAddress string) (*GeoLocation, error)
+}
+
+// SetGeoIPService makes the risk engine, adaptive authentication and security monitor
+// locate IP addresses with the service
+func SetGeoIPService(s GeoIPService) {
+	geoIP = s
+}
+
+// LocateIP resolves a public IP address, or returns nil when GeoIP is off, the address is
+// private or it cannot be located. Lookup failures never fail the caller.
+func LocateIP(ctx context.Context, ipAddress string) *GeoLocation {
+	if geoIP == nil {
+		return nil
+	}
+	ip := net.ParseIP(ipAddress)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() {
+		return nil
+	}
+	location, err := geoIP.Lookup(ctx, ip.String())
+	if err != nil {
+		if !errors.Is(err, ErrGeoIPNotFound) {
+			log.Printf("Failed to locate %s: %v", ipAddress, err)
+		}
+		return nil
+	}
+	return location
+}
+
+// isHighRiskCountry reports whether sign-ins from the ISO country code are high risk
+func isHighRiskCountry(country string) bool {
+	for _, highRisk := range highRiskCountries {
+		if country == highRisk {
+			return true
+		}
+	}
+	return false
+}
+
+// NewGeoIPServiceFromEnv returns a cached GeoIP service reading the MaxMind GeoLite2 City
+// database at GEOIP_CITY_DB, with ASN data from GEOIP_ASN_DB, and falling back to ip-api
+// when GEOIP_IPAPI_ENABLED is true. It returns nil when neither is configured.
+func NewGeoIPServiceFromEnv() (GeoIPService, error) {
+	var providers geoIPChain
+	if cityPath := getEnv("GEOIP_CITY_DB", ""); cityPath != "" {
+		maxMind, err := OpenMaxMindGeoIP(cityPath, getEnv("GEOIP_ASN_DB", ""))
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, maxMind)
+	}
+	if getEnv("GEOIP_IPAPI_ENABLED", "false") == "true" {
+		providers = append(providers, NewIPAPIGeoIP(getEnv("GEOIP_IPAPI_URL", "http://ip-api.com"), getEnv("GEOIP_IPAPI_KEY", "")))
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+
+	var service GeoIPService = providers
+	if len(providers) == 1 {
+		service = providers[0]
+	}
+	maxEntries, err := strconv.Atoi(getEnv("GEOIP_CACHE_SIZE", "10000"))
+	if err != nil || maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return NewCachedGeoIP(service, envDuration("GEOIP_CACHE_TTL", 24*time.Hour), maxEntries), nil
+}
+
+// geoIPChain asks each provider in turn, so ip-api covers addresses the local database
+// does not know
+type geoIPChain []GeoIPService
+
+// Lookup returns the first provider's answer, or the last error when none knows the address
+func (c geoIPChain) Lookup(ctx context.Context, ipAddress string) (*GeoLocation, error) {
+	err := ErrGeoIPNotFound
+	for _, provider := range c {
+		var location *GeoLocation
+		if location, err = provider.Lookup(ctx, ipAddress); err == nil {
+			return location, nil
+		}
+	}
+	return nil, err
+}
+
+// MaxMindGeoIP locates IP addresses with local MaxMind GeoLite2 or GeoIP2 databases
+type MaxMindGeoIP struct {
+	city *geoip2.Reader
+	asn  *geoip2.Reader // optional
+}
+
+// OpenMaxMindGeoIP opens a City database and, when asnPath is set, an ASN database
+func OpenMaxMindGeoIP(cityPath, asnPath string) (*MaxMindGeoIP, error) {
+	city, err := geoip2.Open(cityPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP city database: %w", err)
+	}
+	m := &MaxMindGeoIP{city: city}
+	if asnPath != "" {
+		if m.asn, err = geoip2.Open(asnPath); err != nil {
+			city.Close()
+			return nil, fmt.Errorf("failed to open GeoIP ASN database: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// Lookup reads the address's city record and, when available, its autonomous system
+func (m *MaxMindGeoIP) Lookup(ctx context.Context, ipAddress string) (*GeoLocation, error) {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidIPAddress, ipAddress)
+	}
+	record, err := m.city.City(ip)
+	if err != nil {
+		return nil, err
+	}
+	if record.Country.IsoCode == "" {
+		return nil, ErrGeoIPNotFound
+	}
+
+	location := &GeoLocation{
+		Country:     record.Country.IsoCode,
+		City:        record.City.Names["en"],
+		Latitude:    record.Location.Latitude,
+		Longitude:   record.Location.Longitude,
+		Timezone:    record.Location.TimeZone,
+		VPNDetected: record.Traits.IsAnonymousProxy,
+	}
+	if len(record.Subdivisions) > 0 {
+		location.Region = record.Subdivisions[0].Names["en"]
+	}
+	if m.asn != nil {
+		if asn, err := m.asn.ASN(ip); err == nil && asn.AutonomousSystemNumber != 0 {
+			location.ASN = asn.AutonomousSystemNumber
+			location.ASOrganization = asn.AutonomousSystemOrganization
+			location.ISP = asn.AutonomousSystemOrganization
+		}
+	}
+	return location, nil
+}
+
+// Close closes the databases
+func (m *MaxMindGeoIP) Close() error {
+	if m.asn != nil {
+		m.asn.Close()
+	}
+	return m.city.Close()
+}
+
+// IPAPIGeoIP locates IP addresses with the ip-api.com JSON API. Without a key it uses the
+// free endpoint, which is limited to 45 requests a minute.
+type IPAPIGeoIP struct {
+	BaseURL string
+	Key     string
+	client  *http.Client
+}
+
+// NewIPAPIGeoIP creates an ip-api client; a key selects the pro endpoint
+func NewIPAPIGeoIP(baseURL, key string) *IPAPIGeoIP {
+	if key != "" && baseURL == "http://ip-api.com" {
+		baseURL = "https://pro.ip-api.com"
+	}
+	return &IPAPIGeoIP{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Key:     key,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Lookup queries ip-api for the address
+func (p *IPAPIGeoIP) Lookup(ctx context.Context, ipAddress string) (*GeoLocation, error) {
+	query := url.Values{"fields": {"status,message,countryCode,regionName,city,lat,lon,timezone,isp,as,asname,proxy,hosting"}}
+	if p.Key != "" {
+		query.Set("key", p.Key)
+	}
+	ctx, cancel := withProvider(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/json/"+url.PathEscape(ipAddress)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach ip-api: %w", err)
+	}
+	var result struct {
+		Status      string  `json:"status"`
+		Message     string  `json:"message"`
+		CountryCode string  `json:"countryCode"`
+		RegionName  string  `json:"regionName"`
+		City        string  `json:"city"`
+		Lat         float64 `json:"lat"`
+		Lon         float64 `json:"lon"`
+		Timezone    string  `json:"timezone"`
+		ISP         string  `json:"isp"`
+		AS          string  `json:"as"` // "AS15169 Google LLC"
+		ASName      string  `json:"asname"`
+		Proxy       bool    `json:"proxy"`
+		Hosting     bool    `json:"hosting"`
+	}
+	if err := decodeProviderResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	if result.Status != "success" || result.CountryCode == "" {
+		// Private and reserved ranges and unknown addresses answer "fail"
+		return nil, fmt.Errorf("%w: %s", ErrGeoIPNotFound, result.Message)
+	}
+
+	location := &GeoLocation{
+		Country:        result.CountryCode,
+		Region:         result.RegionName,
+		City:           result.City,
+		Latitude:       result.Lat,
+		Longitude:      result.Lon,
+		ISP:            result.ISP,
+		Timezone:       result.Timezone,
+		VPNDetected:    result.Proxy || result.Hosting,
+		ASOrganization: result.ASName,
+	}
+	if number, _, _ := strings.Cut(result.AS, " "); strings.HasPrefix(number, "AS") {
+		if asn, err := strconv.ParseUint(strings.TrimPrefix(number, "AS"), 10, 32); err == nil {
+			location.ASN = uint(asn)
+		}
+	}
+	return location, nil
+}
+
+// geoIPCacheEntry is a cached lookup; a nil location caches a miss
+type geoIPCacheEntry struct {
+	location  *GeoLocation
+	expiresAt time.Time
+}
+
+// CachedGeoIP remembers lookups, including addresses that could not be located, so
+// repeated sign-ins from an address do not query the provider again
+type CachedGeoIP struct {
+	next       GeoIPService
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]geoIPCacheEntry
+}
+
+// NewCachedGeoIP caches up to maxEntries lookups from next for ttl
+func NewCachedGeoIP(next GeoIPService, ttl time.Duration, maxEntries int) *CachedGeoIP {
+	return &CachedGeoIP{
+		next:       next,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]geoIPCacheEntry),
+	}
+}
+
+// Lookup answers from the cache, asking the provider on a miss. Provider errors other
+// than not found are not cached, so an outage does not hide locations for a whole TTL.
+func (c *CachedGeoIP) Lookup(ctx context.Context, ipAddress string) (*GeoLocation, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[ipAddress]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return cachedLocation(entry.location)
+	}
+
+	location, err := c.next.Lookup(ctx, ipAddress)
+	if err != nil && !errors.Is(err, ErrGeoIPNotFound) {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[ipAddress] = geoIPCacheEntry{location: location, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+	return cachedLocation(location)
+}
+
+// evict drops expired entries and, when none have expired, an arbitrary tenth of the cache.
+// Callers hold the lock.
+func (c *CachedGeoIP) evict(now time.Time) {
+	for ip, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, ip)
+		}
+	}
+	for ip := range c.entries {
+		if len(c.entries) < c.maxEntries-c.maxEntries/10 {
+			break
+		}
+		delete(c.entries, ip)
+	}
+}
+
+// cachedLocation copies a cached location so callers cannot change the cache
+func cachedLocation(location *GeoLocation) (*GeoLocation, error) {
+	if location == nil {
+		return nil, ErrGeoIPNotFound
+	}
+	copied := *location
+	return &copied, nil
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/pkg/constants"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// HeaderProxySecretHeader carries an app's shared secret so its upstream can reject
+// requests that did not come through CloudGate
+const HeaderProxySecretHeader = "X-Cloudgate-Proxy-Secret"
+
+// Identity headers used when an app does not name its own
+const (
+	DefaultHeaderProxyUserHeader   = "X-Remote-User"
+	DefaultHeaderProxyGroupsHeader = "X-Remote-Groups"
+)
+
+var (
+	// ErrHeaderProxyNotFound is returned when an app has no header proxy configuration
+	ErrHeaderProxyNotFound = errors.New("header proxy app not found")
+	// ErrInvalidHeaderProxy is returned for malformed upstreams, header names or groups
+	ErrInvalidHeaderProxy = errors.New("invalid header proxy configuration")
+	// ErrHeaderProxyDisabled is returned when an app's proxy is switched off
+	ErrHeaderProxyDisabled = errors.New("header proxy app is disabled")
+	// ErrHeaderProxyNotAssigned is returned when an app requires an assignment the user lacks
+	ErrHeaderProxyNotAssigned = errors.New("user is not assigned to this app")
+	// ErrHeaderProxyAssignmentNotFound is returned when a user has no assignment to remove
+	ErrHeaderProxyAssignmentNotFound = errors.New("header proxy assignment not found")
+)
+
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// reservedProxyHeaders are never accepted as identity headers
+var reservedProxyHeaders = map[string]bool{
+	"Authorization": true, "Cookie": true, "Host": true, "Connection": true, "Content-Length": true,
+	"Content-Type": true, "Transfer-Encoding": true, "X-Forwarded-For": true, "X-Forwarded-Host": true,
+	"X-Forwarded-Proto": true, HeaderProxySecretHeader: true,
+}
+
+// HeaderProxyInput describes an app's upstream as entered by an admin
+type HeaderProxyInput struct {
+	UpstreamURL       string
+	UserHeader        string
+	EmailHeader       string
+	GroupsHeader      string
+	DefaultGroups     []string
+	SharedSecret      string
+	RequireAssignment bool
+	Enabled           bool
+}
+
+// HeaderProxyIdentity is who CloudGate tells the upstream the user is
+type HeaderProxyIdentity struct {
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Groups   []string `json:"groups"`
+}
+
+// HeaderProxyService lets CloudGate front internal apps that use trusted-header auth.
+// Requests to /proxy/<app>/ are forwarded to the app's upstream once the usual launch
+// policies pass, with the user's identity injected and anything the browser sent in those
+// headers, or CloudGate's own credentials, stripped.
+type HeaderProxyService struct {
+	db        *gorm.DB
+	transport http.RoundTripper
+}
+
+// NewHeaderProxyService creates the header proxy service. HEADER_PROXY_TIMEOUT bounds how
+// long an upstream may take to start responding.
+func NewHeaderProxyService(db *gorm.DB) *HeaderProxyService {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = envDuration("HEADER_PROXY_TIMEOUT", 30*time.Second)
+	return &HeaderProxyService{db: db, transport: transport}
+}
+
+// SetApp creates or replaces the header proxy configuration for an app
+func (s *HeaderProxyService) SetApp(appID string, input HeaderProxyInput, actor *uuid.UUID) (*models.HeaderProxyApp, error) {
+	if app, ok := GetSaaSApp(appID); !ok || app.Protocol != constants.ProtocolHeaderProxy {
+		return nil, fmt.Errorf("%w: %s does not sign in through the header proxy", ErrInvalidHeaderProxy, appID)
+	}
+	upstream, err := url.Parse(strings.TrimSpace(input.UpstreamURL))
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		return nil, fmt.Errorf("%w: upstream_url must be an absolute http(s) URL", ErrInvalidHeaderProxy)
+	}
+	if upstream.User != nil || upstream.RawQuery != "" || upstream.Fragment != "" {
+		return nil, fmt.Errorf("%w: upstream_url must not carry credentials, a query or a fragment", ErrInvalidHeaderProxy)
+	}
+
+	if input.UserHeader == "" {
+		input.UserHeader = DefaultHeaderProxyUserHeader
+	}
+	if input.GroupsHeader == "" {
+		input.GroupsHeader = DefaultHeaderProxyGroupsHeader
+	}
+	seen := make(map[string]bool)
+	headers := []*string{&input.UserHeader, &input.EmailHeader, &input.GroupsHeader}
+	for _, header := range headers {
+		if *header == "" {
+			continue
+		}
+		if !headerNamePattern.MatchString(*header) {
+			return nil, fmt.Errorf("%w: %q is not a valid header name", ErrInvalidHeaderProxy, *header)
+		}
+		*header = textproto.CanonicalMIMEHeaderKey(*header)
+		if reservedProxyHeaders[*header] || seen[*header] {
+			return nil, fmt.Errorf("%w: %s cannot be used as an identity header", ErrInvalidHeaderProxy, *header)
+		}
+		seen[*header] = true
+	}
+	groups, err := normalizeProxyGroups(input.DefaultGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.HeaderProxyApp
+	err = s.db.Where("app_id = ?", appID).First(&config).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get header proxy app: %w", err)
+	}
+
+	config.AppID = appID
+	config.UpstreamURL = strings.TrimSuffix(upstream.String(), "/")
+	config.UserHeader = input.UserHeader
+	config.EmailHeader = input.EmailHeader
+	config.GroupsHeader = input.GroupsHeader
+	config.DefaultGroups = strings.Join(groups, ",")
+	config.SharedSecret = input.SharedSecret
+	config.RequireAssignment = input.RequireAssignment
+	config.Enabled = input.Enabled
+	config.UpdatedBy = actor
+
+	if err := s.db.Save(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to save header proxy app: %w", err)
+	}
+
+	s.audit(actor, "header_proxy_updated", appID, fmt.Sprintf("upstream=%s user_header=%s groups_header=%s require_assignment=%t enabled=%t",
+		config.UpstreamURL, config.UserHeader, config.GroupsHeader, config.RequireAssignment, config.Enabled))
+	// The configuration holds the upstream's shared secret, so it is versioned without a snapshot
+	recordConfigChange(ConfigKindPolicies, "header_proxy:"+appID, actor, "Header proxy configuration updated", nil)
+	return &config, nil
+}
+
+// GetApp returns the header proxy configuration for an app
+func (s *HeaderProxyService) GetApp(appID string) (*models.HeaderProxyApp, error) {
+	var config models.HeaderProxyApp
+	err := s.db.Where("app_id = ?", appID).First(&config).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrHeaderProxyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header proxy app: %w", err)
+	}
+	return &config, nil
+}
+
+// ListApps returns every configured header proxy app
+func (s *HeaderProxyService) ListApps() ([]models.HeaderProxyApp, error) {
+	var configs []models.HeaderProxyApp
+	if err := s.db.Order("app_id ASC").Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list header proxy apps: %w", err)
+	}
+	return configs, nil
+}
+
+// DeleteApp removes an app's header proxy configuration and its assignments
+func (s *HeaderProxyService) DeleteApp(appID string, actor *uuid.UUID) error {
+	result := s.db.Where("app_id = ?", appID).Delete(&models.HeaderProxyApp{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete header proxy app: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrHeaderProxyNotFound
+	}
+	if err := s.db.Where("app_id = ?", appID).Delete(&models.HeaderProxyAssignment{}).Error; err != nil {
+		return fmt.Errorf("failed to delete header proxy assignments: %w", err)
+	}
+
+	s.audit(actor, "header_proxy_deleted", appID, "Header proxy configuration removed")
+	recordConfigChange(ConfigKindPolicies, "header_proxy:"+appID, actor, "Header proxy configuration removed", nil)
+	return nil
+}
+
+// SetAssignment gives a user access to a header proxy app with the groups sent for them
+func (s *HeaderProxyService) SetAssignment(appID string, userID uuid.UUID, groups []string, actor *uuid.UUID) (*models.HeaderProxyAssignment, error) {
+	if _, err := s.GetApp(appID); err != nil {
+		return nil, err
+	}
+	normalized, err := normalizeProxyGroups(groups)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := s.db.Select("id").First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: unknown user %s", ErrInvalidHeaderProxy, userID)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var assignment models.HeaderProxyAssignment
+	err = s.db.Where("app_id = ? AND user_id = ?", appID, userID).First(&assignment).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get header proxy assignment: %w", err)
+	}
+
+	assignment.AppID = appID
+	assignment.UserID = userID
+	assignment.Groups = strings.Join(normalized, ",")
+	assignment.UpdatedBy = actor
+	if err := s.db.Save(&assignment).Error; err != nil {
+		return nil, fmt.Errorf("failed to save header proxy assignment: %w", err)
+	}
+
+	s.audit(actor, "header_proxy_assigned", appID, fmt.Sprintf("user=%s groups=%s", userID, assignment.Groups))
+	return &assignment, nil
+}
+
+// ListAssignments returns the users assigned to a header proxy app
+func (s *HeaderProxyService) ListAssignments(appID string) ([]models.HeaderProxyAssignment, error) {
+	var assignments []models.HeaderProxyAssignment
+	if err := s.db.Where("app_id = ?", appID).Order("created_at ASC").Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list header proxy assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+// DeleteAssignment removes a user's assignment to a header proxy app
+func (s *HeaderProxyService) DeleteAssignment(appID string, userID uuid.UUID, actor *uuid.UUID) error {
+	result := s.db.Where("app_id = ? AND user_id = ?", appID, userID).Delete(&models.HeaderProxyAssignment{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete header proxy assignment: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrHeaderProxyAssignmentNotFound
+	}
+
+	s.audit(actor, "header_proxy_unassigned", appID, fmt.Sprintf("user=%s", userID))
+	return nil
+}
+
+// Authorize returns the app's configuration and the identity to inject for a user, or
+// why they may not use the app
+func (s *HeaderProxyService) Authorize(appID string, userID uuid.UUID, username, email string) (*models.HeaderProxyApp, *HeaderProxyIdentity, error) {
+	config, err := s.GetApp(appID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !config.Enabled {
+		return nil, nil, ErrHeaderProxyDisabled
+	}
+
+	groups := splitProxyGroups(config.DefaultGroups)
+	var assignment models.HeaderProxyAssignment
+	err = s.db.Where("app_id = ? AND user_id = ?", appID, userID).First(&assignment).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		if config.RequireAssignment {
+			return nil, nil, ErrHeaderProxyNotAssigned
+		}
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to get header proxy assignment: %w", err)
+	default:
+		for _, group := range splitProxyGroups(assignment.Groups) {
+			if !slices.Contains(groups, group) {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	return config, &HeaderProxyIdentity{Username: username, Email: email, Groups: groups}, nil
+}
+
+// NewProxy builds a reverse proxy that forwards a request for path (relative to the app's
+// proxy prefix) to the upstream as the given identity
+func (s *HeaderProxyService) NewProxy(config *models.HeaderProxyApp, identity *HeaderProxyIdentity, path string) (*httputil.ReverseProxy, error) {
+	upstream, err := url.Parse(config.UpstreamURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeaderProxy, err)
+	}
+	prefix := "/proxy/" + config.AppID
+
+	return &httputil.ReverseProxy{
+		Transport: s.transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.Out.URL.Path = strings.TrimSuffix(upstream.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+			pr.Out.URL.RawPath = ""
+			pr.SetXForwarded()
+
+			// Nothing the browser sends may pose as the identity, and CloudGate's own
+			// credentials never reach the app
+			stripIdentityHeaders(pr.Out.Header, config)
+			pr.Out.Header.Del("Authorization")
+			stripCloudGateCookies(pr.Out)
+
+			pr.Out.Header.Set(config.UserHeader, identity.Username)
+			if config.EmailHeader != "" {
+				pr.Out.Header.Set(config.EmailHeader, identity.Email)
+			}
+			if config.GroupsHeader != "" {
+				pr.Out.Header.Set(config.GroupsHeader, strings.Join(identity.Groups, ","))
+			}
+			if config.SharedSecret != "" {
+				pr.Out.Header.Set(HeaderProxySecretHeader, config.SharedSecret)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Keep the browser on the proxy when the app redirects to its own address
+			if location := resp.Header.Get("Location"); strings.HasPrefix(location, config.UpstreamURL) {
+				resp.Header.Set("Location", prefix+"/"+strings.TrimPrefix(strings.TrimPrefix(location, config.UpstreamURL), "/"))
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Header proxy error for %s: %v", config.AppID, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"error":"Upstream unavailable"}`))
+		},
+	}, nil
+}
+
+// LogRequest records a proxied request
+func (s *HeaderProxyService) LogRequest(entry *models.HeaderProxyRequestLog) {
+	if err := s.db.Create(entry).Error; err != nil {
+		log.Printf("Failed to log header proxy request: %v", err)
+	}
+}
+
+// ListRequestLogs returns the most recent proxied requests for an app, optionally for one user
+func (s *HeaderProxyService) ListRequestLogs(appID string, userID *uuid.UUID, limit int) ([]models.HeaderProxyRequestLog, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.db.Where("app_id = ?", appID)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	var logs []models.HeaderProxyRequestLog
+	if err := query.Order("created_at DESC").Limit(limit).Find(&logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list header proxy requests: %w", err)
+	}
+	return logs, nil
+}
+
+// stripIdentityHeaders removes the app's identity and secret headers from a request,
+// including spellings with underscores that some servers treat as the same header
+func stripIdentityHeaders(header http.Header, config *models.HeaderProxyApp) {
+	protected := map[string]bool{HeaderProxySecretHeader: true}
+	for _, name := range []string{config.UserHeader, config.EmailHeader, config.GroupsHeader} {
+		if name != "" {
+			protected[textproto.CanonicalMIMEHeaderKey(name)] = true
+		}
+	}
+	for name := range header {
+		if protected[textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(name, "_", "-"))] {
+			delete(header, name)
+		}
+	}
+}
+
+// stripCloudGateCookies removes CloudGate's session cookies from a proxied request
+func stripCloudGateCookies(req *http.Request) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name == "access_token" || cookie.Name == "refresh_token" {
+			continue
+		}
+		req.AddCookie(cookie)
+	}
+}
+
+func normalizeProxyGroups(groups []string) ([]string, error) {
+	normalized := make([]string, 0, len(groups))
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		if strings.ContainsAny(group, ",\r\n") {
+			return nil, fmt.Errorf("%w: group %q may not contain commas or line breaks", ErrInvalidHeaderProxy, group)
+		}
+		if !slices.Contains(normalized, group) {
+			normalized = append(normalized, group)
+		}
+	}
+	return normalized, nil
+}
+
+func splitProxyGroups(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func (s *HeaderProxyService) audit(actor *uuid.UUID, action, appID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "header_proxy_app",
+		ResourceID: appID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit header proxy event: %v", err)
+	}
+}
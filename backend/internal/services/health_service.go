@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status of a dependency in a readiness report
+const (
+	DependencyUp       = "up"
+	DependencyDown     = "down"
+	DependencyDisabled = "disabled"
+)
+
+// Overall status of a readiness report
+const (
+	HealthReady    = "ready"
+	HealthDegraded = "degraded"
+	HealthNotReady = "not_ready"
+)
+
+// DependencyHealth is the result of checking one dependency
+type DependencyHealth struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthReport is the readiness of this instance and of each dependency it checked
+type HealthReport struct {
+	Status    string                      `json:"status"`
+	CheckedAt time.Time                   `json:"checked_at"`
+	Checks    map[string]DependencyHealth `json:"checks"`
+}
+
+// Ready reports whether the instance should be sent traffic
+func (r *HealthReport) Ready() bool {
+	return r.Status != HealthNotReady
+}
+
+// pinger is a cache that can check its server answers, as Redis can
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// errDependencyDisabled marks a dependency that is not configured
+var errDependencyDisabled = errors.New("not configured")
+
+type dependencyCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+// HealthService checks the dependencies an instance needs to serve requests, for the
+// readiness probe. The database, Redis when REDIS_URL is set and the background workers
+// are critical; the instance still serves local sign-ins when Keycloak is unreachable, so
+// that only degrades it, as does a SIEM sink whose last delivery failed. Each check gives
+// up after HEALTH_CHECK_TIMEOUT, and a background loop is stalled after
+// HEALTH_WORKER_STALL_AFTER without a heartbeat.
+type HealthService struct {
+	db         *gorm.DB
+	workers    *Workers
+	client     *http.Client
+	keycloak   string
+	timeout    time.Duration
+	stallAfter time.Duration
+	forwarder  *EventForwarder
+}
+
+// NewHealthService creates a health service from the environment. Keycloak is checked
+// through the discovery document of KEYCLOAK_ISSUER, or of the realm KEYCLOAK_REALM on the
+// server at KEYCLOAK_URL.
+func NewHealthService(db *gorm.DB, workers *Workers) *HealthService {
+	issuer := strings.TrimRight(os.Getenv("KEYCLOAK_ISSUER"), "/")
+	if issuer == "" && os.Getenv("KEYCLOAK_URL") != "" && os.Getenv("KEYCLOAK_REALM") != "" {
+		issuer = strings.TrimRight(os.Getenv("KEYCLOAK_URL"), "/") + "/realms/" + os.Getenv("KEYCLOAK_REALM")
+	}
+	timeout := envDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	return &HealthService{
+		db:         db,
+		workers:    workers,
+		client:     TracedHTTPClient(timeout),
+		keycloak:   issuer,
+		timeout:    timeout,
+		stallAfter: envDuration("HEALTH_WORKER_STALL_AFTER", 15*time.Minute),
+	}
+}
+
+// SetEventForwarder adds the SIEM sinks to the report; failing deliveries only degrade it
+func (s *HealthService) SetEventForwarder(forwarder *EventForwarder) {
+	s.forwarder = forwarder
+}
+
+// Check runs every dependency check at once and reports not_ready when a critical one
+// fails, degraded when another does and ready otherwise
+func (s *HealthService) Check(ctx context.Context) *HealthReport {
+	checks := []dependencyCheck{
+		{name: "database", critical: true, check: s.checkDatabase},
+		{name: "redis", critical: true, check: s.checkRedis},
+		{name: "keycloak", check: s.checkKeycloak},
+		{name: "workers", critical: true, check: s.checkWorkers},
+		{name: "siem", check: s.checkSIEM},
+	}
+	report := &HealthReport{Status: HealthReady, CheckedAt: time.Now().UTC(), Checks: make(map[string]DependencyHealth)}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, dependency := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started := time.Now()
+			err := dependency.check(ctx)
+			result := DependencyHealth{Status: DependencyUp, Critical: dependency.critical, LatencyMs: time.Since(started).Milliseconds()}
+			switch {
+			case errors.Is(err, errDependencyDisabled):
+				result = DependencyHealth{Status: DependencyDisabled}
+			case err != nil:
+				result.Status = DependencyDown
+				result.Error = err.Error()
+			}
+			mutex.Lock()
+			report.Checks[dependency.name] = result
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != DependencyDown {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthNotReady
+		} else if report.Status == HealthReady {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) error {
+	if s.db == nil {
+		return errors.New("database not initialized")
+	}
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (s *HealthService) checkRedis(ctx context.Context) error {
+	cache, ok := SharedCache().(pinger)
+	if !ok {
+		return errDependencyDisabled
+	}
+	return cache.Ping(ctx)
+}
+
+func (s *HealthService) checkKeycloak(ctx context.Context) error {
+	if s.keycloak == "" {
+		return errDependencyDisabled
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.keycloak+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery document returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *HealthService) checkWorkers(context.Context) error {
+	if s.workers == nil {
+		return errDependencyDisabled
+	}
+	return s.workers.Health(time.Now(), s.stallAfter)
+}
+
+func (s *HealthService) checkSIEM(context.Context) error {
+	if s.forwarder == nil {
+		return errDependencyDisabled
+	}
+	return s.forwarder.Health()
+}
@@ -0,0 +1,567 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Identity providers that send risk signals
+const (
+	IdPRiskProviderGoogle    = "google"
+	IdPRiskProviderMicrosoft = "microsoft"
+)
+
+// Risk levels of an identity provider signal; none clears earlier risk
+const (
+	IdPRiskNone   = "none"
+	IdPRiskLow    = "low"
+	IdPRiskMedium = "medium"
+	IdPRiskHigh   = "high"
+)
+
+// riscEventPrefix prefixes the RISC event types Google sends in security event tokens
+const riscEventPrefix = "https://schemas.openid.net/secevent/risc/event-type/"
+
+// idpRiskWindow is how long an identity provider's latest signal counts against the user
+const idpRiskWindow = 30 * 24 * time.Hour
+
+// idpRiskProviderNames are how providers are named in alerts
+var idpRiskProviderNames = map[string]string{
+	IdPRiskProviderGoogle:    "Google",
+	IdPRiskProviderMicrosoft: "Microsoft Entra",
+}
+
+// idpRiskScores are the risk assessment scores recorded for each signal level
+var idpRiskScores = map[string]float64{
+	IdPRiskNone:   0,
+	IdPRiskLow:    0.3,
+	IdPRiskMedium: 0.6,
+	IdPRiskHigh:   0.9,
+}
+
+var (
+	// ErrInvalidRiskSignal is returned for a security event token or notification that fails verification
+	ErrInvalidRiskSignal = errors.New("invalid risk signal")
+	// ErrRiskConnectorNotConfigured is returned when a provider's risk signal connector is not configured
+	ErrRiskConnectorNotConfigured = errors.New("risk signal connector not configured")
+)
+
+// IdPRiskSignalService turns risky-user signals from upstream identity providers into
+// CloudGate alerts and risk assessments. Google pushes RISC security event tokens;
+// Microsoft Entra risky users are polled from Graph, and Graph change notifications
+// trigger an early poll.
+type IdPRiskSignalService struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+	client   *http.Client
+
+	googleIssuer    string
+	googleAudiences map[string]bool
+	googleJWKSURL   string
+	keysMu          sync.Mutex
+	googleKeys      map[string]*rsa.PublicKey
+	keysFetchedAt   time.Time
+
+	msTenantID     string
+	msClientID     string
+	msClientSecret string
+	msClientState  string
+	msLoginURL     string
+	msGraphURL     string
+	pollEvery      time.Duration
+	syncMu         sync.Mutex
+}
+
+// NewIdPRiskSignalService creates a risk signal service from the environment
+func NewIdPRiskSignalService(db *gorm.DB, security *SecurityMonitoringService) *IdPRiskSignalService {
+	s := &IdPRiskSignalService{
+		db:              db,
+		security:        security,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		googleIssuer:    getEnv("GOOGLE_RISC_ISSUER", "https://accounts.google.com/"),
+		googleAudiences: make(map[string]bool),
+		googleJWKSURL:   getEnv("GOOGLE_RISC_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs"),
+		msTenantID:      os.Getenv("MICROSOFT_TENANT_ID"),
+		msClientID:      os.Getenv("MICROSOFT_CLIENT_ID"),
+		msClientSecret:  os.Getenv("MICROSOFT_CLIENT_SECRET"),
+		msClientState:   os.Getenv("MICROSOFT_RISK_CLIENT_STATE"),
+		msLoginURL:      strings.TrimRight(getEnv("MICROSOFT_LOGIN_URL", "https://login.microsoftonline.com"), "/"),
+		msGraphURL:      strings.TrimRight(getEnv("MICROSOFT_GRAPH_URL", "https://graph.microsoft.com"), "/"),
+		pollEvery:       envDuration("MICROSOFT_RISK_POLL_INTERVAL", 15*time.Minute),
+	}
+	for _, audience := range strings.Split(getEnv("GOOGLE_RISC_AUDIENCE", os.Getenv("GOOGLE_CLIENT_ID")), ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			s.googleAudiences[audience] = true
+		}
+	}
+	return s
+}
+
+// GoogleEnabled reports whether Google security event tokens can be verified
+func (s *IdPRiskSignalService) GoogleEnabled() bool {
+	return len(s.googleAudiences) > 0
+}
+
+// MicrosoftEnabled reports whether Microsoft Entra risky users can be read from Graph
+func (s *IdPRiskSignalService) MicrosoftEnabled() bool {
+	return s.msTenantID != "" && s.msClientID != "" && s.msClientSecret != ""
+}
+
+// Interval is how often Microsoft Entra risky users should be polled
+func (s *IdPRiskSignalService) Interval() time.Duration {
+	return s.pollEvery
+}
+
+// riscEvent is one event in a Google security event token
+type riscEvent struct {
+	Subject struct {
+		SubjectType string `json:"subject_type"`
+		Issuer      string `json:"iss"`
+		Sub         string `json:"sub"`
+		Email       string `json:"email"`
+	} `json:"subject"`
+	Reason string `json:"reason"`
+	State  string `json:"state"`
+}
+
+type riscClaims struct {
+	jwt.RegisteredClaims
+	Events map[string]json.RawMessage `json:"events"`
+}
+
+// ReceiveGoogleEvent verifies a RISC security event token pushed by Google and records
+// its events. Verification events only confirm the stream works and record nothing.
+func (s *IdPRiskSignalService) ReceiveGoogleEvent(ctx context.Context, token string, now time.Time) ([]models.IdPRiskSignal, error) {
+	if !s.GoogleEnabled() {
+		return nil, ErrRiskConnectorNotConfigured
+	}
+	var claims riscClaims
+	_, err := jwt.ParseWithClaims(strings.TrimSpace(token), &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.googleKey(ctx, kid, now)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(s.googleIssuer),
+		jwt.WithLeeway(envDuration("ASSERTION_CLOCK_SKEW", 2*time.Minute)), jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRiskSignal, err)
+	}
+	audienceOK := false
+	for _, audience := range claims.Audience {
+		audienceOK = audienceOK || s.googleAudiences[audience]
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidRiskSignal)
+	}
+	if claims.ID == "" || len(claims.Events) == 0 {
+		return nil, fmt.Errorf("%w: token has no jti or events", ErrInvalidRiskSignal)
+	}
+
+	observedAt := now
+	if claims.IssuedAt != nil {
+		observedAt = claims.IssuedAt.Time
+	}
+	var signals []models.IdPRiskSignal
+	for eventType, raw := range claims.Events {
+		var event riscEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return nil, fmt.Errorf("%w: unreadable %s event", ErrInvalidRiskSignal, eventType)
+		}
+		name := strings.TrimPrefix(eventType, riscEventPrefix)
+		if name == "verification" {
+			log.Printf("🔐 Google RISC verification event received (state %q)", event.State)
+			continue
+		}
+		level, detail := googleRiskLevel(name, event.Reason)
+		signal := models.IdPRiskSignal{
+			Provider:   IdPRiskProviderGoogle,
+			EventID:    claims.ID + "#" + name,
+			EventType:  name,
+			RiskLevel:  level,
+			Detail:     detail,
+			Subject:    event.Subject.Email,
+			ObservedAt: observedAt,
+		}
+		if signal.Subject == "" {
+			signal.Subject = event.Subject.Sub
+		}
+		if signal.Subject == "" {
+			return nil, fmt.Errorf("%w: %s event has no subject", ErrInvalidRiskSignal, name)
+		}
+		signal.UserID = s.resolveUser(IdPRiskProviderGoogle, event.Subject.Email, event.Subject.Sub)
+		recorded, err := s.record(&signal)
+		if err != nil {
+			return nil, err
+		}
+		if recorded {
+			signals = append(signals, signal)
+		}
+	}
+	return signals, nil
+}
+
+// googleRiskLevel rates a RISC event. Hijacked accounts and forced credential changes are
+// high risk; Google revoking sessions or tokens, or disabling accounts for other reasons,
+// is medium; re-enabled accounts clear earlier risk.
+func googleRiskLevel(name, reason string) (string, string) {
+	switch name {
+	case "account-disabled":
+		if reason == "hijacking" {
+			return IdPRiskHigh, "Google disabled the account because it was hijacked"
+		}
+		return IdPRiskMedium, fmt.Sprintf("Google disabled the account (%s)", reason)
+	case "account-credential-change-required":
+		return IdPRiskHigh, "Google requires the account's credentials to be changed"
+	case "sessions-revoked":
+		return IdPRiskMedium, "Google revoked the account's sessions"
+	case "tokens-revoked":
+		return IdPRiskMedium, "Google revoked OAuth tokens issued to the account"
+	case "account-enabled":
+		return IdPRiskNone, "Google re-enabled the account"
+	case "account-purged":
+		return IdPRiskLow, "Google deleted the account"
+	default:
+		return IdPRiskLow, "Google sent an unrecognized security event: " + name
+	}
+}
+
+// googleKey returns Google's signing key with the ID, refetching the key set when the ID
+// is unknown, at most once a minute
+func (s *IdPRiskSignalService) googleKey(ctx context.Context, kid string, now time.Time) (*rsa.PublicKey, error) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if key, ok := s.googleKeys[kid]; ok && now.Sub(s.keysFetchedAt) < 24*time.Hour {
+		return key, nil
+	}
+	if now.Sub(s.keysFetchedAt) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.googleJWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Google signing keys: %w", err)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := decodeProviderResponse(resp, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	s.googleKeys, s.keysFetchedAt = keys, now
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// GraphNotification is one Microsoft Graph change notification
+type GraphNotification struct {
+	SubscriptionID string `json:"subscriptionId"`
+	ClientState    string `json:"clientState"`
+	ChangeType     string `json:"changeType"`
+	Resource       string `json:"resource"`
+}
+
+// VerifyMicrosoftNotifications checks every Graph change notification carries the
+// client state set on the subscription
+func (s *IdPRiskSignalService) VerifyMicrosoftNotifications(notifications []GraphNotification) error {
+	if s.msClientState == "" || !s.MicrosoftEnabled() {
+		return ErrRiskConnectorNotConfigured
+	}
+	if len(notifications) == 0 {
+		return fmt.Errorf("%w: no notifications", ErrInvalidRiskSignal)
+	}
+	for _, notification := range notifications {
+		if subtle.ConstantTimeCompare([]byte(notification.ClientState), []byte(s.msClientState)) != 1 {
+			return fmt.Errorf("%w: client state mismatch", ErrInvalidRiskSignal)
+		}
+	}
+	return nil
+}
+
+// SyncMicrosoft reads Entra risky users whose risk changed since the last signal recorded
+// from Microsoft, or in the past day on the first run, and records the changes. The app
+// registration needs IdentityRiskyUser.Read.All.
+func (s *IdPRiskSignalService) SyncMicrosoft(ctx context.Context, now time.Time) (int, error) {
+	if !s.MicrosoftEnabled() {
+		return 0, ErrRiskConnectorNotConfigured
+	}
+	// Webhook-triggered and scheduled syncs would otherwise read the same changes twice
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	since := now.Add(-24 * time.Hour)
+	var latest models.IdPRiskSignal
+	if err := s.db.Where("provider = ?", IdPRiskProviderMicrosoft).Order("observed_at DESC").First(&latest).Error; err == nil {
+		since = latest.ObservedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("failed to find last Microsoft risk signal: %w", err)
+	}
+
+	accessToken, err := fetchMicrosoftGraphToken(ctx, s.client, s.msLoginURL, s.msTenantID, s.msClientID, s.msClientSecret)
+	if err != nil {
+		return 0, err
+	}
+	query := url.Values{}
+	query.Set("$filter", "riskLastUpdatedDateTime gt "+since.UTC().Format(time.RFC3339))
+	next := s.msGraphURL + "/v1.0/identityProtection/riskyUsers?" + query.Encode()
+
+	recorded := 0
+	for next != "" {
+		var page struct {
+			Value []struct {
+				ID                      string    `json:"id"`
+				UserPrincipalName       string    `json:"userPrincipalName"`
+				RiskLevel               string    `json:"riskLevel"`
+				RiskState               string    `json:"riskState"`
+				RiskDetail              string    `json:"riskDetail"`
+				RiskLastUpdatedDateTime time.Time `json:"riskLastUpdatedDateTime"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", next, nil)
+		if err != nil {
+			return recorded, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to query Microsoft Graph: %w", err)
+		}
+		if err := decodeProviderResponse(resp, &page); err != nil {
+			return recorded, err
+		}
+
+		for _, risky := range page.Value {
+			signal := models.IdPRiskSignal{
+				Provider:   IdPRiskProviderMicrosoft,
+				EventID:    risky.ID + "@" + risky.RiskLastUpdatedDateTime.UTC().Format(time.RFC3339Nano),
+				EventType:  "risky_user",
+				RiskLevel:  microsoftRiskLevel(risky.RiskLevel, risky.RiskState),
+				RiskState:  risky.RiskState,
+				Detail:     risky.RiskDetail,
+				Subject:    risky.UserPrincipalName,
+				ObservedAt: risky.RiskLastUpdatedDateTime,
+			}
+			signal.UserID = s.resolveUser(IdPRiskProviderMicrosoft, risky.UserPrincipalName, "")
+			ok, err := s.record(&signal)
+			if err != nil {
+				return recorded, err
+			}
+			if ok {
+				recorded++
+			}
+		}
+		next = page.NextLink
+	}
+	return recorded, nil
+}
+
+// microsoftRiskLevel rates an Entra risky user. Confirmed compromise is high whatever the
+// level; remediated and dismissed risk clears earlier signals. Levels hidden from tenants
+// without Entra ID P2 rate medium.
+func microsoftRiskLevel(level, state string) string {
+	switch state {
+	case "confirmedCompromised":
+		return IdPRiskHigh
+	case "remediated", "dismissed", "confirmedSafe", "none":
+		return IdPRiskNone
+	}
+	switch level {
+	case IdPRiskLow, IdPRiskMedium, IdPRiskHigh:
+		return level
+	case IdPRiskNone:
+		return IdPRiskNone
+	default:
+		return IdPRiskMedium
+	}
+}
+
+// resolveUser finds the CloudGate user behind a signal, by email and then through app
+// connections to the provider
+func (s *IdPRiskSignalService) resolveUser(provider, email, accountID string) *uuid.UUID {
+	if email != "" {
+		var user models.User
+		if err := s.db.Select("id").Where("LOWER(email) = ?", strings.ToLower(email)).First(&user).Error; err == nil {
+			return &user.ID
+		}
+		var connection models.AppConnection
+		if err := s.db.Select("user_id").Where("provider = ? AND LOWER(user_email) = ?", provider, strings.ToLower(email)).
+			First(&connection).Error; err == nil {
+			return &connection.UserID
+		}
+	}
+	if provider == IdPRiskProviderGoogle && accountID != "" {
+		var connections []models.AppConnection
+		s.db.Select("user_id", "app_id", "extras").
+			Where("provider = ? AND status = ? AND extras LIKE ?", provider, models.ConnectionConnected, "%"+accountID+"%").
+			Find(&connections)
+		for _, connection := range connections {
+			if connectionExtras(connection)["google_user_id"] == accountID {
+				return &connection.UserID
+			}
+		}
+	}
+	return nil
+}
+
+// record stores a signal once, then adjusts the user's risk and raises an alert. It
+// reports false for a signal already received.
+func (s *IdPRiskSignalService) record(signal *models.IdPRiskSignal) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(signal)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record risk signal: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if signal.UserID != nil {
+		level := signal.RiskLevel
+		if level == IdPRiskNone {
+			level = IdPRiskLow
+		}
+		assessment := RiskAssessment{
+			UserID:    *signal.UserID,
+			RiskScore: idpRiskScores[signal.RiskLevel],
+			RiskLevel: models.RiskLevel(level),
+			Factors: RiskFactorList{{
+				Type:        "idp_risk",
+				Description: fmt.Sprintf("%s reports %s", idpRiskProviderNames[signal.Provider], signal.EventType),
+				Score:       idpRiskScores[signal.RiskLevel],
+				Severity:    level,
+			}},
+		}
+		if err := s.db.Create(&assessment).Error; err != nil {
+			log.Printf("⚠️ Failed to record risk assessment for %s risk signal: %v", signal.Provider, err)
+		}
+	}
+
+	if signal.RiskLevel == IdPRiskNone || s.security == nil {
+		return true, nil
+	}
+	name := idpRiskProviderNames[signal.Provider]
+	alert, err := s.security.GenerateAlert(AlertTypeIdPRiskSignal, idpRiskSeverity(signal),
+		name+" reports a risky user",
+		idpRiskDescription(name, signal),
+		idpRiskMetadata(signal))
+	if err != nil {
+		log.Printf("⚠️ Failed to raise %s risk signal alert: %v", signal.Provider, err)
+		return true, nil
+	}
+	signal.AlertID = &alert.ID
+	s.db.Model(signal).UpdateColumn("alert_id", alert.ID)
+	return true, nil
+}
+
+func idpRiskDescription(name string, signal *models.IdPRiskSignal) string {
+	description := fmt.Sprintf("%s rates %s as %s risk", name, signal.Subject, signal.RiskLevel)
+	if signal.Detail != "" && signal.Detail != IdPRiskNone {
+		description += ": " + signal.Detail
+	}
+	return description
+}
+
+func idpRiskSeverity(signal *models.IdPRiskSignal) AlertSeverity {
+	switch {
+	case signal.RiskState == "confirmedCompromised" || signal.EventType == "account-disabled" && signal.RiskLevel == IdPRiskHigh:
+		return SeverityCritical
+	case signal.RiskLevel == IdPRiskHigh:
+		return SeverityHigh
+	case signal.RiskLevel == IdPRiskMedium:
+		return SeverityMedium
+	default:
+		return SeverityLow
+	}
+}
+
+func idpRiskMetadata(signal *models.IdPRiskSignal) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"signal_id":  signal.ID.String(),
+		"provider":   signal.Provider,
+		"event_type": signal.EventType,
+		"risk_level": signal.RiskLevel,
+		"subject":    signal.Subject,
+		"risk_score": idpRiskScores[signal.RiskLevel],
+	}
+	if strings.Contains(signal.Subject, "@") {
+		metadata["email"] = signal.Subject
+	}
+	if signal.RiskState != "" {
+		metadata["risk_state"] = signal.RiskState
+	}
+	if signal.UserID != nil {
+		metadata["user_id"] = signal.UserID.String()
+	}
+	return metadata
+}
+
+// List returns recent risk signals, newest first, optionally for one provider or user
+func (s *IdPRiskSignalService) List(provider string, userID *uuid.UUID, limit int) ([]models.IdPRiskSignal, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.db.Order("observed_at DESC").Limit(limit)
+	if provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	var signals []models.IdPRiskSignal
+	if err := query.Find(&signals).Error; err != nil {
+		return nil, fmt.Errorf("failed to list risk signals: %w", err)
+	}
+	return signals, nil
+}
+
+// latestIdPRiskLevel is the level of the newest signal about the user within the risk
+// window, or none
+func latestIdPRiskLevel(db *gorm.DB, userID uuid.UUID, now time.Time) string {
+	var signal models.IdPRiskSignal
+	err := db.Select("risk_level").Where("user_id = ? AND observed_at > ?", userID, now.Add(-idpRiskWindow)).
+		Order("observed_at DESC").First(&signal).Error
+	if err != nil {
+		return IdPRiskNone
+	}
+	return signal.RiskLevel
+}
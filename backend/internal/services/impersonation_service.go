@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrImpersonationNotFound is returned when an impersonation does not exist or belongs to someone else
+	ErrImpersonationNotFound = errors.New("impersonation not found")
+	// ErrInvalidImpersonation is returned for requests without a reason, against oneself or an
+	// inactive user, or longer than IMPERSONATION_MAX_DURATION
+	ErrInvalidImpersonation = errors.New("invalid impersonation request")
+	// ErrImpersonationState is returned when an impersonation cannot move to the requested state,
+	// e.g. starting one that still awaits consent
+	ErrImpersonationState = errors.New("impersonation is not in a state that allows this")
+	// ErrImpersonationEnded is returned for tokens of an impersonation session that has ended
+	ErrImpersonationEnded = errors.New("impersonation has ended")
+)
+
+// ImpersonationInput describes an administrator's request to act as a user
+type ImpersonationInput struct {
+	TargetUserID uuid.UUID
+	Reason       string
+	Duration     time.Duration // defaults to IMPERSONATION_DEFAULT_DURATION
+}
+
+// ImpersonationParty identifies one side of an impersonation in the frontend banner
+type ImpersonationParty struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+	Name  string    `json:"name"`
+}
+
+// ImpersonationBanner is what the frontend shows throughout an impersonation session
+type ImpersonationBanner struct {
+	ImpersonationID uuid.UUID          `json:"impersonation_id"`
+	Impersonator    ImpersonationParty `json:"impersonator"`
+	User            ImpersonationParty `json:"user"`
+	Reason          string             `json:"reason"`
+	StartedAt       time.Time          `json:"started_at"`
+	ExpiresAt       time.Time          `json:"expires_at"`
+	Restrictions    []string           `json:"restrictions"`
+	Message         string             `json:"message"`
+}
+
+// impersonationRestrictions are the areas closed to an impersonating administrator
+var impersonationRestrictions = []string{"security_settings", "mfa", "webauthn", "sessions", "account", "consent", "admin"}
+
+// ImpersonationService runs support impersonation ("login as user"). An administrator
+// requests a time-boxed impersonation with a reason; unless consent is switched off the
+// user must approve it before it can start. Starting it issues a session for the user
+// that records the administrator as impersonator and cannot be refreshed past its end.
+// Every step, and every request made while impersonating, is audited at critical severity.
+type ImpersonationService struct {
+	db              *gorm.DB
+	sessions        *SessionService
+	auditService    *AuditService
+	requireConsent  bool
+	defaultDuration time.Duration
+	maxDuration     time.Duration
+	requestTTL      time.Duration
+}
+
+// NewImpersonationService creates the impersonation service. IMPERSONATION_REQUIRE_CONSENT
+// (default true) controls whether users must approve impersonation.
+func NewImpersonationService(db *gorm.DB, sessions *SessionService, auditService *AuditService) *ImpersonationService {
+	return &ImpersonationService{
+		db:              db,
+		sessions:        sessions,
+		auditService:    auditService,
+		requireConsent:  getEnv("IMPERSONATION_REQUIRE_CONSENT", "true") == "true",
+		defaultDuration: envDuration("IMPERSONATION_DEFAULT_DURATION", 30*time.Minute),
+		maxDuration:     envDuration("IMPERSONATION_MAX_DURATION", time.Hour),
+		requestTTL:      envDuration("IMPERSONATION_REQUEST_TTL", 24*time.Hour),
+	}
+}
+
+// Request records an administrator's impersonation request. It is approved straight
+// away when consent is not required, and otherwise waits for the user.
+func (s *ImpersonationService) Request(adminID uuid.UUID, input ImpersonationInput, source TokenSource, now time.Time) (*models.Impersonation, error) {
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Duration == 0 {
+		input.Duration = s.defaultDuration
+	}
+	switch {
+	case input.Reason == "":
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidImpersonation)
+	case input.TargetUserID == adminID:
+		return nil, fmt.Errorf("%w: administrators cannot impersonate themselves", ErrInvalidImpersonation)
+	case input.Duration < time.Minute || input.Duration > s.maxDuration:
+		return nil, fmt.Errorf("%w: duration must be between 1m and %s", ErrInvalidImpersonation, s.maxDuration)
+	}
+	var target models.User
+	if err := s.db.Where("id = ? AND is_active = ?", input.TargetUserID, true).First(&target).Error; err != nil {
+		return nil, fmt.Errorf("%w: user %s not found or inactive", ErrInvalidImpersonation, input.TargetUserID)
+	}
+
+	impersonation := models.Impersonation{
+		AdminID:         adminID,
+		TargetUserID:    input.TargetUserID,
+		Reason:          input.Reason,
+		Status:          models.ImpersonationPendingConsent,
+		ConsentRequired: s.requireConsent,
+		DurationSeconds: int64(input.Duration / time.Second),
+		RequestExpires:  now.Add(s.requestTTL),
+	}
+	if !s.requireConsent {
+		impersonation.Status = models.ImpersonationApproved
+		impersonation.DecidedAt = &now
+	}
+	if err := s.db.Create(&impersonation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create impersonation: %w", err)
+	}
+
+	s.audit(&impersonation, adminID, nil, source, "request", OutcomeSuccess,
+		fmt.Sprintf("Administrator requested to impersonate %s for %s", target.Email, input.Duration))
+	return &impersonation, nil
+}
+
+// Decide records the user's consent or refusal for a pending impersonation of them
+func (s *ImpersonationService) Decide(userID, id uuid.UUID, approve bool, source TokenSource, now time.Time) (*models.Impersonation, error) {
+	impersonation, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.TargetUserID != userID {
+		return nil, ErrImpersonationNotFound
+	}
+	if impersonation.Status != models.ImpersonationPendingConsent || !now.Before(impersonation.RequestExpires) {
+		return nil, fmt.Errorf("%w: impersonation is %s", ErrImpersonationState, impersonation.Status)
+	}
+
+	status, action, description := models.ImpersonationApproved, "consent_granted", "User consented to impersonation"
+	if !approve {
+		status, action, description = models.ImpersonationDenied, "consent_denied", "User refused impersonation"
+	}
+	if err := s.transition(impersonation, models.ImpersonationPendingConsent, map[string]interface{}{"status": status, "decided_at": now}); err != nil {
+		return nil, err
+	}
+	impersonation.Status = status
+	impersonation.DecidedAt = &now
+
+	s.audit(impersonation, userID, nil, source, action, OutcomeSuccess, description)
+	return impersonation, nil
+}
+
+// Start begins an approved impersonation, creating the session the administrator acts through
+func (s *ImpersonationService) Start(adminID, id uuid.UUID, source TokenSource, now time.Time) (*models.Impersonation, *models.Session, error) {
+	impersonation, err := s.get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if impersonation.AdminID != adminID {
+		return nil, nil, ErrImpersonationNotFound
+	}
+	if impersonation.Status != models.ImpersonationApproved || !now.Before(impersonation.RequestExpires) {
+		s.audit(impersonation, adminID, nil, source, "start", OutcomeDenied, fmt.Sprintf("Impersonation could not start while %s", impersonation.Status))
+		return nil, nil, fmt.Errorf("%w: impersonation is %s", ErrImpersonationState, impersonation.Status)
+	}
+
+	expiresAt := now.Add(impersonation.Duration())
+	session, err := s.sessions.CreateImpersonationSession(impersonation.TargetUserID, adminID, source.IPAddress, source.UserAgent, expiresAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.transition(impersonation, models.ImpersonationApproved, map[string]interface{}{
+		"status":     models.ImpersonationActive,
+		"session_id": session.ID,
+		"started_at": now,
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		_ = s.sessions.InvalidateSession(session.SessionToken)
+		return nil, nil, err
+	}
+	impersonation.Status = models.ImpersonationActive
+	impersonation.SessionID = &session.ID
+	impersonation.StartedAt = &now
+	impersonation.ExpiresAt = &expiresAt
+
+	s.audit(impersonation, adminID, &session.ID, source, "start", OutcomeSuccess,
+		fmt.Sprintf("Impersonation started, ending at %s", expiresAt.UTC().Format(time.RFC3339)))
+	return impersonation, session, nil
+}
+
+// End stops an impersonation that has not finished yet and revokes its session. Either
+// the administrator or the impersonated user may end it.
+func (s *ImpersonationService) End(actorID, id uuid.UUID, source TokenSource, now time.Time) (*models.Impersonation, error) {
+	impersonation, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if actorID != impersonation.AdminID && actorID != impersonation.TargetUserID {
+		return nil, ErrImpersonationNotFound
+	}
+	switch impersonation.Status {
+	case models.ImpersonationPendingConsent, models.ImpersonationApproved, models.ImpersonationActive:
+	default:
+		return nil, fmt.Errorf("%w: impersonation is already %s", ErrImpersonationState, impersonation.Status)
+	}
+
+	if err := s.finish(impersonation, models.ImpersonationEnded, &actorID, now); err != nil {
+		return nil, err
+	}
+	s.audit(impersonation, actorID, impersonation.SessionID, source, "end", OutcomeSuccess, "Impersonation ended")
+	return impersonation, nil
+}
+
+// ExpireStale ends impersonations past their end time and requests nobody acted on in
+// time, returning how many it closed
+func (s *ImpersonationService) ExpireStale(now time.Time) (int, error) {
+	var stale []models.Impersonation
+	err := s.db.Where("(status = ? AND expires_at <= ?) OR (status IN ? AND request_expires <= ?)",
+		models.ImpersonationActive, now,
+		[]string{models.ImpersonationPendingConsent, models.ImpersonationApproved}, now).
+		Find(&stale).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stale impersonations: %w", err)
+	}
+
+	expired := 0
+	for i := range stale {
+		if err := s.finish(&stale[i], models.ImpersonationExpired, nil, now); err != nil {
+			if errors.Is(err, ErrImpersonationState) {
+				continue // ended concurrently
+			}
+			return expired, err
+		}
+		s.audit(&stale[i], stale[i].AdminID, stale[i].SessionID, TokenSource{Provider: "system"}, "expire", OutcomeSuccess, "Impersonation expired")
+		expired++
+	}
+	return expired, nil
+}
+
+// CheckImpersonation confirms an impersonation session is still active, so its access
+// tokens stop working as soon as it ends or expires
+func (s *ImpersonationService) CheckImpersonation(sessionID, impersonatorID uuid.UUID, now time.Time) error {
+	impersonation, err := s.ActiveForSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if impersonation.AdminID != impersonatorID || !now.Before(*impersonation.ExpiresAt) {
+		return ErrImpersonationEnded
+	}
+	return nil
+}
+
+// ActiveForSession returns the active impersonation an impersonation session belongs to
+func (s *ImpersonationService) ActiveForSession(sessionID uuid.UUID) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	err := s.db.Where("session_id = ? AND status = ?", sessionID, models.ImpersonationActive).First(&impersonation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImpersonationEnded
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	return &impersonation, nil
+}
+
+// Banner returns the frontend banner for an impersonation session
+func (s *ImpersonationService) Banner(sessionID uuid.UUID) (*ImpersonationBanner, error) {
+	impersonation, err := s.ActiveForSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	admin, err := s.party(impersonation.AdminID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.party(impersonation.TargetUserID)
+	if err != nil {
+		return nil, err
+	}
+	return &ImpersonationBanner{
+		ImpersonationID: impersonation.ID,
+		Impersonator:    *admin,
+		User:            *user,
+		Reason:          impersonation.Reason,
+		StartedAt:       *impersonation.StartedAt,
+		ExpiresAt:       *impersonation.ExpiresAt,
+		Restrictions:    impersonationRestrictions,
+		Message:         fmt.Sprintf("%s is signed in as %s. Security settings are read-only.", admin.Name, user.Name),
+	}, nil
+}
+
+// List returns impersonations for administrators, newest first, optionally by status
+func (s *ImpersonationService) List(status string) ([]models.Impersonation, error) {
+	query := s.db.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var impersonations []models.Impersonation
+	if err := query.Find(&impersonations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list impersonations: %w", err)
+	}
+	return impersonations, nil
+}
+
+// ListForUser returns the impersonations of a user, newest first, so they can review
+// pending requests and past sessions
+func (s *ImpersonationService) ListForUser(userID uuid.UUID) ([]models.Impersonation, error) {
+	var impersonations []models.Impersonation
+	if err := s.db.Where("target_user_id = ?", userID).Order("created_at DESC").Find(&impersonations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list impersonations: %w", err)
+	}
+	return impersonations, nil
+}
+
+// RecordRequest audits one request made through an impersonation session
+func (s *ImpersonationService) RecordRequest(sessionID, impersonatorID uuid.UUID, method, path string, statusCode int, source TokenSource) {
+	impersonation, err := s.ActiveForSession(sessionID)
+	if err != nil {
+		// Rejected requests after the end are still worth recording against the administrator
+		impersonation = &models.Impersonation{AdminID: impersonatorID}
+	}
+	outcome := OutcomeSuccess
+	if statusCode >= 400 {
+		outcome = OutcomeFailure
+	}
+	s.audit(impersonation, impersonatorID, &sessionID, source, "request_made", outcome, fmt.Sprintf("%s %s -> %d", method, path, statusCode))
+}
+
+func (s *ImpersonationService) get(id uuid.UUID) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	err := s.db.Where("id = ?", id).First(&impersonation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImpersonationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	return &impersonation, nil
+}
+
+// transition updates an impersonation only if it is still in the expected status, so
+// concurrent decisions cannot both win
+func (s *ImpersonationService) transition(impersonation *models.Impersonation, from string, updates map[string]interface{}) error {
+	result := s.db.Model(&models.Impersonation{}).Where("id = ? AND status = ?", impersonation.ID, from).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update impersonation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: impersonation changed concurrently", ErrImpersonationState)
+	}
+	return nil
+}
+
+// finish closes an impersonation and revokes its session, if it had started
+func (s *ImpersonationService) finish(impersonation *models.Impersonation, status string, endedBy *uuid.UUID, now time.Time) error {
+	if err := s.transition(impersonation, impersonation.Status, map[string]interface{}{"status": status, "ended_at": now, "ended_by": endedBy}); err != nil {
+		return err
+	}
+	if impersonation.SessionID != nil {
+		err := s.db.Model(&models.Session{}).Where("id = ?", *impersonation.SessionID).Update("is_active", false).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke impersonation session: %w", err)
+		}
+	}
+	impersonation.Status = status
+	impersonation.EndedAt = &now
+	impersonation.EndedBy = endedBy
+	return nil
+}
+
+func (s *ImpersonationService) party(userID uuid.UUID) (*ImpersonationParty, error) {
+	var user models.User
+	if err := s.db.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", userID, err)
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Username
+	}
+	return &ImpersonationParty{ID: user.ID, Email: user.Email, Name: name}, nil
+}
+
+// audit records a critical audit event, and an entry in the impersonated user's own
+// audit log so they can see who acted as them
+func (s *ImpersonationService) audit(impersonation *models.Impersonation, actorID uuid.UUID, sessionID *uuid.UUID, source TokenSource, action string, outcome AuditOutcome, description string) {
+	details := map[string]interface{}{
+		"impersonation_id": impersonation.ID,
+		"admin_id":         impersonation.AdminID,
+		"target_user_id":   impersonation.TargetUserID,
+		"reason":           impersonation.Reason,
+		"status":           impersonation.Status,
+	}
+	if s.auditService != nil {
+		_ = s.auditService.LogEvent(context.Background(), EventTypeImpersonation, CategoryAdministrative, AuditSeverityCritical, &actorID, sessionID,
+			source.IPAddress, source.UserAgent, "impersonation", action, outcome, description, details)
+	}
+
+	if impersonation.TargetUserID == uuid.Nil {
+		return
+	}
+	status := "success"
+	if outcome != OutcomeSuccess {
+		status = "failure"
+	}
+	auditLog := models.AuditLog{
+		UserID:     &impersonation.TargetUserID,
+		Action:     "impersonation_" + action,
+		Resource:   "impersonation",
+		ResourceID: impersonation.ID.String(),
+		IPAddress:  source.IPAddress,
+		UserAgent:  source.UserAgent,
+		Details:    description,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit impersonation: %v", err)
+	}
+}
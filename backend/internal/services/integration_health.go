@@ -0,0 +1,305 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Weights of each signal in an integration's 0-100 health score
+const (
+	integrationWeightErrors       = 50.0
+	integrationWeightLatency      = 25.0
+	integrationWeightTokenRefresh = 25.0
+)
+
+// Health score thresholds; below degraded the integration is unhealthy
+const (
+	integrationHealthyScore  = 85.0
+	integrationDegradedScore = 60.0
+)
+
+// ErrInvalidSampleKind is returned when a reported call is not an API call or token refresh
+var ErrInvalidSampleKind = errors.New("invalid integration sample kind")
+
+// IntegrationHealth is a provider integration's rolling health score and the signals it
+// was built from
+type IntegrationHealth struct {
+	Provider             string    `json:"provider"`
+	Score                float64   `json:"score"`
+	Status               string    `json:"status"`
+	Samples              int64     `json:"samples"`
+	ErrorRate            float64   `json:"error_rate"`
+	AverageLatencyMs     float64   `json:"average_latency_ms"`
+	TokenRefreshAttempts int64     `json:"token_refresh_attempts"`
+	TokenRefreshFailures int64     `json:"token_refresh_failures"`
+	Remediation          []string  `json:"remediation"`
+	WindowStart          time.Time `json:"window_start"`
+}
+
+// IntegrationHealthService scores provider integrations from recent calls and raises an
+// alert when one degrades, so broken connections are fixed before users report them
+type IntegrationHealthService struct {
+	db            *gorm.DB
+	security      *SecurityMonitoringService
+	window        time.Duration
+	minSamples    int64
+	latencyTarget time.Duration
+	alertCooldown time.Duration
+	evaluateEvery time.Duration
+}
+
+// NewIntegrationHealthService creates a new integration health service. The security
+// monitoring service raises degradation alerts and may be nil in tests.
+func NewIntegrationHealthService(db *gorm.DB, security *SecurityMonitoringService) *IntegrationHealthService {
+	return &IntegrationHealthService{
+		db:            db,
+		security:      security,
+		window:        envDuration("INTEGRATION_HEALTH_WINDOW", time.Hour),
+		minSamples:    int64(envInt("INTEGRATION_HEALTH_MIN_SAMPLES", 5)),
+		latencyTarget: envDuration("INTEGRATION_LATENCY_TARGET", 1500*time.Millisecond),
+		alertCooldown: envDuration("INTEGRATION_ALERT_COOLDOWN", 6*time.Hour),
+		evaluateEvery: envDuration("INTEGRATION_HEALTH_INTERVAL", 5*time.Minute),
+	}
+}
+
+// Interval is how often integrations should be evaluated
+func (s *IntegrationHealthService) Interval() time.Duration {
+	return s.evaluateEvery
+}
+
+// recordIntegrationSample stores an observed provider call. Failing to record is logged
+// rather than returned so it never breaks the call being observed.
+func recordIntegrationSample(db *gorm.DB, sample models.IntegrationHealthSample) {
+	if sample.Provider == "" {
+		return
+	}
+	if err := db.Create(&sample).Error; err != nil {
+		log.Printf("⚠️ Failed to record integration health sample for %s: %v", sample.Provider, err)
+	}
+}
+
+type integrationSampleTotals struct {
+	Provider   string
+	Kind       string
+	Success    bool
+	Count      int64
+	LatencySum int64
+}
+
+type integrationFailureCodes struct {
+	Provider   string
+	StatusCode int
+	Count      int64
+}
+
+// GetIntegrationHealth scores every provider with calls in the rolling window
+func (s *IntegrationHealthService) GetIntegrationHealth(now time.Time) ([]IntegrationHealth, error) {
+	since := now.Add(-s.window)
+
+	var totals []integrationSampleTotals
+	if err := s.db.Model(&models.IntegrationHealthSample{}).
+		Select("provider, kind, success, COUNT(*) AS count, COALESCE(SUM(latency_ms), 0) AS latency_sum").
+		Where("created_at >= ?", since).
+		Group("provider, kind, success").
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate integration samples: %w", err)
+	}
+
+	var failures []integrationFailureCodes
+	if err := s.db.Model(&models.IntegrationHealthSample{}).
+		Select("provider, status_code, COUNT(*) AS count").
+		Where("created_at >= ? AND success = ?", since, false).
+		Group("provider, status_code").
+		Scan(&failures).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate integration failures: %w", err)
+	}
+
+	byProvider := make(map[string][]integrationSampleTotals)
+	for _, total := range totals {
+		byProvider[total.Provider] = append(byProvider[total.Provider], total)
+	}
+	codes := make(map[string]map[int]int64)
+	for _, failure := range failures {
+		if codes[failure.Provider] == nil {
+			codes[failure.Provider] = make(map[int]int64)
+		}
+		codes[failure.Provider][failure.StatusCode] += failure.Count
+	}
+
+	health := make([]IntegrationHealth, 0, len(byProvider))
+	for provider, providerTotals := range byProvider {
+		health = append(health, s.score(provider, providerTotals, codes[provider], since))
+	}
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].Score != health[j].Score {
+			return health[i].Score < health[j].Score
+		}
+		return health[i].Provider < health[j].Provider
+	})
+	return health, nil
+}
+
+// score combines a provider's error rate, latency against the target and token refresh
+// failure rate. Providers with too few calls to judge are reported as unknown.
+func (s *IntegrationHealthService) score(provider string, totals []integrationSampleTotals, failureCodes map[int]int64, since time.Time) IntegrationHealth {
+	health := IntegrationHealth{Provider: provider, WindowStart: since, Remediation: []string{}}
+
+	var calls, failedCalls, latencySum int64
+	for _, total := range totals {
+		health.Samples += total.Count
+		if total.Kind == models.IntegrationSampleTokenRefresh {
+			health.TokenRefreshAttempts += total.Count
+			if !total.Success {
+				health.TokenRefreshFailures += total.Count
+			}
+			continue
+		}
+		calls += total.Count
+		latencySum += total.LatencySum
+		if !total.Success {
+			failedCalls += total.Count
+		}
+	}
+
+	refreshFailureRate := 0.0
+	if health.TokenRefreshAttempts > 0 {
+		refreshFailureRate = float64(health.TokenRefreshFailures) / float64(health.TokenRefreshAttempts)
+	}
+	latencyPenalty := 0.0
+	if calls > 0 {
+		health.ErrorRate = float64(failedCalls) / float64(calls)
+		health.AverageLatencyMs = float64(latencySum) / float64(calls)
+		target := float64(s.latencyTarget.Milliseconds())
+		latencyPenalty = clamp01((health.AverageLatencyMs - target) / (3 * target))
+	}
+
+	score := 100 - health.ErrorRate*integrationWeightErrors -
+		latencyPenalty*integrationWeightLatency -
+		refreshFailureRate*integrationWeightTokenRefresh
+	health.Score = math.Round(score*10) / 10
+	health.ErrorRate = math.Round(health.ErrorRate*1000) / 1000
+	health.AverageLatencyMs = math.Round(health.AverageLatencyMs)
+
+	switch {
+	case health.Samples < s.minSamples:
+		health.Status = models.IntegrationUnknown
+	case health.Score >= integrationHealthyScore:
+		health.Status = models.IntegrationHealthy
+	case health.Score >= integrationDegradedScore:
+		health.Status = models.IntegrationDegraded
+	default:
+		health.Status = models.IntegrationUnhealthy
+	}
+
+	if health.TokenRefreshFailures > 0 {
+		health.Remediation = append(health.Remediation, "Token refresh is failing: check the provider client secret has not expired or been rotated, then ask affected users to reconnect")
+	}
+	if failureCodes[401]+failureCodes[403] > 0 {
+		health.Remediation = append(health.Remediation, "Calls are rejected as unauthorized: verify the granted scopes and that tokens were not revoked at the provider")
+	}
+	if failureCodes[429] > 0 {
+		health.Remediation = append(health.Remediation, "The provider is rate limiting requests: reduce sync frequency or request a higher API quota")
+	}
+	var serverErrors int64
+	for code, count := range failureCodes {
+		if code == 0 || code >= 500 {
+			serverErrors += count
+		}
+	}
+	if serverErrors > 0 {
+		health.Remediation = append(health.Remediation, "The provider is failing or unreachable: check its status page and retry with backoff")
+	}
+	if latencyPenalty > 0 {
+		health.Remediation = append(health.Remediation, fmt.Sprintf("Responses average %.0fms against a %s target: check the provider status page and network path", health.AverageLatencyMs, s.latencyTarget))
+	}
+	return health
+}
+
+// Evaluate scores every integration and raises an "integration degraded" alert for each
+// one that has become degraded or unhealthy, worsened, or stayed down past the cooldown.
+// It returns the number of alerts raised.
+func (s *IntegrationHealthService) Evaluate(now time.Time) (int, error) {
+	health, err := s.GetIntegrationHealth(now)
+	if err != nil {
+		return 0, err
+	}
+
+	var states []models.IntegrationHealthState
+	if err := s.db.Find(&states).Error; err != nil {
+		return 0, fmt.Errorf("failed to load integration health state: %w", err)
+	}
+	previous := make(map[string]models.IntegrationHealthState, len(states))
+	for _, state := range states {
+		previous[state.Provider] = state
+	}
+
+	raised := 0
+	for _, current := range health {
+		state := previous[current.Provider]
+		state.Provider = current.Provider
+		if s.shouldAlert(state, current, now) {
+			if err := s.raiseAlert(current); err != nil {
+				log.Printf("⚠️ Failed to raise integration alert for %s: %v", current.Provider, err)
+			} else {
+				alertedAt := now
+				state.LastAlertAt = &alertedAt
+				raised++
+			}
+		}
+		state.Score = current.Score
+		state.Status = current.Status
+		state.UpdatedAt = now
+		if err := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&state).Error; err != nil {
+			return raised, fmt.Errorf("failed to save integration health state: %w", err)
+		}
+	}
+	return raised, nil
+}
+
+func (s *IntegrationHealthService) shouldAlert(state models.IntegrationHealthState, current IntegrationHealth, now time.Time) bool {
+	if current.Status != models.IntegrationDegraded && current.Status != models.IntegrationUnhealthy {
+		return false
+	}
+	if state.Status != models.IntegrationDegraded && state.Status != models.IntegrationUnhealthy {
+		return true
+	}
+	if state.Status == models.IntegrationDegraded && current.Status == models.IntegrationUnhealthy {
+		return true
+	}
+	return state.LastAlertAt == nil || now.Sub(*state.LastAlertAt) >= s.alertCooldown
+}
+
+func (s *IntegrationHealthService) raiseAlert(health IntegrationHealth) error {
+	if s.security == nil {
+		return nil
+	}
+	severity := SeverityMedium
+	if health.Status == models.IntegrationUnhealthy {
+		severity = SeverityHigh
+	}
+	_, err := s.security.GenerateAlert(
+		AlertTypeIntegrationDegraded,
+		severity,
+		fmt.Sprintf("%s integration %s", health.Provider, health.Status),
+		fmt.Sprintf("%s integration health is %.1f/100: %.0f%% of calls failing, %.0fms average latency, %d of %d token refreshes failing",
+			health.Provider, health.Score, health.ErrorRate*100, health.AverageLatencyMs, health.TokenRefreshFailures, health.TokenRefreshAttempts),
+		map[string]interface{}{
+			"provider":       health.Provider,
+			"health_score":   health.Score,
+			"health_status":  health.Status,
+			"error_rate":     health.ErrorRate,
+			"avg_latency_ms": health.AverageLatencyMs,
+			"remediation":    health.Remediation,
+		},
+	)
+	return err
+}
@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidIPAddress is returned when a reputation is requested for something that is not an IP address
+	ErrInvalidIPAddress = errors.New("invalid IP address")
+	// ErrInvalidIPOverride is returned for an override that is neither allow nor deny, or already expired
+	ErrInvalidIPOverride = errors.New("invalid IP reputation override")
+	// ErrIPOverrideNotFound is returned when clearing an override an IP address does not have
+	ErrIPOverrideNotFound = errors.New("IP reputation override not found")
+)
+
+// Internal observations that worsen an IP address's reputation
+const (
+	IPObservationFailedLogin = "failed_login"
+	IPObservationAlert       = "alert"
+)
+
+// IP reputation verdicts
+const (
+	IPVerdictAllowed  = "allowed"   // analyst allow override
+	IPVerdictDenied   = "denied"    // analyst deny override
+	IPVerdictHighRisk = "high_risk" // score at or above ipHighRiskScore
+	IPVerdictNeutral  = "neutral"
+)
+
+// How much one observation adds to the observation score, and the score from which an
+// IP address counts as high risk
+const (
+	ipFailedLoginWeight = 0.1
+	ipAlertWeight       = 0.25
+	ipHighRiskScore     = 0.7
+)
+
+// ipReputation scores IP addresses for the risk engine and security monitor. It is set by
+// SetIPReputationService; when nil no IP address has a reputation.
+var ipReputation *IPReputationService
+
+// IPReputationScore is an IP address's current reputation and what it is made of
+type IPReputationScore struct {
+	IPAddress         string     `json:"ip_address"`
+	Score             float64    `json:"score"`
+	Verdict           string     `json:"verdict"`
+	IntelScore        float64    `json:"intel_score"`
+	IntelSource       string     `json:"intel_source,omitempty"`
+	ObservationScore  float64    `json:"observation_score"` // after decay
+	FailedLogins      int64      `json:"failed_logins"`
+	Alerts            int64      `json:"alerts"`
+	ObservedAt        *time.Time `json:"observed_at,omitempty"`
+	Override          string     `json:"override,omitempty"`
+	OverrideReason    string     `json:"override_reason,omitempty"`
+	OverrideExpiresAt *time.Time `json:"override_expires_at,omitempty"`
+}
+
+// IPReputationService keeps a local reputation for IP addresses, combining cached
+// threat-intel lookups with failed logins and alerts seen from the address. Observations
+// lose half their weight every IP_REPUTATION_HALF_LIFE, so an address recovers once it
+// behaves; analyst allow and deny overrides take precedence over the score.
+type IPReputationService struct {
+	db       *gorm.DB
+	intel    *ThreatIntelligenceService
+	halfLife time.Duration
+	intelTTL time.Duration
+
+	// Serializes observation updates, which read, decay and write back the score
+	mu sync.Mutex
+
+	// Denied IP addresses and when their override expires, reloaded every
+	// IP_BLOCKLIST_REFRESH so request middleware does not query on every request
+	blockMu       sync.RWMutex
+	blocked       map[string]*time.Time
+	blockedAt     time.Time
+	blockInterval time.Duration
+}
+
+// NewIPReputationService creates a new IP reputation service. Threat intelligence may be
+// nil, in which case only observations and overrides count.
+func NewIPReputationService(db *gorm.DB, intel *ThreatIntelligenceService) *IPReputationService {
+	return &IPReputationService{
+		db:       db,
+		intel:    intel,
+		halfLife: envDuration("IP_REPUTATION_HALF_LIFE", 72*time.Hour),
+		intelTTL: envDuration("IP_REPUTATION_INTEL_TTL", 24*time.Hour),
+
+		blockInterval: envDuration("IP_BLOCKLIST_REFRESH", 15*time.Second),
+	}
+}
+
+// SetIPReputationService makes the risk engine and security monitor consult IP reputation
+func SetIPReputationService(s *IPReputationService) {
+	ipReputation = s
+}
+
+// observeIP counts an observation against an IP address when reputation is on.
+// Recording never fails the login or alert being observed.
+func observeIP(ipAddress, kind string) {
+	if ipReputation == nil || ipAddress == "" {
+		return
+	}
+	if err := ipReputation.Observe(ipAddress, kind, time.Now()); err != nil {
+		log.Printf("Failed to record %s from %s: %v", kind, ipAddress, err)
+	}
+}
+
+// ipIsHighRisk reports whether an IP address has a bad reputation, and is false when
+// reputation is off or cannot be read
+func ipIsHighRisk(ctx context.Context, ipAddress string) bool {
+	if ipReputation == nil {
+		return false
+	}
+	return ipReputation.IsHighRisk(ctx, ipAddress, time.Now())
+}
+
+// ipPreviewHighRisk is ipIsHighRisk for simulated sign-ins, which cache nothing
+func ipPreviewHighRisk(ctx context.Context, ipAddress string) bool {
+	if ipReputation == nil {
+		return false
+	}
+	reputation, err := ipReputation.Preview(ctx, ipAddress, time.Now())
+	return highRiskReputation(ipAddress, reputation, err)
+}
+
+// ipIsTorExitNode reports whether threat intelligence knows an IP address as a Tor exit
+// node, and is false when reputation is off
+func ipIsTorExitNode(ctx context.Context, ipAddress string) bool {
+	if ipReputation == nil || ipReputation.intel == nil {
+		return false
+	}
+	return ipReputation.intel.IsTorExitNode(ctx, ipAddress)
+}
+
+func normalizeIP(ipAddress string) (string, error) {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidIPAddress, ipAddress)
+	}
+	return ip.String(), nil
+}
+
+func (s *IPReputationService) load(ctx context.Context, ipAddress string) (*models.IPReputation, error) {
+	db, cancel := withDB(ctx, s.db)
+	defer cancel()
+	var reputation models.IPReputation
+	result := db.Where("ip_address = ?", ipAddress).Limit(1).Find(&reputation)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get IP reputation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		reputation.IPAddress = ipAddress
+	}
+	return &reputation, nil
+}
+
+// Lookup returns an IP address's reputation, first refreshing its threat-intel verdict
+// when that is older than IP_REPUTATION_INTEL_TTL. Misses are cached too.
+func (s *IPReputationService) Lookup(ctx context.Context, ipAddress string, now time.Time) (*IPReputationScore, error) {
+	return s.lookup(ctx, ipAddress, now, true)
+}
+
+// Preview scores an IP address like Lookup without caching the threat-intel verdict, so
+// simulated sign-ins leave no trace
+func (s *IPReputationService) Preview(ctx context.Context, ipAddress string, now time.Time) (*IPReputationScore, error) {
+	return s.lookup(ctx, ipAddress, now, false)
+}
+
+func (s *IPReputationService) lookup(ctx context.Context, ipAddress string, now time.Time, cacheIntel bool) (*IPReputationScore, error) {
+	ipAddress, err := normalizeIP(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	reputation, err := s.load(ctx, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.intel != nil && (reputation.IntelCheckedAt == nil || now.Sub(*reputation.IntelCheckedAt) >= s.intelTTL) {
+		checkedAt := now
+		reputation.IntelCheckedAt = &checkedAt
+		reputation.IntelScore, reputation.IntelSource = 0, ""
+		if data, err := s.intel.GetThreatData(ctx, ipAddress); err == nil && data != nil {
+			reputation.IntelScore = clamp01(data.Confidence)
+			reputation.IntelSource = data.Source
+		}
+		// A lookup cut short by a cancelled request is not a verdict worth keeping
+		if !cacheIntel || ctx.Err() != nil {
+			return s.score(reputation, now), nil
+		}
+		// Only the intel columns, so a concurrent observation is not overwritten
+		err := s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "ip_address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"intel_score", "intel_source", "intel_checked_at", "updated_at"}),
+		}).Create(reputation).Error
+		if err != nil {
+			// The score is still good without the cache, e.g. on a read-only replica
+			log.Printf("Failed to cache threat intel for %s: %v", ipAddress, err)
+		}
+	}
+	return s.score(reputation, now), nil
+}
+
+// IsHighRisk reports whether an IP address is denied or scores as high risk. Lookup
+// errors count as not high risk, so a reputation outage never locks users out.
+func (s *IPReputationService) IsHighRisk(ctx context.Context, ipAddress string, now time.Time) bool {
+	reputation, err := s.Lookup(ctx, ipAddress, now)
+	return highRiskReputation(ipAddress, reputation, err)
+}
+
+func highRiskReputation(ipAddress string, reputation *IPReputationScore, err error) bool {
+	if err != nil {
+		if !errors.Is(err, ErrInvalidIPAddress) {
+			log.Printf("Failed to look up reputation of %s: %v", ipAddress, err)
+		}
+		return false
+	}
+	return reputation.Verdict == IPVerdictDenied || reputation.Verdict == IPVerdictHighRisk
+}
+
+// IsBlocked reports whether requests from an IP address are refused because it has an
+// unexpired deny override. If the blocklist cannot be loaded the last one is used, or
+// nothing is blocked, so a database outage never locks everyone out.
+func (s *IPReputationService) IsBlocked(ipAddress string, now time.Time) bool {
+	ipAddress, err := normalizeIP(ipAddress)
+	if err != nil {
+		return false
+	}
+
+	s.blockMu.RLock()
+	stale := now.Sub(s.blockedAt) >= s.blockInterval
+	s.blockMu.RUnlock()
+	if stale {
+		s.reloadBlocklist(now)
+	}
+
+	s.blockMu.RLock()
+	defer s.blockMu.RUnlock()
+	expiresAt, blocked := s.blocked[ipAddress]
+	return blocked && (expiresAt == nil || now.Before(*expiresAt))
+}
+
+func (s *IPReputationService) reloadBlocklist(now time.Time) {
+	var denied []models.IPReputation
+	err := s.db.Select("ip_address, override_expires_at").
+		Where("override = ? AND (override_expires_at IS NULL OR override_expires_at > ?)", models.IPOverrideDeny, now).
+		Find(&denied).Error
+
+	s.blockMu.Lock()
+	defer s.blockMu.Unlock()
+	s.blockedAt = now
+	if err != nil {
+		log.Printf("Failed to load IP blocklist: %v", err)
+		return
+	}
+	s.blocked = make(map[string]*time.Time, len(denied))
+	for _, reputation := range denied {
+		s.blocked[reputation.IPAddress] = reputation.OverrideExpiresAt
+	}
+}
+
+// invalidateBlocklist makes the next IsBlocked reload the blocklist, so an override
+// changed on this instance applies at once rather than after IP_BLOCKLIST_REFRESH
+func (s *IPReputationService) invalidateBlocklist() {
+	s.blockMu.Lock()
+	s.blockedAt = time.Time{}
+	s.blockMu.Unlock()
+}
+
+// Observe counts a failed login or alert against an IP address
+func (s *IPReputationService) Observe(ipAddress, kind string, now time.Time) error {
+	ipAddress, err := normalizeIP(ipAddress)
+	if err != nil {
+		return err
+	}
+	weight := ipAlertWeight
+	if kind == IPObservationFailedLogin {
+		weight = ipFailedLoginWeight
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reputation, err := s.load(context.Background(), ipAddress)
+	if err != nil {
+		return err
+	}
+	reputation.ObservationScore = math.Min(s.decay(reputation.ObservationScore, reputation.ObservedAt, now)+weight, 1)
+	reputation.ObservedAt = &now
+	switch kind {
+	case IPObservationFailedLogin:
+		reputation.FailedLogins++
+	case IPObservationAlert:
+		reputation.Alerts++
+	}
+	if err := s.db.Save(reputation).Error; err != nil {
+		return fmt.Errorf("failed to save IP reputation: %w", err)
+	}
+	return nil
+}
+
+// SetOverride allows or denies an IP address regardless of its score, until expiresAt
+// when given
+func (s *IPReputationService) SetOverride(ipAddress, override, reason string, expiresAt *time.Time, actor *uuid.UUID, now time.Time) (*IPReputationScore, error) {
+	ipAddress, err := normalizeIP(ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if override != models.IPOverrideAllow && override != models.IPOverrideDeny {
+		return nil, fmt.Errorf("%w: override must be %q or %q", ErrInvalidIPOverride, models.IPOverrideAllow, models.IPOverrideDeny)
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at is in the past", ErrInvalidIPOverride)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reputation, err := s.load(context.Background(), ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	reputation.Override = override
+	reputation.OverrideReason = reason
+	reputation.OverrideBy = actor
+	reputation.OverrideExpiresAt = expiresAt
+	if err := s.db.Save(reputation).Error; err != nil {
+		return nil, fmt.Errorf("failed to save IP reputation override: %w", err)
+	}
+
+	s.invalidateBlocklist()
+	s.audit(actor, "ip_reputation_override_set", ipAddress, fmt.Sprintf("%s: %s", override, reason))
+	return s.score(reputation, now), nil
+}
+
+// ClearOverride removes an analyst override, so the IP address is scored again
+func (s *IPReputationService) ClearOverride(ipAddress string, actor *uuid.UUID) error {
+	ipAddress, err := normalizeIP(ipAddress)
+	if err != nil {
+		return err
+	}
+	result := s.db.Model(&models.IPReputation{}).Where("ip_address = ? AND override <> ''", ipAddress).Updates(map[string]interface{}{
+		"override":            "",
+		"override_reason":     "",
+		"override_by":         nil,
+		"override_expires_at": nil,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to clear IP reputation override: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrIPOverrideNotFound
+	}
+
+	s.invalidateBlocklist()
+	s.audit(actor, "ip_reputation_override_cleared", ipAddress, "IP reputation override removed")
+	return nil
+}
+
+// List returns a page of known IP addresses, most recently updated first, and the total
+func (s *IPReputationService) List(limit, offset int, now time.Time) ([]IPReputationScore, int64, error) {
+	var total int64
+	if err := s.db.Model(&models.IPReputation{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count IP reputations: %w", err)
+	}
+	var reputations []models.IPReputation
+	if err := s.db.Order("updated_at DESC").Limit(limit).Offset(offset).Find(&reputations).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list IP reputations: %w", err)
+	}
+
+	scores := make([]IPReputationScore, 0, len(reputations))
+	for i := range reputations {
+		scores = append(scores, *s.score(&reputations[i], now))
+	}
+	return scores, total, nil
+}
+
+// decay ages an observation score recorded at observedAt
+func (s *IPReputationService) decay(score float64, observedAt *time.Time, now time.Time) float64 {
+	if observedAt == nil || score == 0 {
+		return 0
+	}
+	age := now.Sub(*observedAt)
+	if age <= 0 {
+		return score
+	}
+	return score * math.Pow(0.5, age.Hours()/s.halfLife.Hours())
+}
+
+// score combines threat intel and decayed observations as independent signals, unless an
+// unexpired override decides
+func (s *IPReputationService) score(reputation *models.IPReputation, now time.Time) *IPReputationScore {
+	observation := s.decay(reputation.ObservationScore, reputation.ObservedAt, now)
+	result := &IPReputationScore{
+		IPAddress:        reputation.IPAddress,
+		IntelScore:       reputation.IntelScore,
+		IntelSource:      reputation.IntelSource,
+		ObservationScore: math.Round(observation*1000) / 1000,
+		FailedLogins:     reputation.FailedLogins,
+		Alerts:           reputation.Alerts,
+		ObservedAt:       reputation.ObservedAt,
+	}
+
+	overridden := reputation.Override != "" && (reputation.OverrideExpiresAt == nil || now.Before(*reputation.OverrideExpiresAt))
+	switch {
+	case overridden && reputation.Override == models.IPOverrideAllow:
+		result.Verdict = IPVerdictAllowed
+	case overridden && reputation.Override == models.IPOverrideDeny:
+		result.Score = 1
+		result.Verdict = IPVerdictDenied
+	default:
+		result.Score = math.Round((1-(1-reputation.IntelScore)*(1-observation))*1000) / 1000
+		result.Verdict = IPVerdictNeutral
+		if result.Score >= ipHighRiskScore {
+			result.Verdict = IPVerdictHighRisk
+		}
+	}
+	if overridden {
+		result.Override = reputation.Override
+		result.OverrideReason = reputation.OverrideReason
+		result.OverrideExpiresAt = reputation.OverrideExpiresAt
+	}
+	return result
+}
+
+func (s *IPReputationService) audit(actor *uuid.UUID, action, ipAddress, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "ip_reputation",
+		ResourceID: ipAddress,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit IP reputation change: %v", err)
+	}
+}
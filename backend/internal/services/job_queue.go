@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrReportJobNotFound is returned when a background report job does not exist
+	ErrReportJobNotFound = errors.New("report job not found")
+	// ErrReportJobFinished is returned when cancelling a job that has already finished
+	ErrReportJobFinished = errors.New("report job already finished")
+)
+
+// JobFunc does the work of a background job and returns its result, which is stored as
+// JSON. It should return promptly once ctx is cancelled.
+type JobFunc func(ctx context.Context, run *JobRun) (interface{}, error)
+
+// JobFilter narrows the job listing
+type JobFilter struct {
+	Kind        string
+	Status      string
+	RequestedBy *uuid.UUID
+}
+
+// JobQueue runs long reports and exports in the background for audit statistics,
+// compliance reports, audit exports, GDPR exports and privilege reviews. Jobs are persisted as ReportJobs
+// with their progress and log; at most JOB_QUEUE_CONCURRENCY run at once and the rest
+// wait for a slot. A JOB_NOTIFY_WEBHOOK_URL receives every job that finishes.
+type JobQueue struct {
+	db        *gorm.DB
+	slots     chan struct{}
+	deliverer *WebhookService
+	notifyURL string
+	retention time.Duration
+
+	mu      sync.Mutex
+	running map[uuid.UUID]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewJobQueue creates a job queue. deliverer sends completion notifications and may be
+// nil, in which case they are only logged.
+func NewJobQueue(db *gorm.DB, deliverer *WebhookService) *JobQueue {
+	concurrency := envInt("JOB_QUEUE_CONCURRENCY", envInt("AUDIT_REPORT_JOB_CONCURRENCY", 2))
+	return &JobQueue{
+		db:        db,
+		slots:     make(chan struct{}, max(concurrency, 1)),
+		deliverer: deliverer,
+		notifyURL: getEnv("JOB_NOTIFY_WEBHOOK_URL", ""),
+		retention: envDuration("JOB_RETENTION", 30*24*time.Hour),
+		running:   make(map[uuid.UUID]context.CancelFunc),
+	}
+}
+
+// JobRun is handed to a running job for reporting progress and writing to its log
+type JobRun struct {
+	queue  *JobQueue
+	jobID  uuid.UUID
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// ID returns the running job's ID
+func (r *JobRun) ID() uuid.UUID {
+	return r.jobID
+}
+
+// Progress records how far the job has got, as a percentage below 100, and returns
+// ctx.Err() once the job has been cancelled, including from another instance
+func (r *JobRun) Progress(percent int, message string) error {
+	percent = min(max(percent, 0), 99)
+	if err := r.queue.db.Model(&models.ReportJob{}).Where("id = ?", r.jobID).
+		Updates(map[string]interface{}{"progress": percent, "progress_message": message}).Error; err != nil {
+		log.Printf("Failed to save progress of job %s: %v", r.jobID, err)
+	}
+
+	var job models.ReportJob
+	if err := r.queue.db.Select("cancel_requested").First(&job, "id = ?", r.jobID).Error; err == nil && job.CancelRequested {
+		r.cancel()
+	}
+	return r.ctx.Err()
+}
+
+// Logf appends an info line to the job's log
+func (r *JobRun) Logf(format string, args ...interface{}) {
+	r.queue.log(r.jobID, models.ReportJobLogInfo, fmt.Sprintf(format, args...))
+}
+
+// Warnf appends a warning to the job's log
+func (r *JobRun) Warnf(format string, args ...interface{}) {
+	r.queue.log(r.jobID, models.ReportJobLogWarn, fmt.Sprintf(format, args...))
+}
+
+// Enqueue saves job as pending and runs fn for it in the background
+func (q *JobQueue) Enqueue(job *models.ReportJob, fn JobFunc) error {
+	job.Status = models.ReportJobPending
+	if err := q.db.Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create report job: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+
+	q.wg.Add(1)
+	go q.run(ctx, cancel, job.ID, job.Kind, fn)
+	return nil
+}
+
+func (q *JobQueue) run(ctx context.Context, cancel context.CancelFunc, jobID uuid.UUID, kind string, fn JobFunc) {
+	defer q.wg.Done()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, jobID)
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	select {
+	case q.slots <- struct{}{}:
+		defer func() { <-q.slots }()
+	case <-ctx.Done():
+		// Cancelled while waiting, either by Cancel, which has already marked it, or by Shutdown
+		if err := q.db.Model(&models.ReportJob{}).Where("id = ? AND status = ?", jobID, models.ReportJobPending).
+			Updates(map[string]interface{}{"status": models.ReportJobCancelled, "completed_at": time.Now()}).Error; err != nil {
+			log.Printf("Failed to cancel report job %s: %v", jobID, err)
+		}
+		return
+	}
+
+	// A job cancelled while pending, possibly on another instance, is not started
+	startedAt := time.Now()
+	started := q.db.Model(&models.ReportJob{}).Where("id = ? AND status = ?", jobID, models.ReportJobPending).
+		Updates(map[string]interface{}{"status": models.ReportJobRunning, "started_at": startedAt})
+	if started.Error != nil {
+		log.Printf("Failed to start report job %s: %v", jobID, started.Error)
+		return
+	}
+	if started.RowsAffected == 0 {
+		return
+	}
+	q.log(jobID, models.ReportJobLogInfo, fmt.Sprintf("Started %s job", kind))
+
+	result, err := fn(ctx, &JobRun{queue: q, jobID: jobID, ctx: ctx, cancel: cancel})
+
+	updates := map[string]interface{}{"completed_at": time.Now()}
+	if err == nil {
+		encoded, encodeErr := json.Marshal(result)
+		err = encodeErr
+		updates["result"] = string(encoded)
+	}
+	switch {
+	case ctx.Err() != nil:
+		updates["status"] = models.ReportJobCancelled
+		q.log(jobID, models.ReportJobLogWarn, "Cancelled")
+	case err != nil:
+		updates["status"] = models.ReportJobFailed
+		updates["error"] = err.Error()
+		q.log(jobID, models.ReportJobLogError, err.Error())
+	default:
+		updates["status"] = models.ReportJobCompleted
+		updates["progress"] = 100
+		q.log(jobID, models.ReportJobLogInfo, fmt.Sprintf("Completed in %s", time.Since(startedAt).Round(time.Millisecond)))
+	}
+	if err := q.db.Model(&models.ReportJob{}).Where("id = ?", jobID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to save report job %s: %v", jobID, err)
+		return
+	}
+
+	q.notify(jobID)
+}
+
+// Get returns a job; its result is JSON once completed
+func (q *JobQueue) Get(jobID uuid.UUID) (*models.ReportJob, error) {
+	var job models.ReportJob
+	if err := q.db.First(&job, "id = ?", jobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get report job: %w", err)
+	}
+	return &job, nil
+}
+
+// List returns jobs matching filter, newest first
+func (q *JobQueue) List(filter JobFilter, limit, offset int) ([]models.ReportJob, int64, error) {
+	query := q.db.Model(&models.ReportJob{})
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.RequestedBy != nil {
+		query = query.Where("requested_by = ?", *filter.RequestedBy)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count report jobs: %w", err)
+	}
+	var jobs []models.ReportJob
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list report jobs: %w", err)
+	}
+	return jobs, total, nil
+}
+
+// Logs returns a job's log, oldest first
+func (q *JobQueue) Logs(jobID uuid.UUID, limit, offset int) ([]models.ReportJobLog, int64, error) {
+	if _, err := q.Get(jobID); err != nil {
+		return nil, 0, err
+	}
+
+	query := q.db.Model(&models.ReportJobLog{}).Where("job_id = ?", jobID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count job logs: %w", err)
+	}
+	var logs []models.ReportJobLog
+	if err := query.Order("created_at ASC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list job logs: %w", err)
+	}
+	return logs, total, nil
+}
+
+// Cancel stops a job. A pending job is cancelled at once; a running job is told to stop
+// and is marked cancelled when its function returns.
+func (q *JobQueue) Cancel(jobID uuid.UUID, actor *uuid.UUID) (*models.ReportJob, error) {
+	job, err := q.Get(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.IsFinished() {
+		return nil, fmt.Errorf("%w: job is %s", ErrReportJobFinished, job.Status)
+	}
+
+	if err := q.db.Model(&models.ReportJob{}).Where("id = ?", jobID).Update("cancel_requested", true).Error; err != nil {
+		return nil, fmt.Errorf("failed to cancel report job: %w", err)
+	}
+	cancelled := q.db.Model(&models.ReportJob{}).Where("id = ? AND status = ?", jobID, models.ReportJobPending).
+		Updates(map[string]interface{}{"status": models.ReportJobCancelled, "completed_at": time.Now()})
+	if cancelled.Error != nil {
+		return nil, fmt.Errorf("failed to cancel report job: %w", cancelled.Error)
+	}
+
+	q.mu.Lock()
+	if cancel, ok := q.running[jobID]; ok {
+		cancel()
+	}
+	q.mu.Unlock()
+
+	q.log(jobID, models.ReportJobLogWarn, "Cancellation requested")
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     "report_job_cancelled",
+		Resource:   "report_job",
+		ResourceID: jobID.String(),
+		Details:    fmt.Sprintf("Cancelled %s job", job.Kind),
+		Status:     "success",
+	}
+	if err := q.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit report job cancellation: %v", err)
+	}
+	if cancelled.RowsAffected > 0 {
+		q.notify(jobID)
+	}
+
+	return q.Get(jobID)
+}
+
+// Shutdown cancels every pending and running job, so each is recorded as cancelled rather
+// than left running, and waits until ctx is done for them to return
+func (q *JobQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	for _, cancel := range q.running {
+		cancel()
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("report jobs still running at shutdown: %w", ctx.Err())
+	}
+}
+
+// Interval returns how often finished jobs past retention are purged
+func (q *JobQueue) Interval() time.Duration {
+	return time.Hour
+}
+
+// PurgeFinished deletes finished jobs, and their logs, that completed more than
+// JOB_RETENTION ago
+func (q *JobQueue) PurgeFinished(now time.Time) (int64, error) {
+	cutoff := now.Add(-q.retention)
+	finished := q.db.Model(&models.ReportJob{}).Select("id").
+		Where("status IN ? AND completed_at < ?", []string{models.ReportJobCompleted, models.ReportJobFailed, models.ReportJobCancelled}, cutoff)
+	if err := q.db.Where("job_id IN (?)", finished).Delete(&models.ReportJobLog{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to purge job logs: %w", err)
+	}
+	result := q.db.Where("status IN ? AND completed_at < ?", []string{models.ReportJobCompleted, models.ReportJobFailed, models.ReportJobCancelled}, cutoff).
+		Delete(&models.ReportJob{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge report jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (q *JobQueue) log(jobID uuid.UUID, level, message string) {
+	entry := models.ReportJobLog{JobID: jobID, Level: level, Message: message}
+	if err := q.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write log of job %s: %v", jobID, err)
+	}
+}
+
+// notify announces a finished job to JOB_NOTIFY_WEBHOOK_URL; the result itself is not
+// sent and has to be fetched through the API
+func (q *JobQueue) notify(jobID uuid.UUID) {
+	job, err := q.Get(jobID)
+	if err != nil {
+		log.Printf("Failed to load finished job %s: %v", jobID, err)
+		return
+	}
+	log.Printf("📦 %s job %s %s", job.Kind, job.ID, job.Status)
+	if q.deliverer == nil || q.notifyURL == "" {
+		return
+	}
+	if err := q.deliverer.Deliver(models.WebhookSourceJob, "job."+job.Status, q.notifyURL, nil, job); err != nil {
+		log.Printf("Failed to notify %s of job %s: %v", q.notifyURL, job.ID, err)
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrKerberosDisabled is returned when no keytab or internal networks are configured
+	ErrKerberosDisabled = errors.New("kerberos sign-in is not configured")
+	// ErrInvalidKerberosTicket is returned for tickets that are not for this service, or
+	// whose ticket, authenticator or times do not check out
+	ErrInvalidKerberosTicket = errors.New("invalid kerberos ticket")
+	// ErrKerberosPrincipalUnknown is returned when a valid principal maps to no active user
+	ErrKerberosPrincipalUnknown = errors.New("kerberos principal does not match a user")
+)
+
+// KerberosPrincipal is a client authenticated by a Kerberos service ticket
+type KerberosPrincipal struct {
+	Name  string // e.g. "alice"
+	Realm string // e.g. "CORP.EXAMPLE.COM"
+}
+
+// String formats the principal as name@REALM
+func (p KerberosPrincipal) String() string {
+	return p.Name + "@" + p.Realm
+}
+
+// KerberosService validates SPNEGO (HTTP Negotiate) tokens from domain-joined devices so
+// they can sign in without a password. It decrypts the service ticket with the key for
+// CloudGate's service principal from KERBEROS_KEYTAB and checks the authenticator, which
+// the replay guard accepts only once. Negotiation is only offered to clients on
+// KERBEROS_INTERNAL_NETWORKS; everyone else uses the normal sign-in.
+type KerberosService struct {
+	db          *gorm.DB
+	replay      *ReplayGuard
+	keys        []KeytabEntry
+	networks    []*net.IPNet
+	emailDomain string
+}
+
+// NewKerberosService creates the Kerberos service from KERBEROS_KEYTAB (a keytab file
+// path), KERBEROS_INTERNAL_NETWORKS (comma separated CIDRs) and KERBEROS_EMAIL_DOMAIN,
+// which maps principals to user emails and defaults to the lowercased realm
+func NewKerberosService(db *gorm.DB, replay *ReplayGuard) *KerberosService {
+	service := &KerberosService{
+		db:          db,
+		replay:      replay,
+		networks:    parseNetworks("KERBEROS_INTERNAL_NETWORKS", getEnv("KERBEROS_INTERNAL_NETWORKS", "")),
+		emailDomain: strings.ToLower(getEnv("KERBEROS_EMAIL_DOMAIN", "")),
+	}
+	if path := getEnv("KERBEROS_KEYTAB", ""); path != "" {
+		if err := service.LoadKeytab(path); err != nil {
+			log.Printf("⚠️ Kerberos sign-in disabled: %v", err)
+		}
+	}
+	return service
+}
+
+// LoadKeytab replaces the service keys with those in a keytab file
+func (s *KerberosService) LoadKeytab(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read keytab: %w", err)
+	}
+	keys, err := ParseKeytab(data)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	return nil
+}
+
+func parseNetworks(setting, value string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() == nil {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("⚠️ Ignoring %s entry %q: %v", setting, entry, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Enabled reports whether a keytab and at least one internal network are configured
+func (s *KerberosService) Enabled() bool {
+	return len(s.keys) > 0 && len(s.networks) > 0
+}
+
+// OnInternalNetwork reports whether a client address may be offered Negotiate
+func (s *KerberosService) OnInternalNetwork(ipAddress string) bool {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate validates the token from an "Authorization: Negotiate" header and returns
+// the client principal it proves
+func (s *KerberosService) Authenticate(token []byte, source TokenSource, now time.Time) (*KerberosPrincipal, error) {
+	if !s.Enabled() {
+		return nil, ErrKerberosDisabled
+	}
+	apReqBytes, err := extractAPReq(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var apReq kerberosAPReq
+	if _, err := asn1.UnmarshalWithParams(apReqBytes, &apReq, "application,explicit,tag:14"); err != nil {
+		return nil, fmt.Errorf("%w: malformed AP-REQ: %v", ErrInvalidSPNEGOToken, err)
+	}
+	if apReq.PVNO != kerberosPVNO || apReq.MsgType != kerberosMsgTypeAPReq {
+		return nil, fmt.Errorf("%w: not a Kerberos v5 AP-REQ", ErrInvalidSPNEGOToken)
+	}
+	// An explicitly tagged RawValue keeps its [3] wrapper; the ticket is inside it
+	var ticket kerberosTicket
+	if _, err := asn1.UnmarshalWithParams(apReq.Ticket.Bytes, &ticket, "application,explicit,tag:1"); err != nil {
+		return nil, fmt.Errorf("%w: malformed ticket: %v", ErrInvalidKerberosTicket, err)
+	}
+
+	// The ticket is sealed with our service key; being able to open it proves the KDC issued it
+	serviceKey, err := s.serviceKey(ticket)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := serviceKey.Decrypt(kerberosUsageTicket, ticket.EncPart.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKerberosTicket, err)
+	}
+	var encPart kerberosEncTicketPart
+	if _, err := asn1.UnmarshalWithParams(plaintext, &encPart, "application,explicit,tag:3"); err != nil {
+		return nil, fmt.Errorf("%w: malformed ticket contents: %v", ErrInvalidKerberosTicket, err)
+	}
+	skew := s.replay.skew
+	if !encPart.StartTime.IsZero() && now.Add(skew).Before(encPart.StartTime) {
+		return nil, fmt.Errorf("%w: ticket is not yet valid", ErrInvalidKerberosTicket)
+	}
+	if !now.Add(-skew).Before(encPart.EndTime) {
+		return nil, fmt.Errorf("%w: ticket has expired", ErrInvalidKerberosTicket)
+	}
+
+	// The authenticator is sealed with the ticket's session key, which only the client has
+	sessionKey := KerberosKey{Type: encPart.Key.KeyType, Value: encPart.Key.KeyValue}
+	plaintext, err = sessionKey.Decrypt(kerberosUsageAuthenticator, apReq.Authenticator.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("%w: authenticator: %v", ErrInvalidKerberosTicket, err)
+	}
+	var authenticator kerberosAuthenticator
+	if _, err := asn1.UnmarshalWithParams(plaintext, &authenticator, "application,explicit,tag:2"); err != nil {
+		return nil, fmt.Errorf("%w: malformed authenticator: %v", ErrInvalidKerberosTicket, err)
+	}
+	if authenticator.CRealm != encPart.CRealm || !authenticator.CName.Equal(encPart.CName) {
+		return nil, fmt.Errorf("%w: authenticator is for a different client", ErrInvalidKerberosTicket)
+	}
+
+	principal := &KerberosPrincipal{Name: encPart.CName.String(), Realm: encPart.CRealm}
+	if err := s.replay.CheckKerberosAuthenticator(principal.Realm, principal.Name, authenticator.CTime, authenticator.Cusec, source, now); err != nil {
+		return nil, err
+	}
+	return principal, nil
+}
+
+// serviceKey finds the keytab key the ticket was sealed with, preferring the ticket's key
+// version and otherwise the newest key for the service principal
+func (s *KerberosService) serviceKey(ticket kerberosTicket) (KerberosKey, error) {
+	var match *KeytabEntry
+	for i := range s.keys {
+		entry := &s.keys[i]
+		if !strings.EqualFold(entry.Realm, ticket.Realm) || !entry.Principal.Equal(ticket.SName) || entry.Key.Type != ticket.EncPart.EType {
+			continue
+		}
+		if ticket.EncPart.KVNO != 0 && entry.KVNO == uint32(ticket.EncPart.KVNO) {
+			return entry.Key, nil
+		}
+		if match == nil || entry.KVNO > match.KVNO {
+			match = entry
+		}
+	}
+	if match == nil {
+		return KerberosKey{}, fmt.Errorf("%w: no key for %s@%s (etype %d)", ErrInvalidKerberosTicket, ticket.SName, ticket.Realm, ticket.EncPart.EType)
+	}
+	return match.Key, nil
+}
+
+// ResolveUser maps a principal to an active user by username, or by the email formed
+// from the principal name and KERBEROS_EMAIL_DOMAIN. Service principals never match.
+func (s *KerberosService) ResolveUser(principal *KerberosPrincipal) (*models.User, error) {
+	name := strings.ToLower(principal.Name)
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("%w: %s", ErrKerberosPrincipalUnknown, principal)
+	}
+	domain := s.emailDomain
+	if domain == "" {
+		domain = strings.ToLower(principal.Realm)
+	}
+
+	var user models.User
+	err := s.db.Where("(LOWER(username) = ? OR LOWER(email) = ?) AND is_active = ?", name, name+"@"+domain, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrKerberosPrincipalUnknown, principal)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up kerberos user: %w", err)
+	}
+	return &user, nil
+}
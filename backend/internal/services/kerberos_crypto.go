@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Kerberos encryption types supported for service tickets (RFC 3962)
+const (
+	KerberosETypeAES128 int32 = 17 // aes128-cts-hmac-sha1-96
+	KerberosETypeAES256 int32 = 18 // aes256-cts-hmac-sha1-96
+)
+
+// Kerberos key usage numbers (RFC 4120 section 7.5.1)
+const (
+	kerberosUsageTicket        uint32 = 2
+	kerberosUsageAuthenticator uint32 = 11
+)
+
+const (
+	kerberosConfounderSize = aes.BlockSize
+	kerberosChecksumSize   = 12 // HMAC-SHA1 truncated to 96 bits
+)
+
+// ErrKerberosIntegrity is returned when a ciphertext fails its HMAC check, i.e. it was
+// not encrypted with this key or was tampered with
+var ErrKerberosIntegrity = errors.New("kerberos integrity check failed")
+
+// KerberosKey is a long-term or session key with its encryption type
+type KerberosKey struct {
+	Type  int32
+	Value []byte
+}
+
+func (k KerberosKey) check() error {
+	switch {
+	case k.Type == KerberosETypeAES128 && len(k.Value) == 16:
+	case k.Type == KerberosETypeAES256 && len(k.Value) == 32:
+	default:
+		return fmt.Errorf("unsupported kerberos key: etype %d with %d bytes", k.Type, len(k.Value))
+	}
+	return nil
+}
+
+// Encrypt seals plaintext for the given key usage: a random confounder and the
+// plaintext under AES-CTS with Ke, followed by a truncated HMAC-SHA1 under Ki
+func (k KerberosKey) Encrypt(usage uint32, plaintext []byte) ([]byte, error) {
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	ke, ki := k.deriveUsageKeys(usage)
+	data := make([]byte, kerberosConfounderSize, kerberosConfounderSize+len(plaintext))
+	if _, err := rand.Read(data); err != nil {
+		return nil, fmt.Errorf("failed to generate confounder: %w", err)
+	}
+	data = append(data, plaintext...)
+
+	ciphertext, err := ctsEncrypt(ke, data)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, ki)
+	mac.Write(data)
+	return append(ciphertext, mac.Sum(nil)[:kerberosChecksumSize]...), nil
+}
+
+// Decrypt opens a ciphertext produced by Encrypt with the same usage
+func (k KerberosKey) Decrypt(usage uint32, ciphertext []byte) ([]byte, error) {
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < kerberosConfounderSize+kerberosChecksumSize {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrKerberosIntegrity)
+	}
+	ke, ki := k.deriveUsageKeys(usage)
+	body, checksum := ciphertext[:len(ciphertext)-kerberosChecksumSize], ciphertext[len(ciphertext)-kerberosChecksumSize:]
+	data, err := ctsDecrypt(ke, body)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, ki)
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil)[:kerberosChecksumSize], checksum) {
+		return nil, ErrKerberosIntegrity
+	}
+	return data[kerberosConfounderSize:], nil
+}
+
+// deriveUsageKeys derives the encryption (0xAA) and integrity (0x55) keys for a usage
+func (k KerberosKey) deriveUsageKeys(usage uint32) ([]byte, []byte) {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+	constant[4] = 0xAA
+	ke := deriveKerberosKey(k.Value, constant)
+	constant[4] = 0x55
+	ki := deriveKerberosKey(k.Value, constant)
+	return ke, ki
+}
+
+// deriveKerberosKey is DK(base, constant) from RFC 3961 section 5.1: the n-folded
+// constant is encrypted repeatedly until there are enough bits for a key
+func deriveKerberosKey(base, constant []byte) []byte {
+	block, _ := aes.NewCipher(base)
+	input := nFold(constant, aes.BlockSize*8)
+	derived := make([]byte, 0, len(base)+aes.BlockSize)
+	for len(derived) < len(base) {
+		output := make([]byte, aes.BlockSize)
+		block.Encrypt(output, input)
+		derived = append(derived, output...)
+		input = output
+	}
+	return derived[:len(base)]
+}
+
+// nFold stretches or shrinks input to n bits (RFC 3961 section 5.1): copies rotated
+// right by 13 bits each are concatenated and summed in n-bit chunks with end-around carry
+func nFold(input []byte, n int) []byte {
+	k := len(input) * 8
+	lcm := n * k / gcd(n, k)
+	var expanded []byte
+	for i := 0; i < lcm/k; i++ {
+		expanded = append(expanded, rotateBitsRight(input, 13*i)...)
+	}
+
+	out := make([]byte, n/8)
+	for offset := 0; offset < len(expanded); offset += n / 8 {
+		carry := 0
+		for j := n/8 - 1; j >= 0; j-- {
+			sum := int(out[j]) + int(expanded[offset+j]) + carry
+			out[j] = byte(sum)
+			carry = sum >> 8
+		}
+		for j := n/8 - 1; carry > 0 && j >= 0; j-- {
+			sum := int(out[j]) + carry
+			out[j] = byte(sum)
+			carry = sum >> 8
+		}
+	}
+	return out
+}
+
+func rotateBitsRight(input []byte, step int) []byte {
+	bits := len(input) * 8
+	out := make([]byte, len(input))
+	for i := 0; i < bits; i++ {
+		if input[i/8]&(0x80>>(i%8)) != 0 {
+			j := (i + step) % bits
+			out[j/8] |= 0x80 >> (j % 8)
+		}
+	}
+	return out
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// ctsEncrypt is AES-CBC with ciphertext stealing as Kerberos uses it (RFC 3962): a zero
+// IV, and the last two blocks always swapped when there is more than one block
+func ctsEncrypt(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) <= aes.BlockSize {
+		if len(plaintext) < aes.BlockSize {
+			return nil, errors.New("kerberos plaintext shorter than one block")
+		}
+		out := make([]byte, aes.BlockSize)
+		block.Encrypt(out, plaintext)
+		return out, nil
+	}
+
+	tail := len(plaintext) % aes.BlockSize
+	if tail == 0 {
+		tail = aes.BlockSize
+	}
+	padded := make([]byte, len(plaintext)-tail+aes.BlockSize)
+	copy(padded, plaintext)
+	cbc := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(cbc, padded)
+
+	n := len(cbc)
+	out := make([]byte, 0, len(plaintext))
+	out = append(out, cbc[:n-2*aes.BlockSize]...)
+	out = append(out, cbc[n-aes.BlockSize:]...)
+	out = append(out, cbc[n-2*aes.BlockSize:n-2*aes.BlockSize+tail]...)
+	return out, nil
+}
+
+func ctsDecrypt(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, fmt.Errorf("%w: ciphertext shorter than one block", ErrKerberosIntegrity)
+	}
+	if len(ciphertext) == aes.BlockSize {
+		out := make([]byte, aes.BlockSize)
+		block.Decrypt(out, ciphertext)
+		return out, nil
+	}
+
+	tail := len(ciphertext) % aes.BlockSize
+	if tail == 0 {
+		tail = aes.BlockSize
+	}
+	head := len(ciphertext) - tail - aes.BlockSize // whole blocks before the swapped pair
+	previous := make([]byte, aes.BlockSize)
+	if head > 0 {
+		copy(previous, ciphertext[head-aes.BlockSize:head])
+	}
+	out := make([]byte, len(ciphertext))
+	if head > 0 {
+		cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out[:head], ciphertext[:head])
+	}
+
+	// The stolen block decrypts to the partial last plaintext and the bytes the
+	// penultimate ciphertext block lost
+	stolen := make([]byte, aes.BlockSize)
+	block.Decrypt(stolen, ciphertext[head:head+aes.BlockSize])
+	last := ciphertext[head+aes.BlockSize:]
+	for i := 0; i < tail; i++ {
+		out[head+aes.BlockSize+i] = stolen[i] ^ last[i]
+	}
+	penultimate := append(append([]byte(nil), last...), stolen[tail:]...)
+	block.Decrypt(out[head:head+aes.BlockSize], penultimate)
+	for i := 0; i < aes.BlockSize; i++ {
+		out[head+i] ^= previous[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GSS-API mechanism OIDs a browser may offer. Windows clients send the Microsoft legacy
+// OID for the same Kerberos v5 mechanism.
+var (
+	oidSPNEGO        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidKerberos5     = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	oidMSKerberos5   = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+	krb5TokenIDAPReq = []byte{0x01, 0x00}
+)
+
+// Kerberos message types and the only protocol version (RFC 4120)
+const (
+	kerberosPVNO         = 5
+	kerberosMsgTypeAPReq = 14
+)
+
+var (
+	// ErrInvalidSPNEGOToken is returned for Negotiate tokens that are not a Kerberos AP-REQ
+	ErrInvalidSPNEGOToken = errors.New("invalid SPNEGO token")
+	// ErrInvalidKeytab is returned when a keytab file cannot be parsed
+	ErrInvalidKeytab = errors.New("invalid keytab")
+)
+
+// KerberosPrincipalName is a principal name without its realm. Kerberos strings are
+// GeneralStrings, which encoding/asn1 reads into Go strings.
+type KerberosPrincipalName struct {
+	NameType   int32    `asn1:"explicit,tag:0"`
+	NameString []string `asn1:"explicit,tag:1"`
+}
+
+// String joins the name components the usual way, e.g. "HTTP/sso.example.com"
+func (n KerberosPrincipalName) String() string {
+	return strings.Join(n.NameString, "/")
+}
+
+// Equal reports whether two names have the same components; the name type is a hint only
+func (n KerberosPrincipalName) Equal(other KerberosPrincipalName) bool {
+	if len(n.NameString) != len(other.NameString) {
+		return false
+	}
+	for i := range n.NameString {
+		if n.NameString[i] != other.NameString[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// KerberosEncryptedData is ciphertext tagged with the etype and key version that sealed it
+type KerberosEncryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+// KerberosEncryptionKey is a key as carried inside tickets
+type KerberosEncryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+// kerberosAPReq is an AP-REQ, [APPLICATION 14]
+type kerberosAPReq struct {
+	PVNO          int                   `asn1:"explicit,tag:0"`
+	MsgType       int                   `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString        `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue         `asn1:"explicit,tag:3"`
+	Authenticator KerberosEncryptedData `asn1:"explicit,tag:4"`
+}
+
+// kerberosTicket is a service ticket, [APPLICATION 1]
+type kerberosTicket struct {
+	TktVNO  int                   `asn1:"explicit,tag:0"`
+	Realm   string                `asn1:"explicit,tag:1"`
+	SName   KerberosPrincipalName `asn1:"explicit,tag:2"`
+	EncPart KerberosEncryptedData `asn1:"explicit,tag:3"`
+}
+
+// kerberosEncTicketPart is the part of a ticket sealed with the service key, [APPLICATION 3]
+type kerberosEncTicketPart struct {
+	Flags             asn1.BitString        `asn1:"explicit,tag:0"`
+	Key               KerberosEncryptionKey `asn1:"explicit,tag:1"`
+	CRealm            string                `asn1:"explicit,tag:2"`
+	CName             KerberosPrincipalName `asn1:"explicit,tag:3"`
+	Transited         asn1.RawValue         `asn1:"explicit,tag:4"`
+	AuthTime          time.Time             `asn1:"generalized,explicit,tag:5"`
+	StartTime         time.Time             `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime           time.Time             `asn1:"generalized,explicit,tag:7"`
+	RenewTill         time.Time             `asn1:"generalized,optional,explicit,tag:8"`
+	CAddr             asn1.RawValue         `asn1:"optional,explicit,tag:9"`
+	AuthorizationData asn1.RawValue         `asn1:"optional,explicit,tag:10"`
+}
+
+// kerberosAuthenticator proves the client holds the ticket's session key, [APPLICATION 2]
+type kerberosAuthenticator struct {
+	AuthenticatorVNO  int                   `asn1:"explicit,tag:0"`
+	CRealm            string                `asn1:"explicit,tag:1"`
+	CName             KerberosPrincipalName `asn1:"explicit,tag:2"`
+	Cksum             asn1.RawValue         `asn1:"optional,explicit,tag:3"`
+	Cusec             int                   `asn1:"explicit,tag:4"`
+	CTime             time.Time             `asn1:"generalized,explicit,tag:5"`
+	Subkey            asn1.RawValue         `asn1:"optional,explicit,tag:6"`
+	SeqNumber         int64                 `asn1:"optional,explicit,tag:7"`
+	AuthorizationData asn1.RawValue         `asn1:"optional,explicit,tag:8"`
+}
+
+// spnegoNegTokenInit is the client's first SPNEGO message (RFC 4178)
+type spnegoNegTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	ReqFlags    asn1.BitString          `asn1:"optional,explicit,tag:1"`
+	MechToken   []byte                  `asn1:"optional,explicit,tag:2"`
+	MechListMIC []byte                  `asn1:"optional,explicit,tag:3"`
+}
+
+// unwrapGSSToken splits a GSS-API InitialContextToken ([APPLICATION 0]) into its
+// mechanism OID and the mechanism-specific bytes that follow it
+func unwrapGSSToken(token []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var outer asn1.RawValue
+	rest, err := asn1.Unmarshal(token, &outer)
+	if err != nil || len(rest) > 0 || outer.Class != asn1.ClassApplication || outer.Tag != 0 {
+		return nil, nil, fmt.Errorf("%w: not a GSS-API initial context token", ErrInvalidSPNEGOToken)
+	}
+	var mech asn1.ObjectIdentifier
+	inner, err := asn1.Unmarshal(outer.Bytes, &mech)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: missing mechanism OID", ErrInvalidSPNEGOToken)
+	}
+	return mech, inner, nil
+}
+
+// extractAPReq finds the Kerberos AP-REQ in a Negotiate token, which is either SPNEGO
+// wrapping a Kerberos mechToken or, from some clients, the raw Kerberos GSS token
+func extractAPReq(token []byte) ([]byte, error) {
+	mech, inner, err := unwrapGSSToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if mech.Equal(oidSPNEGO) {
+		var choice asn1.RawValue
+		if _, err := asn1.Unmarshal(inner, &choice); err != nil || choice.Class != asn1.ClassContextSpecific || choice.Tag != 0 {
+			return nil, fmt.Errorf("%w: expected NegTokenInit", ErrInvalidSPNEGOToken)
+		}
+		var init spnegoNegTokenInit
+		if _, err := asn1.Unmarshal(choice.Bytes, &init); err != nil {
+			return nil, fmt.Errorf("%w: malformed NegTokenInit: %v", ErrInvalidSPNEGOToken, err)
+		}
+		// The optimistic mechToken is for the client's preferred mechanism, which must be
+		// Kerberos; NTLM is not supported
+		if len(init.MechTypes) == 0 || !isKerberosMech(init.MechTypes[0]) || len(init.MechToken) == 0 {
+			return nil, fmt.Errorf("%w: client did not offer Kerberos", ErrInvalidSPNEGOToken)
+		}
+		mech, inner, err = unwrapGSSToken(init.MechToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !isKerberosMech(mech) {
+		return nil, fmt.Errorf("%w: unsupported mechanism %s", ErrInvalidSPNEGOToken, mech)
+	}
+	if !bytes.HasPrefix(inner, krb5TokenIDAPReq) {
+		return nil, fmt.Errorf("%w: expected a Kerberos AP-REQ", ErrInvalidSPNEGOToken)
+	}
+	return inner[len(krb5TokenIDAPReq):], nil
+}
+
+func isKerberosMech(mech asn1.ObjectIdentifier) bool {
+	return mech.Equal(oidKerberos5) || mech.Equal(oidMSKerberos5)
+}
+
+// KeytabEntry is one service key from a keytab
+type KeytabEntry struct {
+	Realm     string
+	Principal KerberosPrincipalName
+	KVNO      uint32
+	Key       KerberosKey
+}
+
+// ParseKeytab reads an MIT keytab (format version 0x0502), as written by ktutil or
+// ktpass. Deleted entries are skipped.
+func ParseKeytab(data []byte) ([]KeytabEntry, error) {
+	if len(data) < 2 || data[0] != 0x05 || data[1] != 0x02 {
+		return nil, fmt.Errorf("%w: unsupported keytab version", ErrInvalidKeytab)
+	}
+	r := bytes.NewReader(data[2:])
+
+	var entries []KeytabEntry
+	for r.Len() > 0 {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKeytab, err)
+		}
+		if size < 0 {
+			// A hole left by a deleted entry
+			if _, err := r.Seek(int64(-size), io.SeekCurrent); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidKeytab, err)
+			}
+			continue
+		}
+		record := make([]byte, size)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, fmt.Errorf("%w: truncated entry", ErrInvalidKeytab)
+		}
+		entry, err := parseKeytabEntry(record)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func parseKeytabEntry(record []byte) (*KeytabEntry, error) {
+	r := bytes.NewReader(record)
+	readUint16 := func() uint16 {
+		var v uint16
+		_ = binary.Read(r, binary.BigEndian, &v)
+		return v
+	}
+	readUint32 := func() uint32 {
+		var v uint32
+		_ = binary.Read(r, binary.BigEndian, &v)
+		return v
+	}
+	readString := func() []byte {
+		buf := make([]byte, readUint16())
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil
+		}
+		return buf
+	}
+
+	var entry KeytabEntry
+	components := int(readUint16())
+	entry.Realm = string(readString())
+	for i := 0; i < components; i++ {
+		entry.Principal.NameString = append(entry.Principal.NameString, string(readString()))
+	}
+	entry.Principal.NameType = int32(readUint32())
+	readUint32() // timestamp
+	vno8, _ := r.ReadByte()
+	entry.KVNO = uint32(vno8)
+	entry.Key.Type = int32(readUint16())
+	entry.Key.Value = readString()
+	// The 32-bit key version, when present, supersedes the 8-bit one
+	if r.Len() >= 4 {
+		if vno := readUint32(); vno != 0 {
+			entry.KVNO = vno
+		}
+	}
+	if entry.Realm == "" || len(entry.Principal.NameString) != components || len(entry.Key.Value) == 0 {
+		return nil, fmt.Errorf("%w: malformed entry", ErrInvalidKeytab)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,446 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// keycloakEventPageSize is how many events are read from the admin API at a time
+	keycloakEventPageSize = 100
+	// keycloakEventMaxPages bounds one poll; the rest is read on the next
+	keycloakEventMaxPages = 50
+)
+
+var (
+	// ErrKeycloakEventsNotConfigured is returned when Keycloak event ingestion is not configured
+	ErrKeycloakEventsNotConfigured = errors.New("keycloak event ingestion not configured")
+	// ErrInvalidKeycloakEvent is returned for a webhook that fails authentication or a malformed event
+	ErrInvalidKeycloakEvent = errors.New("invalid keycloak event")
+)
+
+// keycloakUserEventActions are the audit actions for the Keycloak user events CloudGate
+// records. Other user events, such as token refreshes, are acknowledged and skipped.
+var keycloakUserEventActions = map[string]string{
+	"LOGIN":           "keycloak_login",
+	"LOGIN_ERROR":     "keycloak_login_failed",
+	"LOGOUT":          "keycloak_logout",
+	"LOGOUT_ERROR":    "keycloak_logout_failed",
+	"UPDATE_PASSWORD": "keycloak_password_changed",
+	"UPDATE_TOTP":     "keycloak_mfa_enrolled",
+	"REMOVE_TOTP":     "keycloak_mfa_removed",
+}
+
+// KeycloakEvent is a Keycloak user or admin event as the admin REST API returns it and
+// event listener webhooks forward it. Admin events have an operation type.
+type KeycloakEvent struct {
+	ID        string                 `json:"id"`
+	Time      int64                  `json:"time"` // Unix milliseconds
+	Type      string                 `json:"type"`
+	RealmID   string                 `json:"realmId"`
+	ClientID  string                 `json:"clientId"`
+	UserID    string                 `json:"userId"`
+	SessionID string                 `json:"sessionId"`
+	IPAddress string                 `json:"ipAddress"`
+	Error     string                 `json:"error"`
+	Details   map[string]interface{} `json:"details"`
+
+	OperationType string `json:"operationType"`
+	ResourceType  string `json:"resourceType"`
+	ResourcePath  string `json:"resourcePath"`
+	AuthDetails   struct {
+		RealmID   string `json:"realmId"`
+		ClientID  string `json:"clientId"`
+		UserID    string `json:"userId"`
+		IPAddress string `json:"ipAddress"`
+	} `json:"authDetails"`
+}
+
+// Kind is models.KeycloakEventAdmin for admin events and models.KeycloakEventUser otherwise
+func (e *KeycloakEvent) Kind() string {
+	if e.OperationType != "" {
+		return models.KeycloakEventAdmin
+	}
+	return models.KeycloakEventUser
+}
+
+// key identifies the event across deliveries. Keycloak versions before 22 do not send
+// event IDs, so those events are keyed by their contents.
+func (e *KeycloakEvent) key() string {
+	if e.ID != "" {
+		return e.Kind() + ":" + e.ID
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strconv.FormatInt(e.Time, 10), e.Type, e.OperationType, e.RealmID, e.ClientID, e.UserID,
+		e.SessionID, e.IPAddress, e.Error, e.ResourcePath, e.AuthDetails.UserID,
+	}, "\x00")))
+	return e.Kind() + ":" + hex.EncodeToString(sum[:16])
+}
+
+// detail returns a string from the event's details
+func (e *KeycloakEvent) detail(name string) string {
+	if value, ok := e.Details[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// KeycloakIngestResult counts what happened to a batch of Keycloak events
+type KeycloakIngestResult struct {
+	Ingested   int `json:"ingested"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"` // user event types CloudGate does not audit
+}
+
+func (r *KeycloakIngestResult) add(other KeycloakIngestResult) {
+	r.Ingested += other.Ingested
+	r.Duplicates += other.Duplicates
+	r.Skipped += other.Skipped
+}
+
+// KeycloakEventService turns Keycloak login, logout and admin events into CloudGate audit
+// log entries, and feeds logins to security monitoring so clients signing in through
+// Keycloak no longer report them themselves. Events arrive from an event listener webhook
+// authenticated by KEYCLOAK_EVENTS_WEBHOOK_SECRET, or are polled from the realm's admin
+// API with the KEYCLOAK_EVENTS_CLIENT_ID service account, which needs the view-events role.
+type KeycloakEventService struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+	client   *http.Client
+
+	webhookSecret string
+	serverURL     string
+	realm         string
+	clientID      string
+	clientSecret  string
+	pollEvery     time.Duration
+	retention     time.Duration
+	syncMu        sync.Mutex
+}
+
+// NewKeycloakEventService creates a Keycloak event service from the environment. The
+// security monitoring service is fed logins and may be nil in tests.
+func NewKeycloakEventService(db *gorm.DB, security *SecurityMonitoringService) *KeycloakEventService {
+	return &KeycloakEventService{
+		db:            db,
+		security:      security,
+		client:        TracedHTTPClient(10 * time.Second),
+		webhookSecret: os.Getenv("KEYCLOAK_EVENTS_WEBHOOK_SECRET"),
+		serverURL:     strings.TrimRight(os.Getenv("KEYCLOAK_URL"), "/"),
+		realm:         os.Getenv("KEYCLOAK_REALM"),
+		clientID:      os.Getenv("KEYCLOAK_EVENTS_CLIENT_ID"),
+		clientSecret:  os.Getenv("KEYCLOAK_EVENTS_CLIENT_SECRET"),
+		pollEvery:     envDuration("KEYCLOAK_EVENTS_POLL_INTERVAL", time.Minute),
+		retention:     envDuration("KEYCLOAK_EVENTS_RETENTION", 7*24*time.Hour),
+	}
+}
+
+// WebhookEnabled reports whether an event listener may push events
+func (s *KeycloakEventService) WebhookEnabled() bool {
+	return s.webhookSecret != ""
+}
+
+// PollEnabled reports whether events can be read from the realm's admin API
+func (s *KeycloakEventService) PollEnabled() bool {
+	return s.serverURL != "" && s.realm != "" && s.clientID != "" && s.clientSecret != ""
+}
+
+// Interval is how often events are polled and old ingestion records purged
+func (s *KeycloakEventService) Interval() time.Duration {
+	return s.pollEvery
+}
+
+// VerifyWebhook checks an event listener's bearer token against KEYCLOAK_EVENTS_WEBHOOK_SECRET
+func (s *KeycloakEventService) VerifyWebhook(authorization string) error {
+	if !s.WebhookEnabled() {
+		return ErrKeycloakEventsNotConfigured
+	}
+	token, _ := strings.CutPrefix(authorization, "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.webhookSecret)) != 1 {
+		return fmt.Errorf("%w: webhook secret mismatch", ErrInvalidKeycloakEvent)
+	}
+	return nil
+}
+
+// ParseKeycloakEvents decodes a webhook body holding one event or an array of events
+func ParseKeycloakEvents(body []byte) ([]KeycloakEvent, error) {
+	body = bytes.TrimSpace(body)
+	var events []KeycloakEvent
+	var err error
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &events)
+	} else {
+		events = make([]KeycloakEvent, 1)
+		err = json.Unmarshal(body, &events[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeycloakEvent, err)
+	}
+	for _, event := range events {
+		if event.Type == "" && event.OperationType == "" {
+			return nil, fmt.Errorf("%w: event has no type or operation type", ErrInvalidKeycloakEvent)
+		}
+	}
+	return events, nil
+}
+
+// Ingest records events not seen before, oldest first, so failed logins are counted in
+// the order they happened. An event whose audit entry cannot be written is forgotten
+// again, so a redelivery retries it.
+func (s *KeycloakEventService) Ingest(ctx context.Context, events []KeycloakEvent, now time.Time) (KeycloakIngestResult, error) {
+	events = slices.Clone(events)
+	slices.SortStableFunc(events, func(a, b KeycloakEvent) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+
+	var result KeycloakIngestResult
+	for i := range events {
+		event := &events[i]
+		occurredAt := now
+		if event.Time > 0 {
+			occurredAt = time.UnixMilli(event.Time)
+		}
+		action := keycloakUserEventActions[event.Type]
+		keycloakUserID := event.UserID
+		if event.Kind() == models.KeycloakEventAdmin {
+			action = "keycloak_admin_" + strings.ToLower(event.OperationType)
+			keycloakUserID = event.AuthDetails.UserID
+		}
+		user := s.resolveUser(keycloakUserID, event.detail("username"))
+
+		receipt := models.KeycloakEvent{
+			ID:         event.key(),
+			Kind:       event.Kind(),
+			Type:       event.Type,
+			RealmID:    event.RealmID,
+			OccurredAt: occurredAt,
+		}
+		if event.Kind() == models.KeycloakEventAdmin {
+			receipt.Type = event.OperationType
+		}
+		if user != nil {
+			receipt.UserID = &user.ID
+		}
+		recorded := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&receipt)
+		if recorded.Error != nil {
+			return result, fmt.Errorf("failed to record Keycloak event: %w", recorded.Error)
+		}
+		if recorded.RowsAffected == 0 {
+			result.Duplicates++
+			continue
+		}
+		// Skipped events stay recorded so polling moves past them
+		if action == "" {
+			result.Skipped++
+			continue
+		}
+
+		if err := s.audit(ctx, event, action, receipt.UserID, occurredAt); err != nil {
+			s.db.Delete(&receipt)
+			return result, err
+		}
+		result.Ingested++
+
+		if (event.Type == "LOGIN" || event.Type == "LOGIN_ERROR") && user != nil && s.security != nil {
+			if err := s.security.ProcessLoginEvent(ctx, user.ID, user.Email, event.IPAddress, "Keycloak/"+event.ClientID, event.Type == "LOGIN", 0); err != nil {
+				log.Printf("⚠️ Failed to process Keycloak login for %s: %v", user.Email, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// audit writes the event to the audit log, dated when Keycloak saw it
+func (s *KeycloakEventService) audit(ctx context.Context, event *KeycloakEvent, action string, userID *uuid.UUID, occurredAt time.Time) error {
+	entry := models.AuditLog{
+		UserID:    userID,
+		Action:    action,
+		Status:    "success",
+		CreatedAt: occurredAt,
+	}
+	if event.Error != "" || strings.HasSuffix(event.Type, "_ERROR") {
+		entry.Status = "failure"
+	}
+	if event.Kind() == models.KeycloakEventAdmin {
+		entry.Resource = "keycloak_" + strings.ToLower(event.ResourceType)
+		entry.ResourceID = event.ResourcePath
+		entry.IPAddress = event.AuthDetails.IPAddress
+		entry.UserAgent = "Keycloak/" + event.AuthDetails.ClientID
+		entry.Details = fmt.Sprintf("Keycloak admin %s of %s in realm %s", strings.ToLower(event.OperationType), event.ResourcePath, event.RealmID)
+	} else {
+		entry.Resource = "keycloak_session"
+		entry.ResourceID = event.SessionID
+		entry.IPAddress = event.IPAddress
+		entry.UserAgent = "Keycloak/" + event.ClientID
+		entry.Details = fmt.Sprintf("Keycloak %s in realm %s", event.Type, event.RealmID)
+		if username := event.detail("username"); username != "" {
+			entry.Details += " for " + username
+		}
+	}
+	if event.Error != "" {
+		entry.Details += ": " + event.Error
+	}
+
+	ctx, cancel := context.WithTimeout(detached(ctx), dbTimeout)
+	defer cancel()
+	if err := auditDB(ctx, userID, s.db).WithContext(ctx).Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to audit Keycloak event: %w", err)
+	}
+	return nil
+}
+
+// resolveUser finds the CloudGate user behind a Keycloak user, by Keycloak ID and then
+// by an email username
+func (s *KeycloakEventService) resolveUser(keycloakID, username string) *models.User {
+	var user models.User
+	if keycloakID != "" {
+		if found := s.db.Select("id", "email").Where("keycloak_id = ?", keycloakID).Limit(1).Find(&user); found.Error == nil && found.RowsAffected > 0 {
+			return &user
+		}
+	}
+	if strings.Contains(username, "@") {
+		if found := s.db.Select("id", "email").Where("LOWER(email) = ?", strings.ToLower(username)).Limit(1).Find(&user); found.Error == nil && found.RowsAffected > 0 {
+			return &user
+		}
+	}
+	return nil
+}
+
+// SyncEvents reads user and admin events since the latest of each kind ingested, or the
+// past hour on the first run, from the realm's admin API and ingests them
+func (s *KeycloakEventService) SyncEvents(ctx context.Context, now time.Time) (KeycloakIngestResult, error) {
+	var result KeycloakIngestResult
+	if !s.PollEnabled() {
+		return result, ErrKeycloakEventsNotConfigured
+	}
+	// Scheduled and manual syncs would otherwise read the same events twice
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	accessToken, err := s.adminToken(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, kind := range []string{models.KeycloakEventUser, models.KeycloakEventAdmin} {
+		since := now.Add(-time.Hour)
+		var latest models.KeycloakEvent
+		if err := s.db.Where("kind = ?", kind).Order("occurred_at DESC").First(&latest).Error; err == nil {
+			since = latest.OccurredAt
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return result, fmt.Errorf("failed to find last Keycloak %s event: %w", kind, err)
+		}
+
+		events, err := s.fetchEvents(ctx, accessToken, kind, since)
+		if err != nil {
+			return result, err
+		}
+		ingested, err := s.Ingest(ctx, events, now)
+		result.add(ingested)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// fetchEvents pages through a kind of event, newest first, until it reaches since. The
+// admin API filters by day, so events earlier on since's day are dropped here.
+func (s *KeycloakEventService) fetchEvents(ctx context.Context, accessToken, kind string, since time.Time) ([]KeycloakEvent, error) {
+	endpoint := fmt.Sprintf("%s/admin/realms/%s/events", s.serverURL, url.PathEscape(s.realm))
+	if kind == models.KeycloakEventAdmin {
+		endpoint = fmt.Sprintf("%s/admin/realms/%s/admin-events", s.serverURL, url.PathEscape(s.realm))
+	}
+	sinceMillis := since.UnixMilli()
+
+	var events []KeycloakEvent
+	for page := 0; page < keycloakEventMaxPages; page++ {
+		query := url.Values{}
+		query.Set("dateFrom", since.UTC().Format("2006-01-02"))
+		query.Set("first", strconv.Itoa(page*keycloakEventPageSize))
+		query.Set("max", strconv.Itoa(keycloakEventPageSize))
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Keycloak events: %w", err)
+		}
+		var batch []KeycloakEvent
+		if err := decodeProviderResponse(resp, &batch); err != nil {
+			return nil, err
+		}
+
+		reachedSince := false
+		for _, event := range batch {
+			if event.Time < sinceMillis {
+				reachedSince = true
+				continue
+			}
+			events = append(events, event)
+		}
+		if reachedSince || len(batch) < keycloakEventPageSize {
+			break
+		}
+	}
+	return events, nil
+}
+
+// adminToken gets an admin API token for the events service account
+func (s *KeycloakEventService) adminToken(ctx context.Context) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", s.clientID)
+	form.Set("client_secret", s.clientSecret)
+	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", s.serverURL, url.PathEscape(s.realm))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Keycloak admin token: %w", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := decodeProviderResponse(resp, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// Purge forgets ingested events older than KEYCLOAK_EVENTS_RETENTION. The audit entries
+// are kept; only redeliveries older than this would be audited again.
+func (s *KeycloakEventService) Purge(now time.Time) (int64, error) {
+	result := s.db.Where("occurred_at < ?", now.Add(-s.retention)).Delete(&models.KeycloakEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge Keycloak events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAccessToken is returned for an identity provider access token that fails verification
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+type keycloakClaims struct {
+	jwt.RegisteredClaims
+	Type              string           `json:"typ"`
+	AuthorizedParty   string           `json:"azp"`
+	Scope             string           `json:"scope"`
+	Email             string           `json:"email"`
+	EmailVerified     bool             `json:"email_verified"`
+	PreferredUsername string           `json:"preferred_username"`
+	GivenName         string           `json:"given_name"`
+	FamilyName        string           `json:"family_name"`
+	ACR               string           `json:"acr"`
+	AMR               jwt.ClaimStrings `json:"amr"`
+	RealmAccess       struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+}
+
+type cachedSubject struct {
+	userID   uuid.UUID
+	loadedAt time.Time
+}
+
+// KeycloakTokenVerifier verifies access tokens issued by a Keycloak realm against the
+// realm's published signing keys, and maps their subject to a CloudGate user. Keys are
+// cached for KEYCLOAK_JWKS_CACHE_TTL and refetched early when a token names an unknown
+// key, at most once a minute. Subjects are linked to users by Keycloak ID, then by
+// verified email, and with KEYCLOAK_AUTO_PROVISION new users are created on first use.
+type KeycloakTokenVerifier struct {
+	db     *gorm.DB
+	client *http.Client
+
+	issuer        string
+	jwksURL       string
+	clientID      string
+	audiences     map[string]bool
+	keyTTL        time.Duration
+	userTTL       time.Duration
+	autoProvision bool
+	mfaACRs       map[string]bool
+	roleGrants    map[string]string
+
+	keysMu        sync.Mutex
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+
+	usersMu sync.Mutex
+	users   map[string]cachedSubject
+}
+
+// NewKeycloakTokenVerifier creates a Keycloak token verifier from the environment. The
+// issuer is KEYCLOAK_ISSUER, or the realm KEYCLOAK_REALM on the server at KEYCLOAK_URL.
+func NewKeycloakTokenVerifier(db *gorm.DB) *KeycloakTokenVerifier {
+	issuer := strings.TrimRight(os.Getenv("KEYCLOAK_ISSUER"), "/")
+	if issuer == "" && os.Getenv("KEYCLOAK_URL") != "" && os.Getenv("KEYCLOAK_REALM") != "" {
+		issuer = strings.TrimRight(os.Getenv("KEYCLOAK_URL"), "/") + "/realms/" + os.Getenv("KEYCLOAK_REALM")
+	}
+	clientID := os.Getenv("KEYCLOAK_CLIENT_ID")
+	v := &KeycloakTokenVerifier{
+		db:            db,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		issuer:        issuer,
+		jwksURL:       getEnv("KEYCLOAK_JWKS_URL", issuer+"/protocol/openid-connect/certs"),
+		clientID:      clientID,
+		audiences:     make(map[string]bool),
+		keyTTL:        envDuration("KEYCLOAK_JWKS_CACHE_TTL", time.Hour),
+		userTTL:       envDuration("KEYCLOAK_USER_CACHE_TTL", 5*time.Minute),
+		autoProvision: getEnv("KEYCLOAK_AUTO_PROVISION", "false") == "true",
+		mfaACRs:       make(map[string]bool),
+		roleGrants:    make(map[string]string),
+		users:         make(map[string]cachedSubject),
+	}
+	for _, audience := range strings.Split(getEnv("KEYCLOAK_AUDIENCE", clientID), ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			v.audiences[audience] = true
+		}
+	}
+	for _, acr := range strings.Split(getEnv("KEYCLOAK_MFA_ACR_VALUES", "2,3"), ",") {
+		if acr = strings.TrimSpace(acr); acr != "" {
+			v.mfaACRs[acr] = true
+		}
+	}
+	// Keycloak roles only grant CloudGate roles when the realm is trusted to manage them
+	if getEnv("KEYCLOAK_ROLES_GRANT_ACCESS", "false") == "true" {
+		v.roleGrants[getEnv("KEYCLOAK_ADMIN_ROLE", "cloudgate-admin")] = models.RoleAdmin
+		v.roleGrants[getEnv("KEYCLOAK_SECURITY_ANALYST_ROLE", "cloudgate-security-analyst")] = models.RoleSecurityAnalyst
+	}
+	return v
+}
+
+// Enabled reports whether Keycloak access tokens can be verified
+func (v *KeycloakTokenVerifier) Enabled() bool {
+	return v.issuer != "" && len(v.audiences) > 0
+}
+
+// Issuer is the iss claim of the tokens this verifier accepts
+func (v *KeycloakTokenVerifier) Issuer() string {
+	return v.issuer
+}
+
+// VerifyToken checks a Keycloak access token's signature, issuer, audience and expiry,
+// and returns the CloudGate user it was issued for
+func (v *KeycloakTokenVerifier) VerifyToken(ctx context.Context, token string, now time.Time) (*models.TokenIdentity, error) {
+	if !v.Enabled() {
+		return nil, fmt.Errorf("%w: Keycloak is not configured", ErrInvalidAccessToken)
+	}
+	var claims keycloakClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.signingKey(ctx, kid, now)
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}), jwt.WithIssuer(v.issuer), jwt.WithExpirationRequired(),
+		jwt.WithLeeway(envDuration("ASSERTION_CLOCK_SKEW", 2*time.Minute)), jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+	// Keycloak puts the requesting client in azp; aud only lists clients the token may call
+	audienceOK := v.audiences[claims.AuthorizedParty]
+	for _, audience := range claims.Audience {
+		audienceOK = audienceOK || v.audiences[audience]
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidAccessToken)
+	}
+	// ID and refresh tokens are signed by the same keys but must not be used as access tokens
+	if claims.Type != "" && !strings.EqualFold(claims.Type, "Bearer") {
+		return nil, fmt.Errorf("%w: %s tokens are not access tokens", ErrInvalidAccessToken, claims.Type)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidAccessToken)
+	}
+
+	userID, err := v.resolveUser(&claims, now)
+	if err != nil {
+		return nil, err
+	}
+	identity := &models.TokenIdentity{
+		UserID:   userID,
+		Email:    strings.ToLower(claims.Email),
+		Username: claims.PreferredUsername,
+		Roles:    v.roles(&claims),
+		AAL:      models.AAL1,
+	}
+	for _, role := range identity.Roles {
+		if granted, ok := v.roleGrants[role]; ok && !slices.Contains(identity.GrantedRoles, granted) {
+			identity.GrantedRoles = append(identity.GrantedRoles, granted)
+		}
+	}
+	if v.mfaACRs[claims.ACR] || slices.ContainsFunc(claims.AMR, func(method string) bool {
+		return method == "mfa" || method == "otp" || method == "hwk"
+	}) {
+		identity.AAL = models.AAL2
+	}
+	if claims.IssuedAt != nil {
+		identity.IssuedAt = claims.IssuedAt.Time
+	}
+	// A token requested by another client of the realm only carries the API scopes it was granted
+	if !v.audiences[claims.AuthorizedParty] {
+		identity.Scopes = APIScopesIn(claims.Scope)
+	}
+	return identity, nil
+}
+
+// roles collects the token's realm roles and the roles of CloudGate's own client
+func (v *KeycloakTokenVerifier) roles(claims *keycloakClaims) []string {
+	roles := make([]string, 0, len(claims.RealmAccess.Roles))
+	held := append(slices.Clone(claims.RealmAccess.Roles), claims.ResourceAccess[v.clientID].Roles...)
+	for _, role := range held {
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// resolveUser finds the active CloudGate user a Keycloak subject belongs to
+func (v *KeycloakTokenVerifier) resolveUser(claims *keycloakClaims, now time.Time) (uuid.UUID, error) {
+	v.usersMu.Lock()
+	cached, ok := v.users[claims.Subject]
+	v.usersMu.Unlock()
+	if ok && now.Sub(cached.loadedAt) < v.userTTL {
+		return cached.userID, nil
+	}
+
+	var user models.User
+	found := v.db.Where("keycloak_id = ?", claims.Subject).Limit(1).Find(&user)
+	if found.Error != nil {
+		return uuid.Nil, fmt.Errorf("failed to get user: %w", found.Error)
+	}
+	if found.RowsAffected == 0 {
+		linked, err := v.linkUser(claims, &user)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if !linked {
+			return uuid.Nil, fmt.Errorf("%w: no CloudGate account for this Keycloak user", ErrInvalidAccessToken)
+		}
+	}
+	if !user.IsActive || user.IsLocked(now) {
+		return uuid.Nil, fmt.Errorf("%w: account is disabled", ErrInvalidAccessToken)
+	}
+
+	v.usersMu.Lock()
+	v.users[claims.Subject] = cachedSubject{userID: user.ID, loadedAt: now}
+	v.usersMu.Unlock()
+	return user.ID, nil
+}
+
+// linkUser attaches a Keycloak subject to the user with its email, or provisions one.
+// Both emails must be verified, so nobody takes over an account by registering its address
+// first on either side.
+func (v *KeycloakTokenVerifier) linkUser(claims *keycloakClaims, user *models.User) (bool, error) {
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" || !claims.EmailVerified {
+		return false, nil
+	}
+	found := v.db.Where("LOWER(email) = ?", email).Limit(1).Find(user)
+	if found.Error != nil {
+		return false, fmt.Errorf("failed to get user: %w", found.Error)
+	}
+	subject := claims.Subject
+	if found.RowsAffected > 0 {
+		if user.KeycloakID != nil {
+			return false, fmt.Errorf("%w: account is linked to another Keycloak user", ErrInvalidAccessToken)
+		}
+		if !user.EmailVerified {
+			return false, fmt.Errorf("%w: verify the account's email before signing in with Keycloak", ErrInvalidAccessToken)
+		}
+		if err := v.db.Model(user).Update("keycloak_id", subject).Error; err != nil {
+			return false, fmt.Errorf("failed to link Keycloak user: %w", err)
+		}
+		log.Printf("Linked Keycloak user %s to %s", subject, email)
+		return true, nil
+	}
+	if !v.autoProvision {
+		return false, nil
+	}
+
+	username := claims.PreferredUsername
+	var taken int64
+	if username != "" {
+		if err := v.db.Model(&models.User{}).Where("username = ?", username).Count(&taken).Error; err != nil {
+			return false, fmt.Errorf("failed to check username: %w", err)
+		}
+	}
+	if username == "" || taken > 0 {
+		username = email
+	}
+	verifiedAt := time.Now()
+	*user = models.User{
+		KeycloakID:      &subject,
+		Email:           email,
+		EmailVerified:   true,
+		EmailVerifiedAt: &verifiedAt,
+		Username:        username,
+		FirstName:       claims.GivenName,
+		LastName:        claims.FamilyName,
+		IsActive:        true,
+	}
+	if err := v.db.Create(user).Error; err != nil {
+		return false, fmt.Errorf("failed to provision Keycloak user: %w", err)
+	}
+	log.Printf("Provisioned %s from Keycloak", email)
+	return true, nil
+}
+
+// signingKey returns the realm's signing key with the ID, refetching the key set when
+// the ID is unknown, at most once a minute
+func (v *KeycloakTokenVerifier) signingKey(ctx context.Context, kid string, now time.Time) (*rsa.PublicKey, error) {
+	v.keysMu.Lock()
+	defer v.keysMu.Unlock()
+	if key, ok := v.keys[kid]; ok && now.Sub(v.keysFetchedAt) < v.keyTTL {
+		return key, nil
+	}
+	if now.Sub(v.keysFetchedAt) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", v.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Keycloak signing keys: %w", err)
+	}
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := decodeProviderResponse(resp, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		// Realms also publish encryption keys, which must not verify signatures
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	v.keys, v.keysFetchedAt = keys, now
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
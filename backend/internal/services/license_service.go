@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SeatUsage is the seat information reported by a provider admin API.
+// Zero values mean the provider does not report that figure.
+type SeatUsage struct {
+	ProvisionedSeats int
+	AssignedSeats    int
+}
+
+// LicenseProvider fetches seat counts from a SaaS provider's admin API
+type LicenseProvider interface {
+	GetAppID() string
+	GetSource() string
+	IsConfigured() bool
+	FetchSeatUsage(ctx context.Context) (*SeatUsage, error)
+}
+
+// LicenseUtilization compares licensed seats with active CloudGate users for an app
+type LicenseUtilization struct {
+	AppID              string     `json:"app_id"`
+	AppName            string     `json:"app_name"`
+	ProvisionedSeats   int        `json:"provisioned_seats"`
+	AssignedSeats      int        `json:"assigned_seats"`
+	ConnectedUsers     int64      `json:"connected_users"`
+	ActiveUsers        int64      `json:"active_users"`
+	UnusedSeats        int        `json:"unused_seats"`
+	UtilizationPercent float64    `json:"utilization_percent"`
+	UnusedCost         float64    `json:"unused_cost"`
+	Source             string     `json:"source"`
+	LastSyncedAt       *time.Time `json:"last_synced_at,omitempty"`
+}
+
+// LicenseService builds license utilization reports per connected SaaS provider
+type LicenseService struct {
+	db        *gorm.DB
+	providers map[string]LicenseProvider
+}
+
+// NewLicenseService creates a new license service with the built-in provider integrations
+func NewLicenseService(db *gorm.DB) *LicenseService {
+	s := &LicenseService{db: db, providers: make(map[string]LicenseProvider)}
+	s.RegisterProvider(&GoogleLicenseProvider{
+		AccessToken: os.Getenv("GOOGLE_ADMIN_ACCESS_TOKEN"),
+		CustomerID:  getEnv("GOOGLE_CUSTOMER_ID", "my_customer"),
+	})
+	s.RegisterProvider(&MicrosoftLicenseProvider{
+		TenantID:     os.Getenv("MICROSOFT_TENANT_ID"),
+		ClientID:     os.Getenv("MICROSOFT_CLIENT_ID"),
+		ClientSecret: os.Getenv("MICROSOFT_CLIENT_SECRET"),
+	})
+	return s
+}
+
+// RegisterProvider adds or replaces the admin API integration for an app
+func (s *LicenseService) RegisterProvider(provider LicenseProvider) {
+	s.providers[provider.GetAppID()] = provider
+}
+
+// SetAllocation records the seats held for an app, as entered by an administrator
+func (s *LicenseService) SetAllocation(appID string, provisionedSeats int, costPerSeat float64) (*models.LicenseAllocation, error) {
+	if provisionedSeats < 0 || costPerSeat < 0 {
+		return nil, fmt.Errorf("seats and cost must not be negative")
+	}
+
+	allocation, err := s.getOrNewAllocation(appID)
+	if err != nil {
+		return nil, err
+	}
+	allocation.ProvisionedSeats = provisionedSeats
+	allocation.CostPerSeat = costPerSeat
+
+	if err := s.db.Save(allocation).Error; err != nil {
+		return nil, fmt.Errorf("failed to save license allocation: %w", err)
+	}
+	return allocation, nil
+}
+
+// SyncProviders refreshes seat counts from every configured provider admin API.
+// Failures are returned per app so one broken integration does not block the rest.
+func (s *LicenseService) SyncProviders(ctx context.Context) map[string]error {
+	results := make(map[string]error)
+	for appID, provider := range s.providers {
+		if !provider.IsConfigured() {
+			continue
+		}
+
+		usage, err := provider.FetchSeatUsage(ctx)
+		if err != nil {
+			results[appID] = err
+			continue
+		}
+
+		allocation, err := s.getOrNewAllocation(appID)
+		if err != nil {
+			results[appID] = err
+			continue
+		}
+		if usage.ProvisionedSeats > 0 {
+			allocation.ProvisionedSeats = usage.ProvisionedSeats
+		}
+		allocation.AssignedSeats = usage.AssignedSeats
+		allocation.Source = provider.GetSource()
+		now := time.Now()
+		allocation.LastSyncedAt = &now
+
+		if err := s.db.Save(allocation).Error; err != nil {
+			results[appID] = fmt.Errorf("failed to save license allocation: %w", err)
+			continue
+		}
+		results[appID] = nil
+	}
+	return results
+}
+
+// GetUtilizationReport compares provisioned seats with users active in the given window
+func (s *LicenseService) GetUtilizationReport(activeWindow time.Duration) ([]LicenseUtilization, error) {
+	var allocations []models.LicenseAllocation
+	if err := s.db.Find(&allocations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get license allocations: %w", err)
+	}
+
+	since := time.Now().Add(-activeWindow)
+	report := make([]LicenseUtilization, 0, len(allocations))
+	for _, allocation := range allocations {
+		var active int64
+		if err := s.db.Model(&models.AppLaunchEvent{}).
+			Where("app_id = ? AND launched_at >= ?", allocation.AppID, since).
+			Distinct("user_id").Count(&active).Error; err != nil {
+			return nil, fmt.Errorf("failed to count active users: %w", err)
+		}
+
+		var connected int64
+		if err := s.db.Model(&models.AppConnection{}).
+			Where("app_id = ? AND status = ?", allocation.AppID, models.ConnectionConnected).
+			Count(&connected).Error; err != nil {
+			return nil, fmt.Errorf("failed to count connected users: %w", err)
+		}
+
+		entry := LicenseUtilization{
+			AppID:            allocation.AppID,
+			AppName:          allocation.AppID,
+			ProvisionedSeats: allocation.ProvisionedSeats,
+			AssignedSeats:    allocation.AssignedSeats,
+			ConnectedUsers:   connected,
+			ActiveUsers:      active,
+			Source:           allocation.Source,
+			LastSyncedAt:     allocation.LastSyncedAt,
+		}
+		if app, ok := GetSaaSApp(allocation.AppID); ok {
+			entry.AppName = app.Name
+		}
+		if allocation.ProvisionedSeats > 0 {
+			entry.UnusedSeats = allocation.ProvisionedSeats - int(active)
+			if entry.UnusedSeats < 0 {
+				entry.UnusedSeats = 0
+			}
+			entry.UtilizationPercent = float64(active) / float64(allocation.ProvisionedSeats) * 100
+			entry.UnusedCost = float64(entry.UnusedSeats) * allocation.CostPerSeat
+		}
+		report = append(report, entry)
+	}
+
+	// Biggest savings opportunities first
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].UnusedSeats != report[j].UnusedSeats {
+			return report[i].UnusedSeats > report[j].UnusedSeats
+		}
+		return report[i].AppID < report[j].AppID
+	})
+
+	return report, nil
+}
+
+// WriteUtilizationCSV writes a utilization report as CSV
+func WriteUtilizationCSV(w io.Writer, report []LicenseUtilization) error {
+	writer := csv.NewWriter(w)
+	header := []string{"app_id", "app_name", "provisioned_seats", "assigned_seats", "connected_users",
+		"active_users", "unused_seats", "utilization_percent", "unused_cost", "source"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range report {
+		row := []string{
+			r.AppID,
+			r.AppName,
+			strconv.Itoa(r.ProvisionedSeats),
+			strconv.Itoa(r.AssignedSeats),
+			strconv.FormatInt(r.ConnectedUsers, 10),
+			strconv.FormatInt(r.ActiveUsers, 10),
+			strconv.Itoa(r.UnusedSeats),
+			strconv.FormatFloat(r.UtilizationPercent, 'f', 1, 64),
+			strconv.FormatFloat(r.UnusedCost, 'f', 2, 64),
+			r.Source,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *LicenseService) getOrNewAllocation(appID string) (*models.LicenseAllocation, error) {
+	var allocation models.LicenseAllocation
+	err := s.db.Where("app_id = ?", appID).First(&allocation).Error
+	if err == gorm.ErrRecordNotFound {
+		return &models.LicenseAllocation{AppID: appID, Source: "manual"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get license allocation: %w", err)
+	}
+	return &allocation, nil
+}
+
+// GoogleLicenseProvider counts assigned Google Workspace licenses via the Admin SDK
+// License Manager API. The access token needs the apps.licensing scope.
+type GoogleLicenseProvider struct {
+	AccessToken string
+	CustomerID  string
+	ProductID   string
+}
+
+func (p *GoogleLicenseProvider) GetAppID() string   { return "google-workspace" }
+func (p *GoogleLicenseProvider) GetSource() string  { return "google_admin_sdk" }
+func (p *GoogleLicenseProvider) IsConfigured() bool { return p.AccessToken != "" }
+
+// FetchSeatUsage pages through license assignments for the Workspace product
+func (p *GoogleLicenseProvider) FetchSeatUsage(ctx context.Context) (*SeatUsage, error) {
+	productID := p.ProductID
+	if productID == "" {
+		productID = "Google-Apps"
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	assigned := 0
+	pageToken := ""
+	for {
+		params := url.Values{}
+		params.Set("customerId", p.CustomerID)
+		params.Set("maxResults", "1000")
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+		endpoint := fmt.Sprintf("https://licensing.googleapis.com/apps/licensing/v1/product/%s/users?%s",
+			url.PathEscape(productID), params.Encode())
+
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.AccessToken)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query Google licensing API: %w", err)
+		}
+
+		var page struct {
+			Items         []json.RawMessage `json:"items"`
+			NextPageToken string            `json:"nextPageToken"`
+		}
+		err = decodeProviderResponse(resp, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		assigned += len(page.Items)
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	return &SeatUsage{AssignedSeats: assigned}, nil
+}
+
+// MicrosoftLicenseProvider reads subscribed SKUs from Microsoft Graph using the
+// client credentials flow. The app registration needs Organization.Read.All.
+type MicrosoftLicenseProvider struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+}
+
+func (p *MicrosoftLicenseProvider) GetAppID() string  { return "microsoft-365" }
+func (p *MicrosoftLicenseProvider) GetSource() string { return "microsoft_graph" }
+func (p *MicrosoftLicenseProvider) IsConfigured() bool {
+	return p.TenantID != "" && p.ClientID != "" && p.ClientSecret != ""
+}
+
+// FetchSeatUsage sums enabled and consumed units across all subscribed SKUs
+func (p *MicrosoftLicenseProvider) FetchSeatUsage(ctx context.Context) (*SeatUsage, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	accessToken, err := fetchMicrosoftGraphToken(ctx, client, "https://login.microsoftonline.com", p.TenantID, p.ClientID, p.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://graph.microsoft.com/v1.0/subscribedSkus", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Microsoft Graph: %w", err)
+	}
+	var skus struct {
+		Value []struct {
+			SkuPartNumber string `json:"skuPartNumber"`
+			ConsumedUnits int    `json:"consumedUnits"`
+			PrepaidUnits  struct {
+				Enabled int `json:"enabled"`
+			} `json:"prepaidUnits"`
+		} `json:"value"`
+	}
+	if err := decodeProviderResponse(resp, &skus); err != nil {
+		return nil, err
+	}
+
+	usage := &SeatUsage{}
+	for _, sku := range skus.Value {
+		usage.ProvisionedSeats += sku.PrepaidUnits.Enabled
+		usage.AssignedSeats += sku.ConsumedUnits
+	}
+	return usage, nil
+}
+
+// fetchMicrosoftGraphToken gets an app-only Microsoft Graph token with the client
+// credentials flow
+func fetchMicrosoftGraphToken(ctx context.Context, client *http.Client, loginURL, tenantID, clientID, clientSecret string) (string, error) {
+	form := url.Values{}
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("scope", "https://graph.microsoft.com/.default")
+	form.Set("grant_type", "client_credentials")
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", loginURL, url.PathEscape(tenantID))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Microsoft Graph token: %w", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := decodeProviderResponse(resp, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// decodeProviderResponse decodes a JSON admin API response, turning non-2xx statuses into errors
+func decodeProviderResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("provider API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode provider response: %w", err)
+	}
+	return nil
+}
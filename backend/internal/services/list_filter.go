@@ -0,0 +1,788 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Filter expressions are the query language the audit, alert, incident and risk history
+// lists share, so the frontend builds one query UI for all of them. A comparison is a field,
+// one of = != < <= > >= ~ (contains) and a value, or a field IN a parenthesised list.
+// Comparisons combine with AND, OR, NOT and parentheses, and values with spaces or
+// parentheses are double-quoted:
+//
+//	severity IN (high, critical) AND NOT status = resolved AND created_at >= -7d
+//
+// Time values are RFC3339 timestamps, dates, "now" or offsets back from now such as -15m,
+// -24h or -7d, and a date stands for the whole day. a..b on a time or number field is an
+// inclusive range: created_at = 2025-01-01..2025-01-31.
+
+// ErrInvalidFilter is returned for a filter expression or sort a list does not support
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Bounds on a filter expression, which keep the queries it becomes cheap to plan
+const (
+	filterMaxLength      = 2000
+	filterMaxComparisons = 50
+	filterMaxDepth       = 10
+	filterMaxValues      = 100
+)
+
+// FilterKind is the type of a filterable field, which decides its operators and values
+type FilterKind string
+
+// Filter field kinds
+const (
+	FilterKindString FilterKind = "string"
+	FilterKindEnum   FilterKind = "enum"
+	FilterKindUUID   FilterKind = "uuid"
+	FilterKindNumber FilterKind = "number"
+	FilterKindTime   FilterKind = "time"
+)
+
+// filterOperators lists the operators each kind of field accepts, besides IN
+var filterOperators = map[FilterKind][]string{
+	FilterKindString: {"=", "!=", "~"},
+	FilterKindEnum:   {"=", "!="},
+	FilterKindUUID:   {"=", "!="},
+	FilterKindNumber: {"=", "!=", "<", "<=", ">", ">="},
+	FilterKindTime:   {"=", "!=", "<", "<=", ">", ">="},
+}
+
+// FilterField is a field a list can be filtered on, and the column behind it
+type FilterField struct {
+	Column   string
+	Kind     FilterKind
+	Values   []string // the values an enum field takes
+	Sortable bool
+}
+
+// Operators returns the comparison operators the field accepts
+func (f FilterField) Operators() []string {
+	operators := append([]string{}, filterOperators[f.Kind]...)
+	if f.Kind != FilterKindTime {
+		operators = append(operators, "IN")
+	}
+	return operators
+}
+
+// FilterSchema is the allowlist of fields one list can be filtered and sorted on. Only the
+// columns named here ever reach the SQL; clients supply values alone.
+type FilterSchema struct {
+	Fields      map[string]FilterField
+	DefaultSort string // field, prefixed with - for descending
+}
+
+// Filter schemas of the lists that take filter expressions
+var (
+	AuditLogFilterSchema = &FilterSchema{
+		Fields: map[string]FilterField{
+			"action":      {Column: "action", Kind: FilterKindString, Sortable: true},
+			"resource":    {Column: "resource", Kind: FilterKindString},
+			"resource_id": {Column: "resource_id", Kind: FilterKindString},
+			"status":      {Column: "status", Kind: FilterKindString},
+			"user_id":     {Column: "user_id", Kind: FilterKindUUID},
+			"ip_address":  {Column: "ip_address", Kind: FilterKindString},
+			"user_agent":  {Column: "user_agent", Kind: FilterKindString},
+			"region":      {Column: "region", Kind: FilterKindString},
+			"created_at":  {Column: "created_at", Kind: FilterKindTime, Sortable: true},
+		},
+		DefaultSort: "-created_at",
+	}
+	AlertFilterSchema = &FilterSchema{
+		Fields: map[string]FilterField{
+			"type":           {Column: "type", Kind: FilterKindString},
+			"severity":       {Column: "severity", Kind: FilterKindEnum, Values: []string{"low", "medium", "high", "critical"}},
+			"status":         {Column: "status", Kind: FilterKindEnum, Values: []string{"open", "in_progress", "resolved", "false_positive", "suppressed"}},
+			"title":          {Column: "title", Kind: FilterKindString},
+			"source":         {Column: "source", Kind: FilterKindString},
+			"user_id":        {Column: "user_id", Kind: FilterKindUUID},
+			"assigned_to":    {Column: "assigned_to", Kind: FilterKindUUID},
+			"ip_address":     {Column: "ip_address", Kind: FilterKindString},
+			"priority_score": {Column: "priority_score", Kind: FilterKindNumber, Sortable: true},
+			"created_at":     {Column: "created_at", Kind: FilterKindTime, Sortable: true},
+			"resolved_at":    {Column: "resolved_at", Kind: FilterKindTime, Sortable: true},
+		},
+		DefaultSort: "-created_at",
+	}
+	IncidentFilterSchema = &FilterSchema{
+		Fields: map[string]FilterField{
+			"severity":    {Kind: FilterKindEnum, Values: []string{"low", "medium", "high", "critical"}},
+			"status":      {Kind: FilterKindEnum, Values: []string{"open", "in_progress", "resolved", "closed"}},
+			"title":       {Kind: FilterKindString},
+			"assigned_to": {Kind: FilterKindUUID},
+			"created_at":  {Kind: FilterKindTime, Sortable: true},
+			"updated_at":  {Kind: FilterKindTime, Sortable: true},
+		},
+		DefaultSort: "-created_at",
+	}
+	RiskAssessmentFilterSchema = &FilterSchema{
+		Fields: map[string]FilterField{
+			"risk_level":         {Column: "risk_level", Kind: FilterKindEnum, Values: []string{"low", "medium", "high", "critical"}},
+			"risk_score":         {Column: "risk_score", Kind: FilterKindNumber, Sortable: true},
+			"ip_address":         {Column: "ip_address", Kind: FilterKindString},
+			"session_id":         {Column: "session_id", Kind: FilterKindString},
+			"device_fingerprint": {Column: "device_fingerprint", Kind: FilterKindString},
+			"timestamp":          {Column: "created_at", Kind: FilterKindTime, Sortable: true},
+		},
+		DefaultSort: "-timestamp",
+	}
+)
+
+// FilterSchemas names the filter schemas for clients building queries
+var FilterSchemas = map[string]*FilterSchema{
+	"audit_logs":       AuditLogFilterSchema,
+	"alerts":           AlertFilterSchema,
+	"incidents":        IncidentFilterSchema,
+	"risk_assessments": RiskAssessmentFilterSchema,
+}
+
+// Filter is a parsed filter expression. A nil filter matches everything.
+type Filter struct {
+	root *filterNode
+}
+
+// filterNode is "and", "or" or "not" over its children, or a comparison of one field.
+// Comparisons are reduced to =, !=, <, <=, >, >=, ~ and in, with values of the field's
+// type: strings for string, enum and UUID fields, float64 and time.Time for the others.
+type filterNode struct {
+	op       string
+	children []*filterNode
+	field    string
+	column   string
+	values   []interface{}
+}
+
+// ParseFilter parses a filter expression against a list's schema, resolving relative times
+// against now. An empty expression gives a nil filter.
+func ParseFilter(schema *FilterSchema, expression string, now time.Time) (*Filter, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, nil
+	}
+	if len(expression) > filterMaxLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidFilter, filterMaxLength)
+	}
+	p := &filterParser{input: expression, schema: schema, now: now.UTC()}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+	return &Filter{root: root}, nil
+}
+
+// Scope restricts a query to the rows the filter matches
+func (f *Filter) Scope(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return query
+	}
+	clause, args := f.root.sql()
+	return query.Where(clause, args...)
+}
+
+// Matches reports whether a record held in memory matches the filter, given its field
+// values. Nil and missing values match only !=.
+func (f *Filter) Matches(fields map[string]interface{}) bool {
+	return f == nil || f.root.matches(fields)
+}
+
+func (n *filterNode) sql() (string, []interface{}) {
+	switch n.op {
+	case "and", "or":
+		clauses := make([]string, len(n.children))
+		var args []interface{}
+		for i, child := range n.children {
+			clause, childArgs := child.sql()
+			clauses[i] = clause
+			args = append(args, childArgs...)
+		}
+		return "(" + strings.Join(clauses, " "+strings.ToUpper(n.op)+" ") + ")", args
+	case "not":
+		clause, args := n.children[0].sql()
+		return "NOT " + clause, args
+	case "!=":
+		return "(" + n.column + " IS NULL OR " + n.column + " <> ?)", n.values
+	case "~":
+		return n.column + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + likeEscaper.Replace(n.values[0].(string)) + "%"}
+	case "in":
+		return n.column + " IN ?", []interface{}{n.values}
+	}
+	return n.column + " " + n.op + " ?", n.values
+}
+
+func (n *filterNode) matches(fields map[string]interface{}) bool {
+	switch n.op {
+	case "and":
+		for _, child := range n.children {
+			if !child.matches(fields) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range n.children {
+			if child.matches(fields) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !n.children[0].matches(fields)
+	}
+
+	value, ok := filterValue(fields[n.field])
+	if !ok {
+		return n.op == "!="
+	}
+	switch n.op {
+	case "~":
+		text, _ := value.(string)
+		return strings.Contains(text, n.values[0].(string))
+	case "in":
+		for _, candidate := range n.values {
+			if c, ok := compareFilterValues(value, candidate); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	c, ok := compareFilterValues(value, n.values[0])
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// filterValue brings a record's field value to the types filters compare, reporting false
+// for nil and missing values
+func filterValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case *uuid.UUID:
+		if v == nil {
+			return nil, false
+		}
+		return v.String(), true
+	case uuid.UUID:
+		return v.String(), true
+	case *time.Time:
+		if v == nil {
+			return nil, false
+		}
+		return v.UTC(), true
+	case time.Time:
+		return v.UTC(), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		return v, true
+	}
+	// Named string types such as AlertSeverity
+	return fmt.Sprint(value), true
+}
+
+// compareFilterValues orders two values of the same type, reporting false for mismatched types
+func compareFilterValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), true
+		}
+	}
+	return 0, false
+}
+
+type filterParser struct {
+	input       string
+	pos         int
+	schema      *FilterSchema
+	now         time.Time
+	comparisons int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidFilter}, args...)...)
+}
+
+func (p *filterParser) parseOr(depth int) (*filterNode, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = joinFilterNodes("or", left, right)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (*filterNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = joinFilterNodes("and", left, right)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (*filterNode, error) {
+	if depth > filterMaxDepth {
+		return nil, p.errorf("nested more than %d deep", filterMaxDepth)
+	}
+	if p.keyword("NOT") {
+		child, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &filterNode{op: "not", children: []*filterNode{child}}, nil
+	}
+	if p.symbol("(") {
+		node, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("missing ) at position %d", p.pos+1)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (*filterNode, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) && isFilterIdentChar(p.input[p.pos]) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == "" {
+		return nil, p.errorf("expected a field at position %d", start+1)
+	}
+	field, ok := p.schema.Fields[name]
+	if !ok {
+		return nil, p.errorf("unknown field %q", name)
+	}
+	if p.comparisons++; p.comparisons > filterMaxComparisons {
+		return nil, p.errorf("more than %d comparisons", filterMaxComparisons)
+	}
+
+	if p.keyword("IN") {
+		return p.parseIn(name, field)
+	}
+	op := p.operator()
+	if op == "" {
+		return nil, p.errorf("expected an operator after %s", name)
+	}
+	if !containsValue(filterOperators[field.Kind], op) {
+		return nil, p.errorf("%s does not support %s", name, op)
+	}
+	raw, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return p.comparison(name, field, op, raw)
+}
+
+func (p *filterParser) parseIn(name string, field FilterField) (*filterNode, error) {
+	if field.Kind == FilterKindTime {
+		return nil, p.errorf("%s does not support IN", name)
+	}
+	if !p.symbol("(") {
+		return nil, p.errorf("IN needs a parenthesised list")
+	}
+	node := &filterNode{op: "in", field: name, column: field.Column}
+	for {
+		raw, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.scalar(name, field, raw)
+		if err != nil {
+			return nil, err
+		}
+		if node.values = append(node.values, value); len(node.values) > filterMaxValues {
+			return nil, p.errorf("IN takes at most %d values", filterMaxValues)
+		}
+		if p.symbol(")") {
+			return node, nil
+		}
+		if !p.symbol(",") {
+			return nil, p.errorf("expected , or ) at position %d", p.pos+1)
+		}
+	}
+}
+
+// comparison builds the node for one comparison, expanding ranges and whole-day dates into
+// the comparisons they stand for
+func (p *filterParser) comparison(name string, field FilterField, op, raw string) (*filterNode, error) {
+	leaf := func(op string, value interface{}) *filterNode {
+		return &filterNode{op: op, field: name, column: field.Column, values: []interface{}{value}}
+	}
+
+	if field.Kind == FilterKindNumber || field.Kind == FilterKindTime {
+		if low, high, ok := strings.Cut(raw, ".."); ok {
+			if op != "=" {
+				return nil, p.errorf("a range takes =, not %s", op)
+			}
+			from, _, err := p.bounds(name, field, low)
+			if err != nil {
+				return nil, err
+			}
+			_, until, err := p.bounds(name, field, high)
+			if err != nil {
+				return nil, err
+			}
+			return joinFilterNodes("and", leaf(">=", from), until), nil
+		}
+	}
+	if field.Kind != FilterKindTime {
+		value, err := p.scalar(name, field, raw)
+		if err != nil {
+			return nil, err
+		}
+		return leaf(op, value), nil
+	}
+
+	from, to, err := parseFilterTime(raw, p.now)
+	if err != nil {
+		return nil, p.errorf("%s: %v", name, err)
+	}
+	if from.Equal(to) {
+		return leaf(op, from), nil
+	}
+	// A date is the day from its midnight up to the next
+	switch op {
+	case "=":
+		return joinFilterNodes("and", leaf(">=", from), leaf("<", to)), nil
+	case "!=":
+		return &filterNode{op: "not", children: []*filterNode{joinFilterNodes("and", leaf(">=", from), leaf("<", to))}}, nil
+	case "<", ">=":
+		return leaf(op, from), nil
+	case "<=":
+		return leaf("<", to), nil
+	}
+	return leaf(">=", to), nil
+}
+
+// bounds reads one end of a range, returning its lower bound and the comparison that keeps
+// values up to its upper bound
+func (p *filterParser) bounds(name string, field FilterField, raw string) (interface{}, *filterNode, error) {
+	leaf := func(op string, value interface{}) *filterNode {
+		return &filterNode{op: op, field: name, column: field.Column, values: []interface{}{value}}
+	}
+	if field.Kind == FilterKindNumber {
+		value, err := p.scalar(name, field, raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		return value, leaf("<=", value), nil
+	}
+	from, to, err := parseFilterTime(raw, p.now)
+	if err != nil {
+		return nil, nil, p.errorf("%s: %v", name, err)
+	}
+	if from.Equal(to) {
+		return from, leaf("<=", to), nil
+	}
+	return from, leaf("<", to), nil
+}
+
+// scalar converts a value for a string, enum, UUID or number field
+func (p *filterParser) scalar(name string, field FilterField, raw string) (interface{}, error) {
+	switch field.Kind {
+	case FilterKindEnum:
+		if !containsValue(field.Values, raw) {
+			return nil, p.errorf("%s must be one of %s", name, strings.Join(field.Values, ", "))
+		}
+	case FilterKindUUID:
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, p.errorf("%s must be a UUID", name)
+		}
+		return id.String(), nil
+	case FilterKindNumber:
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, p.errorf("%s must be a number", name)
+		}
+		return number, nil
+	}
+	return raw, nil
+}
+
+// parseFilterTime reads a time value as the span it stands for: an instant, where from and
+// to are equal, for timestamps, "now" and offsets, or the whole day for a date
+func parseFilterTime(raw string, now time.Time) (time.Time, time.Time, error) {
+	if strings.EqualFold(raw, "now") {
+		return now, now, nil
+	}
+	if offset, ok := strings.CutPrefix(raw, "-"); ok && len(offset) > 1 {
+		units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+		unit, known := units[offset[len(offset)-1]]
+		count, err := strconv.Atoi(offset[:len(offset)-1])
+		if known && err == nil && count >= 0 {
+			at := now.Add(-time.Duration(count) * unit)
+			return at, at, nil
+		}
+	}
+	if at, err := time.Parse(time.RFC3339, raw); err == nil {
+		return at.UTC(), at.UTC(), nil
+	}
+	if day, err := time.Parse(time.DateOnly, raw); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%q is not an RFC3339 time, date, now or offset such as -24h", raw)
+}
+
+func joinFilterNodes(op string, left, right *filterNode) *filterNode {
+	if left.op == op {
+		left.children = append(left.children, right)
+		return left
+	}
+	return &filterNode{op: op, children: []*filterNode{left, right}}
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.input) && isFilterSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// keyword consumes a case-insensitive keyword standing as a word of its own
+func (p *filterParser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.input) && isFilterIdentChar(p.input[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *filterParser) symbol(symbol string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.input[p.pos:], symbol) {
+		return false
+	}
+	p.pos += len(symbol)
+	return true
+}
+
+func (p *filterParser) operator() string {
+	p.skipSpace()
+	for _, op := range []string{">=", "<=", "!=", "=", "<", ">", "~"} {
+		if strings.HasPrefix(p.input[p.pos:], op) {
+			p.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+// value reads a double-quoted value, in which \" and \\ are escapes, or a bare value ending
+// at whitespace, a comma or a parenthesis
+func (p *filterParser) value() (string, error) {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.input); p.pos++ {
+			switch c := p.input[p.pos]; {
+			case c == '"':
+				p.pos++
+				return value.String(), nil
+			case c == '\\' && p.pos+1 < len(p.input):
+				p.pos++
+				value.WriteByte(p.input[p.pos])
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", p.errorf("unterminated quoted value")
+	}
+	start := p.pos
+	for p.pos < len(p.input) && !isFilterSpace(p.input[p.pos]) && !strings.ContainsRune("(),", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a value at position %d", start+1)
+	}
+	return p.input[start:p.pos], nil
+}
+
+func isFilterIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isFilterSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// ListSort orders a list by one field of its schema
+type ListSort struct {
+	field      string
+	column     string
+	descending bool
+}
+
+// ParseSort resolves a sort parameter, a field optionally prefixed with - for descending,
+// against the schema; an empty parameter gives the schema's default
+func (s *FilterSchema) ParseSort(sortBy string) (ListSort, error) {
+	if sortBy = strings.TrimSpace(sortBy); sortBy == "" {
+		sortBy = s.DefaultSort
+	}
+	name, descending := strings.CutPrefix(sortBy, "-")
+	field, ok := s.Fields[name]
+	if !ok || !field.Sortable {
+		return ListSort{}, fmt.Errorf("%w: cannot sort by %q", ErrInvalidFilter, name)
+	}
+	return ListSort{field: name, column: field.Column, descending: descending}, nil
+}
+
+// orderBy returns the ORDER BY clause for the sort, or fallback for the zero sort
+func (s ListSort) orderBy(fallback string) string {
+	switch {
+	case s.column == "":
+		return fallback
+	case s.descending:
+		return s.column + " DESC"
+	}
+	return s.column + " ASC"
+}
+
+// ListPage is one page of a filtered, sorted list. A zero Limit returns every match.
+type ListPage struct {
+	Filter *Filter
+	Sort   ListSort
+	Limit  int
+	Offset int
+}
+
+// NewListPage validates a list request against the schema
+func (s *FilterSchema) NewListPage(expression, sortBy string, limit, offset int, now time.Time) (ListPage, error) {
+	filter, err := ParseFilter(s, expression, now)
+	if err != nil {
+		return ListPage{}, err
+	}
+	order, err := s.ParseSort(sortBy)
+	if err != nil {
+		return ListPage{}, err
+	}
+	return ListPage{Filter: filter, Sort: order, Limit: limit, Offset: offset}, nil
+}
+
+// find loads the page of query's rows into dest, returning how many rows match in all.
+// fallbackOrder orders a page without a sort.
+func (p ListPage) find(query *gorm.DB, fallbackOrder string, dest interface{}) (int64, error) {
+	query = p.Filter.Scope(query)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return 0, err
+	}
+	query = query.Order(p.Sort.orderBy(fallbackOrder))
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit)
+	}
+	if p.Offset > 0 {
+		query = query.Offset(p.Offset)
+	}
+	return total, query.Find(dest).Error
+}
+
+// pageRecords applies a page to records held in memory, given each record's field values,
+// returning the page and how many records match in all. Unsorted pages keep the records'
+// order.
+func pageRecords[T any](p ListPage, records []T, fields func(T) map[string]interface{}) ([]T, int64) {
+	type entry struct {
+		record T
+		fields map[string]interface{}
+	}
+	matched := make([]entry, 0, len(records))
+	for _, record := range records {
+		if values := fields(record); p.Filter.Matches(values) {
+			matched = append(matched, entry{record, values})
+		}
+	}
+	if p.Sort.field != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, aok := filterValue(matched[i].fields[p.Sort.field])
+			b, bok := filterValue(matched[j].fields[p.Sort.field])
+			if !aok || !bok {
+				// Records without a value go last
+				return aok && !bok
+			}
+			c, _ := compareFilterValues(a, b)
+			if p.Sort.descending {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	total := int64(len(matched))
+	start := min(p.Offset, len(matched))
+	end := len(matched)
+	if p.Limit > 0 {
+		end = min(start+p.Limit, end)
+	}
+	page := make([]T, 0, end-start)
+	for _, e := range matched[start:end] {
+		page = append(page, e.record)
+	}
+	return page, total
+}
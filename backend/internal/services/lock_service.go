@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// leasePollInterval is how often instances compete for a periodic job's lease, so a job
+// starts at most this long after the previous holder's lease runs out
+const leasePollInterval = time.Minute
+
+// LockService hands out leases stored in the database so that scheduled work runs on
+// exactly one instance when several are deployed
+type LockService struct {
+	db     *gorm.DB
+	holder string
+}
+
+// NewLockService creates a new lock service identified by this instance
+func NewLockService(db *gorm.DB) *LockService {
+	hostname, _ := os.Hostname()
+	return &LockService{
+		db:     db,
+		holder: fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8]),
+	}
+}
+
+// Holder returns the identity this instance uses for its leases
+func (s *LockService) Holder() string {
+	return s.holder
+}
+
+// TryAcquire takes the named lease for ttl if it is free, expired, or already ours.
+// Both statements are atomic per row, so two instances can never both succeed.
+func (s *LockService) TryAcquire(name string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	lease := models.JobLease{Name: name, Holder: s.holder, AcquiredAt: now, ExpiresAt: now.Add(ttl)}
+
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	result = s.db.Model(&models.JobLease{}).
+		Where("name = ? AND (expires_at < ? OR holder = ?)", name, now, s.holder).
+		Updates(map[string]interface{}{"holder": s.holder, "acquired_at": now, "expires_at": now.Add(ttl)})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Release gives up a lease early if this instance holds it
+func (s *LockService) Release(name string) error {
+	if err := s.db.Where("name = ? AND holder = ?", name, s.holder).Delete(&models.JobLease{}).Error; err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", name, err)
+	}
+	return nil
+}
+
+// RunPeriodic runs job once per interval across all instances until ctx is cancelled,
+// with a heartbeat on every poll whichever instance holds the lease.
+// The lease is kept for the whole interval rather than released after the run, which
+// is what stops a second instance with a different tick offset from repeating the work.
+func (s *LockService) RunPeriodic(ctx context.Context, name string, interval time.Duration, job func() error) {
+	poll := leasePollInterval
+	if interval < poll {
+		poll = interval
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	heartbeat(ctx, name, time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			heartbeat(ctx, name, now)
+			acquired, err := s.TryAcquire(name, interval)
+			if err != nil {
+				log.Printf("⚠️ %v", err)
+				continue
+			}
+			if !acquired {
+				continue
+			}
+			if err := job(); err != nil {
+				log.Printf("Job %s failed: %v", name, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDisputeNotFound is returned for disputes that do not exist or belong to another user
+	ErrDisputeNotFound = errors.New("login dispute not found")
+	// ErrDisputeState is returned when a dispute is not in a state that allows the action
+	ErrDisputeState = errors.New("login dispute is not in a state that allows this")
+	// ErrInvalidDisputeStep is returned when a remediation step's input is rejected
+	ErrInvalidDisputeStep = errors.New("invalid remediation step")
+)
+
+// Remediation steps a user completes after disputing a login
+const (
+	DisputeStepPasswordReset   = "password_reset"
+	DisputeStepMFAReenrollment = "mfa_reenrollment"
+)
+
+const disputeMinimumPasswordChars = 8
+
+// LoginDisputeService runs the compromise workflow for a login the user says was not
+// them: the session is revoked and the account flagged as compromised, the user resets
+// their password and enrolls MFA afresh, and an administrator resolves the dispute.
+type LoginDisputeService struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+}
+
+// NewLoginDisputeService creates a new login dispute service. security may be nil, in
+// which case disputes raise no alert.
+func NewLoginDisputeService(db *gorm.DB, security *SecurityMonitoringService) *LoginDisputeService {
+	return &LoginDisputeService{db: db, security: security}
+}
+
+// OpenDispute disputes one of the user's logins. The login's session is revoked
+// immediately; a login already under dispute returns the existing dispute.
+func (s *LoginDisputeService) OpenDispute(userID, sessionID uuid.UUID, comment, reporterIP string, now time.Time) (*models.LoginDispute, error) {
+	var session models.Session
+	if err := s.db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var existing models.LoginDispute
+	err := s.db.Where("session_id = ? AND status <> ?", sessionID, models.DisputeResolved).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get login dispute: %w", err)
+	}
+
+	dispute := models.LoginDispute{
+		UserID:         userID,
+		SessionID:      sessionID,
+		Status:         models.DisputeOpen,
+		Comment:        comment,
+		LoginIPAddress: session.IPAddress,
+		LoginUserAgent: session.UserAgent,
+		LoginAt:        session.CreatedAt,
+		ReporterIP:     reporterIP,
+		CreatedAt:      now,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&session).Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+		if err := tx.Create(&dispute).Error; err != nil {
+			return fmt.Errorf("failed to create login dispute: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if alert := s.raiseAlert(&dispute); alert != nil {
+		dispute.AlertID = &alert.ID
+		if err := s.db.Model(&dispute).Update("alert_id", alert.ID).Error; err != nil {
+			log.Printf("Failed to link alert to login dispute %s: %v", dispute.ID, err)
+		}
+	}
+	s.audit(&userID, "login_disputed", &dispute, fmt.Sprintf("Disputed the login from %s; session revoked", session.IPAddress))
+	return &dispute, nil
+}
+
+func (s *LoginDisputeService) raiseAlert(dispute *models.LoginDispute) *SecurityAlert {
+	if s.security == nil {
+		return nil
+	}
+	description := fmt.Sprintf("The user reported a login from %s at %s as not theirs. The session was revoked; the user must reset their password and re-enroll MFA.",
+		dispute.LoginIPAddress, dispute.LoginAt.UTC().Format(time.RFC3339))
+	if dispute.Comment != "" {
+		description += " Comment: " + dispute.Comment
+	}
+	alert, err := s.security.GenerateAlert(AlertTypeCompromisedAccount, SeverityHigh, "User disputed a login", description,
+		map[string]interface{}{
+			"user_id":     dispute.UserID.String(),
+			"dispute_id":  dispute.ID.String(),
+			"session_id":  dispute.SessionID.String(),
+			"ip_address":  dispute.LoginIPAddress,
+			"user_agent":  dispute.LoginUserAgent,
+			"reporter_ip": dispute.ReporterIP,
+		})
+	if err != nil {
+		log.Printf("Failed to raise compromised account alert: %v", err)
+		return nil
+	}
+	return alert
+}
+
+// ResetPassword completes the password reset step. Every other session of the user is
+// signed out, since any of them may be the attacker's.
+func (s *LoginDisputeService) ResetPassword(userID, disputeID uuid.UUID, newPassword string, currentSession *uuid.UUID, now time.Time) (*models.LoginDispute, error) {
+	dispute, err := s.openDispute(userID, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(newPassword) < disputeMinimumPasswordChars {
+		return nil, fmt.Errorf("%w: password must be at least %d characters", ErrInvalidDisputeStep, disputeMinimumPasswordChars)
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(newPassword)) == nil {
+		return nil, fmt.Errorf("%w: the new password must differ from the current one", ErrInvalidDisputeStep)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		sessions := tx.Model(&models.Session{}).Where("user_id = ? AND is_active = ?", userID, true)
+		if currentSession != nil {
+			sessions = sessions.Where("id <> ?", *currentSession)
+		}
+		if err := sessions.Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to sign out other sessions: %w", err)
+		}
+		dispute.PasswordResetAt = &now
+		return s.advance(tx, dispute)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit(&userID, "login_dispute_password_reset", dispute, "Password reset and other sessions signed out")
+	return dispute, nil
+}
+
+// VerifyMFA completes the MFA re-enrollment step. The user must have set up a new TOTP
+// secret since disputing the login, so an authenticator the attacker may have added
+// does not count, and prove it with a current code.
+func (s *LoginDisputeService) VerifyMFA(userID, disputeID uuid.UUID, code string, now time.Time) (*models.LoginDispute, error) {
+	dispute, err := s.openDispute(userID, disputeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var setup models.MFASetup
+	err = s.db.Where("user_id = ? AND enabled = ?", userID, true).First(&setup).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && setup.CreatedAt.Before(dispute.CreatedAt)) {
+		return nil, fmt.Errorf("%w: set up MFA again before verifying it", ErrInvalidDisputeStep)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MFA setup: %w", err)
+	}
+	if !totp.Validate(code, setup.Secret) {
+		return nil, fmt.Errorf("%w: invalid verification code", ErrInvalidDisputeStep)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		dispute.MFAVerifiedAt = &now
+		return s.advance(tx, dispute)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit(&userID, "login_dispute_mfa_verified", dispute, "MFA re-enrolled and verified")
+	return dispute, nil
+}
+
+// advance saves a remediation step, marking the dispute remediated once every step is done
+func (s *LoginDisputeService) advance(tx *gorm.DB, dispute *models.LoginDispute) error {
+	if len(PendingDisputeSteps(dispute)) == 0 {
+		dispute.Status = models.DisputeRemediated
+	}
+	if err := tx.Save(dispute).Error; err != nil {
+		return fmt.Errorf("failed to update login dispute: %w", err)
+	}
+	return nil
+}
+
+// Resolve closes a dispute with an administrator's finding. Disputes found not
+// compromised can be closed before remediation is finished.
+func (s *LoginDisputeService) Resolve(disputeID uuid.UUID, resolver *uuid.UUID, resolution, note string, now time.Time) (*models.LoginDispute, error) {
+	if resolution != models.DisputeResolutionCompromised && resolution != models.DisputeResolutionNotCompromised {
+		return nil, fmt.Errorf("%w: resolution must be %s or %s", ErrInvalidDisputeStep, models.DisputeResolutionCompromised, models.DisputeResolutionNotCompromised)
+	}
+	dispute, err := s.GetDispute(disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.Status == models.DisputeResolved {
+		return nil, fmt.Errorf("%w: already resolved", ErrDisputeState)
+	}
+	if resolution == models.DisputeResolutionCompromised && dispute.Status != models.DisputeRemediated {
+		return nil, fmt.Errorf("%w: the user has not finished remediation", ErrDisputeState)
+	}
+
+	dispute.Status = models.DisputeResolved
+	dispute.Resolution = resolution
+	dispute.ResolutionNote = note
+	dispute.ResolvedBy = resolver
+	dispute.ResolvedAt = &now
+	if err := s.db.Save(dispute).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve login dispute: %w", err)
+	}
+	s.audit(resolver, "login_dispute_resolved", dispute, fmt.Sprintf("Resolved as %s", resolution))
+	return dispute, nil
+}
+
+// GetDispute returns a dispute by ID
+func (s *LoginDisputeService) GetDispute(disputeID uuid.UUID) (*models.LoginDispute, error) {
+	var dispute models.LoginDispute
+	if err := s.db.First(&dispute, "id = ?", disputeID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrDisputeNotFound
+		}
+		return nil, fmt.Errorf("failed to get login dispute: %w", err)
+	}
+	return &dispute, nil
+}
+
+// GetUserDispute returns one of the user's own disputes
+func (s *LoginDisputeService) GetUserDispute(userID, disputeID uuid.UUID) (*models.LoginDispute, error) {
+	dispute, err := s.GetDispute(disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.UserID != userID {
+		return nil, ErrDisputeNotFound
+	}
+	return dispute, nil
+}
+
+// ListDisputes returns disputes newest first. userID and status are optional filters.
+func (s *LoginDisputeService) ListDisputes(userID *uuid.UUID, status string) ([]models.LoginDispute, error) {
+	query := s.db.Order("created_at DESC")
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var disputes []models.LoginDispute
+	if err := query.Find(&disputes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list login disputes: %w", err)
+	}
+	return disputes, nil
+}
+
+// PendingRemediation returns the user's oldest dispute with remediation steps left, or
+// nil when there is none
+func (s *LoginDisputeService) PendingRemediation(userID uuid.UUID) (*models.LoginDispute, error) {
+	var dispute models.LoginDispute
+	err := s.db.Where("user_id = ? AND status = ?", userID, models.DisputeOpen).Order("created_at ASC").First(&dispute).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending login dispute: %w", err)
+	}
+	return &dispute, nil
+}
+
+// PendingDisputeSteps lists the remediation steps a dispute is still waiting on
+func PendingDisputeSteps(dispute *models.LoginDispute) []string {
+	steps := []string{}
+	if dispute.PasswordResetAt == nil {
+		steps = append(steps, DisputeStepPasswordReset)
+	}
+	if dispute.MFAVerifiedAt == nil {
+		steps = append(steps, DisputeStepMFAReenrollment)
+	}
+	return steps
+}
+
+func (s *LoginDisputeService) openDispute(userID, disputeID uuid.UUID) (*models.LoginDispute, error) {
+	dispute, err := s.GetUserDispute(userID, disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.Status != models.DisputeOpen {
+		return nil, fmt.Errorf("%w: remediation is already complete", ErrDisputeState)
+	}
+	return dispute, nil
+}
+
+func (s *LoginDisputeService) audit(actor *uuid.UUID, action string, dispute *models.LoginDispute, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "login_dispute",
+		ResourceID: dispute.ID.String(),
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit login dispute event: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginAttempt describes a login attempt to record
+type LoginAttempt struct {
+	UserID        *uuid.UUID
+	Email         string
+	Success       bool
+	FailureReason string
+	Method        string
+	SessionID     *uuid.UUID
+	IPAddress     string
+	UserAgent     string
+}
+
+// LoginCluster groups logins from about the same place, for drawing one marker per place
+type LoginCluster struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Country   string    `json:"country,omitempty"`
+	Region    string    `json:"region,omitempty"`
+	City      string    `json:"city,omitempty"`
+	Logins    int       `json:"logins"`
+	Failures  int       `json:"failures"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// GeoBounds is the box containing every clustered login, for fitting a map to it
+type GeoBounds struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+// LoginHistory is one page of a user's logins, with clustering hints covering the whole
+// cluster window rather than just the page
+type LoginHistory struct {
+	Events        []models.LoginEvent `json:"events"`
+	Total         int64               `json:"total"`
+	Limit         int                 `json:"limit"`
+	Offset        int                 `json:"offset"`
+	Clusters      []LoginCluster      `json:"clusters"`
+	Bounds        *GeoBounds          `json:"bounds,omitempty"`
+	ClusterWindow string              `json:"cluster_window"`
+}
+
+// loginClusterPrecision rounds coordinates to one decimal place, about 11km, when clustering
+const loginClusterPrecision = 10
+
+// LoginHistoryService records every login attempt with where it came from, for the
+// user's security center and for administrators investigating an account
+type LoginHistoryService struct {
+	db            *gorm.DB
+	locate        func(ipAddress string) *GeoLocation
+	clusterWindow time.Duration
+}
+
+// NewLoginHistoryService creates a new login history service. locate resolves IP
+// addresses, returning nil when it cannot; clusters cover the last
+// LOGIN_HISTORY_CLUSTER_WINDOW of logins.
+func NewLoginHistoryService(db *gorm.DB, locate func(ipAddress string) *GeoLocation) *LoginHistoryService {
+	return &LoginHistoryService{
+		db:            db,
+		locate:        locate,
+		clusterWindow: envDuration("LOGIN_HISTORY_CLUSTER_WINDOW", 90*24*time.Hour),
+	}
+}
+
+// Record stores a login attempt with its resolved location
+func (s *LoginHistoryService) Record(attempt LoginAttempt, now time.Time) (*models.LoginEvent, error) {
+	event := models.LoginEvent{
+		UserID:        attempt.UserID,
+		Email:         attempt.Email,
+		Success:       attempt.Success,
+		FailureReason: attempt.FailureReason,
+		Method:        attempt.Method,
+		SessionID:     attempt.SessionID,
+		IPAddress:     attempt.IPAddress,
+		UserAgent:     attempt.UserAgent,
+		CreatedAt:     now,
+	}
+	if s.locate != nil && attempt.IPAddress != "" {
+		if location := s.locate(attempt.IPAddress); location != nil {
+			event.Country = location.Country
+			event.Region = location.Region
+			event.City = location.City
+			// 0,0 is what an unresolved lookup leaves behind, not a real login location
+			if location.Latitude != 0 || location.Longitude != 0 {
+				event.Latitude = &location.Latitude
+				event.Longitude = &location.Longitude
+			}
+		}
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+	if !attempt.Success {
+		observeIP(attempt.IPAddress, IPObservationFailedLogin)
+	}
+	return &event, nil
+}
+
+// History returns a page of the user's logins, newest first
+func (s *LoginHistoryService) History(userID uuid.UUID, limit, offset int, now time.Time) (*LoginHistory, error) {
+	base := s.db.Model(&models.LoginEvent{}).Where("user_id = ?", userID).Session(&gorm.Session{})
+
+	history := &LoginHistory{
+		Events:        []models.LoginEvent{},
+		Limit:         limit,
+		Offset:        offset,
+		Clusters:      []LoginCluster{},
+		ClusterWindow: s.clusterWindow.String(),
+	}
+	if err := base.Count(&history.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count logins: %w", err)
+	}
+	if err := base.Order("created_at DESC").Limit(limit).Offset(offset).Find(&history.Events).Error; err != nil {
+		return nil, fmt.Errorf("failed to get login history: %w", err)
+	}
+
+	var located []models.LoginEvent
+	err := base.Where("latitude IS NOT NULL AND longitude IS NOT NULL AND created_at > ?", now.Add(-s.clusterWindow)).
+		Order("created_at ASC").Find(&located).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get located logins: %w", err)
+	}
+	history.Clusters, history.Bounds = clusterLogins(located)
+	return history, nil
+}
+
+// clusterLogins groups located logins by rounded coordinates, each cluster centered on
+// the mean of its logins, busiest first. Events must be oldest first.
+func clusterLogins(events []models.LoginEvent) ([]LoginCluster, *GeoBounds) {
+	type key struct{ lat, lng int64 }
+	type sums struct {
+		cluster  LoginCluster
+		lat, lng float64
+	}
+	var order []key
+	groups := map[key]*sums{}
+	var bounds *GeoBounds
+
+	for _, e := range events {
+		lat, lng := *e.Latitude, *e.Longitude
+		k := key{int64(math.Round(lat * loginClusterPrecision)), int64(math.Round(lng * loginClusterPrecision))}
+		group, ok := groups[k]
+		if !ok {
+			group = &sums{cluster: LoginCluster{Country: e.Country, Region: e.Region, City: e.City, FirstSeen: e.CreatedAt}}
+			groups[k] = group
+			order = append(order, k)
+		}
+		group.lat += lat
+		group.lng += lng
+		group.cluster.Logins++
+		if !e.Success {
+			group.cluster.Failures++
+		}
+		group.cluster.LastSeen = e.CreatedAt
+
+		if bounds == nil {
+			bounds = &GeoBounds{MinLatitude: lat, MinLongitude: lng, MaxLatitude: lat, MaxLongitude: lng}
+		}
+		bounds.MinLatitude = math.Min(bounds.MinLatitude, lat)
+		bounds.MinLongitude = math.Min(bounds.MinLongitude, lng)
+		bounds.MaxLatitude = math.Max(bounds.MaxLatitude, lat)
+		bounds.MaxLongitude = math.Max(bounds.MaxLongitude, lng)
+	}
+
+	clusters := make([]LoginCluster, 0, len(order))
+	for _, k := range order {
+		group := groups[k]
+		group.cluster.Latitude = group.lat / float64(group.cluster.Logins)
+		group.cluster.Longitude = group.lng / float64(group.cluster.Logins)
+		clusters = append(clusters, group.cluster)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Logins > clusters[j].Logins })
+	return clusters, bounds
+}
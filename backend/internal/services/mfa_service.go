@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"time"
@@ -211,8 +212,9 @@ func ReplaceBackupCodes(userID string, newCodes []string) error {
 	return tx.Commit().Error
 }
 
-// LogAuditEvent logs an audit event (wrapper for existing audit logging)
-func LogAuditEvent(userID, action, resource, resourceID, ipAddress, userAgent, details, status string) {
+// LogAuditEvent logs an audit event (wrapper for existing audit logging). The entry is written
+// even when ctx is cancelled, as long as the database answers within DB_TIMEOUT.
+func LogAuditEvent(ctx context.Context, userID, action, resource, resourceID, ipAddress, userAgent, details, status string) {
 	db := GetDB()
 
 	var userUUID *uuid.UUID
@@ -233,7 +235,17 @@ func LogAuditEvent(userID, action, resource, resourceID, ipAddress, userAgent, d
 		Status:     status,
 	}
 
-	if err := db.Create(&auditLog).Error; err != nil {
+	// The database is a read-only replica during disaster recovery
+	if DisasterRecoveryActive() {
+		if err := disasterRecovery.QueueAuditLog(auditLog); err != nil {
+			fmt.Printf("Failed to queue audit log: %v\n", err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(detached(ctx), dbTimeout)
+	defer cancel()
+	if err := auditDB(ctx, userUUID, db).WithContext(ctx).Create(&auditLog).Error; err != nil {
 		// Log error but don't fail the operation
 		fmt.Printf("Failed to create audit log: %v\n", err)
 	}
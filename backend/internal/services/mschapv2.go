@@ -0,0 +1,93 @@
+package services
+
+import (
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// MS-CHAPv2 authenticator response constants (RFC 2759 section 8.7)
+var (
+	msCHAPMagic1 = []byte("Magic server to client signing constant")
+	msCHAPMagic2 = []byte("Pad to make it do more than one iteration")
+)
+
+// NTPasswordHash is the MD4 of the UTF-16LE password that MS-CHAPv2 is keyed on
+func NTPasswordHash(password string) []byte {
+	encoded := utf16.Encode([]rune(password))
+	buf := make([]byte, 2*len(encoded))
+	for i, unit := range encoded {
+		buf[2*i] = byte(unit)
+		buf[2*i+1] = byte(unit >> 8)
+	}
+	hash := md4.New()
+	hash.Write(buf)
+	return hash.Sum(nil)
+}
+
+// msCHAPChallengeHash binds the peer and authenticator challenges to the user name,
+// without any Windows domain prefix
+func msCHAPChallengeHash(peerChallenge, authenticatorChallenge []byte, userName string) []byte {
+	if i := strings.LastIndex(userName, `\`); i >= 0 {
+		userName = userName[i+1:]
+	}
+	hash := sha1.New()
+	hash.Write(peerChallenge)
+	hash.Write(authenticatorChallenge)
+	hash.Write([]byte(userName))
+	return hash.Sum(nil)[:8]
+}
+
+// MSCHAPv2NTResponse computes the 24-byte NT-Response a peer that knows the password
+// sends (RFC 2759 GenerateNTResponse)
+func MSCHAPv2NTResponse(authenticatorChallenge, peerChallenge []byte, userName string, ntHash []byte) []byte {
+	challenge := msCHAPChallengeHash(peerChallenge, authenticatorChallenge, userName)
+	key := make([]byte, 21)
+	copy(key, ntHash)
+	response := make([]byte, 24)
+	for i := 0; i < 3; i++ {
+		block, _ := des.NewCipher(expandDESKey(key[7*i : 7*i+7]))
+		block.Encrypt(response[8*i:8*i+8], challenge)
+	}
+	return response
+}
+
+// VerifyMSCHAPv2 checks a peer's NT-Response and, when it matches, returns the
+// authenticator response ("S=...") proving to the peer that the server knows the password
+func VerifyMSCHAPv2(authenticatorChallenge, peerChallenge, ntResponse []byte, userName string, ntHash []byte) (string, bool) {
+	expected := MSCHAPv2NTResponse(authenticatorChallenge, peerChallenge, userName, ntHash)
+	if subtle.ConstantTimeCompare(expected, ntResponse) != 1 {
+		return "", false
+	}
+
+	hashHash := md4.New()
+	hashHash.Write(ntHash)
+	digest := sha1.New()
+	digest.Write(hashHash.Sum(nil))
+	digest.Write(ntResponse)
+	digest.Write(msCHAPMagic1)
+	final := sha1.New()
+	final.Write(digest.Sum(nil))
+	final.Write(msCHAPChallengeHash(peerChallenge, authenticatorChallenge, userName))
+	final.Write(msCHAPMagic2)
+	return "S=" + strings.ToUpper(hex.EncodeToString(final.Sum(nil))), true
+}
+
+// expandDESKey spreads 56 key bits over 8 bytes, leaving the low (parity) bit of each clear
+func expandDESKey(key []byte) []byte {
+	return []byte{
+		key[0] & 0xfe,
+		(key[0]<<7 | key[1]>>1) & 0xfe,
+		(key[1]<<6 | key[2]>>2) & 0xfe,
+		(key[2]<<5 | key[3]>>3) & 0xfe,
+		(key[3]<<4 | key[4]>>4) & 0xfe,
+		(key[4]<<3 | key[5]>>5) & 0xfe,
+		(key[5]<<2 | key[6]>>6) & 0xfe,
+		key[6] << 1,
+	}
+}
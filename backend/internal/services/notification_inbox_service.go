@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// NotificationFilter selects notifications from a recipient's inbox
+type NotificationFilter struct {
+	Severities []AlertSeverity
+	UnreadOnly bool
+	Limit      int
+	Offset     int
+}
+
+// NotificationCounts are a recipient's unread notifications, in total and by severity
+type NotificationCounts struct {
+	Unread     int64                   `json:"unread"`
+	BySeverity map[AlertSeverity]int64 `json:"by_severity"`
+}
+
+// NotificationInboxService keeps an in-app inbox of alerts for every admin and security
+// analyst, for those who don't watch Slack or email. Notifications older than
+// NOTIFICATION_INBOX_RETENTION_DAYS are purged.
+type NotificationInboxService struct {
+	db        *gorm.DB
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewNotificationInboxService creates a notification inbox configured from the environment
+func NewNotificationInboxService(db *gorm.DB) *NotificationInboxService {
+	return &NotificationInboxService{
+		db:        db,
+		retention: time.Duration(envInt("NOTIFICATION_INBOX_RETENTION_DAYS", 90)) * 24 * time.Hour,
+		interval:  envDuration("NOTIFICATION_INBOX_PURGE_INTERVAL", 24*time.Hour),
+	}
+}
+
+// Interval is how often old notifications should be purged
+func (s *NotificationInboxService) Interval() time.Duration {
+	return s.interval
+}
+
+// Deliver puts an alert in the inbox of every active admin and security analyst,
+// returning how many received it
+func (s *NotificationInboxService) Deliver(alert SecurityAlert) (int, error) {
+	var recipients []uuid.UUID
+	err := s.db.Model(&models.RoleAssignment{}).Distinct("role_assignments.user_id").
+		Joins("JOIN users ON users.id = role_assignments.user_id").
+		Where("role_assignments.role IN ? AND users.is_active = ?", privilegedRoles, true).
+		Pluck("role_assignments.user_id", &recipients).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list notification recipients: %w", err)
+	}
+	if len(recipients) == 0 {
+		return 0, nil
+	}
+
+	var alertID *uuid.UUID
+	if alert.ID != uuid.Nil {
+		alertID = &alert.ID
+	}
+	createdAt := alert.Timestamp
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	notifications := make([]models.AdminNotification, 0, len(recipients))
+	for _, recipient := range recipients {
+		notifications = append(notifications, models.AdminNotification{
+			RecipientID: recipient,
+			AlertID:     alertID,
+			AlertType:   string(alert.Type),
+			Severity:    string(alert.Severity),
+			Title:       alert.Title,
+			Message:     alert.Description,
+			CreatedAt:   createdAt,
+		})
+	}
+	if err := s.db.Create(&notifications).Error; err != nil {
+		return 0, fmt.Errorf("failed to store notifications: %w", err)
+	}
+	return len(notifications), nil
+}
+
+// List returns a recipient's notifications, newest first, with how many match the filter
+func (s *NotificationInboxService) List(recipientID uuid.UUID, filter NotificationFilter) ([]models.AdminNotification, int64, error) {
+	query := s.db.Model(&models.AdminNotification{}).Where("recipient_id = ?", recipientID)
+	if len(filter.Severities) > 0 {
+		query = query.Where("severity IN ?", filter.Severities)
+	}
+	if filter.UnreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	notifications := make([]models.AdminNotification, 0)
+	if err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&notifications).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	return notifications, total, nil
+}
+
+// UnreadCounts counts a recipient's unread notifications by severity
+func (s *NotificationInboxService) UnreadCounts(recipientID uuid.UUID) (*NotificationCounts, error) {
+	var rows []struct {
+		Severity AlertSeverity
+		Count    int64
+	}
+	if err := s.db.Model(&models.AdminNotification{}).Select("severity, COUNT(*) AS count").
+		Where("recipient_id = ? AND read_at IS NULL", recipientID).Group("severity").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	counts := &NotificationCounts{BySeverity: map[AlertSeverity]int64{
+		SeverityLow: 0, SeverityMedium: 0, SeverityHigh: 0, SeverityCritical: 0,
+	}}
+	for _, row := range rows {
+		counts.BySeverity[row.Severity] = row.Count
+		counts.Unread += row.Count
+	}
+	return counts, nil
+}
+
+// MarkRead marks one of a recipient's notifications read
+func (s *NotificationInboxService) MarkRead(recipientID, notificationID uuid.UUID, now time.Time) error {
+	result := s.db.Model(&models.AdminNotification{}).
+		Where("id = ? AND recipient_id = ?", notificationID, recipientID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", now))
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark notification read: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks a recipient's unread notifications read, only those of the given
+// severities when any are given, returning how many it marked
+func (s *NotificationInboxService) MarkAllRead(recipientID uuid.UUID, severities []AlertSeverity, now time.Time) (int64, error) {
+	query := s.db.Model(&models.AdminNotification{}).Where("recipient_id = ? AND read_at IS NULL", recipientID)
+	if len(severities) > 0 {
+		query = query.Where("severity IN ?", severities)
+	}
+	result := query.Update("read_at", now)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Purge deletes notifications older than the retention period
+func (s *NotificationInboxService) Purge(now time.Time) (int64, error) {
+	result := s.db.Where("created_at < ?", now.Add(-s.retention)).Delete(&models.AdminNotification{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge notifications: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// InboxAlertChannel delivers alerts at or above a severity to the admin notification inbox
+type InboxAlertChannel struct {
+	Inbox       *NotificationInboxService
+	MinSeverity AlertSeverity
+	Enabled     bool
+}
+
+func (i *InboxAlertChannel) SendAlert(alert SecurityAlert) error {
+	if !i.Enabled || i.Inbox == nil {
+		return nil
+	}
+	if alert.Severity.Compare(i.MinSeverity) < 0 {
+		return nil
+	}
+	delivered, err := i.Inbox.Deliver(alert)
+	if err != nil {
+		return err
+	}
+	if delivered > 0 {
+		log.Printf("📥 Delivered alert to %d admin inboxes: %s", delivered, alert.Title)
+	}
+	return nil
+}
+
+func (i *InboxAlertChannel) GetChannelType() string {
+	return "inbox"
+}
+
+func (i *InboxAlertChannel) IsEnabled() bool {
+	return i.Enabled
+}
@@ -40,11 +40,11 @@ type EnhancedConnection struct {
 
 // ConnectionHealth represents health status of a connection
 type ConnectionHealth struct {
-	Status       string  `json:"status"`
-	LastCheck    string  `json:"last_check"`
-	ResponseTime int     `json:"response_time"`
-	Uptime       float64 `json:"uptime"`
-	ErrorCount   int     `json:"error_count"`
+	Status       models.HealthStatus `json:"status"`
+	LastCheck    string              `json:"last_check"`
+	ResponseTime int                 `json:"response_time"`
+	Uptime       float64             `json:"uptime"`
+	ErrorCount   int                 `json:"error_count"`
 }
 
 // GetUserConnections retrieves all connections for a user with health data
@@ -103,7 +103,7 @@ func (s *OAuthMonitoringService) GetConnectionStats(userID string) (*ConnectionS
 
 	// Get active connections
 	var activeCount int64
-	if err := s.db.Model(&models.AppConnection{}).Where("user_id = ? AND status = ?", userUUID, "connected").Count(&activeCount).Error; err != nil {
+	if err := s.db.Model(&models.AppConnection{}).Where("user_id = ? AND status = ?", userUUID, models.ConnectionConnected).Count(&activeCount).Error; err != nil {
 		return nil, fmt.Errorf("failed to count active connections: %w", err)
 	}
 	stats.ActiveConnections = int(activeCount)
@@ -117,7 +117,7 @@ func (s *OAuthMonitoringService) GetConnectionStats(userID string) (*ConnectionS
 
 	// Calculate average response time for active connections
 	var avgResponseTime *float64
-	if err := s.db.Model(&models.AppConnection{}).Where("user_id = ? AND status = ?", userUUID, "connected").Select("AVG(response_time)").Scan(&avgResponseTime).Error; err != nil {
+	if err := s.db.Model(&models.AppConnection{}).Where("user_id = ? AND status = ?", userUUID, models.ConnectionConnected).Select("AVG(response_time)").Scan(&avgResponseTime).Error; err != nil {
 		return nil, fmt.Errorf("failed to calculate average response time: %w", err)
 	}
 	if avgResponseTime != nil {
@@ -128,7 +128,7 @@ func (s *OAuthMonitoringService) GetConnectionStats(userID string) (*ConnectionS
 
 	// Calculate average uptime percentage
 	var avgUptime *float64
-	if err := s.db.Model(&models.AppConnection{}).Where("user_id = ? AND status = ?", userUUID, "connected").Select("AVG(uptime_percent)").Scan(&avgUptime).Error; err != nil {
+	if err := s.db.Model(&models.AppConnection{}).Where("user_id = ? AND status = ?", userUUID, models.ConnectionConnected).Select("AVG(uptime_percent)").Scan(&avgUptime).Error; err != nil {
 		return nil, fmt.Errorf("failed to calculate average uptime: %w", err)
 	}
 	if avgUptime != nil {
@@ -170,10 +170,10 @@ func (s *OAuthMonitoringService) TestConnection(userID, connectionID string) err
 	}
 
 	if success {
-		updates["health_status"] = "healthy"
+		updates["health_status"] = models.HealthHealthy
 		updates["error_count"] = 0
 	} else {
-		updates["health_status"] = "error"
+		updates["health_status"] = models.HealthError
 		updates["error_count"] = connection.ErrorCount + 1
 		updates["last_error"] = errorMsg
 		updates["last_error_at"] = now
@@ -198,6 +198,16 @@ func (s *OAuthMonitoringService) TestConnection(userID, connectionID string) err
 		fmt.Printf("Failed to record health metrics: %v\n", err)
 	}
 
+	recordIntegrationSample(s.db, models.IntegrationHealthSample{
+		Provider:     connection.Provider,
+		ConnectionID: &connUUID,
+		Kind:         models.IntegrationSampleHealthCheck,
+		Success:      success,
+		LatencyMs:    responseTime,
+		StatusCode:   statusCode,
+		Error:        errorMsg,
+	})
+
 	return nil
 }
 
@@ -297,6 +307,42 @@ func (s *OAuthMonitoringService) RecordUsage(userID, connectionID string, dataTr
 		Updates(updates).Error
 }
 
+// RecordCallOutcome records the outcome of an API call or token refresh made through a
+// user's connection
+func (s *OAuthMonitoringService) RecordCallOutcome(userID, connectionID, kind string, success bool, latencyMs, statusCode int, errorMsg string) error {
+	if kind == "" {
+		kind = models.IntegrationSampleAPICall
+	}
+	if kind != models.IntegrationSampleAPICall && kind != models.IntegrationSampleTokenRefresh {
+		return fmt.Errorf("%w: %s", ErrInvalidSampleKind, kind)
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+	connUUID, err := uuid.Parse(connectionID)
+	if err != nil {
+		return fmt.Errorf("invalid connection ID: %w", err)
+	}
+
+	var connection models.AppConnection
+	if err := s.db.Where("id = ? AND user_id = ?", connUUID, userUUID).First(&connection).Error; err != nil {
+		return fmt.Errorf("connection not found: %w", err)
+	}
+
+	recordIntegrationSample(s.db, models.IntegrationHealthSample{
+		Provider:     connection.Provider,
+		ConnectionID: &connUUID,
+		Kind:         kind,
+		Success:      success,
+		LatencyMs:    latencyMs,
+		StatusCode:   statusCode,
+		Error:        errorMsg,
+	})
+	return nil
+}
+
 // GetSecurityEvents retrieves security events for a user
 func (s *OAuthMonitoringService) GetSecurityEvents(userID string, limit int) ([]models.SecurityEvent, error) {
 	userUUID, err := uuid.Parse(userID)
@@ -326,11 +372,16 @@ func (s *OAuthMonitoringService) CreateSecurityEvent(userID string, eventType, d
 		return fmt.Errorf("invalid user ID: %w", err)
 	}
 
+	eventSeverity, err := models.ParseSeverity(severity)
+	if err != nil {
+		return err
+	}
+
 	event := models.SecurityEvent{
 		UserID:      userUUID,
 		EventType:   eventType,
 		Description: description,
-		Severity:    severity,
+		Severity:    eventSeverity,
 		IPAddress:   ipAddress,
 		UserAgent:   userAgent,
 		Location:    location,
@@ -0,0 +1,517 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+)
+
+// ErrInvalidOAuthProvider is returned for provider configurations missing required settings
+var ErrInvalidOAuthProvider = errors.New("invalid OAuth provider")
+
+// OAuthProviderConfig describes an OAuth 2.0 authorization code integration. Built-in
+// providers are declared here; more can be added with a JSON list in OAUTH_PROVIDERS_FILE.
+type OAuthProviderConfig struct {
+	Name        string `json:"name"` // used in /oauth/<name>/connect and /oauth/<name>/callback
+	DisplayName string `json:"display_name"`
+	AppID       string `json:"app_id"` // the app connection the tokens are stored on
+	AuthURL     string `json:"auth_url"`
+	TokenURL    string `json:"token_url"`
+	ClientIDEnv string `json:"client_id_env"`
+	SecretEnv   string `json:"secret_env"`
+	// BasicAuth sends the client credentials in the Authorization header instead of the form
+	BasicAuth bool   `json:"basic_auth"`
+	Scope     string `json:"scope"`
+	// AuthParams are added to the authorization URL, such as access_type or prompt
+	AuthParams map[string]string `json:"auth_params"`
+	// OIDC sends a nonce and requires the token response to carry a valid ID token
+	OIDC bool `json:"oidc"`
+	// NoPKCE leaves out the PKCE code challenge and verifier, for providers that reject them
+	NoPKCE bool `json:"no_pkce"`
+
+	// UserInfoURL may name token response fields in braces, like {instance_url}/userinfo
+	UserInfoURL     string            `json:"user_info_url"`
+	UserInfoMethod  string            `json:"user_info_method"`
+	UserInfoHeaders map[string]string `json:"user_info_headers"`
+	// Fields are dotted paths into the user info response; the first non-empty email wins
+	EmailFields   []string `json:"email_fields"`
+	NameField     string   `json:"name_field"`
+	UsernameField string   `json:"username_field"`
+	// TokenExtras and UserExtras copy more fields onto the app connection, by connection key
+	TokenExtras map[string]string `json:"token_extras"`
+	UserExtras  map[string]string `json:"user_extras"`
+	// AdminLinks are admin console URL templates by subject kind (user, repository or
+	// audit_log). Braces name a subject field or a connection extra, like {email} or
+	// {instance_url}; see AdminLinkService.
+	AdminLinks map[string]string `json:"admin_links"`
+}
+
+// Client returns how CloudGate authenticates to the provider's token endpoint
+func (c OAuthProviderConfig) Client() ProviderOAuthClient {
+	return ProviderOAuthClient{TokenURL: c.TokenURL, ClientIDEnv: c.ClientIDEnv, SecretEnv: c.SecretEnv, BasicAuth: c.BasicAuth}
+}
+
+func (c OAuthProviderConfig) validate() error {
+	var missing []string
+	for name, value := range map[string]string{
+		"name": c.Name, "app_id": c.AppID, "auth_url": c.AuthURL, "token_url": c.TokenURL,
+		"user_info_url": c.UserInfoURL, "client_id_env": c.ClientIDEnv, "secret_env": c.SecretEnv,
+	} {
+		if strings.TrimSpace(value) == "" {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %q is missing %s", ErrInvalidOAuthProvider, c.Name, strings.Join(missing, ", "))
+	}
+	if !providerNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("%w: name %q must be lowercase letters, digits and dashes", ErrInvalidOAuthProvider, c.Name)
+	}
+	if c.Name == "trello" {
+		return fmt.Errorf("%w: trello is served by its OAuth 1.0a flow", ErrInvalidOAuthProvider)
+	}
+	return nil
+}
+
+// Label returns the provider's name for messages
+func (c OAuthProviderConfig) Label() string {
+	if c.DisplayName != "" {
+		return c.DisplayName
+	}
+	return c.Name
+}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// builtinOAuthProviders are the integrations CloudGate ships with
+var builtinOAuthProviders = []OAuthProviderConfig{
+	{
+		Name: "google", DisplayName: "Google", AppID: "google-workspace", OIDC: true,
+		AuthURL:     "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:    "https://oauth2.googleapis.com/token",
+		ClientIDEnv: "GOOGLE_CLIENT_ID", SecretEnv: "GOOGLE_CLIENT_SECRET",
+		Scope:       "openid email profile https://www.googleapis.com/auth/gmail.readonly https://www.googleapis.com/auth/drive.readonly https://www.googleapis.com/auth/calendar.readonly",
+		AuthParams:  map[string]string{"access_type": "offline", "prompt": "consent"},
+		UserInfoURL: "https://www.googleapis.com/oauth2/v2/userinfo",
+		EmailFields: []string{"email"}, NameField: "name",
+		UserExtras: map[string]string{"google_user_id": "id"},
+		AdminLinks: map[string]string{
+			AdminLinkUser:     "https://admin.google.com/ac/search?query={email}",
+			AdminLinkAuditLog: "https://admin.google.com/ac/reporting/audit/login",
+		},
+	},
+	{
+		Name: "microsoft", DisplayName: "Microsoft", AppID: "microsoft-365", OIDC: true,
+		AuthURL:     "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		TokenURL:    "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		ClientIDEnv: "MICROSOFT_CLIENT_ID", SecretEnv: "MICROSOFT_CLIENT_SECRET",
+		Scope:       "openid email profile User.Read Mail.Read Calendars.Read Files.Read",
+		UserInfoURL: "https://graph.microsoft.com/v1.0/me",
+		EmailFields: []string{"mail", "userPrincipalName"}, NameField: "displayName",
+		AdminLinks: map[string]string{
+			AdminLinkUser:     "https://entra.microsoft.com/#view/Microsoft_AAD_UsersAndTenants/UserManagementMenuBlade/~/AllUsers/searchText/{email}",
+			AdminLinkAuditLog: "https://entra.microsoft.com/#view/Microsoft_AAD_IAM/SignInEventsV3Blade",
+		},
+	},
+	{
+		Name: "slack", DisplayName: "Slack", AppID: "slack",
+		AuthURL:     "https://slack.com/oauth/v2/authorize",
+		TokenURL:    "https://slack.com/api/oauth.v2.access",
+		ClientIDEnv: "SLACK_CLIENT_ID", SecretEnv: "SLACK_CLIENT_SECRET",
+		Scope:       "channels:read,chat:write,users:read,users:read.email",
+		UserInfoURL: "https://slack.com/api/users.identity",
+		EmailFields: []string{"user.profile.email"}, NameField: "user.real_name",
+		TokenExtras: map[string]string{"team_name": "team.name", "team_id": "team.id"},
+		UserExtras:  map[string]string{"slack_user_id": "user.id"},
+		AdminLinks: map[string]string{
+			AdminLinkUser:     "https://app.slack.com/manage/{team_id}/people?search={email}",
+			AdminLinkAuditLog: "https://app.slack.com/manage/{team_id}/logs/access",
+		},
+	},
+	{
+		Name: "github", DisplayName: "GitHub", AppID: "github",
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		ClientIDEnv: "GITHUB_CLIENT_ID", SecretEnv: "GITHUB_CLIENT_SECRET",
+		Scope:           "user:email,repo,read:org",
+		UserInfoURL:     "https://api.github.com/user",
+		UserInfoHeaders: map[string]string{"Accept": "application/vnd.github.v3+json"},
+		EmailFields:     []string{"email"}, NameField: "name", UsernameField: "login",
+		AdminLinks: map[string]string{
+			AdminLinkUser:       "https://github.com/orgs/{org}/people?query={username}",
+			AdminLinkRepository: "https://github.com/{repository}/settings",
+			AdminLinkAuditLog:   "https://github.com/organizations/{org}/settings/audit-log",
+		},
+	},
+	{
+		Name: "salesforce", DisplayName: "Salesforce", AppID: "salesforce",
+		AuthURL:     "https://login.salesforce.com/services/oauth2/authorize",
+		TokenURL:    "https://login.salesforce.com/services/oauth2/token",
+		ClientIDEnv: "SALESFORCE_CLIENT_ID", SecretEnv: "SALESFORCE_CLIENT_SECRET",
+		Scope:       "openid email profile api",
+		UserInfoURL: "{instance_url}/services/oauth2/userinfo",
+		EmailFields: []string{"email"}, NameField: "display_name", UsernameField: "username",
+		TokenExtras: map[string]string{"instance_url": "instance_url"},
+		AdminLinks: map[string]string{
+			AdminLinkUser:     "{instance_url}/lightning/setup/ManageUsers/home",
+			AdminLinkAuditLog: "{instance_url}/lightning/setup/OrgLoginHistory/home",
+		},
+	},
+	{
+		Name: "jira", DisplayName: "Jira", AppID: "jira",
+		AuthURL:     "https://auth.atlassian.com/authorize",
+		TokenURL:    "https://auth.atlassian.com/oauth/token",
+		ClientIDEnv: "JIRA_CLIENT_ID", SecretEnv: "JIRA_CLIENT_SECRET",
+		Scope:       "read:jira-user read:jira-work write:jira-work",
+		AuthParams:  map[string]string{"audience": "api.atlassian.com", "prompt": "consent"},
+		UserInfoURL: "https://api.atlassian.com/me",
+		EmailFields: []string{"emailAddress"}, NameField: "displayName",
+		UserExtras: map[string]string{"account_id": "accountId"},
+	},
+	{
+		Name: "notion", DisplayName: "Notion", AppID: "notion", BasicAuth: true,
+		AuthURL:     "https://api.notion.com/v1/oauth/authorize",
+		TokenURL:    "https://api.notion.com/v1/oauth/token",
+		ClientIDEnv: "NOTION_CLIENT_ID", SecretEnv: "NOTION_CLIENT_SECRET",
+		AuthParams:      map[string]string{"owner": "user"},
+		UserInfoURL:     "https://api.notion.com/v1/users/me",
+		UserInfoHeaders: map[string]string{"Notion-Version": "2022-06-28"},
+		EmailFields:     []string{"person.email"}, NameField: "name",
+		TokenExtras: map[string]string{"bot_id": "bot_id", "workspace_id": "workspace_id"},
+	},
+	{
+		Name: "dropbox", DisplayName: "Dropbox", AppID: "dropbox",
+		AuthURL:     "https://www.dropbox.com/oauth2/authorize",
+		TokenURL:    "https://api.dropboxapi.com/oauth2/token",
+		ClientIDEnv: "DROPBOX_CLIENT_ID", SecretEnv: "DROPBOX_CLIENT_SECRET",
+		UserInfoURL:     "https://api.dropboxapi.com/2/users/get_current_account",
+		UserInfoMethod:  http.MethodPost,
+		UserInfoHeaders: map[string]string{"Content-Type": "application/json"},
+		EmailFields:     []string{"email"}, NameField: "name.display_name",
+		UserExtras: map[string]string{"account_id": "account_id"},
+		AdminLinks: map[string]string{
+			AdminLinkUser:     "https://www.dropbox.com/team/admin/members?search={email}",
+			AdminLinkAuditLog: "https://www.dropbox.com/team/admin/activity",
+		},
+	},
+}
+
+// OAuthToken is a provider's token response
+type OAuthToken struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	Scope        string
+	ExpiresIn    int
+	IDToken      string
+	Raw          map[string]interface{}
+}
+
+// OAuthUserInfo is the account the tokens were issued for
+type OAuthUserInfo struct {
+	Email    string
+	Name     string
+	Username string
+	Raw      map[string]interface{}
+}
+
+// OAuthProvider runs the authorization code flow against one provider
+type OAuthProvider interface {
+	Config() OAuthProviderConfig
+	AuthURL(redirectURI, state, nonce, codeChallenge string) string
+	Exchange(ctx context.Context, code, redirectURI, codeVerifier, clientSecret string) (*OAuthToken, error)
+	FetchUserInfo(ctx context.Context, token *OAuthToken) (*OAuthUserInfo, error)
+	StoreTokens(userID string, token *OAuthToken, userInfo *OAuthUserInfo) error
+}
+
+// OAuthProviderRegistry holds the OAuth integrations users can connect
+type OAuthProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]OAuthProvider
+}
+
+// NewOAuthProviderRegistry creates a registry of the built-in providers plus those
+// configured in OAUTH_PROVIDERS_FILE, which replace built-ins of the same name
+func NewOAuthProviderRegistry() *OAuthProviderRegistry {
+	registry := &OAuthProviderRegistry{providers: make(map[string]OAuthProvider)}
+	client := TracedHTTPClient(10 * time.Second)
+	for _, config := range builtinOAuthProviders {
+		registry.Register(NewOAuthProvider(config, client))
+	}
+
+	if path := os.Getenv("OAUTH_PROVIDERS_FILE"); path != "" {
+		configs, err := LoadOAuthProviderConfigs(path)
+		if err != nil {
+			log.Printf("⚠️ Failed to load OAuth providers from %s: %v", path, err)
+			return registry
+		}
+		for _, config := range configs {
+			registry.Register(NewOAuthProvider(config, client))
+		}
+	}
+	return registry
+}
+
+// LoadOAuthProviderConfigs reads and validates a JSON list of provider configurations
+func LoadOAuthProviderConfigs(path string) ([]OAuthProviderConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth providers: %w", err)
+	}
+	var configs []OAuthProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse OAuth providers: %w", err)
+	}
+	for _, config := range configs {
+		if err := config.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
+
+// Register adds a provider, replacing one of the same name, and makes its client secret
+// rotatable
+func (r *OAuthProviderRegistry) Register(provider OAuthProvider) {
+	config := provider.Config()
+	r.mu.Lock()
+	r.providers[config.Name] = provider
+	r.mu.Unlock()
+	registerOAuthClient(config.Name, config.Client())
+}
+
+// Get returns a provider by name
+func (r *OAuthProviderRegistry) Get(name string) (OAuthProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Providers returns every provider, by name
+func (r *OAuthProviderRegistry) Providers() []OAuthProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	providers := make([]OAuthProvider, 0, len(r.providers))
+	for _, provider := range r.providers {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Config().Name < providers[j].Config().Name })
+	return providers
+}
+
+// configuredOAuthProvider implements OAuthProvider from its configuration alone
+type configuredOAuthProvider struct {
+	config OAuthProviderConfig
+	client *http.Client
+}
+
+// NewOAuthProvider creates a provider that follows its configuration
+func NewOAuthProvider(config OAuthProviderConfig, client *http.Client) OAuthProvider {
+	return &configuredOAuthProvider{config: config, client: client}
+}
+
+func (p *configuredOAuthProvider) Config() OAuthProviderConfig {
+	return p.config
+}
+
+// AuthURL returns the provider URL the user is sent to for consent. A code challenge is
+// sent with the S256 method.
+func (p *configuredOAuthProvider) AuthURL(redirectURI, state, nonce, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("client_id", getEnv(p.config.ClientIDEnv, ""))
+	query.Set("redirect_uri", redirectURI)
+	query.Set("response_type", "code")
+	query.Set("state", state)
+	if p.config.Scope != "" {
+		query.Set("scope", p.config.Scope)
+	}
+	if nonce != "" {
+		query.Set("nonce", nonce)
+	}
+	if codeChallenge != "" {
+		query.Set("code_challenge", codeChallenge)
+		query.Set("code_challenge_method", "S256")
+	}
+	for key, value := range p.config.AuthParams {
+		query.Set(key, value)
+	}
+	return p.config.AuthURL + "?" + query.Encode()
+}
+
+// Exchange trades an authorization code for tokens, proving with the code verifier that
+// this is the client that started the flow
+func (p *configuredOAuthProvider) Exchange(ctx context.Context, code, redirectURI, codeVerifier, clientSecret string) (*OAuthToken, error) {
+	clientID := getEnv(p.config.ClientIDEnv, "")
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+	if !p.config.BasicAuth {
+		data.Set("client_id", clientID)
+		data.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.BasicAuth {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(clientID+":"+clientSecret)))
+	}
+
+	raw, err := p.do(req, "token exchange failed")
+	if err != nil {
+		return nil, err
+	}
+	token := &OAuthToken{
+		AccessToken:  stringAt(raw, "access_token"),
+		RefreshToken: stringAt(raw, "refresh_token"),
+		TokenType:    stringAt(raw, "token_type"),
+		Scope:        stringAt(raw, "scope"),
+		IDToken:      stringAt(raw, "id_token"),
+		Raw:          raw,
+	}
+	if expiresIn, ok := raw["expires_in"].(float64); ok {
+		token.ExpiresIn = int(expiresIn)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange failed: no access token in response")
+	}
+	return token, nil
+}
+
+// FetchUserInfo reads the account the token was issued for
+func (p *configuredOAuthProvider) FetchUserInfo(ctx context.Context, token *OAuthToken) (*OAuthUserInfo, error) {
+	userInfoURL := p.config.UserInfoURL
+	for key, value := range token.Raw {
+		if text, ok := value.(string); ok {
+			userInfoURL = strings.ReplaceAll(userInfoURL, "{"+key+"}", text)
+		}
+	}
+	method := p.config.UserInfoMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	for key, value := range p.config.UserInfoHeaders {
+		req.Header.Set(key, value)
+	}
+
+	raw, err := p.do(req, "failed to get user info")
+	if err != nil {
+		return nil, err
+	}
+	userInfo := &OAuthUserInfo{
+		Name:     stringAt(raw, p.config.NameField),
+		Username: stringAt(raw, p.config.UsernameField),
+		Raw:      raw,
+	}
+	for _, field := range p.config.EmailFields {
+		if userInfo.Email = stringAt(raw, field); userInfo.Email != "" {
+			break
+		}
+	}
+	return userInfo, nil
+}
+
+// StoreTokens saves the tokens on the user's app connection
+func (p *configuredOAuthProvider) StoreTokens(userID string, token *OAuthToken, userInfo *OAuthUserInfo) error {
+	now := time.Now()
+	connection := map[string]interface{}{
+		"status":       models.ConnectionConnected,
+		"access_token": token.AccessToken,
+		"token_type":   token.TokenType,
+		"user_email":   userInfo.Email,
+		"user_name":    userInfo.Name,
+		"connected_at": now.UTC().Format(time.RFC3339),
+	}
+	if token.RefreshToken != "" {
+		connection["refresh_token"] = token.RefreshToken
+	}
+	if token.Scope != "" {
+		connection["scope"] = token.Scope
+	}
+	if token.ExpiresIn > 0 {
+		connection["expires_at"] = now.Add(time.Duration(token.ExpiresIn) * time.Second).UTC().Format(time.RFC3339)
+	}
+	extras := make(map[string]string)
+	if userInfo.Username != "" {
+		extras["username"] = userInfo.Username
+	}
+	for key, path := range p.config.TokenExtras {
+		extras[key] = stringAt(token.Raw, path)
+	}
+	for key, path := range p.config.UserExtras {
+		extras[key] = stringAt(userInfo.Raw, path)
+	}
+	connection["extras"] = extras
+
+	if err := UpdateUserAppConnection(userID, p.config.AppID, connection); err != nil {
+		return fmt.Errorf("failed to update app connection: %w", err)
+	}
+
+	log.Printf("%s OAuth successful for user %s (email: %s)", p.config.Name, userID, userInfo.Email)
+	return nil
+}
+
+func (p *configuredOAuthProvider) do(req *http.Request, failure string) (map[string]interface{}, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", failure, string(body))
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// stringAt reads a dotted path such as user.profile.email, returning "" if it is absent
+func stringAt(raw map[string]interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	var value interface{} = raw
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+	text, _ := value.(string)
+	return text
+}
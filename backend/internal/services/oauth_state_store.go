@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidOAuthState is returned when a callback's state was not issued to the user for
+// the provider, has expired or was already used
+var ErrInvalidOAuthState = errors.New("invalid or reused OAuth state")
+
+// StateStore keeps the state parameters of OAuth authorization requests in the database,
+// so a callback is only accepted on any instance if the same user started it there, within
+// OAUTH_STATE_TTL, and only once
+type StateStore struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewStateStore creates a new OAuth state store
+func NewStateStore(db *gorm.DB) *StateStore {
+	return &StateStore{
+		db:  db,
+		ttl: envDuration("OAUTH_STATE_TTL", 10*time.Minute),
+	}
+}
+
+// TTL is how long a state, and anything waiting on its callback, is kept
+func (s *StateStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue creates a single-use state for an authorization request the user is starting
+func (s *StateStore) Issue(provider string, userID uuid.UUID, now time.Time) (string, error) {
+	state, err := randomStateValue()
+	if err != nil {
+		return "", err
+	}
+	if err := s.Bind(provider, state, userID, now); err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// IssuePKCE creates a single-use state along with a PKCE code verifier (RFC 7636), which
+// is kept with the state for the token exchange. The authorization request carries
+// PKCEChallenge(verifier).
+func (s *StateStore) IssuePKCE(provider string, userID uuid.UUID, now time.Time) (string, string, error) {
+	state, err := randomStateValue()
+	if err != nil {
+		return "", "", err
+	}
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(bytes)
+	entry := models.OAuthState{Value: state, Provider: provider, UserID: userID, CodeVerifier: verifier, ExpiresAt: now.Add(s.ttl)}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return "", "", fmt.Errorf("failed to store state: %w", err)
+	}
+	return state, verifier, nil
+}
+
+// PKCEChallenge returns the S256 code challenge for a code verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomStateValue() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// Bind stores a value the provider echoes back in place of a state, such as an OAuth 1.0a
+// request token
+func (s *StateStore) Bind(provider, state string, userID uuid.UUID, now time.Time) error {
+	entry := models.OAuthState{Value: state, Provider: provider, UserID: userID, ExpiresAt: now.Add(s.ttl)}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to store state: %w", err)
+	}
+	return nil
+}
+
+// Consume accepts a callback's state if it was issued to the user for the provider and
+// has not expired. The state is deleted either way, so it cannot be tried again.
+func (s *StateStore) Consume(provider, state string, userID uuid.UUID, now time.Time) error {
+	boundTo, err := s.Redeem(provider, state, now)
+	if err != nil {
+		return err
+	}
+	if boundTo != userID {
+		return fmt.Errorf("%w: issued to another user", ErrInvalidOAuthState)
+	}
+	return nil
+}
+
+// Redeem accepts a callback's state if it was issued for the provider and has not expired,
+// returning the user who started the flow. Callbacks arrive as redirects from the
+// provider, often without the user's sign-in token, so the state is what identifies them.
+// The state is deleted either way, so it cannot be tried again.
+func (s *StateStore) Redeem(provider, state string, now time.Time) (uuid.UUID, error) {
+	userID, _, err := s.RedeemPKCE(provider, state, now)
+	return userID, err
+}
+
+// RedeemPKCE is Redeem for a state issued by IssuePKCE, also returning its code verifier.
+// States issued without one return an empty verifier.
+func (s *StateStore) RedeemPKCE(provider, state string, now time.Time) (uuid.UUID, string, error) {
+	if state == "" {
+		return uuid.Nil, "", fmt.Errorf("%w: missing state", ErrInvalidOAuthState)
+	}
+	var entry models.OAuthState
+	if err := s.db.Where("value = ?", state).First(&entry).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return uuid.Nil, "", ErrInvalidOAuthState
+		}
+		return uuid.Nil, "", fmt.Errorf("failed to check state: %w", err)
+	}
+
+	// Only one callback can win the delete, so a state is never consumed twice
+	result := s.db.Where("value = ?", state).Delete(&models.OAuthState{})
+	if result.Error != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to consume state: %w", result.Error)
+	}
+	switch {
+	case result.RowsAffected == 0:
+		return uuid.Nil, "", ErrInvalidOAuthState
+	case entry.Provider != provider:
+		return uuid.Nil, "", fmt.Errorf("%w: issued for %s", ErrInvalidOAuthState, entry.Provider)
+	case !now.Before(entry.ExpiresAt):
+		return uuid.Nil, "", fmt.Errorf("%w: expired at %s", ErrInvalidOAuthState, entry.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return entry.UserID, entry.CodeVerifier, nil
+}
+
+// DemoUserFallback reports whether sign-in callbacks that carry no state, such as
+// IdP-initiated SAML responses, are stored for the demo user. OAUTH_DEMO_USER_FALLBACK=true
+// turns it on for development; it is never on in production.
+func DemoUserFallback() bool {
+	return !isProduction() && getEnv("OAUTH_DEMO_USER_FALLBACK", "false") == "true"
+}
+
+// PurgeExpired deletes states whose authorization requests were never completed
+func (s *StateStore) PurgeExpired(now time.Time) error {
+	if err := s.db.Where("expires_at <= ?", now).Delete(&models.OAuthState{}).Error; err != nil {
+		return fmt.Errorf("failed to purge OAuth states: %w", err)
+	}
+	return nil
+}
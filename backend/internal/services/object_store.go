@@ -0,0 +1,451 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSignedURLTTL is the longest a V4 signed URL may be valid for, on GCS and S3 alike
+const maxSignedURLTTL = 7 * 24 * time.Hour
+
+// ErrInvalidSignedURL is returned for a local download URL that is expired or tampered with
+var ErrInvalidSignedURL = errors.New("invalid or expired download URL")
+
+// ObjectStore keeps uploaded files. Downloads never pass through the API process for
+// GCS; clients are handed a short-lived signed URL instead.
+type ObjectStore interface {
+	Put(ctx context.Context, key, contentType string, content []byte) error
+	// PutStream uploads size bytes read from body, for objects too large to hold in memory
+	PutStream(ctx context.Context, key, contentType string, body io.Reader, size int64) error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the object as filename until now+ttl
+	SignedURL(key, filename string, ttl time.Duration, now time.Time) (string, error)
+}
+
+// NewObjectStoreFromEnv returns a GCS store when GCS_BUCKET is set, an S3 store when
+// S3_BUCKET is, and otherwise a directory on local disk for development
+func NewObjectStoreFromEnv() ObjectStore {
+	if bucket := getEnv("GCS_BUCKET", ""); bucket != "" {
+		return newGCSObjectStoreFromEnv(bucket)
+	}
+	if bucket := getEnv("S3_BUCKET", ""); bucket != "" {
+		return newS3ObjectStoreFromEnv(bucket)
+	}
+	return NewLocalObjectStore(getEnv("UPLOAD_LOCAL_DIR", "uploads"), getEnv("BACKEND_URL", "http://localhost:8081")+"/files")
+}
+
+func newGCSObjectStoreFromEnv(bucket string) *GCSObjectStore {
+	return NewGCSObjectStore(bucket, getEnv("GCS_HMAC_ACCESS_ID", ""), getEnv("GCS_HMAC_SECRET", ""), getEnv("GCS_ENDPOINT", "https://storage.googleapis.com"))
+}
+
+func newS3ObjectStoreFromEnv(bucket string) *S3ObjectStore {
+	store := NewS3ObjectStore(bucket, getEnv("S3_REGION", "us-east-1"), getEnv("S3_ACCESS_KEY_ID", ""), getEnv("S3_SECRET_ACCESS_KEY", ""), getEnv("S3_ENDPOINT", ""))
+	store.SessionToken = getEnv("S3_SESSION_TOKEN", "")
+	return store
+}
+
+// GCSObjectStore stores objects in a Google Cloud Storage bucket through the XML API.
+// Every request, including the server's own uploads and deletes, is a V4 signed URL
+// made with an HMAC key for a service account that has objectAdmin on the bucket, so no
+// Google client library or private key is needed.
+type GCSObjectStore struct {
+	Bucket   string
+	AccessID string
+	Secret   string
+	Endpoint string // https://storage.googleapis.com, or an emulator
+	client   *http.Client
+}
+
+// NewGCSObjectStore creates a store for bucket, signing with the HMAC key accessID/secret
+func NewGCSObjectStore(bucket, accessID, secret, endpoint string) *GCSObjectStore {
+	return &GCSObjectStore{
+		Bucket:   bucket,
+		AccessID: accessID,
+		Secret:   secret,
+		Endpoint: endpoint,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Put uploads an object, replacing any existing object with the same key
+func (s *GCSObjectStore) Put(ctx context.Context, key, contentType string, content []byte) error {
+	return s.PutStream(ctx, key, contentType, bytes.NewReader(content), int64(len(content)))
+}
+
+// PutStream uploads an object from body, replacing any existing object with the same key
+func (s *GCSObjectStore) PutStream(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	signed, err := s.sign(http.MethodPut, key, nil, 15*time.Minute, time.Now())
+	if err != nil {
+		return err
+	}
+	return doObjectRequest(ctx, s.client, "GCS", http.MethodPut, signed, key, contentType, body, size)
+}
+
+// Delete removes an object; a missing object is not an error
+func (s *GCSObjectStore) Delete(ctx context.Context, key string) error {
+	signed, err := s.sign(http.MethodDelete, key, nil, 15*time.Minute, time.Now())
+	if err != nil {
+		return err
+	}
+	return doObjectRequest(ctx, s.client, "GCS", http.MethodDelete, signed, key, "", http.NoBody, 0)
+}
+
+// SignedURL returns a GET URL for the object, served as an attachment named filename
+func (s *GCSObjectStore) SignedURL(key, filename string, ttl time.Duration, now time.Time) (string, error) {
+	return s.sign(http.MethodGet, key, url.Values{
+		"response-content-disposition": {contentDisposition(filename)},
+	}, ttl, now)
+}
+
+// sign builds a GOOG4-HMAC-SHA256 signed URL
+// (https://cloud.google.com/storage/docs/access-control/signing-urls-manually)
+func (s *GCSObjectStore) sign(method, key string, extra url.Values, ttl time.Duration, now time.Time) (string, error) {
+	if s.AccessID == "" || s.Secret == "" {
+		return "", errors.New("GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET are required")
+	}
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid GCS endpoint: %w", err)
+	}
+	signer := v4Signer{
+		algorithm:   "GOOG4-HMAC-SHA256",
+		keyPrefix:   "GOOG4",
+		paramPrefix: "X-Goog-",
+		region:      "auto",
+		service:     "storage",
+		terminator:  "goog4_request",
+		accessID:    s.AccessID,
+		secret:      s.Secret,
+	}
+	return signer.presign(method, endpoint, "/"+s.Bucket+"/"+escapeObjectKey(key), extra, ttl, now), nil
+}
+
+// S3ObjectStore stores objects in an Amazon S3 bucket, or one on an S3-compatible service
+// such as MinIO or Cloudflare R2. As with GCS, every request is a presigned URL, here
+// signed with AWS Signature Version 4 using an access key, and buckets are addressed by
+// path so that any endpoint works.
+type S3ObjectStore struct {
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // for temporary credentials
+	Endpoint        string // https://s3.<region>.amazonaws.com unless set
+	client          *http.Client
+}
+
+// NewS3ObjectStore creates a store for bucket in region, signing with the access key
+// accessKeyID/secretAccessKey; an empty endpoint is the regional AWS endpoint
+func NewS3ObjectStore(bucket, region, accessKeyID, secretAccessKey, endpoint string) *S3ObjectStore {
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return &S3ObjectStore{
+		Bucket:          bucket,
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Endpoint:        endpoint,
+		client:          &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Put uploads an object, replacing any existing object with the same key
+func (s *S3ObjectStore) Put(ctx context.Context, key, contentType string, content []byte) error {
+	return s.PutStream(ctx, key, contentType, bytes.NewReader(content), int64(len(content)))
+}
+
+// PutStream uploads an object from body in a single PUT, which S3 accepts up to 5 GB
+func (s *S3ObjectStore) PutStream(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	signed, err := s.sign(http.MethodPut, key, nil, 15*time.Minute, time.Now())
+	if err != nil {
+		return err
+	}
+	return doObjectRequest(ctx, s.client, "S3", http.MethodPut, signed, key, contentType, body, size)
+}
+
+// Delete removes an object; a missing object is not an error
+func (s *S3ObjectStore) Delete(ctx context.Context, key string) error {
+	signed, err := s.sign(http.MethodDelete, key, nil, 15*time.Minute, time.Now())
+	if err != nil {
+		return err
+	}
+	return doObjectRequest(ctx, s.client, "S3", http.MethodDelete, signed, key, "", http.NoBody, 0)
+}
+
+// SignedURL returns a GET URL for the object, served as an attachment named filename
+func (s *S3ObjectStore) SignedURL(key, filename string, ttl time.Duration, now time.Time) (string, error) {
+	return s.sign(http.MethodGet, key, url.Values{
+		"response-content-disposition": {contentDisposition(filename)},
+	}, ttl, now)
+}
+
+// sign builds an AWS4-HMAC-SHA256 presigned URL
+// (https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html)
+func (s *S3ObjectStore) sign(method, key string, extra url.Values, ttl time.Duration, now time.Time) (string, error) {
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return "", errors.New("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	query := url.Values{}
+	for name, values := range extra {
+		query[name] = values
+	}
+	if s.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	signer := v4Signer{
+		algorithm:   "AWS4-HMAC-SHA256",
+		keyPrefix:   "AWS4",
+		paramPrefix: "X-Amz-",
+		region:      s.Region,
+		service:     "s3",
+		terminator:  "aws4_request",
+		accessID:    s.AccessKeyID,
+		secret:      s.SecretAccessKey,
+	}
+	return signer.presign(method, endpoint, "/"+s.Bucket+"/"+escapeObjectKey(key), query, ttl, now), nil
+}
+
+// doObjectRequest sends a presigned upload or delete to a bucket service
+func doObjectRequest(ctx context.Context, client *http.Client, service, method, signed, key, contentType string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, method, signed, body)
+	if err != nil {
+		return err
+	}
+	// Presigned uploads must not be chunked, so the length is always sent
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s %s returned %d: %s", service, method, key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// v4Signer presigns URLs with the V4 query string scheme that GCS adopted from S3; the two
+// differ only in the names of the algorithm, parameters and credential scope
+type v4Signer struct {
+	algorithm   string // GOOG4-HMAC-SHA256 or AWS4-HMAC-SHA256
+	keyPrefix   string // prepended to the secret to derive the signing key
+	paramPrefix string // X-Goog- or X-Amz-
+	region      string
+	service     string
+	terminator  string
+	accessID    string
+	secret      string
+}
+
+// presign signs method on path at endpoint with the host header only and an unsigned
+// payload, valid for ttl capped at seven days
+func (v v4Signer) presign(method string, endpoint *url.URL, path string, extra url.Values, ttl time.Duration, now time.Time) string {
+	if ttl > maxSignedURLTTL {
+		ttl = maxSignedURLTTL
+	}
+	now = now.UTC()
+	datestamp := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	scope := strings.Join([]string{datestamp, v.region, v.service, v.terminator}, "/")
+
+	query := url.Values{}
+	for name, values := range extra {
+		query[name] = values
+	}
+	query.Set(v.paramPrefix+"Algorithm", v.algorithm)
+	query.Set(v.paramPrefix+"Credential", v.accessID+"/"+scope)
+	query.Set(v.paramPrefix+"Date", timestamp)
+	query.Set(v.paramPrefix+"Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set(v.paramPrefix+"SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		"host:" + endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{v.algorithm, timestamp, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	signingKey := []byte(v.keyPrefix + v.secret)
+	for _, part := range []string{datestamp, v.region, v.service, v.terminator} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&%sSignature=%s", endpoint.Scheme, endpoint.Host, path, canonicalQuery, v.paramPrefix, signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQueryString sorts and RFC 3986 encodes query parameters
+func canonicalQueryString(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, rfc3986Escape(name)+"="+rfc3986Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func rfc3986Escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func escapeObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = rfc3986Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func contentDisposition(filename string) string {
+	return fmt.Sprintf("attachment; filename=%q", strings.ReplaceAll(filename, `"`, ""))
+}
+
+// LocalObjectStore keeps objects in a directory for development. Its signed URLs point
+// back at CloudGate, which checks the HMAC signature before serving the file.
+type LocalObjectStore struct {
+	dir     string
+	baseURL string
+	key     []byte
+}
+
+// NewLocalObjectStore creates a store under dir whose download URLs start with baseURL
+func NewLocalObjectStore(dir, baseURL string) *LocalObjectStore {
+	return &LocalObjectStore{dir: dir, baseURL: baseURL, key: credentialKey("upload-url", "UPLOAD_URL_SIGNING_KEY")}
+}
+
+func (s *LocalObjectStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if cleaned == "." || filepath.IsAbs(cleaned) || strings.HasPrefix(cleaned, "..") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.dir, cleaned), nil
+}
+
+// Put writes an object to disk
+func (s *LocalObjectStore) Put(ctx context.Context, key, contentType string, content []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write upload: %w", err)
+	}
+	return nil
+}
+
+// PutStream writes an object to disk from body
+func (s *LocalObjectStore) PutStream(ctx context.Context, key, contentType string, body io.Reader, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write upload: %w", err)
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write upload: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write upload: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an object from disk; a missing object is not an error
+func (s *LocalObjectStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+// SignedURL returns a CloudGate download URL signed for the object, filename and expiry
+func (s *LocalObjectStore) SignedURL(key, filename string, ttl time.Duration, now time.Time) (string, error) {
+	expires := strconv.FormatInt(now.Add(ttl).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("filename", filename)
+	query.Set("signature", s.signature(key, filename, expires))
+	return s.baseURL + "/" + escapeObjectKey(key) + "?" + query.Encode(), nil
+}
+
+// Open checks a signed download URL's parameters and opens the object
+func (s *LocalObjectStore) Open(key, filename, expires, signature string, now time.Time) (*os.File, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return nil, ErrInvalidSignedURL
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, filename, expires))) {
+		return nil, ErrInvalidSignedURL
+	}
+	path, err := s.path(key)
+	if err != nil {
+		return nil, ErrInvalidSignedURL
+	}
+	return os.Open(path)
+}
+
+func (s *LocalObjectStore) signature(key, filename, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(key + "\n" + filename + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,811 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Scopes an OIDC client may request
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeEmail   = "email"
+	OIDCScopeProfile = "profile"
+)
+
+var oidcScopes = []string{OIDCScopeOpenID, OIDCScopeEmail, OIDCScopeProfile}
+
+// Scopes of CloudGate's own API a client may be granted, so third-party tools can call it
+// on a user's behalf with no more access than they need
+const (
+	APIScopeAlertsRead        = "alerts:read"
+	APIScopeAlertsWrite       = "alerts:write"
+	APIScopeIncidentsRead     = "incidents:read"
+	APIScopeIncidentsWrite    = "incidents:write"
+	APIScopeAuditRead         = "audit:read"
+	APIScopeConnectionsManage = "connections:manage"
+)
+
+var apiScopes = []string{APIScopeAlertsRead, APIScopeAlertsWrite, APIScopeIncidentsRead, APIScopeIncidentsWrite, APIScopeAuditRead, APIScopeConnectionsManage}
+
+// APIScopeDescriptions is what each API scope lets a client do, as shown on the consent
+// screen and in the OpenAPI document
+var APIScopeDescriptions = map[string]string{
+	APIScopeAlertsRead:        "Read security alerts",
+	APIScopeAlertsWrite:       "Raise security alerts and change their status",
+	APIScopeIncidentsRead:     "Read incidents and investigation cases",
+	APIScopeIncidentsWrite:    "Open and update investigation cases",
+	APIScopeAuditRead:         "Read and export the audit log",
+	APIScopeConnectionsManage: "View, test and report on connected applications",
+}
+
+// APIScopesIn returns the API scopes in a space-separated scope value, never nil
+func APIScopesIn(scope string) []string {
+	scopes := []string{}
+	for _, name := range strings.Fields(scope) {
+		if slices.Contains(apiScopes, name) && !slices.Contains(scopes, name) {
+			scopes = append(scopes, name)
+		}
+	}
+	return scopes
+}
+
+// pkceValue matches an RFC 7636 code verifier, and the length of an S256 challenge
+var pkceValue = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+var (
+	ErrOIDCClientNotFound  = errors.New("OIDC client not found")
+	ErrInvalidOIDCClient   = errors.New("invalid OIDC client")
+	ErrInvalidOIDCRedirect = errors.New("redirect_uri is not registered for this client")
+)
+
+// OIDCError is an OAuth 2.0 error response (RFC 6749 section 5.2), returned to the client
+// as its error code and description
+type OIDCError struct {
+	Code        string
+	Description string
+}
+
+func (e *OIDCError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oidcError(code, description string) *OIDCError {
+	return &OIDCError{Code: code, Description: description}
+}
+
+// OIDCClientInput is the registration of an OIDC client
+type OIDCClientInput struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required"`
+	Public       bool     `json:"public"`
+	Scopes       []string `json:"scopes"` // defaults to the identity scopes; API scopes must be listed
+	RequiredAAL  int      `json:"required_aal" binding:"min=0,max=3"`
+}
+
+// OIDCAuthorizeRequest is an authorization request received at /oauth2/authorize
+type OIDCAuthorizeRequest struct {
+	ResponseType        string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OIDCSubject is the signed-in user an authorization code is issued for. AuthTime defaults
+// to when the session was last authenticated.
+type OIDCSubject struct {
+	UserID    uuid.UUID
+	SessionID *uuid.UUID
+	AAL       int
+	AuthTime  time.Time
+}
+
+// OIDCConsentRequiredError is returned by Authorize when a client asks for API scopes the
+// user has not yet agreed to give it
+type OIDCConsentRequiredError struct {
+	Client *models.OIDCClient
+	Scopes []string
+}
+
+func (e *OIDCConsentRequiredError) Error() string {
+	return "consent required for " + strings.Join(e.Scopes, " ")
+}
+
+// OIDCTokenRequest is a token request received at /oauth2/token
+type OIDCTokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+// OIDCTokenResponse is a successful token response
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// OIDCProviderService lets apps sign their users in with CloudGate over OpenID Connect,
+// using the authorization code flow with PKCE. ID tokens and access tokens are JWTs signed
+// with the managed signing keys, so clients verify them against /.well-known/jwks.json.
+type OIDCProviderService struct {
+	db            *gorm.DB
+	keys          *SigningKeyService
+	consents      *ConsentService
+	issuer        string
+	codeLifetime  time.Duration
+	tokenLifetime time.Duration
+}
+
+// NewOIDCProviderService creates an OIDC provider configured from the environment
+func NewOIDCProviderService(db *gorm.DB) *OIDCProviderService {
+	return &OIDCProviderService{
+		db:            db,
+		issuer:        strings.TrimRight(getEnv("OIDC_ISSUER", getEnv("NEXT_PUBLIC_API_URL", "http://localhost:8081")), "/"),
+		codeLifetime:  envDuration("OIDC_CODE_LIFETIME", time.Minute),
+		tokenLifetime: envDuration("OIDC_TOKEN_LIFETIME", time.Hour),
+	}
+}
+
+// UseSigningKeys signs tokens with the managed signing keys
+func (s *OIDCProviderService) UseSigningKeys(keys *SigningKeyService) {
+	s.keys = keys
+}
+
+// UseConsents asks users to consent before a client is given API scopes on their behalf.
+// A consent covers the scopes granted so far; asking for another scope asks again.
+func (s *OIDCProviderService) UseConsents(consents *ConsentService) {
+	s.consents = consents
+}
+
+// Issuer returns the issuer identifier clients should expect in tokens
+func (s *OIDCProviderService) Issuer() string {
+	return s.issuer
+}
+
+// Discovery returns the provider metadata served at /.well-known/openid-configuration
+func (s *OIDCProviderService) Discovery() map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/oauth2/authorize",
+		"token_endpoint":                        s.issuer + "/oauth2/token",
+		"userinfo_endpoint":                     s.issuer + "/oauth2/userinfo",
+		"jwks_uri":                              s.issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      slices.Concat(oidcScopes, apiScopes),
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "acr", "sid",
+			"email", "email_verified", "name", "given_name", "family_name", "preferred_username", "picture"},
+		"authorization_response_iss_parameter_supported": true,
+	}
+}
+
+// CreateClient registers an OIDC client. The secret of a confidential client is only
+// returned here; afterwards only its hash is kept.
+func (s *OIDCProviderService) CreateClient(input OIDCClientInput, actor *uuid.UUID) (*models.OIDCClient, string, error) {
+	clientID, err := oidcRandom(16)
+	if err != nil {
+		return nil, "", err
+	}
+	client := models.OIDCClient{ClientID: "cg_" + clientID, Public: input.Public, CreatedBy: actor}
+	if err := applyOIDCClientInput(&client, input); err != nil {
+		return nil, "", err
+	}
+	secret := ""
+	if !client.Public {
+		if secret, err = oidcRandom(32); err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashOIDCSecret(secret)
+	}
+	client.UpdatedBy = actor
+	if err := s.db.Create(&client).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create OIDC client: %w", err)
+	}
+	s.audit(actor, "oidc_client_created", client.ClientID, fmt.Sprintf("name=%s public=%t redirect_uris=%s",
+		client.Name, client.Public, strings.ReplaceAll(client.RedirectURIs, "\n", " ")))
+	return &client, secret, nil
+}
+
+// UpdateClient replaces a client's registration. Whether it is public can't be changed.
+func (s *OIDCProviderService) UpdateClient(clientID string, input OIDCClientInput, actor *uuid.UUID) (*models.OIDCClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Public != client.Public {
+		return nil, fmt.Errorf("%w: a client can't switch between public and confidential", ErrInvalidOIDCClient)
+	}
+	if err := applyOIDCClientInput(client, input); err != nil {
+		return nil, err
+	}
+	client.UpdatedBy = actor
+	if err := s.db.Save(client).Error; err != nil {
+		return nil, fmt.Errorf("failed to save OIDC client: %w", err)
+	}
+	s.audit(actor, "oidc_client_updated", client.ClientID, fmt.Sprintf("name=%s redirect_uris=%s scopes=%s",
+		client.Name, strings.ReplaceAll(client.RedirectURIs, "\n", " "), client.Scopes))
+	return client, nil
+}
+
+// RotateSecret replaces a confidential client's secret; the old one stops working at once
+func (s *OIDCProviderService) RotateSecret(clientID string, actor *uuid.UUID) (string, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return "", err
+	}
+	if client.Public {
+		return "", fmt.Errorf("%w: public clients have no secret", ErrInvalidOIDCClient)
+	}
+	secret, err := oidcRandom(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Model(client).Updates(map[string]interface{}{"secret_hash": hashOIDCSecret(secret), "updated_by": actor}).Error; err != nil {
+		return "", fmt.Errorf("failed to rotate client secret: %w", err)
+	}
+	s.audit(actor, "oidc_client_secret_rotated", client.ClientID, "")
+	return secret, nil
+}
+
+// GetClient returns a registered client
+func (s *OIDCProviderService) GetClient(clientID string) (*models.OIDCClient, error) {
+	var client models.OIDCClient
+	result := s.db.Where("client_id = ?", clientID).Limit(1).Find(&client)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get OIDC client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOIDCClientNotFound
+	}
+	return &client, nil
+}
+
+// ListClients returns every registered client, by name
+func (s *OIDCProviderService) ListClients() ([]models.OIDCClient, error) {
+	var clients []models.OIDCClient
+	if err := s.db.Order("name ASC").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("failed to list OIDC clients: %w", err)
+	}
+	return clients, nil
+}
+
+// DeleteClient removes a client. Its unexchanged codes and issued access tokens stop working.
+func (s *OIDCProviderService) DeleteClient(clientID string, actor *uuid.UUID) error {
+	result := s.db.Where("client_id = ?", clientID).Delete(&models.OIDCClient{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete OIDC client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrOIDCClientNotFound
+	}
+	if err := s.db.Where("client_id = ?", clientID).Delete(&models.OIDCAuthorizationCode{}).Error; err != nil {
+		log.Printf("Failed to delete authorization codes of OIDC client %s: %v", clientID, err)
+	}
+	s.audit(actor, "oidc_client_deleted", clientID, "")
+	return nil
+}
+
+// AuthorizeClient finds the client of an authorization request and checks its redirect URI.
+// Errors here must be shown to the user rather than sent to the redirect URI.
+func (s *OIDCProviderService) AuthorizeClient(clientID, redirectURI string) (*models.OIDCClient, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(strings.Split(client.RedirectURIs, "\n"), redirectURI) {
+		return nil, ErrInvalidOIDCRedirect
+	}
+	return client, nil
+}
+
+// Authorize answers an authorization request from a client checked by AuthorizeClient,
+// returning where to send the browser: the redirect URI with a code, or with an error.
+func (s *OIDCProviderService) Authorize(client *models.OIDCClient, request OIDCAuthorizeRequest, subject OIDCSubject, now time.Time) (string, error) {
+	code, err := s.issueCode(client, request, subject, now)
+	var protocolErr *OIDCError
+	if errors.As(err, &protocolErr) {
+		return oidcRedirect(request.RedirectURI, map[string]string{
+			"error":             protocolErr.Code,
+			"error_description": protocolErr.Description,
+			"state":             request.State,
+			"iss":               s.issuer,
+		}), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return oidcRedirect(request.RedirectURI, map[string]string{"code": code, "state": request.State, "iss": s.issuer}), nil
+}
+
+func (s *OIDCProviderService) issueCode(client *models.OIDCClient, request OIDCAuthorizeRequest, subject OIDCSubject, now time.Time) (string, error) {
+	if request.ResponseType != "code" {
+		return "", oidcError("unsupported_response_type", "only the authorization code flow is supported")
+	}
+	scopes := strings.Fields(request.Scope)
+	if !slices.Contains(scopes, OIDCScopeOpenID) {
+		return "", oidcError("invalid_scope", "the openid scope is required")
+	}
+	allowed := strings.Fields(client.Scopes)
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return "", oidcError("invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+	}
+	if requested := APIScopesIn(request.Scope); len(requested) > 0 && s.consents != nil {
+		consented, err := s.ConsentedScopes(subject.UserID, client.ClientID)
+		if err != nil {
+			return "", err
+		}
+		missing := slices.DeleteFunc(requested, func(scope string) bool { return slices.Contains(consented, scope) })
+		if len(missing) > 0 {
+			return "", &OIDCConsentRequiredError{Client: client, Scopes: missing}
+		}
+	}
+	if request.CodeChallenge == "" {
+		if client.Public {
+			return "", oidcError("invalid_request", "public clients must send a PKCE code_challenge")
+		}
+	} else if request.CodeChallengeMethod != "S256" {
+		return "", oidcError("invalid_request", "code_challenge_method must be S256")
+	} else if !pkceValue.MatchString(request.CodeChallenge) {
+		return "", oidcError("invalid_request", "code_challenge is malformed")
+	}
+
+	if subject.AuthTime.IsZero() {
+		subject.AuthTime = s.sessionAuthTime(subject.SessionID, now)
+	}
+	code, err := oidcRandom(32)
+	if err != nil {
+		return "", err
+	}
+	record := models.OIDCAuthorizationCode{
+		CodeHash:      hashOIDCSecret(code),
+		ClientID:      client.ClientID,
+		UserID:        subject.UserID,
+		SessionID:     subject.SessionID,
+		RedirectURI:   request.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AAL:           subject.AAL,
+		AuthTime:      subject.AuthTime,
+		ExpiresAt:     now.Add(s.codeLifetime),
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+	// Codes live for a minute; clearing old ones here keeps the table small
+	if err := s.db.Where("expires_at < ?", now.Add(-time.Hour)).Delete(&models.OIDCAuthorizationCode{}).Error; err != nil {
+		log.Printf("Failed to purge expired authorization codes: %v", err)
+	}
+	return code, nil
+}
+
+// Exchange redeems an authorization code for an ID token and access token. Every failure
+// is an *OIDCError to return to the client.
+func (s *OIDCProviderService) Exchange(request OIDCTokenRequest, now time.Time) (*OIDCTokenResponse, error) {
+	if request.GrantType != "authorization_code" {
+		return nil, oidcError("unsupported_grant_type", "only authorization_code is supported")
+	}
+	client, err := s.GetClient(request.ClientID)
+	if err != nil {
+		if errors.Is(err, ErrOIDCClientNotFound) {
+			return nil, oidcError("invalid_client", "unknown client")
+		}
+		return nil, err
+	}
+	if client.Public {
+		if request.ClientSecret != "" {
+			return nil, oidcError("invalid_client", "public clients have no secret")
+		}
+	} else if subtle.ConstantTimeCompare([]byte(hashOIDCSecret(request.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, oidcError("invalid_client", "client authentication failed")
+	}
+
+	var code models.OIDCAuthorizationCode
+	result := s.db.Where("code_hash = ? AND client_id = ?", hashOIDCSecret(request.Code), client.ClientID).Limit(1).Find(&code)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find authorization code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || !now.Before(code.ExpiresAt) {
+		return nil, oidcError("invalid_grant", "the code is invalid or expired")
+	}
+	// Marking the code used in the same statement that checks it stops two exchanges racing
+	used := s.db.Model(&models.OIDCAuthorizationCode{}).Where("id = ? AND used_at IS NULL", code.ID).Update("used_at", now)
+	if used.Error != nil {
+		return nil, fmt.Errorf("failed to redeem authorization code: %w", used.Error)
+	}
+	if used.RowsAffected == 0 {
+		s.audit(&code.UserID, "oidc_code_replayed", client.ClientID, "An authorization code was presented twice")
+		return nil, oidcError("invalid_grant", "the code was already used")
+	}
+	if request.RedirectURI != code.RedirectURI {
+		return nil, oidcError("invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if code.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(request.CodeVerifier))
+		if !pkceValue.MatchString(request.CodeVerifier) ||
+			subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(code.CodeChallenge)) != 1 {
+			return nil, oidcError("invalid_grant", "code_verifier does not match the code_challenge")
+		}
+	} else if request.CodeVerifier != "" {
+		return nil, oidcError("invalid_grant", "no code_challenge was sent with the authorization request")
+	}
+
+	user, err := s.activeUser(code.UserID, now)
+	if err != nil {
+		return nil, oidcError("invalid_grant", err.Error())
+	}
+	response, err := s.issueTokens(client, &code, user, now)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(&user.ID, "oidc_sign_in", client.ClientID, "Tokens issued to "+client.Name)
+	return response, nil
+}
+
+func (s *OIDCProviderService) issueTokens(client *models.OIDCClient, code *models.OIDCAuthorizationCode, user *models.User, now time.Time) (*OIDCTokenResponse, error) {
+	if s.keys == nil {
+		return nil, errors.New("OIDC signing key is not available")
+	}
+	privateKey, _, kid, err := s.keys.ActiveKey()
+	if err != nil {
+		return nil, err
+	}
+	expires := now.Add(s.tokenLifetime)
+
+	access := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":       s.issuer,
+		"sub":       user.ID.String(),
+		"aud":       client.ClientID,
+		"client_id": client.ClientID,
+		"scope":     code.Scope,
+		"auth_time": code.AuthTime.Unix(),
+		"acr":       oidcACR(code.AAL),
+		"iat":       now.Unix(),
+		"exp":       expires.Unix(),
+		"jti":       uuid.NewString(),
+	})
+	access.Header["kid"] = kid
+	access.Header["typ"] = "at+jwt"
+	accessToken, err := access.SignedString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	atHash := sha256.Sum256([]byte(accessToken))
+	claims := jwt.MapClaims{
+		"iss":       s.issuer,
+		"sub":       user.ID.String(),
+		"aud":       client.ClientID,
+		"azp":       client.ClientID,
+		"auth_time": code.AuthTime.Unix(),
+		"iat":       now.Unix(),
+		"exp":       expires.Unix(),
+		"acr":       oidcACR(code.AAL),
+		"at_hash":   base64.RawURLEncoding.EncodeToString(atHash[:len(atHash)/2]),
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	if code.SessionID != nil {
+		claims["sid"] = code.SessionID.String()
+	}
+	for name, value := range oidcUserClaims(user, code.Scope) {
+		claims[name] = value
+	}
+	id := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	id.Header["kid"] = kid
+	idToken, err := id.SignedString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ID token: %w", err)
+	}
+
+	return &OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokenLifetime.Seconds()),
+		IDToken:     idToken,
+		Scope:       code.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims an access token's scopes allow about its user. Every
+// failure is an invalid_token *OIDCError.
+func (s *OIDCProviderService) UserInfo(accessToken string, now time.Time) (map[string]interface{}, error) {
+	claims, user, err := s.verifyAccessToken(accessToken, now)
+	if err != nil {
+		return nil, err
+	}
+	scope, _ := claims["scope"].(string)
+	info := oidcUserClaims(user, scope)
+	info["sub"] = user.ID.String()
+	return info, nil
+}
+
+// VerifyToken checks an access token this provider issued, so clients can call CloudGate's
+// API with it. The caller is limited to the token's API scopes that the user still consents to.
+func (s *OIDCProviderService) VerifyToken(_ context.Context, accessToken string, now time.Time) (*models.TokenIdentity, error) {
+	claims, user, err := s.verifyAccessToken(accessToken, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+	scope, _ := claims["scope"].(string)
+	scopes := APIScopesIn(scope)
+	if len(scopes) > 0 && s.consents != nil {
+		clientID, _ := claims["client_id"].(string)
+		consented, err := s.ConsentedScopes(user.ID, clientID)
+		if err != nil {
+			return nil, err
+		}
+		scopes = slices.DeleteFunc(scopes, func(scope string) bool { return !slices.Contains(consented, scope) })
+	}
+	identity := &models.TokenIdentity{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Username: user.Username,
+		Scopes:   scopes,
+		AAL:      models.AAL1,
+	}
+	if acr, _ := claims["acr"].(string); acr == oidcACR(models.AAL2) {
+		identity.AAL = models.AAL2
+	}
+	if issuedAt, err := claims.GetIssuedAt(); err == nil && issuedAt != nil {
+		identity.IssuedAt = issuedAt.Time
+	}
+	return identity, nil
+}
+
+// verifyAccessToken checks an access token's signature and expiry, that its client is
+// still registered and that its user can still sign in. Every failure is an invalid_token *OIDCError.
+func (s *OIDCProviderService) verifyAccessToken(accessToken string, now time.Time) (jwt.MapClaims, *models.User, error) {
+	if s.keys == nil {
+		return nil, nil, errors.New("OIDC signing key is not available")
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Header["typ"] != "at+jwt" {
+			return nil, errors.New("not an access token")
+		}
+		kid, _ := t.Header["kid"].(string)
+		return s.keys.PublicKey(kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(s.issuer), jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil || !token.Valid {
+		return nil, nil, oidcError("invalid_token", "the access token is invalid or expired")
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	if _, err := s.GetClient(clientID); err != nil {
+		return nil, nil, oidcError("invalid_token", "the client is no longer registered")
+	}
+	subject, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		return nil, nil, oidcError("invalid_token", "the access token has no subject")
+	}
+	user, err := s.activeUser(userID, now)
+	if err != nil {
+		return nil, nil, oidcError("invalid_token", err.Error())
+	}
+	return claims, user, nil
+}
+
+// ConsentedScopes returns the API scopes the user has consented to give a client
+func (s *OIDCProviderService) ConsentedScopes(userID uuid.UUID, clientID string) ([]string, error) {
+	consent, err := s.consents.GetActiveConsent(userID, oidcConsentAppID(clientID))
+	if errors.Is(err, ErrConsentNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	if err := json.Unmarshal([]byte(consent.DataCategories), &scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode consented scopes: %w", err)
+	}
+	return scopes, nil
+}
+
+// ConsentToScopes records that the user agreed to give a client the API scopes, on top of
+// those they consented to before
+func (s *OIDCProviderService) ConsentToScopes(userID uuid.UUID, clientID string, scopes []string, ipAddress, userAgent string) error {
+	if s.consents == nil {
+		return nil
+	}
+	consented, err := s.ConsentedScopes(userID, clientID)
+	if err != nil {
+		return err
+	}
+	for _, scope := range APIScopesIn(strings.Join(scopes, " ")) {
+		if !slices.Contains(consented, scope) {
+			consented = append(consented, scope)
+		}
+	}
+	if _, err := s.consents.GrantConsent(userID, oidcConsentAppID(clientID), consented, ipAddress, userAgent); err != nil {
+		return err
+	}
+	s.audit(&userID, "oidc_scopes_consented", clientID, "API scopes: "+strings.Join(consented, " "))
+	return nil
+}
+
+// sessionAuthTime is when the user last signed in or stepped up in the session
+func (s *OIDCProviderService) sessionAuthTime(sessionID *uuid.UUID, now time.Time) time.Time {
+	if sessionID == nil {
+		return now
+	}
+	var session models.Session
+	if err := s.db.Select("authenticated_at, created_at").Where("id = ?", *sessionID).Limit(1).Find(&session).Error; err != nil {
+		return now
+	}
+	if session.AuthenticatedAt != nil {
+		return *session.AuthenticatedAt
+	}
+	if !session.CreatedAt.IsZero() {
+		return session.CreatedAt
+	}
+	return now
+}
+
+// activeUser returns the user tokens are issued for, unless they can no longer sign in
+func (s *OIDCProviderService) activeUser(userID uuid.UUID, now time.Time) (*models.User, error) {
+	var user models.User
+	result := s.db.Where("id = ?", userID).Limit(1).Find(&user)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, errors.New("the user no longer exists")
+	}
+	if !user.IsActive || user.IsLocked(now) {
+		return nil, errors.New("the user can no longer sign in")
+	}
+	return &user, nil
+}
+
+func (s *OIDCProviderService) audit(actor *uuid.UUID, action, clientID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "oidc_client",
+		ResourceID: clientID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit OIDC event: %v", err)
+	}
+}
+
+// applyOIDCClientInput validates a registration and copies it onto client
+func applyOIDCClientInput(client *models.OIDCClient, input OIDCClientInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidOIDCClient)
+	}
+	if len(input.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: at least one redirect URI is required", ErrInvalidOIDCClient)
+	}
+	redirects := make([]string, 0, len(input.RedirectURIs))
+	for _, raw := range input.RedirectURIs {
+		redirect, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || redirect.Host == "" || redirect.Fragment != "" || redirect.User != nil {
+			return fmt.Errorf("%w: %q must be an absolute URL without a fragment", ErrInvalidOIDCClient, raw)
+		}
+		// Plain http is only safe back to the user's own machine (RFC 8252)
+		loopback := redirect.Hostname() == "localhost" || net.ParseIP(redirect.Hostname()).IsLoopback()
+		if redirect.Scheme != "https" && !(redirect.Scheme == "http" && loopback) {
+			return fmt.Errorf("%w: %q must use https", ErrInvalidOIDCClient, raw)
+		}
+		redirects = append(redirects, redirect.String())
+	}
+	scopes := input.Scopes
+	if len(scopes) == 0 {
+		scopes = oidcScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(oidcScopes, scope) && !slices.Contains(apiScopes, scope) {
+			return fmt.Errorf("%w: unsupported scope %q", ErrInvalidOIDCClient, scope)
+		}
+	}
+	if !slices.Contains(scopes, OIDCScopeOpenID) {
+		scopes = append([]string{OIDCScopeOpenID}, scopes...)
+	}
+
+	client.Name = name
+	client.RedirectURIs = strings.Join(redirects, "\n")
+	client.Scopes = strings.Join(scopes, " ")
+	client.RequiredAAL = input.RequiredAAL
+	return nil
+}
+
+// oidcUserClaims returns the standard claims about a user that the scopes allow
+func oidcUserClaims(user *models.User, scope string) map[string]interface{} {
+	claims := make(map[string]interface{})
+	scopes := strings.Fields(scope)
+	if slices.Contains(scopes, OIDCScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if slices.Contains(scopes, OIDCScopeProfile) {
+		claims["name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims["given_name"] = user.FirstName
+		claims["family_name"] = user.LastName
+		claims["preferred_username"] = user.Username
+		if user.ProfilePictureURL != "" {
+			claims["picture"] = user.ProfilePictureURL
+		}
+	}
+	return claims
+}
+
+// oidcACR describes how strongly the session was authenticated, using the REFEDS profiles
+func oidcACR(aal int) string {
+	if aal >= models.AAL2 {
+		return "https://refeds.org/profile/mfa"
+	}
+	return "https://refeds.org/profile/sfa"
+}
+
+// oidcRedirect adds parameters to a redirect URI, keeping its own query
+func oidcRedirect(redirectURI string, params map[string]string) string {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := target.Query()
+	for name, value := range params {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// oidcConsentAppID is the app a client's API scope consents are recorded under
+func oidcConsentAppID(clientID string) string {
+	return "oidc:" + clientID
+}
+
+func oidcRandom(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashOIDCSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Deadlines for the work a request does on the way, so a slow database or provider fails
+// the operation rather than holding the request until the client gives up. DB_TIMEOUT bounds
+// each database operation and PROVIDER_TIMEOUT each call to a third-party API.
+var (
+	dbTimeout       = envDuration("DB_TIMEOUT", 5*time.Second)
+	providerTimeout = envDuration("PROVIDER_TIMEOUT", 10*time.Second)
+)
+
+// withDB binds db to ctx with the database deadline. Queries on the returned handle are
+// cancelled when the request is; call cancel once they are done.
+func withDB(ctx context.Context, db *gorm.DB) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	return db.WithContext(ctx), cancel
+}
+
+// withProvider gives a call to a third-party API the provider deadline
+func withProvider(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, providerTimeout)
+}
+
+// detached keeps ctx's values but not its cancellation, for writes such as audit records
+// that have to land even when the client hangs up mid-request
+func detached(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
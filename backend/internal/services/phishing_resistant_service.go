@@ -0,0 +1,309 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPhishingResistantPolicyNotFound is returned when a tenant group has no policy
+	ErrPhishingResistantPolicyNotFound = errors.New("phishing-resistant policy not found")
+	// ErrInvalidPhishingResistantPolicy is returned when a policy fails validation
+	ErrInvalidPhishingResistantPolicy = errors.New("invalid phishing-resistant policy")
+	// ErrPhishingResistantRequired is returned when an OTP step-up is refused because the
+	// user must use WebAuthn
+	ErrPhishingResistantRequired = errors.New("a phishing-resistant authenticator is required")
+)
+
+// Audit action for OTP step-ups allowed during a policy's grace period
+const phishingResistantGraceAction = "phishing_resistant_grace_step_up"
+
+// Enrollment statuses of a designated user
+const (
+	PhishingResistantEnrolled    = "enrolled"     // has a WebAuthn/passkey credential
+	PhishingResistantPending     = "pending"      // not enrolled, grace period still running
+	PhishingResistantOverdue     = "overdue"      // not enrolled, grace period over
+	PhishingResistantUnknownUser = "unknown_user" // designated email has no account
+)
+
+// PhishingResistantPolicyInput is the editable part of a policy
+type PhishingResistantPolicyInput struct {
+	Enabled         bool     `json:"enabled"`
+	GracePeriodDays int      `json:"grace_period_days"`
+	Members         []string `json:"members"`
+}
+
+// PhishingResistantRequirement describes the policy that covers a step-up
+type PhishingResistantRequirement struct {
+	Tenant       string    `json:"tenant"`
+	Group        string    `json:"group"`
+	EnforcedFrom time.Time `json:"enforced_from"`
+	InGrace      bool      `json:"in_grace"`
+}
+
+// PhishingResistantMemberStatus is a designated user's progress toward a phishing-resistant factor
+type PhishingResistantMemberStatus struct {
+	Email          string     `json:"email"`
+	UserID         *uuid.UUID `json:"user_id,omitempty"`
+	Status         string     `json:"status"`
+	EnrolledAt     *time.Time `json:"enrolled_at,omitempty"`
+	GraceStepUps   int64      `json:"grace_step_ups"` // OTP step-ups used since the policy was enabled
+	LastGraceUseAt *time.Time `json:"last_grace_use_at,omitempty"`
+}
+
+// PhishingResistantReport is the enrollment state of one policy's group
+type PhishingResistantReport struct {
+	Policy        models.PhishingResistantPolicy  `json:"policy"`
+	DaysRemaining int                             `json:"days_remaining"`
+	Enrolled      int                             `json:"enrolled"`
+	NotEnrolled   int                             `json:"not_enrolled"`
+	Members       []PhishingResistantMemberStatus `json:"members"`
+}
+
+// PhishingResistantService enforces WebAuthn-only step-ups for designated groups, such as
+// a tenant's admins, and reports on who still has to enroll. Only step-ups are affected:
+// RADIUS network logins, which cannot carry WebAuthn, keep their OTP challenge.
+type PhishingResistantService struct {
+	db *gorm.DB
+}
+
+// NewPhishingResistantService creates a new phishing-resistant enforcement service
+func NewPhishingResistantService(db *gorm.DB) *PhishingResistantService {
+	return &PhishingResistantService{db: db}
+}
+
+// SetPolicy creates or updates a tenant group's policy. The grace period starts when the
+// policy is enabled; changing it later moves the enforcement date accordingly.
+func (s *PhishingResistantService) SetPolicy(tenant, group string, input PhishingResistantPolicyInput, actor *uuid.UUID, now time.Time) (*models.PhishingResistantPolicy, error) {
+	tenant = strings.ToLower(strings.TrimSpace(tenant))
+	group = strings.ToLower(strings.TrimSpace(group))
+	if tenant == "" || group == "" {
+		return nil, fmt.Errorf("%w: tenant and group are required", ErrInvalidPhishingResistantPolicy)
+	}
+	if input.GracePeriodDays < 0 {
+		return nil, fmt.Errorf("%w: grace_period_days cannot be negative", ErrInvalidPhishingResistantPolicy)
+	}
+	members := make([]string, 0, len(input.Members))
+	for _, email := range input.Members {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if TenantForEmail(email) != tenant {
+			return nil, fmt.Errorf("%w: %q is not a %s address", ErrInvalidPhishingResistantPolicy, email, tenant)
+		}
+		if !slices.Contains(members, email) {
+			members = append(members, email)
+		}
+	}
+
+	var policy models.PhishingResistantPolicy
+	err := s.db.Where("tenant = ? AND group_name = ?", tenant, group).First(&policy).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get phishing-resistant policy: %w", err)
+	}
+
+	policy.Tenant = tenant
+	policy.Group = group
+	policy.Members = strings.Join(members, ",")
+	policy.GracePeriodDays = input.GracePeriodDays
+	policy.UpdatedBy = actor
+	switch {
+	case input.Enabled && policy.EnabledAt == nil:
+		policy.EnabledAt = &now
+	case !input.Enabled:
+		policy.EnabledAt = nil
+	}
+	policy.Enabled = input.Enabled
+	policy.EnforcedFrom = nil
+	if policy.EnabledAt != nil {
+		enforcedFrom := policy.EnabledAt.AddDate(0, 0, policy.GracePeriodDays)
+		policy.EnforcedFrom = &enforcedFrom
+	}
+
+	if err := s.db.Save(&policy).Error; err != nil {
+		return nil, fmt.Errorf("failed to save phishing-resistant policy: %w", err)
+	}
+
+	s.audit(actor, "phishing_resistant_policy_updated", tenant+"/"+group, "success", fmt.Sprintf("enabled=%t grace_period_days=%d members=%d",
+		policy.Enabled, policy.GracePeriodDays, len(members)))
+	recordConfigChange(ConfigKindPolicies, "phishing_resistant:"+tenant+"/"+group, actor, "Phishing-resistant policy updated", input)
+	return &policy, nil
+}
+
+// DeletePolicy removes a tenant group's policy
+func (s *PhishingResistantService) DeletePolicy(tenant, group string, actor *uuid.UUID) error {
+	tenant = strings.ToLower(tenant)
+	group = strings.ToLower(group)
+	result := s.db.Where("tenant = ? AND group_name = ?", tenant, group).Delete(&models.PhishingResistantPolicy{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete phishing-resistant policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPhishingResistantPolicyNotFound
+	}
+
+	s.audit(actor, "phishing_resistant_policy_deleted", tenant+"/"+group, "success", "Phishing-resistant policy removed")
+	recordConfigChange(ConfigKindPolicies, "phishing_resistant:"+tenant+"/"+group, actor, "Phishing-resistant policy removed", nil)
+	return nil
+}
+
+// restorePolicy puts a tenant group's policy, named tenant/group, back to a recorded version
+func (s *PhishingResistantService) restorePolicy(name string, snapshot []byte, actor *uuid.UUID) error {
+	var input PhishingResistantPolicyInput
+	if err := json.Unmarshal(snapshot, &input); err != nil {
+		return fmt.Errorf("invalid phishing-resistant policy snapshot: %w", err)
+	}
+	tenant, group, _ := strings.Cut(name, "/")
+	_, err := s.SetPolicy(tenant, group, input, actor, time.Now())
+	return err
+}
+
+// ListPolicies returns every policy, by tenant and group
+func (s *PhishingResistantService) ListPolicies() ([]models.PhishingResistantPolicy, error) {
+	var policies []models.PhishingResistantPolicy
+	if err := s.db.Order("tenant ASC, group_name ASC").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list phishing-resistant policies: %w", err)
+	}
+	return policies, nil
+}
+
+// CheckOTPStepUp decides whether a user may step up with an OTP. Users in no enabled
+// policy's group get nil. Within the grace period the step-up is allowed and tracked;
+// after it ErrPhishingResistantRequired is returned along with the requirement.
+func (s *PhishingResistantService) CheckOTPStepUp(userID uuid.UUID, email string, now time.Time) (*PhishingResistantRequirement, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	var policies []models.PhishingResistantPolicy
+	err := s.db.Where("tenant = ? AND enabled = ?", TenantForEmail(email), true).Order("enforced_from ASC").Find(&policies).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get phishing-resistant policies: %w", err)
+	}
+
+	// The strictest policy covering the user decides, which is the one enforced first
+	for _, policy := range policies {
+		if !slices.Contains(splitMembers(policy.Members), email) || policy.EnforcedFrom == nil {
+			continue
+		}
+		requirement := &PhishingResistantRequirement{
+			Tenant:       policy.Tenant,
+			Group:        policy.Group,
+			EnforcedFrom: *policy.EnforcedFrom,
+			InGrace:      now.Before(*policy.EnforcedFrom),
+		}
+		if !requirement.InGrace {
+			s.audit(&userID, "phishing_resistant_step_up_denied", policy.Tenant+"/"+policy.Group, "failure", "OTP step-up refused; WebAuthn required")
+			return requirement, ErrPhishingResistantRequired
+		}
+		s.audit(&userID, phishingResistantGraceAction, policy.Tenant+"/"+policy.Group, "success",
+			fmt.Sprintf("OTP step-up allowed during grace period ending %s", policy.EnforcedFrom.UTC().Format(time.RFC3339)))
+		return requirement, nil
+	}
+	return nil, nil
+}
+
+// Report lists the enrollment state of every enabled policy's members
+func (s *PhishingResistantService) Report(now time.Time) ([]PhishingResistantReport, error) {
+	var policies []models.PhishingResistantPolicy
+	if err := s.db.Where("enabled = ?", true).Order("tenant ASC, group_name ASC").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list phishing-resistant policies: %w", err)
+	}
+
+	reports := make([]PhishingResistantReport, 0, len(policies))
+	for _, policy := range policies {
+		report := PhishingResistantReport{Policy: policy, Members: []PhishingResistantMemberStatus{}}
+		inGrace := policy.EnforcedFrom != nil && now.Before(*policy.EnforcedFrom)
+		if inGrace {
+			// Round up, so the last partial day still counts as a day left
+			report.DaysRemaining = int((policy.EnforcedFrom.Sub(now) + 24*time.Hour - 1) / (24 * time.Hour))
+		}
+
+		for _, email := range splitMembers(policy.Members) {
+			status, err := s.memberStatus(&policy, email, inGrace)
+			if err != nil {
+				return nil, err
+			}
+			if status.Status == PhishingResistantEnrolled {
+				report.Enrolled++
+			} else {
+				report.NotEnrolled++
+			}
+			report.Members = append(report.Members, *status)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (s *PhishingResistantService) memberStatus(policy *models.PhishingResistantPolicy, email string, inGrace bool) (*PhishingResistantMemberStatus, error) {
+	status := &PhishingResistantMemberStatus{Email: email}
+
+	var user models.User
+	err := s.db.Where("LOWER(email) = ?", email).First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		status.Status = PhishingResistantUnknownUser
+		return status, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user %s: %w", email, err)
+	}
+	status.UserID = &user.ID
+
+	var credential WebAuthnCredential
+	err = s.db.Where("user_id = ?", user.ID).Order("created_at ASC").First(&credential).Error
+	switch {
+	case err == nil:
+		status.Status = PhishingResistantEnrolled
+		status.EnrolledAt = &credential.CreatedAt
+	case err != gorm.ErrRecordNotFound:
+		return nil, fmt.Errorf("failed to get WebAuthn credentials for %s: %w", email, err)
+	case inGrace:
+		status.Status = PhishingResistantPending
+	default:
+		status.Status = PhishingResistantOverdue
+	}
+
+	if policy.EnabledAt != nil {
+		graceUses := s.db.Model(&models.AuditLog{}).Where("user_id = ? AND action = ? AND resource_id = ? AND created_at >= ?",
+			user.ID, phishingResistantGraceAction, policy.Tenant+"/"+policy.Group, *policy.EnabledAt).Session(&gorm.Session{})
+		if err := graceUses.Count(&status.GraceStepUps).Error; err != nil {
+			return nil, fmt.Errorf("failed to count grace step-ups for %s: %w", email, err)
+		}
+		if status.GraceStepUps > 0 {
+			var last models.AuditLog
+			if err := graceUses.Order("created_at DESC").First(&last).Error; err != nil {
+				return nil, fmt.Errorf("failed to get last grace step-up for %s: %w", email, err)
+			}
+			status.LastGraceUseAt = &last.CreatedAt
+		}
+	}
+	return status, nil
+}
+
+// splitMembers parses a policy's comma-separated member list
+func splitMembers(members string) []string {
+	if members == "" {
+		return nil
+	}
+	return strings.Split(members, ",")
+}
+
+func (s *PhishingResistantService) audit(actor *uuid.UUID, action, resourceID, status, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "phishing_resistant_policy",
+		ResourceID: resourceID,
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit phishing-resistant policy event: %v", err)
+	}
+}
@@ -0,0 +1,736 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrPlaybookNotFound is returned when a playbook does not exist
+	ErrPlaybookNotFound = errors.New("playbook not found")
+	// ErrPlaybookExists is returned when another playbook already has the name
+	ErrPlaybookExists = errors.New("playbook already exists")
+	// ErrInvalidPlaybook is returned for a definition that cannot be run
+	ErrInvalidPlaybook = errors.New("invalid playbook")
+	// ErrPlaybookExecutionNotFound is returned when a playbook execution does not exist
+	ErrPlaybookExecutionNotFound = errors.New("playbook execution not found")
+	// ErrExecutionNotAwaitingApproval is returned when deciding on a run that is not paused at a gate
+	ErrExecutionNotAwaitingApproval = errors.New("playbook execution is not awaiting approval")
+)
+
+// Playbook step result statuses
+const (
+	StepExecuted = "executed"
+	StepFailed   = "failed"
+	StepSkipped  = "skipped"
+	StepApproved = "approved"
+	StepRejected = "rejected"
+)
+
+// PlaybookDefinition is a playbook as written by an administrator, in JSON or YAML
+type PlaybookDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Enabled     *bool           `json:"enabled,omitempty"` // defaults to true
+	Trigger     PlaybookTrigger `json:"trigger"`
+	Steps       []PlaybookStep  `json:"steps"`
+}
+
+// PlaybookTrigger selects the alerts a playbook runs for; empty lists match anything
+type PlaybookTrigger struct {
+	AlertTypes []AlertType     `json:"alert_types,omitempty"`
+	Severities []AlertSeverity `json:"severities,omitempty"`
+}
+
+// PlaybookStep is one step of a playbook: exactly one of an action, a set of parallel
+// branches, or a manual approval gate, optionally guarded by a condition on the alert
+type PlaybookStep struct {
+	Name            string                 `json:"name"`
+	Action          ActionType             `json:"action,omitempty"`
+	Parameters      map[string]interface{} `json:"parameters,omitempty"`
+	Parallel        []PlaybookStep         `json:"parallel,omitempty"`
+	Approval        bool                   `json:"approval,omitempty"`
+	Condition       *RuleCondition         `json:"condition,omitempty"`
+	ContinueOnError bool                   `json:"continue_on_error,omitempty"`
+}
+
+// StepResult records what happened to a step in a playbook execution
+type StepResult struct {
+	Name       string       `json:"name"`
+	Action     ActionType   `json:"action,omitempty"`
+	Status     string       `json:"status"`
+	Error      string       `json:"error,omitempty"`
+	DecidedBy  *uuid.UUID   `json:"decided_by,omitempty"`
+	Comment    string       `json:"comment,omitempty"`
+	Branches   []StepResult `json:"branches,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+}
+
+// PlaybookDetail is a stored playbook together with its parsed definition
+type PlaybookDetail struct {
+	models.Playbook
+	Definition PlaybookDefinition `json:"definition"`
+}
+
+// PlaybookRun is a playbook execution together with its step results
+type PlaybookRun struct {
+	models.PlaybookExecution
+	Steps []StepResult `json:"steps"`
+}
+
+var knownActionTypes = map[ActionType]bool{
+	ActionTypeBlockIP:          true,
+	ActionTypeLockAccount:      true,
+	ActionTypeForceLogout:      true,
+	ActionTypeRequireMFA:       true,
+	ActionTypeNotifyAdmin:      true,
+	ActionTypeQuarantineUser:   true,
+	ActionTypeResetPassword:    true,
+	ActionTypeDisableAccount:   true,
+	ActionTypeCreateTicket:     true,
+	ActionTypeEscalateIncident: true,
+}
+
+var conditionOperators = map[string]bool{
+	"eq": true, "neq": true, "in": true, "contains": true, "exists": true, "not_exists": true,
+	"gt": true, "gte": true, "lt": true, "lte": true,
+}
+
+// ParsePlaybookDefinition reads a definition from JSON or YAML and validates it.
+// Unknown fields are rejected so that a misspelt key does not silently drop a step.
+func ParsePlaybookDefinition(data []byte, isYAML bool) (*PlaybookDefinition, error) {
+	if isYAML {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPlaybook, err)
+		}
+		converted, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPlaybook, err)
+		}
+		data = converted
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var definition PlaybookDefinition
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlaybook, err)
+	}
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// Validate checks that every step can run
+func (d *PlaybookDefinition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPlaybook)
+	}
+	if len(d.Steps) == 0 {
+		return fmt.Errorf("%w: at least one step is required", ErrInvalidPlaybook)
+	}
+	for _, severity := range d.Trigger.Severities {
+		if !severity.Valid() {
+			return fmt.Errorf("%w: unknown severity %q", ErrInvalidPlaybook, severity)
+		}
+	}
+	for i, step := range d.Steps {
+		if err := validateStep(step, false); err != nil {
+			return fmt.Errorf("%w: step %d (%s): %v", ErrInvalidPlaybook, i+1, step.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateStep(step PlaybookStep, inParallel bool) error {
+	if strings.TrimSpace(step.Name) == "" {
+		return errors.New("name is required")
+	}
+	kinds := 0
+	if step.Action != "" {
+		kinds++
+	}
+	if len(step.Parallel) > 0 {
+		kinds++
+	}
+	if step.Approval {
+		kinds++
+	}
+	if kinds != 1 {
+		return errors.New("must have exactly one of action, parallel or approval")
+	}
+
+	switch {
+	case step.Action != "" && !knownActionTypes[step.Action]:
+		return fmt.Errorf("unknown action %q", step.Action)
+	case len(step.Parallel) > 0 && inParallel:
+		return errors.New("parallel branches cannot be nested")
+	case step.Approval && inParallel:
+		return errors.New("approval gates cannot run inside parallel branches")
+	}
+	for _, branch := range step.Parallel {
+		if err := validateStep(branch, true); err != nil {
+			return fmt.Errorf("branch %s: %v", branch.Name, err)
+		}
+	}
+
+	if step.Condition != nil && !conditionOperators[step.Condition.Operator] {
+		return fmt.Errorf("unknown condition operator %q", step.Condition.Operator)
+	}
+	return nil
+}
+
+// matches reports whether an alert triggers the playbook
+func (d *PlaybookDefinition) matches(alert SecurityAlert) bool {
+	if len(d.Trigger.AlertTypes) > 0 && !containsValue(d.Trigger.AlertTypes, alert.Type) {
+		return false
+	}
+	if len(d.Trigger.Severities) > 0 && !containsValue(d.Trigger.Severities, alert.Severity) {
+		return false
+	}
+	return true
+}
+
+func containsValue[T comparable](values []T, value T) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPlaybooks are the built-in severity responses, seeded when no playbooks exist
+func DefaultPlaybooks() []PlaybookDefinition {
+	userKnown := &RuleCondition{Field: "user_id", Operator: "exists"}
+	ipKnown := &RuleCondition{Field: "ip_address", Operator: "exists"}
+	return []PlaybookDefinition{
+		{
+			Name:        "critical-alert-response",
+			Description: "Contain the user and source IP, then notify administrators",
+			Trigger:     PlaybookTrigger{Severities: []AlertSeverity{SeverityCritical}},
+			Steps: []PlaybookStep{
+				{Name: "Contain", Parallel: []PlaybookStep{
+					{Name: "Force logout", Action: ActionTypeForceLogout, Condition: userKnown},
+					{Name: "Block IP", Action: ActionTypeBlockIP, Condition: ipKnown},
+				}},
+				{Name: "Notify administrators", Action: ActionTypeNotifyAdmin},
+			},
+		},
+		{
+			Name:        "high-alert-response",
+			Description: "Require MFA for the user and open an incident ticket",
+			Trigger:     PlaybookTrigger{Severities: []AlertSeverity{SeverityHigh}},
+			Steps: []PlaybookStep{
+				{Name: "Require MFA", Action: ActionTypeRequireMFA, Condition: userKnown},
+				{Name: "Create ticket", Action: ActionTypeCreateTicket},
+			},
+		},
+		{
+			Name:        "medium-alert-response",
+			Description: "Notify administrators",
+			Trigger:     PlaybookTrigger{Severities: []AlertSeverity{SeverityMedium}},
+			Steps: []PlaybookStep{
+				{Name: "Notify administrators", Action: ActionTypeNotifyAdmin},
+			},
+		},
+	}
+}
+
+// PlaybookEngine stores playbooks and runs the matching ones for each alert
+type PlaybookEngine struct {
+	db      *gorm.DB
+	execute func(SecurityAction) error
+}
+
+// NewPlaybookEngine creates a playbook engine that carries out actions with execute
+func NewPlaybookEngine(db *gorm.DB, execute func(SecurityAction) error) *PlaybookEngine {
+	engine := &PlaybookEngine{db: db, execute: execute}
+	engine.seedDefaults()
+	return engine
+}
+
+func (e *PlaybookEngine) seedDefaults() {
+	var count int64
+	if err := e.db.Model(&models.Playbook{}).Count(&count).Error; err != nil {
+		log.Printf("⚠️ Failed to load playbooks: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	for _, definition := range DefaultPlaybooks() {
+		playbook := playbookFromDefinition(definition)
+		if err := e.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&playbook).Error; err != nil {
+			log.Printf("⚠️ Failed to seed playbook %s: %v", definition.Name, err)
+		}
+	}
+}
+
+func playbookFromDefinition(definition PlaybookDefinition) models.Playbook {
+	encoded, _ := json.Marshal(definition)
+	return models.Playbook{
+		Name:        definition.Name,
+		Description: definition.Description,
+		Enabled:     definition.Enabled == nil || *definition.Enabled,
+		Definition:  string(encoded),
+	}
+}
+
+func playbookDetail(playbook models.Playbook) PlaybookDetail {
+	detail := PlaybookDetail{Playbook: playbook}
+	json.Unmarshal([]byte(playbook.Definition), &detail.Definition)
+	return detail
+}
+
+// ListPlaybooks returns all playbooks by name
+func (e *PlaybookEngine) ListPlaybooks() ([]PlaybookDetail, error) {
+	var playbooks []models.Playbook
+	if err := e.db.Order("name ASC").Find(&playbooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list playbooks: %w", err)
+	}
+	details := make([]PlaybookDetail, 0, len(playbooks))
+	for _, playbook := range playbooks {
+		details = append(details, playbookDetail(playbook))
+	}
+	return details, nil
+}
+
+// GetPlaybook returns a playbook with its definition
+func (e *PlaybookEngine) GetPlaybook(playbookID uuid.UUID) (*PlaybookDetail, error) {
+	var playbook models.Playbook
+	if err := e.db.First(&playbook, "id = ?", playbookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlaybookNotFound
+		}
+		return nil, fmt.Errorf("failed to get playbook: %w", err)
+	}
+	detail := playbookDetail(playbook)
+	return &detail, nil
+}
+
+// CreatePlaybook stores a new playbook
+func (e *PlaybookEngine) CreatePlaybook(definition PlaybookDefinition, createdBy *uuid.UUID) (*PlaybookDetail, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	var existing int64
+	if err := e.db.Model(&models.Playbook{}).Where("name = ?", definition.Name).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check playbook name: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPlaybookExists, definition.Name)
+	}
+
+	playbook := playbookFromDefinition(definition)
+	playbook.CreatedBy = createdBy
+	if err := e.db.Create(&playbook).Error; err != nil {
+		return nil, fmt.Errorf("failed to create playbook: %w", err)
+	}
+	recordConfigChange(ConfigKindRules, "playbook:"+playbook.Name, createdBy, "Playbook created", definition)
+	detail := playbookDetail(playbook)
+	return &detail, nil
+}
+
+// UpdatePlaybook replaces a playbook's definition. Runs already paused at an approval
+// gate keep the definition they started with.
+func (e *PlaybookEngine) UpdatePlaybook(playbookID uuid.UUID, definition PlaybookDefinition) (*PlaybookDetail, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	var existing int64
+	if err := e.db.Model(&models.Playbook{}).Where("name = ? AND id <> ?", definition.Name, playbookID).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check playbook name: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPlaybookExists, definition.Name)
+	}
+
+	updated := playbookFromDefinition(definition)
+	result := e.db.Model(&models.Playbook{}).Where("id = ?", playbookID).Updates(map[string]interface{}{
+		"name":        updated.Name,
+		"description": updated.Description,
+		"enabled":     updated.Enabled,
+		"definition":  updated.Definition,
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update playbook: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPlaybookNotFound
+	}
+	recordConfigChange(ConfigKindRules, "playbook:"+updated.Name, nil, "Playbook updated", definition)
+	return e.GetPlaybook(playbookID)
+}
+
+// DeletePlaybook removes a playbook; its execution history is kept
+func (e *PlaybookEngine) DeletePlaybook(playbookID uuid.UUID) error {
+	var playbook models.Playbook
+	if err := e.db.Select("name").First(&playbook, "id = ?", playbookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPlaybookNotFound
+		}
+		return fmt.Errorf("failed to get playbook: %w", err)
+	}
+	result := e.db.Where("id = ?", playbookID).Delete(&models.Playbook{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete playbook: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPlaybookNotFound
+	}
+	recordConfigChange(ConfigKindRules, "playbook:"+playbook.Name, nil, "Playbook deleted", nil)
+	return nil
+}
+
+// restorePlaybook puts a playbook back to a recorded definition, recreating it when it
+// was deleted since
+func (e *PlaybookEngine) restorePlaybook(name string, snapshot []byte, actor *uuid.UUID) error {
+	var definition PlaybookDefinition
+	if err := json.Unmarshal(snapshot, &definition); err != nil {
+		return fmt.Errorf("invalid playbook snapshot: %w", err)
+	}
+	var playbook models.Playbook
+	err := e.db.Select("id").Where("name = ?", name).First(&playbook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err = e.CreatePlaybook(definition, actor)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get playbook: %w", err)
+	}
+	_, err = e.UpdatePlaybook(playbook.ID, definition)
+	return err
+}
+
+// Run starts every enabled playbook whose trigger matches the alert and returns the runs.
+// Each run proceeds until it finishes, fails, or reaches an approval gate.
+func (e *PlaybookEngine) Run(alert SecurityAlert) []PlaybookRun {
+	var playbooks []models.Playbook
+	if err := e.db.Where("enabled = ?", true).Order("name ASC").Find(&playbooks).Error; err != nil {
+		log.Printf("⚠️ Failed to load playbooks for alert %s: %v", alert.ID, err)
+		return nil
+	}
+
+	encodedAlert, _ := json.Marshal(alert)
+	runs := []PlaybookRun{}
+	for _, playbook := range playbooks {
+		var definition PlaybookDefinition
+		if err := json.Unmarshal([]byte(playbook.Definition), &definition); err != nil {
+			log.Printf("⚠️ Playbook %s has an unreadable definition: %v", playbook.Name, err)
+			continue
+		}
+		if !definition.matches(alert) {
+			continue
+		}
+
+		run := PlaybookRun{PlaybookExecution: models.PlaybookExecution{
+			PlaybookID:   playbook.ID,
+			PlaybookName: playbook.Name,
+			AlertID:      alert.ID,
+			Status:       models.PlaybookRunning,
+			Definition:   playbook.Definition,
+			Alert:        string(encodedAlert),
+		}, Steps: []StepResult{}}
+		if err := e.db.Create(&run.PlaybookExecution).Error; err != nil {
+			log.Printf("⚠️ Failed to start playbook %s for alert %s: %v", playbook.Name, alert.ID, err)
+			continue
+		}
+
+		e.advance(&run, definition, alert, 0)
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// ListExecutions returns the playbook runs for an alert, oldest first
+func (e *PlaybookEngine) ListExecutions(alertID uuid.UUID) ([]PlaybookRun, error) {
+	var executions []models.PlaybookExecution
+	if err := e.db.Where("alert_id = ?", alertID).Order("created_at ASC").Find(&executions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list playbook executions: %w", err)
+	}
+	runs := make([]PlaybookRun, 0, len(executions))
+	for _, execution := range executions {
+		runs = append(runs, playbookRun(execution))
+	}
+	return runs, nil
+}
+
+// Decide approves or rejects the gate a run is paused at. An approved run continues
+// with the next step; a rejected run is cancelled.
+func (e *PlaybookEngine) Decide(executionID uuid.UUID, decidedBy *uuid.UUID, approved bool, comment string) (*PlaybookRun, error) {
+	var execution models.PlaybookExecution
+	if err := e.db.First(&execution, "id = ?", executionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlaybookExecutionNotFound
+		}
+		return nil, fmt.Errorf("failed to get playbook execution: %w", err)
+	}
+
+	// Claim the run so two approvers cannot both resume it
+	result := e.db.Model(&models.PlaybookExecution{}).
+		Where("id = ? AND status = ?", executionID, models.PlaybookAwaitingApproval).
+		Update("status", models.PlaybookRunning)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim playbook execution: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrExecutionNotAwaitingApproval
+	}
+
+	run := playbookRun(execution)
+	run.Status = models.PlaybookRunning
+	var definition PlaybookDefinition
+	var alert SecurityAlert
+	json.Unmarshal([]byte(execution.Definition), &definition)
+	json.Unmarshal([]byte(execution.Alert), &alert)
+
+	gate := definition.Steps[execution.CurrentStep]
+	now := time.Now()
+	decision := StepResult{Name: gate.Name, Status: StepApproved, DecidedBy: decidedBy, Comment: comment, StartedAt: *execution.ApprovalRequestedAt, FinishedAt: now}
+	if !approved {
+		decision.Status = StepRejected
+	}
+	run.Steps = append(run.Steps, decision)
+
+	if !approved {
+		run.Status = models.PlaybookCancelled
+		run.CompletedAt = &now
+		e.save(&run)
+		return &run, nil
+	}
+
+	e.advance(&run, definition, alert, execution.CurrentStep+1)
+	return &run, nil
+}
+
+func playbookRun(execution models.PlaybookExecution) PlaybookRun {
+	run := PlaybookRun{PlaybookExecution: execution, Steps: []StepResult{}}
+	json.Unmarshal([]byte(execution.Results), &run.Steps)
+	return run
+}
+
+// advance runs steps from index from until the run completes, fails or pauses
+func (e *PlaybookEngine) advance(run *PlaybookRun, definition PlaybookDefinition, alert SecurityAlert, from int) {
+	for i := from; i < len(definition.Steps); i++ {
+		step := definition.Steps[i]
+		run.CurrentStep = i
+
+		if step.Approval && (step.Condition == nil || evaluateCondition(step.Condition, alert)) {
+			now := time.Now()
+			run.Status = models.PlaybookAwaitingApproval
+			run.ApprovalRequestedAt = &now
+			e.save(run)
+			log.Printf("⏸️ Playbook %s awaiting approval at %q for alert %s", run.PlaybookName, step.Name, alert.ID)
+			return
+		}
+
+		result := e.runStep(step, alert)
+		run.Steps = append(run.Steps, result)
+		if result.Status == StepFailed && !step.ContinueOnError {
+			now := time.Now()
+			run.Status = models.PlaybookFailed
+			run.CompletedAt = &now
+			e.save(run)
+			return
+		}
+	}
+
+	now := time.Now()
+	run.CurrentStep = len(definition.Steps)
+	run.Status = models.PlaybookCompleted
+	run.CompletedAt = &now
+	e.save(run)
+}
+
+// runStep runs an action step or a set of parallel branches. Approval gates never get
+// here; a gate whose condition is false is recorded as skipped.
+func (e *PlaybookEngine) runStep(step PlaybookStep, alert SecurityAlert) StepResult {
+	result := StepResult{Name: step.Name, Action: step.Action, StartedAt: time.Now()}
+
+	if step.Condition != nil && !evaluateCondition(step.Condition, alert) {
+		result.Status = StepSkipped
+		result.FinishedAt = time.Now()
+		return result
+	}
+
+	if len(step.Parallel) > 0 {
+		result.Branches = make([]StepResult, len(step.Parallel))
+		var wg sync.WaitGroup
+		for i, branch := range step.Parallel {
+			wg.Add(1)
+			go func(i int, branch PlaybookStep) {
+				defer wg.Done()
+				result.Branches[i] = e.runStep(branch, alert)
+			}(i, branch)
+		}
+		wg.Wait()
+
+		result.Status = StepExecuted
+		for i, branch := range result.Branches {
+			if branch.Status == StepFailed && !step.Parallel[i].ContinueOnError {
+				result.Status = StepFailed
+				result.Error = fmt.Sprintf("branch %s failed", branch.Name)
+				break
+			}
+		}
+		result.FinishedAt = time.Now()
+		return result
+	}
+
+	if step.Approval {
+		result.Status = StepSkipped
+		result.FinishedAt = time.Now()
+		return result
+	}
+
+	metadata := map[string]interface{}{"alert_id": alert.ID.String()}
+	for key, value := range step.Parameters {
+		metadata[key] = value
+	}
+	if alert.UserID != nil {
+		metadata["user_id"] = alert.UserID.String()
+	}
+	if alert.IPAddress != "" {
+		metadata["ip_address"] = alert.IPAddress
+	}
+	err := e.execute(SecurityAction{
+		ID:          uuid.New(),
+		Type:        step.Action,
+		Description: step.Name,
+		Timestamp:   time.Now(),
+		Status:      ActionStatusPending,
+		Metadata:    metadata,
+	})
+	result.Status = StepExecuted
+	if err != nil {
+		result.Status = StepFailed
+		result.Error = err.Error()
+	}
+	result.FinishedAt = time.Now()
+	return result
+}
+
+// evaluateCondition tests a step condition against an alert. Severities compare by
+// rank, so "severity gte high" matches high and critical alerts.
+func evaluateCondition(condition *RuleCondition, alert SecurityAlert) bool {
+	actual, present := alertField(alert, condition.Field)
+	switch condition.Operator {
+	case "exists":
+		return present
+	case "not_exists":
+		return !present
+	}
+	if !present {
+		return condition.Operator == "neq"
+	}
+
+	switch condition.Operator {
+	case "eq":
+		return fmt.Sprint(actual) == fmt.Sprint(condition.Value)
+	case "neq":
+		return fmt.Sprint(actual) != fmt.Sprint(condition.Value)
+	case "contains":
+		return strings.Contains(fmt.Sprint(actual), fmt.Sprint(condition.Value))
+	case "in":
+		values, ok := condition.Value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, value := range values {
+			if fmt.Sprint(actual) == fmt.Sprint(value) {
+				return true
+			}
+		}
+		return false
+	case "gt", "gte", "lt", "lte":
+		left, leftOK := comparableNumber(condition.Field, actual)
+		right, rightOK := comparableNumber(condition.Field, condition.Value)
+		if !leftOK || !rightOK {
+			return false
+		}
+		switch condition.Operator {
+		case "gt":
+			return left > right
+		case "gte":
+			return left >= right
+		case "lt":
+			return left < right
+		default:
+			return left <= right
+		}
+	}
+	return false
+}
+
+// alertField looks up a condition field on an alert; metadata.<key> reads alert metadata
+func alertField(alert SecurityAlert, field string) (interface{}, bool) {
+	switch field {
+	case "type":
+		return string(alert.Type), true
+	case "severity":
+		return string(alert.Severity), true
+	case "source":
+		return alert.Source, alert.Source != ""
+	case "user_id":
+		if alert.UserID == nil {
+			return nil, false
+		}
+		return alert.UserID.String(), true
+	case "ip_address":
+		return alert.IPAddress, alert.IPAddress != ""
+	case "user_agent":
+		return alert.UserAgent, alert.UserAgent != ""
+	case "priority":
+		return alert.Priority.Score, true
+	}
+	if key, ok := strings.CutPrefix(field, "metadata."); ok {
+		value, present := alert.Metadata[key]
+		return value, present && value != nil
+	}
+	return nil, false
+}
+
+func comparableNumber(field string, value interface{}) (float64, bool) {
+	if field == "severity" {
+		rank := AlertSeverity(fmt.Sprint(value)).Rank()
+		return float64(rank), rank > 0
+	}
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	}
+	return 0, false
+}
+
+func (e *PlaybookEngine) save(run *PlaybookRun) {
+	results, _ := json.Marshal(run.Steps)
+	run.Results = string(results)
+	if err := e.db.Model(&models.PlaybookExecution{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+		"status":                run.Status,
+		"current_step":          run.CurrentStep,
+		"results":               run.Results,
+		"approval_requested_at": run.ApprovalRequestedAt,
+		"completed_at":          run.CompletedAt,
+	}).Error; err != nil {
+		log.Printf("⚠️ Failed to save playbook execution %s: %v", run.ID, err)
+	}
+}
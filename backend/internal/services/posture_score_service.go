@@ -0,0 +1,336 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Posture score components
+const (
+	PostureMFACoverage      = "mfa_coverage"
+	PosturePasskeyAdoption  = "passkey_adoption"
+	PostureStaleAccounts    = "stale_accounts"
+	PostureCriticalAlerts   = "open_critical_alerts"
+	PostureRuleCoverage     = "rule_coverage"
+	PostureConnectionHealth = "connection_health"
+)
+
+// postureWeights is how much each component counts towards the score
+var postureWeights = map[string]float64{
+	PostureMFACoverage:      25,
+	PosturePasskeyAdoption:  15,
+	PostureStaleAccounts:    15,
+	PostureCriticalAlerts:   20,
+	PostureRuleCoverage:     10,
+	PostureConnectionHealth: 15,
+}
+
+// postureAlertPenalty is what each open critical alert takes off its component's score
+const postureAlertPenalty = 25
+
+// postureCoveredAlertTypes are the alert types an automated response should exist for
+var postureCoveredAlertTypes = []AlertType{
+	AlertTypeBruteForceAttack, AlertTypeCompromisedAccount, AlertTypePrivilegeEscalation,
+	AlertTypeDataExfiltration, AlertTypeSessionHijacking, AlertTypeTokenReplay,
+	AlertTypeMaliciousIP, AlertTypeUnauthorizedAccess, AlertTypeCanaryKeyUsed, AlertTypeMalwareUpload,
+}
+
+var ErrTenantNotFound = errors.New("tenant has no active users")
+
+// PostureComponent is one measured part of a posture score. Components with nothing to
+// measure, like connection health for a tenant without connected apps, are left out and
+// the others reweighted.
+type PostureComponent struct {
+	Name        string  `json:"name"`
+	Score       float64 `json:"score"`  // 0 to 100
+	Weight      float64 `json:"weight"` // share of the total score, in percent
+	Count       int64   `json:"count"`
+	Total       int64   `json:"total,omitempty"`
+	Description string  `json:"description"`
+}
+
+// PostureScore is a tenant's security posture: a 0-100 score, its letter grade and the
+// components it was computed from
+type PostureScore struct {
+	Tenant     string             `json:"tenant"`
+	Score      float64            `json:"score"`
+	Grade      string             `json:"grade"`
+	Users      int64              `json:"users"`
+	Components []PostureComponent `json:"components"`
+	ComputedAt time.Time          `json:"computed_at"`
+}
+
+// PosturePoint is one point of a tenant's posture score trend
+type PosturePoint struct {
+	Score      float64            `json:"score"`
+	Grade      string             `json:"grade"`
+	Components map[string]float64 `json:"components"`
+	At         time.Time          `json:"at"`
+}
+
+// PostureScoreService scores each tenant's security posture from MFA coverage, passkey
+// adoption, stale accounts, open critical alerts, playbook coverage and the health of
+// connected apps. Tenants are email domains. Scores are snapshotted every
+// POSTURE_SCORE_INTERVAL for the trend, and kept for POSTURE_SCORE_RETENTION_DAYS.
+type PostureScoreService struct {
+	db        *gorm.DB
+	interval  time.Duration
+	retention time.Duration
+}
+
+// NewPostureScoreService creates a posture score service configured from the environment
+func NewPostureScoreService(db *gorm.DB) *PostureScoreService {
+	return &PostureScoreService{
+		db:        db,
+		interval:  envDuration("POSTURE_SCORE_INTERVAL", 24*time.Hour),
+		retention: time.Duration(envInt("POSTURE_SCORE_RETENTION_DAYS", 365)) * 24 * time.Hour,
+	}
+}
+
+// Interval is how often posture scores should be snapshotted
+func (s *PostureScoreService) Interval() time.Duration {
+	return s.interval
+}
+
+// Tenants returns every tenant with active users, by name
+func (s *PostureScoreService) Tenants() ([]string, error) {
+	var emails []string
+	if err := s.db.Model(&models.User{}).Where("is_active = ?", true).Pluck("email", &emails).Error; err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	seen := make(map[string]bool)
+	tenants := make([]string, 0)
+	for _, email := range emails {
+		if tenant := TenantForEmail(email); tenant != "" && !seen[tenant] {
+			seen[tenant] = true
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// Compute scores a tenant's posture now
+func (s *PostureScoreService) Compute(tenant string, now time.Time) (*PostureScore, error) {
+	tenant = strings.ToLower(strings.TrimSpace(tenant))
+	var total int64
+	if err := s.tenantUsers(tenant).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count tenant users: %w", err)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenant)
+	}
+	users := s.tenantUsers(tenant).Select("id")
+
+	var withTOTP, withPasskey []uuid.UUID
+	if err := s.db.Model(&models.MFASetup{}).Distinct("user_id").
+		Where("user_id IN (?) AND enabled = ?", users, true).Pluck("user_id", &withTOTP).Error; err != nil {
+		return nil, fmt.Errorf("failed to count MFA enrollments: %w", err)
+	}
+	if err := s.db.Model(&WebAuthnCredential{}).Distinct("user_id").
+		Where("user_id IN (?)", users).Pluck("user_id", &withPasskey).Error; err != nil {
+		return nil, fmt.Errorf("failed to count passkeys: %w", err)
+	}
+	withMFA := make(map[uuid.UUID]bool, len(withTOTP)+len(withPasskey))
+	for _, id := range append(withTOTP, withPasskey...) {
+		withMFA[id] = true
+	}
+
+	var stale int64
+	if err := s.db.Model(&models.DormantAccount{}).
+		Where("user_id IN (?) AND status IN ?", users, []string{models.DormantStatusWarned, models.DormantStatusDormant}).
+		Count(&stale).Error; err != nil {
+		return nil, fmt.Errorf("failed to count dormant accounts: %w", err)
+	}
+
+	var openCritical int64
+	if err := s.db.Model(&models.SecurityAlertRecord{}).
+		Where("user_id IN (?) AND severity = ? AND status IN ?", users, string(SeverityCritical),
+			[]string{string(StatusOpen), string(StatusInProgress)}).
+		Count(&openCritical).Error; err != nil {
+		return nil, fmt.Errorf("failed to count open critical alerts: %w", err)
+	}
+
+	covered, err := s.coveredAlertTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	var connections, healthy int64
+	if err := s.db.Model(&models.AppConnection{}).
+		Where("user_id IN (?) AND status = ? AND health_status <> ?", users, models.ConnectionConnected, models.HealthUnknown).
+		Count(&connections).Error; err != nil {
+		return nil, fmt.Errorf("failed to count app connections: %w", err)
+	}
+	if err := s.db.Model(&models.AppConnection{}).
+		Where("user_id IN (?) AND status = ? AND health_status = ?", users, models.ConnectionConnected, models.HealthHealthy).
+		Count(&healthy).Error; err != nil {
+		return nil, fmt.Errorf("failed to count healthy app connections: %w", err)
+	}
+
+	components := []PostureComponent{
+		ratioComponent(PostureMFACoverage, int64(len(withMFA)), total, "Active users with an authenticator app or passkey"),
+		ratioComponent(PosturePasskeyAdoption, int64(len(withPasskey)), total, "Active users with a registered passkey"),
+		{
+			Name:        PostureStaleAccounts,
+			Score:       100 * (1 - float64(stale)/float64(total)),
+			Count:       stale,
+			Total:       total,
+			Description: "Dormant accounts still enabled",
+		},
+		{
+			Name:        PostureCriticalAlerts,
+			Score:       math.Max(0, 100-postureAlertPenalty*float64(openCritical)),
+			Count:       openCritical,
+			Description: "Open critical alerts on the tenant's users",
+		},
+		ratioComponent(PostureRuleCoverage, int64(covered), int64(len(postureCoveredAlertTypes)), "High-impact alert types answered by an enabled playbook"),
+	}
+	if connections > 0 {
+		components = append(components, ratioComponent(PostureConnectionHealth, healthy, connections, "Connected apps passing health checks"))
+	}
+
+	var weights, weighted float64
+	for _, component := range components {
+		weights += postureWeights[component.Name]
+	}
+	for i := range components {
+		components[i].Score = roundScore(components[i].Score)
+		components[i].Weight = roundScore(100 * postureWeights[components[i].Name] / weights)
+		weighted += components[i].Score * postureWeights[components[i].Name] / weights
+	}
+	score := roundScore(weighted)
+	return &PostureScore{
+		Tenant:     tenant,
+		Score:      score,
+		Grade:      postureGrade(score),
+		Users:      total,
+		Components: components,
+		ComputedAt: now,
+	}, nil
+}
+
+// ComputeAll scores every tenant's posture now, by tenant name
+func (s *PostureScoreService) ComputeAll(now time.Time) ([]PostureScore, error) {
+	tenants, err := s.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]PostureScore, 0, len(tenants))
+	for _, tenant := range tenants {
+		score, err := s.Compute(tenant, now)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, *score)
+	}
+	return scores, nil
+}
+
+// Snapshot records every tenant's posture score for the trend and drops snapshots past
+// the retention period, returning how many it recorded
+func (s *PostureScoreService) Snapshot(now time.Time) (int, error) {
+	scores, err := s.ComputeAll(now)
+	if err != nil {
+		return 0, err
+	}
+	for _, score := range scores {
+		componentScores := make(map[string]float64, len(score.Components))
+		for _, component := range score.Components {
+			componentScores[component.Name] = component.Score
+		}
+		encoded, _ := json.Marshal(componentScores)
+		snapshot := models.PostureScoreSnapshot{
+			Tenant:          score.Tenant,
+			Score:           score.Score,
+			Grade:           score.Grade,
+			Users:           score.Users,
+			ComponentScores: string(encoded),
+			CreatedAt:       now,
+		}
+		if err := s.db.Create(&snapshot).Error; err != nil {
+			return 0, fmt.Errorf("failed to record posture score: %w", err)
+		}
+	}
+	if err := s.db.Where("created_at < ?", now.Add(-s.retention)).Delete(&models.PostureScoreSnapshot{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to drop old posture scores: %w", err)
+	}
+	return len(scores), nil
+}
+
+// History returns a tenant's recorded posture scores since a time, oldest first
+func (s *PostureScoreService) History(tenant string, since time.Time) ([]PosturePoint, error) {
+	var snapshots []models.PostureScoreSnapshot
+	if err := s.db.Where("tenant = ? AND created_at >= ?", strings.ToLower(strings.TrimSpace(tenant)), since).
+		Order("created_at ASC").Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to list posture scores: %w", err)
+	}
+	points := make([]PosturePoint, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		point := PosturePoint{Score: snapshot.Score, Grade: snapshot.Grade, At: snapshot.CreatedAt}
+		json.Unmarshal([]byte(snapshot.ComponentScores), &point.Components)
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// tenantUsers selects a tenant's active users
+func (s *PostureScoreService) tenantUsers(tenant string) *gorm.DB {
+	return s.db.Model(&models.User{}).Where("is_active = ? AND LOWER(email) LIKE ?", true, "%@"+tenant)
+}
+
+// coveredAlertTypes counts the high-impact alert types an enabled playbook runs for
+func (s *PostureScoreService) coveredAlertTypes() (int, error) {
+	var playbooks []models.Playbook
+	if err := s.db.Where("enabled = ?", true).Find(&playbooks).Error; err != nil {
+		return 0, fmt.Errorf("failed to list playbooks: %w", err)
+	}
+	covered := 0
+	for _, alertType := range postureCoveredAlertTypes {
+		alert := SecurityAlert{Type: alertType, Severity: SeverityHigh}
+		for _, playbook := range playbooks {
+			definition := playbookDetail(playbook).Definition
+			if definition.matches(alert) {
+				covered++
+				break
+			}
+		}
+	}
+	return covered, nil
+}
+
+func ratioComponent(name string, count, total int64, description string) PostureComponent {
+	component := PostureComponent{Name: name, Count: count, Total: total, Description: description}
+	if total > 0 {
+		component.Score = 100 * float64(count) / float64(total)
+	}
+	return component
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*10) / 10
+}
+
+func postureGrade(score float64) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	}
+	return "F"
+}
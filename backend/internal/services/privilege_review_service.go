@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// privilegedRequestAction is the audit action recorded when a user calls a privileged endpoint
+const privilegedRequestAction = "privileged_request"
+
+// What a privilege review recommends for a role holder
+const (
+	PrivilegeKeep   = "keep"
+	PrivilegeDemote = "demote" // privileges unused for PRIVILEGE_REVIEW_UNUSED_DAYS
+	PrivilegeRevoke = "revoke" // the account itself is locked or deactivated
+)
+
+// PrivilegedHolder is a user holding privileged roles and how they have used them
+type PrivilegedHolder struct {
+	UserID         uuid.UUID  `json:"user_id"`
+	Email          string     `json:"email"`
+	Roles          []string   `json:"roles"`
+	AssignedAt     time.Time  `json:"assigned_at"` // earliest of the user's assignments
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	LastEndpoint   string     `json:"last_endpoint,omitempty"`
+	RecentRequests int64      `json:"recent_requests"` // privileged requests within the unused window
+	Recommendation string     `json:"recommendation"`
+	Reason         string     `json:"reason"`
+}
+
+// PrivilegeReviewSummary counts role holders by recommendation
+type PrivilegeReviewSummary struct {
+	Holders int `json:"holders"`
+	Keep    int `json:"keep"`
+	Demote  int `json:"demote"`
+	Revoke  int `json:"revoke"`
+}
+
+// PrivilegeReviewReport lists every privileged role holder with their last privileged
+// request, recommending which privileges to demote or revoke
+type PrivilegeReviewReport struct {
+	ID              uuid.UUID              `json:"id"`
+	GeneratedAt     time.Time              `json:"generated_at"`
+	UnusedAfterDays int                    `json:"unused_after_days"`
+	Summary         PrivilegeReviewSummary `json:"summary"`
+	Holders         []PrivilegedHolder     `json:"holders"`
+}
+
+// PrivilegeReviewService reviews privileged role assignments against the audit trail of
+// privileged requests. Holders who made no privileged request for
+// PRIVILEGE_REVIEW_UNUSED_DAYS are recommended for demotion. Reads are audited at most once
+// per user and endpoint every PRIVILEGE_AUDIT_INTERVAL, so dashboards polling the admin API
+// don't flood the audit log; changes are always audited.
+type PrivilegeReviewService struct {
+	db            *gorm.DB
+	jobs          *JobQueue
+	unused        time.Duration
+	interval      time.Duration
+	auditInterval time.Duration
+
+	mu       sync.Mutex
+	recorded map[string]time.Time
+}
+
+// NewPrivilegeReviewService creates a privilege review service configured from the
+// environment, running scheduled reviews on jobs
+func NewPrivilegeReviewService(db *gorm.DB, jobs *JobQueue) *PrivilegeReviewService {
+	return &PrivilegeReviewService{
+		db:            db,
+		jobs:          jobs,
+		unused:        time.Duration(envInt("PRIVILEGE_REVIEW_UNUSED_DAYS", 30)) * 24 * time.Hour,
+		interval:      envDuration("PRIVILEGE_REVIEW_INTERVAL", 7*24*time.Hour),
+		auditInterval: envDuration("PRIVILEGE_AUDIT_INTERVAL", 15*time.Minute),
+		recorded:      make(map[string]time.Time),
+	}
+}
+
+// Interval is how often a scheduled review should be produced
+func (s *PrivilegeReviewService) Interval() time.Duration {
+	return s.interval
+}
+
+// RecordUse audits a privileged request. Reads of an endpoint the user called recently
+// are skipped.
+func (s *PrivilegeReviewService) RecordUse(userID uuid.UUID, method, endpoint, ipAddress, userAgent string, status int, now time.Time) {
+	if method == "GET" || method == "HEAD" {
+		key := userID.String() + " " + endpoint
+		s.mu.Lock()
+		last, seen := s.recorded[key]
+		if seen && now.Sub(last) < s.auditInterval {
+			s.mu.Unlock()
+			return
+		}
+		s.recorded[key] = now
+		// Forget reads outside the interval so the map stays small
+		if len(s.recorded) > 10000 {
+			for k, t := range s.recorded {
+				if now.Sub(t) >= s.auditInterval {
+					delete(s.recorded, k)
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	outcome := "success"
+	if status >= 400 {
+		outcome = "failure"
+	}
+	auditLog := models.AuditLog{
+		UserID:     &userID,
+		Action:     privilegedRequestAction,
+		Resource:   "admin_api",
+		ResourceID: method + " " + endpoint,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		Details:    strconv.Itoa(status),
+		Status:     outcome,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit privileged request: %v", err)
+	}
+}
+
+// Report reviews every privileged role holder as of now
+func (s *PrivilegeReviewService) Report(ctx context.Context, now time.Time) (*PrivilegeReviewReport, error) {
+	db := s.db.WithContext(ctx)
+	var assignments []models.RoleAssignment
+	if err := db.Order("created_at ASC").Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+
+	holders := make(map[uuid.UUID]*PrivilegedHolder)
+	order := make([]uuid.UUID, 0)
+	for _, assignment := range assignments {
+		holder, ok := holders[assignment.UserID]
+		if !ok {
+			holder = &PrivilegedHolder{UserID: assignment.UserID, AssignedAt: assignment.CreatedAt}
+			holders[assignment.UserID] = holder
+			order = append(order, assignment.UserID)
+		}
+		holder.Roles = append(holder.Roles, assignment.Role)
+	}
+
+	report := &PrivilegeReviewReport{
+		ID:              uuid.New(),
+		GeneratedAt:     now,
+		UnusedAfterDays: int(s.unused.Hours() / 24),
+		Holders:         make([]PrivilegedHolder, 0, len(order)),
+	}
+	since := now.Add(-s.unused)
+	for _, userID := range order {
+		holder := holders[userID]
+		var user models.User
+		found := db.Unscoped().Where("id = ?", userID).Limit(1).Find(&user)
+		if found.Error != nil {
+			return nil, fmt.Errorf("failed to get user: %w", found.Error)
+		}
+		holder.Email = user.Email
+
+		var last models.AuditLog
+		if err := db.Where("user_id = ? AND action = ?", userID, privilegedRequestAction).
+			Order("created_at DESC").Limit(1).Find(&last).Error; err != nil {
+			return nil, fmt.Errorf("failed to find last privileged request: %w", err)
+		}
+		if last.ID != uuid.Nil {
+			holder.LastUsedAt = &last.CreatedAt
+			holder.LastEndpoint = last.ResourceID
+		}
+		if err := db.Model(&models.AuditLog{}).
+			Where("user_id = ? AND action = ? AND created_at >= ?", userID, privilegedRequestAction, since).
+			Count(&holder.RecentRequests).Error; err != nil {
+			return nil, fmt.Errorf("failed to count privileged requests: %w", err)
+		}
+
+		switch {
+		case found.RowsAffected == 0 || user.DeletedAt.Valid:
+			holder.Recommendation, holder.Reason = PrivilegeRevoke, "The account no longer exists"
+		case !user.IsActive || user.IsLocked(now):
+			holder.Recommendation, holder.Reason = PrivilegeRevoke, "The account is locked or deactivated"
+		case holder.AssignedAt.After(since) || (holder.LastUsedAt != nil && holder.LastUsedAt.After(since)):
+			holder.Recommendation, holder.Reason = PrivilegeKeep, "Privileges used or granted recently"
+		case holder.LastUsedAt == nil:
+			holder.Recommendation, holder.Reason = PrivilegeDemote, "No privileged request on record"
+		default:
+			holder.Recommendation = PrivilegeDemote
+			holder.Reason = fmt.Sprintf("No privileged request for %d days", int(now.Sub(*holder.LastUsedAt).Hours()/24))
+		}
+		sort.Strings(holder.Roles)
+		report.Holders = append(report.Holders, *holder)
+
+		report.Summary.Holders++
+		switch holder.Recommendation {
+		case PrivilegeKeep:
+			report.Summary.Keep++
+		case PrivilegeDemote:
+			report.Summary.Demote++
+		case PrivilegeRevoke:
+			report.Summary.Revoke++
+		}
+	}
+	return report, nil
+}
+
+// StartReport queues a privilege review; the job's result is the PrivilegeReviewReport.
+// requestedBy is nil for scheduled reviews.
+func (s *PrivilegeReviewService) StartReport(requestedBy *uuid.UUID) (*models.ReportJob, error) {
+	now := time.Now()
+	job := &models.ReportJob{
+		Kind:        models.ReportJobPrivilegeReview,
+		StartTime:   now.Add(-s.unused),
+		EndTime:     now,
+		RequestedBy: requestedBy,
+	}
+	err := s.jobs.Enqueue(job, func(ctx context.Context, run *JobRun) (interface{}, error) {
+		run.Logf("Reviewing privileged role holders against requests since %s", job.StartTime.Format(time.RFC3339))
+		report, err := s.Report(ctx, now)
+		if err == nil && report.Summary.Demote+report.Summary.Revoke > 0 {
+			run.Warnf("%d holder(s) to demote, %d to revoke", report.Summary.Demote, report.Summary.Revoke)
+		}
+		return report, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// WritePrivilegeReviewCSV writes a privilege review as CSV, one row per role holder
+func WritePrivilegeReviewCSV(w io.Writer, report *PrivilegeReviewReport) error {
+	writer := csv.NewWriter(w)
+	header := []string{"user_id", "email", "roles", "assigned_at", "last_used_at", "last_endpoint",
+		"recent_requests", "recommendation", "reason"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, h := range report.Holders {
+		lastUsed := ""
+		if h.LastUsedAt != nil {
+			lastUsed = h.LastUsedAt.UTC().Format(time.RFC3339)
+		}
+		row := []string{
+			h.UserID.String(),
+			h.Email,
+			strings.Join(h.Roles, " "),
+			h.AssignedAt.UTC().Format(time.RFC3339),
+			lastUsed,
+			h.LastEndpoint,
+			strconv.FormatInt(h.RecentRequests, 10),
+			h.Recommendation,
+			h.Reason,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUnknownProvider is returned for providers without a known OAuth token endpoint
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrSecretRejected is returned when the provider refuses the new secret in the test exchange
+	ErrSecretRejected = errors.New("provider rejected client secret")
+)
+
+// ProviderOAuthClient describes how CloudGate authenticates to a provider's token endpoint
+type ProviderOAuthClient struct {
+	TokenURL    string
+	ClientIDEnv string
+	SecretEnv   string
+	BasicAuth   bool // client credentials go in the Authorization header instead of the form
+}
+
+// providerOAuthClients lists the OAuth integrations whose secrets can be rotated: the
+// built-in providers, and any the OAuth provider registry adds from configuration
+var (
+	providerOAuthClientsMu sync.RWMutex
+	providerOAuthClients   = builtinOAuthClients()
+)
+
+func builtinOAuthClients() map[string]ProviderOAuthClient {
+	clients := make(map[string]ProviderOAuthClient, len(builtinOAuthProviders))
+	for _, config := range builtinOAuthProviders {
+		clients[config.Name] = config.Client()
+	}
+	return clients
+}
+
+func registerOAuthClient(provider string, client ProviderOAuthClient) {
+	providerOAuthClientsMu.Lock()
+	providerOAuthClients[provider] = client
+	providerOAuthClientsMu.Unlock()
+}
+
+func lookupOAuthClient(provider string) (ProviderOAuthClient, bool) {
+	providerOAuthClientsMu.RLock()
+	defer providerOAuthClientsMu.RUnlock()
+	client, ok := providerOAuthClients[provider]
+	return client, ok
+}
+
+// SecretValidator checks a candidate client secret against the provider before it goes live
+type SecretValidator interface {
+	ValidateClientSecret(ctx context.Context, client ProviderOAuthClient, clientID, secret string) error
+}
+
+// TokenEndpointValidator validates a secret with a test token exchange using a dummy
+// authorization code. A provider that authenticated the client complains about the
+// code (invalid_grant); one that did not complains about the client (invalid_client).
+type TokenEndpointValidator struct {
+	HTTPClient *http.Client
+}
+
+// clientAuthErrors are the error codes providers use when client credentials are wrong
+var clientAuthErrors = map[string]bool{
+	"invalid_client":               true,
+	"unauthorized_client":          true,
+	"incorrect_client_credentials": true, // GitHub
+	"bad_client_secret":            true, // Slack
+	"invalid_client_id":            true, // Slack
+}
+
+// ValidateClientSecret performs the test exchange
+func (v *TokenEndpointValidator) ValidateClientSecret(ctx context.Context, client ProviderOAuthClient, clientID, secret string) error {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", "cloudgate-secret-rotation-check")
+	form.Set("redirect_uri", getEnv("BACKEND_URL", "http://localhost:8081"))
+	if !client.BasicAuth {
+		form.Set("client_id", clientID)
+		form.Set("client_secret", secret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", client.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if client.BasicAuth {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(clientID+":"+secret)))
+	}
+
+	httpClient := v.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("test token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var result struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &result)
+
+	if clientAuthErrors[result.Error] || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrSecretRejected, strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("test token exchange failed: provider returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ProviderSecretService stores provider client secrets and rotates them without downtime
+type ProviderSecretService struct {
+	db          *gorm.DB
+	validator   SecretValidator
+	gracePeriod time.Duration
+}
+
+// NewProviderSecretService creates a new provider secret service. Old secrets stay
+// usable for PROVIDER_SECRET_GRACE_PERIOD (default 1h) after a rotation.
+func NewProviderSecretService(db *gorm.DB) *ProviderSecretService {
+	return &ProviderSecretService{
+		db:          db,
+		validator:   &TokenEndpointValidator{},
+		gracePeriod: envDuration("PROVIDER_SECRET_GRACE_PERIOD", time.Hour),
+	}
+}
+
+// SetValidator replaces the validator used for the test exchange
+func (s *ProviderSecretService) SetValidator(validator SecretValidator) {
+	s.validator = validator
+}
+
+// RotateSecret validates a new client secret with the provider, makes it the active
+// secret in one transaction and keeps the previous one usable for the grace window.
+func (s *ProviderSecretService) RotateSecret(ctx context.Context, provider, newSecret string, grace time.Duration, actor *uuid.UUID) (*models.ProviderSecret, error) {
+	client, ok := lookupOAuthClient(provider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	newSecret = strings.TrimSpace(newSecret)
+	if newSecret == "" {
+		return nil, fmt.Errorf("%w: secret is empty", ErrSecretRejected)
+	}
+	if grace <= 0 {
+		grace = s.gracePeriod
+	}
+
+	if err := s.validator.ValidateClientSecret(ctx, client, getEnv(client.ClientIDEnv, ""), newSecret); err != nil {
+		s.audit(actor, "provider_secret_rotation_failed", provider, "failure", err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	graceUntil := now.Add(grace)
+	secret := models.ProviderSecret{
+		Provider:    provider,
+		Secret:      newSecret,
+		SecretHint:  secretHint(newSecret),
+		Status:      models.ProviderSecretActive,
+		ValidatedAt: &now,
+		RotatedBy:   actor,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Secrets from an earlier rotation have had their grace window; only the one being replaced gets a new one
+		if err := tx.Model(&models.ProviderSecret{}).
+			Where("provider = ? AND status = ?", provider, models.ProviderSecretGrace).
+			Update("status", models.ProviderSecretRetired).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.ProviderSecret{}).
+			Where("provider = ? AND status = ?", provider, models.ProviderSecretActive).
+			Updates(map[string]interface{}{"status": models.ProviderSecretGrace, "grace_until": graceUntil})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// First rotation away from the environment secret: keep that one for the grace window too
+		if result.RowsAffected == 0 {
+			if envSecret := getEnv(client.SecretEnv, ""); envSecret != "" && envSecret != newSecret {
+				previous := models.ProviderSecret{
+					Provider:   provider,
+					Secret:     envSecret,
+					SecretHint: secretHint(envSecret),
+					Status:     models.ProviderSecretGrace,
+					GraceUntil: &graceUntil,
+				}
+				if err := tx.Create(&previous).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Create(&secret).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate provider secret: %w", err)
+	}
+
+	log.Printf("🔑 Rotated %s client secret (previous secret accepted until %s)", provider, graceUntil.Format(time.RFC3339))
+	s.audit(actor, "provider_secret_rotated", provider, "success",
+		fmt.Sprintf("New secret %s validated and activated; previous secret accepted until %s", secret.SecretHint, graceUntil.Format(time.RFC3339)))
+	return &secret, nil
+}
+
+// ClientSecrets returns the secrets to try for a provider, active first, then those
+// still in their grace window. Without a rotated secret the environment value is used.
+func (s *ProviderSecretService) ClientSecrets(provider string) []string {
+	var secrets []models.ProviderSecret
+	err := s.db.Where("provider = ? AND status IN ?", provider, []string{models.ProviderSecretActive, models.ProviderSecretGrace}).
+		Order("created_at DESC").Find(&secrets).Error
+	if err != nil {
+		log.Printf("⚠️ Failed to load %s client secrets: %v", provider, err)
+	}
+
+	var candidates []string
+	hasActive := false
+	for _, secret := range secrets {
+		if secret.Status == models.ProviderSecretActive {
+			hasActive = true
+			candidates = append([]string{secret.Secret}, candidates...)
+		} else if secret.IsUsable() {
+			candidates = append(candidates, secret.Secret)
+		}
+	}
+	if !hasActive {
+		if client, ok := lookupOAuthClient(provider); ok {
+			if envSecret := getEnv(client.SecretEnv, ""); envSecret != "" {
+				candidates = append([]string{envSecret}, candidates...)
+			}
+		}
+	}
+	return candidates
+}
+
+// ListSecrets returns secret metadata for a provider, newest first
+func (s *ProviderSecretService) ListSecrets(provider string) ([]models.ProviderSecret, error) {
+	if _, ok := lookupOAuthClient(provider); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+
+	var secrets []models.ProviderSecret
+	if err := s.db.Where("provider = ?", provider).Order("created_at DESC").Find(&secrets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list provider secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+func (s *ProviderSecretService) audit(actor *uuid.UUID, action, provider, status, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "provider_secret",
+		ResourceID: provider,
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit provider secret rotation: %v", err)
+	}
+}
+
+// secretHint shows just enough of a secret to tell rotations apart
+func secretHint(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
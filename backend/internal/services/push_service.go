@@ -0,0 +1,355 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fcmScope is the OAuth scope of the FCM HTTP v1 API
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// Platforms a push device can register from
+var pushPlatforms = map[string]bool{"android": true, "ios": true, "web": true}
+
+// ErrInvalidPushDevice is returned when registering a device without a token or platform
+var ErrInvalidPushDevice = errors.New("invalid push device")
+
+// fcmServiceAccount is the part of a Google service account key FCM needs
+type fcmServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// PushService registers admins' phones and browsers and sends them critical alerts as
+// push notifications through Firebase Cloud Messaging, authenticated with the service
+// account in FCM_SERVICE_ACCOUNT_FILE. Notifications deep-link into the alert's view.
+type PushService struct {
+	db       *gorm.DB
+	client   *http.Client
+	account  *fcmServiceAccount // nil when FCM is not configured
+	endpoint string
+	alertURL string
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewPushService creates a push service from the environment. Without a valid service
+// account devices can still register, but nothing is sent.
+func NewPushService(db *gorm.DB) *PushService {
+	s := &PushService{
+		db:       db,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: strings.TrimRight(getEnv("FCM_ENDPOINT", "https://fcm.googleapis.com"), "/"),
+		alertURL: getEnv("PUSH_ALERT_URL", strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/")+"/dashboard/security?alert="),
+	}
+	if path := getEnv("FCM_SERVICE_ACCOUNT_FILE", ""); path != "" {
+		account, err := loadFCMServiceAccount(path)
+		if err != nil {
+			log.Printf("⚠️ Push notifications disabled: %v", err)
+			return s
+		}
+		s.account = account
+	}
+	return s
+}
+
+func loadFCMServiceAccount(path string) (*fcmServiceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM service account: %w", err)
+	}
+	var account fcmServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse FCM service account: %w", err)
+	}
+	account.ProjectID = getEnv("FCM_PROJECT_ID", account.ProjectID)
+	if account.ProjectID == "" || account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("FCM service account needs project_id, client_email and private_key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &account, nil
+}
+
+// Enabled reports whether FCM is configured
+func (s *PushService) Enabled() bool {
+	return s.account != nil
+}
+
+// RegisterDevice records a device's FCM registration token for the user. A token already
+// registered, even by another user, moves to this user, since tokens belong to one app install.
+func (s *PushService) RegisterDevice(userID uuid.UUID, token, platform, name string) (*models.PushDevice, error) {
+	token, platform = strings.TrimSpace(token), strings.ToLower(strings.TrimSpace(platform))
+	if token == "" {
+		return nil, fmt.Errorf("%w: token is required", ErrInvalidPushDevice)
+	}
+	if !pushPlatforms[platform] {
+		return nil, fmt.Errorf("%w: platform must be android, ios or web", ErrInvalidPushDevice)
+	}
+
+	var device models.PushDevice
+	err := s.db.Where("token = ?", token).First(&device).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to look up push device: %w", err)
+	}
+	device.UserID, device.Token, device.Platform, device.Name = userID, token, platform, name
+	if err := s.db.Save(&device).Error; err != nil {
+		return nil, fmt.Errorf("failed to register push device: %w", err)
+	}
+	return &device, nil
+}
+
+// ListDevices returns the user's registered devices
+func (s *PushService) ListDevices(userID uuid.UUID) ([]models.PushDevice, error) {
+	var devices []models.PushDevice
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list push devices: %w", err)
+	}
+	return devices, nil
+}
+
+// RemoveDevice unregisters one of the user's devices
+func (s *PushService) RemoveDevice(userID, deviceID uuid.UUID) (bool, error) {
+	result := s.db.Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.PushDevice{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to remove push device: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SendAlert pushes an alert to every device of an active, unlocked user, returning how
+// many devices it reached. Devices FCM no longer knows are unregistered.
+func (s *PushService) SendAlert(ctx context.Context, alert SecurityAlert) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+	var devices []models.PushDevice
+	err := s.db.Joins("JOIN users ON users.id = push_devices.user_id").
+		Where("users.is_active = ? AND (users.locked_at IS NULL OR users.locked_until <= ?)", true, time.Now()).
+		Find(&devices).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list push devices: %w", err)
+	}
+	return s.sendToDevices(ctx, devices, s.alertMessage(alert))
+}
+
+// NotifyUser pushes a notice to every device the user registered, returning how many it
+// reached. It reaches users on their phones when the channel they sign in through may not
+// be theirs to trust.
+func (s *PushService) NotifyUser(ctx context.Context, userID uuid.UUID, title, body, link string) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+	var devices []models.PushDevice
+	if err := s.db.Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+		return 0, fmt.Errorf("failed to list push devices: %w", err)
+	}
+	message := map[string]interface{}{
+		"notification": map[string]string{"title": title, "body": body},
+		"data":         map[string]string{"link": link},
+		"android":      map[string]interface{}{"priority": "HIGH"},
+		"apns":         map[string]interface{}{"headers": map[string]string{"apns-priority": "10"}},
+		"webpush":      map[string]interface{}{"fcm_options": map[string]string{"link": link}},
+	}
+	return s.sendToDevices(ctx, devices, message)
+}
+
+// sendToDevices sends a message to each device, unregistering those FCM no longer knows
+func (s *PushService) sendToDevices(ctx context.Context, devices []models.PushDevice, message map[string]interface{}) (int, error) {
+	sent := 0
+	var failures []string
+	for _, device := range devices {
+		err := s.send(ctx, device.Token, message)
+		var unregistered *fcmUnregisteredError
+		switch {
+		case errors.As(err, &unregistered):
+			log.Printf("Removing push device %s: %v", device.ID, err)
+			s.db.Delete(&device)
+		case err != nil:
+			failures = append(failures, err.Error())
+		default:
+			sent++
+			now := time.Now()
+			s.db.Model(&device).UpdateColumn("last_push_at", now)
+		}
+	}
+	if len(failures) > 0 {
+		return sent, fmt.Errorf("failed to push to %d device(s): %s", len(failures), failures[0])
+	}
+	return sent, nil
+}
+
+// alertMessage builds the FCM message for an alert, less the device token. Data values
+// must be strings; the mobile app opens alert_id, and browsers open the link.
+func (s *PushService) alertMessage(alert SecurityAlert) map[string]interface{} {
+	link := s.alertURL + url.QueryEscape(alert.ID.String())
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Severity)), alert.Title)
+	body := alert.Description
+	if len(body) > 240 {
+		body = body[:237] + "..."
+	}
+	return map[string]interface{}{
+		"notification": map[string]string{"title": title, "body": body},
+		"data": map[string]string{
+			"alert_id": alert.ID.String(),
+			"type":     string(alert.Type),
+			"severity": string(alert.Severity),
+			"link":     link,
+		},
+		"android": map[string]interface{}{"priority": "HIGH"},
+		"apns":    map[string]interface{}{"headers": map[string]string{"apns-priority": "10"}},
+		"webpush": map[string]interface{}{"fcm_options": map[string]string{"link": link}},
+	}
+}
+
+// fcmUnregisteredError is returned when FCM reports a registration token is no longer valid
+type fcmUnregisteredError struct {
+	status int
+}
+
+func (e *fcmUnregisteredError) Error() string {
+	return fmt.Sprintf("FCM registration token is no longer valid (status %d)", e.status)
+}
+
+func (s *PushService) send(ctx context.Context, token string, message map[string]interface{}) error {
+	accessToken, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+	message["token"] = token
+	payload, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return err
+	}
+
+	sendURL := fmt.Sprintf("%s/v1/projects/%s/messages:send", s.endpoint, url.PathEscape(s.account.ProjectID))
+	req, err := http.NewRequestWithContext(ctx, "POST", sendURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if resp.StatusCode == http.StatusNotFound || strings.Contains(string(body), "UNREGISTERED") {
+		return &fcmUnregisteredError{status: resp.StatusCode}
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.mu.Lock()
+		s.accessToken = ""
+		s.mu.Unlock()
+	}
+	return fmt.Errorf("FCM returned status %d: %s", resp.StatusCode, string(body))
+}
+
+// token returns an access token for the FCM API, exchanging a service account assertion
+// for a new one shortly before the cached token expires
+func (s *PushService) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.accessToken != "" && now.Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(s.account.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid FCM service account key: %w", err)
+	}
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token request: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, "POST", s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get FCM access token: %w", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := decodeProviderResponse(resp, &token); err != nil {
+		return "", err
+	}
+	s.accessToken = token.AccessToken
+	s.expiresAt = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.accessToken, nil
+}
+
+// PushAlertChannel sends alerts at or above a severity, critical by default, to admins'
+// registered devices
+type PushAlertChannel struct {
+	Push        *PushService
+	MinSeverity AlertSeverity
+	Enabled     bool
+}
+
+func (p *PushAlertChannel) SendAlert(alert SecurityAlert) error {
+	if !p.Enabled || p.Push == nil {
+		return nil
+	}
+	minSeverity := p.MinSeverity
+	if minSeverity == "" {
+		minSeverity = SeverityCritical
+	}
+	if alert.Severity.Compare(minSeverity) < 0 {
+		return nil
+	}
+	log.Printf("📱 Sending push alert: %s", alert.Title)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := p.Push.SendAlert(ctx, alert)
+	return err
+}
+
+func (p *PushAlertChannel) GetChannelType() string {
+	return "push"
+}
+
+func (p *PushAlertChannel) IsEnabled() bool {
+	return p.Enabled
+}
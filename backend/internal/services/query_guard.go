@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidQueryRange is returned for a missing or inverted time range
+	ErrInvalidQueryRange = errors.New("invalid query range")
+	// ErrQueryRangeTooLarge is returned when a range exceeds the maximum even for background jobs
+	ErrQueryRangeTooLarge = errors.New("query range too large")
+	// ErrQueryTimeout is returned when a guarded query runs past its statement timeout
+	ErrQueryTimeout = errors.New("query timed out")
+)
+
+// QueryCostMetric is the running cost of one reporting endpoint's queries
+type QueryCostMetric struct {
+	Endpoint   string    `json:"endpoint"`
+	Queries    int64     `json:"queries"`
+	Failures   int64     `json:"failures"`
+	Timeouts   int64     `json:"timeouts"`
+	Rejected   int64     `json:"rejected"`
+	Deferred   int64     `json:"deferred"`
+	TotalMs    int64     `json:"total_ms"`
+	MaxMs      int64     `json:"max_ms"`
+	AvgMs      float64   `json:"avg_ms"`
+	LastRunAt  time.Time `json:"last_run_at,omitempty"`
+	LastRangeH float64   `json:"last_range_hours"`
+}
+
+// QueryGuard bounds the cost of expensive reporting queries. Ranges above
+// AUDIT_QUERY_MAX_RANGE are rejected, ranges above AUDIT_QUERY_SYNC_RANGE should run as
+// background jobs, and every guarded query runs under a statement timeout
+// (AUDIT_QUERY_STATEMENT_TIMEOUT inline, AUDIT_QUERY_JOB_TIMEOUT in jobs).
+type QueryGuard struct {
+	maxRange         time.Duration
+	syncRange        time.Duration
+	statementTimeout time.Duration
+	jobTimeout       time.Duration
+
+	mu      sync.Mutex
+	metrics map[string]*QueryCostMetric
+}
+
+// NewQueryGuard creates a query guard configured from the environment
+func NewQueryGuard() *QueryGuard {
+	return &QueryGuard{
+		maxRange:         envDuration("AUDIT_QUERY_MAX_RANGE", 366*24*time.Hour),
+		syncRange:        envDuration("AUDIT_QUERY_SYNC_RANGE", 31*24*time.Hour),
+		statementTimeout: envDuration("AUDIT_QUERY_STATEMENT_TIMEOUT", 15*time.Second),
+		jobTimeout:       envDuration("AUDIT_QUERY_JOB_TIMEOUT", 10*time.Minute),
+		metrics:          make(map[string]*QueryCostMetric),
+	}
+}
+
+// CheckRange validates a query range for endpoint and reports whether it is large enough
+// that it must run as a background job rather than inline
+func (g *QueryGuard) CheckRange(endpoint string, startTime, endTime time.Time) (bool, error) {
+	if startTime.IsZero() || endTime.IsZero() || !endTime.After(startTime) {
+		return false, fmt.Errorf("%w: end_time must be after start_time", ErrInvalidQueryRange)
+	}
+
+	span := endTime.Sub(startTime)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	metric := g.metric(endpoint)
+	metric.LastRangeH = span.Hours()
+	if span > g.maxRange {
+		metric.Rejected++
+		return false, fmt.Errorf("%w: %.0f days exceeds the %.0f day maximum", ErrQueryRangeTooLarge, span.Hours()/24, g.maxRange.Hours()/24)
+	}
+	if span > g.syncRange {
+		metric.Deferred++
+		return true, nil
+	}
+	return false, nil
+}
+
+// Run executes fn in a transaction bounded by the inline or job statement timeout and
+// records its cost against endpoint. On Postgres the timeout is also set server-side with
+// SET LOCAL statement_timeout, so a runaway query is cancelled even if the client stalls.
+func (g *QueryGuard) Run(ctx context.Context, db *gorm.DB, endpoint string, background bool, fn func(tx *gorm.DB) error) error {
+	timeout := g.statementTimeout
+	if background {
+		timeout = g.jobTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())).Error; err != nil {
+				return fmt.Errorf("failed to set statement timeout: %w", err)
+			}
+		}
+		return fn(tx)
+	})
+	elapsed := time.Since(started)
+
+	timedOut := err != nil && (errors.Is(ctx.Err(), context.DeadlineExceeded) || strings.Contains(err.Error(), "statement timeout"))
+	g.record(endpoint, elapsed, err, timedOut)
+	if timedOut {
+		return fmt.Errorf("%w after %s: narrow the time range", ErrQueryTimeout, timeout)
+	}
+	return err
+}
+
+// Metrics returns a snapshot of per-endpoint query cost, ordered by endpoint
+func (g *QueryGuard) Metrics() []QueryCostMetric {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	metrics := make([]QueryCostMetric, 0, len(g.metrics))
+	for _, metric := range g.metrics {
+		snapshot := *metric
+		if snapshot.Queries > 0 {
+			snapshot.AvgMs = float64(snapshot.TotalMs) / float64(snapshot.Queries)
+		}
+		metrics = append(metrics, snapshot)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Endpoint < metrics[j].Endpoint })
+	return metrics
+}
+
+func (g *QueryGuard) record(endpoint string, elapsed time.Duration, err error, timedOut bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	metric := g.metric(endpoint)
+	metric.Queries++
+	metric.TotalMs += elapsed.Milliseconds()
+	if elapsed.Milliseconds() > metric.MaxMs {
+		metric.MaxMs = elapsed.Milliseconds()
+	}
+	metric.LastRunAt = time.Now()
+	if timedOut {
+		metric.Timeouts++
+	} else if err != nil {
+		metric.Failures++
+	}
+}
+
+// metric returns the entry for endpoint, creating it; callers must hold g.mu
+func (g *QueryGuard) metric(endpoint string) *QueryCostMetric {
+	metric, ok := g.metrics[endpoint]
+	if !ok {
+		metric = &QueryCostMetric{Endpoint: endpoint}
+		g.metrics[endpoint] = metric
+	}
+	return metric
+}
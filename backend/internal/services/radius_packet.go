@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RADIUS packet codes (RFC 2865)
+const (
+	RadiusAccessRequest   byte = 1
+	RadiusAccessAccept    byte = 2
+	RadiusAccessReject    byte = 3
+	RadiusAccessChallenge byte = 11
+)
+
+// RADIUS attribute types used by the RADIUS server
+const (
+	RadiusAttrUserName             byte = 1
+	RadiusAttrUserPassword         byte = 2
+	RadiusAttrNASIPAddress         byte = 4
+	RadiusAttrReplyMessage         byte = 18
+	RadiusAttrState                byte = 24
+	RadiusAttrVendorSpecific       byte = 26
+	RadiusAttrCallingStationID     byte = 31
+	RadiusAttrNASIdentifier        byte = 32
+	RadiusAttrMessageAuthenticator byte = 80
+)
+
+// Microsoft vendor-specific attributes carrying MS-CHAPv2 (RFC 2548)
+const (
+	radiusVendorMicrosoft uint32 = 311
+	msCHAPError           byte   = 2
+	msCHAPChallenge       byte   = 11
+	msCHAP2Response       byte   = 25
+	msCHAP2Success        byte   = 26
+)
+
+const (
+	radiusHeaderLength = 20
+	radiusMaxLength    = 4096
+)
+
+// ErrInvalidRadiusPacket is returned for datagrams that are not well-formed RADIUS packets
+var ErrInvalidRadiusPacket = errors.New("invalid RADIUS packet")
+
+// RadiusAttribute is a single type-length-value attribute
+type RadiusAttribute struct {
+	Type  byte
+	Value []byte
+}
+
+// RadiusPacket is a decoded RADIUS packet
+type RadiusPacket struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []RadiusAttribute
+}
+
+// ParseRadiusPacket decodes a datagram, ignoring any padding beyond the stated length
+func ParseRadiusPacket(data []byte) (*RadiusPacket, error) {
+	if len(data) < radiusHeaderLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidRadiusPacket, len(data))
+	}
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < radiusHeaderLength || length > radiusMaxLength || length > len(data) {
+		return nil, fmt.Errorf("%w: bad length %d", ErrInvalidRadiusPacket, length)
+	}
+
+	packet := &RadiusPacket{Code: data[0], Identifier: data[1]}
+	copy(packet.Authenticator[:], data[4:20])
+	for rest := data[radiusHeaderLength:length]; len(rest) > 0; {
+		if len(rest) < 2 || int(rest[1]) < 2 || int(rest[1]) > len(rest) {
+			return nil, fmt.Errorf("%w: truncated attribute", ErrInvalidRadiusPacket)
+		}
+		packet.Attributes = append(packet.Attributes, RadiusAttribute{Type: rest[0], Value: append([]byte(nil), rest[2:rest[1]]...)})
+		rest = rest[rest[1]:]
+	}
+	return packet, nil
+}
+
+// Get returns the first attribute of the given type
+func (p *RadiusPacket) Get(attrType byte) ([]byte, bool) {
+	for _, attr := range p.Attributes {
+		if attr.Type == attrType {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+// GetString returns the first attribute of the given type as a string
+func (p *RadiusPacket) GetString(attrType byte) string {
+	value, _ := p.Get(attrType)
+	return string(value)
+}
+
+// Add appends an attribute
+func (p *RadiusPacket) Add(attrType byte, value []byte) {
+	p.Attributes = append(p.Attributes, RadiusAttribute{Type: attrType, Value: value})
+}
+
+// GetVendor returns the first Microsoft vendor-specific sub-attribute of the given type
+func (p *RadiusPacket) GetVendor(vendorType byte) ([]byte, bool) {
+	for _, attr := range p.Attributes {
+		if attr.Type != RadiusAttrVendorSpecific || len(attr.Value) < 6 {
+			continue
+		}
+		if binary.BigEndian.Uint32(attr.Value[:4]) != radiusVendorMicrosoft {
+			continue
+		}
+		if attr.Value[4] == vendorType && int(attr.Value[5]) == len(attr.Value)-4 {
+			return attr.Value[6:], true
+		}
+	}
+	return nil, false
+}
+
+// AddVendor appends a Microsoft vendor-specific sub-attribute
+func (p *RadiusPacket) AddVendor(vendorType byte, value []byte) {
+	attr := make([]byte, 6, 6+len(value))
+	binary.BigEndian.PutUint32(attr[:4], radiusVendorMicrosoft)
+	attr[4] = vendorType
+	attr[5] = byte(2 + len(value))
+	p.Add(RadiusAttrVendorSpecific, append(attr, value...))
+}
+
+// Encode serializes the packet as it stands, without computing any authenticators
+func (p *RadiusPacket) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write([]byte{p.Code, p.Identifier, 0, 0})
+	buf.Write(p.Authenticator[:])
+	for _, attr := range p.Attributes {
+		if len(attr.Value) > 253 {
+			return nil, fmt.Errorf("%w: attribute %d is %d bytes", ErrInvalidRadiusPacket, attr.Type, len(attr.Value))
+		}
+		buf.Write([]byte{attr.Type, byte(2 + len(attr.Value))})
+		buf.Write(attr.Value)
+	}
+	data := buf.Bytes()
+	if len(data) > radiusMaxLength {
+		return nil, fmt.Errorf("%w: packet is %d bytes", ErrInvalidRadiusPacket, len(data))
+	}
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+	return data, nil
+}
+
+// NewRadiusResponse creates a reply to a request. Message-Authenticator is placed first
+// so clients hardened against Blast-RADIUS can check it before parsing anything else.
+func NewRadiusResponse(request *RadiusPacket, code byte) *RadiusPacket {
+	response := &RadiusPacket{Code: code, Identifier: request.Identifier, Authenticator: request.Authenticator}
+	response.Add(RadiusAttrMessageAuthenticator, make([]byte, 16))
+	return response
+}
+
+// EncodeResponse signs a response built by NewRadiusResponse: the Message-Authenticator
+// HMAC over the packet (RFC 3579), then the Response Authenticator (RFC 2865 section 3)
+func (p *RadiusPacket) EncodeResponse(secret []byte) ([]byte, error) {
+	data, err := p.Encode()
+	if err != nil {
+		return nil, err
+	}
+	if offset := messageAuthenticatorOffset(data); offset >= 0 {
+		mac := hmac.New(md5.New, secret)
+		mac.Write(data)
+		copy(data[offset:offset+16], mac.Sum(nil))
+	}
+	hash := md5.New()
+	hash.Write(data)
+	hash.Write(secret)
+	copy(data[4:20], hash.Sum(nil))
+	return data, nil
+}
+
+// VerifyMessageAuthenticator checks an Access-Request's Message-Authenticator. It
+// reports false when the attribute is absent or does not match.
+func VerifyMessageAuthenticator(data, secret []byte) bool {
+	offset := messageAuthenticatorOffset(data)
+	if offset < 0 {
+		return false
+	}
+	received := append([]byte(nil), data[offset:offset+16]...)
+	zeroed := append([]byte(nil), data[:binary.BigEndian.Uint16(data[2:4])]...)
+	copy(zeroed[offset:offset+16], make([]byte, 16))
+	mac := hmac.New(md5.New, secret)
+	mac.Write(zeroed)
+	return subtle.ConstantTimeCompare(received, mac.Sum(nil)) == 1
+}
+
+// messageAuthenticatorOffset finds the Message-Authenticator value in an encoded
+// packet, or returns -1
+func messageAuthenticatorOffset(data []byte) int {
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	for offset := radiusHeaderLength; offset+2 <= length; {
+		attrLength := int(data[offset+1])
+		if attrLength < 2 || offset+attrLength > length {
+			return -1
+		}
+		if data[offset] == RadiusAttrMessageAuthenticator && attrLength == 18 {
+			return offset + 2
+		}
+		offset += attrLength
+	}
+	return -1
+}
+
+// DecodeRadiusPassword recovers a PAP User-Password hidden with the shared secret and
+// the request authenticator (RFC 2865 section 5.2)
+func DecodeRadiusPassword(hidden, secret []byte, authenticator [16]byte) ([]byte, error) {
+	if len(hidden) == 0 || len(hidden)%16 != 0 || len(hidden) > 128 {
+		return nil, fmt.Errorf("%w: User-Password is %d bytes", ErrInvalidRadiusPacket, len(hidden))
+	}
+	password := make([]byte, len(hidden))
+	previous := authenticator[:]
+	for i := 0; i < len(hidden); i += 16 {
+		hash := md5.New()
+		hash.Write(secret)
+		hash.Write(previous)
+		block := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			password[i+j] = hidden[i+j] ^ block[j]
+		}
+		previous = hidden[i : i+16]
+	}
+	return bytes.TrimRight(password, "\x00"), nil
+}
+
+// EncodeRadiusPassword hides a PAP User-Password, as a network device would
+func EncodeRadiusPassword(password, secret []byte, authenticator [16]byte) []byte {
+	padded := make([]byte, (len(password)+15)/16*16)
+	if len(padded) == 0 {
+		padded = make([]byte, 16)
+	}
+	copy(padded, password)
+	hidden := make([]byte, len(padded))
+	previous := authenticator[:]
+	for i := 0; i < len(padded); i += 16 {
+		hash := md5.New()
+		hash.Write(secret)
+		hash.Write(previous)
+		block := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			hidden[i+j] = padded[i+j] ^ block[j]
+		}
+		previous = hidden[i : i+16]
+	}
+	return hidden
+}
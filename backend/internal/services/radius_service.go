@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// radiusApplicationID identifies network logins to the risk engine and in audit logs
+const radiusApplicationID = "radius"
+
+var (
+	// ErrUnknownRadiusClient is returned for packets from addresses not in RADIUS_CLIENTS
+	ErrUnknownRadiusClient = errors.New("unknown RADIUS client")
+	// ErrBadMessageAuthenticator is returned for requests with a missing or wrong Message-Authenticator
+	ErrBadMessageAuthenticator = errors.New("missing or invalid Message-Authenticator")
+)
+
+// RadiusClient is a network device or VPN concentrator allowed to send Access-Requests
+type RadiusClient struct {
+	Network *net.IPNet
+	Secret  []byte
+}
+
+// RadiusRiskEvaluator scores a network login; AdaptiveAuthService implements it
+type RadiusRiskEvaluator interface {
+	EvaluateAuthentication(ctx context.Context, authCtx *AuthContext) (*AuthDecision, error)
+}
+
+// RadiusService is an optional RADIUS server that lets network devices and VPNs
+// authenticate users against CloudGate identities. PAP passwords are checked against the
+// user's password hash; MS-CHAPv2 needs the NT hash captured at web sign-in, so it is
+// off unless RADIUS_MSCHAPV2=true. Every login goes through the adaptive-auth risk
+// engine, and users with TOTP enabled, or whom the engine challenges, must answer an
+// Access-Challenge with a one-time passcode, which only PAP clients can do.
+type RadiusService struct {
+	db                          *gorm.DB
+	risk                        RadiusRiskEvaluator
+	clients                     []RadiusClient
+	mschapv2                    bool
+	requireMessageAuthenticator bool
+	challengeTTL                time.Duration
+	credentialKey               []byte
+}
+
+// NewRadiusService creates the RADIUS service. Clients come from RADIUS_CLIENTS, a comma
+// separated list of cidr=secret pairs; with no clients the server is disabled.
+func NewRadiusService(db *gorm.DB, risk RadiusRiskEvaluator) *RadiusService {
+	return &RadiusService{
+		db:                          db,
+		risk:                        risk,
+		clients:                     parseRadiusClients(getEnv("RADIUS_CLIENTS", "")),
+		mschapv2:                    getEnv("RADIUS_MSCHAPV2", "false") == "true",
+		requireMessageAuthenticator: getEnv("RADIUS_REQUIRE_MESSAGE_AUTHENTICATOR", "true") == "true",
+		challengeTTL:                envDuration("RADIUS_OTP_TIMEOUT", 2*time.Minute),
+		credentialKey:               credentialKey("cloudgate-radius-credential", "RADIUS_CREDENTIAL_KEY"),
+	}
+}
+
+func parseRadiusClients(value string) []RadiusClient {
+	var clients []RadiusClient
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		network, secret, found := strings.Cut(entry, "=")
+		if !found || secret == "" {
+			log.Printf("⚠️ Ignoring RADIUS client %q: expected cidr=secret", network)
+			continue
+		}
+		if !strings.Contains(network, "/") {
+			if ip := net.ParseIP(network); ip != nil && ip.To4() == nil {
+				network += "/128"
+			} else {
+				network += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			log.Printf("⚠️ Ignoring RADIUS client %q: %v", network, err)
+			continue
+		}
+		clients = append(clients, RadiusClient{Network: ipNet, Secret: []byte(secret)})
+	}
+	return clients
+}
+
+// Enabled reports whether any RADIUS clients are configured
+func (s *RadiusService) Enabled() bool {
+	return len(s.clients) > 0
+}
+
+// RememberPassword stores the sealed NT hash of a password the user has just proven,
+// so later MS-CHAPv2 logins can be verified. It does nothing unless MS-CHAPv2 is enabled.
+func (s *RadiusService) RememberPassword(userID uuid.UUID, password string) error {
+	if !s.mschapv2 {
+		return nil
+	}
+	sealed, err := s.seal(NTPasswordHash(password))
+	if err != nil {
+		return err
+	}
+	credential := models.RadiusCredential{UserID: userID, NTHash: sealed}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"nt_hash", "updated_at"}),
+	}).Create(&credential).Error
+	if err != nil {
+		return fmt.Errorf("failed to store RADIUS credential: %w", err)
+	}
+	return nil
+}
+
+// HandlePacket answers one Access-Request datagram. Packets from unknown clients, or
+// that fail the Message-Authenticator check, return an error and get no response.
+func (s *RadiusService) HandlePacket(data []byte, from net.IP, now time.Time) ([]byte, error) {
+	client := s.clientFor(from)
+	if client == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRadiusClient, from)
+	}
+	request, err := ParseRadiusPacket(data)
+	if err != nil {
+		return nil, err
+	}
+	if request.Code != RadiusAccessRequest {
+		return nil, fmt.Errorf("%w: unexpected code %d", ErrInvalidRadiusPacket, request.Code)
+	}
+	if _, present := request.Get(RadiusAttrMessageAuthenticator); present || s.requireMessageAuthenticator {
+		if !VerifyMessageAuthenticator(data, client.Secret) {
+			return nil, ErrBadMessageAuthenticator
+		}
+	}
+
+	response := s.authenticate(request, client.Secret, from, now)
+	return response.EncodeResponse(client.Secret)
+}
+
+// ListenAndServe serves RADIUS over UDP until the context is cancelled
+func (s *RadiusService) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for RADIUS on %s: %w", addr, err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, radiusMaxLength)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read RADIUS packet: %w", err)
+		}
+		udpAddr, ok := remote.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		data := append([]byte(nil), buf[:n]...)
+		go func() {
+			response, err := s.HandlePacket(data, udpAddr.IP, time.Now())
+			if err != nil {
+				log.Printf("⚠️ Dropped RADIUS packet from %s: %v", remote, err)
+				return
+			}
+			if _, err := conn.WriteTo(response, remote); err != nil {
+				log.Printf("⚠️ Failed to answer RADIUS client %s: %v", remote, err)
+			}
+		}()
+	}
+}
+
+// PurgeExpired deletes unanswered passcode challenges, and any stored NT hashes once
+// MS-CHAPv2 has been turned off
+func (s *RadiusService) PurgeExpired(now time.Time) error {
+	if err := s.db.Where("expires_at <= ?", now).Delete(&models.RadiusChallenge{}).Error; err != nil {
+		return fmt.Errorf("failed to purge RADIUS challenges: %w", err)
+	}
+	if !s.mschapv2 {
+		if err := s.db.Where("1 = 1").Delete(&models.RadiusCredential{}).Error; err != nil {
+			return fmt.Errorf("failed to purge RADIUS credentials: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *RadiusService) clientFor(ip net.IP) *RadiusClient {
+	for i := range s.clients {
+		if s.clients[i].Network.Contains(ip) {
+			return &s.clients[i]
+		}
+	}
+	return nil
+}
+
+// radiusLogin is what an Access-Request says about who is signing in, and from where
+type radiusLogin struct {
+	userName  string
+	nasID     string
+	ipAddress string
+}
+
+func (s *RadiusService) authenticate(request *RadiusPacket, secret []byte, from net.IP, now time.Time) *RadiusPacket {
+	login := radiusLogin{userName: request.GetString(RadiusAttrUserName), nasID: request.GetString(RadiusAttrNASIdentifier), ipAddress: from.String()}
+	if login.nasID == "" {
+		login.nasID = from.String()
+	}
+	// Calling-Station-Id is the user's address for VPN logins, but a MAC for Wi-Fi
+	if calling := net.ParseIP(request.GetString(RadiusAttrCallingStationID)); calling != nil {
+		login.ipAddress = calling.String()
+	}
+	if login.userName == "" {
+		return radiusReject(request, "User-Name is required")
+	}
+
+	if state, ok := request.Get(RadiusAttrState); ok {
+		return s.completeChallenge(request, secret, string(state), login, now)
+	}
+
+	user, err := s.findUser(login.userName)
+	if err != nil {
+		s.audit(nil, login, "Unknown or inactive user "+login.userName, "failure")
+		return radiusReject(request, "Invalid credentials")
+	}
+
+	// Verify the first factor
+	var mschapIdent byte
+	var mschapSuccess string
+	usingMSCHAP := false
+	if hidden, ok := request.Get(RadiusAttrUserPassword); ok {
+		password, err := DecodeRadiusPassword(hidden, secret, request.Authenticator)
+		if err != nil || user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), password) != nil {
+			s.audit(&user.ID, login, "PAP password rejected", "failure")
+			return radiusReject(request, "Invalid credentials")
+		}
+	} else if response, ok := request.GetVendor(msCHAP2Response); ok {
+		usingMSCHAP = true
+		challenge, _ := request.GetVendor(msCHAPChallenge)
+		if len(response) != 50 {
+			return radiusReject(request, "Invalid MS-CHAPv2 response")
+		}
+		mschapIdent = response[0]
+		mschapSuccess, ok = s.verifyMSCHAPv2(user.ID, login.userName, challenge, response)
+		if !ok {
+			s.audit(&user.ID, login, "MS-CHAPv2 response rejected", "failure")
+			reject := radiusReject(request, "Invalid credentials")
+			reject.AddVendor(msCHAPError, append([]byte{mschapIdent}, "E=691 R=0 V=3"...))
+			return reject
+		}
+	} else {
+		return radiusReject(request, "Unsupported authentication method")
+	}
+
+	// The risk engine decides whether the password is enough
+	otpRequired, reason := s.evaluateRisk(user, login, now)
+	if reason != "" {
+		s.audit(&user.ID, login, reason, "failure")
+		return radiusReject(request, "Sign-in blocked by security policy")
+	}
+	_, mfaEnabled := s.enabledMFA(user.ID)
+	if mfaEnabled || otpRequired {
+		switch {
+		case !mfaEnabled:
+			s.audit(&user.ID, login, "One-time passcode required but the user has no authenticator enrolled", "failure")
+			return radiusReject(request, "Set up two-factor authentication in CloudGate to sign in")
+		case usingMSCHAP:
+			s.audit(&user.ID, login, "One-time passcode required but MS-CHAPv2 cannot carry one", "failure")
+			return radiusReject(request, "A one-time passcode is required; connect with PAP to enter it")
+		}
+		return s.issueChallenge(request, user.ID, login, now)
+	}
+
+	s.audit(&user.ID, login, "Network login accepted", "success")
+	accept := NewRadiusResponse(request, RadiusAccessAccept)
+	if usingMSCHAP {
+		accept.AddVendor(msCHAP2Success, append([]byte{mschapIdent}, mschapSuccess...))
+	}
+	return accept
+}
+
+func (s *RadiusService) verifyMSCHAPv2(userID uuid.UUID, userName string, challenge, response []byte) (string, bool) {
+	if !s.mschapv2 || len(challenge) != 16 {
+		return "", false
+	}
+	var credential models.RadiusCredential
+	if err := s.db.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		return "", false
+	}
+	ntHash, err := s.open(credential.NTHash)
+	if err != nil {
+		log.Printf("⚠️ Failed to open RADIUS credential for %s: %v", userID, err)
+		return "", false
+	}
+	// Response layout: Ident, Flags, Peer-Challenge[16], Reserved[8], NT-Response[24]
+	return VerifyMSCHAPv2(challenge, response[2:18], response[26:50], userName, ntHash)
+}
+
+// evaluateRisk runs the adaptive-auth engine. It returns whether a passcode is needed,
+// or a reason when the login must be refused outright.
+func (s *RadiusService) evaluateRisk(user *models.User, login radiusLogin, now time.Time) (bool, string) {
+	if s.risk == nil {
+		return false, ""
+	}
+	decision, err := s.risk.EvaluateAuthentication(context.Background(), &AuthContext{
+		UserID:        user.ID,
+		Email:         user.Email,
+		IPAddress:     login.ipAddress,
+		UserAgent:     "RADIUS/" + login.nasID,
+		LoginTime:     now,
+		ApplicationID: radiusApplicationID,
+		SessionInfo:   map[string]interface{}{"nas_identifier": login.nasID},
+	})
+	if err != nil {
+		// Fail closed to the second factor rather than open
+		log.Printf("⚠️ RADIUS risk evaluation failed for %s: %v", user.ID, err)
+		return true, ""
+	}
+	if decision.Decision == AuthDecisionDeny {
+		return false, fmt.Sprintf("Denied by risk engine (%s risk, score %.2f)", decision.RiskLevel, decision.RiskScore)
+	}
+	if decision.Decision == AuthDecisionChallenge {
+		return true, ""
+	}
+	for _, action := range decision.RequiredActions {
+		if action.Type == ActionMFARequired && action.Required {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+func (s *RadiusService) issueChallenge(request *RadiusPacket, userID uuid.UUID, login radiusLogin, now time.Time) *RadiusPacket {
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		log.Printf("⚠️ Failed to generate RADIUS challenge state: %v", err)
+		return radiusReject(request, "Temporary failure, try again")
+	}
+	state := hex.EncodeToString(stateBytes)
+	challenge := models.RadiusChallenge{State: state, UserID: userID, UserName: login.userName, ExpiresAt: now.Add(s.challengeTTL)}
+	if err := s.db.Create(&challenge).Error; err != nil {
+		log.Printf("⚠️ Failed to store RADIUS challenge: %v", err)
+		return radiusReject(request, "Temporary failure, try again")
+	}
+
+	response := NewRadiusResponse(request, RadiusAccessChallenge)
+	response.Add(RadiusAttrState, []byte(state))
+	response.Add(RadiusAttrReplyMessage, []byte("Enter the one-time passcode from your authenticator app"))
+	return response
+}
+
+// completeChallenge checks the passcode sent in reply to an Access-Challenge. Each
+// challenge can be answered once.
+func (s *RadiusService) completeChallenge(request *RadiusPacket, secret []byte, state string, login radiusLogin, now time.Time) *RadiusPacket {
+	var challenge models.RadiusChallenge
+	err := s.db.Where("state = ? AND user_name = ? AND expires_at > ?", state, login.userName, now).First(&challenge).Error
+	if err != nil {
+		return radiusReject(request, "Passcode challenge expired, sign in again")
+	}
+	if result := s.db.Where("state = ?", state).Delete(&models.RadiusChallenge{}); result.Error != nil || result.RowsAffected == 0 {
+		return radiusReject(request, "Passcode challenge expired, sign in again")
+	}
+
+	hidden, ok := request.Get(RadiusAttrUserPassword)
+	if !ok {
+		return radiusReject(request, "Passcode is required")
+	}
+	code, err := DecodeRadiusPassword(hidden, secret, request.Authenticator)
+	mfaSetup, enabled := s.enabledMFA(challenge.UserID)
+	if err != nil || !enabled || !totp.Validate(string(code), mfaSetup.Secret) {
+		s.audit(&challenge.UserID, login, "One-time passcode rejected", "failure")
+		return radiusReject(request, "Invalid passcode")
+	}
+
+	s.audit(&challenge.UserID, login, "Network login accepted with one-time passcode", "success")
+	return NewRadiusResponse(request, RadiusAccessAccept)
+}
+
+// findUser matches the RADIUS User-Name against email or username, ignoring any
+// Windows domain prefix
+func (s *RadiusService) findUser(userName string) (*models.User, error) {
+	if i := strings.LastIndex(userName, `\`); i >= 0 {
+		userName = userName[i+1:]
+	}
+	var user models.User
+	err := s.db.Where("(email = ? OR username = ?) AND is_active = ?", userName, userName, true).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *RadiusService) enabledMFA(userID uuid.UUID) (*models.MFASetup, bool) {
+	var setup models.MFASetup
+	if err := s.db.Where("user_id = ? AND enabled = ?", userID, true).First(&setup).Error; err != nil {
+		return nil, false
+	}
+	return &setup, true
+}
+
+func (s *RadiusService) seal(plaintext []byte) (string, error) {
+	sealed, err := sealSecret(s.credentialKey, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal RADIUS credential: %w", err)
+	}
+	return sealed, nil
+}
+
+func (s *RadiusService) open(sealed string) ([]byte, error) {
+	return openSecret(s.credentialKey, sealed)
+}
+
+func (s *RadiusService) audit(userID *uuid.UUID, login radiusLogin, details, status string) {
+	auditLog := models.AuditLog{
+		UserID:     userID,
+		Action:     "radius_authentication",
+		Resource:   radiusApplicationID,
+		ResourceID: login.nasID,
+		IPAddress:  login.ipAddress,
+		UserAgent:  "RADIUS/" + login.nasID,
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit RADIUS login: %v", err)
+	}
+}
+
+func radiusReject(request *RadiusPacket, message string) *RadiusPacket {
+	response := NewRadiusResponse(request, RadiusAccessReject)
+	response.Add(RadiusAttrReplyMessage, []byte(message))
+	return response
+}
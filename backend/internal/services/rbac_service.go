@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var privilegedRoles = []string{models.RoleAdmin, models.RoleSecurityAnalyst}
+
+var (
+	ErrInvalidRole            = errors.New("unknown role")
+	ErrRoleAssignmentNotFound = errors.New("role assignment not found")
+	ErrLastAdmin              = errors.New("the last administrator cannot be removed")
+)
+
+// RoleDefinition describes a role and the permissions it grants
+type RoleDefinition struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+type cachedRoles struct {
+	roles    []string
+	loadedAt time.Time
+}
+
+// RBACService assigns privileged roles and answers whether a user holds them. Lookups are
+// cached per user for RBAC_ROLE_CACHE_TTL; changes made here take effect at once. Users
+// listed in RBAC_BOOTSTRAP_ADMINS are made administrators on their first privileged
+// request while no administrator exists, so a new deployment can be set up. Only an
+// address the user has proven they own counts, since anyone may register any address.
+type RBACService struct {
+	db              *gorm.DB
+	audit           *AuditService
+	bootstrapAdmins map[string]bool
+	cacheTTL        time.Duration
+
+	mu    sync.Mutex
+	cache map[uuid.UUID]cachedRoles
+}
+
+// NewRBACService creates a role service configured from the environment. Role changes
+// are recorded through audit, which may be nil.
+func NewRBACService(db *gorm.DB, audit *AuditService) *RBACService {
+	bootstrap := make(map[string]bool)
+	for _, email := range strings.Split(getEnv("RBAC_BOOTSTRAP_ADMINS", ""), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			bootstrap[email] = true
+		}
+	}
+	return &RBACService{
+		db:              db,
+		audit:           audit,
+		bootstrapAdmins: bootstrap,
+		cacheTTL:        envDuration("RBAC_ROLE_CACHE_TTL", 30*time.Second),
+		cache:           make(map[uuid.UUID]cachedRoles),
+	}
+}
+
+// Roles returns every assignable role with its permissions
+func (s *RBACService) Roles() []RoleDefinition {
+	definitions := make([]RoleDefinition, 0, len(privilegedRoles))
+	for _, role := range privilegedRoles {
+		definitions = append(definitions, RoleDefinition{Role: role, Permissions: models.RolePermissions[role]})
+	}
+	return definitions
+}
+
+// AssignRole grants a user a privileged role; assigning a role the user holds is a no-op
+func (s *RBACService) AssignRole(userID uuid.UUID, role string, actor *uuid.UUID) (*models.RoleAssignment, error) {
+	if !slices.Contains(privilegedRoles, role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	var user models.User
+	if err := s.db.Select("id").Where("id = ?", userID).Take(&user).Error; err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+
+	assignment := models.RoleAssignment{UserID: userID, Role: role, AssignedBy: actor}
+	result := s.db.Where("user_id = ? AND role = ?", userID, role).Limit(1).Find(&assignment)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find role assignment: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return &assignment, nil
+	}
+	if err := s.db.Create(&assignment).Error; err != nil {
+		return nil, fmt.Errorf("failed to assign role: %w", err)
+	}
+	s.forget(userID)
+	s.logChange(EventTypeRoleAssigned, actor, userID, role, "Assigned "+role)
+	return &assignment, nil
+}
+
+// RevokeRole removes a privileged role from a user. The last administrator keeps theirs,
+// so the admin API can't be locked out.
+func (s *RBACService) RevokeRole(userID uuid.UUID, role string, actor *uuid.UUID) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if role == models.RoleAdmin {
+			var admins int64
+			if err := tx.Model(&models.RoleAssignment{}).Where("role = ? AND user_id <> ?", models.RoleAdmin, userID).
+				Count(&admins).Error; err != nil {
+				return fmt.Errorf("failed to count administrators: %w", err)
+			}
+			if admins == 0 {
+				var held int64
+				if err := tx.Model(&models.RoleAssignment{}).Where("role = ? AND user_id = ?", models.RoleAdmin, userID).
+					Count(&held).Error; err != nil {
+					return fmt.Errorf("failed to find role assignment: %w", err)
+				}
+				if held > 0 {
+					return ErrLastAdmin
+				}
+			}
+		}
+		result := tx.Where("user_id = ? AND role = ?", userID, role).Delete(&models.RoleAssignment{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke role: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrRoleAssignmentNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.forget(userID)
+	s.logChange(EventTypeRoleRevoked, actor, userID, role, "Revoked "+role)
+	return nil
+}
+
+// ListAssignments returns every privileged role assignment, oldest first
+func (s *RBACService) ListAssignments() ([]models.RoleAssignment, error) {
+	var assignments []models.RoleAssignment
+	if err := s.db.Order("created_at ASC").Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list role assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+// UserRoles returns the roles a user holds
+func (s *RBACService) UserRoles(userID uuid.UUID) ([]string, error) {
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.loadedAt) < s.cacheTTL {
+		return cached.roles, nil
+	}
+
+	roles := make([]string, 0)
+	if err := s.db.Model(&models.RoleAssignment{}).Where("user_id = ?", userID).Order("role ASC").
+		Pluck("role", &roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	if len(roles) == 0 && len(s.bootstrapAdmins) > 0 {
+		bootstrapped, err := s.bootstrap(userID)
+		if err != nil {
+			return nil, err
+		}
+		if bootstrapped {
+			roles = []string{models.RoleAdmin}
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[userID] = cachedRoles{roles: roles, loadedAt: now}
+	s.mu.Unlock()
+	return roles, nil
+}
+
+// UserPermissions returns the permissions granted by the roles a user holds
+func (s *RBACService) UserPermissions(userID uuid.UUID) ([]string, error) {
+	roles, err := s.UserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := make([]string, 0)
+	for _, role := range roles {
+		for _, permission := range models.RolePermissions[role] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// HasRole reports whether a user holds any of the given roles
+func (s *RBACService) HasRole(userID uuid.UUID, roles ...string) (bool, error) {
+	held, err := s.UserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if slices.Contains(held, role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// bootstrap makes a listed user an administrator while nobody else is one. The user's email
+// must be verified, or vouched for by Keycloak through a linked account.
+func (s *RBACService) bootstrap(userID uuid.UUID) (bool, error) {
+	var user models.User
+	found := s.db.Select("id", "email").
+		Where("id = ? AND is_active = ? AND (email_verified = ? OR keycloak_id IS NOT NULL)", userID, true, true).
+		Limit(1).Find(&user)
+	if found.Error != nil {
+		return false, fmt.Errorf("failed to get user: %w", found.Error)
+	}
+	if found.RowsAffected == 0 || !s.bootstrapAdmins[strings.ToLower(user.Email)] {
+		return false, nil
+	}
+
+	created := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&models.RoleAssignment{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+			return fmt.Errorf("failed to count administrators: %w", err)
+		}
+		if admins > 0 {
+			return nil
+		}
+		if err := tx.Create(&models.RoleAssignment{UserID: userID, Role: models.RoleAdmin}).Error; err != nil {
+			return fmt.Errorf("failed to assign role: %w", err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil || !created {
+		return false, err
+	}
+	log.Printf("Bootstrapped %s as the first administrator", user.Email)
+	s.logChange(EventTypeRoleAssigned, nil, userID, models.RoleAdmin, "Assigned admin from RBAC_BOOTSTRAP_ADMINS")
+	return true, nil
+}
+
+func (s *RBACService) forget(userID uuid.UUID) {
+	s.mu.Lock()
+	delete(s.cache, userID)
+	s.mu.Unlock()
+}
+
+// logChange records a role change as an authorization audit event, and in the audit log
+// that privilege reviews and the admin timeline read
+func (s *RBACService) logChange(eventType AuditEventType, actor *uuid.UUID, subject uuid.UUID, role, description string) {
+	if s.audit != nil {
+		details := map[string]interface{}{"subject_user_id": subject.String(), "role": role}
+		_ = s.audit.LogEvent(context.Background(), eventType, CategoryAuthorization, AuditSeverityWarning, actor, nil, "", "",
+			"user", string(eventType), OutcomeSuccess, description, details)
+	}
+
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     string(eventType),
+		Resource:   "user",
+		ResourceID: subject.String(),
+		Details:    description,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit role change: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrRedirectNotAllowed is returned for a redirect target or OAuth callback outside the allowlist
+var ErrRedirectNotAllowed = errors.New("redirect target not allowed")
+
+// RedirectAllowlist holds the origins the backend may send browsers to after a sign-in
+// flow, and the origins OAuth providers may return authorization codes to. Anything
+// else is rejected so a tampered or misconfigured URL cannot become an open redirect or
+// leak authorization codes to another host.
+type RedirectAllowlist struct {
+	frontendOrigins map[string]bool
+	callbackOrigins map[string]bool
+}
+
+// NewRedirectAllowlist loads the allowlists from REDIRECT_ALLOWED_ORIGINS and
+// OAUTH_CALLBACK_ALLOWED_ORIGINS. They default to FRONTEND_URL, and to BACKEND_URL plus
+// NEXT_PUBLIC_API_URL (which the Trello callback is built from) when set.
+func NewRedirectAllowlist() *RedirectAllowlist {
+	callbackDefault := getEnv("BACKEND_URL", "http://localhost:8081")
+	if apiURL := getEnv("NEXT_PUBLIC_API_URL", ""); apiURL != "" {
+		callbackDefault += "," + apiURL
+	}
+	return &RedirectAllowlist{
+		frontendOrigins: loadOrigins("REDIRECT_ALLOWED_ORIGINS", getEnv("FRONTEND_URL", "http://localhost:3000")),
+		callbackOrigins: loadOrigins("OAUTH_CALLBACK_ALLOWED_ORIGINS", callbackDefault),
+	}
+}
+
+func loadOrigins(key, fallback string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, entry := range strings.Split(getEnv(key, fallback), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		origin, err := normalizeOrigin(entry)
+		if err != nil {
+			log.Printf("⚠️ Ignoring %s entry %q: %v", key, entry, err)
+			continue
+		}
+		origins[origin] = true
+	}
+	return origins
+}
+
+// normalizeOrigin reduces a URL to its scheme://host[:port] origin. Plain http is only
+// accepted for loopback hosts used in development.
+func normalizeOrigin(raw string) (string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "https" && scheme != "http" {
+		return "", fmt.Errorf("scheme %q is not http or https", parsed.Scheme)
+	}
+	if parsed.Host == "" || parsed.User != nil {
+		return "", errors.New("must be an absolute URL without credentials")
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if scheme == "http" && !isLoopbackHost(host) {
+		return "", errors.New("http is only allowed for localhost")
+	}
+	return scheme + "://" + strings.ToLower(parsed.Host), nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// CheckRedirect verifies a browser redirect target is on an allowed frontend origin
+func (a *RedirectAllowlist) CheckRedirect(target string) error {
+	origin, err := normalizeOrigin(target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedirectNotAllowed, err)
+	}
+	if !a.frontendOrigins[origin] {
+		return fmt.Errorf("%w: origin %s", ErrRedirectNotAllowed, origin)
+	}
+	return nil
+}
+
+// CheckCallback verifies an OAuth redirect URI is this backend's callback for the
+// provider on an allowed origin, with nothing extra a provider would echo back
+func (a *RedirectAllowlist) CheckCallback(provider, redirectURI string) error {
+	origin, err := normalizeOrigin(redirectURI)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedirectNotAllowed, err)
+	}
+	if !a.callbackOrigins[origin] {
+		return fmt.Errorf("%w: callback origin %s", ErrRedirectNotAllowed, origin)
+	}
+	parsed, _ := url.Parse(redirectURI)
+	if parsed.Path != "/oauth/"+provider+"/callback" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("%w: callback path %s", ErrRedirectNotAllowed, parsed.Path)
+	}
+	return nil
+}
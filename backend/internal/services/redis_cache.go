@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisCache is a Cache in Redis 6.2 or later, which every instance shares. It speaks
+// just enough of the Redis protocol for GET, SET with an expiry, GETDEL and DEL over a
+// small pool of connections.
+type RedisCache struct {
+	addr      string
+	username  string
+	password  string
+	db        int
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	idle      chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply from Redis, after which the connection is still usable
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisCache creates a cache in the Redis server at a redis:// or, for TLS, rediss://
+// URL such as redis://:password@host:6379/0. Up to REDIS_POOL_SIZE connections are kept
+// open and each command times out after REDIS_TIMEOUT.
+func NewRedisCache(rawURL string) (*RedisCache, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	cache := &RedisCache{
+		timeout: envDuration("REDIS_TIMEOUT", 3*time.Second),
+		idle:    make(chan *redisConn, max(envInt("REDIS_POOL_SIZE", 10), 1)),
+	}
+	switch parsed.Scheme {
+	case "redis":
+	case "rediss":
+		cache.tlsConfig = &tls.Config{ServerName: parsed.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("unsupported Redis URL scheme %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, errors.New("Redis URL has no host")
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "6379"
+	}
+	cache.addr = net.JoinHostPort(parsed.Hostname(), port)
+	if parsed.User != nil {
+		cache.username = parsed.User.Username()
+		cache.password, _ = parsed.User.Password()
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" {
+		if cache.db, err = strconv.Atoi(db); err != nil || cache.db < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return cache, nil
+}
+
+// Get returns the value cached for key
+func (r *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return r.bulk(r.do(ctx, "GET", key))
+}
+
+// Set caches value for key for ttl
+func (r *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := r.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	return err
+}
+
+// Take returns the value cached for key and deletes it
+func (r *RedisCache) Take(ctx context.Context, key string) ([]byte, error) {
+	return r.bulk(r.do(ctx, "GETDEL", key))
+}
+
+// Delete drops the value cached for key
+func (r *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", key)
+	return err
+}
+
+// Ping checks that Redis answers
+func (r *RedisCache) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections
+func (r *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-r.idle:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (r *RedisCache) bulk(reply interface{}, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrCacheMiss
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return value, nil
+}
+
+// do runs a command on a pooled connection. Connections that fail are closed rather than
+// returned to the pool, since a reply may be left unread on them.
+func (r *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.command(ctx, r.timeout, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.conn.Close()
+		return nil, err
+	}
+	select {
+	case r.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+	return reply, err
+}
+
+func (r *RedisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-r.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: r.timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	if r.tlsConfig != nil {
+		netConn = tls.Client(netConn, r.tlsConfig)
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := conn.command(ctx, r.timeout, args...); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("failed to authenticate to Redis: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.command(ctx, r.timeout, "SELECT", strconv.Itoa(r.db)); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("failed to select Redis database %d: %w", r.db, err)
+		}
+	}
+	return conn, nil
+}
+
+// command writes a command as an array of bulk strings and reads its reply
+func (c *redisConn) command(ctx context.Context, timeout time.Duration, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads one reply: a simple string, error, integer, bulk string or array. Nil
+// bulk strings and arrays are returned as nil.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, value); err != nil {
+			return nil, err
+		}
+		return value[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
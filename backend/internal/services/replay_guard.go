@@ -0,0 +1,262 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Replay cache entry kinds
+const (
+	ReplayKindSAMLAssertion = "saml_assertion"
+	ReplayKindOIDCIDToken   = "oidc_id_token"
+	ReplayKindKerberosAuth  = "kerberos_authenticator"
+)
+
+// authNonceTTL is how long a user has to finish an OIDC sign-in after starting it
+const authNonceTTL = 10 * time.Minute
+
+var (
+	// ErrTokenReplayed is returned when an assertion or ID token has already been accepted
+	ErrTokenReplayed = errors.New("assertion or token has already been used")
+	// ErrTokenNotYetValid is returned before an assertion or token's NotBefore / nbf
+	ErrTokenNotYetValid = errors.New("assertion or token is not yet valid")
+	// ErrTokenExpired is returned at or after an assertion or token's NotOnOrAfter / exp
+	ErrTokenExpired = errors.New("assertion or token has expired")
+	// ErrInvalidAssertion is returned for an assertion or token missing required fields
+	ErrInvalidAssertion = errors.New("invalid assertion or token")
+	// ErrInvalidNonce is returned when an ID token's nonce was not issued or was already used
+	ErrInvalidNonce = errors.New("invalid or reused nonce")
+)
+
+// TokenSource identifies where an inbound assertion or token came from, for alerts
+type TokenSource struct {
+	Provider  string
+	IPAddress string
+	UserAgent string
+}
+
+// idTokenClaims are the OIDC ID token claims checked before a sign-in is accepted
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+}
+
+// ReplayGuard rejects inbound SAML assertions and OIDC ID tokens outside their validity
+// window, or presented more than once. Accepted IDs are kept in the database until they
+// expire so every instance shares the cache.
+type ReplayGuard struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+	skew     time.Duration
+}
+
+// NewReplayGuard creates a replay guard. The security monitoring service raises replay
+// alerts and may be nil in tests.
+func NewReplayGuard(db *gorm.DB, security *SecurityMonitoringService) *ReplayGuard {
+	return &ReplayGuard{
+		db:       db,
+		security: security,
+		skew:     envDuration("ASSERTION_CLOCK_SKEW", 2*time.Minute),
+	}
+}
+
+// IssueNonce creates a single-use nonce to send with an OIDC authorization request
+func (g *ReplayGuard) IssueNonce(provider string, now time.Time) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(bytes)
+	if err := g.db.Create(&models.AuthNonce{Value: nonce, Provider: provider, ExpiresAt: now.Add(authNonceTTL)}).Error; err != nil {
+		return "", fmt.Errorf("failed to store nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// CheckSAMLAssertion validates an assertion's validity window, allowing for clock skew,
+// and records its ID. The earliest of the NotOnOrAfter values given (Conditions and
+// SubjectConfirmationData) applies; at least one is required so no assertion is accepted
+// indefinitely.
+func (g *ReplayGuard) CheckSAMLAssertion(issuer, assertionID, notBefore string, notOnOrAfter []string, source TokenSource, now time.Time) error {
+	if assertionID == "" {
+		return fmt.Errorf("%w: assertion ID is required", ErrInvalidAssertion)
+	}
+	var expiresAt time.Time
+	for _, value := range notOnOrAfter {
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("%w: NotOnOrAfter: %v", ErrInvalidAssertion, err)
+		}
+		if expiresAt.IsZero() || parsed.Before(expiresAt) {
+			expiresAt = parsed
+		}
+	}
+	if expiresAt.IsZero() {
+		return fmt.Errorf("%w: NotOnOrAfter is required", ErrInvalidAssertion)
+	}
+	var startsAt *time.Time
+	if notBefore != "" {
+		parsed, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return fmt.Errorf("%w: NotBefore: %v", ErrInvalidAssertion, err)
+		}
+		startsAt = &parsed
+	}
+
+	if err := g.checkWindow(startsAt, expiresAt, now); err != nil {
+		return err
+	}
+	return g.consume(ReplayKindSAMLAssertion, issuer, assertionID, expiresAt, source)
+}
+
+// CheckIDToken validates an ID token received directly from the provider's token
+// endpoint over TLS, where OIDC Core 3.1.3.7 allows the TLS server validation to stand
+// in for signature checks: issuer, audience, validity window, an issued nonce, and that
+// it has not been used before. Tokens without a jti are keyed by their hash.
+func (g *ReplayGuard) CheckIDToken(idToken, clientID string, source TokenSource, now time.Time) error {
+	if idToken == "" {
+		return fmt.Errorf("%w: ID token is required", ErrInvalidAssertion)
+	}
+	var claims idTokenClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, &claims); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+
+	switch {
+	case claims.Issuer == "":
+		return fmt.Errorf("%w: iss is required", ErrInvalidAssertion)
+	case claims.ExpiresAt == nil:
+		return fmt.Errorf("%w: exp is required", ErrInvalidAssertion)
+	case clientID != "" && !containsValue(claims.Audience, clientID):
+		return fmt.Errorf("%w: audience does not include this client", ErrInvalidAssertion)
+	}
+
+	var startsAt *time.Time
+	if claims.NotBefore != nil {
+		startsAt = &claims.NotBefore.Time
+	}
+	if err := g.checkWindow(startsAt, claims.ExpiresAt.Time, now); err != nil {
+		return err
+	}
+	if claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(g.skew)) {
+		return fmt.Errorf("%w: issued in the future", ErrTokenNotYetValid)
+	}
+
+	// Check for replay first: a replayed token's nonce is already spent
+	id := claims.ID
+	if id == "" {
+		sum := sha256.Sum256([]byte(idToken))
+		id = hex.EncodeToString(sum[:])
+	}
+	if err := g.consume(ReplayKindOIDCIDToken, claims.Issuer, id, claims.ExpiresAt.Time, source); err != nil {
+		return err
+	}
+	return g.consumeNonce(source.Provider, claims.Nonce, now)
+}
+
+// CheckKerberosAuthenticator accepts a Kerberos authenticator once, and only while its
+// client timestamp is within the clock skew (RFC 4120 section 3.2.3)
+func (g *ReplayGuard) CheckKerberosAuthenticator(realm, principal string, ctime time.Time, cusec int, source TokenSource, now time.Time) error {
+	if ctime.Before(now.Add(-g.skew)) {
+		return fmt.Errorf("%w: authenticator time %s", ErrTokenExpired, ctime.UTC().Format(time.RFC3339))
+	}
+	if ctime.After(now.Add(g.skew)) {
+		return fmt.Errorf("%w: authenticator time %s", ErrTokenNotYetValid, ctime.UTC().Format(time.RFC3339))
+	}
+	id := fmt.Sprintf("%s/%d.%06d", principal, ctime.Unix(), cusec)
+	return g.consume(ReplayKindKerberosAuth, realm, id, ctime.Add(g.skew), source)
+}
+
+func (g *ReplayGuard) checkWindow(notBefore *time.Time, notOnOrAfter, now time.Time) error {
+	if notBefore != nil && now.Add(g.skew).Before(*notBefore) {
+		return fmt.Errorf("%w: valid from %s", ErrTokenNotYetValid, notBefore.UTC().Format(time.RFC3339))
+	}
+	if !now.Add(-g.skew).Before(notOnOrAfter) {
+		return fmt.Errorf("%w: expired at %s", ErrTokenExpired, notOnOrAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (g *ReplayGuard) consumeNonce(provider, nonce string, now time.Time) error {
+	if nonce == "" {
+		return fmt.Errorf("%w: ID token has no nonce", ErrInvalidNonce)
+	}
+	result := g.db.Where("value = ? AND provider = ? AND expires_at > ?", nonce, provider, now).Delete(&models.AuthNonce{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to check nonce: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidNonce
+	}
+	return nil
+}
+
+// consume records an accepted ID until it expires; finding it already recorded is a replay
+func (g *ReplayGuard) consume(kind, issuer, id string, expiresAt time.Time, source TokenSource) error {
+	entry := models.ReplayCacheEntry{
+		Key:       strings.Join([]string{kind, issuer, id}, ":"),
+		Kind:      kind,
+		Issuer:    issuer,
+		ExpiresAt: expiresAt.Add(g.skew),
+	}
+	result := g.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record %s: %w", kind, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	g.raiseReplayAlert(kind, issuer, id, source)
+	return fmt.Errorf("%w: %s %s", ErrTokenReplayed, kind, id)
+}
+
+func (g *ReplayGuard) raiseReplayAlert(kind, issuer, id string, source TokenSource) {
+	log.Printf("🚨 Replayed %s from %s (issuer %s) rejected", kind, source.IPAddress, issuer)
+	if g.security == nil {
+		return
+	}
+	_, err := g.security.GenerateAlert(
+		AlertTypeTokenReplay,
+		SeverityHigh,
+		"Replayed sign-in assertion",
+		fmt.Sprintf("A %s from %s was presented again and rejected", strings.ReplaceAll(kind, "_", " "), issuer),
+		map[string]interface{}{
+			"provider":     source.Provider,
+			"issuer":       issuer,
+			"kind":         kind,
+			"assertion_id": id,
+			"ip_address":   source.IPAddress,
+			"user_agent":   source.UserAgent,
+		},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to raise replay alert: %v", err)
+	}
+}
+
+// PurgeExpired deletes expired replay cache entries and unused nonces
+func (g *ReplayGuard) PurgeExpired(now time.Time) error {
+	if err := g.db.Where("expires_at <= ?", now).Delete(&models.ReplayCacheEntry{}).Error; err != nil {
+		return fmt.Errorf("failed to purge replay cache: %w", err)
+	}
+	if err := g.db.Where("expires_at <= ?", now).Delete(&models.AuthNonce{}).Error; err != nil {
+		return fmt.Errorf("failed to purge nonces: %w", err)
+	}
+	return nil
+}
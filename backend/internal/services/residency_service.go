@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	// ErrCrossRegionQuery is returned when a tenant's query reaches another region's database
+	ErrCrossRegionQuery = errors.New("cross-region query refused")
+	// ErrRegionUnavailable is returned when a tenant's region has no database connection.
+	// Tenant data never falls back to another region.
+	ErrRegionUnavailable = errors.New("data residency region unavailable")
+)
+
+// residency routes tenant data to regional databases. It is set by SetResidencyService; when
+// nil every tenant is served by the primary database.
+var residency *ResidencyService
+
+type tenantContextKey struct{}
+
+// RegionStatus describes one data residency region
+type RegionStatus struct {
+	Region    string   `json:"region"`
+	Home      bool     `json:"home"`
+	Connected bool     `json:"connected"`
+	Tenants   []string `json:"tenants"`
+}
+
+// ResidencyService keeps each tenant's data in its region. A tenant is an email domain;
+// DATA_RESIDENCY_TENANTS maps tenants to regions and unmapped tenants live in the home
+// region, served by the primary database. Each region's connection refuses queries made
+// on behalf of a tenant pinned elsewhere, and audit entries record the region they are
+// stored in.
+type ResidencyService struct {
+	primary *gorm.DB
+	home    string
+	regions map[string]*gorm.DB
+	tenants map[string]string
+}
+
+// NewResidencyService creates a new residency service and connects to the regional
+// databases in DATA_RESIDENCY_REGIONS, each at DATABASE_URL_<REGION>
+func NewResidencyService(primary *gorm.DB) *ResidencyService {
+	s := &ResidencyService{
+		primary: primary,
+		home:    strings.ToLower(getEnv("DATA_RESIDENCY_HOME_REGION", "primary")),
+		regions: make(map[string]*gorm.DB),
+		tenants: make(map[string]string),
+	}
+	s.AddRegion(s.home, primary)
+
+	for _, entry := range strings.Split(getEnv("DATA_RESIDENCY_TENANTS", ""), ",") {
+		tenant, region, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || strings.TrimSpace(tenant) == "" || strings.TrimSpace(region) == "" {
+			if strings.TrimSpace(entry) != "" {
+				log.Printf("⚠️ Ignoring DATA_RESIDENCY_TENANTS entry %q", entry)
+			}
+			continue
+		}
+		s.tenants[strings.ToLower(strings.TrimSpace(tenant))] = strings.ToLower(strings.TrimSpace(region))
+	}
+
+	for _, region := range strings.Split(getEnv("DATA_RESIDENCY_REGIONS", ""), ",") {
+		region = strings.ToLower(strings.TrimSpace(region))
+		if region == "" || region == s.home {
+			continue
+		}
+		db, err := openRegionalDatabase(region)
+		if err != nil {
+			log.Printf("⚠️ Data residency region %s unavailable: %v", region, err)
+			continue
+		}
+		s.AddRegion(region, db)
+		log.Printf("🌍 Data residency region %s connected", region)
+	}
+	return s
+}
+
+// SetResidencyService makes audit logging route tenant entries to their region
+func SetResidencyService(s *ResidencyService) {
+	residency = s
+}
+
+// AddRegion serves a region from a database connection and installs the residency guard on it
+func (s *ResidencyService) AddRegion(region string, db *gorm.DB) {
+	s.regions[region] = db
+
+	guard := func(tx *gorm.DB) {
+		tenant, ok := TenantFromContext(tx.Statement.Context)
+		if !ok {
+			return
+		}
+		if pinned := s.RegionFor(tenant); pinned != region {
+			tx.AddError(fmt.Errorf("%w: tenant %s is pinned to %s, not %s", ErrCrossRegionQuery, tenant, pinned, region))
+		}
+	}
+	stamp := func(tx *gorm.DB) {
+		if tx.Statement.Schema == nil || tx.Statement.Schema.LookUpField("Region") == nil {
+			return
+		}
+		if table := tx.Statement.Schema.Table; table == "audit_logs" || table == "audit_events" {
+			tx.Statement.SetColumn("Region", region, true)
+		}
+	}
+
+	callbacks := db.Callback()
+	if callbacks.Query().Get("residency:guard") != nil {
+		return
+	}
+	for _, err := range []error{
+		callbacks.Query().Before("gorm:query").Register("residency:guard", guard),
+		callbacks.Row().Before("gorm:row").Register("residency:guard", guard),
+		callbacks.Raw().Before("gorm:raw").Register("residency:guard", guard),
+		callbacks.Create().Before("gorm:create").Register("residency:guard", guard),
+		callbacks.Create().Before("gorm:create").Register("residency:region", stamp),
+		callbacks.Update().Before("gorm:update").Register("residency:guard", guard),
+		callbacks.Delete().Before("gorm:delete").Register("residency:guard", guard),
+	} {
+		if err != nil {
+			log.Printf("Failed to register residency callback for region %s: %v", region, err)
+		}
+	}
+}
+
+// WithTenant marks a context as acting on behalf of a tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, strings.ToLower(tenant))
+}
+
+// TenantFromContext returns the tenant a context acts for
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// TenantForEmail returns the tenant a user belongs to: the domain of their email address
+func TenantForEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// RegionFor returns the region a tenant's data is stored in
+func (s *ResidencyService) RegionFor(tenant string) string {
+	if region, ok := s.tenants[strings.ToLower(tenant)]; ok {
+		return region
+	}
+	return s.home
+}
+
+// ForTenant returns the database for a tenant's region, scoped so that every query made
+// through it is checked against the tenant's region
+func (s *ResidencyService) ForTenant(ctx context.Context, tenant string) (*gorm.DB, string, error) {
+	region := s.RegionFor(tenant)
+	db, ok := s.regions[region]
+	if !ok {
+		return nil, region, fmt.Errorf("%w: %s (tenant %s)", ErrRegionUnavailable, region, tenant)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tenant == "" {
+		return db.WithContext(ctx), region, nil
+	}
+	return db.WithContext(WithTenant(ctx, tenant)), region, nil
+}
+
+// ForUser returns the database for a user's tenant. Users themselves live in the primary
+// database, which serves as the directory for every region.
+func (s *ResidencyService) ForUser(ctx context.Context, userID uuid.UUID) (*gorm.DB, string, error) {
+	var user models.User
+	if err := s.primary.WithContext(ctx).Select("email").First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.ForTenant(ctx, "")
+		}
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	return s.ForTenant(ctx, TenantForEmail(user.Email))
+}
+
+// TenantRegions returns the tenant-to-region map
+func (s *ResidencyService) TenantRegions() map[string]string {
+	regions := make(map[string]string, len(s.tenants))
+	for tenant, region := range s.tenants {
+		regions[tenant] = region
+	}
+	return regions
+}
+
+// Regions lists the configured regions, their connection state and their tenants
+func (s *ResidencyService) Regions() []RegionStatus {
+	byRegion := map[string]*RegionStatus{}
+	status := func(region string) *RegionStatus {
+		if existing, ok := byRegion[region]; ok {
+			return existing
+		}
+		_, connected := s.regions[region]
+		byRegion[region] = &RegionStatus{Region: region, Home: region == s.home, Connected: connected, Tenants: []string{}}
+		return byRegion[region]
+	}
+	for region := range s.regions {
+		status(region)
+	}
+	for tenant, region := range s.tenants {
+		entry := status(region)
+		entry.Tenants = append(entry.Tenants, tenant)
+	}
+
+	regions := make([]RegionStatus, 0, len(byRegion))
+	for _, entry := range byRegion {
+		sort.Strings(entry.Tenants)
+		regions = append(regions, *entry)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].Home != regions[j].Home {
+			return regions[i].Home
+		}
+		return regions[i].Region < regions[j].Region
+	})
+	return regions
+}
+
+// regionalDatabases returns the database of each region, the home region's included
+func (s *ResidencyService) regionalDatabases() []*gorm.DB {
+	databases := make([]*gorm.DB, 0, len(s.regions))
+	for _, db := range s.regions {
+		databases = append(databases, db)
+	}
+	return databases
+}
+
+// auditDB returns the database an audit entry about a user is written to
+func auditDB(ctx context.Context, userID *uuid.UUID, fallback *gorm.DB) *gorm.DB {
+	if residency == nil || userID == nil {
+		return fallback
+	}
+	db, _, err := residency.ForUser(ctx, *userID)
+	if err != nil {
+		log.Printf("⚠️ Audit entry for user %s stays in the home region: %v", userID, err)
+		return fallback
+	}
+	return db
+}
+
+func openRegionalDatabase(region string) (*gorm.DB, error) {
+	url := getEnv("DATABASE_URL_"+strings.ToUpper(strings.ReplaceAll(region, "-", "_")), "")
+	if url == "" {
+		return nil, fmt.Errorf("DATABASE_URL_%s is not set", strings.ToUpper(strings.ReplaceAll(region, "-", "_")))
+	}
+
+	var dialector gorm.Dialector
+	if path, ok := strings.CutPrefix(url, "sqlite://"); ok {
+		dialector = sqlite.Open(path)
+	} else {
+		dialector = postgres.Open(url)
+	}
+	// Users live in the primary database, so regional tables cannot reference them
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+		DisableForeignKeyConstraintWhenMigrating: true,
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := TraceQueries(db); err != nil {
+		log.Printf("⚠️ Queries in region %s will not be traced: %v", region, err)
+	}
+	if getEnv("RUN_MIGRATIONS", "false") == "true" {
+		if err := migrateModels(db); err != nil {
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+	return db, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"cloudgate-backend/internal/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -10,27 +11,119 @@ import (
 	"gorm.io/gorm"
 )
 
-// RiskAssessment represents a risk assessment record
+// RiskAssessment represents a risk assessment record. Its nested fields are stored as JSON,
+// in jsonb columns on Postgres.
 type RiskAssessment struct {
-	ID                uuid.UUID `gorm:"type:text;primary_key" json:"id"`
-	UserID            uuid.UUID `gorm:"type:text;not null;index" json:"user_id"`
-	SessionID         string    `gorm:"type:text" json:"session_id"`
-	IPAddress         string    `gorm:"type:text" json:"ip_address"`
-	UserAgent         string    `gorm:"type:text" json:"user_agent"`
-	Location          string    `gorm:"type:text" json:"location"` // JSON serialized LocationInfo
-	DeviceFingerprint string    `gorm:"type:text" json:"device_fingerprint"`
-	BehaviorSignals   string    `gorm:"type:text" json:"behavior_signals"` // JSON serialized
-	RiskScore         float64   `gorm:"not null" json:"risk_score"`
-	RiskLevel         string    `gorm:"type:text;not null" json:"risk_level"`
-	Factors           string    `gorm:"type:text" json:"risk_factors"`    // JSON serialized
-	Recommendations   string    `gorm:"type:text" json:"recommendations"` // JSON serialized
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                uuid.UUID        `gorm:"type:text;primary_key" json:"id"`
+	UserID            uuid.UUID        `gorm:"type:text;not null;index" json:"user_id"`
+	SessionID         string           `gorm:"type:text" json:"session_id"`
+	IPAddress         string           `gorm:"type:text" json:"ip_address"`
+	UserAgent         string           `gorm:"type:text" json:"user_agent"`
+	Location          *LocationInfo    `gorm:"type:jsonb;serializer:json" json:"location,omitempty"`
+	DeviceFingerprint string           `gorm:"type:text" json:"device_fingerprint"`
+	BehaviorSignals   *BehaviorSignals `gorm:"type:jsonb;serializer:json" json:"behavior_signals,omitempty"`
+	RiskScore         float64          `gorm:"not null" json:"risk_score"`
+	RiskLevel         models.RiskLevel `gorm:"type:text;not null;check:chk_risk_assessments_risk_level,risk_level IN ('low','medium','high','critical')" json:"risk_level"`
+	Factors           RiskFactorList   `gorm:"type:jsonb;serializer:json" json:"risk_factors"`
+	Recommendations   []string         `gorm:"type:jsonb;serializer:json" json:"recommendations"`
+	// Clients have always seen when an assessment was made as its timestamp
+	CreatedAt time.Time `json:"timestamp"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	// Relationships
 	User models.User `gorm:"foreignKey:UserID" json:"-"`
 }
 
+// LocationInfo is where an assessed sign-in came from
+type LocationInfo struct {
+	Country   string  `json:"country"`
+	Region    string  `json:"region"`
+	City      string  `json:"city"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+	ISP       string  `json:"isp"`
+	IsVPN     bool    `json:"is_vpn"`
+	IsTor     bool    `json:"is_tor"`
+	IsProxy   bool    `json:"is_proxy"`
+	// Autonomous system announcing the address, when GeoIP knows it
+	ASN            uint   `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+}
+
+// BehaviorSignals are how the user typed, moved the mouse and navigated while signing in
+type BehaviorSignals struct {
+	TypingPattern     TypingPattern     `json:"typing_pattern"`
+	MouseMovement     MouseMovement     `json:"mouse_movement"`
+	NavigationPattern NavigationPattern `json:"navigation_pattern"`
+	TimePatterns      TimePatterns      `json:"time_patterns"`
+}
+
+type TypingPattern struct {
+	AvgKeydownTime float64   `json:"avg_keydown_time"`
+	AvgKeyupTime   float64   `json:"avg_keyup_time"`
+	TypingRhythm   float64   `json:"typing_rhythm"`
+	PausePatterns  []float64 `json:"pause_patterns"`
+}
+
+type MouseMovement struct {
+	AvgSpeed        float64 `json:"avg_speed"`
+	ClickFrequency  float64 `json:"click_frequency"`
+	MovementPattern string  `json:"movement_pattern"`
+	ScrollBehavior  float64 `json:"scroll_behavior"`
+}
+
+type NavigationPattern struct {
+	PageSequence    []string `json:"page_sequence"`
+	SessionDuration float64  `json:"session_duration"`
+	ClickDepth      int      `json:"click_depth"`
+	BackButtonUsage int      `json:"back_button_usage"`
+}
+
+type TimePatterns struct {
+	LoginTime        string  `json:"login_time"`
+	TypicalHours     []int   `json:"typical_hours"`
+	WeekdayPattern   []int   `json:"weekday_pattern"`
+	SessionFrequency float64 `json:"session_frequency"`
+}
+
+// RiskFactor is one reason an assessment scored as it did
+type RiskFactor struct {
+	Type        string  `json:"type"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+	Score       float64 `json:"score"`
+	Severity    string  `json:"severity"`
+}
+
+// RiskFactorList is an assessment's risk factors. Assessments stored before the factors
+// were typed kept adaptive authentication's per-category scores or plain factor names, and
+// both still load.
+type RiskFactorList []RiskFactor
+
+// UnmarshalJSON reads a list of factors, a list of factor names or per-category scores
+func (l *RiskFactorList) UnmarshalJSON(data []byte) error {
+	var factors []RiskFactor
+	if err := json.Unmarshal(data, &factors); err == nil {
+		*l = factors
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err == nil {
+		*l = make(RiskFactorList, 0, len(names))
+		for _, name := range names {
+			*l = append(*l, RiskFactor{Type: name})
+		}
+		return nil
+	}
+	var scores RiskFactors
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return fmt.Errorf("invalid risk factors: %w", err)
+	}
+	*l = scores.list()
+	return nil
+}
+
 // BeforeCreate hook for RiskAssessment
 func (r *RiskAssessment) BeforeCreate(tx *gorm.DB) error {
 	if r.ID == uuid.Nil {
@@ -39,6 +132,14 @@ func (r *RiskAssessment) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// BeforeSave rejects risk levels outside the enum
+func (r *RiskAssessment) BeforeSave(tx *gorm.DB) error {
+	if !r.RiskLevel.Valid() {
+		return fmt.Errorf("invalid risk level %q", r.RiskLevel)
+	}
+	return nil
+}
+
 // RiskThresholds represents configurable risk scoring thresholds
 type RiskThresholds struct {
 	ID              uuid.UUID `gorm:"type:text;primary_key" json:"id"`
@@ -114,166 +215,107 @@ func (w *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
 }
 
 // StoreRiskAssessment stores a risk assessment in the database
-func StoreRiskAssessment(assessment interface{}) error {
-	db := GetDB()
+func StoreRiskAssessment(ctx context.Context, assessment *RiskAssessment) error {
+	db, cancel := withDB(ctx, GetDB())
+	defer cancel()
+	return db.Create(assessment).Error
+}
 
-	// Convert the assessment to our internal structure
-	assessmentData, err := json.Marshal(assessment)
+// GetLatestRiskAssessment retrieves the latest risk assessment for a user
+func GetLatestRiskAssessment(ctx context.Context, userID string) (*RiskAssessment, error) {
+	userUUID, err := uuid.Parse(userID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal assessment: %w", err)
-	}
-
-	var assessmentMap map[string]interface{}
-	if err := json.Unmarshal(assessmentData, &assessmentMap); err != nil {
-		return fmt.Errorf("failed to unmarshal assessment: %w", err)
-	}
-
-	// Extract user ID
-	userIDStr, ok := assessmentMap["user_id"].(string)
-	if !ok {
-		return fmt.Errorf("invalid user_id in assessment")
+		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	userID, err := uuid.Parse(userIDStr)
+	db, cancel := withDB(ctx, GetDB())
+	defer cancel()
+	assessment, found, err := latestRiskAssessment(db, userUUID, time.Time{})
 	if err != nil {
-		return fmt.Errorf("invalid user_id format: %w", err)
+		return nil, fmt.Errorf("failed to get latest risk assessment: %w", err)
 	}
-
-	// Serialize complex fields
-	locationJSON, _ := json.Marshal(assessmentMap["location"])
-	behaviorJSON, _ := json.Marshal(assessmentMap["behavior_signals"])
-	factorsJSON, _ := json.Marshal(assessmentMap["risk_factors"])
-	recommendationsJSON, _ := json.Marshal(assessmentMap["recommendations"])
-
-	// Create database record
-	riskAssessment := RiskAssessment{
-		UserID:            userID,
-		SessionID:         getStringField(assessmentMap, "session_id"),
-		IPAddress:         getStringField(assessmentMap, "ip_address"),
-		UserAgent:         getStringField(assessmentMap, "user_agent"),
-		Location:          string(locationJSON),
-		DeviceFingerprint: getStringField(assessmentMap, "device_fingerprint"),
-		BehaviorSignals:   string(behaviorJSON),
-		RiskScore:         getFloatField(assessmentMap, "risk_score"),
-		RiskLevel:         getStringField(assessmentMap, "risk_level"),
-		Factors:           string(factorsJSON),
-		Recommendations:   string(recommendationsJSON),
+	if !found {
+		return nil, fmt.Errorf("failed to get latest risk assessment: %w", gorm.ErrRecordNotFound)
 	}
-
-	return db.Create(&riskAssessment).Error
+	return assessment, nil
 }
 
-// GetLatestRiskAssessment retrieves the latest risk assessment for a user
-func GetLatestRiskAssessment(userID string) (interface{}, error) {
-	db := GetDB()
-
+// GetRiskAssessmentHistory retrieves risk assessment history for a user, newest first
+func GetRiskAssessmentHistory(ctx context.Context, userID string, limit int) ([]RiskAssessment, error) {
 	userUUID, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 
-	var assessment RiskAssessment
-	err = db.Where("user_id = ?", userUUID).
-		Order("created_at DESC").
-		First(&assessment).Error
-
+	db, cancel := withDB(ctx, GetDB())
+	defer cancel()
+	assessments, err := riskAssessmentsOf(db, userUUID).limit(limit).find()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get latest risk assessment: %w", err)
+		return nil, fmt.Errorf("failed to get risk assessment history: %w", err)
 	}
+	return assessments, nil
+}
 
-	// Convert back to the expected format
-	result := map[string]interface{}{
-		"user_id":            assessment.UserID.String(),
-		"session_id":         assessment.SessionID,
-		"ip_address":         assessment.IPAddress,
-		"user_agent":         assessment.UserAgent,
-		"device_fingerprint": assessment.DeviceFingerprint,
-		"risk_score":         assessment.RiskScore,
-		"risk_level":         assessment.RiskLevel,
-		"timestamp":          assessment.CreatedAt,
+// ListRiskAssessments returns a page of a user's risk assessments and how many match the
+// page's filter in all
+func ListRiskAssessments(ctx context.Context, userID uuid.UUID, page ListPage) ([]RiskAssessment, int64, error) {
+	db, cancel := withDB(ctx, GetDB())
+	defer cancel()
+	var assessments []RiskAssessment
+	total, err := page.find(db.Model(&RiskAssessment{}).Where("user_id = ?", userID), "created_at DESC", &assessments)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list risk assessments: %w", err)
 	}
+	return assessments, total, nil
+}
 
-	// Deserialize JSON fields
-	if assessment.Location != "" {
-		var location interface{}
-		json.Unmarshal([]byte(assessment.Location), &location)
-		result["location"] = location
+// latestRiskAssessment returns the user's newest assessment made after since, reporting
+// whether there is one
+func latestRiskAssessment(db *gorm.DB, userID uuid.UUID, since time.Time) (*RiskAssessment, bool, error) {
+	assessments, err := riskAssessmentsOf(db, userID).since(since).limit(1).find()
+	if err != nil || len(assessments) == 0 {
+		return nil, false, err
 	}
+	return &assessments[0], true, nil
+}
 
-	if assessment.BehaviorSignals != "" {
-		var behavior interface{}
-		json.Unmarshal([]byte(assessment.BehaviorSignals), &behavior)
-		result["behavior_signals"] = behavior
-	}
+// riskAssessmentQuery selects a user's risk assessments, newest first
+type riskAssessmentQuery struct {
+	tx *gorm.DB
+}
 
-	if assessment.Factors != "" {
-		var factors interface{}
-		json.Unmarshal([]byte(assessment.Factors), &factors)
-		result["risk_factors"] = factors
-	}
+func riskAssessmentsOf(db *gorm.DB, userID uuid.UUID) riskAssessmentQuery {
+	return riskAssessmentQuery{tx: db.Model(&RiskAssessment{}).Where("user_id = ?", userID).Order("created_at DESC")}
+}
 
-	if assessment.Recommendations != "" {
-		var recommendations interface{}
-		json.Unmarshal([]byte(assessment.Recommendations), &recommendations)
-		result["recommendations"] = recommendations
+// since keeps assessments made after t; the zero time keeps them all
+func (q riskAssessmentQuery) since(t time.Time) riskAssessmentQuery {
+	if t.IsZero() {
+		return q
 	}
-
-	return result, nil
+	return riskAssessmentQuery{tx: q.tx.Where("created_at > ?", t)}
 }
 
-// GetRiskAssessmentHistory retrieves risk assessment history for a user
-func GetRiskAssessmentHistory(userID string, limit int) ([]interface{}, error) {
-	db := GetDB()
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+// limit keeps the newest n assessments; zero or less keeps them all
+func (q riskAssessmentQuery) limit(n int) riskAssessmentQuery {
+	if n <= 0 {
+		return q
 	}
+	return riskAssessmentQuery{tx: q.tx.Limit(n)}
+}
 
+func (q riskAssessmentQuery) find() ([]RiskAssessment, error) {
 	var assessments []RiskAssessment
-	query := db.Where("user_id = ?", userUUID).
-		Order("created_at DESC")
-
-	if limit > 0 {
-		query = query.Limit(limit)
-	}
-
-	err = query.Find(&assessments).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to get risk assessment history: %w", err)
-	}
-
-	// Convert to expected format
-	results := make([]interface{}, len(assessments))
-	for i, assessment := range assessments {
-		result := map[string]interface{}{
-			"user_id":            assessment.UserID.String(),
-			"session_id":         assessment.SessionID,
-			"ip_address":         assessment.IPAddress,
-			"user_agent":         assessment.UserAgent,
-			"device_fingerprint": assessment.DeviceFingerprint,
-			"risk_score":         assessment.RiskScore,
-			"risk_level":         assessment.RiskLevel,
-			"timestamp":          assessment.CreatedAt,
-		}
-
-		// Deserialize JSON fields
-		if assessment.Location != "" {
-			var location interface{}
-			json.Unmarshal([]byte(assessment.Location), &location)
-			result["location"] = location
-		}
-
-		results[i] = result
-	}
-
-	return results, nil
+	err := q.tx.Find(&assessments).Error
+	return assessments, err
 }
 
 // UpdateRiskThresholds updates risk scoring thresholds
 func UpdateRiskThresholds(thresholds map[string]float64) error {
-	db := GetDB()
+	return saveRiskThresholds(GetDB(), thresholds)
+}
 
+func saveRiskThresholds(db *gorm.DB, thresholds map[string]float64) error {
 	// Get or create risk thresholds record
 	var riskThresholds RiskThresholds
 	err := db.First(&riskThresholds).Error
@@ -308,7 +350,48 @@ func UpdateRiskThresholds(thresholds map[string]float64) error {
 		}
 	}
 
-	return db.Save(&riskThresholds).Error
+	if err := db.Save(&riskThresholds).Error; err != nil {
+		return err
+	}
+	recordConfigChange(ConfigKindThresholds, "risk_thresholds", nil, "Risk thresholds updated", riskThresholdMap(riskThresholds))
+	return nil
+}
+
+// restoreRiskThresholds puts the risk thresholds back to recorded values
+func restoreRiskThresholds(db *gorm.DB, snapshot []byte) error {
+	var thresholds map[string]float64
+	if err := json.Unmarshal(snapshot, &thresholds); err != nil {
+		return fmt.Errorf("invalid risk thresholds snapshot: %w", err)
+	}
+	return saveRiskThresholds(db, thresholds)
+}
+
+// riskThresholdValues returns the stored risk thresholds keyed like UpdateRiskThresholds
+// accepts them, or nil when they were never changed from the defaults
+func riskThresholdValues(db *gorm.DB) (map[string]float64, error) {
+	var riskThresholds RiskThresholds
+	err := db.First(&riskThresholds).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get risk thresholds: %w", err)
+	}
+	return riskThresholdMap(riskThresholds), nil
+}
+
+func riskThresholdMap(riskThresholds RiskThresholds) map[string]float64 {
+	return map[string]float64{
+		"vpn_risk":         riskThresholds.VPNRisk,
+		"tor_risk":         riskThresholds.TorRisk,
+		"new_device_risk":  riskThresholds.NewDeviceRisk,
+		"off_hours_risk":   riskThresholds.OffHoursRisk,
+		"behavior_risk":    riskThresholds.BehaviorRisk,
+		"location_risk":    riskThresholds.LocationRisk,
+		"low_threshold":    riskThresholds.LowThreshold,
+		"medium_threshold": riskThresholds.MediumThreshold,
+		"high_threshold":   riskThresholds.HighThreshold,
+	}
 }
 
 // IsNewDevice checks if a device fingerprint is new for a user
@@ -457,22 +540,3 @@ func DeleteWebAuthnCredential(userID, credentialID string) error {
 	return db.Where("user_id = ? AND credential_id = ?", userUUID, credentialID).
 		Delete(&WebAuthnCredential{}).Error
 }
-
-// Helper functions
-func getStringField(data map[string]interface{}, key string) string {
-	if value, exists := data[key]; exists {
-		if str, ok := value.(string); ok {
-			return str
-		}
-	}
-	return ""
-}
-
-func getFloatField(data map[string]interface{}, key string) float64 {
-	if value, exists := data[key]; exists {
-		if f, ok := value.(float64); ok {
-			return f
-		}
-	}
-	return 0.0
-}
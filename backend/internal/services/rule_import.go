@@ -0,0 +1,579 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Rule bundle formats
+const (
+	RuleBundleJSON = "json"
+	RuleBundleYAML = "yaml"
+	RuleBundleCSV  = "csv"
+)
+
+// What an import does with each rule or policy
+const (
+	RuleImportCreate  = "create"
+	RuleImportUpdate  = "update"
+	RuleImportInvalid = "invalid"
+)
+
+// ErrInvalidRuleBundle is returned for a bundle that cannot be read at all
+var ErrInvalidRuleBundle = errors.New("invalid rule bundle")
+
+// ruleConditionOperators are the operators a detection rule condition may use: the
+// playbook condition operators and their symbolic forms
+var ruleConditionOperators = map[string]bool{
+	"=": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true,
+}
+
+// ruleCSVColumns are the columns of a CSV rule bundle. Each row is one condition; rows
+// with the same name make up one rule, and the other columns are read from its first row.
+var ruleCSVColumns = []string{"name", "description", "type", "severity", "enabled", "field", "operator", "value", "time_window", "actions"}
+
+var knownRuleTypes = map[RuleType]bool{
+	RuleTypeThreshold: true, RuleTypeAnomaly: true, RuleTypePattern: true,
+	RuleTypeGeolocation: true, RuleTypeFrequency: true, RuleTypeCorrelation: true,
+}
+
+// RuleBundle is a set of detection rules and response policies (playbooks), as kept
+// under version control and imported together
+type RuleBundle struct {
+	Rules    []SecurityRule       `json:"rules"`
+	Policies []PlaybookDefinition `json:"policies"`
+}
+
+// RuleImportItem is the validation outcome for one rule or policy in a bundle
+type RuleImportItem struct {
+	Kind     string   `json:"kind"`  // rule, policy
+	Index    int      `json:"index"` // position in the bundle, from 1
+	Name     string   `json:"name"`
+	Action   string   `json:"action"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RuleImportReport lists what an import did, or would do, for each rule and policy. A
+// bundle with any error is not applied at all.
+type RuleImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Valid    bool             `json:"valid"`
+	Applied  bool             `json:"applied"`
+	Errors   int              `json:"errors"`
+	Warnings int              `json:"warnings"`
+	Items    []RuleImportItem `json:"items"`
+}
+
+// ParseRuleBundle reads a bundle in JSON, YAML or CSV. JSON and YAML bundles hold rules
+// and policies and reject unknown fields; CSV bundles hold only rules.
+func ParseRuleBundle(data []byte, format string) (*RuleBundle, error) {
+	switch format {
+	case RuleBundleCSV:
+		return parseRuleBundleCSV(data)
+	case RuleBundleYAML:
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRuleBundle, err)
+		}
+		converted, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRuleBundle, err)
+		}
+		data = converted
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var bundle RuleBundle
+	if err := decoder.Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleBundle, err)
+	}
+	if len(bundle.Rules) == 0 && len(bundle.Policies) == 0 {
+		return nil, fmt.Errorf("%w: bundle has no rules or policies", ErrInvalidRuleBundle)
+	}
+	return &bundle, nil
+}
+
+// parseRuleBundleCSV reads rules from CSV. Values that parse as JSON, such as numbers or
+// ["CN","RU"], keep their type. Actions are separated by semicolons, each optionally
+// followed by query-style parameters: lock_account?duration=30m;notify_admin
+func parseRuleBundleCSV(data []byte) (*RuleBundle, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header row", ErrInvalidRuleBundle)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "field", "operator"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing %s column (columns are %s)", ErrInvalidRuleBundle, required, strings.Join(ruleCSVColumns, ", "))
+		}
+	}
+
+	bundle := &RuleBundle{}
+	byName := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRuleBundle, err)
+		}
+		line, _ := reader.FieldPos(0)
+		cell := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		name := cell("name")
+		index, seen := byName[name]
+		if !seen {
+			enabled := true
+			if value := cell("enabled"); value != "" {
+				if enabled, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("%w: line %d: enabled must be true or false", ErrInvalidRuleBundle, line)
+				}
+			}
+			actions, err := parseCSVRuleActions(cell("actions"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRuleBundle, line, err)
+			}
+			bundle.Rules = append(bundle.Rules, SecurityRule{
+				Name:        name,
+				Description: cell("description"),
+				Type:        RuleType(cell("type")),
+				Severity:    AlertSeverity(cell("severity")),
+				Enabled:     enabled,
+				Actions:     actions,
+			})
+			index = len(bundle.Rules) - 1
+			byName[name] = index
+		}
+		bundle.Rules[index].Conditions = append(bundle.Rules[index].Conditions, RuleCondition{
+			Field:      cell("field"),
+			Operator:   cell("operator"),
+			Value:      csvConditionValue(cell("value")),
+			TimeWindow: cell("time_window"),
+		})
+	}
+	if len(bundle.Rules) == 0 {
+		return nil, fmt.Errorf("%w: bundle has no rules", ErrInvalidRuleBundle)
+	}
+	return bundle, nil
+}
+
+func csvConditionValue(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+		return decoded
+	}
+	return value
+}
+
+func parseCSVRuleActions(value string) ([]RuleAction, error) {
+	var actions []RuleAction
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		actionType, query, _ := strings.Cut(entry, "?")
+		action := RuleAction{Type: ActionType(strings.TrimSpace(actionType))}
+		if query != "" {
+			values, err := url.ParseQuery(query)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameters for action %s: %v", actionType, err)
+			}
+			action.Parameters = make(map[string]interface{}, len(values))
+			for key := range values {
+				action.Parameters[key] = values.Get(key)
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// RuleImportService validates rule bundles and applies them in one step: policies are
+// created or updated by name in a single transaction, then detection rules are created
+// or updated by name. Nothing missing from a bundle is deleted.
+type RuleImportService struct {
+	db       *gorm.DB
+	security *SecurityMonitoringService
+}
+
+// NewRuleImportService creates a new rule import service
+func NewRuleImportService(db *gorm.DB, security *SecurityMonitoringService) *RuleImportService {
+	return &RuleImportService{db: db, security: security}
+}
+
+// Import validates a bundle and, unless dryRun is set or any item has an error, applies it
+func (s *RuleImportService) Import(bundle *RuleBundle, dryRun bool, actor *uuid.UUID, now time.Time) (*RuleImportReport, error) {
+	var playbooks []models.Playbook
+	if err := s.db.Select("id", "name", "definition").Find(&playbooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load playbooks: %w", err)
+	}
+	existingPolicies := make(map[string]PlaybookDefinition, len(playbooks))
+	for _, playbook := range playbooks {
+		existingPolicies[playbook.Name] = playbookDetail(playbook).Definition
+	}
+	existingRules := make(map[string]SecurityRule)
+	for _, rule := range s.security.GetSecurityRules() {
+		existingRules[rule.Name] = rule
+	}
+
+	report := &RuleImportReport{DryRun: dryRun}
+	report.Items = append(report.Items, validateRules(bundle.Rules, existingRules)...)
+	report.Items = append(report.Items, validatePolicies(bundle.Policies, existingPolicies)...)
+	for _, item := range report.Items {
+		report.Errors += len(item.Errors)
+		report.Warnings += len(item.Warnings)
+	}
+	report.Valid = report.Errors == 0
+	if !report.Valid || dryRun {
+		return report, nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, definition := range bundle.Policies {
+			playbook := playbookFromDefinition(definition)
+			if _, exists := existingPolicies[definition.Name]; exists {
+				err := tx.Model(&models.Playbook{}).Where("name = ?", definition.Name).Updates(map[string]interface{}{
+					"description": playbook.Description,
+					"enabled":     playbook.Enabled,
+					"definition":  playbook.Definition,
+				}).Error
+				if err != nil {
+					return fmt.Errorf("failed to update policy %s: %w", definition.Name, err)
+				}
+				continue
+			}
+			playbook.CreatedBy = actor
+			if err := tx.Create(&playbook).Error; err != nil {
+				return fmt.Errorf("failed to create policy %s: %w", definition.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.security.importSecurityRules(bundle.Rules, now)
+	report.Applied = true
+
+	for _, item := range report.Items {
+		key, snapshot := "rule:"+item.Name, interface{}(bundle.Rules[item.Index-1])
+		if item.Kind == "policy" {
+			key, snapshot = "playbook:"+item.Name, bundle.Policies[item.Index-1]
+		}
+		summary := "Created by bundle import"
+		if item.Action == RuleImportUpdate {
+			summary = "Updated by bundle import"
+		}
+		recordConfigChange(ConfigKindRules, key, actor, summary, snapshot)
+	}
+	auditLog := models.AuditLog{
+		UserID:   actor,
+		Action:   "rules_imported",
+		Resource: "security_rules",
+		Details:  fmt.Sprintf("Imported %d rule(s) and %d policy(ies)", len(bundle.Rules), len(bundle.Policies)),
+		Status:   "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit rule import: %v", err)
+	}
+	return report, nil
+}
+
+// validateRules checks each rule and looks for rules that would fire together: an enabled
+// rule with the same conditions as another is an error, and one whose conditions include
+// all of another's is a warning, since both fire whenever the stricter one does
+func validateRules(rules []SecurityRule, existing map[string]SecurityRule) []RuleImportItem {
+	items := make([]RuleImportItem, len(rules))
+	effective := make(map[string]SecurityRule, len(existing)+len(rules))
+	for name, rule := range existing {
+		effective[name] = rule
+	}
+	seen := make(map[string]int)
+	for i, rule := range rules {
+		item := RuleImportItem{Kind: "rule", Index: i + 1, Name: rule.Name, Action: RuleImportCreate}
+		if _, ok := existing[rule.Name]; ok {
+			item.Action = RuleImportUpdate
+		}
+		item.Errors = validateSecurityRule(rule)
+		if first, ok := seen[rule.Name]; ok && rule.Name != "" {
+			item.Errors = append(item.Errors, fmt.Sprintf("name is also used by rule %d", first))
+		} else {
+			seen[rule.Name] = i + 1
+		}
+		effective[rule.Name] = rule
+		items[i] = item
+	}
+
+	for i, rule := range rules {
+		if !rule.Enabled || len(items[i].Errors) > 0 {
+			continue
+		}
+		conditions := conditionKeys(rule.Conditions)
+		names := make([]string, 0, len(effective))
+		for name := range effective {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			other := effective[name]
+			if name == rule.Name || !other.Enabled || other.Type != rule.Type {
+				continue
+			}
+			otherConditions := conditionKeys(other.Conditions)
+			switch {
+			case len(conditions) == len(otherConditions) && containsAllKeys(conditions, otherConditions):
+				items[i].Errors = append(items[i].Errors, fmt.Sprintf("conditions are the same as rule %q", name))
+			case containsAllKeys(conditions, otherConditions):
+				items[i].Warnings = append(items[i].Warnings, fmt.Sprintf("conditions overlap rule %q, which fires whenever this rule does", name))
+			}
+		}
+	}
+	for i := range items {
+		if len(items[i].Errors) > 0 {
+			items[i].Action = RuleImportInvalid
+		}
+	}
+	return items
+}
+
+func validateSecurityRule(rule SecurityRule) []string {
+	var problems []string
+	if strings.TrimSpace(rule.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	if !knownRuleTypes[rule.Type] {
+		problems = append(problems, fmt.Sprintf("unknown rule type %q", rule.Type))
+	}
+	if !rule.Severity.Valid() {
+		problems = append(problems, fmt.Sprintf("unknown severity %q", rule.Severity))
+	}
+	if len(rule.Conditions) == 0 {
+		problems = append(problems, "at least one condition is required")
+	}
+	for i, condition := range rule.Conditions {
+		if problem := validateRuleCondition(condition); problem != "" {
+			problems = append(problems, fmt.Sprintf("condition %d: %s", i+1, problem))
+		}
+	}
+	if len(rule.Actions) == 0 {
+		problems = append(problems, "at least one action is required")
+	}
+	for i, action := range rule.Actions {
+		if !knownActionTypes[action.Type] {
+			problems = append(problems, fmt.Sprintf("action %d: unknown action %q", i+1, action.Type))
+			continue
+		}
+		if _, err := actionExpiry(action.Parameters, time.Minute, time.Now()); err != nil {
+			problems = append(problems, fmt.Sprintf("action %d: %v", i+1, err))
+		}
+	}
+	return problems
+}
+
+func validateRuleCondition(condition RuleCondition) string {
+	if strings.TrimSpace(condition.Field) == "" {
+		return "field is required"
+	}
+	if !conditionOperators[condition.Operator] && !ruleConditionOperators[condition.Operator] {
+		return fmt.Sprintf("unknown operator %q", condition.Operator)
+	}
+	if condition.TimeWindow != "" {
+		if window, err := time.ParseDuration(condition.TimeWindow); err != nil || window <= 0 {
+			return fmt.Sprintf("invalid time window %q", condition.TimeWindow)
+		}
+	}
+	switch condition.Operator {
+	case "exists", "not_exists":
+		return ""
+	case "in":
+		if _, ok := condition.Value.([]interface{}); !ok {
+			return "in needs a list of values"
+		}
+	case "gt", "gte", "lt", "lte", ">", ">=", "<", "<=":
+		if _, ok := comparableNumber(condition.Field, condition.Value); !ok {
+			return fmt.Sprintf("%s needs a number", condition.Operator)
+		}
+	}
+	if condition.Value == nil {
+		return "value is required"
+	}
+	return ""
+}
+
+// conditionKeys identifies conditions by field, operator, value and window
+func conditionKeys(conditions []RuleCondition) map[string]bool {
+	keys := make(map[string]bool, len(conditions))
+	for _, condition := range conditions {
+		value, _ := json.Marshal(condition.Value)
+		keys[fmt.Sprintf("%s|%s|%s|%s", condition.Field, condition.Operator, value, condition.TimeWindow)] = true
+	}
+	return keys
+}
+
+func containsAllKeys(superset, subset map[string]bool) bool {
+	for key := range subset {
+		if !superset[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePolicies checks each policy and warns when two enabled policies can trigger on
+// the same alert and both run an action, which would then run twice
+func validatePolicies(policies []PlaybookDefinition, existing map[string]PlaybookDefinition) []RuleImportItem {
+	items := make([]RuleImportItem, len(policies))
+	effective := make(map[string]PlaybookDefinition, len(existing)+len(policies))
+	for name, definition := range existing {
+		effective[name] = definition
+	}
+	seen := make(map[string]int)
+	for i, definition := range policies {
+		item := RuleImportItem{Kind: "policy", Index: i + 1, Name: definition.Name, Action: RuleImportCreate}
+		if _, ok := existing[definition.Name]; ok {
+			item.Action = RuleImportUpdate
+		}
+		if err := definition.Validate(); err != nil {
+			item.Errors = append(item.Errors, strings.TrimPrefix(err.Error(), ErrInvalidPlaybook.Error()+": "))
+		}
+		if first, ok := seen[definition.Name]; ok && definition.Name != "" {
+			item.Errors = append(item.Errors, fmt.Sprintf("name is also used by policy %d", first))
+		} else {
+			seen[definition.Name] = i + 1
+		}
+		effective[definition.Name] = definition
+		items[i] = item
+	}
+
+	for i, definition := range policies {
+		if len(items[i].Errors) > 0 || (definition.Enabled != nil && !*definition.Enabled) {
+			continue
+		}
+		names := make([]string, 0, len(effective))
+		for name := range effective {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			other := effective[name]
+			if name == definition.Name || (other.Enabled != nil && !*other.Enabled) || !triggersOverlap(definition.Trigger, other.Trigger) {
+				continue
+			}
+			for action := range playbookActions(definition.Steps) {
+				if playbookActions(other.Steps)[action] {
+					items[i].Warnings = append(items[i].Warnings, fmt.Sprintf("policy %q also runs %s for some of the same alerts", name, action))
+				}
+			}
+		}
+	}
+	for i := range items {
+		if len(items[i].Errors) > 0 {
+			items[i].Action = RuleImportInvalid
+		}
+	}
+	return items
+}
+
+func triggersOverlap(a, b PlaybookTrigger) bool {
+	return valuesOverlap(a.AlertTypes, b.AlertTypes) && valuesOverlap(a.Severities, b.Severities)
+}
+
+// valuesOverlap reports whether two trigger lists share a value; an empty list matches anything
+func valuesOverlap[T comparable](a, b []T) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, value := range a {
+		if containsValue(b, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func playbookActions(steps []PlaybookStep) map[ActionType]bool {
+	actions := make(map[ActionType]bool)
+	for _, step := range steps {
+		if step.Action != "" {
+			actions[step.Action] = true
+		}
+		for action := range playbookActions(step.Parallel) {
+			actions[action] = true
+		}
+	}
+	return actions
+}
+
+// GetSecurityRules returns the detection rules
+func (s *SecurityMonitoringService) GetSecurityRules() []SecurityRule {
+	s.ruleEngine.mutex.RLock()
+	defer s.ruleEngine.mutex.RUnlock()
+	return append([]SecurityRule(nil), s.ruleEngine.rules...)
+}
+
+// importSecurityRules creates or updates detection rules by name; updated rules keep
+// their ID and creation time
+func (s *SecurityMonitoringService) importSecurityRules(rules []SecurityRule, now time.Time) {
+	s.ruleEngine.mutex.Lock()
+	defer s.ruleEngine.mutex.Unlock()
+	byName := make(map[string]int, len(s.ruleEngine.rules))
+	for i, rule := range s.ruleEngine.rules {
+		byName[rule.Name] = i
+	}
+	for _, rule := range rules {
+		rule.UpdatedAt = now
+		if i, ok := byName[rule.Name]; ok {
+			rule.ID, rule.CreatedAt = s.ruleEngine.rules[i].ID, s.ruleEngine.rules[i].CreatedAt
+			s.ruleEngine.rules[i] = rule
+			continue
+		}
+		rule.ID, rule.CreatedAt = uuid.New(), now
+		s.ruleEngine.rules = append(s.ruleEngine.rules, rule)
+		byName[rule.Name] = len(s.ruleEngine.rules) - 1
+	}
+}
+
+// restoreSecurityRule puts a detection rule back to a recorded version
+func (s *SecurityMonitoringService) restoreSecurityRule(name string, snapshot []byte, actor *uuid.UUID) error {
+	var rule SecurityRule
+	if err := json.Unmarshal(snapshot, &rule); err != nil {
+		return fmt.Errorf("invalid rule snapshot: %w", err)
+	}
+	rule.Name = name
+	s.importSecurityRules([]SecurityRule{rule}, time.Now())
+	recordConfigChange(ConfigKindRules, "rule:"+name, actor, "Rule restored", rule)
+	return nil
+}
@@ -3,6 +3,11 @@ package services
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"cloudgate-backend/internal/models"
@@ -12,10 +17,15 @@ import (
 	"github.com/google/uuid"
 )
 
-var saasApps map[string]*types.SaaSApplication
+var (
+	saasApps   map[string]*types.SaaSApplication
+	saasAppsMu sync.RWMutex
+)
 
 // InitializeSaaSApps initializes the SaaS applications catalog
 func InitializeSaaSApps() {
+	saasAppsMu.Lock()
+	defer saasAppsMu.Unlock()
 	saasApps = make(map[string]*types.SaaSApplication)
 
 	// Google Workspace
@@ -27,8 +37,15 @@ func InitializeSaaSApps() {
 		Category:    "productivity",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"google.com", "gmail.com"},
+		DataAccess: []string{
+			"Email address and basic profile",
+			"Gmail messages (read-only)",
+			"Google Drive file metadata",
+			"Calendar events",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Microsoft 365
@@ -40,8 +57,15 @@ func InitializeSaaSApps() {
 		Category:    "productivity",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"office.com", "microsoft365.com", "outlook.com", "live.com", "sharepoint.com"},
+		DataAccess: []string{
+			"Email address and basic profile",
+			"Outlook mail (read-only)",
+			"Calendar events",
+			"OneDrive file metadata",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Slack
@@ -53,8 +77,14 @@ func InitializeSaaSApps() {
 		Category:    "communication",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"slack.com"},
+		DataAccess: []string{
+			"Workspace member list and email addresses",
+			"Public channel list",
+			"Posting messages on your behalf",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// GitHub
@@ -66,8 +96,14 @@ func InitializeSaaSApps() {
 		Category:    "development",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"github.com"},
+		DataAccess: []string{
+			"Email address and public profile",
+			"Repositories, including private ones",
+			"Organization membership",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Trello
@@ -79,8 +115,13 @@ func InitializeSaaSApps() {
 		Category:    "productivity",
 		Protocol:    "oauth1",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"trello.com"},
+		DataAccess: []string{
+			"Account profile",
+			"Boards, lists and cards",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Salesforce
@@ -92,8 +133,13 @@ func InitializeSaaSApps() {
 		Category:    "crm",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"salesforce.com", "force.com"},
+		DataAccess: []string{
+			"Email address and basic profile",
+			"CRM records accessible to your account",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Jira
@@ -105,8 +151,14 @@ func InitializeSaaSApps() {
 		Category:    "productivity",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"atlassian.net", "atlassian.com"},
+		DataAccess: []string{
+			"Account profile",
+			"Projects and issues",
+			"Creating and updating issues",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Notion
@@ -118,8 +170,13 @@ func InitializeSaaSApps() {
 		Category:    "productivity",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"notion.so"},
+		DataAccess: []string{
+			"Workspace profile",
+			"Pages and databases shared with CloudGate",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 
 	// Dropbox
@@ -131,13 +188,57 @@ func InitializeSaaSApps() {
 		Category:    "storage",
 		Protocol:    "oauth2",
 		Status:      "available",
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Domains:     []string{"dropbox.com"},
+		DataAccess: []string{
+			"Account profile",
+			"File and folder metadata",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// SharePoint Server (WS-Federation relying party)
+	saasApps["sharepoint-server"] = &types.SaaSApplication{
+		ID:          "sharepoint-server",
+		Name:        "SharePoint Server",
+		Icon:        "🗂️",
+		Description: "Sign in to on-premises SharePoint sites",
+		Category:    "productivity",
+		Protocol:    constants.ProtocolWSFed,
+		Status:      "available",
+		DataAccess: []string{
+			"Email address and display name",
+		},
+		Config: map[string]string{
+			"realm":     getEnv("SHAREPOINT_WSFED_REALM", "urn:sharepoint:cloudgate"),
+			"reply_url": getEnv("SHAREPOINT_WSFED_REPLY_URL", "https://sharepoint.example.com/_trust/"),
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// Intranet portal (trusted-header auth behind the CloudGate proxy)
+	saasApps["intranet-portal"] = &types.SaaSApplication{
+		ID:          "intranet-portal",
+		Name:        "Intranet Portal",
+		Icon:        "🏠",
+		Description: "Open internal sites that sign you in through CloudGate",
+		Category:    "productivity",
+		Protocol:    constants.ProtocolHeaderProxy,
+		Status:      "available",
+		LaunchURL:   "/proxy/intranet-portal/",
+		DataAccess: []string{
+			"Username, email address and group memberships",
+		},
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 	}
 }
 
 // GetAllSaaSApps returns all available SaaS applications
 func GetAllSaaSApps() []*types.SaaSApplication {
+	saasAppsMu.RLock()
+	defer saasAppsMu.RUnlock()
 	apps := make([]*types.SaaSApplication, 0, len(saasApps))
 	for _, app := range saasApps {
 		apps = append(apps, app)
@@ -178,10 +279,72 @@ func buildMetadata(dbConn *models.AppConnection) map[string]string {
 
 // GetSaaSApp returns a specific SaaS application by ID
 func GetSaaSApp(appID string) (*types.SaaSApplication, bool) {
+	saasAppsMu.RLock()
+	defer saasAppsMu.RUnlock()
 	app, exists := saasApps[appID]
 	return app, exists
 }
 
+// GetSaaSAppByDomain returns the application served from a host or one of its parent domains
+func GetSaaSAppByDomain(host string) (*types.SaaSApplication, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	saasAppsMu.RLock()
+	defer saasAppsMu.RUnlock()
+	for _, app := range saasApps {
+		for _, domain := range app.Domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return app, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// RegisterSaaSApp adds or replaces an application defined at runtime, such as a bookmark.
+// A replaced application keeps its session policy.
+func RegisterSaaSApp(app *types.SaaSApplication) {
+	saasAppsMu.Lock()
+	defer saasAppsMu.Unlock()
+	if saasApps == nil {
+		saasApps = make(map[string]*types.SaaSApplication)
+	}
+	if existing, ok := saasApps[app.ID]; ok && app.SessionPolicy == nil {
+		app.SessionPolicy = existing.SessionPolicy
+	}
+	saasApps[app.ID] = app
+}
+
+// SetSaaSAppSessionPolicy attaches a session policy to an application in the catalog, or
+// clears it when policy is nil. It reports whether the application exists.
+func SetSaaSAppSessionPolicy(appID string, policy *types.AppSessionPolicy) bool {
+	saasAppsMu.Lock()
+	defer saasAppsMu.Unlock()
+	app, ok := saasApps[appID]
+	if ok {
+		app.SessionPolicy = policy
+	}
+	return ok
+}
+
+// RemoveSaaSApp removes an application defined at runtime from the catalog
+func RemoveSaaSApp(appID string) {
+	saasAppsMu.Lock()
+	defer saasAppsMu.Unlock()
+	delete(saasApps, appID)
+}
+
+// GetWSFedAppByRealm returns the WS-Federation application registered for a wtrealm
+func GetWSFedAppByRealm(realm string) (*types.SaaSApplication, bool) {
+	saasAppsMu.RLock()
+	defer saasAppsMu.RUnlock()
+	for _, app := range saasApps {
+		if app.Protocol == constants.ProtocolWSFed && realm != "" && app.Config["realm"] == realm {
+			return app, true
+		}
+	}
+	return nil, false
+}
+
 // GetUserAppConnections returns all app connections for a user
 func GetUserAppConnections(userID string) map[string]*types.UserAppConnection {
 	userUUID, err := uuid.Parse(userID)
@@ -194,17 +357,7 @@ func GetUserAppConnections(userID string) map[string]*types.UserAppConnection {
 
 	connections := make(map[string]*types.UserAppConnection)
 	for _, dbConn := range dbConnections {
-		connections[dbConn.AppID] = &types.UserAppConnection{
-			UserID:       dbConn.UserID.String(),
-			AppID:        dbConn.AppID,
-			Status:       dbConn.Status,
-			AccessToken:  dbConn.AccessToken,
-			RefreshToken: dbConn.RefreshToken,
-			ExpiresAt:    formatTimePtr(dbConn.TokenExpiresAt),
-			Metadata:     buildMetadata(&dbConn),
-			ConnectedAt:  dbConn.ConnectedAt.Format(time.RFC3339),
-			LastAccessAt: formatTimePtr(dbConn.LastUsed),
-		}
+		connections[dbConn.AppID] = userAppConnection(&dbConn)
 	}
 	return connections
 }
@@ -222,18 +375,36 @@ func GetUserAppConnection(userID, appID string) (*types.UserAppConnection, bool)
 		return nil, false
 	}
 
+	return userAppConnection(&dbConn), true
+}
+
+// userAppConnection converts a stored connection, opening its tokens. A token that cannot
+// be opened is left out, so the connection reads as needing to be authorized again.
+func userAppConnection(dbConn *models.AppConnection) *types.UserAppConnection {
 	connection := &types.UserAppConnection{
 		UserID:       dbConn.UserID.String(),
 		AppID:        dbConn.AppID,
-		Status:       dbConn.Status,
-		AccessToken:  dbConn.AccessToken,
-		RefreshToken: dbConn.RefreshToken,
+		Status:       string(dbConn.Status),
 		ExpiresAt:    formatTimePtr(dbConn.TokenExpiresAt),
-		Metadata:     buildMetadata(&dbConn),
+		Metadata:     buildMetadata(dbConn),
 		ConnectedAt:  dbConn.ConnectedAt.Format(time.RFC3339),
 		LastAccessAt: formatTimePtr(dbConn.LastUsed),
 	}
-	return connection, true
+	if dbConn.AccessToken == "" && dbConn.RefreshToken == "" {
+		return connection
+	}
+	vault, err := activeTokenVault()
+	if err != nil {
+		log.Printf("Failed to open tokens of %s connection: %v", dbConn.AppID, err)
+		return connection
+	}
+	if connection.AccessToken, err = vault.Decrypt(dbConn.AccessToken); err != nil {
+		log.Printf("Failed to open access token of %s connection %s: %v", dbConn.AppID, dbConn.ID, err)
+	}
+	if connection.RefreshToken, err = vault.Decrypt(dbConn.RefreshToken); err != nil {
+		log.Printf("Failed to open refresh token of %s connection %s: %v", dbConn.AppID, dbConn.ID, err)
+	}
+	return connection
 }
 
 // CreateUserAppConnection creates a new app connection for a user
@@ -247,7 +418,7 @@ func CreateUserAppConnection(userID, appID string) *types.UserAppConnection {
 	dbConn := models.AppConnection{
 		UserID:      userUUID,
 		AppID:       appID,
-		Status:      constants.StatusPending,
+		Status:      models.ConnectionPending,
 		ConnectedAt: now,
 	}
 
@@ -256,7 +427,7 @@ func CreateUserAppConnection(userID, appID string) *types.UserAppConnection {
 	return &types.UserAppConnection{
 		UserID:      userID,
 		AppID:       appID,
-		Status:      constants.StatusPending,
+		Status:      string(models.ConnectionPending),
 		ConnectedAt: now.Format(time.RFC3339),
 	}
 }
@@ -277,20 +448,38 @@ func UpdateUserAppConnection(userID, appID string, updates map[string]interface{
 		dbConn = models.AppConnection{
 			UserID:      userUUID,
 			AppID:       appID,
-			Status:      constants.StatusPending,
+			Status:      models.ConnectionPending,
 			ConnectedAt: now,
 		}
 	}
 
 	// Update fields from the updates map
-	if status, ok := updates["status"].(string); ok {
+	switch status := updates["status"].(type) {
+	case models.ConnectionStatus:
 		dbConn.Status = status
+	case string:
+		if dbConn.Status, err = models.ParseConnectionStatus(status); err != nil {
+			return err
+		}
 	}
-	if accessToken, ok := updates["access_token"].(string); ok {
-		dbConn.AccessToken = accessToken
-	}
-	if refreshToken, ok := updates["refresh_token"].(string); ok {
-		dbConn.RefreshToken = refreshToken
+	// Tokens are sealed by the token vault before they reach the database
+	accessToken, hasAccess := updates["access_token"].(string)
+	refreshToken, hasRefresh := updates["refresh_token"].(string)
+	if hasAccess || hasRefresh {
+		vault, err := activeTokenVault()
+		if err != nil {
+			return fmt.Errorf("failed to load token vault: %w", err)
+		}
+		if hasAccess {
+			if dbConn.AccessToken, err = vault.Encrypt(accessToken); err != nil {
+				return fmt.Errorf("failed to encrypt access token: %w", err)
+			}
+		}
+		if hasRefresh {
+			if dbConn.RefreshToken, err = vault.Encrypt(refreshToken); err != nil {
+				return fmt.Errorf("failed to encrypt refresh token: %w", err)
+			}
+		}
 	}
 	if scopes, ok := updates["scope"].(string); ok {
 		dbConn.Scopes = scopes
@@ -314,6 +503,13 @@ func UpdateUserAppConnection(userID, appID string, updates map[string]interface{
 	if appName, ok := updates["app_name"].(string); ok {
 		dbConn.AppName = appName
 	}
+	if extras, ok := updates["extras"].(map[string]string); ok {
+		data, err := json.Marshal(extras)
+		if err != nil {
+			return err
+		}
+		dbConn.Extras = string(data)
+	}
 
 	// Update last access time
 	now := time.Now().UTC()
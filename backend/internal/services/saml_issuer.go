@@ -0,0 +1,439 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/pkg/constants"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Name ID formats a relying party may ask for
+const (
+	SAMLNameIDEmail       = "email"       // the user's email address
+	SAMLNameIDPersistent  = "persistent"  // the user's CloudGate ID, stable across email changes
+	SAMLNameIDUnspecified = "unspecified" // the user's username
+)
+
+var samlNameIDFormats = map[string]string{
+	SAMLNameIDEmail:       "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+	SAMLNameIDPersistent:  "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+	SAMLNameIDUnspecified: "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified",
+}
+
+// samlAttributeSources are the user fields attribute mappings may send
+var samlAttributeSources = map[string]func(*models.User) string{
+	"user_id":      func(u *models.User) string { return u.ID.String() },
+	"email":        func(u *models.User) string { return u.Email },
+	"username":     func(u *models.User) string { return u.Username },
+	"first_name":   func(u *models.User) string { return u.FirstName },
+	"last_name":    func(u *models.User) string { return u.LastName },
+	"display_name": func(u *models.User) string { return strings.TrimSpace(u.FirstName + " " + u.LastName) },
+}
+
+// defaultSAMLAttributeMappings are sent to relying parties that map no attributes
+var defaultSAMLAttributeMappings = map[string]string{
+	"email":     "email",
+	"firstName": "first_name",
+	"lastName":  "last_name",
+	"username":  "username",
+}
+
+const maxAuthnRequestBytes = 64 << 10
+
+var (
+	// ErrSAMLRelyingPartyNotFound is returned for service providers not registered with CloudGate
+	ErrSAMLRelyingPartyNotFound = errors.New("SAML relying party not found")
+	// ErrInvalidSAMLRelyingParty is returned for relying party settings that cannot be used
+	ErrInvalidSAMLRelyingParty = errors.New("invalid SAML relying party")
+	// ErrInvalidAuthnRequest is returned for AuthnRequests that cannot be answered
+	ErrInvalidAuthnRequest = errors.New("invalid SAML AuthnRequest")
+)
+
+// SAMLRelyingPartyInput describes a service provider as entered by an admin
+type SAMLRelyingPartyInput struct {
+	EntityID          string            `json:"entity_id"`
+	ACSURL            string            `json:"acs_url"`
+	NameIDFormat      string            `json:"name_id_format"`
+	AttributeMappings map[string]string `json:"attribute_mappings"`
+}
+
+// SAMLAuthnRequest is a service provider's sign-in request, checked against its registration
+type SAMLAuthnRequest struct {
+	ID           string
+	Issuer       string
+	RelyingParty *models.SAMLRelyingParty
+}
+
+// SAMLSubject is the signed-in CloudGate user a SAML response is issued for
+type SAMLSubject struct {
+	UserID       uuid.UUID
+	AAL          int
+	SessionIndex string
+	// NotOnOrAfter, when set, is the latest the assertion may expire, such as when the
+	// app's session policy ends the session
+	NotOnOrAfter time.Time
+}
+
+// SAMLSignInResponse is posted to the relying party's ACS URL by the browser
+type SAMLSignInResponse struct {
+	ACSURL       string    `json:"acs_url"`
+	SAMLResponse string    `json:"saml_response"` // base64, for the HTTP-POST binding
+	ResponseID   string    `json:"response_id"`
+	AssertionID  string    `json:"assertion_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// SAMLIssuerService makes CloudGate a SAML 2.0 identity provider for registered relying
+// parties. It answers AuthnRequests received over the HTTP-Redirect or HTTP-POST binding
+// with a Response carrying an assertion signed by the managed signing keys, valid for
+// SAML_ASSERTION_LIFETIME and issued as SAML_IDP_ENTITY_ID.
+type SAMLIssuerService struct {
+	db       *gorm.DB
+	entityID string
+	lifetime time.Duration
+	keys     *SigningKeyService
+}
+
+// NewSAMLIssuerService creates a SAML identity provider configured from the environment
+func NewSAMLIssuerService(db *gorm.DB) *SAMLIssuerService {
+	return &SAMLIssuerService{
+		db:       db,
+		entityID: getEnv("SAML_IDP_ENTITY_ID", "CloudGate-SSO"),
+		lifetime: envDuration("SAML_ASSERTION_LIFETIME", 5*time.Minute),
+	}
+}
+
+// UseSigningKeys signs assertions with the managed signing keys
+func (s *SAMLIssuerService) UseSigningKeys(keys *SigningKeyService) {
+	s.keys = keys
+}
+
+// EntityID returns the issuer name relying parties should trust
+func (s *SAMLIssuerService) EntityID() string {
+	return s.entityID
+}
+
+// SetRelyingParty creates or replaces the service provider registered for an app
+func (s *SAMLIssuerService) SetRelyingParty(appID string, input SAMLRelyingPartyInput, actor *uuid.UUID) (*models.SAMLRelyingParty, error) {
+	if app, ok := GetSaaSApp(appID); !ok || app.Protocol != constants.ProtocolSAML {
+		return nil, fmt.Errorf("%w: %s does not sign in with SAML", ErrInvalidSAMLRelyingParty, appID)
+	}
+	input.EntityID = strings.TrimSpace(input.EntityID)
+	if input.EntityID == "" {
+		return nil, fmt.Errorf("%w: entity_id is required", ErrInvalidSAMLRelyingParty)
+	}
+	acs, err := url.Parse(strings.TrimSpace(input.ACSURL))
+	if err != nil || (acs.Scheme != "http" && acs.Scheme != "https") || acs.Host == "" || acs.Fragment != "" {
+		return nil, fmt.Errorf("%w: acs_url must be an absolute http(s) URL", ErrInvalidSAMLRelyingParty)
+	}
+	if input.NameIDFormat == "" {
+		input.NameIDFormat = SAMLNameIDEmail
+	}
+	if _, ok := samlNameIDFormats[input.NameIDFormat]; !ok {
+		return nil, fmt.Errorf("%w: name_id_format must be email, persistent or unspecified", ErrInvalidSAMLRelyingParty)
+	}
+	if len(input.AttributeMappings) == 0 {
+		input.AttributeMappings = defaultSAMLAttributeMappings
+	}
+	for name, source := range input.AttributeMappings {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%w: attribute names must not be empty", ErrInvalidSAMLRelyingParty)
+		}
+		if _, ok := samlAttributeSources[source]; !ok {
+			return nil, fmt.Errorf("%w: unknown user field %q for attribute %s", ErrInvalidSAMLRelyingParty, source, name)
+		}
+	}
+	mappings, err := json.Marshal(input.AttributeMappings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attribute mappings: %w", err)
+	}
+
+	var other models.SAMLRelyingParty
+	err = s.db.Where("entity_id = ? AND app_id <> ?", input.EntityID, appID).First(&other).Error
+	if err == nil {
+		return nil, fmt.Errorf("%w: entity_id is already registered for %s", ErrInvalidSAMLRelyingParty, other.AppID)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to check SAML relying parties: %w", err)
+	}
+
+	var party models.SAMLRelyingParty
+	err = s.db.Where("app_id = ?", appID).First(&party).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get SAML relying party: %w", err)
+	}
+
+	party.AppID = appID
+	party.EntityID = input.EntityID
+	party.ACSURL = acs.String()
+	party.NameIDFormat = input.NameIDFormat
+	party.AttributeMappings = string(mappings)
+	party.UpdatedBy = actor
+
+	if err := s.db.Save(&party).Error; err != nil {
+		return nil, fmt.Errorf("failed to save SAML relying party: %w", err)
+	}
+
+	s.audit(actor, "saml_relying_party_updated", appID, fmt.Sprintf("entity_id=%s acs_url=%s name_id=%s attributes=%d",
+		party.EntityID, party.ACSURL, party.NameIDFormat, len(input.AttributeMappings)))
+	recordConfigChange(ConfigKindPolicies, "saml_relying_party:"+appID, actor, "SAML relying party updated", input)
+	return &party, nil
+}
+
+// GetRelyingParty returns the service provider registered for an app
+func (s *SAMLIssuerService) GetRelyingParty(appID string) (*models.SAMLRelyingParty, error) {
+	var party models.SAMLRelyingParty
+	err := s.db.Where("app_id = ?", appID).First(&party).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrSAMLRelyingPartyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SAML relying party: %w", err)
+	}
+	return &party, nil
+}
+
+// ListRelyingParties returns every registered service provider
+func (s *SAMLIssuerService) ListRelyingParties() ([]models.SAMLRelyingParty, error) {
+	var parties []models.SAMLRelyingParty
+	if err := s.db.Order("app_id ASC").Find(&parties).Error; err != nil {
+		return nil, fmt.Errorf("failed to list SAML relying parties: %w", err)
+	}
+	return parties, nil
+}
+
+// DeleteRelyingParty stops answering an app's service provider
+func (s *SAMLIssuerService) DeleteRelyingParty(appID string, actor *uuid.UUID) error {
+	result := s.db.Where("app_id = ?", appID).Delete(&models.SAMLRelyingParty{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete SAML relying party: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSAMLRelyingPartyNotFound
+	}
+
+	s.audit(actor, "saml_relying_party_deleted", appID, "SAML relying party removed")
+	recordConfigChange(ConfigKindPolicies, "saml_relying_party:"+appID, actor, "SAML relying party removed", nil)
+	return nil
+}
+
+// restoreRelyingParty puts an app's service provider back to a recorded version
+func (s *SAMLIssuerService) restoreRelyingParty(appID string, snapshot []byte, actor *uuid.UUID) error {
+	var input SAMLRelyingPartyInput
+	if err := json.Unmarshal(snapshot, &input); err != nil {
+		return fmt.Errorf("invalid SAML relying party snapshot: %w", err)
+	}
+	_, err := s.SetRelyingParty(appID, input, actor)
+	return err
+}
+
+// ParseAuthnRequest decodes an AuthnRequest, DEFLATE-compressed when it arrived over the
+// HTTP-Redirect binding, and finds the relying party that sent it. The request may only
+// ask for the party's registered ACS URL and the HTTP-POST binding.
+func (s *SAMLIssuerService) ParseAuthnRequest(encoded string, deflated bool) (*SAMLAuthnRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid encoding", ErrInvalidAuthnRequest)
+	}
+	if deflated {
+		inflated, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxAuthnRequestBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid compression", ErrInvalidAuthnRequest)
+		}
+		data = inflated
+	}
+	if len(data) > maxAuthnRequestBytes {
+		return nil, fmt.Errorf("%w: request too large", ErrInvalidAuthnRequest)
+	}
+
+	root, err := parseXMLDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthnRequest, err)
+	}
+	if root.space != saml2ProtocolNamespace || root.local != "AuthnRequest" || root.attr("Version") != "2.0" || root.attr("ID") == "" {
+		return nil, fmt.Errorf("%w: not a SAML 2.0 AuthnRequest", ErrInvalidAuthnRequest)
+	}
+	issuer := root.child(saml2AssertionNamespace, "Issuer")
+	if issuer == nil || strings.TrimSpace(issuer.text()) == "" {
+		return nil, fmt.Errorf("%w: Issuer is required", ErrInvalidAuthnRequest)
+	}
+	request := &SAMLAuthnRequest{ID: root.attr("ID"), Issuer: strings.TrimSpace(issuer.text())}
+
+	var party models.SAMLRelyingParty
+	err = s.db.Where("entity_id = ?", request.Issuer).First(&party).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrSAMLRelyingPartyNotFound, request.Issuer)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SAML relying party: %w", err)
+	}
+	if acs := root.attr("AssertionConsumerServiceURL"); acs != "" && acs != party.ACSURL {
+		return nil, fmt.Errorf("%w: AssertionConsumerServiceURL %q is not registered for %s", ErrInvalidAuthnRequest, acs, party.AppID)
+	}
+	if binding := root.attr("ProtocolBinding"); binding != "" && binding != saml2PostBinding {
+		return nil, fmt.Errorf("%w: responses are only sent with the HTTP-POST binding", ErrInvalidAuthnRequest)
+	}
+	request.RelyingParty = &party
+	return request, nil
+}
+
+// IssueResponse builds a Response to the request with a signed assertion for the subject,
+// valid only for the relying party's entity ID and ACS URL
+func (s *SAMLIssuerService) IssueResponse(request *SAMLAuthnRequest, subject SAMLSubject, now time.Time) (*SAMLSignInResponse, error) {
+	party := request.RelyingParty
+	var user models.User
+	if err := s.db.Where("id = ?", subject.UserID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	nameID, format := samlNameID(party.NameIDFormat, &user)
+	if nameID == "" {
+		return nil, fmt.Errorf("%w: the signed-in user has no %s name ID", ErrInvalidAuthnRequest, party.NameIDFormat)
+	}
+	mappings := map[string]string{}
+	if party.AttributeMappings != "" {
+		if err := json.Unmarshal([]byte(party.AttributeMappings), &mappings); err != nil {
+			return nil, fmt.Errorf("invalid attribute mappings for %s: %w", party.AppID, err)
+		}
+	}
+	privateKey, certificate, err := s.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	expiresAt := now.Add(s.lifetime)
+	if !subject.NotOnOrAfter.IsZero() && subject.NotOnOrAfter.Before(expiresAt) {
+		expiresAt = subject.NotOnOrAfter.UTC()
+	}
+	responseID, assertionID := "_"+uuid.New().String(), "_"+uuid.New().String()
+	sessionIndex := subject.SessionIndex
+	if sessionIndex == "" {
+		sessionIndex = assertionID
+	}
+
+	issued, expires := formatWSFedTime(now), formatWSFedTime(expiresAt)
+	issuer := c14nElement("saml:Issuer", nil, escapeXMLText(s.entityID))
+	body := c14nElement("saml:Subject", nil,
+		c14nElement("saml:NameID", [][2]string{{"Format", format}}, escapeXMLText(nameID))+
+			c14nElement("saml:SubjectConfirmation", [][2]string{{"Method", saml2BearerMethod}},
+				c14nElement("saml:SubjectConfirmationData", [][2]string{{"InResponseTo", request.ID}, {"NotOnOrAfter", expires}, {"Recipient", party.ACSURL}}, ""))) +
+		c14nElement("saml:Conditions", [][2]string{{"NotBefore", issued}, {"NotOnOrAfter", expires}},
+			c14nElement("saml:AudienceRestriction", nil,
+				c14nElement("saml:Audience", nil, escapeXMLText(party.EntityID)))) +
+		c14nElement("saml:AuthnStatement", [][2]string{{"AuthnInstant", issued}, {"SessionIndex", sessionIndex}},
+			c14nElement("saml:AuthnContext", nil,
+				c14nElement("saml:AuthnContextClassRef", nil, samlAuthnContext(subject.AAL)))) +
+		samlAttributeStatement(mappings, &user)
+
+	open := `<saml:Assertion xmlns:saml="` + saml2AssertionNamespace + `"` + c14nAttributes([][2]string{{"ID", assertionID}, {"IssueInstant", issued}, {"Version", "2.0"}}) + `>`
+	closing := `</saml:Assertion>`
+	signature, err := envelopedSignature(privateKey, certificate, assertionID, open+issuer+body+closing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign assertion: %w", err)
+	}
+	// SAML requires the Signature to follow the assertion's Issuer
+	assertion := open + issuer + signature + body + closing
+
+	response := `<samlp:Response xmlns:samlp="` + saml2ProtocolNamespace + `"` +
+		c14nAttributes([][2]string{{"Destination", party.ACSURL}, {"ID", responseID}, {"InResponseTo", request.ID}, {"IssueInstant", issued}, {"Version", "2.0"}}) + `>` +
+		`<saml:Issuer xmlns:saml="` + saml2AssertionNamespace + `">` + escapeXMLText(s.entityID) + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + saml2StatusSuccess + `"></samlp:StatusCode></samlp:Status>` +
+		assertion +
+		`</samlp:Response>`
+
+	return &SAMLSignInResponse{
+		ACSURL:       party.ACSURL,
+		SAMLResponse: base64.StdEncoding.EncodeToString([]byte(response)),
+		ResponseID:   responseID,
+		AssertionID:  assertionID,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// signingKey returns the key and certificate assertions are signed with
+func (s *SAMLIssuerService) signingKey() (*rsa.PrivateKey, *x509.Certificate, error) {
+	if s.keys == nil {
+		return nil, nil, errors.New("SAML signing key is not available")
+	}
+	privateKey, certificate, _, err := s.keys.ActiveKey()
+	return privateKey, certificate, err
+}
+
+// samlNameID returns the subject's name ID in a relying party's format
+func samlNameID(format string, user *models.User) (string, string) {
+	switch format {
+	case SAMLNameIDPersistent:
+		return user.ID.String(), samlNameIDFormats[format]
+	case SAMLNameIDUnspecified:
+		return user.Username, samlNameIDFormats[format]
+	default:
+		return user.Email, samlNameIDFormats[SAMLNameIDEmail]
+	}
+}
+
+// samlAuthnContext describes how strongly the session was authenticated, using the REFEDS
+// MFA profile for step-up sessions
+func samlAuthnContext(aal int) string {
+	if aal >= models.AAL2 {
+		return "https://refeds.org/profile/mfa"
+	}
+	return "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+}
+
+// samlAttributeStatement renders the mapped attributes in name order, leaving out empty values
+func samlAttributeStatement(mappings map[string]string, user *models.User) string {
+	names := make([]string, 0, len(mappings))
+	for name := range mappings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var attributes strings.Builder
+	for _, name := range names {
+		source, ok := samlAttributeSources[mappings[name]]
+		if !ok {
+			log.Printf("⚠️ Skipping SAML attribute %s mapped to unknown field %s", name, mappings[name])
+			continue
+		}
+		value := source(user)
+		if value == "" {
+			continue
+		}
+		attributes.WriteString(c14nElement("saml:Attribute", [][2]string{{"Name", name}, {"NameFormat", "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"}},
+			c14nElement("saml:AttributeValue", nil, escapeXMLText(value))))
+	}
+	if attributes.Len() == 0 {
+		return ""
+	}
+	return c14nElement("saml:AttributeStatement", nil, attributes.String())
+}
+
+func (s *SAMLIssuerService) audit(actor *uuid.UUID, action, appID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "saml_relying_party",
+		ResourceID: appID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit SAML relying party event: %v", err)
+	}
+}
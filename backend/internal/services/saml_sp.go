@@ -0,0 +1,491 @@
+package services
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	saml2AssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	saml2ProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	saml2MetadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	saml2StatusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	saml2BearerMethod       = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	saml2PostBinding        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	maxSAMLMetadataBytes    = 1 << 20
+)
+
+var (
+	// ErrSAMLIdPNotConfigured is returned for apps without a trusted SAML identity provider
+	ErrSAMLIdPNotConfigured = errors.New("no SAML identity provider configured for this app")
+	// ErrInvalidSAMLIdP is returned for identity provider settings or metadata that cannot be used
+	ErrInvalidSAMLIdP = errors.New("invalid SAML identity provider")
+	// ErrInvalidSAMLResponse is returned for SAML responses that fail validation
+	ErrInvalidSAMLResponse = errors.New("invalid SAML response")
+	// ErrSAMLAuthnFailed is returned for well-formed responses reporting a failed sign-in
+	ErrSAMLAuthnFailed = errors.New("SAML authentication failed")
+)
+
+// SAMLIdPInput describes an app's identity provider as entered by an admin: either its
+// metadata, pasted or fetched from MetadataURL, or the entity ID, sign-in URL and signing
+// certificates directly. Values given directly override those in the metadata.
+type SAMLIdPInput struct {
+	MetadataXML  string   `json:"metadata_xml,omitempty"`
+	MetadataURL  string   `json:"metadata_url,omitempty"`
+	EntityID     string   `json:"entity_id,omitempty"`
+	SSOURL       string   `json:"sso_url,omitempty"`
+	Certificates []string `json:"certificates,omitempty"`
+}
+
+// SAMLAssertionInfo is what CloudGate takes from a validated SAML assertion
+type SAMLAssertionInfo struct {
+	ID           string
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	InResponseTo string
+	NotBefore    string
+	NotOnOrAfter []string // from the Conditions and the bearer SubjectConfirmationData
+	Attributes   map[string][]string
+}
+
+// SAMLServiceProvider accepts SAML 2.0 responses for apps that sign users in through their
+// own identity provider. A response is only accepted when the configured IdP signed it, it
+// contains exactly one assertion, and the assertion is addressed to this app's ACS URL and
+// CloudGate's entity ID (SAML_SP_ENTITY_ID). Validity windows and replays are checked by
+// the ReplayGuard.
+type SAMLServiceProvider struct {
+	db       *gorm.DB
+	entityID string
+	baseURL  string
+	client   *http.Client
+}
+
+// NewSAMLServiceProvider creates a SAML service provider configured from the environment
+func NewSAMLServiceProvider(db *gorm.DB) *SAMLServiceProvider {
+	return &SAMLServiceProvider{
+		db:       db,
+		entityID: getEnv("SAML_SP_ENTITY_ID", "CloudGate-SSO"),
+		baseURL:  strings.TrimRight(getEnv("NEXT_PUBLIC_API_URL", "http://localhost:8081"), "/"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// EntityID returns the entity ID CloudGate uses as a service provider
+func (s *SAMLServiceProvider) EntityID() string {
+	return s.entityID
+}
+
+// ACSURL returns where an app's identity provider posts its SAML responses
+func (s *SAMLServiceProvider) ACSURL(appID string) string {
+	return fmt.Sprintf("%s/saml/%s/acs", s.baseURL, appID)
+}
+
+// SetConfig creates or replaces the identity provider trusted for an app
+func (s *SAMLServiceProvider) SetConfig(appID string, input SAMLIdPInput, actor *uuid.UUID) (*models.SAMLIdentityProvider, error) {
+	metadata := input.MetadataXML
+	if metadata == "" && input.MetadataURL != "" && len(input.Certificates) == 0 {
+		fetched, err := s.fetchMetadata(input.MetadataURL)
+		if err != nil {
+			return nil, err
+		}
+		metadata = fetched
+	}
+
+	resolved := SAMLIdPInput{MetadataURL: input.MetadataURL}
+	if metadata != "" {
+		parsed, err := parseSAMLIdPMetadata([]byte(metadata), input.EntityID)
+		if err != nil {
+			return nil, err
+		}
+		resolved.EntityID, resolved.SSOURL, resolved.Certificates = parsed.EntityID, parsed.SSOURL, parsed.Certificates
+	}
+	if input.EntityID != "" {
+		resolved.EntityID = strings.TrimSpace(input.EntityID)
+	}
+	if input.SSOURL != "" {
+		resolved.SSOURL = strings.TrimSpace(input.SSOURL)
+	}
+	if len(input.Certificates) > 0 {
+		resolved.Certificates = input.Certificates
+	}
+
+	if resolved.EntityID == "" {
+		return nil, fmt.Errorf("%w: entity_id is required", ErrInvalidSAMLIdP)
+	}
+	if resolved.SSOURL != "" {
+		if u, err := url.Parse(resolved.SSOURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("%w: sso_url must be an absolute HTTP(S) URL", ErrInvalidSAMLIdP)
+		}
+	}
+	if len(resolved.Certificates) == 0 {
+		return nil, fmt.Errorf("%w: at least one signing certificate is required", ErrInvalidSAMLIdP)
+	}
+	certificates := make([]string, 0, len(resolved.Certificates))
+	for _, value := range resolved.Certificates {
+		certificate, err := parseXMLCertificate(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLIdP, err)
+		}
+		certificates = append(certificates, base64.StdEncoding.EncodeToString(certificate.Raw))
+	}
+	resolved.Certificates = certificates
+
+	var config models.SAMLIdentityProvider
+	err := s.db.Where("app_id = ?", appID).First(&config).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get SAML identity provider: %w", err)
+	}
+
+	config.AppID = appID
+	config.EntityID = resolved.EntityID
+	config.SSOURL = resolved.SSOURL
+	config.Certificates = strings.Join(certificates, "\n")
+	config.MetadataURL = resolved.MetadataURL
+	config.UpdatedBy = actor
+
+	if err := s.db.Save(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to save SAML identity provider: %w", err)
+	}
+
+	s.audit(actor, "saml_idp_updated", appID, fmt.Sprintf("entity_id=%s certificates=%d", config.EntityID, len(certificates)))
+	// The snapshot holds the resolved settings, so restoring it does not fetch metadata again
+	recordConfigChange(ConfigKindPolicies, "saml_idp:"+appID, actor, "SAML identity provider updated", resolved)
+	return &config, nil
+}
+
+// GetConfig returns the identity provider trusted for an app
+func (s *SAMLServiceProvider) GetConfig(appID string) (*models.SAMLIdentityProvider, error) {
+	var config models.SAMLIdentityProvider
+	err := s.db.Where("app_id = ?", appID).First(&config).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrSAMLIdPNotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SAML identity provider: %w", err)
+	}
+	return &config, nil
+}
+
+// ListConfigs returns every app's identity provider
+func (s *SAMLServiceProvider) ListConfigs() ([]models.SAMLIdentityProvider, error) {
+	var configs []models.SAMLIdentityProvider
+	if err := s.db.Order("app_id ASC").Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list SAML identity providers: %w", err)
+	}
+	return configs, nil
+}
+
+// DeleteConfig removes an app's identity provider, after which its SAML responses are refused
+func (s *SAMLServiceProvider) DeleteConfig(appID string, actor *uuid.UUID) error {
+	result := s.db.Where("app_id = ?", appID).Delete(&models.SAMLIdentityProvider{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete SAML identity provider: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSAMLIdPNotConfigured
+	}
+
+	s.audit(actor, "saml_idp_deleted", appID, "SAML identity provider removed")
+	recordConfigChange(ConfigKindPolicies, "saml_idp:"+appID, actor, "SAML identity provider removed", nil)
+	return nil
+}
+
+// restoreConfig puts an app's identity provider back to a recorded version
+func (s *SAMLServiceProvider) restoreConfig(appID string, snapshot []byte, actor *uuid.UUID) error {
+	var input SAMLIdPInput
+	if err := json.Unmarshal(snapshot, &input); err != nil {
+		return fmt.Errorf("invalid SAML identity provider snapshot: %w", err)
+	}
+	_, err := s.SetConfig(appID, input, actor)
+	return err
+}
+
+// fetchMetadata downloads IdP metadata, which must come over HTTPS since it carries the
+// certificates every later response is trusted by
+func (s *SAMLServiceProvider) fetchMetadata(metadataURL string) (string, error) {
+	u, err := url.Parse(metadataURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("%w: metadata_url must be an HTTPS URL", ErrInvalidSAMLIdP)
+	}
+	resp, err := s.client.Get(u.String())
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to fetch metadata: %v", ErrInvalidSAMLIdP, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: metadata URL returned %d", ErrInvalidSAMLIdP, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSAMLMetadataBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to read metadata: %v", ErrInvalidSAMLIdP, err)
+	}
+	if len(body) > maxSAMLMetadataBytes {
+		return "", fmt.Errorf("%w: metadata larger than %d bytes", ErrInvalidSAMLIdP, maxSAMLMetadataBytes)
+	}
+	return string(body), nil
+}
+
+// parseSAMLIdPMetadata reads the entity ID, sign-in URL and signing certificates from an
+// EntityDescriptor, or from the one in an EntitiesDescriptor matching entityID
+func parseSAMLIdPMetadata(data []byte, entityID string) (*SAMLIdPInput, error) {
+	root, err := parseXMLDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidSAMLIdP, err)
+	}
+
+	var candidates []*xmlElement
+	root.walk(func(e *xmlElement) {
+		if e.space == saml2MetadataNamespace && e.local == "EntityDescriptor" && len(e.childElements(saml2MetadataNamespace, "IDPSSODescriptor")) > 0 {
+			if entityID == "" || e.attr("entityID") == entityID {
+				candidates = append(candidates, e)
+			}
+		}
+	})
+	switch {
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("%w: metadata describes no matching identity provider", ErrInvalidSAMLIdP)
+	case len(candidates) > 1:
+		return nil, fmt.Errorf("%w: metadata describes several identity providers; set entity_id", ErrInvalidSAMLIdP)
+	}
+
+	entity := candidates[0]
+	parsed := &SAMLIdPInput{EntityID: entity.attr("entityID")}
+	for _, descriptor := range entity.childElements(saml2MetadataNamespace, "IDPSSODescriptor") {
+		for _, service := range descriptor.childElements(saml2MetadataNamespace, "SingleSignOnService") {
+			if parsed.SSOURL == "" || service.attr("Binding") == saml2PostBinding {
+				parsed.SSOURL = service.attr("Location")
+			}
+		}
+		for _, key := range descriptor.childElements(saml2MetadataNamespace, "KeyDescriptor") {
+			if use := key.attr("use"); use != "" && use != "signing" {
+				continue
+			}
+			key.walk(func(e *xmlElement) {
+				if e.space == xmlDSigNamespace && e.local == "X509Certificate" {
+					parsed.Certificates = append(parsed.Certificates, strings.Join(strings.Fields(e.text()), ""))
+				}
+			})
+		}
+	}
+	return parsed, nil
+}
+
+// ValidateResponse checks a decoded SAML response posted to an app's ACS URL and returns
+// its assertion. The response or the assertion must carry a valid signature from the app's
+// identity provider; values are only read from the signed elements.
+func (s *SAMLServiceProvider) ValidateResponse(appID string, data []byte) (*SAMLAssertionInfo, error) {
+	config, err := s.GetConfig(appID)
+	if err != nil {
+		return nil, err
+	}
+	certificates := make([]*x509.Certificate, 0)
+	for _, value := range strings.Fields(config.Certificates) {
+		certificate, err := parseXMLCertificate(value)
+		if err != nil {
+			log.Printf("⚠️ Ignoring unreadable SAML certificate for app %s: %v", appID, err)
+			continue
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%w: identity provider has no usable certificates", ErrSAMLIdPNotConfigured)
+	}
+
+	response, err := parseXMLDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+	if response.space != saml2ProtocolNamespace || response.local != "Response" {
+		return nil, fmt.Errorf("%w: not a SAML 2.0 Response", ErrInvalidSAMLResponse)
+	}
+
+	// Signature wrapping relies on a second copy of the signed element, so IDs must be
+	// unique and the one assertion must sit directly in the Response
+	ids := map[string]bool{}
+	assertions, encrypted := 0, false
+	var duplicate string
+	response.walk(func(e *xmlElement) {
+		if id := e.attr("ID"); id != "" {
+			if ids[id] {
+				duplicate = id
+			}
+			ids[id] = true
+		}
+		if e.space == saml2AssertionNamespace && e.local == "Assertion" {
+			assertions++
+		}
+		if e.space == saml2AssertionNamespace && e.local == "EncryptedAssertion" {
+			encrypted = true
+		}
+	})
+	switch {
+	case duplicate != "":
+		return nil, fmt.Errorf("%w: duplicate ID %s", ErrInvalidSAMLResponse, duplicate)
+	case encrypted:
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidSAMLResponse)
+	case assertions != 1:
+		return nil, fmt.Errorf("%w: exactly one assertion is required", ErrInvalidSAMLResponse)
+	}
+	assertion := response.child(saml2AssertionNamespace, "Assertion")
+	if assertion == nil {
+		return nil, fmt.Errorf("%w: the assertion must be a child of the Response", ErrInvalidSAMLResponse)
+	}
+
+	signed := false
+	for _, element := range []*xmlElement{response, assertion} {
+		signatures := element.childElements(xmlDSigNamespace, "Signature")
+		if len(signatures) > 1 {
+			return nil, fmt.Errorf("%w: more than one signature", ErrInvalidSAMLResponse)
+		}
+		if len(signatures) == 1 {
+			if err := verifyEnvelopedSignature(element, signatures[0], certificates); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+			}
+			signed = true
+		}
+	}
+	if !signed {
+		return nil, fmt.Errorf("%w: neither the response nor the assertion is signed", ErrInvalidSAMLResponse)
+	}
+
+	if status := response.child(saml2ProtocolNamespace, "Status"); status == nil {
+		return nil, fmt.Errorf("%w: Status is required", ErrInvalidSAMLResponse)
+	} else if code := status.child(saml2ProtocolNamespace, "StatusCode"); code == nil || code.attr("Value") != saml2StatusSuccess {
+		value := ""
+		if code != nil {
+			value = code.attr("Value")
+		}
+		return nil, fmt.Errorf("%w: status %s", ErrSAMLAuthnFailed, value)
+	}
+
+	acsURL := s.ACSURL(appID)
+	if destination := response.attr("Destination"); destination != "" && destination != acsURL {
+		return nil, fmt.Errorf("%w: Destination %s is not this app's ACS URL", ErrInvalidSAMLResponse, destination)
+	}
+	if issuer := response.child(saml2AssertionNamespace, "Issuer"); issuer != nil && strings.TrimSpace(issuer.text()) != config.EntityID {
+		return nil, fmt.Errorf("%w: response issuer is not the app's identity provider", ErrInvalidSAMLResponse)
+	}
+
+	info, err := s.readAssertion(assertion, config.EntityID, acsURL)
+	if err != nil {
+		return nil, err
+	}
+	if inResponseTo := response.attr("InResponseTo"); inResponseTo != "" {
+		if info.InResponseTo != "" && info.InResponseTo != inResponseTo {
+			return nil, fmt.Errorf("%w: InResponseTo does not match the subject confirmation", ErrInvalidSAMLResponse)
+		}
+		info.InResponseTo = inResponseTo
+	}
+	return info, nil
+}
+
+// readAssertion checks the assertion's issuer, audience and bearer subject confirmation
+// and reads the subject and attributes
+func (s *SAMLServiceProvider) readAssertion(assertion *xmlElement, issuerID, acsURL string) (*SAMLAssertionInfo, error) {
+	info := &SAMLAssertionInfo{ID: assertion.attr("ID"), Attributes: map[string][]string{}}
+	if info.ID == "" || assertion.attr("Version") != "2.0" {
+		return nil, fmt.Errorf("%w: assertion must be SAML 2.0 with an ID", ErrInvalidSAMLResponse)
+	}
+	issuer := assertion.child(saml2AssertionNamespace, "Issuer")
+	if issuer == nil || strings.TrimSpace(issuer.text()) != issuerID {
+		return nil, fmt.Errorf("%w: assertion issuer is not the app's identity provider", ErrInvalidSAMLResponse)
+	}
+	info.Issuer = issuerID
+
+	subject := assertion.child(saml2AssertionNamespace, "Subject")
+	if subject == nil {
+		return nil, fmt.Errorf("%w: Subject is required", ErrInvalidSAMLResponse)
+	}
+	nameID := subject.child(saml2AssertionNamespace, "NameID")
+	if nameID == nil || strings.TrimSpace(nameID.text()) == "" {
+		return nil, fmt.Errorf("%w: NameID is required", ErrInvalidSAMLResponse)
+	}
+	info.NameID, info.NameIDFormat = strings.TrimSpace(nameID.text()), nameID.attr("Format")
+
+	// One bearer confirmation must be for this ACS URL; its NotOnOrAfter bounds the assertion
+	confirmed := false
+	for _, confirmation := range subject.childElements(saml2AssertionNamespace, "SubjectConfirmation") {
+		if confirmation.attr("Method") != saml2BearerMethod {
+			continue
+		}
+		data := confirmation.child(saml2AssertionNamespace, "SubjectConfirmationData")
+		if data == nil || data.attr("Recipient") != acsURL || data.attr("NotOnOrAfter") == "" {
+			continue
+		}
+		info.NotOnOrAfter = append(info.NotOnOrAfter, data.attr("NotOnOrAfter"))
+		info.InResponseTo = data.attr("InResponseTo")
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("%w: no bearer subject confirmation for this app's ACS URL", ErrInvalidSAMLResponse)
+	}
+
+	// Every AudienceRestriction must name CloudGate
+	conditions := assertion.child(saml2AssertionNamespace, "Conditions")
+	if conditions == nil {
+		return nil, fmt.Errorf("%w: Conditions are required", ErrInvalidSAMLResponse)
+	}
+	restrictions := conditions.childElements(saml2AssertionNamespace, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, fmt.Errorf("%w: an audience restriction is required", ErrInvalidSAMLResponse)
+	}
+	for _, restriction := range restrictions {
+		allowed := false
+		for _, audience := range restriction.childElements(saml2AssertionNamespace, "Audience") {
+			if strings.TrimSpace(audience.text()) == s.entityID {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: assertion is not for audience %s", ErrInvalidSAMLResponse, s.entityID)
+		}
+	}
+	info.NotBefore = conditions.attr("NotBefore")
+	if notOnOrAfter := conditions.attr("NotOnOrAfter"); notOnOrAfter != "" {
+		info.NotOnOrAfter = append(info.NotOnOrAfter, notOnOrAfter)
+	}
+
+	if statement := assertion.child(saml2AssertionNamespace, "AuthnStatement"); statement != nil {
+		info.SessionIndex = statement.attr("SessionIndex")
+	}
+	for _, statement := range assertion.childElements(saml2AssertionNamespace, "AttributeStatement") {
+		for _, attribute := range statement.childElements(saml2AssertionNamespace, "Attribute") {
+			name := attribute.attr("Name")
+			for _, value := range attribute.childElements(saml2AssertionNamespace, "AttributeValue") {
+				info.Attributes[name] = append(info.Attributes[name], strings.TrimSpace(value.text()))
+			}
+		}
+	}
+	return info, nil
+}
+
+func (s *SAMLServiceProvider) audit(actor *uuid.UUID, action, appID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "saml_idp",
+		ResourceID: appID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit SAML identity provider event: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// credentialKey derives the AES-256 key for credentials sealed at rest from the given
+// setting, falling back to JWT_SECRET. The purpose label keeps each use's key distinct.
+func credentialKey(purpose, setting string) []byte {
+	key := sha256.Sum256([]byte(purpose + ":" + getEnv(setting, getEnv("JWT_SECRET", "dev-secret-change-me"))))
+	return key[:]
+}
+
+// sealSecret encrypts plaintext with AES-GCM under key, returning base64(nonce || ciphertext)
+func sealSecret(key, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// openSecret reverses sealSecret
+func openSecret(key []byte, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("sealed credential is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrActionTargetMissing is returned when an action has no user or IP address to act on
+	ErrActionTargetMissing = errors.New("security action target missing")
+	// ErrUserNotFound is returned when locking or unlocking an account that does not exist
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// ActionFilters selects recorded security action executions
+type ActionFilters struct {
+	Type    *ActionType
+	AlertID *uuid.UUID
+	UserID  *uuid.UUID
+	Limit   int
+	Offset  int
+}
+
+// executeAction carries out a response action and records it in the action audit trail.
+// Actions find their target in the metadata, user_id or ip_address, and block_ip and
+// lock_account take an optional duration such as "30m".
+func (s *SecurityMonitoringService) executeAction(action SecurityAction) error {
+	log.Printf("🔧 Executing security action: %s - %s", action.Type, action.Description)
+
+	var userID *uuid.UUID
+	if value, ok := action.Metadata["user_id"].(string); ok {
+		if id, err := uuid.Parse(value); err == nil {
+			userID = &id
+		}
+	}
+	ipAddress, _ := action.Metadata["ip_address"].(string)
+	reason := action.Description
+	if alertID, ok := action.Metadata["alert_id"].(string); ok {
+		reason = fmt.Sprintf("%s (alert %s)", action.Description, alertID)
+	}
+
+	var err error
+	switch action.Type {
+	case ActionTypeBlockIP:
+		err = s.blockIP(ipAddress, action.Metadata, reason)
+	case ActionTypeForceLogout:
+		err = s.forceLogout(userID, action.Metadata)
+	case ActionTypeLockAccount:
+		err = s.lockAccountFor(userID, action.Metadata, reason)
+	}
+
+	s.recordAction(action, userID, ipAddress, err)
+	return err
+}
+
+// actionExpiry reads an action's duration parameter, falling back to the default
+func actionExpiry(metadata map[string]interface{}, fallback time.Duration, now time.Time) (time.Time, error) {
+	duration := fallback
+	if value, ok := metadata["duration"].(string); ok && value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return time.Time{}, fmt.Errorf("invalid action duration %q", value)
+		}
+		duration = parsed
+	}
+	return now.Add(duration), nil
+}
+
+// blockIP denies the IP address through an IP reputation override, which request
+// middleware enforces, for AUTO_BLOCK_IP_DURATION unless the action says otherwise
+func (s *SecurityMonitoringService) blockIP(ipAddress string, metadata map[string]interface{}, reason string) error {
+	if ipAddress == "" {
+		return fmt.Errorf("%w: block_ip needs an ip_address", ErrActionTargetMissing)
+	}
+	if ipReputation == nil {
+		return fmt.Errorf("cannot block %s: IP reputation is not enabled", ipAddress)
+	}
+	now := time.Now()
+	expiresAt, err := actionExpiry(metadata, envDuration("AUTO_BLOCK_IP_DURATION", 24*time.Hour), now)
+	if err != nil {
+		return err
+	}
+	if _, err := ipReputation.SetOverride(ipAddress, models.IPOverrideDeny, reason, &expiresAt, nil, now); err != nil {
+		return fmt.Errorf("failed to block %s: %w", ipAddress, err)
+	}
+	return nil
+}
+
+// forceLogout revokes every session of the user, or only the one in session_id, so
+// refresh tokens stop working and the user signs in again once the current access
+// token expires
+func (s *SecurityMonitoringService) forceLogout(userID *uuid.UUID, metadata map[string]interface{}) error {
+	if userID == nil {
+		return fmt.Errorf("%w: force_logout needs a user_id", ErrActionTargetMissing)
+	}
+	value, ok := metadata["session_id"].(string)
+	if !ok || value == "" {
+		return s.sessions.InvalidateAllUserSessions(*userID)
+	}
+	sessionID, err := uuid.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid session_id %q", value)
+	}
+	result := s.db.Model(&models.Session{}).Where("id = ? AND user_id = ? AND is_active = ?", sessionID, *userID, true).
+		Update("is_active", false)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ForceLogout signs a user out on an administrator's request, of every session or only
+// the given one, and records it in the action audit trail as a force_logout
+func (s *SecurityMonitoringService) ForceLogout(userID uuid.UUID, sessionID *uuid.UUID, performedBy *uuid.UUID, reason string) error {
+	var exists int64
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Count(&exists).Error; err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+
+	description := "Signed out of all sessions by an administrator"
+	metadata := map[string]interface{}{"user_id": userID.String()}
+	if sessionID != nil {
+		description = "Signed out of a session by an administrator"
+		metadata["session_id"] = sessionID.String()
+	}
+	if reason != "" {
+		description += ": " + reason
+	}
+	action := SecurityAction{
+		ID:          uuid.New(),
+		Type:        ActionTypeForceLogout,
+		Description: description,
+		Timestamp:   time.Now(),
+		PerformedBy: uuidOrNil(performedBy),
+		Metadata:    metadata,
+	}
+	err := s.forceLogout(&userID, metadata)
+	// Nothing was done for a session that isn't the user's, so there is nothing to record
+	if !errors.Is(err, ErrSessionNotFound) {
+		s.recordAction(action, &userID, "", err)
+	}
+	return err
+}
+
+func (s *SecurityMonitoringService) lockAccountFor(userID *uuid.UUID, metadata map[string]interface{}, reason string) error {
+	if userID == nil {
+		return fmt.Errorf("%w: lock_account needs a user_id", ErrActionTargetMissing)
+	}
+	until, err := actionExpiry(metadata, envDuration("AUTO_LOCK_ACCOUNT_DURATION", time.Hour), time.Now())
+	if err != nil {
+		return err
+	}
+	return s.LockAccount(*userID, &until, reason)
+}
+
+// LockAccount refuses sign-in to a user until the given time, or until unlocked when nil,
+// and revokes the sessions they already have
+func (s *SecurityMonitoringService) LockAccount(userID uuid.UUID, until *time.Time, reason string) error {
+	result := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"locked_at":    time.Now(),
+		"locked_until": until,
+		"lock_reason":  reason,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to lock account: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	return s.sessions.InvalidateAllUserSessions(userID)
+}
+
+// UnlockAccount lets a locked user sign in again, recording who unlocked it
+func (s *SecurityMonitoringService) UnlockAccount(userID uuid.UUID, unlockedBy *uuid.UUID) error {
+	result := s.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"locked_at":    nil,
+		"locked_until": nil,
+		"lock_reason":  "",
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unlock account: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+
+	s.recordAction(SecurityAction{
+		ID:          uuid.New(),
+		Type:        ActionTypeUnlockAccount,
+		Description: "Account unlocked",
+		Timestamp:   time.Now(),
+		PerformedBy: uuidOrNil(unlockedBy),
+		Metadata:    map[string]interface{}{"user_id": userID.String()},
+	}, &userID, "", nil)
+	return nil
+}
+
+// recordAction stores an executed action in the audit trail. Failing to record is
+// logged rather than returned, so the action's own outcome is what the caller sees.
+func (s *SecurityMonitoringService) recordAction(action SecurityAction, userID *uuid.UUID, ipAddress string, actionErr error) {
+	metadata, _ := json.Marshal(action.Metadata)
+	execution := models.SecurityActionExecution{
+		ActionID:    action.ID,
+		Type:        string(action.Type),
+		Description: action.Description,
+		UserID:      userID,
+		IPAddress:   ipAddress,
+		Status:      string(ActionStatusExecuted),
+		Metadata:    string(metadata),
+	}
+	if alertID, ok := action.Metadata["alert_id"].(string); ok {
+		if id, err := uuid.Parse(alertID); err == nil {
+			execution.AlertID = &id
+		}
+	}
+	if action.PerformedBy != uuid.Nil {
+		execution.PerformedBy = &action.PerformedBy
+	}
+	if actionErr != nil {
+		execution.Status = string(ActionStatusFailed)
+		execution.Error = actionErr.Error()
+	}
+	if err := s.db.Create(&execution).Error; err != nil {
+		log.Printf("Failed to record security action %s: %v", action.ID, err)
+	}
+}
+
+// GetActionExecutions returns recorded security actions, newest first, and the total
+func (s *SecurityMonitoringService) GetActionExecutions(filters ActionFilters) ([]models.SecurityActionExecution, int64, error) {
+	query := s.db.Model(&models.SecurityActionExecution{})
+	if filters.Type != nil {
+		query = query.Where("type = ?", string(*filters.Type))
+	}
+	if filters.AlertID != nil {
+		query = query.Where("alert_id = ?", *filters.AlertID)
+	}
+	if filters.UserID != nil {
+		query = query.Where("user_id = ?", *filters.UserID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count security actions: %w", err)
+	}
+	var executions []models.SecurityActionExecution
+	if err := query.Order("created_at DESC").Limit(filters.Limit).Offset(filters.Offset).Find(&executions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get security actions: %w", err)
+	}
+	return executions, total, nil
+}
+
+func uuidOrNil(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
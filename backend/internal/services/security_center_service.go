@@ -0,0 +1,281 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSessionNotFound is returned for sessions that do not belong to the user
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrAppNotConnected is returned when disconnecting an app the user has not connected
+	ErrAppNotConnected = errors.New("app not connected")
+)
+
+const securityCenterLoginHistory = 20
+
+// SecurityOverview is everything the security center shows a user about their account
+type SecurityOverview struct {
+	RecentLogins   []LoginRecord          `json:"recent_logins"`
+	ActiveSessions []LoginRecord          `json:"active_sessions"`
+	ConnectedApps  []ConnectedApp         `json:"connected_apps"`
+	Devices        []models.TrustedDevice `json:"devices"`
+	Passkeys       []PasskeySummary       `json:"passkeys"`
+	MFA            MFAStatus              `json:"mfa"`
+}
+
+// LoginRecord is a sign-in as shown to the user, with where it came from
+type LoginRecord struct {
+	SessionID    uuid.UUID `json:"session_id"`
+	SignedInAt   time.Time `json:"signed_in_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	IPAddress    string    `json:"ip_address"`
+	Location     string    `json:"location"`
+	UserAgent    string    `json:"user_agent"`
+	Device       string    `json:"device"` // browser and operating system, read from the user agent
+	LastActiveAt time.Time `json:"last_active_at"`
+	AuthMethod   string    `json:"auth_method"`
+	AuthLevel    int       `json:"auth_level"`
+	Active       bool      `json:"active"`
+	Current      bool      `json:"current"`
+	Impersonated bool      `json:"impersonated"` // started by an administrator acting as the user
+}
+
+// ConnectedApp is an app the user connected, with the access it was granted
+type ConnectedApp struct {
+	AppID       string                  `json:"app_id"`
+	AppName     string                  `json:"app_name"`
+	Provider    string                  `json:"provider"`
+	Status      models.ConnectionStatus `json:"status"`
+	Scopes      []string                `json:"scopes"`
+	ConnectedAt time.Time               `json:"connected_at"`
+	LastUsed    *time.Time              `json:"last_used,omitempty"`
+}
+
+// PasskeySummary is a registered passkey, without its key material
+type PasskeySummary struct {
+	ID         uuid.UUID  `json:"id"`
+	DeviceName string     `json:"device_name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsed   *time.Time `json:"last_used,omitempty"`
+}
+
+// MFAStatus summarizes the second factors protecting the account
+type MFAStatus struct {
+	TOTPEnabled          bool `json:"totp_enabled"`
+	BackupCodesRemaining int  `json:"backup_codes_remaining"`
+	Passkeys             int  `json:"passkeys"`
+}
+
+// SecurityCenterService powers the security center page, where users review their own
+// sign-ins, sessions, connected apps and authenticators and act on anything they do not
+// recognize. Every method is scoped to the requesting user; logins the user does not
+// recognize are disputed through the LoginDisputeService.
+type SecurityCenterService struct {
+	db     *gorm.DB
+	locate func(ipAddress string) string
+}
+
+// NewSecurityCenterService creates a new security center service. locate describes where
+// an IP address is.
+func NewSecurityCenterService(db *gorm.DB, locate func(ipAddress string) string) *SecurityCenterService {
+	return &SecurityCenterService{db: db, locate: locate}
+}
+
+// Overview gathers the user's security center data. currentSession marks the session
+// the request was made with.
+func (s *SecurityCenterService) Overview(userID uuid.UUID, currentSession *uuid.UUID, now time.Time) (*SecurityOverview, error) {
+	overview := &SecurityOverview{
+		RecentLogins:   []LoginRecord{},
+		ActiveSessions: []LoginRecord{},
+		ConnectedApps:  []ConnectedApp{},
+		Devices:        []models.TrustedDevice{},
+		Passkeys:       []PasskeySummary{},
+	}
+
+	var sessions []models.Session
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(securityCenterLoginHistory).Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sign-ins: %w", err)
+	}
+	for _, session := range sessions {
+		record := s.loginRecord(session, currentSession, now)
+		overview.RecentLogins = append(overview.RecentLogins, record)
+		if record.Active {
+			overview.ActiveSessions = append(overview.ActiveSessions, record)
+		}
+	}
+
+	var connections []models.AppConnection
+	if err := s.db.Where("user_id = ? AND status <> ?", userID, models.ConnectionRevoked).Order("connected_at DESC").Find(&connections).Error; err != nil {
+		return nil, fmt.Errorf("failed to get connected apps: %w", err)
+	}
+	for _, connection := range connections {
+		overview.ConnectedApps = append(overview.ConnectedApps, ConnectedApp{
+			AppID:       connection.AppID,
+			AppName:     connection.AppName,
+			Provider:    connection.Provider,
+			Status:      connection.Status,
+			Scopes:      strings.FieldsFunc(connection.Scopes, func(r rune) bool { return r == ' ' || r == ',' }),
+			ConnectedAt: connection.ConnectedAt,
+			LastUsed:    connection.LastUsed,
+		})
+	}
+
+	if err := s.db.Where("user_id = ?", userID).Order("last_seen DESC").Find(&overview.Devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	var credentials []WebAuthnCredential
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("failed to get passkeys: %w", err)
+	}
+	for _, credential := range credentials {
+		overview.Passkeys = append(overview.Passkeys, PasskeySummary{
+			ID:         credential.ID,
+			DeviceName: credential.DeviceName,
+			CreatedAt:  credential.CreatedAt,
+			LastUsed:   credential.LastUsed,
+		})
+	}
+	overview.MFA.Passkeys = len(credentials)
+
+	var setup models.MFASetup
+	err := s.db.Where("user_id = ?", userID).First(&setup).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get MFA status: %w", err)
+	}
+	if err == nil && setup.Enabled {
+		overview.MFA.TOTPEnabled = true
+		var remaining int64
+		if err := s.db.Model(&models.BackupCode{}).Where("mfa_setup_id = ? AND used = ?", setup.ID, false).Count(&remaining).Error; err != nil {
+			return nil, fmt.Errorf("failed to count backup codes: %w", err)
+		}
+		overview.MFA.BackupCodesRemaining = int(remaining)
+	}
+	return overview, nil
+}
+
+// RevokeSession signs the user out of one of their sessions
+func (s *SecurityCenterService) RevokeSession(userID, sessionID uuid.UUID) error {
+	result := s.db.Model(&models.Session{}).Where("id = ? AND user_id = ? AND is_active = ?", sessionID, userID, true).Update("is_active", false)
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ActiveSessions lists the user's sessions that are still usable, newest first.
+// currentSession marks the session the request was made with.
+func (s *SecurityCenterService) ActiveSessions(userID uuid.UUID, currentSession *uuid.UUID, now time.Time) ([]LoginRecord, error) {
+	var sessions []models.Session
+	if err := s.db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, now).
+		Order("created_at DESC").Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	records := make([]LoginRecord, 0, len(sessions))
+	for _, session := range sessions {
+		records = append(records, s.loginRecord(session, currentSession, now))
+	}
+	return records, nil
+}
+
+// RevokeOtherSessions signs the user out everywhere but the current session, or
+// everywhere when there is none, returning how many sessions it revoked
+func (s *SecurityCenterService) RevokeOtherSessions(userID uuid.UUID, currentSession *uuid.UUID) (int64, error) {
+	query := s.db.Model(&models.Session{}).Where("user_id = ? AND is_active = ?", userID, true)
+	if currentSession != nil {
+		query = query.Where("id <> ?", *currentSession)
+	}
+	result := query.Update("is_active", false)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// DisconnectApp revokes an app connection, discarding its tokens and withdrawing consent
+func (s *SecurityCenterService) DisconnectApp(userID uuid.UUID, appID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AppConnection{}).Where("user_id = ? AND app_id = ? AND status <> ?", userID, appID, models.ConnectionRevoked).
+			Updates(map[string]interface{}{"status": models.ConnectionRevoked, "access_token": "", "refresh_token": "", "token_expires_at": nil})
+		if result.Error != nil {
+			return fmt.Errorf("failed to disconnect app: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrAppNotConnected
+		}
+		err := tx.Model(&models.ConsentRecord{}).Where("user_id = ? AND app_id = ? AND revoked_at IS NULL", userID, appID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke consent: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SecurityCenterService) loginRecord(session models.Session, currentSession *uuid.UUID, now time.Time) LoginRecord {
+	return LoginRecord{
+		SessionID:    session.ID,
+		SignedInAt:   session.CreatedAt,
+		ExpiresAt:    session.ExpiresAt,
+		IPAddress:    session.IPAddress,
+		Location:     s.location(session.IPAddress),
+		UserAgent:    session.UserAgent,
+		Device:       describeUserAgent(session.UserAgent),
+		LastActiveAt: session.UpdatedAt,
+		AuthMethod:   session.AuthMethod,
+		AuthLevel:    session.AuthLevel,
+		Active:       session.IsActive && session.ExpiresAt.After(now),
+		Current:      currentSession != nil && *currentSession == session.ID,
+		Impersonated: session.ImpersonatorID != nil,
+	}
+}
+
+func (s *SecurityCenterService) location(ipAddress string) string {
+	if s.locate == nil || ipAddress == "" {
+		return ""
+	}
+	return s.locate(ipAddress)
+}
+
+// describeUserAgent names the browser and operating system in a user agent, such as
+// "Firefox on Linux", for people reviewing where they are signed in
+func describeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+	browser := "Unknown browser"
+	// Order matters: Edge and Opera also claim Chrome, and Chrome also claims Safari
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	platform := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Android", "Android"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
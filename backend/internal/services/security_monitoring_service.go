@@ -2,16 +2,34 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/smtp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"cloudgate-backend/internal/models"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrAlertNotFound is returned when a security alert does not exist
+	ErrAlertNotFound = errors.New("alert not found")
+	// ErrInvalidAlertStatus is returned when an alert is moved to an unknown status
+	ErrInvalidAlertStatus = errors.New("invalid alert status")
+	// ErrAlertClosed is returned when acknowledging or escalating a resolved alert
+	ErrAlertClosed = errors.New("alert is already closed")
+)
+
 // SecurityMonitoringService handles real-time security monitoring and alerting
 type SecurityMonitoringService struct {
 	db                 *gorm.DB
@@ -19,11 +37,19 @@ type SecurityMonitoringService struct {
 	ruleEngine         *SecurityRuleEngine
 	threatIntelligence *ThreatIntelligenceService
 	incidentManager    *IncidentManager
+	correlator         *AlertCorrelator
+	watchlist          *WatchlistService
+	playbooks          *PlaybookEngine
+	sessions           *SessionService
+	adminLinks         *AdminLinkService
+	forwarder          *EventForwarder
 	alertQueue         chan SecurityAlert
 	subscribers        map[string][]chan SecurityAlert
 	mutex              sync.RWMutex
 	ctx                context.Context
 	cancel             context.CancelFunc
+	closed             bool           // set by Shutdown; no more alerts are queued
+	workers            sync.WaitGroup // processors and in-flight channel deliveries
 }
 
 // SecurityAlert represents a security alert
@@ -44,6 +70,7 @@ type SecurityAlert struct {
 	ResolvedAt  *time.Time             `json:"resolved_at,omitempty"`
 	Actions     []SecurityAction       `json:"actions"`
 	Tags        []string               `json:"tags"`
+	Priority    AlertPriority          `json:"priority"`
 }
 
 // AlertType represents the type of security alert
@@ -65,16 +92,30 @@ const (
 	AlertTypeAPIAbuse              AlertType = "api_abuse"
 	AlertTypeConfigurationChange   AlertType = "configuration_change"
 	AlertTypeSystemIntegrityBreach AlertType = "system_integrity_breach"
+	AlertTypeIntegrationDegraded   AlertType = "integration_degraded"
+	AlertTypeTokenReplay           AlertType = "token_replay"
+	AlertTypePasswordReuse         AlertType = "password_reuse"
+	AlertTypePhishingSuspected     AlertType = "phishing_suspected"
+	AlertTypeSigningKeyExpiring    AlertType = "signing_key_expiring"
+	AlertTypeDetectionQuery        AlertType = "detection_query"
+	AlertTypeCallbackAbuse         AlertType = "oauth_callback_abuse"
+	AlertTypeCanaryKeyUsed         AlertType = "canary_key_used"
+	AlertTypeMalwareUpload         AlertType = "malware_upload"
+	AlertTypeExternalEvent         AlertType = "external_security_event"
+	AlertTypeAuditVolumeAnomaly    AlertType = "audit_volume_anomaly"
+	AlertTypeIdPRiskSignal         AlertType = "idp_risk_signal"
+	AlertTypeDormantAccounts       AlertType = "dormant_accounts"
 )
 
-// AlertSeverity represents the severity level of an alert
-type AlertSeverity string
+// AlertSeverity represents the severity level of an alert; it is the severity every
+// alert, event and case shares
+type AlertSeverity = models.Severity
 
 const (
-	SeverityLow      AlertSeverity = "low"
-	SeverityMedium   AlertSeverity = "medium"
-	SeverityHigh     AlertSeverity = "high"
-	SeverityCritical AlertSeverity = "critical"
+	SeverityLow      = models.SeverityLow
+	SeverityMedium   = models.SeverityMedium
+	SeverityHigh     = models.SeverityHigh
+	SeverityCritical = models.SeverityCritical
 )
 
 // AlertStatus represents the status of an alert
@@ -113,6 +154,7 @@ const (
 	ActionTypeDisableAccount   ActionType = "disable_account"
 	ActionTypeCreateTicket     ActionType = "create_ticket"
 	ActionTypeEscalateIncident ActionType = "escalate_incident"
+	ActionTypeUnlockAccount    ActionType = "unlock_account"
 )
 
 // ActionStatus represents the status of a security action
@@ -141,6 +183,7 @@ type EmailAlertChannel struct {
 	FromAddress  string
 	ToAddresses  []string
 	Enabled      bool
+	Links        *AlertEmailLinks // adds one-click acknowledge and escalate links; nil leaves them out
 }
 
 // SlackAlertChannel sends alerts to Slack
@@ -149,19 +192,22 @@ type SlackAlertChannel struct {
 	Channel    string
 	Username   string
 	Enabled    bool
+	Deliverer  *WebhookService // retries and dead-letters; nil only logs
 }
 
 // WebhookAlertChannel sends alerts to custom webhooks
 type WebhookAlertChannel struct {
-	URL     string
-	Headers map[string]string
-	Enabled bool
+	URL       string
+	Headers   map[string]string
+	Enabled   bool
+	Deliverer *WebhookService // retries and dead-letters; nil only logs
 }
 
 // SecurityRuleEngine processes security rules and generates alerts
 type SecurityRuleEngine struct {
 	rules   []SecurityRule
 	metrics *SecurityMetrics
+	mutex   sync.RWMutex
 }
 
 // SecurityRule represents a security monitoring rule
@@ -205,16 +251,26 @@ type RuleAction struct {
 	Parameters map[string]interface{} `json:"parameters"`
 }
 
-// ThreatIntelligenceService provides threat intelligence data
+// ThreatIntelligenceService provides threat intelligence data. Downloaded lists, refreshed
+// every THREAT_FEED_REFRESH, are answered from memory; answers of providers looked up
+// remotely, including addresses none of them know, are cached for THREAT_INTEL_CACHE_TTL.
 type ThreatIntelligenceService struct {
-	providers []ThreatIntelProvider
-	cache     map[string]ThreatIntelData
-	mutex     sync.RWMutex
+	providers   []ThreatIntelProvider
+	cache       Cache
+	cachePrefix string
+	cacheTTL    time.Duration
+	feedRefresh time.Duration
+	mutex       sync.RWMutex
+}
+
+// threatIntelCacheEntry is a cached answer; nil data caches that no provider knows the indicator
+type threatIntelCacheEntry struct {
+	Data *ThreatIntelData `json:"data"`
 }
 
 // ThreatIntelProvider represents a threat intelligence provider
 type ThreatIntelProvider interface {
-	GetThreatData(indicator string) (*ThreatIntelData, error)
+	GetThreatData(ctx context.Context, indicator string) (*ThreatIntelData, error)
 	GetProviderName() string
 }
 
@@ -286,20 +342,26 @@ type SecurityMetrics struct {
 // NewSecurityMonitoringService creates a new security monitoring service
 func NewSecurityMonitoringService(db *gorm.DB) *SecurityMonitoringService {
 	ctx, cancel := context.WithCancel(context.Background())
+	incidentManager := NewIncidentManager()
 
 	service := &SecurityMonitoringService{
 		db:                 db,
 		alertChannels:      make(map[string]AlertChannel),
 		ruleEngine:         NewSecurityRuleEngine(),
 		threatIntelligence: NewThreatIntelligenceService(),
-		incidentManager:    NewIncidentManager(),
+		incidentManager:    incidentManager,
+		correlator:         NewAlertCorrelator(incidentManager, DefaultCorrelationRules()),
+		watchlist:          NewWatchlistService(db),
+		sessions:           NewSessionService(db),
 		alertQueue:         make(chan SecurityAlert, 1000),
 		subscribers:        make(map[string][]chan SecurityAlert),
 		ctx:                ctx,
 		cancel:             cancel,
 	}
+	service.playbooks = NewPlaybookEngine(db, service.executeAction)
 
 	// Start background workers
+	service.workers.Add(3)
 	go service.alertProcessor()
 	go service.ruleProcessor()
 	go service.metricsCollector()
@@ -323,8 +385,11 @@ func NewSecurityRuleEngine() *SecurityRuleEngine {
 // NewThreatIntelligenceService creates a new threat intelligence service
 func NewThreatIntelligenceService() *ThreatIntelligenceService {
 	return &ThreatIntelligenceService{
-		providers: []ThreatIntelProvider{},
-		cache:     make(map[string]ThreatIntelData),
+		providers:   []ThreatIntelProvider{},
+		cache:       NewMemoryCache(maxThreatIntelCacheEntries),
+		cachePrefix: "threat_intel::",
+		cacheTTL:    envDuration("THREAT_INTEL_CACHE_TTL", time.Hour),
+		feedRefresh: envDuration("THREAT_FEED_REFRESH", time.Hour),
 	}
 }
 
@@ -364,18 +429,54 @@ func (s *SecurityMonitoringService) GenerateAlert(alertType AlertType, severity
 		alert.UserAgent = userAgent
 	}
 
+	// Watchlisted users get one severity level higher so their alerts surface sooner
+	if alert.UserID != nil {
+		if _, watched := s.watchlist.GetActiveEntry(*alert.UserID); watched {
+			alert.Severity = alert.Severity.Escalate()
+			alert.Tags = append(alert.Tags, "watchlist")
+		}
+	}
+
 	// Enrich alert with threat intelligence
 	if alert.IPAddress != "" {
-		if threatData, err := s.threatIntelligence.GetThreatData(alert.IPAddress); err == nil && threatData != nil {
+		if threatData, err := s.threatIntelligence.GetThreatData(context.Background(), alert.IPAddress); err == nil && threatData != nil {
 			alert.Metadata["threat_intelligence"] = threatData
 			if threatData.Confidence > 0.7 {
 				alert.Severity = SeverityCritical
 				alert.Tags = append(alert.Tags, "threat-intel-confirmed")
 			}
 		}
+		// Scored before this alert counts against the address, so it cannot escalate itself
+		if ipReputation != nil {
+			if reputation, err := ipReputation.Lookup(context.Background(), alert.IPAddress, alert.Timestamp); err == nil && reputation.Score > 0 {
+				alert.Metadata["ip_reputation"] = reputation
+				if reputation.Verdict == IPVerdictHighRisk || reputation.Verdict == IPVerdictDenied {
+					alert.Tags = append(alert.Tags, "bad-ip-reputation")
+				}
+			}
+		}
+		observeIP(alert.IPAddress, IPObservationAlert)
 	}
 
-	// Queue alert for processing
+	// Link the user or repository in each connected provider's admin console
+	if s.adminLinks != nil {
+		if links, err := s.adminLinks.ForAlert(alert); err != nil {
+			log.Printf("⚠️ Failed to build admin console links for alert %s: %v", alert.ID, err)
+		} else if len(links) > 0 {
+			alert.Metadata["admin_links"] = links
+		}
+	}
+
+	// Score for the triage queue once all enrichment is in
+	alert.Priority = s.prioritizeAlert(alert)
+
+	// Queue alert for processing; the read lock keeps Shutdown from closing the queue mid-send
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		log.Printf("⚠️ Security monitoring shut down, dropping alert: %s", alert.ID)
+		return nil, fmt.Errorf("security monitoring is shut down")
+	}
 	select {
 	case s.alertQueue <- alert:
 		log.Printf("🚨 Security Alert Generated: %s - %s", alert.Type, alert.Title)
@@ -388,7 +489,7 @@ func (s *SecurityMonitoringService) GenerateAlert(alertType AlertType, severity
 }
 
 // ProcessLoginEvent processes login events for security monitoring
-func (s *SecurityMonitoringService) ProcessLoginEvent(userID uuid.UUID, email, ipAddress, userAgent string, success bool, riskScore float64) error {
+func (s *SecurityMonitoringService) ProcessLoginEvent(ctx context.Context, userID uuid.UUID, email, ipAddress, userAgent string, success bool, riskScore float64) error {
 	metadata := map[string]interface{}{
 		"user_id":    userID.String(),
 		"email":      email,
@@ -397,6 +498,17 @@ func (s *SecurityMonitoringService) ProcessLoginEvent(userID uuid.UUID, email, i
 		"success":    success,
 		"risk_score": riskScore,
 	}
+	// Alerts and playbooks see where the sign-in came from when GeoIP can locate it
+	location := LocateIP(ctx, ipAddress)
+	if location != nil {
+		metadata["country"] = location.Country
+		metadata["city"] = location.City
+		metadata["vpn_detected"] = location.VPNDetected
+		if location.ASN != 0 {
+			metadata["asn"] = location.ASN
+			metadata["as_organization"] = location.ASOrganization
+		}
+	}
 
 	// Check for multiple failed logins
 	if !success {
@@ -412,12 +524,16 @@ func (s *SecurityMonitoringService) ProcessLoginEvent(userID uuid.UUID, email, i
 	}
 
 	// Check for suspicious location
-	if success && s.checkSuspiciousLocation(userID, ipAddress) {
+	if success && s.checkSuspiciousLocation(userID, location) {
+		place := location.Country
+		if location.City != "" {
+			place = location.City + ", " + location.Country
+		}
 		s.GenerateAlert(
 			AlertTypeSuspiciousLocation,
 			SeverityMedium,
 			"Login from Suspicious Location",
-			fmt.Sprintf("User %s logged in from suspicious location: %s", email, ipAddress),
+			fmt.Sprintf("User %s logged in from suspicious location: %s (%s)", email, place, ipAddress),
 			metadata,
 		)
 	}
@@ -434,7 +550,7 @@ func (s *SecurityMonitoringService) ProcessLoginEvent(userID uuid.UUID, email, i
 	}
 
 	// Check for high-risk login
-	if success && riskScore > 0.8 {
+	if success && riskScore > s.watchlist.ScaleThreshold(userID, 0.8) {
 		s.GenerateAlert(
 			AlertTypeLoginAnomaly,
 			SeverityHigh,
@@ -483,11 +599,76 @@ func (s *SecurityMonitoringService) ProcessAPIEvent(endpoint, method, ipAddress,
 	return nil
 }
 
+// ErrInvalidSecurityEvent is returned for an external security event missing its type,
+// title or a known severity
+var ErrInvalidSecurityEvent = errors.New("invalid security event")
+
+// ExternalSecurityEvent is a detection reported by another system, such as an EDR or WAF,
+// through the internal ingestion APIs
+type ExternalSecurityEvent struct {
+	EventType   string
+	Severity    AlertSeverity
+	Title       string
+	Description string
+	UserID      *uuid.UUID
+	IPAddress   string
+	Attributes  map[string]string
+	OccurredAt  time.Time
+	Source      string // service account that reported it
+}
+
+// ProcessSecurityEvent raises an external security event as an alert
+func (s *SecurityMonitoringService) ProcessSecurityEvent(event ExternalSecurityEvent) (*SecurityAlert, error) {
+	if strings.TrimSpace(event.EventType) == "" || strings.TrimSpace(event.Title) == "" {
+		return nil, fmt.Errorf("%w: event_type and title are required", ErrInvalidSecurityEvent)
+	}
+	switch event.Severity {
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+	default:
+		return nil, fmt.Errorf("%w: unknown severity %q", ErrInvalidSecurityEvent, event.Severity)
+	}
+
+	metadata := map[string]interface{}{
+		"event_type": event.EventType,
+		"source":     event.Source,
+	}
+	if event.UserID != nil {
+		metadata["user_id"] = event.UserID.String()
+	}
+	if event.IPAddress != "" {
+		metadata["ip_address"] = event.IPAddress
+	}
+	if !event.OccurredAt.IsZero() {
+		metadata["occurred_at"] = event.OccurredAt.UTC().Format(time.RFC3339)
+	}
+	for key, value := range event.Attributes {
+		if _, reserved := metadata[key]; !reserved {
+			metadata[key] = value
+		}
+	}
+
+	return s.GenerateAlert(AlertTypeExternalEvent, event.Severity, event.Title, event.Description, metadata)
+}
+
 // AddAlertChannel adds a new alert delivery channel
 func (s *SecurityMonitoringService) AddAlertChannel(name string, channel AlertChannel) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	s.alertChannels[name] = channel
+	s.mutex.Unlock()
+	// Channels hold webhook URLs and credentials, so they are versioned without a snapshot
+	recordConfigChange(ConfigKindChannels, "alert_channel:"+name, nil, "Alert channel added", nil)
+}
+
+// AlertChannelNames returns the names of the configured alert delivery channels
+func (s *SecurityMonitoringService) AlertChannelNames() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := make([]string, 0, len(s.alertChannels))
+	for name := range s.alertChannels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Subscribe allows services to subscribe to security alerts
@@ -507,18 +688,142 @@ func (s *SecurityMonitoringService) Unsubscribe(subscriberID string) {
 	delete(s.subscribers, subscriberID)
 }
 
-// GetAlerts retrieves security alerts with filtering options
+// GetAlert retrieves one security alert by ID
+func (s *SecurityMonitoringService) GetAlert(alertID uuid.UUID) (*SecurityAlert, error) {
+	var record models.SecurityAlertRecord
+	if err := s.db.First(&record, "id = ?", alertID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAlertNotFound
+		}
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+	return &alertsFromRecords([]models.SecurityAlertRecord{record})[0], nil
+}
+
+// GetAlerts retrieves security alerts with filtering options, newest first
 func (s *SecurityMonitoringService) GetAlerts(filters AlertFilters) ([]SecurityAlert, error) {
-	// Implementation would query database with filters
-	return []SecurityAlert{}, nil
+	alerts, _, err := s.ListAlerts(filters)
+	return alerts, err
+}
+
+// ListAlerts returns a page of alerts and how many match the filters in all
+func (s *SecurityMonitoringService) ListAlerts(filters AlertFilters) ([]SecurityAlert, int64, error) {
+	query := s.db.Model(&models.SecurityAlertRecord{})
+	if filters.Type != nil {
+		query = query.Where("type = ?", string(*filters.Type))
+	}
+	if filters.Severity != nil {
+		query = query.Where("severity = ?", string(*filters.Severity))
+	}
+	if filters.Status != nil {
+		query = query.Where("status = ?", string(*filters.Status))
+	}
+	if filters.UserID != nil {
+		query = query.Where("user_id = ?", *filters.UserID)
+	}
+	if filters.IPAddress != "" {
+		query = query.Where("ip_address = ?", filters.IPAddress)
+	}
+	if filters.StartTime != nil {
+		query = query.Where("created_at >= ?", *filters.StartTime)
+	}
+	if filters.EndTime != nil {
+		query = query.Where("created_at <= ?", *filters.EndTime)
+	}
+
+	var records []models.SecurityAlertRecord
+	page := ListPage{Filter: filters.Filter, Sort: filters.Sort, Limit: filters.Limit, Offset: filters.Offset}
+	total, err := page.find(query, "created_at DESC", &records)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get alerts: %w", err)
+	}
+	return alertsFromRecords(records), total, nil
+}
+
+// GetAlertQueue returns the untriaged backlog - open and in-progress alerts - ordered so
+// the highest priority comes first and, among equals, the one that has waited longest
+func (s *SecurityMonitoringService) GetAlertQueue(limit, offset int) ([]SecurityAlert, int64, error) {
+	query := s.db.Model(&models.SecurityAlertRecord{}).
+		Where("status IN ?", []string{string(StatusOpen), string(StatusInProgress)})
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count alert queue: %w", err)
+	}
+
+	var records []models.SecurityAlertRecord
+	if err := query.Order("priority_score DESC, created_at ASC").Limit(limit).Offset(offset).Find(&records).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get alert queue: %w", err)
+	}
+	return alertsFromRecords(records), total, nil
 }
 
 // UpdateAlertStatus updates the status of a security alert
 func (s *SecurityMonitoringService) UpdateAlertStatus(alertID uuid.UUID, status AlertStatus, assignedTo *uuid.UUID) error {
-	// Implementation would update alert in database
+	switch status {
+	case StatusOpen, StatusInProgress, StatusResolved, StatusFalsePositive, StatusSuppressed:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidAlertStatus, status)
+	}
+
+	updates := map[string]interface{}{"status": string(status)}
+	if assignedTo != nil {
+		updates["assigned_to"] = *assignedTo
+	}
+	// Reopening an alert clears when it was resolved
+	closed := status == StatusResolved || status == StatusFalsePositive
+	if closed {
+		updates["resolved_at"] = time.Now()
+	} else {
+		updates["resolved_at"] = nil
+	}
+
+	result := s.db.Model(&models.SecurityAlertRecord{}).Where("id = ?", alertID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update alert: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+
+	if closed {
+		s.ruleEngine.metrics.mutex.Lock()
+		s.ruleEngine.metrics.AlertsResolved++
+		if status == StatusFalsePositive {
+			s.ruleEngine.metrics.FalsePositives++
+		}
+		s.ruleEngine.metrics.mutex.Unlock()
+	}
 	return nil
 }
 
+// EscalateAlert raises an open alert one severity level, tags it as escalated and sends
+// it through the alert channels again so the next responders hear about it
+func (s *SecurityMonitoringService) EscalateAlert(alertID uuid.UUID) (*SecurityAlert, error) {
+	alert, err := s.GetAlert(alertID)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == StatusResolved || alert.Status == StatusFalsePositive {
+		return nil, ErrAlertClosed
+	}
+
+	alert.Severity = alert.Severity.Escalate()
+	if !slices.Contains(alert.Tags, "escalated") {
+		alert.Tags = append(alert.Tags, "escalated")
+	}
+	tags, _ := json.Marshal(alert.Tags)
+	if err := s.db.Model(&models.SecurityAlertRecord{}).Where("id = ?", alertID).Updates(map[string]interface{}{
+		"severity": string(alert.Severity),
+		"tags":     string(tags),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to escalate alert: %w", err)
+	}
+
+	s.sendToChannels(*alert)
+	return alert, nil
+}
+
 // CreateIncident creates a new security incident from alerts
 func (s *SecurityMonitoringService) CreateIncident(title, description string, severity AlertSeverity, alertIDs []uuid.UUID) (*SecurityIncident, error) {
 	return s.incidentManager.CreateIncident(title, description, severity, alertIDs)
@@ -529,6 +834,53 @@ func (s *SecurityMonitoringService) GetIncidents(filters IncidentFilters) ([]Sec
 	return s.incidentManager.GetIncidents(filters)
 }
 
+// ListIncidents returns a page of incidents and how many match the filters in all
+func (s *SecurityMonitoringService) ListIncidents(filters IncidentFilters) ([]SecurityIncident, int64, error) {
+	return s.incidentManager.ListIncidents(filters)
+}
+
+// ThreatIntelligence returns the threat intelligence the monitor enriches alerts with
+func (s *SecurityMonitoringService) ThreatIntelligence() *ThreatIntelligenceService {
+	return s.threatIntelligence
+}
+
+// SetAdminLinks makes alerts carry deep links into connected providers' admin consoles
+func (s *SecurityMonitoringService) SetAdminLinks(adminLinks *AdminLinkService) {
+	s.adminLinks = adminLinks
+}
+
+// SetWatchlist shares the watchlist analysts edit, so alerts for a newly watched user are
+// escalated straight away
+func (s *SecurityMonitoringService) SetWatchlist(watchlist *WatchlistService) {
+	s.watchlist = watchlist
+}
+
+// SetEventForwarder sends every alert the service raises to SIEMs
+func (s *SecurityMonitoringService) SetEventForwarder(forwarder *EventForwarder) {
+	s.forwarder = forwarder
+}
+
+// GetCorrelationRules returns the active alert correlation rules
+func (s *SecurityMonitoringService) GetCorrelationRules() []CorrelationRule {
+	return s.correlator.Rules()
+}
+
+// SetCorrelationRules replaces the alert correlation rules
+func (s *SecurityMonitoringService) SetCorrelationRules(rules []CorrelationRule) {
+	s.correlator.SetRules(rules)
+	recordConfigChange(ConfigKindRules, "correlation_rules", nil, fmt.Sprintf("%d correlation rule(s) set", len(rules)), rules)
+}
+
+// restoreCorrelationRules puts the correlation rules back to a recorded set
+func (s *SecurityMonitoringService) restoreCorrelationRules(_ string, snapshot []byte, _ *uuid.UUID) error {
+	var rules []CorrelationRule
+	if err := json.Unmarshal(snapshot, &rules); err != nil {
+		return fmt.Errorf("invalid correlation rules snapshot: %w", err)
+	}
+	s.SetCorrelationRules(rules)
+	return nil
+}
+
 // GetSecurityMetrics returns current security monitoring metrics
 func (s *SecurityMonitoringService) GetSecurityMetrics() SecurityMetrics {
 	s.ruleEngine.metrics.mutex.RLock()
@@ -547,18 +899,17 @@ func (s *SecurityMonitoringService) GetSecurityMetrics() SecurityMetrics {
 
 // Background workers
 
+// alertProcessor runs until Shutdown closes the queue, so alerts already queued are still
+// stored and delivered
 func (s *SecurityMonitoringService) alertProcessor() {
-	for {
-		select {
-		case alert := <-s.alertQueue:
-			s.processAlert(alert)
-		case <-s.ctx.Done():
-			return
-		}
+	defer s.workers.Done()
+	for alert := range s.alertQueue {
+		s.processAlert(alert)
 	}
 }
 
 func (s *SecurityMonitoringService) ruleProcessor() {
+	defer s.workers.Done()
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
@@ -573,6 +924,7 @@ func (s *SecurityMonitoringService) ruleProcessor() {
 }
 
 func (s *SecurityMonitoringService) metricsCollector() {
+	defer s.workers.Done()
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
@@ -589,24 +941,9 @@ func (s *SecurityMonitoringService) metricsCollector() {
 func (s *SecurityMonitoringService) processAlert(alert SecurityAlert) {
 	// Store alert in database
 	s.storeAlert(alert)
+	s.forwarder.Forward(securityAlertSIEMEvent(alert))
 
-	// Send alert through all enabled channels
-	s.mutex.RLock()
-	channels := make([]AlertChannel, 0, len(s.alertChannels))
-	for _, channel := range s.alertChannels {
-		if channel.IsEnabled() {
-			channels = append(channels, channel)
-		}
-	}
-	s.mutex.RUnlock()
-
-	for _, channel := range channels {
-		go func(ch AlertChannel) {
-			if err := ch.SendAlert(alert); err != nil {
-				log.Printf("Failed to send alert through %s: %v", ch.GetChannelType(), err)
-			}
-		}(channel)
-	}
+	s.sendToChannels(alert)
 
 	// Notify subscribers
 	s.mutex.RLock()
@@ -621,98 +958,111 @@ func (s *SecurityMonitoringService) processAlert(alert SecurityAlert) {
 	}
 	s.mutex.RUnlock()
 
-	// Execute automated actions based on alert severity
+	// Run the playbooks triggered by the alert
 	s.executeAutomatedActions(alert)
 
+	// Fold related alerts into incidents
+	opened := s.correlator.Correlate(alert)
+
 	// Update metrics
 	s.ruleEngine.metrics.mutex.Lock()
 	s.ruleEngine.metrics.AlertsGenerated++
+	s.ruleEngine.metrics.IncidentsCreated += int64(len(opened))
 	s.ruleEngine.metrics.mutex.Unlock()
 }
 
-func (s *SecurityMonitoringService) storeAlert(alert SecurityAlert) error {
-	// Implementation would store alert in database
-	return nil
-}
+// sendToChannels sends an alert through all enabled channels
+func (s *SecurityMonitoringService) sendToChannels(alert SecurityAlert) {
+	s.mutex.RLock()
+	channels := make([]AlertChannel, 0, len(s.alertChannels))
+	for _, channel := range s.alertChannels {
+		if channel.IsEnabled() {
+			channels = append(channels, channel)
+		}
+	}
+	s.mutex.RUnlock()
 
-func (s *SecurityMonitoringService) executeAutomatedActions(alert SecurityAlert) {
-	// Execute automated responses based on alert type and severity
-	switch alert.Severity {
-	case SeverityCritical:
-		s.handleCriticalAlert(alert)
-	case SeverityHigh:
-		s.handleHighSeverityAlert(alert)
-	case SeverityMedium:
-		s.handleMediumSeverityAlert(alert)
+	s.workers.Add(len(channels))
+	for _, channel := range channels {
+		go func(ch AlertChannel) {
+			defer s.workers.Done()
+			if err := ch.SendAlert(alert); err != nil {
+				log.Printf("Failed to send alert through %s: %v", ch.GetChannelType(), err)
+			}
+		}(channel)
 	}
 }
 
-func (s *SecurityMonitoringService) handleCriticalAlert(alert SecurityAlert) {
-	// Immediate automated actions for critical alerts
-	if alert.UserID != nil {
-		// Force logout all sessions
-		s.executeAction(SecurityAction{
-			Type:        ActionTypeForceLogout,
-			Description: "Force logout due to critical security alert",
-			Timestamp:   time.Now(),
-			Status:      ActionStatusPending,
-		})
+func (s *SecurityMonitoringService) storeAlert(alert SecurityAlert) error {
+	metadata, _ := json.Marshal(alert.Metadata)
+	tags, _ := json.Marshal(alert.Tags)
+	factors, _ := json.Marshal(alert.Priority)
+
+	record := models.SecurityAlertRecord{
+		ID:              alert.ID,
+		Type:            string(alert.Type),
+		Severity:        alert.Severity,
+		Title:           alert.Title,
+		Description:     alert.Description,
+		Source:          alert.Source,
+		UserID:          alert.UserID,
+		IPAddress:       alert.IPAddress,
+		UserAgent:       alert.UserAgent,
+		Metadata:        string(metadata),
+		Tags:            string(tags),
+		Status:          string(alert.Status),
+		AssignedTo:      alert.AssignedTo,
+		PriorityScore:   alert.Priority.Score,
+		PriorityFactors: string(factors),
+		ResolvedAt:      alert.ResolvedAt,
+		CreatedAt:       alert.Timestamp,
 	}
-
-	if alert.IPAddress != "" {
-		// Block IP address
-		s.executeAction(SecurityAction{
-			Type:        ActionTypeBlockIP,
-			Description: "Block IP due to critical security alert",
-			Timestamp:   time.Now(),
-			Status:      ActionStatusPending,
-		})
-	}
-
-	// Notify administrators immediately
-	s.executeAction(SecurityAction{
-		Type:        ActionTypeNotifyAdmin,
-		Description: "Immediate admin notification for critical alert",
-		Timestamp:   time.Now(),
-		Status:      ActionStatusPending,
-	})
+	if err := s.db.Create(&record).Error; err != nil {
+		log.Printf("Failed to store alert %s: %v", alert.ID, err)
+		return fmt.Errorf("failed to store alert: %w", err)
+	}
+	return nil
 }
 
-func (s *SecurityMonitoringService) handleHighSeverityAlert(alert SecurityAlert) {
-	// Automated actions for high severity alerts
-	if alert.UserID != nil {
-		// Require MFA for next login
-		s.executeAction(SecurityAction{
-			Type:        ActionTypeRequireMFA,
-			Description: "Require MFA due to high severity alert",
-			Timestamp:   time.Now(),
-			Status:      ActionStatusPending,
-		})
-	}
-
-	// Create incident ticket
-	s.executeAction(SecurityAction{
-		Type:        ActionTypeCreateTicket,
-		Description: "Create incident ticket for high severity alert",
-		Timestamp:   time.Now(),
-		Status:      ActionStatusPending,
-	})
+// alertsFromRecords converts stored alerts back to the form the rest of the service uses
+func alertsFromRecords(records []models.SecurityAlertRecord) []SecurityAlert {
+	alerts := make([]SecurityAlert, 0, len(records))
+	for _, record := range records {
+		alert := SecurityAlert{
+			ID:          record.ID,
+			Type:        AlertType(record.Type),
+			Severity:    AlertSeverity(record.Severity),
+			Title:       record.Title,
+			Description: record.Description,
+			Source:      record.Source,
+			UserID:      record.UserID,
+			IPAddress:   record.IPAddress,
+			UserAgent:   record.UserAgent,
+			Timestamp:   record.CreatedAt,
+			Status:      AlertStatus(record.Status),
+			AssignedTo:  record.AssignedTo,
+			ResolvedAt:  record.ResolvedAt,
+			Actions:     []SecurityAction{},
+			Tags:        []string{},
+		}
+		json.Unmarshal([]byte(record.Metadata), &alert.Metadata)
+		json.Unmarshal([]byte(record.Tags), &alert.Tags)
+		json.Unmarshal([]byte(record.PriorityFactors), &alert.Priority)
+		alerts = append(alerts, alert)
+	}
+	return alerts
 }
 
-func (s *SecurityMonitoringService) handleMediumSeverityAlert(alert SecurityAlert) {
-	// Automated actions for medium severity alerts
-	s.executeAction(SecurityAction{
-		Type:        ActionTypeNotifyAdmin,
-		Description: "Notify admin of medium severity alert",
-		Timestamp:   time.Now(),
-		Status:      ActionStatusPending,
-	})
+func (s *SecurityMonitoringService) executeAutomatedActions(alert SecurityAlert) {
+	// Automated responses are defined as playbooks triggered by alert type and severity
+	for _, run := range s.playbooks.Run(alert) {
+		log.Printf("📘 Playbook %s %s for alert %s", run.PlaybookName, run.Status, alert.ID)
+	}
 }
 
-func (s *SecurityMonitoringService) executeAction(action SecurityAction) error {
-	// Implementation would execute the security action
-	log.Printf("🔧 Executing security action: %s - %s", action.Type, action.Description)
-	return nil
+// Playbooks returns the playbook engine that runs automated alert responses
+func (s *SecurityMonitoringService) Playbooks() *PlaybookEngine {
+	return s.playbooks
 }
 
 func (s *SecurityMonitoringService) collectMetrics() {
@@ -726,9 +1076,8 @@ func (s *SecurityMonitoringService) checkMultipleFailedLogins(userID uuid.UUID,
 	return false
 }
 
-func (s *SecurityMonitoringService) checkSuspiciousLocation(userID uuid.UUID, ipAddress string) bool {
-	// Implementation would check if location is suspicious for user
-	return false
+func (s *SecurityMonitoringService) checkSuspiciousLocation(userID uuid.UUID, location *GeoLocation) bool {
+	return location != nil && isHighRiskCountry(location.Country)
 }
 
 func (s *SecurityMonitoringService) checkNewDeviceAccess(userID uuid.UUID, userAgent string) bool {
@@ -754,6 +1103,8 @@ func (s *SecurityMonitoringService) checkSuspiciousUserAgent(userAgent string) b
 
 // Filter types for queries
 
+// AlertFilters selects alerts. Filter is a filter expression over AlertFilterSchema, applied
+// together with the individual fields; alerts are newest first unless Sort says otherwise.
 type AlertFilters struct {
 	Type      *AlertType
 	Severity  *AlertSeverity
@@ -762,16 +1113,22 @@ type AlertFilters struct {
 	IPAddress string
 	StartTime *time.Time
 	EndTime   *time.Time
+	Filter    *Filter
+	Sort      ListSort
 	Limit     int
 	Offset    int
 }
 
+// IncidentFilters selects incidents. Filter is a filter expression over
+// IncidentFilterSchema, applied together with the individual fields.
 type IncidentFilters struct {
 	Status     *IncidentStatus
 	Severity   *AlertSeverity
 	AssignedTo *uuid.UUID
 	StartTime  *time.Time
 	EndTime    *time.Time
+	Filter     *Filter
+	Sort       ListSort
 	Limit      int
 	Offset     int
 }
@@ -860,15 +1217,106 @@ func (im *IncidentManager) CreateIncident(title, description string, severity Al
 }
 
 func (im *IncidentManager) GetIncidents(filters IncidentFilters) ([]SecurityIncident, error) {
-	im.mutex.RLock()
-	defer im.mutex.RUnlock()
+	incidents, _, err := im.ListIncidents(filters)
+	return incidents, err
+}
 
+// ListIncidents returns a page of incidents, newest first unless the filters sort otherwise,
+// and how many match in all
+func (im *IncidentManager) ListIncidents(filters IncidentFilters) ([]SecurityIncident, int64, error) {
+	im.mutex.RLock()
 	incidents := make([]SecurityIncident, 0, len(im.incidents))
 	for _, incident := range im.incidents {
+		if filters.Status != nil && incident.Status != *filters.Status ||
+			filters.Severity != nil && incident.Severity != *filters.Severity ||
+			filters.AssignedTo != nil && (incident.AssignedTo == nil || *incident.AssignedTo != *filters.AssignedTo) ||
+			filters.StartTime != nil && incident.CreatedAt.Before(*filters.StartTime) ||
+			filters.EndTime != nil && incident.CreatedAt.After(*filters.EndTime) {
+			continue
+		}
 		incidents = append(incidents, *incident)
 	}
+	im.mutex.RUnlock()
+
+	// Incidents are held in a map, so they are put in a stable order before paging
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].CreatedAt.After(incidents[j].CreatedAt) })
+	page := ListPage{Filter: filters.Filter, Sort: filters.Sort, Limit: filters.Limit, Offset: filters.Offset}
+	incidents, total := pageRecords(page, incidents, incidentFilterFields)
+	return incidents, total, nil
+}
+
+// incidentFilterFields gives an incident's values for the fields of IncidentFilterSchema
+func incidentFilterFields(incident SecurityIncident) map[string]interface{} {
+	return map[string]interface{}{
+		"severity":    incident.Severity,
+		"status":      incident.Status,
+		"title":       incident.Title,
+		"assigned_to": incident.AssignedTo,
+		"created_at":  incident.CreatedAt,
+		"updated_at":  incident.UpdatedAt,
+	}
+}
+
+// createCorrelatedIncident opens an incident holding the given alerts, at the highest of their severities
+func (im *IncidentManager) createCorrelatedIncident(title, description, ruleName string, alerts []SecurityAlert) *SecurityIncident {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	now := time.Now()
+	severity := SeverityLow
+	for _, alert := range alerts {
+		if alert.Severity.Compare(severity) > 0 {
+			severity = alert.Severity
+		}
+	}
+
+	incident := &SecurityIncident{
+		ID:          uuid.New(),
+		Title:       title,
+		Description: description,
+		Severity:    severity,
+		Status:      IncidentStatusOpen,
+		Alerts:      append([]SecurityAlert(nil), alerts...),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Timeline: []IncidentEvent{{
+			ID:          uuid.New(),
+			Type:        "correlated",
+			Description: description,
+			Timestamp:   now,
+			Metadata:    map[string]interface{}{"rule": ruleName, "alert_count": len(alerts)},
+		}},
+	}
+
+	im.incidents[incident.ID] = incident
+	return incident
+}
+
+// attachAlert adds an alert to an active incident, raising its severity if needed.
+// Returns false if the incident no longer exists or has been resolved or closed.
+func (im *IncidentManager) attachAlert(incidentID uuid.UUID, alert SecurityAlert, ruleName string) bool {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	incident, ok := im.incidents[incidentID]
+	if !ok || incident.Status == IncidentStatusResolved || incident.Status == IncidentStatusClosed {
+		return false
+	}
 
-	return incidents, nil
+	now := time.Now()
+	incident.Alerts = append(incident.Alerts, alert)
+	if alert.Severity.Compare(incident.Severity) > 0 {
+		incident.Severity = alert.Severity
+	}
+	incident.UpdatedAt = now
+	incident.Timeline = append(incident.Timeline, IncidentEvent{
+		ID:          uuid.New(),
+		Type:        "alert_correlated",
+		Description: fmt.Sprintf("Alert %s added: %s", alert.ID, alert.Title),
+		Timestamp:   now,
+		Metadata:    map[string]interface{}{"rule": ruleName, "alert_id": alert.ID.String()},
+	})
+	return true
 }
 
 // Alert channel implementations
@@ -877,11 +1325,55 @@ func (e *EmailAlertChannel) SendAlert(alert SecurityAlert) error {
 	if !e.Enabled {
 		return nil
 	}
-	// Implementation would send email alert
 	log.Printf("📧 Sending email alert: %s", alert.Title)
+	if e.SMTPHost == "" {
+		return nil
+	}
+
+	port := e.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if e.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", e.SMTPUsername, e.SMTPPassword, e.SMTPHost)
+	}
+	// Each recipient gets their own email, since the links are signed for them
+	var failed []string
+	for _, to := range e.ToAddresses {
+		message := e.message(alert, to, time.Now())
+		if err := smtp.SendMail(net.JoinHostPort(e.SMTPHost, strconv.Itoa(port)), auth, e.FromAddress, []string{to}, message); err != nil {
+			log.Printf("Failed to email alert to %s: %v", to, err)
+			failed = append(failed, to)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to email alert to %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
+// message builds the plain text email for an alert sent to one recipient
+func (e *EmailAlertChannel) message(alert SecurityAlert, to string, now time.Time) []byte {
+	// Alert titles can come from request data, so keep them from adding headers
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(alert.Title)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\nSubject: [CloudGate %s] %s\r\n", e.FromAddress, to, strings.ToUpper(string(alert.Severity)), subject)
+	body.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n\r\n%s\r\n\r\n", alert.Title, alert.Description)
+	fmt.Fprintf(&body, "Alert: %s\r\nType: %s\r\nSeverity: %s\r\nTime: %s\r\n", alert.ID, alert.Type, alert.Severity, alert.Timestamp.UTC().Format(time.RFC1123))
+	if alert.IPAddress != "" {
+		fmt.Fprintf(&body, "IP address: %s\r\n", alert.IPAddress)
+	}
+	if e.Links != nil {
+		links := e.Links.URLs(alert.ID, to, now)
+		fmt.Fprintf(&body, "\r\nAcknowledge and take this alert:\r\n%s\r\n", links[AlertEmailAcknowledge])
+		fmt.Fprintf(&body, "\r\nEscalate this alert:\r\n%s\r\n", links[AlertEmailEscalate])
+	}
+	return []byte(body.String())
+}
+
 func (e *EmailAlertChannel) GetChannelType() string {
 	return "email"
 }
@@ -894,9 +1386,20 @@ func (s *SlackAlertChannel) SendAlert(alert SecurityAlert) error {
 	if !s.Enabled {
 		return nil
 	}
-	// Implementation would send Slack alert
 	log.Printf("💬 Sending Slack alert: %s", alert.Title)
-	return nil
+	if s.Deliverer == nil || s.WebhookURL == "" {
+		return nil
+	}
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf("[%s] %s: %s", alert.Severity, alert.Title, alert.Description),
+	}
+	if s.Channel != "" {
+		payload["channel"] = s.Channel
+	}
+	if s.Username != "" {
+		payload["username"] = s.Username
+	}
+	return s.Deliverer.Deliver(models.WebhookSourceAlert, "security_alert."+string(alert.Type), s.WebhookURL, nil, payload)
 }
 
 func (s *SlackAlertChannel) GetChannelType() string {
@@ -911,9 +1414,11 @@ func (w *WebhookAlertChannel) SendAlert(alert SecurityAlert) error {
 	if !w.Enabled {
 		return nil
 	}
-	// Implementation would send webhook alert
 	log.Printf("🔗 Sending webhook alert: %s", alert.Title)
-	return nil
+	if w.Deliverer == nil || w.URL == "" {
+		return nil
+	}
+	return w.Deliverer.Deliver(models.WebhookSourceAlert, "security_alert."+string(alert.Type), w.URL, w.Headers, alert)
 }
 
 func (w *WebhookAlertChannel) GetChannelType() string {
@@ -926,38 +1431,232 @@ func (w *WebhookAlertChannel) IsEnabled() bool {
 
 // Threat intelligence methods
 
-func (ti *ThreatIntelligenceService) GetThreatData(indicator string) (*ThreatIntelData, error) {
+// maxThreatIntelCacheEntries bounds the cache each service keeps until UseCache shares one
+const maxThreatIntelCacheEntries = 50000
+
+// AddProvider adds a threat intelligence provider, consulted after those already added
+func (ti *ThreatIntelligenceService) AddProvider(provider ThreatIntelProvider) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+	ti.providers = append(ti.providers, provider)
+	// Answers are cached per set of remote providers, so adding one forgets them and
+	// instances configured differently do not share answers
+	var remote []string
+	for _, provider := range ti.providers {
+		if _, ok := provider.(threatFeed); !ok {
+			remote = append(remote, provider.GetProviderName())
+		}
+	}
+	ti.cachePrefix = "threat_intel:" + strings.Join(remote, ",") + ":"
+}
+
+// UseCache caches remote answers in cache, such as the shared cache, instead of in memory
+func (ti *ThreatIntelligenceService) UseCache(cache Cache) {
+	ti.mutex.Lock()
+	ti.cache = cache
+	ti.mutex.Unlock()
+}
+
+// GetThreatData returns the most confident answer any provider has for the indicator, with
+// the tags of every provider that knows it
+func (ti *ThreatIntelligenceService) GetThreatData(ctx context.Context, indicator string) (*ThreatIntelData, error) {
 	ti.mutex.RLock()
-	if data, exists := ti.cache[indicator]; exists {
-		ti.mutex.RUnlock()
-		return &data, nil
+	providers := ti.providers
+	ti.mutex.RUnlock()
+
+	var feeds, remote []ThreatIntelProvider
+	for _, provider := range providers {
+		if _, ok := provider.(threatFeed); ok {
+			feeds = append(feeds, provider)
+		} else {
+			remote = append(remote, provider)
+		}
+	}
+	answer, _ := combineThreatData(ctx, indicator, feeds)
+	if len(remote) > 0 {
+		if remoteAnswer := ti.remoteThreatData(ctx, indicator, remote); remoteAnswer != nil {
+			if answer == nil {
+				answer = remoteAnswer
+			} else {
+				tags := answer.Tags
+				for _, tag := range remoteAnswer.Tags {
+					if !slices.Contains(tags, tag) {
+						tags = append(tags, tag)
+					}
+				}
+				if remoteAnswer.Confidence > answer.Confidence {
+					answer = remoteAnswer
+				}
+				answer.Tags = tags
+			}
+		}
+	}
+
+	if answer == nil {
+		return nil, fmt.Errorf("no threat intelligence data found for indicator: %s", indicator)
+	}
+	return answer, nil
+}
+
+// remoteThreatData answers from the cache, asking the remote providers on a miss. Failed
+// lookups are not cached, so a provider outage does not hide an address for a whole TTL.
+func (ti *ThreatIntelligenceService) remoteThreatData(ctx context.Context, indicator string, providers []ThreatIntelProvider) *ThreatIntelData {
+	ti.mutex.RLock()
+	cache, key := ti.cache, ti.cachePrefix+indicator
+	ti.mutex.RUnlock()
+
+	var entry threatIntelCacheEntry
+	cached, err := cache.Get(ctx, key)
+	if err == nil {
+		if err = json.Unmarshal(cached, &entry); err == nil {
+			return entry.Data
+		}
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		log.Printf("Failed to read cached threat intel for %s: %v", indicator, err)
+	}
+
+	data, failed := combineThreatData(ctx, indicator, providers)
+	if data != nil || !failed {
+		entry.Data = data
+		encoded, err := json.Marshal(entry)
+		if err == nil {
+			err = cache.Set(ctx, key, encoded, ti.cacheTTL)
+		}
+		if err != nil {
+			log.Printf("Failed to cache threat intel for %s: %v", indicator, err)
+		}
+	}
+	return data
+}
+
+// combineThreatData asks each provider in turn, keeping the most confident answer with the
+// tags of every provider that knows the indicator, and reports whether any provider failed
+func combineThreatData(ctx context.Context, indicator string, providers []ThreatIntelProvider) (*ThreatIntelData, bool) {
+	var best *ThreatIntelData
+	var tags []string
+	failed := false
+	for _, provider := range providers {
+		data, err := provider.GetThreatData(ctx, indicator)
+		if err != nil {
+			log.Printf("Threat intel provider %s failed for %s: %v", provider.GetProviderName(), indicator, err)
+			failed = true
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		for _, tag := range data.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if best == nil || data.Confidence > best.Confidence {
+			answer := *data
+			best = &answer
+		}
 	}
+	if best != nil {
+		best.Tags = tags
+	}
+	return best, failed
+}
+
+// IsTorExitNode reports whether any provider knows the IP address as a Tor exit node
+func (ti *ThreatIntelligenceService) IsTorExitNode(ctx context.Context, ipAddress string) bool {
+	data, err := ti.GetThreatData(ctx, ipAddress)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(data.Tags, ThreatTagTor)
+}
+
+// RefreshFeeds downloads every provider's list, such as the Tor exit nodes. A feed that
+// fails keeps its last list.
+func (ti *ThreatIntelligenceService) RefreshFeeds(ctx context.Context) error {
+	ti.mutex.RLock()
+	providers := ti.providers
 	ti.mutex.RUnlock()
 
-	// Query threat intelligence providers
+	var errs []error
+	for _, provider := range providers {
+		if feed, ok := provider.(threatFeed); ok {
+			if err := feed.Refresh(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HasFeeds reports whether any provider answers from a downloaded list
+func (ti *ThreatIntelligenceService) HasFeeds() bool {
+	ti.mutex.RLock()
+	defer ti.mutex.RUnlock()
 	for _, provider := range ti.providers {
-		if data, err := provider.GetThreatData(indicator); err == nil && data != nil {
-			ti.mutex.Lock()
-			ti.cache[indicator] = *data
-			ti.mutex.Unlock()
-			return data, nil
+		if _, ok := provider.(threatFeed); ok {
+			return true
 		}
 	}
+	return false
+}
 
-	return nil, fmt.Errorf("no threat intelligence data found for indicator: %s", indicator)
+// RunFeedRefresh refreshes the downloaded lists now and then every THREAT_FEED_REFRESH
+// until ctx is cancelled. Every instance keeps its own lists, so this runs on each rather
+// than leased.
+func (ti *ThreatIntelligenceService) RunFeedRefresh(ctx context.Context) {
+	if !ti.HasFeeds() {
+		return
+	}
+	ticker := time.NewTicker(ti.feedRefresh)
+	defer ticker.Stop()
+
+	for {
+		if err := ti.RefreshFeeds(ctx); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-// Shutdown gracefully shuts down the security monitoring service
-func (s *SecurityMonitoringService) Shutdown() {
-	s.cancel()
+// Shutdown stops accepting alerts, then waits until ctx is done for the queued ones to be
+// processed and delivered before closing subscriber channels. It is safe to call twice.
+func (s *SecurityMonitoringService) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
 	close(s.alertQueue)
+	s.mutex.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("security monitoring shutdown: %d alert(s) still queued: %w", len(s.alertQueue), ctx.Err())
+	}
 
-	// Close all subscriber channels
+	// Close all subscriber channels, dropping them so an alert still being processed is
+	// not sent to a closed channel
 	s.mutex.Lock()
 	for _, subscribers := range s.subscribers {
 		for _, subscriber := range subscribers {
 			close(subscriber)
 		}
 	}
+	s.subscribers = make(map[string][]chan SecurityAlert)
 	s.mutex.Unlock()
+	return err
 }
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Scopes a service account may be granted
+const (
+	ServiceScopeLoginEvents    = "events:login"
+	ServiceScopeAPIEvents      = "events:api"
+	ServiceScopeSecurityEvents = "events:security"
+	ServiceScopeDevicePosture  = "devices:posture"
+)
+
+var serviceScopes = []string{ServiceScopeLoginEvents, ServiceScopeAPIEvents, ServiceScopeSecurityEvents, ServiceScopeDevicePosture}
+
+var (
+	// ErrClientCertificateRequired is returned when a caller presented no client certificate
+	ErrClientCertificateRequired = errors.New("client certificate required")
+	// ErrClientCertificateInvalid is returned for a certificate that does not chain to the client CA
+	ErrClientCertificateInvalid = errors.New("client certificate is not valid")
+	// ErrServiceAccountUnknown is returned when no service account matches a valid certificate
+	ErrServiceAccountUnknown = errors.New("no service account matches the client certificate")
+	// ErrServiceAccountDisabled is returned for a disabled service account
+	ErrServiceAccountDisabled = errors.New("service account is disabled")
+	// ErrServiceAccountNotFound is returned when a service account does not exist
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	// ErrInvalidServiceAccount is returned for a malformed service account definition
+	ErrInvalidServiceAccount = errors.New("invalid service account")
+	// ErrMTLSNotConfigured is returned when no client CA is configured
+	ErrMTLSNotConfigured = errors.New("mutual TLS is not configured")
+)
+
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ServiceAccountInput is an admin's definition of a service account
+type ServiceAccountInput struct {
+	Name            string
+	Description     string
+	CertFingerprint string
+	CertURI         string
+	CertSubject     string
+	Scopes          []string
+	Enabled         bool
+	EventRateLimit  int
+}
+
+// ServiceAccountService authenticates internal services by client certificate. The
+// certificate is either verified by the TLS handshake on the mTLS listener, or forwarded
+// by a TLS-terminating proxy in MTLS_CLIENT_CERT_HEADER (URL-escaped PEM, as nginx's
+// $ssl_client_escaped_cert) and verified here against MTLS_CLIENT_CA_FILE. Forwarded
+// certificates are only accepted from MTLS_TRUSTED_PROXIES.
+type ServiceAccountService struct {
+	db             *gorm.DB
+	clientCAs      *x509.CertPool
+	certHeader     string
+	trustedProxies []*net.IPNet
+}
+
+// NewServiceAccountService creates a new service account service
+func NewServiceAccountService(db *gorm.DB) *ServiceAccountService {
+	s := &ServiceAccountService{
+		db:             db,
+		certHeader:     getEnv("MTLS_CLIENT_CERT_HEADER", "X-SSL-Client-Cert"),
+		trustedProxies: parseNetworks("MTLS_TRUSTED_PROXIES", getEnv("MTLS_TRUSTED_PROXIES", "")),
+	}
+	if caFile := getEnv("MTLS_CLIENT_CA_FILE", ""); caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			log.Printf("⚠️ Failed to read MTLS_CLIENT_CA_FILE: %v", err)
+			return s
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			log.Printf("⚠️ MTLS_CLIENT_CA_FILE contains no PEM certificates")
+			return s
+		}
+		s.clientCAs = pool
+	}
+	return s
+}
+
+// Enabled reports whether a client CA is configured
+func (s *ServiceAccountService) Enabled() bool {
+	return s.clientCAs != nil
+}
+
+// ServerTLSConfig returns the TLS configuration for the mTLS listener, which requires every
+// client to present a certificate issued by the client CA
+func (s *ServiceAccountService) ServerTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if s.clientCAs == nil {
+		return nil, ErrMTLSNotConfigured
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientCAs:    s.clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Authenticate returns the enabled service account a request's client certificate maps to.
+// peerIP is the address of the direct peer, used to decide whether a forwarded certificate
+// can be trusted.
+func (s *ServiceAccountService) Authenticate(r *http.Request, peerIP net.IP, now time.Time) (*models.ServiceAccount, error) {
+	certificate, err := s.clientCertificate(r, peerIP, now)
+	if err != nil {
+		return nil, err
+	}
+	return s.AuthenticateCertificate(certificate, now)
+}
+
+// AuthenticateCertificate returns the enabled service account for a client certificate that
+// a TLS handshake against ServerTLSConfig has already verified, as on the gRPC listener
+func (s *ServiceAccountService) AuthenticateCertificate(certificate *x509.Certificate, now time.Time) (*models.ServiceAccount, error) {
+	account, err := s.match(certificate)
+	if err != nil {
+		return nil, err
+	}
+	if !account.Enabled {
+		return nil, ErrServiceAccountDisabled
+	}
+
+	account.LastSeenAt = &now
+	account.LastSeenSerial = certificate.SerialNumber.Text(16)
+	if err := s.db.Model(account).Updates(map[string]interface{}{"last_seen_at": now, "last_seen_serial": account.LastSeenSerial}).Error; err != nil {
+		log.Printf("Failed to record service account use: %v", err)
+	}
+	return account, nil
+}
+
+// HasScope reports whether a service account was granted a scope
+func HasScope(account *models.ServiceAccount, scope string) bool {
+	return slices.Contains(strings.Fields(account.Scopes), scope)
+}
+
+// CertificateFingerprint returns the lowercase hex SHA-256 fingerprint service accounts pin
+func CertificateFingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *ServiceAccountService) clientCertificate(r *http.Request, peerIP net.IP, now time.Time) (*x509.Certificate, error) {
+	if s.clientCAs == nil {
+		return nil, ErrMTLSNotConfigured
+	}
+
+	// Terminated here: the handshake already verified the chain
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], nil
+	}
+
+	forwarded := r.Header.Get(s.certHeader)
+	if forwarded == "" {
+		return nil, ErrClientCertificateRequired
+	}
+	if !s.trustedProxy(peerIP) {
+		return nil, fmt.Errorf("%w: forwarded by an untrusted peer", ErrClientCertificateInvalid)
+	}
+	unescaped, err := url.QueryUnescape(forwarded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClientCertificateInvalid, err)
+	}
+	block, _ := pem.Decode([]byte(unescaped))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: forwarded certificate is not PEM encoded", ErrClientCertificateInvalid)
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClientCertificateInvalid, err)
+	}
+	_, err = certificate.Verify(x509.VerifyOptions{
+		Roots:       s.clientCAs,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClientCertificateInvalid, err)
+	}
+	return certificate, nil
+}
+
+func (s *ServiceAccountService) trustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// match finds the service account for a certificate, preferring the most specific mapping
+func (s *ServiceAccountService) match(certificate *x509.Certificate) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	err := s.db.Where("cert_fingerprint = ?", CertificateFingerprint(certificate)).First(&account).Error
+	if err == nil {
+		return &account, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+
+	for _, uri := range certificate.URIs {
+		err = s.db.Where("cert_uri = ? AND cert_fingerprint = ''", uri.String()).First(&account).Error
+		if err == nil {
+			return &account, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("failed to get service account: %w", err)
+		}
+	}
+
+	if certificate.Subject.CommonName != "" {
+		err = s.db.Where("cert_subject = ? AND cert_fingerprint = '' AND cert_uri = ''", certificate.Subject.CommonName).First(&account).Error
+		if err == nil {
+			return &account, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("failed to get service account: %w", err)
+		}
+	}
+	return nil, ErrServiceAccountUnknown
+}
+
+// CreateAccount defines a new service account
+func (s *ServiceAccountService) CreateAccount(input ServiceAccountInput, actor *uuid.UUID) (*models.ServiceAccount, error) {
+	account := &models.ServiceAccount{CreatedBy: actor}
+	if err := applyServiceAccountInput(account, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	s.audit(actor, "service_account_created", account.ID.String(), fmt.Sprintf("Service account %s created with scopes %s", account.Name, account.Scopes))
+	return account, nil
+}
+
+// UpdateAccount replaces a service account's certificate mapping, scopes and state
+func (s *ServiceAccountService) UpdateAccount(id uuid.UUID, input ServiceAccountInput, actor *uuid.UUID) (*models.ServiceAccount, error) {
+	account, err := s.getAccount(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyServiceAccountInput(account, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(account).Error; err != nil {
+		return nil, fmt.Errorf("failed to update service account: %w", err)
+	}
+
+	s.audit(actor, "service_account_updated", account.ID.String(), fmt.Sprintf("Service account %s updated (enabled: %t, scopes: %s)", account.Name, account.Enabled, account.Scopes))
+	return account, nil
+}
+
+// ListAccounts returns every service account
+func (s *ServiceAccountService) ListAccounts() ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	if err := s.db.Order("name ASC").Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// DeleteAccount removes a service account
+func (s *ServiceAccountService) DeleteAccount(id uuid.UUID, actor *uuid.UUID) error {
+	account, err := s.getAccount(id)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(account).Error; err != nil {
+		return fmt.Errorf("failed to delete service account: %w", err)
+	}
+
+	s.audit(actor, "service_account_deleted", account.ID.String(), fmt.Sprintf("Service account %s deleted", account.Name))
+	return nil
+}
+
+func (s *ServiceAccountService) getAccount(id uuid.UUID) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := s.db.First(&account, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrServiceAccountNotFound
+		}
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+	return &account, nil
+}
+
+func (s *ServiceAccountService) audit(actor *uuid.UUID, action, accountID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "service_account",
+		ResourceID: accountID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit service account change: %v", err)
+	}
+}
+
+func applyServiceAccountInput(account *models.ServiceAccount, input ServiceAccountInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidServiceAccount)
+	}
+	fingerprint := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(input.CertFingerprint), ":", ""))
+	if fingerprint != "" && !fingerprintPattern.MatchString(fingerprint) {
+		return fmt.Errorf("%w: cert_fingerprint must be a hex SHA-256 fingerprint", ErrInvalidServiceAccount)
+	}
+	uri := strings.TrimSpace(input.CertURI)
+	if uri != "" {
+		if parsed, err := url.Parse(uri); err != nil || parsed.Scheme == "" {
+			return fmt.Errorf("%w: cert_uri must be an absolute URI", ErrInvalidServiceAccount)
+		}
+	}
+	subject := strings.TrimSpace(input.CertSubject)
+	if fingerprint == "" && uri == "" && subject == "" {
+		return fmt.Errorf("%w: a certificate fingerprint, URI or subject is required", ErrInvalidServiceAccount)
+	}
+	if len(input.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidServiceAccount)
+	}
+	if input.EventRateLimit < 0 {
+		return fmt.Errorf("%w: event_rate_limit cannot be negative", ErrInvalidServiceAccount)
+	}
+	var scopes []string
+	for _, scope := range input.Scopes {
+		if !slices.Contains(serviceScopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalidServiceAccount, scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	account.Name = name
+	account.Description = strings.TrimSpace(input.Description)
+	account.CertFingerprint = fingerprint
+	account.CertURI = uri
+	account.CertSubject = subject
+	account.Scopes = strings.Join(scopes, " ")
+	account.Enabled = input.Enabled
+	account.EventRateLimit = input.EventRateLimit
+	return nil
+}
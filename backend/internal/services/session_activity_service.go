@@ -0,0 +1,216 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// minSessionIdleTimeout is the shortest idle timeout a risk policy may put on a session
+const minSessionIdleTimeout = 5
+
+// SessionActivity is when a session was last used and when it times out without more use
+type SessionActivity struct {
+	SessionID          uuid.UUID `json:"session_id"`
+	LastActivityAt     time.Time `json:"last_activity_at"`
+	IdleTimeoutSeconds int64     `json:"idle_timeout_seconds"`
+	IdleExpiresAt      time.Time `json:"idle_expires_at"`
+}
+
+// SessionActivityService ends sessions nobody has used for their idle timeout: the
+// session's own, set from a risk policy's session limits, or SESSION_IDLE_TIMEOUT. A
+// session's last activity is its updated_at, as for app session policies and dormant
+// accounts; requests made with it and heartbeats from the frontend move it forward, at
+// most once every SESSION_ACTIVITY_WRITE_INTERVAL per instance so that every request
+// does not write. Each timeout is audited as session_idle_timeout.
+type SessionActivityService struct {
+	db          *gorm.DB
+	idleTimeout time.Duration
+	writeEvery  time.Duration
+	sweepEvery  time.Duration
+
+	mutex   sync.Mutex
+	checked map[uuid.UUID]time.Time // when this instance last found each session in use
+}
+
+// NewSessionActivityService creates a session activity service from the environment. A
+// zero SESSION_IDLE_TIMEOUT leaves sessions without their own timeout alone.
+func NewSessionActivityService(db *gorm.DB) *SessionActivityService {
+	return &SessionActivityService{
+		db:          db,
+		idleTimeout: envDuration("SESSION_IDLE_TIMEOUT", time.Hour),
+		writeEvery:  envDuration("SESSION_ACTIVITY_WRITE_INTERVAL", time.Minute),
+		sweepEvery:  envDuration("SESSION_IDLE_SWEEP_INTERVAL", 5*time.Minute),
+		checked:     make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Interval returns how often sessions that went idle without another request are ended
+func (s *SessionActivityService) Interval() time.Duration {
+	return s.sweepEvery
+}
+
+// timeout returns the idle timeout that applies to a session, zero for none
+func (s *SessionActivityService) timeout(session *models.Session) time.Duration {
+	if session.IdleTimeoutMinutes > 0 {
+		return time.Duration(session.IdleTimeoutMinutes) * time.Minute
+	}
+	return s.idleTimeout
+}
+
+// RecordActivity checks that a session has not timed out, ending it if it just has, and
+// when active records the request as activity. Passive requests, such as the frontend
+// polling for notifications, are checked without keeping the session alive. It reports
+// whether the session has ended and why; a session that cannot be read is let through.
+func (s *SessionActivityService) RecordActivity(sessionID uuid.UUID, active bool, now time.Time) (bool, string) {
+	// Having found the session in use moments ago, this instance need not read it again
+	s.mutex.Lock()
+	checkedAt, ok := s.checked[sessionID]
+	s.mutex.Unlock()
+	if ok && now.Sub(checkedAt) < s.writeEvery {
+		return false, ""
+	}
+
+	var session models.Session
+	if err := s.db.Select("id", "user_id", "is_active", "idle_timeout_minutes", "updated_at").
+		First(&session, "id = ?", sessionID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("⚠️ Failed to read session %s activity: %v", sessionID, err)
+		}
+		return false, ""
+	}
+	if timeout := s.timeout(&session); timeout > 0 && now.Sub(session.UpdatedAt) >= timeout {
+		s.endIdle(&session, timeout, now)
+		return true, idleReason(timeout)
+	}
+	if !session.IsActive {
+		return false, ""
+	}
+
+	if active {
+		if err := s.db.Model(&models.Session{}).Where("id = ?", sessionID).UpdateColumn("updated_at", now).Error; err != nil {
+			log.Printf("⚠️ Failed to record session %s activity: %v", sessionID, err)
+			return false, ""
+		}
+		s.mutex.Lock()
+		s.checked[sessionID] = now
+		s.mutex.Unlock()
+	}
+	return false, ""
+}
+
+// Heartbeat records activity on a session the user is interacting with without making
+// requests, such as while filling in a long form, and returns when it will next time out
+func (s *SessionActivityService) Heartbeat(sessionID uuid.UUID, now time.Time) (*SessionActivity, error) {
+	var session models.Session
+	if err := s.db.First(&session, "id = ? AND is_active = ?", sessionID, true).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if ended, _ := s.RecordActivity(sessionID, true, now); ended {
+		return nil, ErrSessionNotFound
+	}
+
+	activity := &SessionActivity{SessionID: sessionID, LastActivityAt: now}
+	if timeout := s.timeout(&session); timeout > 0 {
+		activity.IdleTimeoutSeconds = int64(timeout.Seconds())
+		activity.IdleExpiresAt = now.Add(timeout)
+	}
+	return activity, nil
+}
+
+// LimitIdleTimeout shortens a session's idle timeout to minutes, as a risk policy's session
+// limits ask; it never lengthens one
+func (s *SessionActivityService) LimitIdleTimeout(sessionID uuid.UUID, minutes int) error {
+	minutes = max(minutes, minSessionIdleTimeout)
+	if s.idleTimeout > 0 && time.Duration(minutes)*time.Minute >= s.idleTimeout {
+		return nil
+	}
+	err := s.db.Model(&models.Session{}).
+		Where("id = ? AND (idle_timeout_minutes = 0 OR idle_timeout_minutes > ?)", sessionID, minutes).
+		UpdateColumn("idle_timeout_minutes", minutes).Error
+	if err != nil {
+		return fmt.Errorf("failed to limit session idle timeout: %w", err)
+	}
+	return nil
+}
+
+// ExpireIdle ends active sessions that timed out without another request, so they leave
+// session lists and the audit trail shows when they ended. It returns how many it ended.
+func (s *SessionActivityService) ExpireIdle(now time.Time) (int, error) {
+	var sessions []models.Session
+	query := s.db.Select("id", "user_id", "is_active", "idle_timeout_minutes", "updated_at").
+		Where("is_active = ?", true)
+	if s.idleTimeout > 0 {
+		query = query.Where("(idle_timeout_minutes = 0 AND updated_at < ?) OR (idle_timeout_minutes > 0 AND updated_at < ?)",
+			now.Add(-s.idleTimeout), now.Add(-minSessionIdleTimeout*time.Minute))
+	} else {
+		query = query.Where("idle_timeout_minutes > 0 AND updated_at < ?", now.Add(-minSessionIdleTimeout*time.Minute))
+	}
+	if err := query.Find(&sessions).Error; err != nil {
+		return 0, fmt.Errorf("failed to find idle sessions: %w", err)
+	}
+
+	ended := 0
+	for i := range sessions {
+		timeout := s.timeout(&sessions[i])
+		if timeout > 0 && now.Sub(sessions[i].UpdatedAt) >= timeout && s.endIdle(&sessions[i], timeout, now) {
+			ended++
+		}
+	}
+
+	// Forget sessions this instance has not seen in use for a while
+	s.mutex.Lock()
+	for sessionID, checkedAt := range s.checked {
+		if now.Sub(checkedAt) >= s.writeEvery {
+			delete(s.checked, sessionID)
+		}
+	}
+	s.mutex.Unlock()
+	return ended, nil
+}
+
+// endIdle deactivates a timed-out session and audits it, once however many instances
+// notice. updated_at is left alone so the session still reads as idle afterwards.
+func (s *SessionActivityService) endIdle(session *models.Session, timeout time.Duration, now time.Time) bool {
+	s.mutex.Lock()
+	delete(s.checked, session.ID)
+	s.mutex.Unlock()
+
+	result := s.db.Model(&models.Session{}).Where("id = ? AND is_active = ?", session.ID, true).UpdateColumn("is_active", false)
+	if result.Error != nil {
+		log.Printf("⚠️ Failed to end idle session %s: %v", session.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	userID := session.UserID
+	auditLog := models.AuditLog{
+		UserID:     &userID,
+		Action:     "session_idle_timeout",
+		Resource:   "session",
+		ResourceID: session.ID.String(),
+		Details: fmt.Sprintf("Session ended after %s without activity (idle timeout %s, last activity %s)",
+			now.Sub(session.UpdatedAt).Round(time.Second), timeout, session.UpdatedAt.UTC().Format(time.RFC3339)),
+		Status: "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit idle session timeout: %v", err)
+	}
+	return true
+}
+
+func idleReason(timeout time.Duration) string {
+	return fmt.Sprintf("Your session ended after %d minutes without activity; please sign in again", int(timeout.Minutes()))
+}
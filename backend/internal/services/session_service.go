@@ -30,21 +30,28 @@ func NewSessionServiceForTesting(db *gorm.DB) *SessionService {
 
 // CreateSession creates a new session for a user
 func (s *SessionService) CreateSession(userID uuid.UUID, ipAddress, userAgent string) (*models.Session, error) {
-	// Generate session token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate session token: %w", err)
+	return s.CreateSessionWithMethod(userID, ipAddress, userAgent, models.AuthMethodPassword)
+}
+
+// CreateSessionWithMethod creates a session recording how the user authenticated
+func (s *SessionService) CreateSessionWithMethod(userID uuid.UUID, ipAddress, userAgent, authMethod string) (*models.Session, error) {
+	sessionToken, err := newSessionToken()
+	if err != nil {
+		return nil, err
 	}
-	sessionToken := hex.EncodeToString(tokenBytes)
 
 	// Create session
+	now := time.Now()
 	session := models.Session{
-		UserID:       userID,
-		SessionToken: sessionToken,
-		IPAddress:    ipAddress,
-		UserAgent:    userAgent,
-		ExpiresAt:    time.Now().Add(24 * time.Hour), // 24 hours default
-		IsActive:     true,
+		UserID:          userID,
+		SessionToken:    sessionToken,
+		IPAddress:       ipAddress,
+		UserAgent:       userAgent,
+		ExpiresAt:       now.Add(24 * time.Hour), // 24 hours default
+		IsActive:        true,
+		AuthLevel:       models.AAL1,
+		AuthMethod:      authMethod,
+		AuthenticatedAt: &now,
 	}
 
 	if err := s.db.Create(&session).Error; err != nil {
@@ -59,6 +66,40 @@ func (s *SessionService) CreateSession(userID uuid.UUID, ipAddress, userAgent st
 	return &session, nil
 }
 
+// CreateImpersonationSession creates a session for an administrator acting as a user.
+// It ends at a fixed time that refresh never extends, and skips the cleanup of old
+// sessions so the user's own sessions are left alone.
+func (s *SessionService) CreateImpersonationSession(userID, impersonatorID uuid.UUID, ipAddress, userAgent string, expiresAt time.Time) (*models.Session, error) {
+	sessionToken, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := models.Session{
+		UserID:         userID,
+		SessionToken:   sessionToken,
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		ExpiresAt:      expiresAt,
+		IsActive:       true,
+		AuthLevel:      models.AAL1,
+		AuthMethod:     models.AuthMethodImpersonation,
+		ImpersonatorID: &impersonatorID,
+	}
+	if err := s.db.Create(&session).Error; err != nil {
+		return nil, fmt.Errorf("failed to create impersonation session: %w", err)
+	}
+	return &session, nil
+}
+
+func newSessionToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
 // GetSessionByToken retrieves a session by token
 func (s *SessionService) GetSessionByToken(token string) (*models.Session, error) {
 	var session models.Session
@@ -77,6 +118,51 @@ func (s *SessionService) GetSessionByToken(token string) (*models.Session, error
 	return &session, nil
 }
 
+// GetSessionByID retrieves an active, unexpired session by its ID
+func (s *SessionService) GetSessionByID(sessionID uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := s.db.Preload("User").Where("id = ? AND is_active = ?", sessionID, true).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if session.IsExpired() {
+		s.db.Model(&session).Update("is_active", false)
+		return nil, fmt.Errorf("session expired")
+	}
+
+	return &session, nil
+}
+
+// ElevateSessionAAL raises the authentication assurance level of a session.
+// The level never decreases, so a WebAuthn session stays at AAL3 after a later TOTP check.
+func (s *SessionService) ElevateSessionAAL(sessionID uuid.UUID, level int) (*models.Session, error) {
+	if level < models.AAL1 || level > models.AAL3 {
+		return nil, fmt.Errorf("invalid authentication assurance level: %d", level)
+	}
+
+	session, err := s.GetSessionByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Any successful step-up also counts as re-authentication for apps that ask for a recent one
+	now := time.Now()
+	updates := map[string]interface{}{"authenticated_at": now}
+	if level > session.AuthLevel {
+		updates["auth_level"] = level
+	}
+	if err := s.db.Model(session).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to elevate session: %w", err)
+	}
+	session.AuthenticatedAt = &now
+	if level > session.AuthLevel {
+		session.AuthLevel = level
+	}
+
+	return session, nil
+}
+
 // ValidateSession validates a session and returns the user
 func (s *SessionService) ValidateSession(token string) (*models.User, error) {
 	session, err := s.GetSessionByToken(token)
@@ -97,10 +183,16 @@ func (s *SessionService) RefreshSession(token string) (*models.Session, error) {
 		return nil, err
 	}
 
-	// Extend expiry by 24 hours
+	// Impersonation sessions are time-boxed
+	if session.ImpersonatorID != nil {
+		return session, nil
+	}
+
+	// Extend expiry by 24 hours. Refreshing is not activity, so updated_at is left alone
+	// for idle timeouts.
 	session.ExpiresAt = time.Now().Add(24 * time.Hour)
 
-	if err := s.db.Save(session).Error; err != nil {
+	if err := s.db.Model(session).UpdateColumn("expires_at", session.ExpiresAt).Error; err != nil {
 		return nil, fmt.Errorf("failed to refresh session: %w", err)
 	}
 
@@ -0,0 +1,632 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Discovered app review statuses
+const (
+	DiscoveryStatusUnreviewed = "unreviewed"
+	DiscoveryStatusSanctioned = "sanctioned"
+	DiscoveryStatusBlocked    = "blocked"
+)
+
+// discoverySourceExtension is the source of apps found in browser extension domain reports
+const discoverySourceExtension = "browser_extension"
+
+// microsoftFirstPartyTenant owns Microsoft's own service principals, which are not shadow IT
+const microsoftFirstPartyTenant = "f8cdef31-a31e-4b4a-93e4-5f571e91255a"
+
+var (
+	// ErrDiscoveredAppNotFound is returned when a discovered app does not exist
+	ErrDiscoveredAppNotFound = errors.New("discovered app not found")
+	// ErrInvalidDiscoveryStatus is returned for an unknown review status
+	ErrInvalidDiscoveryStatus = errors.New("invalid discovery status")
+)
+
+// scopeRisks rates OAuth scopes by how much data they expose, matched case-insensitively
+// as substrings and checked in order. Unmatched scopes such as openid or profile rate low.
+var scopeRisks = []struct {
+	pattern string
+	score   int
+}{
+	// Mailbox, files and directory write access
+	{"https://mail.google.com/", 70},
+	{"gmail.modify", 70},
+	{"gmail.send", 70},
+	{"gmail.compose", 70},
+	{"auth/drive.readonly", 40},
+	{"auth/drive", 70},
+	{"admin.directory", 70},
+	{"cloud-platform", 70},
+	{"mail.readwrite", 70},
+	{"mail.send", 70},
+	{"files.readwrite", 70},
+	{"sites.readwrite", 70},
+	{"directory.readwrite", 70},
+	{"directory.accessasuser", 70},
+	{"user.readwrite.all", 70},
+	{"full_access_as_user", 70},
+	// Read access to mail, files, calendars, contacts and the directory
+	{"gmail.readonly", 40},
+	{"calendar", 40},
+	{"contacts", 40},
+	{"mail.read", 40},
+	{"files.read", 40},
+	{"sites.read", 40},
+	{"directory.read", 40},
+	{"user.read.all", 40},
+	{"people.read", 40},
+}
+
+// OAuthGrant is an OAuth grant a user (or an administrator, for everyone) gave a
+// third-party app on a connected tenant
+type OAuthGrant struct {
+	ClientID    string
+	DisplayName string
+	UserEmail   string
+	Scopes      []string
+	TenantWide  bool
+}
+
+// OAuthGrantProvider lists the third-party OAuth grants on a connected tenant
+type OAuthGrantProvider interface {
+	GetSource() string
+	IsConfigured() bool
+	FetchGrants(ctx context.Context) ([]OAuthGrant, error)
+}
+
+// ShadowITService discovers SaaS apps employees use outside the app catalog, from
+// browser extension domain reports and OAuth grant scans of connected tenants, and rates
+// how risky each one is
+type ShadowITService struct {
+	db           *gorm.DB
+	providers    map[string]OAuthGrantProvider
+	ownClientIDs map[string]bool
+	scanEvery    time.Duration
+}
+
+// NewShadowITService creates a new shadow IT discovery service with the built-in tenant scans
+func NewShadowITService(db *gorm.DB) *ShadowITService {
+	s := &ShadowITService{
+		db:        db,
+		providers: make(map[string]OAuthGrantProvider),
+		ownClientIDs: map[string]bool{
+			os.Getenv("GOOGLE_CLIENT_ID"):    true,
+			os.Getenv("MICROSOFT_CLIENT_ID"): true,
+		},
+		scanEvery: envDuration("SHADOW_IT_SCAN_INTERVAL", 24*time.Hour),
+	}
+	delete(s.ownClientIDs, "")
+	s.RegisterProvider(&GoogleOAuthGrantProvider{
+		AccessToken: os.Getenv("GOOGLE_ADMIN_ACCESS_TOKEN"),
+		CustomerID:  getEnv("GOOGLE_CUSTOMER_ID", "my_customer"),
+	})
+	s.RegisterProvider(&MicrosoftOAuthGrantProvider{
+		TenantID:     os.Getenv("MICROSOFT_TENANT_ID"),
+		ClientID:     os.Getenv("MICROSOFT_CLIENT_ID"),
+		ClientSecret: os.Getenv("MICROSOFT_CLIENT_SECRET"),
+	})
+	return s
+}
+
+// RegisterProvider adds or replaces the OAuth grant scan for a source
+func (s *ShadowITService) RegisterProvider(provider OAuthGrantProvider) {
+	s.providers[provider.GetSource()] = provider
+}
+
+// Interval is how often discovery should run
+func (s *ShadowITService) Interval() time.Duration {
+	return s.scanEvery
+}
+
+// Scan folds in browser extension domain reports and scans every configured tenant for
+// OAuth grants. Failures are returned per source so one broken scan does not block the rest.
+func (s *ShadowITService) Scan(ctx context.Context, now time.Time) map[string]error {
+	results := map[string]error{discoverySourceExtension: s.IngestDomainReports(now)}
+	for source, provider := range s.providers {
+		if !provider.IsConfigured() {
+			continue
+		}
+		grants, err := provider.FetchGrants(ctx)
+		if err != nil {
+			results[source] = err
+			continue
+		}
+		results[source] = s.RecordGrants(source, grants, now)
+	}
+	return results
+}
+
+// IngestDomainReports aggregates the sites users' browser extensions reported into
+// discovered apps, skipping sites that have since joined the catalog
+func (s *ShadowITService) IngestDomainReports(now time.Time) error {
+	type domainUsage struct {
+		users      int64
+		visits     int64
+		loginForms int64
+		firstSeen  time.Time
+		lastSeen   time.Time
+	}
+	usage := make(map[string]*domainUsage)
+
+	var batch []models.ExtensionDomainReport
+	err := s.db.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, report := range batch {
+			entry, ok := usage[report.Domain]
+			if !ok {
+				entry = &domainUsage{firstSeen: report.FirstSeen, lastSeen: report.LastSeen}
+				usage[report.Domain] = entry
+			}
+			entry.users++
+			entry.visits += report.Visits
+			entry.loginForms += report.LoginForms
+			if report.FirstSeen.Before(entry.firstSeen) {
+				entry.firstSeen = report.FirstSeen
+			}
+			if report.LastSeen.After(entry.lastSeen) {
+				entry.lastSeen = report.LastSeen
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to read domain reports: %w", err)
+	}
+
+	for domain, entry := range usage {
+		if _, known := GetSaaSAppByDomain(domain); known {
+			continue
+		}
+		app, err := getOrNewDiscoveredApp(s.db, "domain:"+domain, now)
+		if err != nil {
+			return err
+		}
+		app.Name = domain
+		app.Domain = domain
+		app.Source = discoverySourceExtension
+		app.Users = entry.users
+		app.Visits = entry.visits
+		app.LoginForms = entry.loginForms
+		app.FirstSeen = entry.firstSeen
+		app.LastSeen = entry.lastSeen
+		rateDiscoveredApp(app)
+		if err := s.db.Save(app).Error; err != nil {
+			return fmt.Errorf("failed to save discovered app: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordGrants replaces a source's OAuth grants with the ones found by a scan. Apps with no
+// grants left keep their history but drop to zero users.
+func (s *ShadowITService) RecordGrants(source string, grants []OAuthGrant, now time.Time) error {
+	byClient := make(map[string][]OAuthGrant)
+	for _, grant := range grants {
+		if grant.ClientID == "" || s.ownClientIDs[grant.ClientID] {
+			continue
+		}
+		byClient[grant.ClientID] = append(byClient[grant.ClientID], grant)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for clientID, clientGrants := range byClient {
+			app, err := getOrNewDiscoveredApp(tx, source+":"+clientID, now)
+			if err != nil {
+				return err
+			}
+			scopes := make(map[string]bool)
+			users := make(map[string]bool)
+			app.TenantWide = false
+			for _, grant := range clientGrants {
+				if grant.DisplayName != "" {
+					app.Name = grant.DisplayName
+				}
+				for _, scope := range grant.Scopes {
+					scopes[scope] = true
+				}
+				if grant.TenantWide {
+					app.TenantWide = true
+				} else if grant.UserEmail != "" {
+					users[strings.ToLower(grant.UserEmail)] = true
+				}
+			}
+			if app.Name == "" {
+				app.Name = clientID
+			}
+			app.ClientID = clientID
+			app.Source = source
+			app.Scopes = strings.Join(sortedKeys(scopes), " ")
+			app.Users = int64(len(users))
+			app.LastSeen = now
+			rateDiscoveredApp(app)
+			if err := tx.Save(app).Error; err != nil {
+				return fmt.Errorf("failed to save discovered app: %w", err)
+			}
+
+			for _, grant := range clientGrants {
+				email := strings.ToLower(grant.UserEmail)
+				if grant.TenantWide {
+					email = "*"
+				}
+				if email == "" {
+					continue
+				}
+				var record models.DiscoveredAppGrant
+				err := tx.Where("discovered_app_id = ? AND user_email = ?", app.ID, email).First(&record).Error
+				if err != nil && err != gorm.ErrRecordNotFound {
+					return fmt.Errorf("failed to get grant: %w", err)
+				}
+				record.DiscoveredAppID = app.ID
+				record.UserEmail = email
+				record.Scopes = strings.Join(grant.Scopes, " ")
+				record.LastSeen = now
+				if err := tx.Save(&record).Error; err != nil {
+					return fmt.Errorf("failed to save grant: %w", err)
+				}
+			}
+		}
+
+		// Grants not seen in this scan have been revoked
+		stale := tx.Model(&models.DiscoveredApp{}).Select("id").Where("source = ?", source)
+		if err := tx.Where("discovered_app_id IN (?) AND last_seen < ?", stale, now).Delete(&models.DiscoveredAppGrant{}).Error; err != nil {
+			return fmt.Errorf("failed to remove revoked grants: %w", err)
+		}
+		if err := tx.Model(&models.DiscoveredApp{}).Where("source = ? AND last_seen < ?", source, now).
+			Updates(map[string]interface{}{"users": 0, "tenant_wide": false}).Error; err != nil {
+			return fmt.Errorf("failed to update revoked apps: %w", err)
+		}
+		return nil
+	})
+}
+
+// Report lists discovered apps, riskiest first, optionally filtered by status and risk level
+func (s *ShadowITService) Report(status, riskLevel string) ([]models.DiscoveredApp, error) {
+	query := s.db.Model(&models.DiscoveredApp{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if riskLevel != "" {
+		query = query.Where("risk_level = ?", riskLevel)
+	}
+
+	var apps []models.DiscoveredApp
+	if err := query.Order("risk_score DESC, users DESC, name ASC").Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to list discovered apps: %w", err)
+	}
+	return apps, nil
+}
+
+// GetGrants returns the users who granted a discovered app access, as of the latest scan
+func (s *ShadowITService) GetGrants(id uuid.UUID) ([]models.DiscoveredAppGrant, error) {
+	var grants []models.DiscoveredAppGrant
+	if err := s.db.Where("discovered_app_id = ?", id).Order("user_email ASC").Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list grants: %w", err)
+	}
+	return grants, nil
+}
+
+// SetStatus records an administrator's review of a discovered app
+func (s *ShadowITService) SetStatus(id uuid.UUID, status, note string, reviewer *uuid.UUID) (*models.DiscoveredApp, error) {
+	switch status {
+	case DiscoveryStatusUnreviewed, DiscoveryStatusSanctioned, DiscoveryStatusBlocked:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDiscoveryStatus, status)
+	}
+
+	var app models.DiscoveredApp
+	if err := s.db.First(&app, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrDiscoveredAppNotFound
+		}
+		return nil, fmt.Errorf("failed to get discovered app: %w", err)
+	}
+
+	now := time.Now()
+	app.Status = status
+	app.ReviewNote = note
+	app.ReviewedBy = reviewer
+	app.ReviewedAt = &now
+	if err := s.db.Save(&app).Error; err != nil {
+		return nil, fmt.Errorf("failed to save discovered app: %w", err)
+	}
+
+	s.audit(reviewer, "shadow_it_reviewed", app.ID.String(), fmt.Sprintf("%s marked %s", app.Name, status))
+	return &app, nil
+}
+
+func getOrNewDiscoveredApp(db *gorm.DB, key string, now time.Time) (*models.DiscoveredApp, error) {
+	var app models.DiscoveredApp
+	err := db.Where("discovery_key = ?", key).First(&app).Error
+	if err == gorm.ErrRecordNotFound {
+		return &models.DiscoveredApp{DiscoveryKey: key, Status: DiscoveryStatusUnreviewed, FirstSeen: now}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get discovered app: %w", err)
+	}
+	return &app, nil
+}
+
+func (s *ShadowITService) audit(userID *uuid.UUID, action, resourceID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		Resource:   "discovered_app",
+		ResourceID: resourceID,
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit shadow IT review: %v", err)
+	}
+}
+
+// rateDiscoveredApp scores an app 0-100 from the most sensitive scope it was granted,
+// how widely it is used and whether people sign in to it with a password
+func rateDiscoveredApp(app *models.DiscoveredApp) {
+	score := 0
+	for _, scope := range strings.Fields(app.Scopes) {
+		if risk := scopeRisk(scope); risk > score {
+			score = risk
+		}
+	}
+	if app.Source == discoverySourceExtension {
+		// An unmanaged app has no known scopes; a sign-in form means company credentials
+		// may be reused there
+		score = 15
+		if app.LoginForms > 0 {
+			score += 25
+		}
+	}
+	if app.TenantWide {
+		score += 20
+	}
+	users := int(app.Users) * 2
+	if users > 20 {
+		users = 20
+	}
+	score += users
+	if score > 100 {
+		score = 100
+	}
+
+	app.RiskScore = score
+	switch {
+	case score >= 70:
+		app.RiskLevel = "high"
+	case score >= 40:
+		app.RiskLevel = "medium"
+	default:
+		app.RiskLevel = "low"
+	}
+}
+
+func scopeRisk(scope string) int {
+	scope = strings.ToLower(scope)
+	for _, risk := range scopeRisks {
+		if strings.Contains(scope, risk.pattern) {
+			return risk.score
+		}
+	}
+	return 10
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GoogleOAuthGrantProvider lists the third-party apps each Google Workspace user has
+// authorized via the Admin SDK Directory API. The access token needs the
+// admin.directory.user.readonly and admin.directory.user.security scopes.
+type GoogleOAuthGrantProvider struct {
+	AccessToken string
+	CustomerID  string
+	BaseURL     string // defaults to https://admin.googleapis.com
+}
+
+func (p *GoogleOAuthGrantProvider) GetSource() string  { return "google_oauth" }
+func (p *GoogleOAuthGrantProvider) IsConfigured() bool { return p.AccessToken != "" }
+
+// FetchGrants pages through the tenant's users and reads each one's OAuth tokens
+func (p *GoogleOAuthGrantProvider) FetchGrants(ctx context.Context) ([]OAuthGrant, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = "https://admin.googleapis.com"
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var grants []OAuthGrant
+	pageToken := ""
+	for {
+		params := url.Values{}
+		params.Set("customer", p.CustomerID)
+		params.Set("maxResults", "500")
+		params.Set("fields", "users(primaryEmail),nextPageToken")
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+		var page struct {
+			Users []struct {
+				PrimaryEmail string `json:"primaryEmail"`
+			} `json:"users"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := p.get(ctx, client, baseURL+"/admin/directory/v1/users?"+params.Encode(), &page); err != nil {
+			return nil, fmt.Errorf("failed to list Google Workspace users: %w", err)
+		}
+
+		for _, user := range page.Users {
+			var tokens struct {
+				Items []struct {
+					ClientID    string   `json:"clientId"`
+					DisplayText string   `json:"displayText"`
+					Scopes      []string `json:"scopes"`
+				} `json:"items"`
+			}
+			endpoint := baseURL + "/admin/directory/v1/users/" + url.PathEscape(user.PrimaryEmail) + "/tokens"
+			if err := p.get(ctx, client, endpoint, &tokens); err != nil {
+				return nil, fmt.Errorf("failed to list OAuth tokens for %s: %w", user.PrimaryEmail, err)
+			}
+			for _, token := range tokens.Items {
+				grants = append(grants, OAuthGrant{
+					ClientID:    token.ClientID,
+					DisplayName: token.DisplayText,
+					UserEmail:   user.PrimaryEmail,
+					Scopes:      token.Scopes,
+				})
+			}
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+	return grants, nil
+}
+
+func (p *GoogleOAuthGrantProvider) get(ctx context.Context, client *http.Client, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.AccessToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return decodeProviderResponse(resp, out)
+}
+
+// MicrosoftOAuthGrantProvider lists delegated permission grants to third-party apps from
+// Microsoft Graph using the client credentials flow. The app registration needs
+// DelegatedPermissionGrant.Read.All, Application.Read.All and User.Read.All.
+type MicrosoftOAuthGrantProvider struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	LoginURL     string // defaults to https://login.microsoftonline.com
+	GraphURL     string // defaults to https://graph.microsoft.com
+}
+
+func (p *MicrosoftOAuthGrantProvider) GetSource() string { return "microsoft_oauth" }
+func (p *MicrosoftOAuthGrantProvider) IsConfigured() bool {
+	return p.TenantID != "" && p.ClientID != "" && p.ClientSecret != ""
+}
+
+// FetchGrants reads every delegated permission grant and resolves the app and user behind
+// it, skipping apps published by the tenant itself or by Microsoft
+func (p *MicrosoftOAuthGrantProvider) FetchGrants(ctx context.Context) ([]OAuthGrant, error) {
+	loginURL, graphURL := p.LoginURL, p.GraphURL
+	if loginURL == "" {
+		loginURL = "https://login.microsoftonline.com"
+	}
+	if graphURL == "" {
+		graphURL = "https://graph.microsoft.com"
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	accessToken, err := fetchMicrosoftGraphToken(ctx, client, loginURL, p.TenantID, p.ClientID, p.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	get := func(endpoint string, out interface{}) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to query Microsoft Graph: %w", err)
+		}
+		return decodeProviderResponse(resp, out)
+	}
+
+	type servicePrincipal struct {
+		AppID                  string `json:"appId"`
+		DisplayName            string `json:"displayName"`
+		AppOwnerOrganizationID string `json:"appOwnerOrganizationId"`
+	}
+	principals := make(map[string]*servicePrincipal)
+	userEmails := make(map[string]string)
+
+	var grants []OAuthGrant
+	next := graphURL + "/v1.0/oauth2PermissionGrants"
+	for next != "" {
+		var page struct {
+			Value []struct {
+				ClientID    string `json:"clientId"`
+				ConsentType string `json:"consentType"`
+				PrincipalID string `json:"principalId"`
+				Scope       string `json:"scope"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		if err := get(next, &page); err != nil {
+			return nil, err
+		}
+
+		for _, grant := range page.Value {
+			sp, ok := principals[grant.ClientID]
+			if !ok {
+				sp = &servicePrincipal{}
+				endpoint := graphURL + "/v1.0/servicePrincipals/" + url.PathEscape(grant.ClientID) + "?$select=appId,displayName,appOwnerOrganizationId"
+				if err := get(endpoint, sp); err != nil {
+					return nil, err
+				}
+				principals[grant.ClientID] = sp
+			}
+			if sp.AppOwnerOrganizationID == p.TenantID || sp.AppOwnerOrganizationID == microsoftFirstPartyTenant {
+				continue
+			}
+
+			entry := OAuthGrant{
+				ClientID:    sp.AppID,
+				DisplayName: sp.DisplayName,
+				Scopes:      strings.Fields(grant.Scope),
+				TenantWide:  grant.ConsentType == "AllPrincipals",
+			}
+			if !entry.TenantWide && grant.PrincipalID != "" {
+				email, ok := userEmails[grant.PrincipalID]
+				if !ok {
+					var user struct {
+						UserPrincipalName string `json:"userPrincipalName"`
+						Mail              string `json:"mail"`
+					}
+					endpoint := graphURL + "/v1.0/users/" + url.PathEscape(grant.PrincipalID) + "?$select=userPrincipalName,mail"
+					if err := get(endpoint, &user); err != nil {
+						return nil, err
+					}
+					email = user.Mail
+					if email == "" {
+						email = user.UserPrincipalName
+					}
+					userEmails[grant.PrincipalID] = email
+				}
+				entry.UserEmail = email
+			}
+			grants = append(grants, entry)
+		}
+		next = page.NextLink
+	}
+	return grants, nil
+}
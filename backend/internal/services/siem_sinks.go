@@ -0,0 +1,381 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogEnterpriseID is the private enterprise number in syslog structured data IDs
+const syslogEnterpriseID = "32473"
+
+// SplunkHECSink sends events to a Splunk HTTP Event Collector, a batch per request
+type SplunkHECSink struct {
+	URL        string
+	Token      string
+	Index      string // the token's default index when empty
+	SourceType string
+	Host       string
+	client     *http.Client
+}
+
+// NewSplunkHECSink creates a sink for the collector at url, which may be the server's base
+// URL or the full event endpoint
+func NewSplunkHECSink(url, token string) *SplunkHECSink {
+	url = strings.TrimRight(url, "/")
+	if !strings.Contains(url, "/services/collector") {
+		url += "/services/collector/event"
+	}
+	host, _ := os.Hostname()
+	return &SplunkHECSink{
+		URL:        url,
+		Token:      token,
+		SourceType: "cloudgate",
+		Host:       host,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the sink in logs and stats
+func (s *SplunkHECSink) Name() string {
+	return "splunk_hec"
+}
+
+// Send posts the batch as concatenated HEC event objects
+func (s *SplunkHECSink) Send(ctx context.Context, events []SIEMEvent) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, event := range events {
+		envelope := map[string]interface{}{
+			"time":       float64(event.Timestamp.UnixMilli()) / 1000,
+			"source":     "cloudgate:" + event.Kind,
+			"sourcetype": s.SourceType,
+			"event":      event,
+		}
+		if s.Host != "" {
+			envelope["host"] = s.Host
+		}
+		if s.Index != "" {
+			envelope["index"] = s.Index
+		}
+		if err := encoder.Encode(envelope); err != nil {
+			return fmt.Errorf("%w: failed to encode event %s: %v", ErrSIEMRejected, event.ID, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, &body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSIEMRejected, err)
+	}
+	req.Header.Set("Authorization", "Splunk "+s.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Splunk HEC: %w", err)
+	}
+	defer resp.Body.Close()
+	return siemResponseError("Splunk HEC", resp)
+}
+
+// ElasticsearchSink indexes events into an Elasticsearch index or data stream through the
+// bulk API. Each event is created with its id as the document id, so one sent again after
+// a retry is not indexed twice.
+type ElasticsearchSink struct {
+	URL      string
+	Index    string
+	APIKey   string // base64 encoded id:key, preferred over basic auth
+	Username string
+	Password string
+	client   *http.Client
+}
+
+// NewElasticsearchSink creates a sink for the cluster at url
+func NewElasticsearchSink(url, index string) *ElasticsearchSink {
+	return &ElasticsearchSink{
+		URL:    strings.TrimSuffix(strings.TrimRight(url, "/"), "/_bulk"),
+		Index:  index,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the sink in logs and stats
+func (s *ElasticsearchSink) Name() string {
+	return "elasticsearch"
+}
+
+// elasticBulkResponse is the part of a bulk API response that says how each item went
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Send indexes the batch in one bulk request. Items Elasticsearch was too busy for are
+// returned to retry in a SIEMPartialError; items it refused, such as for a mapping
+// conflict, are not.
+func (s *ElasticsearchSink) Send(ctx context.Context, events []SIEMEvent) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, event := range events {
+		action := map[string]interface{}{"create": map[string]string{"_index": s.Index, "_id": event.ID}}
+		document := struct {
+			Timestamp time.Time `json:"@timestamp"`
+			SIEMEvent
+		}{event.Timestamp, event}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("%w: failed to encode event %s: %v", ErrSIEMRejected, event.ID, err)
+		}
+		if err := encoder.Encode(document); err != nil {
+			return fmt.Errorf("%w: failed to encode event %s: %v", ErrSIEMRejected, event.ID, err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/_bulk", &body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSIEMRejected, err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case s.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Elasticsearch: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := siemResponseError("Elasticsearch", resp); err != nil {
+		return err
+	}
+
+	var result elasticBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode Elasticsearch bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	// The reason given is the first refusal's, or failing that the first throttling's
+	partial := &SIEMPartialError{}
+	for i, item := range result.Items {
+		if i >= len(events) {
+			break
+		}
+		for _, outcome := range item {
+			// A conflict means the document was created by an earlier attempt
+			if outcome.Status < 300 || outcome.Status == http.StatusConflict {
+				continue
+			}
+			retry := outcome.Status == http.StatusTooManyRequests || outcome.Status >= 500
+			if outcome.Error != nil && (partial.Reason == "" || !retry && partial.Rejected == 0) {
+				partial.Reason = outcome.Error.Type + ": " + outcome.Error.Reason
+			}
+			if retry {
+				partial.Retry = append(partial.Retry, events[i])
+			} else {
+				partial.Rejected++
+			}
+		}
+	}
+	if len(partial.Retry) == 0 && partial.Rejected == 0 {
+		return nil
+	}
+	return partial
+}
+
+// SyslogSink sends events as RFC 5424 syslog messages over UDP, TCP or TLS, one message
+// per datagram over UDP and octet counted (RFC 6587) over a stream. Each message carries
+// the event's type, severity, outcome, user and address as structured data and the whole
+// event as JSON in its body.
+type SyslogSink struct {
+	Network   string // udp, tcp or tls
+	Addr      string
+	Facility  int // 10 (authpriv) by default
+	Hostname  string
+	AppName   string
+	TLSConfig *tls.Config
+	conn      net.Conn
+}
+
+// NewSyslogSink creates a sink for the syslog server at addr
+func NewSyslogSink(network, addr string) *SyslogSink {
+	host, _ := os.Hostname()
+	return &SyslogSink{
+		Network:  strings.ToLower(network),
+		Addr:     addr,
+		Facility: 10,
+		Hostname: host,
+		AppName:  "cloudgate",
+	}
+}
+
+// Name identifies the sink in logs and stats
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Send writes the batch over the sink's connection, reconnecting if it was lost
+func (s *SyslogSink) Send(ctx context.Context, events []SIEMEvent) error {
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog server: %w", err)
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	var stream bytes.Buffer
+	for _, event := range events {
+		message, err := s.Format(event)
+		if err != nil {
+			return fmt.Errorf("%w: failed to format event %s: %v", ErrSIEMRejected, event.ID, err)
+		}
+		if s.Network == "udp" {
+			if _, err := s.conn.Write(message); err != nil {
+				return s.lost(err)
+			}
+			continue
+		}
+		stream.WriteString(strconv.Itoa(len(message)))
+		stream.WriteByte(' ')
+		stream.Write(message)
+	}
+	if stream.Len() > 0 {
+		if _, err := s.conn.Write(stream.Bytes()); err != nil {
+			return s.lost(err)
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	switch s.Network {
+	case "udp", "tcp":
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, s.Network, s.Addr)
+	case "tls":
+		dialer := tls.Dialer{Config: s.TLSConfig}
+		return dialer.DialContext(ctx, "tcp", s.Addr)
+	default:
+		return nil, fmt.Errorf("%w: unsupported syslog network %q", ErrSIEMRejected, s.Network)
+	}
+}
+
+// lost drops a connection that failed to write, so the retry reconnects
+func (s *SyslogSink) lost(err error) error {
+	s.conn.Close()
+	s.conn = nil
+	return fmt.Errorf("failed to write to syslog server: %w", err)
+}
+
+// Format renders an event as an RFC 5424 message
+func (s *SyslogSink) Format(event SIEMEvent) ([]byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "<%d>1 %s %s %s %d %s ",
+		s.Facility*8+syslogSeverity(event.Severity),
+		event.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		syslogHeaderField(s.Hostname, 255),
+		syslogHeaderField(s.AppName, 48),
+		os.Getpid(),
+		syslogHeaderField(event.Kind, 32))
+
+	userID := ""
+	if event.UserID != nil {
+		userID = event.UserID.String()
+	}
+	message.WriteString("[cloudgate@" + syslogEnterpriseID)
+	for _, param := range [][2]string{
+		{"id", event.ID},
+		{"type", event.Type},
+		{"severity", event.Severity},
+		{"outcome", event.Outcome},
+		{"user_id", userID},
+		{"ip", event.IPAddress},
+		{"resource", event.Resource},
+	} {
+		if param[1] != "" {
+			message.WriteString(" " + param[0] + `="` + syslogParamValue(param[1]) + `"`)
+		}
+	}
+	message.WriteString("] ")
+	message.Write(body)
+	return message.Bytes(), nil
+}
+
+// syslogSeverity maps an event's severity to a syslog severity
+func syslogSeverity(severity string) int {
+	switch severity {
+	case "critical":
+		return 2
+	case "high", "error":
+		return 3
+	case "medium", "warning":
+		return 4
+	case "low":
+		return 5
+	default:
+		return 6
+	}
+}
+
+// syslogHeaderField makes value fit a header field: printable ASCII without spaces, or
+// the nil value
+func syslogHeaderField(value string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// syslogParamValue escapes the characters a structured data value cannot hold as is
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// siemResponseError classifies an HTTP response: throttling and server errors are worth
+// retrying, other failures mean the SIEM refused the events
+func siemResponseError(service string, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s returned %s: %s", service, resp.Status, strings.TrimSpace(string(detail)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500 {
+		return err
+	}
+	return errors.Join(ErrSIEMRejected, err)
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Slack alert button action IDs. Each alert's actions block has the alert ID as its block ID.
+const (
+	SlackActionAcknowledge = "alert_acknowledge"
+	SlackActionResolve     = "alert_resolve"
+	SlackActionAssign      = "alert_assign" // a users_select of the analyst to assign
+)
+
+const slackAlertBlockPrefix = "alert:"
+
+var (
+	// ErrInvalidSlackSignature is returned for requests not signed with SLACK_SIGNING_SECRET
+	// or signed too long ago
+	ErrInvalidSlackSignature = errors.New("invalid Slack request signature")
+	// ErrSlackUserUnauthorized is returned when a Slack user is not mapped to an active analyst
+	ErrSlackUserUnauthorized = errors.New("Slack user is not linked to an active CloudGate analyst")
+	// ErrInvalidSlackAction is returned for interactions this integration did not send
+	ErrInvalidSlackAction = errors.New("invalid Slack action")
+)
+
+// SlackCommand is a slash command invocation, such as /cloudgate alerts
+type SlackCommand struct {
+	TeamID  string
+	UserID  string
+	Command string
+	Text    string
+}
+
+// SlackInteraction is a block_actions payload sent when an alert button is clicked
+type SlackInteraction struct {
+	Type string `json:"type"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string             `json:"response_url"`
+	Actions     []SlackBlockAction `json:"actions"`
+}
+
+// SlackBlockAction is one clicked button or chosen menu option
+type SlackBlockAction struct {
+	ActionID     string `json:"action_id"`
+	BlockID      string `json:"block_id"`
+	SelectedUser string `json:"selected_user"`
+}
+
+// SlackMessage is a message sent back to Slack
+type SlackMessage struct {
+	ResponseType    string                   `json:"response_type,omitempty"` // ephemeral or in_channel
+	ReplaceOriginal bool                     `json:"replace_original,omitempty"`
+	Text            string                   `json:"text"`
+	Blocks          []map[string]interface{} `json:"blocks,omitempty"`
+}
+
+// SlackTriageService lets analysts list and triage alerts from Slack: /cloudgate alerts
+// posts the alert queue with buttons to acknowledge, resolve or assign each alert
+type SlackTriageService struct {
+	db            *gorm.DB
+	security      *SecurityMonitoringService
+	signingSecret string
+	maxAge        time.Duration
+	client        *http.Client
+}
+
+// NewSlackTriageService creates a new Slack triage service
+func NewSlackTriageService(db *gorm.DB, security *SecurityMonitoringService) *SlackTriageService {
+	return &SlackTriageService{
+		db:            db,
+		security:      security,
+		signingSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+		maxAge:        5 * time.Minute,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled reports whether a Slack signing secret is configured
+func (s *SlackTriageService) Enabled() bool {
+	return s.signingSecret != ""
+}
+
+// VerifyRequest checks a request's X-Slack-Signature, an HMAC of the timestamp and body,
+// and that its X-Slack-Request-Timestamp is recent so it cannot be replayed later
+func (s *SlackTriageService) VerifyRequest(timestamp, signature string, body []byte, now time.Time) error {
+	if !s.Enabled() {
+		return fmt.Errorf("%w: SLACK_SIGNING_SECRET is not set", ErrInvalidSlackSignature)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidSlackSignature)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > s.maxAge || age < -s.maxAge {
+		return fmt.Errorf("%w: timestamp is outside %s", ErrInvalidSlackSignature, s.maxAge)
+	}
+	mac := hmac.New(sha256.New, []byte(s.signingSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSlackSignature
+	}
+	return nil
+}
+
+// ResolveAnalyst returns the CloudGate user a Slack user acts as: an admin-made link if
+// there is one, otherwise the analyst who connected that Slack account through OAuth
+func (s *SlackTriageService) ResolveAnalyst(teamID, slackUserID string, now time.Time) (uuid.UUID, error) {
+	var userID uuid.UUID
+	var link models.SlackAnalyst
+	err := s.db.First(&link, "team_id = ? AND slack_user_id = ?", teamID, slackUserID).Error
+	switch {
+	case err == nil:
+		userID = link.UserID
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var found bool
+		if userID, found, err = s.connectedAnalyst(teamID, slackUserID); err != nil {
+			return uuid.Nil, err
+		} else if !found {
+			return uuid.Nil, fmt.Errorf("%w: %s", ErrSlackUserUnauthorized, slackUserID)
+		}
+	default:
+		return uuid.Nil, fmt.Errorf("failed to get Slack analyst: %w", err)
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, fmt.Errorf("%w: %s", ErrSlackUserUnauthorized, slackUserID)
+		}
+		return uuid.Nil, fmt.Errorf("failed to get analyst: %w", err)
+	}
+	if !user.IsActive || user.IsLocked(now) {
+		return uuid.Nil, fmt.Errorf("%w: account is inactive or locked", ErrSlackUserUnauthorized)
+	}
+	return userID, nil
+}
+
+// connectedAnalyst finds the user whose Slack connection is the given Slack account
+func (s *SlackTriageService) connectedAnalyst(teamID, slackUserID string) (uuid.UUID, bool, error) {
+	var connections []models.AppConnection
+	if err := s.db.Select("user_id", "app_id", "extras").
+		Where("app_id = ? AND status = ? AND extras LIKE ?", "slack", models.ConnectionConnected, "%"+slackUserID+"%").
+		Find(&connections).Error; err != nil {
+		return uuid.Nil, false, fmt.Errorf("failed to get Slack connections: %w", err)
+	}
+	for _, connection := range connections {
+		extras := connectionExtras(connection)
+		if extras["slack_user_id"] == slackUserID && extras["team_id"] == teamID {
+			return connection.UserID, true, nil
+		}
+	}
+	return uuid.Nil, false, nil
+}
+
+// LinkAnalyst maps a Slack user to a CloudGate analyst, replacing any earlier mapping
+func (s *SlackTriageService) LinkAnalyst(teamID, slackUserID string, userID uuid.UUID, linkedBy *uuid.UUID) (*models.SlackAnalyst, error) {
+	if err := s.db.First(&models.User{}, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	link := models.SlackAnalyst{TeamID: teamID, SlackUserID: slackUserID, UserID: userID, LinkedBy: linkedBy}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "team_id"}, {Name: "slack_user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "linked_by", "updated_at"}),
+	}).Create(&link).Error; err != nil {
+		return nil, fmt.Errorf("failed to link Slack analyst: %w", err)
+	}
+	return &link, nil
+}
+
+// UnlinkAnalyst removes a Slack user's mapping, reporting whether there was one
+func (s *SlackTriageService) UnlinkAnalyst(teamID, slackUserID string) (bool, error) {
+	result := s.db.Delete(&models.SlackAnalyst{}, "team_id = ? AND slack_user_id = ?", teamID, slackUserID)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to unlink Slack analyst: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ListAnalysts returns the admin-made Slack analyst mappings
+func (s *SlackTriageService) ListAnalysts() ([]models.SlackAnalyst, error) {
+	var links []models.SlackAnalyst
+	if err := s.db.Order("team_id, slack_user_id").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to list Slack analysts: %w", err)
+	}
+	return links, nil
+}
+
+// HandleCommand answers a slash command, visible only to the analyst who ran it.
+// "alerts [count]" lists the top of the alert queue; anything else shows usage.
+func (s *SlackTriageService) HandleCommand(command SlackCommand, now time.Time) (*SlackMessage, error) {
+	if _, err := s.ResolveAnalyst(command.TeamID, command.UserID, now); err != nil {
+		return nil, err
+	}
+
+	args := strings.Fields(command.Text)
+	if len(args) == 0 || args[0] != "alerts" {
+		return &SlackMessage{
+			ResponseType: "ephemeral",
+			Text:         fmt.Sprintf("Usage: `%s alerts [count]` lists the open alert queue, highest priority first", command.Command),
+		}, nil
+	}
+	count := 10
+	if len(args) > 1 {
+		if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+			count = min(n, 25)
+		}
+	}
+
+	alerts, total, err := s.security.GetAlertQueue(count, 0)
+	if err != nil {
+		return nil, err
+	}
+	message := &SlackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf("%d alert(s) awaiting triage", total)}
+	if total == 0 {
+		message.Text = "No alerts awaiting triage :tada:"
+		return message, nil
+	}
+	message.Blocks = append(message.Blocks, slackText(fmt.Sprintf("*%d alert(s) awaiting triage*, showing the top %d", total, len(alerts))))
+	for _, alert := range alerts {
+		message.Blocks = append(message.Blocks, slackAlertBlocks(alert)...)
+	}
+	return message, nil
+}
+
+// HandleInteraction carries out an alert button click as the analyst who clicked it and
+// returns the alert's updated message
+func (s *SlackTriageService) HandleInteraction(ctx context.Context, interaction SlackInteraction, now time.Time) (*SlackMessage, error) {
+	if interaction.Type != "block_actions" || len(interaction.Actions) != 1 {
+		return nil, fmt.Errorf("%w: expected one block action", ErrInvalidSlackAction)
+	}
+	action := interaction.Actions[0]
+	alertID, err := uuid.Parse(strings.TrimPrefix(action.BlockID, slackAlertBlockPrefix))
+	if err != nil || !strings.HasPrefix(action.BlockID, slackAlertBlockPrefix) {
+		return nil, fmt.Errorf("%w: block %q is not an alert", ErrInvalidSlackAction, action.BlockID)
+	}
+	analystID, err := s.ResolveAnalyst(interaction.Team.ID, interaction.User.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	alert, err := s.security.GetAlert(alertID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, assignee, verb := alert.Status, alert.AssignedTo, ""
+	switch action.ActionID {
+	case SlackActionAcknowledge:
+		status, assignee, verb = StatusInProgress, &analystID, "acknowledged"
+	case SlackActionResolve:
+		status, verb = StatusResolved, "resolved"
+	case SlackActionAssign:
+		if action.SelectedUser == "" {
+			return nil, fmt.Errorf("%w: no analyst selected", ErrInvalidSlackAction)
+		}
+		assigneeID, err := s.ResolveAnalyst(interaction.Team.ID, action.SelectedUser, now)
+		if err != nil {
+			return nil, err
+		}
+		assignee, verb = &assigneeID, "assigned"
+		if status == StatusOpen {
+			status = StatusInProgress
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidSlackAction, action.ActionID)
+	}
+
+	if err := s.security.UpdateAlertStatus(alertID, status, assignee); err != nil {
+		return nil, err
+	}
+	LogAuditEvent(ctx, analystID.String(), "alert_"+verb, "security_alert", alertID.String(), "", "slack",
+		fmt.Sprintf("Alert %s from Slack by %s", verb, interaction.User.ID), "success")
+
+	alert.Status, alert.AssignedTo = status, assignee
+	blocks := slackAlertBlocks(*alert)
+	blocks = append(blocks, slackContext(fmt.Sprintf("%s by <@%s>", strings.ToUpper(verb[:1])+verb[1:], interaction.User.ID)))
+	return &SlackMessage{ReplaceOriginal: true, Text: alert.Title, Blocks: blocks}, nil
+}
+
+// Respond posts a message to an interaction's response_url, which must be Slack's
+func (s *SlackTriageService) Respond(responseURL string, message *SlackMessage) error {
+	parsed, err := url.Parse(responseURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host != "hooks.slack.com" {
+		return fmt.Errorf("%w: response_url %q is not a Slack URL", ErrInvalidSlackAction, responseURL)
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode Slack message: %w", err)
+	}
+	resp, err := s.client.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post Slack response: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to post Slack response: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// slackAlertBlocks renders an alert with its triage buttons; closed alerts get none
+func slackAlertBlocks(alert SecurityAlert) []map[string]interface{} {
+	summary := fmt.Sprintf("*[%s] %s*\n%s · %s · priority %.0f", alert.Severity, alert.Title, alert.Type, alert.Status, alert.Priority.Score)
+	if alert.AssignedTo != nil {
+		summary += fmt.Sprintf(" · assigned to %s", alert.AssignedTo)
+	}
+	blocks := []map[string]interface{}{slackText(summary)}
+	if alert.Status == StatusResolved || alert.Status == StatusFalsePositive {
+		return blocks
+	}
+	return append(blocks, map[string]interface{}{
+		"type":     "actions",
+		"block_id": slackAlertBlockPrefix + alert.ID.String(),
+		"elements": []map[string]interface{}{
+			slackButton(SlackActionAcknowledge, "Acknowledge", ""),
+			slackButton(SlackActionResolve, "Resolve", "primary"),
+			{
+				"type":        "users_select",
+				"action_id":   SlackActionAssign,
+				"placeholder": map[string]interface{}{"type": "plain_text", "text": "Assign to…"},
+			},
+		},
+	})
+}
+
+func slackText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "section", "text": map[string]interface{}{"type": "mrkdwn", "text": text}}
+}
+
+func slackContext(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "context",
+		"elements": []map[string]interface{}{{"type": "mrkdwn", "text": text}},
+	}
+}
+
+func slackButton(actionID, text, style string) map[string]interface{} {
+	button := map[string]interface{}{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      map[string]interface{}{"type": "plain_text", "text": text},
+	}
+	if style != "" {
+		button["style"] = style
+	}
+	return button
+}
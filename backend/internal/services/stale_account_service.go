@@ -0,0 +1,474 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/pkg/constants"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// dormantLockPrefix starts the lock reason of accounts disabled for inactivity, so sign-in
+// can point their owners to the reactivation workflow
+const dormantLockPrefix = "Dormant:"
+
+var (
+	ErrDormantAccountNotFound = errors.New("no disabled dormant account for this user")
+	ErrNotDormantLock         = errors.New("account is locked for another reason")
+)
+
+// DormantAccountSummary counts dormant accounts by where they stand, for admins and
+// compliance reports
+type DormantAccountSummary struct {
+	ThresholdDays         int   `json:"threshold_days"`
+	AutoDisable           bool  `json:"auto_disable"`
+	Warned                int64 `json:"warned"`
+	Dormant               int64 `json:"dormant"` // past the limit but still enabled
+	Disabled              int64 `json:"disabled"`
+	ReactivationRequested int64 `json:"reactivation_requested"`
+	Reactivated           int64 `json:"reactivated"`
+}
+
+// StaleAccountScan is what one scan for dormant accounts found
+type StaleAccountScan struct {
+	Warned   int `json:"warned"`
+	Dormant  int `json:"dormant"`
+	Disabled int `json:"disabled"`
+	Cleared  int `json:"cleared"` // owners who signed in again
+}
+
+// StaleAccountService finds accounts nobody has signed in to for STALE_ACCOUNT_DAYS.
+// Owners are warned STALE_ACCOUNT_WARNING_DAYS ahead, admins are alerted, and with
+// STALE_ACCOUNT_AUTO_DISABLE the accounts are locked until an admin reactivates them,
+// usually after the owner asks to. Accounts listed in STALE_ACCOUNT_EXEMPT, such as break
+// glass accounts that are rightly idle, are never flagged.
+type StaleAccountService struct {
+	db          *gorm.DB
+	security    *SecurityMonitoringService
+	push        *PushService
+	threshold   time.Duration
+	warning     time.Duration
+	autoDisable bool
+	exempt      map[string]bool
+	interval    time.Duration
+	link        string
+}
+
+// NewStaleAccountService creates a dormant account detector configured from the
+// environment. push may be nil, leaving owners to find the warning in their audit log.
+func NewStaleAccountService(db *gorm.DB, security *SecurityMonitoringService, push *PushService) *StaleAccountService {
+	exempt := make(map[string]bool)
+	for _, email := range strings.Split(getEnv("STALE_ACCOUNT_EXEMPT", ""), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			exempt[email] = true
+		}
+	}
+	return &StaleAccountService{
+		db:          db,
+		security:    security,
+		push:        push,
+		threshold:   time.Duration(envInt("STALE_ACCOUNT_DAYS", 90)) * 24 * time.Hour,
+		warning:     time.Duration(envInt("STALE_ACCOUNT_WARNING_DAYS", 14)) * 24 * time.Hour,
+		autoDisable: getEnv("STALE_ACCOUNT_AUTO_DISABLE", "false") == "true",
+		exempt:      exempt,
+		interval:    envDuration("STALE_ACCOUNT_INTERVAL", 24*time.Hour),
+		link:        strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/") + "/dashboard/security",
+	}
+}
+
+// Interval is how often Scan should run
+func (s *StaleAccountService) Interval() time.Duration {
+	return s.interval
+}
+
+// IsDormantLock reports whether the user is locked for going unused, and so can ask for
+// their account back
+func IsDormantLock(user *models.User) bool {
+	return user.IsLocked(time.Now()) && strings.HasPrefix(user.LockReason, dormantLockPrefix)
+}
+
+// Scan warns the owners of accounts nearing the limit, and flags or disables the
+// accounts past it. Accounts whose owners signed in again are cleared.
+func (s *StaleAccountService) Scan(now time.Time) (StaleAccountScan, error) {
+	var scan StaleAccountScan
+	var users []models.User
+	if err := s.db.Find(&users).Error; err != nil {
+		return scan, fmt.Errorf("failed to list users: %w", err)
+	}
+	var records []models.DormantAccount
+	if err := s.db.Find(&records).Error; err != nil {
+		return scan, fmt.Errorf("failed to list dormant accounts: %w", err)
+	}
+	byUser := make(map[uuid.UUID]*models.DormantAccount, len(records))
+	for i := range records {
+		byUser[records[i].UserID] = &records[i]
+	}
+
+	var flagged []string
+	for i := range users {
+		user := &users[i]
+		if user.ID.String() == constants.DemoUserID || s.exempt[strings.ToLower(user.Email)] {
+			continue
+		}
+		record := byUser[user.ID]
+		signIn, err := s.lastSignIn(user)
+		if err != nil {
+			return scan, err
+		}
+
+		// Reactivated owners get the warning period to sign in before the account goes again
+		since := signIn
+		if record != nil {
+			if record.Status == models.DormantStatusDisabled || record.Status == models.DormantStatusReactivationRequested {
+				// Waiting on an admin, unless one unlocked the account some other way
+				if !user.IsLocked(now) {
+					s.reactivated(record, nil, now)
+				}
+				continue
+			}
+			if record.ReactivatedAt != nil && !signIn.After(*record.ReactivatedAt) {
+				since = record.ReactivatedAt.Add(s.warning - s.threshold)
+			}
+		}
+		if user.IsLocked(now) {
+			continue
+		}
+
+		idle := now.Sub(since)
+		switch {
+		case idle < s.threshold-s.warning:
+			if record != nil {
+				s.clear(record)
+				scan.Cleared++
+			}
+		case idle < s.threshold:
+			if record == nil || record.Status == models.DormantStatusReactivated {
+				if err := s.warn(user, record, signIn, since.Add(s.threshold), now); err != nil {
+					return scan, err
+				}
+				scan.Warned++
+				flagged = append(flagged, user.Email)
+			}
+		default:
+			if s.autoDisable {
+				if err := s.disable(user, record, signIn, now); err != nil {
+					return scan, err
+				}
+				scan.Disabled++
+				flagged = append(flagged, user.Email)
+			} else if record == nil || record.Status != models.DormantStatusDormant {
+				if err := s.markDormant(user, record, signIn); err != nil {
+					return scan, err
+				}
+				scan.Dormant++
+				flagged = append(flagged, user.Email)
+			}
+		}
+	}
+
+	if len(flagged) > 0 {
+		s.alert(scan, flagged)
+	}
+	return scan, nil
+}
+
+// lastSignIn is the latest sign-in, session refresh or account creation for the user
+func (s *StaleAccountService) lastSignIn(user *models.User) (time.Time, error) {
+	latest := user.CreatedAt
+	if user.LastLoginAt != nil && user.LastLoginAt.After(latest) {
+		latest = *user.LastLoginAt
+	}
+
+	var event models.LoginEvent
+	if err := s.db.Select("created_at").Where("user_id = ? AND success = ?", user.ID, true).
+		Order("created_at DESC").Limit(1).Find(&event).Error; err != nil {
+		return latest, fmt.Errorf("failed to find last sign-in: %w", err)
+	}
+	if event.CreatedAt.After(latest) {
+		latest = event.CreatedAt
+	}
+
+	var session models.Session
+	if err := s.db.Select("updated_at").Where("user_id = ?", user.ID).
+		Order("updated_at DESC").Limit(1).Find(&session).Error; err != nil {
+		return latest, fmt.Errorf("failed to find last session: %w", err)
+	}
+	if session.UpdatedAt.After(latest) {
+		latest = session.UpdatedAt
+	}
+	return latest, nil
+}
+
+func (s *StaleAccountService) warn(user *models.User, record *models.DormantAccount, signIn, deadline, now time.Time) error {
+	record = s.upsert(user, record, models.DormantStatusWarned, signIn)
+	record.WarnedAt = &now
+	if err := s.db.Save(record).Error; err != nil {
+		return fmt.Errorf("failed to record dormant account: %w", err)
+	}
+
+	disableOn := deadline.UTC().Format("January 2, 2006")
+	details := fmt.Sprintf("No sign-in since %s; the account is flagged as dormant on %s", signIn.UTC().Format(time.RFC3339), disableOn)
+	body := "You haven't signed in to CloudGate for a while. Sign in before " + disableOn + " to keep your account active."
+	if s.autoDisable {
+		details = fmt.Sprintf("No sign-in since %s; the account is disabled on %s", signIn.UTC().Format(time.RFC3339), disableOn)
+		body = "You haven't signed in to CloudGate for a while. Sign in before " + disableOn + " or your account will be disabled."
+	}
+	s.audit(&user.ID, "dormant_account_warned", user.ID, details)
+	s.notify(user.ID, "Your account is about to go dormant", body)
+	return nil
+}
+
+func (s *StaleAccountService) markDormant(user *models.User, record *models.DormantAccount, signIn time.Time) error {
+	record = s.upsert(user, record, models.DormantStatusDormant, signIn)
+	if err := s.db.Save(record).Error; err != nil {
+		return fmt.Errorf("failed to record dormant account: %w", err)
+	}
+	s.audit(nil, "dormant_account_flagged", user.ID, fmt.Sprintf("No sign-in since %s", signIn.UTC().Format(time.RFC3339)))
+	return nil
+}
+
+func (s *StaleAccountService) disable(user *models.User, record *models.DormantAccount, signIn, now time.Time) error {
+	days := int(s.threshold.Hours() / 24)
+	if err := s.security.LockAccount(user.ID, nil, fmt.Sprintf("%s no sign-in for %d days", dormantLockPrefix, days)); err != nil {
+		return err
+	}
+	record = s.upsert(user, record, models.DormantStatusDisabled, signIn)
+	record.DisabledAt = &now
+	if err := s.db.Save(record).Error; err != nil {
+		return fmt.Errorf("failed to record dormant account: %w", err)
+	}
+	s.audit(nil, "dormant_account_disabled", user.ID, fmt.Sprintf("Disabled after no sign-in since %s", signIn.UTC().Format(time.RFC3339)))
+	s.notify(user.ID, "Your account was disabled",
+		fmt.Sprintf("Your CloudGate account was disabled after %d days without sign-in. You can ask for it back from the sign-in page.", days))
+	return nil
+}
+
+// upsert starts a new dormant record or moves an existing one to the given status
+func (s *StaleAccountService) upsert(user *models.User, record *models.DormantAccount, status string, signIn time.Time) *models.DormantAccount {
+	if record == nil {
+		record = &models.DormantAccount{UserID: user.ID}
+	}
+	record.Email = user.Email
+	record.Status = status
+	record.LastActivityAt = signIn
+	return record
+}
+
+func (s *StaleAccountService) clear(record *models.DormantAccount) {
+	if err := s.db.Delete(record).Error; err != nil {
+		log.Printf("⚠️ Failed to clear dormant account %s: %v", record.UserID, err)
+		return
+	}
+	s.audit(nil, "dormant_account_cleared", record.UserID, "Owner signed in again")
+}
+
+func (s *StaleAccountService) reactivated(record *models.DormantAccount, actor *uuid.UUID, now time.Time) {
+	record.Status = models.DormantStatusReactivated
+	record.ReactivatedAt = &now
+	record.ReactivatedBy = actor
+	if err := s.db.Save(record).Error; err != nil {
+		log.Printf("⚠️ Failed to record reactivation of %s: %v", record.UserID, err)
+	}
+}
+
+// alert tells admins which accounts a scan warned, flagged or disabled
+func (s *StaleAccountService) alert(scan StaleAccountScan, emails []string) {
+	if s.security == nil {
+		return
+	}
+	severity := SeverityLow
+	if scan.Dormant > 0 || scan.Disabled > 0 {
+		severity = SeverityMedium
+	}
+	_, err := s.security.GenerateAlert(
+		AlertTypeDormantAccounts,
+		severity,
+		"Dormant accounts found",
+		fmt.Sprintf("%d account(s) warned, %d dormant and still enabled, %d disabled after %d days without sign-in",
+			scan.Warned, scan.Dormant, scan.Disabled, int(s.threshold.Hours()/24)),
+		map[string]interface{}{
+			"warned":       scan.Warned,
+			"dormant":      scan.Dormant,
+			"disabled":     scan.Disabled,
+			"accounts":     emails,
+			"auto_disable": s.autoDisable,
+		},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to raise dormant account alert: %v", err)
+	}
+}
+
+// RequestReactivation records that the owner of a disabled account wants it back and
+// tells admins. Unknown or active accounts are ignored without error, so the request
+// can't be used to find out which accounts exist.
+func (s *StaleAccountService) RequestReactivation(email, reason, ipAddress string, now time.Time) error {
+	var user models.User
+	err := s.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	var record models.DormantAccount
+	err = s.db.Where("user_id = ? AND status IN ?", user.ID,
+		[]string{models.DormantStatusDisabled, models.DormantStatusReactivationRequested}).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find dormant account: %w", err)
+	}
+
+	first := record.Status == models.DormantStatusDisabled
+	record.Status = models.DormantStatusReactivationRequested
+	record.ReactivationRequestedAt = &now
+	record.ReactivationReason = reason
+	if err := s.db.Save(&record).Error; err != nil {
+		return fmt.Errorf("failed to record reactivation request: %w", err)
+	}
+	auditLog := models.AuditLog{
+		UserID:     &user.ID,
+		Action:     "dormant_account_reactivation_requested",
+		Resource:   "user",
+		ResourceID: user.ID.String(),
+		IPAddress:  ipAddress,
+		Details:    reason,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit reactivation request: %v", err)
+	}
+
+	if first && s.security != nil {
+		_, err := s.security.GenerateAlert(
+			AlertTypeDormantAccounts,
+			SeverityLow,
+			"Dormant account reactivation requested",
+			fmt.Sprintf("%s asked for their disabled account back", user.Email),
+			map[string]interface{}{
+				"user_id":    user.ID.String(),
+				"email":      user.Email,
+				"reason":     reason,
+				"ip_address": ipAddress,
+			},
+		)
+		if err != nil {
+			log.Printf("⚠️ Failed to raise reactivation request alert: %v", err)
+		}
+	}
+	return nil
+}
+
+// Reactivate unlocks a disabled dormant account. The owner is warned at the next scan and
+// has STALE_ACCOUNT_WARNING_DAYS to sign in before it goes dormant again.
+func (s *StaleAccountService) Reactivate(userID uuid.UUID, actor *uuid.UUID) error {
+	var record models.DormantAccount
+	err := s.db.Where("user_id = ? AND status IN ?", userID,
+		[]string{models.DormantStatusDisabled, models.DormantStatusReactivationRequested}).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrDormantAccountNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find dormant account: %w", err)
+	}
+	var user models.User
+	if err := s.db.Where("id = ?", userID).Take(&user).Error; err != nil {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+	// A lock raised since, say for a compromise, must be lifted deliberately
+	if user.IsLocked(time.Now()) && !IsDormantLock(&user) {
+		return ErrNotDormantLock
+	}
+
+	if err := s.security.UnlockAccount(userID, actor); err != nil {
+		return err
+	}
+	s.reactivated(&record, actor, time.Now())
+	s.audit(actor, "dormant_account_reactivated", userID, "Dormant account reactivated")
+	s.notify(userID, "Your account was reactivated",
+		fmt.Sprintf("Your CloudGate account is active again. Sign in within %d days to keep it that way.", int(s.warning.Hours()/24)))
+	return nil
+}
+
+// List returns dormant accounts, optionally only those with the given status, longest idle first
+func (s *StaleAccountService) List(status string) ([]models.DormantAccount, error) {
+	query := s.db.Order("last_activity_at ASC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var records []models.DormantAccount
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to list dormant accounts: %w", err)
+	}
+	return records, nil
+}
+
+// Summary counts dormant accounts by status
+func (s *StaleAccountService) Summary() (DormantAccountSummary, error) {
+	summary := DormantAccountSummary{
+		ThresholdDays: int(s.threshold.Hours() / 24),
+		AutoDisable:   s.autoDisable,
+	}
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	if err := s.db.Model(&models.DormantAccount{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		return summary, fmt.Errorf("failed to count dormant accounts: %w", err)
+	}
+	for _, count := range counts {
+		switch count.Status {
+		case models.DormantStatusWarned:
+			summary.Warned = count.Count
+		case models.DormantStatusDormant:
+			summary.Dormant = count.Count
+		case models.DormantStatusDisabled:
+			summary.Disabled = count.Count
+		case models.DormantStatusReactivationRequested:
+			summary.ReactivationRequested = count.Count
+		case models.DormantStatusReactivated:
+			summary.Reactivated = count.Count
+		}
+	}
+	return summary, nil
+}
+
+func (s *StaleAccountService) notify(userID uuid.UUID, title, body string) {
+	if s.push == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := s.push.NotifyUser(ctx, userID, title, body, s.link); err != nil {
+			log.Printf("⚠️ Failed to notify user %s about their dormant account: %v", userID, err)
+		}
+	}()
+}
+
+func (s *StaleAccountService) audit(actor *uuid.UUID, action string, subject uuid.UUID, details string) {
+	userID := actor
+	if userID == nil {
+		userID = &subject
+	}
+	auditLog := models.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		Resource:   "user",
+		ResourceID: subject.String(),
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit dormant account event: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// stepUpChallengeSpacing is how close together step-up demands count as one prompt, since a
+// single page can hit several protected endpoints at once
+const stepUpChallengeSpacing = 15 * time.Second
+
+// StepUpBlock is a user whose step-up prompts are paused after too many arrived too fast
+type StepUpBlock struct {
+	UserID       uuid.UUID `json:"user_id"`
+	Challenges   int       `json:"challenges"` // prompts in the window that triggered the block
+	IPAddress    string    `json:"ip_address,omitempty"`
+	BlockedAt    time.Time `json:"blocked_at"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	AlertID      string    `json:"alert_id,omitempty"`
+}
+
+// StepUpFatigueService detects MFA prompt bombing: more than STEP_UP_FATIGUE_THRESHOLD
+// step-up challenges for one user within STEP_UP_FATIGUE_WINDOW. Instead of prompting again
+// it pauses the user's step-ups for STEP_UP_FATIGUE_BLOCK, tells the user on their
+// registered phones and raises a compromised account alert, since whoever triggers the
+// prompts most likely holds the user's password or session. Counts are kept in memory, so
+// each instance counts the prompts it issues.
+type StepUpFatigueService struct {
+	db        *gorm.DB
+	security  *SecurityMonitoringService
+	push      *PushService
+	threshold int
+	window    time.Duration
+	block     time.Duration
+	link      string
+
+	mu         sync.Mutex
+	challenges map[uuid.UUID][]time.Time
+	blocks     map[uuid.UUID]*StepUpBlock
+}
+
+// NewStepUpFatigueService creates a step-up fatigue detector configured from the
+// environment. push may be nil, leaving users to learn of the block when they next sign in.
+func NewStepUpFatigueService(db *gorm.DB, security *SecurityMonitoringService, push *PushService) *StepUpFatigueService {
+	return &StepUpFatigueService{
+		db:         db,
+		security:   security,
+		push:       push,
+		threshold:  envInt("STEP_UP_FATIGUE_THRESHOLD", 5),
+		window:     envDuration("STEP_UP_FATIGUE_WINDOW", 10*time.Minute),
+		block:      envDuration("STEP_UP_FATIGUE_BLOCK", 30*time.Minute),
+		link:       strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:3000"), "/") + "/dashboard/security",
+		challenges: make(map[uuid.UUID][]time.Time),
+		blocks:     make(map[uuid.UUID]*StepUpBlock),
+	}
+}
+
+// RecordChallenge counts a step-up challenge about to be issued to the user. It returns
+// true, and when the pause ends, if the challenge must not be issued.
+func (s *StepUpFatigueService) RecordChallenge(userID uuid.UUID, ipAddress, userAgent string, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	if block, ok := s.activeBlock(userID, now); ok {
+		s.mu.Unlock()
+		return block.BlockedUntil, true
+	}
+
+	recent := s.challenges[userID][:0]
+	for _, t := range s.challenges[userID] {
+		if now.Sub(t) < s.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) > 0 && now.Sub(recent[len(recent)-1]) < stepUpChallengeSpacing {
+		s.challenges[userID] = recent
+		s.mu.Unlock()
+		return time.Time{}, false
+	}
+	recent = append(recent, now)
+	if len(recent) <= s.threshold {
+		s.challenges[userID] = recent
+		s.mu.Unlock()
+		return time.Time{}, false
+	}
+
+	block := &StepUpBlock{
+		UserID:       userID,
+		Challenges:   len(recent),
+		IPAddress:    ipAddress,
+		BlockedAt:    now,
+		BlockedUntil: now.Add(s.block),
+	}
+	s.blocks[userID] = block
+	delete(s.challenges, userID)
+	s.mu.Unlock()
+
+	s.respond(block, userAgent)
+	return block.BlockedUntil, true
+}
+
+// Blocked reports whether the user's step-ups are paused, and until when
+func (s *StepUpFatigueService) Blocked(userID uuid.UUID, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	block, ok := s.activeBlock(userID, now)
+	if !ok {
+		return time.Time{}, false
+	}
+	return block.BlockedUntil, true
+}
+
+// ListBlocks returns the users whose step-ups are paused, most recent first
+func (s *StepUpFatigueService) ListBlocks(now time.Time) []StepUpBlock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blocks := make([]StepUpBlock, 0, len(s.blocks))
+	for userID := range s.blocks {
+		if block, ok := s.activeBlock(userID, now); ok {
+			blocks = append(blocks, *block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].BlockedAt.After(blocks[j].BlockedAt) })
+	return blocks
+}
+
+// Unblock lets the user step up again, once an admin has confirmed who was prompting.
+// It returns false if the user was not blocked.
+func (s *StepUpFatigueService) Unblock(userID uuid.UUID, actor *uuid.UUID) bool {
+	s.mu.Lock()
+	_, ok := s.activeBlock(userID, time.Now())
+	delete(s.blocks, userID)
+	delete(s.challenges, userID)
+	s.mu.Unlock()
+	if ok {
+		s.audit(actor, "step_up_unblocked", userID, "", "Step-up prompts resumed by an administrator", "success")
+	}
+	return ok
+}
+
+// activeBlock returns the user's block if it has not yet ended; s.mu must be held
+func (s *StepUpFatigueService) activeBlock(userID uuid.UUID, now time.Time) (*StepUpBlock, bool) {
+	block, ok := s.blocks[userID]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(block.BlockedUntil) {
+		delete(s.blocks, userID)
+		return nil, false
+	}
+	return block, true
+}
+
+// respond raises the alert and tells the user their prompts are paused
+func (s *StepUpFatigueService) respond(block *StepUpBlock, userAgent string) {
+	log.Printf("🚨 MFA prompt bombing suspected for user %s: %d step-up challenges within %s", block.UserID, block.Challenges, s.window)
+	details := fmt.Sprintf("%d step-up challenges within %s; further prompts paused until %s",
+		block.Challenges, s.window, block.BlockedUntil.UTC().Format(time.RFC3339))
+	s.audit(&block.UserID, "step_up_prompts_blocked", block.UserID, block.IPAddress, details, "failure")
+
+	if s.security != nil {
+		alert, err := s.security.GenerateAlert(
+			AlertTypeCompromisedAccount,
+			SeverityHigh,
+			"MFA prompt bombing suspected",
+			fmt.Sprintf("User received %d step-up challenges within %s; their credentials or session are likely in someone else's hands", block.Challenges, s.window),
+			map[string]interface{}{
+				"user_id":       block.UserID.String(),
+				"ip_address":    block.IPAddress,
+				"user_agent":    userAgent,
+				"challenges":    block.Challenges,
+				"window":        s.window.String(),
+				"blocked_until": block.BlockedUntil,
+			},
+		)
+		if err != nil {
+			log.Printf("⚠️ Failed to raise MFA prompt bombing alert: %v", err)
+		} else {
+			s.mu.Lock()
+			block.AlertID = alert.ID.String()
+			s.mu.Unlock()
+		}
+	}
+
+	if s.push != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_, err := s.push.NotifyUser(ctx, block.UserID,
+				"Unexpected sign-in prompts paused",
+				"Someone triggered many verification prompts on your account. We've paused them; don't approve any you didn't start, and change your password.",
+				s.link)
+			if err != nil {
+				log.Printf("⚠️ Failed to notify user %s of paused step-ups: %v", block.UserID, err)
+			}
+		}()
+	}
+}
+
+func (s *StepUpFatigueService) audit(userID *uuid.UUID, action string, subject uuid.UUID, ipAddress, details, status string) {
+	auditLog := models.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		Resource:   "user",
+		ResourceID: subject.String(),
+		IPAddress:  ipAddress,
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit step-up fatigue event: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThreatTagTor marks threat intel about Tor exit nodes
+const ThreatTagTor = "tor"
+
+// threatFeed is a threat intel provider answering from a downloaded list, which has to be
+// refreshed on every instance
+type threatFeed interface {
+	ThreatIntelProvider
+	Refresh(ctx context.Context) error
+}
+
+// NewThreatIntelProvidersFromEnv returns the threat intel providers configured in the
+// environment: the Tor exit node list when THREAT_INTEL_TOR_ENABLED is true, the Spamhaus
+// DROP lists when THREAT_INTEL_SPAMHAUS_ENABLED is true, and AbuseIPDB when
+// ABUSEIPDB_API_KEY is set. The downloaded lists are answered first.
+func NewThreatIntelProvidersFromEnv() []ThreatIntelProvider {
+	var providers []ThreatIntelProvider
+	if getEnv("THREAT_INTEL_TOR_ENABLED", "false") == "true" {
+		providers = append(providers, NewTorExitNodeFeed(getEnv("TOR_EXIT_LIST_URL", "https://check.torproject.org/torbulkexitlist")))
+	}
+	if getEnv("THREAT_INTEL_SPAMHAUS_ENABLED", "false") == "true" {
+		urls := strings.Split(getEnv("SPAMHAUS_DROP_URLS", "https://www.spamhaus.org/drop/drop_v4.json,https://www.spamhaus.org/drop/drop_v6.json"), ",")
+		providers = append(providers, NewSpamhausDROPFeed(urls...))
+	}
+	if apiKey := getEnv("ABUSEIPDB_API_KEY", ""); apiKey != "" {
+		providers = append(providers, NewAbuseIPDBProvider(
+			getEnv("ABUSEIPDB_URL", "https://api.abuseipdb.com"), apiKey,
+			envInt("ABUSEIPDB_MAX_AGE_DAYS", 90), envInt("ABUSEIPDB_MIN_SCORE", 25),
+		))
+	}
+	return providers
+}
+
+// IPFeed flags IP addresses found on downloaded lists of addresses and networks, one
+// entry per line. Plain lists, "network ; comment" lists and JSON lines with a cidr or ip
+// field are understood. Until the first refresh succeeds nothing is listed, and a failed
+// refresh keeps the last list.
+type IPFeed struct {
+	name    string
+	urls    []string
+	verdict ThreatIntelData
+	client  *http.Client
+
+	mu        sync.RWMutex
+	addresses map[netip.Addr]bool
+	networks  []netip.Prefix
+	updatedAt time.Time
+}
+
+// NewIPFeed creates a feed that answers with verdict for addresses on the lists at urls
+func NewIPFeed(name string, verdict ThreatIntelData, urls ...string) *IPFeed {
+	for i := range urls {
+		urls[i] = strings.TrimSpace(urls[i])
+	}
+	verdict.Source = name
+	return &IPFeed{
+		name:    name,
+		urls:    urls,
+		verdict: verdict,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// NewTorExitNodeFeed creates a feed of the Tor Project's exit node list. Tor is not
+// malicious in itself, so exit nodes raise risk without counting as high risk.
+func NewTorExitNodeFeed(listURL string) *IPFeed {
+	return NewIPFeed("tor_exit_nodes", ThreatIntelData{
+		Type:        "ip",
+		Confidence:  0.5,
+		Severity:    string(SeverityMedium),
+		Description: "Tor exit node",
+		Tags:        []string{ThreatTagTor, "anonymizer"},
+	}, listURL)
+}
+
+// NewSpamhausDROPFeed creates a feed of the Spamhaus DROP lists of hijacked networks and
+// networks run by criminals, which no legitimate sign-in comes from
+func NewSpamhausDROPFeed(urls ...string) *IPFeed {
+	return NewIPFeed("spamhaus_drop", ThreatIntelData{
+		Type:        "ip",
+		Confidence:  1.0,
+		Severity:    string(SeverityCritical),
+		Description: "Listed on Spamhaus DROP as a hijacked or criminal network",
+		Tags:        []string{"spamhaus-drop", "hijacked-network"},
+	}, urls...)
+}
+
+// GetProviderName returns the feed's name
+func (f *IPFeed) GetProviderName() string {
+	return f.name
+}
+
+// GetThreatData returns the feed's verdict when the address is listed, or nil
+func (f *IPFeed) GetThreatData(ctx context.Context, indicator string) (*ThreatIntelData, error) {
+	addr, err := netip.ParseAddr(indicator)
+	if err != nil {
+		return nil, nil
+	}
+	addr = addr.Unmap()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	listed := f.addresses[addr]
+	for _, network := range f.networks {
+		if listed {
+			break
+		}
+		listed = network.Contains(addr)
+	}
+	if !listed {
+		return nil, nil
+	}
+	data := f.verdict
+	data.Indicator = indicator
+	data.LastSeen = f.updatedAt
+	data.Tags = append([]string(nil), f.verdict.Tags...)
+	return &data, nil
+}
+
+// Refresh downloads the lists and replaces the feed's entries when all of them load
+func (f *IPFeed) Refresh(ctx context.Context) error {
+	addresses := make(map[netip.Addr]bool)
+	var networks []netip.Prefix
+	for _, listURL := range f.urls {
+		if err := f.download(ctx, listURL, addresses, &networks); err != nil {
+			return fmt.Errorf("failed to refresh %s from %s: %w", f.name, listURL, err)
+		}
+	}
+
+	f.mu.Lock()
+	f.addresses, f.networks, f.updatedAt = addresses, networks, time.Now()
+	f.mu.Unlock()
+	log.Printf("🛡️ Threat feed %s refreshed: %d addresses, %d networks", f.name, len(addresses), len(networks))
+	return nil
+}
+
+func (f *IPFeed) download(ctx context.Context, listURL string, addresses map[netip.Addr]bool, networks *[]netip.Prefix) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("list returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return parseIPFeed(resp.Body, addresses, networks)
+}
+
+// parseIPFeed reads one address or network per line, skipping comments and entries it
+// cannot parse
+func parseIPFeed(r io.Reader, addresses map[netip.Addr]bool, networks *[]netip.Prefix) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		var entry string
+		if line[0] == '{' {
+			var record struct {
+				CIDR string `json:"cidr"`
+				IP   string `json:"ip"`
+			}
+			if json.Unmarshal([]byte(line), &record) != nil {
+				continue
+			}
+			entry = record.CIDR + record.IP // metadata lines have neither
+		} else {
+			listed, _, _ := strings.Cut(line, ";")
+			if fields := strings.Fields(listed); len(fields) > 0 {
+				entry = fields[0]
+			}
+		}
+
+		if strings.Contains(entry, "/") {
+			if network, err := netip.ParsePrefix(entry); err == nil {
+				*networks = append(*networks, network.Masked())
+			}
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			addresses[addr.Unmap()] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// AbuseIPDBProvider looks IP addresses up in AbuseIPDB's crowd-sourced abuse reports
+type AbuseIPDBProvider struct {
+	BaseURL    string
+	apiKey     string
+	maxAgeDays int
+	minScore   int
+	client     *http.Client
+}
+
+// NewAbuseIPDBProvider creates an AbuseIPDB client considering reports from the last
+// maxAgeDays days; addresses with an abuse confidence score below minScore are not
+// reported unless they are Tor exit nodes
+func NewAbuseIPDBProvider(baseURL, apiKey string, maxAgeDays, minScore int) *AbuseIPDBProvider {
+	return &AbuseIPDBProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		maxAgeDays: maxAgeDays,
+		minScore:   minScore,
+		client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// GetProviderName returns "abuseipdb"
+func (p *AbuseIPDBProvider) GetProviderName() string {
+	return "abuseipdb"
+}
+
+// GetThreatData checks the address against AbuseIPDB
+func (p *AbuseIPDBProvider) GetThreatData(ctx context.Context, indicator string) (*ThreatIntelData, error) {
+	if _, err := netip.ParseAddr(indicator); err != nil {
+		return nil, nil
+	}
+	query := url.Values{"ipAddress": {indicator}, "maxAgeInDays": {strconv.Itoa(p.maxAgeDays)}}
+	ctx, cancel := withProvider(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/api/v2/check?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Key", p.apiKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach AbuseIPDB: %w", err)
+	}
+	var result struct {
+		Data struct {
+			AbuseConfidenceScore int        `json:"abuseConfidenceScore"`
+			UsageType            string     `json:"usageType"`
+			IsTor                bool       `json:"isTor"`
+			TotalReports         int        `json:"totalReports"`
+			NumDistinctUsers     int        `json:"numDistinctUsers"`
+			LastReportedAt       *time.Time `json:"lastReportedAt"`
+		} `json:"data"`
+	}
+	if err := decodeProviderResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	report := result.Data
+	if report.AbuseConfidenceScore < p.minScore && !report.IsTor {
+		return nil, nil
+	}
+
+	data := &ThreatIntelData{
+		Indicator:   indicator,
+		Type:        "ip",
+		Confidence:  float64(report.AbuseConfidenceScore) / 100,
+		Severity:    string(abuseScoreSeverity(report.AbuseConfidenceScore)),
+		Description: fmt.Sprintf("Reported %d times by %d users to AbuseIPDB", report.TotalReports, report.NumDistinctUsers),
+		Source:      p.GetProviderName(),
+		Tags:        []string{"abuseipdb"},
+	}
+	if report.LastReportedAt != nil {
+		data.LastSeen = *report.LastReportedAt
+	}
+	if report.IsTor {
+		data.Tags = append(data.Tags, ThreatTagTor)
+	}
+	if report.UsageType != "" {
+		data.Tags = append(data.Tags, report.UsageType)
+	}
+	return data, nil
+}
+
+// abuseScoreSeverity maps an AbuseIPDB confidence score to an alert severity
+func abuseScoreSeverity(score int) AlertSeverity {
+	switch {
+	case score >= 90:
+		return SeverityCritical
+	case score >= 70:
+		return SeverityHigh
+	case score >= 40:
+		return SeverityMedium
+	default:
+		return SeverityLow
+	}
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Timeline sources
+const (
+	TimelineSourceAudit         = "audit"
+	TimelineSourceRisk          = "risk"
+	TimelineSourceSecurityEvent = "security_event"
+	TimelineSourceDevice        = "device"
+	TimelineSourceConnection    = "connection"
+	TimelineSourceLogin         = "login"
+	TimelineSourceAlert         = "alert"
+)
+
+// ErrUnknownTimelineSource is returned when a query names a source that does not exist
+var ErrUnknownTimelineSource = errors.New("unknown timeline source")
+
+// TimelineEntry is one item in a user's activity timeline
+type TimelineEntry struct {
+	Timestamp   time.Time              `json:"timestamp"`
+	Source      string                 `json:"source"`
+	Type        string                 `json:"type"`
+	Summary     string                 `json:"summary"`
+	Severity    string                 `json:"severity,omitempty"`
+	IPAddress   string                 `json:"ip_address,omitempty"`
+	ReferenceID string                 `json:"reference_id"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+}
+
+// TimelineQuery filters and pages a timeline request
+type TimelineQuery struct {
+	Since   *time.Time
+	Until   *time.Time
+	Sources []string // empty means all sources
+	Limit   int
+	Offset  int
+}
+
+// TimelineService merges a user's activity from several tables into one feed for investigations
+type TimelineService struct {
+	db *gorm.DB
+}
+
+// NewTimelineService creates a new timeline service
+func NewTimelineService(db *gorm.DB) *TimelineService {
+	return &TimelineService{db: db}
+}
+
+// timelineLoader fetches the newest n entries of one source and that source's total count
+type timelineLoader func(n int) ([]TimelineEntry, int64, error)
+
+// GetUserTimeline returns the user's activity newest first along with the total number of entries.
+// Each source is read up to offset+limit rows, so merged pages stay correct without loading everything.
+func (s *TimelineService) GetUserTimeline(userID uuid.UUID, query TimelineQuery) ([]TimelineEntry, int64, error) {
+	loaders := map[string]timelineLoader{
+		TimelineSourceAudit:         func(n int) ([]TimelineEntry, int64, error) { return s.loadAuditLogs(userID, query, n) },
+		TimelineSourceRisk:          func(n int) ([]TimelineEntry, int64, error) { return s.loadRiskAssessments(userID, query, n) },
+		TimelineSourceSecurityEvent: func(n int) ([]TimelineEntry, int64, error) { return s.loadSecurityEvents(userID, query, n) },
+		TimelineSourceDevice:        func(n int) ([]TimelineEntry, int64, error) { return s.loadDevices(userID, query, n) },
+		TimelineSourceConnection:    func(n int) ([]TimelineEntry, int64, error) { return s.loadConnections(userID, query, n) },
+		TimelineSourceLogin:         func(n int) ([]TimelineEntry, int64, error) { return s.loadLogins(userID, query, n) },
+		TimelineSourceAlert:         func(n int) ([]TimelineEntry, int64, error) { return s.loadAlerts(userID, query, n) },
+	}
+
+	sources := query.Sources
+	if len(sources) == 0 {
+		sources = []string{TimelineSourceAudit, TimelineSourceRisk, TimelineSourceSecurityEvent, TimelineSourceDevice, TimelineSourceConnection, TimelineSourceLogin, TimelineSourceAlert}
+	}
+
+	window := query.Offset + query.Limit
+	var merged []TimelineEntry
+	var total int64
+	for _, source := range sources {
+		loader, ok := loaders[source]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %s", ErrUnknownTimelineSource, source)
+		}
+		entries, count, err := loader(window)
+		if err != nil {
+			return nil, 0, err
+		}
+		merged = append(merged, entries...)
+		total += count
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.After(merged[j].Timestamp)
+	})
+
+	if query.Offset >= len(merged) {
+		return []TimelineEntry{}, total, nil
+	}
+	end := query.Offset + query.Limit
+	if end > len(merged) {
+		end = len(merged)
+	}
+	return merged[query.Offset:end], total, nil
+}
+
+// scopeTimeRange applies the query's time bounds to a column. The result is a
+// new session so it can be reused for both the count and the page query.
+func scopeTimeRange(db *gorm.DB, column string, query TimelineQuery) *gorm.DB {
+	if query.Since != nil {
+		db = db.Where(column+" >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		db = db.Where(column+" <= ?", *query.Until)
+	}
+	return db.Session(&gorm.Session{})
+}
+
+func (s *TimelineService) loadAuditLogs(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	base := scopeTimeRange(s.db.Model(&models.AuditLog{}).Where("user_id = ?", userID), "created_at", query)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+	var logs []models.AuditLog
+	if err := base.Order("created_at DESC").Limit(n).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get audit logs: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   l.CreatedAt,
+			Source:      TimelineSourceAudit,
+			Type:        l.Action,
+			Summary:     l.Details,
+			IPAddress:   l.IPAddress,
+			ReferenceID: l.ID.String(),
+			Details: map[string]interface{}{
+				"resource":    l.Resource,
+				"resource_id": l.ResourceID,
+				"status":      l.Status,
+			},
+		})
+	}
+	return entries, total, nil
+}
+
+func (s *TimelineService) loadRiskAssessments(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	base := scopeTimeRange(s.db.Model(&RiskAssessment{}).Where("user_id = ?", userID), "created_at", query)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count risk assessments: %w", err)
+	}
+	var assessments []RiskAssessment
+	if err := base.Order("created_at DESC").Limit(n).Find(&assessments).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get risk assessments: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(assessments))
+	for _, a := range assessments {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   a.CreatedAt,
+			Source:      TimelineSourceRisk,
+			Type:        "risk_assessment",
+			Summary:     fmt.Sprintf("Risk assessed as %s (%.2f)", a.RiskLevel, a.RiskScore),
+			Severity:    string(a.RiskLevel),
+			IPAddress:   a.IPAddress,
+			ReferenceID: a.ID.String(),
+			Details: map[string]interface{}{
+				"risk_score": a.RiskScore,
+				"session_id": a.SessionID,
+			},
+		})
+	}
+	return entries, total, nil
+}
+
+func (s *TimelineService) loadSecurityEvents(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	base := scopeTimeRange(s.db.Model(&models.SecurityEvent{}).Where("user_id = ?", userID), "created_at", query)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count security events: %w", err)
+	}
+	var events []models.SecurityEvent
+	if err := base.Order("created_at DESC").Limit(n).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get security events: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(events))
+	for _, e := range events {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   e.CreatedAt,
+			Source:      TimelineSourceSecurityEvent,
+			Type:        e.EventType,
+			Summary:     e.Description,
+			Severity:    string(e.Severity),
+			IPAddress:   e.IPAddress,
+			ReferenceID: e.ID.String(),
+			Details: map[string]interface{}{
+				"risk_score": e.RiskScore,
+				"resolved":   e.Resolved,
+				"location":   e.Location,
+			},
+		})
+	}
+	return entries, total, nil
+}
+
+// loadDevices covers both trusted-device registrations and adaptive-auth device fingerprints
+func (s *TimelineService) loadDevices(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	trustedBase := scopeTimeRange(s.db.Model(&models.TrustedDevice{}).Where("user_id = ?", userID), "created_at", query)
+	fingerprintBase := scopeTimeRange(s.db.Model(&DeviceFingerprint{}).Where("user_id = ?", userID), "created_at", query)
+
+	var trustedCount, fingerprintCount int64
+	if err := trustedBase.Count(&trustedCount).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count devices: %w", err)
+	}
+	if err := fingerprintBase.Count(&fingerprintCount).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count device fingerprints: %w", err)
+	}
+
+	var devices []models.TrustedDevice
+	if err := trustedBase.Order("created_at DESC").Limit(n).Find(&devices).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get devices: %w", err)
+	}
+	var fingerprints []DeviceFingerprint
+	if err := fingerprintBase.Order("created_at DESC").Limit(n).Find(&fingerprints).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get device fingerprints: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(devices)+len(fingerprints))
+	for _, d := range devices {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   d.CreatedAt,
+			Source:      TimelineSourceDevice,
+			Type:        "device_registered",
+			Summary:     fmt.Sprintf("Registered %s (%s on %s)", d.DeviceName, d.Browser, d.OS),
+			IPAddress:   d.IPAddress,
+			ReferenceID: d.ID.String(),
+			Details: map[string]interface{}{
+				"device_type": d.DeviceType,
+				"trusted":     d.Trusted,
+				"location":    d.Location,
+			},
+		})
+	}
+	for _, f := range fingerprints {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   f.CreatedAt,
+			Source:      TimelineSourceDevice,
+			Type:        "device_fingerprint",
+			Summary:     fmt.Sprintf("New device fingerprint %s (%s on %s)", f.DeviceName, f.Browser, f.OS),
+			ReferenceID: f.ID.String(),
+			Details: map[string]interface{}{
+				"device_type": f.DeviceType,
+				"trusted":     f.IsTrusted,
+			},
+		})
+	}
+	return entries, trustedCount + fingerprintCount, nil
+}
+
+func (s *TimelineService) loadConnections(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	base := scopeTimeRange(s.db.Model(&models.AppConnection{}).Where("user_id = ?", userID), "updated_at", query)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count connections: %w", err)
+	}
+	var connections []models.AppConnection
+	if err := base.Order("updated_at DESC").Limit(n).Find(&connections).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get connections: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(connections))
+	for _, conn := range connections {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   conn.UpdatedAt,
+			Source:      TimelineSourceConnection,
+			Type:        "connection_" + string(conn.Status),
+			Summary:     fmt.Sprintf("%s connection is %s", conn.AppID, conn.Status),
+			ReferenceID: conn.ID.String(),
+			Details: map[string]interface{}{
+				"app_id":        conn.AppID,
+				"provider":      conn.Provider,
+				"connected_at":  conn.ConnectedAt,
+				"health_status": conn.HealthStatus,
+			},
+		})
+	}
+	return entries, total, nil
+}
+
+func (s *TimelineService) loadLogins(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	base := scopeTimeRange(s.db.Model(&models.LoginEvent{}).Where("user_id = ?", userID), "created_at", query)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count logins: %w", err)
+	}
+	var events []models.LoginEvent
+	if err := base.Order("created_at DESC").Limit(n).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get logins: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(events))
+	for _, e := range events {
+		entry := TimelineEntry{
+			Timestamp:   e.CreatedAt,
+			Source:      TimelineSourceLogin,
+			Type:        "login_succeeded",
+			Summary:     fmt.Sprintf("Signed in with %s", e.Method),
+			IPAddress:   e.IPAddress,
+			ReferenceID: e.ID.String(),
+			Details: map[string]interface{}{
+				"method":    e.Method,
+				"country":   e.Country,
+				"city":      e.City,
+				"latitude":  e.Latitude,
+				"longitude": e.Longitude,
+			},
+		}
+		if !e.Success {
+			entry.Type = "login_failed"
+			entry.Summary = fmt.Sprintf("Failed %s sign-in (%s)", e.Method, e.FailureReason)
+			entry.Severity = "low"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
+
+func (s *TimelineService) loadAlerts(userID uuid.UUID, query TimelineQuery, n int) ([]TimelineEntry, int64, error) {
+	base := scopeTimeRange(s.db.Model(&models.SecurityAlertRecord{}).Where("user_id = ?", userID), "created_at", query)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count security alerts: %w", err)
+	}
+	var alerts []models.SecurityAlertRecord
+	if err := base.Order("created_at DESC").Limit(n).Find(&alerts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get security alerts: %w", err)
+	}
+
+	entries := make([]TimelineEntry, 0, len(alerts))
+	for _, a := range alerts {
+		entries = append(entries, TimelineEntry{
+			Timestamp:   a.CreatedAt,
+			Source:      TimelineSourceAlert,
+			Type:        a.Type,
+			Summary:     a.Title,
+			Severity:    string(a.Severity),
+			IPAddress:   a.IPAddress,
+			ReferenceID: a.ID.String(),
+			Details: map[string]interface{}{
+				"status":         a.Status,
+				"priority_score": a.PriorityScore,
+				"assigned_to":    a.AssignedTo,
+				"resolved_at":    a.ResolvedAt,
+			},
+		})
+	}
+	return entries, total, nil
+}
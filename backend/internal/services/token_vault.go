@@ -0,0 +1,264 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloudgate-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// tokenVaultPrefix marks a value sealed by the token vault; anything else is a token
+// stored before encryption at rest, read as is until rotation encrypts it
+const tokenVaultPrefix = "vault:v1:"
+
+// ErrUnknownTokenKey is returned when a token was sealed under a key the keyring lacks
+var ErrUnknownTokenKey = errors.New("token sealed under unknown key")
+
+var tokenVault *TokenVault
+
+// TokenKeyring wraps and unwraps the data keys tokens are sealed under. Keys are named so
+// tokens sealed under retired keys can still be read while they are rotated.
+type TokenKeyring interface {
+	ActiveKeyID() string
+	Wrap(keyID string, dataKey []byte) (string, error)
+	Unwrap(keyID, wrapped string) ([]byte, error)
+}
+
+// EnvTokenKeyring holds key-encryption keys from TOKEN_VAULT_KEYS, a comma-separated
+// list of id=base64 AES-256 keys whose first entry is the active key
+type EnvTokenKeyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewEnvTokenKeyring reads TOKEN_VAULT_KEYS. Left unset, a single key named "default" is
+// derived from TOKEN_VAULT_SECRET, falling back to JWT_SECRET.
+func NewEnvTokenKeyring() (*EnvTokenKeyring, error) {
+	keyring := &EnvTokenKeyring{keys: make(map[string][]byte)}
+	configured := strings.TrimSpace(getEnv("TOKEN_VAULT_KEYS", ""))
+	if configured == "" {
+		keyring.active = "default"
+		keyring.keys["default"] = credentialKey("token-vault", "TOKEN_VAULT_SECRET")
+		return keyring, nil
+	}
+	for _, entry := range strings.Split(configured, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid TOKEN_VAULT_KEYS entry %q: want id=base64key", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid TOKEN_VAULT_KEYS key %q: want 32 base64-encoded bytes", id)
+		}
+		if keyring.active == "" {
+			keyring.active = id
+		}
+		keyring.keys[id] = key
+	}
+	return keyring, nil
+}
+
+// ActiveKeyID names the key new tokens are sealed under
+func (k *EnvTokenKeyring) ActiveKeyID() string {
+	return k.active
+}
+
+// Wrap seals a data key under the named key
+func (k *EnvTokenKeyring) Wrap(keyID string, dataKey []byte) (string, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTokenKey, keyID)
+	}
+	return sealSecret(key, dataKey)
+}
+
+// Unwrap opens a data key sealed under the named key
+func (k *EnvTokenKeyring) Unwrap(keyID, wrapped string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTokenKey, keyID)
+	}
+	return openSecret(key, wrapped)
+}
+
+// TokenVault encrypts OAuth tokens at rest with envelope encryption: each token is sealed
+// with AES-GCM under its own data key, which is wrapped by the keyring's active key.
+// Rotating the key only rewraps data keys; the tokens themselves are not re-encrypted.
+type TokenVault struct {
+	keyring TokenKeyring
+}
+
+// NewTokenVault creates a vault over a keyring
+func NewTokenVault(keyring TokenKeyring) *TokenVault {
+	return &TokenVault{keyring: keyring}
+}
+
+// NewTokenVaultFromEnv creates a vault over the keys in TOKEN_VAULT_KEYS
+func NewTokenVaultFromEnv() (*TokenVault, error) {
+	keyring, err := NewEnvTokenKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenVault(keyring), nil
+}
+
+// SetTokenVault makes app connections seal and open tokens with the vault
+func SetTokenVault(vault *TokenVault) {
+	tokenVault = vault
+}
+
+// activeTokenVault returns the configured vault, or one from the environment
+func activeTokenVault() (*TokenVault, error) {
+	if tokenVault == nil {
+		vault, err := NewTokenVaultFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		tokenVault = vault
+	}
+	return tokenVault, nil
+}
+
+// Encrypt seals a token under a fresh data key. Empty tokens stay empty.
+func (v *TokenVault) Encrypt(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	sealed, err := sealSecret(dataKey, []byte(token))
+	if err != nil {
+		return "", fmt.Errorf("failed to seal token: %w", err)
+	}
+	keyID := v.keyring.ActiveKeyID()
+	wrapped, err := v.keyring.Wrap(keyID, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return tokenVaultPrefix + keyID + ":" + wrapped + ":" + sealed, nil
+}
+
+// Decrypt opens a sealed token. Tokens stored before encryption are returned as is.
+func (v *TokenVault) Decrypt(stored string) (string, error) {
+	keyID, wrapped, sealed, ok := splitSealedToken(stored)
+	if !ok {
+		if strings.HasPrefix(stored, tokenVaultPrefix) {
+			return "", errors.New("malformed sealed token")
+		}
+		return stored, nil
+	}
+	dataKey, err := v.keyring.Unwrap(keyID, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	token, err := openSecret(dataKey, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to open token: %w", err)
+	}
+	return string(token), nil
+}
+
+// rewrap moves a stored token under the active key, encrypting one stored before
+// encryption. It reports whether the value changed.
+func (v *TokenVault) rewrap(stored string) (string, bool, error) {
+	if stored == "" {
+		return "", false, nil
+	}
+	keyID, wrapped, sealed, ok := splitSealedToken(stored)
+	if !ok {
+		if strings.HasPrefix(stored, tokenVaultPrefix) {
+			return "", false, errors.New("malformed sealed token")
+		}
+		encrypted, err := v.Encrypt(stored)
+		return encrypted, err == nil, err
+	}
+	active := v.keyring.ActiveKeyID()
+	if keyID == active {
+		return stored, false, nil
+	}
+	dataKey, err := v.keyring.Unwrap(keyID, wrapped)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	rewrapped, err := v.keyring.Wrap(active, dataKey)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return tokenVaultPrefix + active + ":" + rewrapped + ":" + sealed, true, nil
+}
+
+func splitSealedToken(stored string) (keyID, wrapped, sealed string, ok bool) {
+	rest, found := strings.CutPrefix(stored, tokenVaultPrefix)
+	if !found {
+		return "", "", "", false
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// TokenRotationResult counts the app connections a key rotation touched
+type TokenRotationResult struct {
+	ActiveKey string `json:"active_key"`
+	Scanned   int    `json:"scanned"`
+	Rotated   int    `json:"rotated"`
+	Failed    int    `json:"failed"`
+}
+
+// RotateKeys rewraps every app connection's tokens under the active key, encrypting
+// tokens stored before encryption at rest. Connections whose tokens cannot be opened
+// are counted and left alone, so a rotation can be run again once their key is restored.
+func (v *TokenVault) RotateKeys(db *gorm.DB) (*TokenRotationResult, error) {
+	result := &TokenRotationResult{ActiveKey: v.keyring.ActiveKeyID()}
+	var connections []models.AppConnection
+	err := db.Unscoped().Select("id", "access_token", "refresh_token").
+		Where("access_token <> '' OR refresh_token <> ''").
+		FindInBatches(&connections, 200, func(tx *gorm.DB, batch int) error {
+			for _, connection := range connections {
+				result.Scanned++
+				rotated, err := v.rotateConnection(db, connection)
+				if err != nil {
+					log.Printf("Failed to rotate tokens of app connection %s: %v", connection.ID, err)
+					result.Failed++
+				} else if rotated {
+					result.Rotated++
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to rotate tokens: %w", err)
+	}
+	return result, nil
+}
+
+func (v *TokenVault) rotateConnection(db *gorm.DB, connection models.AppConnection) (bool, error) {
+	access, accessChanged, err := v.rewrap(connection.AccessToken)
+	if err != nil {
+		return false, err
+	}
+	refresh, refreshChanged, err := v.rewrap(connection.RefreshToken)
+	if err != nil {
+		return false, err
+	}
+	if !accessChanged && !refreshChanged {
+		return false, nil
+	}
+	// UpdateColumns leaves updated_at alone; rotation is not a change to the connection
+	err = db.Unscoped().Model(&models.AppConnection{}).Where("id = ?", connection.ID).
+		UpdateColumns(map[string]interface{}{"access_token": access, "refresh_token": refresh}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/config"
+)
+
+// tracerName names the instrumentation behind the spans this package records itself. The
+// tracer is looked up from the global provider for each span, so spans go nowhere until
+// InitTracing runs.
+const tracerName = "cloudgate-backend/internal/services"
+
+// InitTracing installs the OTLP exporter and W3C trace context propagation. When tracing is
+// not configured it installs nothing and spans are dropped. The returned function flushes
+// spans still buffered and should run before the process exits.
+func InitTracing(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	// Propagate incoming trace context even when this instance does not export, so spans
+	// recorded upstream and downstream still join up
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+		otlptracehttp.WithHeaders(cfg.Headers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service for tracing: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// TracedHTTPClient returns a client whose requests are recorded as spans under the caller's
+// context and carry its trace context to the server
+func TracedHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method + " " + r.URL.Host
+			}),
+		),
+	}
+}
+
+const querySpanKey = "tracing:span"
+
+// TraceQueries records a span for each query run on db under a traced context. Queries
+// outside a request or job that is being traced are left alone, so background sweeps do not
+// each start a trace of their own.
+func TraceQueries(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if callbacks.Query().Get("tracing:start") != nil {
+		return nil
+	}
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("tracing:start", startQuerySpan("create")),
+		callbacks.Create().After("gorm:create").Register("tracing:end", endQuerySpan),
+		callbacks.Query().Before("gorm:query").Register("tracing:start", startQuerySpan("query")),
+		callbacks.Query().After("gorm:query").Register("tracing:end", endQuerySpan),
+		callbacks.Update().Before("gorm:update").Register("tracing:start", startQuerySpan("update")),
+		callbacks.Update().After("gorm:update").Register("tracing:end", endQuerySpan),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:start", startQuerySpan("delete")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:end", endQuerySpan),
+		callbacks.Row().Before("gorm:row").Register("tracing:start", startQuerySpan("row")),
+		callbacks.Row().After("gorm:row").Register("tracing:end", endQuerySpan),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:start", startQuerySpan("raw")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:end", endQuerySpan),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register tracing callback: %w", err)
+		}
+	}
+	return nil
+}
+
+// startQuerySpan opens the span for a statement about to run
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := otel.Tracer(tracerName).Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", tx.Dialector.Name()), attribute.String("db.operation", operation)),
+		)
+		tx.InstanceSet(querySpanKey, span)
+	}
+}
+
+// endQuerySpan records what ran and how it went
+func endQuerySpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(querySpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("db.statement", tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.sql.table", tx.Statement.Table))
+	}
+	if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
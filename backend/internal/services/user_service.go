@@ -238,19 +238,19 @@ func (s *UserService) LogAudit(userID uuid.UUID, action, resource, resourceID, i
 
 // GetUserAuditLogs retrieves audit logs for a user
 func (s *UserService) GetUserAuditLogs(userID uuid.UUID, limit int) ([]models.AuditLog, error) {
-	var logs []models.AuditLog
-
-	query := s.db.Where("user_id = ?", userID).Order("created_at DESC")
-	if limit > 0 {
-		query = query.Limit(limit)
-	}
+	logs, _, err := s.ListUserAuditLogs(userID, ListPage{Limit: limit})
+	return logs, err
+}
 
-	err := query.Find(&logs).Error
+// ListUserAuditLogs returns a page of a user's audit log entries and how many match the
+// page's filter in all
+func (s *UserService) ListUserAuditLogs(userID uuid.UUID, page ListPage) ([]models.AuditLog, int64, error) {
+	var logs []models.AuditLog
+	total, err := page.find(s.db.Model(&models.AuditLog{}).Where("user_id = ?", userID), "created_at DESC", &logs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get audit logs: %w", err)
+		return nil, 0, fmt.Errorf("failed to get audit logs: %w", err)
 	}
-
-	return logs, nil
+	return logs, total, nil
 }
 
 // DeactivateUser deactivates a user account
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultWatchlistThresholdFactor halves alert and risk thresholds for watched users
+	DefaultWatchlistThresholdFactor = 0.5
+	// DefaultWatchlistDuration is used when an analyst does not choose an expiry
+	DefaultWatchlistDuration = 30 * 24 * time.Hour
+
+	watchlistCacheTTL = 30 * time.Second
+)
+
+// ErrNotOnWatchlist is returned when a user has no active watchlist entry
+var ErrNotOnWatchlist = errors.New("user is not on the watchlist")
+
+// WatchlistService manages users flagged for enhanced monitoring
+type WatchlistService struct {
+	db            *gorm.DB
+	cache         map[uuid.UUID]models.WatchlistEntry
+	cacheLoadedAt time.Time
+	mutex         sync.RWMutex
+}
+
+// NewWatchlistService creates a new watchlist service
+func NewWatchlistService(db *gorm.DB) *WatchlistService {
+	return &WatchlistService{db: db}
+}
+
+// AddToWatchlist flags a user for enhanced monitoring until the given duration elapses.
+// An existing active entry is replaced so the latest reason and settings apply.
+func (s *WatchlistService) AddToWatchlist(userID uuid.UUID, addedBy *uuid.UUID, reason string, duration time.Duration, thresholdFactor float64, fullSessionLogging bool) (*models.WatchlistEntry, error) {
+	if duration <= 0 {
+		duration = DefaultWatchlistDuration
+	}
+	if thresholdFactor <= 0 || thresholdFactor > 1 {
+		thresholdFactor = DefaultWatchlistThresholdFactor
+	}
+
+	entry := models.WatchlistEntry{
+		UserID:             userID,
+		Reason:             reason,
+		AddedBy:            addedBy,
+		ThresholdFactor:    thresholdFactor,
+		FullSessionLogging: fullSessionLogging,
+		ExpiresAt:          time.Now().Add(duration),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.WatchlistEntry{}).
+			Where("user_id = ? AND removed_at IS NULL", userID).
+			Updates(map[string]interface{}{"removed_at": now, "removed_by": addedBy}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add user to watchlist: %w", err)
+	}
+
+	s.invalidateCache()
+	s.audit(addedBy, "watchlist_added", userID, fmt.Sprintf("Added to watchlist until %s: %s", entry.ExpiresAt.Format(time.RFC3339), reason))
+
+	return &entry, nil
+}
+
+// RemoveFromWatchlist ends enhanced monitoring for a user
+func (s *WatchlistService) RemoveFromWatchlist(userID uuid.UUID, removedBy *uuid.UUID) error {
+	result := s.db.Model(&models.WatchlistEntry{}).
+		Where("user_id = ? AND removed_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Updates(map[string]interface{}{"removed_at": time.Now(), "removed_by": removedBy})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove user from watchlist: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotOnWatchlist
+	}
+
+	s.invalidateCache()
+	s.audit(removedBy, "watchlist_removed", userID, "Removed from watchlist")
+	return nil
+}
+
+// GetActiveEntry returns the user's active watchlist entry, served from a short-lived cache
+func (s *WatchlistService) GetActiveEntry(userID uuid.UUID) (*models.WatchlistEntry, bool) {
+	if err := s.refreshCache(); err != nil {
+		log.Printf("⚠️ Failed to load watchlist: %v", err)
+		return nil, false
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entry, ok := s.cache[userID]
+	if !ok || !entry.IsActive() {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// ListActive returns all active watchlist entries, soonest expiry first
+func (s *WatchlistService) ListActive() ([]models.WatchlistEntry, error) {
+	var entries []models.WatchlistEntry
+	err := s.db.Where("removed_at IS NULL AND expires_at > ?", time.Now()).
+		Order("expires_at ASC").Find(&entries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watchlist: %w", err)
+	}
+	return entries, nil
+}
+
+// ExpireEntries closes out entries past their expiry and audits each one
+func (s *WatchlistService) ExpireEntries() (int, error) {
+	var expired []models.WatchlistEntry
+	if err := s.db.Where("removed_at IS NULL AND expires_at <= ?", time.Now()).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired watchlist entries: %w", err)
+	}
+
+	for _, entry := range expired {
+		if err := s.db.Model(&entry).Update("removed_at", entry.ExpiresAt).Error; err != nil {
+			return 0, fmt.Errorf("failed to expire watchlist entry: %w", err)
+		}
+		s.audit(nil, "watchlist_expired", entry.UserID, "Watchlist entry expired")
+	}
+
+	if len(expired) > 0 {
+		s.invalidateCache()
+	}
+	return len(expired), nil
+}
+
+// ScaleThreshold lowers a threshold for a watched user; unwatched users keep the original value
+func (s *WatchlistService) ScaleThreshold(userID uuid.UUID, threshold float64) float64 {
+	if entry, ok := s.GetActiveEntry(userID); ok {
+		return threshold * entry.ThresholdFactor
+	}
+	return threshold
+}
+
+func (s *WatchlistService) refreshCache() error {
+	s.mutex.RLock()
+	fresh := s.cache != nil && time.Since(s.cacheLoadedAt) < watchlistCacheTTL
+	s.mutex.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	entries, err := s.ListActive()
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[uuid.UUID]models.WatchlistEntry, len(entries))
+	for _, entry := range entries {
+		cache[entry.UserID] = entry
+	}
+
+	s.mutex.Lock()
+	s.cache = cache
+	s.cacheLoadedAt = time.Now()
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *WatchlistService) invalidateCache() {
+	s.mutex.Lock()
+	s.cache = nil
+	s.mutex.Unlock()
+}
+
+// audit records watchlist changes; the actor is the analyst, the resource is the watched user
+func (s *WatchlistService) audit(actor *uuid.UUID, action string, userID uuid.UUID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "watchlist",
+		ResourceID: userID.String(),
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit watchlist change: %v", err)
+	}
+}
+
+// GetActivity returns the audit trail recorded for a user since the given time, newest first
+func (s *WatchlistService) GetActivity(userID uuid.UUID, since time.Time, limit, offset int) ([]models.AuditLog, int64, error) {
+	query := s.db.Model(&models.AuditLog{}).
+		Where("(user_id = ? OR (resource = ? AND resource_id = ?)) AND created_at >= ?", userID, "watchlist", userID.String(), since).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count activity: %w", err)
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get activity: %w", err)
+	}
+	return logs, total, nil
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+	webAuthnFlagAttestedData = 0x40
+)
+
+// COSE algorithms CloudGate accepts, matching the pubKeyCredParams it offers
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+var (
+	// ErrInvalidWebAuthnResponse is returned when an authenticator response fails verification
+	ErrInvalidWebAuthnResponse = errors.New("invalid WebAuthn response")
+	// ErrWebAuthnCredentialNotFound is returned when the user has no such credential
+	ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+	// ErrWebAuthnSignCountRegressed is returned when an assertion's signature counter does
+	// not advance past the stored one, which suggests a cloned authenticator
+	ErrWebAuthnSignCountRegressed = errors.New("WebAuthn signature counter did not advance")
+)
+
+// WebAuthnAssertion is the authenticator's response to a webauthn.get ceremony
+type WebAuthnAssertion struct {
+	CredentialID      string
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+// WebAuthnRPID is the relying party ID credentials are scoped to, from WEBAUTHN_RP_ID
+func WebAuthnRPID() string {
+	return getEnv("WEBAUTHN_RP_ID", "localhost")
+}
+
+// webAuthnOrigins are the origins ceremonies may run on, from WEBAUTHN_ORIGINS or else
+// ALLOWED_ORIGINS
+func webAuthnOrigins() map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(getEnv("WEBAUTHN_ORIGINS", getEnv("ALLOWED_ORIGINS", "http://localhost:3000")), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
+
+// RegisterWebAuthnCredential verifies a webauthn.create response and stores the credential
+// with its public key and signature counter. The challenge is checked by the caller. The
+// attestation statement is not verified, so the authenticator's make is not vouched for.
+func RegisterWebAuthnCredential(userID, credentialID string, clientDataJSON, attestationObject []byte) error {
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+	if err := checkWebAuthnClientData(clientDataJSON, "webauthn.create"); err != nil {
+		return err
+	}
+	rawID, publicKey, signCount, err := parseWebAuthnAttestation(attestationObject)
+	if err != nil {
+		return err
+	}
+	if base64.RawURLEncoding.EncodeToString(rawID) != strings.TrimRight(credentialID, "=") {
+		return fmt.Errorf("%w: credential ID does not match the authenticator data", ErrInvalidWebAuthnResponse)
+	}
+
+	credential := WebAuthnCredential{
+		UserID:            userUUID,
+		CredentialID:      credentialID,
+		PublicKey:         publicKey,
+		AttestationObject: attestationObject,
+		Counter:           signCount,
+		DeviceName:        "WebAuthn Device",
+	}
+	return GetDB().Create(&credential).Error
+}
+
+// VerifyWebAuthnAssertion checks an assertion against the user's stored credential: the
+// origin, the relying party ID hash, user presence, the signature over the authenticator
+// data and client data, and that the signature counter advanced. The counter and last use
+// are then recorded. The challenge is checked by the caller.
+func VerifyWebAuthnAssertion(userID string, assertion WebAuthnAssertion) (*WebAuthnCredential, error) {
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	db := GetDB()
+
+	var credential WebAuthnCredential
+	result := db.Where("user_id = ? AND credential_id = ?", userUUID, assertion.CredentialID).Limit(1).Find(&credential)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get WebAuthn credential: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	if err := checkWebAuthnClientData(assertion.ClientDataJSON, "webauthn.get"); err != nil {
+		return nil, err
+	}
+	authData := assertion.AuthenticatorData
+	if len(authData) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data is too short", ErrInvalidWebAuthnResponse)
+	}
+	if err := checkWebAuthnRPIDHash(authData); err != nil {
+		return nil, err
+	}
+	if authData[32]&webAuthnFlagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: the user was not present", ErrInvalidWebAuthnResponse)
+	}
+
+	// Credentials stored before public keys were kept still carry their attestation
+	coseKey := credential.PublicKey
+	if len(coseKey) == 0 {
+		if _, coseKey, _, err = parseWebAuthnAttestation(credential.AttestationObject); err != nil {
+			return nil, fmt.Errorf("%w: the credential has no usable public key; register it again", ErrInvalidWebAuthnResponse)
+		}
+	}
+	clientDataHash := sha256.Sum256(assertion.ClientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(coseKey, signed, assertion.Signature); err != nil {
+		return nil, err
+	}
+
+	// A counter that does not advance means another copy of the key is in use; authenticators
+	// that keep no counter always report zero
+	signCount := binary.BigEndian.Uint32(authData[33:37])
+	if (signCount != 0 || credential.Counter != 0) && signCount <= credential.Counter {
+		return nil, ErrWebAuthnSignCountRegressed
+	}
+	now := time.Now()
+	updated := db.Model(&WebAuthnCredential{}).
+		Where("id = ? AND counter = ?", credential.ID, credential.Counter).
+		Updates(map[string]interface{}{"counter": signCount, "public_key": coseKey, "last_used": &now})
+	if updated.Error != nil {
+		return nil, fmt.Errorf("failed to record WebAuthn credential use: %w", updated.Error)
+	}
+	if updated.RowsAffected == 0 {
+		// Another assertion with this credential was accepted meanwhile
+		return nil, ErrWebAuthnSignCountRegressed
+	}
+	credential.Counter = signCount
+	credential.PublicKey = coseKey
+	credential.LastUsed = &now
+	return &credential, nil
+}
+
+// checkWebAuthnClientData checks the ceremony type and that it ran on an allowed origin
+func checkWebAuthnClientData(clientDataJSON []byte, ceremony string) error {
+	var clientData struct {
+		Type   string `json:"type"`
+		Origin string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("%w: client data is not JSON", ErrInvalidWebAuthnResponse)
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: expected a %s ceremony", ErrInvalidWebAuthnResponse, ceremony)
+	}
+	if !webAuthnOrigins()[clientData.Origin] {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidWebAuthnResponse, clientData.Origin)
+	}
+	return nil
+}
+
+// checkWebAuthnRPIDHash checks that authenticator data was produced for CloudGate's RP ID
+func checkWebAuthnRPIDHash(authData []byte) error {
+	expected := sha256.Sum256([]byte(WebAuthnRPID()))
+	if !bytes.Equal(authData[:32], expected[:]) {
+		return fmt.Errorf("%w: relying party ID hash does not match", ErrInvalidWebAuthnResponse)
+	}
+	return nil
+}
+
+// parseWebAuthnAttestation returns the credential ID, COSE public key and signature counter
+// from an attestation object's authenticator data
+func parseWebAuthnAttestation(attestationObject []byte) ([]byte, []byte, uint32, error) {
+	decoded, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, nil, 0, fmt.Errorf("%w: attestation object is not CBOR", ErrInvalidWebAuthnResponse)
+	}
+	object, _ := decoded.(map[interface{}]interface{})
+	authData, _ := object["authData"].([]byte)
+	if len(authData) < 37 {
+		return nil, nil, 0, fmt.Errorf("%w: attestation has no authenticator data", ErrInvalidWebAuthnResponse)
+	}
+	if err := checkWebAuthnRPIDHash(authData); err != nil {
+		return nil, nil, 0, err
+	}
+	flags := authData[32]
+	if flags&webAuthnFlagUserPresent == 0 {
+		return nil, nil, 0, fmt.Errorf("%w: the user was not present", ErrInvalidWebAuthnResponse)
+	}
+	if flags&webAuthnFlagAttestedData == 0 || len(authData) < 55 {
+		return nil, nil, 0, fmt.Errorf("%w: attestation carries no credential", ErrInvalidWebAuthnResponse)
+	}
+	signCount := binary.BigEndian.Uint32(authData[33:37])
+
+	// AAGUID (16 bytes), credential ID length (2 bytes), credential ID, COSE key
+	idLength := int(binary.BigEndian.Uint16(authData[53:55]))
+	if len(authData) < 55+idLength {
+		return nil, nil, 0, fmt.Errorf("%w: credential ID is truncated", ErrInvalidWebAuthnResponse)
+	}
+	credentialID := authData[55 : 55+idLength]
+	keyData := authData[55+idLength:]
+	_, extensions, err := decodeCBOR(keyData)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: credential public key is not CBOR", ErrInvalidWebAuthnResponse)
+	}
+	coseKey := keyData[:len(keyData)-len(extensions)]
+	if _, _, err := parseCOSEKey(coseKey); err != nil {
+		return nil, nil, 0, err
+	}
+	return credentialID, coseKey, signCount, nil
+}
+
+// parseCOSEKey returns a COSE_Key's algorithm and public key
+func parseCOSEKey(coseKey []byte) (int64, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: public key is not CBOR", ErrInvalidWebAuthnResponse)
+	}
+	key, _ := decoded.(map[interface{}]interface{})
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == coseAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			break
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			break
+		}
+		return alg, public, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			break
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case kty == 1 && alg == coseAlgEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			break
+		}
+		return alg, ed25519.PublicKey(x), nil
+	}
+	return 0, nil, fmt.Errorf("%w: unsupported public key (kty %d, alg %d)", ErrInvalidWebAuthnResponse, kty, alg)
+}
+
+// verifyCOSESignature checks signature over message with a COSE public key
+func verifyCOSESignature(coseKey, message, signature []byte) error {
+	alg, public, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(message)
+	valid := false
+	switch alg {
+	case coseAlgES256:
+		valid = ecdsa.VerifyASN1(public.(*ecdsa.PublicKey), digest[:], signature)
+	case coseAlgRS256:
+		valid = rsa.VerifyPKCS1v15(public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case coseAlgEdDSA:
+		valid = ed25519.Verify(public.(ed25519.PublicKey), message, signature)
+	}
+	if !valid {
+		return fmt.Errorf("%w: signature does not verify", ErrInvalidWebAuthnResponse)
+	}
+	return nil
+}
+
+// cborMaxDepth bounds nesting so hostile input cannot exhaust the stack
+const cborMaxDepth = 16
+
+// decodeCBOR decodes the first CBOR data item in data and returns the rest. It covers the
+// definite-length subset authenticators emit: integers, byte and text strings, arrays,
+// maps, tags (returned as their content) and simple values.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor: nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("cbor: unexpected end of data")
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	var argument uint64
+	switch {
+	case info < 24:
+		argument = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		for _, b := range data[:size] {
+			argument = argument<<8 | uint64(b)
+		}
+		data = data[size:]
+	default:
+		return nil, nil, errors.New("cbor: indefinite lengths are not supported")
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer overflows")
+		}
+		return int64(argument), data, nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer overflows")
+		}
+		return -1 - int64(argument), data, nil
+	case 2, 3:
+		if uint64(len(data)) < argument {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		value := data[:argument]
+		if major == 3 {
+			return string(value), data[argument:], nil
+		}
+		return append([]byte{}, value...), data[argument:], nil
+	case 4:
+		if uint64(len(data)) < argument {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+			data = rest
+		}
+		return items, data, nil
+	case 5:
+		if uint64(len(data)) < argument {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		items := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, rest, err := decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("cbor: map keys must be integers or text")
+			}
+			value, rest, err := decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+			data = rest
+		}
+		return items, data, nil
+	case 6:
+		return decodeCBORItem(data, depth+1)
+	default:
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		case 25, 26, 27:
+			// Floats are skipped; nothing WebAuthn verifies uses them
+			return nil, data, nil
+		}
+		return nil, nil, errors.New("cbor: unsupported simple value")
+	}
+}
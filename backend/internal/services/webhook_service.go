@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBulkReplay bounds how many dead letters one bulk replay request sends
+	maxBulkReplay = 100
+	// maxStoredResponse bounds how much of a receiver's response body is kept
+	maxStoredResponse = 2048
+)
+
+var (
+	// ErrDeadLetterNotFound is returned when a dead letter does not exist
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrDeadLetterReplayed is returned when replaying a dead letter that was already delivered
+	ErrDeadLetterReplayed = errors.New("dead letter already replayed")
+	// ErrWebhookDeliveryFailed is returned when the receiver did not accept a delivery
+	ErrWebhookDeliveryFailed = errors.New("webhook delivery failed")
+)
+
+// DeadLetterFilter narrows the dead-letter listing
+type DeadLetterFilter struct {
+	Source    string
+	Status    string
+	EventType string
+}
+
+// WebhookReplayResult is the outcome of replaying one dead letter in a bulk replay
+type WebhookReplayResult struct {
+	ID        uuid.UUID `json:"id"`
+	Delivered bool      `json:"delivered"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// WebhookService delivers outbound webhooks with retries and keeps failed deliveries in a
+// dead-letter store for inspection and replay
+type WebhookService struct {
+	db             *gorm.DB
+	client         *http.Client
+	maxAttempts    int
+	retryBackoff   time.Duration
+	retention      time.Duration
+	maxDeadLetters int
+	signer         *WebhookSigningService
+}
+
+// NewWebhookService creates a new webhook service. Retries and dead-letter retention are
+// configured with WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_BACKOFF, WEBHOOK_DEAD_LETTER_RETENTION
+// and WEBHOOK_DEAD_LETTER_MAX.
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	return &WebhookService{
+		db:             db,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:    envInt("WEBHOOK_MAX_ATTEMPTS", 3),
+		retryBackoff:   envDuration("WEBHOOK_RETRY_BACKOFF", 2*time.Second),
+		retention:      envDuration("WEBHOOK_DEAD_LETTER_RETENTION", 30*24*time.Hour),
+		maxDeadLetters: envInt("WEBHOOK_DEAD_LETTER_MAX", 10000),
+	}
+}
+
+// UseSigner signs deliveries to registered consumers with their signing keys
+func (s *WebhookService) UseSigner(signer *WebhookSigningService) {
+	s.signer = signer
+}
+
+// Deliver posts a JSON payload to a receiver, retrying with linear backoff. When every
+// attempt fails the delivery is dead-lettered and the last error returned.
+func (s *WebhookService) Deliver(source, eventType, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	var statusCode int
+	var response string
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		statusCode, response, err = s.send(context.Background(), url, headers, body)
+		if err == nil {
+			return nil
+		}
+		if attempt < s.maxAttempts {
+			time.Sleep(time.Duration(attempt) * s.retryBackoff)
+		}
+	}
+
+	headersJSON, _ := json.Marshal(headers)
+	deadLetter := models.WebhookDeadLetter{
+		Source:         source,
+		EventType:      eventType,
+		URL:            url,
+		Headers:        string(headersJSON),
+		Payload:        string(body),
+		Status:         models.DeadLetterFailed,
+		Attempts:       s.maxAttempts,
+		LastStatusCode: statusCode,
+		LastResponse:   response,
+		LastError:      err.Error(),
+		LastAttemptAt:  time.Now(),
+	}
+	if dbErr := s.db.Create(&deadLetter).Error; dbErr != nil {
+		log.Printf("⚠️ Failed to dead-letter %s webhook to %s: %v", eventType, url, dbErr)
+	} else {
+		log.Printf("📭 %s webhook to %s dead-lettered after %d attempts: %v", eventType, url, s.maxAttempts, err)
+		s.PurgeExpired()
+	}
+	return err
+}
+
+// send makes a single delivery attempt; any non-2xx response is a failure. Each attempt
+// is signed afresh, so replays carry a current timestamp and the consumer's current keys.
+func (s *WebhookService) send(ctx context.Context, url string, headers map[string]string, body []byte) (int, string, error) {
+	ctx, cancel := withProvider(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrWebhookDeliveryFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if s.signer != nil {
+		signature, err := s.signer.SignatureHeaders(url, body, time.Now())
+		if err != nil {
+			return 0, "", fmt.Errorf("%w: %v", ErrWebhookDeliveryFailed, err)
+		}
+		for key, value := range signature {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrWebhookDeliveryFailed, err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxStoredResponse))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(responseBody), fmt.Errorf("%w: receiver returned status %d", ErrWebhookDeliveryFailed, resp.StatusCode)
+	}
+	return resp.StatusCode, string(responseBody), nil
+}
+
+// ListDeadLetters returns dead letters newest first
+func (s *WebhookService) ListDeadLetters(filter DeadLetterFilter, limit, offset int) ([]models.WebhookDeadLetter, int64, error) {
+	query := s.db.Model(&models.WebhookDeadLetter{})
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.EventType != "" {
+		query = query.Where("event_type = ?", filter.EventType)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+
+	var deadLetters []models.WebhookDeadLetter
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&deadLetters).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	return deadLetters, total, nil
+}
+
+// GetDeadLetter returns a dead letter with its payload and last response
+func (s *WebhookService) GetDeadLetter(id uuid.UUID) (*models.WebhookDeadLetter, error) {
+	var deadLetter models.WebhookDeadLetter
+	if err := s.db.First(&deadLetter, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	return &deadLetter, nil
+}
+
+// Replay redelivers a dead letter once. The updated dead letter is returned even when
+// the receiver fails again, so the caller can show the new response.
+func (s *WebhookService) Replay(ctx context.Context, id uuid.UUID, actor *uuid.UUID) (*models.WebhookDeadLetter, error) {
+	deadLetter, err := s.GetDeadLetter(id)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetter.Status == models.DeadLetterReplayed {
+		return deadLetter, ErrDeadLetterReplayed
+	}
+
+	var headers map[string]string
+	if deadLetter.Headers != "" {
+		_ = json.Unmarshal([]byte(deadLetter.Headers), &headers)
+	}
+
+	statusCode, response, sendErr := s.send(ctx, deadLetter.URL, headers, []byte(deadLetter.Payload))
+	now := time.Now()
+	deadLetter.Attempts++
+	deadLetter.LastStatusCode = statusCode
+	deadLetter.LastResponse = response
+	deadLetter.LastAttemptAt = now
+	if sendErr == nil {
+		deadLetter.Status = models.DeadLetterReplayed
+		deadLetter.LastError = ""
+		deadLetter.ReplayedAt = &now
+		deadLetter.ReplayedBy = actor
+	} else {
+		deadLetter.LastError = sendErr.Error()
+	}
+
+	if err := s.db.Save(deadLetter).Error; err != nil {
+		return nil, fmt.Errorf("failed to update dead letter: %w", err)
+	}
+
+	status := "success"
+	details := fmt.Sprintf("Replayed %s webhook to %s", deadLetter.EventType, deadLetter.URL)
+	if sendErr != nil {
+		status = "failure"
+		details += ": " + sendErr.Error()
+	}
+	s.audit(actor, "webhook_replayed", deadLetter.ID, status, details)
+
+	return deadLetter, sendErr
+}
+
+// ReplayBulk replays the given dead letters, or when ids is empty the oldest failed
+// ones matching the filter, up to maxBulkReplay per call
+func (s *WebhookService) ReplayBulk(ctx context.Context, ids []uuid.UUID, filter DeadLetterFilter, actor *uuid.UUID) ([]WebhookReplayResult, error) {
+	if len(ids) == 0 {
+		query := s.db.Model(&models.WebhookDeadLetter{}).Where("status = ?", models.DeadLetterFailed)
+		if filter.Source != "" {
+			query = query.Where("source = ?", filter.Source)
+		}
+		if filter.EventType != "" {
+			query = query.Where("event_type = ?", filter.EventType)
+		}
+		if err := query.Order("created_at ASC").Limit(maxBulkReplay).Pluck("id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to select dead letters: %w", err)
+		}
+	}
+	if len(ids) > maxBulkReplay {
+		ids = ids[:maxBulkReplay]
+	}
+
+	results := make([]WebhookReplayResult, 0, len(ids))
+	for _, id := range ids {
+		result := WebhookReplayResult{ID: id}
+		if _, err := s.Replay(ctx, id, actor); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Delivered = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// DiscardDeadLetter deletes a dead letter that should not be replayed
+func (s *WebhookService) DiscardDeadLetter(id uuid.UUID, actor *uuid.UUID) error {
+	result := s.db.Delete(&models.WebhookDeadLetter{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to discard dead letter: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeadLetterNotFound
+	}
+	s.audit(actor, "webhook_dead_letter_discarded", id, "success", "Dead letter discarded")
+	return nil
+}
+
+// PurgeExpired enforces the dead-letter retention limits: entries older than the
+// retention window go first, then the oldest beyond the maximum count
+func (s *WebhookService) PurgeExpired() int64 {
+	result := s.db.Where("created_at < ?", time.Now().Add(-s.retention)).Delete(&models.WebhookDeadLetter{})
+	if result.Error != nil {
+		log.Printf("⚠️ Failed to purge expired dead letters: %v", result.Error)
+		return 0
+	}
+	purged := result.RowsAffected
+
+	var count int64
+	if err := s.db.Model(&models.WebhookDeadLetter{}).Count(&count).Error; err != nil || count <= int64(s.maxDeadLetters) {
+		return purged
+	}
+	oldest := s.db.Model(&models.WebhookDeadLetter{}).Select("id").Order("created_at ASC").Limit(int(count) - s.maxDeadLetters)
+	result = s.db.Where("id IN (?)", oldest).Delete(&models.WebhookDeadLetter{})
+	if result.Error != nil {
+		log.Printf("⚠️ Failed to trim dead letters: %v", result.Error)
+		return purged
+	}
+	return purged + result.RowsAffected
+}
+
+func (s *WebhookService) audit(actor *uuid.UUID, action string, deadLetterID uuid.UUID, status, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "webhook_dead_letter",
+		ResourceID: deadLetterID.String(),
+		Details:    details,
+		Status:     status,
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit webhook action: %v", err)
+	}
+}
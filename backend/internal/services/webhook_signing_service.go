@@ -0,0 +1,407 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudgate-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookSignatureHeader carries the signatures of an outbound webhook delivery
+const WebhookSignatureHeader = "X-CloudGate-Signature"
+
+var (
+	// ErrWebhookConsumerNotFound is returned when a webhook consumer does not exist
+	ErrWebhookConsumerNotFound = errors.New("webhook consumer not found")
+	// ErrInvalidWebhookConsumer is returned for consumer registrations that fail validation
+	ErrInvalidWebhookConsumer = errors.New("invalid webhook consumer")
+	// ErrWebhookKeyNotFound is returned when a consumer has no such signing key
+	ErrWebhookKeyNotFound = errors.New("webhook signing key not found")
+	// ErrLastWebhookKey is returned when revoking the only key still signing for a consumer
+	ErrLastWebhookKey = errors.New("cannot revoke the consumer's only signing key; rotate first")
+)
+
+// WebhookConsumerInput is the registration of a webhook consumer
+type WebhookConsumerInput struct {
+	Name        string `json:"name" binding:"required"`
+	URL         string `json:"url" binding:"required"`
+	Description string `json:"description"`
+}
+
+// WebhookVerification is the outcome of checking a consumer's sample signature
+type WebhookVerification struct {
+	Valid     bool       `json:"valid"`
+	KeyID     string     `json:"key_id,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// WebhookSigningService manages per-consumer webhook signing keys and signs deliveries.
+// A delivery carries X-CloudGate-Signature: t=<unix time>,v1=<hex>, where each v1 is the
+// HMAC-SHA256 of "<t>.<body>" under one of the consumer's signing keys. While a rotated
+// key is retiring both it and its replacement sign, so either secret verifies.
+type WebhookSigningService struct {
+	db         *gorm.DB
+	sealKey    []byte
+	overlap    time.Duration
+	tolerance  time.Duration
+	checkEvery time.Duration
+}
+
+// NewWebhookSigningService creates a webhook signing service. Secrets are sealed under
+// WEBHOOK_SIGNING_ENCRYPTION_KEY; WEBHOOK_SIGNING_KEY_OVERLAP is how long a rotated key
+// keeps signing, WEBHOOK_SIGNATURE_TOLERANCE how old a verified timestamp may be and
+// WEBHOOK_SIGNING_KEY_CHECK_INTERVAL how often keys past their overlap are retired.
+func NewWebhookSigningService(db *gorm.DB) *WebhookSigningService {
+	return &WebhookSigningService{
+		db:         db,
+		sealKey:    credentialKey("webhook-signing", "WEBHOOK_SIGNING_ENCRYPTION_KEY"),
+		overlap:    envDuration("WEBHOOK_SIGNING_KEY_OVERLAP", 24*time.Hour),
+		tolerance:  envDuration("WEBHOOK_SIGNATURE_TOLERANCE", 5*time.Minute),
+		checkEvery: envDuration("WEBHOOK_SIGNING_KEY_CHECK_INTERVAL", 15*time.Minute),
+	}
+}
+
+// Interval is how often RetireExpiredKeys should run
+func (s *WebhookSigningService) Interval() time.Duration {
+	return s.checkEvery
+}
+
+// RetireExpiredKeys marks keys whose overlap has ended as retired and returns how many
+// were. They stop signing and verifying at the end of the overlap whether or not this has
+// run; it keeps the recorded status in step.
+func (s *WebhookSigningService) RetireExpiredKeys(now time.Time) (int, error) {
+	result := s.db.Model(&models.WebhookSigningKey{}).
+		Where("status = ? AND retires_at <= ?", models.WebhookKeyRetiring, now).
+		Updates(map[string]interface{}{"status": models.WebhookKeyRetired, "retired_at": now})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to retire webhook signing keys: %w", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// CreateConsumer registers a consumer with its first signing key, returning the key's
+// secret. The secret is only available here and from RotateKey.
+func (s *WebhookSigningService) CreateConsumer(input WebhookConsumerInput, actor *uuid.UUID, now time.Time) (*models.WebhookConsumer, *models.WebhookSigningKey, string, error) {
+	consumer := models.WebhookConsumer{CreatedBy: actor, UpdatedBy: actor}
+	if err := applyWebhookConsumerInput(&consumer, input); err != nil {
+		return nil, nil, "", err
+	}
+	if err := s.ensureURLAvailable(consumer.URL, uuid.Nil); err != nil {
+		return nil, nil, "", err
+	}
+
+	var key *models.WebhookSigningKey
+	var secret string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&consumer).Error; err != nil {
+			return fmt.Errorf("failed to create webhook consumer: %w", err)
+		}
+		var err error
+		key, secret, err = s.createKey(tx, consumer.ID, actor)
+		return err
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	s.audit(actor, "webhook_consumer_created", consumer.ID, fmt.Sprintf("Webhook consumer %s registered for %s", consumer.Name, consumer.URL))
+	return &consumer, key, secret, nil
+}
+
+// UpdateConsumer replaces a consumer's registration; its keys are kept
+func (s *WebhookSigningService) UpdateConsumer(id uuid.UUID, input WebhookConsumerInput, actor *uuid.UUID) (*models.WebhookConsumer, error) {
+	consumer, err := s.GetConsumer(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyWebhookConsumerInput(consumer, input); err != nil {
+		return nil, err
+	}
+	if err := s.ensureURLAvailable(consumer.URL, consumer.ID); err != nil {
+		return nil, err
+	}
+	consumer.UpdatedBy = actor
+	if err := s.db.Omit("Keys").Save(consumer).Error; err != nil {
+		return nil, fmt.Errorf("failed to update webhook consumer: %w", err)
+	}
+	s.audit(actor, "webhook_consumer_updated", consumer.ID, "Webhook consumer "+consumer.Name+" updated")
+	return consumer, nil
+}
+
+// GetConsumer returns a consumer with its keys, newest first
+func (s *WebhookSigningService) GetConsumer(id uuid.UUID) (*models.WebhookConsumer, error) {
+	var consumer models.WebhookConsumer
+	result := s.db.Preload("Keys", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		Where("id = ?", id).Limit(1).Find(&consumer)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get webhook consumer: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrWebhookConsumerNotFound
+	}
+	return &consumer, nil
+}
+
+// ListConsumers returns every consumer with its keys
+func (s *WebhookSigningService) ListConsumers() ([]models.WebhookConsumer, error) {
+	var consumers []models.WebhookConsumer
+	if err := s.db.Preload("Keys", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		Order("name ASC").Find(&consumers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook consumers: %w", err)
+	}
+	return consumers, nil
+}
+
+// DeleteConsumer removes a consumer and its keys; deliveries to its URL go unsigned
+func (s *WebhookSigningService) DeleteConsumer(id uuid.UUID, actor *uuid.UUID) error {
+	consumer, err := s.GetConsumer(id)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("consumer_id = ?", id).Delete(&models.WebhookSigningKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.WebhookConsumer{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook consumer: %w", err)
+	}
+	s.audit(actor, "webhook_consumer_deleted", id, "Webhook consumer "+consumer.Name+" deleted")
+	return nil
+}
+
+// RotateKey issues a new signing key for a consumer and returns its secret. Keys that
+// were signing keep signing alongside it for the overlap, then retire.
+func (s *WebhookSigningService) RotateKey(consumerID uuid.UUID, actor *uuid.UUID, now time.Time) (*models.WebhookSigningKey, string, error) {
+	if _, err := s.GetConsumer(consumerID); err != nil {
+		return nil, "", err
+	}
+	retiresAt := now.Add(s.overlap)
+	var key *models.WebhookSigningKey
+	var secret string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebhookSigningKey{}).
+			Where("consumer_id = ? AND status = ?", consumerID, models.WebhookKeyActive).
+			Updates(map[string]interface{}{"status": models.WebhookKeyRetiring, "retires_at": retiresAt}).Error; err != nil {
+			return fmt.Errorf("failed to retire webhook signing keys: %w", err)
+		}
+		var err error
+		key, secret, err = s.createKey(tx, consumerID, actor)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	s.audit(actor, "webhook_key_rotated", consumerID, fmt.Sprintf("Signing key %s issued; previous keys sign until %s", key.KeyID, retiresAt.UTC().Format(time.RFC3339)))
+	return key, secret, nil
+}
+
+// RevokeKey retires a consumer's signing key at once, such as when its secret leaked
+func (s *WebhookSigningService) RevokeKey(consumerID uuid.UUID, keyID string, actor *uuid.UUID, now time.Time) error {
+	keys, err := s.signingKeys(consumerID, now)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, key := range keys {
+		found = found || key.KeyID == keyID
+	}
+	if !found {
+		return ErrWebhookKeyNotFound
+	}
+	if len(keys) == 1 {
+		return ErrLastWebhookKey
+	}
+	if err := s.db.Model(&models.WebhookSigningKey{}).Where("consumer_id = ? AND key_id = ?", consumerID, keyID).
+		Updates(map[string]interface{}{"status": models.WebhookKeyRetired, "retired_at": now}).Error; err != nil {
+		return fmt.Errorf("failed to revoke webhook signing key: %w", err)
+	}
+	s.audit(actor, "webhook_key_revoked", consumerID, "Signing key "+keyID+" revoked")
+	return nil
+}
+
+// SignatureHeaders returns the signature header for a delivery of body to a receiver,
+// or nil when the receiver is not a registered consumer
+func (s *WebhookSigningService) SignatureHeaders(receiverURL string, body []byte, now time.Time) (map[string]string, error) {
+	var consumer models.WebhookConsumer
+	result := s.db.Where("url = ?", receiverURL).Limit(1).Find(&consumer)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find webhook consumer: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	keys, err := s.signingKeys(consumer.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	parts := []string{"t=" + timestamp}
+	for _, key := range keys {
+		secret, err := openSecret(s.sealKey, key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open webhook signing key %s: %w", key.KeyID, err)
+		}
+		parts = append(parts, "v1="+webhookSignature(secret, timestamp, body))
+	}
+	return map[string]string{WebhookSignatureHeader: strings.Join(parts, ",")}, nil
+}
+
+// Verify checks a signature header a consumer computed over a sample payload, so they
+// can test their implementation against their current keys. It only reads, as anyone may
+// call it.
+func (s *WebhookSigningService) Verify(consumerID uuid.UUID, body []byte, header string, now time.Time) (*WebhookVerification, error) {
+	keys, err := s.signingKeys(consumerID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return &WebhookVerification{Reason: "the signature must look like t=<unix time>,v1=<hex>"}, nil
+	}
+	signedAt := time.Unix(unix, 0).UTC()
+	verification := &WebhookVerification{Timestamp: &signedAt}
+
+	for _, key := range keys {
+		secret, err := openSecret(s.sealKey, key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open webhook signing key %s: %w", key.KeyID, err)
+		}
+		expected := webhookSignature(secret, timestamp, body)
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+				verification.KeyID = key.KeyID
+			}
+		}
+	}
+	switch {
+	case verification.KeyID == "":
+		verification.Reason = "no v1 signature matches a current signing key over \"<t>.<body>\""
+	case now.Sub(signedAt) > s.tolerance || signedAt.Sub(now) > s.tolerance:
+		verification.Reason = fmt.Sprintf("the signature matches but t is more than %s from now; receivers should reject it", s.tolerance)
+	default:
+		verification.Valid = true
+	}
+	return verification, nil
+}
+
+// signingKeys returns the keys signing for a consumer: active keys and retiring keys still
+// within their overlap
+func (s *WebhookSigningService) signingKeys(consumerID uuid.UUID, now time.Time) ([]models.WebhookSigningKey, error) {
+	var keys []models.WebhookSigningKey
+	if err := s.db.Where("consumer_id = ? AND (status = ? OR (status = ? AND retires_at > ?))",
+		consumerID, models.WebhookKeyActive, models.WebhookKeyRetiring, now).
+		Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhook signing keys: %w", err)
+	}
+	if len(keys) == 0 {
+		if _, err := s.GetConsumer(consumerID); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (s *WebhookSigningService) createKey(tx *gorm.DB, consumerID uuid.UUID, actor *uuid.UUID) (*models.WebhookSigningKey, string, error) {
+	raw := make([]byte, 32)
+	id := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", fmt.Errorf("failed to generate webhook key ID: %w", err)
+	}
+	secret := "whsec_" + base64.RawURLEncoding.EncodeToString(raw)
+	sealed, err := sealSecret(s.sealKey, []byte(secret))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to seal webhook secret: %w", err)
+	}
+	key := models.WebhookSigningKey{
+		ConsumerID: consumerID,
+		KeyID:      "whk_" + hex.EncodeToString(id),
+		Secret:     sealed,
+		Status:     models.WebhookKeyActive,
+		CreatedBy:  actor,
+	}
+	if err := tx.Create(&key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to store webhook signing key: %w", err)
+	}
+	return &key, secret, nil
+}
+
+func (s *WebhookSigningService) ensureURLAvailable(receiverURL string, self uuid.UUID) error {
+	var count int64
+	if err := s.db.Model(&models.WebhookConsumer{}).Where("url = ? AND id <> ?", receiverURL, self).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check webhook consumer URL: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: another consumer already receives %s", ErrInvalidWebhookConsumer, receiverURL)
+	}
+	return nil
+}
+
+func (s *WebhookSigningService) audit(actor *uuid.UUID, action string, consumerID uuid.UUID, details string) {
+	auditLog := models.AuditLog{
+		UserID:     actor,
+		Action:     action,
+		Resource:   "webhook_consumer",
+		ResourceID: consumerID.String(),
+		Details:    details,
+		Status:     "success",
+	}
+	if err := s.db.Create(&auditLog).Error; err != nil {
+		log.Printf("Failed to audit webhook consumer action: %v", err)
+	}
+}
+
+// applyWebhookConsumerInput validates a registration and copies it onto consumer
+func applyWebhookConsumerInput(consumer *models.WebhookConsumer, input WebhookConsumerInput) error {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidWebhookConsumer)
+	}
+	receiver, err := url.Parse(strings.TrimSpace(input.URL))
+	if err != nil || receiver.Host == "" || (receiver.Scheme != "https" && receiver.Scheme != "http") {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhookConsumer)
+	}
+	consumer.Name = name
+	consumer.URL = strings.TrimSpace(input.URL)
+	consumer.Description = strings.TrimSpace(input.Description)
+	return nil
+}
+
+// webhookSignature is the hex HMAC-SHA256 of "<timestamp>.<body>"
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudgate-backend/pkg/constants"
+	"cloudgate-backend/pkg/types"
+
+	"github.com/google/uuid"
+)
+
+// WSFedActionSignIn is the passive requestor sign-in action (the wa parameter)
+const WSFedActionSignIn = "wsignin1.0"
+
+const (
+	wsTrustNamespace            = "http://schemas.xmlsoap.org/ws/2005/02/trust"
+	wsUtilityNamespace          = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	wsPolicyNamespace           = "http://schemas.xmlsoap.org/ws/2004/09/policy"
+	wsAddressNamespace          = "http://www.w3.org/2005/08/addressing"
+	saml11Namespace             = "urn:oasis:names:tc:SAML:1.0:assertion"
+	xmlDSigNamespace            = "http://www.w3.org/2000/09/xmldsig#"
+	excC14NAlgorithm            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	rsaSHA256Algorithm          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	sha256Algorithm             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	envelopedSignatureTransform = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	claimsNamespace             = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims"
+)
+
+var (
+	// ErrInvalidWSFedRequest is returned for sign-in requests that do not match the app's configuration
+	ErrInvalidWSFedRequest = errors.New("invalid WS-Federation request")
+	// ErrWSFedNotConfigured is returned for apps that are not set up for WS-Federation
+	ErrWSFedNotConfigured = errors.New("application is not configured for WS-Federation")
+)
+
+// WSFedSignInRequest is a passive requestor sign-in request from a relying party
+type WSFedSignInRequest struct {
+	Action  string // wa
+	Realm   string // wtrealm
+	ReplyTo string // wreply, optional
+	Context string // wctx, returned unchanged
+}
+
+// WSFedSubject is the signed-in CloudGate user a token is issued for
+type WSFedSubject struct {
+	UserID string
+	Email  string
+	Name   string
+	AAL    int
+	// NotOnOrAfter, when set, is the latest the token may expire, such as when the app's
+	// session policy ends the session
+	NotOnOrAfter time.Time
+}
+
+// WSFedSignInResponse is posted back to the relying party by the browser
+type WSFedSignInResponse struct {
+	ReplyTo     string    `json:"reply_to"`
+	Result      string    `json:"wresult"`
+	Context     string    `json:"wctx,omitempty"`
+	AssertionID string    `json:"assertion_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// WSFederationService issues signed SAML 1.1 tokens in WS-Trust RSTR envelopes for
+// relying parties configured with the "wsfed" protocol in the app catalog. Each app's
+// Config carries its "realm" (wtrealm) and "reply_url" (the only accepted wreply).
+type WSFederationService struct {
+	issuer      string
+	privateKey  *rsa.PrivateKey
+	certificate *x509.Certificate
+	keys        *SigningKeyService
+	lifetime    time.Duration
+}
+
+// NewWSFederationService creates a WS-Federation token issuer. Tokens are signed with the
+// PEM key and certificate in WSFED_SIGNING_KEY and WSFED_SIGNING_CERT; without them a
+// self-signed certificate is generated at startup, so relying parties must re-import the
+// federation metadata after every restart, which is only suitable for development.
+func NewWSFederationService() *WSFederationService {
+	service := &WSFederationService{
+		issuer:   getEnv("WSFED_ISSUER", getEnv("BACKEND_URL", "http://localhost:8081")+"/wsfed"),
+		lifetime: envDuration("WSFED_TOKEN_LIFETIME", time.Hour),
+	}
+
+	privateKey, certificate, err := loadWSFedSigningKey(getEnv("WSFED_SIGNING_KEY", ""), getEnv("WSFED_SIGNING_CERT", ""))
+	if err != nil {
+		log.Printf("⚠️ %v, generating a temporary WS-Federation signing certificate", err)
+	}
+	if privateKey == nil {
+		privateKey, certificate, err = generateWSFedSigningKey(service.issuer, time.Now())
+		if err != nil {
+			log.Printf("⚠️ Failed to generate WS-Federation signing certificate: %v", err)
+		}
+	}
+	service.privateKey = privateKey
+	service.certificate = certificate
+	return service
+}
+
+func loadWSFedSigningKey(keyPEM, certPEM string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if keyPEM == "" && certPEM == "" {
+		return nil, nil, nil
+	}
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if keyBlock == nil || certBlock == nil {
+		return nil, nil, errors.New("WSFED_SIGNING_KEY and WSFED_SIGNING_CERT must both be PEM encoded")
+	}
+
+	var privateKey *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("WSFED_SIGNING_KEY must be an RSA key")
+		}
+		privateKey = rsaKey
+	} else if rsaKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
+		privateKey = rsaKey
+	} else {
+		return nil, nil, fmt.Errorf("failed to parse WSFED_SIGNING_KEY: %w", err)
+	}
+
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse WSFED_SIGNING_CERT: %w", err)
+	}
+	if !privateKey.PublicKey.Equal(certificate.PublicKey) {
+		return nil, nil, errors.New("WSFED_SIGNING_CERT does not match WSFED_SIGNING_KEY")
+	}
+	return privateKey, certificate, nil
+}
+
+func generateWSFedSigningKey(issuer string, now time.Time) (*rsa.PrivateKey, *x509.Certificate, error) {
+	return generateSigningKeyPair("CloudGate WS-Federation ("+issuer+")", now, 365*24*time.Hour)
+}
+
+// UseSigningKeys signs with the managed signing keys instead of the key loaded at startup
+// and publishes every key relying parties should trust in the federation metadata
+func (s *WSFederationService) UseSigningKeys(keys *SigningKeyService) {
+	s.keys = keys
+}
+
+// signingKey returns the key and certificate tokens are signed with
+func (s *WSFederationService) signingKey() (*rsa.PrivateKey, *x509.Certificate, error) {
+	if s.keys != nil {
+		privateKey, certificate, _, err := s.keys.ActiveKey()
+		return privateKey, certificate, err
+	}
+	if s.privateKey == nil || s.certificate == nil {
+		return nil, nil, errors.New("WS-Federation signing key is not available")
+	}
+	return s.privateKey, s.certificate, nil
+}
+
+// Issuer returns the issuer name relying parties should trust
+func (s *WSFederationService) Issuer() string {
+	return s.issuer
+}
+
+// Certificate returns the base64 DER signing certificate relying parties should trust
+func (s *WSFederationService) Certificate() string {
+	_, certificate, err := s.signingKey()
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(certificate.Raw)
+}
+
+// CheckRequest validates a sign-in request against the app's catalog entry and returns
+// the address the response must be posted to
+func (s *WSFederationService) CheckRequest(app *types.SaaSApplication, req WSFedSignInRequest) (string, error) {
+	if app == nil || app.Protocol != constants.ProtocolWSFed || app.Config["realm"] == "" || app.Config["reply_url"] == "" {
+		return "", ErrWSFedNotConfigured
+	}
+	if req.Action != WSFedActionSignIn {
+		return "", fmt.Errorf("%w: unsupported action %q", ErrInvalidWSFedRequest, req.Action)
+	}
+	if req.Realm != app.Config["realm"] {
+		return "", fmt.Errorf("%w: wtrealm %q is not the realm configured for %s", ErrInvalidWSFedRequest, req.Realm, app.ID)
+	}
+	// Only the registered reply address may receive tokens
+	if req.ReplyTo != "" && req.ReplyTo != app.Config["reply_url"] {
+		return "", fmt.Errorf("%w: wreply %q is not registered for %s", ErrInvalidWSFedRequest, req.ReplyTo, app.ID)
+	}
+	return app.Config["reply_url"], nil
+}
+
+// IssueSignInResponse builds a signed RSTR for the subject, valid for the app's realm only
+func (s *WSFederationService) IssueSignInResponse(app *types.SaaSApplication, req WSFedSignInRequest, subject WSFedSubject, now time.Time) (*WSFedSignInResponse, error) {
+	replyTo, err := s.CheckRequest(app, req)
+	if err != nil {
+		return nil, err
+	}
+	if subject.Email == "" {
+		return nil, fmt.Errorf("%w: the signed-in user has no email address", ErrInvalidWSFedRequest)
+	}
+	privateKey, certificate, err := s.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	expiresAt := now.Add(s.lifetime)
+	if !subject.NotOnOrAfter.IsZero() && subject.NotOnOrAfter.Before(expiresAt) {
+		expiresAt = subject.NotOnOrAfter.UTC()
+	}
+	assertionID := "_" + uuid.New().String()
+	assertion, err := s.signedAssertion(privateKey, certificate, assertionID, app.Config["realm"], subject, now, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	created := formatWSFedTime(now)
+	expires := formatWSFedTime(expiresAt)
+	rstr := `<t:RequestSecurityTokenResponse xmlns:t="` + wsTrustNamespace + `">` +
+		`<t:Lifetime>` +
+		`<wsu:Created xmlns:wsu="` + wsUtilityNamespace + `">` + created + `</wsu:Created>` +
+		`<wsu:Expires xmlns:wsu="` + wsUtilityNamespace + `">` + expires + `</wsu:Expires>` +
+		`</t:Lifetime>` +
+		`<wsp:AppliesTo xmlns:wsp="` + wsPolicyNamespace + `">` +
+		`<wsa:EndpointReference xmlns:wsa="` + wsAddressNamespace + `"><wsa:Address>` + escapeXMLText(app.Config["realm"]) + `</wsa:Address></wsa:EndpointReference>` +
+		`</wsp:AppliesTo>` +
+		`<t:RequestedSecurityToken>` + assertion + `</t:RequestedSecurityToken>` +
+		`<t:TokenType>` + saml11Namespace + `</t:TokenType>` +
+		`<t:RequestType>` + wsTrustNamespace + `/Issue</t:RequestType>` +
+		`<t:KeyType>http://schemas.xmlsoap.org/ws/2005/05/identity/NoProofKey</t:KeyType>` +
+		`</t:RequestSecurityTokenResponse>`
+
+	return &WSFedSignInResponse{
+		ReplyTo:     replyTo,
+		Result:      rstr,
+		Context:     req.Context,
+		AssertionID: assertionID,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// signedAssertion renders a SAML 1.1 assertion with an enveloped XML signature. The
+// assertion is written directly in exclusive canonical form, so the digest is computed
+// over exactly the bytes that are sent.
+func (s *WSFederationService) signedAssertion(privateKey *rsa.PrivateKey, certificate *x509.Certificate, assertionID, realm string, subject WSFedSubject, now, expiresAt time.Time) (string, error) {
+	issued := formatWSFedTime(now)
+	samlSubject := c14nElement("saml:Subject", nil,
+		c14nElement("saml:NameIdentifier", [][2]string{{"Format", "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"}}, escapeXMLText(subject.Email))+
+			c14nElement("saml:SubjectConfirmation", nil,
+				c14nElement("saml:ConfirmationMethod", nil, "urn:oasis:names:tc:SAML:1.0:cm:bearer")))
+
+	attributes := [][2]string{{"emailaddress", subject.Email}, {"upn", subject.Email}}
+	if subject.Name != "" {
+		attributes = append(attributes, [2]string{"name", subject.Name})
+	}
+	var statement strings.Builder
+	statement.WriteString(samlSubject)
+	for _, attribute := range attributes {
+		statement.WriteString(c14nElement("saml:Attribute", [][2]string{{"AttributeName", attribute[0]}, {"AttributeNamespace", claimsNamespace}},
+			c14nElement("saml:AttributeValue", nil, escapeXMLText(attribute[1]))))
+	}
+
+	// Microsoft relying parties recognise the AD FS multi-factor method for step-up sessions
+	authenticationMethod := "urn:oasis:names:tc:SAML:1.0:am:password"
+	if subject.AAL >= 2 {
+		authenticationMethod = "http://schemas.microsoft.com/claims/multipleauthn"
+	}
+
+	body := c14nElement("saml:Conditions", [][2]string{{"NotBefore", issued}, {"NotOnOrAfter", formatWSFedTime(expiresAt)}},
+		c14nElement("saml:AudienceRestrictionCondition", nil,
+			c14nElement("saml:Audience", nil, escapeXMLText(realm)))) +
+		c14nElement("saml:AttributeStatement", nil, statement.String()) +
+		c14nElement("saml:AuthenticationStatement", [][2]string{{"AuthenticationInstant", issued}, {"AuthenticationMethod", authenticationMethod}}, samlSubject)
+
+	assertionAttrs := [][2]string{
+		{"AssertionID", assertionID},
+		{"IssueInstant", issued},
+		{"Issuer", s.issuer},
+		{"MajorVersion", "1"},
+		{"MinorVersion", "1"},
+	}
+	open := `<saml:Assertion xmlns:saml="` + saml11Namespace + `"` + c14nAttributes(assertionAttrs) + `>`
+	closing := `</saml:Assertion>`
+
+	signatureElement, err := envelopedSignature(privateKey, certificate, assertionID, open+body+closing)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+	return open + body + signatureElement + closing, nil
+}
+
+// publishedCertificates lists the certificates relying parties should trust, which during
+// a signing key rotation include the next or previous key
+func (s *WSFederationService) publishedCertificates() []string {
+	if s.keys != nil {
+		certificates, err := s.keys.Certificates()
+		if err != nil {
+			log.Printf("Failed to list signing certificates: %v", err)
+		}
+		return certificates
+	}
+	if certificate := s.Certificate(); certificate != "" {
+		return []string{certificate}
+	}
+	return nil
+}
+
+// signingKeyDescriptors renders a metadata KeyDescriptor for each signing certificate
+func signingKeyDescriptors(certificates []string) string {
+	var descriptors strings.Builder
+	for _, certificate := range certificates {
+		descriptors.WriteString(`<md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="` + xmlDSigNamespace + `"><ds:X509Data><ds:X509Certificate>` +
+			certificate + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`)
+	}
+	return descriptors.String()
+}
+
+// FederationMetadata describes this issuer and its signing certificate for relying parties
+func (s *WSFederationService) FederationMetadata(passiveEndpoint string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:fed="http://docs.oasis-open.org/wsfed/federation/200706" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:wsa="` + wsAddressNamespace + `" entityID="` + escapeXMLAttribute(s.issuer) + `">` +
+		`<md:RoleDescriptor xsi:type="fed:SecurityTokenServiceType" protocolSupportEnumeration="http://docs.oasis-open.org/wsfed/federation/200706">` +
+		signingKeyDescriptors(s.publishedCertificates()) +
+		`<fed:ClaimTypesOffered>` +
+		`<auth:ClaimType xmlns:auth="http://docs.oasis-open.org/wsfed/authorization/200706" Uri="` + claimsNamespace + `/emailaddress"/>` +
+		`<auth:ClaimType xmlns:auth="http://docs.oasis-open.org/wsfed/authorization/200706" Uri="` + claimsNamespace + `/upn"/>` +
+		`<auth:ClaimType xmlns:auth="http://docs.oasis-open.org/wsfed/authorization/200706" Uri="` + claimsNamespace + `/name"/>` +
+		`</fed:ClaimTypesOffered>` +
+		`<fed:PassiveRequestorEndpoint><wsa:EndpointReference><wsa:Address>` + escapeXMLText(passiveEndpoint) + `</wsa:Address></wsa:EndpointReference></fed:PassiveRequestorEndpoint>` +
+		`</md:RoleDescriptor>` +
+		`</md:EntityDescriptor>`
+}
+
+func formatWSFedTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// c14nElement renders an element in exclusive canonical form: attributes sorted (namespace
+// declarations first), values escaped, and empty elements written as start/end pairs.
+// content must already be canonical.
+func c14nElement(name string, attrs [][2]string, content string) string {
+	return "<" + name + c14nAttributes(attrs) + ">" + content + "</" + name + ">"
+}
+
+func c14nAttributes(attrs [][2]string) string {
+	sorted := append([][2]string(nil), attrs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iNS, jNS := strings.HasPrefix(sorted[i][0], "xmlns"), strings.HasPrefix(sorted[j][0], "xmlns")
+		if iNS != jNS {
+			return iNS
+		}
+		return sorted[i][0] < sorted[j][0]
+	})
+	var b strings.Builder
+	for _, attr := range sorted {
+		b.WriteString(" " + attr[0] + `="` + escapeXMLAttribute(attr[1]) + `"`)
+	}
+	return b.String()
+}
+
+var (
+	xmlTextEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	xmlAttributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeXMLText(value string) string {
+	return xmlTextEscaper.Replace(value)
+}
+
+func escapeXMLAttribute(value string) string {
+	return xmlAttributeEscaper.Replace(value)
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	xmlNamespace             = "http://www.w3.org/XML/1998/namespace"
+	rsaSHA512Algorithm       = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	ecdsaSHA256Algorithm     = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	sha512Algorithm          = "http://www.w3.org/2001/04/xmlenc#sha512"
+	maxSignedDocumentBytes   = 1 << 20
+	maxSignedDocumentDepth   = 64
+	maxSignedDocumentElement = 10000
+)
+
+// ErrInvalidXMLSignature is returned when a signed XML document fails verification
+var ErrInvalidXMLSignature = errors.New("invalid XML signature")
+
+// xmlElement is an element of a parsed XML document, keeping namespace prefixes as
+// written so it can be canonicalized the way its signer did
+type xmlElement struct {
+	prefix   string
+	local    string
+	space    string            // resolved namespace URI
+	decls    map[string]string // namespace declarations made here, by prefix ("" for the default)
+	attrs    []xmlAttribute
+	parent   *xmlElement
+	children []xmlNode
+}
+
+type xmlAttribute struct {
+	prefix string
+	local  string
+	space  string
+	value  string
+}
+
+// xmlNode is a child of an element: an element, text, or a processing instruction
+type xmlNode struct {
+	element  *xmlElement
+	text     string
+	procInst *xml.ProcInst
+}
+
+// parseXMLDocument parses a document into elements, refusing DTDs, which signed documents
+// never need and which enable entity expansion attacks
+func parseXMLDocument(data []byte) (*xmlElement, error) {
+	if len(data) > maxSignedDocumentBytes {
+		return nil, fmt.Errorf("document larger than %d bytes", maxSignedDocumentBytes)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *xmlElement
+	depth, elements := 0, 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root != nil && current == nil {
+				return nil, errors.New("more than one root element")
+			}
+			depth++
+			elements++
+			if depth > maxSignedDocumentDepth || elements > maxSignedDocumentElement {
+				return nil, errors.New("document nested too deeply or too large")
+			}
+			element := &xmlElement{prefix: t.Name.Space, local: t.Name.Local, decls: map[string]string{}, parent: current}
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					element.decls[""] = attr.Value
+				case attr.Name.Space == "xmlns":
+					element.decls[attr.Name.Local] = attr.Value
+				default:
+					element.attrs = append(element.attrs, xmlAttribute{prefix: attr.Name.Space, local: attr.Name.Local, value: attr.Value})
+				}
+			}
+			var ok bool
+			if element.space, ok = element.lookup(element.prefix); !ok {
+				return nil, fmt.Errorf("undeclared namespace prefix %q", element.prefix)
+			}
+			for i := range element.attrs {
+				if element.attrs[i].prefix == "" {
+					continue
+				}
+				if element.attrs[i].space, ok = element.lookup(element.attrs[i].prefix); !ok {
+					return nil, fmt.Errorf("undeclared namespace prefix %q", element.attrs[i].prefix)
+				}
+			}
+			if current == nil {
+				root = element
+			} else {
+				current.children = append(current.children, xmlNode{element: element})
+			}
+			current = element
+		case xml.EndElement:
+			if current == nil || t.Name.Space != current.prefix || t.Name.Local != current.local {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			depth--
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, xmlNode{text: string(t)})
+			} else if strings.TrimSpace(string(t)) != "" {
+				return nil, errors.New("text outside the root element")
+			}
+		case xml.ProcInst:
+			if current != nil {
+				inst := t.Copy()
+				current.children = append(current.children, xmlNode{procInst: &inst})
+			}
+		case xml.Directive:
+			return nil, errors.New("DTDs are not allowed")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("incomplete document")
+	}
+	return root, nil
+}
+
+// lookup resolves a namespace prefix in scope at the element
+func (e *xmlElement) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for element := e; element != nil; element = element.parent {
+		if space, ok := element.decls[prefix]; ok {
+			return space, true
+		}
+	}
+	// Without a declaration the default namespace is empty
+	return "", prefix == ""
+}
+
+// attr returns the value of an unqualified attribute
+func (e *xmlElement) attr(name string) string {
+	for _, attr := range e.attrs {
+		if attr.prefix == "" && attr.local == name {
+			return attr.value
+		}
+	}
+	return ""
+}
+
+// childElements returns the child elements with the given namespace and local name
+func (e *xmlElement) childElements(space, local string) []*xmlElement {
+	var matches []*xmlElement
+	for _, child := range e.children {
+		if child.element != nil && child.element.space == space && child.element.local == local {
+			matches = append(matches, child.element)
+		}
+	}
+	return matches
+}
+
+// child returns the only child element with the given name, or nil if there is not exactly one
+func (e *xmlElement) child(space, local string) *xmlElement {
+	matches := e.childElements(space, local)
+	if len(matches) != 1 {
+		return nil
+	}
+	return matches[0]
+}
+
+// text returns the element's character data, without descendant elements
+func (e *xmlElement) text() string {
+	var b strings.Builder
+	for _, child := range e.children {
+		if child.element == nil && child.procInst == nil {
+			b.WriteString(child.text)
+		}
+	}
+	return b.String()
+}
+
+// walk calls visit for the element and each of its descendants, in document order
+func (e *xmlElement) walk(visit func(*xmlElement)) {
+	visit(e)
+	for _, child := range e.children {
+		if child.element != nil {
+			child.element.walk(visit)
+		}
+	}
+}
+
+// canonicalize renders the element in exclusive XML canonical form without comments
+// (xml-exc-c14n#), leaving out the excluded element as the enveloped-signature transform
+// does. inclusive lists prefixes from an InclusiveNamespaces PrefixList.
+func (e *xmlElement) canonicalize(exclude *xmlElement, inclusive []string) []byte {
+	var b bytes.Buffer
+	e.writeCanonical(&b, map[string]string{}, exclude, inclusive)
+	return b.Bytes()
+}
+
+func (e *xmlElement) writeCanonical(b *bytes.Buffer, rendered map[string]string, exclude *xmlElement, inclusive []string) {
+	// Namespaces are rendered where first visibly used, unless an output ancestor already
+	// rendered the same declaration
+	used := []string{e.prefix}
+	for _, attr := range e.attrs {
+		if attr.prefix != "" && attr.prefix != "xml" {
+			used = append(used, attr.prefix)
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, declared := e.lookup(prefix); declared {
+			used = append(used, prefix)
+		}
+	}
+
+	decls := map[string]string{}
+	for _, prefix := range used {
+		space, _ := e.lookup(prefix)
+		previous, ok := rendered[prefix]
+		if prefix == "" && !ok {
+			previous, ok = "", true
+		}
+		if ok && previous == space {
+			continue
+		}
+		decls[prefix] = space
+	}
+	if len(decls) > 0 {
+		scope := make(map[string]string, len(rendered)+len(decls))
+		for prefix, space := range rendered {
+			scope[prefix] = space
+		}
+		for prefix, space := range decls {
+			scope[prefix] = space
+		}
+		rendered = scope
+	}
+
+	name := e.local
+	if e.prefix != "" {
+		name = e.prefix + ":" + e.local
+	}
+	b.WriteString("<" + name)
+	prefixes := make([]string, 0, len(decls))
+	for prefix := range decls {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			b.WriteString(` xmlns="` + escapeXMLAttribute(decls[prefix]) + `"`)
+		} else {
+			b.WriteString(" xmlns:" + prefix + `="` + escapeXMLAttribute(decls[prefix]) + `"`)
+		}
+	}
+	attrs := append([]xmlAttribute(nil), e.attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+	for _, attr := range attrs {
+		b.WriteString(" ")
+		if attr.prefix != "" {
+			b.WriteString(attr.prefix + ":")
+		}
+		b.WriteString(attr.local + `="` + escapeXMLAttribute(attr.value) + `"`)
+	}
+	b.WriteString(">")
+
+	for _, child := range e.children {
+		switch {
+		case child.element != nil:
+			if child.element != exclude {
+				child.element.writeCanonical(b, rendered, exclude, inclusive)
+			}
+		case child.procInst != nil:
+			b.WriteString("<?" + child.procInst.Target)
+			if len(child.procInst.Inst) > 0 {
+				b.WriteString(" " + string(child.procInst.Inst))
+			}
+			b.WriteString("?>")
+		default:
+			b.WriteString(escapeXMLText(child.text))
+		}
+	}
+	b.WriteString("</" + name + ">")
+}
+
+// envelopedSignature signs an element with RSA-SHA256 and returns the Signature to insert
+// into it. canonical is the element, without the Signature, in exclusive canonical form,
+// which is what the enveloped-signature transform digests. SignedInfo is written in
+// canonical form too, so the signature covers exactly the bytes that are sent.
+func envelopedSignature(privateKey *rsa.PrivateKey, certificate *x509.Certificate, referenceID, canonical string) (string, error) {
+	digest := sha256.Sum256([]byte(canonical))
+	signedInfo := c14nElement("ds:SignedInfo", [][2]string{{"xmlns:ds", xmlDSigNamespace}},
+		c14nElement("ds:CanonicalizationMethod", [][2]string{{"Algorithm", excC14NAlgorithm}}, "")+
+			c14nElement("ds:SignatureMethod", [][2]string{{"Algorithm", rsaSHA256Algorithm}}, "")+
+			c14nElement("ds:Reference", [][2]string{{"URI", "#" + referenceID}},
+				c14nElement("ds:Transforms", nil,
+					c14nElement("ds:Transform", [][2]string{{"Algorithm", envelopedSignatureTransform}}, "")+
+						c14nElement("ds:Transform", [][2]string{{"Algorithm", excC14NAlgorithm}}, ""))+
+					c14nElement("ds:DigestMethod", [][2]string{{"Algorithm", sha256Algorithm}}, "")+
+					c14nElement("ds:DigestValue", nil, base64.StdEncoding.EncodeToString(digest[:]))))
+
+	signedInfoHash := sha256.Sum256([]byte(signedInfo))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, signedInfoHash[:])
+	if err != nil {
+		return "", err
+	}
+	return `<ds:Signature xmlns:ds="` + xmlDSigNamespace + `">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(signature) + `</ds:SignatureValue>` +
+		`<ds:KeyInfo><ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(certificate.Raw) + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo>` +
+		`</ds:Signature>`, nil
+}
+
+// verifyEnvelopedSignature checks the Signature that is a direct child of element: its one
+// Reference must point at the element by ID, the digest must match, and the signature
+// must verify with one of the trusted certificates. Only exclusive canonicalization and
+// SHA-256 or stronger are accepted.
+func verifyEnvelopedSignature(element, signature *xmlElement, certificates []*x509.Certificate) error {
+	signedInfo := signature.child(xmlDSigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("%w: SignedInfo is required", ErrInvalidXMLSignature)
+	}
+	canonicalization := signedInfo.child(xmlDSigNamespace, "CanonicalizationMethod")
+	if canonicalization == nil || canonicalization.attr("Algorithm") != excC14NAlgorithm {
+		return fmt.Errorf("%w: SignedInfo must use exclusive canonicalization", ErrInvalidXMLSignature)
+	}
+	method := signedInfo.child(xmlDSigNamespace, "SignatureMethod")
+	if method == nil {
+		return fmt.Errorf("%w: SignatureMethod is required", ErrInvalidXMLSignature)
+	}
+	references := signedInfo.childElements(xmlDSigNamespace, "Reference")
+	if len(references) != 1 {
+		return fmt.Errorf("%w: exactly one Reference is required", ErrInvalidXMLSignature)
+	}
+	reference := references[0]
+	id := element.attr("ID")
+	if id == "" || reference.attr("URI") != "#"+id {
+		return fmt.Errorf("%w: signature does not reference the signed element", ErrInvalidXMLSignature)
+	}
+
+	// Only enveloped-signature and exclusive canonicalization transforms are accepted, so
+	// the digest always covers the whole element
+	var inclusive []string
+	enveloped := false
+	if transforms := reference.child(xmlDSigNamespace, "Transforms"); transforms != nil {
+		for _, transform := range transforms.childElements(xmlDSigNamespace, "Transform") {
+			switch transform.attr("Algorithm") {
+			case envelopedSignatureTransform:
+				enveloped = true
+			case excC14NAlgorithm:
+				inclusive = inclusivePrefixes(transform)
+			default:
+				return fmt.Errorf("%w: unsupported transform %s", ErrInvalidXMLSignature, transform.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped {
+		return fmt.Errorf("%w: enveloped-signature transform is required", ErrInvalidXMLSignature)
+	}
+
+	digestMethod := reference.child(xmlDSigNamespace, "DigestMethod")
+	digestValue := reference.child(xmlDSigNamespace, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return fmt.Errorf("%w: DigestMethod and DigestValue are required", ErrInvalidXMLSignature)
+	}
+	expected, err := decodeXMLBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: DigestValue: %v", ErrInvalidXMLSignature, err)
+	}
+	canonical := element.canonicalize(signature, inclusive)
+	var digest []byte
+	switch digestMethod.attr("Algorithm") {
+	case sha256Algorithm:
+		sum := sha256.Sum256(canonical)
+		digest = sum[:]
+	case sha512Algorithm:
+		sum := sha512.Sum512(canonical)
+		digest = sum[:]
+	default:
+		return fmt.Errorf("%w: unsupported digest %s", ErrInvalidXMLSignature, digestMethod.attr("Algorithm"))
+	}
+	if subtle.ConstantTimeCompare(digest, expected) != 1 {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidXMLSignature)
+	}
+
+	signatureValue := signature.child(xmlDSigNamespace, "SignatureValue")
+	if signatureValue == nil {
+		return fmt.Errorf("%w: SignatureValue is required", ErrInvalidXMLSignature)
+	}
+	signatureBytes, err := decodeXMLBase64(signatureValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: SignatureValue: %v", ErrInvalidXMLSignature, err)
+	}
+	signed := signedInfo.canonicalize(nil, inclusivePrefixes(canonicalization))
+	for _, certificate := range certificates {
+		if verifyXMLSignatureValue(method.attr("Algorithm"), certificate, signed, signatureBytes) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature does not match a trusted certificate", ErrInvalidXMLSignature)
+}
+
+// verifyXMLSignatureValue checks a SignatureValue over canonical SignedInfo
+func verifyXMLSignatureValue(algorithm string, certificate *x509.Certificate, signed, signature []byte) error {
+	var hash crypto.Hash
+	var digest []byte
+	switch algorithm {
+	case rsaSHA256Algorithm, ecdsaSHA256Algorithm:
+		sum := sha256.Sum256(signed)
+		hash, digest = crypto.SHA256, sum[:]
+	case rsaSHA512Algorithm:
+		sum := sha512.Sum512(signed)
+		hash, digest = crypto.SHA512, sum[:]
+	default:
+		return fmt.Errorf("unsupported signature method %s", algorithm)
+	}
+
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm == ecdsaSHA256Algorithm {
+			return errors.New("certificate key does not match the signature method")
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if algorithm != ecdsaSHA256Algorithm {
+			return errors.New("certificate key does not match the signature method")
+		}
+		// XML signatures carry ECDSA as r||s rather than ASN.1
+		if len(signature)%2 != 0 {
+			return errors.New("malformed ECDSA signature")
+		}
+		half := len(signature) / 2
+		der, err := asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:])})
+		if err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(key, digest, der) {
+			return errors.New("ECDSA verification failed")
+		}
+		return nil
+	default:
+		return errors.New("unsupported certificate key")
+	}
+}
+
+// inclusivePrefixes reads the PrefixList of an InclusiveNamespaces child
+func inclusivePrefixes(element *xmlElement) []string {
+	for _, child := range element.children {
+		if child.element != nil && child.element.local == "InclusiveNamespaces" && child.element.space == excC14NAlgorithm {
+			return strings.Fields(child.element.attr("PrefixList"))
+		}
+	}
+	return nil
+}
+
+// decodeXMLBase64 decodes base64 content, which XML documents often wrap across lines
+func decodeXMLBase64(value string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+}
+
+// parseXMLCertificate parses a base64 DER certificate as found in X509Certificate
+// elements, or a PEM certificate
+func parseXMLCertificate(value string) (*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-----BEGIN") {
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "-----BEGIN CERTIFICATE-----"), "-----END CERTIFICATE-----")
+	}
+	der, err := decodeXMLBase64(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate encoding: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	"cloudgate-backend/internal/config"
 	"cloudgate-backend/internal/handlers"
@@ -32,6 +38,19 @@ func main() {
 	}
 	log.Printf("✅ Configuration validated successfully")
 
+	// Export spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := services.InitTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("❌ Failed to initialize tracing:", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
 	// Initialize database with retry logic for Cloud Run
 	log.Printf("🔄 Initializing database connection...")
 	maxRetries := 3
@@ -53,21 +72,19 @@ func main() {
 	}
 	defer services.CloseDatabase()
 
-	// Initialize SaaS applications
-	log.Printf("🔄 Initializing SaaS applications...")
-	services.InitializeSaaSApps()
-	log.Printf("✅ SaaS applications initialized")
+	// OAuth tokens are sealed at rest under the keys in TOKEN_VAULT_KEYS
+	tokenVault, err := services.NewTokenVaultFromEnv()
+	if err != nil {
+		log.Fatal("❌ Failed to load token vault keys:", err)
+	}
+	services.SetTokenVault(tokenVault)
 
-	// Initialize demo user for development (optional for production)
-	if os.Getenv("SKIP_DEMO_USER") != "true" {
-		log.Printf("🔄 Initializing demo user...")
-		userService := services.NewUserService(services.GetDB())
-		_, err := userService.GetOrCreateDemoUser()
-		if err != nil {
-			log.Printf("⚠️ Warning: Failed to create demo user: %v", err)
-		} else {
-			log.Printf("✅ Demo user initialized successfully")
-		}
+	// Load the app catalog and apply pending seed data; demo data is gated by environment
+	log.Printf("🔄 Bootstrapping application data...")
+	if _, err := services.NewBootstrapService(services.GetDB()).Startup(time.Now()); err != nil {
+		log.Printf("⚠️ Warning: Bootstrap incomplete: %v", err)
+	} else {
+		log.Printf("✅ Bootstrap complete")
 	}
 
 	// Set Gin mode for production
@@ -84,24 +101,79 @@ func main() {
 	// Trust proxy headers (Render, etc.) to get correct client IP and scheme
 	_ = router.SetTrustedProxies(nil)
 
-	// Setup middleware
+	// Setup middleware; the request span comes first so it covers everything after it
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
 	router.Use(middleware.SetupCORS(cfg))
 	router.Use(middleware.SecurityHeadersMiddleware())
 	router.Use(handlers.DetailedRequestLogger()) // Add detailed logging
 
-	// Setup routes
-	handlers.SetupRoutes(router, cfg)
+	// Background loops stop, and the services they feed shut down, once the server has drained
+	workers := services.NewWorkers(context.Background())
 
-	// Start session cleanup routine
-	go func() {
-		sessionService := services.NewSessionService(services.GetDB())
-		for {
-			time.Sleep(1 * time.Hour) // Run every hour
+	// Setup routes
+	handlers.SetupRoutes(router, cfg, workers)
+
+	// Start session cleanup routine, leased so only one instance runs it each hour
+	lockService := services.NewLockService(services.GetDB())
+	sessionService := services.NewSessionService(services.GetDB())
+	watchlistService := services.NewWatchlistService(services.GetDB())
+	replayGuard := services.NewReplayGuard(services.GetDB(), nil)
+	oauthStates := services.NewStateStore(services.GetDB())
+	auditService := services.NewAuditService(services.GetDB())
+	impersonationService := services.NewImpersonationService(services.GetDB(), sessionService, auditService)
+	workers.Go(func(ctx context.Context) {
+		lockService.RunPeriodic(ctx, "session_cleanup", time.Hour, func() error {
 			if err := sessionService.CleanupExpiredSessions(); err != nil {
 				log.Printf("Failed to cleanup expired sessions: %v", err)
 			}
+			if _, err := watchlistService.ExpireEntries(); err != nil {
+				log.Printf("Failed to expire watchlist entries: %v", err)
+			}
+			if err := replayGuard.PurgeExpired(time.Now()); err != nil {
+				log.Printf("Failed to purge replay cache: %v", err)
+			}
+			if err := oauthStates.PurgeExpired(time.Now()); err != nil {
+				log.Printf("Failed to purge OAuth states: %v", err)
+			}
+			if _, err := impersonationService.ExpireStale(time.Now()); err != nil {
+				log.Printf("Failed to expire impersonations: %v", err)
+			}
+			return nil
+		})
+	})
+
+	// Roll up completed days of audit events so statistics over past days stay cheap
+	workers.Go(func(ctx context.Context) {
+		lockService.RunPeriodic(ctx, "audit_rollups", time.Hour, func() error {
+			days, err := auditService.RefreshDailyRollups(time.Now())
+			if days > 0 {
+				log.Printf("📊 Rolled up %d day(s) of audit statistics", days)
+			}
+			return err
+		})
+	})
+
+	// Start server - bind to all interfaces for Cloud Run
+	address := "0.0.0.0:" + cfg.Port
+	servers := []*http.Server{{Addr: address, Handler: router}}
+
+	// Optional mutual TLS listener for internal services calling with client certificates
+	if mtlsAddress := os.Getenv("MTLS_LISTEN_ADDR"); mtlsAddress != "" {
+		serviceAccountService := services.NewServiceAccountService(services.GetDB())
+		tlsConfig, err := serviceAccountService.ServerTLSConfig(os.Getenv("MTLS_CERT_FILE"), os.Getenv("MTLS_KEY_FILE"))
+		if err != nil {
+			log.Printf("❌ mTLS listener disabled: %v", err)
+		} else {
+			server := &http.Server{Addr: mtlsAddress, Handler: router, TLSConfig: tlsConfig}
+			servers = append(servers, server)
+			go func() {
+				log.Printf("🔐 mTLS listener on %s", mtlsAddress)
+				if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Printf("❌ mTLS listener stopped: %v", err)
+				}
+			}()
 		}
-	}()
+	}
 
 	// Log startup information
 	log.Printf("🚀 ========================================")
@@ -112,14 +184,38 @@ func main() {
 	log.Printf("🌍 Allowed Origins: %v", cfg.AllowedOrigins)
 	log.Printf("📦 SaaS Applications: %d", len(services.GetAllSaaSApps()))
 	log.Printf("💾 Database: Initialized and migrations completed")
-	log.Printf("🔄 Session cleanup: Running every hour")
+	log.Printf("🔄 Session cleanup: Running every hour (lease holder %s)", lockService.Holder())
 	log.Printf("📝 Logging: Enhanced debugging enabled")
 	log.Printf("🚀 ========================================")
 
-	// Start server - bind to all interfaces for Cloud Run
-	address := "0.0.0.0:" + cfg.Port
+	// Cloud Run sends SIGTERM before scaling an instance down
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
 	log.Printf("🚀 Server starting on %s...", address)
-	if err := router.Run(address); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- servers[0].ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
 		log.Fatal("❌ Failed to start server:", err)
+	case <-signals.Done():
+	}
+	stopSignals()
+
+	// Stop accepting connections and let in-flight requests finish, then stop background
+	// work, all within SHUTDOWN_TIMEOUT
+	log.Printf("🛑 Shutting down, draining for up to %s...", cfg.ShutdownTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(drainCtx); err != nil {
+			log.Printf("⚠️ %s did not drain: %v", server.Addr, err)
+		}
+	}
+	if err := workers.Stop(drainCtx); err != nil {
+		log.Printf("⚠️ Background work did not finish: %v", err)
 	}
+	log.Printf("👋 Shutdown complete")
 }
@@ -187,9 +187,12 @@ const (
 
 // OAuth protocol constants
 const (
-	ProtocolOAuth2 = "oauth2"
-	ProtocolSAML   = "saml"
-	ProtocolOIDC   = "oidc"
+	ProtocolOAuth2      = "oauth2"
+	ProtocolSAML        = "saml"
+	ProtocolOIDC        = "oidc"
+	ProtocolWSFed       = "wsfed"
+	ProtocolHeaderProxy = "header_proxy"
+	ProtocolBookmark    = "bookmark"
 )
 
 // Application categories
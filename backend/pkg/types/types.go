@@ -48,6 +48,16 @@ type APIInfoResponse struct {
 	Endpoints   []string `json:"endpoints"`
 }
 
+// AppSessionPolicy is an app's session rules; zero durations and an empty level list mean no limit
+type AppSessionPolicy struct {
+	MaxSessionMinutes  int   `json:"max_session_minutes,omitempty"`  // age of the CloudGate session
+	IdleTimeoutMinutes int   `json:"idle_timeout_minutes,omitempty"` // time since the session was last used
+	ReauthAfterMinutes int   `json:"reauth_after_minutes,omitempty"` // time since the user last proved their identity
+	AllowedAALs        []int `json:"allowed_aals,omitempty"`         // assurance levels the app accepts
+	// RequireCompliantDevice admits only devices whose reported posture passes the checks
+	RequireCompliantDevice bool `json:"require_compliant_device,omitempty"`
+}
+
 // SaaSApplication represents a SaaS application configuration
 type SaaSApplication struct {
 	ID          string            `json:"id"`
@@ -55,12 +65,17 @@ type SaaSApplication struct {
 	Icon        string            `json:"icon"`
 	Description string            `json:"description"`
 	Category    string            `json:"category"`
-	Protocol    string            `json:"protocol"` // "oauth2", "saml", "oidc"
+	Protocol    string            `json:"protocol"` // "oauth2", "saml", "oidc", "wsfed", "header_proxy", "bookmark"
 	Status      string            `json:"status"`   // "available", "connected", "configured"
 	LaunchURL   string            `json:"launch_url,omitempty"`
+	Domains     []string          `json:"domains,omitempty"`      // sites the app is served from, subdomains included
+	RequiredAAL int               `json:"required_aal,omitempty"` // minimum session assurance level to launch
+	DataAccess  []string          `json:"data_access,omitempty"`  // data categories shown on the consent screen
 	Config      map[string]string `json:"config,omitempty"`
-	CreatedAt   string            `json:"created_at"`
-	UpdatedAt   string            `json:"updated_at"`
+	// SessionPolicy limits the CloudGate sessions the app may be launched from
+	SessionPolicy *AppSessionPolicy `json:"session_policy,omitempty"`
+	CreatedAt     string            `json:"created_at"`
+	UpdatedAt     string            `json:"updated_at"`
 }
 
 // UserAppConnection represents a user's connection to a SaaS app
@@ -83,10 +98,11 @@ type AppLaunchRequest struct {
 
 // AppLaunchResponse represents the response for launching an application
 type AppLaunchResponse struct {
-	LaunchURL string `json:"launch_url"`
-	Method    string `json:"method"` // "redirect", "popup", "iframe"
-	Token     string `json:"token,omitempty"`
-	ExpiresIn int64  `json:"expires_in,omitempty"`
+	LaunchURL   string `json:"launch_url"`
+	Method      string `json:"method"` // "redirect", "popup", "iframe"
+	Token       string `json:"token,omitempty"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	AutofillURL string `json:"autofill_url,omitempty"` // bookmark apps that auto-fill saved credentials
 }
 
 // AppConnectionRequest represents a request to connect to an application
@@ -0,0 +1,60 @@
+package main
+
+// bootstrap applies CloudGate's seed data to the configured database, the same way an
+// instance does on boot.
+//
+//	go run ./scripts/bootstrap            # seed data, demo data as the environment allows
+//	go run ./scripts/bootstrap -demo      # include demo data
+//	go run ./scripts/bootstrap -force     # apply steps again even when already recorded
+//	go run ./scripts/bootstrap -status    # list the applied steps
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"cloudgate-backend/internal/services"
+)
+
+func main() {
+	demo := flag.Bool("demo", false, "seed demo data even where the environment disables it")
+	force := flag.Bool("force", false, "apply steps again even when recorded at their version")
+	status := flag.Bool("status", false, "list the applied bootstrap steps and exit")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	if err := services.InitializeDatabase(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer services.CloseDatabase()
+	bootstrap := services.NewBootstrapService(services.GetDB())
+
+	if *status {
+		records, err := bootstrap.ListRecords()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(records) == 0 {
+			fmt.Println("No bootstrap steps applied")
+		}
+		for _, record := range records {
+			fmt.Printf("%-24s v%d  demo=%t  applied %s\n", record.Step, record.Version, record.Demo, record.AppliedAt.Format(time.RFC3339))
+		}
+		return
+	}
+
+	opts := services.BootstrapOptionsFromEnv()
+	opts.Demo = opts.Demo || *demo
+	opts.Force = *force
+	results, err := bootstrap.Run(opts, time.Now())
+	for _, result := range results {
+		fmt.Printf("%-24s v%d  %s\n", result.Step, result.Version, result.Status)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("✓ Bootstrap complete")
+}
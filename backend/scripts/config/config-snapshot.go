@@ -0,0 +1,145 @@
+package main
+
+// config-snapshot exports and restores CloudGate configuration through the admin API.
+//
+//	CLOUDGATE_URL=https://cloudgate.example.com CLOUDGATE_TOKEN=... go run ./scripts/config export > snapshot.json
+//	go run ./scripts/config restore -dry-run snapshot.json
+//	go run ./scripts/config restore snapshot.json
+//
+// The token must belong to an administrator; restores also need a step-up (AAL2) session.
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type configChange struct {
+	Section string   `json:"section"`
+	Key     string   `json:"key"`
+	Action  string   `json:"action"`
+	Fields  []string `json:"fields"`
+	Note    string   `json:"note"`
+}
+
+type restoreResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Changes []configChange `json:"changes"`
+	Applied int            `json:"applied"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	baseURL := strings.TrimRight(getEnv("CLOUDGATE_URL", "http://localhost:8081"), "/")
+	token := os.Getenv("CLOUDGATE_TOKEN")
+	if token == "" {
+		log.Fatal("CLOUDGATE_TOKEN is required")
+	}
+
+	switch os.Args[1] {
+	case "export":
+		body, err := call(http.MethodGet, baseURL+"/admin/config/export", token, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(body)
+		fmt.Println()
+	case "restore":
+		flags := flag.NewFlagSet("restore", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only report the changes a restore would make")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			usage()
+		}
+
+		snapshot, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to read snapshot: %v", err)
+		}
+		url := baseURL + "/admin/config/restore"
+		if *dryRun {
+			url += "?dry_run=true"
+		}
+		body, err := call(http.MethodPost, url, token, snapshot)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var result restoreResult
+		if err := json.Unmarshal(body, &result); err != nil {
+			log.Fatalf("Failed to read restore result: %v", err)
+		}
+		printResult(result)
+	default:
+		usage()
+	}
+}
+
+func printResult(result restoreResult) {
+	if len(result.Changes) == 0 {
+		fmt.Println("✓ Configuration already matches the snapshot")
+		return
+	}
+	for _, change := range result.Changes {
+		line := fmt.Sprintf("%-8s %s/%s", change.Action, change.Section, change.Key)
+		if len(change.Fields) > 0 {
+			line += " (" + strings.Join(change.Fields, ", ") + ")"
+		}
+		if change.Note != "" {
+			line += " - " + change.Note
+		}
+		fmt.Println(line)
+	}
+	if result.DryRun {
+		fmt.Printf("Dry run: %d change(s), nothing applied\n", len(result.Changes))
+		return
+	}
+	fmt.Printf("✓ Applied %d of %d change(s)\n", result.Applied, len(result.Changes))
+}
+
+func call(method, url, token string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: config-snapshot export | restore [-dry-run] <snapshot.json>")
+	os.Exit(2)
+}
@@ -0,0 +1,17 @@
+#!/bin/bash
+
+# Regenerates the gRPC bindings in internal/grpcapi from proto/
+# Requires protoc, protoc-gen-go and protoc-gen-go-grpc on PATH:
+#   go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.36.6
+#   go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+
+set -e
+
+cd "$(dirname "$0")/.."
+
+protoc -I proto \
+  --go_out=. --go_opt=module=cloudgate-backend \
+  --go-grpc_out=. --go-grpc_opt=module=cloudgate-backend \
+  proto/cloudgate/events/v1/*.proto
+
+echo "✅ Generated gRPC bindings"
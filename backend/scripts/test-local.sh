@@ -6,7 +6,7 @@ echo "🧪 Testing CloudGate Backend in Cloud Run simulation mode"
 # Set Cloud Run environment variables
 export PORT=8080
 export GIN_MODE=release
-export SKIP_DEMO_USER=true
+export BOOTSTRAP_DEMO_DATA=false
 export RUN_MIGRATIONS=false
 
 # Test database connection (use SQLite for quick testing)
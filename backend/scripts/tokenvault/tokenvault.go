@@ -0,0 +1,48 @@
+package main
+
+// tokenvault rewraps the OAuth tokens of every app connection under the active key in
+// TOKEN_VAULT_KEYS, encrypting tokens stored before encryption at rest.
+//
+//	go run ./scripts/tokenvault rotate
+//
+// To rotate, put a new key first in TOKEN_VAULT_KEYS, keeping the old one after it, deploy,
+// run the rotation, and remove the old key once no connection failed.
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"cloudgate-backend/internal/services"
+)
+
+func main() {
+	if len(os.Args) != 2 || os.Args[1] != "rotate" {
+		fmt.Fprintln(os.Stderr, "usage: tokenvault rotate")
+		os.Exit(2)
+	}
+
+	_ = godotenv.Load()
+	vault, err := services.NewTokenVaultFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load token vault keys:", err)
+	}
+	if err := services.InitializeDatabase(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer services.CloseDatabase()
+
+	result, err := vault.RotateKeys(services.GetDB())
+	if result != nil {
+		fmt.Printf("Active key %s: %d connection(s) scanned, %d rotated, %d failed\n", result.ActiveKey, result.Scanned, result.Rotated, result.Failed)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if result.Failed > 0 {
+		log.Fatal("Some connections were not rotated; keep their keys in TOKEN_VAULT_KEYS and run again")
+	}
+	fmt.Println("✓ Token rotation complete")
+}
@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// dialAlertStream opens the alert stream with the given token and browser origin
+func dialAlertStream(t *testing.T, serverURL, token, origin string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/ws/security/alerts", header)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func TestAlertStream_Route(t *testing.T) {
+	server := setupTestRouter(t)
+	_, analystToken := createTestUser(t, models.RoleSecurityAnalyst)
+
+	t.Run("should refuse users without a security role", func(t *testing.T) {
+		_, userToken := createTestUser(t)
+		_, resp, err := dialAlertStream(t, server.URL, userToken, testOrigin)
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should refuse origins that are not allowed", func(t *testing.T) {
+		_, resp, err := dialAlertStream(t, server.URL, analystToken, "https://evil.example.com")
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("should push alerts as JSON", func(t *testing.T) {
+		conn, _, err := dialAlertStream(t, server.URL, analystToken, testOrigin)
+		require.NoError(t, err)
+
+		// Presenting a canary key raises a critical alert
+		_, key, err := services.NewCanaryKeyService(services.DB, nil).Create("Stream test", "ci secrets", nil)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/health", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for {
+			var message struct {
+				Type  string                 `json:"type"`
+				Alert services.SecurityAlert `json:"alert"`
+			}
+			require.NoError(t, conn.ReadJSON(&message))
+			assert.Equal(t, "alert", message.Type)
+			if message.Alert.Type != services.AlertTypeCanaryKeyUsed {
+				continue
+			}
+			assert.Equal(t, services.SeverityCritical, message.Alert.Severity)
+			assert.Equal(t, "Canary API key used", message.Alert.Title)
+			return
+		}
+	})
+}
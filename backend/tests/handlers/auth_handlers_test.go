@@ -0,0 +1,45 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestLoginHandler_LockedAccountLooksLikeWrongPassword(t *testing.T) {
+	server := setupTestRouter(t)
+	userID, _ := createTestUser(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	require.NoError(t, err)
+	lockedAt := time.Now()
+	require.NoError(t, services.DB.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"password_hash": string(hash), "locked_at": lockedAt}).Error)
+	var user models.User
+	require.NoError(t, services.DB.First(&user, "id = ?", userID).Error)
+
+	login := func(password string) (int, map[string]interface{}) {
+		body, err := json.Marshal(map[string]string{"email": user.Email, "password": password})
+		require.NoError(t, err)
+		resp, err := http.Post(server.URL+"/auth/login", "application/json", strings.NewReader(string(body)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&payload))
+		return resp.StatusCode, payload
+	}
+
+	wrongStatus, wrongBody := login("wrong password")
+	rightStatus, rightBody := login("correct horse battery")
+	assert.Equal(t, http.StatusUnauthorized, wrongStatus)
+	assert.Equal(t, wrongStatus, rightStatus, "the correct password must not reveal the lock")
+	assert.Equal(t, wrongBody, rightBody)
+}
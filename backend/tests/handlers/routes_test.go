@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+)
+
+func TestRoutes_LicenseAndAnalyticsRoles(t *testing.T) {
+	server := setupTestRouter(t)
+	_, userToken := createTestUser(t)
+	_, analystToken := createTestUser(t, models.RoleSecurityAnalyst)
+	_, adminToken := createTestUser(t, models.RoleAdmin)
+
+	routes := []struct {
+		method   string
+		path     string
+		body     string
+		readOnly bool
+	}{
+		{http.MethodGet, "/api/v1/analytics/apps", "", true},
+		{http.MethodGet, "/api/v1/analytics/apps/daily", "", true},
+		{http.MethodGet, "/api/v1/analytics/sso", "", true},
+		{http.MethodGet, "/api/v1/licenses/report", "", true},
+		{http.MethodPut, "/api/v1/licenses/slack", `{"total_seats":10}`, false},
+		{http.MethodPost, "/api/v1/licenses/sync", "", false},
+	}
+
+	request := func(method, path, body, token string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			assert.Equal(t, http.StatusForbidden, request(route.method, route.path, route.body, userToken), "users without a role are refused")
+			if route.readOnly {
+				assert.Equal(t, http.StatusOK, request(route.method, route.path, route.body, analystToken), "analysts may read")
+				assert.Equal(t, http.StatusOK, request(route.method, route.path, route.body, adminToken))
+				return
+			}
+			assert.Equal(t, http.StatusForbidden, request(route.method, route.path, route.body, analystToken), "only admins make changes")
+			assert.NotEqual(t, http.StatusForbidden, request(route.method, route.path, route.body, adminToken))
+		})
+	}
+}
+
+func TestRoutes_BlockedDuringImpersonation(t *testing.T) {
+	server := setupTestRouter(t)
+	adminID, _ := createTestUser(t, models.RoleAdmin)
+	targetID, targetToken := createTestUser(t, models.RoleAdmin)
+	impersonationToken := createImpersonationToken(t, adminID, targetID)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/oauth2/authorize?client_id=unknown&response_type=code"},
+		{http.MethodPost, "/oauth2/authorize"},
+		{http.MethodGet, "/proxy/wiki/"},
+		{http.MethodPost, "/proxy/wiki/pages"},
+		{http.MethodPut, "/admin/apps/wiki/proxy"},
+		{http.MethodPut, "/admin/apps/wiki/proxy/assignments/" + adminID.String()},
+	}
+
+	request := func(method, path, token string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var payload struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&payload)
+		return resp.StatusCode, payload.Error
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			status, code := request(route.method, route.path, impersonationToken)
+			assert.Equal(t, http.StatusForbidden, status)
+			assert.Equal(t, "impersonation_restricted", code)
+			status, _ = request(route.method, route.path, targetToken)
+			assert.NotEqual(t, http.StatusForbidden, status, "the user themselves may use the route")
+		})
+	}
+}
+
+func TestRoutes_AdminWritesRequireAAL2(t *testing.T) {
+	server := setupTestRouter(t)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPut, "/admin/apps/wiki/proxy"},
+		{http.MethodDelete, "/admin/apps/wiki/proxy"},
+		{http.MethodPut, "/admin/apps/wiki/proxy/assignments/" + uuid.NewString()},
+		{http.MethodDelete, "/admin/apps/wiki/proxy/assignments/" + uuid.NewString()},
+		{http.MethodPost, "/admin/apps/bookmarks"},
+		{http.MethodPut, "/admin/apps/bookmarks/payroll"},
+		{http.MethodDelete, "/admin/apps/bookmarks/payroll"},
+		{http.MethodPut, "/admin/apps/payroll/schedule"},
+		{http.MethodDelete, "/admin/apps/payroll/schedule"},
+		{http.MethodPost, "/admin/access-overrides/" + uuid.NewString() + "/approve"},
+		{http.MethodPost, "/admin/access-overrides/" + uuid.NewString() + "/deny"},
+	}
+
+	request := func(method, path, token string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var payload struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&payload)
+		return resp.StatusCode, payload.Error
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			_, passwordOnly := createTestUserWithAAL(t, models.AAL1, models.RoleAdmin)
+			_, stepped := createTestUser(t, models.RoleAdmin)
+			status, code := request(route.method, route.path, passwordOnly)
+			assert.Equal(t, http.StatusForbidden, status)
+			assert.Equal(t, "step_up_required", code)
+			status, _ = request(route.method, route.path, stepped)
+			assert.NotEqual(t, http.StatusForbidden, status, "admins who stepped up may make changes")
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/handlers"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+const (
+	// testJWTSecret signs the access tokens minted for route tests
+	testJWTSecret = "route-test-secret"
+	// testOrigin is the only browser origin the test router allows
+	testOrigin = "https://console.example.com"
+)
+
+// setupTestRouter serves the application's real routes over a migrated SQLite database, so
+// tests exercise the middleware each route is registered with
+func setupTestRouter(t *testing.T) *httptest.Server {
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DB_NAME", filepath.Join(t.TempDir(), "cloudgate.db"))
+	t.Setenv("RUN_MIGRATIONS", "true")
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	t.Setenv("ALLOWED_ORIGINS", testOrigin)
+	require.NoError(t, services.InitializeDatabase(), "Failed to initialize test database")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	workers := services.NewWorkers(context.Background())
+	handlers.SetupRoutes(router, config.LoadConfig(), workers)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		workers.Stop(ctx)
+	})
+	return server
+}
+
+// createTestUser stores an active user holding the given roles and returns a bearer token for them
+func createTestUser(t *testing.T, roles ...string) (uuid.UUID, string) {
+	return createTestUserWithAAL(t, models.AAL2, roles...)
+}
+
+// createTestUserWithAAL is createTestUser for a token at the given assurance level
+func createTestUserWithAAL(t *testing.T, aal int, roles ...string) (uuid.UUID, string) {
+	user := models.User{
+		Email:    uuid.NewString() + "@example.com",
+		Username: uuid.NewString(),
+		IsActive: true,
+	}
+	require.NoError(t, services.DB.Create(&user).Error)
+	for _, role := range roles {
+		require.NoError(t, services.DB.Create(&models.RoleAssignment{UserID: user.ID, Role: role}).Error)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      user.ID.String(),
+		"username": user.Username,
+		"email":    user.Email,
+		"aal":      aal,
+		"exp":      time.Now().Add(15 * time.Minute).Unix(),
+	}).SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	return user.ID, token
+}
+
+// createImpersonationToken starts an impersonation of the target by the admin and returns
+// the access token the admin acts with
+func createImpersonationToken(t *testing.T, adminID, targetID uuid.UUID) string {
+	sessionID := uuid.New()
+	now := time.Now()
+	expiresAt := now.Add(15 * time.Minute)
+	require.NoError(t, services.DB.Create(&models.Impersonation{
+		AdminID:         adminID,
+		TargetUserID:    targetID,
+		Reason:          "Route test",
+		Status:          models.ImpersonationActive,
+		DurationSeconds: int64((15 * time.Minute).Seconds()),
+		RequestExpires:  expiresAt,
+		SessionID:       &sessionID,
+		StartedAt:       &now,
+		ExpiresAt:       &expiresAt,
+	}).Error)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": targetID.String(),
+		"sid": sessionID.String(),
+		"aal": models.AAL2,
+		"act": map[string]interface{}{"sub": adminID.String()},
+		"exp": expiresAt.Unix(),
+	}).SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	return token
+}
@@ -0,0 +1,52 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestWebhookConsumers_VerifySignatureRoute(t *testing.T) {
+	// The route group limit applies by default
+	t.Setenv("ENABLE_RATE_LIMITING", "true")
+	t.Setenv("RATE_LIMIT_ROUTES", "")
+	t.Setenv("WEBHOOK_SIGNING_KEY_OVERLAP", "1ms")
+	server := setupTestRouter(t)
+
+	signing := services.NewWebhookSigningService(services.DB)
+	consumer, first, _, err := signing.CreateConsumer(services.WebhookConsumerInput{Name: "SIEM", URL: "https://siem.example.com/hook"}, nil, time.Now())
+	require.NoError(t, err)
+	_, _, err = signing.RotateKey(consumer.ID, nil, time.Now())
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	verify := func() int {
+		resp, err := http.Post(server.URL+"/webhooks/consumers/"+consumer.ID.String()+"/verify", "application/json", strings.NewReader(`{"event":"test"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("should not change keys while verifying", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, verify())
+		var key models.WebhookSigningKey
+		require.NoError(t, services.DB.Where("key_id = ?", first.KeyID).First(&key).Error)
+		assert.Equal(t, models.WebhookKeyRetiring, key.Status, "retiring is left to the scheduled job")
+		assert.Nil(t, key.RetiredAt)
+	})
+
+	t.Run("should limit each client", func(t *testing.T) {
+		limited := false
+		for i := 0; i < 20 && !limited; i++ {
+			limited = verify() == http.StatusTooManyRequests
+		}
+		assert.True(t, limited)
+	})
+}
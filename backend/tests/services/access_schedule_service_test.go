@@ -0,0 +1,130 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestAccessScheduleService sets up an access schedule service with an in-memory database
+func setupTestAccessScheduleService(t *testing.T) (*services.AccessScheduleService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.AppAccessSchedule{}, &models.AccessOverrideRequest{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewAccessScheduleService(db), db
+}
+
+func TestAccessScheduleService_CheckAccess(t *testing.T) {
+	service, _ := setupTestAccessScheduleService(t)
+	admin := uuid.New()
+	user := uuid.New()
+
+	_, err := service.SetSchedule("salesforce", services.AccessScheduleInput{
+		Timezone:         "UTC",
+		StartTime:        "06:00",
+		EndTime:          "20:00",
+		Days:             []string{"mon", "tue", "wed", "thu", "fri"},
+		AllowedCountries: []string{"us", "CA"},
+		Enabled:          true,
+	}, &admin)
+	require.NoError(t, err)
+
+	// Wednesday 2024-01-10
+	wednesdayNoon := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		country string
+		at      time.Time
+		allowed bool
+	}{
+		{"inside window from allowed country", "US", wednesdayNoon, true},
+		{"disallowed country", "FR", wednesdayNoon, false},
+		{"unknown country", "", wednesdayNoon, false},
+		{"after hours", "CA", time.Date(2024, 1, 10, 21, 0, 0, 0, time.UTC), false},
+		{"weekend", "US", time.Date(2024, 1, 13, 12, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := service.CheckAccess(user, "salesforce", tt.country, tt.at)
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, result.Allowed, result.Reason)
+		})
+	}
+
+	t.Run("should allow apps without a schedule", func(t *testing.T) {
+		result, err := service.CheckAccess(user, "slack", "", wednesdayNoon)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	})
+
+	t.Run("should handle overnight windows", func(t *testing.T) {
+		_, err := service.SetSchedule("jira", services.AccessScheduleInput{Timezone: "UTC", StartTime: "22:00", EndTime: "06:00", Enabled: true}, &admin)
+		require.NoError(t, err)
+
+		result, err := service.CheckAccess(user, "jira", "", time.Date(2024, 1, 10, 23, 30, 0, 0, time.UTC))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		result, err = service.CheckAccess(user, "jira", "", wednesdayNoon)
+		require.NoError(t, err)
+		assert.False(t, result.Allowed)
+	})
+
+	t.Run("should reject malformed schedules", func(t *testing.T) {
+		_, err := service.SetSchedule("slack", services.AccessScheduleInput{Timezone: "Mars/Olympus"}, &admin)
+		assert.ErrorIs(t, err, services.ErrInvalidSchedule)
+		_, err = service.SetSchedule("slack", services.AccessScheduleInput{StartTime: "6am", EndTime: "20:00"}, &admin)
+		assert.ErrorIs(t, err, services.ErrInvalidSchedule)
+	})
+}
+
+func TestAccessScheduleService_Overrides(t *testing.T) {
+	service, db := setupTestAccessScheduleService(t)
+	admin := uuid.New()
+	user := uuid.New()
+
+	_, err := service.SetSchedule("salesforce", services.AccessScheduleInput{AllowedCountries: []string{"US"}, Enabled: true}, &admin)
+	require.NoError(t, err)
+
+	request, err := service.RequestOverride(user, "salesforce", "Travelling for quarter close", 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, models.OverrideStatusPending, request.Status)
+
+	// Pending requests do not grant access
+	result, err := service.CheckAccess(user, "salesforce", "DE", time.Now())
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	approved, err := service.ReviewOverride(request.ID, true, &admin, "Approved by finance lead")
+	require.NoError(t, err)
+	assert.True(t, approved.IsActive())
+
+	_, err = service.ReviewOverride(request.ID, false, &admin, "")
+	assert.ErrorIs(t, err, services.ErrOverrideAlreadyReviewed)
+
+	result, err = service.CheckAccess(user, "salesforce", "DE", time.Now())
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	require.NotNil(t, result.OverrideID)
+	assert.Equal(t, request.ID, *result.OverrideID)
+
+	// Other users are still held to the schedule
+	result, err = service.CheckAccess(uuid.New(), "salesforce", "DE", time.Now())
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	var used int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "access_override_used").Count(&used)
+	assert.Equal(t, int64(1), used)
+}
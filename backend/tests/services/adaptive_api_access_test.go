@@ -0,0 +1,77 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestAdaptiveAuthService sets up an adaptive auth service with a session to score requests against
+func setupTestAdaptiveAuthService(t *testing.T) (*services.AdaptiveAuthService, uuid.UUID, uuid.UUID) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AuditLog{}, &models.SecurityEvent{},
+		&models.WatchlistEntry{}, &services.RiskAssessment{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	userID := uuid.New()
+	session := models.Session{
+		UserID:       userID,
+		SessionToken: "session-token",
+		IPAddress:    "203.0.113.10",
+		UserAgent:    "Mozilla/5.0",
+		IsActive:     true,
+	}
+	require.NoError(t, db.Create(&session).Error)
+
+	return services.NewAdaptiveAuthService(db), userID, session.ID
+}
+
+func TestAdaptiveAuthService_EvaluateRequestAccess(t *testing.T) {
+	service, userID, sessionID := setupTestAdaptiveAuthService(t)
+	critical := services.RoutePolicyFor(services.RouteSensitivityCritical)
+
+	t.Run("should allow a request matching its session", func(t *testing.T) {
+		decision := service.EvaluateRequestAccess(context.Background(), &services.RequestRiskContext{
+			UserID: userID, SessionID: &sessionID, IPAddress: "203.0.113.10", UserAgent: "Mozilla/5.0", AAL: models.AAL1,
+		}, critical)
+		assert.Equal(t, services.AuthDecisionAllow, decision.Decision)
+		assert.Equal(t, 0.0, decision.RiskScore)
+	})
+
+	t.Run("should require step-up when the session has drifted", func(t *testing.T) {
+		ctx := &services.RequestRiskContext{
+			UserID: userID, SessionID: &sessionID, IPAddress: "198.51.100.20", UserAgent: "Mozilla/5.0 (X11)", AAL: models.AAL1,
+		}
+		decision := service.EvaluateRequestAccess(context.Background(), ctx, critical)
+		assert.Equal(t, services.AuthDecisionChallenge, decision.Decision)
+		assert.Equal(t, models.AAL3, decision.RequiredAAL)
+		assert.InDelta(t, 0.5, decision.RiskScore, 0.0001)
+
+		// The same drift is tolerated on a less sensitive route
+		medium := service.EvaluateRequestAccess(context.Background(), ctx, services.RoutePolicyFor(services.RouteSensitivityMedium))
+		assert.Equal(t, services.AuthDecisionAllow, medium.Decision)
+
+		// And once the session has stepped up
+		ctx.AAL = models.AAL3
+		stepped := service.EvaluateRequestAccess(context.Background(), ctx, critical)
+		assert.Equal(t, services.AuthDecisionAllow, stepped.Decision)
+	})
+
+	t.Run("should deny when risk exceeds the route's ceiling", func(t *testing.T) {
+		decision := service.EvaluateRequestAccess(context.Background(), &services.RequestRiskContext{
+			UserID: userID, SessionID: &sessionID, IPAddress: "198.51.100.20", UserAgent: "curl/8.0", AAL: models.AAL3,
+		}, critical)
+		assert.Equal(t, services.AuthDecisionDeny, decision.Decision)
+		assert.NotEmpty(t, decision.Reasons)
+	})
+}
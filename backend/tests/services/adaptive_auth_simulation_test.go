@@ -0,0 +1,169 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func triggeredRules(simulation *services.AuthSimulation) []string {
+	var rules []string
+	for _, rule := range simulation.TriggeredRules {
+		rules = append(rules, rule.Rule)
+	}
+	return rules
+}
+
+func TestAdaptiveAuthService_SimulateAuthentication(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.SecurityEvent{}, &models.WatchlistEntry{},
+		&services.RiskAssessment{}, &services.DeviceFingerprint{}))
+	originalDB := services.DB
+	services.DB = db
+	t.Cleanup(func() { services.DB = originalDB })
+
+	// GeoIP would place every address in Germany; simulations keep the location they are given
+	services.SetGeoIPService(&countingGeoIP{locations: map[string]*services.GeoLocation{
+		"203.0.113.9": {Country: "DE", City: "Frankfurt am Main"},
+	}})
+	t.Cleanup(func() { services.SetGeoIPService(nil) })
+
+	userID := uuid.New()
+	require.NoError(t, services.RegisterDeviceFingerprint(userID.String(), "laptop", "Work laptop", "desktop", "Firefox", "Linux"))
+	service := services.NewAdaptiveAuthService(db)
+
+	usual, err := service.SimulateAuthentication(context.Background(), &services.AuthContext{
+		UserID:            userID,
+		IPAddress:         "203.0.113.9",
+		UserAgent:         "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+		DeviceFingerprint: "laptop",
+		LoginTime:         time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "DE", usual.Context.Location.Country, "located with GeoIP when no location is given")
+	assert.NotContains(t, triggeredRules(usual), "new_device")
+	assert.NotContains(t, triggeredRules(usual), "unusual_hours")
+
+	risky, err := service.SimulateAuthentication(context.Background(), &services.AuthContext{
+		UserID:            userID,
+		IPAddress:         "203.0.113.9",
+		UserAgent:         "curl/8.5.0",
+		DeviceFingerprint: "unknown-phone",
+		Location:          &services.GeoLocation{Country: "KP", City: "Pyongyang", VPNDetected: true},
+		LoginTime:         time.Date(2026, 10, 14, 3, 30, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "KP", risky.Context.Location.Country)
+	rules := triggeredRules(risky)
+	for _, rule := range []string{"vpn_or_proxy", "new_country", "high_risk_country", "new_device", "unusual_hours"} {
+		assert.Contains(t, rules, rule)
+	}
+	assert.Greater(t, risky.Decision.RiskScore, usual.Decision.RiskScore)
+	assert.InDelta(t, 0.9, risky.RiskFactors.LocationRisk, 0.001)
+	for _, rule := range risky.TriggeredRules {
+		if rule.Rule == "unusual_hours" {
+			assert.Equal(t, "temporal", rule.Factor)
+			assert.Equal(t, "Sign-in at 03:30", rule.Description)
+		}
+	}
+
+	// Nothing is recorded for a simulated login
+	var assessments, events int64
+	db.Model(&services.RiskAssessment{}).Count(&assessments)
+	db.Model(&models.SecurityEvent{}).Count(&events)
+	assert.Zero(t, assessments)
+	assert.Zero(t, events)
+}
+
+func TestAdaptiveAuthService_EvaluateAuthenticationStoresAssessment(t *testing.T) {
+	db, service, userID := setupAdaptiveAuthBenchmark(t)
+
+	decision, err := service.EvaluateAuthentication(context.Background(), &services.AuthContext{
+		UserID:            userID,
+		IPAddress:         "203.0.113.9",
+		UserAgent:         "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+		DeviceFingerprint: "laptop",
+		LoginTime:         time.Now(),
+	})
+	require.NoError(t, err)
+
+	var stored services.RiskAssessment
+	require.NoError(t, db.Where("user_id = ?", userID).First(&stored).Error)
+	assert.Equal(t, decision.RiskScore, stored.RiskScore)
+	assert.Equal(t, "laptop", stored.DeviceFingerprint)
+	require.NotNil(t, stored.Location)
+	assert.Equal(t, "DE", stored.Location.Country)
+	assert.Equal(t, decision.Reasoning, stored.Recommendations)
+}
+
+// setupAdaptiveAuthBenchmark creates an adaptive auth service with a known user and device,
+// located by an in-memory GeoIP so nothing leaves the process
+func setupAdaptiveAuthBenchmark(tb testing.TB) (*gorm.DB, *services.AdaptiveAuthService, uuid.UUID) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(tb, err, "Failed to connect to test database")
+	require.NoError(tb, db.AutoMigrate(&models.User{}, &models.SecurityEvent{}, &models.WatchlistEntry{}, &models.IdPRiskSignal{},
+		&services.RiskAssessment{}, &services.DeviceFingerprint{}))
+	originalDB := services.DB
+	services.DB = db
+	tb.Cleanup(func() { services.DB = originalDB })
+	services.SetGeoIPService(&countingGeoIP{locations: map[string]*services.GeoLocation{
+		"203.0.113.9": {Country: "DE", City: "Frankfurt am Main"},
+	}})
+	tb.Cleanup(func() { services.SetGeoIPService(nil) })
+
+	userID := uuid.New()
+	require.NoError(tb, services.RegisterDeviceFingerprint(userID.String(), "laptop", "Work laptop", "desktop", "Firefox", "Linux"))
+	return db, services.NewAdaptiveAuthService(db), userID
+}
+
+// Benchmark tests
+func BenchmarkAdaptiveAuthService_EvaluateAuthentication(b *testing.B) {
+	_, service, userID := setupAdaptiveAuthBenchmark(b)
+	loginTime := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := service.EvaluateAuthentication(context.Background(), &services.AuthContext{
+			UserID:            userID,
+			IPAddress:         "203.0.113.9",
+			UserAgent:         "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+			DeviceFingerprint: "laptop",
+			LoginTime:         loginTime,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAdaptiveAuthService_SimulateAuthentication(b *testing.B) {
+	_, service, userID := setupAdaptiveAuthBenchmark(b)
+	loginTime := time.Date(2026, 10, 14, 3, 30, 0, 0, time.UTC)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := service.SimulateAuthentication(context.Background(), &services.AuthContext{
+			UserID:            userID,
+			IPAddress:         "203.0.113.9",
+			UserAgent:         "curl/8.5.0",
+			DeviceFingerprint: "unknown-phone",
+			Location:          &services.GeoLocation{Country: "KP", City: "Pyongyang", VPNDetected: true},
+			LoginTime:         loginTime,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
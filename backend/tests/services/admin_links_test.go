@@ -0,0 +1,82 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+)
+
+func linkURLs(links []services.AdminConsoleLink) map[string]string {
+	urls := make(map[string]string)
+	for _, link := range links {
+		urls[link.Provider+"/"+link.Kind] = link.URL
+	}
+	return urls
+}
+
+func TestAdminLinkService_LinksConnectedProviders(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.AppConnection{}), "Failed to migrate database schema")
+
+	alice := models.User{Email: "alice+ops@corp.example", Username: "alice"}
+	bob := models.User{Email: "bob@corp.example", Username: "bob"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+
+	registry := services.NewOAuthProviderRegistry()
+	registry.Register(services.NewOAuthProvider(services.OAuthProviderConfig{
+		Name: "acme", AppID: "acme-suite",
+		TokenExtras: map[string]string{"instance_url": "instance_url"},
+		AdminLinks:  map[string]string{services.AdminLinkUser: "{instance_url}/users?q={email}"},
+	}, nil))
+
+	for _, connection := range []models.AppConnection{
+		{UserID: bob.ID, AppID: "google-workspace", Status: constants.StatusConnected},
+		{UserID: alice.ID, AppID: "github", Status: constants.StatusConnected, Extras: `{"username":"alice-gh"}`},
+		{UserID: bob.ID, AppID: "salesforce", Status: constants.StatusConnected, UserEmail: "bob@sf.example",
+			Extras: `{"instance_url":"https://corp.my.salesforce.com/","username":"bob@sf.example"}`},
+		{UserID: bob.ID, AppID: "slack", Status: "revoked", Extras: `{"team_id":"T123"}`},
+		{UserID: bob.ID, AppID: "acme-suite", Status: constants.StatusConnected, Extras: `{"instance_url":"javascript:alert(1)"}`},
+	} {
+		require.NoError(t, db.Create(&connection).Error)
+	}
+
+	service := services.NewAdminLinkService(db, registry)
+
+	links, err := service.ForUser(alice.ID)
+	require.NoError(t, err)
+	urls := linkURLs(links)
+	assert.Equal(t, "https://admin.google.com/ac/search?query=alice%2Bops%40corp.example", urls["google/user"],
+		"the user's email is escaped into the query")
+	assert.Equal(t, "https://corp.my.salesforce.com/lightning/setup/ManageUsers/home", urls["salesforce/user"],
+		"the organization's instance comes from another user's connection")
+	assert.Contains(t, urls, "salesforce/audit_log")
+	assert.NotContains(t, urls, "github/user", "there is no organization without a repository")
+	assert.NotContains(t, urls, "slack/user", "revoked connections are not linked")
+	assert.NotContains(t, urls, "acme/user", "only https links are returned")
+
+	alert := services.SecurityAlert{UserID: &alice.ID, Metadata: map[string]interface{}{"repository": "corp/api"}}
+	links, err = service.ForAlert(alert)
+	require.NoError(t, err)
+	urls = linkURLs(links)
+	assert.Equal(t, "https://github.com/orgs/corp/people?query=alice-gh", urls["github/user"],
+		"the user's own connection supplies their GitHub login")
+	assert.Equal(t, "https://github.com/corp/api/settings", urls["github/repository"])
+	assert.Equal(t, "https://github.com/organizations/corp/settings/audit-log", urls["github/audit_log"])
+
+	links, err = service.ForAlert(services.SecurityAlert{Metadata: map[string]interface{}{"category": "authentication"}})
+	require.NoError(t, err)
+	assert.Empty(t, links, "alerts about no user or repository get no links")
+
+	_, err = service.ForUser(uuid.New())
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+}
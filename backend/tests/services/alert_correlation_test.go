@@ -0,0 +1,96 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/services"
+)
+
+func newTestAlert(alertType services.AlertType, severity services.AlertSeverity, userID uuid.UUID, ip string, at time.Time) services.SecurityAlert {
+	return services.SecurityAlert{
+		ID:        uuid.New(),
+		Type:      alertType,
+		Severity:  severity,
+		Title:     string(alertType),
+		UserID:    &userID,
+		IPAddress: ip,
+		Timestamp: at,
+	}
+}
+
+func TestAlertCorrelator_SameUserSameIP(t *testing.T) {
+	manager := services.NewIncidentManager()
+	correlator := services.NewAlertCorrelator(manager, []services.CorrelationRule{{
+		Name:      "same_user_same_ip",
+		Keys:      []services.CorrelationKey{services.CorrelationKeyUser, services.CorrelationKeyIP},
+		Window:    15 * time.Minute,
+		MinAlerts: 2,
+	}})
+
+	userID := uuid.New()
+	start := time.Now()
+
+	t.Run("should open an incident once the threshold is reached", func(t *testing.T) {
+		opened := correlator.Correlate(newTestAlert(services.AlertTypeNewDeviceAccess, services.SeverityMedium, userID, "203.0.113.5", start))
+		assert.Empty(t, opened)
+
+		opened = correlator.Correlate(newTestAlert(services.AlertTypeLoginAnomaly, services.SeverityHigh, userID, "203.0.113.5", start.Add(time.Minute)))
+		require.Len(t, opened, 1)
+		assert.Len(t, opened[0].Alerts, 2)
+		assert.Equal(t, services.SeverityHigh, opened[0].Severity)
+	})
+
+	t.Run("should attach later alerts in the window to the same incident", func(t *testing.T) {
+		opened := correlator.Correlate(newTestAlert(services.AlertTypeSuspiciousLocation, services.SeverityCritical, userID, "203.0.113.5", start.Add(2*time.Minute)))
+		assert.Empty(t, opened)
+
+		incidents, err := manager.GetIncidents(services.IncidentFilters{})
+		require.NoError(t, err)
+		require.Len(t, incidents, 1)
+		assert.Len(t, incidents[0].Alerts, 3)
+		assert.Equal(t, services.SeverityCritical, incidents[0].Severity)
+	})
+
+	t.Run("should not group alerts from a different IP", func(t *testing.T) {
+		opened := correlator.Correlate(newTestAlert(services.AlertTypeLoginAnomaly, services.SeverityHigh, userID, "198.51.100.7", start.Add(3*time.Minute)))
+		assert.Empty(t, opened)
+	})
+
+	t.Run("should start a new incident after a quiet window", func(t *testing.T) {
+		later := start.Add(time.Hour)
+		correlator.Correlate(newTestAlert(services.AlertTypeLoginAnomaly, services.SeverityLow, userID, "203.0.113.5", later))
+		opened := correlator.Correlate(newTestAlert(services.AlertTypeLoginAnomaly, services.SeverityLow, userID, "203.0.113.5", later.Add(time.Minute)))
+		require.Len(t, opened, 1)
+		assert.Len(t, opened[0].Alerts, 2)
+	})
+}
+
+func TestAlertCorrelator_AttackPatternAcrossUsers(t *testing.T) {
+	manager := services.NewIncidentManager()
+	correlator := services.NewAlertCorrelator(manager, []services.CorrelationRule{{
+		Name:             "attack_pattern_across_users",
+		Keys:             []services.CorrelationKey{services.CorrelationKeyAlertType},
+		Window:           10 * time.Minute,
+		MinAlerts:        3,
+		MinDistinctUsers: 3,
+	}})
+
+	start := time.Now()
+	repeat := uuid.New()
+
+	// Three alerts for the same user do not make a cross-user pattern
+	for i := 0; i < 3; i++ {
+		opened := correlator.Correlate(newTestAlert(services.AlertTypeBruteForceAttack, services.SeverityHigh, repeat, "192.0.2.1", start.Add(time.Duration(i)*time.Second)))
+		assert.Empty(t, opened)
+	}
+
+	correlator.Correlate(newTestAlert(services.AlertTypeBruteForceAttack, services.SeverityHigh, uuid.New(), "192.0.2.2", start.Add(5*time.Second)))
+	opened := correlator.Correlate(newTestAlert(services.AlertTypeBruteForceAttack, services.SeverityHigh, uuid.New(), "192.0.2.3", start.Add(6*time.Second)))
+	require.Len(t, opened, 1)
+	assert.Len(t, opened[0].Alerts, 5)
+}
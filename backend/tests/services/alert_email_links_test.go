@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func alertEmailLinkFromURL(t *testing.T, alert *services.SecurityAlert, raw string) services.AlertEmailLink {
+	parsed, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "/alerts/"+alert.ID.String()+"/email-action", parsed.Path)
+	query := parsed.Query()
+	return services.AlertEmailLink{
+		AlertID:   alert.ID,
+		Action:    query.Get("action"),
+		Recipient: query.Get("recipient"),
+		Expires:   query.Get("expires"),
+		Signature: query.Get("signature"),
+	}
+}
+
+func TestAlertEmailLinks_AcknowledgeAndEscalate(t *testing.T) {
+	t.Setenv("BACKEND_URL", "https://cloudgate.example")
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AlertLinkClick{}, &models.AuditLog{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&models.AlertLinkClick{}, &models.AuditLog{}) })
+	originalDB := services.DB
+	services.DB = db
+	t.Cleanup(func() { services.DB = originalDB })
+
+	alice := models.User{Email: "alice@corp.example", Username: "alice", IsActive: true}
+	require.NoError(t, db.Create(&alice).Error)
+
+	alert, err := monitoring.GenerateAlert(services.AlertTypeBruteForceAttack, services.SeverityMedium, "Brute force", "Brute force", map[string]interface{}{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := monitoring.GetAlert(alert.ID)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	links := services.NewAlertEmailLinks(db, monitoring)
+	now := time.Now()
+	urls := links.URLs(alert.ID, "Alice@corp.example", now)
+	require.True(t, strings.HasPrefix(urls[services.AlertEmailAcknowledge], "https://cloudgate.example/alerts/"))
+	acknowledge := alertEmailLinkFromURL(t, alert, urls[services.AlertEmailAcknowledge])
+	escalate := alertEmailLinkFromURL(t, alert, urls[services.AlertEmailEscalate])
+
+	// Links cannot be retargeted or used after they expire
+	tampered := acknowledge
+	tampered.Recipient = "mallory@evil.example"
+	assert.ErrorIs(t, links.Verify(tampered, now), services.ErrInvalidAlertLink)
+	tampered = acknowledge
+	tampered.Action = services.AlertEmailEscalate
+	assert.ErrorIs(t, links.Verify(tampered, now), services.ErrInvalidAlertLink)
+	assert.ErrorIs(t, links.Verify(acknowledge, now.Add(25*time.Hour)), services.ErrInvalidAlertLink)
+
+	stored, err := links.Apply(context.Background(), acknowledge, "203.0.113.7", "Mail/1.0", now)
+	require.NoError(t, err)
+	assert.Equal(t, services.StatusInProgress, stored.Status)
+	stored, err = monitoring.GetAlert(alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.StatusInProgress, stored.Status)
+	assert.Equal(t, alice.ID, *stored.AssignedTo, "the recipient's analyst takes the alert")
+
+	_, err = links.Apply(context.Background(), acknowledge, "203.0.113.7", "Mail/1.0", now)
+	assert.ErrorIs(t, err, services.ErrAlertLinkUsed)
+
+	stored, err = links.Apply(context.Background(), escalate, "198.51.100.2", "Phone/2.0", now)
+	require.NoError(t, err)
+	assert.Equal(t, services.SeverityHigh, stored.Severity)
+	stored, err = monitoring.GetAlert(alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.SeverityHigh, stored.Severity)
+	assert.Contains(t, stored.Tags, "escalated")
+
+	var clicks []models.AlertLinkClick
+	require.NoError(t, db.Order("ip_address").Find(&clicks, "alert_id = ?", alert.ID).Error)
+	require.Len(t, clicks, 2)
+	assert.Equal(t, "198.51.100.2", clicks[0].IPAddress)
+	assert.Equal(t, services.AlertEmailEscalate, clicks[0].Action)
+	assert.Equal(t, "203.0.113.7", clicks[1].IPAddress)
+	assert.Equal(t, "Mail/1.0", clicks[1].UserAgent)
+	assert.Equal(t, alice.ID, *clicks[1].UserID)
+
+	var audits int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("resource = ? AND resource_id = ?", "security_alert", alert.ID.String()).Count(&audits).Error)
+	assert.Equal(t, int64(2), audits)
+
+	// Resolved alerts cannot be acknowledged, and the refused link stays usable
+	require.NoError(t, monitoring.UpdateAlertStatus(alert.ID, services.StatusResolved, nil))
+	other := alertEmailLinkFromURL(t, alert, links.URLs(alert.ID, "bob@corp.example", now)[services.AlertEmailAcknowledge])
+	_, err = links.Apply(context.Background(), other, "192.0.2.1", "", now)
+	assert.ErrorIs(t, err, services.ErrAlertClosed)
+	var count int64
+	require.NoError(t, db.Model(&models.AlertLinkClick{}).Where("recipient = ?", "bob@corp.example").Count(&count).Error)
+	assert.Zero(t, count)
+}
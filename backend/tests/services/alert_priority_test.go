@@ -0,0 +1,108 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestSecurityMonitoringService sets up a monitoring service on a database its
+// background alert processor can share
+func setupTestSecurityMonitoringService(t *testing.T) (*services.SecurityMonitoringService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open("file:alertqueue?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.WatchlistEntry{}, &models.SecurityAlertRecord{}, &models.Playbook{}, &models.PlaybookExecution{}, &services.RiskAssessment{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	service := services.NewSecurityMonitoringService(db)
+	t.Cleanup(func() {
+		service.Shutdown(context.Background())
+		db.Migrator().DropTable(&models.User{}, &models.WatchlistEntry{}, &models.SecurityAlertRecord{}, &models.Playbook{}, &models.PlaybookExecution{}, &services.RiskAssessment{})
+	})
+	return service, db
+}
+
+func TestSecurityMonitoringService_AlertQueue(t *testing.T) {
+	service, db := setupTestSecurityMonitoringService(t)
+	riskyUser := uuid.New()
+	watchedUser := uuid.New()
+	require.NoError(t, db.Create(&services.RiskAssessment{UserID: riskyUser, RiskScore: 0.9, RiskLevel: "high"}).Error)
+	require.NoError(t, db.Create(&models.WatchlistEntry{UserID: watchedUser, Reason: "Departing employee", ThresholdFactor: 0.5, ExpiresAt: time.Now().Add(time.Hour)}).Error)
+
+	lowRisky, err := service.GenerateAlert(services.AlertTypeNewDeviceAccess, services.SeverityLow, "New device", "New device",
+		map[string]interface{}{"user_id": riskyUser.String()})
+	require.NoError(t, err)
+	adminAbuse, err := service.GenerateAlert(services.AlertTypeAPIAbuse, services.SeverityHigh, "API abuse", "API abuse",
+		map[string]interface{}{"endpoint": "/admin/emergency/signout"})
+	require.NoError(t, err)
+	critical, err := service.GenerateAlert(services.AlertTypeDataExfiltration, services.SeverityCritical, "Exfiltration", "Exfiltration",
+		map[string]interface{}{})
+	require.NoError(t, err)
+	watched, err := service.GenerateAlert(services.AlertTypeLoginAnomaly, services.SeverityMedium, "Login anomaly", "Login anomaly",
+		map[string]interface{}{"user_id": watchedUser.String()})
+	require.NoError(t, err)
+
+	// Severity, asset sensitivity and user risk all feed the score
+	assert.InDelta(t, 23.5, lowRisky.Priority.Score, 0.01)
+	assert.InDelta(t, 50.0, adminAbuse.Priority.Score, 0.01)
+	assert.InDelta(t, 42.0, critical.Priority.Score, 0.01)
+	assert.InDelta(t, 44.0, watched.Priority.Score, 0.01, "watchlisted users are escalated and carry a risk floor")
+
+	require.Eventually(t, func() bool {
+		_, total, err := service.GetAlertQueue(50, 0)
+		return err == nil && total == 4
+	}, 2*time.Second, 10*time.Millisecond)
+
+	queue, _, err := service.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	order := make([]uuid.UUID, 0, len(queue))
+	for _, alert := range queue {
+		order = append(order, alert.ID)
+	}
+	assert.Equal(t, []uuid.UUID{adminAbuse.ID, watched.ID, critical.ID, lowRisky.ID}, order)
+	assert.InDelta(t, 1.0, queue[0].Priority.AssetSensitivity, 0.001)
+
+	// Working an alert keeps it queued; closing it removes it
+	analyst := uuid.New()
+	require.NoError(t, service.UpdateAlertStatus(adminAbuse.ID, services.StatusInProgress, &analyst))
+	_, total, err := service.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+
+	require.NoError(t, service.UpdateAlertStatus(adminAbuse.ID, services.StatusResolved, nil))
+	queue, total, err = service.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, watched.ID, queue[0].ID)
+
+	err = service.UpdateAlertStatus(uuid.New(), services.StatusResolved, nil)
+	assert.ErrorIs(t, err, services.ErrAlertNotFound)
+	err = service.UpdateAlertStatus(watched.ID, "closed", nil)
+	assert.ErrorIs(t, err, services.ErrInvalidAlertStatus)
+
+	// Reopening a resolved alert clears its resolution and puts it back in the queue
+	resolved, err := service.GetAlert(adminAbuse.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.StatusResolved, resolved.Status)
+	assert.Equal(t, analyst, *resolved.AssignedTo)
+	require.NotNil(t, resolved.ResolvedAt)
+	require.NoError(t, service.UpdateAlertStatus(adminAbuse.ID, services.StatusOpen, nil))
+	reopened, err := service.GetAlert(adminAbuse.ID)
+	require.NoError(t, err)
+	assert.Nil(t, reopened.ResolvedAt)
+	_, total, err = service.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	_, err = service.GetAlert(uuid.New())
+	assert.ErrorIs(t, err, services.ErrAlertNotFound)
+}
@@ -0,0 +1,81 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestAnalyticsService sets up an analytics service backed by an in-memory database
+func setupTestAnalyticsService(t *testing.T) (*services.AnalyticsService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AppLaunchEvent{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	services.InitializeSaaSApps()
+	return services.NewAnalyticsService(db), db
+}
+
+func TestAnalyticsService_GetAppUsage(t *testing.T) {
+	service, _ := setupTestAnalyticsService(t)
+	alice, bob := uuid.New(), uuid.New()
+
+	require.NoError(t, service.RecordAppLaunch(alice, "slack", "10.0.0.1", "Browser"))
+	require.NoError(t, service.RecordAppLaunch(alice, "slack", "10.0.0.1", "Browser"))
+	require.NoError(t, service.RecordAppLaunch(bob, "slack", "10.0.0.2", "Browser"))
+	require.NoError(t, service.RecordAppLaunch(bob, "github", "10.0.0.2", "Browser"))
+
+	end := time.Now().Add(time.Minute)
+	usage, err := service.GetAppUsage(end.Add(-24*time.Hour), end)
+	require.NoError(t, err)
+
+	t.Run("should rank apps by launches", func(t *testing.T) {
+		require.GreaterOrEqual(t, len(usage), 2)
+		assert.Equal(t, "slack", usage[0].AppID)
+		assert.Equal(t, int64(3), usage[0].Launches)
+		assert.Equal(t, int64(2), usage[0].UniqueUsers)
+		assert.NotNil(t, usage[0].LastLaunchedAt)
+		assert.Equal(t, "github", usage[1].AppID)
+	})
+
+	t.Run("should include catalog apps without launches", func(t *testing.T) {
+		var dropbox *services.AppUsageSummary
+		for i := range usage {
+			if usage[i].AppID == "dropbox" {
+				dropbox = &usage[i]
+			}
+		}
+		require.NotNil(t, dropbox)
+		assert.Equal(t, int64(0), dropbox.Launches)
+		assert.Equal(t, "Dropbox", dropbox.AppName)
+	})
+}
+
+func TestAnalyticsService_GetDailyAppUsage(t *testing.T) {
+	service, db := setupTestAnalyticsService(t)
+	user := uuid.New()
+
+	yesterday := time.Now().UTC().Add(-24 * time.Hour)
+	require.NoError(t, db.Create(&models.AppLaunchEvent{UserID: user, AppID: "jira", LaunchedAt: yesterday}).Error)
+	require.NoError(t, service.RecordAppLaunch(user, "jira", "10.0.0.1", "Browser"))
+	require.NoError(t, service.RecordAppLaunch(user, "jira", "10.0.0.1", "Browser"))
+
+	end := time.Now().Add(time.Minute)
+	daily, err := service.GetDailyAppUsage("jira", end.Add(-7*24*time.Hour), end)
+	require.NoError(t, err)
+	require.Len(t, daily, 2)
+	assert.Equal(t, yesterday.Format("2006-01-02"), daily[0].Date)
+	assert.Equal(t, int64(1), daily[0].Count)
+	assert.Equal(t, int64(2), daily[1].Count)
+	assert.Equal(t, 1, daily[1].ActiveUsers)
+}
@@ -0,0 +1,102 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/types"
+)
+
+func TestAppSessionPolicyService_CheckSession(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}, &models.AuditLog{}, &models.AppSessionPolicy{}))
+
+	services.RegisterSaaSApp(&types.SaaSApplication{ID: "payroll", Name: "Payroll"})
+	t.Cleanup(func() { services.RemoveSaaSApp("payroll") })
+	service := services.NewAppSessionPolicyService(db)
+	admin := uuid.New()
+
+	_, err = service.SetPolicy("payroll", services.AppSessionPolicyInput{AllowedAALs: []int{7}}, &admin)
+	assert.ErrorIs(t, err, services.ErrInvalidSessionPolicy)
+	_, err = service.SetPolicy("payroll", services.AppSessionPolicyInput{
+		MaxSessionMinutes:  480,
+		IdleTimeoutMinutes: 30,
+		ReauthAfterMinutes: 60,
+		AllowedAALs:        []int{3, 2, 2},
+	}, &admin)
+	require.NoError(t, err)
+
+	app, _ := services.GetSaaSApp("payroll")
+	require.NotNil(t, app.SessionPolicy, "the policy is kept in the catalog")
+	assert.Equal(t, []int{2, 3}, app.SessionPolicy.AllowedAALs)
+	services.RegisterSaaSApp(&types.SaaSApplication{ID: "payroll", Name: "Payroll"})
+	app, _ = services.GetSaaSApp("payroll")
+	require.NotNil(t, app.SessionPolicy, "re-registering an app keeps its policy")
+
+	sessions := services.NewSessionServiceForTesting(db)
+	user := models.User{ID: uuid.New(), Email: "payroll@example.com", Username: "payroll"}
+	require.NoError(t, db.Create(&user).Error)
+	session, err := sessions.CreateSession(user.ID, "203.0.113.9", "Mozilla/5.0")
+	require.NoError(t, err)
+	now := time.Now()
+
+	result, err := service.CheckSession(app, &session.ID, models.AAL1, now)
+	require.NoError(t, err)
+	assert.Equal(t, services.AppSessionStepUpRequired, result.Error)
+	assert.Equal(t, models.AAL2, result.RequiredAAL)
+
+	result, err = service.CheckSession(app, &session.ID, models.AAL2, now)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.WithinDuration(t, now.Add(30*time.Minute), result.NotOnOrAfter, time.Second, "tokens end with the idle timeout")
+
+	result, err = service.CheckSession(app, nil, models.AAL2, now)
+	require.NoError(t, err)
+	assert.Equal(t, services.AppSessionReauthRequired, result.Error, "tokens without a session cannot be checked")
+
+	// An hour after signing in an active user still has to confirm it's them, which a step-up does
+	db.Model(&models.Session{}).Where("id = ?", session.ID).UpdateColumn("updated_at", now.Add(60*time.Minute))
+	result, err = service.CheckSession(app, &session.ID, models.AAL2, now.Add(61*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, services.AppSessionReauthRequired, result.Error)
+	assert.Contains(t, result.Reason, "every 60 minutes")
+
+	db.Model(&models.Session{}).Where("id = ?", session.ID).UpdateColumns(map[string]interface{}{
+		"created_at": now.Add(-2 * time.Hour), "updated_at": now.Add(-45 * time.Minute),
+	})
+	result, err = service.CheckSession(app, &session.ID, models.AAL2, now)
+	require.NoError(t, err)
+	assert.Equal(t, services.AppSessionReauthRequired, result.Error)
+	assert.Contains(t, result.Reason, "idle")
+
+	_, err = sessions.ElevateSessionAAL(session.ID, models.AAL2)
+	require.NoError(t, err)
+	result, err = service.CheckSession(app, &session.ID, models.AAL2, time.Now())
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "stepping up counts as activity and re-authentication")
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), result.NotOnOrAfter, time.Second)
+
+	// Sessions older than the app allows have to sign in again
+	db.Model(&models.Session{}).Where("id = ?", session.ID).UpdateColumn("created_at", now.Add(-9*time.Hour))
+	result, err = service.CheckSession(app, &session.ID, models.AAL2, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, services.AppSessionReauthRequired, result.Error)
+	assert.Contains(t, result.Reason, "at most 480 minutes")
+
+	require.NoError(t, service.DeletePolicy("payroll", &admin))
+	app, _ = services.GetSaaSApp("payroll")
+	assert.Nil(t, app.SessionPolicy)
+	result, err = service.CheckSession(app, nil, models.AAL1, now)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.ErrorIs(t, service.DeletePolicy("payroll", &admin), services.ErrSessionPolicyNotFound)
+}
@@ -0,0 +1,160 @@
+package services_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestAuditExportService sets up an audit export service with an in-memory database
+func setupTestAuditExportService(t *testing.T) (*services.AuditExportService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.AuditExport{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewAuditExportService(db), db
+}
+
+func TestAuditExportService_CreateExport(t *testing.T) {
+	service, db := setupTestAuditExportService(t)
+	exporter := uuid.New()
+	subject := uuid.New()
+	now := time.Now()
+
+	for _, entry := range []models.AuditLog{
+		{ID: uuid.New(), UserID: &subject, Action: "login", Status: "success", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: uuid.New(), UserID: &subject, Action: "mfa_disabled", Status: "success", CreatedAt: now.Add(-time.Hour)},
+		{ID: uuid.New(), Action: "login", Status: "success", CreatedAt: now.Add(-time.Hour)},
+		{ID: uuid.New(), UserID: &subject, Action: "login", Status: "success", CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		require.NoError(t, db.Create(&entry).Error)
+	}
+
+	export, err := service.CreateExport(services.AuditExportFilters{
+		StartTime: now.Add(-24 * time.Hour),
+		EndTime:   now,
+		UserID:    &subject,
+	}, services.AuditExportExporter{UserID: &exporter, Email: "auditor@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, export.RecordCount)
+
+	// The stored content hashes to the value in the manifest
+	hash := sha256.Sum256([]byte(export.Content))
+	assert.Equal(t, hex.EncodeToString(hash[:]), export.ContentSHA256)
+
+	var manifest services.AuditExportManifest
+	require.NoError(t, json.Unmarshal([]byte(export.Manifest), &manifest))
+	assert.Equal(t, export.ID, manifest.ExportID)
+	assert.Equal(t, export.ContentSHA256, manifest.ContentSHA256)
+	assert.Equal(t, "auditor@example.com", manifest.Exporter.Email)
+	assert.Equal(t, &subject, manifest.Filters.UserID)
+
+	// Recipients can verify offline with just the public key
+	publicKey, keyID := service.PublicKey()
+	assert.Equal(t, keyID, export.KeyID)
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	require.NoError(t, err)
+	signature, err := base64.StdEncoding.DecodeString(export.Signature)
+	require.NoError(t, err)
+	assert.True(t, ed25519.Verify(ed25519.PublicKey(key), []byte(export.Manifest), signature))
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "audit_export_created").Count(&audits)
+	assert.Equal(t, int64(1), audits)
+
+	_, err = service.CreateExport(services.AuditExportFilters{StartTime: now, EndTime: now.Add(-time.Hour)}, services.AuditExportExporter{})
+	assert.ErrorIs(t, err, services.ErrInvalidAuditExport)
+}
+
+func TestAuditExportService_VerifyManifest(t *testing.T) {
+	service, _ := setupTestAuditExportService(t)
+	now := time.Now()
+
+	export, err := service.CreateExport(services.AuditExportFilters{StartTime: now.Add(-time.Hour), EndTime: now}, services.AuditExportExporter{})
+	require.NoError(t, err)
+
+	result, err := service.VerifyManifest([]byte(export.Manifest), export.Signature, strings.ToUpper(export.ContentSHA256))
+	require.NoError(t, err)
+	assert.True(t, result.SignatureValid)
+	assert.True(t, result.ContentChecked)
+	assert.True(t, result.ContentMatches)
+
+	// A tampered manifest no longer matches its signature
+	tampered := strings.Replace(export.Manifest, `"record_count":0`, `"record_count":5`, 1)
+	require.NotEqual(t, export.Manifest, tampered)
+	result, err = service.VerifyManifest([]byte(tampered), export.Signature, "")
+	require.NoError(t, err)
+	assert.False(t, result.SignatureValid)
+	assert.False(t, result.ContentChecked)
+
+	// Altered content does not match the manifest
+	result, err = service.VerifyManifest([]byte(export.Manifest), export.Signature, strings.Repeat("0", 64))
+	require.NoError(t, err)
+	assert.True(t, result.SignatureValid)
+	assert.False(t, result.ContentMatches)
+
+	_, err = service.VerifyManifest([]byte(export.Manifest), "not base64!", "")
+	assert.ErrorIs(t, err, services.ErrInvalidAuditExport)
+}
+
+func TestAuditExportService_StreamLogs(t *testing.T) {
+	service, db := setupTestAuditExportService(t)
+	now := time.Now()
+
+	// More rows than the sqlite driver fetches per batch, across two actions
+	for i := 0; i < 1200; i++ {
+		action := "login"
+		if i%3 == 0 {
+			action = "logout"
+		}
+		entry := models.AuditLog{ID: uuid.New(), Action: action, Status: "success", CreatedAt: now.Add(-time.Duration(1200-i) * time.Second)}
+		require.NoError(t, db.Create(&entry).Error)
+	}
+	filters := services.AuditExportFilters{StartTime: now.Add(-time.Hour), EndTime: now, Action: "login"}
+
+	var streamed int
+	var last time.Time
+	err := service.StreamLogs(context.Background(), filters, func(auditLog *models.AuditLog) error {
+		assert.Equal(t, "login", auditLog.Action)
+		assert.False(t, auditLog.CreatedAt.Before(last), "records stream oldest first")
+		last = auditLog.CreatedAt
+		streamed++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 800, streamed)
+
+	// An error from the callback stops the stream
+	errStop := errors.New("client went away")
+	streamed = 0
+	err = service.StreamLogs(context.Background(), filters, func(*models.AuditLog) error {
+		streamed++
+		if streamed == 10 {
+			return errStop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 10, streamed)
+
+	err = service.StreamLogs(context.Background(), services.AuditExportFilters{StartTime: now, EndTime: now.Add(-time.Hour)}, func(*models.AuditLog) error { return nil })
+	assert.ErrorIs(t, err, services.ErrInvalidAuditExport)
+}
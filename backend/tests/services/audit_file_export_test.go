@@ -0,0 +1,186 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestAuditExportService_ExportFile(t *testing.T) {
+	service, db := setupTestAuditExportService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditFileExport{}, &models.AuditExportSchedule{}))
+	dir := t.TempDir()
+	service.UseObjectStore(services.NewLocalObjectStore(dir, "http://localhost:8081/files"))
+
+	exporter := uuid.New()
+	subject := uuid.New()
+	now := time.Now()
+	for _, entry := range []models.AuditLog{
+		{ID: uuid.New(), UserID: &subject, Action: "login", Status: "success", UserAgent: "=HYPERLINK(\"http://evil\")", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: uuid.New(), UserID: &subject, Action: "mfa_disabled", Status: "success", CreatedAt: now.Add(-time.Hour)},
+		{ID: uuid.New(), Action: "login", Status: "failure", CreatedAt: now.Add(-time.Hour)},
+		{ID: uuid.New(), UserID: &subject, Action: "login", Status: "success", CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		require.NoError(t, db.Create(&entry).Error)
+	}
+
+	_, err := service.ExportFile(context.Background(), services.AuditExportFilters{StartTime: now.Add(-time.Hour), EndTime: now}, "xlsx", &exporter)
+	assert.ErrorIs(t, err, services.ErrInvalidAuditExport)
+
+	export, err := service.ExportFile(context.Background(), services.AuditExportFilters{
+		StartTime: now.Add(-24 * time.Hour),
+		EndTime:   now,
+		UserID:    &subject,
+	}, models.AuditFileExportCSV, &exporter)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuditFileExportCompleted, export.Status)
+	assert.Equal(t, int64(2), export.RecordCount)
+
+	content, err := os.ReadFile(filepath.Join(dir, export.ObjectKey))
+	require.NoError(t, err)
+	hash := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(hash[:]), export.ContentSHA256)
+	assert.Equal(t, int64(len(content)), export.SizeBytes)
+	rows, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, "action", rows[0][3])
+	assert.Equal(t, "login", rows[1][3])
+	assert.Equal(t, "'=HYPERLINK(\"http://evil\")", rows[1][8], "formulas are not evaluated when the export is opened")
+
+	stored, err := service.GetFileExport(export.ID)
+	require.NoError(t, err)
+	assert.Equal(t, export.ContentSHA256, stored.ContentSHA256)
+	downloadURL, _, err := service.FileExportURL(export.ID, now)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(downloadURL, "http://localhost:8081/files/"+export.ObjectKey+"?"))
+
+	var audits []models.AuditLog
+	require.NoError(t, db.Where("action = ?", string(services.EventTypeDataExport)).Find(&audits).Error)
+	require.Len(t, audits, 1)
+	assert.Equal(t, &exporter, audits[0].UserID)
+	assert.Equal(t, export.ID.String(), audits[0].ResourceID)
+	assert.Contains(t, audits[0].Details, export.ContentSHA256)
+
+	// JSON Lines exports hold one audit log per line
+	export, err = service.ExportFile(context.Background(), services.AuditExportFilters{StartTime: now.Add(-24 * time.Hour), EndTime: now, Action: "login"}, models.AuditFileExportJSONL, &exporter)
+	require.NoError(t, err)
+	file, err := os.Open(filepath.Join(dir, export.ObjectKey))
+	require.NoError(t, err)
+	defer file.Close()
+	var lines int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry models.AuditLog
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		assert.Equal(t, "login", entry.Action)
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestAuditExportService_RunDueExports(t *testing.T) {
+	service, db := setupTestAuditExportService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditFileExport{}, &models.AuditExportSchedule{}))
+	dir := t.TempDir()
+	service.UseObjectStore(services.NewLocalObjectStore(dir, "http://localhost:8081/files"))
+	owner := uuid.New()
+
+	_, err := service.CreateSchedule(services.AuditExportScheduleDefinition{Name: "hourly", Format: models.AuditFileExportJSONL, IntervalMinutes: 5}, &owner)
+	assert.ErrorIs(t, err, services.ErrInvalidAuditExport, "schedules run at most every 15 minutes")
+	schedule, err := service.CreateSchedule(services.AuditExportScheduleDefinition{
+		Name:            "hourly failures",
+		Format:          models.AuditFileExportJSONL,
+		IntervalMinutes: 60,
+		Filters:         services.AuditExportFilters{Status: "failure"},
+	}, &owner)
+	require.NoError(t, err)
+	_, err = service.CreateSchedule(services.AuditExportScheduleDefinition{Name: "hourly failures", Format: models.AuditFileExportCSV, IntervalMinutes: 60}, &owner)
+	assert.ErrorIs(t, err, services.ErrAuditExportScheduleExists)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, entry := range []models.AuditLog{
+		{ID: uuid.New(), Action: "login", Status: "failure", CreatedAt: now.Add(-30 * time.Minute)},
+		{ID: uuid.New(), Action: "login", Status: "success", CreatedAt: now.Add(-20 * time.Minute)},
+		{ID: uuid.New(), Action: "login", Status: "failure", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: uuid.New(), Action: "login", Status: "failure", CreatedAt: now.Add(30 * time.Minute)},
+	} {
+		require.NoError(t, db.Create(&entry).Error)
+	}
+
+	exported, err := service.RunDueExports(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, exported, "a new schedule is due at once and covers the interval before it")
+	exported, err = service.RunDueExports(context.Background(), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, exported)
+	exported, err = service.RunDueExports(context.Background(), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, exported)
+
+	exports, total, err := service.ListFileExports(&schedule.ID, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	assert.Equal(t, now, exports[0].StartTime.UTC(), "each run starts where the previous one ended")
+	assert.Equal(t, now.Add(time.Hour), exports[0].EndTime.UTC())
+	assert.Equal(t, int64(1), exports[0].RecordCount)
+	assert.Equal(t, now.Add(-time.Hour), exports[1].StartTime.UTC())
+	assert.Equal(t, int64(1), exports[1].RecordCount)
+	assert.Equal(t, &owner, exports[1].RequestedBy)
+
+	require.NoError(t, service.DeleteSchedule(schedule.ID, &owner))
+	assert.ErrorIs(t, service.DeleteSchedule(schedule.ID, &owner), services.ErrAuditExportScheduleNotFound)
+}
+
+func TestS3ObjectStore_SignsRequests(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	store := services.NewS3ObjectStore("audit", "eu-west-1", "AKIAEXAMPLE", "secret", server.URL)
+	content := "id,action\n1,login\n"
+	require.NoError(t, store.PutStream(context.Background(), "audit_exports/2026/10/17/export.csv", "text/csv", strings.NewReader(content), int64(len(content))))
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPut, requests[0].Method)
+	assert.Equal(t, "/audit/audit_exports/2026/10/17/export.csv", requests[0].URL.Path)
+	assert.Equal(t, int64(len(content)), requests[0].ContentLength, "presigned uploads are not chunked")
+	assert.Equal(t, content, bodies[0])
+	query := requests[0].URL.Query()
+	assert.Equal(t, "AWS4-HMAC-SHA256", query.Get("X-Amz-Algorithm"))
+	assert.True(t, strings.HasPrefix(query.Get("X-Amz-Credential"), "AKIAEXAMPLE/"))
+	assert.True(t, strings.HasSuffix(query.Get("X-Amz-Credential"), "/eu-west-1/s3/aws4_request"))
+	assert.Len(t, query.Get("X-Amz-Signature"), 64)
+
+	store.SessionToken = "session"
+	signed, err := store.SignedURL("audit_exports/export.csv", "export.csv", 30*24*time.Hour, time.Now())
+	require.NoError(t, err)
+	assert.Contains(t, signed, "X-Amz-Expires=604800")
+	assert.Contains(t, signed, "X-Amz-Security-Token=session")
+
+	_, err = services.NewS3ObjectStore("audit", "eu-west-1", "", "", server.URL).SignedURL("key", "file", time.Minute, time.Now())
+	assert.Error(t, err)
+}
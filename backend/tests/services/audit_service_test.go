@@ -0,0 +1,70 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestAuditService_StatisticsFromDailyRollups(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.AuditDailyRollup{}), "Failed to migrate database schema")
+	service := services.NewAuditService(db)
+
+	firstDay := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -10)
+	secondDay := firstDay.AddDate(0, 0, 1)
+	for _, rollup := range []models.AuditDailyRollup{
+		{Day: firstDay.Format("2006-01-02"), Dimension: models.RollupDimensionTotal, Count: 10, RiskSum: 20, RiskCount: 4},
+		{Day: firstDay.Format("2006-01-02"), Dimension: models.RollupDimensionCategory, Value: "security", Count: 3},
+		{Day: firstDay.Format("2006-01-02"), Dimension: models.RollupDimensionOutcome, Value: "failure", Count: 2},
+		{Day: firstDay.Format("2006-01-02"), Dimension: models.RollupDimensionCompliance, Count: 1},
+		{Day: secondDay.Format("2006-01-02"), Dimension: models.RollupDimensionTotal, Count: 5, RiskSum: 40, RiskCount: 1},
+		{Day: secondDay.Format("2006-01-02"), Dimension: models.RollupDimensionOutcome, Value: "failure", Count: 1},
+		{Day: secondDay.Format("2006-01-02"), Dimension: models.RollupDimensionOutcome, Value: "denied", Count: 4},
+		{Day: secondDay.Format("2006-01-02"), Dimension: models.RollupDimensionEventType, Value: "login", Count: 5},
+	} {
+		require.NoError(t, db.Create(&rollup).Error)
+	}
+
+	// Whole rolled-up days are answered without touching audit_events at all
+	stats, err := service.GetStatistics(firstDay, secondDay.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), stats.TotalEvents)
+	assert.Equal(t, int64(3), stats.SecurityEvents)
+	assert.Equal(t, int64(7), stats.FailedAttempts)
+	assert.Equal(t, int64(1), stats.ComplianceViolations)
+	assert.Equal(t, int64(5), stats.EventsByType[services.EventTypeLogin])
+	assert.InDelta(t, 12.0, stats.AverageRiskScore, 0.001)
+
+	// A day without a rollup is counted live, which needs the Postgres-only events table
+	_, err = service.GetStatistics(firstDay, secondDay.AddDate(0, 0, 2))
+	assert.Error(t, err)
+}
+
+func TestAuditSampler_SamplesOnlyLowValueEvents(t *testing.T) {
+	t.Setenv("AUDIT_SAMPLE_RATES", "api_call=0.01, data_access=0.5, login=2, bogus")
+	sampler := services.NewAuditSamplerFromEnv()
+
+	assert.Equal(t, 0.01, sampler.Rate(services.EventTypeAPICall, services.CategoryAPI, services.AuditSeverityInfo, services.OutcomeSuccess, nil))
+	assert.Equal(t, 1.0, sampler.Rate(services.EventTypeAPIError, services.CategoryAPI, services.AuditSeverityError, services.OutcomeError, nil), "errors are always kept")
+	assert.Equal(t, 1.0, sampler.Rate(services.EventTypeAPICall, services.CategorySecurity, services.AuditSeverityInfo, services.OutcomeSuccess, nil), "security events are always kept")
+	assert.Equal(t, 1.0, sampler.Rate(services.EventTypeDataAccess, services.CategoryDataAccess, services.AuditSeverityInfo, services.OutcomeSuccess, []string{"gdpr-data-access"}), "compliance evidence is always kept")
+	assert.Equal(t, 1.0, sampler.Rate(services.EventTypeLogin, services.CategoryAuthentication, services.AuditSeverityInfo, services.OutcomeSuccess, nil), "out of range rates are ignored")
+
+	assert.True(t, sampler.Keep(1))
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		if sampler.Keep(0.1) {
+			kept++
+		}
+	}
+	assert.InDelta(t, 1000, kept, 200)
+}
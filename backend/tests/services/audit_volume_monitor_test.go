@@ -0,0 +1,67 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestAuditVolumeMonitor_AlertsOnDropsAndSpikes(t *testing.T) {
+	t.Setenv("AUDIT_VOLUME_BASELINE_WINDOW", "10m")
+	security, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditVolumeBaseline{}))
+	// The real audit_events table is Postgres-only; the monitor reads just these columns
+	require.NoError(t, db.Exec("CREATE TABLE audit_events (id TEXT PRIMARY KEY, timestamp DATETIME, category TEXT, sample_rate REAL)").Error)
+	t.Cleanup(func() { db.Migrator().DropTable("audit_events", &models.AuditVolumeBaseline{}) })
+	monitor := services.NewAuditVolumeMonitor(db, security)
+
+	base := time.Now().UTC().Truncate(time.Minute).Add(-time.Hour)
+	logEvents := func(minute, count int, sampleRate float64) {
+		for i := 0; i < count; i++ {
+			require.NoError(t, db.Exec("INSERT INTO audit_events (id, timestamp, category, sample_rate) VALUES (?, ?, ?, ?)",
+				uuid.NewString(), base.Add(time.Duration(minute)*time.Minute+time.Second), "api", sampleRate).Error)
+		}
+	}
+	evaluate := func(minute int) int {
+		alerts, err := monitor.Evaluate(base.Add(time.Duration(minute+2) * time.Minute))
+		require.NoError(t, err)
+		return alerts
+	}
+
+	// Sampled at one in two, 9 to 11 stored events stand for 18 to 22 a minute
+	for minute := 0; minute < 15; minute++ {
+		logEvents(minute, 9+minute%3, 0.5)
+		assert.Zero(t, evaluate(minute), "minute %d", minute)
+	}
+	baselines, err := monitor.GetBaselines()
+	require.NoError(t, err)
+	require.Len(t, baselines, 1)
+	assert.Equal(t, models.AuditVolumeNormal, baselines[0].Status)
+	assert.InDelta(t, 20, baselines[0].Mean, 2)
+
+	logEvents(15, 1, 0.5)
+	assert.Equal(t, 1, evaluate(15), "logging nearly stopped")
+	assert.Zero(t, evaluate(16), "a continuing drop waits for the cooldown")
+	baselines, err = monitor.GetBaselines()
+	require.NoError(t, err)
+	assert.Equal(t, models.AuditVolumeDrop, baselines[0].Status)
+	assert.Equal(t, int64(0), baselines[0].LastCount)
+
+	logEvents(17, 60, 0.5)
+	assert.Equal(t, 1, evaluate(17))
+
+	alertType := services.AlertTypeAuditVolumeAnomaly
+	var alerts []services.SecurityAlert
+	require.Eventually(t, func() bool {
+		alerts, err = security.GetAlerts(services.AlertFilters{Type: &alertType, Limit: 10})
+		return err == nil && len(alerts) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	severities := []services.AlertSeverity{alerts[0].Severity, alerts[1].Severity}
+	assert.ElementsMatch(t, []services.AlertSeverity{services.SeverityHigh, services.SeverityMedium}, severities)
+}
@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestWorkers_Stop(t *testing.T) {
+	t.Run("should wait for workers and then run shutdowns in reverse order", func(t *testing.T) {
+		workers := services.NewWorkers(context.Background())
+		finished := make(chan struct{})
+		workers.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			close(finished)
+		})
+		var order []string
+		workers.OnStop(func(context.Context) error {
+			order = append(order, "first")
+			return nil
+		})
+		workers.OnStop(func(context.Context) error {
+			order = append(order, "second")
+			return nil
+		})
+
+		require.NoError(t, workers.Stop(context.Background()))
+		select {
+		case <-finished:
+		default:
+			t.Fatal("Stop returned before the worker")
+		}
+		assert.Equal(t, []string{"second", "first"}, order)
+		assert.Error(t, workers.Context().Err())
+	})
+
+	t.Run("should give up on a stuck worker at the deadline but still shut services down", func(t *testing.T) {
+		workers := services.NewWorkers(context.Background())
+		release := make(chan struct{})
+		defer close(release)
+		workers.Go(func(context.Context) { <-release })
+		stopped := false
+		workers.OnStop(func(context.Context) error {
+			stopped = true
+			return nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.Error(t, workers.Stop(ctx))
+		assert.True(t, stopped)
+	})
+}
+
+func TestSecurityMonitoringService_ShutdownDrainsQueue(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:shutdowndrain?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.WatchlistEntry{}, &models.SecurityAlertRecord{}, &models.Playbook{}, &models.PlaybookExecution{}, &services.RiskAssessment{}))
+	service := services.NewSecurityMonitoringService(db)
+
+	for i := 0; i < 5; i++ {
+		_, err := service.GenerateAlert(services.AlertTypeLoginAnomaly, services.SeverityLow, "Login anomaly", "Login anomaly", map[string]interface{}{})
+		require.NoError(t, err)
+	}
+	require.NoError(t, service.Shutdown(context.Background()))
+
+	var stored int64
+	require.NoError(t, db.Model(&models.SecurityAlertRecord{}).Count(&stored).Error)
+	assert.Equal(t, int64(5), stored, "alerts queued before shutdown are still stored")
+
+	_, err = service.GenerateAlert(services.AlertTypeLoginAnomaly, services.SeverityLow, "Login anomaly", "Login anomaly", map[string]interface{}{})
+	assert.Error(t, err, "no alerts are queued after shutdown")
+	assert.NoError(t, service.Shutdown(context.Background()), "a second shutdown is a no-op")
+}
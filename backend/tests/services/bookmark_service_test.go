@@ -0,0 +1,121 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+)
+
+// setupTestBookmarkService sets up a bookmark service with a user
+func setupTestBookmarkService(t *testing.T) (*services.BookmarkService, *gorm.DB, *models.User) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.BookmarkApp{}, &models.BookmarkCredential{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	services.InitializeSaaSApps()
+
+	user := &models.User{Email: "alice@example.com", Username: "alice", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	return services.NewBookmarkService(db), db, user
+}
+
+func TestBookmarkService_CreateApp(t *testing.T) {
+	service, _, _ := setupTestBookmarkService(t)
+
+	tests := []struct {
+		name  string
+		input services.BookmarkAppInput
+	}{
+		{"bad id", services.BookmarkAppInput{AppID: "Payroll Portal", Name: "Payroll", URL: "https://payroll.example.com"}},
+		{"catalog clash", services.BookmarkAppInput{AppID: "slack", Name: "Slack", URL: "https://slack.com"}},
+		{"no name", services.BookmarkAppInput{AppID: "payroll", URL: "https://payroll.example.com"}},
+		{"relative url", services.BookmarkAppInput{AppID: "payroll", Name: "Payroll", URL: "/payroll"}},
+		{"bad login url", services.BookmarkAppInput{AppID: "payroll", Name: "Payroll", URL: "https://payroll.example.com", LoginURL: "javascript:alert(1)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateApp(tt.input, nil)
+			assert.ErrorIs(t, err, services.ErrInvalidBookmark)
+		})
+	}
+
+	app, err := service.CreateApp(services.BookmarkAppInput{
+		AppID: "payroll", Name: "Payroll", URL: "https://payroll.example.com", AllowCredentials: true, RequiredAAL: models.AAL2,
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, constants.CategoryProductivity, app.Category)
+
+	entry, ok := services.GetSaaSApp("payroll")
+	require.True(t, ok, "bookmark apps join the catalog")
+	assert.Equal(t, constants.ProtocolBookmark, entry.Protocol)
+	assert.Equal(t, "https://payroll.example.com", entry.LaunchURL)
+	assert.Equal(t, models.AAL2, entry.RequiredAAL)
+	assert.NotEmpty(t, entry.DataAccess)
+
+	// The catalog is rebuilt on start-up and bookmark apps are loaded back in
+	services.InitializeSaaSApps()
+	require.NoError(t, service.LoadApps())
+	_, ok = services.GetSaaSApp("payroll")
+	assert.True(t, ok)
+
+	require.NoError(t, service.DeleteApp("payroll", nil))
+	_, ok = services.GetSaaSApp("payroll")
+	assert.False(t, ok)
+	assert.ErrorIs(t, service.DeleteApp("payroll", nil), services.ErrBookmarkNotFound)
+}
+
+func TestBookmarkService_Credentials(t *testing.T) {
+	service, db, user := setupTestBookmarkService(t)
+
+	_, err := service.CreateApp(services.BookmarkAppInput{
+		AppID: "payroll", Name: "Payroll", URL: "https://payroll.example.com/home", LoginURL: "https://login.payroll.example.com/signin",
+		UsernameSelector: "#user", PasswordSelector: "#pass", AllowCredentials: true,
+	}, nil)
+	require.NoError(t, err)
+
+	info, err := service.GetCredentialInfo(user.ID, "payroll")
+	require.NoError(t, err)
+	assert.False(t, info.HasCredentials)
+	_, err = service.Autofill(user.ID, "payroll", time.Now())
+	assert.ErrorIs(t, err, services.ErrBookmarkCredentialNotFound)
+
+	info, err = service.SaveCredential(user.ID, "payroll", "alice.payroll", "hunter2")
+	require.NoError(t, err)
+	assert.True(t, info.HasCredentials)
+
+	// Credentials are sealed at rest
+	var stored models.BookmarkCredential
+	require.NoError(t, db.First(&stored, "user_id = ?", user.ID).Error)
+	assert.NotContains(t, stored.Username, "alice.payroll")
+	assert.NotContains(t, stored.Password, "hunter2")
+
+	autofill, err := service.Autofill(user.ID, "payroll", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "alice.payroll", autofill.Username)
+	assert.Equal(t, "hunter2", autofill.Password)
+	assert.Equal(t, "https://login.payroll.example.com", autofill.Origin)
+	assert.Equal(t, "#user", autofill.UsernameSelector)
+
+	var used int64
+	db.Model(&models.AuditLog{}).Where("user_id = ? AND action = ?", user.ID, "bookmark_credentials_used").Count(&used)
+	assert.Equal(t, int64(1), used)
+
+	// Switching off credential storage deletes what users saved
+	_, err = service.UpdateApp("payroll", services.BookmarkAppInput{Name: "Payroll", URL: "https://payroll.example.com/home"}, nil)
+	require.NoError(t, err)
+	_, err = service.Autofill(user.ID, "payroll", time.Now())
+	assert.ErrorIs(t, err, services.ErrBookmarkCredentialsNotAllowed)
+	_, err = service.SaveCredential(user.ID, "payroll", "alice", "pw")
+	assert.ErrorIs(t, err, services.ErrBookmarkCredentialsNotAllowed)
+	info, err = service.GetCredentialInfo(user.ID, "payroll")
+	require.NoError(t, err)
+	assert.False(t, info.HasCredentials)
+}
@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+)
+
+func setupTestBootstrapService(t *testing.T) (*services.BootstrapService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	return services.NewBootstrapService(db), db
+}
+
+func TestBootstrapService_SeedsDemoDataOnce(t *testing.T) {
+	service, db := setupTestBootstrapService(t)
+
+	results, err := service.Run(services.BootstrapOptions{Demo: true}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, services.BootstrapApplied, results[0].Status)
+
+	var demoUser models.User
+	require.NoError(t, db.First(&demoUser, "id = ?", constants.DemoUserID).Error)
+	require.NoError(t, db.Delete(&demoUser).Error)
+
+	// A restart does not bring back demo data an admin removed
+	results, err = service.Run(services.BootstrapOptions{Demo: true}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, services.BootstrapCurrent, results[0].Status)
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	records, err := service.ListRecords()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "demo_user", records[0].Step)
+	assert.True(t, records[0].Demo)
+}
+
+func TestBootstrapService_SkipsDemoDataUnlessEnabled(t *testing.T) {
+	service, db := setupTestBootstrapService(t)
+
+	results, err := service.Run(services.BootstrapOptions{}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, services.BootstrapDisabled, results[0].Status)
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+	records, err := service.ListRecords()
+	require.NoError(t, err)
+	assert.Empty(t, records, "skipped steps can still be applied later")
+}
+
+func TestBootstrapOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantDemo bool
+	}{
+		{"development", map[string]string{}, true},
+		{"release mode", map[string]string{"GIN_MODE": "release"}, false},
+		{"platform port", map[string]string{"PORT": "8080"}, false},
+		{"enabled in production", map[string]string{"PORT": "8080", "BOOTSTRAP_DEMO_DATA": "true"}, true},
+		{"legacy skip", map[string]string{"BOOTSTRAP_DEMO_DATA": "true", "SKIP_DEMO_USER": "true"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"GIN_MODE", "PORT", "BOOTSTRAP_DEMO_DATA", "SKIP_DEMO_USER"} {
+				t.Setenv(key, tt.env[key])
+			}
+			assert.Equal(t, tt.wantDemo, services.BootstrapOptionsFromEnv().Demo)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/services"
+)
+
+// fakeRedis serves GET, SET PX, GETDEL, DEL and PING from memory, requiring AUTH and recording
+// the database each connection selected
+type fakeRedis struct {
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	expiries map[string]time.Time
+	selected []string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	server := &fakeRedis{password: password, values: map[string]string{}, expiries: map[string]time.Time{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server, listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readFakeRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(args[0])
+		if !authenticated && command != "AUTH" {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		f.mu.Lock()
+		value, exists := f.values[args[len(args)-1]]
+		if exists && !time.Now().Before(f.expiries[args[len(args)-1]]) {
+			exists = false
+		}
+		var reply string
+		switch command {
+		case "AUTH":
+			authenticated = args[len(args)-1] == f.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SELECT":
+			f.selected = append(f.selected, args[1])
+			reply = "+OK\r\n"
+		case "SET":
+			ms, _ := strconv.Atoi(args[4])
+			f.values[args[1]] = args[2]
+			f.expiries[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			reply = "+OK\r\n"
+		case "GET", "GETDEL":
+			reply = "$-1\r\n"
+			if exists {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			}
+			if command == "GETDEL" {
+				delete(f.values, args[1])
+			}
+		case "DEL":
+			delete(f.values, args[1])
+			reply = ":1\r\n"
+		case "PING":
+			reply = "+PONG\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+func readFakeRedisCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		args[i] = string(value[:size])
+	}
+	return args, nil
+}
+
+// exerciseCache checks the behaviour every Cache shares
+func exerciseCache(t *testing.T, cache services.Cache) {
+	ctx := context.Background()
+	_, err := cache.Get(ctx, "missing")
+	assert.ErrorIs(t, err, services.ErrCacheMiss)
+
+	require.NoError(t, cache.Set(ctx, "secret", []byte("value\r\nwith newline"), time.Minute))
+	value, err := cache.Get(ctx, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "value\r\nwith newline", string(value))
+
+	// Taking a value deletes it, so single-use values are only used once
+	value, err = cache.Take(ctx, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "value\r\nwith newline", string(value))
+	_, err = cache.Take(ctx, "secret")
+	assert.ErrorIs(t, err, services.ErrCacheMiss)
+
+	require.NoError(t, cache.Set(ctx, "deleted", []byte("x"), time.Minute))
+	require.NoError(t, cache.Delete(ctx, "deleted"))
+	_, err = cache.Get(ctx, "deleted")
+	assert.ErrorIs(t, err, services.ErrCacheMiss)
+
+	require.NoError(t, cache.Set(ctx, "short", []byte("x"), 20*time.Millisecond))
+	time.Sleep(40 * time.Millisecond)
+	_, err = cache.Get(ctx, "short")
+	assert.ErrorIs(t, err, services.ErrCacheMiss, "values expire after their TTL")
+}
+
+func TestMemoryCache(t *testing.T) {
+	exerciseCache(t, services.NewMemoryCache(100))
+
+	// A full cache makes room for new values
+	cache := services.NewMemoryCache(2)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, cache.Set(ctx, key, []byte(key), time.Minute))
+	}
+	value, err := cache.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "c", string(value))
+}
+
+func TestRedisCache(t *testing.T) {
+	server, addr := startFakeRedis(t, "s3cret")
+	cache, err := services.NewRedisCache("redis://:s3cret@" + addr + "/2")
+	require.NoError(t, err)
+	defer cache.Close()
+	exerciseCache(t, cache)
+
+	// Pooled connections authenticate and select the database once
+	server.mu.Lock()
+	assert.Equal(t, []string{"2"}, server.selected)
+	server.mu.Unlock()
+
+	wrongPassword, err := services.NewRedisCache("redis://:wrong@" + addr)
+	require.NoError(t, err)
+	_, err = wrongPassword.Get(context.Background(), "secret")
+	assert.ErrorContains(t, err, "WRONGPASS")
+
+	_, err = services.NewRedisCache("http://" + addr)
+	assert.Error(t, err)
+}
+
+func TestThreatIntelligence_SharesRemoteAnswersThroughCache(t *testing.T) {
+	abuseLookups, abuseDown := 0, false
+	server := threatFeedServer(t, &abuseLookups, &abuseDown)
+	cache := services.NewMemoryCache(100)
+	newInstance := func() *services.ThreatIntelligenceService {
+		intel := services.NewThreatIntelligenceService()
+		intel.AddProvider(services.NewAbuseIPDBProvider(server.URL, "abuse-key", 30, 25))
+		intel.UseCache(cache)
+		return intel
+	}
+
+	// An answer one instance looked up is served to another from the shared cache
+	data, err := newInstance().GetThreatData(context.Background(), "203.0.113.66")
+	require.NoError(t, err)
+	assert.Equal(t, "abuseipdb", data.Source)
+	data, err = newInstance().GetThreatData(context.Background(), "203.0.113.66")
+	require.NoError(t, err)
+	assert.Equal(t, "abuseipdb", data.Source)
+	assert.InDelta(t, 0.96, data.Confidence, 0.001)
+	assert.Equal(t, 1, abuseLookups)
+}
@@ -0,0 +1,95 @@
+package services_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestCallbackGuard(t *testing.T) (*services.CallbackGuard, *services.SecurityMonitoringService) {
+	t.Setenv("CALLBACK_GUARD_MAX_IP_FAILURES", "3")
+	t.Setenv("CALLBACK_GUARD_MAX_STATE_FAILURES", "4")
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.CallbackFailure{}, &models.CallbackBlock{}, &models.AuditLog{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.CallbackFailure{}, &models.CallbackBlock{}, &models.AuditLog{})
+	})
+	return services.NewCallbackGuard(db, monitoring), monitoring
+}
+
+func TestCallbackGuard_BlocksIP(t *testing.T) {
+	guard, monitoring := setupTestCallbackGuard(t)
+	now := time.Now()
+	const attacker = "203.0.113.9"
+
+	for i := 0; i < 3; i++ {
+		block, err := guard.Check(attacker, "", now)
+		require.NoError(t, err)
+		require.Nil(t, block, "not blocked before the threshold")
+		require.NoError(t, guard.RecordFailure("google_callback", attacker, fmt.Sprintf("forged-%d", i), "curl", 500, now))
+	}
+
+	block, err := guard.Check(attacker, "", now)
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	assert.Equal(t, models.CallbackBlockIP, block.Scope)
+	assert.Equal(t, int64(3), block.Failures)
+	require.Eventually(t, func() bool {
+		alerts, _, err := monitoring.GetAlertQueue(50, 0)
+		return err == nil && len(alerts) == 1 && alerts[0].Type == services.AlertTypeCallbackAbuse
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Other addresses are unaffected, and the block is temporary
+	block, err = guard.Check("198.51.100.1", "", now)
+	require.NoError(t, err)
+	assert.Nil(t, block)
+	block, err = guard.Check(attacker, "", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Nil(t, block)
+
+	blocks, err := guard.ListBlocks(now)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	analyst := uuid.New()
+	require.NoError(t, guard.Unblock(blocks[0].ID, &analyst, now))
+	assert.ErrorIs(t, guard.Unblock(blocks[0].ID, &analyst, now), services.ErrCallbackBlockNotFound)
+
+	// Lifting a block forgets its failures, so one more does not block again
+	require.NoError(t, guard.RecordFailure("google_callback", attacker, "", "curl", 400, now))
+	block, err = guard.Check(attacker, "", now)
+	require.NoError(t, err)
+	assert.Nil(t, block)
+}
+
+func TestCallbackGuard_BlocksStatePrefix(t *testing.T) {
+	guard, _ := setupTestCallbackGuard(t)
+	now := time.Now()
+
+	// A campaign spread over many addresses, each below the per-IP threshold
+	for i := 0; i < 4; i++ {
+		ip := fmt.Sprintf("192.0.2.%d", i+1)
+		require.NoError(t, guard.RecordFailure("github_callback", ip, fmt.Sprintf("deadbeef%04d", i), "curl", 400, now))
+	}
+
+	block, err := guard.Check("192.0.2.200", "deadbeef9999", now)
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	assert.Equal(t, models.CallbackBlockStatePrefix, block.Scope)
+	assert.Equal(t, "deadbeef", block.Value)
+
+	block, err = guard.Check("192.0.2.200", "0a1b2c3d4e5f", now)
+	require.NoError(t, err)
+	assert.Nil(t, block, "other states from the same address proceed")
+
+	require.NoError(t, guard.Purge(now.Add(time.Hour)))
+	blocks, err := guard.ListBlocks(now)
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+}
@@ -0,0 +1,77 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestCanaryKeyService_DetectsUse(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.CanaryKey{}, &models.CanaryKeyHit{}, &models.AuditLog{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.CanaryKey{}, &models.CanaryKeyHit{}, &models.AuditLog{})
+	})
+	service := services.NewCanaryKeyService(db, monitoring)
+	analyst := uuid.New()
+	now := time.Now()
+
+	canary, key, err := service.Create("Deploy guide", "ops wiki: deploy guide", &analyst)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, services.CanaryKeyPrefix))
+	assert.Equal(t, key[len(key)-4:], canary.KeyHint)
+
+	_, _, err = service.Create(" ", "", &analyst)
+	assert.ErrorIs(t, err, services.ErrInvalidCanaryKey)
+
+	// Other keys and tokens are not canaries
+	found, err := service.Detect(services.CanaryRequest{Key: services.CanaryKeyPrefix + "0000"}, now)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = service.Detect(services.CanaryRequest{Key: "eyJhbGciOiJIUzI1NiJ9"}, now)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	found, err = service.Detect(services.CanaryRequest{
+		Key:         key,
+		PresentedIn: "x-api-key",
+		IPAddress:   "203.0.113.77",
+		UserAgent:   "python-requests/2.31",
+		Method:      "GET",
+		Path:        "/api/v1/security/alerts",
+		Headers:     map[string]string{"X-Api-Key": "[redacted]", "Accept": "*/*"},
+	}, now)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, canary.ID, found.ID)
+
+	require.Eventually(t, func() bool {
+		alerts, _, err := monitoring.GetAlertQueue(50, 0)
+		return err == nil && len(alerts) == 1 && alerts[0].Type == services.AlertTypeCanaryKeyUsed &&
+			alerts[0].Severity == services.SeverityCritical && alerts[0].IPAddress == "203.0.113.77"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	hits, total, err := service.Hits(canary.ID, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "/api/v1/security/alerts", hits[0].Path)
+	assert.Contains(t, hits[0].Headers, "[redacted]")
+
+	canaries, err := service.List()
+	require.NoError(t, err)
+	require.Len(t, canaries, 1)
+	assert.Equal(t, int64(1), canaries[0].HitCount)
+	assert.Equal(t, "203.0.113.77", canaries[0].LastHitIP)
+
+	require.NoError(t, service.Delete(canary.ID, &analyst))
+	assert.ErrorIs(t, service.Delete(canary.ID, &analyst), services.ErrCanaryKeyNotFound)
+	_, _, err = service.Hits(canary.ID, 50, 0)
+	assert.ErrorIs(t, err, services.ErrCanaryKeyNotFound)
+}
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestCaseService sets up a test case service with an in-memory database
+func setupTestCaseService(t *testing.T) *services.CaseService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.AuditLog{}, &models.InvestigationCase{}, &models.CaseLink{},
+		&models.CaseNote{}, &models.CaseEvidence{}, &models.CaseTask{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewCaseService(db)
+}
+
+func TestCaseService_CaseLifecycle(t *testing.T) {
+	service := setupTestCaseService(t)
+	analyst := uuid.New()
+
+	investigation, err := service.CreateCase("Credential stuffing wave", "Several accounts hit from one ASN", "high", &analyst, &analyst)
+	require.NoError(t, err)
+	assert.Equal(t, models.CaseStatusOpen, investigation.Status)
+
+	t.Run("should link incidents, alerts and users once", func(t *testing.T) {
+		userID := uuid.New().String()
+		_, err := service.LinkTarget(investigation.ID, models.CaseLinkIncident, uuid.New().String(), &analyst)
+		require.NoError(t, err)
+		first, err := service.LinkTarget(investigation.ID, models.CaseLinkUser, userID, &analyst)
+		require.NoError(t, err)
+		second, err := service.LinkTarget(investigation.ID, models.CaseLinkUser, userID, &analyst)
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, second.ID)
+
+		cases, err := service.FindCasesForTarget(models.CaseLinkUser, userID)
+		require.NoError(t, err)
+		require.Len(t, cases, 1)
+		assert.Equal(t, investigation.ID, cases[0].ID)
+	})
+
+	t.Run("should reject unknown link types", func(t *testing.T) {
+		_, err := service.LinkTarget(investigation.ID, "ticket", uuid.New().String(), &analyst)
+		assert.ErrorIs(t, err, services.ErrInvalidCaseLink)
+	})
+
+	t.Run("should track notes, evidence and tasks", func(t *testing.T) {
+		_, err := service.AddNote(investigation.ID, "Blocked ASN at the edge", &analyst)
+		require.NoError(t, err)
+		_, err = service.AddEvidence(investigation.ID, "auth.log", "Raw auth log export", "s3://evidence/auth.log", "abc123", &analyst)
+		require.NoError(t, err)
+
+		due := time.Now().Add(-time.Hour)
+		task, err := service.AddTask(investigation.ID, "Reset affected passwords", &analyst, &due, &analyst)
+		require.NoError(t, err)
+		assert.True(t, task.IsOverdue())
+
+		assigned, err := service.GetAssignedTasks(analyst)
+		require.NoError(t, err)
+		assert.Len(t, assigned, 1)
+
+		task, err = service.UpdateTaskStatus(investigation.ID, task.ID, models.CaseTaskDone, &analyst)
+		require.NoError(t, err)
+		assert.NotNil(t, task.CompletedAt)
+		assert.False(t, task.IsOverdue())
+
+		full, err := service.GetCase(investigation.ID)
+		require.NoError(t, err)
+		assert.Len(t, full.Links, 2)
+		assert.Len(t, full.Notes, 1)
+		assert.Len(t, full.Evidence, 1)
+		assert.Len(t, full.Tasks, 1)
+	})
+
+	t.Run("should freeze a closed case except for notes", func(t *testing.T) {
+		closed := models.CaseStatusClosed
+		updated, err := service.UpdateCase(investigation.ID, services.CaseUpdate{Status: &closed}, &analyst)
+		require.NoError(t, err)
+		assert.NotNil(t, updated.ClosedAt)
+
+		_, err = service.AddTask(investigation.ID, "Late task", nil, nil, &analyst)
+		assert.ErrorIs(t, err, services.ErrCaseClosed)
+		_, err = service.AddNote(investigation.ID, "Post-mortem filed", &analyst)
+		assert.NoError(t, err)
+
+		open := models.CaseStatusOpen
+		reopened, err := service.UpdateCase(investigation.ID, services.CaseUpdate{Status: &open}, &analyst)
+		require.NoError(t, err)
+		assert.Nil(t, reopened.ClosedAt)
+	})
+}
+
+func TestCaseService_ListCases(t *testing.T) {
+	service := setupTestCaseService(t)
+	owner := uuid.New()
+
+	_, err := service.CreateCase("Owned", "", "low", &owner, nil)
+	require.NoError(t, err)
+	_, err = service.CreateCase("Unowned", "", "medium", nil, nil)
+	require.NoError(t, err)
+
+	_, err = service.CreateCase("Bad severity", "", "urgent", nil, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidCaseInput)
+
+	cases, total, err := service.ListCases(services.CaseFilters{OwnerID: &owner, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, cases, 1)
+	assert.Equal(t, "Owned", cases[0].Title)
+
+	_, total, err = service.ListCases(services.CaseFilters{Status: models.CaseStatusOpen, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+}
@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func openConfigTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.BookmarkApp{}, &models.BookmarkCredential{},
+		&models.HeaderProxyApp{}, &models.AppAccessSchedule{}, &models.Playbook{}, &models.ServiceAccount{}, &services.RiskThresholds{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	return db
+}
+
+// setupTestConfigSource builds an environment with one of each kind of configuration
+func setupTestConfigSource(t *testing.T) *gorm.DB {
+	services.InitializeSaaSApps()
+	db := openConfigTestDB(t)
+
+	_, err := services.NewBookmarkService(db).CreateApp(services.BookmarkAppInput{AppID: "payroll", Name: "Payroll", URL: "https://payroll.example.com"}, nil)
+	require.NoError(t, err)
+	_, err = services.NewHeaderProxyService(db).SetApp("intranet-portal", services.HeaderProxyInput{
+		UpstreamURL: "http://intranet.local/app/", SharedSecret: "proxy-secret", DefaultGroups: []string{"staff"}, Enabled: true,
+	}, nil)
+	require.NoError(t, err)
+	_, err = services.NewAccessScheduleService(db).SetSchedule("payroll", services.AccessScheduleInput{
+		Timezone: "Europe/Berlin", StartTime: "08:00", EndTime: "18:00", Days: []string{"mon", "tue"}, Enabled: true,
+	}, nil)
+	require.NoError(t, err)
+	_, err = services.NewServiceAccountService(db).CreateAccount(services.ServiceAccountInput{
+		Name: "siem", CertSubject: "siem.internal", Scopes: []string{services.ServiceScopeLoginEvents}, Enabled: true,
+	}, nil)
+	require.NoError(t, err)
+	services.NewPlaybookEngine(db, nil)
+
+	originalDB := services.DB
+	services.DB = db
+	defer func() { services.DB = originalDB }()
+	require.NoError(t, services.UpdateRiskThresholds(map[string]float64{"vpn_risk": 0.4, "high_threshold": 0.8}))
+	return db
+}
+
+// exportSnapshot exports a snapshot and round-trips it through JSON, as the CLI does
+func exportSnapshot(t *testing.T, db *gorm.DB) *services.ConfigSnapshot {
+	snapshot, err := services.NewConfigBackupService(db, nil, nil).ExportSnapshot(time.Now())
+	require.NoError(t, err)
+	encoded, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "proxy-secret", "snapshots carry no secrets")
+
+	var decoded services.ConfigSnapshot
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	return &decoded
+}
+
+func TestConfigBackupService_RestoresIntoFreshEnvironment(t *testing.T) {
+	snapshot := exportSnapshot(t, setupTestConfigSource(t))
+	assert.Equal(t, services.ConfigSnapshotSchemaVersion, snapshot.SchemaVersion)
+	require.Len(t, snapshot.HeaderProxyApps, 1)
+	assert.True(t, snapshot.HeaderProxyApps[0].HasSharedSecret)
+
+	// A different environment, with its own catalog
+	services.InitializeSaaSApps()
+	target := openConfigTestDB(t)
+	service := services.NewConfigBackupService(target, nil, nil)
+
+	preview, err := service.Restore(snapshot, true, nil, time.Now())
+	require.NoError(t, err)
+	assert.True(t, preview.DryRun)
+	assert.Zero(t, preview.Applied)
+	var count int64
+	require.NoError(t, target.Model(&models.BookmarkApp{}).Count(&count).Error)
+	assert.Zero(t, count, "a dry run changes nothing")
+
+	result, err := service.Restore(snapshot, false, nil, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, len(preview.Changes), len(result.Changes))
+	assert.Equal(t, len(result.Changes), result.Applied)
+	for _, change := range result.Changes {
+		assert.Equal(t, services.ConfigChangeCreate, change.Action, "%s %s", change.Section, change.Key)
+		if change.Section == "header_proxy_apps" {
+			assert.NotEmpty(t, change.Note, "the operator is told to set the shared secret again")
+		}
+	}
+
+	restored := exportSnapshot(t, target)
+	assert.Equal(t, snapshot.BookmarkApps, restored.BookmarkApps)
+	assert.Equal(t, snapshot.AccessSchedules, restored.AccessSchedules)
+	assert.Equal(t, snapshot.ServiceAccounts, restored.ServiceAccounts)
+	assert.Equal(t, snapshot.Playbooks, restored.Playbooks)
+	assert.Equal(t, snapshot.RiskThresholds, restored.RiskThresholds)
+	_, inCatalog := services.GetSaaSApp("payroll")
+	assert.True(t, inCatalog)
+
+	again, err := service.Restore(snapshot, true, nil, time.Now())
+	require.NoError(t, err)
+	require.Len(t, again.Changes, 1, "only the shared secret is left to set")
+	assert.Equal(t, services.ConfigChangeManual, again.Changes[0].Action)
+}
+
+func TestConfigBackupService_ReportsFieldChanges(t *testing.T) {
+	db := setupTestConfigSource(t)
+	service := services.NewConfigBackupService(db, nil, nil)
+	snapshot := exportSnapshot(t, db)
+
+	snapshot.BookmarkApps[0].Name = "Payroll (EU)"
+	snapshot.ServiceAccounts[0].Enabled = false
+	snapshot.RiskThresholds["vpn_risk"] = 0.5
+
+	result, err := service.Restore(snapshot, true, nil, time.Now())
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 3)
+	assert.Equal(t, services.ConfigChange{Section: "bookmark_apps", Key: "payroll", Action: services.ConfigChangeUpdate, Fields: []string{"name"}}, result.Changes[0])
+	assert.Equal(t, []string{"enabled"}, result.Changes[1].Fields)
+	assert.Equal(t, "service_accounts", result.Changes[1].Section)
+	assert.Equal(t, []string{"vpn_risk"}, result.Changes[2].Fields)
+
+	_, err = service.Restore(snapshot, false, nil, time.Now())
+	require.NoError(t, err)
+	var account models.ServiceAccount
+	require.NoError(t, db.Where("name = ?", "siem").First(&account).Error)
+	assert.False(t, account.Enabled)
+}
+
+func TestConfigBackupService_RejectsUnsupportedSnapshots(t *testing.T) {
+	service := services.NewConfigBackupService(openConfigTestDB(t), nil, nil)
+
+	_, err := service.Restore(&services.ConfigSnapshot{SchemaVersion: services.ConfigSnapshotSchemaVersion + 1}, true, nil, time.Now())
+	assert.ErrorIs(t, err, services.ErrSnapshotVersionUnsupported)
+	_, err = service.Restore(&services.ConfigSnapshot{}, true, nil, time.Now())
+	assert.ErrorIs(t, err, services.ErrInvalidSnapshot)
+}
+
+func TestConfigBackupService_RollsBackFailedRestores(t *testing.T) {
+	services.InitializeSaaSApps()
+	db := openConfigTestDB(t)
+	service := services.NewConfigBackupService(db, nil, nil)
+
+	snapshot := &services.ConfigSnapshot{
+		SchemaVersion:   services.ConfigSnapshotSchemaVersion,
+		BookmarkApps:    []services.BookmarkAppConfig{{AppID: "payroll", Name: "Payroll", URL: "https://payroll.example.com"}},
+		ServiceAccounts: []services.ServiceAccountConfig{{Name: "siem", CertSubject: "siem.internal", Scopes: []string{"unknown"}}},
+	}
+	_, err := service.Restore(snapshot, false, nil, time.Now())
+	assert.ErrorIs(t, err, services.ErrInvalidServiceAccount)
+
+	var count int64
+	require.NoError(t, db.Model(&models.BookmarkApp{}).Count(&count).Error)
+	assert.Zero(t, count)
+	_, inCatalog := services.GetSaaSApp("payroll")
+	assert.False(t, inCatalog)
+}
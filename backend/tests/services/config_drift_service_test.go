@@ -0,0 +1,185 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestConfigDriftService sets up a drift service raising alerts through a monitoring
+// service, on a database the monitoring service's background processor can share
+func setupTestConfigDriftService(t *testing.T) (*services.ConfigDriftService, <-chan services.SecurityAlert) {
+	t.Setenv("CONFIG_DRIFT_MAX_CHANGES", "3")
+	t.Setenv("CONFIG_DRIFT_WINDOW", "1h")
+	t.Setenv("CONFIG_BUSINESS_HOURS", "08:00-18:00")
+	t.Setenv("CONFIG_BUSINESS_TIMEZONE", "Europe/Berlin")
+
+	db, err := gorm.Open(sqlite.Open("file:configdrift?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	tables := []interface{}{&models.User{}, &models.WatchlistEntry{}, &models.SecurityAlertRecord{}, &models.Playbook{}, &models.PlaybookExecution{}, &services.RiskAssessment{}, &models.ConfigVersion{}}
+	require.NoError(t, db.AutoMigrate(tables...), "Failed to migrate database schema")
+
+	monitoring := services.NewSecurityMonitoringService(db)
+	alerts := monitoring.Subscribe("config-drift-test")
+	t.Cleanup(func() {
+		monitoring.Shutdown(context.Background())
+		db.Migrator().DropTable(tables...)
+	})
+	return services.NewConfigDriftService(db, monitoring), alerts
+}
+
+func nextAlert(t *testing.T, alerts <-chan services.SecurityAlert) services.SecurityAlert {
+	select {
+	case alert := <-alerts:
+		return alert
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a configuration drift alert")
+		return services.SecurityAlert{}
+	}
+}
+
+func TestConfigDriftService_AlertsOnBurstOfChanges(t *testing.T) {
+	service, alerts := setupTestConfigDriftService(t)
+	admin := uuid.New()
+	monday := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC) // 11:00 in Berlin
+
+	for i := 0; i < 3; i++ {
+		version, err := service.RecordChange(services.ConfigKindThresholds, "risk_thresholds", &admin, "Risk thresholds updated", nil, monday.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, i+1, version.Version)
+		assert.False(t, version.OffHours)
+	}
+	select {
+	case alert := <-alerts:
+		t.Fatalf("unexpected alert within the usual rate: %s", alert.Title)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err := service.RecordChange(services.ConfigKindRules, "correlation_rules", &admin, "Rules set", nil, monday.Add(5*time.Minute))
+	require.NoError(t, err)
+	alert := nextAlert(t, alerts)
+	assert.Equal(t, services.AlertTypeConfigurationChange, alert.Type)
+	assert.Equal(t, services.SeverityMedium, alert.Severity)
+	require.NotNil(t, alert.UserID)
+	assert.Equal(t, admin, *alert.UserID)
+
+	status, err := service.Status(monday.Add(10 * time.Minute))
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, status.ChangesInWindow)
+	assert.EqualValues(t, 3, status.ChangesByKind[services.ConfigKindThresholds])
+	require.NotNil(t, status.LastChange)
+	assert.Equal(t, "correlation_rules", status.LastChange.Key)
+
+	versions, err := service.ListVersions(services.ConfigKindThresholds, "", 0)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, 3, versions[0].Version, "newest first")
+}
+
+func TestConfigDriftService_AlertsOnOffHoursChanges(t *testing.T) {
+	service, alerts := setupTestConfigDriftService(t)
+	saturday := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	version, err := service.RecordChange(services.ConfigKindChannels, "alert_channel:slack", nil, "Alert channel added", nil, saturday)
+	require.NoError(t, err)
+	assert.True(t, version.OffHours)
+	alert := nextAlert(t, alerts)
+	assert.Equal(t, services.SeverityLow, alert.Severity)
+	assert.Equal(t, "alert_channel:slack", alert.Metadata["key"])
+
+	// Further off-hours changes in the same window do not repeat the alert
+	_, err = service.RecordChange(services.ConfigKindPolicies, "access_schedule:payroll", nil, "Access schedule updated", nil, saturday.Add(time.Minute))
+	require.NoError(t, err)
+	select {
+	case alert := <-alerts:
+		t.Fatalf("unexpected repeated alert: %s", alert.Title)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestConfigDriftService_BusinessHours(t *testing.T) {
+	t.Setenv("CONFIG_BUSINESS_HOURS", "22:00-06:00")
+	t.Setenv("CONFIG_BUSINESS_DAYS", "mon,tue,wed,thu,fri")
+	t.Setenv("CONFIG_BUSINESS_TIMEZONE", "UTC")
+	service := services.NewConfigDriftService(nil, nil)
+
+	assert.True(t, service.InBusinessHours(time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)), "Monday night shift")
+	assert.True(t, service.InBusinessHours(time.Date(2024, 1, 20, 3, 0, 0, 0, time.UTC)), "Friday's shift runs into Saturday")
+	assert.False(t, service.InBusinessHours(time.Date(2024, 1, 15, 3, 0, 0, 0, time.UTC)), "Sunday night is off")
+	assert.False(t, service.InBusinessHours(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestConfigDriftService_RollsBackToPriorVersion(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:configrollback?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	tables := []interface{}{&models.User{}, &models.WatchlistEntry{}, &models.SecurityAlertRecord{}, &models.Playbook{}, &models.PlaybookExecution{}, &services.RiskAssessment{}, &models.ConfigVersion{}, &models.AuditLog{}}
+	require.NoError(t, db.AutoMigrate(tables...), "Failed to migrate database schema")
+	monitoring := services.NewSecurityMonitoringService(db)
+	drift := services.NewConfigDriftService(db, monitoring)
+	services.SetConfigDriftService(drift)
+	t.Cleanup(func() {
+		services.SetConfigDriftService(nil)
+		monitoring.Shutdown(context.Background())
+		db.Migrator().DropTable(tables...)
+	})
+
+	admin := uuid.New()
+	engine := monitoring.Playbooks()
+	definition, err := services.ParsePlaybookDefinition([]byte(`
+name: contain-takeover
+trigger:
+  alert_types: [compromised_account]
+steps:
+  - name: Force logout
+    action: force_logout
+`), true)
+	require.NoError(t, err)
+	playbook, err := engine.CreatePlaybook(*definition, &admin)
+	require.NoError(t, err)
+
+	definition.Steps[0].Action = services.ActionTypeDisableAccount
+	_, err = engine.UpdatePlaybook(playbook.ID, *definition)
+	require.NoError(t, err)
+
+	versions, err := drift.ListVersions(services.ConfigKindRules, "playbook:contain-takeover", 0)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, []services.ConfigFieldChange{{Field: "steps[0].action", Before: "force_logout", After: "disable_account"}}, versions[0].Diff)
+	require.True(t, versions[1].Restorable)
+
+	rolledBack, err := drift.Rollback(versions[1].ID, &admin, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 3, rolledBack.Version)
+	assert.Equal(t, "Rolled back to version 1", rolledBack.Summary)
+	require.NotNil(t, rolledBack.RollbackOf)
+	assert.Equal(t, 1, *rolledBack.RollbackOf)
+	assert.Equal(t, &admin, rolledBack.ChangedBy)
+	restored, err := engine.GetPlaybook(playbook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.ActionTypeForceLogout, restored.Definition.Steps[0].Action)
+
+	versions, err = drift.ListVersions(services.ConfigKindRules, "playbook:contain-takeover", 0)
+	require.NoError(t, err)
+	assert.Len(t, versions, 3, "the restore is recorded once")
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "config_rolled_back", "playbook:contain-takeover").Count(&audits)
+	assert.Equal(t, int64(1), audits)
+
+	// Versions without a snapshot cannot be rolled back to, and versions never change
+	unsnapshotted, err := drift.RecordChange(services.ConfigKindChannels, "channel:pager", &admin, "Alert channel added", nil, time.Now())
+	require.NoError(t, err)
+	_, err = drift.Rollback(unsnapshotted.ID, &admin, time.Now())
+	assert.ErrorIs(t, err, services.ErrConfigRollbackUnsupported)
+	_, err = drift.Rollback(uuid.New(), &admin, time.Now())
+	assert.ErrorIs(t, err, services.ErrConfigVersionNotFound)
+	assert.ErrorIs(t, db.Delete(unsnapshotted).Error, models.ErrConfigVersionImmutable)
+}
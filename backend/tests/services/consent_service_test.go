@@ -0,0 +1,111 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestConsentService sets up a consent service backed by an in-memory database
+func setupTestConsentService(t *testing.T) (*services.ConsentService, *gorm.DB, *models.User) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.ConsentRecord{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	kc := "test-keycloak-id"
+	user := &models.User{
+		ID:         uuid.New(),
+		KeycloakID: &kc,
+		Email:      "test@example.com",
+		Username:   "testuser",
+		IsActive:   true,
+	}
+	require.NoError(t, db.Create(user).Error)
+
+	return services.NewConsentService(db), db, user
+}
+
+func TestConsentService_GrantConsent(t *testing.T) {
+	service, db, user := setupTestConsentService(t)
+
+	t.Run("should record consent with data categories", func(t *testing.T) {
+		record, err := service.GrantConsent(user.ID, "github", []string{"Repositories"}, "192.168.1.100", "Test Browser")
+		assert.NoError(t, err)
+		assert.Equal(t, "github", record.AppID)
+		assert.Equal(t, `["Repositories"]`, record.DataCategories)
+		assert.NotNil(t, record.ExpiresAt)
+
+		consented, err := service.HasValidConsent(user.ID, "github")
+		assert.NoError(t, err)
+		assert.True(t, consented)
+	})
+
+	t.Run("should supersede an earlier grant for the same app", func(t *testing.T) {
+		_, err := service.GrantConsent(user.ID, "slack", []string{"Channels"}, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+		second, err := service.GrantConsent(user.ID, "slack", []string{"Channels", "Messages"}, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+
+		active, err := service.GetUserConsents(user.ID, false)
+		assert.NoError(t, err)
+		var slackActive []models.ConsentRecord
+		for _, r := range active {
+			if r.AppID == "slack" {
+				slackActive = append(slackActive, r)
+			}
+		}
+		assert.Len(t, slackActive, 1)
+		assert.Equal(t, second.ID, slackActive[0].ID)
+
+		var total int64
+		db.Model(&models.ConsentRecord{}).Where("app_id = ?", "slack").Count(&total)
+		assert.Equal(t, int64(2), total)
+	})
+
+	t.Run("should treat expired consent as missing", func(t *testing.T) {
+		record, err := service.GrantConsent(user.ID, "trello", nil, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, db.Model(record).Update("expires_at", past).Error)
+
+		consented, err := service.HasValidConsent(user.ID, "trello")
+		assert.NoError(t, err)
+		assert.False(t, consented)
+	})
+}
+
+func TestConsentService_RevokeConsent(t *testing.T) {
+	service, _, user := setupTestConsentService(t)
+
+	t.Run("should revoke active consent", func(t *testing.T) {
+		_, err := service.GrantConsent(user.ID, "dropbox", []string{"Files"}, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+
+		assert.NoError(t, service.RevokeConsent(user.ID, "dropbox"))
+
+		consented, err := service.HasValidConsent(user.ID, "dropbox")
+		assert.NoError(t, err)
+		assert.False(t, consented)
+
+		all, err := service.GetUserConsents(user.ID, true)
+		assert.NoError(t, err)
+		require.Len(t, all, 1)
+		assert.NotNil(t, all[0].RevokedAt)
+	})
+
+	t.Run("should return not found without active consent", func(t *testing.T) {
+		err := service.RevokeConsent(user.ID, "notion")
+		assert.ErrorIs(t, err, services.ErrConsentNotFound)
+	})
+}
@@ -0,0 +1,159 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func createDetectionAuditLogs(t *testing.T, db *gorm.DB, count int, action, ipAddress, status string, at time.Time) {
+	for i := 0; i < count; i++ {
+		require.NoError(t, db.Create(&models.AuditLog{Action: action, Resource: "user", IPAddress: ipAddress, Status: status, CreatedAt: at}).Error)
+	}
+}
+
+func failedLoginsByIP() services.DetectionQueryDefinition {
+	return services.DetectionQueryDefinition{
+		Name: "Failed logins per IP",
+		Filters: []services.DetectionFilter{
+			{Field: "action", Operator: "eq", Value: "${action}"},
+			{Field: "status", Operator: "eq", Value: "failure"},
+		},
+		GroupBy:    "ip_address",
+		Window:     "1h",
+		Interval:   "5m",
+		Threshold:  3,
+		Severity:   services.SeverityHigh,
+		Parameters: map[string]string{"action": "login"},
+	}
+}
+
+func TestDetectionQueryDefinition_Validate(t *testing.T) {
+	valid := failedLoginsByIP()
+	require.NoError(t, valid.Validate())
+
+	cases := map[string]func(d *services.DetectionQueryDefinition){
+		"unknown field":        func(d *services.DetectionQueryDefinition) { d.Filters[0].Field = "password_hash" },
+		"unknown operator":     func(d *services.DetectionQueryDefinition) { d.Filters[0].Operator = "regex" },
+		"parameter no default": func(d *services.DetectionQueryDefinition) { d.Parameters = nil },
+		"bad group by":         func(d *services.DetectionQueryDefinition) { d.GroupBy = "created_at; DROP TABLE users" },
+		"window too long":      func(d *services.DetectionQueryDefinition) { d.Window = "1000h" },
+		"interval too short":   func(d *services.DetectionQueryDefinition) { d.Interval = "10s" },
+		"zero threshold":       func(d *services.DetectionQueryDefinition) { d.Threshold = 0 },
+		"in without values":    func(d *services.DetectionQueryDefinition) { d.Filters[1].Operator = "in" },
+	}
+	for name, mutate := range cases {
+		definition := failedLoginsByIP()
+		mutate(&definition)
+		assert.ErrorIs(t, definition.Validate(), services.ErrInvalidDetectionQuery, name)
+	}
+}
+
+func TestDetectionQueryService_ScheduledEvaluation(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}, &models.DetectionQuery{}, &models.DetectionQueryRun{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.AuditLog{}, &models.DetectionQuery{}, &models.DetectionQueryRun{})
+	})
+
+	service := services.NewDetectionQueryService(db, monitoring)
+	now := time.Now()
+	createDetectionAuditLogs(t, db, 4, "login", "203.0.113.9", "failure", now.Add(-10*time.Minute))
+	createDetectionAuditLogs(t, db, 2, "login", "198.51.100.4", "failure", now.Add(-10*time.Minute))
+	createDetectionAuditLogs(t, db, 5, "login", "203.0.113.9", "success", now.Add(-10*time.Minute))
+	createDetectionAuditLogs(t, db, 5, "login", "192.0.2.8", "failure", now.Add(-2*time.Hour)) // outside the window
+
+	query, err := service.CreateQuery(failedLoginsByIP(), nil, now)
+	require.NoError(t, err)
+	_, err = service.CreateQuery(failedLoginsByIP(), nil, now)
+	assert.ErrorIs(t, err, services.ErrDetectionQueryExists)
+
+	raised, err := service.EvaluateDue(now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, raised, "not due until one interval after creation")
+
+	raised, err = service.EvaluateDue(now.Add(5 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, raised)
+
+	// Still matching, but the same events are still in the window
+	raised, err = service.EvaluateDue(now.Add(10 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, raised)
+
+	runs, total, err := service.ListRuns(query.ID, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, runs, 2)
+	latest, first := runs[0], runs[1]
+	assert.Equal(t, models.DetectionRunScheduled, first.Trigger)
+	assert.True(t, first.Triggered)
+	assert.NotNil(t, first.AlertID)
+	assert.Equal(t, int64(6), first.MatchCount)
+	assert.Equal(t, []services.DetectionGroupCount{{Value: "203.0.113.9", Count: 4}}, first.Groups)
+	assert.True(t, latest.Triggered)
+	assert.Nil(t, latest.AlertID)
+
+	require.Eventually(t, func() bool {
+		_, total, err := monitoring.GetAlertQueue(50, 0)
+		return err == nil && total == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	queue, _, err := monitoring.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, services.AlertTypeDetectionQuery, queue[0].Type)
+	assert.Equal(t, services.SeverityHigh, queue[0].Severity)
+	assert.Equal(t, "Failed logins per IP", queue[0].Metadata["query_name"])
+}
+
+func TestDetectionQueryService_ManualRunWithParameters(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}, &models.DetectionQuery{}, &models.DetectionQueryRun{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.AuditLog{}, &models.DetectionQuery{}, &models.DetectionQueryRun{})
+	})
+
+	service := services.NewDetectionQueryService(db, monitoring)
+	now := time.Now()
+	createDetectionAuditLogs(t, db, 3, "mfa_verification_failed", "203.0.113.9", "failure", now.Add(-time.Minute))
+	createDetectionAuditLogs(t, db, 3, "mfa_100%_failed", "203.0.113.9", "failure", now.Add(-time.Minute))
+
+	query, err := service.CreateQuery(failedLoginsByIP(), nil, now)
+	require.NoError(t, err)
+
+	run, err := service.RunQuery(query.ID, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), run.MatchCount, "the default parameter looks for logins")
+
+	run, err = service.RunQuery(query.ID, map[string]string{"action": "mfa_verification_failed"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.DetectionRunManual, run.Trigger)
+	assert.Equal(t, int64(3), run.MatchCount)
+	assert.True(t, run.Triggered)
+	assert.Nil(t, run.AlertID, "manual runs never alert")
+
+	// LIKE wildcards in a filter value match literally
+	definition := failedLoginsByIP()
+	definition.Filters[0] = services.DetectionFilter{Field: "action", Operator: "prefix", Value: "mfa_100%"}
+	updated, err := service.UpdateQuery(query.ID, definition, nil, now)
+	require.NoError(t, err)
+	run, err = service.RunQuery(updated.ID, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), run.MatchCount)
+
+	_, total, err := monitoring.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	require.NoError(t, service.DeleteQuery(query.ID, nil))
+	_, err = service.RunQuery(query.ID, nil, now)
+	assert.ErrorIs(t, err, services.ErrDetectionQueryNotFound)
+	_, total, err = service.ListRuns(query.ID, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total, "run history outlives the query")
+}
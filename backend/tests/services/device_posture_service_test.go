@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/types"
+)
+
+func TestDevicePostureService_Compliance(t *testing.T) {
+	t.Setenv("DEVICE_MIN_OS_VERSIONS", "windows=10.0.19045, macos=13.0")
+	t.Setenv("DEVICE_POSTURE_MAX_AGE", "24h")
+	t.Setenv("INTUNE_POSTURE_WEBHOOK_SECRET", "intune-secret")
+	t.Setenv("JAMF_POSTURE_WEBHOOK_SECRET", "")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.DevicePosture{}, &models.AuditLog{}, &models.AppSessionPolicy{}))
+
+	user := models.User{ID: uuid.New(), Email: "posture@example.com", Username: "posture"}
+	require.NoError(t, db.Create(&user).Error)
+	service := services.NewDevicePostureService(db)
+	now := time.Now()
+
+	_, err = service.RecordAttestation(services.PostureAttestation{DeviceID: "laptop-1", Email: "nobody@example.com"}, now)
+	assert.ErrorIs(t, err, services.ErrInvalidPosture)
+
+	// Intune covers encryption and OS version but not EDR, which the agent reports later
+	attestations, err := services.ParseIntuneDevices([]byte(`{"value":[{
+		"id":"intune-1","azureADDeviceId":"laptop-1","deviceName":"LAPTOP-1","userPrincipalName":"Posture@example.com",
+		"operatingSystem":"Windows","osVersion":"10.0.19041.1","isEncrypted":true,"complianceState":"compliant"}]}`))
+	require.NoError(t, err)
+	require.Len(t, attestations, 1)
+	posture, err := service.RecordAttestation(attestations[0], now)
+	require.NoError(t, err)
+	assert.Equal(t, "windows", posture.Platform)
+	assert.False(t, posture.Compliant)
+	assert.Contains(t, posture.Issues, "EDR not reported")
+	assert.Contains(t, posture.Issues, "older than 10.0.19045")
+
+	running, encrypted := true, false
+	posture, err = service.RecordAttestation(services.PostureAttestation{
+		DeviceID: "laptop-1", UserID: &user.ID, OSVersion: "10.0.22631", EDRRunning: &running, Source: models.PostureSourceAgent,
+	}, now)
+	require.NoError(t, err)
+	assert.True(t, posture.Compliant, "agent reports fill in what the MDM left out: %s", posture.Issues)
+	require.NotNil(t, posture.DiskEncrypted)
+	assert.True(t, *posture.DiskEncrypted)
+
+	compliance, err := service.CheckCompliance(user.ID, "laptop-1", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, compliance.Compliant)
+	compliance, err = service.CheckCompliance(user.ID, "laptop-1", now.Add(25*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, compliance.Compliant, "stale posture is not trusted")
+	compliance, err = service.CheckCompliance(user.ID, "unknown", now)
+	require.NoError(t, err)
+	assert.False(t, compliance.Compliant)
+	assert.Nil(t, compliance.Posture)
+
+	// High-sensitivity apps can require a compliant device
+	services.SetDevicePostureService(service)
+	t.Cleanup(func() { services.SetDevicePostureService(nil) })
+	services.RegisterSaaSApp(&types.SaaSApplication{ID: "finance", Name: "Finance"})
+	t.Cleanup(func() { services.RemoveSaaSApp("finance") })
+	policies := services.NewAppSessionPolicyService(db)
+	_, err = policies.SetPolicy("finance", services.AppSessionPolicyInput{RequireCompliantDevice: true}, nil)
+	require.NoError(t, err)
+	app, _ := services.GetSaaSApp("finance")
+
+	result, err := policies.CheckDevice(app, user.ID, "laptop-1", now)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	_, err = service.RecordAttestation(services.PostureAttestation{DeviceID: "laptop-1", UserID: &user.ID, DiskEncrypted: &encrypted}, now)
+	require.NoError(t, err)
+	result, err = policies.CheckDevice(app, user.ID, "laptop-1", now)
+	require.NoError(t, err)
+	assert.Equal(t, services.AppSessionDeviceNotCompliant, result.Error)
+	assert.Contains(t, result.Reason, "disk not encrypted")
+	result, err = policies.CheckDevice(app, user.ID, "", now)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "unidentified devices are not compliant")
+
+	// Webhooks are authenticated by their own secret and stay off until it is set
+	assert.NoError(t, service.VerifyWebhook(models.PostureSourceIntune, "Bearer intune-secret"))
+	assert.ErrorIs(t, service.VerifyWebhook(models.PostureSourceIntune, "Bearer wrong"), services.ErrPostureWebhookUnauthorized)
+	assert.ErrorIs(t, service.VerifyWebhook(models.PostureSourceJamf, "Bearer "), services.ErrPostureWebhookNotConfigured)
+
+	attestations, err = services.ParseJamfComputer([]byte(`{"udid":"MAC-1","general":{"name":"Mac"},
+		"userAndLocation":{"email":"posture@example.com"},"operatingSystem":{"name":"macOS","version":"14.4.1"},
+		"diskEncryption":{"bootPartitionEncryptionDetails":{"partitionFileVault2State":"ENCRYPTED"}}}`))
+	require.NoError(t, err)
+	posture, err = service.RecordAttestation(attestations[0], now)
+	require.NoError(t, err)
+	assert.Equal(t, "macos", posture.Platform)
+	assert.Equal(t, "EDR not reported", posture.Issues)
+}
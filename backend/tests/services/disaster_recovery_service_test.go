@@ -0,0 +1,93 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestDisasterRecoveryService(t *testing.T) (*services.DisasterRecoveryService, *gorm.DB, string) {
+	queueFile := filepath.Join(t.TempDir(), "dr-queue.jsonl")
+	t.Setenv("DR_QUEUE_FILE", queueFile)
+	t.Setenv("DR_MODE", "true")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AuditLog{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	originalDB := services.DB
+	services.DB = db
+	service := services.NewDisasterRecoveryService(db)
+	services.SetDisasterRecoveryService(service)
+	t.Cleanup(func() {
+		services.DB = originalDB
+		services.SetDisasterRecoveryService(nil)
+	})
+	return service, db, queueFile
+}
+
+func TestDisasterRecoveryService_QueuesWritesUntilDisabled(t *testing.T) {
+	service, db, queueFile := setupTestDisasterRecoveryService(t)
+	require.True(t, service.Enabled())
+	assert.True(t, services.DisasterRecoveryActive())
+
+	user := models.User{Email: "dana@example.com", Username: "dana"}
+	require.NoError(t, db.Create(&user).Error)
+	session := models.Session{UserID: user.ID, SessionToken: "refresh-token", ExpiresAt: time.Now().Add(time.Hour), IsActive: true}
+	require.NoError(t, db.Create(&session).Error)
+
+	services.LogAuditEvent(context.Background(), user.ID.String(), "login", "session", "", "203.0.113.1", "test", "", "success")
+	require.NoError(t, service.QueueLogout("refresh-token"))
+
+	var count int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Count(&count).Error)
+	assert.Zero(t, count, "audit writes are queued while in DR mode")
+	assert.True(t, service.LoggedOut("refresh-token"), "logouts take effect before they are replayed")
+	assert.Equal(t, 2, service.Status().QueuedOps)
+
+	// A restarted instance picks up the queue
+	assert.Equal(t, 2, services.NewDisasterRecoveryService(db).Status().QueuedOps)
+
+	replayed, err := service.Disable()
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.False(t, services.DisasterRecoveryActive())
+	assert.False(t, service.LoggedOut("refresh-token"))
+	assert.Zero(t, service.Status().QueuedOps)
+
+	var stored models.AuditLog
+	require.NoError(t, db.Where("user_id = ?", user.ID).First(&stored).Error)
+	assert.Equal(t, "login", stored.Action)
+	require.NoError(t, db.First(&session, "id = ?", session.ID).Error)
+	assert.False(t, session.IsActive)
+	_, err = os.Stat(queueFile)
+	assert.True(t, os.IsNotExist(err), "the queue is cleared once replayed")
+}
+
+func TestDisasterRecoveryService_KeepsFailedWritesQueued(t *testing.T) {
+	service, db, _ := setupTestDisasterRecoveryService(t)
+
+	services.LogAuditEvent(context.Background(), "", "config_viewed", "settings", "", "203.0.113.1", "test", "", "success")
+	require.NoError(t, db.Migrator().DropTable(&models.AuditLog{}))
+
+	replayed, err := service.Disable()
+	assert.Error(t, err)
+	assert.Zero(t, replayed)
+	assert.Equal(t, 1, service.Status().QueuedOps)
+
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	replayed, err = service.Replay()
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+}
@@ -0,0 +1,122 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestEmergencyService sets up an emergency service with an in-memory database
+func setupTestEmergencyService(t *testing.T) (*services.EmergencyService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AuditLog{}, &models.EmergencyLockdown{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewEmergencyService(db, nil), db
+}
+
+func createEmergencyTestSession(t *testing.T, db *gorm.DB, email string) models.Session {
+	user := models.User{ID: uuid.New(), Email: email, Username: email}
+	require.NoError(t, db.Create(&user).Error)
+
+	session := models.Session{
+		ID:           uuid.New(),
+		UserID:       user.ID,
+		SessionToken: uuid.NewString(),
+		ExpiresAt:    time.Now().Add(time.Hour),
+		IsActive:     true,
+	}
+	require.NoError(t, db.Create(&session).Error)
+	return session
+}
+
+func TestEmergencyService_TriggerSignoutDomain(t *testing.T) {
+	service, db := setupTestEmergencyService(t)
+	admin := uuid.New()
+
+	acme := createEmergencyTestSession(t, db, "alice@acme.com")
+	other := createEmergencyTestSession(t, db, "bob@example.org")
+
+	lockdown, err := service.TriggerSignout(services.EmergencySignoutInput{
+		Scope:      models.LockdownScopeDomain,
+		Domain:     "ACME.com",
+		Reason:     "Leaked IdP credentials",
+		RequireMFA: true,
+	}, &admin)
+	require.NoError(t, err)
+	assert.Equal(t, "acme.com", lockdown.Domain)
+	assert.Equal(t, int64(1), lockdown.SessionsRevoked)
+
+	var revokedSession, untouchedSession models.Session
+	require.NoError(t, db.First(&revokedSession, "id = ?", acme.ID).Error)
+	assert.False(t, revokedSession.IsActive)
+	require.NoError(t, db.First(&untouchedSession, "id = ?", other.ID).Error)
+	assert.True(t, untouchedSession.IsActive)
+
+	// Tokens issued before the lockdown are revoked, newer ones must step up to MFA
+	revoked, _, _ := service.CheckToken("alice@acme.com", time.Now().Add(-time.Minute))
+	assert.True(t, revoked)
+	revoked, requiredAAL, _ := service.CheckToken("alice@acme.com", time.Now().Add(time.Second))
+	assert.False(t, revoked)
+	assert.Equal(t, models.AAL2, requiredAAL)
+
+	revoked, requiredAAL, _ = service.CheckToken("bob@example.org", time.Now().Add(-time.Minute))
+	assert.False(t, revoked)
+	assert.Equal(t, models.AAL1, requiredAAL)
+
+	assert.NotNil(t, service.RefreshPausedUntil("alice@acme.com"))
+	assert.Nil(t, service.RefreshPausedUntil("bob@example.org"))
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "emergency_signout").Count(&audits)
+	assert.Equal(t, int64(1), audits)
+}
+
+func TestEmergencyService_InvalidScope(t *testing.T) {
+	service, _ := setupTestEmergencyService(t)
+
+	_, err := service.TriggerSignout(services.EmergencySignoutInput{Scope: models.LockdownScopeDomain, Reason: "test"}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidLockdownScope)
+
+	_, err = service.TriggerSignout(services.EmergencySignoutInput{Scope: "tenant", Reason: "test"}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidLockdownScope)
+}
+
+func TestEmergencyService_LiftLockdown(t *testing.T) {
+	service, db := setupTestEmergencyService(t)
+	createEmergencyTestSession(t, db, "carol@acme.com")
+
+	lockdown, err := service.TriggerSignout(services.EmergencySignoutInput{
+		Scope:  models.LockdownScopeGlobal,
+		Reason: "Signing key compromise",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), lockdown.SessionsRevoked)
+
+	revoked, _, _ := service.CheckToken("carol@acme.com", time.Now().Add(-time.Minute))
+	assert.True(t, revoked)
+
+	require.NoError(t, service.LiftLockdown(lockdown.ID, nil))
+	assert.ErrorIs(t, service.LiftLockdown(lockdown.ID, nil), services.ErrLockdownNotFound)
+
+	revoked, _, _ = service.CheckToken("carol@acme.com", time.Now().Add(-time.Minute))
+	assert.False(t, revoked)
+	assert.Nil(t, service.RefreshPausedUntil("carol@acme.com"))
+
+	active, err := service.ListLockdowns(true)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+	all, err := service.ListLockdowns(false)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
@@ -0,0 +1,117 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestEntityGraphService(t *testing.T) (*services.EntityGraphService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.LoginEvent{}, &models.TrustedDevice{}, &models.AppLaunchEvent{},
+		&models.AppConnection{}, &services.RiskAssessment{}, &services.DeviceFingerprint{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewEntityGraphService(db), db
+}
+
+func graphNode(graph *services.EntityGraph, id string) *services.EntityNode {
+	for i := range graph.Nodes {
+		if graph.Nodes[i].ID == id {
+			return &graph.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func TestEntityGraphService_Traverse(t *testing.T) {
+	service, db := setupTestEntityGraphService(t)
+	now := time.Now()
+	alice := models.User{Email: "alice@example.com", Username: "alice"}
+	bob := models.User{Email: "bob@example.com", Username: "bob"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+
+	const sharedIP = "203.0.113.50"
+	createTestSession(t, db, alice.ID, sharedIP, now.Add(-2*time.Hour))
+	createTestSession(t, db, alice.ID, sharedIP, now.Add(-time.Hour))
+	createTestSession(t, db, alice.ID, "198.51.100.1", now.AddDate(0, 0, -200)) // outside the window
+	require.NoError(t, db.Create(&models.LoginEvent{UserID: &bob.ID, Email: bob.Email, Success: false, Method: "password",
+		IPAddress: sharedIP, CreatedAt: now.Add(-30 * time.Minute)}).Error)
+	require.NoError(t, db.Create(&models.AppLaunchEvent{UserID: bob.ID, AppID: "salesforce", IPAddress: sharedIP, LaunchedAt: now}).Error)
+	require.NoError(t, db.Create(&models.TrustedDevice{ID: uuid.New(), UserID: bob.ID, DeviceName: "Bob's laptop", DeviceType: "desktop",
+		Fingerprint: "fp-shared", LastSeen: now}).Error)
+	require.NoError(t, db.Create(&services.RiskAssessment{ID: uuid.New(), UserID: alice.ID, DeviceFingerprint: "fp-shared",
+		RiskScore: 0.8, RiskLevel: "high", CreatedAt: now}).Error)
+
+	// What else did this IP touch?
+	graph, err := service.Traverse(services.EntityIP, sharedIP, services.EntityGraphQuery{Depth: 1}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "ip:"+sharedIP, graph.Root)
+	assert.Len(t, graph.Nodes, 4, "the IP, both users and the app")
+	aliceNode := graphNode(graph, "user:"+alice.ID.String())
+	require.NotNil(t, aliceNode)
+	assert.Equal(t, "alice@example.com", aliceNode.Label)
+	require.NotNil(t, aliceNode.RiskScore)
+	assert.Equal(t, "high", aliceNode.RiskLevel)
+	assert.NotNil(t, graphNode(graph, "app:salesforce"))
+	assert.Equal(t, int64(1), graphNode(graph, "ip:"+sharedIP).FailedLogins)
+
+	var sessionEdge *services.EntityEdge
+	for i := range graph.Edges {
+		if graph.Edges[i].From == "ip:"+sharedIP && graph.Edges[i].To == "user:"+alice.ID.String() {
+			sessionEdge = &graph.Edges[i]
+		}
+	}
+	require.NotNil(t, sessionEdge)
+	assert.Equal(t, int64(2), sessionEdge.Count)
+	assert.Equal(t, []string{"session"}, sessionEdge.Sources)
+	assert.WithinDuration(t, now.Add(-2*time.Hour), sessionEdge.FirstSeen, time.Second)
+	assert.WithinDuration(t, now.Add(-time.Hour), sessionEdge.LastSeen, time.Second)
+
+	// Which users share this device?
+	graph, err = service.Traverse(services.EntityDevice, "fp-shared", services.EntityGraphQuery{Depth: 1, Types: []string{services.EntityUser}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "Bob's laptop", graph.Nodes[0].Label)
+	assert.Len(t, graph.Nodes, 3)
+	assert.NotNil(t, graphNode(graph, "user:"+alice.ID.String()))
+	assert.NotNil(t, graphNode(graph, "user:"+bob.ID.String()))
+
+	// Two hops from alice reach bob through the shared IP and device
+	graph, err = service.Traverse(services.EntityUser, alice.ID.String(), services.EntityGraphQuery{Depth: 2}, now)
+	require.NoError(t, err)
+	bobNode := graphNode(graph, "user:"+bob.ID.String())
+	require.NotNil(t, bobNode)
+	assert.Equal(t, 2, bobNode.Depth)
+	assert.Nil(t, graphNode(graph, "ip:198.51.100.1"))
+
+	_, err = service.Traverse("printer", "x", services.EntityGraphQuery{Depth: 1}, now)
+	assert.ErrorIs(t, err, services.ErrUnknownEntityType)
+	_, err = service.Traverse(services.EntityIP, sharedIP, services.EntityGraphQuery{Depth: 4}, now)
+	assert.ErrorIs(t, err, services.ErrInvalidGraphQuery)
+}
+
+func TestEntityGraphService_NodeLimit(t *testing.T) {
+	t.Setenv("ENTITY_GRAPH_MAX_NODES", "3")
+	service, db := setupTestEntityGraphService(t)
+	now := time.Now()
+	userID := uuid.New()
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+		createTestSession(t, db, userID, ip, now.Add(-time.Hour))
+	}
+
+	graph, err := service.Traverse(services.EntityUser, userID.String(), services.EntityGraphQuery{Depth: 1}, now)
+	require.NoError(t, err)
+	assert.True(t, graph.Truncated)
+	assert.Len(t, graph.Nodes, 3)
+	assert.Len(t, graph.Edges, 2, "no edges to entities left out")
+}
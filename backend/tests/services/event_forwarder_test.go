@@ -0,0 +1,206 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// recordingSink keeps the events it is sent
+type recordingSink struct {
+	mutex  sync.Mutex
+	events []services.SIEMEvent
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(_ context.Context, events []services.SIEMEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func TestEventForwarder_DeliversToSinks(t *testing.T) {
+	t.Setenv("SIEM_BATCH_SIZE", "2")
+	t.Setenv("SIEM_FLUSH_INTERVAL", "20ms")
+	t.Setenv("SIEM_RETRY_BACKOFF", "1ms")
+
+	// Splunk is busy the first time and takes the batch on the retry
+	var mutex sync.Mutex
+	var hecCalls int
+	var hecEvents []map[string]interface{}
+	hec := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, "/services/collector/event", r.URL.Path)
+		assert.Equal(t, "Splunk hec-token", r.Header.Get("Authorization"))
+		hecCalls++
+		if hecCalls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		for {
+			var envelope map[string]interface{}
+			if err := decoder.Decode(&envelope); err == io.EOF {
+				break
+			} else if !assert.NoError(t, err) {
+				break
+			}
+			hecEvents = append(hecEvents, envelope)
+		}
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer hec.Close()
+
+	// Elasticsearch throttles the first document and refuses the second for good
+	var bulkBodies []string
+	elastic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		assert.Equal(t, "ApiKey elastic-key", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		bulkBodies = append(bulkBodies, string(body))
+		if len(bulkBodies) == 1 {
+			w.Write([]byte(`{"errors":true,"items":[` +
+				`{"create":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"busy"}}},` +
+				`{"create":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad field"}}}]}`))
+			return
+		}
+		w.Write([]byte(`{"errors":false,"items":[{"create":{"status":201}}]}`))
+	}))
+	defer elastic.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	frames := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				return
+			}
+			frames <- string(frame)
+		}
+	}()
+
+	splunk := services.NewSplunkHECSink(hec.URL, "hec-token")
+	splunk.Host = "gateway-1"
+	elasticSink := services.NewElasticsearchSink(elastic.URL, "cloudgate-events")
+	elasticSink.APIKey = "elastic-key"
+	syslog := services.NewSyslogSink("tcp", listener.Addr().String())
+	syslog.Hostname = "gateway-1"
+	forwarder := services.NewEventForwarder(splunk, elasticSink, syslog)
+
+	// Audit logs are forwarded whoever writes them
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	services.NewAuditService(db).SetEventForwarder(forwarder)
+	userID := uuid.New()
+	require.NoError(t, db.Create(&models.AuditLog{UserID: &userID, Action: "login", Status: "failure", IPAddress: "203.0.113.7", Details: `bad "password"`}).Error)
+	require.NoError(t, db.Create(&models.AuditLog{UserID: &userID, Action: "mfa_disabled", Resource: "user", Status: "success"}).Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		forwarder.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		stats := forwarder.Stats()
+		return stats[0].Sent == 2 && stats[1].Sent+stats[1].Failed == 2 && stats[2].Sent == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	stats := forwarder.Stats()
+	assert.Equal(t, "splunk_hec", stats[0].Sink)
+	assert.Equal(t, int64(1), stats[1].Sent)
+	assert.Equal(t, int64(1), stats[1].Failed, "a refused document is not retried")
+	assert.Contains(t, stats[1].LastError, "mapper_parsing_exception")
+	assert.NoError(t, forwarder.Health(), "every sink delivered after its last failure")
+
+	mutex.Lock()
+	assert.Equal(t, 2, hecCalls)
+	require.Len(t, hecEvents, 2)
+	assert.Equal(t, "gateway-1", hecEvents[0]["host"])
+	assert.Equal(t, "cloudgate:audit_log", hecEvents[0]["source"])
+	event := hecEvents[0]["event"].(map[string]interface{})
+	assert.Equal(t, "login", event["type"])
+	assert.Equal(t, "medium", event["severity"])
+	assert.Equal(t, userID.String(), event["user_id"])
+	require.Len(t, bulkBodies, 2)
+	assert.Equal(t, 4, strings.Count(bulkBodies[0], "\n"), "an action and a document line per event")
+	assert.Contains(t, bulkBodies[0], `"@timestamp"`)
+	assert.Equal(t, 2, strings.Count(bulkBodies[1], "\n"), "only the throttled document is sent again")
+	assert.Contains(t, bulkBodies[1], `"type":"login"`)
+	mutex.Unlock()
+
+	first := <-frames
+	assert.True(t, strings.HasPrefix(first, "<84>1 "), "authpriv warning: %s", first)
+	assert.Contains(t, first, " gateway-1 cloudgate ")
+	assert.Contains(t, first, " audit_log [cloudgate@32473 id=")
+	assert.Contains(t, first, `type="login" severity="medium" outcome="failure" user_id="`+userID.String()+`" ip="203.0.113.7"]`)
+	assert.Contains(t, first, `"message":"bad \"password\""`)
+	second := <-frames
+	assert.True(t, strings.HasPrefix(second, "<86>1 "), "authpriv info: %s", second)
+}
+
+func TestEventForwarder_DropsOldestWhenFull(t *testing.T) {
+	t.Setenv("SIEM_QUEUE_SIZE", "2")
+	sink := &recordingSink{}
+	forwarder := services.NewEventForwarder(sink)
+
+	for i := 1; i <= 5; i++ {
+		forwarder.Forward(services.SIEMEvent{ID: strconv.Itoa(i), Kind: services.SIEMKindSecurityAlert, Timestamp: time.Now()})
+	}
+	stats := forwarder.Stats()
+	assert.Equal(t, 2, stats[0].Queued)
+	assert.Equal(t, int64(3), stats[0].Dropped)
+
+	// Stopping delivers what is still queued
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	forwarder.Run(ctx)
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, "4", sink.events[0].ID)
+	assert.Equal(t, "5", sink.events[1].ID)
+	assert.Equal(t, int64(2), forwarder.Stats()[0].Sent)
+
+	var none *services.EventForwarder
+	none.Forward(services.SIEMEvent{ID: "ignored"})
+}
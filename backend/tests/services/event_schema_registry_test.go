@@ -0,0 +1,81 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/services"
+)
+
+func TestEventSchemaRegistry_UpgradesDeprecatedVersions(t *testing.T) {
+	registry := services.NewEventSchemaRegistry()
+	assert.Equal(t, 2, registry.CurrentVersion(services.EventKindLogin))
+
+	event, err := registry.Normalize(services.EventKindLogin, 1, map[string]interface{}{
+		"user_id":    "7f0c3f4e-8d2a-4f51-9a4c-3b7f0e8f1a2b",
+		"email":      "alice@example.com",
+		"ip_address": "203.0.113.7",
+		"user_agent": "curl/8.0",
+		"success":    true,
+		"region":     "eu-west-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, event.Version)
+	assert.True(t, event.Deprecated)
+	assert.Equal(t, "success", event.Payload["outcome"])
+	assert.NotContains(t, event.Payload, "success")
+	assert.NotContains(t, event.Payload, "region", "unknown fields are dropped")
+	require.Len(t, event.Warnings, 2)
+	assert.Contains(t, event.Warnings[0], "deprecated")
+	assert.Contains(t, event.Warnings[1], "region")
+
+	// A missing success flag was a failed login in v1
+	event, err = registry.Normalize(services.EventKindLogin, 1, map[string]interface{}{
+		"user_id": "7f0c3f4e-8d2a-4f51-9a4c-3b7f0e8f1a2b", "email": "alice@example.com", "ip_address": "203.0.113.7", "user_agent": "curl/8.0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "failure", event.Payload["outcome"])
+
+	event, err = registry.Normalize(services.EventKindLogin, 2, map[string]interface{}{
+		"user_id": "7f0c3f4e-8d2a-4f51-9a4c-3b7f0e8f1a2b", "email": "alice@example.com", "ip_address": "203.0.113.7", "user_agent": "curl/8.0", "outcome": "failure",
+	})
+	require.NoError(t, err)
+	assert.False(t, event.Deprecated)
+	assert.Empty(t, event.Warnings)
+}
+
+func TestEventSchemaRegistry_RejectsInvalidEvents(t *testing.T) {
+	registry := services.NewEventSchemaRegistry()
+
+	_, err := registry.Normalize(services.EventKindLogin, 2, map[string]interface{}{
+		"user_id": "not-a-uuid", "email": "alice@example.com", "ip_address": "203.0.113.7", "user_agent": "curl/8.0", "outcome": "maybe",
+	})
+	assert.ErrorIs(t, err, services.ErrEventSchemaMismatch)
+	assert.ErrorContains(t, err, "user_id must be a UUID")
+	assert.ErrorContains(t, err, "outcome must be one of success, failure")
+
+	_, err = registry.Normalize(services.EventKindAPI, 1, map[string]interface{}{
+		"endpoint": "/api/v1/apps", "method": "GET", "ip_address": "203.0.113.7", "user_agent": "curl/8.0", "status_code": 200.5,
+	})
+	assert.ErrorContains(t, err, "status_code must be an integer")
+	assert.ErrorContains(t, err, "response_time_ms is required")
+
+	_, err = registry.Normalize(services.EventKindSecurity, 1, map[string]interface{}{
+		"event_type": "ids.scan", "severity": "low", "title": "Port scan", "attributes": map[string]interface{}{"port": 22.0},
+	})
+	assert.ErrorContains(t, err, "attributes must only have string values")
+
+	_, err = registry.Normalize(services.EventKindAPI, 3, map[string]interface{}{})
+	assert.ErrorIs(t, err, services.ErrUnknownEventSchema)
+
+	version, err := services.ParseEventSchemaVersion("v2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	version, err = services.ParseEventSchemaVersion("")
+	require.NoError(t, err)
+	assert.Equal(t, 1, version, "unversioned producers send the original schemas")
+	_, err = services.ParseEventSchemaVersion("latest")
+	assert.ErrorIs(t, err, services.ErrUnknownEventSchema)
+}
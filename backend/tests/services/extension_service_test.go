@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestExtensionService(t *testing.T) (*services.ExtensionService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.ExtensionDomainReport{}, &models.SecurityEvent{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	services.InitializeSaaSApps()
+	return services.NewExtensionService(db, nil), db
+}
+
+func TestExtensionService_ReportDomains(t *testing.T) {
+	service, db := setupTestExtensionService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	result, err := service.ReportDomains(userID, []services.ExtensionDomainInput{
+		{Domain: "https://www.Canva.com/design", Visits: 3},
+		{Domain: "canva.com:443", LoginForm: true},
+		{Domain: "mail.google.com"},
+		{Domain: "192.168.1.10"},
+		{Domain: "localhost"},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Accepted)
+	assert.Equal(t, 1, result.Known)
+	assert.Equal(t, 2, result.Rejected)
+
+	var reports []models.ExtensionDomainReport
+	require.NoError(t, db.Find(&reports).Error)
+	require.Len(t, reports, 1)
+	assert.Equal(t, "canva.com", reports[0].Domain)
+	assert.Equal(t, int64(4), reports[0].Visits)
+	assert.Equal(t, int64(1), reports[0].LoginForms)
+
+	_, err = service.ReportDomains(userID, nil, now)
+	assert.ErrorIs(t, err, services.ErrInvalidExtensionReport)
+}
+
+func TestExtensionService_ReportEvents(t *testing.T) {
+	service, db := setupTestExtensionService(t)
+	userID := uuid.New()
+	source := services.TokenSource{Provider: "browser_extension", IPAddress: "203.0.113.7"}
+
+	_, err := service.ReportEvents(userID, []services.ExtensionEventInput{
+		{Type: "password_reuse", URL: "https://login.example.net"},
+		{Type: "keylogger"},
+	}, source, time.Now())
+	assert.ErrorIs(t, err, services.ErrInvalidExtensionReport)
+
+	recorded, err := service.ReportEvents(userID, []services.ExtensionEventInput{
+		{Type: "phishing_suspected", URL: "https://cloudgate-login.example.net/signin", Description: "Page copies the CloudGate sign-in"},
+	}, source, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, recorded)
+
+	var events []models.SecurityEvent
+	require.NoError(t, db.Find(&events).Error)
+	require.Len(t, events, 1)
+	assert.Equal(t, "extension_phishing_suspected", events[0].EventType)
+	assert.Equal(t, models.SeverityHigh, events[0].Severity)
+	assert.Contains(t, events[0].Description, "cloudgate-login.example.net")
+	assert.Equal(t, "203.0.113.7", events[0].IPAddress)
+}
+
+func TestExtensionService_Apps(t *testing.T) {
+	service, _ := setupTestExtensionService(t)
+
+	apps := service.Apps(1, "https://gate.example.com/")
+	require.NotEmpty(t, apps)
+	for _, app := range apps {
+		if app.ID == "intranet-portal" {
+			assert.Equal(t, "https://gate.example.com/proxy/intranet-portal/", app.LaunchURL)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// fakeScanner flags any file containing the EICAR test string
+type fakeScanner struct{}
+
+func (fakeScanner) Scan(ctx context.Context, filename string, content []byte) (bool, string, error) {
+	if strings.Contains(string(content), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+		return true, "Eicar-Test-Signature", nil
+	}
+	return false, "", nil
+}
+
+func setupTestFileUploadService(t *testing.T, scanner services.MalwareScanner) (*services.FileUploadService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.FileUpload{}, &models.AuditLog{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	store := services.NewLocalObjectStore(t.TempDir(), "http://localhost:8081/files")
+	return services.NewFileUploadService(db, store, scanner, nil), db
+}
+
+func TestFileUploadService_UploadAndDownload(t *testing.T) {
+	service, _ := setupTestFileUploadService(t, fakeScanner{})
+	analyst := uuid.New()
+	now := time.Now()
+	ctx := context.Background()
+
+	upload, err := service.Upload(ctx, services.UploadInput{
+		Purpose:    models.UploadPurposeBulkImport,
+		Filename:   "../../etc/users.csv",
+		Content:    []byte("email,name\nalice@example.com,Alice\n"),
+		UploadedBy: &analyst,
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "users.csv", upload.Filename)
+	assert.Equal(t, "text/plain", upload.ContentType)
+	assert.Equal(t, models.UploadScanClean, upload.ScanStatus)
+	assert.WithinDuration(t, now.Add(7*24*time.Hour), upload.ExpiresAt, time.Second)
+
+	// The signed URL opens the file until it expires, and not with another filename
+	signed, expiresAt, err := service.DownloadURL(upload.ID, &analyst, now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(15*time.Minute), expiresAt, time.Second)
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	key := strings.TrimPrefix(parsed.Path, "/files/")
+	query := parsed.Query()
+	store := service.LocalStore()
+	file, err := store.Open(key, query.Get("filename"), query.Get("expires"), query.Get("signature"), now)
+	require.NoError(t, err)
+	file.Close()
+	_, err = store.Open(key, "other.csv", query.Get("expires"), query.Get("signature"), now)
+	assert.ErrorIs(t, err, services.ErrInvalidSignedURL)
+	_, err = store.Open(key, query.Get("filename"), query.Get("expires"), query.Get("signature"), now.Add(time.Hour))
+	assert.ErrorIs(t, err, services.ErrInvalidSignedURL)
+
+	// Retention removes the file from storage
+	purged, err := service.PurgeExpired(ctx, now.Add(8*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = service.Get(upload.ID, now)
+	assert.ErrorIs(t, err, services.ErrUploadNotFound)
+	_, err = store.Open(key, query.Get("filename"), query.Get("expires"), query.Get("signature"), now)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFileUploadService_RejectsUnsafeFiles(t *testing.T) {
+	service, db := setupTestFileUploadService(t, fakeScanner{})
+	now := time.Now()
+	ctx := context.Background()
+	upload := func(purpose string, content []byte) error {
+		_, err := service.Upload(ctx, services.UploadInput{Purpose: purpose, Filename: "file", Content: content}, now)
+		return err
+	}
+
+	assert.ErrorIs(t, upload(models.UploadPurposeCaseEvidence, []byte("\x7fELF\x02\x01\x01")), services.ErrUploadTypeNotAllowed)
+	assert.ErrorIs(t, upload(models.UploadPurposeCaseEvidence, []byte("#!/bin/sh\nrm -rf /\n")), services.ErrUploadTypeNotAllowed)
+	assert.ErrorIs(t, upload(models.UploadPurposeBulkImport, []byte("%PDF-1.7\n")), services.ErrUploadTypeNotAllowed,
+		"the sniffed type decides, whatever the file is called")
+	assert.ErrorIs(t, upload(models.UploadPurposeBulkImport, make([]byte, 10<<20+1)), services.ErrUploadTooLarge)
+	assert.ErrorIs(t, upload(models.UploadPurposeBulkImport, nil), services.ErrInvalidUpload)
+	assert.ErrorIs(t, upload("avatar", []byte("hello")), services.ErrInvalidUpload)
+	assert.ErrorIs(t, upload(models.UploadPurposeCaseEvidence, []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)), services.ErrUploadInfected)
+
+	// Text that merely starts with MZ is not an executable
+	assert.NoError(t, upload(models.UploadPurposeBulkImport, []byte("MZ,region\nnorth,1\n")))
+	assert.NoError(t, upload(models.UploadPurposeComplianceReport, []byte("%PDF-1.7\n")))
+
+	var rejected int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("action = ?", "file_upload_rejected").Count(&rejected).Error)
+	assert.Equal(t, int64(1), rejected)
+}
+
+func TestGCSObjectStore_SignsRequests(t *testing.T) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	store := services.NewGCSObjectStore("evidence", "GOOG1EXAMPLE", "secret", server.URL)
+	require.NoError(t, store.Put(context.Background(), "case_evidence/2026/10/report.pdf", "application/pdf", []byte("%PDF-1.7")))
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPut, requests[0].Method)
+	assert.Equal(t, "/evidence/case_evidence/2026/10/report.pdf", requests[0].URL.Path)
+	query := requests[0].URL.Query()
+	assert.Equal(t, "GOOG4-HMAC-SHA256", query.Get("X-Goog-Algorithm"))
+	assert.True(t, strings.HasPrefix(query.Get("X-Goog-Credential"), "GOOG1EXAMPLE/"))
+	assert.Len(t, query.Get("X-Goog-Signature"), 64)
+
+	signed, err := store.SignedURL("case_evidence/2026/10/report.pdf", "report.pdf", 30*24*time.Hour, time.Now())
+	require.NoError(t, err)
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "604800", parsed.Query().Get("X-Goog-Expires"), "signed URLs are capped at seven days")
+	assert.Equal(t, `attachment; filename="report.pdf"`, parsed.Query().Get("response-content-disposition"))
+
+	_, err = services.NewGCSObjectStore("evidence", "", "", server.URL).SignedURL("key", "file", time.Minute, time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/services"
+)
+
+// countingGeoIP answers from a fixed table and counts lookups
+type countingGeoIP struct {
+	locations map[string]*services.GeoLocation
+	err       error
+	lookups   int
+}
+
+func (g *countingGeoIP) Lookup(ctx context.Context, ipAddress string) (*services.GeoLocation, error) {
+	g.lookups++
+	if g.err != nil {
+		return nil, g.err
+	}
+	if location, ok := g.locations[ipAddress]; ok {
+		return location, nil
+	}
+	return nil, services.ErrGeoIPNotFound
+}
+
+func TestGeoIPService_IPAPILookups(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.URL.Query().Get("key"))
+		switch strings.TrimPrefix(r.URL.Path, "/json/") {
+		case "203.0.113.9":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "success", "countryCode": "DE", "regionName": "Hesse", "city": "Frankfurt am Main",
+				"lat": 50.11, "lon": 8.68, "timezone": "Europe/Berlin", "isp": "Hetzner Online GmbH",
+				"as": "AS24940 Hetzner Online GmbH", "asname": "HETZNER-AS", "proxy": false, "hosting": true,
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"status": "fail", "message": "reserved range"})
+		}
+	}))
+	defer server.Close()
+	provider := services.NewIPAPIGeoIP(server.URL, "secret")
+
+	location, err := provider.Lookup(context.Background(), "203.0.113.9")
+	require.NoError(t, err)
+	assert.Equal(t, "DE", location.Country)
+	assert.Equal(t, "Frankfurt am Main", location.City)
+	assert.Equal(t, uint(24940), location.ASN)
+	assert.Equal(t, "HETZNER-AS", location.ASOrganization)
+	assert.True(t, location.VPNDetected, "hosting networks count as anonymizing")
+
+	_, err = provider.Lookup(context.Background(), "198.51.100.1")
+	assert.ErrorIs(t, err, services.ErrGeoIPNotFound)
+}
+
+func TestGeoIPService_CachesLookups(t *testing.T) {
+	provider := &countingGeoIP{locations: map[string]*services.GeoLocation{
+		"203.0.113.9": {Country: "DE", City: "Frankfurt am Main"},
+	}}
+	cache := services.NewCachedGeoIP(provider, time.Hour, 2)
+
+	for i := 0; i < 3; i++ {
+		location, err := cache.Lookup(context.Background(), "203.0.113.9")
+		require.NoError(t, err)
+		assert.Equal(t, "DE", location.Country)
+		location.Country = "changed"
+	}
+	for i := 0; i < 2; i++ {
+		_, err := cache.Lookup(context.Background(), "198.51.100.1")
+		assert.ErrorIs(t, err, services.ErrGeoIPNotFound)
+	}
+	assert.Equal(t, 2, provider.lookups, "hits and misses are both cached")
+
+	provider.err = errors.New("provider unavailable")
+	for i := 0; i < 2; i++ {
+		_, err := cache.Lookup(context.Background(), "192.0.2.7")
+		assert.EqualError(t, err, "provider unavailable")
+	}
+	assert.Equal(t, 4, provider.lookups, "provider failures are not cached")
+}
+
+func TestGeoIPService_SuspiciousLocationAlerts(t *testing.T) {
+	monitoring, _ := setupTestSecurityMonitoringService(t)
+	services.SetGeoIPService(&countingGeoIP{locations: map[string]*services.GeoLocation{
+		"203.0.113.50": {Country: "KP", City: "Pyongyang", ASN: 131279, ASOrganization: "Star Joint Venture"},
+		"203.0.113.9":  {Country: "DE", City: "Frankfurt am Main"},
+	}})
+	t.Cleanup(func() { services.SetGeoIPService(nil) })
+
+	assert.Nil(t, services.LocateIP(context.Background(), "10.0.0.1"), "private addresses are not looked up")
+	assert.Equal(t, "DE", services.LocateIP(context.Background(), "203.0.113.9").Country)
+
+	alerts := monitoring.Subscribe("geoip-test")
+	defer monitoring.Unsubscribe("geoip-test")
+	require.NoError(t, monitoring.ProcessLoginEvent(context.Background(), uuid.New(), "traveller@example.com", "203.0.113.9", "Mozilla/5.0", true, 0))
+	require.NoError(t, monitoring.ProcessLoginEvent(context.Background(), uuid.New(), "victim@example.com", "203.0.113.50", "Mozilla/5.0", true, 0))
+
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, services.AlertTypeSuspiciousLocation, alert.Type)
+		assert.Contains(t, alert.Description, "Pyongyang, KP")
+		assert.Equal(t, "KP", alert.Metadata["country"])
+		assert.EqualValues(t, 131279, alert.Metadata["asn"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("no suspicious location alert")
+	}
+}
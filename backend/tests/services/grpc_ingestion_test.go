@@ -0,0 +1,182 @@
+package services_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"cloudgate-backend/internal/grpcapi"
+	"cloudgate-backend/internal/grpcapi/eventsv1"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// issueKeyPair issues a certificate with its key, for either end of a TLS connection
+func (ca *testCA) issueKeyPair(t *testing.T, commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// setupTestEventIngestion serves the gRPC API over mTLS in memory and returns a client
+// authenticated as a service account with the given scopes and rate limit
+func setupTestEventIngestion(t *testing.T, scopes []string, rateLimit int) (eventsv1.EventIngestionClient, *services.SecurityMonitoringService) {
+	ca := newTestCA(t, "Service CA")
+	accounts, _ := setupTestServiceAccountService(t, ca)
+	security, _ := setupTestSecurityMonitoringService(t)
+	_, err := accounts.CreateAccount(services.ServiceAccountInput{
+		Name: "siem-connector", CertSubject: "siem-connector", Scopes: scopes, Enabled: true, EventRateLimit: rateLimit,
+	}, nil)
+	require.NoError(t, err)
+
+	serverCert := ca.issueKeyPair(t, "cloudgate-events", x509.ExtKeyUsageServerAuth)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	serverTLS, err := accounts.ServerTLSConfig(certFile, keyFile)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	eventsv1.RegisterEventIngestionServer(server, grpcapi.NewServer(security, accounts, services.NewEventQuota()))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientTLS := &tls.Config{
+		Certificates: []tls.Certificate{ca.issueKeyPair(t, "siem-connector", x509.ExtKeyUsageClientAuth)},
+		RootCAs:      roots,
+		ServerName:   "cloudgate-events",
+	}
+	conn, err := grpc.NewClient("passthrough:///cloudgate-events",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return eventsv1.NewEventIngestionClient(conn), security
+}
+
+func externalAlerts(t *testing.T, security *services.SecurityMonitoringService) []services.SecurityAlert {
+	alertType := services.AlertTypeExternalEvent
+	alerts, err := security.GetAlerts(services.AlertFilters{Type: &alertType, Limit: 50})
+	require.NoError(t, err)
+	return alerts
+}
+
+func TestEventIngestion_ProcessSecurityEvent(t *testing.T) {
+	client, security := setupTestEventIngestion(t, []string{services.ServiceScopeSecurityEvents}, 0)
+	ctx := context.Background()
+
+	_, err := client.ProcessSecurityEvent(ctx, &eventsv1.SecurityEvent{
+		EventType:  "edr.malware_detected",
+		Severity:   eventsv1.Severity_SEVERITY_HIGH,
+		Title:      "Malware detected on laptop",
+		IpAddress:  "10.4.5.6",
+		Attributes: map[string]string{"host": "lt-0042", "source": "spoofed"},
+	})
+	require.NoError(t, err)
+
+	var alerts []services.SecurityAlert
+	require.Eventually(t, func() bool {
+		alerts = externalAlerts(t, security)
+		return len(alerts) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, services.SeverityHigh, alerts[0].Severity)
+	assert.Equal(t, "siem-connector", alerts[0].Metadata["source"], "the caller cannot override its own name")
+	assert.Equal(t, "lt-0042", alerts[0].Metadata["host"])
+
+	_, err = client.ProcessSecurityEvent(ctx, &eventsv1.SecurityEvent{EventType: "edr.malware_detected", Title: "No severity"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ProcessLoginEvent(ctx, &eventsv1.LoginEvent{UserId: "not-checked", Email: "a@example.com"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "the account lacks the login scope")
+}
+
+func TestEventIngestion_StreamEvents(t *testing.T) {
+	client, security := setupTestEventIngestion(t, []string{services.ServiceScopeSecurityEvents}, 0)
+
+	stream, err := client.StreamEvents(context.Background())
+	require.NoError(t, err)
+	events := []*eventsv1.Event{
+		{Event: &eventsv1.Event_Security{Security: &eventsv1.SecurityEvent{EventType: "ids.scan", Severity: eventsv1.Severity_SEVERITY_LOW, Title: "Port scan"}}},
+		{Event: &eventsv1.Event_Security{Security: &eventsv1.SecurityEvent{EventType: "ids.scan", Severity: eventsv1.Severity_SEVERITY_LOW}}},
+		{Event: &eventsv1.Event_Login{Login: &eventsv1.LoginEvent{Email: "a@example.com"}}},
+		{Event: &eventsv1.Event_Security{Security: &eventsv1.SecurityEvent{EventType: "ids.scan", Severity: eventsv1.Severity_SEVERITY_MEDIUM, Title: "Repeated port scan"}}},
+	}
+	for _, event := range events {
+		require.NoError(t, stream.Send(event))
+	}
+	response, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), response.Accepted)
+	assert.Equal(t, int64(2), response.Rejected)
+	require.Len(t, response.Errors, 2)
+	assert.Equal(t, int64(1), response.Errors[0].Index)
+	assert.Equal(t, int64(2), response.Errors[1].Index)
+	assert.Contains(t, response.Errors[1].Message, services.ServiceScopeLoginEvents)
+	require.Eventually(t, func() bool { return len(externalAlerts(t, security)) == 2 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestEventIngestion_EnforcesAccountQuota(t *testing.T) {
+	client, _ := setupTestEventIngestion(t, []string{services.ServiceScopeSecurityEvents}, 2)
+	event := &eventsv1.SecurityEvent{EventType: "ids.scan", Severity: eventsv1.Severity_SEVERITY_LOW, Title: "Port scan"}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.ProcessSecurityEvent(context.Background(), event)
+		require.NoError(t, err)
+	}
+	_, err := client.ProcessSecurityEvent(context.Background(), event)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestEventQuota_RefillsPerSecond(t *testing.T) {
+	t.Setenv("SERVICE_EVENT_RATE_LIMIT", "2")
+	quota := services.NewEventQuota()
+	account := &models.ServiceAccount{ID: [16]byte{1}}
+	now := time.Now()
+
+	assert.True(t, quota.Allow(account, now))
+	assert.True(t, quota.Allow(account, now))
+	assert.False(t, quota.Allow(account, now))
+	assert.True(t, quota.Allow(account, now.Add(500*time.Millisecond)), "half a second refills one event")
+	assert.False(t, quota.Allow(account, now.Add(500*time.Millisecond)))
+
+	account.EventRateLimit = 10
+	assert.True(t, quota.Allow(account, now.Add(time.Second)), "the account's own limit replaces the default")
+}
@@ -0,0 +1,92 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestHealthService_Check(t *testing.T) {
+	var keycloakDown atomic.Bool
+	keycloak := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keycloakDown.Load() || r.URL.Path != "/realms/cloudgate/.well-known/openid-configuration" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer keycloak.Close()
+	t.Setenv("KEYCLOAK_ISSUER", keycloak.URL+"/realms/cloudgate")
+	t.Setenv("HEALTH_WORKER_STALL_AFTER", "100ms")
+
+	_, addr := startFakeRedis(t, "")
+	redis, err := services.NewRedisCache("redis://" + addr)
+	require.NoError(t, err)
+	defer redis.Close()
+	services.SetCache(redis)
+	t.Cleanup(func() { services.SetCache(services.NewMemoryCache(100)) })
+
+	db, err := gorm.Open(sqlite.Open("file:healthcheck?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.JobLease{}))
+	workers := services.NewWorkers(context.Background())
+	release := make(chan struct{})
+	var stuck atomic.Bool
+	workers.Go(func(ctx context.Context) {
+		services.NewLockService(db).RunPeriodic(ctx, "probe_job", 10*time.Millisecond, func() error {
+			if stuck.Load() {
+				<-release
+			}
+			return nil
+		})
+	})
+	health := services.NewHealthService(db, workers)
+
+	report := health.Check(context.Background())
+	assert.Equal(t, services.HealthReady, report.Status)
+	for _, name := range []string{"database", "redis", "keycloak", "workers"} {
+		assert.Equal(t, services.DependencyUp, report.Checks[name].Status, name)
+	}
+
+	// Keycloak being unreachable degrades the instance but keeps it in rotation
+	keycloakDown.Store(true)
+	report = health.Check(context.Background())
+	assert.Equal(t, services.HealthDegraded, report.Status)
+	assert.True(t, report.Ready())
+	assert.Equal(t, services.DependencyDown, report.Checks["keycloak"].Status)
+	assert.Contains(t, report.Checks["keycloak"].Error, "503")
+
+	// A loop stuck in its job stops sending heartbeats
+	stuck.Store(true)
+	assert.Eventually(t, func() bool {
+		return health.Check(context.Background()).Status == services.HealthNotReady
+	}, 2*time.Second, 20*time.Millisecond)
+	report = health.Check(context.Background())
+	assert.False(t, report.Ready())
+	assert.Contains(t, report.Checks["workers"].Error, "probe_job")
+
+	close(release)
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, workers.Stop(stopCtx))
+	assert.Contains(t, health.Check(context.Background()).Checks["workers"].Error, "stopping")
+
+	// Without Redis or Keycloak configured those checks are skipped
+	services.SetCache(services.NewMemoryCache(100))
+	t.Setenv("KEYCLOAK_ISSUER", "")
+	report = services.NewHealthService(db, nil).Check(context.Background())
+	assert.Equal(t, services.HealthReady, report.Status)
+	assert.Equal(t, services.DependencyDisabled, report.Checks["redis"].Status)
+	assert.Equal(t, services.DependencyDisabled, report.Checks["keycloak"].Status)
+}
@@ -0,0 +1,181 @@
+package services_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestIdPRiskService(t *testing.T) (*services.IdPRiskSignalService, *gorm.DB) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.IdPRiskSignal{}, &models.AppConnection{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&models.IdPRiskSignal{}, &models.AppConnection{}) })
+	return services.NewIdPRiskSignalService(db, monitoring), db
+}
+
+func TestIdPRiskSignalService_GoogleSecurityEvents(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "risc-1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+	t.Setenv("GOOGLE_RISC_AUDIENCE", "client-1.apps.googleusercontent.com")
+	t.Setenv("GOOGLE_RISC_JWKS_URL", jwks.URL)
+
+	risk, db := setupTestIdPRiskService(t)
+	require.True(t, risk.GoogleEnabled())
+	user := models.User{ID: uuid.New(), Email: "hijacked@example.com", Username: "hijacked", IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+	linked := models.User{ID: uuid.New(), Email: "linked@corp.example", Username: "linked", IsActive: true}
+	require.NoError(t, db.Create(&linked).Error)
+	require.NoError(t, db.Create(&models.AppConnection{
+		ID: uuid.New(), UserID: linked.ID, AppID: "google-workspace", AppName: "Google Workspace", Provider: "google",
+		Status: "connected", Extras: `{"google_user_id":"1093847561"}`,
+	}).Error)
+
+	now := time.Now()
+	sign := func(audience, jti string, events map[string]interface{}) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":    "https://accounts.google.com/",
+			"aud":    audience,
+			"iat":    now.Unix(),
+			"jti":    jti,
+			"events": events,
+		})
+		token.Header["kid"] = "risc-1"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	hijacking := map[string]interface{}{
+		"https://schemas.openid.net/secevent/risc/event-type/account-disabled": map[string]interface{}{
+			"subject": map[string]string{"subject_type": "email", "email": "Hijacked@example.com"},
+			"reason":  "hijacking",
+		},
+	}
+
+	signals, err := risk.ReceiveGoogleEvent(context.Background(), sign("client-1.apps.googleusercontent.com", "jti-1", hijacking), now)
+	require.NoError(t, err)
+	require.Len(t, signals, 1)
+	assert.Equal(t, services.IdPRiskHigh, signals[0].RiskLevel)
+	assert.Equal(t, "account-disabled", signals[0].EventType)
+	require.NotNil(t, signals[0].UserID)
+	assert.Equal(t, user.ID, *signals[0].UserID)
+	assert.NotNil(t, signals[0].AlertID, "risky users raise an alert")
+
+	var assessment services.RiskAssessment
+	require.NoError(t, db.Where("user_id = ?", user.ID).First(&assessment).Error)
+	assert.InDelta(t, 0.9, assessment.RiskScore, 0.001)
+
+	signals, err = risk.ReceiveGoogleEvent(context.Background(), sign("client-1.apps.googleusercontent.com", "jti-1", hijacking), now)
+	require.NoError(t, err)
+	assert.Empty(t, signals, "redelivered events are recorded once")
+
+	revoked := map[string]interface{}{
+		"https://schemas.openid.net/secevent/risc/event-type/sessions-revoked": map[string]interface{}{
+			"subject": map[string]string{"subject_type": "iss-sub", "iss": "https://accounts.google.com/", "sub": "1093847561"},
+		},
+	}
+	signals, err = risk.ReceiveGoogleEvent(context.Background(), sign("client-1.apps.googleusercontent.com", "jti-2", revoked), now)
+	require.NoError(t, err)
+	require.Len(t, signals, 1)
+	assert.Equal(t, services.IdPRiskMedium, signals[0].RiskLevel)
+	require.NotNil(t, signals[0].UserID, "Google account IDs resolve through app connections")
+	assert.Equal(t, linked.ID, *signals[0].UserID)
+
+	verification := map[string]interface{}{
+		"https://schemas.openid.net/secevent/risc/event-type/verification": map[string]interface{}{"state": "test"},
+	}
+	signals, err = risk.ReceiveGoogleEvent(context.Background(), sign("client-1.apps.googleusercontent.com", "jti-3", verification), now)
+	require.NoError(t, err)
+	assert.Empty(t, signals)
+
+	_, err = risk.ReceiveGoogleEvent(context.Background(), sign("someone-else", "jti-4", hijacking), now)
+	assert.ErrorIs(t, err, services.ErrInvalidRiskSignal)
+	_, err = risk.ReceiveGoogleEvent(context.Background(), "not.a.token", now)
+	assert.ErrorIs(t, err, services.ErrInvalidRiskSignal)
+
+	listed, err := risk.List(services.IdPRiskProviderGoogle, nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+}
+
+func TestIdPRiskSignalService_MicrosoftRiskyUsers(t *testing.T) {
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token") {
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "graph-token"})
+			return
+		}
+		assert.Equal(t, "/v1.0/identityProtection/riskyUsers", r.URL.Path)
+		assert.Equal(t, "Bearer graph-token", r.Header.Get("Authorization"))
+		filters = append(filters, r.URL.Query().Get("$filter"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": []map[string]interface{}{
+			{"id": "aad-1", "userPrincipalName": "victim@example.com", "riskLevel": "high", "riskState": "atRisk",
+				"riskDetail": "none", "riskLastUpdatedDateTime": updated.Format(time.RFC3339)},
+			{"id": "aad-2", "userPrincipalName": "cleared@example.com", "riskLevel": "none", "riskState": "remediated",
+				"riskDetail": "userPerformedSecuredPasswordReset", "riskLastUpdatedDateTime": updated.Format(time.RFC3339)},
+		}})
+	}))
+	defer server.Close()
+	t.Setenv("MICROSOFT_TENANT_ID", "tenant-1")
+	t.Setenv("MICROSOFT_CLIENT_ID", "client-1")
+	t.Setenv("MICROSOFT_CLIENT_SECRET", "secret")
+	t.Setenv("MICROSOFT_RISK_CLIENT_STATE", "state-secret")
+	t.Setenv("MICROSOFT_LOGIN_URL", server.URL)
+	t.Setenv("MICROSOFT_GRAPH_URL", server.URL)
+
+	risk, db := setupTestIdPRiskService(t)
+	victim := models.User{ID: uuid.New(), Email: "victim@example.com", Username: "victim", IsActive: true}
+	require.NoError(t, db.Create(&victim).Error)
+
+	assert.NoError(t, risk.VerifyMicrosoftNotifications([]services.GraphNotification{{ClientState: "state-secret"}}))
+	assert.ErrorIs(t, risk.VerifyMicrosoftNotifications([]services.GraphNotification{{ClientState: "forged"}}), services.ErrInvalidRiskSignal)
+
+	now := updated.Add(time.Hour)
+	recorded, err := risk.SyncMicrosoft(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, recorded)
+	assert.Equal(t, "riskLastUpdatedDateTime gt "+now.Add(-24*time.Hour).Format(time.RFC3339), filters[0])
+
+	signals, err := risk.List(services.IdPRiskProviderMicrosoft, &victim.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, signals, 1)
+	assert.Equal(t, services.IdPRiskHigh, signals[0].RiskLevel)
+	assert.NotNil(t, signals[0].AlertID)
+
+	var cleared models.IdPRiskSignal
+	require.NoError(t, db.Where("subject = ?", "cleared@example.com").First(&cleared).Error)
+	assert.Equal(t, services.IdPRiskNone, cleared.RiskLevel)
+	assert.Nil(t, cleared.AlertID, "remediated risk raises no alert")
+
+	recorded, err = risk.SyncMicrosoft(context.Background(), now)
+	require.NoError(t, err)
+	assert.Zero(t, recorded)
+	assert.Equal(t, "riskLastUpdatedDateTime gt "+updated.Format(time.RFC3339), filters[1],
+		"later syncs resume from the newest change seen")
+}
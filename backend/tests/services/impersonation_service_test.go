@@ -0,0 +1,156 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+var impersonationSource = services.TokenSource{Provider: "impersonation", IPAddress: "10.0.0.5", UserAgent: "test"}
+
+// setupTestImpersonationService sets up an impersonation service with an administrator and a user
+func setupTestImpersonationService(t *testing.T, requireConsent bool) (*services.ImpersonationService, *gorm.DB, *models.User, *models.User) {
+	if requireConsent {
+		t.Setenv("IMPERSONATION_REQUIRE_CONSENT", "true")
+	} else {
+		t.Setenv("IMPERSONATION_REQUIRE_CONSENT", "false")
+	}
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AuditLog{}, &models.Impersonation{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	admin := &models.User{Email: "support@example.com", Username: "support", FirstName: "Sam", LastName: "Support", IsActive: true}
+	user := &models.User{Email: "user@example.com", Username: "user", FirstName: "Uma", LastName: "User", IsActive: true}
+	require.NoError(t, db.Create(admin).Error)
+	require.NoError(t, db.Create(user).Error)
+
+	service := services.NewImpersonationService(db, services.NewSessionServiceForTesting(db), services.NewAuditService(db))
+	return service, db, admin, user
+}
+
+func TestImpersonationService_RequestValidation(t *testing.T) {
+	service, _, admin, user := setupTestImpersonationService(t, true)
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		input services.ImpersonationInput
+	}{
+		{"no reason", services.ImpersonationInput{TargetUserID: user.ID, Reason: "  "}},
+		{"self", services.ImpersonationInput{TargetUserID: admin.ID, Reason: "ticket 42"}},
+		{"too long", services.ImpersonationInput{TargetUserID: user.ID, Reason: "ticket 42", Duration: 2 * time.Hour}},
+		{"unknown user", services.ImpersonationInput{TargetUserID: admin.ID, Reason: "ticket 42", Duration: time.Minute}},
+	}
+	tests[3].input.TargetUserID[0] ^= 0xff
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Request(admin.ID, tt.input, impersonationSource, now)
+			assert.ErrorIs(t, err, services.ErrInvalidImpersonation)
+		})
+	}
+}
+
+func TestImpersonationService_ConsentAndSession(t *testing.T) {
+	service, db, admin, user := setupTestImpersonationService(t, true)
+	now := time.Now()
+
+	impersonation, err := service.Request(admin.ID, services.ImpersonationInput{TargetUserID: user.ID, Reason: "ticket 42"}, impersonationSource, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImpersonationPendingConsent, impersonation.Status)
+	assert.Equal(t, 30*time.Minute, impersonation.Duration())
+
+	// Nothing starts before the user consents, and only the user can consent
+	_, _, err = service.Start(admin.ID, impersonation.ID, impersonationSource, now)
+	assert.ErrorIs(t, err, services.ErrImpersonationState)
+	_, err = service.Decide(admin.ID, impersonation.ID, true, impersonationSource, now)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotFound)
+
+	_, err = service.Decide(user.ID, impersonation.ID, true, impersonationSource, now)
+	require.NoError(t, err)
+	_, err = service.Decide(user.ID, impersonation.ID, false, impersonationSource, now)
+	assert.ErrorIs(t, err, services.ErrImpersonationState, "a decision is final")
+
+	impersonation, session, err := service.Start(admin.ID, impersonation.ID, impersonationSource, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImpersonationActive, impersonation.Status)
+	assert.Equal(t, user.ID, session.UserID)
+	require.NotNil(t, session.ImpersonatorID)
+	assert.Equal(t, admin.ID, *session.ImpersonatorID)
+	assert.Equal(t, models.AuthMethodImpersonation, session.AuthMethod)
+	assert.WithinDuration(t, now.Add(30*time.Minute), session.ExpiresAt, time.Second)
+
+	// Refresh never extends an impersonation session
+	refreshed, err := services.NewSessionServiceForTesting(db).RefreshSession(session.SessionToken)
+	require.NoError(t, err)
+	assert.WithinDuration(t, session.ExpiresAt, refreshed.ExpiresAt, time.Second)
+
+	require.NoError(t, service.CheckImpersonation(session.ID, admin.ID, now))
+	assert.ErrorIs(t, service.CheckImpersonation(session.ID, user.ID, now), services.ErrImpersonationEnded)
+	assert.ErrorIs(t, service.CheckImpersonation(session.ID, admin.ID, now.Add(31*time.Minute)), services.ErrImpersonationEnded)
+
+	banner, err := service.Banner(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Sam Support", banner.Impersonator.Name)
+	assert.Equal(t, "user@example.com", banner.User.Email)
+	assert.Contains(t, banner.Restrictions, "security_settings")
+
+	// The user can end it from their own session, which revokes the impersonation session
+	_, err = service.End(user.ID, impersonation.ID, impersonationSource, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.CheckImpersonation(session.ID, admin.ID, now), services.ErrImpersonationEnded)
+	var stored models.Session
+	require.NoError(t, db.First(&stored, "id = ?", session.ID).Error)
+	assert.False(t, stored.IsActive)
+
+	// Every step shows in the user's own audit log
+	var userLogs int64
+	db.Model(&models.AuditLog{}).Where("user_id = ? AND resource = ?", user.ID, "impersonation").Count(&userLogs)
+	assert.Equal(t, int64(5), userLogs, "request, refused start, consent, start, end")
+}
+
+func TestImpersonationService_DeniedAndExpired(t *testing.T) {
+	service, _, admin, user := setupTestImpersonationService(t, true)
+	now := time.Now()
+
+	denied, err := service.Request(admin.ID, services.ImpersonationInput{TargetUserID: user.ID, Reason: "ticket 1"}, impersonationSource, now)
+	require.NoError(t, err)
+	_, err = service.Decide(user.ID, denied.ID, false, impersonationSource, now)
+	require.NoError(t, err)
+	_, _, err = service.Start(admin.ID, denied.ID, impersonationSource, now)
+	assert.ErrorIs(t, err, services.ErrImpersonationState)
+
+	stale, err := service.Request(admin.ID, services.ImpersonationInput{TargetUserID: user.ID, Reason: "ticket 2"}, impersonationSource, now)
+	require.NoError(t, err)
+	expired, err := service.ExpireStale(now.Add(25 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	_, err = service.Decide(user.ID, stale.ID, true, impersonationSource, now)
+	assert.ErrorIs(t, err, services.ErrImpersonationState)
+}
+
+func TestImpersonationService_WithoutConsent(t *testing.T) {
+	service, _, admin, user := setupTestImpersonationService(t, false)
+	now := time.Now()
+
+	impersonation, err := service.Request(admin.ID, services.ImpersonationInput{TargetUserID: user.ID, Reason: "ticket 42", Duration: 10 * time.Minute}, impersonationSource, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.ImpersonationApproved, impersonation.Status)
+
+	_, session, err := service.Start(admin.ID, impersonation.ID, impersonationSource, now)
+	require.NoError(t, err)
+
+	// Active impersonations expire with their session
+	expired, err := service.ExpireStale(now.Add(11 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.ErrorIs(t, service.CheckImpersonation(session.ID, admin.ID, now), services.ErrImpersonationEnded)
+}
@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestIntegrationHealthService_DegradationAlerts(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AppConnection{}, &models.IntegrationHealthSample{}, &models.IntegrationHealthState{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.AppConnection{}, &models.IntegrationHealthSample{}, &models.IntegrationHealthState{})
+	})
+
+	userID := uuid.New()
+	connections := map[string]string{}
+	for _, provider := range []string{"slack", "google", "github"} {
+		connection := models.AppConnection{UserID: userID, AppID: provider, AppName: provider, Provider: provider, Status: "connected"}
+		require.NoError(t, db.Create(&connection).Error)
+		connections[provider] = connection.ID.String()
+	}
+
+	oauthMonitoring := services.NewOAuthMonitoringService(db)
+	record := func(provider, kind string, success bool, latencyMs, statusCode int) {
+		require.NoError(t, oauthMonitoring.RecordCallOutcome(userID.String(), connections[provider], kind, success, latencyMs, statusCode, ""))
+	}
+	for i := 0; i < 3; i++ {
+		record("slack", "", true, 300, 200)
+		record("slack", "", false, 300, 503)
+	}
+	for i := 0; i < 5; i++ {
+		record("google", models.IntegrationSampleAPICall, true, 200, 200)
+	}
+	record("github", models.IntegrationSampleAPICall, false, 100, 401)
+	record("github", models.IntegrationSampleAPICall, false, 100, 401)
+
+	err := oauthMonitoring.RecordCallOutcome(userID.String(), connections["slack"], "webhook", true, 0, 0, "")
+	assert.ErrorIs(t, err, services.ErrInvalidSampleKind)
+
+	integrationHealth := services.NewIntegrationHealthService(db, monitoring)
+	health, err := integrationHealth.GetIntegrationHealth(time.Now())
+	require.NoError(t, err)
+	require.Len(t, health, 3)
+	byProvider := map[string]services.IntegrationHealth{}
+	for _, integration := range health {
+		byProvider[integration.Provider] = integration
+	}
+	assert.Equal(t, models.IntegrationDegraded, byProvider["slack"].Status)
+	assert.InDelta(t, 75.0, byProvider["slack"].Score, 0.01)
+	assert.InDelta(t, 0.5, byProvider["slack"].ErrorRate, 0.001)
+	assert.Equal(t, models.IntegrationHealthy, byProvider["google"].Status)
+	assert.Equal(t, models.IntegrationUnknown, byProvider["github"].Status, "too few calls to judge")
+
+	// Degrading raises one alert; the cooldown suppresses repeats
+	raised, err := integrationHealth.Evaluate(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, raised)
+	raised, err = integrationHealth.Evaluate(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, raised)
+
+	// Failing token refreshes make it unhealthy, which alerts again with remediation
+	record("slack", models.IntegrationSampleTokenRefresh, false, 0, 400)
+	record("slack", models.IntegrationSampleTokenRefresh, false, 0, 400)
+	raised, err = integrationHealth.Evaluate(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, raised)
+
+	require.Eventually(t, func() bool {
+		_, total, err := monitoring.GetAlertQueue(50, 0)
+		return err == nil && total == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	queue, _, err := monitoring.GetAlertQueue(50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, services.AlertTypeIntegrationDegraded, queue[0].Type)
+	assert.Equal(t, services.SeverityHigh, queue[0].Severity)
+	assert.Equal(t, "slack", queue[0].Metadata["provider"])
+	assert.Len(t, queue[0].Metadata["remediation"], 2, "token refresh and provider error remediation")
+}
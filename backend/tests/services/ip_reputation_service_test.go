@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestIPReputationService(t *testing.T) (*services.IPReputationService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.IPReputation{}, &models.AuditLog{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewIPReputationService(db, services.NewThreatIntelligenceService()), db
+}
+
+func TestIPReputationService_ObservationsDecay(t *testing.T) {
+	service, _ := setupTestIPReputationService(t)
+	now := time.Now()
+	const ip = "203.0.113.7"
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, service.Observe(ip, services.IPObservationFailedLogin, now))
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, service.Observe(ip, services.IPObservationAlert, now))
+	}
+
+	reputation, err := service.Lookup(context.Background(), ip, now)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.8, reputation.Score, 0.001)
+	assert.Equal(t, services.IPVerdictHighRisk, reputation.Verdict)
+	assert.Equal(t, int64(3), reputation.FailedLogins)
+	assert.Equal(t, int64(2), reputation.Alerts)
+	assert.True(t, service.IsHighRisk(context.Background(), ip, now))
+
+	// One half-life later the address is no longer high risk
+	later := now.Add(72 * time.Hour)
+	reputation, err = service.Lookup(context.Background(), ip, later)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.4, reputation.Score, 0.001)
+	assert.Equal(t, services.IPVerdictNeutral, reputation.Verdict)
+	assert.False(t, service.IsHighRisk(context.Background(), ip, later))
+
+	// Unknown and invalid addresses are neutral
+	assert.False(t, service.IsHighRisk(context.Background(), "198.51.100.1", now))
+	assert.False(t, service.IsHighRisk(context.Background(), "not-an-ip", now))
+	_, err = service.Lookup(context.Background(), "not-an-ip", now)
+	assert.ErrorIs(t, err, services.ErrInvalidIPAddress)
+}
+
+func TestIPReputationService_Overrides(t *testing.T) {
+	service, db := setupTestIPReputationService(t)
+	now := time.Now()
+	analyst := uuid.New()
+	const office = "192.0.2.10"
+	const scanner = "192.0.2.66"
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, service.Observe(office, services.IPObservationAlert, now))
+	}
+	require.True(t, service.IsHighRisk(context.Background(), office, now))
+
+	reputation, err := service.SetOverride(office, models.IPOverrideAllow, "Office egress", nil, &analyst, now)
+	require.NoError(t, err)
+	assert.Equal(t, services.IPVerdictAllowed, reputation.Verdict)
+	assert.Zero(t, reputation.Score)
+	assert.False(t, service.IsHighRisk(context.Background(), office, now))
+
+	expiresAt := now.Add(time.Hour)
+	_, err = service.SetOverride(scanner, models.IPOverrideDeny, "Known scanner", &expiresAt, &analyst, now)
+	require.NoError(t, err)
+	assert.True(t, service.IsHighRisk(context.Background(), scanner, now))
+	assert.False(t, service.IsHighRisk(context.Background(), scanner, now.Add(2*time.Hour)), "expired overrides no longer apply")
+
+	_, err = service.SetOverride(scanner, "block", "", nil, &analyst, now)
+	assert.ErrorIs(t, err, services.ErrInvalidIPOverride)
+	past := now.Add(-time.Minute)
+	_, err = service.SetOverride(scanner, models.IPOverrideDeny, "", &past, &analyst, now)
+	assert.ErrorIs(t, err, services.ErrInvalidIPOverride)
+
+	// Clearing the override scores the address again
+	require.NoError(t, service.ClearOverride(office, &analyst))
+	assert.True(t, service.IsHighRisk(context.Background(), office, now))
+	assert.ErrorIs(t, service.ClearOverride(office, &analyst), services.ErrIPOverrideNotFound)
+
+	reputations, total, err := service.List(50, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, reputations, 2)
+
+	var audits int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("resource = ?", "ip_reputation").Count(&audits).Error)
+	assert.Equal(t, int64(3), audits)
+}
@@ -0,0 +1,140 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestJobQueue(t *testing.T) (*services.JobQueue, *gorm.DB) {
+	t.Setenv("JOB_QUEUE_CONCURRENCY", "1")
+	// Jobs run on other goroutines, so every connection must see the same database
+	db, err := gorm.Open(sqlite.Open("file:jobqueue?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	tables := []interface{}{&models.ReportJob{}, &models.ReportJobLog{}, &models.AuditLog{}, &models.User{}, &models.Session{}, &models.LoginEvent{}}
+	require.NoError(t, db.AutoMigrate(tables...), "Failed to migrate database schema")
+	t.Cleanup(func() {
+		db.Migrator().DropTable(tables...)
+	})
+	return services.NewJobQueue(db, nil), db
+}
+
+func waitForJob(t *testing.T, queue *services.JobQueue, jobID uuid.UUID) *models.ReportJob {
+	var job *models.ReportJob
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = queue.Get(jobID)
+		return err == nil && job.IsFinished()
+	}, 2*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestJobQueue_ProgressLogsAndResult(t *testing.T) {
+	queue, _ := setupTestJobQueue(t)
+	analyst := uuid.New()
+
+	job := &models.ReportJob{Kind: models.ReportJobAuditExport, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now(), RequestedBy: &analyst}
+	require.NoError(t, queue.Enqueue(job, func(ctx context.Context, run *services.JobRun) (interface{}, error) {
+		// Runs on the queue's goroutine, where require cannot stop the test
+		assert.NoError(t, run.Progress(50, "Halfway"))
+		stored, err := queue.Get(run.ID())
+		if !assert.NoError(t, err) {
+			return nil, err
+		}
+		assert.Equal(t, models.ReportJobRunning, stored.Status)
+		assert.Equal(t, 50, stored.Progress)
+		assert.Equal(t, "Halfway", stored.ProgressMessage)
+		run.Logf("Exported %d records", 3)
+		return map[string]int{"records": 3}, nil
+	}))
+	assert.Equal(t, models.ReportJobPending, job.Status)
+
+	done := waitForJob(t, queue, job.ID)
+	assert.Equal(t, models.ReportJobCompleted, done.Status)
+	assert.Equal(t, 100, done.Progress)
+	assert.NotNil(t, done.StartedAt)
+	assert.NotNil(t, done.CompletedAt)
+	assert.JSONEq(t, `{"records":3}`, done.Result)
+
+	logs, total, err := queue.Logs(job.ID, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, "Exported 3 records", logs[1].Message)
+
+	mine, total, err := queue.List(services.JobFilter{RequestedBy: &analyst}, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, job.ID, mine[0].ID)
+
+	_, err = queue.Cancel(job.ID, &analyst)
+	assert.ErrorIs(t, err, services.ErrReportJobFinished)
+	_, err = queue.Get(uuid.New())
+	assert.ErrorIs(t, err, services.ErrReportJobNotFound)
+}
+
+func TestJobQueue_Cancel(t *testing.T) {
+	queue, _ := setupTestJobQueue(t)
+	started := make(chan struct{})
+
+	// With one slot, the second job waits behind the first
+	running := &models.ReportJob{Kind: models.ReportJobAuditStatistics, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now()}
+	require.NoError(t, queue.Enqueue(running, func(ctx context.Context, run *services.JobRun) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	<-started
+	pending := &models.ReportJob{Kind: models.ReportJobAuditStatistics, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now()}
+	require.NoError(t, queue.Enqueue(pending, func(ctx context.Context, run *services.JobRun) (interface{}, error) {
+		return nil, errors.New("should not run")
+	}))
+
+	cancelled, err := queue.Cancel(pending.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReportJobCancelled, cancelled.Status)
+
+	_, err = queue.Cancel(running.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReportJobCancelled, waitForJob(t, queue, running.ID).Status)
+	assert.Equal(t, models.ReportJobCancelled, waitForJob(t, queue, pending.ID).Status)
+}
+
+func TestUserDataExportService_StartExport(t *testing.T) {
+	queue, db := setupTestJobQueue(t)
+	service := services.NewUserDataExportService(db, queue)
+
+	user := models.User{Email: "alice@example.com", Username: "alice", PasswordHash: "$2a$10$passwordhash"}
+	require.NoError(t, db.Create(&user).Error)
+	require.NoError(t, db.Create(&models.Session{UserID: user.ID, SessionToken: "secret-token", ExpiresAt: time.Now().Add(time.Hour)}).Error)
+	require.NoError(t, db.Create(&models.LoginEvent{UserID: &user.ID, Email: user.Email, Success: true, Method: "password"}).Error)
+
+	job, err := service.StartExport(user.ID, &user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReportJobUserDataExport, job.Kind)
+	assert.Equal(t, &user.ID, job.SubjectID)
+
+	done := waitForJob(t, queue, job.ID)
+	require.Equal(t, models.ReportJobCompleted, done.Status, done.Error)
+	var export services.UserDataExport
+	require.NoError(t, json.Unmarshal([]byte(done.Result), &export))
+	assert.Equal(t, "alice@example.com", export.Profile.Email)
+	require.Len(t, export.Sessions, 1)
+	assert.Empty(t, export.Sessions[0].SessionToken)
+	assert.Len(t, export.LoginHistory, 1)
+	assert.NotContains(t, done.Result, "secret-token")
+	assert.NotContains(t, done.Result, "passwordhash")
+
+	_, err = service.StartExport(uuid.New(), nil)
+	assert.ErrorIs(t, err, services.ErrDataSubjectNotFound)
+}
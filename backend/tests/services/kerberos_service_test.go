@@ -0,0 +1,277 @@
+package services_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+const kerberosTestRealm = "CORP.EXAMPLE.COM"
+
+var kerberosTestSPN = services.KerberosPrincipalName{NameType: 3, NameString: []string{"HTTP", "sso.corp.example.com"}}
+
+// Mirrors of the RFC 4120 messages, used to play the part of the client and the KDC
+type testTransited struct {
+	TrType   int32  `asn1:"explicit,tag:0"`
+	Contents []byte `asn1:"explicit,tag:1"`
+}
+
+type testEncTicketPart struct {
+	Flags     asn1.BitString                 `asn1:"explicit,tag:0"`
+	Key       services.KerberosEncryptionKey `asn1:"explicit,tag:1"`
+	CRealm    string                         `asn1:"explicit,tag:2"`
+	CName     services.KerberosPrincipalName `asn1:"explicit,tag:3"`
+	Transited testTransited                  `asn1:"explicit,tag:4"`
+	AuthTime  time.Time                      `asn1:"generalized,explicit,tag:5"`
+	EndTime   time.Time                      `asn1:"generalized,explicit,tag:7"`
+}
+
+type testTicket struct {
+	TktVNO  int                            `asn1:"explicit,tag:0"`
+	Realm   string                         `asn1:"explicit,tag:1"`
+	SName   services.KerberosPrincipalName `asn1:"explicit,tag:2"`
+	EncPart services.KerberosEncryptedData `asn1:"explicit,tag:3"`
+}
+
+type testAuthenticator struct {
+	AuthenticatorVNO int                            `asn1:"explicit,tag:0"`
+	CRealm           string                         `asn1:"explicit,tag:1"`
+	CName            services.KerberosPrincipalName `asn1:"explicit,tag:2"`
+	Cusec            int                            `asn1:"explicit,tag:4"`
+	CTime            time.Time                      `asn1:"generalized,explicit,tag:5"`
+}
+
+type testAPReq struct {
+	PVNO          int                            `asn1:"explicit,tag:0"`
+	MsgType       int                            `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString                 `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue                  // [3] EXPLICIT; RawValues are encoded as given
+	Authenticator services.KerberosEncryptedData `asn1:"explicit,tag:4"`
+}
+
+type testNegTokenInit struct {
+	MechTypes []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	MechToken []byte                  `asn1:"explicit,tag:2"`
+}
+
+// kerberosTicketOptions describe the ticket and authenticator a test client presents
+type kerberosTicketOptions struct {
+	client     string
+	serviceKey services.KerberosKey
+	endTime    time.Time
+	ctime      time.Time
+}
+
+func randomKerberosKey(t *testing.T) services.KerberosKey {
+	key := services.KerberosKey{Type: services.KerberosETypeAES256, Value: make([]byte, 32)}
+	_, err := rand.Read(key.Value)
+	require.NoError(t, err)
+	return key
+}
+
+// writeTestKeytab writes an MIT keytab with a deleted entry followed by the service key
+func writeTestKeytab(t *testing.T, key services.KerberosKey, kvno uint32) string {
+	counted := func(buf *bytes.Buffer, value []byte) {
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(value)))
+		buf.Write(value)
+	}
+	var entry bytes.Buffer
+	_ = binary.Write(&entry, binary.BigEndian, uint16(len(kerberosTestSPN.NameString)))
+	counted(&entry, []byte(kerberosTestRealm))
+	for _, component := range kerberosTestSPN.NameString {
+		counted(&entry, []byte(component))
+	}
+	_ = binary.Write(&entry, binary.BigEndian, uint32(kerberosTestSPN.NameType))
+	_ = binary.Write(&entry, binary.BigEndian, uint32(time.Now().Unix()))
+	entry.WriteByte(byte(kvno))
+	_ = binary.Write(&entry, binary.BigEndian, uint16(key.Type))
+	counted(&entry, key.Value)
+	_ = binary.Write(&entry, binary.BigEndian, kvno)
+
+	var keytab bytes.Buffer
+	keytab.Write([]byte{0x05, 0x02})
+	_ = binary.Write(&keytab, binary.BigEndian, int32(-8))
+	keytab.Write(make([]byte, 8))
+	_ = binary.Write(&keytab, binary.BigEndian, int32(entry.Len()))
+	keytab.Write(entry.Bytes())
+
+	path := filepath.Join(t.TempDir(), "http.keytab")
+	require.NoError(t, os.WriteFile(path, keytab.Bytes(), 0o600))
+	return path
+}
+
+func gssToken(t *testing.T, mech asn1.ObjectIdentifier, inner []byte) []byte {
+	oid, err := asn1.Marshal(mech)
+	require.NoError(t, err)
+	token, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: append(oid, inner...)})
+	require.NoError(t, err)
+	return token
+}
+
+// negotiateToken builds the SPNEGO token a domain-joined browser sends after getting a
+// service ticket from the KDC
+func negotiateToken(t *testing.T, opts kerberosTicketOptions) []byte {
+	clientName := services.KerberosPrincipalName{NameType: 1, NameString: []string{opts.client}}
+	sessionKey := randomKerberosKey(t)
+
+	encPart, err := asn1.MarshalWithParams(testEncTicketPart{
+		Flags:     asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+		Key:       services.KerberosEncryptionKey{KeyType: sessionKey.Type, KeyValue: sessionKey.Value},
+		CRealm:    kerberosTestRealm,
+		CName:     clientName,
+		Transited: testTransited{TrType: 1, Contents: []byte{}},
+		AuthTime:  opts.ctime.Add(-time.Minute).UTC().Truncate(time.Second),
+		EndTime:   opts.endTime.UTC().Truncate(time.Second),
+	}, "application,explicit,tag:3")
+	require.NoError(t, err)
+	sealedTicket, err := opts.serviceKey.Encrypt(2, encPart)
+	require.NoError(t, err)
+	ticket, err := asn1.MarshalWithParams(testTicket{
+		TktVNO:  5,
+		Realm:   kerberosTestRealm,
+		SName:   kerberosTestSPN,
+		EncPart: services.KerberosEncryptedData{EType: opts.serviceKey.Type, KVNO: 3, Cipher: sealedTicket},
+	}, "application,explicit,tag:1")
+	require.NoError(t, err)
+
+	authenticator, err := asn1.MarshalWithParams(testAuthenticator{
+		AuthenticatorVNO: 5,
+		CRealm:           kerberosTestRealm,
+		CName:            clientName,
+		Cusec:            opts.ctime.Nanosecond() / 1000,
+		CTime:            opts.ctime.UTC().Truncate(time.Second),
+	}, "application,explicit,tag:2")
+	require.NoError(t, err)
+	sealedAuthenticator, err := sessionKey.Encrypt(11, authenticator)
+	require.NoError(t, err)
+
+	apReq, err := asn1.MarshalWithParams(testAPReq{
+		PVNO:          5,
+		MsgType:       14,
+		APOptions:     asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+		Ticket:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: ticket},
+		Authenticator: services.KerberosEncryptedData{EType: sessionKey.Type, Cipher: sealedAuthenticator},
+	}, "application,explicit,tag:14")
+	require.NoError(t, err)
+
+	krb5 := asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	mechToken := gssToken(t, krb5, append([]byte{0x01, 0x00}, apReq...))
+	negTokenInit, err := asn1.Marshal(testNegTokenInit{MechTypes: []asn1.ObjectIdentifier{{1, 2, 840, 48018, 1, 2, 2}, krb5}, MechToken: mechToken})
+	require.NoError(t, err)
+	choice, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: negTokenInit})
+	require.NoError(t, err)
+	return gssToken(t, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}, choice)
+}
+
+// setupTestKerberosService sets up a Kerberos service with a keytab, one internal network
+// and one user
+func setupTestKerberosService(t *testing.T) (*services.KerberosService, services.KerberosKey, *gorm.DB) {
+	serviceKey := randomKerberosKey(t)
+	t.Setenv("KERBEROS_KEYTAB", writeTestKeytab(t, serviceKey, 3))
+	t.Setenv("KERBEROS_INTERNAL_NETWORKS", "10.0.0.0/8, 192.168.1.10")
+	t.Setenv("KERBEROS_EMAIL_DOMAIN", "")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.ReplayCacheEntry{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	require.NoError(t, db.Create(&models.User{Email: "alice@corp.example.com", Username: "Alice Smith", IsActive: true}).Error)
+
+	return services.NewKerberosService(db, services.NewReplayGuard(db, nil)), serviceKey, db
+}
+
+func TestKerberosService_Authenticate(t *testing.T) {
+	service, serviceKey, db := setupTestKerberosService(t)
+	require.True(t, service.Enabled())
+	assert.True(t, service.OnInternalNetwork("10.20.30.40"))
+	assert.True(t, service.OnInternalNetwork("192.168.1.10"))
+	assert.False(t, service.OnInternalNetwork("192.168.1.11"))
+	assert.False(t, service.OnInternalNetwork("203.0.113.5"))
+
+	now := time.Now()
+	source := services.TokenSource{Provider: "kerberos", IPAddress: "10.20.30.40"}
+	token := negotiateToken(t, kerberosTicketOptions{client: "alice", serviceKey: serviceKey, endTime: now.Add(10 * time.Hour), ctime: now})
+
+	principal, err := service.Authenticate(token, source, now)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@CORP.EXAMPLE.COM", principal.String())
+
+	user, err := service.ResolveUser(principal)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@corp.example.com", user.Email)
+
+	session, err := services.NewSessionServiceForTesting(db).CreateSessionWithMethod(user.ID, source.IPAddress, "", models.AuthMethodKerberos)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuthMethodKerberos, session.AuthMethod)
+
+	// A captured header cannot be presented again
+	_, err = service.Authenticate(token, source, now)
+	assert.ErrorIs(t, err, services.ErrTokenReplayed)
+}
+
+func TestKerberosService_RejectsBadTickets(t *testing.T) {
+	service, serviceKey, _ := setupTestKerberosService(t)
+	now := time.Now()
+	source := services.TokenSource{Provider: "kerberos", IPAddress: "10.20.30.40"}
+
+	tests := []struct {
+		name    string
+		opts    kerberosTicketOptions
+		wantErr error
+	}{
+		{"wrong service key", kerberosTicketOptions{client: "alice", serviceKey: randomKerberosKey(t), endTime: now.Add(time.Hour), ctime: now}, services.ErrInvalidKerberosTicket},
+		{"expired ticket", kerberosTicketOptions{client: "alice", serviceKey: serviceKey, endTime: now.Add(-time.Hour), ctime: now}, services.ErrInvalidKerberosTicket},
+		{"stale authenticator", kerberosTicketOptions{client: "alice", serviceKey: serviceKey, endTime: now.Add(time.Hour), ctime: now.Add(-10 * time.Minute)}, services.ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Authenticate(negotiateToken(t, tt.opts), source, now)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	// NTLM and other non-Kerberos tokens are refused so the client falls back
+	ntlm := gssToken(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}, []byte("NTLMSSP\x00"))
+	_, err := service.Authenticate(ntlm, source, now)
+	assert.ErrorIs(t, err, services.ErrInvalidSPNEGOToken)
+	_, err = service.Authenticate([]byte("TlRMTVNTUAAB"), source, now)
+	assert.ErrorIs(t, err, services.ErrInvalidSPNEGOToken)
+}
+
+func TestKerberosService_ResolveUser(t *testing.T) {
+	service, _, _ := setupTestKerberosService(t)
+
+	user, err := service.ResolveUser(&services.KerberosPrincipal{Name: "Alice Smith", Realm: kerberosTestRealm})
+	require.NoError(t, err, "principals match usernames case-insensitively")
+	assert.Equal(t, "alice@corp.example.com", user.Email)
+
+	_, err = service.ResolveUser(&services.KerberosPrincipal{Name: "bob", Realm: kerberosTestRealm})
+	assert.ErrorIs(t, err, services.ErrKerberosPrincipalUnknown)
+	_, err = service.ResolveUser(&services.KerberosPrincipal{Name: "HTTP/alice", Realm: kerberosTestRealm})
+	assert.ErrorIs(t, err, services.ErrKerberosPrincipalUnknown, "service principals are not users")
+}
+
+func TestKerberosService_DisabledWithoutInternalNetworks(t *testing.T) {
+	t.Setenv("KERBEROS_KEYTAB", writeTestKeytab(t, randomKerberosKey(t), 3))
+	t.Setenv("KERBEROS_INTERNAL_NETWORKS", "")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	service := services.NewKerberosService(db, services.NewReplayGuard(db, nil))
+	assert.False(t, service.Enabled())
+	_, err = service.Authenticate([]byte{0x60}, services.TokenSource{}, time.Now())
+	assert.ErrorIs(t, err, services.ErrKerberosDisabled)
+}
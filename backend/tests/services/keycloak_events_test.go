@@ -0,0 +1,122 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestKeycloakEventService(t *testing.T) (*services.KeycloakEventService, *gorm.DB, models.User) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.KeycloakEvent{}, &models.AuditLog{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&models.KeycloakEvent{}, &models.AuditLog{}) })
+
+	keycloakID := "f2c1d6a0-kc"
+	user := models.User{ID: uuid.New(), KeycloakID: &keycloakID, Email: "alice@example.com", Username: "alice", IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+	return services.NewKeycloakEventService(db, monitoring), db, user
+}
+
+func TestKeycloakEventService_Webhook(t *testing.T) {
+	t.Setenv("KEYCLOAK_EVENTS_WEBHOOK_SECRET", "kc-secret")
+	events, db, user := setupTestKeycloakEventService(t)
+
+	assert.NoError(t, events.VerifyWebhook("Bearer kc-secret"))
+	assert.ErrorIs(t, events.VerifyWebhook("Bearer wrong"), services.ErrInvalidKeycloakEvent)
+	_, err := services.ParseKeycloakEvents([]byte(`{"realmId":"cloudgate"}`))
+	assert.ErrorIs(t, err, services.ErrInvalidKeycloakEvent)
+
+	now := time.Now()
+	body := `[
+		{"id":"e2","time":` + strconv.FormatInt(now.UnixMilli(), 10) + `,"type":"LOGIN","realmId":"cloudgate","clientId":"portal","userId":"f2c1d6a0-kc","sessionId":"s1","ipAddress":"203.0.113.9","details":{"username":"alice"}},
+		{"id":"e1","time":` + strconv.FormatInt(now.Add(-time.Minute).UnixMilli(), 10) + `,"type":"LOGIN_ERROR","realmId":"cloudgate","clientId":"portal","ipAddress":"203.0.113.9","error":"invalid_user_credentials","details":{"username":"Alice@example.com"}},
+		{"id":"e3","time":` + strconv.FormatInt(now.UnixMilli(), 10) + `,"type":"CODE_TO_TOKEN","realmId":"cloudgate","userId":"f2c1d6a0-kc"},
+		{"time":` + strconv.FormatInt(now.UnixMilli(), 10) + `,"realmId":"cloudgate","operationType":"DELETE","resourceType":"USER","resourcePath":"users/9b1e","authDetails":{"userId":"f2c1d6a0-kc","clientId":"security-admin-console","ipAddress":"198.51.100.4"}}
+	]`
+	parsed, err := services.ParseKeycloakEvents([]byte(body))
+	require.NoError(t, err)
+	result, err := events.Ingest(context.Background(), parsed, now)
+	require.NoError(t, err)
+	assert.Equal(t, services.KeycloakIngestResult{Ingested: 3, Skipped: 1}, result)
+
+	var logs []models.AuditLog
+	require.NoError(t, db.Order("created_at").Find(&logs).Error)
+	require.Len(t, logs, 3)
+	assert.Equal(t, "keycloak_login_failed", logs[0].Action)
+	assert.Equal(t, "failure", logs[0].Status)
+	require.NotNil(t, logs[0].UserID, "an email username resolves the user")
+	assert.Equal(t, user.ID, *logs[0].UserID)
+	assert.Contains(t, logs[0].Details, "invalid_user_credentials")
+	assert.WithinDuration(t, now.Add(-time.Minute), logs[0].CreatedAt, time.Millisecond, "entries are dated when Keycloak saw the event")
+	actions := []string{logs[1].Action, logs[2].Action}
+	assert.ElementsMatch(t, []string{"keycloak_login", "keycloak_admin_delete"}, actions)
+	for _, entry := range logs[1:] {
+		if entry.Action == "keycloak_admin_delete" {
+			assert.Equal(t, "keycloak_user", entry.Resource)
+			assert.Equal(t, "users/9b1e", entry.ResourceID)
+			assert.Equal(t, "198.51.100.4", entry.IPAddress)
+		}
+	}
+
+	result, err = events.Ingest(context.Background(), parsed, now)
+	require.NoError(t, err)
+	assert.Equal(t, services.KeycloakIngestResult{Duplicates: 4}, result, "redelivered events are not audited again")
+
+	purged, err := events.Purge(now.Add(30 * 24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), purged)
+}
+
+func TestKeycloakEventService_Poll(t *testing.T) {
+	now := time.Now()
+	var tokenRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/realms/cloudgate/protocol/openid-connect/token":
+			tokenRequests++
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "admin-token"})
+		case "/admin/realms/cloudgate/events":
+			assert.Equal(t, "Bearer admin-token", r.Header.Get("Authorization"))
+			assert.Equal(t, now.Add(-time.Hour).UTC().Format("2006-01-02"), r.URL.Query().Get("dateFrom"))
+			// Newest first, with one event from before the cursor on the same day
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"time": now.UnixMilli(), "type": "LOGOUT", "realmId": "cloudgate", "userId": "f2c1d6a0-kc", "sessionId": "s1"},
+				{"time": now.Add(-2 * time.Hour).UnixMilli(), "type": "LOGIN", "realmId": "cloudgate", "userId": "f2c1d6a0-kc"},
+			})
+		case "/admin/realms/cloudgate/admin-events":
+			json.NewEncoder(w).Encode([]map[string]interface{}{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("KEYCLOAK_URL", server.URL)
+	t.Setenv("KEYCLOAK_REALM", "cloudgate")
+	t.Setenv("KEYCLOAK_EVENTS_CLIENT_ID", "cloudgate-events")
+	t.Setenv("KEYCLOAK_EVENTS_CLIENT_SECRET", "secret")
+
+	events, db, user := setupTestKeycloakEventService(t)
+	require.True(t, events.PollEnabled())
+	result, err := events.SyncEvents(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, services.KeycloakIngestResult{Ingested: 1}, result, "events before the first hour are not read")
+	assert.Equal(t, 1, tokenRequests)
+
+	var logout models.AuditLog
+	require.NoError(t, db.Where("action = ?", "keycloak_logout").First(&logout).Error)
+	assert.Equal(t, user.ID, *logout.UserID)
+	assert.Equal(t, "s1", logout.ResourceID)
+}
@@ -0,0 +1,179 @@
+package services_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestKeycloakTokenVerifier_VerifiesRealmTokens(t *testing.T) {
+	realmKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var fetches atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "realm-key", "kty": "RSA", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(realmKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(realmKey.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	issuer := "https://keycloak.example.com/realms/cloudgate"
+	t.Setenv("KEYCLOAK_ISSUER", issuer)
+	t.Setenv("KEYCLOAK_JWKS_URL", jwks.URL)
+	t.Setenv("KEYCLOAK_CLIENT_ID", "cloudgate-backend")
+	t.Setenv("KEYCLOAK_AUTO_PROVISION", "true")
+	t.Setenv("KEYCLOAK_ROLES_GRANT_ACCESS", "true")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+	verifier := services.NewKeycloakTokenVerifier(db)
+	require.True(t, verifier.Enabled())
+	now := time.Now()
+
+	existing := models.User{Email: "analyst@example.com", Username: "analyst", EmailVerified: true, IsActive: true}
+	require.NoError(t, db.Create(&existing).Error)
+	squatted := models.User{Email: "cfo@example.com", Username: "cfo", IsActive: true}
+	require.NoError(t, db.Create(&squatted).Error)
+
+	sign := func(key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		base := jwt.MapClaims{
+			"iss": issuer, "aud": "account", "azp": "cloudgate-backend", "typ": "Bearer",
+			"iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(), "email_verified": true,
+		}
+		for name, value := range claims {
+			base[name] = value
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	verify := func(token string) (*models.TokenIdentity, error) {
+		return verifier.VerifyToken(context.Background(), token, now)
+	}
+
+	// A verified email links the Keycloak user to the existing account
+	identity, err := verify(sign(realmKey, "realm-key", jwt.MapClaims{
+		"sub": "kc-analyst", "email": "Analyst@example.com", "preferred_username": "analyst", "acr": "2",
+		"realm_access":    map[string]interface{}{"roles": []string{"offline_access", "cloudgate-security-analyst"}},
+		"resource_access": map[string]interface{}{"cloudgate-backend": map[string]interface{}{"roles": []string{"reviewer"}}},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, identity.UserID)
+	assert.Equal(t, "analyst@example.com", identity.Email)
+	assert.Equal(t, []string{"offline_access", "cloudgate-security-analyst", "reviewer"}, identity.Roles)
+	assert.Equal(t, []string{models.RoleSecurityAnalyst}, identity.GrantedRoles)
+	assert.Equal(t, models.AAL2, identity.AAL)
+	var linked models.User
+	require.NoError(t, db.First(&linked, "id = ?", existing.ID).Error)
+	require.NotNil(t, linked.KeycloakID)
+	assert.Equal(t, "kc-analyst", *linked.KeycloakID)
+
+	// Unknown verified users are provisioned; unverified emails never link or provision
+	identity, err = verify(sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-new", "email": "new@example.com", "preferred_username": "analyst"}))
+	require.NoError(t, err)
+	assert.Equal(t, models.AAL1, identity.AAL)
+	var provisioned models.User
+	require.NoError(t, db.First(&provisioned, "id = ?", identity.UserID).Error)
+	assert.Equal(t, "new@example.com", provisioned.Username, "taken usernames fall back to the email")
+	_, err = verify(sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-squatter", "email": "victim@example.com", "email_verified": false}))
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+
+	// A local account whose email was never verified may have been registered by someone else,
+	// so the Keycloak user is refused instead of inheriting it
+	_, err = verify(sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-cfo", "email": "cfo@example.com"}))
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+	require.NoError(t, db.First(&squatted, "id = ?", squatted.ID).Error)
+	assert.Nil(t, squatted.KeycloakID)
+
+	// Signature, audience, expiry, issuer and token type are all checked
+	for name, token := range map[string]string{
+		"other key":      sign(otherKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst"}),
+		"wrong audience": sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst", "aud": "other", "azp": "other"}),
+		"expired":        sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst", "exp": now.Add(-time.Hour).Unix()}),
+		"no expiry":      sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst", "exp": nil}),
+		"other issuer":   sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst", "iss": "https://evil.example.com"}),
+		"ID token":       sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst", "typ": "ID"}),
+	} {
+		_, err := verify(token)
+		assert.ErrorIs(t, err, services.ErrInvalidAccessToken, name)
+	}
+
+	// Keys are cached, and an unknown key ID refetches at most once a minute
+	assert.Equal(t, int32(1), fetches.Load())
+	_, err = verify(sign(realmKey, "rotated-key", jwt.MapClaims{"sub": "kc-analyst"}))
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// The middleware hands realm tokens to the verifier and trusts the roles it grants
+	middleware.SetExternalTokenVerifier(verifier)
+	t.Cleanup(func() { middleware.SetExternalTokenVerifier(nil) })
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/security", middleware.AuthenticationMiddleware(), middleware.RequireRole(models.RoleSecurityAnalyst), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("userID").(uuid.UUID), "roles": c.GetStringSlice("roles")})
+	})
+	request := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/security", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, r)
+		return w
+	}
+	w := request(sign(realmKey, "realm-key", jwt.MapClaims{
+		"sub": "kc-analyst", "realm_access": map[string]interface{}{"roles": []string{"cloudgate-security-analyst"}},
+	}))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), existing.ID.String())
+	assert.Equal(t, http.StatusForbidden, request(sign(realmKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst"})).Code)
+	assert.Equal(t, http.StatusUnauthorized, request(sign(otherKey, "realm-key", jwt.MapClaims{"sub": "kc-analyst"})).Code)
+
+	// Tokens requested by another client of the realm only reach routes their scopes open
+	middleware.RequireScope(http.MethodGet, "/alerts", services.APIScopeAlertsRead)
+	router.GET("/alerts", middleware.AuthenticationMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"scopes": c.GetStringSlice("scopes")})
+	})
+	scoped := func(path, scope string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+sign(realmKey, "realm-key", jwt.MapClaims{
+			"sub": "kc-analyst", "aud": []string{"cloudgate-backend"}, "azp": "soc-dashboard", "scope": scope,
+			"realm_access": map[string]interface{}{"roles": []string{"cloudgate-security-analyst"}},
+		}))
+		router.ServeHTTP(w, r)
+		return w
+	}
+	w = scoped("/alerts", "openid alerts:read")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"scopes":["alerts:read"]}`, w.Body.String())
+	w = scoped("/alerts", "openid incidents:read")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="alerts:read"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusForbidden, scoped("/security", "openid alerts:read").Code, "undeclared routes are closed to scoped tokens")
+}
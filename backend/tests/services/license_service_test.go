@@ -0,0 +1,101 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// stubLicenseProvider is a LicenseProvider returning fixed seat counts
+type stubLicenseProvider struct {
+	appID string
+	usage *services.SeatUsage
+	err   error
+}
+
+func (p *stubLicenseProvider) GetAppID() string   { return p.appID }
+func (p *stubLicenseProvider) GetSource() string  { return "stub" }
+func (p *stubLicenseProvider) IsConfigured() bool { return true }
+func (p *stubLicenseProvider) FetchSeatUsage(ctx context.Context) (*services.SeatUsage, error) {
+	return p.usage, p.err
+}
+
+// setupTestLicenseService sets up a license service backed by an in-memory database
+func setupTestLicenseService(t *testing.T) (*services.LicenseService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AppLaunchEvent{}, &models.AppConnection{}, &models.LicenseAllocation{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	services.InitializeSaaSApps()
+	return services.NewLicenseService(db), db
+}
+
+func TestLicenseService_GetUtilizationReport(t *testing.T) {
+	service, db := setupTestLicenseService(t)
+
+	_, err := service.SetAllocation("slack", 10, 8.75)
+	require.NoError(t, err)
+	_, err = service.SetAllocation("github", 2, 4)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Create(&models.AppLaunchEvent{UserID: uuid.New(), AppID: "slack", LaunchedAt: time.Now()}).Error)
+	}
+	// Launches outside the active window do not count
+	require.NoError(t, db.Create(&models.AppLaunchEvent{UserID: uuid.New(), AppID: "slack", LaunchedAt: time.Now().Add(-60 * 24 * time.Hour)}).Error)
+
+	report, err := service.GetUtilizationReport(30 * 24 * time.Hour)
+	require.NoError(t, err)
+	require.Len(t, report, 2)
+
+	slack := report[0]
+	assert.Equal(t, "slack", slack.AppID)
+	assert.Equal(t, "Slack", slack.AppName)
+	assert.Equal(t, int64(3), slack.ActiveUsers)
+	assert.Equal(t, 7, slack.UnusedSeats)
+	assert.InDelta(t, 30.0, slack.UtilizationPercent, 0.01)
+	assert.InDelta(t, 61.25, slack.UnusedCost, 0.01)
+
+	t.Run("should export CSV with a header row", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, services.WriteUtilizationCSV(&buf, report))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "app_id,app_name,provisioned_seats"))
+		assert.True(t, strings.HasPrefix(lines[1], "slack,Slack,10,"))
+	})
+}
+
+func TestLicenseService_SyncProviders(t *testing.T) {
+	service, db := setupTestLicenseService(t)
+
+	_, err := service.SetAllocation("google-workspace", 50, 6)
+	require.NoError(t, err)
+	service.RegisterProvider(&stubLicenseProvider{appID: "google-workspace", usage: &services.SeatUsage{AssignedSeats: 42}})
+	service.RegisterProvider(&stubLicenseProvider{appID: "microsoft-365", err: errors.New("unauthorized")})
+
+	results := service.SyncProviders(context.Background())
+	assert.NoError(t, results["google-workspace"])
+	assert.Error(t, results["microsoft-365"])
+
+	var allocation models.LicenseAllocation
+	require.NoError(t, db.Where("app_id = ?", "google-workspace").First(&allocation).Error)
+	assert.Equal(t, 50, allocation.ProvisionedSeats, "provider without seat totals keeps the manual value")
+	assert.Equal(t, 42, allocation.AssignedSeats)
+	assert.Equal(t, "stub", allocation.Source)
+	assert.NotNil(t, allocation.LastSyncedAt)
+}
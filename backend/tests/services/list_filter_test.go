@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestListFilter_AuditLogs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	exports := services.NewAuditExportService(db)
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	for _, entry := range []models.AuditLog{
+		{Action: "login", Status: "success", UserID: &userID, IPAddress: "203.0.113.1", CreatedAt: now.Add(-time.Hour)},
+		{Action: "login", Status: "failure", IPAddress: "203.0.113.2", CreatedAt: now.Add(-2 * time.Hour)},
+		{Action: "password_changed", Status: "success", UserID: &userID, CreatedAt: now.AddDate(0, 0, -3)},
+		{Action: "app_connected", Status: "success", Details: "50% done", CreatedAt: time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC)},
+	} {
+		require.NoError(t, db.Create(&entry).Error)
+	}
+
+	list := func(expression, sort string) ([]string, int64) {
+		t.Helper()
+		page, err := services.AuditLogFilterSchema.NewListPage(expression, sort, 2, 0, now)
+		require.NoError(t, err)
+		logs, total, err := exports.ListLogs(context.Background(), page)
+		require.NoError(t, err)
+		actions := make([]string, len(logs))
+		for i, entry := range logs {
+			actions[i] = entry.Action
+		}
+		return actions, total
+	}
+
+	t.Run("should combine comparisons with AND, OR, NOT and parentheses", func(t *testing.T) {
+		actions, total := list(`(action = login AND NOT status = failure) OR action IN (app_connected, "password_changed")`, "action")
+		assert.Equal(t, int64(3), total)
+		assert.Equal(t, []string{"app_connected", "login"}, actions, "the page is sorted and limited")
+	})
+
+	t.Run("should resolve relative times, dates and ranges", func(t *testing.T) {
+		_, total := list("created_at >= -1d", "")
+		assert.Equal(t, int64(2), total)
+		actions, _ := list("created_at = 2025-03-01", "")
+		assert.Equal(t, []string{"app_connected"}, actions, "a date covers the whole day")
+		_, total = list("created_at = 2025-03-01..2025-03-07", "")
+		assert.Equal(t, int64(2), total)
+		_, total = list("created_at <= 2025-03-01", "")
+		assert.Equal(t, int64(1), total)
+	})
+
+	t.Run("should match UUIDs and substrings literally", func(t *testing.T) {
+		_, total := list("user_id = "+userID.String(), "")
+		assert.Equal(t, int64(2), total)
+		_, total = list(`ip_address ~ "113.2"`, "")
+		assert.Equal(t, int64(1), total)
+		_, total = list(`action ~ "_"`, "")
+		assert.Equal(t, int64(2), total, "LIKE wildcards in values match themselves")
+		_, total = list(`action = "login' OR '1'='1"`, "")
+		assert.Zero(t, total, "values never become SQL")
+	})
+
+	t.Run("should reject what the list does not allow", func(t *testing.T) {
+		for expression, message := range map[string]string{
+			"details ~ done":                  `unknown field "details"`,
+			"action > login":                  "action does not support >",
+			"created_at IN (now)":             "created_at does not support IN",
+			"user_id = someone":               "user_id must be a UUID",
+			"(action = login":                 "missing )",
+			"action = login status = failure": "unexpected",
+			"created_at >= yesterday":         "is not an RFC3339 time",
+			`action = "login`:                 "unterminated quoted value",
+		} {
+			_, err := services.ParseFilter(services.AuditLogFilterSchema, expression, now)
+			assert.ErrorIs(t, err, services.ErrInvalidFilter, expression)
+			assert.ErrorContains(t, err, message, expression)
+		}
+		_, err := services.AuditLogFilterSchema.ParseSort("-user_agent")
+		assert.ErrorIs(t, err, services.ErrInvalidFilter)
+		_, err = services.ParseFilter(services.AlertFilterSchema, "severity = urgent", now)
+		assert.ErrorContains(t, err, "severity must be one of low, medium, high, critical")
+	})
+}
+
+func TestListFilter_IncidentsInMemory(t *testing.T) {
+	manager := services.NewIncidentManager()
+	for _, incident := range []struct {
+		title    string
+		severity services.AlertSeverity
+	}{
+		{"Credential stuffing", services.SeverityHigh},
+		{"Impossible travel", services.SeverityCritical},
+		{"New device", services.SeverityLow},
+	} {
+		_, err := manager.CreateIncident(incident.title, "", incident.severity, nil)
+		require.NoError(t, err)
+	}
+
+	page, err := services.IncidentFilterSchema.NewListPage("severity IN (high, critical) AND title ~ i", "-created_at", 1, 0, time.Now())
+	require.NoError(t, err)
+	filters := services.IncidentFilters{Filter: page.Filter, Sort: page.Sort, Limit: page.Limit}
+	incidents, total, err := manager.ListIncidents(filters)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, incidents, 1)
+	assert.Contains(t, []string{"Credential stuffing", "Impossible travel"}, incidents[0].Title)
+
+	assigned := uuid.New()
+	filter, err := services.ParseFilter(services.IncidentFilterSchema, "assigned_to != "+assigned.String(), time.Now())
+	require.NoError(t, err)
+	incidents, _, err = manager.ListIncidents(services.IncidentFilters{Filter: filter})
+	require.NoError(t, err)
+	assert.Len(t, incidents, 3, "unassigned incidents match !=")
+}
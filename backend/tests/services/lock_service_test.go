@@ -0,0 +1,104 @@
+package services_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestLockDB sets up an in-memory database shared by several simulated instances
+func setupTestLockDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.JobLease{})
+	})
+
+	require.NoError(t, db.AutoMigrate(&models.JobLease{}), "Failed to migrate database schema")
+	return db
+}
+
+func TestLockService_TryAcquire(t *testing.T) {
+	db := setupTestLockDB(t)
+	instanceA := services.NewLockService(db)
+	instanceB := services.NewLockService(db)
+	assert.NotEqual(t, instanceA.Holder(), instanceB.Holder())
+
+	acquired, err := instanceA.TryAcquire("session_cleanup", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = instanceB.TryAcquire("session_cleanup", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, acquired, "lease is held by another instance")
+
+	// The holder may renew its own lease
+	acquired, err = instanceA.TryAcquire("session_cleanup", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// Other jobs are independent
+	acquired, err = instanceB.TryAcquire("health_checks", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// Releasing lets the other instance take over; only the holder can release
+	require.NoError(t, instanceB.Release("session_cleanup"))
+	acquired, err = instanceB.TryAcquire("session_cleanup", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, instanceA.Release("session_cleanup"))
+	acquired, err = instanceB.TryAcquire("session_cleanup", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLockService_ExpiredLeaseIsTakenOver(t *testing.T) {
+	db := setupTestLockDB(t)
+	instanceA := services.NewLockService(db)
+	instanceB := services.NewLockService(db)
+
+	acquired, err := instanceA.TryAcquire("token_refresh", time.Hour)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	db.Model(&models.JobLease{}).Where("name = ?", "token_refresh").Update("expires_at", time.Now().Add(-time.Second))
+
+	acquired, err = instanceB.TryAcquire("token_refresh", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	var lease models.JobLease
+	require.NoError(t, db.First(&lease, "name = ?", "token_refresh").Error)
+	assert.Equal(t, instanceB.Holder(), lease.Holder)
+}
+
+func TestLockService_RunPeriodicRunsOnOneInstance(t *testing.T) {
+	db := setupTestLockDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs atomic.Int32
+	for i := 0; i < 3; i++ {
+		instance := services.NewLockService(db)
+		go instance.RunPeriodic(ctx, "session_cleanup", 200*time.Millisecond, func() error {
+			runs.Add(1)
+			return nil
+		})
+	}
+
+	// Each instance ticks at 200ms; within one lease only a single run may happen
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	assert.Equal(t, int32(1), runs.Load())
+}
@@ -0,0 +1,171 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestLoginDisputeService sets up a dispute service raising alerts through a
+// monitoring service, on a database the monitoring service's background processor can share
+func setupTestLoginDisputeService(t *testing.T) (*services.LoginDisputeService, *gorm.DB, <-chan services.SecurityAlert) {
+	db, err := gorm.Open(sqlite.Open("file:logindispute?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	tables := []interface{}{&models.User{}, &models.Session{}, &models.MFASetup{}, &models.BackupCode{}, &models.AuditLog{},
+		&models.LoginDispute{}, &models.WatchlistEntry{}, &models.SecurityAlertRecord{}, &models.Playbook{},
+		&models.PlaybookExecution{}, &services.RiskAssessment{}}
+	require.NoError(t, db.AutoMigrate(tables...), "Failed to migrate database schema")
+
+	monitoring := services.NewSecurityMonitoringService(db)
+	alerts := monitoring.Subscribe("login-dispute-test")
+	t.Cleanup(func() {
+		monitoring.Shutdown(context.Background())
+		db.Migrator().DropTable(tables...)
+	})
+	return services.NewLoginDisputeService(db, monitoring), db, alerts
+}
+
+func createDisputeTestUser(t *testing.T, db *gorm.DB, password string) models.User {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := models.User{Email: uuid.NewString() + "@example.com", Username: uuid.NewString(), PasswordHash: string(hash)}
+	require.NoError(t, db.Create(&user).Error)
+	return user
+}
+
+func TestLoginDisputeService_OpenDispute(t *testing.T) {
+	service, db, alerts := setupTestLoginDisputeService(t)
+	user := createDisputeTestUser(t, db, "old-password")
+	session := createTestSession(t, db, user.ID, "198.51.100.7", time.Now().Add(-time.Hour))
+
+	_, err := service.OpenDispute(uuid.New(), session.ID, "", "203.0.113.10", time.Now())
+	assert.ErrorIs(t, err, services.ErrSessionNotFound, "only the session's owner can dispute it")
+
+	dispute, err := service.OpenDispute(user.ID, session.ID, "I was asleep", "203.0.113.10", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, models.DisputeOpen, dispute.Status)
+	assert.Equal(t, "198.51.100.7", dispute.LoginIPAddress)
+	assert.Equal(t, []string{services.DisputeStepPasswordReset, services.DisputeStepMFAReenrollment}, services.PendingDisputeSteps(dispute))
+
+	var stored models.Session
+	require.NoError(t, db.First(&stored, "id = ?", session.ID).Error)
+	assert.False(t, stored.IsActive, "the disputed session is revoked")
+
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, services.AlertTypeCompromisedAccount, alert.Type)
+		assert.Equal(t, user.ID.String(), alert.Metadata["user_id"])
+		assert.Equal(t, dispute.ID.String(), alert.Metadata["dispute_id"])
+		require.NotNil(t, dispute.AlertID)
+		assert.Equal(t, alert.ID, *dispute.AlertID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a compromised account alert")
+	}
+
+	again, err := service.OpenDispute(user.ID, session.ID, "", "203.0.113.10", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, dispute.ID, again.ID, "a login is disputed once")
+
+	pending, err := service.PendingRemediation(user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	assert.Equal(t, dispute.ID, pending.ID)
+}
+
+func TestLoginDisputeService_RemediationAndResolution(t *testing.T) {
+	service, db, _ := setupTestLoginDisputeService(t)
+	user := createDisputeTestUser(t, db, "old-password")
+	disputed := createTestSession(t, db, user.ID, "198.51.100.7", time.Now().Add(-time.Hour))
+	current := createTestSession(t, db, user.ID, "203.0.113.10", time.Now().Add(-time.Minute))
+	createTestSession(t, db, user.ID, "192.0.2.1", time.Now().Add(-2*time.Minute))
+
+	// An authenticator enrolled before the dispute, possibly by the attacker
+	oldKey, err := totp.Generate(totp.GenerateOpts{Issuer: "CloudGate SSO", AccountName: user.Email})
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.MFASetup{ID: uuid.New(), UserID: user.ID, Secret: oldKey.Secret(), Enabled: true, CreatedAt: time.Now().Add(-24 * time.Hour)}).Error)
+
+	dispute, err := service.OpenDispute(user.ID, disputed.ID, "", "203.0.113.10", time.Now())
+	require.NoError(t, err)
+
+	_, err = service.Resolve(dispute.ID, nil, models.DisputeResolutionCompromised, "", time.Now())
+	assert.ErrorIs(t, err, services.ErrDisputeState, "compromise is confirmed only after remediation")
+
+	t.Run("password reset", func(t *testing.T) {
+		_, err := service.ResetPassword(user.ID, dispute.ID, "short", &current.ID, time.Now())
+		assert.ErrorIs(t, err, services.ErrInvalidDisputeStep)
+		_, err = service.ResetPassword(user.ID, dispute.ID, "old-password", &current.ID, time.Now())
+		assert.ErrorIs(t, err, services.ErrInvalidDisputeStep, "the password must change")
+		_, err = service.ResetPassword(uuid.New(), dispute.ID, "new-password-1", &current.ID, time.Now())
+		assert.ErrorIs(t, err, services.ErrDisputeNotFound)
+
+		updated, err := service.ResetPassword(user.ID, dispute.ID, "new-password-1", &current.ID, time.Now())
+		require.NoError(t, err)
+		assert.NotNil(t, updated.PasswordResetAt)
+		assert.Equal(t, models.DisputeOpen, updated.Status)
+
+		var stored models.User
+		require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte("new-password-1")))
+
+		var sessions []models.Session
+		require.NoError(t, db.Where("user_id = ?", user.ID).Find(&sessions).Error)
+		for _, s := range sessions {
+			assert.Equal(t, s.ID == current.ID, s.IsActive, "only the current session survives, session %s", s.IPAddress)
+		}
+	})
+
+	t.Run("MFA re-enrollment", func(t *testing.T) {
+		code, err := totp.GenerateCode(oldKey.Secret(), time.Now())
+		require.NoError(t, err)
+		_, err = service.VerifyMFA(user.ID, dispute.ID, code, time.Now())
+		assert.ErrorIs(t, err, services.ErrInvalidDisputeStep, "the old authenticator does not count")
+
+		newKey, err := totp.Generate(totp.GenerateOpts{Issuer: "CloudGate SSO", AccountName: user.Email})
+		require.NoError(t, err)
+		require.NoError(t, db.Where("user_id = ?", user.ID).Delete(&models.MFASetup{}).Error)
+		require.NoError(t, db.Create(&models.MFASetup{ID: uuid.New(), UserID: user.ID, Secret: newKey.Secret(), Enabled: true, CreatedAt: time.Now().Add(time.Second)}).Error)
+
+		_, err = service.VerifyMFA(user.ID, dispute.ID, "000000", time.Now())
+		assert.ErrorIs(t, err, services.ErrInvalidDisputeStep)
+
+		code, err = totp.GenerateCode(newKey.Secret(), time.Now())
+		require.NoError(t, err)
+		updated, err := service.VerifyMFA(user.ID, dispute.ID, code, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, models.DisputeRemediated, updated.Status)
+		assert.Empty(t, services.PendingDisputeSteps(updated))
+
+		pending, err := service.PendingRemediation(user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, pending, "the user is no longer held back")
+	})
+
+	t.Run("resolution", func(t *testing.T) {
+		admin := uuid.New()
+		_, err := service.Resolve(dispute.ID, &admin, "maybe", "", time.Now())
+		assert.ErrorIs(t, err, services.ErrInvalidDisputeStep)
+
+		resolved, err := service.Resolve(dispute.ID, &admin, models.DisputeResolutionCompromised, "Credential stuffing from a known botnet", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, models.DisputeResolved, resolved.Status)
+		assert.Equal(t, &admin, resolved.ResolvedBy)
+
+		_, err = service.Resolve(dispute.ID, &admin, models.DisputeResolutionCompromised, "", time.Now())
+		assert.ErrorIs(t, err, services.ErrDisputeState)
+
+		disputes, err := service.ListDisputes(&user.ID, models.DisputeResolved)
+		require.NoError(t, err)
+		assert.Len(t, disputes, 1)
+	})
+}
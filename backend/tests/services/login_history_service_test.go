@@ -0,0 +1,97 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+var testLoginLocations = map[string]*services.GeoLocation{
+	"203.0.113.10": {Country: "DE", City: "Berlin", Latitude: 52.52, Longitude: 13.405},
+	"203.0.113.11": {Country: "DE", City: "Berlin", Latitude: 52.51, Longitude: 13.41},
+	"198.51.100.7": {Country: "BR", City: "São Paulo", Latitude: -23.55, Longitude: -46.633},
+	"10.0.0.1":     {Country: "Local", City: "Local"},
+}
+
+func setupTestLoginHistoryService(t *testing.T) *services.LoginHistoryService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.LoginEvent{}), "Failed to migrate database schema")
+
+	return services.NewLoginHistoryService(db, func(ip string) *services.GeoLocation { return testLoginLocations[ip] })
+}
+
+func TestLoginHistoryService_RecordResolvesLocation(t *testing.T) {
+	service := setupTestLoginHistoryService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	event, err := service.Record(services.LoginAttempt{UserID: &userID, Email: "a@example.com", Success: true, Method: models.AuthMethodPassword, IPAddress: "203.0.113.10"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "Berlin", event.City)
+	require.NotNil(t, event.Latitude)
+	assert.Equal(t, 52.52, *event.Latitude)
+
+	local, err := service.Record(services.LoginAttempt{UserID: &userID, Email: "a@example.com", Success: true, Method: models.AuthMethodPassword, IPAddress: "10.0.0.1"}, now)
+	require.NoError(t, err)
+	assert.Nil(t, local.Latitude, "no coordinates rather than 0,0")
+
+	unknown, err := service.Record(services.LoginAttempt{Email: "nobody@example.com", Method: models.AuthMethodPassword, FailureReason: models.LoginFailureUnknownUser, IPAddress: "192.0.2.1"}, now)
+	require.NoError(t, err)
+	assert.Nil(t, unknown.UserID)
+	assert.Empty(t, unknown.Country)
+}
+
+func TestLoginHistoryService_HistoryPagesAndClusters(t *testing.T) {
+	service := setupTestLoginHistoryService(t)
+	userID := uuid.New()
+	now := time.Now()
+	record := func(ip string, success bool, at time.Time) {
+		attempt := services.LoginAttempt{UserID: &userID, Email: "a@example.com", Success: success, Method: models.AuthMethodPassword, IPAddress: ip}
+		if !success {
+			attempt.FailureReason = models.LoginFailureInvalidPassword
+		}
+		_, err := service.Record(attempt, at)
+		require.NoError(t, err)
+	}
+
+	record("203.0.113.10", true, now.Add(-200*24*time.Hour)) // outside the cluster window
+	record("203.0.113.10", true, now.Add(-3*time.Hour))
+	record("203.0.113.11", true, now.Add(-2*time.Hour))
+	record("198.51.100.7", false, now.Add(-time.Hour))
+	record("10.0.0.1", true, now)
+	other := uuid.New()
+	_, err := service.Record(services.LoginAttempt{UserID: &other, Email: "b@example.com", Success: true, Method: models.AuthMethodPassword, IPAddress: "198.51.100.7"}, now)
+	require.NoError(t, err)
+
+	history, err := service.History(userID, 2, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), history.Total)
+	require.Len(t, history.Events, 2)
+	assert.Nil(t, history.Events[0].Latitude, "newest first")
+	assert.False(t, history.Events[1].Success)
+
+	require.Len(t, history.Clusters, 2, "nearby Berlin logins share a cluster")
+	berlin := history.Clusters[0]
+	assert.Equal(t, "Berlin", berlin.City)
+	assert.Equal(t, 2, berlin.Logins)
+	assert.Equal(t, 0, berlin.Failures)
+	assert.InDelta(t, 52.515, berlin.Latitude, 0.0001)
+	assert.Equal(t, 1, history.Clusters[1].Failures)
+
+	require.NotNil(t, history.Bounds)
+	assert.Equal(t, -23.55, history.Bounds.MinLatitude)
+	assert.Equal(t, 13.41, history.Bounds.MaxLongitude)
+
+	page, err := service.History(userID, 2, 4, now)
+	require.NoError(t, err)
+	assert.Len(t, page.Events, 1)
+}
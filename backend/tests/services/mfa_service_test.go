@@ -139,9 +139,10 @@ func TestMFAService_GetMFASetup(t *testing.T) {
 
 	t.Run("should return error for user without MFA setup", func(t *testing.T) {
 		// Create another user without MFA setup
+		kc := "another-keycloak-id"
 		newUser := models.User{
 			ID:         uuid.New(),
-			KeycloakID: "another-keycloak-id",
+			KeycloakID: &kc,
 			Email:      "another@example.com",
 			Username:   "anotheruser",
 			IsActive:   true,
@@ -305,9 +306,10 @@ func BenchmarkMFAService_StoreMFASetup(b *testing.B) {
 	defer func() { services.DB = originalDB }()
 
 	// Create test user
+	kc := "benchmark-user"
 	user := &models.User{
 		ID:         uuid.New(),
-		KeycloakID: "benchmark-user",
+		KeycloakID: &kc,
 		Email:      "benchmark@example.com",
 		Username:   "benchuser",
 		IsActive:   true,
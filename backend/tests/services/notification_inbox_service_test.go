@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestNotificationInboxService_DeliversToPrivilegedUsers(t *testing.T) {
+	t.Setenv("NOTIFICATION_INBOX_RETENTION_DAYS", "30")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.RoleAssignment{}, &models.AdminNotification{}))
+	inbox := services.NewNotificationInboxService(db)
+	now := time.Now()
+
+	user := func(email string, active bool, roles ...string) uuid.UUID {
+		u := models.User{Email: email, Username: email, IsActive: true}
+		require.NoError(t, db.Create(&u).Error)
+		if !active {
+			require.NoError(t, db.Model(&u).Update("is_active", false).Error)
+		}
+		for _, role := range roles {
+			require.NoError(t, db.Create(&models.RoleAssignment{UserID: u.ID, Role: role}).Error)
+		}
+		return u.ID
+	}
+	admin := user("admin@example.com", true, models.RoleAdmin, models.RoleSecurityAnalyst)
+	analyst := user("analyst@example.com", true, models.RoleSecurityAnalyst)
+	user("member@example.com", true)
+	user("former@example.com", false, models.RoleAdmin)
+
+	// The channel only passes alerts at or above its severity, once per recipient
+	channel := &services.InboxAlertChannel{Inbox: inbox, MinSeverity: services.SeverityMedium, Enabled: true}
+	alert := func(severity services.AlertSeverity, title string) services.SecurityAlert {
+		return services.SecurityAlert{ID: uuid.New(), Type: services.AlertTypeBruteForceAttack, Severity: severity, Title: title, Timestamp: now}
+	}
+	require.NoError(t, channel.SendAlert(alert(services.SeverityLow, "Ignored")))
+	require.NoError(t, channel.SendAlert(alert(services.SeverityHigh, "Brute force")))
+	require.NoError(t, channel.SendAlert(alert(services.SeverityCritical, "Canary key used")))
+	var stored int64
+	db.Model(&models.AdminNotification{}).Count(&stored)
+	assert.Equal(t, int64(4), stored)
+
+	counts, err := inbox.UnreadCounts(admin)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counts.Unread)
+	assert.Equal(t, int64(1), counts.BySeverity[services.SeverityCritical])
+	assert.Equal(t, int64(0), counts.BySeverity[services.SeverityLow])
+
+	notifications, total, err := inbox.List(admin, services.NotificationFilter{Severities: []services.AlertSeverity{services.SeverityCritical}, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "Canary key used", notifications[0].Title)
+
+	// Recipients only read their own notifications
+	assert.ErrorIs(t, inbox.MarkRead(analyst, notifications[0].ID, now), services.ErrNotificationNotFound)
+	require.NoError(t, inbox.MarkRead(admin, notifications[0].ID, now))
+	unread, total, err := inbox.List(admin, services.NotificationFilter{UnreadOnly: true, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "Brute force", unread[0].Title)
+
+	marked, err := inbox.MarkAllRead(analyst, []services.AlertSeverity{services.SeverityHigh}, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+	counts, err = inbox.UnreadCounts(analyst)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counts.Unread)
+
+	purged, err := inbox.Purge(now.Add(31 * 24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), purged)
+}
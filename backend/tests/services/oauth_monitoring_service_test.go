@@ -53,7 +53,7 @@ func createTestUser(t *testing.T, db *gorm.DB) *models.User {
 }
 
 // createTestConnection creates a test app connection
-func createTestConnection(t *testing.T, db *gorm.DB, userID uuid.UUID, status string) *models.AppConnection {
+func createTestConnection(t *testing.T, db *gorm.DB, userID uuid.UUID, status models.ConnectionStatus) *models.AppConnection {
 	connection := &models.AppConnection{
 		ID:              uuid.New(),
 		UserID:          userID,
@@ -103,7 +103,7 @@ func TestOAuthMonitoringService_GetUserConnections(t *testing.T) {
 
 		// Check first connection
 		assert.Equal(t, conn1.ID, connections[0].ID)
-		assert.Equal(t, "healthy", connections[0].Health.Status)
+		assert.Equal(t, models.HealthHealthy, connections[0].Health.Status)
 		assert.Equal(t, 150, connections[0].Health.ResponseTime)
 		assert.Equal(t, 99.5, connections[0].Health.Uptime)
 		assert.Equal(t, int64(10), connections[0].UsageCount)
@@ -254,7 +254,7 @@ func TestOAuthMonitoringService_CreateSecurityEvent(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, events, 1)
 		assert.Equal(t, "suspicious_login", events[0].EventType)
-		assert.Equal(t, "high", events[0].Severity)
+		assert.Equal(t, models.SeverityHigh, events[0].Severity)
 		assert.Equal(t, 8.5, events[0].RiskScore)
 	})
 
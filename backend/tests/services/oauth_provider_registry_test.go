@@ -0,0 +1,152 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// newFakeOAuthProvider serves a token endpoint that authenticates the client with HTTP
+// Basic auth and a user info endpoint under the instance URL it hands out
+func newFakeOAuthProvider(t *testing.T) (*httptest.Server, services.OAuthProviderConfig) {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "acme-client" || secret != "acme-secret" || r.FormValue("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		assert.Empty(t, r.FormValue("client_secret"), "basic auth keeps the secret out of the form")
+		assert.Equal(t, "verifier-1", r.FormValue("code_verifier"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-123", "refresh_token": "refresh-456", "token_type": "Bearer",
+			"expires_in": 3600, "instance_url": server.URL + "/tenant", "workspace": map[string]string{"name": "Acme"},
+		})
+	})
+	mux.HandleFunc("/tenant/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-123" || r.Header.Get("X-Api-Version") != "2" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"login":   "alice",
+			"profile": map[string]string{"display_name": "Alice Example", "primary_email": "alice@acme.example"},
+		})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, services.OAuthProviderConfig{
+		Name: "acme", DisplayName: "Acme", AppID: "acme-suite", BasicAuth: true,
+		AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token",
+		ClientIDEnv: "ACME_CLIENT_ID", SecretEnv: "ACME_CLIENT_SECRET",
+		Scope:           "read write",
+		AuthParams:      map[string]string{"prompt": "consent"},
+		UserInfoURL:     "{instance_url}/me",
+		UserInfoHeaders: map[string]string{"X-Api-Version": "2"},
+		EmailFields:     []string{"email", "profile.primary_email"},
+		NameField:       "profile.display_name",
+		UsernameField:   "login",
+		TokenExtras:     map[string]string{"workspace_name": "workspace.name"},
+	}
+}
+
+func TestOAuthProvider_AuthorizationCodeFlow(t *testing.T) {
+	t.Setenv("ACME_CLIENT_ID", "acme-client")
+	server, config := newFakeOAuthProvider(t)
+	provider := services.NewOAuthProvider(config, server.Client())
+	ctx := context.Background()
+
+	authURL, err := url.Parse(provider.AuthURL("https://cloudgate.example/oauth/acme/callback", "state-1", "", services.PKCEChallenge("verifier-1")))
+	require.NoError(t, err)
+	query := authURL.Query()
+	assert.Equal(t, "acme-client", query.Get("client_id"))
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "read write", query.Get("scope"))
+	assert.Equal(t, "consent", query.Get("prompt"))
+	assert.Equal(t, "state-1", query.Get("state"))
+	assert.False(t, query.Has("nonce"))
+	assert.Equal(t, services.PKCEChallenge("verifier-1"), query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	_, err = provider.Exchange(ctx, "good-code", "https://cloudgate.example/oauth/acme/callback", "verifier-1", "stale-secret")
+	assert.ErrorContains(t, err, "invalid_client")
+
+	token, err := provider.Exchange(ctx, "good-code", "https://cloudgate.example/oauth/acme/callback", "verifier-1", "acme-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "access-123", token.AccessToken)
+	assert.Equal(t, "refresh-456", token.RefreshToken)
+	assert.Equal(t, 3600, token.ExpiresIn)
+
+	userInfo, err := provider.FetchUserInfo(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@acme.example", userInfo.Email, "the first non-empty email field wins")
+	assert.Equal(t, "Alice Example", userInfo.Name)
+	assert.Equal(t, "alice", userInfo.Username)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.AppConnection{}), "Failed to migrate database schema")
+	originalDB := services.DB
+	services.DB = db
+	t.Cleanup(func() { services.DB = originalDB })
+
+	userID := uuid.New()
+	require.NoError(t, provider.StoreTokens(userID.String(), token, userInfo))
+	var connection models.AppConnection
+	require.NoError(t, db.First(&connection, "user_id = ? AND app_id = ?", userID, "acme-suite").Error)
+	assert.NotContains(t, connection.AccessToken, "access-123", "tokens are encrypted at rest")
+	stored, ok := services.GetUserAppConnection(userID.String(), "acme-suite")
+	require.True(t, ok)
+	assert.Equal(t, "access-123", stored.AccessToken)
+	assert.Equal(t, "refresh-456", stored.RefreshToken)
+	assert.Equal(t, "alice@acme.example", connection.UserEmail)
+	assert.JSONEq(t, `{"username":"alice","workspace_name":"Acme"}`, connection.Extras)
+}
+
+func TestOAuthProviderRegistry_LoadsConfiguredProviders(t *testing.T) {
+	_, config := newFakeOAuthProvider(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "providers.json")
+	data, err := json.Marshal([]services.OAuthProviderConfig{config})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	t.Setenv("OAUTH_PROVIDERS_FILE", path)
+
+	registry := services.NewOAuthProviderRegistry()
+	provider, ok := registry.Get("acme")
+	require.True(t, ok)
+	assert.Equal(t, "acme-suite", provider.Config().AppID)
+	google, ok := registry.Get("google")
+	require.True(t, ok, "built-in providers stay registered")
+	assert.True(t, google.Config().OIDC)
+	assert.Len(t, registry.Providers(), 9)
+
+	// Configured providers get client secret rotation like the built-in ones
+	secretDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, secretDB.AutoMigrate(&models.ProviderSecret{}))
+	_, err = services.NewProviderSecretService(secretDB).ListSecrets("acme")
+	assert.NoError(t, err)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`[{"name":"Bad Name","app_id":"x"}]`), 0o600))
+	_, err = services.LoadOAuthProviderConfigs(invalid)
+	assert.ErrorIs(t, err, services.ErrInvalidOAuthProvider)
+	assert.ErrorContains(t, err, "auth_url")
+}
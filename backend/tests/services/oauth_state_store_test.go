@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestStateStore_ConsumesStatesBoundToUserAndProvider(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.OAuthState{}), "Failed to migrate database schema")
+
+	store := services.NewStateStore(db)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice, mallory := uuid.New(), uuid.New()
+
+	state, err := store.Issue("github", alice, now)
+	require.NoError(t, err)
+	assert.Len(t, state, 64)
+	require.NoError(t, store.Consume("github", state, alice, now.Add(time.Minute)))
+	assert.ErrorIs(t, store.Consume("github", state, alice, now.Add(time.Minute)), services.ErrInvalidOAuthState,
+		"a state is single-use")
+
+	assert.ErrorIs(t, store.Consume("github", "forged", alice, now), services.ErrInvalidOAuthState)
+	assert.ErrorIs(t, store.Consume("github", "", alice, now), services.ErrInvalidOAuthState)
+
+	// A state lifted from another user's flow is rejected and burned
+	state, err = store.Issue("github", alice, now)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.Consume("github", state, mallory, now), services.ErrInvalidOAuthState)
+	assert.ErrorIs(t, store.Consume("github", state, alice, now), services.ErrInvalidOAuthState)
+
+	state, err = store.Issue("github", alice, now)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.Consume("slack", state, alice, now), services.ErrInvalidOAuthState)
+
+	// OAuth 1.0a request tokens are bound the same way
+	require.NoError(t, store.Bind("trello", "request-token", alice, now))
+	assert.ErrorIs(t, store.Consume("trello", "request-token", alice, now.Add(11*time.Minute)), services.ErrInvalidOAuthState,
+		"states expire after OAUTH_STATE_TTL")
+
+	_, err = store.Issue("github", alice, now)
+	require.NoError(t, err)
+	require.NoError(t, store.PurgeExpired(now.Add(10*time.Minute)))
+	var remaining int64
+	require.NoError(t, db.Model(&models.OAuthState{}).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+}
+
+func TestStateStore_RedeemsStateForTheUserWhoStartedTheFlow(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.OAuthState{}), "Failed to migrate database schema")
+
+	store := services.NewStateStore(db)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice := uuid.New()
+
+	state, err := store.Issue("google", alice, now)
+	require.NoError(t, err)
+	userID, err := store.Redeem("google", state, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID, "callbacks without a sign-in token still resolve the user")
+	_, err = store.Redeem("google", state, now.Add(time.Minute))
+	assert.ErrorIs(t, err, services.ErrInvalidOAuthState)
+
+	state, err = store.Issue("google", alice, now)
+	require.NoError(t, err)
+	_, err = store.Redeem("github", state, now)
+	assert.ErrorIs(t, err, services.ErrInvalidOAuthState)
+	_, err = store.Redeem("saml:legacy-hr", "", now)
+	assert.ErrorIs(t, err, services.ErrInvalidOAuthState)
+}
+
+func TestStateStore_KeepsPKCEVerifierWithState(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.OAuthState{}), "Failed to migrate database schema")
+
+	store := services.NewStateStore(db)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice := uuid.New()
+
+	state, verifier, err := store.IssuePKCE("github", alice, now)
+	require.NoError(t, err)
+	assert.Len(t, verifier, 43, "verifiers are 43 to 128 unreserved characters")
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", services.PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"),
+		"matches the RFC 7636 appendix B example")
+
+	userID, redeemed, err := store.RedeemPKCE("github", state, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, alice, userID)
+	assert.Equal(t, verifier, redeemed)
+	_, _, err = store.RedeemPKCE("github", state, now.Add(time.Minute))
+	assert.ErrorIs(t, err, services.ErrInvalidOAuthState, "the verifier is only handed out once")
+
+	state, err = store.Issue("apps", alice, now)
+	require.NoError(t, err)
+	_, redeemed, err = store.RedeemPKCE("apps", state, now)
+	require.NoError(t, err)
+	assert.Empty(t, redeemed)
+}
+
+func TestDemoUserFallback_IsDevelopmentOnly(t *testing.T) {
+	t.Setenv("GIN_MODE", "")
+	t.Setenv("PORT", "")
+	t.Setenv("OAUTH_DEMO_USER_FALLBACK", "")
+	assert.False(t, services.DemoUserFallback(), "off unless asked for")
+
+	t.Setenv("OAUTH_DEMO_USER_FALLBACK", "true")
+	assert.True(t, services.DemoUserFallback())
+
+	t.Setenv("GIN_MODE", "release")
+	assert.False(t, services.DemoUserFallback(), "never in production")
+	t.Setenv("GIN_MODE", "")
+	t.Setenv("PORT", "8080")
+	assert.False(t, services.DemoUserFallback())
+}
@@ -0,0 +1,218 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestOIDCProviderService_AuthorizationCodeFlow(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "https://sso.example.com/")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.SigningKey{}, &models.Session{},
+		&models.OIDCClient{}, &models.OIDCAuthorizationCode{}))
+	keys := services.NewSigningKeyService(db, nil)
+	now := time.Now()
+	require.NoError(t, keys.EnsureActiveKey(now))
+	provider := services.NewOIDCProviderService(db)
+	provider.UseSigningKeys(keys)
+	assert.Equal(t, "https://sso.example.com/oauth2/token", provider.Discovery()["token_endpoint"])
+
+	user := models.User{Email: "ada@example.com", Username: "ada", FirstName: "Ada", LastName: "Lovelace", IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+
+	_, _, err = provider.CreateClient(services.OIDCClientInput{Name: "Wiki", RedirectURIs: []string{"http://wiki.example.com/cb"}}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidOIDCClient, "remote redirect URIs must use https")
+	_, _, err = provider.CreateClient(services.OIDCClientInput{Name: "Wiki", RedirectURIs: []string{"https://wiki.example.com/cb"}, Scopes: []string{"admin"}}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidOIDCClient)
+
+	confidential, secret, err := provider.CreateClient(services.OIDCClientInput{
+		Name: "Wiki", RedirectURIs: []string{"https://wiki.example.com/cb"}, Scopes: []string{"email"},
+	}, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	assert.Equal(t, "openid email", confidential.Scopes)
+	public, publicSecret, err := provider.CreateClient(services.OIDCClientInput{
+		Name: "CLI", RedirectURIs: []string{"http://127.0.0.1:8400/callback"}, Public: true,
+	}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, publicSecret)
+
+	_, err = provider.AuthorizeClient(confidential.ClientID, "https://evil.example.com/cb")
+	assert.ErrorIs(t, err, services.ErrInvalidOIDCRedirect)
+	_, err = provider.AuthorizeClient("cg_unknown", "https://wiki.example.com/cb")
+	assert.ErrorIs(t, err, services.ErrOIDCClientNotFound)
+
+	authorize := func(client *models.OIDCClient, request services.OIDCAuthorizeRequest) url.Values {
+		request.ResponseType = "code"
+		request.RedirectURI = client.RedirectURIs
+		redirect, err := provider.Authorize(client, request, services.OIDCSubject{UserID: user.ID, AAL: models.AAL2}, now)
+		require.NoError(t, err)
+		parsed, err := url.Parse(redirect)
+		require.NoError(t, err)
+		return parsed.Query()
+	}
+
+	// Protocol errors go back to the client with its state
+	query := authorize(confidential, services.OIDCAuthorizeRequest{Scope: "openid profile", State: "s1"})
+	assert.Equal(t, "invalid_scope", query.Get("error"))
+	assert.Equal(t, "s1", query.Get("state"))
+	query = authorize(public, services.OIDCAuthorizeRequest{Scope: "openid"})
+	assert.Equal(t, "invalid_request", query.Get("error"), "public clients must use PKCE")
+
+	// Confidential client: secret authentication, one use per code
+	query = authorize(confidential, services.OIDCAuthorizeRequest{Scope: "openid email", State: "s2", Nonce: "n-123"})
+	require.NotEmpty(t, query.Get("code"))
+	assert.Equal(t, "s2", query.Get("state"))
+	assert.Equal(t, "https://sso.example.com", query.Get("iss"))
+	exchange := services.OIDCTokenRequest{
+		GrantType: "authorization_code", Code: query.Get("code"), RedirectURI: confidential.RedirectURIs,
+		ClientID: confidential.ClientID, ClientSecret: "wrong",
+	}
+	_, err = provider.Exchange(exchange, now)
+	var protocolErr *services.OIDCError
+	require.ErrorAs(t, err, &protocolErr)
+	assert.Equal(t, "invalid_client", protocolErr.Code)
+
+	exchange.ClientSecret = secret
+	tokens, err := provider.Exchange(exchange, now)
+	require.NoError(t, err)
+	_, err = provider.Exchange(exchange, now)
+	require.ErrorAs(t, err, &protocolErr)
+	assert.Equal(t, "invalid_grant", protocolErr.Code, "codes cannot be replayed")
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.PublicKey(kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(confidential.ClientID), jwt.WithIssuer("https://sso.example.com"))
+	require.NoError(t, err, "ID tokens verify against the published keys")
+	assert.Equal(t, user.ID.String(), claims["sub"])
+	assert.Equal(t, "n-123", claims["nonce"])
+	assert.Equal(t, "ada@example.com", claims["email"])
+	assert.Equal(t, "https://refeds.org/profile/mfa", claims["acr"])
+	assert.NotContains(t, claims, "name", "profile was not granted")
+
+	info, err := provider.UserInfo(tokens.AccessToken, now)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", info["email"])
+	_, err = provider.UserInfo(tokens.IDToken, now)
+	assert.ErrorAs(t, err, &protocolErr, "ID tokens are not access tokens")
+	_, err = provider.UserInfo(tokens.AccessToken, now.Add(2*time.Hour))
+	assert.ErrorAs(t, err, &protocolErr, "expired access tokens are rejected")
+
+	// Public client: PKCE binds the code to the verifier
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	pkce := services.OIDCAuthorizeRequest{Scope: "openid profile", CodeChallenge: challenge, CodeChallengeMethod: "S256"}
+	query = authorize(public, pkce)
+	exchange = services.OIDCTokenRequest{
+		GrantType: "authorization_code", Code: query.Get("code"), RedirectURI: public.RedirectURIs,
+		ClientID: public.ClientID, CodeVerifier: "x" + verifier[1:],
+	}
+	_, err = provider.Exchange(exchange, now)
+	require.ErrorAs(t, err, &protocolErr)
+	assert.Equal(t, "invalid_grant", protocolErr.Code)
+
+	query = authorize(public, pkce)
+	exchange.Code, exchange.CodeVerifier = query.Get("code"), verifier
+	_, err = provider.Exchange(exchange, now.Add(2*time.Minute))
+	assert.ErrorAs(t, err, &protocolErr, "codes expire")
+	query = authorize(public, pkce)
+	exchange.Code = query.Get("code")
+	tokens, err = provider.Exchange(exchange, now)
+	require.NoError(t, err)
+	info, err = provider.UserInfo(tokens.AccessToken, now)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace", info["name"])
+	assert.NotContains(t, info, "email")
+
+	// Deleting a client revokes the access tokens it was issued
+	require.NoError(t, provider.DeleteClient(public.ClientID, nil))
+	_, err = provider.UserInfo(tokens.AccessToken, now)
+	assert.ErrorAs(t, err, &protocolErr)
+	assert.ErrorIs(t, provider.DeleteClient(public.ClientID, nil), services.ErrOIDCClientNotFound)
+
+	var replays int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "oidc_code_replayed").Count(&replays)
+	assert.Equal(t, int64(1), replays)
+}
+
+func TestOIDCProviderService_APIScopeConsent(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "https://sso.example.com")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.SigningKey{}, &models.Session{},
+		&models.OIDCClient{}, &models.OIDCAuthorizationCode{}, &models.ConsentRecord{}))
+	keys := services.NewSigningKeyService(db, nil)
+	now := time.Now()
+	require.NoError(t, keys.EnsureActiveKey(now))
+	consents := services.NewConsentService(db)
+	provider := services.NewOIDCProviderService(db)
+	provider.UseSigningKeys(keys)
+	provider.UseConsents(consents)
+	assert.Contains(t, provider.Discovery()["scopes_supported"], services.APIScopeAuditRead)
+
+	user := models.User{Email: "ada@example.com", Username: "ada", IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+	client, secret, err := provider.CreateClient(services.OIDCClientInput{
+		Name: "SOC Dashboard", RedirectURIs: []string{"https://soc.example.com/cb"},
+		Scopes: []string{services.APIScopeAlertsRead, services.APIScopeIncidentsWrite},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "openid alerts:read incidents:write", client.Scopes)
+
+	request := services.OIDCAuthorizeRequest{ResponseType: "code", RedirectURI: client.RedirectURIs, Scope: "openid alerts:read"}
+	subject := services.OIDCSubject{UserID: user.ID, AAL: models.AAL1}
+	_, err = provider.Authorize(client, request, subject, now)
+	var consentErr *services.OIDCConsentRequiredError
+	require.ErrorAs(t, err, &consentErr)
+	assert.Equal(t, []string{services.APIScopeAlertsRead}, consentErr.Scopes)
+
+	require.NoError(t, provider.ConsentToScopes(user.ID, client.ClientID, consentErr.Scopes, "203.0.113.7", "test"))
+	redirect, err := provider.Authorize(client, request, subject, now)
+	require.NoError(t, err)
+	// Asking for another scope asks for consent to that scope only
+	request.Scope = "openid alerts:read incidents:write"
+	_, err = provider.Authorize(client, request, subject, now)
+	require.ErrorAs(t, err, &consentErr)
+	assert.Equal(t, []string{services.APIScopeIncidentsWrite}, consentErr.Scopes)
+
+	parsed, err := url.Parse(redirect)
+	require.NoError(t, err)
+	tokens, err := provider.Exchange(services.OIDCTokenRequest{
+		GrantType: "authorization_code", Code: parsed.Query().Get("code"), RedirectURI: client.RedirectURIs,
+		ClientID: client.ClientID, ClientSecret: secret,
+	}, now)
+	require.NoError(t, err)
+	identity, err := provider.VerifyToken(context.Background(), tokens.AccessToken, now)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, identity.UserID)
+	assert.Equal(t, []string{services.APIScopeAlertsRead}, identity.Scopes)
+	_, err = provider.VerifyToken(context.Background(), tokens.IDToken, now)
+	assert.ErrorIs(t, err, services.ErrInvalidAccessToken)
+
+	// Revoking the consent takes the scopes back from tokens already issued
+	var consentList []models.ConsentRecord
+	require.NoError(t, db.Find(&consentList).Error)
+	require.Len(t, consentList, 1)
+	require.NoError(t, consents.RevokeConsent(user.ID, consentList[0].AppID))
+	identity, err = provider.VerifyToken(context.Background(), tokens.AccessToken, now)
+	require.NoError(t, err)
+	assert.Empty(t, identity.Scopes)
+	assert.NotNil(t, identity.Scopes, "the token stays limited to API scopes")
+}
@@ -0,0 +1,65 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestLogAuditEvent_WritesAfterRequestIsCancelled(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	originalDB := services.DB
+	services.DB = db
+	defer func() { services.DB = originalDB }()
+
+	// The client hung up, but what it did still has to be on record
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	services.LogAuditEvent(ctx, "", "password_changed", "user", "", "203.0.113.1", "test", "", "success")
+
+	var count int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("action = ?", "password_changed").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestThreatIntelligence_ProviderCallsFollowRequestContext(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// Stalls until the caller gives up
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"abuseConfidenceScore": 90, "totalReports": 3}})
+	}))
+	defer server.Close()
+	intel := services.NewThreatIntelligenceService()
+	intel.AddProvider(services.NewAbuseIPDBProvider(server.URL, "abuse-key", 30, 25))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := intel.GetThreatData(ctx, "203.0.113.66")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(started), 2*time.Second, "the lookup ends with the request, not the client timeout")
+
+	// The abandoned lookup was not cached as a miss
+	data, err := intel.GetThreatData(context.Background(), "203.0.113.66")
+	require.NoError(t, err)
+	assert.Equal(t, "abuseipdb", data.Source)
+	assert.Equal(t, int32(2), calls.Load())
+}
@@ -0,0 +1,148 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestPhishingResistantService(t *testing.T) (*services.PhishingResistantService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.PhishingResistantPolicy{}, &services.WebAuthnCredential{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewPhishingResistantService(db), db
+}
+
+func createPhishingResistantUser(t *testing.T, db *gorm.DB, email string) models.User {
+	user := models.User{Email: email, Username: email}
+	require.NoError(t, db.Create(&user).Error)
+	return user
+}
+
+func TestPhishingResistantService_SetPolicyValidation(t *testing.T) {
+	service, _ := setupTestPhishingResistantService(t)
+	now := time.Now()
+
+	_, err := service.SetPolicy("acme.com", "admins", services.PhishingResistantPolicyInput{
+		Enabled: true, Members: []string{"eve@other.com"},
+	}, nil, now)
+	assert.ErrorIs(t, err, services.ErrInvalidPhishingResistantPolicy, "members must belong to the tenant")
+
+	_, err = service.SetPolicy("acme.com", "admins", services.PhishingResistantPolicyInput{GracePeriodDays: -1}, nil, now)
+	assert.ErrorIs(t, err, services.ErrInvalidPhishingResistantPolicy)
+
+	policy, err := service.SetPolicy("ACME.com", "Admins", services.PhishingResistantPolicyInput{
+		Enabled: true, GracePeriodDays: 14, Members: []string{" Alice@acme.com", "alice@acme.com"},
+	}, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, "acme.com", policy.Tenant)
+	assert.Equal(t, "admins", policy.Group)
+	assert.Equal(t, "alice@acme.com", policy.Members)
+	require.NotNil(t, policy.EnforcedFrom)
+	assert.WithinDuration(t, now.AddDate(0, 0, 14), *policy.EnforcedFrom, time.Second)
+
+	// Updating an enabled policy keeps the original start of its grace period
+	policy, err = service.SetPolicy("acme.com", "admins", services.PhishingResistantPolicyInput{
+		Enabled: true, GracePeriodDays: 7, Members: []string{"alice@acme.com"},
+	}, nil, now.Add(48*time.Hour))
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.AddDate(0, 0, 7), *policy.EnforcedFrom, time.Second)
+
+	policies, err := service.ListPolicies()
+	require.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	assert.ErrorIs(t, service.DeletePolicy("acme.com", "auditors", nil), services.ErrPhishingResistantPolicyNotFound)
+	require.NoError(t, service.DeletePolicy("acme.com", "admins", nil))
+}
+
+func TestPhishingResistantService_CheckOTPStepUp(t *testing.T) {
+	service, db := setupTestPhishingResistantService(t)
+	now := time.Now()
+	admin := createPhishingResistantUser(t, db, "admin@acme.com")
+	staff := createPhishingResistantUser(t, db, "staff@acme.com")
+
+	_, err := service.SetPolicy("acme.com", "admins", services.PhishingResistantPolicyInput{
+		Enabled: true, GracePeriodDays: 7, Members: []string{admin.Email},
+	}, nil, now)
+	require.NoError(t, err)
+
+	requirement, err := service.CheckOTPStepUp(staff.ID, staff.Email, now)
+	require.NoError(t, err)
+	assert.Nil(t, requirement, "users outside the group are not restricted")
+
+	requirement, err = service.CheckOTPStepUp(admin.ID, admin.Email, now.Add(24*time.Hour))
+	require.NoError(t, err, "OTP is still allowed during the grace period")
+	require.NotNil(t, requirement)
+	assert.True(t, requirement.InGrace)
+
+	requirement, err = service.CheckOTPStepUp(admin.ID, "Admin@acme.com", now.AddDate(0, 0, 8))
+	assert.ErrorIs(t, err, services.ErrPhishingResistantRequired)
+	require.NotNil(t, requirement)
+	assert.False(t, requirement.InGrace)
+
+	var denials int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("action = ? AND status = ?", "phishing_resistant_step_up_denied", "failure").Count(&denials).Error)
+	assert.Equal(t, int64(1), denials)
+
+	// Disabled policies are not enforced
+	_, err = service.SetPolicy("acme.com", "admins", services.PhishingResistantPolicyInput{Members: []string{admin.Email}}, nil, now)
+	require.NoError(t, err)
+	requirement, err = service.CheckOTPStepUp(admin.ID, admin.Email, now.AddDate(0, 0, 8))
+	require.NoError(t, err)
+	assert.Nil(t, requirement)
+}
+
+func TestPhishingResistantService_Report(t *testing.T) {
+	service, db := setupTestPhishingResistantService(t)
+	now := time.Now()
+	enrolled := createPhishingResistantUser(t, db, "keyholder@acme.com")
+	pending := createPhishingResistantUser(t, db, "pending@acme.com")
+	require.NoError(t, db.Create(&services.WebAuthnCredential{ID: uuid.New(), UserID: enrolled.ID, CredentialID: "cred-1", CreatedAt: now}).Error)
+
+	_, err := service.SetPolicy("acme.com", "admins", services.PhishingResistantPolicyInput{
+		Enabled: true, GracePeriodDays: 10, Members: []string{enrolled.Email, pending.Email, "ghost@acme.com"},
+	}, nil, now)
+	require.NoError(t, err)
+	_, err = service.CheckOTPStepUp(pending.ID, pending.Email, now)
+	require.NoError(t, err)
+	_, err = service.CheckOTPStepUp(pending.ID, pending.Email, now)
+	require.NoError(t, err)
+
+	reports, err := service.Report(now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	report := reports[0]
+	assert.Equal(t, 10, report.DaysRemaining)
+	assert.Equal(t, 1, report.Enrolled)
+	assert.Equal(t, 2, report.NotEnrolled)
+
+	statuses := map[string]services.PhishingResistantMemberStatus{}
+	for _, member := range report.Members {
+		statuses[member.Email] = member
+	}
+	assert.Equal(t, services.PhishingResistantEnrolled, statuses[enrolled.Email].Status)
+	assert.Equal(t, services.PhishingResistantPending, statuses[pending.Email].Status)
+	assert.Equal(t, int64(2), statuses[pending.Email].GraceStepUps)
+	assert.NotNil(t, statuses[pending.Email].LastGraceUseAt)
+	assert.Equal(t, services.PhishingResistantUnknownUser, statuses["ghost@acme.com"].Status)
+
+	reports, err = service.Report(now.AddDate(0, 0, 11))
+	require.NoError(t, err)
+	assert.Equal(t, 0, reports[0].DaysRemaining)
+	for _, member := range reports[0].Members {
+		if member.Email == pending.Email {
+			assert.Equal(t, services.PhishingResistantOverdue, member.Status)
+		}
+	}
+}
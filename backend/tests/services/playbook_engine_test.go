@@ -0,0 +1,199 @@
+package services_test
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// actionRecorder stands in for the monitoring service's action executor
+type actionRecorder struct {
+	mutex   sync.Mutex
+	actions []services.ActionType
+	fail    map[services.ActionType]bool
+}
+
+func (r *actionRecorder) execute(action services.SecurityAction) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.actions = append(r.actions, action.Type)
+	if r.fail[action.Type] {
+		return errors.New("action failed")
+	}
+	return nil
+}
+
+func (r *actionRecorder) executed() []services.ActionType {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]services.ActionType(nil), r.actions...)
+}
+
+func setupTestPlaybookEngine(t *testing.T) (*services.PlaybookEngine, *actionRecorder) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.Playbook{}, &models.PlaybookExecution{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	recorder := &actionRecorder{fail: map[services.ActionType]bool{}}
+	return services.NewPlaybookEngine(db, recorder.execute), recorder
+}
+
+func TestPlaybookEngine_DefaultPlaybooks(t *testing.T) {
+	engine, recorder := setupTestPlaybookEngine(t)
+
+	playbooks, err := engine.ListPlaybooks()
+	require.NoError(t, err)
+	assert.Len(t, playbooks, 3)
+
+	userID := uuid.New()
+	runs := engine.Run(services.SecurityAlert{
+		ID: uuid.New(), Type: services.AlertTypeDataExfiltration, Severity: services.SeverityCritical,
+		UserID: &userID, IPAddress: "203.0.113.7",
+	})
+	require.Len(t, runs, 1)
+	assert.Equal(t, "critical-alert-response", runs[0].PlaybookName)
+	assert.Equal(t, models.PlaybookCompleted, runs[0].Status)
+	require.Len(t, runs[0].Steps, 2)
+	assert.Len(t, runs[0].Steps[0].Branches, 2)
+
+	executed := recorder.executed()
+	sort.Slice(executed[:2], func(i, j int) bool { return executed[i] < executed[j] })
+	assert.Equal(t, []services.ActionType{services.ActionTypeBlockIP, services.ActionTypeForceLogout, services.ActionTypeNotifyAdmin}, executed)
+
+	// Conditions skip containment that does not apply
+	runs = engine.Run(services.SecurityAlert{ID: uuid.New(), Type: services.AlertTypeAPIAbuse, Severity: services.SeverityHigh})
+	require.Len(t, runs, 1)
+	assert.Equal(t, services.StepSkipped, runs[0].Steps[0].Status)
+	assert.Equal(t, services.StepExecuted, runs[0].Steps[1].Status)
+
+	assert.Empty(t, engine.Run(services.SecurityAlert{ID: uuid.New(), Type: services.AlertTypeAPIAbuse, Severity: services.SeverityLow}))
+}
+
+func TestPlaybookEngine_ApprovalGate(t *testing.T) {
+	engine, recorder := setupTestPlaybookEngine(t)
+
+	// Only the playbook under test should run
+	defaults, err := engine.ListPlaybooks()
+	require.NoError(t, err)
+	for _, playbook := range defaults {
+		require.NoError(t, engine.DeletePlaybook(playbook.ID))
+	}
+	assert.ErrorIs(t, engine.DeletePlaybook(defaults[0].ID), services.ErrPlaybookNotFound)
+
+	definition, err := services.ParsePlaybookDefinition([]byte(`
+name: disable-compromised-account
+trigger:
+  alert_types: [compromised_account]
+steps:
+  - name: Require MFA
+    action: require_mfa
+  - name: Analyst sign-off
+    approval: true
+    condition: {field: severity, operator: gte, value: high}
+  - name: Disable account
+    action: disable_account
+`), true)
+	require.NoError(t, err)
+	_, err = engine.CreatePlaybook(*definition, nil)
+	require.NoError(t, err)
+	_, err = engine.CreatePlaybook(*definition, nil)
+	assert.ErrorIs(t, err, services.ErrPlaybookExists)
+
+	// Below the gate's severity the gate is skipped
+	runs := engine.Run(services.SecurityAlert{ID: uuid.New(), Type: services.AlertTypeCompromisedAccount, Severity: services.SeverityMedium})
+	require.Len(t, runs, 1)
+	assert.Equal(t, models.PlaybookCompleted, runs[0].Status)
+	assert.Equal(t, services.StepSkipped, runs[0].Steps[1].Status)
+
+	// Approved runs resume after the gate
+	alertID := uuid.New()
+	runs = engine.Run(services.SecurityAlert{ID: alertID, Type: services.AlertTypeCompromisedAccount, Severity: services.SeverityCritical})
+	require.Len(t, runs, 1)
+	assert.Equal(t, models.PlaybookAwaitingApproval, runs[0].Status)
+	assert.Equal(t, 1, runs[0].CurrentStep)
+
+	analyst := uuid.New()
+	run, err := engine.Decide(runs[0].ID, &analyst, true, "confirmed with user")
+	require.NoError(t, err)
+	assert.Equal(t, models.PlaybookCompleted, run.Status)
+	require.Len(t, run.Steps, 3)
+	assert.Equal(t, services.StepApproved, run.Steps[1].Status)
+	assert.Equal(t, &analyst, run.Steps[1].DecidedBy)
+	assert.Equal(t, services.ActionTypeDisableAccount, recorder.executed()[len(recorder.executed())-1])
+
+	_, err = engine.Decide(runs[0].ID, &analyst, true, "")
+	assert.ErrorIs(t, err, services.ErrExecutionNotAwaitingApproval)
+
+	history, err := engine.ListExecutions(alertID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Len(t, history[0].Steps, 3)
+
+	// Rejected runs stop at the gate
+	runs = engine.Run(services.SecurityAlert{ID: uuid.New(), Type: services.AlertTypeCompromisedAccount, Severity: services.SeverityHigh})
+	actionsBefore := len(recorder.executed())
+	run, err = engine.Decide(runs[0].ID, &analyst, false, "false positive")
+	require.NoError(t, err)
+	assert.Equal(t, models.PlaybookCancelled, run.Status)
+	assert.Equal(t, services.StepRejected, run.Steps[1].Status)
+	assert.Len(t, recorder.executed(), actionsBefore)
+}
+
+func TestPlaybookEngine_FailedSteps(t *testing.T) {
+	engine, recorder := setupTestPlaybookEngine(t)
+	recorder.fail[services.ActionTypeBlockIP] = true
+
+	_, err := engine.CreatePlaybook(services.PlaybookDefinition{
+		Name:    "brute-force",
+		Trigger: services.PlaybookTrigger{AlertTypes: []services.AlertType{services.AlertTypeBruteForceAttack}},
+		Steps: []services.PlaybookStep{
+			{Name: "Block IP", Action: services.ActionTypeBlockIP, ContinueOnError: true},
+			{Name: "Lock account", Action: services.ActionTypeLockAccount},
+			{Name: "Block again", Action: services.ActionTypeBlockIP},
+			{Name: "Escalate", Action: services.ActionTypeEscalateIncident},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	runs := engine.Run(services.SecurityAlert{ID: uuid.New(), Type: services.AlertTypeBruteForceAttack, Severity: services.SeverityLow})
+	require.Len(t, runs, 1)
+	assert.Equal(t, models.PlaybookFailed, runs[0].Status)
+	require.Len(t, runs[0].Steps, 3)
+	assert.Equal(t, services.StepFailed, runs[0].Steps[0].Status)
+	assert.Equal(t, "action failed", runs[0].Steps[0].Error)
+	assert.NotContains(t, recorder.executed(), services.ActionTypeEscalateIncident)
+}
+
+func TestParsePlaybookDefinition_Validation(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+	}{
+		{"missing name", `{"steps":[{"name":"a","action":"notify_admin"}]}`},
+		{"no steps", `{"name":"p"}`},
+		{"unknown action", `{"name":"p","steps":[{"name":"a","action":"launch_missiles"}]}`},
+		{"unknown field", `{"name":"p","steps":[{"name":"a","acton":"notify_admin"}]}`},
+		{"action and approval", `{"name":"p","steps":[{"name":"a","action":"notify_admin","approval":true}]}`},
+		{"approval in parallel", `{"name":"p","steps":[{"name":"a","parallel":[{"name":"b","approval":true}]}]}`},
+		{"unknown operator", `{"name":"p","steps":[{"name":"a","action":"notify_admin","condition":{"field":"type","operator":"like"}}]}`},
+		{"unknown severity", `{"name":"p","trigger":{"severities":["urgent"]},"steps":[{"name":"a","action":"notify_admin"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := services.ParsePlaybookDefinition([]byte(tt.definition), false)
+			assert.ErrorIs(t, err, services.ErrInvalidPlaybook)
+		})
+	}
+}
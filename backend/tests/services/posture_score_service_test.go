@@ -0,0 +1,95 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestPostureScoreService_ScoresTenants(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.MFASetup{}, &services.WebAuthnCredential{}, &models.DormantAccount{},
+		&models.SecurityAlertRecord{}, &models.Playbook{}, &models.AppConnection{}, &models.PostureScoreSnapshot{}))
+	posture := services.NewPostureScoreService(db)
+	now := time.Now()
+
+	user := func(email string) uuid.UUID {
+		u := models.User{Email: email, Username: email, IsActive: true}
+		require.NoError(t, db.Create(&u).Error)
+		return u.ID
+	}
+	totp := user("totp@acme.com")
+	passkey := user("passkey@Acme.com")
+	idle := user("idle@acme.com")
+	former := user("former@acme.com")
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", former).Update("is_active", false).Error)
+	user("solo@other.com")
+
+	require.NoError(t, db.Create(&models.MFASetup{UserID: totp, Secret: "s", Enabled: true}).Error)
+	require.NoError(t, db.Create(&services.WebAuthnCredential{UserID: passkey, CredentialID: "cred-1"}).Error)
+	require.NoError(t, db.Create(&models.DormantAccount{UserID: idle, Status: models.DormantStatusDormant, LastActivityAt: now}).Error)
+	require.NoError(t, db.Create(&models.DormantAccount{UserID: former, Status: models.DormantStatusDisabled, LastActivityAt: now}).Error)
+	require.NoError(t, db.Create(&models.SecurityAlertRecord{ID: uuid.New(), Type: "compromised_account", Severity: "critical", Title: "Open", UserID: &totp, Status: "open"}).Error)
+	require.NoError(t, db.Create(&models.SecurityAlertRecord{ID: uuid.New(), Type: "compromised_account", Severity: "critical", Title: "Closed", UserID: &totp, Status: "resolved"}).Error)
+	require.NoError(t, db.Create(&models.Playbook{Name: "Lock", Enabled: true,
+		Definition: `{"name":"Lock","trigger":{"alert_types":["brute_force_attack","compromised_account"]}}`}).Error)
+	disabled := models.Playbook{Name: "Off", Definition: `{"name":"Off","trigger":{}}`}
+	require.NoError(t, db.Create(&disabled).Error)
+	require.NoError(t, db.Model(&disabled).Update("enabled", false).Error)
+	require.NoError(t, db.Create(&models.AppConnection{UserID: totp, AppID: "slack", AppName: "Slack", Provider: "slack", Status: "connected", HealthStatus: "healthy"}).Error)
+	require.NoError(t, db.Create(&models.AppConnection{UserID: passkey, AppID: "github", AppName: "GitHub", Provider: "github", Status: "connected", HealthStatus: "error"}).Error)
+
+	tenants, err := posture.Tenants()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme.com", "other.com"}, tenants)
+
+	score, err := posture.Compute("ACME.com", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), score.Users, "inactive users are left out")
+	components := make(map[string]services.PostureComponent)
+	for _, component := range score.Components {
+		components[component.Name] = component
+	}
+	assert.Equal(t, 66.7, components[services.PostureMFACoverage].Score)
+	assert.Equal(t, 33.3, components[services.PosturePasskeyAdoption].Score)
+	assert.Equal(t, 66.7, components[services.PostureStaleAccounts].Score)
+	assert.Equal(t, 75.0, components[services.PostureCriticalAlerts].Score)
+	assert.Equal(t, 20.0, components[services.PostureRuleCoverage].Score)
+	assert.Equal(t, 50.0, components[services.PostureConnectionHealth].Score)
+	assert.Equal(t, 56.2, score.Score)
+	assert.Equal(t, "F", score.Grade)
+
+	// Components with nothing to measure are left out and the rest reweighted
+	solo, err := posture.Compute("other.com", now)
+	require.NoError(t, err)
+	assert.Len(t, solo.Components, 5)
+	var weights float64
+	for _, component := range solo.Components {
+		weights += component.Weight
+	}
+	assert.InDelta(t, 100, weights, 0.5)
+	_, err = posture.Compute("nobody.com", now)
+	assert.ErrorIs(t, err, services.ErrTenantNotFound)
+
+	// Snapshots build the trend
+	recorded, err := posture.Snapshot(now.Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, recorded)
+	require.NoError(t, db.Create(&models.MFASetup{UserID: idle, Secret: "s", Enabled: true}).Error)
+	_, err = posture.Snapshot(now)
+	require.NoError(t, err)
+	history, err := posture.History("acme.com", now.Add(-7*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Greater(t, history[1].Score, history[0].Score)
+	assert.Equal(t, 100.0, history[1].Components[services.PostureMFACoverage])
+}
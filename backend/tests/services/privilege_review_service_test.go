@@ -0,0 +1,98 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestPrivilegeReviewService_RecommendsDemotions(t *testing.T) {
+	t.Setenv("PRIVILEGE_REVIEW_UNUSED_DAYS", "30")
+	t.Setenv("PRIVILEGE_AUDIT_INTERVAL", "15m")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.RoleAssignment{}, &models.AuditLog{}))
+	review := services.NewPrivilegeReviewService(db, nil)
+	rbac := services.NewRBACService(db, services.NewAuditService(db))
+	now := time.Now()
+	daysAgo := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	holder := func(email string, roles ...string) uuid.UUID {
+		user := models.User{Email: email, Username: email, IsActive: true}
+		require.NoError(t, db.Create(&user).Error)
+		for _, role := range roles {
+			_, err := rbac.AssignRole(user.ID, role, nil)
+			require.NoError(t, err)
+		}
+		return user.ID
+	}
+	active := holder("active@example.com", models.RoleAdmin, models.RoleSecurityAnalyst)
+	idle := holder("idle@example.com", models.RoleAdmin)
+	never := holder("never@example.com", models.RoleSecurityAnalyst)
+	locked := holder("locked@example.com", models.RoleAdmin)
+	require.NoError(t, db.Model(&models.RoleAssignment{}).Where("1 = 1").Update("created_at", daysAgo(120)).Error)
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", locked).Update("locked_at", now).Error)
+
+	_, err = rbac.AssignRole(active, "owner", nil)
+	assert.ErrorIs(t, err, services.ErrInvalidRole)
+	_, err = rbac.AssignRole(uuid.New(), models.RoleAdmin, nil)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+	_, err = rbac.AssignRole(active, models.RoleAdmin, nil)
+	require.NoError(t, err, "assigning a held role is a no-op")
+
+	// Repeated reads are audited once per interval; changes every time
+	for i := 0; i < 3; i++ {
+		review.RecordUse(active, "GET", "/api/v1/security/alerts", "203.0.113.9", "curl", 200, now.Add(time.Duration(i)*time.Minute))
+	}
+	review.RecordUse(active, "GET", "/api/v1/security/alerts", "203.0.113.9", "curl", 200, now.Add(20*time.Minute))
+	review.RecordUse(active, "POST", "/admin/canary-keys", "203.0.113.9", "curl", 201, now)
+	review.RecordUse(active, "POST", "/admin/canary-keys", "203.0.113.9", "curl", 201, now)
+	review.RecordUse(idle, "DELETE", "/admin/users/:id/lock", "203.0.113.9", "curl", 200, now)
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("user_id = ? AND action = ?", idle, "privileged_request").
+		Update("created_at", daysAgo(45)).Error)
+
+	report, err := review.Report(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, services.PrivilegeReviewSummary{Holders: 4, Keep: 1, Demote: 2, Revoke: 1}, report.Summary)
+	byUser := make(map[uuid.UUID]services.PrivilegedHolder)
+	for _, h := range report.Holders {
+		byUser[h.UserID] = h
+	}
+	assert.Equal(t, services.PrivilegeKeep, byUser[active].Recommendation)
+	assert.Equal(t, []string{models.RoleAdmin, models.RoleSecurityAnalyst}, byUser[active].Roles)
+	assert.Equal(t, int64(4), byUser[active].RecentRequests)
+	assert.Equal(t, services.PrivilegeDemote, byUser[idle].Recommendation)
+	assert.Equal(t, "DELETE /admin/users/:id/lock", byUser[idle].LastEndpoint)
+	assert.Equal(t, "No privileged request for 45 days", byUser[idle].Reason)
+	assert.Equal(t, services.PrivilegeDemote, byUser[never].Recommendation)
+	assert.Nil(t, byUser[never].LastUsedAt)
+	assert.Equal(t, services.PrivilegeRevoke, byUser[locked].Recommendation)
+
+	var buf bytes.Buffer
+	require.NoError(t, services.WritePrivilegeReviewCSV(&buf, report))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	assert.Equal(t, "recommendation", rows[0][7])
+
+	// Demoting clears the recommendation
+	require.NoError(t, rbac.RevokeRole(never, models.RoleSecurityAnalyst, nil))
+	assert.ErrorIs(t, rbac.RevokeRole(never, models.RoleSecurityAnalyst, nil), services.ErrRoleAssignmentNotFound)
+	report, err = review.Report(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Summary.Holders)
+	assignments, err := rbac.ListAssignments()
+	require.NoError(t, err)
+	assert.Len(t, assignments, 4)
+}
@@ -0,0 +1,132 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// stubSecretValidator accepts only the secrets it was given
+type stubSecretValidator struct {
+	valid map[string]bool
+}
+
+func (v *stubSecretValidator) ValidateClientSecret(ctx context.Context, client services.ProviderOAuthClient, clientID, secret string) error {
+	if !v.valid[secret] {
+		return fmt.Errorf("%w: invalid_client", services.ErrSecretRejected)
+	}
+	return nil
+}
+
+// setupTestProviderSecretService sets up a provider secret service with an in-memory database
+func setupTestProviderSecretService(t *testing.T, validSecrets ...string) (*services.ProviderSecretService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.ProviderSecret{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	valid := make(map[string]bool)
+	for _, secret := range validSecrets {
+		valid[secret] = true
+	}
+	service := services.NewProviderSecretService(db)
+	service.SetValidator(&stubSecretValidator{valid: valid})
+	return service, db
+}
+
+func TestProviderSecretService_RotateSecret(t *testing.T) {
+	t.Setenv("SLACK_CLIENT_SECRET", "env-secret")
+	service, db := setupTestProviderSecretService(t, "secret-one", "secret-two")
+	admin := uuid.New()
+	ctx := context.Background()
+
+	assert.Equal(t, []string{"env-secret"}, service.ClientSecrets("slack"))
+
+	// First rotation keeps the environment secret for in-flight callbacks
+	first, err := service.RotateSecret(ctx, "slack", "secret-one", time.Hour, &admin)
+	require.NoError(t, err)
+	assert.Equal(t, models.ProviderSecretActive, first.Status)
+	assert.Equal(t, "****-one", first.SecretHint)
+	assert.Equal(t, []string{"secret-one", "env-secret"}, service.ClientSecrets("slack"))
+
+	// The next rotation retires the environment secret and gives secret-one the grace window
+	_, err = service.RotateSecret(ctx, "slack", "secret-two", time.Hour, &admin)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"secret-two", "secret-one"}, service.ClientSecrets("slack"))
+
+	secrets, err := service.ListSecrets("slack")
+	require.NoError(t, err)
+	assert.Len(t, secrets, 3)
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "provider_secret_rotated", "slack").Count(&audits)
+	assert.Equal(t, int64(2), audits)
+}
+
+func TestProviderSecretService_RejectedSecret(t *testing.T) {
+	service, db := setupTestProviderSecretService(t, "good")
+	ctx := context.Background()
+
+	_, err := service.RotateSecret(ctx, "github", "bad", time.Hour, nil)
+	assert.ErrorIs(t, err, services.ErrSecretRejected)
+
+	_, err = service.RotateSecret(ctx, "myspace", "good", time.Hour, nil)
+	assert.ErrorIs(t, err, services.ErrUnknownProvider)
+
+	var count int64
+	db.Model(&models.ProviderSecret{}).Count(&count)
+	assert.Zero(t, count)
+
+	var failures int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND status = ?", "provider_secret_rotation_failed", "failure").Count(&failures)
+	assert.Equal(t, int64(1), failures)
+}
+
+func TestProviderSecretService_GraceWindowExpires(t *testing.T) {
+	service, db := setupTestProviderSecretService(t, "old", "new")
+	ctx := context.Background()
+
+	_, err := service.RotateSecret(ctx, "dropbox", "old", time.Hour, nil)
+	require.NoError(t, err)
+	_, err = service.RotateSecret(ctx, "dropbox", "new", time.Hour, nil)
+	require.NoError(t, err)
+
+	db.Model(&models.ProviderSecret{}).Where("status = ?", models.ProviderSecretGrace).
+		Update("grace_until", time.Now().Add(-time.Minute))
+	assert.Equal(t, []string{"new"}, service.ClientSecrets("dropbox"))
+}
+
+func TestTokenEndpointValidator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("client_secret") != "right" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		// Authenticated client, but the dummy code is of course not a real grant
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+	}))
+	defer server.Close()
+
+	validator := &services.TokenEndpointValidator{HTTPClient: server.Client()}
+	client := services.ProviderOAuthClient{TokenURL: server.URL}
+
+	assert.NoError(t, validator.ValidateClientSecret(context.Background(), client, "id", "right"))
+	assert.ErrorIs(t, validator.ValidateClientSecret(context.Background(), client, "id", "wrong"), services.ErrSecretRejected)
+}
@@ -0,0 +1,169 @@
+package services_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestPushDB(t *testing.T) *gorm.DB {
+	_, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.PushDevice{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&models.PushDevice{}) })
+	return db
+}
+
+func TestPushService_RegisterListAndRemoveDevices(t *testing.T) {
+	t.Setenv("FCM_SERVICE_ACCOUNT_FILE", "")
+	db := setupTestPushDB(t)
+	push := services.NewPushService(db)
+	assert.False(t, push.Enabled())
+
+	alice, bob := uuid.New(), uuid.New()
+	_, err := push.RegisterDevice(alice, "", "android", "Pixel")
+	assert.ErrorIs(t, err, services.ErrInvalidPushDevice)
+	_, err = push.RegisterDevice(alice, "token-1", "blackberry", "Bold")
+	assert.ErrorIs(t, err, services.ErrInvalidPushDevice)
+
+	device, err := push.RegisterDevice(alice, " token-1 ", "Android", "Pixel")
+	require.NoError(t, err)
+	assert.Equal(t, "android", device.Platform)
+
+	moved, err := push.RegisterDevice(bob, "token-1", "android", "Pixel")
+	require.NoError(t, err)
+	assert.Equal(t, device.ID, moved.ID, "a token registered again moves to the new user")
+
+	devices, err := push.ListDevices(alice)
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+	devices, err = push.ListDevices(bob)
+	require.NoError(t, err)
+	assert.Len(t, devices, 1)
+
+	removed, err := push.RemoveDevice(alice, device.ID)
+	require.NoError(t, err)
+	assert.False(t, removed, "users cannot remove other users' devices")
+	removed, err = push.RemoveDevice(bob, device.ID)
+	require.NoError(t, err)
+	assert.True(t, removed)
+}
+
+func TestPushService_SendAlert(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var mu sync.Mutex
+	var sent []map[string]interface{}
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			require.NoError(t, r.ParseForm())
+			assert.NotEmpty(t, r.PostForm.Get("assertion"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "fcm-access", "expires_in": 3600})
+			return
+		}
+		assert.Equal(t, "/v1/projects/cloudgate-test/messages:send", r.URL.Path)
+		assert.Equal(t, "Bearer fcm-access", r.Header.Get("Authorization"))
+		var body struct {
+			Message map[string]interface{} `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body.Message["token"] == "stale-token" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+			return
+		}
+		sent = append(sent, body.Message)
+		w.Write([]byte(`{"name":"projects/cloudgate-test/messages/1"}`))
+	}))
+	defer server.Close()
+
+	accountFile := filepath.Join(t.TempDir(), "service-account.json")
+	account, _ := json.Marshal(map[string]string{
+		"project_id":   "cloudgate-test",
+		"client_email": "push@cloudgate-test.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    server.URL + "/token",
+	})
+	require.NoError(t, os.WriteFile(accountFile, account, 0o600))
+	t.Setenv("FCM_SERVICE_ACCOUNT_FILE", accountFile)
+	t.Setenv("FCM_ENDPOINT", server.URL)
+	t.Setenv("PUSH_ALERT_URL", "https://cloudgate.example/alerts/")
+
+	db := setupTestPushDB(t)
+	push := services.NewPushService(db)
+	require.True(t, push.Enabled())
+
+	active := models.User{ID: uuid.New(), Email: "admin@example.com", Username: "admin", IsActive: true}
+	locked := models.User{ID: uuid.New(), Email: "locked@example.com", Username: "locked", IsActive: true}
+	lockedAt := time.Now()
+	locked.LockedAt = &lockedAt
+	require.NoError(t, db.Create(&active).Error)
+	require.NoError(t, db.Create(&locked).Error)
+	_, err = push.RegisterDevice(active.ID, "live-token", "ios", "iPhone")
+	require.NoError(t, err)
+	_, err = push.RegisterDevice(active.ID, "stale-token", "web", "Old laptop")
+	require.NoError(t, err)
+	_, err = push.RegisterDevice(locked.ID, "locked-token", "android", "Pixel")
+	require.NoError(t, err)
+
+	alert := services.SecurityAlert{
+		ID:          uuid.New(),
+		Type:        services.AlertTypeCompromisedAccount,
+		Severity:    services.SeverityCritical,
+		Title:       "Compromised account",
+		Description: strings.Repeat("x", 300),
+	}
+	count, err := push.SendAlert(context.Background(), alert)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "only the active user's live device is reached")
+
+	mu.Lock()
+	require.Len(t, sent, 1)
+	message := sent[0]
+	assert.Equal(t, 1, tokenRequests)
+	mu.Unlock()
+	assert.Equal(t, "live-token", message["token"])
+	data := message["data"].(map[string]interface{})
+	assert.Equal(t, alert.ID.String(), data["alert_id"])
+	assert.Equal(t, "https://cloudgate.example/alerts/"+alert.ID.String(), data["link"])
+	notification := message["notification"].(map[string]interface{})
+	assert.Equal(t, "[CRITICAL] Compromised account", notification["title"])
+	assert.Len(t, notification["body"], 240)
+
+	devices, err := push.ListDevices(active.ID)
+	require.NoError(t, err)
+	require.Len(t, devices, 1, "devices FCM no longer knows are unregistered")
+	assert.Equal(t, "live-token", devices[0].Token)
+	assert.NotNil(t, devices[0].LastPushAt)
+
+	channel := &services.PushAlertChannel{Push: push, Enabled: true}
+	alert.Severity = services.SeverityHigh
+	require.NoError(t, channel.SendAlert(alert))
+	mu.Lock()
+	assert.Len(t, sent, 1, "alerts below critical are not pushed by default")
+	mu.Unlock()
+}
@@ -0,0 +1,107 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestQueryGuard_CheckRange(t *testing.T) {
+	t.Setenv("AUDIT_QUERY_SYNC_RANGE", "168h")
+	t.Setenv("AUDIT_QUERY_MAX_RANGE", "720h")
+	guard := services.NewQueryGuard()
+	now := time.Now()
+
+	async, err := guard.CheckRange("audit_statistics", now.Add(-24*time.Hour), now)
+	require.NoError(t, err)
+	assert.False(t, async)
+
+	async, err = guard.CheckRange("audit_statistics", now.Add(-14*24*time.Hour), now)
+	require.NoError(t, err)
+	assert.True(t, async, "ranges above the sync range run as jobs")
+
+	_, err = guard.CheckRange("audit_statistics", now.Add(-365*24*time.Hour), now)
+	assert.ErrorIs(t, err, services.ErrQueryRangeTooLarge)
+
+	_, err = guard.CheckRange("audit_statistics", now, now.Add(-time.Hour))
+	assert.ErrorIs(t, err, services.ErrInvalidQueryRange)
+
+	metrics := guard.Metrics()
+	require.Len(t, metrics, 1)
+	assert.Equal(t, int64(1), metrics[0].Deferred)
+	assert.Equal(t, int64(1), metrics[0].Rejected)
+}
+
+func TestQueryGuard_RunRecordsCostAndTimeouts(t *testing.T) {
+	t.Setenv("AUDIT_QUERY_STATEMENT_TIMEOUT", "50ms")
+	guard := services.NewQueryGuard()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = guard.Run(context.Background(), db, "compliance_report", false, func(tx *gorm.DB) error {
+		return tx.Exec("SELECT 1").Error
+	})
+	require.NoError(t, err)
+
+	err = guard.Run(context.Background(), db, "compliance_report", false, func(tx *gorm.DB) error {
+		time.Sleep(100 * time.Millisecond)
+		return tx.Exec("SELECT 1").Error
+	})
+	assert.ErrorIs(t, err, services.ErrQueryTimeout)
+
+	metrics := guard.Metrics()
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "compliance_report", metrics[0].Endpoint)
+	assert.Equal(t, int64(2), metrics[0].Queries)
+	assert.Equal(t, int64(1), metrics[0].Timeouts)
+	assert.Equal(t, int64(0), metrics[0].Failures)
+	assert.GreaterOrEqual(t, metrics[0].MaxMs, int64(50))
+}
+
+func TestAuditService_LargeRangesRunAsJobs(t *testing.T) {
+	t.Setenv("AUDIT_QUERY_SYNC_RANGE", "168h")
+	t.Setenv("AUDIT_QUERY_MAX_RANGE", "720h")
+	db, err := gorm.Open(sqlite.Open("file:reportjobs?mode=memory&cache=shared&_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.ReportJob{}), "Failed to migrate database schema")
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.ReportJob{})
+	})
+	service := services.NewAuditService(db)
+	now := time.Now()
+	analyst := uuid.New()
+
+	_, _, err = service.RequestStatistics(now.Add(-90*24*time.Hour), now, &analyst)
+	assert.ErrorIs(t, err, services.ErrQueryRangeTooLarge)
+
+	stats, job, err := service.RequestStatistics(now.Add(-14*24*time.Hour), now, &analyst)
+	require.NoError(t, err)
+	assert.Nil(t, stats)
+	require.NotNil(t, job)
+	assert.Equal(t, models.ReportJobAuditStatistics, job.Kind)
+	assert.Equal(t, &analyst, job.RequestedBy)
+
+	// The job runs in the background and always reaches a final state; audit_events
+	// uses Postgres column types, so on sqlite it ends up failed with the query error
+	require.Eventually(t, func() bool {
+		stored, err := service.GetReportJob(job.ID)
+		return err == nil && (stored.Status == models.ReportJobCompleted || stored.Status == models.ReportJobFailed)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	stored, err := service.GetReportJob(job.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.StartedAt)
+	assert.NotNil(t, stored.CompletedAt)
+
+	_, err = service.GetReportJob(uuid.New())
+	assert.ErrorIs(t, err, services.ErrReportJobNotFound)
+}
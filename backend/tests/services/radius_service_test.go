@@ -0,0 +1,213 @@
+package services_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+const radiusTestSecret = "s3cret"
+
+var radiusTestNAS = net.ParseIP("10.1.2.3")
+
+type stubRiskEvaluator struct {
+	decision services.AuthDecisionType
+}
+
+func (s *stubRiskEvaluator) EvaluateAuthentication(ctx context.Context, authCtx *services.AuthContext) (*services.AuthDecision, error) {
+	return &services.AuthDecision{Decision: s.decision, RiskLevel: "test"}, nil
+}
+
+// setupTestRadiusService sets up a RADIUS service with one client and one user
+func setupTestRadiusService(t *testing.T, risk services.RadiusRiskEvaluator) (*services.RadiusService, *gorm.DB, *models.User) {
+	t.Setenv("RADIUS_CLIENTS", "10.0.0.0/8="+radiusTestSecret)
+	t.Setenv("RADIUS_MSCHAPV2", "true")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.MFASetup{}, &models.RadiusCredential{}, &models.RadiusChallenge{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("clientPass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &models.User{Email: "user@example.com", Username: "User", PasswordHash: string(hash), IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	return services.NewRadiusService(db, risk), db, user
+}
+
+// radiusRequest builds a signed Access-Request the way a network device would
+func radiusRequest(t *testing.T, build func(p *services.RadiusPacket)) ([]byte, *services.RadiusPacket) {
+	request := &services.RadiusPacket{Code: services.RadiusAccessRequest, Identifier: 7}
+	_, err := rand.Read(request.Authenticator[:])
+	require.NoError(t, err)
+	request.Add(services.RadiusAttrMessageAuthenticator, make([]byte, 16))
+	request.Add(services.RadiusAttrNASIdentifier, []byte("vpn-1"))
+	build(request)
+
+	data, err := request.Encode()
+	require.NoError(t, err)
+	mac := hmac.New(md5.New, []byte(radiusTestSecret))
+	mac.Write(data)
+	copy(data[22:38], mac.Sum(nil)) // Message-Authenticator is the first attribute
+	return data, request
+}
+
+func papRequest(t *testing.T, userName, password string, state []byte) []byte {
+	data, _ := radiusRequest(t, func(p *services.RadiusPacket) {
+		p.Add(services.RadiusAttrUserName, []byte(userName))
+		p.Add(services.RadiusAttrUserPassword, services.EncodeRadiusPassword([]byte(password), []byte(radiusTestSecret), p.Authenticator))
+		if state != nil {
+			p.Add(services.RadiusAttrState, state)
+		}
+	})
+	return data
+}
+
+func sendRadius(t *testing.T, service *services.RadiusService, data []byte) *services.RadiusPacket {
+	raw, err := service.HandlePacket(data, radiusTestNAS, time.Now())
+	require.NoError(t, err)
+	response, err := services.ParseRadiusPacket(raw)
+	require.NoError(t, err)
+
+	// Responses are signed with the request authenticator and the shared secret
+	signed := append([]byte(nil), raw...)
+	copy(signed[4:20], data[4:20])
+	hash := md5.New()
+	hash.Write(signed)
+	hash.Write([]byte(radiusTestSecret))
+	assert.Equal(t, hash.Sum(nil), raw[4:20], "Response Authenticator")
+	assert.True(t, services.VerifyMessageAuthenticator(signed, []byte(radiusTestSecret)), "Message-Authenticator")
+	return response
+}
+
+func TestMSCHAPv2_RFC2759Vectors(t *testing.T) {
+	authenticatorChallenge, _ := hex.DecodeString("5B5D7C7D7B3F2F3E3C2C602132262628")
+	peerChallenge, _ := hex.DecodeString("21402324255E262A28295F2B3A337C7E")
+	ntHash := services.NTPasswordHash("clientPass")
+	assert.Equal(t, "44EBBA8D5312B8D611474411F56989AE", strings.ToUpper(hex.EncodeToString(ntHash)))
+
+	ntResponse := services.MSCHAPv2NTResponse(authenticatorChallenge, peerChallenge, "User", ntHash)
+	assert.Equal(t, "82309ECD8D708B5EA08FAA3981CD83544233114A3D85D6DF", strings.ToUpper(hex.EncodeToString(ntResponse)))
+
+	success, ok := services.VerifyMSCHAPv2(authenticatorChallenge, peerChallenge, ntResponse, "User", ntHash)
+	require.True(t, ok)
+	assert.Equal(t, "S=407A5589115FD0D6209F510FE9C04566932CDA56", success)
+
+	_, ok = services.VerifyMSCHAPv2(authenticatorChallenge, peerChallenge, ntResponse, "User", services.NTPasswordHash("wrong"))
+	assert.False(t, ok)
+}
+
+func TestRadiusService_PAP(t *testing.T) {
+	risk := &stubRiskEvaluator{decision: services.AuthDecisionAllow}
+	service, db, _ := setupTestRadiusService(t, risk)
+
+	response := sendRadius(t, service, papRequest(t, "user@example.com", "clientPass", nil))
+	assert.Equal(t, services.RadiusAccessAccept, response.Code)
+	response = sendRadius(t, service, papRequest(t, `CORP\User`, "clientPass", nil))
+	assert.Equal(t, services.RadiusAccessAccept, response.Code, "usernames may carry a domain prefix")
+
+	response = sendRadius(t, service, papRequest(t, "user@example.com", "wrong", nil))
+	assert.Equal(t, services.RadiusAccessReject, response.Code)
+	response = sendRadius(t, service, papRequest(t, "nobody@example.com", "clientPass", nil))
+	assert.Equal(t, services.RadiusAccessReject, response.Code)
+
+	risk.decision = services.AuthDecisionDeny
+	response = sendRadius(t, service, papRequest(t, "user@example.com", "clientPass", nil))
+	assert.Equal(t, services.RadiusAccessReject, response.Code, "the risk engine can refuse a valid password")
+
+	var failures int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND status = ?", "radius_authentication", "failure").Count(&failures)
+	assert.Equal(t, int64(3), failures)
+
+	// Unknown clients and unsigned requests get no answer at all
+	_, err := service.HandlePacket(papRequest(t, "user@example.com", "clientPass", nil), net.ParseIP("192.0.2.1"), time.Now())
+	assert.ErrorIs(t, err, services.ErrUnknownRadiusClient)
+	tampered := papRequest(t, "user@example.com", "clientPass", nil)
+	tampered[len(tampered)-1] ^= 0xff
+	_, err = service.HandlePacket(tampered, radiusTestNAS, time.Now())
+	assert.ErrorIs(t, err, services.ErrBadMessageAuthenticator)
+}
+
+func TestRadiusService_OTPChallenge(t *testing.T) {
+	risk := &stubRiskEvaluator{decision: services.AuthDecisionAllow}
+	service, db, user := setupTestRadiusService(t, risk)
+
+	// The risk engine can demand a passcode the user cannot provide
+	risk.decision = services.AuthDecisionChallenge
+	response := sendRadius(t, service, papRequest(t, "user@example.com", "clientPass", nil))
+	assert.Equal(t, services.RadiusAccessReject, response.Code)
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "CloudGate", AccountName: user.Email})
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.MFASetup{UserID: user.ID, Secret: key.Secret(), Enabled: true}).Error)
+
+	response = sendRadius(t, service, papRequest(t, "user@example.com", "clientPass", nil))
+	require.Equal(t, services.RadiusAccessChallenge, response.Code)
+	state, ok := response.Get(services.RadiusAttrState)
+	require.True(t, ok)
+
+	response = sendRadius(t, service, papRequest(t, "user@example.com", "000000x", state))
+	assert.Equal(t, services.RadiusAccessReject, response.Code)
+	response = sendRadius(t, service, papRequest(t, "user@example.com", "clientPass", nil))
+	require.Equal(t, services.RadiusAccessChallenge, response.Code)
+	state, _ = response.Get(services.RadiusAttrState)
+
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	require.NoError(t, err)
+	response = sendRadius(t, service, papRequest(t, "user@example.com", code, state))
+	assert.Equal(t, services.RadiusAccessAccept, response.Code)
+	response = sendRadius(t, service, papRequest(t, "user@example.com", code, state))
+	assert.Equal(t, services.RadiusAccessReject, response.Code, "a challenge can only be answered once")
+}
+
+func TestRadiusService_MSCHAPv2(t *testing.T) {
+	service, _, user := setupTestRadiusService(t, &stubRiskEvaluator{decision: services.AuthDecisionAllow})
+
+	mschapRequest := func(password string) []byte {
+		authenticatorChallenge := make([]byte, 16)
+		peerChallenge := make([]byte, 16)
+		_, _ = rand.Read(authenticatorChallenge)
+		_, _ = rand.Read(peerChallenge)
+		ntResponse := services.MSCHAPv2NTResponse(authenticatorChallenge, peerChallenge, "User", services.NTPasswordHash(password))
+		response := append([]byte{1, 0}, peerChallenge...)
+		response = append(response, make([]byte, 8)...)
+		response = append(response, ntResponse...)
+		data, _ := radiusRequest(t, func(p *services.RadiusPacket) {
+			p.Add(services.RadiusAttrUserName, []byte("User"))
+			p.AddVendor(11, authenticatorChallenge)
+			p.AddVendor(25, response)
+		})
+		return data
+	}
+
+	// Without a captured NT hash MS-CHAPv2 cannot be verified
+	response := sendRadius(t, service, mschapRequest("clientPass"))
+	assert.Equal(t, services.RadiusAccessReject, response.Code)
+
+	require.NoError(t, service.RememberPassword(user.ID, "clientPass"))
+	response = sendRadius(t, service, mschapRequest("clientPass"))
+	require.Equal(t, services.RadiusAccessAccept, response.Code)
+	success, ok := response.GetVendor(26)
+	require.True(t, ok)
+	assert.True(t, strings.HasPrefix(string(success[1:]), "S="))
+
+	response = sendRadius(t, service, mschapRequest("wrong"))
+	assert.Equal(t, services.RadiusAccessReject, response.Code)
+}
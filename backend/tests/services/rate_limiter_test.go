@@ -0,0 +1,82 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/middleware"
+)
+
+func TestRateLimiter_LimitsPerIPAndRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := middleware.NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		PerIP:   config.RateLimit{PerMinute: 60, Burst: 3},
+		Routes:  map[string]config.RateLimit{"/auth/": {PerMinute: 60, Burst: 1}},
+	})
+	var refusals []string
+	limiter.OnLimit(func(c *gin.Context, scope, key string) {
+		refusals = append(refusals, scope+" "+key)
+	})
+	router := gin.New()
+	router.Use(limiter.LimitRequests())
+	router.POST("/auth/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/data", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(method, path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/auth/login", "203.0.113.9:1234").Code)
+	for i := 0; i < 2; i++ {
+		w := request(http.MethodPost, "/auth/login", "203.0.113.9:1234")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), "rate_limit_exceeded")
+	}
+	assert.Equal(t, []string{"route /auth/ 203.0.113.9"}, refusals, "a run of refusals is reported once")
+
+	// Refused route requests still count against the address
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodGet, "/data", "203.0.113.9:1234").Code)
+	assert.Equal(t, "ip 203.0.113.9", refusals[1])
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/health", "203.0.113.9:1234").Code, "health checks are never limited")
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/data", "198.51.100.7:1234").Code, "other addresses have their own buckets")
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := middleware.NewRateLimiter(config.RateLimitConfig{PerIP: config.RateLimit{PerMinute: 1, Burst: 1}})
+	router := gin.New()
+	router.Use(limiter.LimitRequests())
+	router.GET("/data", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestConfig_RateLimitRoutes(t *testing.T) {
+	t.Setenv("RATE_LIMIT_REQUESTS_PER_MINUTE", "120")
+	t.Setenv("RATE_LIMIT_BURST", "")
+	t.Setenv("RATE_LIMIT_ROUTES", "/auth/=30:10, bogus, /admin/=300, /api/=x:5")
+
+	limits := config.LoadConfig().RateLimits
+	assert.True(t, limits.Enabled)
+	assert.Equal(t, config.RateLimit{PerMinute: 120, Burst: 100}, limits.PerIP)
+	assert.Equal(t, map[string]config.RateLimit{
+		"/auth/":  {PerMinute: 30, Burst: 10},
+		"/admin/": {PerMinute: 300, Burst: 300},
+	}, limits.Routes)
+}
@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestRBACService_AssignsRolesAndEnforcesThem(t *testing.T) {
+	t.Setenv("RBAC_BOOTSTRAP_ADMINS", "Root@Example.com")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.RoleAssignment{}, &models.AuditLog{}))
+	audit := services.NewAuditService(db)
+	rbac := services.NewRBACService(db, audit)
+
+	user := func(email string) uuid.UUID {
+		u := models.User{Email: email, Username: email, IsActive: true, EmailVerified: true}
+		require.NoError(t, db.Create(&u).Error)
+		return u.ID
+	}
+
+	// Whoever registers a bootstrap address first has not proven they own it
+	squatter := models.User{Email: "ROOT@example.com", Username: "squatter", IsActive: true}
+	require.NoError(t, db.Create(&squatter).Error)
+	allowed, err := rbac.HasRole(squatter.ID, models.RoleAdmin)
+	require.NoError(t, err)
+	assert.False(t, allowed, "unverified addresses are not bootstrapped")
+	require.NoError(t, db.Delete(&squatter).Error)
+
+	root := user("root@example.com")
+	analyst := user("analyst@example.com")
+	other := user("other@example.com")
+
+	// Bootstrap admins are promoted on first use while no admin exists
+	allowed, err = rbac.HasRole(other, models.RoleAdmin)
+	require.NoError(t, err)
+	assert.False(t, allowed, "unlisted users are not bootstrapped")
+	allowed, err = rbac.HasRole(root, models.RoleAdmin)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	_, err = rbac.AssignRole(analyst, models.RoleSecurityAnalyst, &root)
+	require.NoError(t, err)
+	_, err = rbac.AssignRole(analyst, "owner", &root)
+	assert.ErrorIs(t, err, services.ErrInvalidRole)
+	allowed, err = rbac.HasRole(analyst, models.RoleAdmin, models.RoleSecurityAnalyst)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	permissions, err := rbac.UserPermissions(analyst)
+	require.NoError(t, err)
+	assert.Contains(t, permissions, models.PermissionRiskPolicy)
+	assert.NotContains(t, permissions, models.PermissionRoleManage)
+
+	// The last administrator keeps the role
+	assert.ErrorIs(t, rbac.RevokeRole(root, models.RoleAdmin, &root), services.ErrLastAdmin)
+	_, err = rbac.AssignRole(analyst, models.RoleAdmin, &root)
+	require.NoError(t, err)
+	require.NoError(t, rbac.RevokeRole(root, models.RoleAdmin, &analyst))
+	allowed, err = rbac.HasRole(root, models.RoleAdmin)
+	require.NoError(t, err)
+	assert.False(t, allowed, "revocations take effect despite the cache, and bootstrap no longer applies")
+
+	var assigned []models.AuditLog
+	require.NoError(t, db.Where("action = ?", "role_assigned").Find(&assigned).Error)
+	assert.Len(t, assigned, 3)
+	var bootstrapped int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND user_id IS NULL AND resource_id = ?", "role_assigned", root.String()).Count(&bootstrapped)
+	assert.Equal(t, int64(1), bootstrapped, "the bootstrap has no actor")
+	var revoked models.AuditLog
+	require.NoError(t, db.Where("action = ?", "role_revoked").First(&revoked).Error)
+	assert.Equal(t, analyst, *revoked.UserID)
+	assert.Equal(t, root.String(), revoked.ResourceID)
+
+	// RequireRole fails closed and lets role holders through
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var caller uuid.UUID
+	router.Use(func(c *gin.Context) { c.Set("userID", caller) })
+	router.GET("/security", middleware.RequireRole(models.RoleAdmin, models.RoleSecurityAnalyst), func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func(userID uuid.UUID) int {
+		caller = userID
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/security", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, request(analyst), "no checker installed")
+	middleware.SetRoleChecker(rbac)
+	t.Cleanup(func() { middleware.SetRoleChecker(nil) })
+	assert.Equal(t, http.StatusOK, request(analyst))
+	assert.Equal(t, http.StatusForbidden, request(other))
+	assert.Equal(t, http.StatusForbidden, request(uuid.Nil))
+}
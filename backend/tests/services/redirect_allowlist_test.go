@@ -0,0 +1,48 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cloudgate-backend/internal/services"
+)
+
+func TestRedirectAllowlist_CheckRedirect(t *testing.T) {
+	t.Setenv("REDIRECT_ALLOWED_ORIGINS", "https://app.cloudgate.example, http://localhost:3000, http://evil.example")
+	allowlist := services.NewRedirectAllowlist()
+
+	assert.NoError(t, allowlist.CheckRedirect("https://app.cloudgate.example/oauth/callback?provider=google"))
+	assert.NoError(t, allowlist.CheckRedirect("https://APP.cloudgate.example/dashboard"))
+	assert.NoError(t, allowlist.CheckRedirect("http://localhost:3000/oauth/callback"))
+
+	for _, target := range []string{
+		"https://app.cloudgate.example.evil.example/oauth/callback",
+		"https://app.cloudgate.example:8443/oauth/callback",
+		"http://app.cloudgate.example/oauth/callback",
+		"https://user@app.cloudgate.example/oauth/callback",
+		"//app.cloudgate.example/oauth/callback",
+		"/oauth/callback",
+		"javascript:alert(1)",
+		"http://evil.example/", // http is only allowed for loopback, so the entry was ignored
+	} {
+		assert.ErrorIs(t, allowlist.CheckRedirect(target), services.ErrRedirectNotAllowed, target)
+	}
+}
+
+func TestRedirectAllowlist_CheckCallback(t *testing.T) {
+	t.Setenv("OAUTH_CALLBACK_ALLOWED_ORIGINS", "https://api.cloudgate.example")
+	allowlist := services.NewRedirectAllowlist()
+
+	assert.NoError(t, allowlist.CheckCallback("google", "https://api.cloudgate.example/oauth/google/callback"))
+
+	for _, redirectURI := range []string{
+		"https://attacker.example/oauth/google/callback",
+		"https://api.cloudgate.example/oauth/slack/callback",
+		"https://api.cloudgate.example/oauth/google/callback/../../steal",
+		"https://api.cloudgate.example/oauth/google/callback?next=https://attacker.example",
+		"http://localhost:8081/oauth/google/callback",
+	} {
+		assert.ErrorIs(t, allowlist.CheckCallback("google", redirectURI), services.ErrRedirectNotAllowed, redirectURI)
+	}
+}
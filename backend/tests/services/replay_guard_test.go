@@ -0,0 +1,92 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestReplayGuard(t *testing.T) (*services.ReplayGuard, *services.SecurityMonitoringService) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.ReplayCacheEntry{}, &models.AuthNonce{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.ReplayCacheEntry{}, &models.AuthNonce{})
+	})
+	return services.NewReplayGuard(db, monitoring), monitoring
+}
+
+func TestReplayGuard_SAMLAssertions(t *testing.T) {
+	guard, monitoring := setupTestReplayGuard(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	source := services.TokenSource{Provider: "workday", IPAddress: "198.51.100.4"}
+	window := func(notOnOrAfter ...string) []string { return notOnOrAfter }
+
+	err := guard.CheckSAMLAssertion("https://idp.example", "_a1", "2026-03-01T11:59:00Z", window("2026-03-01T12:05:00Z", ""), source, now)
+	require.NoError(t, err)
+
+	err = guard.CheckSAMLAssertion("https://idp.example", "_a1", "2026-03-01T11:59:00Z", window("2026-03-01T12:05:00Z"), source, now)
+	assert.ErrorIs(t, err, services.ErrTokenReplayed)
+	require.Eventually(t, func() bool {
+		alerts, _, err := monitoring.GetAlertQueue(50, 0)
+		return err == nil && len(alerts) == 1 && alerts[0].Type == services.AlertTypeTokenReplay
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The same ID from another issuer is a different assertion
+	assert.NoError(t, guard.CheckSAMLAssertion("https://other-idp.example", "_a1", "", window("2026-03-01T12:05:00Z"), source, now))
+
+	// Validity windows are strict apart from the clock skew allowance
+	assert.NoError(t, guard.CheckSAMLAssertion("https://idp.example", "_a2", "2026-03-01T12:01:00Z", window("2026-03-01T12:05:00Z"), source, now))
+	assert.ErrorIs(t, guard.CheckSAMLAssertion("https://idp.example", "_a3", "2026-03-01T12:03:00Z", window("2026-03-01T12:05:00Z"), source, now), services.ErrTokenNotYetValid)
+	assert.ErrorIs(t, guard.CheckSAMLAssertion("https://idp.example", "_a4", "", window("2026-03-01T12:10:00Z", "2026-03-01T11:57:00Z"), source, now), services.ErrTokenExpired,
+		"the earliest NotOnOrAfter applies")
+	assert.ErrorIs(t, guard.CheckSAMLAssertion("https://idp.example", "_a5", "", window("", ""), source, now), services.ErrInvalidAssertion)
+	assert.ErrorIs(t, guard.CheckSAMLAssertion("https://idp.example", "", "", window("2026-03-01T12:05:00Z"), source, now), services.ErrInvalidAssertion)
+
+	require.NoError(t, guard.PurgeExpired(now.Add(time.Hour)))
+}
+
+func TestReplayGuard_IDTokens(t *testing.T) {
+	guard, _ := setupTestReplayGuard(t)
+	now := time.Now()
+	source := services.TokenSource{Provider: "google", IPAddress: "198.51.100.4"}
+
+	idToken := func(nonce, audience string, expiresAt time.Time) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss":   "https://accounts.google.com",
+			"aud":   audience,
+			"sub":   "1234567890",
+			"iat":   now.Unix(),
+			"exp":   expiresAt.Unix(),
+			"nonce": nonce,
+		})
+		signed, err := token.SignedString([]byte("test"))
+		require.NoError(t, err)
+		return signed
+	}
+
+	nonce, err := guard.IssueNonce("google", now)
+	require.NoError(t, err)
+	token := idToken(nonce, "client-id", now.Add(time.Hour))
+	require.NoError(t, guard.CheckIDToken(token, "client-id", source, now))
+	assert.ErrorIs(t, guard.CheckIDToken(token, "client-id", source, now), services.ErrTokenReplayed)
+
+	// Nonces must have been issued, for this provider, and are single use
+	assert.ErrorIs(t, guard.CheckIDToken(idToken("made-up", "client-id", now.Add(time.Hour)), "client-id", source, now), services.ErrInvalidNonce)
+	assert.ErrorIs(t, guard.CheckIDToken(idToken(nonce, "client-id", now.Add(2*time.Hour)), "client-id", source, now), services.ErrInvalidNonce)
+	microsoftNonce, err := guard.IssueNonce("microsoft", now)
+	require.NoError(t, err)
+	assert.ErrorIs(t, guard.CheckIDToken(idToken(microsoftNonce, "client-id", now.Add(time.Hour)), "client-id", source, now), services.ErrInvalidNonce)
+
+	nonce, err = guard.IssueNonce("google", now)
+	require.NoError(t, err)
+	assert.ErrorIs(t, guard.CheckIDToken(idToken(nonce, "another-client", now.Add(time.Hour)), "client-id", source, now), services.ErrInvalidAssertion)
+	assert.ErrorIs(t, guard.CheckIDToken(idToken(nonce, "client-id", now.Add(-5*time.Minute)), "client-id", source, now), services.ErrTokenExpired)
+	assert.ErrorIs(t, guard.CheckIDToken("not-a-jwt", "client-id", source, now), services.ErrInvalidAssertion)
+	assert.ErrorIs(t, guard.CheckIDToken("", "client-id", source, now), services.ErrInvalidAssertion)
+}
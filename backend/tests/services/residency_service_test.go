@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func openResidencyTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	return db
+}
+
+func setupTestResidencyService(t *testing.T) (*services.ResidencyService, *gorm.DB, *gorm.DB) {
+	t.Setenv("DATA_RESIDENCY_HOME_REGION", "us")
+	t.Setenv("DATA_RESIDENCY_TENANTS", "acme.de=eu, Globex.JP=ap")
+
+	primary := openResidencyTestDB(t)
+	eu := openResidencyTestDB(t)
+	service := services.NewResidencyService(primary)
+	service.AddRegion("eu", eu)
+	return service, primary, eu
+}
+
+func TestResidencyService_RoutesTenantsToTheirRegion(t *testing.T) {
+	service, primary, eu := setupTestResidencyService(t)
+	ctx := context.Background()
+
+	assert.Equal(t, "eu", service.RegionFor("acme.de"))
+	assert.Equal(t, "ap", service.RegionFor("globex.jp"))
+	assert.Equal(t, "us", service.RegionFor("example.com"), "unmapped tenants stay in the home region")
+	assert.Equal(t, "acme.de", services.TenantForEmail("Hans@ACME.de"))
+
+	db, region, err := service.ForTenant(ctx, "acme.de")
+	require.NoError(t, err)
+	assert.Equal(t, "eu", region)
+	require.NoError(t, db.Create(&models.AuditLog{Action: "login"}).Error)
+
+	var stored models.AuditLog
+	require.NoError(t, eu.First(&stored).Error)
+	assert.Equal(t, "eu", stored.Region, "audit entries record the region they are stored in")
+	var count int64
+	require.NoError(t, primary.Model(&models.AuditLog{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	_, _, err = service.ForTenant(ctx, "globex.jp")
+	assert.ErrorIs(t, err, services.ErrRegionUnavailable, "tenant data never falls back to another region")
+}
+
+func TestResidencyService_RefusesCrossRegionQueries(t *testing.T) {
+	service, primary, eu := setupTestResidencyService(t)
+	ctx := services.WithTenant(context.Background(), "acme.de")
+
+	err := primary.WithContext(ctx).Create(&models.AuditLog{Action: "login"}).Error
+	assert.ErrorIs(t, err, services.ErrCrossRegionQuery)
+	var logs []models.AuditLog
+	err = primary.WithContext(ctx).Find(&logs).Error
+	assert.ErrorIs(t, err, services.ErrCrossRegionQuery)
+
+	homeCtx := services.WithTenant(context.Background(), "example.com")
+	err = eu.WithContext(homeCtx).Find(&logs).Error
+	assert.ErrorIs(t, err, services.ErrCrossRegionQuery)
+	require.NoError(t, primary.WithContext(homeCtx).Find(&logs).Error)
+
+	regions := service.Regions()
+	require.Len(t, regions, 3)
+	assert.Equal(t, "us", regions[0].Region)
+	assert.True(t, regions[0].Home)
+	assert.Equal(t, "ap", regions[1].Region)
+	assert.False(t, regions[1].Connected)
+	assert.Equal(t, []string{"acme.de"}, regions[2].Tenants)
+}
+
+func TestLogAuditEvent_WritesToUserRegion(t *testing.T) {
+	service, primary, eu := setupTestResidencyService(t)
+	originalDB := services.DB
+	services.DB = primary
+	services.SetResidencyService(service)
+	defer func() {
+		services.DB = originalDB
+		services.SetResidencyService(nil)
+	}()
+
+	user := models.User{Email: "hans@acme.de", Username: "hans"}
+	require.NoError(t, primary.Create(&user).Error)
+
+	services.LogAuditEvent(context.Background(), user.ID.String(), "login", "session", "", "203.0.113.1", "test", "", "success")
+
+	var stored models.AuditLog
+	require.NoError(t, eu.Where("user_id = ?", user.ID).First(&stored).Error)
+	assert.Equal(t, "eu", stored.Region)
+	var count int64
+	require.NoError(t, primary.Model(&models.AuditLog{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
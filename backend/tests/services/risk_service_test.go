@@ -1,14 +1,21 @@
 package services_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"cloudgate-backend/internal/handlers"
 	"cloudgate-backend/internal/models"
 	"cloudgate-backend/internal/services"
 )
@@ -65,51 +72,51 @@ func TestRiskService_StoreRiskAssessment(t *testing.T) {
 	defer func() { services.DB = originalDB }()
 
 	t.Run("should store risk assessment successfully", func(t *testing.T) {
-		assessment := map[string]interface{}{
-			"user_id":            user.ID.String(),
-			"session_id":         "test-session-123",
-			"ip_address":         "192.168.1.100",
-			"user_agent":         "Mozilla/5.0 (Test Browser)",
-			"location":           map[string]string{"country": "US", "city": "San Francisco"},
-			"device_fingerprint": "test-fingerprint-123",
-			"behavior_signals":   map[string]float64{"typing_speed": 120.5, "mouse_movement": 85.2},
-			"risk_score":         0.65,
-			"risk_level":         "medium",
-			"risk_factors":       []string{"new_device", "unusual_location"},
-			"recommendations":    []string{"require_mfa", "verify_email"},
+		assessment := &services.RiskAssessment{
+			UserID:            user.ID,
+			SessionID:         "test-session-123",
+			IPAddress:         "192.168.1.100",
+			UserAgent:         "Mozilla/5.0 (Test Browser)",
+			Location:          &services.LocationInfo{Country: "US", City: "San Francisco", IsVPN: true},
+			DeviceFingerprint: "test-fingerprint-123",
+			BehaviorSignals:   &services.BehaviorSignals{TypingPattern: services.TypingPattern{AvgKeydownTime: 120.5}},
+			RiskScore:         0.65,
+			RiskLevel:         "medium",
+			Factors:           services.RiskFactorList{{Type: "new_device", Score: 0.7}, {Type: "unusual_location", Score: 0.6}},
+			Recommendations:   []string{"require_mfa", "verify_email"},
 		}
 
-		err := services.StoreRiskAssessment(assessment)
+		err := services.StoreRiskAssessment(context.Background(), assessment)
 		assert.NoError(t, err)
 
-		// Verify assessment was stored
+		// Verify assessment was stored with its nested fields
 		var storedAssessment services.RiskAssessment
 		err = db.Where("user_id = ?", user.ID).First(&storedAssessment).Error
-		assert.NoError(t, err)
+		require.NoError(t, err)
 		assert.Equal(t, "test-session-123", storedAssessment.SessionID)
 		assert.Equal(t, 0.65, storedAssessment.RiskScore)
-		assert.Equal(t, "medium", storedAssessment.RiskLevel)
-	})
-
-	t.Run("should return error for invalid user ID", func(t *testing.T) {
-		assessment := map[string]interface{}{
-			"user_id":    "invalid-uuid",
-			"risk_score": 0.5,
-		}
-
-		err := services.StoreRiskAssessment(assessment)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid user_id format")
+		assert.Equal(t, models.RiskMedium, storedAssessment.RiskLevel)
+		assert.Equal(t, assessment.Location, storedAssessment.Location)
+		assert.Equal(t, 120.5, storedAssessment.BehaviorSignals.TypingPattern.AvgKeydownTime)
+		assert.Equal(t, assessment.Factors, storedAssessment.Factors)
+		assert.Equal(t, []string{"require_mfa", "verify_email"}, storedAssessment.Recommendations)
 	})
 
-	t.Run("should return error for missing user ID", func(t *testing.T) {
-		assessment := map[string]interface{}{
-			"risk_score": 0.5,
-		}
-
-		err := services.StoreRiskAssessment(assessment)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid user_id in assessment")
+	t.Run("should load assessments stored before their fields were typed", func(t *testing.T) {
+		legacyUser := uuid.New()
+		require.NoError(t, db.Exec(`INSERT INTO risk_assessments (id, user_id, risk_score, risk_level, location, factors, recommendations, created_at, updated_at)
+			VALUES (?, ?, 0.5, 'medium', '', ?, '', ?, ?)`,
+			uuid.New(), legacyUser, `{"location_risk":0.6,"device_risk":0,"velocity_risk":0.4}`, time.Now(), time.Now()).Error)
+		require.NoError(t, db.Exec(`INSERT INTO risk_assessments (id, user_id, risk_score, risk_level, factors, created_at, updated_at)
+			VALUES (?, ?, 0.9, 'high', ?, ?, ?)`,
+			uuid.New(), legacyUser, `["idp_risk:entra_id:riskDetected"]`, time.Now().Add(-time.Hour), time.Now()).Error)
+
+		history, err := services.GetRiskAssessmentHistory(context.Background(), legacyUser.String(), 0)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Nil(t, history[0].Location)
+		assert.Equal(t, services.RiskFactorList{{Type: "location", Score: 0.6}, {Type: "velocity", Score: 0.4}}, history[0].Factors)
+		assert.Equal(t, services.RiskFactorList{{Type: "idp_risk:entra_id:riskDetected"}}, history[1].Factors)
 	})
 }
 
@@ -123,42 +130,33 @@ func TestRiskService_GetLatestRiskAssessment(t *testing.T) {
 
 	t.Run("should return latest risk assessment", func(t *testing.T) {
 		// Store multiple assessments
-		assessment1 := map[string]interface{}{
-			"user_id":    user.ID.String(),
-			"risk_score": 0.3,
-			"risk_level": "low",
-		}
-		assessment2 := map[string]interface{}{
-			"user_id":    user.ID.String(),
-			"risk_score": 0.8,
-			"risk_level": "high",
-		}
+		assessment1 := &services.RiskAssessment{UserID: user.ID, RiskScore: 0.3, RiskLevel: "low"}
+		assessment2 := &services.RiskAssessment{UserID: user.ID, RiskScore: 0.8, RiskLevel: "high"}
 
-		err := services.StoreRiskAssessment(assessment1)
+		err := services.StoreRiskAssessment(context.Background(), assessment1)
 		assert.NoError(t, err)
 
 		time.Sleep(10 * time.Millisecond) // Ensure different timestamps
 
-		err = services.StoreRiskAssessment(assessment2)
+		err = services.StoreRiskAssessment(context.Background(), assessment2)
 		assert.NoError(t, err)
 
 		// Get latest assessment
-		latest, err := services.GetLatestRiskAssessment(user.ID.String())
+		latest, err := services.GetLatestRiskAssessment(context.Background(), user.ID.String())
 		assert.NoError(t, err)
 
-		latestMap := latest.(map[string]interface{})
-		assert.Equal(t, 0.8, latestMap["risk_score"])
-		assert.Equal(t, "high", latestMap["risk_level"])
+		assert.Equal(t, 0.8, latest.RiskScore)
+		assert.Equal(t, models.RiskHigh, latest.RiskLevel)
 	})
 
 	t.Run("should return error for non-existent user", func(t *testing.T) {
 		nonExistentUserID := uuid.New().String()
-		_, err := services.GetLatestRiskAssessment(nonExistentUserID)
+		_, err := services.GetLatestRiskAssessment(context.Background(), nonExistentUserID)
 		assert.Error(t, err)
 	})
 
 	t.Run("should return error for invalid user ID", func(t *testing.T) {
-		_, err := services.GetLatestRiskAssessment("invalid-uuid")
+		_, err := services.GetLatestRiskAssessment(context.Background(), "invalid-uuid")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid user ID")
 	})
@@ -175,37 +173,32 @@ func TestRiskService_GetRiskAssessmentHistory(t *testing.T) {
 	t.Run("should return risk assessment history with limit", func(t *testing.T) {
 		// Store multiple assessments
 		for i := 0; i < 5; i++ {
-			assessment := map[string]interface{}{
-				"user_id":    user.ID.String(),
-				"risk_score": float64(i) * 0.2,
-				"risk_level": "test",
-			}
-			err := services.StoreRiskAssessment(assessment)
+			err := services.StoreRiskAssessment(context.Background(), &services.RiskAssessment{UserID: user.ID, RiskScore: float64(i) * 0.2, RiskLevel: models.RiskLow})
 			assert.NoError(t, err)
 			time.Sleep(5 * time.Millisecond) // Ensure different timestamps
 		}
 
 		// Get history with limit
-		history, err := services.GetRiskAssessmentHistory(user.ID.String(), 3)
+		history, err := services.GetRiskAssessmentHistory(context.Background(), user.ID.String(), 3)
 		assert.NoError(t, err)
 		assert.Len(t, history, 3)
 
 		// Should be in descending order (latest first)
-		firstAssessment := history[0].(map[string]interface{})
-		assert.Equal(t, 0.8, firstAssessment["risk_score"]) // Latest assessment
+		assert.Equal(t, 0.8, history[0].RiskScore) // Latest assessment
 	})
 
 	t.Run("should return empty history for user with no assessments", func(t *testing.T) {
+		kc2 := "test-keycloak-id-2"
 		newUser := &models.User{
 			ID:         uuid.New(),
-			KeycloakID: "test-keycloak-id-2",
+			KeycloakID: &kc2,
 			Email:      "test2@example.com",
 			Username:   "testuser2",
 		}
 		err := db.Create(newUser).Error
 		assert.NoError(t, err)
 
-		history, err := services.GetRiskAssessmentHistory(newUser.ID.String(), 10)
+		history, err := services.GetRiskAssessmentHistory(context.Background(), newUser.ID.String(), 10)
 		assert.NoError(t, err)
 		assert.Empty(t, history)
 	})
@@ -395,3 +388,71 @@ func TestRiskService_WebAuthnCredentials(t *testing.T) {
 		assert.Contains(t, err.Error(), "invalid user ID")
 	})
 }
+
+// Benchmark tests
+func BenchmarkRiskService_StoreRiskAssessment(b *testing.B) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &services.RiskAssessment{}); err != nil {
+		b.Fatal(err)
+	}
+	originalDB := services.DB
+	services.DB = db
+	defer func() { services.DB = originalDB }()
+
+	userID := uuid.New()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		assessment := &services.RiskAssessment{
+			UserID:            userID,
+			IPAddress:         "192.168.1.100",
+			UserAgent:         "Mozilla/5.0 (Test Browser)",
+			Location:          &services.LocationInfo{Country: "US", City: "San Francisco"},
+			DeviceFingerprint: "test-fingerprint-123",
+			RiskScore:         0.65,
+			RiskLevel:         "medium",
+			Factors:           services.RiskFactorList{{Type: "new_device"}, {Type: "unusual_location"}},
+			Recommendations:   []string{"require_mfa"},
+		}
+		if err := services.StoreRiskAssessment(context.Background(), assessment); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAssessRiskHandler covers the risk engine's scoring and storage for one request
+func BenchmarkAssessRiskHandler(b *testing.B) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &services.RiskAssessment{}, &services.DeviceFingerprint{}); err != nil {
+		b.Fatal(err)
+	}
+	originalDB := services.DB
+	services.DB = db
+	defer func() { services.DB = originalDB }()
+
+	userID := uuid.New()
+	if err := services.RegisterDeviceFingerprint(userID.String(), "laptop", "Work laptop", "desktop", "Firefox", "Linux"); err != nil {
+		b.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/risk/assess", func(c *gin.Context) { c.Set("userID", userID) }, handlers.AssessRiskHandler)
+	body := `{"device_fingerprint":"laptop","behavior_signals":{"typing_pattern":{"avg_keydown_time":120}}}`
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/risk/assess", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func findRule(rules []services.SecurityRule, name string) *services.SecurityRule {
+	for i := range rules {
+		if rules[i].Name == name {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func TestRuleImportService_ParsesCSVRules(t *testing.T) {
+	bundle, err := services.ParseRuleBundle([]byte(`name,type,severity,field,operator,value,time_window,actions
+Password spray,frequency,high,failed_logins,>=,20,10m,lock_account?duration=1h;notify_admin
+Password spray,frequency,high,distinct_users,>=,5,10m,
+Risky countries,geolocation,medium,country,in,"[""KP"",""IR""]",,require_mfa
+`), services.RuleBundleCSV)
+	require.NoError(t, err)
+	require.Len(t, bundle.Rules, 2)
+
+	spray := bundle.Rules[0]
+	assert.True(t, spray.Enabled)
+	require.Len(t, spray.Conditions, 2)
+	assert.Equal(t, 20.0, spray.Conditions[0].Value)
+	assert.Equal(t, "distinct_users", spray.Conditions[1].Field)
+	require.Len(t, spray.Actions, 2)
+	assert.Equal(t, services.ActionTypeLockAccount, spray.Actions[0].Type)
+	assert.Equal(t, "1h", spray.Actions[0].Parameters["duration"])
+	assert.Equal(t, []interface{}{"KP", "IR"}, bundle.Rules[1].Conditions[0].Value)
+
+	_, err = services.ParseRuleBundle([]byte("name,type\nx,threshold\n"), services.RuleBundleCSV)
+	assert.ErrorIs(t, err, services.ErrInvalidRuleBundle)
+	_, err = services.ParseRuleBundle([]byte(`{"rules":[{"name":"x","condtions":[]}]}`), services.RuleBundleJSON)
+	assert.ErrorIs(t, err, services.ErrInvalidRuleBundle, "misspelt fields are rejected")
+}
+
+func TestRuleImportService_AppliesValidBundles(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	importer := services.NewRuleImportService(db, monitoring)
+
+	bundle, err := services.ParseRuleBundle([]byte(`
+rules:
+  - name: Password spray
+    type: frequency
+    severity: high
+    enabled: true
+    conditions:
+      - {field: failed_logins, operator: ">=", value: 20, time_window: 10m}
+      - {field: distinct_users, operator: ">=", value: 5, time_window: 10m}
+    actions:
+      - {type: lock_account, parameters: {duration: 1h}}
+  - name: Multiple Failed Logins
+    type: threshold
+    severity: critical
+    enabled: true
+    conditions:
+      - {field: failed_logins, operator: ">=", value: 10, time_window: 5m}
+    actions:
+      - {type: lock_account}
+policies:
+  - name: canary-response
+    trigger: {alert_types: [canary_key_used]}
+    steps:
+      - {name: Block IP, action: block_ip}
+`), services.RuleBundleYAML)
+	require.NoError(t, err)
+
+	original := findRule(monitoring.GetSecurityRules(), "Multiple Failed Logins")
+	require.NotNil(t, original)
+
+	report, err := importer.Import(bundle, true, nil, time.Now())
+	require.NoError(t, err)
+	assert.True(t, report.Valid)
+	assert.False(t, report.Applied)
+	require.Len(t, report.Items, 3)
+	assert.Equal(t, services.RuleImportCreate, report.Items[0].Action)
+	assert.Equal(t, services.RuleImportUpdate, report.Items[1].Action)
+	assert.Equal(t, services.RuleImportCreate, report.Items[2].Action)
+	assert.Nil(t, findRule(monitoring.GetSecurityRules(), "Password spray"), "dry runs change nothing")
+
+	report, err = importer.Import(bundle, false, nil, time.Now())
+	require.NoError(t, err)
+	assert.True(t, report.Applied)
+
+	rules := monitoring.GetSecurityRules()
+	require.NotNil(t, findRule(rules, "Password spray"))
+	updated := findRule(rules, "Multiple Failed Logins")
+	require.NotNil(t, updated)
+	assert.Equal(t, original.ID, updated.ID, "updated rules keep their ID")
+	assert.Equal(t, services.SeverityCritical, updated.Severity)
+
+	var playbook models.Playbook
+	require.NoError(t, db.Where("name = ?", "canary-response").First(&playbook).Error)
+	assert.True(t, playbook.Enabled)
+}
+
+func TestRuleImportService_RejectsInvalidBundlesWhole(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	importer := services.NewRuleImportService(db, monitoring)
+
+	bundle, err := services.ParseRuleBundle([]byte(`{
+		"rules": [
+			{"name": "Failed logins copy", "type": "threshold", "severity": "high", "enabled": true,
+			 "conditions": [{"field": "failed_logins", "operator": ">=", "value": 5, "time_window": "5m"}],
+			 "actions": [{"type": "lock_account"}]},
+			{"name": "Broken", "type": "heuristic", "severity": "urgent", "enabled": true,
+			 "conditions": [{"field": "score", "operator": "~", "value": 1}, {"field": "count", "operator": "gt", "value": "many"}],
+			 "actions": [{"type": "launch_missiles"}, {"type": "lock_account", "parameters": {"duration": "forever"}}]},
+			{"name": "Stricter failed logins", "type": "threshold", "severity": "high", "enabled": true,
+			 "conditions": [{"field": "failed_logins", "operator": ">=", "value": 5, "time_window": "5m"},
+			                {"field": "new_device", "operator": "eq", "value": true}],
+			 "actions": [{"type": "require_mfa"}]}
+		],
+		"policies": [
+			{"name": "contain-critical", "trigger": {"severities": ["critical"]},
+			 "steps": [{"name": "Notify", "action": "notify_admin"}]},
+			{"name": "no-steps", "steps": []}
+		]
+	}`), services.RuleBundleJSON)
+	require.NoError(t, err)
+
+	report, err := importer.Import(bundle, false, nil, time.Now())
+	require.NoError(t, err)
+	assert.False(t, report.Valid)
+	assert.False(t, report.Applied)
+	require.Len(t, report.Items, 5)
+
+	copied := report.Items[0]
+	assert.Equal(t, services.RuleImportInvalid, copied.Action)
+	assert.Contains(t, copied.Errors, `conditions are the same as rule "Multiple Failed Logins"`)
+
+	broken := report.Items[1]
+	assert.Len(t, broken.Errors, 6, "type, severity, two conditions and two actions: %v", broken.Errors)
+
+	stricter := report.Items[2]
+	assert.Empty(t, stricter.Errors)
+	assert.Contains(t, stricter.Warnings, `conditions overlap rule "Failed logins copy", which fires whenever this rule does`)
+
+	contain := report.Items[3]
+	assert.Empty(t, contain.Errors)
+	assert.Contains(t, contain.Warnings, `policy "critical-alert-response" also runs notify_admin for some of the same alerts`)
+	assert.NotEmpty(t, report.Items[4].Errors)
+
+	assert.Nil(t, findRule(monitoring.GetSecurityRules(), "Stricter failed logins"), "valid rules in an invalid bundle are not applied")
+	var count int64
+	db.Model(&models.Playbook{}).Where("name = ?", "contain-critical").Count(&count)
+	assert.Zero(t, count, "valid policies in an invalid bundle are not applied")
+}
@@ -0,0 +1,105 @@
+package services_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+	"cloudgate-backend/pkg/types"
+)
+
+func samlAuthnRequest(t *testing.T, issuer, acsURL string, deflate bool) string {
+	request := `<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+    ID="_req42" Version="2.0" IssueInstant="2026-01-01T00:00:00Z" AssertionConsumerServiceURL="` + acsURL + `"
+    ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST">
+  <saml:Issuer>` + issuer + `</saml:Issuer>
+</samlp:AuthnRequest>`
+	if !deflate {
+		return base64.StdEncoding.EncodeToString([]byte(request))
+	}
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(request))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return base64.StdEncoding.EncodeToString(compressed.Bytes())
+}
+
+func TestSAMLIssuerService_IssueResponse(t *testing.T) {
+	const spEntityID = "https://payroll.example.com/sp"
+	acsURL := "https://api.cloudgate.test/saml/payroll/acs"
+	t.Setenv("SAML_IDP_ENTITY_ID", "https://cloudgate.test/idp")
+	t.Setenv("SAML_SP_ENTITY_ID", spEntityID)
+	t.Setenv("NEXT_PUBLIC_API_URL", "https://api.cloudgate.test")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.SigningKey{}, &models.SAMLRelyingParty{}, &models.SAMLIdentityProvider{}))
+
+	user := models.User{ID: uuid.New(), Email: "ada@example.com", Username: "ada", FirstName: "Ada", LastName: "Lovelace"}
+	require.NoError(t, db.Create(&user).Error)
+	services.RegisterSaaSApp(&types.SaaSApplication{ID: "payroll", Name: "Payroll", Protocol: constants.ProtocolSAML})
+	t.Cleanup(func() { services.RemoveSaaSApp("payroll") })
+
+	keys := services.NewSigningKeyService(db, nil)
+	require.NoError(t, keys.EnsureActiveKey(time.Now()))
+	issuer := services.NewSAMLIssuerService(db)
+	issuer.UseSigningKeys(keys)
+
+	_, err = issuer.SetRelyingParty("payroll", services.SAMLRelyingPartyInput{
+		EntityID: spEntityID, ACSURL: acsURL, AttributeMappings: map[string]string{"mail": "password_hash"},
+	}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidSAMLRelyingParty, "only known user fields can be mapped")
+	party, err := issuer.SetRelyingParty("payroll", services.SAMLRelyingPartyInput{
+		EntityID: spEntityID, ACSURL: acsURL, NameIDFormat: services.SAMLNameIDPersistent,
+		AttributeMappings: map[string]string{"mail": "email", "displayName": "display_name"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, acsURL, party.ACSURL)
+
+	// Requests are only answered for registered providers at their registered ACS URL
+	_, err = issuer.ParseAuthnRequest(samlAuthnRequest(t, "https://unknown.example.com", acsURL, true), true)
+	assert.ErrorIs(t, err, services.ErrSAMLRelyingPartyNotFound)
+	_, err = issuer.ParseAuthnRequest(samlAuthnRequest(t, spEntityID, "https://evil.example.com/acs", true), true)
+	assert.ErrorIs(t, err, services.ErrInvalidAuthnRequest)
+	request, err := issuer.ParseAuthnRequest(samlAuthnRequest(t, spEntityID, acsURL, false), false)
+	require.NoError(t, err, "HTTP-POST binding")
+	assert.Equal(t, "_req42", request.ID)
+	request, err = issuer.ParseAuthnRequest(samlAuthnRequest(t, spEntityID, acsURL, true), true)
+	require.NoError(t, err, "HTTP-Redirect binding")
+	require.Equal(t, "payroll", request.RelyingParty.AppID)
+
+	sessionEnds := time.Now().Add(2 * time.Minute)
+	response, err := issuer.IssueResponse(request, services.SAMLSubject{UserID: user.ID, AAL: models.AAL2, NotOnOrAfter: sessionEnds}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, acsURL, response.ACSURL)
+	assert.WithinDuration(t, sessionEnds, response.ExpiresAt, time.Second, "assertions end with the app session")
+
+	// CloudGate's own service provider accepts the response once it trusts the issuer
+	certificates, err := keys.Certificates()
+	require.NoError(t, err)
+	sp := services.NewSAMLServiceProvider(db)
+	_, err = sp.SetConfig("payroll", services.SAMLIdPInput{EntityID: issuer.EntityID(), Certificates: certificates}, nil)
+	require.NoError(t, err)
+	xmlData, err := base64.StdEncoding.DecodeString(response.SAMLResponse)
+	require.NoError(t, err)
+	info, err := sp.ValidateResponse("payroll", xmlData)
+	require.NoError(t, err)
+	assert.Equal(t, response.AssertionID, info.ID)
+	assert.Equal(t, user.ID.String(), info.NameID)
+	assert.Equal(t, "_req42", info.InResponseTo)
+	assert.Equal(t, []string{"ada@example.com"}, info.Attributes["mail"])
+	assert.Equal(t, []string{"Ada Lovelace"}, info.Attributes["displayName"])
+	assert.NotContains(t, info.Attributes, "username", "only mapped attributes are sent")
+}
@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+const (
+	samlTestIdP = "https://idp.example.com/saml"
+	samlTestACS = "https://api.cloudgate.test/saml/hr/acs"
+)
+
+func samlTestCertificate(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return key, base64.StdEncoding.EncodeToString(der)
+}
+
+// signedSAMLResponse builds a Response around an assertion signed over its canonical form,
+// then writes the assertion the way an IdP might: attributes reordered and the saml
+// namespace declared on the Response instead
+func signedSAMLResponse(t *testing.T, key *rsa.PrivateKey, audience, recipient string) string {
+	now := time.Now().UTC()
+	notOnOrAfter := now.Add(5 * time.Minute).Format(time.RFC3339)
+	issuer := `<saml:Issuer>` + samlTestIdP + `</saml:Issuer>`
+	body := `<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">alice@example.com</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData InResponseTo="_req1" NotOnOrAfter="` + notOnOrAfter + `" Recipient="` + recipient + `"></saml:SubjectConfirmationData></saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(time.RFC3339) + `" NotOnOrAfter="` + notOnOrAfter + `"><saml:AudienceRestriction><saml:Audience>` + audience + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AttributeStatement><saml:Attribute Name="groups"><saml:AttributeValue>hr</saml:AttributeValue><saml:AttributeValue>staff</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>`
+	canonicalStart := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" IssueInstant="` + now.Format(time.RFC3339) + `" Version="2.0">`
+	digest := sha256.Sum256([]byte(canonicalStart + issuer + body + `</saml:Assertion>`))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>` +
+		`<ds:Reference URI="#_a1"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:Transform></ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	hashed := sha256.Sum256([]byte(signedInfo))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	require.NoError(t, err)
+	signatureElement := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(signature) + `</ds:SignatureValue></ds:Signature>`
+
+	assertion := `<saml:Assertion Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `" ID="_a1">` +
+		issuer + signatureElement + body + `</saml:Assertion>`
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+    ID="_r1" Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `" Destination="` + samlTestACS + `" InResponseTo="_req1">
+  <saml:Issuer>` + samlTestIdP + `</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  ` + assertion + `
+</samlp:Response>`
+}
+
+func TestSAMLServiceProvider_ValidateResponse(t *testing.T) {
+	t.Setenv("SAML_SP_ENTITY_ID", "https://cloudgate.test/sp")
+	t.Setenv("NEXT_PUBLIC_API_URL", "https://api.cloudgate.test")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.SAMLIdentityProvider{}, &models.AuditLog{}))
+	sp := services.NewSAMLServiceProvider(db)
+	key, certificate := samlTestCertificate(t)
+	assert.Equal(t, samlTestACS, sp.ACSURL("hr"))
+
+	valid := signedSAMLResponse(t, key, sp.EntityID(), samlTestACS)
+	_, err = sp.ValidateResponse("hr", []byte(valid))
+	assert.ErrorIs(t, err, services.ErrSAMLIdPNotConfigured)
+
+	// The IdP is imported from its metadata, preferring the HTTP-POST sign-in URL
+	_, err = sp.SetConfig("hr", services.SAMLIdPInput{MetadataXML: `<!DOCTYPE x [<!ENTITY a "b">]><x/>`}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidSAMLIdP)
+	config, err := sp.SetConfig("hr", services.SAMLIdPInput{MetadataXML: `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + samlTestIdP + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="encryption"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>bm90IGEgY2VydA==</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>
+      ` + certificate + `
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso/redirect"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, samlTestIdP, config.EntityID)
+	assert.Equal(t, "https://idp.example.com/sso/post", config.SSOURL)
+	assert.Equal(t, certificate, config.Certificates, "only signing keys are trusted")
+
+	info, err := sp.ValidateResponse("hr", []byte(valid))
+	require.NoError(t, err)
+	assert.Equal(t, "_a1", info.ID)
+	assert.Equal(t, "alice@example.com", info.NameID)
+	assert.Equal(t, "_req1", info.InResponseTo)
+	assert.Len(t, info.NotOnOrAfter, 2)
+	assert.Equal(t, []string{"hr", "staff"}, info.Attributes["groups"])
+
+	rejected := map[string]string{
+		"tampered subject":  strings.Replace(valid, "alice@example.com", "mallory@example.com", 1),
+		"wrong audience":    signedSAMLResponse(t, key, "https://other-sp.example.com", samlTestACS),
+		"wrong recipient":   signedSAMLResponse(t, key, sp.EntityID(), "https://evil.example.com/acs"),
+		"unsigned":          valid[:strings.Index(valid, "<ds:Signature")] + valid[strings.Index(valid, "</ds:Signature>")+len("</ds:Signature>"):],
+		"wrong destination": strings.Replace(valid, `Destination="`+samlTestACS, `Destination="https://evil.example.com/acs`, 1),
+		// The signed assertion is moved aside and an unsigned one takes its place
+		"wrapped": strings.Replace(valid, "<saml:Assertion ", `<samlp:Extensions>`+valid[strings.Index(valid, "<saml:Assertion "):strings.Index(valid, "</samlp:Response>")]+`</samlp:Extensions><saml:Assertion `, 1),
+	}
+	otherKey, _ := samlTestCertificate(t)
+	rejected["untrusted signer"] = signedSAMLResponse(t, otherKey, sp.EntityID(), samlTestACS)
+	for name, response := range rejected {
+		_, err := sp.ValidateResponse("hr", []byte(response))
+		assert.ErrorIs(t, err, services.ErrInvalidSAMLResponse, name)
+	}
+
+	require.NoError(t, sp.DeleteConfig("hr", nil))
+	_, err = sp.ValidateResponse("hr", []byte(valid))
+	assert.ErrorIs(t, err, services.ErrSAMLIdPNotConfigured)
+}
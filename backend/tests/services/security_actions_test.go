@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestSecurityMonitoringService_ResponseActions(t *testing.T) {
+	security, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.Session{}, &models.SecurityActionExecution{}, &models.IPReputation{}, &models.AuditLog{}))
+	t.Cleanup(func() {
+		db.Migrator().DropTable(&models.Session{}, &models.SecurityActionExecution{}, &models.IPReputation{}, &models.AuditLog{})
+	})
+	reputation := services.NewIPReputationService(db, nil)
+	services.SetIPReputationService(reputation)
+	t.Cleanup(func() { services.SetIPReputationService(nil) })
+
+	user := models.User{Email: "mallory@example.com", Username: "mallory"}
+	require.NoError(t, db.Create(&user).Error)
+	_, err := services.NewSessionServiceForTesting(db).CreateSession(user.ID, "203.0.113.9", "curl/8.0")
+	require.NoError(t, err)
+
+	actions := func(actionType services.ActionType) []models.SecurityActionExecution {
+		executions, _, err := security.GetActionExecutions(services.ActionFilters{Type: &actionType, Limit: 50})
+		require.NoError(t, err)
+		return executions
+	}
+
+	// The built-in critical playbook logs the user out everywhere and blocks the source IP
+	_, err = security.GenerateAlert(services.AlertTypeCompromisedAccount, services.SeverityCritical, "Compromised account", "Credential stuffing succeeded",
+		map[string]interface{}{"user_id": user.ID.String(), "ip_address": "203.0.113.9"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(actions(services.ActionTypeForceLogout)) == 1 && len(actions(services.ActionTypeBlockIP)) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	var active int64
+	require.NoError(t, db.Model(&models.Session{}).Where("user_id = ? AND is_active = ?", user.ID, true).Count(&active).Error)
+	assert.Zero(t, active)
+	assert.True(t, reputation.IsBlocked("203.0.113.9", time.Now()))
+	assert.False(t, reputation.IsBlocked("203.0.113.9", time.Now().Add(25*time.Hour)), "automated blocks expire")
+	assert.False(t, reputation.IsBlocked("198.51.100.1", time.Now()))
+	blocked := actions(services.ActionTypeBlockIP)[0]
+	assert.Equal(t, string(services.ActionStatusExecuted), blocked.Status)
+	assert.Equal(t, "203.0.113.9", blocked.IPAddress)
+	require.NotNil(t, blocked.AlertID)
+
+	_, err = security.Playbooks().CreatePlaybook(services.PlaybookDefinition{
+		Name:    "lock-brute-force",
+		Trigger: services.PlaybookTrigger{AlertTypes: []services.AlertType{services.AlertTypeBruteForceAttack}},
+		Steps:   []services.PlaybookStep{{Name: "Lock account", Action: services.ActionTypeLockAccount, Parameters: map[string]interface{}{"duration": "30m"}}},
+	}, nil)
+	require.NoError(t, err)
+	_, err = security.GenerateAlert(services.AlertTypeBruteForceAttack, services.SeverityLow, "Brute force", "Brute force",
+		map[string]interface{}{"user_id": user.ID.String()})
+	require.NoError(t, err)
+	_, err = security.GenerateAlert(services.AlertTypeBruteForceAttack, services.SeverityLow, "Brute force", "Brute force from an unknown account", map[string]interface{}{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(actions(services.ActionTypeLockAccount)) == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	var locked models.User
+	require.NoError(t, db.First(&locked, "id = ?", user.ID).Error)
+	assert.True(t, locked.IsLocked(time.Now()))
+	assert.False(t, locked.IsLocked(time.Now().Add(31*time.Minute)), "the lock lasts the step's duration")
+	assert.Contains(t, locked.LockReason, "Lock account")
+
+	statuses := []string{}
+	for _, execution := range actions(services.ActionTypeLockAccount) {
+		statuses = append(statuses, execution.Status)
+		if execution.Status == string(services.ActionStatusFailed) {
+			assert.Contains(t, execution.Error, "lock_account needs a user_id")
+		}
+	}
+	assert.ElementsMatch(t, []string{string(services.ActionStatusExecuted), string(services.ActionStatusFailed)}, statuses)
+
+	admin := uuid.New()
+	require.NoError(t, security.UnlockAccount(user.ID, &admin))
+	var unlocked models.User
+	require.NoError(t, db.First(&unlocked, "id = ?", user.ID).Error)
+	assert.False(t, unlocked.IsLocked(time.Now()))
+	unlocks := actions(services.ActionTypeUnlockAccount)
+	require.Len(t, unlocks, 1)
+	assert.Equal(t, admin, *unlocks[0].PerformedBy)
+	assert.ErrorIs(t, security.UnlockAccount(uuid.New(), &admin), services.ErrUserNotFound)
+}
+
+func TestSecurityMonitoringService_ForceLogout(t *testing.T) {
+	security, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.Session{}, &models.SecurityActionExecution{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&models.Session{}, &models.SecurityActionExecution{}) })
+	sessions := services.NewSessionServiceForTesting(db)
+
+	user := models.User{Email: "eve@example.com", Username: "eve"}
+	require.NoError(t, db.Create(&user).Error)
+	laptop, err := sessions.CreateSession(user.ID, "203.0.113.9", "Firefox")
+	require.NoError(t, err)
+	phone, err := sessions.CreateSession(user.ID, "198.51.100.7", "Safari")
+	require.NoError(t, err)
+	admin := uuid.New()
+	active := func(session *models.Session) bool {
+		var stored models.Session
+		require.NoError(t, db.First(&stored, "id = ?", session.ID).Error)
+		return stored.IsActive
+	}
+
+	// One session, then the rest; each is recorded as a force_logout by the administrator
+	require.NoError(t, security.ForceLogout(user.ID, &phone.ID, &admin, "Lost phone"))
+	assert.False(t, active(phone))
+	assert.True(t, active(laptop))
+	assert.ErrorIs(t, security.ForceLogout(user.ID, &phone.ID, &admin, ""), services.ErrSessionNotFound)
+	unknown := uuid.New()
+	assert.ErrorIs(t, security.ForceLogout(user.ID, &unknown, &admin, ""), services.ErrSessionNotFound)
+	require.NoError(t, security.ForceLogout(user.ID, nil, &admin, ""))
+	assert.False(t, active(laptop))
+	assert.ErrorIs(t, security.ForceLogout(uuid.New(), nil, &admin, ""), services.ErrUserNotFound)
+
+	forceLogout := services.ActionTypeForceLogout
+	executions, total, err := security.GetActionExecutions(services.ActionFilters{Type: &forceLogout, UserID: &user.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	for _, execution := range executions {
+		assert.Equal(t, admin, *execution.PerformedBy)
+		assert.Equal(t, string(services.ActionStatusExecuted), execution.Status)
+	}
+	descriptions := []string{executions[0].Description, executions[1].Description}
+	assert.Contains(t, descriptions, "Signed out of a session by an administrator: Lost phone")
+}
@@ -0,0 +1,160 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestSecurityCenterService sets up a security center with a fixed IP locator
+func setupTestSecurityCenterService(t *testing.T) (*services.SecurityCenterService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AppConnection{}, &models.ConsentRecord{}, &models.TrustedDevice{},
+		&models.MFASetup{}, &models.BackupCode{}, &services.WebAuthnCredential{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	locate := func(ip string) string { return "Somewhere near " + ip }
+	return services.NewSecurityCenterService(db, locate), db
+}
+
+func createTestSession(t *testing.T, db *gorm.DB, userID uuid.UUID, ip string, createdAt time.Time) models.Session {
+	session := models.Session{
+		ID:           uuid.New(),
+		UserID:       userID,
+		SessionToken: uuid.NewString(),
+		IPAddress:    ip,
+		UserAgent:    "Mozilla/5.0",
+		ExpiresAt:    createdAt.Add(24 * time.Hour),
+		IsActive:     true,
+		CreatedAt:    createdAt,
+	}
+	require.NoError(t, db.Create(&session).Error)
+	return session
+}
+
+func TestSecurityCenterService_Overview(t *testing.T) {
+	service, db := setupTestSecurityCenterService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	current := createTestSession(t, db, userID, "203.0.113.10", now.Add(-time.Hour))
+	ended := createTestSession(t, db, userID, "198.51.100.7", now.Add(-2*time.Hour))
+	require.NoError(t, db.Model(&ended).Update("is_active", false).Error)
+	createTestSession(t, db, uuid.New(), "192.0.2.1", now) // another user's
+
+	require.NoError(t, db.Create(&models.AppConnection{UserID: userID, AppID: "slack", AppName: "Slack", Provider: "slack",
+		Status: "connected", Scopes: "channels:read chat:write", AccessToken: "secret", ConnectedAt: now}).Error)
+	require.NoError(t, db.Create(&models.AppConnection{UserID: userID, AppID: "jira", AppName: "Jira", Provider: "atlassian",
+		Status: "revoked", ConnectedAt: now}).Error)
+
+	setup := models.MFASetup{ID: uuid.New(), UserID: userID, Secret: "secret", Enabled: true}
+	require.NoError(t, db.Create(&setup).Error)
+	require.NoError(t, db.Create(&models.BackupCode{ID: uuid.New(), MFASetupID: setup.ID, Code: "a", Used: false}).Error)
+	require.NoError(t, db.Create(&models.BackupCode{ID: uuid.New(), MFASetupID: setup.ID, Code: "b", Used: true}).Error)
+
+	overview, err := service.Overview(userID, &current.ID, now)
+	require.NoError(t, err)
+
+	require.Len(t, overview.RecentLogins, 2)
+	assert.Equal(t, current.ID, overview.RecentLogins[0].SessionID, "newest sign-in first")
+	assert.Equal(t, "Somewhere near 203.0.113.10", overview.RecentLogins[0].Location)
+	assert.True(t, overview.RecentLogins[0].Current)
+	assert.False(t, overview.RecentLogins[1].Active)
+
+	require.Len(t, overview.ActiveSessions, 1)
+	assert.Equal(t, current.ID, overview.ActiveSessions[0].SessionID)
+
+	require.Len(t, overview.ConnectedApps, 1, "revoked connections are not listed")
+	assert.Equal(t, []string{"channels:read", "chat:write"}, overview.ConnectedApps[0].Scopes)
+
+	assert.True(t, overview.MFA.TOTPEnabled)
+	assert.Equal(t, 1, overview.MFA.BackupCodesRemaining)
+	assert.Empty(t, overview.Passkeys)
+}
+
+func TestSecurityCenterService_RevokeSessionIsScopedToUser(t *testing.T) {
+	service, db := setupTestSecurityCenterService(t)
+	userID := uuid.New()
+	session := createTestSession(t, db, uuid.New(), "203.0.113.10", time.Now())
+
+	assert.ErrorIs(t, service.RevokeSession(userID, session.ID), services.ErrSessionNotFound)
+
+	require.NoError(t, service.RevokeSession(session.UserID, session.ID))
+	var stored models.Session
+	require.NoError(t, db.First(&stored, "id = ?", session.ID).Error)
+	assert.False(t, stored.IsActive)
+	assert.ErrorIs(t, service.RevokeSession(session.UserID, session.ID), services.ErrSessionNotFound, "already revoked")
+}
+
+func TestSecurityCenterService_ActiveSessionsAndRevokeOthers(t *testing.T) {
+	service, db := setupTestSecurityCenterService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	current := createTestSession(t, db, userID, "203.0.113.10", now.Add(-time.Hour))
+	require.NoError(t, db.Model(&current).Update("user_agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 Version/17.5 Safari/605.1.15").Error)
+	phone := createTestSession(t, db, userID, "198.51.100.7", now.Add(-2*time.Hour))
+	require.NoError(t, db.Model(&phone).Update("user_agent", "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 Chrome/126.0 Mobile Safari/537.36").Error)
+	expired := createTestSession(t, db, userID, "192.0.2.1", now.Add(-48*time.Hour))
+	other := createTestSession(t, db, uuid.New(), "192.0.2.2", now)
+
+	sessions, err := service.ActiveSessions(userID, &current.ID, now)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2, "expired sessions are not listed")
+	assert.Equal(t, current.ID, sessions[0].SessionID)
+	assert.True(t, sessions[0].Current)
+	assert.Equal(t, "Safari on macOS", sessions[0].Device)
+	assert.Equal(t, "Chrome on Android", sessions[1].Device)
+	assert.Equal(t, "Somewhere near 198.51.100.7", sessions[1].Location)
+
+	revoked, err := service.RevokeOtherSessions(userID, &current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), revoked, "the expired session is revoked too")
+	sessions, err = service.ActiveSessions(userID, &current.ID, now)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, current.ID, sessions[0].SessionID)
+
+	for _, untouched := range []models.Session{current, other} {
+		var stored models.Session
+		require.NoError(t, db.First(&stored, "id = ?", untouched.ID).Error)
+		assert.True(t, stored.IsActive)
+	}
+	var stored models.Session
+	require.NoError(t, db.First(&stored, "id = ?", expired.ID).Error)
+	assert.False(t, stored.IsActive)
+}
+
+func TestSecurityCenterService_DisconnectApp(t *testing.T) {
+	service, db := setupTestSecurityCenterService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	require.NoError(t, db.Create(&models.AppConnection{UserID: userID, AppID: "slack", AppName: "Slack", Provider: "slack",
+		Status: "connected", AccessToken: "access", RefreshToken: "refresh", ConnectedAt: now}).Error)
+	require.NoError(t, db.Create(&models.ConsentRecord{ID: uuid.New(), UserID: userID, AppID: "slack", GrantedAt: now}).Error)
+
+	require.NoError(t, service.DisconnectApp(userID, "slack"))
+
+	var connection models.AppConnection
+	require.NoError(t, db.First(&connection, "user_id = ? AND app_id = ?", userID, "slack").Error)
+	assert.Equal(t, models.ConnectionRevoked, connection.Status)
+	assert.Empty(t, connection.AccessToken)
+	assert.Empty(t, connection.RefreshToken)
+
+	var consent models.ConsentRecord
+	require.NoError(t, db.First(&consent, "user_id = ? AND app_id = ?", userID, "slack").Error)
+	assert.NotNil(t, consent.RevokedAt)
+
+	assert.ErrorIs(t, service.DisconnectApp(userID, "slack"), services.ErrAppNotConnected)
+	assert.ErrorIs(t, service.DisconnectApp(uuid.New(), "slack"), services.ErrAppNotConnected)
+}
@@ -0,0 +1,173 @@
+package services_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, commonName, uri string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		parsed, err := url.Parse(uri)
+		require.NoError(t, err)
+		template.URIs = []*url.URL{parsed}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func setupTestServiceAccountService(t *testing.T, ca *testCA) (*services.ServiceAccountService, *gorm.DB) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600))
+	t.Setenv("MTLS_CLIENT_CA_FILE", caFile)
+	t.Setenv("MTLS_TRUSTED_PROXIES", "10.0.0.0/8")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.AuditLog{}, &models.ServiceAccount{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	return services.NewServiceAccountService(db), db
+}
+
+func TestServiceAccountService_AuthenticatesForwardedCertificates(t *testing.T) {
+	ca := newTestCA(t, "Service CA")
+	service, db := setupTestServiceAccountService(t, ca)
+	now := time.Now()
+
+	_, err := service.CreateAccount(services.ServiceAccountInput{
+		Name: "login-gateway", CertSubject: "login-gateway", Scopes: []string{services.ServiceScopeLoginEvents}, Enabled: true,
+	}, nil)
+	require.NoError(t, err)
+
+	cert := ca.issue(t, "login-gateway", "")
+	request := httptest.NewRequest("POST", "/internal/events/login", nil)
+	request.Header.Set("X-SSL-Client-Cert", url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))))
+
+	account, err := service.Authenticate(request, net.ParseIP("10.1.2.3"), now)
+	require.NoError(t, err)
+	assert.Equal(t, "login-gateway", account.Name)
+	assert.True(t, services.HasScope(account, services.ServiceScopeLoginEvents))
+	assert.False(t, services.HasScope(account, services.ServiceScopeAPIEvents))
+
+	var stored models.ServiceAccount
+	require.NoError(t, db.First(&stored, "id = ?", account.ID).Error)
+	assert.NotNil(t, stored.LastSeenAt)
+
+	_, err = service.Authenticate(request, net.ParseIP("203.0.113.9"), now)
+	assert.ErrorIs(t, err, services.ErrClientCertificateInvalid, "only trusted proxies may forward certificates")
+
+	foreign := newTestCA(t, "Other CA").issue(t, "login-gateway", "")
+	request.Header.Set("X-SSL-Client-Cert", url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: foreign.Raw}))))
+	_, err = service.Authenticate(request, net.ParseIP("10.1.2.3"), now)
+	assert.ErrorIs(t, err, services.ErrClientCertificateInvalid)
+
+	request.Header.Del("X-SSL-Client-Cert")
+	_, err = service.Authenticate(request, net.ParseIP("10.1.2.3"), now)
+	assert.ErrorIs(t, err, services.ErrClientCertificateRequired)
+}
+
+func TestServiceAccountService_MatchesMostSpecificMapping(t *testing.T) {
+	ca := newTestCA(t, "Service CA")
+	service, _ := setupTestServiceAccountService(t, ca)
+	now := time.Now()
+	cert := ca.issue(t, "events", "spiffe://corp.example/events")
+
+	_, err := service.CreateAccount(services.ServiceAccountInput{Name: "by-subject", CertSubject: "events", Scopes: []string{services.ServiceScopeAPIEvents}, Enabled: true}, nil)
+	require.NoError(t, err)
+	_, err = service.CreateAccount(services.ServiceAccountInput{Name: "by-uri", CertURI: "spiffe://corp.example/events", Scopes: []string{services.ServiceScopeAPIEvents}, Enabled: true}, nil)
+	require.NoError(t, err)
+
+	// The handshake on the mTLS listener already verified the chain
+	request := httptest.NewRequest("POST", "/internal/events/api", nil)
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}}
+	account, err := service.Authenticate(request, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, "by-uri", account.Name)
+
+	pinned, err := service.CreateAccount(services.ServiceAccountInput{Name: "pinned", CertFingerprint: services.CertificateFingerprint(cert), Scopes: []string{services.ServiceScopeAPIEvents}, Enabled: false}, nil)
+	require.NoError(t, err)
+	_, err = service.Authenticate(request, nil, now)
+	assert.ErrorIs(t, err, services.ErrServiceAccountDisabled, "a disabled pinned account is not bypassed by broader mappings")
+
+	input := services.ServiceAccountInput{Name: "pinned", CertFingerprint: services.CertificateFingerprint(cert), Scopes: []string{services.ServiceScopeAPIEvents}, Enabled: true}
+	_, err = service.UpdateAccount(pinned.ID, input, nil)
+	require.NoError(t, err)
+	account, err = service.Authenticate(request, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, "pinned", account.Name)
+
+	other := ca.issue(t, "unmapped", "")
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}, VerifiedChains: [][]*x509.Certificate{{other, ca.cert}}}
+	_, err = service.Authenticate(request, nil, now)
+	assert.ErrorIs(t, err, services.ErrServiceAccountUnknown)
+}
+
+func TestServiceAccountService_ValidatesInput(t *testing.T) {
+	service, _ := setupTestServiceAccountService(t, newTestCA(t, "Service CA"))
+
+	_, err := service.CreateAccount(services.ServiceAccountInput{Name: "no-mapping", Scopes: []string{services.ServiceScopeLoginEvents}}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidServiceAccount)
+	_, err = service.CreateAccount(services.ServiceAccountInput{Name: "bad-scope", CertSubject: "svc", Scopes: []string{"admin"}}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidServiceAccount)
+	_, err = service.CreateAccount(services.ServiceAccountInput{Name: "bad-fingerprint", CertFingerprint: "abc", Scopes: []string{services.ServiceScopeLoginEvents}}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidServiceAccount)
+	_, err = service.UpdateAccount(models.ServiceAccount{}.ID, services.ServiceAccountInput{Name: "x", CertSubject: "x", Scopes: []string{services.ServiceScopeLoginEvents}}, nil)
+	assert.ErrorIs(t, err, services.ErrServiceAccountNotFound)
+}
@@ -0,0 +1,87 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestSessionActivityService_IdleTimeout(t *testing.T) {
+	t.Setenv("SESSION_IDLE_TIMEOUT", "30m")
+	t.Setenv("SESSION_ACTIVITY_WRITE_INTERVAL", "1m")
+	sessions, db, user := setupTestSessionService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	activity := services.NewSessionActivityService(db)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	session, err := sessions.CreateSession(user.ID, "192.168.1.100", "Mozilla/5.0 Test Browser")
+	require.NoError(t, err)
+	lastActivity := func() time.Time {
+		var stored models.Session
+		require.NoError(t, db.First(&stored, "id = ?", session.ID).Error)
+		return stored.UpdatedAt.UTC()
+	}
+	require.NoError(t, db.Model(session).UpdateColumn("updated_at", now.Add(-10*time.Minute)).Error)
+
+	// Passive requests and token refreshes do not keep the session alive
+	ended, _ := activity.RecordActivity(session.ID, false, now)
+	assert.False(t, ended)
+	_, err = sessions.RefreshSession(session.SessionToken)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-10*time.Minute), lastActivity())
+
+	ended, _ = activity.RecordActivity(session.ID, true, now)
+	assert.False(t, ended)
+	assert.Equal(t, now, lastActivity())
+	ended, _ = activity.RecordActivity(session.ID, true, now.Add(30*time.Second))
+	assert.False(t, ended)
+	assert.Equal(t, now, lastActivity(), "activity is written at most once a minute")
+
+	heartbeat, err := activity.Heartbeat(session.ID, now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1800), heartbeat.IdleTimeoutSeconds)
+	assert.Equal(t, now.Add(35*time.Minute), heartbeat.IdleExpiresAt)
+	assert.Equal(t, now.Add(5*time.Minute), lastActivity())
+
+	ended, reason := activity.RecordActivity(session.ID, false, now.Add(35*time.Minute))
+	assert.True(t, ended)
+	assert.Contains(t, reason, "30 minutes")
+	ended, _ = activity.RecordActivity(session.ID, true, now.Add(36*time.Minute))
+	assert.True(t, ended, "an idle session stays ended")
+	_, err = sessions.GetSessionByToken(session.SessionToken)
+	assert.Error(t, err, "the refresh token no longer works")
+
+	var audits []models.AuditLog
+	require.NoError(t, db.Where("action = ?", "session_idle_timeout").Find(&audits).Error)
+	require.Len(t, audits, 1, "the timeout is audited once")
+	assert.Equal(t, user.ID, *audits[0].UserID)
+	assert.Equal(t, session.ID.String(), audits[0].ResourceID)
+	assert.Contains(t, audits[0].Details, "idle timeout 30m0s")
+
+	// A risk policy can only shorten a session's timeout, and the sweep ends sessions
+	// that never make another request
+	risky, err := sessions.CreateSession(user.ID, "203.0.113.7", "curl/8.0")
+	require.NoError(t, err)
+	require.NoError(t, activity.LimitIdleTimeout(risky.ID, 15))
+	require.NoError(t, activity.LimitIdleTimeout(risky.ID, 45))
+	require.NoError(t, db.Model(risky).UpdateColumn("updated_at", now).Error)
+	var stored models.Session
+	require.NoError(t, db.First(&stored, "id = ?", risky.ID).Error)
+	assert.Equal(t, 15, stored.IdleTimeoutMinutes)
+
+	swept, err := activity.ExpireIdle(now.Add(10 * time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, swept)
+	swept, err = activity.ExpireIdle(now.Add(16 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, swept)
+	require.NoError(t, db.First(&stored, "id = ?", risky.ID).Error)
+	assert.False(t, stored.IsActive)
+	_, err = activity.Heartbeat(risky.ID, now.Add(17*time.Minute))
+	assert.ErrorIs(t, err, services.ErrSessionNotFound)
+}
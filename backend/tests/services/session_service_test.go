@@ -165,6 +165,53 @@ func TestSessionService_RefreshSession(t *testing.T) {
 	})
 }
 
+func TestSessionService_ElevateSessionAAL(t *testing.T) {
+	service, _, user := setupTestSessionService(t)
+
+	t.Run("should start new sessions at AAL1", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "192.168.1.100", "Test Browser")
+		assert.NoError(t, err)
+		assert.Equal(t, models.AAL1, session.AuthLevel)
+	})
+
+	t.Run("should raise session level after step-up", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+
+		elevated, err := service.ElevateSessionAAL(session.ID, models.AAL2)
+		assert.NoError(t, err)
+		assert.Equal(t, models.AAL2, elevated.AuthLevel)
+
+		stored, err := service.GetSessionByToken(session.SessionToken)
+		assert.NoError(t, err)
+		assert.Equal(t, models.AAL2, stored.AuthLevel)
+	})
+
+	t.Run("should never lower session level", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+
+		_, err = service.ElevateSessionAAL(session.ID, models.AAL3)
+		require.NoError(t, err)
+
+		elevated, err := service.ElevateSessionAAL(session.ID, models.AAL2)
+		assert.NoError(t, err)
+		assert.Equal(t, models.AAL3, elevated.AuthLevel)
+	})
+
+	t.Run("should reject invalid levels and inactive sessions", func(t *testing.T) {
+		session, err := service.CreateSession(user.ID, "192.168.1.100", "Test Browser")
+		require.NoError(t, err)
+
+		_, err = service.ElevateSessionAAL(session.ID, 4)
+		assert.Error(t, err)
+
+		require.NoError(t, service.InvalidateSession(session.SessionToken))
+		_, err = service.ElevateSessionAAL(session.ID, models.AAL2)
+		assert.Error(t, err)
+	})
+}
+
 func TestSessionService_InvalidateSession(t *testing.T) {
 	service, db, user := setupTestSessionService(t)
 
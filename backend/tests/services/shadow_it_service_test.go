@@ -0,0 +1,137 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestShadowITService(t *testing.T) (*services.ShadowITService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.AuditLog{}, &models.ExtensionDomainReport{}, &models.DiscoveredApp{}, &models.DiscoveredAppGrant{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	services.InitializeSaaSApps()
+	return services.NewShadowITService(db), db
+}
+
+func TestShadowITService_IngestDomainReports(t *testing.T) {
+	service, db := setupTestShadowITService(t)
+	now := time.Now()
+
+	for _, report := range []models.ExtensionDomainReport{
+		{UserID: uuid.New(), Domain: "canva.com", Visits: 4, LoginForms: 1, FirstSeen: now.Add(-48 * time.Hour), LastSeen: now},
+		{UserID: uuid.New(), Domain: "canva.com", Visits: 2, FirstSeen: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour)},
+		{UserID: uuid.New(), Domain: "pastebin.com", Visits: 1, FirstSeen: now, LastSeen: now},
+		{UserID: uuid.New(), Domain: "app.slack.com", Visits: 9, FirstSeen: now, LastSeen: now},
+	} {
+		require.NoError(t, db.Create(&report).Error)
+	}
+
+	require.NoError(t, service.IngestDomainReports(now))
+
+	apps, err := service.Report("", "")
+	require.NoError(t, err)
+	require.Len(t, apps, 2, "catalog domains are not shadow IT")
+	assert.Equal(t, "canva.com", apps[0].Name)
+	assert.Equal(t, int64(2), apps[0].Users)
+	assert.Equal(t, int64(6), apps[0].Visits)
+	assert.Equal(t, "medium", apps[0].RiskLevel, "a sign-in form was seen")
+	assert.Equal(t, "low", apps[1].RiskLevel)
+	assert.WithinDuration(t, now.Add(-48*time.Hour), apps[0].FirstSeen, time.Second)
+}
+
+func TestShadowITService_RecordGrants(t *testing.T) {
+	service, db := setupTestShadowITService(t)
+	scan := time.Now()
+
+	err := service.RecordGrants("google_oauth", []services.OAuthGrant{
+		{ClientID: "mailer", DisplayName: "Mail Merge Pro", UserEmail: "alice@example.com", Scopes: []string{"https://mail.google.com/"}},
+		{ClientID: "mailer", DisplayName: "Mail Merge Pro", UserEmail: "bob@example.com", Scopes: []string{"email"}},
+		{ClientID: "notes", DisplayName: "Notes", UserEmail: "alice@example.com", Scopes: []string{"openid", "email"}},
+	}, scan)
+	require.NoError(t, err)
+
+	apps, err := service.Report("", "high")
+	require.NoError(t, err)
+	require.Len(t, apps, 1)
+	assert.Equal(t, "Mail Merge Pro", apps[0].Name)
+	assert.Equal(t, int64(2), apps[0].Users)
+	assert.Equal(t, "email https://mail.google.com/", apps[0].Scopes)
+
+	// Grants missing from the next scan were revoked
+	err = service.RecordGrants("google_oauth", []services.OAuthGrant{
+		{ClientID: "mailer", DisplayName: "Mail Merge Pro", UserEmail: "bob@example.com", Scopes: []string{"email"}},
+	}, scan.Add(time.Hour))
+	require.NoError(t, err)
+
+	grants, err := service.GetGrants(apps[0].ID)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	assert.Equal(t, "bob@example.com", grants[0].UserEmail)
+
+	var notes models.DiscoveredApp
+	require.NoError(t, db.Where("name = ?", "Notes").First(&notes).Error)
+	assert.Equal(t, int64(0), notes.Users)
+
+	reviewer := uuid.New()
+	reviewed, err := service.SetStatus(notes.ID, services.DiscoveryStatusSanctioned, "approved by IT", &reviewer)
+	require.NoError(t, err)
+	assert.Equal(t, services.DiscoveryStatusSanctioned, reviewed.Status)
+	_, err = service.SetStatus(notes.ID, "ignored", "", &reviewer)
+	assert.ErrorIs(t, err, services.ErrInvalidDiscoveryStatus)
+	_, err = service.SetStatus(uuid.New(), services.DiscoveryStatusBlocked, "", &reviewer)
+	assert.ErrorIs(t, err, services.ErrDiscoveredAppNotFound)
+}
+
+func TestMicrosoftOAuthGrantProvider_FetchGrants(t *testing.T) {
+	respond := func(w http.ResponseWriter, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant-1/oauth2/v2.0/token":
+			respond(w, map[string]string{"access_token": "graph-token"})
+		case "/v1.0/oauth2PermissionGrants":
+			respond(w, map[string]interface{}{"value": []map[string]string{
+				{"clientId": "sp-external", "consentType": "Principal", "principalId": "user-1", "scope": "Mail.Read offline_access"},
+				{"clientId": "sp-external", "consentType": "AllPrincipals", "scope": "User.Read"},
+				{"clientId": "sp-internal", "consentType": "Principal", "principalId": "user-1", "scope": "User.Read"},
+			}})
+		case "/v1.0/servicePrincipals/sp-external":
+			respond(w, map[string]string{"appId": "ext-app", "displayName": "Survey Tool", "appOwnerOrganizationId": "other-tenant"})
+		case "/v1.0/servicePrincipals/sp-internal":
+			respond(w, map[string]string{"appId": "int-app", "displayName": "HR Portal", "appOwnerOrganizationId": "tenant-1"})
+		case "/v1.0/users/user-1":
+			respond(w, map[string]string{"userPrincipalName": "alice@example.com"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := &services.MicrosoftOAuthGrantProvider{
+		TenantID: "tenant-1", ClientID: "client", ClientSecret: "secret",
+		LoginURL: server.URL, GraphURL: server.URL,
+	}
+	grants, err := provider.FetchGrants(context.Background())
+	require.NoError(t, err)
+	require.Len(t, grants, 2, "apps published by the tenant itself are skipped")
+	assert.Equal(t, "ext-app", grants[0].ClientID)
+	assert.Equal(t, "alice@example.com", grants[0].UserEmail)
+	assert.Equal(t, []string{"Mail.Read", "offline_access"}, grants[0].Scopes)
+	assert.True(t, grants[1].TenantWide)
+}
@@ -0,0 +1,139 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func setupTestSigningKeyService(t *testing.T) (*services.SigningKeyService, *gorm.DB) {
+	t.Setenv("SIGNING_KEY_OVERLAP", "24h")
+	t.Setenv("SIGNING_KEY_VALIDITY", "2160h")
+	t.Setenv("SIGNING_KEY_EXPIRY_WARNING", "720h")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	err = db.AutoMigrate(&models.AuditLog{}, &models.SigningKey{})
+	require.NoError(t, err, "Failed to migrate database schema")
+	return services.NewSigningKeyService(db, nil), db
+}
+
+func TestSigningKeyService_ScheduledRotation(t *testing.T) {
+	service, db := setupTestSigningKeyService(t)
+	now := time.Now()
+
+	require.NoError(t, service.EnsureActiveKey(now))
+	require.NoError(t, service.EnsureActiveKey(now), "an existing active key is kept")
+	_, _, original, err := service.ActiveKey()
+	require.NoError(t, err)
+
+	var stored models.SigningKey
+	require.NoError(t, db.Where("kid = ?", original).First(&stored).Error)
+	assert.NotContains(t, stored.PrivateKey, "PRIVATE KEY", "private keys are sealed at rest")
+
+	next, err := service.Rotate(false, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.SigningKeyNext, next.Status)
+	_, err = service.Rotate(false, nil, now)
+	assert.ErrorIs(t, err, services.ErrSigningKeyRotationPending)
+
+	// The next key is published before it signs
+	set, err := service.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, original, set.Keys[0].Kid, "the active key is listed first")
+	assert.Equal(t, "RS256", set.Keys[1].Alg)
+
+	require.NoError(t, service.Maintain(now.Add(time.Hour)))
+	_, _, kid, err := service.ActiveKey()
+	require.NoError(t, err)
+	assert.Equal(t, original, kid, "the old key signs until the overlap ends")
+
+	require.NoError(t, service.Maintain(now.Add(25*time.Hour)))
+	_, _, kid, err = service.ActiveKey()
+	require.NoError(t, err)
+	assert.Equal(t, next.KID, kid)
+	certificates, err := service.Certificates()
+	require.NoError(t, err)
+	assert.Len(t, certificates, 2, "the previous key stays published while its tokens may be in use")
+
+	require.NoError(t, service.Maintain(now.Add(50*time.Hour)))
+	set, err = service.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, next.KID, set.Keys[0].Kid)
+}
+
+func TestSigningKeyService_ImmediateRotationAndRevoke(t *testing.T) {
+	service, _ := setupTestSigningKeyService(t)
+	now := time.Now()
+	require.NoError(t, service.EnsureActiveKey(now))
+	_, _, original, err := service.ActiveKey()
+	require.NoError(t, err)
+
+	replacement, err := service.Rotate(true, nil, now)
+	require.NoError(t, err)
+	_, _, kid, err := service.ActiveKey()
+	require.NoError(t, err)
+	assert.Equal(t, replacement.KID, kid)
+
+	assert.ErrorIs(t, service.Revoke(kid, nil, now), services.ErrSigningKeyInUse)
+	assert.ErrorIs(t, service.Revoke("unknown", nil, now), services.ErrSigningKeyNotFound)
+	require.NoError(t, service.Revoke(original, nil, now))
+
+	set, err := service.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, kid, set.Keys[0].Kid)
+}
+
+func TestSigningKeyService_ExpiryWarning(t *testing.T) {
+	service, db := setupTestSigningKeyService(t)
+	now := time.Now()
+	require.NoError(t, service.EnsureActiveKey(now))
+
+	require.NoError(t, service.Maintain(now))
+	var key models.SigningKey
+	require.NoError(t, db.Where("status = ?", models.SigningKeyActive).First(&key).Error)
+	assert.Nil(t, key.ExpiryAlertedAt)
+
+	// 90 day certificates are flagged 30 days before they expire, once
+	require.NoError(t, service.Maintain(now.Add(61*24*time.Hour)))
+	require.NoError(t, db.First(&key, "id = ?", key.ID).Error)
+	require.NotNil(t, key.ExpiryAlertedAt)
+	alertedAt := *key.ExpiryAlertedAt
+	require.NoError(t, service.Maintain(now.Add(62*24*time.Hour)))
+	require.NoError(t, db.First(&key, "id = ?", key.ID).Error)
+	assert.WithinDuration(t, alertedAt, *key.ExpiryAlertedAt, time.Second)
+}
+
+func TestWSFederationService_UsesManagedSigningKeys(t *testing.T) {
+	keys, _ := setupTestSigningKeyService(t)
+	now := time.Now()
+	require.NoError(t, keys.EnsureActiveKey(now))
+	_, err := keys.Rotate(false, nil, now)
+	require.NoError(t, err)
+
+	service := services.NewWSFederationService()
+	service.UseSigningKeys(keys)
+	certificates, err := keys.Certificates()
+	require.NoError(t, err)
+	assert.Equal(t, certificates[0], service.Certificate())
+
+	metadata := service.FederationMetadata("https://gate.example.com/wsfed")
+	assert.Equal(t, 2, strings.Count(metadata, `<md:KeyDescriptor use="signing">`))
+
+	response, err := service.IssueSignInResponse(wsfedTestApp(), services.WSFedSignInRequest{
+		Action: services.WSFedActionSignIn, Realm: "urn:legacy:portal",
+	}, services.WSFedSubject{Email: "alice@example.com"}, now)
+	require.NoError(t, err)
+	assert.Contains(t, response.Result, certificates[0])
+}
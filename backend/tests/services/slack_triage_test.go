@@ -0,0 +1,143 @@
+package services_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+)
+
+func slackInteraction(teamID, userID, actionID, blockID, selectedUser string) services.SlackInteraction {
+	var interaction services.SlackInteraction
+	interaction.Type = "block_actions"
+	interaction.Team.ID = teamID
+	interaction.User.ID = userID
+	interaction.Actions = []services.SlackBlockAction{{ActionID: actionID, BlockID: blockID, SelectedUser: selectedUser}}
+	return interaction
+}
+
+func TestSlackTriageService_VerifyRequest(t *testing.T) {
+	t.Setenv("SLACK_SIGNING_SECRET", "8f742231b10e8888abcd99yyyzzz85a5")
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	slack := services.NewSlackTriageService(db, monitoring)
+	now := time.Unix(1_700_000_000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte("token=x&team_id=T1&user_id=U1&command=%2Fcloudgate&text=alerts")
+
+	mac := hmac.New(sha256.New, []byte("8f742231b10e8888abcd99yyyzzz85a5"))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	signature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.NoError(t, slack.VerifyRequest(timestamp, signature, body, now.Add(time.Minute)))
+	assert.ErrorIs(t, slack.VerifyRequest(timestamp, signature, append(body, '1'), now), services.ErrInvalidSlackSignature)
+	assert.ErrorIs(t, slack.VerifyRequest(timestamp, "v0=deadbeef", body, now), services.ErrInvalidSlackSignature)
+	assert.ErrorIs(t, slack.VerifyRequest(timestamp, signature, body, now.Add(6*time.Minute)), services.ErrInvalidSlackSignature,
+		"old requests cannot be replayed")
+
+	t.Setenv("SLACK_SIGNING_SECRET", "")
+	unconfigured := services.NewSlackTriageService(db, monitoring)
+	assert.False(t, unconfigured.Enabled())
+	assert.ErrorIs(t, unconfigured.VerifyRequest(timestamp, signature, body, now), services.ErrInvalidSlackSignature)
+}
+
+func TestSlackTriageService_TriagesAlertsAsMappedAnalysts(t *testing.T) {
+	monitoring, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AppConnection{}, &models.SlackAnalyst{}, &models.AuditLog{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&models.AppConnection{}, &models.SlackAnalyst{}, &models.AuditLog{}) })
+	originalDB := services.DB
+	services.DB = db
+	t.Cleanup(func() { services.DB = originalDB })
+
+	alice := models.User{Email: "alice@corp.example", Username: "alice", IsActive: true}
+	bob := models.User{Email: "bob@corp.example", Username: "bob", IsActive: true}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	require.NoError(t, db.Create(&models.AppConnection{
+		UserID: alice.ID, AppID: "slack", Status: constants.StatusConnected,
+		Extras: `{"slack_user_id":"U1","team_id":"T1","team_name":"Corp"}`,
+	}).Error)
+
+	slack := services.NewSlackTriageService(db, monitoring)
+	now := time.Now()
+
+	_, err := slack.HandleCommand(services.SlackCommand{TeamID: "T1", UserID: "U2", Command: "/cloudgate", Text: "alerts"}, now)
+	assert.ErrorIs(t, err, services.ErrSlackUserUnauthorized)
+	_, err = slack.HandleCommand(services.SlackCommand{TeamID: "T9", UserID: "U1", Command: "/cloudgate", Text: "alerts"}, now)
+	assert.ErrorIs(t, err, services.ErrSlackUserUnauthorized, "the connection must be in the same workspace")
+
+	message, err := slack.HandleCommand(services.SlackCommand{TeamID: "T1", UserID: "U1", Command: "/cloudgate", Text: "alerts"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "No alerts awaiting triage :tada:", message.Text)
+
+	alert, err := monitoring.GenerateAlert(services.AlertTypeBruteForceAttack, services.SeverityHigh, "Brute force", "Brute force", map[string]interface{}{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := monitoring.GetAlert(alert.ID)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	message, err = slack.HandleCommand(services.SlackCommand{TeamID: "T1", UserID: "U1", Command: "/cloudgate", Text: "alerts 5"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "ephemeral", message.ResponseType)
+	blockID := "alert:" + alert.ID.String()
+	assert.Contains(t, fmt.Sprint(message.Blocks), blockID)
+
+	// Acknowledging takes the alert as the clicking analyst
+	message, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U1", services.SlackActionAcknowledge, blockID, ""), now)
+	require.NoError(t, err)
+	assert.True(t, message.ReplaceOriginal)
+	stored, err := monitoring.GetAlert(alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.StatusInProgress, stored.Status)
+	assert.Equal(t, alice.ID, *stored.AssignedTo)
+
+	// Assigning needs the selected Slack user to be an analyst too
+	_, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U1", services.SlackActionAssign, blockID, "U2"), now)
+	assert.ErrorIs(t, err, services.ErrSlackUserUnauthorized)
+	_, err = slack.LinkAnalyst("T1", "U2", bob.ID, &alice.ID)
+	require.NoError(t, err)
+	_, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U1", services.SlackActionAssign, blockID, "U2"), now)
+	require.NoError(t, err)
+	stored, err = monitoring.GetAlert(alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, *stored.AssignedTo)
+
+	message, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U2", services.SlackActionResolve, blockID, ""), now)
+	require.NoError(t, err)
+	assert.NotContains(t, fmt.Sprint(message.Blocks), services.SlackActionResolve, "resolved alerts have no buttons")
+	stored, err = monitoring.GetAlert(alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.StatusResolved, stored.Status)
+	assert.Equal(t, bob.ID, *stored.AssignedTo)
+
+	var audits int64
+	require.NoError(t, db.Model(&models.AuditLog{}).Where("resource = ? AND resource_id = ?", "security_alert", alert.ID.String()).Count(&audits).Error)
+	assert.Equal(t, int64(3), audits)
+
+	_, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U1", "delete_everything", blockID, ""), now)
+	assert.ErrorIs(t, err, services.ErrInvalidSlackAction)
+	_, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U1", services.SlackActionResolve, "other-block", ""), now)
+	assert.ErrorIs(t, err, services.ErrInvalidSlackAction)
+
+	// Locked analysts cannot triage from Slack
+	require.NoError(t, db.Model(&bob).Update("locked_at", now).Error)
+	_, err = slack.HandleInteraction(context.Background(), slackInteraction("T1", "U2", services.SlackActionAcknowledge, blockID, ""), now)
+	assert.ErrorIs(t, err, services.ErrSlackUserUnauthorized)
+
+	removed, err := slack.UnlinkAnalyst("T1", "U2")
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	assert.ErrorIs(t, slack.Respond("https://attacker.example/hook", message), services.ErrInvalidSlackAction)
+}
@@ -0,0 +1,94 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestStaleAccountService_DisablesAndReactivates(t *testing.T) {
+	t.Setenv("STALE_ACCOUNT_DAYS", "90")
+	t.Setenv("STALE_ACCOUNT_WARNING_DAYS", "14")
+	t.Setenv("STALE_ACCOUNT_AUTO_DISABLE", "true")
+	t.Setenv("STALE_ACCOUNT_EXEMPT", "breakglass@example.com")
+	security, db := setupTestSecurityMonitoringService(t)
+	tables := []interface{}{&models.Session{}, &models.LoginEvent{}, &models.DormantAccount{}, &models.AuditLog{}, &models.SecurityActionExecution{}}
+	require.NoError(t, db.AutoMigrate(tables...))
+	t.Cleanup(func() { db.Migrator().DropTable(tables...) })
+	stale := services.NewStaleAccountService(db, security, nil)
+	now := time.Now()
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	user := func(email string, created time.Time) models.User {
+		u := models.User{Email: email, Username: email, IsActive: true, CreatedAt: created}
+		require.NoError(t, db.Create(&u).Error)
+		return u
+	}
+	active := user("active@example.com", days(400))
+	activeID := active.ID
+	require.NoError(t, db.Create(&models.LoginEvent{UserID: &activeID, Email: active.Email, Success: true, Method: "password", CreatedAt: days(10)}).Error)
+	nearing := user("nearing@example.com", days(80))
+	idle := user("idle@example.com", days(300))
+	require.NoError(t, db.Create(&models.Session{UserID: idle.ID, SessionToken: uuid.NewString(), ExpiresAt: days(99), CreatedAt: days(100), UpdatedAt: days(100)}).Error)
+	user("breakglass@example.com", days(500))
+
+	scan, err := stale.Scan(now)
+	require.NoError(t, err)
+	assert.Equal(t, services.StaleAccountScan{Warned: 1, Disabled: 1}, scan)
+	var locked models.User
+	require.NoError(t, db.First(&locked, "id = ?", idle.ID).Error)
+	assert.True(t, services.IsDormantLock(&locked))
+	alertType := services.AlertTypeDormantAccounts
+	require.Eventually(t, func() bool {
+		alerts, err := security.GetAlerts(services.AlertFilters{Type: &alertType, Limit: 10})
+		return err == nil && len(alerts) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	scan, err = stale.Scan(now)
+	require.NoError(t, err)
+	assert.Equal(t, services.StaleAccountScan{}, scan, "owners are warned once")
+
+	// Signing in again clears the warning
+	nearingID := nearing.ID
+	require.NoError(t, db.Create(&models.LoginEvent{UserID: &nearingID, Email: nearing.Email, Success: true, Method: "password", CreatedAt: now}).Error)
+	scan, err = stale.Scan(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, scan.Cleared)
+
+	// Reactivation requests don't reveal which accounts exist or are disabled
+	require.NoError(t, stale.RequestReactivation("nobody@example.com", "", "203.0.113.9", now))
+	require.NoError(t, stale.RequestReactivation("active@example.com", "", "203.0.113.9", now))
+	require.NoError(t, stale.RequestReactivation("IDLE@example.com", "Back from leave", "203.0.113.9", now))
+	accounts, err := stale.List(models.DormantStatusReactivationRequested)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, idle.ID, accounts[0].UserID)
+	assert.Equal(t, "Back from leave", accounts[0].ReactivationReason)
+
+	assert.ErrorIs(t, stale.Reactivate(active.ID, nil), services.ErrDormantAccountNotFound)
+	require.NoError(t, stale.Reactivate(idle.ID, nil))
+	var unlocked models.User
+	require.NoError(t, db.First(&unlocked, "id = ?", idle.ID).Error)
+	assert.False(t, unlocked.IsLocked(time.Now()))
+
+	// A reactivated owner who still doesn't sign in is warned, then disabled after the warning period
+	scan, err = stale.Scan(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, services.StaleAccountScan{Warned: 1}, scan)
+	scan, err = stale.Scan(time.Now().Add(15 * 24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, services.StaleAccountScan{Disabled: 1}, scan)
+	summary, err := stale.Summary()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), summary.Disabled)
+
+	// Locks raised for other reasons since are not lifted by reactivation
+	require.NoError(t, security.LockAccount(idle.ID, nil, "Compromised credentials"))
+	assert.ErrorIs(t, stale.Reactivate(idle.ID, nil), services.ErrNotDormantLock)
+}
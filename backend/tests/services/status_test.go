@@ -0,0 +1,48 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/models"
+)
+
+func TestStatusEnums_Helpers(t *testing.T) {
+	assert.Equal(t, 1, models.SeverityCritical.Compare(models.SeverityHigh))
+	assert.Equal(t, -1, models.SeverityLow.Compare(models.SeverityMedium))
+	assert.Equal(t, 0, models.RiskHigh.Compare(models.RiskHigh))
+	assert.Equal(t, 1, models.HealthError.Compare(models.HealthWarning), "an erroring connection is less healthy")
+	assert.Equal(t, models.SeverityCritical, models.SeverityCritical.Escalate())
+
+	assert.True(t, models.ConnectionRevoked.IsTerminal())
+	assert.False(t, models.ConnectionError.IsTerminal(), "a failing connection can recover")
+
+	_, err := models.ParseSeverity("urgent")
+	assert.Error(t, err)
+	_, err = models.ParseConnectionStatus("Connected")
+	assert.Error(t, err, "statuses are case sensitive")
+}
+
+func TestStatusEnums_ValidatedOnWrite(t *testing.T) {
+	db := setupOAuthTestDB(t)
+	user := createTestUser(t, db)
+	connection := createTestConnection(t, db, user.ID, models.ConnectionConnected)
+
+	// Hooks reject values outside the enum before they reach the database
+	connection.Status = "active"
+	assert.ErrorContains(t, db.Save(connection).Error, `invalid connection status "active"`)
+	connection.Status = models.ConnectionConnected
+	connection.HealthStatus = "ok"
+	assert.ErrorContains(t, db.Save(connection).Error, `invalid health status "ok"`)
+
+	// Writes that skip the hooks are stopped by the check constraint
+	err := db.Exec("UPDATE app_connections SET status = ? WHERE id = ?", "active", connection.ID).Error
+	assert.ErrorContains(t, err, "CHECK constraint failed")
+
+	var stored models.AppConnection
+	require.NoError(t, db.First(&stored, "id = ?", connection.ID).Error)
+	assert.Equal(t, models.ConnectionConnected, stored.Status)
+	assert.Equal(t, models.HealthHealthy, stored.HealthStatus)
+}
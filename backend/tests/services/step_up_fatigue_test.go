@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/middleware"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestStepUpFatigueService_PausesPromptBombing(t *testing.T) {
+	t.Setenv("STEP_UP_FATIGUE_THRESHOLD", "3")
+	t.Setenv("STEP_UP_FATIGUE_WINDOW", "10m")
+	t.Setenv("STEP_UP_FATIGUE_BLOCK", "30m")
+	security, db := setupTestSecurityMonitoringService(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	fatigue := services.NewStepUpFatigueService(db, security, nil)
+	user, other := uuid.New(), uuid.New()
+	now := time.Now()
+
+	// Demands a few seconds apart, as from one page, are a single prompt
+	for i := 0; i < 5; i++ {
+		_, blocked := fatigue.RecordChallenge(user, "203.0.113.9", "curl", now.Add(time.Duration(i)*time.Second))
+		assert.False(t, blocked)
+	}
+	for i := 1; i < 3; i++ {
+		_, blocked := fatigue.RecordChallenge(user, "203.0.113.9", "curl", now.Add(time.Duration(i)*time.Minute))
+		assert.False(t, blocked)
+	}
+	_, blocked := fatigue.RecordChallenge(other, "198.51.100.7", "curl", now.Add(3*time.Minute))
+	assert.False(t, blocked, "other users are counted separately")
+
+	until, blocked := fatigue.RecordChallenge(user, "203.0.113.9", "curl", now.Add(3*time.Minute))
+	require.True(t, blocked, "a fourth prompt within the window is not issued")
+	assert.Equal(t, now.Add(33*time.Minute), until)
+	_, blocked = fatigue.Blocked(user, now.Add(32*time.Minute))
+	assert.True(t, blocked)
+	_, blocked = fatigue.Blocked(user, now.Add(34*time.Minute))
+	assert.False(t, blocked, "the pause ends on its own")
+
+	alertType := services.AlertTypeCompromisedAccount
+	require.Eventually(t, func() bool {
+		alerts, err := security.GetAlerts(services.AlertFilters{Type: &alertType, Limit: 10})
+		return err == nil && len(alerts) == 1 && alerts[0].UserID != nil && *alerts[0].UserID == user
+	}, 2*time.Second, 10*time.Millisecond)
+	var logs []models.AuditLog
+	require.NoError(t, db.Where("user_id = ? AND action = ?", user, "step_up_prompts_blocked").Find(&logs).Error)
+	assert.Len(t, logs, 1, "the user sees the pause in their audit log")
+
+	// Required step-ups stop prompting once the user is paused
+	gin.SetMode(gin.TestMode)
+	middleware.SetStepUpGuard(fatigue)
+	t.Cleanup(func() { middleware.SetStepUpGuard(nil) })
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", other)
+		c.Set("aal", models.AAL1)
+	})
+	router.POST("/admin", middleware.RequireAAL(models.AAL2), func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin", nil))
+		return w
+	}
+
+	w := request()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "step_up_required")
+	fatigue.Unblock(other, nil)
+	for _, at := range []time.Duration{3 * time.Minute, 2 * time.Minute, time.Minute} {
+		fatigue.RecordChallenge(other, "198.51.100.7", "curl", time.Now().Add(-at))
+	}
+	w = request()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "step_up_blocked")
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	assert.Len(t, fatigue.ListBlocks(time.Now()), 1)
+	assert.True(t, fatigue.Unblock(other, nil))
+	assert.False(t, fatigue.Unblock(other, nil))
+	assert.Equal(t, http.StatusForbidden, request().Code, "an admin can resume prompts")
+}
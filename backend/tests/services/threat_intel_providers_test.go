@@ -0,0 +1,154 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// threatFeedServer serves a Tor exit list, Spamhaus DROP lists in both formats and the
+// AbuseIPDB check API, counting AbuseIPDB lookups
+func threatFeedServer(t *testing.T, abuseLookups *int, abuseDown *bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/torbulkexitlist":
+			w.Write([]byte("# exit nodes\n185.220.101.4\n2001:db8::dead\n\n"))
+		case "/drop_v4.json":
+			w.Write([]byte(`{"cidr":"198.51.100.0/24","sblid":"SBL123456","rir":"arin"}` + "\n" +
+				`{"type":"metadata","timestamp":1700000000,"size":1}` + "\n"))
+		case "/drop.txt":
+			w.Write([]byte("; Spamhaus DROP List\n192.0.2.128/25 ; SBL654321\n"))
+		case "/api/v2/check":
+			*abuseLookups++
+			assert.Equal(t, "abuse-key", r.Header.Get("Key"))
+			assert.Equal(t, "30", r.URL.Query().Get("maxAgeInDays"))
+			if *abuseDown {
+				http.Error(w, `{"errors":[{"detail":"Daily rate limit exceeded"}]}`, http.StatusTooManyRequests)
+				return
+			}
+			score, isTor := 0, false
+			switch r.URL.Query().Get("ipAddress") {
+			case "203.0.113.66":
+				score = 96
+			case "185.220.101.4":
+				score, isTor = 30, true
+			case "203.0.113.80":
+				isTor = true
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"abuseConfidenceScore": score, "isTor": isTor, "usageType": "Data Center/Web Hosting/Transit",
+				"totalReports": 42, "numDistinctUsers": 17, "lastReportedAt": "2026-10-01T12:00:00+00:00",
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestThreatIntelligence_FeedsAndAbuseIPDB(t *testing.T) {
+	abuseLookups, abuseDown := 0, false
+	server := threatFeedServer(t, &abuseLookups, &abuseDown)
+	intel := services.NewThreatIntelligenceService()
+	intel.AddProvider(services.NewTorExitNodeFeed(server.URL + "/torbulkexitlist"))
+	intel.AddProvider(services.NewSpamhausDROPFeed(server.URL+"/drop_v4.json", server.URL+"/drop.txt"))
+	intel.AddProvider(services.NewAbuseIPDBProvider(server.URL, "abuse-key", 30, 25))
+
+	// Lists are empty until downloaded
+	assert.False(t, intel.IsTorExitNode(context.Background(), "2001:db8::dead"))
+	require.NoError(t, intel.RefreshFeeds(context.Background()))
+
+	assert.True(t, intel.IsTorExitNode(context.Background(), "185.220.101.4"))
+	assert.True(t, intel.IsTorExitNode(context.Background(), "2001:db8::dead"))
+	assert.True(t, intel.IsTorExitNode(context.Background(), "203.0.113.80"), "AbuseIPDB also flags Tor")
+	assert.False(t, intel.IsTorExitNode(context.Background(), "203.0.113.66"))
+
+	data, err := intel.GetThreatData(context.Background(), "198.51.100.23")
+	require.NoError(t, err)
+	assert.Equal(t, "spamhaus_drop", data.Source)
+	assert.Equal(t, 1.0, data.Confidence)
+	data, err = intel.GetThreatData(context.Background(), "192.0.2.200")
+	require.NoError(t, err)
+	assert.Equal(t, "spamhaus_drop", data.Source)
+	_, err = intel.GetThreatData(context.Background(), "192.0.2.1")
+	assert.Error(t, err, "outside the listed /25")
+
+	data, err = intel.GetThreatData(context.Background(), "203.0.113.66")
+	require.NoError(t, err)
+	assert.Equal(t, "abuseipdb", data.Source)
+	assert.InDelta(t, 0.96, data.Confidence, 0.001)
+	assert.Equal(t, string(services.SeverityCritical), data.Severity)
+	assert.Contains(t, data.Description, "Reported 42 times by 17 users")
+
+	// The most confident answer wins, with every provider's tags
+	data, err = intel.GetThreatData(context.Background(), "185.220.101.4")
+	require.NoError(t, err)
+	assert.Equal(t, "tor_exit_nodes", data.Source)
+	assert.Contains(t, data.Tags, "abuseipdb")
+
+	// Answers and misses are cached; provider failures are not
+	lookups := abuseLookups
+	_, err = intel.GetThreatData(context.Background(), "203.0.113.66")
+	require.NoError(t, err)
+	_, err = intel.GetThreatData(context.Background(), "203.0.113.1")
+	assert.Error(t, err)
+	_, err = intel.GetThreatData(context.Background(), "203.0.113.1")
+	assert.Error(t, err)
+	assert.Equal(t, lookups+1, abuseLookups)
+
+	abuseDown = true
+	_, err = intel.GetThreatData(context.Background(), "203.0.113.2")
+	assert.Error(t, err)
+	abuseDown = false
+	_, err = intel.GetThreatData(context.Background(), "203.0.113.2")
+	assert.Error(t, err)
+	assert.Equal(t, lookups+3, abuseLookups)
+}
+
+func TestThreatIntelligence_FailedRefreshKeepsList(t *testing.T) {
+	abuseLookups, abuseDown := 0, false
+	server := threatFeedServer(t, &abuseLookups, &abuseDown)
+	feed := services.NewSpamhausDROPFeed(server.URL + "/drop_v4.json")
+	require.NoError(t, feed.Refresh(context.Background()))
+
+	broken := services.NewSpamhausDROPFeed(server.URL+"/drop_v4.json", server.URL+"/missing.json")
+	assert.Error(t, broken.Refresh(context.Background()))
+	data, err := broken.GetThreatData(context.Background(), "198.51.100.1")
+	require.NoError(t, err)
+	assert.Nil(t, data, "a partial download is not used")
+
+	data, err = feed.GetThreatData(context.Background(), "198.51.100.1")
+	require.NoError(t, err)
+	require.NotNil(t, data)
+	assert.Equal(t, "198.51.100.1", data.Indicator)
+}
+
+func TestThreatIntelligence_DROPListedAddressesAreHighRisk(t *testing.T) {
+	abuseLookups, abuseDown := 0, false
+	server := threatFeedServer(t, &abuseLookups, &abuseDown)
+	intel := services.NewThreatIntelligenceService()
+	intel.AddProvider(services.NewTorExitNodeFeed(server.URL + "/torbulkexitlist"))
+	intel.AddProvider(services.NewSpamhausDROPFeed(server.URL + "/drop.txt"))
+	require.NoError(t, intel.RefreshFeeds(context.Background()))
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.IPReputation{}, &models.AuditLog{}))
+	reputation := services.NewIPReputationService(db, intel)
+	now := time.Now()
+
+	assert.True(t, reputation.IsHighRisk(context.Background(), "192.0.2.130", now))
+	assert.False(t, reputation.IsHighRisk(context.Background(), "185.220.101.4", now), "Tor alone is not high risk")
+}
@@ -0,0 +1,104 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestTimelineService sets up a timeline service with one event of each kind
+func setupTestTimelineService(t *testing.T) (*services.TimelineService, uuid.UUID, time.Time) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.SecurityEvent{}, &models.TrustedDevice{},
+		&models.AppConnection{}, &services.RiskAssessment{}, &services.DeviceFingerprint{}, &models.LoginEvent{}, &models.SecurityAlertRecord{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	userID := uuid.New()
+	base := time.Now().Add(-time.Hour).UTC()
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	require.NoError(t, db.Create(&models.AuditLog{UserID: &userID, Action: "login", CreatedAt: at(0)}).Error)
+	require.NoError(t, db.Create(&services.RiskAssessment{UserID: userID, RiskScore: 0.3, RiskLevel: "medium", CreatedAt: at(1)}).Error)
+	require.NoError(t, db.Create(&models.SecurityEvent{UserID: userID, EventType: "new_device", Description: "New device", Severity: "medium", CreatedAt: at(2)}).Error)
+	require.NoError(t, db.Create(&models.TrustedDevice{UserID: userID, DeviceName: "Laptop", DeviceType: "desktop", Fingerprint: "fp-1", CreatedAt: at(3)}).Error)
+	require.NoError(t, db.Create(&models.AppConnection{UserID: userID, AppID: "slack", AppName: "Slack", Provider: "slack", Status: "connected", UpdatedAt: at(4)}).Error)
+	require.NoError(t, db.Create(&models.SecurityAlertRecord{UserID: &userID, Type: "impossible_travel", Severity: "high", Title: "Impossible travel", Status: "open", CreatedAt: at(2).Add(30 * time.Second)}).Error)
+	// Another user's activity must not leak into the timeline
+	other := uuid.New()
+	require.NoError(t, db.Create(&models.AuditLog{UserID: &other, Action: "login", CreatedAt: at(5)}).Error)
+	require.NoError(t, db.Create(&models.SecurityAlertRecord{UserID: &other, Type: "brute_force", Severity: "medium", Title: "Brute force", Status: "open", CreatedAt: at(5)}).Error)
+
+	return services.NewTimelineService(db), userID, base
+}
+
+func TestTimelineService_GetUserTimeline(t *testing.T) {
+	service, userID, base := setupTestTimelineService(t)
+
+	t.Run("should merge all sources newest first", func(t *testing.T) {
+		entries, total, err := service.GetUserTimeline(userID, services.TimelineQuery{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), total)
+		require.Len(t, entries, 6)
+
+		sources := []string{}
+		for _, e := range entries {
+			sources = append(sources, e.Source)
+		}
+		assert.Equal(t, []string{"connection", "device", "alert", "security_event", "risk", "audit"}, sources)
+	})
+
+	t.Run("should page across sources", func(t *testing.T) {
+		entries, total, err := service.GetUserTimeline(userID, services.TimelineQuery{Limit: 2, Offset: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), total)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "alert", entries[0].Source)
+		assert.Equal(t, "security_event", entries[1].Source)
+	})
+
+	t.Run("should include the user's security alerts", func(t *testing.T) {
+		since := base.Add(2 * time.Minute)
+		until := base.Add(3 * time.Minute)
+		entries, total, err := service.GetUserTimeline(userID, services.TimelineQuery{
+			Since:   &since,
+			Until:   &until,
+			Sources: []string{services.TimelineSourceAlert, services.TimelineSourceSecurityEvent},
+			Limit:   1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		require.Len(t, entries, 1)
+		assert.Equal(t, services.TimelineSourceAlert, entries[0].Source)
+		assert.Equal(t, "impossible_travel", entries[0].Type)
+		assert.Equal(t, "Impossible travel", entries[0].Summary)
+		assert.Equal(t, "high", entries[0].Severity)
+		assert.Equal(t, "open", entries[0].Details["status"])
+	})
+
+	t.Run("should filter by source and time", func(t *testing.T) {
+		since := base.Add(90 * time.Second)
+		entries, _, err := service.GetUserTimeline(userID, services.TimelineQuery{
+			Since:   &since,
+			Sources: []string{services.TimelineSourceAudit, services.TimelineSourceSecurityEvent},
+			Limit:   10,
+		})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "new_device", entries[0].Type)
+	})
+
+	t.Run("should reject unknown sources", func(t *testing.T) {
+		_, _, err := service.GetUserTimeline(userID, services.TimelineQuery{Sources: []string{"email"}, Limit: 10})
+		assert.ErrorIs(t, err, services.ErrUnknownTimelineSource)
+	})
+}
@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func tokenVaultKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func newTestTokenVault(t *testing.T, keys string) *services.TokenVault {
+	t.Setenv("TOKEN_VAULT_KEYS", keys)
+	vault, err := services.NewTokenVaultFromEnv()
+	require.NoError(t, err)
+	return vault
+}
+
+func TestTokenVault_SealsTokensUnderTheActiveKey(t *testing.T) {
+	vault := newTestTokenVault(t, "2026-10="+tokenVaultKey('a'))
+
+	sealed, err := vault.Encrypt("ya29.secret-access-token")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "vault:v1:2026-10:"))
+	assert.NotContains(t, sealed, "secret-access-token")
+	again, err := vault.Encrypt("ya29.secret-access-token")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "every token gets its own data key")
+
+	token, err := vault.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.secret-access-token", token)
+
+	token, err = vault.Decrypt("legacy-plaintext-token")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-plaintext-token", token, "tokens stored before encryption still read")
+	empty, err := vault.Encrypt("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	_, err = vault.Decrypt(sealed[:len(sealed)-4] + "AAA=")
+	assert.Error(t, err, "tampered tokens do not open")
+	_, err = vault.Decrypt("vault:v1:2026-10:garbage")
+	assert.Error(t, err)
+
+	other := newTestTokenVault(t, "2027-01="+tokenVaultKey('b'))
+	_, err = other.Decrypt(sealed)
+	assert.ErrorIs(t, err, services.ErrUnknownTokenKey)
+
+	for _, keys := range []string{"nokey", "short=" + base64.StdEncoding.EncodeToString([]byte("short")), "a:b=" + tokenVaultKey('a')} {
+		t.Setenv("TOKEN_VAULT_KEYS", keys)
+		_, err := services.NewTokenVaultFromEnv()
+		assert.Error(t, err, keys)
+	}
+}
+
+func TestTokenVault_EncryptsAppConnectionsAndRotatesKeys(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.AppConnection{}), "Failed to migrate database schema")
+	originalDB := services.DB
+	services.DB = db
+	t.Cleanup(func() { services.DB = originalDB })
+	t.Cleanup(func() { services.SetTokenVault(nil) })
+
+	services.SetTokenVault(newTestTokenVault(t, "old="+tokenVaultKey('o')))
+	userID := uuid.New().String()
+	require.NoError(t, services.UpdateUserAppConnection(userID, "google-workspace", map[string]interface{}{
+		"access_token": "access-1", "refresh_token": "refresh-1",
+	}))
+	var raw models.AppConnection
+	require.NoError(t, db.First(&raw, "app_id = ?", "google-workspace").Error)
+	assert.True(t, strings.HasPrefix(raw.AccessToken, "vault:v1:old:"))
+	assert.True(t, strings.HasPrefix(raw.RefreshToken, "vault:v1:old:"))
+
+	// A connection written before encryption at rest
+	legacyUser := uuid.New()
+	require.NoError(t, db.Create(&models.AppConnection{UserID: legacyUser, AppID: "github", AppName: "GitHub", Provider: "github", AccessToken: "gho_legacy"}).Error)
+	legacy, ok := services.GetUserAppConnection(legacyUser.String(), "github")
+	require.True(t, ok)
+	assert.Equal(t, "gho_legacy", legacy.AccessToken)
+
+	// Rotate to a new key, keeping the old one to read existing tokens
+	rotating := newTestTokenVault(t, "new="+tokenVaultKey('n')+",old="+tokenVaultKey('o'))
+	services.SetTokenVault(rotating)
+	result, err := rotating.RotateKeys(db)
+	require.NoError(t, err)
+	assert.Equal(t, services.TokenRotationResult{ActiveKey: "new", Scanned: 2, Rotated: 2}, *result)
+
+	result, err = rotating.RotateKeys(db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Rotated, "rotation is idempotent")
+
+	// The old key can now be retired
+	services.SetTokenVault(newTestTokenVault(t, "new="+tokenVaultKey('n')))
+	connection, ok := services.GetUserAppConnection(userID, "google-workspace")
+	require.True(t, ok)
+	assert.Equal(t, "access-1", connection.AccessToken)
+	assert.Equal(t, "refresh-1", connection.RefreshToken)
+	legacy, ok = services.GetUserAppConnection(legacyUser.String(), "github")
+	require.True(t, ok)
+	assert.Equal(t, "gho_legacy", legacy.AccessToken)
+	var rotated models.AppConnection
+	require.NoError(t, db.First(&rotated, "app_id = ?", "github").Error)
+	assert.True(t, strings.HasPrefix(rotated.AccessToken, "vault:v1:new:"))
+}
@@ -0,0 +1,77 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/config"
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+func TestTracing_RecordsQueriesAndOutboundCalls(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	originalProvider, originalPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	defer func() {
+		otel.SetTracerProvider(originalProvider)
+		otel.SetTextMapPropagator(originalPropagator)
+	}()
+	shutdown, err := services.InitTracing(context.Background(), config.TracingConfig{})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+	otel.SetTracerProvider(provider)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	require.NoError(t, services.TraceQueries(db))
+	require.NoError(t, services.TraceQueries(db), "tracing a database twice is harmless")
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"access_token":"token"}`))
+	}))
+	defer server.Close()
+
+	// Queries outside a traced request do not start traces of their own
+	require.NoError(t, db.Create(&models.AuditLog{Action: "untraced"}).Error)
+	assert.Empty(t, recorder.Ended())
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "GET /auth/callback")
+	require.NoError(t, db.WithContext(ctx).Create(&models.AuditLog{Action: "login"}).Error)
+	var entry models.AuditLog
+	require.NoError(t, db.WithContext(ctx).Where("action = ?", "login").First(&entry).Error)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/token", nil)
+	require.NoError(t, err)
+	resp, err := services.TracedHTTPClient(time.Second).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	root.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		assert.Equal(t, root.SpanContext().TraceID(), span.SpanContext().TraceID(), "%s belongs to the request's trace", span.Name())
+	}
+	require.Contains(t, spans, "gorm.create")
+	require.Contains(t, spans, "gorm.query")
+	assert.Contains(t, spans["gorm.query"].Attributes(), attribute.String("db.sql.table", "audit_logs"))
+
+	outbound, ok := spans["POST "+server.Listener.Addr().String()]
+	require.True(t, ok, "the outbound call is recorded")
+	assert.Contains(t, traceparent, outbound.SpanContext().TraceID().String(), "the trace continues at the provider")
+}
@@ -98,9 +98,10 @@ func TestUserService_GetUserByID(t *testing.T) {
 
 	t.Run("should retrieve existing user", func(t *testing.T) {
 		// Create test user directly in database
+		kc := uuid.New().String()
 		testUser := models.User{
 			ID:         uuid.New(),
-			KeycloakID: uuid.New().String(),
+			KeycloakID: &kc,
 			Email:      "test@example.com",
 			Username:   "testuser",
 			FirstName:  "Test",
@@ -131,9 +132,10 @@ func TestUserService_GetUserByID(t *testing.T) {
 
 	t.Run("should return error for inactive user", func(t *testing.T) {
 		// Create inactive user
+		kc2 := uuid.New().String()
 		inactiveUser := models.User{
 			ID:         uuid.New(),
-			KeycloakID: uuid.New().String(),
+			KeycloakID: &kc2,
 			Email:      "inactive@example.com",
 			Username:   "inactiveuser",
 			IsActive:   false,
@@ -225,9 +227,10 @@ func BenchmarkUserService_GetUserByID(b *testing.B) {
 	userService := services.NewUserService(db)
 
 	// Create test user
+	kc := uuid.New().String()
 	testUser := models.User{
 		ID:         uuid.New(),
-		KeycloakID: uuid.New().String(),
+		KeycloakID: &kc,
 		Email:      "benchmark@example.com",
 		Username:   "benchuser",
 		IsActive:   true,
@@ -0,0 +1,124 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestWatchlistService sets up a watchlist service backed by an in-memory database
+func setupTestWatchlistService(t *testing.T) (*services.WatchlistService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.WatchlistEntry{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewWatchlistService(db), db
+}
+
+func TestWatchlistService_AddToWatchlist(t *testing.T) {
+	service, db := setupTestWatchlistService(t)
+	analyst := uuid.New()
+	user := uuid.New()
+
+	t.Run("should flag user and lower thresholds", func(t *testing.T) {
+		entry, err := service.AddToWatchlist(user, &analyst, "Departing employee", 7*24*time.Hour, 0.25, true)
+		require.NoError(t, err)
+		assert.True(t, entry.IsActive())
+
+		active, watched := service.GetActiveEntry(user)
+		require.True(t, watched)
+		assert.Equal(t, entry.ID, active.ID)
+		assert.InDelta(t, 0.2, service.ScaleThreshold(user, 0.8), 0.0001)
+		assert.InDelta(t, 0.8, service.ScaleThreshold(uuid.New(), 0.8), 0.0001)
+	})
+
+	t.Run("should fall back to defaults for invalid settings", func(t *testing.T) {
+		other := uuid.New()
+		entry, err := service.AddToWatchlist(other, &analyst, "Investigation", 0, 3, false)
+		require.NoError(t, err)
+		assert.Equal(t, services.DefaultWatchlistThresholdFactor, entry.ThresholdFactor)
+		assert.WithinDuration(t, time.Now().Add(services.DefaultWatchlistDuration), entry.ExpiresAt, time.Minute)
+		assert.False(t, entry.FullSessionLogging)
+	})
+
+	t.Run("should audit watchlist changes", func(t *testing.T) {
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "watchlist_added", user.String()).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestWatchlistService_RemoveAndExpire(t *testing.T) {
+	service, db := setupTestWatchlistService(t)
+	analyst := uuid.New()
+
+	t.Run("should remove user from watchlist", func(t *testing.T) {
+		user := uuid.New()
+		_, err := service.AddToWatchlist(user, &analyst, "Suspicious downloads", time.Hour, 0.5, true)
+		require.NoError(t, err)
+
+		require.NoError(t, service.RemoveFromWatchlist(user, &analyst))
+		_, watched := service.GetActiveEntry(user)
+		assert.False(t, watched)
+
+		assert.ErrorIs(t, service.RemoveFromWatchlist(user, &analyst), services.ErrNotOnWatchlist)
+	})
+
+	t.Run("should expire entries past their expiry", func(t *testing.T) {
+		user := uuid.New()
+		entry, err := service.AddToWatchlist(user, &analyst, "Contractor offboarding", time.Hour, 0.5, true)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(entry).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		expired, err := service.ExpireEntries()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, expired)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "watchlist_expired", user.String()).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestWatchlistService_SharedWithRiskScoring(t *testing.T) {
+	db, adaptiveAuth, userID := setupAdaptiveAuthBenchmark(t)
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}))
+	watchlist := services.NewWatchlistService(db)
+	adaptiveAuth.SetWatchlist(watchlist)
+
+	simulate := func() *services.AuthSimulation {
+		simulation, err := adaptiveAuth.SimulateAuthentication(context.Background(), &services.AuthContext{
+			UserID:            userID,
+			IPAddress:         "203.0.113.9",
+			UserAgent:         "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+			DeviceFingerprint: "laptop",
+			LoginTime:         time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+		return simulation
+	}
+
+	// Scoring once loads the watchlist cache
+	assert.NotContains(t, triggeredRules(simulate()), "watchlisted_user")
+
+	// An entry added through the shared service applies to the very next sign-in
+	_, err := watchlist.AddToWatchlist(userID, nil, "Credential stuffing target", time.Hour, 0.5, false)
+	require.NoError(t, err)
+	simulation := simulate()
+	assert.Contains(t, triggeredRules(simulation), "watchlisted_user")
+	assert.Equal(t, true, simulation.Decision.Metadata["watchlisted"])
+
+	require.NoError(t, watchlist.RemoveFromWatchlist(userID, nil))
+	assert.NotContains(t, triggeredRules(simulate()), "watchlisted_user")
+}
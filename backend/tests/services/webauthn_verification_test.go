@@ -0,0 +1,168 @@
+package services_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/services"
+)
+
+// cborHead encodes a CBOR major type and argument
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+
+func cborText(s string) []byte { return append(cborHead(3, len(s)), s...) }
+
+// softwareAuthenticator is a software ES256 authenticator
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	return &softwareAuthenticator{key: key, credentialID: id}
+}
+
+func (a *softwareAuthenticator) id() string {
+	return base64.RawURLEncoding.EncodeToString(a.credentialID)
+}
+
+func (a *softwareAuthenticator) authData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softwareAuthenticator) attestationObject(rpID string) []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	coseKey := cborHead(5, 5)
+	for _, part := range [][]byte{cborInt(1), cborInt(2), cborInt(3), cborInt(-7), cborInt(-1), cborInt(1), cborInt(-2), cborBytes(x), cborInt(-3), cborBytes(y)} {
+		coseKey = append(coseKey, part...)
+	}
+	authData := a.authData(rpID, 0x41)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+
+	object := cborHead(5, 3)
+	for _, part := range [][]byte{cborText("fmt"), cborText("none"), cborText("attStmt"), cborHead(5, 0), cborText("authData"), cborBytes(authData)} {
+		object = append(object, part...)
+	}
+	return object
+}
+
+func (a *softwareAuthenticator) assert(t *testing.T, rpID, origin string) services.WebAuthnAssertion {
+	a.signCount++
+	clientData, err := json.Marshal(map[string]string{"type": "webauthn.get", "challenge": "c2lnbmVk", "origin": origin})
+	require.NoError(t, err)
+	authData := a.authData(rpID, 0x05)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+	return services.WebAuthnAssertion{CredentialID: a.id(), ClientDataJSON: clientData, AuthenticatorData: authData, Signature: signature}
+}
+
+func TestWebAuthnVerification(t *testing.T) {
+	t.Setenv("WEBAUTHN_RP_ID", "login.example.com")
+	t.Setenv("WEBAUTHN_ORIGINS", "https://login.example.com")
+	db, user := setupTestRiskService(t)
+	originalDB := services.DB
+	services.DB = db
+	defer func() { services.DB = originalDB }()
+
+	authenticator := newSoftwareAuthenticator(t)
+	creation, err := json.Marshal(map[string]string{"type": "webauthn.create", "origin": "https://login.example.com"})
+	require.NoError(t, err)
+
+	t.Run("should register a credential with its public key", func(t *testing.T) {
+		err := services.RegisterWebAuthnCredential(user.ID.String(), authenticator.id(), creation, authenticator.attestationObject("evil.example.com"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse, "created for another relying party")
+		err = services.RegisterWebAuthnCredential(user.ID.String(), "another-id", creation, authenticator.attestationObject("login.example.com"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse, "credential ID differs from the authenticator data")
+
+		require.NoError(t, services.RegisterWebAuthnCredential(user.ID.String(), authenticator.id(), creation, authenticator.attestationObject("login.example.com")))
+		credentials, err := services.GetUserWebAuthnCredentials(user.ID.String())
+		require.NoError(t, err)
+		require.Len(t, credentials, 1)
+		assert.NotEmpty(t, credentials[0].PublicKey)
+	})
+
+	t.Run("should accept a signed assertion and record its counter", func(t *testing.T) {
+		credential, err := services.VerifyWebAuthnAssertion(user.ID.String(), authenticator.assert(t, "login.example.com", "https://login.example.com"))
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1), credential.Counter)
+		assert.NotNil(t, credential.LastUsed)
+	})
+
+	t.Run("should reject forged and misdirected assertions", func(t *testing.T) {
+		forged := authenticator.assert(t, "login.example.com", "https://login.example.com")
+		forged.Signature = []byte("not a signature")
+		_, err := services.VerifyWebAuthnAssertion(user.ID.String(), forged)
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse)
+
+		// Signed by a different key for the same credential ID
+		impostor := newSoftwareAuthenticator(t)
+		impostor.credentialID = authenticator.credentialID
+		impostor.signCount = 10
+		_, err = services.VerifyWebAuthnAssertion(user.ID.String(), impostor.assert(t, "login.example.com", "https://login.example.com"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse)
+
+		_, err = services.VerifyWebAuthnAssertion(user.ID.String(), authenticator.assert(t, "evil.example.com", "https://login.example.com"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse, "wrong relying party ID")
+		_, err = services.VerifyWebAuthnAssertion(user.ID.String(), authenticator.assert(t, "login.example.com", "https://evil.example.com"))
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse, "wrong origin")
+
+		absent := authenticator.assert(t, "login.example.com", "https://login.example.com")
+		absent.AuthenticatorData[32] = 0
+		_, err = services.VerifyWebAuthnAssertion(user.ID.String(), absent)
+		assert.ErrorIs(t, err, services.ErrInvalidWebAuthnResponse, "user presence is required")
+
+		_, err = services.VerifyWebAuthnAssertion(user.ID.String(), services.WebAuthnAssertion{CredentialID: "unknown"})
+		assert.ErrorIs(t, err, services.ErrWebAuthnCredentialNotFound)
+	})
+
+	t.Run("should reject a signature counter that does not advance", func(t *testing.T) {
+		authenticator.signCount = 0
+		_, err := services.VerifyWebAuthnAssertion(user.ID.String(), authenticator.assert(t, "login.example.com", "https://login.example.com"))
+		assert.ErrorIs(t, err, services.ErrWebAuthnSignCountRegressed)
+
+		authenticator.signCount = 41
+		_, err = services.VerifyWebAuthnAssertion(user.ID.String(), authenticator.assert(t, "login.example.com", "https://login.example.com"))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,143 @@
+package services_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// setupTestWebhookService sets up a webhook service with an in-memory database and fast retries
+func setupTestWebhookService(t *testing.T) (*services.WebhookService, *gorm.DB) {
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+	t.Setenv("WEBHOOK_RETRY_BACKOFF", "1ms")
+	t.Setenv("WEBHOOK_DEAD_LETTER_MAX", "3")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+
+	err = db.AutoMigrate(&models.User{}, &models.AuditLog{}, &models.WebhookDeadLetter{})
+	require.NoError(t, err, "Failed to migrate database schema")
+
+	return services.NewWebhookService(db), db
+}
+
+// toggleReceiver fails until healthy is set, counting requests
+func toggleReceiver(healthy *atomic.Bool, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.Copy(io.Discard, r.Body)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("receiver down"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestWebhookService_DeadLetterAndReplay(t *testing.T) {
+	service, db := setupTestWebhookService(t)
+	var healthy atomic.Bool
+	var requests atomic.Int32
+	server := toggleReceiver(&healthy, &requests)
+	defer server.Close()
+
+	err := service.Deliver(models.WebhookSourceAlert, "security_alert.brute_force_attack", server.URL,
+		map[string]string{"Authorization": "Bearer secret"}, map[string]string{"title": "Brute force"})
+	assert.ErrorIs(t, err, services.ErrWebhookDeliveryFailed)
+	assert.Equal(t, int32(2), requests.Load())
+
+	deadLetters, total, err := service.ListDeadLetters(services.DeadLetterFilter{Source: models.WebhookSourceAlert}, 50, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	deadLetter := deadLetters[0]
+	assert.Equal(t, models.DeadLetterFailed, deadLetter.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, deadLetter.LastStatusCode)
+	assert.Equal(t, "receiver down", deadLetter.LastResponse)
+	assert.JSONEq(t, `{"title":"Brute force"}`, deadLetter.Payload)
+
+	// Replay while the receiver is still down keeps it in the store
+	_, err = service.Replay(context.Background(), deadLetter.ID, nil)
+	assert.ErrorIs(t, err, services.ErrWebhookDeliveryFailed)
+
+	healthy.Store(true)
+	admin := uuid.New()
+	replayed, err := service.Replay(context.Background(), deadLetter.ID, &admin)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeadLetterReplayed, replayed.Status)
+	assert.Equal(t, 4, replayed.Attempts)
+	assert.Equal(t, &admin, replayed.ReplayedBy)
+
+	_, err = service.Replay(context.Background(), deadLetter.ID, &admin)
+	assert.ErrorIs(t, err, services.ErrDeadLetterReplayed)
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "webhook_replayed").Count(&audits)
+	assert.Equal(t, int64(2), audits)
+}
+
+func TestWebhookService_ReplayBulk(t *testing.T) {
+	service, _ := setupTestWebhookService(t)
+	var healthy atomic.Bool
+	var requests atomic.Int32
+	server := toggleReceiver(&healthy, &requests)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		service.Deliver(models.WebhookSourceAlert, "security_alert.api_abuse", server.URL, nil, map[string]int{"n": i})
+	}
+	service.Deliver(models.WebhookSourceAudit, "audit.event", server.URL, nil, map[string]string{})
+
+	healthy.Store(true)
+	results, err := service.ReplayBulk(context.Background(), nil, services.DeadLetterFilter{Source: models.WebhookSourceAlert}, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.True(t, result.Delivered)
+	}
+
+	remaining, _, err := service.ListDeadLetters(services.DeadLetterFilter{Status: models.DeadLetterFailed}, 50, 0)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, models.WebhookSourceAudit, remaining[0].Source)
+}
+
+func TestWebhookService_RetentionLimits(t *testing.T) {
+	service, db := setupTestWebhookService(t)
+	var healthy atomic.Bool
+	var requests atomic.Int32
+	server := toggleReceiver(&healthy, &requests)
+	defer server.Close()
+
+	// An entry past the retention window is purged
+	expired := models.WebhookDeadLetter{Source: models.WebhookSourceProvider, URL: server.URL, Payload: "{}", Status: models.DeadLetterFailed}
+	require.NoError(t, db.Create(&expired).Error)
+	db.Model(&expired).UpdateColumn("created_at", time.Now().Add(-31*24*time.Hour))
+
+	// Only the newest WEBHOOK_DEAD_LETTER_MAX entries are kept
+	for i := 0; i < 4; i++ {
+		service.Deliver(models.WebhookSourceAlert, "security_alert.api_abuse", server.URL, nil, map[string]int{"n": i})
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	deadLetters, total, err := service.ListDeadLetters(services.DeadLetterFilter{}, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.JSONEq(t, `{"n":3}`, deadLetters[0].Payload)
+	for _, deadLetter := range deadLetters {
+		assert.NotEqual(t, expired.ID, deadLetter.ID)
+	}
+}
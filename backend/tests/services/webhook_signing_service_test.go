@@ -0,0 +1,130 @@
+package services_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"cloudgate-backend/internal/models"
+	"cloudgate-backend/internal/services"
+)
+
+// consumerSignature signs like a consumer testing their implementation would
+func consumerSignature(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSigningService_SignsPerConsumerAndRotates(t *testing.T) {
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "1")
+	t.Setenv("WEBHOOK_SIGNING_KEY_OVERLAP", "1h")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to test database")
+	require.NoError(t, db.AutoMigrate(&models.AuditLog{}, &models.WebhookDeadLetter{}, &models.WebhookConsumer{}, &models.WebhookSigningKey{}))
+	signing := services.NewWebhookSigningService(db)
+	webhooks := services.NewWebhookService(db)
+	webhooks.UseSigner(signing)
+	now := time.Now()
+
+	received := make(chan *http.Request, 4)
+	bodies := make(chan []byte, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	_, _, _, err = signing.CreateConsumer(services.WebhookConsumerInput{Name: "SIEM", URL: "ftp://siem.example.com"}, nil, now)
+	assert.ErrorIs(t, err, services.ErrInvalidWebhookConsumer)
+	consumer, first, firstSecret, err := signing.CreateConsumer(services.WebhookConsumerInput{Name: "SIEM", URL: server.URL + "/hook"}, nil, now)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(firstSecret, "whsec_"))
+	_, _, _, err = signing.CreateConsumer(services.WebhookConsumerInput{Name: "Other", URL: server.URL + "/hook"}, nil, now)
+	assert.ErrorIs(t, err, services.ErrInvalidWebhookConsumer, "one consumer per URL")
+
+	var stored models.WebhookSigningKey
+	require.NoError(t, db.Where("key_id = ?", first.KeyID).First(&stored).Error)
+	assert.NotContains(t, stored.Secret, firstSecret, "secrets are sealed at rest")
+
+	// Registered receivers get a signature their secret verifies; others get none
+	require.NoError(t, webhooks.Deliver(models.WebhookSourceJob, "job.completed", server.URL+"/hook", nil, map[string]string{"id": "1"}))
+	request, body := <-received, <-bodies
+	header := request.Header.Get(services.WebhookSignatureHeader)
+	parts := strings.Split(header, ",")
+	require.Len(t, parts, 2)
+	signedAt, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "t="), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, consumerSignature(firstSecret, time.Unix(signedAt, 0), body), header)
+	require.NoError(t, webhooks.Deliver(models.WebhookSourceJob, "job.completed", server.URL+"/other", nil, map[string]string{"id": "2"}))
+	request, _ = <-received, <-bodies
+	assert.Empty(t, request.Header.Get(services.WebhookSignatureHeader))
+
+	// The verification helper reports which key matched, without signing anything itself
+	sample := []byte(`{"event":"test"}`)
+	verification, err := signing.Verify(consumer.ID, sample, consumerSignature(firstSecret, now, sample), now)
+	require.NoError(t, err)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, first.KeyID, verification.KeyID)
+	verification, err = signing.Verify(consumer.ID, sample, consumerSignature("whsec_wrong", now, sample), now)
+	require.NoError(t, err)
+	assert.False(t, verification.Valid)
+	verification, err = signing.Verify(consumer.ID, sample, consumerSignature(firstSecret, now.Add(-time.Hour), sample), now)
+	require.NoError(t, err)
+	assert.False(t, verification.Valid, "stale timestamps are flagged")
+	assert.Equal(t, first.KeyID, verification.KeyID)
+
+	// During the overlap both keys sign and verify; afterwards only the new one
+	assert.ErrorIs(t, signing.RevokeKey(consumer.ID, first.KeyID, nil, now), services.ErrLastWebhookKey)
+	second, secondSecret, err := signing.RotateKey(consumer.ID, nil, now)
+	require.NoError(t, err)
+	headers, err := signing.SignatureHeaders(server.URL+"/hook", sample, now)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(headers[services.WebhookSignatureHeader], ","), 3)
+	verification, err = signing.Verify(consumer.ID, sample, consumerSignature(secondSecret, now, sample), now)
+	require.NoError(t, err)
+	assert.Equal(t, second.KeyID, verification.KeyID)
+
+	later := now.Add(2 * time.Hour)
+	verification, err = signing.Verify(consumer.ID, sample, consumerSignature(firstSecret, later, sample), later)
+	require.NoError(t, err)
+	assert.False(t, verification.Valid, "retired keys no longer verify")
+	reloaded, err := signing.GetConsumer(consumer.ID)
+	require.NoError(t, err)
+	require.Len(t, reloaded.Keys, 2)
+	assert.Equal(t, models.WebhookKeyRetiring, reloaded.Keys[1].Status, "verifying changes nothing")
+	retired, err := signing.RetireExpiredKeys(later)
+	require.NoError(t, err)
+	assert.Equal(t, 1, retired)
+	reloaded, err = signing.GetConsumer(consumer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.WebhookKeyRetired, reloaded.Keys[1].Status)
+
+	// A leaked key can be revoked immediately once another is signing
+	_, _, err = signing.RotateKey(consumer.ID, nil, later)
+	require.NoError(t, err)
+	require.NoError(t, signing.RevokeKey(consumer.ID, second.KeyID, nil, later))
+	assert.ErrorIs(t, signing.RevokeKey(consumer.ID, second.KeyID, nil, later), services.ErrWebhookKeyNotFound)
+	headers, err = signing.SignatureHeaders(server.URL+"/hook", sample, later)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(headers[services.WebhookSignatureHeader], ","), 2)
+
+	require.NoError(t, signing.DeleteConsumer(consumer.ID, nil))
+	_, err = signing.Verify(consumer.ID, sample, "", later)
+	assert.ErrorIs(t, err, services.ErrWebhookConsumerNotFound)
+}
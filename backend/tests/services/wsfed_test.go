@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cloudgate-backend/internal/services"
+	"cloudgate-backend/pkg/constants"
+	"cloudgate-backend/pkg/types"
+)
+
+func wsfedTestApp() *types.SaaSApplication {
+	return &types.SaaSApplication{
+		ID:       "legacy-portal",
+		Name:     "Legacy Portal",
+		Protocol: constants.ProtocolWSFed,
+		Config: map[string]string{
+			"realm":     "urn:legacy:portal",
+			"reply_url": "https://portal.example.com/_trust/",
+		},
+	}
+}
+
+func TestWSFederationService_CheckRequest(t *testing.T) {
+	service := services.NewWSFederationService()
+	app := wsfedTestApp()
+	valid := services.WSFedSignInRequest{Action: services.WSFedActionSignIn, Realm: "urn:legacy:portal"}
+
+	replyTo, err := service.CheckRequest(app, valid)
+	require.NoError(t, err)
+	assert.Equal(t, "https://portal.example.com/_trust/", replyTo, "replies default to the registered address")
+
+	withReply := valid
+	withReply.ReplyTo = "https://portal.example.com/_trust/"
+	_, err = service.CheckRequest(app, withReply)
+	assert.NoError(t, err)
+
+	for name, req := range map[string]services.WSFedSignInRequest{
+		"sign-out action": {Action: "wsignout1.0", Realm: "urn:legacy:portal"},
+		"other realm":     {Action: services.WSFedActionSignIn, Realm: "urn:other"},
+		"unregistered reply": {
+			Action: services.WSFedActionSignIn, Realm: "urn:legacy:portal", ReplyTo: "https://attacker.example/_trust/",
+		},
+	} {
+		_, err := service.CheckRequest(app, req)
+		assert.ErrorIs(t, err, services.ErrInvalidWSFedRequest, name)
+	}
+
+	oauthApp := wsfedTestApp()
+	oauthApp.Protocol = constants.ProtocolOAuth2
+	_, err = service.CheckRequest(oauthApp, valid)
+	assert.ErrorIs(t, err, services.ErrWSFedNotConfigured)
+}
+
+func TestWSFederationService_IssueSignInResponse(t *testing.T) {
+	service := services.NewWSFederationService()
+	now := time.Now()
+	req := services.WSFedSignInRequest{Action: services.WSFedActionSignIn, Realm: "urn:legacy:portal", Context: "rm=0&id=passive"}
+	subject := services.WSFedSubject{UserID: "u1", Email: "ada@example.com", Name: "Ada <Admin>", AAL: 2}
+
+	response, err := service.IssueSignInResponse(wsfedTestApp(), req, subject, now)
+	require.NoError(t, err)
+	assert.Equal(t, "https://portal.example.com/_trust/", response.ReplyTo)
+	assert.Equal(t, "rm=0&id=passive", response.Context)
+	assert.WithinDuration(t, now.Add(time.Hour), response.ExpiresAt, time.Second)
+
+	var rstr struct {
+		Token struct {
+			Assertion struct {
+				AssertionID string   `xml:"AssertionID,attr"`
+				Issuer      string   `xml:"Issuer,attr"`
+				Audience    string   `xml:"Conditions>AudienceRestrictionCondition>Audience"`
+				NameID      string   `xml:"AttributeStatement>Subject>NameIdentifier"`
+				Values      []string `xml:"AttributeStatement>Attribute>AttributeValue"`
+				AuthnStmt   struct {
+					Method string `xml:"AuthenticationMethod,attr"`
+				} `xml:"AuthenticationStatement"`
+			} `xml:"Assertion"`
+		} `xml:"RequestedSecurityToken"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(response.Result), &rstr), "the RSTR must be well-formed XML")
+	assertion := rstr.Token.Assertion
+	assert.Equal(t, response.AssertionID, assertion.AssertionID)
+	assert.Equal(t, service.Issuer(), assertion.Issuer)
+	assert.Equal(t, "urn:legacy:portal", assertion.Audience)
+	assert.Equal(t, "ada@example.com", assertion.NameID)
+	assert.Contains(t, assertion.Values, "Ada <Admin>")
+	assert.Equal(t, "http://schemas.microsoft.com/claims/multipleauthn", assertion.AuthnStmt.Method)
+
+	// Verify the enveloped signature the way a relying party would
+	signed := regexp.MustCompile(`<saml:Assertion .*</saml:Assertion>`).FindString(response.Result)
+	signature := regexp.MustCompile(`<ds:Signature .*</ds:Signature>`).FindString(signed)
+	require.NotEmpty(t, signature)
+	digest := sha256.Sum256([]byte(strings.Replace(signed, signature, "", 1)))
+	assert.Contains(t, signature, "<ds:DigestValue>"+base64.StdEncoding.EncodeToString(digest[:])+"</ds:DigestValue>")
+
+	signedInfo := regexp.MustCompile(`<ds:SignedInfo .*</ds:SignedInfo>`).FindString(signature)
+	signatureValue, err := base64.StdEncoding.DecodeString(regexp.MustCompile(`<ds:SignatureValue>(.*)</ds:SignatureValue>`).FindStringSubmatch(signature)[1])
+	require.NoError(t, err)
+	der, err := base64.StdEncoding.DecodeString(service.Certificate())
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	signedInfoHash := sha256.Sum256([]byte(signedInfo))
+	assert.NoError(t, rsa.VerifyPKCS1v15(certificate.PublicKey.(*rsa.PublicKey), crypto.SHA256, signedInfoHash[:], signatureValue))
+
+	assert.Contains(t, service.FederationMetadata("https://gate.example.com/wsfed"), service.Certificate())
+
+	// An app session policy ending sooner shortens the token
+	subject.NotOnOrAfter = now.Add(10 * time.Minute)
+	response, err = service.IssueSignInResponse(wsfedTestApp(), req, subject, now)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(10*time.Minute), response.ExpiresAt, time.Second)
+
+	subject.Email = ""
+	_, err = service.IssueSignInResponse(wsfedTestApp(), req, subject, now)
+	assert.ErrorIs(t, err, services.ErrInvalidWSFedRequest)
+}